@@ -1,9 +1,12 @@
 package main
 
 import (
+	"bufio"
 	"context"
+	"errors"
 	"flag"
 	"fmt"
+	"io"
 	"net/http"
 	"os"
 	"os/signal"
@@ -16,13 +19,17 @@ import (
 	"github.com/RoseOO/TapeBackarr/internal/config"
 	"github.com/RoseOO/TapeBackarr/internal/database"
 	"github.com/RoseOO/TapeBackarr/internal/encryption"
+	"github.com/RoseOO/TapeBackarr/internal/library"
 	"github.com/RoseOO/TapeBackarr/internal/logging"
 	"github.com/RoseOO/TapeBackarr/internal/models"
 	"github.com/RoseOO/TapeBackarr/internal/notifications"
+	"github.com/RoseOO/TapeBackarr/internal/preflight"
 	"github.com/RoseOO/TapeBackarr/internal/proxmox"
 	"github.com/RoseOO/TapeBackarr/internal/restore"
 	"github.com/RoseOO/TapeBackarr/internal/scheduler"
+	"github.com/RoseOO/TapeBackarr/internal/scratch"
 	"github.com/RoseOO/TapeBackarr/internal/tape"
+	"github.com/RoseOO/TapeBackarr/internal/updates"
 )
 
 var (
@@ -35,6 +42,11 @@ func main() {
 	configPath := flag.String("config", "/etc/tapebackarr/config.json", "Path to configuration file")
 	showVersion := flag.Bool("version", false, "Show version information")
 	initConfig := flag.Bool("init-config", false, "Create default configuration file")
+	decrypt := flag.Bool("decrypt", false, "Decrypt an encrypted backup stream from stdin to stdout (manual recovery)")
+	decryptKey := flag.String("key", "", "Base64 encryption key from the key sheet, used with -decrypt")
+	upgradeCheck := flag.Bool("upgrade-check", false, "List the database migrations this release would apply, without changing anything")
+	upgrade := flag.Bool("upgrade", false, "Snapshot the database and apply this release's migrations, then exit")
+	unlockUser := flag.String("unlock-user", "", "Unlock the account with this username after too many failed logins, then exit")
 	flag.Parse()
 
 	if *showVersion {
@@ -42,6 +54,14 @@ func main() {
 		os.Exit(0)
 	}
 
+	if *decrypt {
+		if err := decryptStream(os.Stdin, os.Stdout, *decryptKey); err != nil {
+			fmt.Fprintf(os.Stderr, "Decryption failed: %v\n", err)
+			os.Exit(1)
+		}
+		os.Exit(0)
+	}
+
 	// Load configuration
 	cfg, err := config.Load(*configPath)
 	if err != nil {
@@ -58,6 +78,22 @@ func main() {
 		os.Exit(0)
 	}
 
+	if *upgradeCheck || *upgrade {
+		if err := runUpgrade(os.Stdout, cfg, *upgradeCheck); err != nil {
+			fmt.Fprintf(os.Stderr, "Upgrade failed: %v\n", err)
+			os.Exit(1)
+		}
+		os.Exit(0)
+	}
+
+	if *unlockUser != "" {
+		if err := runUnlockUser(os.Stdout, cfg, *unlockUser); err != nil {
+			fmt.Fprintf(os.Stderr, "Unlock failed: %v\n", err)
+			os.Exit(1)
+		}
+		os.Exit(0)
+	}
+
 	// Initialize logger
 	logger, err := logging.NewLogger(cfg.Logging.Level, cfg.Logging.Format, cfg.Logging.OutputPath)
 	if err != nil {
@@ -70,40 +106,144 @@ func main() {
 		"version": version,
 		"config":  *configPath,
 	})
+	for _, warning := range cfg.Warnings {
+		logger.Warn("Configuration: "+warning, map[string]interface{}{"config": *configPath})
+	}
 
-	// Initialize database
-	db, err := database.New(cfg.Database.Path)
+	// Initialize database, falling back to the newest local snapshot if it
+	// is corrupt
+	snapshotDir := cfg.Database.SnapshotDir
+	if snapshotDir == "" {
+		snapshotDir = database.DefaultSnapshotDir(cfg.Database.Path)
+	}
+	db, recovery, err := database.OpenChecked(cfg.Database.Path, snapshotDir)
 	if err != nil {
 		logger.Error("Failed to initialize database", map[string]interface{}{"error": err.Error()})
 		os.Exit(1)
 	}
 	defer db.Close()
+	if recovery != nil && recovery.Snapshot != "" {
+		logger.Error("Database was corrupt and has been restored from a local snapshot", map[string]interface{}{
+			"problems":     recovery.Problems,
+			"snapshot":     recovery.Snapshot,
+			"corrupt_path": recovery.CorruptPath,
+		})
+	} else if recovery != nil {
+		logger.Error("Database is corrupt and no usable local snapshot was found; restore it from a tape database backup", map[string]interface{}{
+			"problems": recovery.Problems,
+		})
+	}
 
-	// Run migrations
-	if err := db.Migrate(); err != nil {
-		logger.Error("Failed to run migrations", map[string]interface{}{"error": err.Error()})
+	// Run migrations, snapshotting the database first when an upgrade
+	// brings new ones
+	upgraded, err := db.Upgrade(snapshotDir)
+	if errors.Is(err, database.ErrSchemaTooNew) {
+		// Running an older release after a downgrade mostly works, but
+		// anything the newer schema added is ignored
+		logger.Warn("Database schema is newer than this release", map[string]interface{}{"error": err.Error()})
+	} else if err != nil {
+		fields := map[string]interface{}{"error": err.Error()}
+		if upgraded != nil && upgraded.RolledBack {
+			fields["snapshot"] = upgraded.Snapshot.Path
+		}
+		logger.Error("Failed to run migrations", fields)
 		os.Exit(1)
 	}
+	if len(upgraded.Applied) > 0 && upgraded.Snapshot != nil {
+		logger.Info("Database upgraded", map[string]interface{}{
+			"from_version": upgraded.FromVersion,
+			"to_version":   upgraded.ToVersion,
+			"snapshot":     upgraded.Snapshot.Path,
+		})
+	}
 
 	logger.Info("Database initialized", map[string]interface{}{"path": cfg.Database.Path})
 
+	// Prepare the scratch directory and remove temp files left by a previous run
+	scratchDir := scratch.New(cfg.Scratch.Dir, cfg.Scratch.MinFreeMB)
+	if err := scratchDir.Ensure(); err != nil {
+		logger.Warn("Failed to create scratch directory", map[string]interface{}{"path": scratchDir.Root(), "error": err.Error()})
+	}
+	if removed, err := scratchDir.CleanOrphans(); err != nil {
+		logger.Warn("Failed to clean orphaned scratch files", map[string]interface{}{"path": scratchDir.Root(), "error": err.Error()})
+	} else if len(removed) > 0 {
+		logger.Info("Removed orphaned scratch files", map[string]interface{}{"path": scratchDir.Root(), "count": len(removed)})
+	}
+
 	// Initialize services
 	tapeService := tape.NewService(cfg.Tape.DefaultDevice, cfg.Tape.BlockSize)
 	authService := auth.NewService(db, cfg.Auth.JWTSecret, cfg.Auth.TokenExpiration)
+	authService.SetMaxFailedLogins(cfg.Auth.MaxFailedLogins)
+	authService.SetLockoutDuration(time.Duration(cfg.Auth.LockoutMinutes) * time.Minute)
 
 	// Initialize notification service
 	telegramService := notifications.NewTelegramService(notifications.TelegramConfig{
 		Enabled:  cfg.Notifications.Telegram.Enabled,
 		BotToken: cfg.Notifications.Telegram.BotToken,
 		ChatID:   cfg.Notifications.Telegram.ChatID,
+		Language: cfg.Notifications.Telegram.Language,
 	})
 
 	if telegramService.IsEnabled() {
 		logger.Info("Telegram notifications enabled", nil)
 	}
+	emailService := notifications.NewEmailService(notifications.EmailConfig{
+		Enabled:    cfg.Notifications.Email.Enabled,
+		SMTPHost:   cfg.Notifications.Email.SMTPHost,
+		SMTPPort:   cfg.Notifications.Email.SMTPPort,
+		Username:   cfg.Notifications.Email.Username,
+		Password:   cfg.Notifications.Email.Password,
+		FromEmail:  cfg.Notifications.Email.FromEmail,
+		FromName:   cfg.Notifications.Email.FromName,
+		ToEmails:   cfg.Notifications.Email.ToEmails,
+		UseTLS:     cfg.Notifications.Email.UseTLS,
+		StartTLS:   cfg.Notifications.Email.StartTLS,
+		SkipVerify: cfg.Notifications.Email.SkipVerify,
+		Language:   cfg.Notifications.Email.Language,
+	})
+
+	// Job notifications go to each job's owner and recipients, or to the
+	// global chat and addresses when the job has none
+	jobNotifier := notifications.NewJobNotifier(telegramService, emailService)
+
+	// Jobs and restores fetch tapes held in library slots themselves
+	libraryLoader := library.NewLoader(db, logger)
+
+	// Check access to the drives, changers and tools as the user we run as,
+	// so missing permissions show up now rather than in the first job.
+	// Changers that cannot be used are left to the operator.
+	if targets, err := preflight.LoadTargets(db); err != nil {
+		logger.Warn("Failed to read drives and libraries for the access check", map[string]interface{}{"error": err.Error()})
+	} else {
+		report := preflight.Run(targets)
+		libraryLoader.SetUnavailable(report.UnavailableChangers)
+		for _, c := range report.Problems() {
+			fields := map[string]interface{}{"kind": c.Kind, "name": c.Name, "feature": c.Feature, "error": c.Error, "hint": c.Hint}
+			if c.Required {
+				logger.Warn("Access check failed", fields)
+			} else {
+				logger.Info("Optional tool not available", fields)
+			}
+		}
+		if len(report.Disabled) > 0 {
+			logger.Warn("Features disabled until the access problems are fixed", map[string]interface{}{"features": report.Disabled, "user": report.User})
+		}
+	}
 
 	// Create backup service
 	backupService := backup.NewService(db, tapeService, logger, cfg.Tape.BlockSize, cfg.Tape.BufferSizeMB, cfg.Tape.PipelineDepthMB)
+	backupService.SetScratchDir(scratchDir)
+	backupService.SetMediaCheck(cfg.Tape.MediaCheck)
+	backupService.SetWriteRetries(cfg.Tape.WriteRetries)
+	backupService.SetLibraryLoader(libraryLoader)
+	if err := backupService.ClearDriveReservations(); err != nil {
+		logger.Warn("Failed to clear stale drive reservations", map[string]interface{}{"error": err.Error()})
+	}
+	go func() {
+		if _, err := backupService.ClassifyCatalog(context.Background()); err != nil {
+			logger.Warn("Failed to classify catalog entries", map[string]interface{}{"error": err.Error()})
+		}
+	}()
 	backupService.TapeChangeCallback = func(ctx context.Context, jobName, currentTape, reason, nextTape string) {
 		telegramService.NotifyTapeChangeRequired(ctx, jobName, currentTape, reason, nextTape)
 	}
@@ -113,33 +253,52 @@ func main() {
 
 	// Create restore service
 	restoreService := restore.NewService(db, tapeService, logger, cfg.Tape.BlockSize)
+	restoreService.SetScratchDir(scratchDir)
+	restoreService.SetLibraryLoader(libraryLoader)
+	restoreService.SetRateLimit(cfg.Restore.RateLimitMBps)
 
 	// Create encryption service
 	encryptionService := encryption.NewService(db, logger)
 
+	// With the backup window report enabled, successful runs are summarized
+	// once per window and only failures are announced as they happen
+	suppressJobMessages := cfg.Notifications.BackupWindow.Enabled && cfg.Notifications.BackupWindow.SuppressJobMessages
+
 	// Create job runner for scheduler
 	jobRunner := func(ctx context.Context, job *models.BackupJob) error {
+		// Notifications still go out when the run is cancelled by a shutdown
+		notifyCtx := context.WithoutCancel(ctx)
+
+		recipients, err := backupService.JobRecipients(job.ID)
+		if err != nil {
+			logger.Warn("Failed to resolve job notification recipients", map[string]interface{}{"job_id": job.ID, "error": err.Error()})
+		}
+
 		// Get source
 		var source models.BackupSource
-		err := db.QueryRow(`
-			SELECT id, name, source_type, path, include_patterns, exclude_patterns
+		err = db.QueryRow(`
+			SELECT id, name, source_type, path, include_patterns, exclude_patterns, symlink_policy
 			FROM backup_sources WHERE id = ?
 		`, job.SourceID).Scan(&source.ID, &source.Name, &source.SourceType, &source.Path,
-			&source.IncludePatterns, &source.ExcludePatterns)
+			&source.IncludePatterns, &source.ExcludePatterns, &source.SymlinkPolicy)
 		if err != nil {
 			// Notify on failure
-			telegramService.NotifyBackupFailed(ctx, job.Name, fmt.Sprintf("source not found: %v", err))
+			jobNotifier.NotifyBackupFailed(notifyCtx, recipients, job.Name, fmt.Sprintf("source not found: %v", err))
 			return fmt.Errorf("source not found: %w", err)
 		}
 
-		// Get an available tape from the pool
-		var tapeID int64
-		var tapeLabel string
-		err = db.QueryRow(`
-			SELECT id, label FROM tapes 
-			WHERE pool_id = ? AND status IN ('blank', 'active')
-			ORDER BY used_bytes ASC LIMIT 1
-		`, job.PoolID).Scan(&tapeID, &tapeLabel)
+		// Get an available tape from the pool, preferring the one loaded in
+		// the job's drive when it is pinned to one, then one a library can
+		// fetch; RunBackup loads it from its slot
+		tapeID, tapeLabel, err := backupService.TapeInJobDrive(job.ID, job.PoolID)
+		if err != nil {
+			err = db.QueryRow(`
+				SELECT id, label FROM tapes 
+				WHERE pool_id = ? AND status IN ('blank', 'active')
+				AND id NOT IN (SELECT tape_id FROM tape_reservations WHERE job_id != ? AND expires_at > datetime('now'))
+				ORDER BY `+library.InSlotOrder+` DESC, used_bytes ASC LIMIT 1
+			`, job.PoolID, job.ID).Scan(&tapeID, &tapeLabel)
+		}
 		if err != nil {
 			// Look up the next candidate tape label for the notification
 			var nextTapeLabel string
@@ -150,29 +309,43 @@ func main() {
 			`, job.PoolID).Scan(&nextTapeLabel)
 
 			// Notify that tape change is required, including the next expected tape
-			telegramService.NotifyTapeChangeRequired(ctx, job.Name, "", "no available tape in pool", nextTapeLabel)
+			telegramService.NotifyTapeChangeRequired(notifyCtx, job.Name, "", "no available tape in pool", nextTapeLabel)
 			return fmt.Errorf("no available tape in pool: %w", err)
 		}
 
 		// Notify backup started
-		telegramService.NotifyBackupStarted(ctx, job.Name, 1, string(job.BackupType))
+		if !suppressJobMessages {
+			jobNotifier.NotifyBackupStarted(notifyCtx, recipients, job.Name, 1, string(job.BackupType))
+		}
 
 		startTime := time.Now()
 		result, err := backupService.RunBackup(ctx, job, &source, tapeID, job.BackupType)
 		if err != nil {
-			telegramService.NotifyBackupFailed(ctx, job.Name, err.Error())
+			jobNotifier.NotifyBackupFailed(notifyCtx, recipients, job.Name, err.Error())
 			return err
 		}
 
 		// Notify backup completed
 		duration := time.Since(startTime)
-		telegramService.NotifyBackupCompleted(ctx, job.Name, result.FileCount, result.TotalBytes, duration)
+		if !suppressJobMessages {
+			jobNotifier.NotifyBackupCompleted(notifyCtx, recipients, job.Name, result.FileCount, result.TotalBytes, duration)
+		}
 
 		return nil
 	}
 
-	// Create scheduler
+	// Create scheduler. Runs still going at shutdown get a grace period and
+	// are then checkpointed or cancelled.
 	schedulerService := scheduler.NewService(db, logger, jobRunner)
+	shutdownPolicy := scheduler.ShutdownPolicy{Grace: time.Duration(cfg.Scheduler.ShutdownGraceSeconds) * time.Second}
+	switch cfg.Scheduler.ShutdownAction {
+	case config.ShutdownCheckpoint:
+		shutdownPolicy.Checkpoint = func(jobID int64) { backupService.CheckpointJob(jobID) }
+	case "", config.ShutdownCancel:
+	default:
+		logger.Warn("Unknown scheduler.shutdown_action, running jobs will be cancelled at shutdown", map[string]interface{}{"shutdown_action": cfg.Scheduler.ShutdownAction})
+	}
+	schedulerService.SetShutdownPolicy(shutdownPolicy)
 
 	// Initialize Proxmox services if configured
 	var proxmoxClient *proxmox.Client
@@ -205,6 +378,8 @@ func main() {
 		} else {
 			proxmoxBackupService = proxmox.NewBackupService(proxmoxClient, db, tapeService, logger, cfg.Tape.BlockSize)
 			proxmoxRestoreService = proxmox.NewRestoreService(proxmoxClient, db, tapeService, logger, cfg.Tape.BlockSize)
+			proxmoxBackupService.SetScratchDir(scratchDir)
+			proxmoxRestoreService.SetScratchDir(scratchDir)
 
 			if cfg.Proxmox.TempDir != "" {
 				proxmoxBackupService.SetTempDir(cfg.Proxmox.TempDir)
@@ -233,6 +408,8 @@ func main() {
 		cfg,
 	)
 
+	server.SetUpdateChecker(updates.NewChecker(db, version, cfg.Updates))
+
 	// Start scheduler
 	if err := schedulerService.Start(); err != nil {
 		logger.Error("Failed to start scheduler", map[string]interface{}{"error": err.Error()})
@@ -257,6 +434,26 @@ func main() {
 		}
 	}()
 
+	// Start the monitoring listener for /metrics and /health
+	monitoringServer, err := server.NewMonitoringServer(cfg.Monitoring)
+	if err != nil {
+		logger.Error("Monitoring listener not started", map[string]interface{}{"error": err.Error()})
+	}
+	if monitoringServer != nil {
+		go func() {
+			logger.Info("Starting monitoring listener", map[string]interface{}{"address": monitoringServer.Addr, "tls": monitoringServer.TLSConfig != nil})
+			var err error
+			if monitoringServer.TLSConfig != nil {
+				err = monitoringServer.ListenAndServeTLS("", "")
+			} else {
+				err = monitoringServer.ListenAndServe()
+			}
+			if err != http.ErrServerClosed {
+				logger.Error("Monitoring listener error", map[string]interface{}{"error": err.Error()})
+			}
+		}()
+	}
+
 	// Wait for shutdown signal
 	sigChan := make(chan os.Signal, 1)
 	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
@@ -275,6 +472,26 @@ func main() {
 	if err := httpServer.Shutdown(ctx); err != nil {
 		logger.Error("HTTP server shutdown error", map[string]interface{}{"error": err.Error()})
 	}
+	if monitoringServer != nil {
+		monitoringServer.Shutdown(ctx)
+	}
 
 	logger.Info("TapeBackarr shutdown complete", nil)
 }
+
+// decryptStream decrypts a backup stream read from a tape (or a dd image of
+// one) so it can be piped into tar without a running TapeBackarr instance.
+func decryptStream(in io.Reader, out io.Writer, keyBase64 string) error {
+	if keyBase64 == "" {
+		return fmt.Errorf("-key is required")
+	}
+	dec, err := encryption.NewBackupDecryptingReader(bufio.NewReaderSize(in, 1024*1024), keyBase64, nil)
+	if err != nil {
+		return err
+	}
+	bw := bufio.NewWriterSize(out, 1024*1024)
+	if _, err := io.Copy(bw, dec); err != nil {
+		return err
+	}
+	return bw.Flush()
+}
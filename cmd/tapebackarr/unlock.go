@@ -0,0 +1,29 @@
+package main
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/RoseOO/TapeBackarr/internal/auth"
+	"github.com/RoseOO/TapeBackarr/internal/config"
+	"github.com/RoseOO/TapeBackarr/internal/database"
+)
+
+// runUnlockUser clears the lock and failed login count of an account, for
+// when every admin is locked out and the API cannot be used to unlock one
+func runUnlockUser(out io.Writer, cfg *config.Config, username string) error {
+	db, err := database.New(cfg.Database.Path)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	if err := db.Migrate(); err != nil {
+		return err
+	}
+
+	if err := auth.NewService(db, cfg.Auth.JWTSecret, cfg.Auth.TokenExpiration).UnlockUsername(username); err != nil {
+		return fmt.Errorf("%s: %w", username, err)
+	}
+	fmt.Fprintf(out, "Unlocked %s\n", username)
+	return nil
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/RoseOO/TapeBackarr/internal/config"
+	"github.com/RoseOO/TapeBackarr/internal/database"
+)
+
+// runUpgrade lists the migrations this release would apply to the
+// configured database, or with checkOnly false applies them after a
+// pre-upgrade snapshot. Run it with the service stopped, after installing
+// a new release and before starting it.
+func runUpgrade(out io.Writer, cfg *config.Config, checkOnly bool) error {
+	db, err := database.New(cfg.Database.Path)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	current, err := db.SchemaVersion()
+	if err != nil {
+		return err
+	}
+	pending, err := db.PendingMigrations()
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(out, "TapeBackarr v%s, database %s at schema version %d\n", version, cfg.Database.Path, current)
+	if len(pending) == 0 {
+		fmt.Fprintln(out, "No migrations to apply.")
+		if migrations, err := database.Migrations(); err == nil && len(migrations) > 0 && current > migrations[len(migrations)-1].Version {
+			return fmt.Errorf("%w: this release knows up to schema version %d", database.ErrSchemaTooNew, migrations[len(migrations)-1].Version)
+		}
+		return nil
+	}
+	fmt.Fprintf(out, "%d migrations to apply:\n", len(pending))
+	for _, m := range pending {
+		fmt.Fprintf(out, "  %s\n", m.Name)
+	}
+	if checkOnly {
+		return nil
+	}
+
+	snapshotDir := cfg.Database.SnapshotDir
+	if snapshotDir == "" {
+		snapshotDir = database.DefaultSnapshotDir(cfg.Database.Path)
+	}
+	result, err := db.Upgrade(snapshotDir)
+	if result != nil && result.Snapshot != nil {
+		fmt.Fprintf(out, "Pre-upgrade snapshot: %s\n", result.Snapshot.Path)
+	}
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(out, "Database upgraded from schema version %d to %d.\n", result.FromVersion, result.ToVersion)
+	return nil
+}
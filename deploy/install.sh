@@ -145,6 +145,8 @@ if [ ! -f "$CONFIG_DIR/config.json" ]; then
     
     # Generate a random JWT secret
     JWT_SECRET=$(openssl rand -base64 32 2>/dev/null || head -c 32 /dev/urandom | base64)
+    # and a separate key for the credentials store
+    CREDENTIALS_KEY=$(openssl rand -base64 32 2>/dev/null || head -c 32 /dev/urandom | base64)
     
     cat > "$CONFIG_DIR/config.json" << EOF
 {
@@ -167,7 +169,7 @@ if [ ! -f "$CONFIG_DIR/config.json" ]; then
     ],
     "buffer_size_mb": 512,
     "block_size": 262144,
-    "write_retries": 3,
+    "write_retries": 0,
     "verify_after_write": true
   },
   "logging": {
@@ -177,6 +179,7 @@ if [ ! -f "$CONFIG_DIR/config.json" ]; then
   },
   "auth": {
     "jwt_secret": "$JWT_SECRET",
+    "credentials_key": "$CREDENTIALS_KEY",
     "token_expiration": 24,
     "session_timeout": 60
   },
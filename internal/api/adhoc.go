@@ -0,0 +1,213 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/RoseOO/TapeBackarr/internal/models"
+	"github.com/RoseOO/TapeBackarr/internal/validation"
+)
+
+// handleRunAdHocBackup runs an immediate one-off backup of a path. No job or
+// source shows up in the lists: they are recorded as hidden ad-hoc rows so
+// the backup set is catalogued, browsable and restorable like any other.
+func (s *Server) handleRunAdHocBackup(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Name              string               `json:"name"`
+		Path              string               `json:"path"`
+		IncludePatterns   []string             `json:"include_patterns"`
+		ExcludePatterns   []string             `json:"exclude_patterns"`
+		SymlinkPolicy     models.SymlinkPolicy `json:"symlink_policy"`
+		PoolID            int64                `json:"pool_id"`
+		TapeID            int64                `json:"tape_id"`
+		RetentionDays     int                  `json:"retention_days"`
+		Compression       string               `json:"compression"`
+		EncryptionKeyID   *int64               `json:"encryption_key_id"`
+		HwEncryptionKeyID *int64               `json:"hw_encryption_key_id"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		s.respondError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+
+	if req.SymlinkPolicy == "" {
+		req.SymlinkPolicy = models.SymlinkStore
+	}
+	compression := req.Compression
+	if compression == "" {
+		compression = "none"
+	}
+	v := validation.New()
+	if !filepath.IsAbs(req.Path) {
+		v.Add("path", "must be an absolute path")
+	} else if info, err := os.Stat(req.Path); err != nil || !info.IsDir() {
+		v.Add("path", "does not exist or is not a directory")
+	}
+	if req.PoolID == 0 && req.TapeID == 0 {
+		v.Add("pool_id", "pool_id or tape_id is required")
+	}
+	v.NonNegative("retention_days", int64(req.RetentionDays))
+	v.OneOf("symlink_policy", string(req.SymlinkPolicy), symlinkPolicies...)
+	v.OneOf("compression", compression, compressionTypes...)
+	if err := v.Err(); err != nil {
+		s.respondValidationError(w, err)
+		return
+	}
+	req.Path = filepath.Clean(req.Path)
+
+	encryptionEnabled := false
+	if req.EncryptionKeyID != nil && *req.EncryptionKeyID > 0 {
+		if _, err := s.encryptionService.GetKey(r.Context(), *req.EncryptionKeyID); err != nil {
+			s.respondError(w, http.StatusBadRequest, "encryption key not found")
+			return
+		}
+		encryptionEnabled = true
+	}
+	hwEncryptionEnabled := false
+	if req.HwEncryptionKeyID != nil && *req.HwEncryptionKeyID > 0 {
+		if _, err := s.encryptionService.GetKey(r.Context(), *req.HwEncryptionKeyID); err != nil {
+			s.respondError(w, http.StatusBadRequest, "hardware encryption key not found")
+			return
+		}
+		hwEncryptionEnabled = true
+	}
+
+	// Pick the tape before recording anything so a full pool leaves no rows behind
+	tapeID := req.TapeID
+	var tapeLabel string
+	if tapeID == 0 {
+		var err error
+		tapeID, tapeLabel, err = s.selectTapeFromPool(req.PoolID, req.RetentionDays)
+		if err != nil {
+			s.respondError(w, http.StatusBadRequest, fmt.Sprintf("no suitable tape found in pool: %v", err))
+			return
+		}
+	} else {
+		var tapePoolID int64
+		if err := s.db.QueryRow("SELECT label, COALESCE(pool_id, 0) FROM tapes WHERE id = ?", tapeID).Scan(&tapeLabel, &tapePoolID); err != nil {
+			s.respondError(w, http.StatusBadRequest, "tape not found")
+			return
+		}
+		if tapePoolID == 0 || (req.PoolID != 0 && req.PoolID != tapePoolID) {
+			s.respondError(w, http.StatusBadRequest, "tape must belong to the requested pool")
+			return
+		}
+		req.PoolID = tapePoolID
+	}
+	if err := s.backupService.CheckTapeWritable(tapeID); err != nil {
+		s.respondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	name := req.Name
+	if name == "" {
+		name = fmt.Sprintf("Ad-hoc %s %s", req.Path, time.Now().Format("2006-01-02 15:04"))
+	}
+	if req.IncludePatterns == nil {
+		req.IncludePatterns = []string{}
+	}
+	if req.ExcludePatterns == nil {
+		req.ExcludePatterns = []string{}
+	}
+	includeJSON, _ := json.Marshal(req.IncludePatterns)
+	excludeJSON, _ := json.Marshal(req.ExcludePatterns)
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		s.respondError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec(`
+		INSERT INTO backup_sources (name, source_type, path, include_patterns, exclude_patterns, symlink_policy, enabled, ad_hoc)
+		VALUES (?, ?, ?, ?, ?, ?, 1, 1)
+	`, name, models.SourceTypeLocal, req.Path, string(includeJSON), string(excludeJSON), req.SymlinkPolicy)
+	if err != nil {
+		s.respondError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	sourceID, _ := result.LastInsertId()
+
+	result, err = tx.Exec(`
+		INSERT INTO backup_jobs (name, source_id, pool_id, backup_type, schedule_cron, retention_days, enabled,
+			encryption_enabled, encryption_key_id, hw_encryption_enabled, hw_encryption_key_id, compression, ad_hoc)
+		VALUES (?, ?, ?, ?, '', ?, 0, ?, ?, ?, ?, ?, 1)
+	`, name, sourceID, req.PoolID, models.BackupTypeFull, req.RetentionDays,
+		encryptionEnabled, req.EncryptionKeyID, hwEncryptionEnabled, req.HwEncryptionKeyID, compression)
+	if err != nil {
+		s.respondError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	jobID, _ := result.LastInsertId()
+
+	if err := tx.Commit(); err != nil {
+		s.respondError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if err := s.backupService.ReserveTape(tapeID, jobID); err != nil {
+		s.respondReserveError(w, err)
+		return
+	}
+
+	job := models.BackupJob{
+		ID:                  jobID,
+		Name:                name,
+		SourceID:            sourceID,
+		PoolID:              req.PoolID,
+		BackupType:          models.BackupTypeFull,
+		RetentionDays:       req.RetentionDays,
+		EncryptionEnabled:   encryptionEnabled,
+		EncryptionKeyID:     req.EncryptionKeyID,
+		HwEncryptionEnabled: hwEncryptionEnabled,
+		HwEncryptionKeyID:   req.HwEncryptionKeyID,
+		Compression:         models.CompressionType(compression),
+	}
+	source := models.BackupSource{
+		ID:              sourceID,
+		Name:            name,
+		SourceType:      models.SourceTypeLocal,
+		Path:            req.Path,
+		IncludePatterns: string(includeJSON),
+		ExcludePatterns: string(excludeJSON),
+		SymlinkPolicy:   req.SymlinkPolicy,
+		Enabled:         true,
+	}
+
+	go func() {
+		defer func() {
+			if r := recover(); r != nil {
+				if s.logger != nil {
+					s.logger.Error("Panic in backup goroutine", map[string]interface{}{
+						"job_id": job.ID,
+						"panic":  fmt.Sprintf("%v", r),
+					})
+				}
+			}
+		}()
+		ctx := context.Background()
+		if _, err := s.backupService.RunBackup(ctx, &job, &source, tapeID, models.BackupTypeFull); err != nil {
+			s.logger.Error("Ad-hoc backup failed", map[string]interface{}{
+				"job_id":   job.ID,
+				"job_name": job.Name,
+				"error":    err.Error(),
+			})
+		}
+	}()
+
+	s.auditLog(r, "run", "backup_job", jobID, fmt.Sprintf("Started ad-hoc backup of %s", req.Path))
+
+	s.respondJSON(w, http.StatusAccepted, map[string]interface{}{
+		"status":     "started",
+		"message":    fmt.Sprintf("Ad-hoc backup of %s started using tape %s", req.Path, tapeLabel),
+		"job_id":     jobID,
+		"source_id":  sourceID,
+		"tape_id":    tapeID,
+		"tape_label": tapeLabel,
+	})
+}
@@ -0,0 +1,670 @@
+package api
+
+import (
+	"context"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/RoseOO/TapeBackarr/internal/auth"
+	"github.com/RoseOO/TapeBackarr/internal/library"
+	"github.com/RoseOO/TapeBackarr/internal/models"
+	"github.com/RoseOO/TapeBackarr/internal/restore"
+)
+
+// Artifact recall statuses
+const (
+	recallQueued    = "queued"
+	recallWaiting   = "waiting" // the tape is neither loaded nor in a library slot
+	recallRecalling = "recalling"
+	recallReady     = "ready"
+	recallFailed    = "failed"
+	recallExpired   = "expired"
+)
+
+const (
+	// defaultRecallTTLHours is how long a recalled artifact can be downloaded
+	defaultRecallTTLHours = 24
+	maxRecallTTLHours     = 7 * 24
+	// artifactRecallTimeout bounds a single recall, including waiting for the
+	// drive to report the right tape
+	artifactRecallTimeout = 6 * time.Hour
+)
+
+// artifactRecallPollInterval is how often recalls waiting for an operator to
+// load their tape are retried
+var artifactRecallPollInterval = 30 * time.Second
+
+// artifactRecallState tracks the recall worker. A single worker drains the
+// queue so recalls never compete with each other for drives.
+type artifactRecallState struct {
+	mu      sync.Mutex
+	running bool
+	wake    chan struct{}
+	current int64 // recall being extracted
+	cancel  context.CancelFunc
+}
+
+// artifactInfo describes a cataloged artifact and where it lives on tape
+type artifactInfo struct {
+	ID          int64      `json:"id"`
+	BackupSetID int64      `json:"backup_set_id"`
+	JobID       int64      `json:"job_id"`
+	JobName     string     `json:"job_name"`
+	Path        string     `json:"path"`
+	Size        int64      `json:"size"`
+	ModTime     *time.Time `json:"mod_time,omitempty"`
+	Checksum    string     `json:"checksum,omitempty"`
+	TapeID      int64      `json:"tape_id"`
+	TapeLabel   string     `json:"tape_label"`
+	SetStatus   string     `json:"backup_set_status"`
+	Loaded      bool       `json:"loaded"`     // the tape is in a drive
+	InLibrary   bool       `json:"in_library"` // the tape is in a library slot
+	CreatedAt   time.Time  `json:"created_at"`
+}
+
+// artifactRecall is a queued or finished recall of an artifact
+type artifactRecall struct {
+	ID          int64      `json:"id"`
+	ArtifactID  int64      `json:"artifact_id"`
+	BackupSetID int64      `json:"backup_set_id"`
+	Path        string     `json:"path"`
+	Size        int64      `json:"size"`
+	Status      string     `json:"status"`
+	Error       string     `json:"error,omitempty"`
+	TTLHours    int        `json:"ttl_hours"`
+	DownloadURL string     `json:"download_url,omitempty"`
+	RequestedBy *int64     `json:"requested_by,omitempty"`
+	RequestedAt time.Time  `json:"requested_at"`
+	StartedAt   *time.Time `json:"started_at,omitempty"`
+	ReadyAt     *time.Time `json:"ready_at,omitempty"`
+	ExpiresAt   *time.Time `json:"expires_at,omitempty"`
+
+	stagedPath string
+	token      string
+}
+
+const artifactRecallColumns = `id, catalog_entry_id, backup_set_id, file_path, file_size, status, error,
+	ttl_hours, requested_by, requested_at, started_at, ready_at, expires_at, staged_path, COALESCE(download_token, '')`
+
+func scanArtifactRecall(row interface{ Scan(...interface{}) error }) (*artifactRecall, error) {
+	var rc artifactRecall
+	var requestedBy sql.NullInt64
+	var startedAt, readyAt, expiresAt sql.NullTime
+	err := row.Scan(&rc.ID, &rc.ArtifactID, &rc.BackupSetID, &rc.Path, &rc.Size, &rc.Status, &rc.Error,
+		&rc.TTLHours, &requestedBy, &rc.RequestedAt, &startedAt, &readyAt, &expiresAt, &rc.stagedPath, &rc.token)
+	if err != nil {
+		return nil, err
+	}
+	if requestedBy.Valid {
+		rc.RequestedBy = &requestedBy.Int64
+	}
+	if startedAt.Valid {
+		rc.StartedAt = &startedAt.Time
+	}
+	if readyAt.Valid {
+		rc.ReadyAt = &readyAt.Time
+	}
+	if expiresAt.Valid {
+		rc.ExpiresAt = &expiresAt.Time
+	}
+	if rc.Status == recallReady && rc.token != "" {
+		rc.DownloadURL = "/api/v1/artifact-downloads/" + rc.token
+	}
+	return &rc, nil
+}
+
+func (s *Server) getArtifactRecall(id int64) (*artifactRecall, error) {
+	return scanArtifactRecall(s.db.QueryRow("SELECT "+artifactRecallColumns+" FROM artifact_recalls WHERE id = ?", id))
+}
+
+// handleGetArtifact returns a cataloged artifact and the tape holding it
+func (s *Server) handleGetArtifact(w http.ResponseWriter, r *http.Request) {
+	id, err := s.getIDParam(r)
+	if err != nil {
+		s.respondError(w, http.StatusBadRequest, "invalid artifact id")
+		return
+	}
+
+	var a artifactInfo
+	var modTime sql.NullTime
+	var checksum sql.NullString
+	err = s.db.QueryRow(`
+		SELECT ce.id, ce.backup_set_id, bs.job_id, COALESCE(bj.name, ''), ce.file_path, ce.file_size,
+			ce.mod_time, ce.checksum, bs.tape_id, t.label, bs.status, ce.created_at
+		FROM catalog_entries ce
+		JOIN backup_sets bs ON ce.backup_set_id = bs.id
+		JOIN tapes t ON bs.tape_id = t.id
+		LEFT JOIN backup_jobs bj ON bs.job_id = bj.id
+		WHERE ce.id = ?
+	`, id).Scan(&a.ID, &a.BackupSetID, &a.JobID, &a.JobName, &a.Path, &a.Size,
+		&modTime, &checksum, &a.TapeID, &a.TapeLabel, &a.SetStatus, &a.CreatedAt)
+	if err != nil {
+		s.respondError(w, http.StatusNotFound, "artifact not found")
+		return
+	}
+	if modTime.Valid {
+		a.ModTime = &modTime.Time
+	}
+	a.Checksum = checksum.String
+
+	var n int
+	s.db.QueryRow("SELECT COUNT(*) FROM tape_drives WHERE current_tape_id = ? AND enabled = 1", a.TapeID).Scan(&n)
+	a.Loaded = n > 0
+	s.db.QueryRow("SELECT COUNT(*) FROM tape_library_slots WHERE tape_id = ? AND slot_type = 'storage'", a.TapeID).Scan(&n)
+	a.InLibrary = n > 0
+
+	s.respondJSON(w, http.StatusOK, a)
+}
+
+// handleRecallArtifact queues the recall of an artifact from tape. An open
+// recall of the same artifact is returned instead of queueing another one.
+func (s *Server) handleRecallArtifact(w http.ResponseWriter, r *http.Request) {
+	id, err := s.getIDParam(r)
+	if err != nil {
+		s.respondError(w, http.StatusBadRequest, "invalid artifact id")
+		return
+	}
+
+	var req struct {
+		TTLHours int `json:"ttl_hours"`
+	}
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil && !errors.Is(err, io.EOF) {
+			s.respondError(w, http.StatusBadRequest, "invalid request body")
+			return
+		}
+	}
+	if req.TTLHours == 0 {
+		req.TTLHours = defaultRecallTTLHours
+	}
+	if req.TTLHours < 1 || req.TTLHours > maxRecallTTLHours {
+		s.respondError(w, http.StatusBadRequest, fmt.Sprintf("ttl_hours must be between 1 and %d", maxRecallTTLHours))
+		return
+	}
+
+	var setID, size int64
+	var path, setStatus string
+	err = s.db.QueryRow(`
+		SELECT ce.backup_set_id, ce.file_path, ce.file_size, bs.status
+		FROM catalog_entries ce JOIN backup_sets bs ON ce.backup_set_id = bs.id
+		WHERE ce.id = ?
+	`, id).Scan(&setID, &path, &size, &setStatus)
+	if err != nil {
+		s.respondError(w, http.StatusNotFound, "artifact not found")
+		return
+	}
+	if setStatus != string(models.BackupSetStatusCompleted) {
+		s.respondError(w, http.StatusConflict, fmt.Sprintf("artifact belongs to a %s backup set", setStatus))
+		return
+	}
+
+	s.expireArtifactRecalls()
+	existing, err := scanArtifactRecall(s.db.QueryRow(`
+		SELECT `+artifactRecallColumns+` FROM artifact_recalls
+		WHERE catalog_entry_id = ? AND status IN (?, ?, ?, ?)
+		ORDER BY id DESC LIMIT 1
+	`, id, recallQueued, recallWaiting, recallRecalling, recallReady))
+	if err == nil {
+		s.respondJSON(w, http.StatusOK, existing)
+		return
+	}
+
+	var requestedBy interface{}
+	if claims, ok := r.Context().Value("claims").(*auth.Claims); ok && claims != nil {
+		requestedBy = claims.UserID
+	}
+	result, err := s.db.Exec(`
+		INSERT INTO artifact_recalls (catalog_entry_id, backup_set_id, file_path, file_size, ttl_hours, requested_by)
+		VALUES (?, ?, ?, ?, ?, ?)
+	`, id, setID, path, size, req.TTLHours, requestedBy)
+	if err != nil {
+		s.respondError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	recallID, _ := result.LastInsertId()
+
+	s.auditLog(r, "recall", "artifact", id, fmt.Sprintf("Queued recall %d of %s from backup set %d", recallID, path, setID))
+	s.kickArtifactRecalls()
+
+	rc, err := s.getArtifactRecall(recallID)
+	if err != nil {
+		s.respondError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	w.Header().Set("Location", fmt.Sprintf("/api/v1/artifacts/recalls/%d", recallID))
+	s.respondJSON(w, http.StatusAccepted, rc)
+}
+
+// handleListArtifactRecalls lists recalls, newest first, optionally by status
+func (s *Server) handleListArtifactRecalls(w http.ResponseWriter, r *http.Request) {
+	query := "SELECT " + artifactRecallColumns + " FROM artifact_recalls"
+	var args []interface{}
+	if status := r.URL.Query().Get("status"); status != "" {
+		query += " WHERE status = ?"
+		args = append(args, status)
+	}
+	query += " ORDER BY id DESC LIMIT 500"
+
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		s.respondError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	defer rows.Close()
+
+	recalls := []*artifactRecall{}
+	for rows.Next() {
+		rc, err := scanArtifactRecall(rows)
+		if err != nil {
+			continue
+		}
+		recalls = append(recalls, rc)
+	}
+	s.respondJSON(w, http.StatusOK, recalls)
+}
+
+// handleGetArtifactRecall returns a recall; once ready it carries the
+// time-limited download URL
+func (s *Server) handleGetArtifactRecall(w http.ResponseWriter, r *http.Request) {
+	id, err := s.getIDParam(r)
+	if err != nil {
+		s.respondError(w, http.StatusBadRequest, "invalid recall id")
+		return
+	}
+	rc, err := s.getArtifactRecall(id)
+	if err != nil {
+		s.respondError(w, http.StatusNotFound, "recall not found")
+		return
+	}
+	s.respondJSON(w, http.StatusOK, rc)
+}
+
+// handleDeleteArtifactRecall cancels a recall, or withdraws the download of
+// a ready one, and removes its staged copy
+func (s *Server) handleDeleteArtifactRecall(w http.ResponseWriter, r *http.Request) {
+	id, err := s.getIDParam(r)
+	if err != nil {
+		s.respondError(w, http.StatusBadRequest, "invalid recall id")
+		return
+	}
+	rc, err := s.getArtifactRecall(id)
+	if err != nil {
+		s.respondError(w, http.StatusNotFound, "recall not found")
+		return
+	}
+
+	s.db.Exec("DELETE FROM artifact_recalls WHERE id = ?", id)
+	s.artifactRecall.mu.Lock()
+	if s.artifactRecall.current == id && s.artifactRecall.cancel != nil {
+		s.artifactRecall.cancel()
+	}
+	s.artifactRecall.mu.Unlock()
+	s.removeRecallStaging(rc.stagedPath)
+
+	s.auditLog(r, "delete", "artifact_recall", id, fmt.Sprintf("Deleted %s recall of %s", rc.Status, rc.Path))
+	s.respondJSON(w, http.StatusOK, map[string]string{"message": "recall deleted"})
+}
+
+// handleDownloadArtifact serves a recalled artifact. The random token in the
+// URL is the credential, so the link can be handed to tools without an API
+// key until it expires.
+func (s *Server) handleDownloadArtifact(w http.ResponseWriter, r *http.Request) {
+	token := chi.URLParam(r, "token")
+	rc, err := scanArtifactRecall(s.db.QueryRow(
+		"SELECT "+artifactRecallColumns+" FROM artifact_recalls WHERE download_token = ?", token))
+	if err != nil {
+		s.respondError(w, http.StatusNotFound, "download not found")
+		return
+	}
+	if rc.Status != recallReady || rc.ExpiresAt == nil || time.Now().After(*rc.ExpiresAt) {
+		s.respondError(w, http.StatusGone, "download link has expired")
+		return
+	}
+	f, err := os.Open(rc.stagedPath)
+	if err != nil {
+		s.respondError(w, http.StatusGone, "recalled file is no longer staged")
+		return
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		s.respondError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	// Large artifacts take longer than the server's write timeout
+	http.NewResponseController(w).SetWriteDeadline(time.Time{})
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filepath.Base(rc.Path)))
+	w.Header().Set("Content-Type", "application/octet-stream")
+	http.ServeContent(w, r, "", info.ModTime(), f)
+}
+
+// kickArtifactRecalls starts the recall worker, or wakes it when it is
+// already running so newly queued recalls are picked up
+func (s *Server) kickArtifactRecalls() {
+	s.artifactRecall.mu.Lock()
+	defer s.artifactRecall.mu.Unlock()
+	if s.artifactRecall.wake == nil {
+		s.artifactRecall.wake = make(chan struct{}, 1)
+	}
+	if s.artifactRecall.running {
+		select {
+		case s.artifactRecall.wake <- struct{}{}:
+		default:
+		}
+		return
+	}
+	s.artifactRecall.running = true
+	go s.runArtifactRecalls()
+}
+
+// runArtifactRecalls works off queued recalls until none are left. Recalls
+// waiting for a tape are retried every artifactRecallPollInterval.
+func (s *Server) runArtifactRecalls() {
+	defer func() {
+		if rec := recover(); rec != nil {
+			if s.logger != nil {
+				s.logger.Error("Panic in artifact recall worker", map[string]interface{}{"panic": fmt.Sprintf("%v", rec)})
+			}
+			s.artifactRecall.mu.Lock()
+			s.artifactRecall.running = false
+			s.artifactRecall.mu.Unlock()
+		}
+	}()
+
+	for {
+		waiting := s.processArtifactRecalls()
+
+		s.artifactRecall.mu.Lock()
+		if waiting == 0 && len(s.artifactRecall.wake) == 0 {
+			s.artifactRecall.running = false
+			s.artifactRecall.mu.Unlock()
+			return
+		}
+		wake := s.artifactRecall.wake
+		s.artifactRecall.mu.Unlock()
+
+		if waiting > 0 {
+			select {
+			case <-wake:
+			case <-time.After(artifactRecallPollInterval):
+			}
+		} else {
+			<-wake
+		}
+	}
+}
+
+// processArtifactRecalls attempts every open recall once in queue order and
+// returns how many are still waiting for their tape
+func (s *Server) processArtifactRecalls() int {
+	rows, err := s.db.Query("SELECT id FROM artifact_recalls WHERE status IN (?, ?) ORDER BY id", recallQueued, recallWaiting)
+	if err != nil {
+		return 0
+	}
+	var ids []int64
+	for rows.Next() {
+		var id int64
+		if rows.Scan(&id) == nil {
+			ids = append(ids, id)
+		}
+	}
+	rows.Close()
+
+	waiting := 0
+	for _, id := range ids {
+		if !s.recallArtifact(id) {
+			waiting++
+		}
+	}
+	return waiting
+}
+
+// recallArtifact extracts one artifact into scratch space. It returns false
+// when the recall has to wait for its tape to be loaded.
+func (s *Server) recallArtifact(id int64) bool {
+	rc, err := s.getArtifactRecall(id)
+	if err != nil || (rc.Status != recallQueued && rc.Status != recallWaiting) {
+		return true
+	}
+
+	var tapeID int64
+	var label string
+	err = s.db.QueryRow(`
+		SELECT bs.tape_id, t.label FROM backup_sets bs JOIN tapes t ON bs.tape_id = t.id WHERE bs.id = ?
+	`, rc.BackupSetID).Scan(&tapeID, &label)
+	if err != nil {
+		s.failArtifactRecall(rc, "", "backup set no longer exists")
+		return true
+	}
+
+	driveID, ok := s.driveForRecall(tapeID, label)
+	if !ok {
+		if rc.Status != recallWaiting {
+			s.db.Exec("UPDATE artifact_recalls SET status = ? WHERE id = ?", recallWaiting, id)
+			if s.eventBus != nil {
+				s.eventBus.Publish(SystemEvent{
+					Type:     "warning",
+					Category: "restore",
+					Key:      "artifact_recall_tape_required",
+					Args:     []interface{}{rc.Path, label},
+				})
+			}
+		}
+		return false
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), artifactRecallTimeout)
+	defer cancel()
+	s.artifactRecall.mu.Lock()
+	s.artifactRecall.current = id
+	s.artifactRecall.cancel = cancel
+	s.artifactRecall.mu.Unlock()
+	defer func() {
+		s.artifactRecall.mu.Lock()
+		s.artifactRecall.current = 0
+		s.artifactRecall.cancel = nil
+		s.artifactRecall.mu.Unlock()
+	}()
+
+	s.db.Exec("UPDATE artifact_recalls SET status = ?, started_at = ?, error = '' WHERE id = ?", recallRecalling, time.Now(), id)
+	if s.logger != nil {
+		s.logger.Info("Recalling artifact", map[string]interface{}{
+			"recall_id": id, "path": rc.Path, "backup_set_id": rc.BackupSetID, "tape": label,
+		})
+	}
+
+	dir, err := s.scratch.MkdirTemp("recall-*")
+	if err != nil {
+		s.failArtifactRecall(rc, "", "failed to create staging directory: "+err.Error())
+		return true
+	}
+	if err := s.scratch.CheckSpace(dir, rc.Size); err != nil {
+		s.failArtifactRecall(rc, dir, err.Error())
+		return true
+	}
+
+	result, err := s.restoreService.Restore(ctx, &restore.RestoreRequest{
+		BackupSetID:     rc.BackupSetID,
+		FilePaths:       []string{rc.Path},
+		DestPath:        dir,
+		DestinationType: string(models.RestoreDestLocal),
+		Verify:          true,
+		DriveID:         &driveID,
+	})
+	if err == nil && len(result.Errors) > 0 {
+		err = errors.New(result.Errors[0])
+	}
+	if err != nil {
+		s.failArtifactRecall(rc, dir, err.Error())
+		return true
+	}
+	staged := filepath.Join(dir, rc.Path)
+	if _, err := os.Stat(staged); err != nil {
+		s.failArtifactRecall(rc, dir, "artifact was not found on tape")
+		return true
+	}
+
+	token := make([]byte, 32)
+	if _, err := io.ReadFull(cryptoRand, token); err != nil {
+		s.failArtifactRecall(rc, dir, "failed to generate download token: "+err.Error())
+		return true
+	}
+	now := time.Now()
+	res, err := s.db.Exec(`
+		UPDATE artifact_recalls SET status = ?, staged_path = ?, download_token = ?, ready_at = ?, expires_at = ?
+		WHERE id = ? AND status = ?
+	`, recallReady, staged, hex.EncodeToString(token), now, now.Add(time.Duration(rc.TTLHours)*time.Hour), id, recallRecalling)
+	if n, _ := res.RowsAffected(); err != nil || n == 0 {
+		// Deleted while it was being extracted
+		s.removeRecallStaging(staged)
+		return true
+	}
+
+	s.auditLogDirect(nil, "", "recall_ready", "artifact", rc.ArtifactID,
+		fmt.Sprintf("Recalled %s from tape %s for download until %s", rc.Path, label, now.Add(time.Duration(rc.TTLHours)*time.Hour).Format(time.RFC3339)))
+	if s.eventBus != nil {
+		s.eventBus.Publish(SystemEvent{
+			Type:     "success",
+			Category: "restore",
+			Key:      "artifact_recall_ready",
+			Args:     []interface{}{rc.Path, rc.TTLHours},
+		})
+	}
+	return true
+}
+
+// driveForRecall returns a drive holding the tape. A tape sitting in a
+// library slot is loaded into an idle drive of that library first.
+func (s *Server) driveForRecall(tapeID int64, label string) (int64, bool) {
+	var driveID int64
+	if err := s.db.QueryRow("SELECT id FROM tape_drives WHERE current_tape_id = ? AND enabled = 1", tapeID).Scan(&driveID); err == nil {
+		return driveID, true
+	}
+
+	if s.library == nil {
+		return 0, false
+	}
+	libraryID, ok := s.library.LibraryOf(tapeID)
+	if !ok {
+		return 0, false
+	}
+	driveID, _, err := s.pickLibraryDrive(libraryID)
+	if err != nil {
+		return 0, false
+	}
+	var devicePath string
+	s.db.QueryRow("SELECT device_path FROM tape_drives WHERE id = ?", driveID).Scan(&devicePath)
+
+	// The library serializes the move with jobs and other loads
+	load, err := s.library.Load(context.Background(), tapeID, library.Request{DevicePath: devicePath})
+	if load != nil {
+		s.auditLogDirect(nil, "", "load", "tape_library", load.LibraryID,
+			fmt.Sprintf("Loaded tape %s from slot %d to drive %d for an artifact recall", label, load.Slot, load.DriveNumber))
+		if s.eventBus != nil {
+			s.eventBus.Publish(SystemEvent{
+				Type:     "info",
+				Category: "tape",
+				Key:      "library_tape_loaded",
+				Args:     []interface{}{load.Slot, load.DriveNumber},
+			})
+		}
+	}
+	if err != nil {
+		// A tape that was loaded is found in its drive on the next attempt
+		if s.logger != nil {
+			s.logger.Warn("Failed to load tape for artifact recall", map[string]interface{}{"tape": label, "error": err.Error()})
+		}
+		return 0, false
+	}
+	return load.DriveID, true
+}
+
+func (s *Server) failArtifactRecall(rc *artifactRecall, dir, reason string) {
+	s.removeRecallStaging(dir)
+	s.db.Exec("UPDATE artifact_recalls SET status = ?, error = ? WHERE id = ?", recallFailed, reason, rc.ID)
+	if s.logger != nil {
+		s.logger.Error("Artifact recall failed", map[string]interface{}{"recall_id": rc.ID, "path": rc.Path, "error": reason})
+	}
+	if s.eventBus != nil {
+		s.eventBus.Publish(SystemEvent{
+			Type:     "error",
+			Category: "restore",
+			Key:      "artifact_recall_failed",
+			Args:     []interface{}{rc.Path, reason},
+		})
+	}
+}
+
+// removeRecallStaging removes the staging directory of a recall given the
+// directory itself or the staged file inside it
+func (s *Server) removeRecallStaging(path string) {
+	if path == "" {
+		return
+	}
+	root := filepath.Clean(s.scratch.Root())
+	for filepath.Dir(path) != root {
+		parent := filepath.Dir(path)
+		if parent == path {
+			return // not under the scratch directory
+		}
+		path = parent
+	}
+	os.RemoveAll(path)
+}
+
+// expireArtifactRecalls removes staged copies of recalls past their expiry
+func (s *Server) expireArtifactRecalls() {
+	rows, err := s.db.Query(`
+		SELECT `+artifactRecallColumns+` FROM artifact_recalls WHERE status = ? AND expires_at < ?
+	`, recallReady, time.Now())
+	if err != nil {
+		return
+	}
+	var expired []*artifactRecall
+	for rows.Next() {
+		if rc, err := scanArtifactRecall(rows); err == nil {
+			expired = append(expired, rc)
+		}
+	}
+	rows.Close()
+
+	for _, rc := range expired {
+		s.removeRecallStaging(rc.stagedPath)
+		s.db.Exec("UPDATE artifact_recalls SET status = ?, staged_path = '', download_token = NULL WHERE id = ?", recallExpired, rc.ID)
+	}
+}
+
+// resumeArtifactRecalls requeues recalls interrupted by a restart. Staged
+// copies do not survive one, since orphaned scratch entries are cleaned at
+// startup, so recalls that were ready are expired.
+func (s *Server) resumeArtifactRecalls() {
+	s.db.Exec(`
+		UPDATE artifact_recalls SET status = ?, error = 'staged copy removed on restart', staged_path = '', download_token = NULL
+		WHERE status = ?
+	`, recallExpired, recallReady)
+	res, err := s.db.Exec("UPDATE artifact_recalls SET status = ? WHERE status IN (?, ?)", recallQueued, recallWaiting, recallRecalling)
+	if err != nil {
+		return
+	}
+	var open int
+	s.db.QueryRow("SELECT COUNT(*) FROM artifact_recalls WHERE status = ?", recallQueued).Scan(&open)
+	if open > 0 {
+		if s.logger != nil {
+			n, _ := res.RowsAffected()
+			s.logger.Info("Resuming artifact recalls", map[string]interface{}{"interrupted": n, "queued": open})
+		}
+		s.kickArtifactRecalls()
+	}
+}
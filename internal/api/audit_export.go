@@ -0,0 +1,471 @@
+package api
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/RoseOO/TapeBackarr/internal/tape"
+)
+
+const (
+	auditExportMagic   = "TAPEBACKARR_AUDIT"
+	auditExportVersion = 1
+	// maxAuditExportSize bounds how much of a tape file verification reads
+	maxAuditExportSize = 256 << 20
+)
+
+// auditExportEntry is an audit log row as written to the compliance tape.
+// Only columns that never change are included, so the hash of an export can
+// be recomputed from the database later.
+type auditExportEntry struct {
+	ID           int64  `json:"id"`
+	UserID       int64  `json:"user_id"`
+	Action       string `json:"action"`
+	ResourceType string `json:"resource_type"`
+	ResourceID   int64  `json:"resource_id"`
+	Details      string `json:"details"`
+	IPAddress    string `json:"ip_address"`
+	CreatedAt    string `json:"created_at"`
+}
+
+// auditExportFile is one export as written to the compliance tape, one tape
+// file per export
+type auditExportFile struct {
+	Magic     string    `json:"magic"`
+	Version   int       `json:"version"`
+	Sequence  int64     `json:"sequence"`
+	TapeLabel string    `json:"tape_label"`
+	TapeUUID  string    `json:"tape_uuid"`
+	CreatedAt time.Time `json:"created_at"`
+	FirstID   int64     `json:"first_audit_id"`
+	LastID    int64     `json:"last_audit_id"`
+	PrevHash  string    `json:"prev_hash"`
+	Hash      string    `json:"hash"`
+	// Usernames resolves the entries' user IDs for readers of the tape. It
+	// is not covered by the hash since users can be renamed.
+	Usernames map[string]string  `json:"usernames,omitempty"`
+	Entries   []auditExportEntry `json:"entries"`
+}
+
+// auditExport is the record of an export kept in the database
+type auditExport struct {
+	ID           int64     `json:"id"`
+	Sequence     int64     `json:"sequence"`
+	TapeID       int64     `json:"tape_id"`
+	TapeLabel    string    `json:"tape_label"`
+	FileNumber   int64     `json:"file_number"`
+	FirstAuditID int64     `json:"first_audit_id"`
+	LastAuditID  int64     `json:"last_audit_id"`
+	EntryCount   int       `json:"entry_count"`
+	PrevHash     string    `json:"prev_hash"`
+	Hash         string    `json:"hash"`
+	CreatedAt    time.Time `json:"created_at"`
+}
+
+// auditVerifyResult reports a verification of the compliance tape
+type auditVerifyResult struct {
+	TapeLabel string   `json:"tape_label"`
+	Exports   int      `json:"exports"`
+	Entries   int      `json:"entries"`
+	OK        bool     `json:"ok"`
+	Problems  []string `json:"problems"`
+}
+
+// auditChainHash links an export to the one before it: the hash covers the
+// previous export's hash, the sequence number and the entries
+func auditChainHash(prevHash string, sequence int64, entries []auditExportEntry) (string, error) {
+	data, err := json.Marshal(entries)
+	if err != nil {
+		return "", err
+	}
+	h := sha256.New()
+	fmt.Fprintf(h, "%s\n%d\n", prevHash, sequence)
+	h.Write(data)
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// auditExportEntries returns the audit rows after afterID, up to and
+// including uptoID when it is not zero, oldest first
+func (s *Server) auditExportEntries(afterID, uptoID int64) ([]auditExportEntry, error) {
+	query := `
+		SELECT id, COALESCE(user_id, 0), action, resource_type, COALESCE(resource_id, 0),
+			COALESCE(details, ''), COALESCE(ip_address, ''), COALESCE(CAST(created_at AS TEXT), '')
+		FROM audit_logs WHERE id > ?`
+	args := []interface{}{afterID}
+	if uptoID > 0 {
+		query += " AND id <= ?"
+		args = append(args, uptoID)
+	}
+	rows, err := s.db.Query(query+" ORDER BY id", args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	entries := []auditExportEntry{}
+	for rows.Next() {
+		var e auditExportEntry
+		if err := rows.Scan(&e.ID, &e.UserID, &e.Action, &e.ResourceType, &e.ResourceID, &e.Details, &e.IPAddress, &e.CreatedAt); err != nil {
+			return nil, err
+		}
+		entries = append(entries, e)
+	}
+	return entries, rows.Err()
+}
+
+// complianceTape looks up the configured compliance tape and the drive it
+// is loaded in. The tape must be kept out of pools and backups.
+func (s *Server) complianceTape() (tapeID int64, label, uuid, devicePath string, err error) {
+	if s.config != nil {
+		label = s.config.AuditExport.TapeLabel
+	}
+	if label == "" {
+		return 0, "", "", "", fmt.Errorf("no compliance tape configured: set audit_export.tape_label")
+	}
+	var poolID sql.NullInt64
+	if err := s.db.QueryRow("SELECT id, uuid, pool_id FROM tapes WHERE label = ?", label).Scan(&tapeID, &uuid, &poolID); err != nil {
+		return 0, "", "", "", fmt.Errorf("compliance tape %s not found", label)
+	}
+	if poolID.Valid {
+		return 0, "", "", "", fmt.Errorf("compliance tape %s belongs to a pool; remove it from the pool so backups never write to it", label)
+	}
+	var sets int
+	s.db.QueryRow("SELECT COUNT(*) FROM backup_sets WHERE tape_id = ?", tapeID).Scan(&sets)
+	if sets > 0 {
+		return 0, "", "", "", fmt.Errorf("compliance tape %s holds backup sets", label)
+	}
+	if err := s.db.QueryRow("SELECT device_path FROM tape_drives WHERE current_tape_id = ? AND COALESCE(enabled, 1) = 1", tapeID).Scan(&devicePath); err != nil {
+		return 0, "", "", "", fmt.Errorf("compliance tape %s is not loaded in any drive", label)
+	}
+	return tapeID, label, uuid, devicePath, nil
+}
+
+// verifyTapeLabel checks that the drive holds the expected tape
+func verifyTapeLabel(ctx context.Context, driveSvc *tape.Service, label, uuid string) error {
+	physical, err := driveSvc.ReadTapeLabel(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to read tape label: %w", err)
+	}
+	if physical == nil || physical.Label != label || physical.UUID != uuid {
+		return fmt.Errorf("the drive does not hold compliance tape %s", label)
+	}
+	return nil
+}
+
+// exportAuditLog appends the audit entries written since the last export to
+// the compliance tape as one new tape file. It never overwrites: the tape
+// must end exactly after the exports on record. It returns nil when there is
+// nothing new to export.
+func (s *Server) exportAuditLog(ctx context.Context) (*auditExport, error) {
+	s.auditExportMu.Lock()
+	defer s.auditExportMu.Unlock()
+
+	tapeID, label, uuid, devicePath, err := s.complianceTape()
+	if err != nil {
+		return nil, err
+	}
+
+	var prevSeq, prevLastID int64
+	var prevHash string
+	err = s.db.QueryRow("SELECT sequence, last_audit_id, hash FROM audit_exports ORDER BY sequence DESC LIMIT 1").Scan(&prevSeq, &prevLastID, &prevHash)
+	if err != nil && err != sql.ErrNoRows {
+		return nil, err
+	}
+	var lastFile int64
+	s.db.QueryRow("SELECT COALESCE(MAX(file_number), 0) FROM audit_exports WHERE tape_id = ?", tapeID).Scan(&lastFile)
+
+	entries, err := s.auditExportEntries(prevLastID, 0)
+	if err != nil {
+		return nil, err
+	}
+	if len(entries) == 0 {
+		return nil, nil
+	}
+
+	e := &auditExport{
+		Sequence:     prevSeq + 1,
+		TapeID:       tapeID,
+		TapeLabel:    label,
+		FileNumber:   lastFile + 1,
+		FirstAuditID: entries[0].ID,
+		LastAuditID:  entries[len(entries)-1].ID,
+		EntryCount:   len(entries),
+		PrevHash:     prevHash,
+		CreatedAt:    time.Now().UTC(),
+	}
+	if e.Hash, err = auditChainHash(prevHash, e.Sequence, entries); err != nil {
+		return nil, err
+	}
+	data, err := json.Marshal(auditExportFile{
+		Magic:     auditExportMagic,
+		Version:   auditExportVersion,
+		Sequence:  e.Sequence,
+		TapeLabel: label,
+		TapeUUID:  uuid,
+		CreatedAt: e.CreatedAt,
+		FirstID:   e.FirstAuditID,
+		LastID:    e.LastAuditID,
+		PrevHash:  prevHash,
+		Hash:      e.Hash,
+		Usernames: s.auditUsernames(entries),
+		Entries:   entries,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	driveSvc := tape.NewServiceForDevice(devicePath, s.tapeService.GetBlockSize())
+	if err := verifyTapeLabel(ctx, driveSvc, label, uuid); err != nil {
+		return nil, err
+	}
+	// Append only where the last export ended, and only if nothing follows
+	if err := driveSvc.SeekToFileNumber(ctx, e.FileNumber); err != nil {
+		return nil, fmt.Errorf("compliance tape %s does not hold the %d export(s) on record: %w", label, lastFile, err)
+	}
+	if err := driveSvc.SeekToFileNumber(ctx, e.FileNumber+1); err == nil {
+		return nil, fmt.Errorf("compliance tape %s holds data after its last export; refusing to write", label)
+	}
+	if err := driveSvc.SeekToFileNumber(ctx, e.FileNumber); err != nil {
+		return nil, fmt.Errorf("failed to position compliance tape %s: %w", label, err)
+	}
+
+	w, err := driveSvc.OpenWriter(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := w.Write(data); err != nil {
+		w.Close()
+		return nil, fmt.Errorf("failed to write to compliance tape %s: %w", label, err)
+	}
+	if err := w.Close(); err != nil {
+		return nil, fmt.Errorf("failed to write to compliance tape %s: %w", label, err)
+	}
+	if err := driveSvc.WriteFileMark(ctx); err != nil {
+		return nil, fmt.Errorf("failed to write file mark on compliance tape %s: %w", label, err)
+	}
+
+	result, err := s.db.Exec(`
+		INSERT INTO audit_exports (sequence, tape_id, file_number, first_audit_id, last_audit_id, entry_count, prev_hash, hash, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`, e.Sequence, tapeID, e.FileNumber, e.FirstAuditID, e.LastAuditID, e.EntryCount, e.PrevHash, e.Hash, e.CreatedAt)
+	if err != nil {
+		return nil, fmt.Errorf("export %d was written to tape %s but could not be recorded: %w", e.Sequence, label, err)
+	}
+	e.ID, _ = result.LastInsertId()
+	s.db.Exec("UPDATE tapes SET last_written_at = CURRENT_TIMESTAMP, updated_at = CURRENT_TIMESTAMP WHERE id = ?", tapeID)
+	return e, nil
+}
+
+// auditUsernames maps the user IDs of entries to usernames
+func (s *Server) auditUsernames(entries []auditExportEntry) map[string]string {
+	names := map[string]string{}
+	rows, err := s.db.Query("SELECT id, username FROM users")
+	if err != nil {
+		return names
+	}
+	defer rows.Close()
+	all := map[int64]string{}
+	for rows.Next() {
+		var id int64
+		var name string
+		if rows.Scan(&id, &name) == nil {
+			all[id] = name
+		}
+	}
+	for _, e := range entries {
+		if name, ok := all[e.UserID]; ok {
+			names[strconv.FormatInt(e.UserID, 10)] = name
+		}
+	}
+	return names
+}
+
+// verifyAuditExports reads every export on the loaded compliance tape and
+// checks the hash chain, the export records and that the audit rows in the
+// database still match what was exported
+func (s *Server) verifyAuditExports(ctx context.Context) (*auditVerifyResult, error) {
+	s.auditExportMu.Lock()
+	defer s.auditExportMu.Unlock()
+
+	tapeID, label, uuid, devicePath, err := s.complianceTape()
+	if err != nil {
+		return nil, err
+	}
+	driveSvc := tape.NewServiceForDevice(devicePath, s.tapeService.GetBlockSize())
+	if err := verifyTapeLabel(ctx, driveSvc, label, uuid); err != nil {
+		return nil, err
+	}
+
+	res := &auditVerifyResult{TapeLabel: label, Problems: []string{}}
+	problem := func(format string, args ...interface{}) {
+		res.Problems = append(res.Problems, fmt.Sprintf(format, args...))
+	}
+
+	var files []auditExportFile
+	for fileNum := int64(1); ; fileNum++ {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		if err := driveSvc.SeekToFileNumber(ctx, fileNum); err != nil {
+			break
+		}
+		r, err := driveSvc.OpenReader(ctx)
+		if err != nil {
+			break
+		}
+		data, err := io.ReadAll(io.LimitReader(r, maxAuditExportSize))
+		r.Close()
+		if err != nil || len(data) == 0 {
+			break
+		}
+		var f auditExportFile
+		if err := json.Unmarshal(data, &f); err != nil || f.Magic != auditExportMagic {
+			problem("tape file %d is not an audit export", fileNum)
+			continue
+		}
+		files = append(files, f)
+	}
+
+	for i, f := range files {
+		res.Exports++
+		res.Entries += len(f.Entries)
+		hash, err := auditChainHash(f.PrevHash, f.Sequence, f.Entries)
+		if err != nil || hash != f.Hash {
+			problem("export %d on tape does not match its own hash", f.Sequence)
+		}
+		if i > 0 {
+			if prev := files[i-1]; f.PrevHash != prev.Hash || f.Sequence != prev.Sequence+1 {
+				problem("export %d does not follow export %d in the hash chain", f.Sequence, prev.Sequence)
+			}
+		} else if f.Sequence > 1 {
+			// The chain continues from an earlier compliance tape
+			var prevHash string
+			if err := s.db.QueryRow("SELECT hash FROM audit_exports WHERE sequence = ?", f.Sequence-1).Scan(&prevHash); err != nil || prevHash != f.PrevHash {
+				problem("export %d does not follow the recorded export %d", f.Sequence, f.Sequence-1)
+			}
+		}
+
+		var recorded string
+		if err := s.db.QueryRow("SELECT hash FROM audit_exports WHERE sequence = ? AND tape_id = ?", f.Sequence, tapeID).Scan(&recorded); err != nil {
+			problem("export %d on tape has no record in the database", f.Sequence)
+		} else if recorded != f.Hash {
+			problem("export %d on tape differs from its database record", f.Sequence)
+		}
+
+		current, err := s.auditExportEntries(f.FirstID-1, f.LastID)
+		if err != nil {
+			return nil, err
+		}
+		if hash, err := auditChainHash(f.PrevHash, f.Sequence, current); err != nil || hash != f.Hash {
+			problem("audit entries %d-%d in the database were changed or removed after export %d", f.FirstID, f.LastID, f.Sequence)
+		}
+	}
+
+	var recorded int
+	s.db.QueryRow("SELECT COUNT(*) FROM audit_exports WHERE tape_id = ?", tapeID).Scan(&recorded)
+	if recorded != len(files) {
+		problem("the database records %d export(s) on tape %s but %d were read", recorded, label, len(files))
+	}
+	res.OK = len(res.Problems) == 0
+	return res, nil
+}
+
+// runScheduledAuditExport is the maintenance task behind audit_export.schedule
+func (s *Server) runScheduledAuditExport() {
+	e, err := s.exportAuditLog(context.Background())
+	if err != nil {
+		if s.logger != nil {
+			s.logger.Error("Scheduled audit log export failed", map[string]interface{}{"error": err.Error()})
+		}
+		s.eventBus.Publish(SystemEvent{
+			Type:     "error",
+			Category: "system",
+			Key:      "audit_export_failed",
+			Args:     []interface{}{err.Error()},
+		})
+		return
+	}
+	if e != nil {
+		s.recordAuditExport(nil, "", e)
+	}
+}
+
+// recordAuditExport logs a completed export. The audit entry it adds goes
+// out with the next export.
+func (s *Server) recordAuditExport(r *http.Request, remote string, e *auditExport) {
+	details := fmt.Sprintf("Exported audit entries %d-%d to compliance tape %s as export %d", e.FirstAuditID, e.LastAuditID, e.TapeLabel, e.Sequence)
+	if r != nil {
+		s.auditLog(r, "audit_export", "tape", e.TapeID, details)
+	} else {
+		s.auditLogDirect(nil, remote, "audit_export", "tape", e.TapeID, details)
+	}
+	if s.eventBus != nil {
+		s.eventBus.Publish(SystemEvent{
+			Type:     "success",
+			Category: "system",
+			Key:      "audit_exported",
+			Args:     []interface{}{e.EntryCount, e.TapeLabel, e.Sequence},
+		})
+	}
+}
+
+// handleListAuditExports lists the audit log exports, newest first
+func (s *Server) handleListAuditExports(w http.ResponseWriter, r *http.Request) {
+	rows, err := s.db.Query(`
+		SELECT e.id, e.sequence, e.tape_id, COALESCE(t.label, ''), e.file_number, e.first_audit_id, e.last_audit_id,
+			e.entry_count, e.prev_hash, e.hash, e.created_at
+		FROM audit_exports e LEFT JOIN tapes t ON e.tape_id = t.id
+		ORDER BY e.sequence DESC
+	`)
+	if err != nil {
+		s.respondError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	defer rows.Close()
+
+	exports := []auditExport{}
+	for rows.Next() {
+		var e auditExport
+		if err := rows.Scan(&e.ID, &e.Sequence, &e.TapeID, &e.TapeLabel, &e.FileNumber, &e.FirstAuditID, &e.LastAuditID,
+			&e.EntryCount, &e.PrevHash, &e.Hash, &e.CreatedAt); err != nil {
+			continue
+		}
+		exports = append(exports, e)
+	}
+	s.respondJSON(w, http.StatusOK, exports)
+}
+
+// handleRunAuditExport appends the audit entries since the last export to
+// the compliance tape now
+func (s *Server) handleRunAuditExport(w http.ResponseWriter, r *http.Request) {
+	e, err := s.exportAuditLog(r.Context())
+	if err != nil {
+		s.respondError(w, http.StatusConflict, err.Error())
+		return
+	}
+	if e == nil {
+		s.respondJSON(w, http.StatusOK, map[string]string{"status": "nothing to export"})
+		return
+	}
+	s.recordAuditExport(r, "", e)
+	s.respondJSON(w, http.StatusOK, e)
+}
+
+// handleVerifyAuditExports reads the loaded compliance tape and checks its
+// exports against each other and the database
+func (s *Server) handleVerifyAuditExports(w http.ResponseWriter, r *http.Request) {
+	res, err := s.verifyAuditExports(r.Context())
+	if err != nil {
+		s.respondError(w, http.StatusConflict, err.Error())
+		return
+	}
+	s.respondJSON(w, http.StatusOK, res)
+}
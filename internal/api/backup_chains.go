@@ -0,0 +1,268 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/RoseOO/TapeBackarr/internal/models"
+)
+
+// backupChainTape is a tape a backup set was written to
+type backupChainTape struct {
+	ID      int64  `json:"id"`
+	Label   string `json:"label"`
+	Barcode string `json:"barcode"`
+	Status  string `json:"status"`
+}
+
+// backupChainSet is one completed backup set of a chain
+type backupChainSet struct {
+	BackupSetID int64             `json:"backup_set_id"`
+	BackupType  string            `json:"backup_type"`
+	StartTime   time.Time         `json:"start_time"`
+	EndTime     *time.Time        `json:"end_time"`
+	FileCount   int64             `json:"file_count"`
+	TotalBytes  int64             `json:"total_bytes"`
+	Tapes       []backupChainTape `json:"tapes"`
+	// DependsOn is the set this one is restored on top of
+	DependsOn *int64 `json:"depends_on"`
+	// Requires lists the sets a restore of this set's point in time reads,
+	// oldest first and including the set itself
+	Requires    []int64 `json:"requires"`
+	Expired     bool    `json:"expired"`
+	Invalidated bool    `json:"invalidated"`
+	// ChainBrokenAt is when a set this one depends on was deleted, expired
+	// or erased
+	ChainBrokenAt *time.Time `json:"chain_broken_at,omitempty"`
+	Problems      []string   `json:"problems,omitempty"`
+
+	hasCatalog        bool
+	chainBrokenReason string
+	// lost says how the set would be removed when checking what removing
+	// it breaks
+	lost string
+}
+
+// backupChain is a full backup and the differentials and incrementals
+// restored on top of it
+type backupChain struct {
+	// FullSetID is nil when no full backup precedes the chain's sets
+	FullSetID *int64            `json:"full_set_id"`
+	Sets      []*backupChainSet `json:"sets"`
+	// Broken is set when a valid set of the chain cannot be restored
+	// completely; the sets' problems say why
+	Broken bool `json:"broken"`
+	// Expired is set when every valid set of the chain has expired
+	Expired bool `json:"expired"`
+}
+
+// handleJobChains returns the restore dependencies of a job's completed
+// backup sets, grouped into chains that each start at a full backup, so the
+// UI can draw them. Chains are resolved as point-in-time restores resolve
+// them: a differential depends on the full, an incremental on the set
+// before it back to the latest differential or full. Invalidated sets are
+// listed but nothing depends on them.
+func (s *Server) handleJobChains(w http.ResponseWriter, r *http.Request) {
+	id, err := s.getIDParam(r)
+	if err != nil {
+		s.respondError(w, http.StatusBadRequest, "invalid job id")
+		return
+	}
+	var jobName string
+	if err := s.db.QueryRow("SELECT name FROM backup_jobs WHERE id = ?", id).Scan(&jobName); err != nil {
+		s.respondError(w, http.StatusNotFound, "job not found")
+		return
+	}
+
+	sets, err := s.loadBackupChainSets(id)
+	if err != nil {
+		s.respondError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	chains := buildBackupChains(sets)
+	broken := 0
+	for _, c := range chains {
+		if c.Broken {
+			broken++
+		}
+	}
+	s.respondJSON(w, http.StatusOK, map[string]interface{}{
+		"job_id":        id,
+		"job_name":      jobName,
+		"chains":        chains,
+		"broken_chains": broken,
+	})
+}
+
+// loadBackupChainSets loads a job's completed backup sets, oldest first,
+// with the tapes they were written to
+func (s *Server) loadBackupChainSets(jobID int64) ([]*backupChainSet, error) {
+	// Later tapes of a spanned run are recorded as sets of their own with no
+	// catalog; they are listed as tapes of the run's first set instead
+	rows, err := s.db.Query(`
+		SELECT bs.id, bs.backup_type, bs.start_time, bs.end_time, COALESCE(bs.file_count, 0), COALESCE(bs.total_bytes, 0),
+		       bs.invalidated_at IS NOT NULL,
+		       EXISTS (SELECT 1 FROM catalog_entries ce WHERE ce.backup_set_id = bs.id),
+		       COALESCE(j.retention_days > 0 AND bs.end_time < datetime('now', '-' || j.retention_days || ' days'), 0),
+		       bs.chain_broken_at, bs.chain_broken_reason
+		FROM backup_sets bs
+		JOIN backup_jobs j ON j.id = bs.job_id
+		WHERE bs.job_id = ? AND bs.status = ?
+		  AND NOT EXISTS (
+			SELECT 1 FROM tape_spanning_members m
+			JOIN tape_spanning_members f ON f.spanning_set_id = m.spanning_set_id
+			WHERE m.backup_set_id = bs.id AND f.backup_set_id != bs.id AND f.sequence_number < m.sequence_number
+		  )
+		ORDER BY bs.start_time, bs.id
+	`, jobID, models.BackupSetStatusCompleted)
+	if err != nil {
+		return nil, err
+	}
+	var sets []*backupChainSet
+	byID := make(map[int64]*backupChainSet)
+	for rows.Next() {
+		set := &backupChainSet{Tapes: []backupChainTape{}, Requires: []int64{}}
+		if err := rows.Scan(&set.BackupSetID, &set.BackupType, &set.StartTime, &set.EndTime, &set.FileCount, &set.TotalBytes,
+			&set.Invalidated, &set.hasCatalog, &set.Expired, &set.ChainBrokenAt, &set.chainBrokenReason); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		sets = append(sets, set)
+		byID[set.BackupSetID] = set
+	}
+	rows.Close()
+
+	rows, err = s.db.Query(`
+		SELECT x.backup_set_id, t.id, t.label, COALESCE(t.barcode, ''), t.status
+		FROM (
+			SELECT id AS backup_set_id, tape_id, 0 AS seq FROM backup_sets WHERE job_id = ?
+			UNION
+			SELECT f.backup_set_id, m.tape_id, m.sequence_number FROM tape_spanning_members f
+			JOIN tape_spanning_members m ON m.spanning_set_id = f.spanning_set_id
+			JOIN backup_sets bs ON bs.id = f.backup_set_id
+			WHERE bs.job_id = ?
+		) x
+		JOIN tapes t ON t.id = x.tape_id
+		ORDER BY x.backup_set_id, x.seq
+	`, jobID, jobID)
+	if err != nil {
+		return nil, err
+	}
+	for rows.Next() {
+		var setID int64
+		var tape backupChainTape
+		if err := rows.Scan(&setID, &tape.ID, &tape.Label, &tape.Barcode, &tape.Status); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		set := byID[setID]
+		if set == nil || containsChainTape(set.Tapes, tape.ID) {
+			continue
+		}
+		set.Tapes = append(set.Tapes, tape)
+		if tape.Status == string(models.TapeStatusExpired) {
+			set.Expired = true
+		}
+	}
+	rows.Close()
+	return sets, nil
+}
+
+// containsChainTape reports whether tapes holds the tape
+func containsChainTape(tapes []backupChainTape, id int64) bool {
+	for _, t := range tapes {
+		if t.ID == id {
+			return true
+		}
+	}
+	return false
+}
+
+// buildBackupChains groups a job's sets, oldest first, into chains and
+// records what each valid set depends on and why it cannot be restored.
+// It can be run again on the same sets.
+func buildBackupChains(sets []*backupChainSet) []*backupChain {
+	chains := []*backupChain{}
+	var chain *backupChain
+	// full, the latest differential after it and the incrementals after
+	// that, as a restore of the current point in time would read them
+	var full, diff *backupChainSet
+	var incs []*backupChainSet
+
+	for _, set := range sets {
+		set.DependsOn, set.Requires, set.Problems = nil, []int64{}, nil
+		valid := !set.Invalidated
+		if set.BackupType == string(models.BackupTypeFull) && valid {
+			id := set.BackupSetID
+			chain = &backupChain{FullSetID: &id}
+			chains = append(chains, chain)
+			full, diff, incs = set, nil, nil
+		} else if chain == nil {
+			chain = &backupChain{}
+			chains = append(chains, chain)
+		}
+		chain.Sets = append(chain.Sets, set)
+		if !valid {
+			continue
+		}
+
+		var base []*backupChainSet
+		switch {
+		case set.BackupType == string(models.BackupTypeFull):
+		case full == nil:
+			set.Problems = append(set.Problems, "no full backup precedes this set; it may have been deleted")
+		case set.BackupType == string(models.BackupTypeDifferential):
+			base = []*backupChainSet{full}
+			diff, incs = set, nil
+		default:
+			base = []*backupChainSet{full}
+			if diff != nil {
+				base = append(base, diff)
+			}
+			base = append(base, incs...)
+			incs = append(incs, set)
+		}
+		if len(base) > 0 {
+			dep := base[len(base)-1].BackupSetID
+			set.DependsOn = &dep
+		}
+
+		if set.chainBrokenReason != "" {
+			set.Problems = append(set.Problems, set.chainBrokenReason)
+		}
+		if !set.hasCatalog && set.FileCount > 0 {
+			set.Problems = append(set.Problems, "catalog missing, the set's files cannot be selected for restore")
+		}
+		for _, b := range base {
+			set.Requires = append(set.Requires, b.BackupSetID)
+			if b.lost != "" {
+				set.Problems = append(set.Problems, chainBreakReason(b.BackupSetID, b.lost))
+			} else if b.Expired && !set.Expired {
+				set.Problems = append(set.Problems, fmt.Sprintf("requires expired backup set %d", b.BackupSetID))
+			}
+			if !b.hasCatalog && b.FileCount > 0 {
+				set.Problems = append(set.Problems, fmt.Sprintf("requires backup set %d, whose catalog is missing", b.BackupSetID))
+			}
+		}
+		set.Requires = append(set.Requires, set.BackupSetID)
+	}
+
+	for _, c := range chains {
+		valid, expired := 0, 0
+		for _, set := range c.Sets {
+			if set.Invalidated {
+				continue
+			}
+			valid++
+			if set.Expired {
+				expired++
+			}
+			if len(set.Problems) > 0 {
+				c.Broken = true
+			}
+		}
+		c.Expired = valid > 0 && expired == valid
+	}
+	return chains
+}
@@ -0,0 +1,199 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/RoseOO/TapeBackarr/internal/auth"
+)
+
+var (
+	errBackupSetNotInvalidatable = errors.New("only completed backup sets can be invalidated")
+	errBackupSetInvalidated      = errors.New("backup set is already invalidated")
+	errBackupSetSpanned          = errors.New("backup set is part of a backup spanning several tapes; delete the whole backup instead")
+	errBackupSetChained          = errors.New("later incremental or differential backups of the job depend on this backup set; invalidate them first")
+)
+
+// setBytesExpr is the space a backup set takes on tape: the bytes written
+// after compression where recorded, otherwise its source size
+const setBytesExpr = "CASE WHEN bs.tape_bytes > 0 THEN bs.tape_bytes ELSE bs.total_bytes END"
+
+// invalidateBackupSet logically deletes a completed backup set. Its catalog
+// and snapshots are removed so it can no longer be restored or used as the
+// base of an incremental, but the row stays so its space on tape is counted
+// as reclaimable until the tape is recycled. Later sets on the tape are not
+// affected.
+func (s *Server) invalidateBackupSet(id int64, userID *int64, reason string) error {
+	var status string
+	var invalidatedAt *time.Time
+	err := s.db.QueryRow("SELECT status, invalidated_at FROM backup_sets WHERE id = ?", id).Scan(&status, &invalidatedAt)
+	if err != nil {
+		return errBackupSetNotFound
+	}
+	if status != "completed" {
+		return errBackupSetNotInvalidatable
+	}
+	if invalidatedAt != nil {
+		return errBackupSetInvalidated
+	}
+
+	var refs int
+	s.db.QueryRow("SELECT COUNT(*) FROM catalog_entries WHERE ref_backup_set_id = ? AND backup_set_id != ?", id, id).Scan(&refs)
+	if refs > 0 {
+		return errBackupSetReferenced
+	}
+	var spanned int
+	s.db.QueryRow("SELECT COUNT(*) FROM tape_spanning_members WHERE backup_set_id = ?", id).Scan(&spanned)
+	if spanned > 0 {
+		return errBackupSetSpanned
+	}
+
+	// An incremental is restored on top of every valid set back to the
+	// latest differential or full, and a differential on top of the full.
+	// A later set of either kind without a newer full may need this set.
+	var dependents int
+	s.db.QueryRow(`
+		SELECT COUNT(*) FROM backup_sets l, backup_sets bs
+		WHERE bs.id = ? AND l.job_id = bs.job_id AND l.status = 'completed' AND l.invalidated_at IS NULL
+		  AND l.start_time > bs.start_time
+		  AND (
+			(l.backup_type = 'incremental' AND NOT EXISTS (
+				SELECT 1 FROM backup_sets d
+				WHERE d.job_id = l.job_id AND d.status = 'completed' AND d.invalidated_at IS NULL
+				  AND d.backup_type = 'differential' AND d.start_time > bs.start_time AND d.start_time < l.start_time
+			))
+			OR (l.backup_type = 'differential' AND bs.backup_type = 'full')
+		  )
+		  AND NOT EXISTS (
+			SELECT 1 FROM backup_sets f
+			WHERE f.job_id = l.job_id AND f.status = 'completed' AND f.invalidated_at IS NULL
+			  AND f.backup_type = 'full' AND f.start_time > bs.start_time AND f.start_time < l.start_time
+		  )
+	`, id).Scan(&dependents)
+	if dependents > 0 {
+		return errBackupSetChained
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if _, err := tx.Exec("DELETE FROM catalog_entries WHERE backup_set_id = ?", id); err != nil {
+		return err
+	}
+	// The next incremental must not skip files that only this set held
+	if _, err := tx.Exec("DELETE FROM snapshots WHERE backup_set_id = ?", id); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(`
+		UPDATE backup_sets SET invalidated_at = CURRENT_TIMESTAMP, invalidated_by = ?, invalidation_reason = ?,
+		       updated_at = CURRENT_TIMESTAMP
+		WHERE id = ?
+	`, userID, reason, id); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// handleInvalidateBackupSet marks a backup set as logically deleted while
+// its data stays on tape
+func (s *Server) handleInvalidateBackupSet(w http.ResponseWriter, r *http.Request) {
+	id, err := s.getIDParam(r)
+	if err != nil {
+		s.respondError(w, http.StatusBadRequest, "invalid backup set id")
+		return
+	}
+	var req struct {
+		Reason string `json:"reason"`
+	}
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			s.respondError(w, http.StatusBadRequest, "invalid request body")
+			return
+		}
+	}
+	req.Reason = strings.TrimSpace(req.Reason)
+
+	var userID *int64
+	if claims, ok := r.Context().Value("claims").(*auth.Claims); ok {
+		userID = &claims.UserID
+	}
+	if err := s.invalidateBackupSet(id, userID, req.Reason); err != nil {
+		switch {
+		case errors.Is(err, errBackupSetNotFound):
+			s.respondError(w, http.StatusNotFound, err.Error())
+		case errors.Is(err, errBackupSetNotInvalidatable):
+			s.respondError(w, http.StatusBadRequest, err.Error())
+		case errors.Is(err, errBackupSetInvalidated), errors.Is(err, errBackupSetReferenced),
+			errors.Is(err, errBackupSetSpanned), errors.Is(err, errBackupSetChained):
+			s.respondError(w, http.StatusConflict, err.Error())
+		default:
+			s.respondError(w, http.StatusInternalServerError, "failed to invalidate backup set")
+		}
+		return
+	}
+
+	details := fmt.Sprintf("Invalidated backup set #%d", id)
+	if req.Reason != "" {
+		details += ": " + req.Reason
+	}
+	s.auditLog(r, "invalidate", "backup_set", id, details)
+	s.respondJSON(w, http.StatusOK, map[string]string{"status": "invalidated"})
+}
+
+// handleListReclaimableTapes reports, per tape holding invalidated backup
+// sets, how much of its used space would be freed by recycling it. Tapes
+// with no valid sets left can be recycled as they are; the others need
+// their valid sets consolidated onto another tape first.
+func (s *Server) handleListReclaimableTapes(w http.ResponseWriter, r *http.Request) {
+	rows, err := s.db.Query(`
+		SELECT t.id, t.label, t.status, COALESCE(tp.name, ''), t.capacity_bytes, t.used_bytes,
+		       SUM(CASE WHEN bs.invalidated_at IS NOT NULL THEN ` + setBytesExpr + ` ELSE 0 END),
+		       SUM(CASE WHEN bs.invalidated_at IS NOT NULL THEN 1 ELSE 0 END),
+		       SUM(CASE WHEN bs.invalidated_at IS NULL THEN 1 ELSE 0 END)
+		FROM tapes t
+		JOIN backup_sets bs ON bs.tape_id = t.id AND bs.status = 'completed'
+		LEFT JOIN tape_pools tp ON tp.id = t.pool_id
+		GROUP BY t.id
+		HAVING SUM(CASE WHEN bs.invalidated_at IS NOT NULL THEN 1 ELSE 0 END) > 0
+		ORDER BY 7 DESC, t.label
+	`)
+	if err != nil {
+		s.respondError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	defer rows.Close()
+
+	tapes := make([]map[string]interface{}, 0)
+	for rows.Next() {
+		var id, capacity, used, reclaimable int64
+		var label, status, poolName string
+		var invalidated, valid int
+		if err := rows.Scan(&id, &label, &status, &poolName, &capacity, &used, &reclaimable, &invalidated, &valid); err != nil {
+			continue
+		}
+		var percent float64
+		if used > 0 {
+			percent = float64(reclaimable) * 100 / float64(used)
+		}
+		tapes = append(tapes, map[string]interface{}{
+			"tape_id":             id,
+			"label":               label,
+			"status":              status,
+			"pool_name":           poolName,
+			"capacity_bytes":      capacity,
+			"used_bytes":          used,
+			"reclaimable_bytes":   reclaimable,
+			"reclaimable_percent": percent,
+			"invalidated_sets":    invalidated,
+			"valid_sets":          valid,
+			"fully_reclaimable":   valid == 0,
+		})
+	}
+	s.respondJSON(w, http.StatusOK, tapes)
+}
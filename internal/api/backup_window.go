@@ -0,0 +1,118 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/RoseOO/TapeBackarr/internal/backup"
+	"github.com/RoseOO/TapeBackarr/internal/notifications"
+	"github.com/RoseOO/TapeBackarr/internal/scheduler"
+)
+
+// buildWindowReport collects the backup sets of a window and merges in the
+// scheduled runs that failed before writing one.
+func (s *Server) buildWindowReport(from, to time.Time, failures []scheduler.RunFailure) (*backup.WindowReport, error) {
+	report, err := s.backupService.BackupWindowReport(from, to)
+	if err != nil {
+		return nil, err
+	}
+	for _, f := range failures {
+		report.AddFailure(f.JobID, f.JobName, f.Error)
+	}
+	return report, nil
+}
+
+// sendBackupWindowReport is the scheduler's window callback. It publishes one
+// event and one Telegram/email notification for the whole window.
+func (s *Server) sendBackupWindowReport(from, to time.Time, failures []scheduler.RunFailure) {
+	report, err := s.buildWindowReport(from, to, failures)
+	if err != nil {
+		if s.logger != nil {
+			s.logger.Error("Failed to build backup window report", map[string]interface{}{"error": err.Error()})
+		}
+		return
+	}
+
+	if s.eventBus != nil {
+		eventType := "success"
+		if report.Failed > 0 {
+			eventType = "warning"
+		}
+		s.eventBus.Publish(SystemEvent{
+			Type:     eventType,
+			Category: "backup",
+			Key:      "backup_window_report",
+			Args:     []interface{}{report.Succeeded, report.Failed, telegramFormatBytes(report.Bytes), len(report.Tapes)},
+		})
+	}
+
+	summary := notifications.WindowSummary{
+		From:      report.From,
+		To:        report.To,
+		Succeeded: report.Succeeded,
+		Failed:    report.Failed,
+		Running:   report.Running,
+		Files:     report.Files,
+		Bytes:     report.Bytes,
+		Tapes:     report.Tapes,
+	}
+	for _, job := range report.Jobs {
+		summary.Jobs = append(summary.Jobs, notifications.WindowJobSummary{
+			Name:      job.JobName,
+			Runs:      job.Runs,
+			Succeeded: job.Succeeded,
+			Failed:    job.Failed,
+			Running:   job.Running,
+			Bytes:     job.Bytes,
+			Error:     job.Error,
+		})
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	if s.telegramService != nil {
+		if err := s.telegramService.NotifyBackupWindow(ctx, summary); err != nil && s.logger != nil {
+			s.logger.Warn("Failed to send backup window report via Telegram", map[string]interface{}{"error": err.Error()})
+		}
+	}
+	if s.emailService != nil {
+		if err := s.emailService.NotifyBackupWindow(ctx, summary); err != nil && s.logger != nil {
+			s.logger.Warn("Failed to send backup window report via email", map[string]interface{}{"error": err.Error()})
+		}
+	}
+}
+
+// handleBackupWindowReport previews the window report. from and to are
+// RFC 3339 times; by default the report covers the last 24 hours.
+func (s *Server) handleBackupWindowReport(w http.ResponseWriter, r *http.Request) {
+	to := time.Now()
+	if v := r.URL.Query().Get("to"); v != "" {
+		t, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			s.respondError(w, http.StatusBadRequest, "to must be an RFC 3339 time")
+			return
+		}
+		to = t
+	}
+	from := to.Add(-24 * time.Hour)
+	if v := r.URL.Query().Get("from"); v != "" {
+		t, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			s.respondError(w, http.StatusBadRequest, "from must be an RFC 3339 time")
+			return
+		}
+		from = t
+	}
+	if !from.Before(to) {
+		s.respondError(w, http.StatusBadRequest, "from must be before to")
+		return
+	}
+
+	report, err := s.buildWindowReport(from, to, s.scheduler.Failures(from, to))
+	if err != nil {
+		s.respondError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	s.respondJSON(w, http.StatusOK, report)
+}
@@ -0,0 +1,85 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/RoseOO/TapeBackarr/internal/backup"
+	"github.com/RoseOO/TapeBackarr/internal/models"
+)
+
+const (
+	// maxBenchmarkSizeMB caps the data pushed through each benchmark stage.
+	maxBenchmarkSizeMB = 100 * 1024
+	// maxBenchmarkStageSeconds keeps a full run inside the request timeout.
+	maxBenchmarkStageSeconds = 10
+)
+
+// handleRunBenchmark runs the backup pipeline against /dev/null or a virtual
+// device and reports the achievable throughput of each stage.
+func (s *Server) handleRunBenchmark(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		SourceID            *int64 `json:"source_id"`
+		DevicePath          string `json:"device_path"`
+		Compression         string `json:"compression"`
+		Encrypt             bool   `json:"encrypt"`
+		SizeMB              int64  `json:"size_mb"`
+		StageTimeoutSeconds int    `json:"stage_timeout_seconds"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		s.respondError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+
+	opts := backup.BenchmarkOptions{
+		DevicePath:  req.DevicePath,
+		Compression: models.CompressionType(req.Compression),
+		Encrypt:     req.Encrypt,
+	}
+	switch opts.Compression {
+	case "", models.CompressionNone, models.CompressionLTO, models.CompressionGzip, models.CompressionZstd:
+	default:
+		s.respondError(w, http.StatusBadRequest, "compression must be one of: none, lto, gzip, zstd")
+		return
+	}
+	if opts.DevicePath != "" {
+		if err := backup.ValidateBenchmarkDevice(opts.DevicePath); err != nil {
+			s.respondError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+	}
+	if req.SizeMB < 0 || req.SizeMB > maxBenchmarkSizeMB {
+		s.respondError(w, http.StatusBadRequest, fmt.Sprintf("size_mb must be between 1 and %d", maxBenchmarkSizeMB))
+		return
+	}
+	opts.SizeBytes = req.SizeMB * 1024 * 1024
+	if req.StageTimeoutSeconds < 0 || req.StageTimeoutSeconds > maxBenchmarkStageSeconds {
+		s.respondError(w, http.StatusBadRequest, fmt.Sprintf("stage_timeout_seconds must be between 1 and %d", maxBenchmarkStageSeconds))
+		return
+	}
+	opts.StageTimeout = time.Duration(req.StageTimeoutSeconds) * time.Second
+
+	if req.SourceID != nil {
+		var source models.BackupSource
+		err := s.db.QueryRow(`
+			SELECT id, name, source_type, path, include_patterns, exclude_patterns, symlink_policy
+			FROM backup_sources WHERE id = ?
+		`, *req.SourceID).Scan(&source.ID, &source.Name, &source.SourceType, &source.Path, &source.IncludePatterns, &source.ExcludePatterns, &source.SymlinkPolicy)
+		if err != nil {
+			s.respondError(w, http.StatusNotFound, "source not found")
+			return
+		}
+		opts.Source = &source
+	}
+
+	result, err := s.backupService.RunBenchmark(r.Context(), opts)
+	if err != nil {
+		s.respondError(w, http.StatusInternalServerError, fmt.Sprintf("benchmark failed: %v", err))
+		return
+	}
+
+	s.auditLog(r, "benchmark", "system", 0, fmt.Sprintf("Ran pipeline benchmark against %s (bottleneck: %s)", result.DevicePath, result.Bottleneck))
+	s.respondJSON(w, http.StatusOK, result)
+}
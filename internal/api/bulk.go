@@ -0,0 +1,376 @@
+package api
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/RoseOO/TapeBackarr/internal/auth"
+)
+
+// maxBulkBackupSets caps the number of backup sets accepted by a single bulk request.
+const maxBulkBackupSets = 1000
+
+// bulkItemResult is the outcome of a bulk operation on one backup set.
+type bulkItemResult struct {
+	BackupSetID int64    `json:"backup_set_id"`
+	OK          bool     `json:"ok"`
+	Message     string   `json:"message,omitempty"`
+	Issues      []string `json:"issues,omitempty"`
+}
+
+// bulkOpState tracks a running bulk backup-set operation.
+type bulkOpState struct {
+	mu        sync.Mutex
+	running   bool
+	cancel    context.CancelFunc
+	action    string // "delete", "verify" or "recompute"
+	total     int
+	processed int
+	succeeded int
+	failed    int
+	results   []bulkItemResult
+	started   time.Time
+	finished  time.Time
+}
+
+// handleBulkBackupSets starts a background bulk operation over a selection of
+// backup sets. Only one bulk operation may run at a time.
+func (s *Server) handleBulkBackupSets(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Action string  `json:"action"`
+		IDs    []int64 `json:"ids"`
+		// Force deletes sets even if later sets depend on them
+		Force bool `json:"force"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		s.respondError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+
+	var op func(id int64) bulkItemResult
+	switch req.Action {
+	case "delete":
+		op = s.bulkDeleteBackupSet
+	case "verify":
+		op = s.verifyBackupSetCatalog
+	case "recompute":
+		op = s.recomputeBackupSetStats
+	default:
+		s.respondError(w, http.StatusBadRequest, "action must be one of: delete, verify, recompute")
+		return
+	}
+	if len(req.IDs) == 0 {
+		s.respondError(w, http.StatusBadRequest, "ids is required")
+		return
+	}
+	if len(req.IDs) > maxBulkBackupSets {
+		s.respondError(w, http.StatusBadRequest, fmt.Sprintf("at most %d backup sets can be processed per request", maxBulkBackupSets))
+		return
+	}
+	var breaks []chainBreak
+	if req.Action == "delete" {
+		var ok bool
+		if breaks, ok = s.checkChainBreaks(w, req.IDs, chainLostDeleted, req.Force); !ok {
+			return
+		}
+	}
+
+	s.bulkOp.mu.Lock()
+	if s.bulkOp.running {
+		s.bulkOp.mu.Unlock()
+		s.respondErrorCode(w, http.StatusConflict, codeOperationInProgress, "a bulk backup set operation is already running", nil)
+		return
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	s.bulkOp.running = true
+	s.bulkOp.cancel = cancel
+	s.bulkOp.action = req.Action
+	s.bulkOp.total = len(req.IDs)
+	s.bulkOp.processed = 0
+	s.bulkOp.succeeded = 0
+	s.bulkOp.failed = 0
+	s.bulkOp.results = make([]bulkItemResult, 0, len(req.IDs))
+	s.bulkOp.started = time.Now()
+	s.bulkOp.finished = time.Time{}
+	s.bulkOp.mu.Unlock()
+
+	claims, _ := r.Context().Value("claims").(*auth.Claims)
+	ipAddress := clientIP(r)
+	ids := req.IDs
+	action := req.Action
+
+	go func() {
+		var deleted []int64
+		defer func() {
+			if rec := recover(); rec != nil {
+				if s.logger != nil {
+					s.logger.Error("Panic in bulk backup set goroutine", map[string]interface{}{
+						"action": action,
+						"panic":  fmt.Sprintf("%v", rec),
+					})
+				}
+			}
+			s.bulkOp.mu.Lock()
+			s.bulkOp.running = false
+			s.bulkOp.cancel = nil
+			s.bulkOp.finished = time.Now()
+			succeeded, failed := s.bulkOp.succeeded, s.bulkOp.failed
+			s.bulkOp.mu.Unlock()
+			cancel()
+
+			s.flagChainBreaks(breaks, deleted)
+			s.auditLogDirect(claims, ipAddress, "bulk_"+action, "backup_set", 0,
+				fmt.Sprintf("Bulk %s of %d backup sets: %d succeeded, %d failed", action, len(ids), succeeded, failed))
+			if s.eventBus != nil {
+				s.eventBus.Publish(SystemEvent{
+					Type:     "info",
+					Category: "backup",
+					Key:      "bulk_operation_finished",
+					Args:     []interface{}{action, len(ids), succeeded, failed},
+				})
+			}
+		}()
+
+		for _, id := range ids {
+			if ctx.Err() != nil {
+				return
+			}
+			res := op(id)
+			s.bulkOp.mu.Lock()
+			s.bulkOp.processed++
+			if res.OK {
+				s.bulkOp.succeeded++
+				if action == "delete" {
+					deleted = append(deleted, id)
+				}
+			} else {
+				s.bulkOp.failed++
+			}
+			s.bulkOp.results = append(s.bulkOp.results, res)
+			s.bulkOp.mu.Unlock()
+		}
+	}()
+
+	s.respondJSON(w, http.StatusAccepted, map[string]interface{}{
+		"status":  "started",
+		"action":  req.Action,
+		"total":   len(req.IDs),
+		"message": fmt.Sprintf("Bulk %s of %d backup sets started", req.Action, len(req.IDs)),
+	})
+}
+
+// handleBulkBackupSetsStatus returns progress and per-set results of the
+// current or most recent bulk operation.
+func (s *Server) handleBulkBackupSetsStatus(w http.ResponseWriter, r *http.Request) {
+	s.bulkOp.mu.Lock()
+	status := map[string]interface{}{
+		"running":   s.bulkOp.running,
+		"action":    s.bulkOp.action,
+		"total":     s.bulkOp.total,
+		"processed": s.bulkOp.processed,
+		"succeeded": s.bulkOp.succeeded,
+		"failed":    s.bulkOp.failed,
+		"results":   append([]bulkItemResult{}, s.bulkOp.results...),
+	}
+	if !s.bulkOp.started.IsZero() {
+		status["started"] = s.bulkOp.started.Format(time.RFC3339)
+	}
+	if !s.bulkOp.finished.IsZero() {
+		status["finished"] = s.bulkOp.finished.Format(time.RFC3339)
+	}
+	s.bulkOp.mu.Unlock()
+	s.respondJSON(w, http.StatusOK, status)
+}
+
+// handleBulkBackupSetsCancel stops a running bulk operation after the current set.
+func (s *Server) handleBulkBackupSetsCancel(w http.ResponseWriter, r *http.Request) {
+	s.bulkOp.mu.Lock()
+	defer s.bulkOp.mu.Unlock()
+	if !s.bulkOp.running || s.bulkOp.cancel == nil {
+		s.respondError(w, http.StatusBadRequest, "no bulk operation is running")
+		return
+	}
+	s.bulkOp.cancel()
+	s.respondJSON(w, http.StatusOK, map[string]string{"status": "cancelling"})
+}
+
+// handleBulkExportCatalogs streams the catalog entries of the selected backup
+// sets as CSV (default) or JSON.
+func (s *Server) handleBulkExportCatalogs(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		IDs    []int64 `json:"ids"`
+		Format string  `json:"format"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		s.respondError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+	if len(req.IDs) == 0 {
+		s.respondError(w, http.StatusBadRequest, "ids is required")
+		return
+	}
+	if len(req.IDs) > maxBulkBackupSets {
+		s.respondError(w, http.StatusBadRequest, fmt.Sprintf("at most %d backup sets can be exported per request", maxBulkBackupSets))
+		return
+	}
+	if req.Format == "" {
+		req.Format = "csv"
+	}
+	if req.Format != "csv" && req.Format != "json" {
+		s.respondError(w, http.StatusBadRequest, "format must be csv or json")
+		return
+	}
+
+	type exportEntry struct {
+		BackupSetID int64     `json:"backup_set_id"`
+		TapeLabel   string    `json:"tape_label"`
+		FilePath    string    `json:"file_path"`
+		FileSize    int64     `json:"file_size"`
+		FileMode    int       `json:"file_mode"`
+		ModTime     time.Time `json:"mod_time"`
+		Checksum    string    `json:"checksum"`
+	}
+
+	filename := fmt.Sprintf("catalog-export-%s.%s", time.Now().Format("20060102-150405"), req.Format)
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+	var csvWriter *csv.Writer
+	var jsonEncoder *json.Encoder
+	if req.Format == "csv" {
+		w.Header().Set("Content-Type", "text/csv")
+		csvWriter = csv.NewWriter(w)
+		csvWriter.Write([]string{"backup_set_id", "tape_label", "file_path", "file_size", "file_mode", "mod_time", "checksum"})
+	} else {
+		w.Header().Set("Content-Type", "application/json")
+		jsonEncoder = json.NewEncoder(w)
+		w.Write([]byte("["))
+	}
+
+	first := true
+	for _, id := range req.IDs {
+		rows, err := s.db.Query(`
+			SELECT ce.backup_set_id, COALESCE(t.label, ''), ce.file_path, ce.file_size, ce.file_mode, ce.mod_time, COALESCE(ce.checksum, '')
+			FROM catalog_entries ce
+			LEFT JOIN backup_sets bs ON ce.backup_set_id = bs.id
+			LEFT JOIN tapes t ON bs.tape_id = t.id
+			WHERE ce.backup_set_id = ?
+			ORDER BY ce.file_path
+		`, id)
+		if err != nil {
+			s.logger.Warn("Failed to query catalog for export", map[string]interface{}{"backup_set_id": id, "error": err.Error()})
+			continue
+		}
+		for rows.Next() {
+			var e exportEntry
+			if err := rows.Scan(&e.BackupSetID, &e.TapeLabel, &e.FilePath, &e.FileSize, &e.FileMode, &e.ModTime, &e.Checksum); err != nil {
+				continue
+			}
+			if csvWriter != nil {
+				csvWriter.Write([]string{
+					strconv.FormatInt(e.BackupSetID, 10), e.TapeLabel, e.FilePath,
+					strconv.FormatInt(e.FileSize, 10), strconv.Itoa(e.FileMode),
+					e.ModTime.Format(time.RFC3339), e.Checksum,
+				})
+			} else {
+				if !first {
+					w.Write([]byte(","))
+				}
+				jsonEncoder.Encode(e)
+			}
+			first = false
+		}
+		rows.Close()
+	}
+
+	if csvWriter != nil {
+		csvWriter.Flush()
+	} else {
+		w.Write([]byte("]"))
+	}
+	s.auditLog(r, "export", "backup_set", 0, fmt.Sprintf("Exported catalogs of %d backup sets as %s", len(req.IDs), req.Format))
+}
+
+// bulkDeleteBackupSet deletes one backup set as part of a bulk operation.
+func (s *Server) bulkDeleteBackupSet(id int64) bulkItemResult {
+	if _, err := s.deleteBackupSet(id); err != nil {
+		return bulkItemResult{BackupSetID: id, Message: err.Error()}
+	}
+	return bulkItemResult{BackupSetID: id, OK: true, Message: "deleted"}
+}
+
+// verifyBackupSetCatalog checks that a backup set's catalog is consistent with
+// its recorded statistics and that its tape is still tracked. It does not read
+// the tape itself.
+func (s *Server) verifyBackupSetCatalog(id int64) bulkItemResult {
+	var status string
+	var fileCount, totalBytes int64
+	var tapeStatus *string
+	err := s.db.QueryRow(`
+		SELECT bs.status, bs.file_count, bs.total_bytes, t.status
+		FROM backup_sets bs LEFT JOIN tapes t ON bs.tape_id = t.id
+		WHERE bs.id = ?
+	`, id).Scan(&status, &fileCount, &totalBytes, &tapeStatus)
+	if err != nil {
+		return bulkItemResult{BackupSetID: id, Message: "backup set not found"}
+	}
+
+	var issues []string
+	if status != "completed" {
+		issues = append(issues, fmt.Sprintf("backup set status is %s", status))
+	}
+	if tapeStatus == nil {
+		issues = append(issues, "tape record is missing")
+	} else if *tapeStatus == "blank" || *tapeStatus == "retired" {
+		issues = append(issues, fmt.Sprintf("tape status is %s", *tapeStatus))
+	}
+
+	var catalogCount, catalogBytes, missingChecksums int64
+	s.db.QueryRow(`
+		SELECT COUNT(*), COALESCE(SUM(file_size), 0),
+			COALESCE(SUM(CASE WHEN checksum IS NULL OR checksum = '' THEN 1 ELSE 0 END), 0)
+		FROM catalog_entries WHERE backup_set_id = ?
+	`, id).Scan(&catalogCount, &catalogBytes, &missingChecksums)
+	if catalogCount != fileCount {
+		issues = append(issues, fmt.Sprintf("catalog has %d entries but set records %d files", catalogCount, fileCount))
+	}
+	if catalogBytes != totalBytes {
+		issues = append(issues, fmt.Sprintf("catalog totals %d bytes but set records %d bytes", catalogBytes, totalBytes))
+	}
+	if missingChecksums > 0 {
+		issues = append(issues, fmt.Sprintf("%d catalog entries have no checksum", missingChecksums))
+	}
+
+	if len(issues) > 0 {
+		return bulkItemResult{BackupSetID: id, Message: "verification found issues", Issues: issues}
+	}
+	return bulkItemResult{BackupSetID: id, OK: true, Message: "catalog consistent"}
+}
+
+// recomputeBackupSetStats recalculates file_count and total_bytes of a backup
+// set from its catalog entries.
+func (s *Server) recomputeBackupSetStats(id int64) bulkItemResult {
+	var status string
+	var oldCount, oldBytes int64
+	if err := s.db.QueryRow("SELECT status, file_count, total_bytes FROM backup_sets WHERE id = ?", id).Scan(&status, &oldCount, &oldBytes); err != nil {
+		return bulkItemResult{BackupSetID: id, Message: "backup set not found"}
+	}
+	if status == "running" || status == "pending" {
+		return bulkItemResult{BackupSetID: id, Message: "cannot recompute statistics of a running backup set"}
+	}
+
+	var newCount, newBytes int64
+	s.db.QueryRow("SELECT COUNT(*), COALESCE(SUM(file_size), 0) FROM catalog_entries WHERE backup_set_id = ?", id).Scan(&newCount, &newBytes)
+	if _, err := s.db.Exec("UPDATE backup_sets SET file_count = ?, total_bytes = ?, updated_at = CURRENT_TIMESTAMP WHERE id = ?", newCount, newBytes, id); err != nil {
+		return bulkItemResult{BackupSetID: id, Message: err.Error()}
+	}
+	return bulkItemResult{
+		BackupSetID: id,
+		OK:          true,
+		Message:     fmt.Sprintf("files %d -> %d, bytes %d -> %d", oldCount, newCount, oldBytes, newBytes),
+	}
+}
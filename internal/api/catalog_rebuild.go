@@ -0,0 +1,305 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/RoseOO/TapeBackarr/internal/auth"
+	"github.com/RoseOO/TapeBackarr/internal/backup"
+	"github.com/RoseOO/TapeBackarr/internal/tape"
+)
+
+// rebuildSlotResult is the outcome of scanning the tape in one library slot.
+type rebuildSlotResult struct {
+	SlotNumber int                   `json:"slot_number"`
+	Barcode    string                `json:"barcode,omitempty"`
+	OK         bool                  `json:"ok"`
+	Message    string                `json:"message,omitempty"`
+	Result     *backup.RebuildResult `json:"result,omitempty"`
+}
+
+// catalogRebuildState tracks a running library-wide catalog rebuild.
+type catalogRebuildState struct {
+	mu        sync.Mutex
+	running   bool
+	cancel    context.CancelFunc
+	libraryID int64
+	dryRun    bool
+	total     int
+	processed int
+	sets      int
+	failed    int
+	results   []rebuildSlotResult
+	started   time.Time
+	finished  time.Time
+}
+
+// rebuildDrive resolves an enabled drive to a tape service for it
+func (s *Server) rebuildDrive(driveID int64) (*tape.Service, error) {
+	var devicePath string
+	if err := s.db.QueryRow("SELECT device_path FROM tape_drives WHERE id = ? AND enabled = 1", driveID).Scan(&devicePath); err != nil {
+		return nil, err
+	}
+	return tape.NewServiceForDevice(devicePath, s.tapeService.GetBlockSize()), nil
+}
+
+// handleRebuildCatalogScan rebuilds the catalog from the tape an operator
+// loaded into a drive. It reads the label and every TOC on the tape and
+// records the tape, its backup sets and their catalog entries.
+func (s *Server) handleRebuildCatalogScan(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		DriveID int64 `json:"drive_id"`
+		DryRun  bool  `json:"dry_run"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		s.respondError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+	if req.DriveID == 0 {
+		s.respondError(w, http.StatusBadRequest, "drive_id is required")
+		return
+	}
+	driveSvc, err := s.rebuildDrive(req.DriveID)
+	if err != nil {
+		s.respondError(w, http.StatusBadRequest, "drive not found or not enabled")
+		return
+	}
+
+	result, err := s.backupService.RebuildCatalogFromTape(r.Context(), driveSvc, req.DryRun)
+	if errors.Is(err, backup.ErrUnlabeledTape) {
+		s.respondError(w, http.StatusUnprocessableEntity, err.Error())
+		return
+	}
+	if err != nil {
+		s.respondError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	if !req.DryRun {
+		s.tapeService.GetLabelCache().InvalidateAllReason("catalog_rebuild")
+		s.auditLog(r, "rebuild", "catalog", result.TapeID,
+			fmt.Sprintf("Rebuilt catalog from tape %s: %d backup sets", result.Label, len(result.Sets)))
+	}
+	s.respondJSON(w, http.StatusOK, result)
+}
+
+// handleRebuildCatalogLibrary starts a background catalog rebuild over the
+// tapes in a library: each occupied storage slot is loaded into the drive,
+// scanned and unloaded again. Only one library rebuild may run at a time.
+func (s *Server) handleRebuildCatalogLibrary(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		LibraryID int64 `json:"library_id"`
+		DriveID   int64 `json:"drive_id"`
+		Slots     []int `json:"slots"`
+		DryRun    bool  `json:"dry_run"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		s.respondError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+	if req.LibraryID == 0 || req.DriveID == 0 {
+		s.respondError(w, http.StatusBadRequest, "library_id and drive_id are required")
+		return
+	}
+
+	var changerPath string
+	if err := s.db.QueryRow("SELECT device_path FROM tape_libraries WHERE id = ?", req.LibraryID).Scan(&changerPath); err != nil {
+		s.respondError(w, http.StatusNotFound, "library not found")
+		return
+	}
+	if err := s.library.CheckChanger(changerPath); err != nil {
+		s.respondError(w, http.StatusServiceUnavailable, err.Error())
+		return
+	}
+	var drivePath string
+	var driveNumber *int64
+	err := s.db.QueryRow(`
+		SELECT device_path, library_drive_number FROM tape_drives
+		WHERE id = ? AND enabled = 1 AND library_id = ?
+	`, req.DriveID, req.LibraryID).Scan(&drivePath, &driveNumber)
+	if err != nil {
+		s.respondError(w, http.StatusBadRequest, "drive not found, not enabled or not in this library")
+		return
+	}
+	driveNum := 0
+	if driveNumber != nil {
+		driveNum = int(*driveNumber)
+	}
+
+	wanted := make(map[int]bool, len(req.Slots))
+	for _, slot := range req.Slots {
+		wanted[slot] = true
+	}
+	rows, err := s.db.Query(`
+		SELECT slot_number, COALESCE(barcode, '') FROM tape_library_slots
+		WHERE library_id = ? AND slot_type = 'storage' AND is_empty = 0
+		ORDER BY slot_number
+	`, req.LibraryID)
+	if err != nil {
+		s.respondError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	var slots []rebuildSlotResult
+	for rows.Next() {
+		var slot rebuildSlotResult
+		if err := rows.Scan(&slot.SlotNumber, &slot.Barcode); err != nil {
+			continue
+		}
+		if len(wanted) == 0 || wanted[slot.SlotNumber] {
+			slots = append(slots, slot)
+		}
+	}
+	rows.Close()
+	if len(slots) == 0 {
+		s.respondError(w, http.StatusBadRequest, "no occupied storage slots to scan; run a library inventory first")
+		return
+	}
+
+	s.catalogRebuild.mu.Lock()
+	if s.catalogRebuild.running {
+		s.catalogRebuild.mu.Unlock()
+		s.respondErrorCode(w, http.StatusConflict, codeOperationInProgress, "a catalog rebuild is already running", nil)
+		return
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	s.catalogRebuild.running = true
+	s.catalogRebuild.cancel = cancel
+	s.catalogRebuild.libraryID = req.LibraryID
+	s.catalogRebuild.dryRun = req.DryRun
+	s.catalogRebuild.total = len(slots)
+	s.catalogRebuild.processed = 0
+	s.catalogRebuild.sets = 0
+	s.catalogRebuild.failed = 0
+	s.catalogRebuild.results = make([]rebuildSlotResult, 0, len(slots))
+	s.catalogRebuild.started = time.Now()
+	s.catalogRebuild.finished = time.Time{}
+	s.catalogRebuild.mu.Unlock()
+
+	claims, _ := r.Context().Value("claims").(*auth.Claims)
+	ipAddress := clientIP(r)
+	libraryID := req.LibraryID
+	dryRun := req.DryRun
+	driveSvc := tape.NewServiceForDevice(drivePath, s.tapeService.GetBlockSize())
+
+	go func() {
+		defer func() {
+			if rec := recover(); rec != nil {
+				if s.logger != nil {
+					s.logger.Error("Panic in catalog rebuild goroutine", map[string]interface{}{
+						"library_id": libraryID,
+						"panic":      fmt.Sprintf("%v", rec),
+					})
+				}
+			}
+			s.catalogRebuild.mu.Lock()
+			s.catalogRebuild.running = false
+			s.catalogRebuild.cancel = nil
+			s.catalogRebuild.finished = time.Now()
+			processed, sets, failed := s.catalogRebuild.processed, s.catalogRebuild.sets, s.catalogRebuild.failed
+			s.catalogRebuild.mu.Unlock()
+			cancel()
+
+			if dryRun {
+				return
+			}
+			s.auditLogDirect(claims, ipAddress, "rebuild", "catalog", libraryID,
+				fmt.Sprintf("Rebuilt catalog from library %d: %d tapes scanned, %d backup sets, %d failed", libraryID, processed, sets, failed))
+			if s.eventBus != nil {
+				s.eventBus.Publish(SystemEvent{
+					Type:     "info",
+					Category: "tape",
+					Key:      "catalog_rebuild_finished",
+					Args:     []interface{}{processed, sets, failed},
+				})
+			}
+		}()
+
+		for _, slot := range slots {
+			if ctx.Err() != nil {
+				return
+			}
+			res := s.rebuildLibrarySlot(ctx, libraryID, driveNum, driveSvc, slot, dryRun)
+			s.catalogRebuild.mu.Lock()
+			s.catalogRebuild.processed++
+			if res.OK {
+				s.catalogRebuild.sets += len(res.Result.Sets)
+			} else {
+				s.catalogRebuild.failed++
+			}
+			s.catalogRebuild.results = append(s.catalogRebuild.results, res)
+			s.catalogRebuild.mu.Unlock()
+		}
+	}()
+
+	s.respondJSON(w, http.StatusAccepted, map[string]interface{}{
+		"status":  "started",
+		"total":   len(slots),
+		"message": fmt.Sprintf("Catalog rebuild of %d tapes in library %d started", len(slots), req.LibraryID),
+	})
+}
+
+// rebuildLibrarySlot loads the tape in a slot, rebuilds the catalog from it
+// and returns it to its slot.
+func (s *Server) rebuildLibrarySlot(ctx context.Context, libraryID int64, driveNum int, driveSvc *tape.Service, slot rebuildSlotResult, dryRun bool) rebuildSlotResult {
+	if err := s.library.LoadSlot(ctx, libraryID, slot.SlotNumber, driveNum); err != nil {
+		slot.Message = err.Error()
+		return slot
+	}
+
+	result, err := s.backupService.RebuildCatalogFromTape(ctx, driveSvc, dryRun)
+	if err != nil {
+		slot.Message = err.Error()
+	} else {
+		slot.OK = true
+		slot.Result = result
+	}
+
+	// Unload even when the scan was cancelled so the drive is left empty
+	if err := s.library.UnloadSlot(context.Background(), libraryID, slot.SlotNumber, driveNum); err != nil {
+		slot.OK = false
+		slot.Message = err.Error()
+	}
+	return slot
+}
+
+// handleRebuildCatalogStatus returns progress and per-slot results of the
+// current or most recent library catalog rebuild.
+func (s *Server) handleRebuildCatalogStatus(w http.ResponseWriter, r *http.Request) {
+	s.catalogRebuild.mu.Lock()
+	status := map[string]interface{}{
+		"running":    s.catalogRebuild.running,
+		"library_id": s.catalogRebuild.libraryID,
+		"dry_run":    s.catalogRebuild.dryRun,
+		"total":      s.catalogRebuild.total,
+		"processed":  s.catalogRebuild.processed,
+		"sets":       s.catalogRebuild.sets,
+		"failed":     s.catalogRebuild.failed,
+		"results":    append([]rebuildSlotResult{}, s.catalogRebuild.results...),
+	}
+	if !s.catalogRebuild.started.IsZero() {
+		status["started"] = s.catalogRebuild.started.Format(time.RFC3339)
+	}
+	if !s.catalogRebuild.finished.IsZero() {
+		status["finished"] = s.catalogRebuild.finished.Format(time.RFC3339)
+	}
+	s.catalogRebuild.mu.Unlock()
+	s.respondJSON(w, http.StatusOK, status)
+}
+
+// handleRebuildCatalogCancel stops a running library rebuild after the
+// current tape has been unloaded.
+func (s *Server) handleRebuildCatalogCancel(w http.ResponseWriter, r *http.Request) {
+	s.catalogRebuild.mu.Lock()
+	defer s.catalogRebuild.mu.Unlock()
+	if !s.catalogRebuild.running || s.catalogRebuild.cancel == nil {
+		s.respondError(w, http.StatusBadRequest, "no catalog rebuild is running")
+		return
+	}
+	s.catalogRebuild.cancel()
+	s.respondJSON(w, http.StatusOK, map[string]string{"status": "cancelling"})
+}
@@ -0,0 +1,212 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// codeBreaksBackupChain is returned when deleting, expiring or erasing
+// would leave other backup sets unable to be restored completely. The
+// details list them; the request is repeated with force to go ahead.
+const codeBreaksBackupChain = "breaks_backup_chain"
+
+// How backup sets are removed, as shown in the reasons of the sets that
+// depend on them
+const (
+	chainLostDeleted = "deleted"
+	chainLostExpired = "expired"
+	chainLostErased  = "erased"
+)
+
+// chainBreak is a valid backup set whose restore would read a set that is
+// about to be removed
+type chainBreak struct {
+	BackupSetID int64     `json:"backup_set_id"`
+	JobID       int64     `json:"job_id"`
+	JobName     string    `json:"job_name"`
+	BackupType  string    `json:"backup_type"`
+	StartTime   time.Time `json:"start_time"`
+	// Missing are the removed sets it depends on
+	Missing []int64 `json:"missing"`
+	Reason  string  `json:"reason"`
+
+	how string
+}
+
+// chainBreaks returns the backup sets that removing the given sets would
+// break: sets outside removed that can be restored completely now but
+// depend on one of them. how is one of the chainLost reasons. Sets that are
+// invalidated or expired themselves are not reported.
+func (s *Server) chainBreaks(removed []int64, how string) ([]chainBreak, error) {
+	lost := make(map[int64]bool, len(removed))
+	var jobIDs []int64
+	seenJobs := make(map[int64]bool)
+	for _, id := range removed {
+		lost[id] = true
+		var jobID int64
+		if err := s.db.QueryRow("SELECT job_id FROM backup_sets WHERE id = ?", id).Scan(&jobID); err != nil {
+			continue
+		}
+		if !seenJobs[jobID] {
+			seenJobs[jobID] = true
+			jobIDs = append(jobIDs, jobID)
+		}
+	}
+
+	breaks := []chainBreak{}
+	for _, jobID := range jobIDs {
+		sets, err := s.loadBackupChainSets(jobID)
+		if err != nil {
+			return nil, err
+		}
+		buildBackupChains(sets)
+		brokenBefore := make(map[int64]bool)
+		for _, set := range sets {
+			if len(set.Problems) > 0 {
+				brokenBefore[set.BackupSetID] = true
+			}
+			if lost[set.BackupSetID] {
+				set.lost = how
+			}
+		}
+		buildBackupChains(sets)
+
+		var jobName string
+		s.db.QueryRow("SELECT name FROM backup_jobs WHERE id = ?", jobID).Scan(&jobName)
+		for _, set := range sets {
+			if set.lost != "" || set.Invalidated || set.Expired || brokenBefore[set.BackupSetID] {
+				continue
+			}
+			var missing []int64
+			for _, id := range set.Requires {
+				if lost[id] {
+					missing = append(missing, id)
+				}
+			}
+			if len(missing) == 0 {
+				continue
+			}
+			breaks = append(breaks, chainBreak{
+				BackupSetID: set.BackupSetID,
+				JobID:       jobID,
+				JobName:     jobName,
+				BackupType:  set.BackupType,
+				StartTime:   set.StartTime,
+				Missing:     missing,
+				Reason:      chainBreakReason(missing[0], how),
+				how:         how,
+			})
+		}
+	}
+	return breaks, nil
+}
+
+// chainBreakReason says why a set is broken, also as listed in its chain's
+// problems
+func chainBreakReason(missing int64, how string) string {
+	return fmt.Sprintf("depends on backup set %d, which is %s", missing, how)
+}
+
+// setsOnTape returns the backup sets with data on a tape, including the
+// first set of a spanned backup that continues onto it
+func (s *Server) setsOnTape(tapeID int64) ([]int64, error) {
+	rows, err := s.db.Query(`
+		SELECT id FROM backup_sets WHERE tape_id = ?
+		UNION
+		SELECT f.backup_set_id FROM tape_spanning_members m
+		JOIN tape_spanning_members f ON f.spanning_set_id = m.spanning_set_id
+		WHERE m.tape_id = ? AND NOT EXISTS (
+			SELECT 1 FROM tape_spanning_members e
+			WHERE e.spanning_set_id = f.spanning_set_id AND e.sequence_number < f.sequence_number
+		)
+	`, tapeID, tapeID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var ids []int64
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+// checkChainBreaks works out what removing the sets would break. Unless
+// force is set, a removal that breaks chains is refused with the broken
+// sets in the details and ok is false. On an error the response has been
+// written as well.
+func (s *Server) checkChainBreaks(w http.ResponseWriter, removed []int64, how string, force bool) (breaks []chainBreak, ok bool) {
+	breaks, err := s.chainBreaks(removed, how)
+	if err != nil {
+		s.respondError(w, http.StatusInternalServerError, "failed to check backup chains: "+err.Error())
+		return nil, false
+	}
+	if len(breaks) > 0 && !force {
+		s.respondErrorCode(w, http.StatusConflict, codeBreaksBackupChain,
+			fmt.Sprintf("%d backup sets depend on the sets this would remove and could no longer be restored completely; repeat with force to go ahead", len(breaks)),
+			map[string]interface{}{"broken_sets": breaks})
+		return breaks, false
+	}
+	return breaks, true
+}
+
+// flagChainBreaks records on the broken sets that a set they depend on was
+// removed and raises a warning for each job affected. Only breaks caused
+// by a set in removed are flagged, so a partly failed removal flags what it
+// actually broke.
+func (s *Server) flagChainBreaks(breaks []chainBreak, removed []int64) {
+	done := make(map[int64]bool, len(removed))
+	for _, id := range removed {
+		done[id] = true
+	}
+	perJob := make(map[int64][]int64)
+	var jobs []int64
+	names := make(map[int64]string)
+	for _, b := range breaks {
+		reason := ""
+		for _, id := range b.Missing {
+			if done[id] {
+				reason = chainBreakReason(id, b.how)
+				break
+			}
+		}
+		if reason == "" {
+			continue
+		}
+		if _, err := s.db.Exec(`
+			UPDATE backup_sets SET chain_broken_at = CURRENT_TIMESTAMP, chain_broken_reason = ?, updated_at = CURRENT_TIMESTAMP
+			WHERE id = ? AND chain_broken_at IS NULL
+		`, reason, b.BackupSetID); err != nil {
+			if s.logger != nil {
+				s.logger.Warn("Failed to flag broken backup chain", map[string]interface{}{"backup_set_id": b.BackupSetID, "error": err.Error()})
+			}
+			continue
+		}
+		if _, ok := perJob[b.JobID]; !ok {
+			jobs = append(jobs, b.JobID)
+			names[b.JobID] = b.JobName
+		}
+		perJob[b.JobID] = append(perJob[b.JobID], b.BackupSetID)
+	}
+
+	for _, jobID := range jobs {
+		ids := perJob[jobID]
+		if s.logger != nil {
+			s.logger.Warn("Backup chain broken", map[string]interface{}{"job_id": jobID, "backup_set_ids": ids})
+		}
+		if s.eventBus != nil {
+			s.eventBus.Publish(SystemEvent{
+				Type:     "warning",
+				Category: "backup",
+				Key:      "backup_chain_broken",
+				Args:     []interface{}{len(ids), names[jobID]},
+				Details:  map[string]interface{}{"job_id": jobID, "backup_set_ids": ids},
+			})
+		}
+	}
+}
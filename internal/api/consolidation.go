@@ -0,0 +1,283 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/RoseOO/TapeBackarr/internal/auth"
+	"github.com/RoseOO/TapeBackarr/internal/backup"
+	"github.com/RoseOO/TapeBackarr/internal/tape"
+)
+
+// How long a consolidation waits for an operator to load each source tape,
+// and how often it checks the source drive meanwhile
+var (
+	consolidationLoadTimeout  = 2 * time.Hour
+	consolidationPollInterval = 15 * time.Second
+)
+
+// consolidationState tracks a running tape consolidation.
+type consolidationState struct {
+	mu       sync.Mutex
+	running  bool
+	cancel   context.CancelFunc
+	plan     *backup.ConsolidationPlan
+	message  string
+	waiting  string // label of the source tape waiting to be loaded
+	err      string
+	started  time.Time
+	finished time.Time
+}
+
+// consolidationRequest names the tapes of a consolidation and, to run it,
+// the drives to read and write them in
+type consolidationRequest struct {
+	SourceTapeIDs []int64 `json:"source_tape_ids"`
+	TargetTapeID  int64   `json:"target_tape_id"`
+	SourceDriveID int64   `json:"source_drive_id"`
+	TargetDriveID int64   `json:"target_drive_id"`
+}
+
+// planConsolidation decodes a consolidation request and plans it, writing
+// the error response itself when that fails
+func (s *Server) planConsolidation(w http.ResponseWriter, r *http.Request) (*consolidationRequest, *backup.ConsolidationPlan, bool) {
+	var req consolidationRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		s.respondError(w, http.StatusBadRequest, "invalid request body")
+		return nil, nil, false
+	}
+	if len(req.SourceTapeIDs) == 0 || req.TargetTapeID == 0 {
+		s.respondError(w, http.StatusBadRequest, "source_tape_ids and target_tape_id are required")
+		return nil, nil, false
+	}
+	plan, err := s.backupService.PlanConsolidation(req.SourceTapeIDs, req.TargetTapeID)
+	if errors.Is(err, backup.ErrInvalidConsolidation) {
+		s.respondError(w, http.StatusBadRequest, err.Error())
+		return nil, nil, false
+	}
+	if err != nil {
+		s.respondError(w, http.StatusInternalServerError, err.Error())
+		return nil, nil, false
+	}
+	return &req, plan, true
+}
+
+// handlePlanConsolidation shows which valid backup sets a consolidation
+// would copy onto the target tape, without touching any tape
+func (s *Server) handlePlanConsolidation(w http.ResponseWriter, r *http.Request) {
+	_, plan, ok := s.planConsolidation(w, r)
+	if !ok {
+		return
+	}
+	s.respondJSON(w, http.StatusOK, plan)
+}
+
+// handleStartConsolidation copies the valid backup sets of the source tapes
+// onto a blank target tape in the background. The target is read from the
+// target drive; source tapes are read one after another from the source
+// drive, and the operator is asked to load each one in turn.
+func (s *Server) handleStartConsolidation(w http.ResponseWriter, r *http.Request) {
+	req, plan, ok := s.planConsolidation(w, r)
+	if !ok {
+		return
+	}
+	if plan.SetCount == 0 {
+		s.respondError(w, http.StatusBadRequest, "the source tapes hold no valid backup sets to copy")
+		return
+	}
+	if req.SourceDriveID == 0 || req.TargetDriveID == 0 || req.SourceDriveID == req.TargetDriveID {
+		s.respondError(w, http.StatusBadRequest, "source_drive_id and target_drive_id must name two different drives")
+		return
+	}
+	source, err := s.rebuildDrive(req.SourceDriveID)
+	if err != nil {
+		s.respondError(w, http.StatusBadRequest, "source drive not found or not enabled")
+		return
+	}
+	target, err := s.rebuildDrive(req.TargetDriveID)
+	if err != nil {
+		s.respondError(w, http.StatusBadRequest, "target drive not found or not enabled")
+		return
+	}
+	var sourceDriveName string
+	s.db.QueryRow("SELECT COALESCE(display_name, device_path) FROM tape_drives WHERE id = ?", req.SourceDriveID).Scan(&sourceDriveName)
+
+	s.consolidation.mu.Lock()
+	if s.consolidation.running {
+		s.consolidation.mu.Unlock()
+		s.respondErrorCode(w, http.StatusConflict, codeOperationInProgress, "a consolidation is already running", nil)
+		return
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	s.consolidation.running = true
+	s.consolidation.cancel = cancel
+	s.consolidation.plan = plan
+	s.consolidation.message = "Starting consolidation..."
+	s.consolidation.waiting = ""
+	s.consolidation.err = ""
+	s.consolidation.started = time.Now()
+	s.consolidation.finished = time.Time{}
+	s.consolidation.mu.Unlock()
+
+	claims, _ := r.Context().Value("claims").(*auth.Claims)
+	ipAddress := clientIP(r)
+	driveIDs := []int64{req.SourceDriveID, req.TargetDriveID}
+	for _, id := range driveIDs {
+		s.db.Exec("UPDATE tape_drives SET status = 'busy' WHERE id = ?", id)
+	}
+
+	progress := func(message string) {
+		s.consolidation.mu.Lock()
+		s.consolidation.message = message
+		s.consolidation.mu.Unlock()
+	}
+	load := func(ctx context.Context, src *backup.ConsolidationSource) error {
+		return s.waitForConsolidationSource(ctx, source, src, sourceDriveName)
+	}
+
+	// Respond before the run starts filling in the plan
+	s.respondJSON(w, http.StatusAccepted, map[string]interface{}{
+		"status":  "started",
+		"plan":    plan,
+		"message": fmt.Sprintf("Consolidation of %d backup sets onto %s started", plan.SetCount, plan.TargetLabel),
+	})
+
+	go func() {
+		err := s.backupService.Consolidate(ctx, plan, source, target, load, progress)
+		cancel()
+		for _, id := range driveIDs {
+			s.db.Exec("UPDATE tape_drives SET status = 'ready' WHERE id = ?", id)
+		}
+		s.tapeService.GetLabelCache().InvalidateAllReason("consolidation")
+
+		s.consolidation.mu.Lock()
+		s.consolidation.running = false
+		s.consolidation.cancel = nil
+		s.consolidation.waiting = ""
+		s.consolidation.finished = time.Now()
+		if err != nil {
+			s.consolidation.err = err.Error()
+			s.consolidation.message = "Consolidation failed: " + err.Error()
+		} else {
+			s.consolidation.message = fmt.Sprintf("Consolidated %d backup sets onto %s", plan.SetCount, plan.TargetLabel)
+		}
+		s.consolidation.mu.Unlock()
+
+		if err != nil {
+			if s.logger != nil {
+				s.logger.Error("Tape consolidation failed", map[string]interface{}{"target": plan.TargetLabel, "error": err.Error()})
+			}
+			if s.eventBus != nil {
+				s.eventBus.Publish(SystemEvent{
+					Type:     "error",
+					Category: "tape",
+					Key:      "consolidation_failed",
+					Args:     []interface{}{plan.TargetLabel, err.Error()},
+				})
+			}
+			return
+		}
+		s.auditLogDirect(claims, ipAddress, "consolidate", "tape", plan.TargetTapeID,
+			fmt.Sprintf("Consolidated %d backup sets from %d tapes onto %s", plan.SetCount, len(plan.Sources), plan.TargetLabel))
+		if s.eventBus != nil {
+			s.eventBus.Publish(SystemEvent{
+				Type:     "success",
+				Category: "tape",
+				Key:      "consolidation_completed",
+				Args:     []interface{}{plan.SetCount, plan.TargetLabel, plan.FreedTapes},
+			})
+		}
+	}()
+}
+
+// waitForConsolidationSource returns once the source tape is in the source
+// drive, asking the operator to load it when it is not
+func (s *Server) waitForConsolidationSource(ctx context.Context, driveSvc *tape.Service, src *backup.ConsolidationSource, driveName string) error {
+	err := waitForOperatorLoad(ctx, driveSvc, src.Label, src.UUID, driveName, func() {
+		s.consolidation.mu.Lock()
+		s.consolidation.waiting = src.Label
+		s.consolidation.message = fmt.Sprintf("Waiting for tape %s to be loaded into %s", src.Label, driveName)
+		s.consolidation.mu.Unlock()
+		if s.eventBus != nil {
+			s.eventBus.Publish(SystemEvent{
+				Type:     "warning",
+				Category: "tape",
+				Key:      "consolidation_load_tape",
+				Args:     []interface{}{src.Label, driveName},
+			})
+		}
+	})
+	s.consolidation.mu.Lock()
+	s.consolidation.waiting = ""
+	s.consolidation.mu.Unlock()
+	return err
+}
+
+// waitForOperatorLoad returns once the tape is in the drive. The first time
+// it is not, ask is called to have an operator load it; the drive is then
+// checked until the tape shows up or consolidationLoadTimeout passes.
+func waitForOperatorLoad(ctx context.Context, driveSvc *tape.Service, label, uuid, driveName string, ask func()) error {
+	deadline := time.Now().Add(consolidationLoadTimeout)
+	asked := false
+	for {
+		if l, err := driveSvc.ReadTapeLabel(ctx); err == nil && l != nil && l.UUID == uuid {
+			return nil
+		}
+		if !asked {
+			asked = true
+			ask()
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("tape %s was not loaded into %s within %s", label, driveName, consolidationLoadTimeout)
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(consolidationPollInterval):
+		}
+	}
+}
+
+// handleConsolidationStatus returns the progress of the current or most
+// recent consolidation
+func (s *Server) handleConsolidationStatus(w http.ResponseWriter, r *http.Request) {
+	s.consolidation.mu.Lock()
+	status := map[string]interface{}{
+		"running": s.consolidation.running,
+		"message": s.consolidation.message,
+		"waiting": s.consolidation.waiting,
+		"error":   s.consolidation.err,
+	}
+	// The plan is filled in as sets are copied, so it is only shown once
+	// the run is over
+	if !s.consolidation.running {
+		status["plan"] = s.consolidation.plan
+	}
+	if !s.consolidation.started.IsZero() {
+		status["started"] = s.consolidation.started.Format(time.RFC3339)
+	}
+	if !s.consolidation.finished.IsZero() {
+		status["finished"] = s.consolidation.finished.Format(time.RFC3339)
+	}
+	s.consolidation.mu.Unlock()
+	s.respondJSON(w, http.StatusOK, status)
+}
+
+// handleCancelConsolidation stops a running consolidation. Nothing is
+// recorded in the catalog until every set has been copied, so a cancelled
+// run leaves the source sets as they were.
+func (s *Server) handleCancelConsolidation(w http.ResponseWriter, r *http.Request) {
+	s.consolidation.mu.Lock()
+	defer s.consolidation.mu.Unlock()
+	if !s.consolidation.running || s.consolidation.cancel == nil {
+		s.respondError(w, http.StatusBadRequest, "no consolidation is running")
+		return
+	}
+	s.consolidation.cancel()
+	s.respondJSON(w, http.StatusOK, map[string]string{"status": "cancelling"})
+}
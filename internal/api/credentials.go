@@ -0,0 +1,380 @@
+package api
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/RoseOO/TapeBackarr/internal/config"
+	"github.com/RoseOO/TapeBackarr/internal/credentials"
+	"github.com/RoseOO/TapeBackarr/internal/database"
+	"github.com/RoseOO/TapeBackarr/internal/logging"
+	"github.com/RoseOO/TapeBackarr/internal/models"
+)
+
+// newCredentialStore opens the credentials store with auth.credentials_key.
+// When no key is set yet, one is generated and saved to the config file at
+// configPath. It returns nil when the store cannot be opened.
+//
+// Secrets stored by older releases, which encrypted them with the JWT
+// secret, are moved to the credentials key whenever the store is opened, so
+// a move that fails is retried on the next start.
+func newCredentialStore(db *database.DB, cfg *config.Config, configPath string, logger *logging.Logger) *credentials.Store {
+	if cfg.Auth.CredentialsKey == "" {
+		if err := generateCredentialsKey(cfg, configPath); err != nil {
+			if logger != nil {
+				logger.Error("Failed to create a credentials key", map[string]interface{}{"error": err.Error()})
+			}
+			return nil
+		}
+	}
+	store, err := credentials.NewStore(db, cfg.Auth.CredentialsKey)
+	if err != nil {
+		if logger != nil {
+			logger.Error("Failed to open credentials store", map[string]interface{}{"error": err.Error()})
+		}
+		return nil
+	}
+	if cfg.Auth.JWTSecret != "" && cfg.Auth.JWTSecret != cfg.Auth.CredentialsKey {
+		legacy, err := credentials.NewStore(db, cfg.Auth.JWTSecret)
+		if err == nil {
+			var moved int
+			if moved, err = store.Reencrypt(legacy); moved > 0 && logger != nil {
+				logger.Info("Moved stored credentials to the credentials key", map[string]interface{}{"count": moved})
+			}
+		}
+		if err != nil && logger != nil {
+			// The secrets stay encrypted with the JWT secret until then
+			logger.Error("Failed to move stored secrets to the credentials key, retrying on the next start", map[string]interface{}{"error": err.Error()})
+		}
+	}
+	return store
+}
+
+// generateCredentialsKey sets auth.credentials_key to a random key and saves
+// it to the config file, so that the JWT secret never has to be shared with
+// anything that needs the credentials. The key is saved before any secret is
+// encrypted with it, so none is ever encrypted with a key lost on restart.
+func generateCredentialsKey(cfg *config.Config, configPath string) error {
+	if configPath == "" {
+		return fmt.Errorf("set auth.credentials_key: there is no config file to save a generated key to")
+	}
+	raw := make([]byte, 32)
+	if _, err := io.ReadFull(cryptoRand, raw); err != nil {
+		return err
+	}
+	cfg.Auth.CredentialsKey = base64.StdEncoding.EncodeToString(raw)
+	if err := cfg.Save(configPath); err != nil {
+		cfg.Auth.CredentialsKey = ""
+		return fmt.Errorf("failed to save the credentials key: %w", err)
+	}
+	return nil
+}
+
+// credentialStore returns the current credentials store, which replication
+// replaces when the primary's key changes
+func (s *Server) credentialStore() *credentials.Store {
+	s.credentialsMu.RLock()
+	defer s.credentialsMu.RUnlock()
+	return s.credentials
+}
+
+// credentialsKey returns auth.credentials_key, which replication replaces
+func (s *Server) credentialsKey() string {
+	s.credentialsMu.RLock()
+	defer s.credentialsMu.RUnlock()
+	return s.config.Auth.CredentialsKey
+}
+
+// requireCredentials returns the credentials store, or writes an error and
+// returns nil when it is not available
+func (s *Server) requireCredentials(w http.ResponseWriter) *credentials.Store {
+	store := s.credentialStore()
+	if store == nil {
+		s.respondErrorCode(w, http.StatusServiceUnavailable, codeNotConfigured, "credentials store not available: set auth.credentials_key", nil)
+	}
+	return store
+}
+
+// checkCredentialRef returns an error message when a restore target refers
+// to a credential that does not exist
+func (s *Server) checkCredentialRef(id *int64) string {
+	if id == nil {
+		return ""
+	}
+	var exists int
+	if err := s.db.QueryRow("SELECT COUNT(*) FROM credentials WHERE id = ?", *id).Scan(&exists); err != nil || exists == 0 {
+		return "credential not found"
+	}
+	return ""
+}
+
+func (s *Server) handleListCredentials(w http.ResponseWriter, r *http.Request) {
+	rows, err := s.db.Query("SELECT " + credentials.Columns + " FROM credentials ORDER BY name")
+	if err != nil {
+		s.respondError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	defer rows.Close()
+
+	list := []models.Credential{}
+	for rows.Next() {
+		c, _, err := credentials.Scan(rows)
+		if err != nil {
+			continue
+		}
+		list = append(list, *c)
+	}
+
+	s.respondJSON(w, http.StatusOK, list)
+}
+
+func (s *Server) handleGetCredential(w http.ResponseWriter, r *http.Request) {
+	id, err := s.getIDParam(r)
+	if err != nil {
+		s.respondError(w, http.StatusBadRequest, "invalid credential id")
+		return
+	}
+	store := s.requireCredentials(w)
+	if store == nil {
+		return
+	}
+
+	c, err := store.Get(id)
+	if errors.Is(err, credentials.ErrNotFound) {
+		s.respondError(w, http.StatusNotFound, err.Error())
+		return
+	}
+	if err != nil {
+		s.respondError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	// Show where the credential is referenced
+	usedBy := []map[string]interface{}{}
+	rows, err := s.db.Query("SELECT id, name FROM restore_targets WHERE credential_id = ? ORDER BY name", id)
+	if err == nil {
+		defer rows.Close()
+		for rows.Next() {
+			var targetID int64
+			var name string
+			if rows.Scan(&targetID, &name) == nil {
+				usedBy = append(usedBy, map[string]interface{}{"type": "restore_target", "id": targetID, "name": name})
+			}
+		}
+	}
+	rows, err = s.db.Query("SELECT id, name FROM proxmox_clusters WHERE credential_id = ? ORDER BY name", id)
+	if err == nil {
+		defer rows.Close()
+		for rows.Next() {
+			var clusterID int64
+			var name string
+			if rows.Scan(&clusterID, &name) == nil {
+				usedBy = append(usedBy, map[string]interface{}{"type": "proxmox_cluster", "id": clusterID, "name": name})
+			}
+		}
+	}
+
+	rows, err = s.db.Query("SELECT id, name FROM backup_sources WHERE credential_id = ? ORDER BY name", id)
+	if err == nil {
+		defer rows.Close()
+		for rows.Next() {
+			var sourceID int64
+			var name string
+			if rows.Scan(&sourceID, &name) == nil {
+				usedBy = append(usedBy, map[string]interface{}{"type": "backup_source", "id": sourceID, "name": name})
+			}
+		}
+	}
+
+	s.respondJSON(w, http.StatusOK, struct {
+		*models.Credential
+		UsedBy []map[string]interface{} `json:"used_by"`
+	}{c, usedBy})
+}
+
+func (s *Server) handleCreateCredential(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Name           string                `json:"name"`
+		CredentialType models.CredentialType `json:"credential_type"`
+		Username       string                `json:"username"`
+		Domain         string                `json:"domain"`
+		Description    string                `json:"description"`
+		Secret         string                `json:"secret"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		s.respondError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+	store := s.requireCredentials(w)
+	if store == nil {
+		return
+	}
+
+	c := &models.Credential{
+		Name:           strings.TrimSpace(req.Name),
+		CredentialType: req.CredentialType,
+		Username:       req.Username,
+		Domain:         req.Domain,
+		Description:    req.Description,
+	}
+	if err := credentials.Validate(c); err != nil {
+		s.respondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	id, err := store.Create(c, req.Secret)
+	if err != nil {
+		if strings.Contains(err.Error(), "UNIQUE") {
+			s.respondErrorCode(w, http.StatusConflict, codeAlreadyExists, "a credential with this name already exists", nil)
+			return
+		}
+		s.respondError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	s.auditLog(r, "create", "credential", id, fmt.Sprintf("Created %s credential '%s'", c.CredentialType, c.Name))
+
+	s.respondJSON(w, http.StatusCreated, map[string]int64{"id": id})
+}
+
+func (s *Server) handleUpdateCredential(w http.ResponseWriter, r *http.Request) {
+	id, err := s.getIDParam(r)
+	if err != nil {
+		s.respondError(w, http.StatusBadRequest, "invalid credential id")
+		return
+	}
+
+	var req struct {
+		Name           *string                `json:"name"`
+		CredentialType *models.CredentialType `json:"credential_type"`
+		Username       *string                `json:"username"`
+		Domain         *string                `json:"domain"`
+		Description    *string                `json:"description"`
+		Secret         *string                `json:"secret"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		s.respondError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+	store := s.requireCredentials(w)
+	if store == nil {
+		return
+	}
+
+	c, err := store.Get(id)
+	if errors.Is(err, credentials.ErrNotFound) {
+		s.respondError(w, http.StatusNotFound, err.Error())
+		return
+	}
+	if err != nil {
+		s.respondError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	if req.Name != nil {
+		c.Name = strings.TrimSpace(*req.Name)
+	}
+	if req.CredentialType != nil {
+		c.CredentialType = *req.CredentialType
+	}
+	if req.Username != nil {
+		c.Username = *req.Username
+	}
+	if req.Domain != nil {
+		c.Domain = *req.Domain
+	}
+	if req.Description != nil {
+		c.Description = *req.Description
+	}
+	if err := credentials.Validate(c); err != nil {
+		s.respondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if err := store.Update(c, req.Secret); err != nil {
+		if strings.Contains(err.Error(), "UNIQUE") {
+			s.respondErrorCode(w, http.StatusConflict, codeAlreadyExists, "a credential with this name already exists", nil)
+			return
+		}
+		s.respondError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	details := fmt.Sprintf("Updated credential '%s'", c.Name)
+	if req.Secret != nil {
+		details += " (secret changed)"
+	}
+	s.auditLog(r, "update", "credential", id, details)
+
+	s.respondJSON(w, http.StatusOK, map[string]string{"status": "updated"})
+}
+
+func (s *Server) handleDeleteCredential(w http.ResponseWriter, r *http.Request) {
+	id, err := s.getIDParam(r)
+	if err != nil {
+		s.respondError(w, http.StatusBadRequest, "invalid credential id")
+		return
+	}
+	store := s.requireCredentials(w)
+	if store == nil {
+		return
+	}
+
+	c, err := store.Get(id)
+	if errors.Is(err, credentials.ErrNotFound) {
+		s.respondError(w, http.StatusNotFound, err.Error())
+		return
+	}
+	if err != nil {
+		s.respondError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if err := store.Delete(id); err != nil {
+		if errors.Is(err, credentials.ErrInUse) {
+			s.respondError(w, http.StatusConflict, err.Error())
+			return
+		}
+		s.respondError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	s.auditLog(r, "delete", "credential", id, fmt.Sprintf("Deleted credential '%s'", c.Name))
+
+	s.respondJSON(w, http.StatusOK, map[string]string{"status": "deleted"})
+}
+
+// handleCredentialUsage returns the most recent uses of a credential's
+// secret, newest first. ?limit= caps the list (default 100).
+func (s *Server) handleCredentialUsage(w http.ResponseWriter, r *http.Request) {
+	id, err := s.getIDParam(r)
+	if err != nil {
+		s.respondError(w, http.StatusBadRequest, "invalid credential id")
+		return
+	}
+	store := s.requireCredentials(w)
+	if store == nil {
+		return
+	}
+	limit := 100
+	if v := r.URL.Query().Get("limit"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil && n > 0 && n <= 1000 {
+			limit = n
+		}
+	}
+
+	if _, err := store.Get(id); err != nil {
+		s.respondError(w, http.StatusNotFound, "credential not found")
+		return
+	}
+	usage, err := store.UsageLog(id, limit)
+	if err != nil {
+		s.respondError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	s.respondJSON(w, http.StatusOK, usage)
+}
@@ -0,0 +1,104 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/RoseOO/TapeBackarr/internal/database"
+	"github.com/RoseOO/TapeBackarr/internal/notifications"
+)
+
+// runIntegrityCheck runs a full integrity check. A passing check is followed
+// by a snapshot that a later startup can fall back to; a failing check
+// raises an alert instead.
+func (s *Server) runIntegrityCheck() *database.IntegrityResult {
+	result := s.db.CheckIntegrity(true)
+	if !result.OK {
+		if s.logger != nil {
+			s.logger.Error("Database integrity check failed", map[string]interface{}{"problems": result.Problems})
+		}
+		s.alertDatabaseIntegrity(notifications.IntegrityAlert{Problems: result.Problems})
+		return result
+	}
+
+	snap, err := s.takeSnapshot("")
+	if err != nil {
+		return result
+	}
+	s.pruneSnapshots()
+	if s.logger != nil {
+		s.logger.Info("Database integrity check passed", map[string]interface{}{"snapshot": snap.Name, "duration_seconds": result.Duration})
+	}
+	return result
+}
+
+// alertDatabaseIntegrity publishes a corruption event and notifies the
+// global Telegram chat and email addresses
+func (s *Server) alertDatabaseIntegrity(alert notifications.IntegrityAlert) {
+	if s.eventBus != nil {
+		event := SystemEvent{Type: "error", Category: "system", Key: "database_corrupt", Args: []interface{}{len(alert.Problems)}}
+		if alert.Snapshot != "" {
+			event = SystemEvent{Type: "warning", Category: "system", Key: "database_recovered",
+				Args: []interface{}{alert.Snapshot, alert.SnapshotTime.Format("2006-01-02 15:04")}}
+		}
+		s.eventBus.Publish(event)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	if s.telegramService != nil {
+		if err := s.telegramService.NotifyDatabaseIntegrity(ctx, alert); err != nil && s.logger != nil {
+			s.logger.Warn("Failed to send database integrity alert via Telegram", map[string]interface{}{"error": err.Error()})
+		}
+	}
+	if s.emailService != nil {
+		if err := s.emailService.NotifyDatabaseIntegrity(ctx, alert); err != nil && s.logger != nil {
+			s.logger.Warn("Failed to send database integrity alert via email", map[string]interface{}{"error": err.Error()})
+		}
+	}
+}
+
+// reportStartupRecovery alerts about corruption found when the database was
+// opened, whether or not a snapshot could replace it
+func (s *Server) reportStartupRecovery() {
+	recovery := s.db.Recovery()
+	if recovery == nil {
+		return
+	}
+	s.alertDatabaseIntegrity(notifications.IntegrityAlert{
+		Problems:     recovery.Problems,
+		Snapshot:     recovery.Snapshot,
+		SnapshotTime: recovery.SnapshotTime,
+	})
+}
+
+// handleDatabaseIntegrity returns the last integrity check, any startup
+// recovery and the available snapshots
+func (s *Server) handleDatabaseIntegrity(w http.ResponseWriter, r *http.Request) {
+	snapshots, err := database.ListSnapshots(s.snapshotDir())
+	if err != nil {
+		s.respondError(w, http.StatusInternalServerError, "failed to list snapshots: "+err.Error())
+		return
+	}
+	if snapshots == nil {
+		snapshots = []database.Snapshot{}
+	}
+	s.respondJSON(w, http.StatusOK, map[string]interface{}{
+		"last_check": s.db.LastIntegrityCheck(),
+		"recovery":   s.db.Recovery(),
+		"snapshots":  snapshots,
+	})
+}
+
+// handleCheckDatabaseIntegrity runs a full integrity check now
+func (s *Server) handleCheckDatabaseIntegrity(w http.ResponseWriter, r *http.Request) {
+	result := s.runIntegrityCheck()
+	details := "Integrity check passed"
+	if !result.OK {
+		details = fmt.Sprintf("Integrity check failed: %d problem(s)", len(result.Problems))
+	}
+	s.auditLog(r, "integrity_check", "database", 0, details)
+	s.respondJSON(w, http.StatusOK, result)
+}
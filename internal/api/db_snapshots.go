@@ -0,0 +1,145 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+
+	"github.com/RoseOO/TapeBackarr/internal/database"
+	"github.com/RoseOO/TapeBackarr/internal/notifications"
+	"github.com/go-chi/chi/v5"
+)
+
+// snapshotDir is where local database snapshots are kept
+func (s *Server) snapshotDir() string {
+	if s.config != nil && s.config.Database.SnapshotDir != "" {
+		return s.config.Database.SnapshotDir
+	}
+	return database.DefaultSnapshotDir(s.db.Path)
+}
+
+// snapshotKeep is the number of local snapshots kept
+func (s *Server) snapshotKeep() int {
+	if s.config != nil && s.config.Database.SnapshotKeep > 0 {
+		return s.config.Database.SnapshotKeep
+	}
+	return 10
+}
+
+// takeSnapshot writes a local snapshot of the database
+func (s *Server) takeSnapshot(label string) (*database.Snapshot, error) {
+	snap, err := s.db.CreateSnapshot(s.snapshotDir(), label)
+	if err != nil && s.logger != nil {
+		s.logger.Warn("Failed to snapshot database", map[string]interface{}{"error": err.Error()})
+	}
+	return snap, err
+}
+
+// pruneSnapshots keeps the newest snapshot_keep snapshots
+func (s *Server) pruneSnapshots() {
+	removed, err := database.PruneSnapshots(s.snapshotDir(), s.snapshotKeep())
+	if err != nil && s.logger != nil {
+		s.logger.Warn("Failed to prune database snapshots", map[string]interface{}{"error": err.Error()})
+	}
+	if len(removed) > 0 && s.logger != nil {
+		s.logger.Info("Pruned database snapshots", map[string]interface{}{"removed": removed})
+	}
+}
+
+// runScheduledSnapshot takes a rolling snapshot. A quick check runs first
+// so a damaged database never displaces the good snapshots.
+func (s *Server) runScheduledSnapshot() {
+	if result := s.db.CheckIntegrity(false); !result.OK {
+		if s.logger != nil {
+			s.logger.Error("Skipping database snapshot: integrity check failed", map[string]interface{}{"problems": result.Problems})
+		}
+		s.alertDatabaseIntegrity(notifications.IntegrityAlert{Problems: result.Problems})
+		return
+	}
+	if _, err := s.takeSnapshot(""); err == nil {
+		s.pruneSnapshots()
+	}
+}
+
+// handleListDatabaseSnapshots lists the local snapshots, newest first
+func (s *Server) handleListDatabaseSnapshots(w http.ResponseWriter, r *http.Request) {
+	snapshots, err := database.ListSnapshots(s.snapshotDir())
+	if err != nil {
+		s.respondError(w, http.StatusInternalServerError, "failed to list snapshots: "+err.Error())
+		return
+	}
+	if snapshots == nil {
+		snapshots = []database.Snapshot{}
+	}
+	s.respondJSON(w, http.StatusOK, snapshots)
+}
+
+// handleCreateDatabaseSnapshot takes a snapshot now, e.g. before a risky change
+func (s *Server) handleCreateDatabaseSnapshot(w http.ResponseWriter, r *http.Request) {
+	snap, err := s.takeSnapshot("manual")
+	if err != nil {
+		s.respondError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	s.pruneSnapshots()
+	s.auditLog(r, "snapshot", "database", 0, fmt.Sprintf("Database snapshot created: %s", snap.Name))
+	s.respondJSON(w, http.StatusCreated, snap)
+}
+
+// handleRestoreDatabaseSnapshot replaces the database with a local snapshot.
+// The current database is snapshotted first so the restore can be undone.
+func (s *Server) handleRestoreDatabaseSnapshot(w http.ResponseWriter, r *http.Request) {
+	name := chi.URLParam(r, "name")
+	snap, err := database.FindSnapshot(s.snapshotDir(), name)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			s.respondError(w, http.StatusNotFound, "snapshot not found")
+		} else {
+			s.respondError(w, http.StatusBadRequest, err.Error())
+		}
+		return
+	}
+	if s.backupService != nil && len(s.backupService.GetActiveJobs()) > 0 {
+		s.respondError(w, http.StatusConflict, "cannot restore the database while backups are running")
+		return
+	}
+	if !database.VerifySnapshot(snap.Path) {
+		s.respondError(w, http.StatusUnprocessableEntity, "snapshot failed its integrity check")
+		return
+	}
+
+	safety, err := s.takeSnapshot("pre-restore")
+	if err != nil {
+		s.respondError(w, http.StatusInternalServerError, "failed to snapshot the current database: "+err.Error())
+		return
+	}
+	if err := s.db.RestoreSnapshot(snap.Path); err != nil {
+		s.respondError(w, http.StatusInternalServerError, "failed to restore snapshot: "+err.Error())
+		return
+	}
+
+	// Pick up the jobs and templates of the restored database
+	if s.scheduler != nil {
+		if err := s.scheduler.ReloadJobs(); err != nil && s.logger != nil {
+			s.logger.Warn("Failed to reload jobs after snapshot restore", map[string]interface{}{"error": err.Error()})
+		}
+	}
+	s.reloadNotificationTemplates()
+
+	s.auditLog(r, "snapshot_restore", "database", 0,
+		fmt.Sprintf("Database restored from snapshot %s; previous state saved as %s", snap.Name, safety.Name))
+	if s.eventBus != nil {
+		s.eventBus.Publish(SystemEvent{
+			Type:     "warning",
+			Category: "system",
+			Key:      "database_snapshot_restored",
+			Args:     []interface{}{snap.Name, safety.Name},
+		})
+	}
+	s.respondJSON(w, http.StatusOK, map[string]interface{}{
+		"status":          "restored",
+		"snapshot":        snap,
+		"safety_snapshot": safety,
+	})
+}
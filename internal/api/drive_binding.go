@@ -0,0 +1,292 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/RoseOO/TapeBackarr/internal/tape"
+)
+
+// Drive binding states stored in tape_drives.binding_status
+const (
+	driveBindingBound   = "bound"
+	driveBindingMissing = "missing"
+)
+
+// driveRebindInterval limits how often requests trigger a sysfs rescan
+const driveRebindInterval = 5 * time.Second
+
+// scanDeviceNodes lists the tape device nodes present, replaced in tests
+var scanDeviceNodes = tape.ScanDeviceNodes
+
+// driveBindingState serializes and throttles rebindDrives
+type driveBindingState struct {
+	mu      sync.Mutex
+	lastRun time.Time
+}
+
+// boundDrive is a physical drive row as seen by rebindDrives
+type boundDrive struct {
+	id              int64
+	name            string
+	path            string
+	serial          string
+	wwn             string
+	status          string
+	enabled         bool
+	bindingDisabled bool
+}
+
+// driveBindingMiddleware re-resolves drive device nodes before requests are
+// handled, so operations started by the request use the current node
+func (s *Server) driveBindingMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.rebindDrives(false)
+		next.ServeHTTP(w, r)
+	})
+}
+
+// rebindDrives matches physical drives to the device nodes present by serial
+// number and WWN. A drive found at a different node has its device_path
+// moved there. A drive that cannot be found is disabled and reported once;
+// it is re-enabled when it shows up again. Drives without a recorded serial
+// or WWN are bound to the identity of the drive at their current path.
+// Unless force is set, calls within driveRebindInterval of the last scan
+// return immediately.
+func (s *Server) rebindDrives(force bool) {
+	if s.db == nil {
+		return
+	}
+	s.driveBinding.mu.Lock()
+	defer s.driveBinding.mu.Unlock()
+	if !force && time.Since(s.driveBinding.lastRun) < driveRebindInterval {
+		return
+	}
+	s.driveBinding.lastRun = time.Now()
+
+	rows, err := s.db.Query(`
+		SELECT id, COALESCE(display_name, ''), device_path, COALESCE(serial_number, ''), wwn, binding_status,
+		       COALESCE(enabled, 1), binding_disabled
+		FROM tape_drives ORDER BY id
+	`)
+	if err != nil {
+		return
+	}
+	var drives []*boundDrive
+	holders := make(map[string]*boundDrive)
+	for rows.Next() {
+		d := &boundDrive{}
+		if err := rows.Scan(&d.id, &d.name, &d.path, &d.serial, &d.wwn, &d.status, &d.enabled, &d.bindingDisabled); err != nil {
+			continue
+		}
+		if d.name == "" {
+			d.name = d.path
+		}
+		holders[d.path] = d
+		if tape.IsPhysicalDevice(d.path) {
+			drives = append(drives, d)
+		}
+	}
+	rows.Close()
+	if len(drives) == 0 {
+		return
+	}
+
+	nodes, err := scanDeviceNodes()
+	if err != nil {
+		if s.logger != nil {
+			s.logger.Warn("Failed to scan tape device nodes", map[string]interface{}{"error": err.Error()})
+		}
+		return
+	}
+
+	// Resolve bound drives first so unbound drives never learn the identity
+	// of a node that belongs to another drive
+	claimed := make(map[string]bool)
+	moves := make(map[*boundDrive]string)
+	for _, d := range drives {
+		if d.serial == "" && d.wwn == "" {
+			continue
+		}
+		node := tape.FindDeviceNode(nodes, d.serial, d.wwn)
+		if node == nil {
+			if d.status != driveBindingMissing {
+				s.markDriveMissing(d)
+			} else {
+				s.db.Exec("UPDATE tape_drives SET binding_checked_at = CURRENT_TIMESTAMP WHERE id = ?", d.id)
+			}
+			continue
+		}
+		claimed[node.DevicePath] = true
+		if d.serial == "" {
+			d.serial = node.Serial
+		}
+		if d.wwn == "" {
+			d.wwn = node.WWN
+		}
+		if current := tape.NodeForPath(nodes, d.path); current == nil || current.DevicePath != node.DevicePath {
+			moves[d] = node.DevicePath
+		}
+		if d.status == driveBindingMissing && s.eventBus != nil {
+			s.eventBus.Publish(SystemEvent{
+				Type:     "info",
+				Category: "drive",
+				Key:      "drive_found",
+				Args:     []interface{}{d.name, node.DevicePath},
+			})
+		}
+		s.db.Exec(`
+			UPDATE tape_drives SET serial_number = ?, wwn = ?, binding_status = ?,
+			       enabled = CASE WHEN binding_disabled THEN 1 ELSE enabled END, binding_disabled = 0,
+			       binding_checked_at = CURRENT_TIMESTAMP
+			WHERE id = ?
+		`, d.serial, d.wwn, driveBindingBound, d.id)
+		d.status = driveBindingBound
+	}
+
+	for _, d := range drives {
+		if d.serial != "" || d.wwn != "" {
+			continue
+		}
+		node := tape.NodeForPath(nodes, d.path)
+		if node == nil || claimed[node.DevicePath] || (node.Serial == "" && node.WWN == "") {
+			continue
+		}
+		claimed[node.DevicePath] = true
+		s.db.Exec(`
+			UPDATE tape_drives SET serial_number = ?, wwn = ?, binding_status = ?, binding_checked_at = CURRENT_TIMESTAMP
+			WHERE id = ?
+		`, node.Serial, node.WWN, driveBindingBound, d.id)
+		d.serial, d.wwn, d.status = node.Serial, node.WWN, driveBindingBound
+	}
+
+	if len(moves) > 0 {
+		s.applyDriveMoves(moves, holders)
+	}
+}
+
+// markDriveMissing disables a bound drive that is no longer present and
+// raises an alert
+func (s *Server) markDriveMissing(d *boundDrive) {
+	s.db.Exec(`
+		UPDATE tape_drives SET binding_status = ?, binding_disabled = ?, enabled = 0,
+		       binding_checked_at = CURRENT_TIMESTAMP
+		WHERE id = ?
+	`, driveBindingMissing, d.enabled || d.bindingDisabled, d.id)
+	d.status = driveBindingMissing
+	if s.logger != nil {
+		s.logger.Warn("Tape drive not found by serial number", map[string]interface{}{
+			"drive_id":    d.id,
+			"device_path": d.path,
+			"serial":      d.serial,
+			"wwn":         d.wwn,
+		})
+	}
+	if s.eventBus != nil {
+		identity := d.serial
+		if identity == "" {
+			identity = d.wwn
+		}
+		s.eventBus.Publish(SystemEvent{
+			Type:     "warning",
+			Category: "drive",
+			Key:      "drive_serial_missing",
+			Args:     []interface{}{d.name, identity, d.path},
+			Details: map[string]interface{}{
+				"drive_id":    d.id,
+				"device_path": d.path,
+				"serial":      d.serial,
+				"wwn":         d.wwn,
+			},
+		})
+	}
+}
+
+// applyDriveMoves points drives at their new device nodes in one
+// transaction. device_path is unique, so moving drives are parked on
+// temporary paths first, and missing drives holding a wanted path are moved
+// aside. A move onto a path held by any other drive is skipped.
+func (s *Server) applyDriveMoves(moves map[*boundDrive]string, holders map[string]*boundDrive) {
+	var displaced []*boundDrive
+	for d, target := range moves {
+		holder := holders[target]
+		if holder == nil || holder == d {
+			continue
+		}
+		if _, moving := moves[holder]; moving {
+			continue
+		}
+		if holder.status == driveBindingMissing {
+			displaced = append(displaced, holder)
+			continue
+		}
+		if s.logger != nil {
+			s.logger.Error("Cannot rebind tape drive: device node is assigned to another drive", map[string]interface{}{
+				"drive_id":    d.id,
+				"device_path": target,
+				"holder_id":   holder.id,
+			})
+		}
+		delete(moves, d)
+	}
+	if len(moves) == 0 {
+		return
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return
+	}
+	defer tx.Rollback()
+	for _, h := range displaced {
+		if _, err := tx.Exec("UPDATE tape_drives SET device_path = ? WHERE id = ?", fmt.Sprintf("missing:%d:%s", h.id, h.path), h.id); err != nil {
+			return
+		}
+	}
+	for d := range moves {
+		if _, err := tx.Exec("UPDATE tape_drives SET device_path = ? WHERE id = ?", fmt.Sprintf("rebind:%d", d.id), d.id); err != nil {
+			return
+		}
+	}
+	for d, target := range moves {
+		if _, err := tx.Exec("UPDATE tape_drives SET device_path = ?, updated_at = CURRENT_TIMESTAMP WHERE id = ?", target, d.id); err != nil {
+			if s.logger != nil {
+				s.logger.Error("Failed to rebind tape drive", map[string]interface{}{"drive_id": d.id, "error": err.Error()})
+			}
+			return
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return
+	}
+
+	var cache *tape.LabelCache
+	if s.tapeService != nil {
+		cache = s.tapeService.GetLabelCache()
+	}
+	for d, target := range moves {
+		// Cached labels are keyed by device path and now describe another drive
+		if cache != nil {
+			cache.InvalidateReason(d.path, "drive rebound")
+			cache.InvalidateReason(target, "drive rebound")
+		}
+		if s.logger != nil {
+			s.logger.Info("Tape drive rebound to new device node", map[string]interface{}{
+				"drive_id": d.id,
+				"old_path": d.path,
+				"new_path": target,
+				"serial":   d.serial,
+			})
+		}
+		if s.eventBus != nil {
+			s.eventBus.Publish(SystemEvent{
+				Type:     "info",
+				Category: "drive",
+				Key:      "drive_rebound",
+				Args:     []interface{}{d.name, d.path, target},
+			})
+		}
+	}
+}
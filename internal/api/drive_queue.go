@@ -0,0 +1,45 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+)
+
+// validateJobDrive checks that a drive_id refers to an enabled drive. Zero
+// unpins the job.
+func (s *Server) validateJobDrive(driveID int64) error {
+	if driveID == 0 {
+		return nil
+	}
+	var enabled bool
+	if err := s.db.QueryRow("SELECT COALESCE(enabled, 1) FROM tape_drives WHERE id = ?", driveID).Scan(&enabled); err != nil {
+		return fmt.Errorf("does not refer to an existing drive")
+	}
+	if !enabled {
+		return fmt.Errorf("refers to a disabled drive")
+	}
+	return nil
+}
+
+// jobDriveWait describes the run a job pinned to a drive will queue behind,
+// or returns "" when the job is not pinned or its drive is free
+func (s *Server) jobDriveWait(jobID int64) string {
+	var drive, holder string
+	err := s.db.QueryRow(`
+		SELECT COALESCE(NULLIF(d.display_name, ''), d.device_path), h.name
+		FROM backup_jobs j
+		JOIN tape_drives d ON d.id = j.drive_id
+		JOIN backup_jobs h ON h.id = d.reserved_job_id
+		WHERE j.id = ? AND d.reserved_job_id != j.id
+	`, jobID).Scan(&drive, &holder)
+	if err != nil {
+		return ""
+	}
+	return fmt.Sprintf("drive %s is in use by job %s, the run will wait for it", drive, holder)
+}
+
+// handleDriveQueues returns the drives held by backup runs and the runs
+// waiting for each
+func (s *Server) handleDriveQueues(w http.ResponseWriter, r *http.Request) {
+	s.respondJSON(w, http.StatusOK, s.backupService.DriveQueues())
+}
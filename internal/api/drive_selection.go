@@ -0,0 +1,160 @@
+package api
+
+import (
+	"database/sql"
+	"fmt"
+	"net/http"
+	"sort"
+
+	"github.com/RoseOO/TapeBackarr/internal/config"
+)
+
+// driveCandidate is an enabled drive with what drive selection weighs
+type driveCandidate struct {
+	DriveID            int64   `json:"drive_id"`
+	Name               string  `json:"name"`
+	DevicePath         string  `json:"device_path"`
+	LibraryID          *int64  `json:"library_id,omitempty"`
+	LibraryDriveNumber *int64  `json:"library_drive_number,omitempty"`
+	Status             string  `json:"status"`
+	Idle               bool    `json:"idle"`
+	RecentWriteHours   float64 `json:"recent_write_hours"`
+	RecentBytes        int64   `json:"recent_bytes_written"`
+	TemperatureC       int64   `json:"temperature_c"`
+	CriticalAlerts     int     `json:"critical_alerts"`
+	// Avoid explains why the drive is only used when no other one is idle
+	Avoid string `json:"avoid,omitempty"`
+}
+
+// driveSelection returns the drive selection settings with defaults filled in
+func (s *Server) driveSelection() config.DriveSelectionConfig {
+	if s.config == nil {
+		return config.DefaultConfig().Tape.DriveSelection
+	}
+	sel := s.config.Tape.DriveSelection
+	if sel.Policy == "" {
+		sel.Policy = config.DriveSelectionLeastUsed
+	}
+	if sel.WindowDays <= 0 {
+		sel.WindowDays = 30
+	}
+	return sel
+}
+
+// driveCandidates returns the enabled drives, optionally of one library,
+// ranked by the drive selection policy: the preferred drive first
+func (s *Server) driveCandidates(libraryID *int64) ([]driveCandidate, error) {
+	sel := s.driveSelection()
+	since := fmt.Sprintf("-%d days", sel.WindowDays)
+
+	query := `
+		SELECT d.id, COALESCE(d.display_name, ''), d.device_path, d.library_id, d.library_drive_number,
+			d.status, d.current_tape_id IS NULL,
+			COALESCE((SELECT SUM(u.write_seconds) FROM drive_usage u WHERE u.drive_id = d.id AND u.created_at >= datetime('now', ?)), 0),
+			COALESCE((SELECT SUM(u.bytes_written) FROM drive_usage u WHERE u.drive_id = d.id AND u.created_at >= datetime('now', ?)), 0),
+			COALESCE((SELECT st.temperature_c FROM drive_statistics st WHERE st.drive_id = d.id AND st.updated_at >= datetime('now', '-1 hours')), 0),
+			(SELECT COUNT(*) FROM drive_alerts a WHERE a.drive_id = d.id AND a.resolved = 0 AND a.severity = 'critical')
+		FROM tape_drives d
+		WHERE COALESCE(d.enabled, 1) = 1`
+	args := []interface{}{since, since}
+	if libraryID != nil {
+		query += " AND d.library_id = ? AND d.library_drive_number IS NOT NULL"
+		args = append(args, *libraryID)
+	}
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	candidates := []driveCandidate{}
+	for rows.Next() {
+		var c driveCandidate
+		var libID, driveNum sql.NullInt64
+		var seconds float64
+		if err := rows.Scan(&c.DriveID, &c.Name, &c.DevicePath, &libID, &driveNum, &c.Status, &c.Idle,
+			&seconds, &c.RecentBytes, &c.TemperatureC, &c.CriticalAlerts); err != nil {
+			return nil, err
+		}
+		if libID.Valid {
+			c.LibraryID = &libID.Int64
+		}
+		if driveNum.Valid {
+			c.LibraryDriveNumber = &driveNum.Int64
+		}
+		c.RecentWriteHours = seconds / 3600
+		c.Idle = c.Idle && c.Status == "ready"
+		switch {
+		case c.CriticalAlerts > 0:
+			c.Avoid = "unresolved critical alerts"
+		case sel.MaxTemperatureC > 0 && c.TemperatureC >= int64(sel.MaxTemperatureC):
+			c.Avoid = fmt.Sprintf("temperature %d°C", c.TemperatureC)
+		}
+		candidates = append(candidates, c)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	rankDrives(candidates, sel.Policy)
+	return candidates, nil
+}
+
+// rankDrives orders drives by preference. Drives to avoid come last; the
+// least_used policy then prefers the fewest recent writing hours and the
+// cooler drive, the first policy keeps the drive order.
+func rankDrives(drives []driveCandidate, policy string) {
+	number := func(c driveCandidate) int64 {
+		if c.LibraryDriveNumber != nil {
+			return *c.LibraryDriveNumber
+		}
+		return c.DriveID
+	}
+	sort.SliceStable(drives, func(i, j int) bool {
+		a, b := drives[i], drives[j]
+		if (a.Avoid == "") != (b.Avoid == "") {
+			return a.Avoid == ""
+		}
+		if policy != config.DriveSelectionFirst {
+			if a.RecentWriteHours != b.RecentWriteHours {
+				return a.RecentWriteHours < b.RecentWriteHours
+			}
+			if a.TemperatureC != b.TemperatureC {
+				return a.TemperatureC < b.TemperatureC
+			}
+		}
+		return number(a) < number(b)
+	})
+}
+
+// pickLibraryDrive returns the idle drive of a library that a tape should be
+// loaded into, following the drive selection policy
+func (s *Server) pickLibraryDrive(libraryID int64) (driveID int64, driveNum int, err error) {
+	candidates, err := s.driveCandidates(&libraryID)
+	if err != nil {
+		return 0, 0, err
+	}
+	for _, c := range candidates {
+		if c.Idle {
+			return c.DriveID, int(*c.LibraryDriveNumber), nil
+		}
+	}
+	return 0, 0, fmt.Errorf("no idle drive in library")
+}
+
+// handleDriveUsage lists the enabled drives in the order drive selection
+// would pick them, with their recent writing hours and health
+func (s *Server) handleDriveUsage(w http.ResponseWriter, r *http.Request) {
+	candidates, err := s.driveCandidates(nil)
+	if err != nil {
+		s.respondError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	sel := s.driveSelection()
+	s.respondJSON(w, http.StatusOK, map[string]interface{}{
+		"policy":            sel.Policy,
+		"window_days":       sel.WindowDays,
+		"max_temperature_c": sel.MaxTemperatureC,
+		"drives":            candidates,
+	})
+}
@@ -0,0 +1,150 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/go-chi/chi/v5/middleware"
+
+	"github.com/RoseOO/TapeBackarr/internal/backup"
+	"github.com/RoseOO/TapeBackarr/internal/validation"
+)
+
+// Error codes returned in the code field of error responses. Clients branch
+// on these rather than on the message, which may change wording.
+const (
+	codeInvalidRequest      = "invalid_request"
+	codeUnauthorized        = "unauthorized"
+	codeForbidden           = "forbidden"
+	codeNotFound            = "not_found"
+	codeConflict            = "conflict"
+	codePayloadTooLarge     = "payload_too_large"
+	codeUnprocessable       = "unprocessable"
+	codeRateLimited         = "rate_limited"
+	codeInternal            = "internal_error"
+	codeNotImplemented      = "not_implemented"
+	codeUpstream            = "upstream_error"
+	codeUnavailable         = "unavailable"
+	codeTimeout             = "timeout"
+	codeAlreadyExists       = "already_exists"
+	codeOperationInProgress = "operation_in_progress"
+	codeJobRunning          = "job_running"
+	codeDriveBusy           = "drive_busy"
+	codeTapeReserved        = "tape_reserved"
+	codeNoTapeAvailable     = "no_tape_available"
+	codeNotConfigured       = "not_configured"
+	codeStandbyReplica      = "standby_replica"
+	codePoolPolicyConflict  = "pool_policy_conflict"
+	codeValidationFailed    = "validation_failed"
+)
+
+// retryableCodes are the conditions that clear by themselves, so the same
+// request may succeed if sent again later
+var retryableCodes = map[string]bool{
+	codeRateLimited:         true,
+	codeUpstream:            true,
+	codeTimeout:             true,
+	codeOperationInProgress: true,
+	codeJobRunning:          true,
+	codeDriveBusy:           true,
+	codeTapeReserved:        true,
+}
+
+// apiError is the body of every error response. Error repeats Message so
+// clients written against the plain {"error": "..."} body keep working.
+type apiError struct {
+	Error     string      `json:"error"`
+	Code      string      `json:"code"`
+	Message   string      `json:"message"`
+	Details   interface{} `json:"details,omitempty"`
+	Retryable bool        `json:"retryable"`
+	RequestID string      `json:"request_id,omitempty"`
+}
+
+// statusErrorCode is the code of an error response that has no more
+// specific one
+func statusErrorCode(status int) string {
+	switch status {
+	case http.StatusUnauthorized:
+		return codeUnauthorized
+	case http.StatusForbidden:
+		return codeForbidden
+	case http.StatusNotFound:
+		return codeNotFound
+	case http.StatusConflict:
+		return codeConflict
+	case http.StatusRequestEntityTooLarge:
+		return codePayloadTooLarge
+	case http.StatusUnprocessableEntity:
+		return codeUnprocessable
+	case http.StatusTooManyRequests:
+		return codeRateLimited
+	case http.StatusNotImplemented:
+		return codeNotImplemented
+	case http.StatusBadGateway:
+		return codeUpstream
+	case http.StatusServiceUnavailable:
+		return codeUnavailable
+	case http.StatusGatewayTimeout, http.StatusRequestTimeout:
+		return codeTimeout
+	}
+	if status >= 500 {
+		return codeInternal
+	}
+	return codeInvalidRequest
+}
+
+// respondErrorCode writes an error response with a specific code. details,
+// when not nil, carries data a client needs to act on the error.
+func (s *Server) respondErrorCode(w http.ResponseWriter, status int, code, message string, details interface{}) {
+	s.respondJSON(w, status, apiError{
+		Error:     message,
+		Code:      code,
+		Message:   message,
+		Details:   details,
+		Retryable: retryableCodes[code],
+		RequestID: w.Header().Get(middleware.RequestIDHeader),
+	})
+}
+
+// requestIDResponse echoes the request ID in the response so a client can
+// quote it when reporting an error, and error bodies can include it
+func requestIDResponse(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if id := middleware.GetReqID(r.Context()); id != "" {
+			w.Header().Set(middleware.RequestIDHeader, id)
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// respondTapeSelectionError reports a tape that could not be selected or
+// reserved for a run
+func (s *Server) respondTapeSelectionError(w http.ResponseWriter, err error, message string) {
+	if errors.Is(err, backup.ErrTapeReserved) {
+		s.respondErrorCode(w, http.StatusConflict, codeTapeReserved, message, nil)
+		return
+	}
+	s.respondErrorCode(w, http.StatusBadRequest, codeNoTapeAvailable, message, nil)
+}
+
+// respondReserveError reports a run that could not start on the tape it was
+// given
+func (s *Server) respondReserveError(w http.ResponseWriter, err error) {
+	if errors.Is(err, backup.ErrTapeReserved) {
+		s.respondErrorCode(w, http.StatusConflict, codeTapeReserved, err.Error(), nil)
+		return
+	}
+	s.respondError(w, http.StatusBadRequest, err.Error())
+}
+
+// respondValidationError reports the invalid fields of a request body, each
+// with its problem in details
+func (s *Server) respondValidationError(w http.ResponseWriter, err error) {
+	var fields validation.Errors
+	if errors.As(err, &fields) {
+		s.respondErrorCode(w, http.StatusBadRequest, codeValidationFailed, "invalid request: "+fields.Error(), fields)
+		return
+	}
+	s.respondError(w, http.StatusBadRequest, err.Error())
+}
@@ -4,32 +4,68 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/http"
+	"strconv"
+	"strings"
 	"sync"
 	"time"
+
+	"github.com/RoseOO/TapeBackarr/internal/auth"
+	"github.com/RoseOO/TapeBackarr/internal/database"
+	"github.com/RoseOO/TapeBackarr/internal/i18n"
+	"github.com/RoseOO/TapeBackarr/internal/logging"
 )
 
 // SystemEvent represents a real-time system event/notification
 type SystemEvent struct {
-	ID        string                 `json:"id"`
-	Type      string                 `json:"type"`     // info, warning, success, error
-	Category  string                 `json:"category"` // tape, drive, backup, system
-	Title     string                 `json:"title"`
-	Message   string                 `json:"message"`
+	ID string `json:"id"`
+	// Seq numbers events in publishing order. It is the SSE event id that
+	// reconnecting clients send back as Last-Event-ID.
+	Seq      int64  `json:"seq"`
+	Type     string `json:"type"`     // info, warning, success, error
+	Category string `json:"category"` // tape, drive, backup, system
+	Title    string `json:"title"`
+	Message  string `json:"message"`
+	// Key names the catalog entry (event.<key>.title / .message) the title
+	// and message are rendered from; Args are its format arguments. Events
+	// with a key are re-rendered in each recipient's language on delivery.
+	Key       string                 `json:"key,omitempty"`
+	Args      []interface{}          `json:"args,omitempty"`
 	Details   map[string]interface{} `json:"details,omitempty"`
 	Timestamp time.Time              `json:"timestamp"`
 }
 
+// Localized returns the event with its title and message rendered in lang.
+// Events published without a key are returned unchanged.
+func (e SystemEvent) Localized(lang i18n.Lang) SystemEvent {
+	if e.Key == "" {
+		return e
+	}
+	e.Title = i18n.T(lang, "event."+e.Key+".title", e.Args...)
+	e.Message = i18n.T(lang, "event."+e.Key+".message", e.Args...)
+	return e
+}
+
 // EventBus manages event subscriptions and broadcasting
 type EventBus struct {
 	mu          sync.RWMutex
 	subscribers map[chan SystemEvent]struct{}
 	history     []SystemEvent
 	maxHistory  int
+	seq         int64
+	// store receives events to persist, see Persist
+	store chan SystemEvent
+	db    *database.DB
+	// storeDropped counts events not persisted because store was full
+	storeDropped int
 }
 
 const (
 	// eventChannelBufferSize is the buffer size for subscriber event channels
 	eventChannelBufferSize = 50
+	// eventStoreKeep is the number of newest events kept in the database
+	eventStoreKeep = 10000
+	// eventReplayLimit caps the events replayed to a reconnecting client
+	eventReplayLimit = 1000
 )
 
 // NewEventBus creates a new event bus
@@ -66,12 +102,26 @@ func (eb *EventBus) Publish(event SystemEvent) {
 	if event.ID == "" {
 		event.ID = fmt.Sprintf("%d", time.Now().UnixNano())
 	}
+	if event.Key != "" && event.Title == "" {
+		event = event.Localized(i18n.Default)
+	}
 
 	eb.mu.Lock()
+	eb.seq++
+	event.Seq = eb.seq
 	eb.history = append(eb.history, event)
 	if len(eb.history) > eb.maxHistory {
 		eb.history = eb.history[len(eb.history)-eb.maxHistory:]
 	}
+	if eb.store != nil {
+		select {
+		case eb.store <- event:
+		default:
+			// Never hold up publishers when the database falls behind; the
+			// writer reports the drops once it catches up
+			eb.storeDropped++
+		}
+	}
 	eb.mu.Unlock()
 
 	eb.mu.RLock()
@@ -94,7 +144,182 @@ func (eb *EventBus) GetHistory() []SystemEvent {
 	return result
 }
 
-// handleEventStream handles SSE connections for real-time events
+// Persist stores every event published from now on in db, so clients can
+// replay events older than the in-memory history. Sequence numbers continue
+// from the stored events. Events are written in the background so a
+// publisher holding the database connection never blocks.
+func (eb *EventBus) Persist(db *database.DB, logger *logging.Logger) {
+	var maxSeq int64
+	db.QueryRow("SELECT COALESCE(MAX(id), 0) FROM system_events").Scan(&maxSeq)
+
+	store := make(chan SystemEvent, 1000)
+	eb.mu.Lock()
+	if maxSeq > eb.seq {
+		eb.seq = maxSeq
+	}
+	eb.db = db
+	eb.store = store
+	eb.mu.Unlock()
+
+	go func() {
+		for event := range store {
+			args, _ := json.Marshal(event.Args)
+			details, _ := json.Marshal(event.Details)
+			_, err := db.Exec(`
+				INSERT OR REPLACE INTO system_events (id, event_id, type, category, title, message, event_key, args, details, created_at)
+				VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+			`, event.Seq, event.ID, event.Type, event.Category, event.Title, event.Message, event.Key, string(args), string(details), event.Timestamp)
+			if err != nil {
+				if logger != nil {
+					logger.Warn("Failed to store event", map[string]interface{}{"error": err.Error()})
+				}
+				continue
+			}
+			if event.Seq%100 == 0 {
+				db.Exec("DELETE FROM system_events WHERE id <= ?", event.Seq-eventStoreKeep)
+			}
+
+			eb.mu.Lock()
+			dropped := eb.storeDropped
+			eb.storeDropped = 0
+			eb.mu.Unlock()
+			if dropped > 0 && logger != nil {
+				logger.Warn("Events were not stored because the database fell behind; clients reconnecting later cannot replay them", map[string]interface{}{"count": dropped})
+			}
+		}
+	}()
+}
+
+// Since returns the events published after seq, oldest first and at most
+// eventReplayLimit of them. Events that left the in-memory history are
+// read from the database when the bus persists them.
+func (eb *EventBus) Since(seq int64) []SystemEvent {
+	eb.mu.RLock()
+	history := make([]SystemEvent, len(eb.history))
+	copy(history, eb.history)
+	db := eb.db
+	eb.mu.RUnlock()
+
+	if len(history) > 0 && history[0].Seq <= seq+1 || db == nil {
+		return historySince(history, seq)
+	}
+
+	rows, err := db.Query(`
+		SELECT id, event_id, type, category, title, message, event_key, args, details, created_at
+		FROM system_events WHERE id > ? ORDER BY id LIMIT ?
+	`, seq, eventReplayLimit)
+	if err != nil {
+		// Replay what is still in memory
+		return historySince(history, seq)
+	}
+	defer rows.Close()
+
+	var events []SystemEvent
+	for rows.Next() {
+		var event SystemEvent
+		var args, details string
+		if err := rows.Scan(&event.Seq, &event.ID, &event.Type, &event.Category, &event.Title, &event.Message,
+			&event.Key, &args, &details, &event.Timestamp); err != nil {
+			continue
+		}
+		event.Args = decodeEventArgs(args)
+		json.Unmarshal([]byte(details), &event.Details)
+		events = append(events, event)
+	}
+
+	// Add what the background writer has not stored yet
+	last := seq
+	if len(events) > 0 {
+		last = events[len(events)-1].Seq
+	}
+	for _, event := range history {
+		if event.Seq > last && len(events) < eventReplayLimit {
+			events = append(events, event)
+		}
+	}
+	return events
+}
+
+// historySince returns the events of history published after seq, at most
+// the newest eventReplayLimit of them
+func historySince(history []SystemEvent, seq int64) []SystemEvent {
+	var events []SystemEvent
+	for _, event := range history {
+		if event.Seq > seq {
+			events = append(events, event)
+		}
+	}
+	if len(events) > eventReplayLimit {
+		events = events[len(events)-eventReplayLimit:]
+	}
+	return events
+}
+
+// decodeEventArgs reads stored format arguments back, keeping whole numbers
+// integers so %d verbs still render
+func decodeEventArgs(stored string) []interface{} {
+	dec := json.NewDecoder(strings.NewReader(stored))
+	dec.UseNumber()
+	var args []interface{}
+	if dec.Decode(&args) != nil {
+		return nil
+	}
+	for i, arg := range args {
+		n, ok := arg.(json.Number)
+		if !ok {
+			continue
+		}
+		if v, err := n.Int64(); err == nil {
+			args[i] = v
+		} else if v, err := n.Float64(); err == nil {
+			args[i] = v
+		}
+	}
+	return args
+}
+
+// eventFilter selects the events a stream client asked for
+type eventFilter struct {
+	categories map[string]bool
+	severities map[string]bool
+}
+
+// parseEventFilter reads the comma-separated ?category= and ?severity=
+// (event type) lists. An empty list lets everything through.
+func parseEventFilter(r *http.Request) eventFilter {
+	split := func(v string) map[string]bool {
+		if v == "" {
+			return nil
+		}
+		set := map[string]bool{}
+		for _, part := range strings.Split(v, ",") {
+			if part = strings.TrimSpace(part); part != "" {
+				set[part] = true
+			}
+		}
+		return set
+	}
+	return eventFilter{
+		categories: split(r.URL.Query().Get("category")),
+		severities: split(r.URL.Query().Get("severity")),
+	}
+}
+
+// match reports whether an event passes the filter
+func (f eventFilter) match(event SystemEvent) bool {
+	if f.categories != nil && !f.categories[event.Category] {
+		return false
+	}
+	if f.severities != nil && !f.severities[event.Type] {
+		return false
+	}
+	return true
+}
+
+// handleEventStream handles SSE connections for real-time events. The
+// ?category= and ?severity= lists filter the stream. A client that
+// reconnects with a Last-Event-ID header (or ?last_event_id=) gets the
+// events it missed; a new client gets the recent history.
 func (s *Server) handleEventStream(w http.ResponseWriter, r *http.Request) {
 	flusher, ok := w.(http.Flusher)
 	if !ok {
@@ -109,11 +334,34 @@ func (s *Server) handleEventStream(w http.ResponseWriter, r *http.Request) {
 
 	ch := s.eventBus.Subscribe()
 	defer s.eventBus.Unsubscribe(ch)
+	lang := s.requestLanguage(r)
+	filter := parseEventFilter(r)
+
+	lastID := r.Header.Get("Last-Event-ID")
+	if lastID == "" {
+		lastID = r.URL.Query().Get("last_event_id")
+	}
+	var sent int64
+	send := func(event SystemEvent) {
+		if event.Seq <= sent || !filter.match(event) {
+			return
+		}
+		sent = event.Seq
+		data, _ := json.Marshal(event.Localized(lang))
+		fmt.Fprintf(w, "id: %d\ndata: %s\n\n", event.Seq, data)
+	}
 
-	// Send recent history first
-	for _, event := range s.eventBus.GetHistory() {
-		data, _ := json.Marshal(event)
-		fmt.Fprintf(w, "data: %s\n\n", data)
+	// Replay what the client missed, or send the recent history first.
+	// Events published meanwhile are already queued on ch; send skips the
+	// ones replayed here.
+	if seq, err := strconv.ParseInt(lastID, 10, 64); err == nil && seq >= 0 {
+		for _, event := range s.eventBus.Since(seq) {
+			send(event)
+		}
+	} else {
+		for _, event := range s.eventBus.GetHistory() {
+			send(event)
+		}
 	}
 	flusher.Flush()
 
@@ -126,8 +374,7 @@ func (s *Server) handleEventStream(w http.ResponseWriter, r *http.Request) {
 			if !ok {
 				return
 			}
-			data, _ := json.Marshal(event)
-			fmt.Fprintf(w, "data: %s\n\n", data)
+			send(event)
 			flusher.Flush()
 		}
 	}
@@ -136,5 +383,31 @@ func (s *Server) handleEventStream(w http.ResponseWriter, r *http.Request) {
 // handleGetNotifications returns recent notification history
 func (s *Server) handleGetNotifications(w http.ResponseWriter, r *http.Request) {
 	events := s.eventBus.GetHistory()
+	lang := s.requestLanguage(r)
+	for i := range events {
+		events[i] = events[i].Localized(lang)
+	}
 	s.respondJSON(w, http.StatusOK, events)
 }
+
+// requestLanguage picks the language events are rendered in for a request:
+// an explicit ?lang= parameter, then the caller's saved preference, then the
+// Accept-Language header.
+func (s *Server) requestLanguage(r *http.Request) i18n.Lang {
+	if l, ok := i18n.Parse(r.URL.Query().Get("lang")); ok {
+		return l
+	}
+	if claims, ok := r.Context().Value("claims").(*auth.Claims); ok && claims != nil && claims.UserID > 0 && s.authService != nil {
+		if prefs, err := s.authService.GetPreferences(claims.UserID); err == nil {
+			if l, ok := i18n.Parse(prefs.Language); ok {
+				return l
+			}
+		}
+	}
+	for _, part := range strings.Split(r.Header.Get("Accept-Language"), ",") {
+		if l, ok := i18n.Parse(strings.SplitN(part, ";", 2)[0]); ok {
+			return l
+		}
+	}
+	return i18n.Default
+}
@@ -0,0 +1,627 @@
+package api
+
+import (
+	"archive/zip"
+	"bytes"
+	"database/sql"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// inventoryFormat is the version of the inventory archive layout
+const inventoryFormat = 1
+
+// inventoryFilePrefix starts the names of scheduled inventory exports
+const inventoryFilePrefix = "tapebackarr-inventory-"
+
+// inventoryTable describes a table carried in the inventory archive
+type inventoryTable struct {
+	name string
+	// key lists the columns that identify a row across servers: an import
+	// updates the row with the same key instead of adding another one
+	key []string
+	// refs maps foreign key columns to the inventory table they point to
+	refs map[string]string
+	// local lists columns that describe this server's runtime state or point
+	// at rows outside the inventory (users, encryption keys); they are
+	// exported for reference but never imported
+	local []string
+	// defaults fills NOT NULL local columns of rows the import adds
+	defaults map[string]interface{}
+}
+
+// inventoryTables are the tables an inventory export carries, in the order
+// an import has to apply them so references resolve
+var inventoryTables = []inventoryTable{
+	{name: "tape_pools", key: []string{"name"}},
+	{name: "tape_libraries", key: []string{"name"}, local: []string{"last_inventory_at"}},
+	{
+		name:  "tapes",
+		key:   []string{"label"},
+		refs:  map[string]string{"pool_id": "tape_pools"},
+		local: []string{"reuse_approved_by", "physical_remaining_bytes", "physical_remaining_at"},
+	},
+	{
+		name:     "tape_drives",
+		key:      []string{"device_path"},
+		refs:     map[string]string{"library_id": "tape_libraries"},
+		local:    []string{"status", "current_tape_id", "binding_status", "binding_checked_at"},
+		defaults: map[string]interface{}{"status": "offline"},
+	},
+	{
+		name: "tape_library_slots",
+		key:  []string{"library_id", "slot_number"},
+		refs: map[string]string{"library_id": "tape_libraries", "tape_id": "tapes", "drive_id": "tape_drives"},
+	},
+	{name: "backup_sources", key: []string{"name"}},
+	{
+		name:  "backup_jobs",
+		key:   []string{"name"},
+		refs:  map[string]string{"source_id": "backup_sources", "pool_id": "tape_pools"},
+		local: []string{"last_run_at", "next_run_at", "owner_id", "encryption_key_id", "hw_encryption_key_id", "guard_confirmed"},
+	},
+}
+
+// inventorySetsTable holds the recent backup sets. They are exported for
+// reporting only; an import never adds them since their file catalog is
+// not part of the inventory.
+const inventorySetsTable = "backup_sets"
+
+// inventoryManifest describes an inventory archive
+type inventoryManifest struct {
+	Format     int            `json:"format"`
+	ExportedAt time.Time      `json:"exported_at"`
+	SetsDays   int            `json:"sets_days"`
+	Tables     map[string]int `json:"tables"`
+}
+
+// inventoryData is the content of one table in an inventory archive
+type inventoryData struct {
+	Columns []string
+	Rows    [][]interface{}
+}
+
+// inventoryImportResult counts what an import did per table
+type inventoryImportResult struct {
+	Created int      `json:"created"`
+	Updated int      `json:"updated"`
+	Skipped int      `json:"skipped"`
+	Errors  []string `json:"errors,omitempty"`
+}
+
+// readInventoryTable reads all rows of a query with their column names
+func (s *Server) readInventoryTable(query string, args ...interface{}) (*inventoryData, error) {
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	columns, err := rows.Columns()
+	if err != nil {
+		return nil, err
+	}
+	data := &inventoryData{Columns: columns, Rows: [][]interface{}{}}
+	for rows.Next() {
+		values := make([]interface{}, len(columns))
+		ptrs := make([]interface{}, len(columns))
+		for i := range values {
+			ptrs[i] = &values[i]
+		}
+		if err := rows.Scan(ptrs...); err != nil {
+			return nil, err
+		}
+		for i, v := range values {
+			if b, ok := v.([]byte); ok {
+				values[i] = string(b)
+			}
+		}
+		data.Rows = append(data.Rows, values)
+	}
+	return data, rows.Err()
+}
+
+// writeInventoryArchive writes a zip archive with a JSON and a CSV file per
+// inventory table, the backup sets of the last setsDays days and a manifest
+func (s *Server) writeInventoryArchive(w io.Writer, setsDays int) (*inventoryManifest, error) {
+	manifest := &inventoryManifest{
+		Format:     inventoryFormat,
+		ExportedAt: time.Now().UTC(),
+		SetsDays:   setsDays,
+		Tables:     map[string]int{},
+	}
+
+	tables := map[string]*inventoryData{}
+	names := []string{}
+	for _, t := range inventoryTables {
+		data, err := s.readInventoryTable("SELECT * FROM " + t.name + " ORDER BY id")
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s: %w", t.name, err)
+		}
+		tables[t.name] = data
+		names = append(names, t.name)
+	}
+	sets, err := s.readInventoryTable(`
+		SELECT bs.*, COALESCE(j.name, '') AS job_name, COALESCE(t.label, '') AS tape_label
+		FROM backup_sets bs
+		LEFT JOIN backup_jobs j ON bs.job_id = j.id
+		LEFT JOIN tapes t ON bs.tape_id = t.id
+		WHERE bs.start_time >= ?
+		ORDER BY bs.id
+	`, time.Now().AddDate(0, 0, -setsDays))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", inventorySetsTable, err)
+	}
+	tables[inventorySetsTable] = sets
+	names = append(names, inventorySetsTable)
+
+	zw := zip.NewWriter(w)
+	for _, name := range names {
+		data := tables[name]
+		manifest.Tables[name] = len(data.Rows)
+
+		objects := make([]map[string]interface{}, 0, len(data.Rows))
+		for _, row := range data.Rows {
+			obj := make(map[string]interface{}, len(row))
+			for i, col := range data.Columns {
+				obj[col] = row[i]
+			}
+			objects = append(objects, obj)
+		}
+		f, err := zw.Create(name + ".json")
+		if err != nil {
+			return nil, err
+		}
+		enc := json.NewEncoder(f)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(objects); err != nil {
+			return nil, err
+		}
+
+		f, err = zw.Create(name + ".csv")
+		if err != nil {
+			return nil, err
+		}
+		cw := csv.NewWriter(f)
+		cw.Write(data.Columns)
+		for _, row := range data.Rows {
+			record := make([]string, len(row))
+			for i, v := range row {
+				record[i] = inventoryCSVValue(v)
+			}
+			cw.Write(record)
+		}
+		cw.Flush()
+		if err := cw.Error(); err != nil {
+			return nil, err
+		}
+	}
+
+	f, err := zw.Create("manifest.json")
+	if err != nil {
+		return nil, err
+	}
+	enc := json.NewEncoder(f)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(manifest); err != nil {
+		return nil, err
+	}
+	return manifest, zw.Close()
+}
+
+// inventoryCSVValue formats a column value for the CSV files
+func inventoryCSVValue(v interface{}) string {
+	switch val := v.(type) {
+	case nil:
+		return ""
+	case time.Time:
+		return val.UTC().Format(time.RFC3339)
+	case string:
+		return val
+	default:
+		return fmt.Sprint(val)
+	}
+}
+
+// inventorySetsDays reads the ?days= window of exported backup sets
+func inventorySetsDays(r *http.Request) int {
+	if v := r.URL.Query().Get("days"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil && n > 0 && n <= 3650 {
+			return n
+		}
+	}
+	return 30
+}
+
+// handleExportInventory downloads the system inventory as a zip archive:
+// pools, tapes, drives, libraries and slots, sources, jobs and the backup
+// sets of the last ?days= days (default 30), each as JSON and CSV.
+func (s *Server) handleExportInventory(w http.ResponseWriter, r *http.Request) {
+	var buf bytes.Buffer
+	manifest, err := s.writeInventoryArchive(&buf, inventorySetsDays(r))
+	if err != nil {
+		s.respondError(w, http.StatusInternalServerError, "failed to export inventory: "+err.Error())
+		return
+	}
+
+	s.auditLog(r, "export", "inventory", 0, fmt.Sprintf("Exported inventory: %d tapes, %d jobs, %d backup sets",
+		manifest.Tables["tapes"], manifest.Tables["backup_jobs"], manifest.Tables[inventorySetsTable]))
+
+	filename := inventoryFilePrefix + time.Now().Format("20060102-150405") + ".zip"
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+	w.Header().Set("Content-Length", strconv.Itoa(buf.Len()))
+	w.WriteHeader(http.StatusOK)
+	w.Write(buf.Bytes())
+}
+
+// handleImportInventory applies an inventory archive uploaded as the
+// "inventory" form field, e.g. to seed a standby server. Rows are matched
+// by name, label or device path and updated, or added when missing. Jobs
+// the import adds are disabled unless ?enable_jobs=true, so a standby does
+// not start writing to tapes on its own.
+func (s *Server) handleImportInventory(w http.ResponseWriter, r *http.Request) {
+	const maxUploadSize = 100 << 20
+	r.Body = http.MaxBytesReader(w, r.Body, maxUploadSize)
+	if err := r.ParseMultipartForm(maxUploadSize); err != nil {
+		s.respondError(w, http.StatusBadRequest, "file too large or invalid upload")
+		return
+	}
+	file, _, err := r.FormFile("inventory")
+	if err != nil {
+		s.respondError(w, http.StatusBadRequest, "no inventory file provided")
+		return
+	}
+	defer file.Close()
+	content, err := io.ReadAll(file)
+	if err != nil {
+		s.respondError(w, http.StatusBadRequest, "failed to read inventory file")
+		return
+	}
+
+	tables, err := readInventoryArchive(content)
+	if err != nil {
+		s.respondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	enableJobs := r.URL.Query().Get("enable_jobs") == "true"
+	results, warnings, err := s.importInventory(tables, enableJobs)
+	if err != nil {
+		s.respondError(w, http.StatusInternalServerError, "failed to import inventory: "+err.Error())
+		return
+	}
+	if s.scheduler != nil {
+		if err := s.scheduler.ReloadJobs(); err != nil && s.logger != nil {
+			s.logger.Warn("Failed to reload scheduled jobs after inventory import", map[string]interface{}{"error": err.Error()})
+		}
+	}
+
+	created, updated := 0, 0
+	for _, res := range results {
+		created += res.Created
+		updated += res.Updated
+	}
+	s.auditLog(r, "import", "inventory", 0, fmt.Sprintf("Imported inventory: %d rows added, %d updated", created, updated))
+
+	s.respondJSON(w, http.StatusOK, map[string]interface{}{
+		"tables":   results,
+		"warnings": warnings,
+	})
+}
+
+// readInventoryArchive reads the JSON files of an inventory archive
+func readInventoryArchive(content []byte) (map[string][]map[string]interface{}, error) {
+	zr, err := zip.NewReader(bytes.NewReader(content), int64(len(content)))
+	if err != nil {
+		return nil, fmt.Errorf("not an inventory archive: %w", err)
+	}
+	files := map[string]*zip.File{}
+	for _, f := range zr.File {
+		files[f.Name] = f
+	}
+
+	decode := func(name string, v interface{}) error {
+		f, ok := files[name]
+		if !ok {
+			return fmt.Errorf("inventory archive has no %s", name)
+		}
+		rc, err := f.Open()
+		if err != nil {
+			return err
+		}
+		defer rc.Close()
+		dec := json.NewDecoder(rc)
+		dec.UseNumber()
+		if err := dec.Decode(v); err != nil {
+			return fmt.Errorf("invalid %s: %w", name, err)
+		}
+		return nil
+	}
+
+	var manifest inventoryManifest
+	if err := decode("manifest.json", &manifest); err != nil {
+		return nil, err
+	}
+	if manifest.Format != inventoryFormat {
+		return nil, fmt.Errorf("unsupported inventory format %d", manifest.Format)
+	}
+	tables := map[string][]map[string]interface{}{}
+	for _, t := range inventoryTables {
+		var rows []map[string]interface{}
+		if _, ok := files[t.name+".json"]; !ok {
+			continue
+		}
+		if err := decode(t.name+".json", &rows); err != nil {
+			return nil, err
+		}
+		tables[t.name] = rows
+	}
+	return tables, nil
+}
+
+// inventoryValue converts a decoded JSON value for the database
+func inventoryValue(v interface{}) interface{} {
+	n, ok := v.(json.Number)
+	if !ok {
+		return v
+	}
+	if i, err := n.Int64(); err == nil {
+		return i
+	}
+	f, _ := n.Float64()
+	return f
+}
+
+// importInventory upserts the inventory tables in one transaction and
+// returns what happened per table plus warnings about jobs that need
+// attention
+func (s *Server) importInventory(tables map[string][]map[string]interface{}, enableJobs bool) (map[string]*inventoryImportResult, []string, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, nil, err
+	}
+	defer tx.Rollback()
+
+	results := map[string]*inventoryImportResult{}
+	warnings := []string{}
+	// ids maps exported row IDs to the IDs on this server, per table
+	ids := map[string]map[int64]int64{}
+
+	for _, t := range inventoryTables {
+		res := &inventoryImportResult{}
+		results[t.name] = res
+		ids[t.name] = map[int64]int64{}
+
+		columns, err := tableColumns(tx, t.name)
+		if err != nil {
+			return nil, nil, err
+		}
+		skip := map[string]bool{"id": true, "created_at": true, "updated_at": true}
+		for _, c := range t.local {
+			skip[c] = true
+		}
+
+		for _, row := range tables[t.name] {
+			values := map[string]interface{}{}
+			for col, v := range row {
+				if skip[col] || !columns[col] {
+					continue
+				}
+				v = inventoryValue(v)
+				if ref, ok := t.refs[col]; ok && v != nil {
+					oldID, _ := v.(int64)
+					if newID, found := ids[ref][oldID]; found {
+						v = newID
+					} else {
+						v = nil
+					}
+				}
+				values[col] = v
+			}
+			name := inventoryRowName(t, values)
+
+			where := make([]string, len(t.key))
+			keyArgs := make([]interface{}, len(t.key))
+			for i, k := range t.key {
+				if values[k] == nil {
+					where = nil
+					break
+				}
+				where[i] = k + " = ?"
+				keyArgs[i] = values[k]
+			}
+			if where == nil {
+				res.Skipped++
+				res.Errors = append(res.Errors, fmt.Sprintf("%s: missing %s", name, strings.Join(t.key, ", ")))
+				continue
+			}
+
+			var existingID int64
+			err := tx.QueryRow("SELECT id FROM "+t.name+" WHERE "+strings.Join(where, " AND "), keyArgs...).Scan(&existingID)
+			if err != nil && err != sql.ErrNoRows {
+				return nil, nil, err
+			}
+			exists := err == nil
+
+			if t.name == "backup_jobs" {
+				encrypted := inventoryTruthy(values["encryption_enabled"]) || inventoryTruthy(values["hw_encryption_enabled"])
+				if exists {
+					// Keep the job's schedule state as it is on this server
+					delete(values, "enabled")
+				} else {
+					values["enabled"] = enableJobs && !encrypted
+				}
+				if encrypted && !exists {
+					warnings = append(warnings, fmt.Sprintf("job %s uses encryption and was added disabled: assign its encryption key before enabling it", name))
+				}
+			}
+
+			cols := make([]string, 0, len(values))
+			for col := range values {
+				cols = append(cols, col)
+			}
+			sort.Strings(cols)
+			args := make([]interface{}, 0, len(cols)+1)
+			for _, col := range cols {
+				args = append(args, values[col])
+			}
+
+			if exists {
+				sets := make([]string, len(cols))
+				for i, col := range cols {
+					sets[i] = col + " = ?"
+				}
+				sets = append(sets, "updated_at = CURRENT_TIMESTAMP")
+				args = append(args, existingID)
+				if _, err := tx.Exec("UPDATE "+t.name+" SET "+strings.Join(sets, ", ")+" WHERE id = ?", args...); err != nil {
+					res.Skipped++
+					res.Errors = append(res.Errors, fmt.Sprintf("%s: %v", name, err))
+					continue
+				}
+				res.Updated++
+			} else {
+				for col, v := range t.defaults {
+					if _, ok := values[col]; !ok && columns[col] {
+						cols = append(cols, col)
+						args = append(args, v)
+					}
+				}
+				placeholders := strings.TrimSuffix(strings.Repeat("?, ", len(cols)), ", ")
+				result, err := tx.Exec("INSERT INTO "+t.name+" ("+strings.Join(cols, ", ")+") VALUES ("+placeholders+")", args...)
+				if err != nil {
+					res.Skipped++
+					res.Errors = append(res.Errors, fmt.Sprintf("%s: %v", name, err))
+					continue
+				}
+				existingID, _ = result.LastInsertId()
+				res.Created++
+			}
+
+			if oldID, ok := inventoryValue(row["id"]).(int64); ok {
+				ids[t.name][oldID] = existingID
+			}
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, nil, err
+	}
+	return results, warnings, nil
+}
+
+// tableColumns returns the column names of a table on this server, so an
+// archive from another release only imports the columns both know
+func tableColumns(tx *sql.Tx, table string) (map[string]bool, error) {
+	rows, err := tx.Query("SELECT name FROM pragma_table_info(?)", table)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	columns := map[string]bool{}
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, err
+		}
+		columns[name] = true
+	}
+	return columns, rows.Err()
+}
+
+// inventoryRowName describes an imported row by its key for error messages
+func inventoryRowName(t inventoryTable, values map[string]interface{}) string {
+	parts := make([]string, len(t.key))
+	for i, k := range t.key {
+		parts[i] = fmt.Sprint(values[k])
+	}
+	return fmt.Sprintf("%s %q", strings.TrimSuffix(t.name, "s"), strings.Join(parts, "/"))
+}
+
+// inventoryTruthy reports whether an imported boolean column is set
+func inventoryTruthy(v interface{}) bool {
+	switch val := v.(type) {
+	case bool:
+		return val
+	case int64:
+		return val != 0
+	case float64:
+		return val != 0
+	}
+	return false
+}
+
+// runScheduledInventoryExport writes the inventory to
+// inventory_export.dir, typically a mounted network share read by a
+// standby server, and keeps the newest inventory_export.keep files
+func (s *Server) runScheduledInventoryExport() {
+	cfg := s.config.InventoryExport
+	if err := s.exportInventoryTo(cfg.Dir, cfg.SetsDays, cfg.Keep); err != nil {
+		if s.logger != nil {
+			s.logger.Error("Scheduled inventory export failed", map[string]interface{}{"dir": cfg.Dir, "error": err.Error()})
+		}
+		s.eventBus.Publish(SystemEvent{
+			Type:     "error",
+			Category: "system",
+			Key:      "inventory_export_failed",
+			Args:     []interface{}{cfg.Dir, err.Error()},
+		})
+	}
+}
+
+// exportInventoryTo writes an inventory archive into dir and prunes older
+// ones down to keep. The file is written under a temporary name first so a
+// reader never picks up a partial archive.
+func (s *Server) exportInventoryTo(dir string, setsDays, keep int) error {
+	if dir == "" {
+		return fmt.Errorf("no export directory configured")
+	}
+	if setsDays <= 0 {
+		setsDays = 30
+	}
+	if err := os.MkdirAll(dir, 0750); err != nil {
+		return err
+	}
+
+	name := inventoryFilePrefix + time.Now().Format("20060102-150405") + ".zip"
+	tmp, err := os.CreateTemp(dir, ".inventory-*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := s.writeInventoryArchive(tmp, setsDays); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp.Name(), filepath.Join(dir, name)); err != nil {
+		return err
+	}
+	if s.logger != nil {
+		s.logger.Info("Inventory exported", map[string]interface{}{"file": filepath.Join(dir, name)})
+	}
+
+	if keep <= 0 {
+		return nil
+	}
+	matches, err := filepath.Glob(filepath.Join(dir, inventoryFilePrefix+"*.zip"))
+	if err != nil {
+		return err
+	}
+	// The timestamped names sort oldest first
+	sort.Strings(matches)
+	for i := 0; i < len(matches)-keep; i++ {
+		os.Remove(matches[i])
+	}
+	return nil
+}
@@ -0,0 +1,38 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/RoseOO/TapeBackarr/internal/validation"
+)
+
+// validateGuardrails checks a job's guardrail limits and action
+func validateGuardrails(v *validation.Validator, maxFiles, maxBytes int64, maxChangePercent int, action string) {
+	v.NonNegative("guard_max_files", maxFiles)
+	v.NonNegative("guard_max_bytes", maxBytes)
+	v.NonNegative("guard_max_change_percent", int64(maxChangePercent))
+	v.OneOf("guard_action", action, guardActions...)
+}
+
+// handleConfirmJobGuardrails lets the job's next run go ahead even if it
+// exceeds the job's guardrails. The confirmation is used up by that run.
+func (s *Server) handleConfirmJobGuardrails(w http.ResponseWriter, r *http.Request) {
+	id, err := s.getIDParam(r)
+	if err != nil {
+		s.respondError(w, http.StatusBadRequest, "invalid job id")
+		return
+	}
+	var name string
+	if err := s.db.QueryRow("SELECT name FROM backup_jobs WHERE id = ? AND ad_hoc = 0", id).Scan(&name); err != nil {
+		s.respondError(w, http.StatusNotFound, "job not found")
+		return
+	}
+	if _, err := s.db.Exec("UPDATE backup_jobs SET guard_confirmed = 1 WHERE id = ?", id); err != nil {
+		s.respondError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	s.auditLog(r, "confirm_guardrails", "backup_job", id, fmt.Sprintf("Confirmed the next run of job %s past its guardrails", name))
+	s.respondJSON(w, http.StatusOK, map[string]interface{}{"id": id, "guard_confirmed": true})
+}
@@ -0,0 +1,55 @@
+package api
+
+import (
+	"fmt"
+	"net/mail"
+	"strconv"
+	"strings"
+
+	"github.com/RoseOO/TapeBackarr/internal/notifications"
+)
+
+// validateEmailList checks a comma-separated list of email addresses
+func validateEmailList(list string) error {
+	for _, a := range notifications.SplitAddresses(list) {
+		if _, err := mail.ParseAddress(a); err != nil {
+			return fmt.Errorf("invalid email address %q", a)
+		}
+	}
+	return nil
+}
+
+// validateChatIDs checks a comma-separated list of Telegram chat IDs, which
+// are numeric (negative for groups) or a public @channel name
+func validateChatIDs(list string) error {
+	for _, c := range notifications.SplitAddresses(list) {
+		if strings.HasPrefix(c, "@") && len(c) > 1 {
+			continue
+		}
+		if _, err := strconv.ParseInt(c, 10, 64); err != nil {
+			return fmt.Errorf("invalid Telegram chat ID %q", c)
+		}
+	}
+	return nil
+}
+
+// validateJobOwner checks that an owner_id refers to an existing user. Zero
+// clears the owner.
+func (s *Server) validateJobOwner(ownerID int64) error {
+	if ownerID == 0 {
+		return nil
+	}
+	var exists int
+	if err := s.db.QueryRow("SELECT COUNT(*) FROM users WHERE id = ?", ownerID).Scan(&exists); err != nil || exists == 0 {
+		return fmt.Errorf("does not refer to an existing user")
+	}
+	return nil
+}
+
+// nullableID stores zero as NULL
+func nullableID(id *int64) interface{} {
+	if id == nil || *id == 0 {
+		return nil
+	}
+	return *id
+}
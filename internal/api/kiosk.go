@@ -0,0 +1,258 @@
+package api
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+)
+
+// kioskLookahead is how far ahead the kiosk lists scheduled jobs
+const kioskLookahead = 24 * time.Hour
+
+// kioskTapeRequest is a tape change a spanning backup is waiting for. It
+// continues once an operator confirms the new tape is loaded.
+type kioskTapeRequest struct {
+	ID          int64      `json:"id"`
+	JobName     string     `json:"job_name"`
+	CurrentTape string     `json:"current_tape"`
+	Reason      string     `json:"reason"`
+	NextTapeID  *int64     `json:"next_tape_id"`
+	NextTape    string     `json:"next_tape"` // Tape allocated from the pool, if any
+	RequestedAt *time.Time `json:"requested_at"`
+}
+
+// kioskTapeWait is a tape that a recall or consolidation is waiting for.
+// These notice the tape by themselves once it is loaded.
+type kioskTapeWait struct {
+	Kind      string     `json:"kind"` // recall or consolidation
+	TapeLabel string     `json:"tape_label"`
+	Detail    string     `json:"detail"`
+	Since     *time.Time `json:"since,omitempty"`
+}
+
+// kioskDrive is a drive and the tape it holds
+type kioskDrive struct {
+	ID         int64  `json:"id"`
+	Name       string `json:"name"`
+	Status     string `json:"status"`
+	LoadedTape string `json:"loaded_tape"`
+}
+
+// kioskUpcomingJob is a scheduled backup and the pool it will need a tape from
+type kioskUpcomingJob struct {
+	JobID     int64     `json:"job_id"`
+	JobName   string    `json:"job_name"`
+	PoolName  string    `json:"pool_name"`
+	NextRunAt time.Time `json:"next_run_at"`
+}
+
+// kioskStatus is everything an operator standing at the library needs
+type kioskStatus struct {
+	TapeRequests []kioskTapeRequest `json:"tape_requests"`
+	Waiting      []kioskTapeWait    `json:"waiting"`
+	Drives       []kioskDrive       `json:"drives"`
+	UpcomingJobs []kioskUpcomingJob `json:"upcoming_jobs"`
+}
+
+// handleKioskStatus returns the pending tape requests, the drives and the
+// backups due in the next kioskLookahead. Drives are not probed, so the view
+// can be refreshed often while jobs are running.
+func (s *Server) handleKioskStatus(w http.ResponseWriter, r *http.Request) {
+	status := kioskStatus{
+		TapeRequests: []kioskTapeRequest{},
+		Waiting:      []kioskTapeWait{},
+		Drives:       []kioskDrive{},
+		UpcomingJobs: []kioskUpcomingJob{},
+	}
+
+	rows, err := s.db.Query(`
+		SELECT tcr.id, COALESCE(bj.name, ''), t.label, tcr.reason, tcr.new_tape_id, COALESCE(nt.label, ''), tcr.requested_at
+		FROM tape_change_requests tcr
+		JOIN tapes t ON t.id = tcr.current_tape_id
+		LEFT JOIN tapes nt ON nt.id = tcr.new_tape_id
+		LEFT JOIN tape_spanning_sets tss ON tss.id = tcr.spanning_set_id
+		LEFT JOIN backup_jobs bj ON bj.id = tss.job_id
+		WHERE tcr.status IN ('pending', 'acknowledged')
+		ORDER BY tcr.requested_at, tcr.id
+	`)
+	if err != nil {
+		s.respondError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var req kioskTapeRequest
+		if err := rows.Scan(&req.ID, &req.JobName, &req.CurrentTape, &req.Reason, &req.NextTapeID, &req.NextTape, &req.RequestedAt); err != nil {
+			continue
+		}
+		status.TapeRequests = append(status.TapeRequests, req)
+	}
+
+	recalls, err := s.db.Query(`
+		SELECT t.label, ar.file_path, ar.requested_at
+		FROM artifact_recalls ar
+		JOIN backup_sets bs ON bs.id = ar.backup_set_id
+		JOIN tapes t ON t.id = bs.tape_id
+		WHERE ar.status = ?
+		ORDER BY ar.requested_at, ar.id
+	`, recallWaiting)
+	if err == nil {
+		defer recalls.Close()
+		for recalls.Next() {
+			wait := kioskTapeWait{Kind: "recall"}
+			if err := recalls.Scan(&wait.TapeLabel, &wait.Detail, &wait.Since); err != nil {
+				continue
+			}
+			status.Waiting = append(status.Waiting, wait)
+		}
+	}
+
+	s.consolidation.mu.Lock()
+	if s.consolidation.running && s.consolidation.waiting != "" {
+		started := s.consolidation.started
+		status.Waiting = append(status.Waiting, kioskTapeWait{
+			Kind:      "consolidation",
+			TapeLabel: s.consolidation.waiting,
+			Detail:    s.consolidation.message,
+			Since:     &started,
+		})
+	}
+	s.consolidation.mu.Unlock()
+
+	s.syntheticFull.mu.Lock()
+	if s.syntheticFull.running && s.syntheticFull.waiting != "" {
+		started := s.syntheticFull.started
+		status.Waiting = append(status.Waiting, kioskTapeWait{
+			Kind:      "synthetic_full",
+			TapeLabel: s.syntheticFull.waiting,
+			Detail:    s.syntheticFull.message,
+			Since:     &started,
+		})
+	}
+	s.syntheticFull.mu.Unlock()
+
+	drives, err := s.db.Query(`
+		SELECT d.id, COALESCE(NULLIF(d.display_name, ''), d.device_path), d.status, COALESCE(t.label, '')
+		FROM tape_drives d
+		LEFT JOIN tapes t ON t.id = d.current_tape_id
+		WHERE COALESCE(d.enabled, 1) = 1
+		ORDER BY d.device_path
+	`)
+	if err == nil {
+		defer drives.Close()
+		for drives.Next() {
+			var d kioskDrive
+			if err := drives.Scan(&d.ID, &d.Name, &d.Status, &d.LoadedTape); err != nil {
+				continue
+			}
+			status.Drives = append(status.Drives, d)
+		}
+	}
+
+	jobs, err := s.db.Query(`
+		SELECT bj.id, bj.name, COALESCE(tp.name, ''), bj.next_run_at
+		FROM backup_jobs bj
+		LEFT JOIN tape_pools tp ON tp.id = bj.pool_id
+		WHERE bj.enabled = 1 AND bj.ad_hoc = 0 AND bj.next_run_at IS NOT NULL AND bj.next_run_at <= ?
+		ORDER BY bj.next_run_at
+	`, time.Now().Add(kioskLookahead))
+	if err == nil {
+		defer jobs.Close()
+		for jobs.Next() {
+			var job kioskUpcomingJob
+			if err := jobs.Scan(&job.JobID, &job.JobName, &job.PoolName, &job.NextRunAt); err != nil {
+				continue
+			}
+			status.UpcomingJobs = append(status.UpcomingJobs, job)
+		}
+	}
+
+	s.respondJSON(w, http.StatusOK, status)
+}
+
+// handleKioskConfirmLoaded completes a tape change request once the operator
+// has loaded the new tape. The tape defaults to the one allocated from the
+// pool; the operator may name another by ID, or by the label or barcode on
+// the cartridge.
+func (s *Server) handleKioskConfirmLoaded(w http.ResponseWriter, r *http.Request) {
+	id, err := s.getIDParam(r)
+	if err != nil {
+		s.respondError(w, http.StatusBadRequest, "invalid request id")
+		return
+	}
+	var req struct {
+		TapeID    *int64 `json:"tape_id"`
+		TapeLabel string `json:"tape_label"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && !errors.Is(err, io.EOF) {
+		s.respondError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+
+	var status string
+	var currentTapeID int64
+	var allocated *int64
+	err = s.db.QueryRow("SELECT status, current_tape_id, new_tape_id FROM tape_change_requests WHERE id = ?", id).
+		Scan(&status, &currentTapeID, &allocated)
+	if err == sql.ErrNoRows {
+		s.respondError(w, http.StatusNotFound, "tape request not found")
+		return
+	} else if err != nil {
+		s.respondError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if status != "pending" && status != "acknowledged" {
+		s.respondError(w, http.StatusConflict, "tape request is already "+status)
+		return
+	}
+
+	tapeID := req.TapeID
+	if tapeID == nil && req.TapeLabel != "" {
+		var found int64
+		if err := s.db.QueryRow("SELECT id FROM tapes WHERE label = ? OR barcode = ? LIMIT 1", req.TapeLabel, req.TapeLabel).Scan(&found); err != nil {
+			s.respondError(w, http.StatusNotFound, "no tape with label or barcode "+req.TapeLabel)
+			return
+		}
+		tapeID = &found
+	}
+	if tapeID == nil {
+		tapeID = allocated
+	}
+	if tapeID == nil {
+		s.respondError(w, http.StatusBadRequest, "tape_id or tape_label is required: no tape was allocated for this request")
+		return
+	}
+	if *tapeID == currentTapeID {
+		s.respondError(w, http.StatusBadRequest, "the new tape must differ from the full one")
+		return
+	}
+	var label string
+	if err := s.db.QueryRow("SELECT label FROM tapes WHERE id = ?", *tapeID).Scan(&label); err != nil {
+		s.respondError(w, http.StatusNotFound, "tape not found")
+		return
+	}
+
+	res, err := s.db.Exec(`
+		UPDATE tape_change_requests SET status = 'completed', new_tape_id = ?, acknowledged_at = CURRENT_TIMESTAMP
+		WHERE id = ? AND status IN ('pending', 'acknowledged')
+	`, *tapeID, id)
+	if err != nil {
+		s.respondError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		s.respondError(w, http.StatusConflict, "tape request is no longer pending")
+		return
+	}
+
+	s.auditLog(r, "tape_loaded", "tape_change_request", id, fmt.Sprintf("Confirmed tape %s loaded", label))
+	s.respondJSON(w, http.StatusOK, map[string]interface{}{
+		"status":     "completed",
+		"tape_id":    *tapeID,
+		"tape_label": label,
+	})
+}
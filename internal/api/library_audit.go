@@ -0,0 +1,145 @@
+package api
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/RoseOO/TapeBackarr/internal/library"
+)
+
+// libraryAuditTimeout bounds one mtx status of a changer
+const libraryAuditTimeout = 5 * time.Minute
+
+// auditLibrary compares a library's slots with the slot records and raises
+// a warning event for each discrepancy, naming what the operator should do
+func (s *Server) auditLibrary(ctx context.Context, libraryID int64) (*library.AuditResult, error) {
+	ctx, cancel := context.WithTimeout(ctx, libraryAuditTimeout)
+	defer cancel()
+	result, err := s.library.Audit(ctx, libraryID)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, d := range result.Discrepancies {
+		barcode := d.Barcode
+		if barcode == "" {
+			barcode = "(no barcode)"
+		}
+		details := map[string]interface{}{
+			"library_id": result.LibraryID,
+			"kind":       d.Kind,
+			"barcode":    d.Barcode,
+		}
+		if d.TapeID != 0 {
+			details["tape_id"] = d.TapeID
+		}
+		var args []interface{}
+		switch d.Kind {
+		case library.DiscrepancyMissing:
+			details["expected"] = d.Expected
+			args = []interface{}{barcode, d.Expected.String(), result.LibraryName}
+		case library.DiscrepancyMoved:
+			details["expected"], details["found"] = d.Expected, d.Found
+			args = []interface{}{barcode, d.Expected.String(), result.LibraryName, d.Found.String()}
+		default:
+			details["found"] = d.Found
+			args = []interface{}{barcode, d.Found.String(), result.LibraryName}
+		}
+		if s.eventBus != nil {
+			s.eventBus.Publish(SystemEvent{
+				Type:     "warning",
+				Category: "tape",
+				Key:      "library_tape_" + d.Kind,
+				Args:     args,
+				Details:  details,
+			})
+		}
+	}
+
+	if s.logger != nil {
+		s.logger.Info("Library slot audit completed", map[string]interface{}{
+			"library_id":    result.LibraryID,
+			"elements":      result.Elements,
+			"discrepancies": len(result.Discrepancies),
+		})
+	}
+	return result, nil
+}
+
+// runLibraryAudits audits every enabled library that has been inventoried.
+// A failed audit raises a warning event too: a changer that cannot report
+// its slots will not load tapes for the next jobs either.
+func (s *Server) runLibraryAudits() {
+	if s.library == nil {
+		return
+	}
+	rows, err := s.db.Query(`
+		SELECT id, name FROM tape_libraries
+		WHERE COALESCE(enabled, 1) = 1 AND last_inventory_at IS NOT NULL
+		ORDER BY id
+	`)
+	if err != nil {
+		return
+	}
+	type libraryRef struct {
+		id   int64
+		name string
+	}
+	var libraries []libraryRef
+	for rows.Next() {
+		var lib libraryRef
+		if err := rows.Scan(&lib.id, &lib.name); err == nil {
+			libraries = append(libraries, lib)
+		}
+	}
+	rows.Close()
+
+	for _, lib := range libraries {
+		if _, err := s.auditLibrary(context.Background(), lib.id); err != nil {
+			if s.logger != nil {
+				s.logger.Warn("Library slot audit failed", map[string]interface{}{"library_id": lib.id, "error": err.Error()})
+			}
+			if s.eventBus != nil {
+				s.eventBus.Publish(SystemEvent{
+					Type:     "warning",
+					Category: "tape",
+					Key:      "library_audit_failed",
+					Args:     []interface{}{lib.name, err.Error()},
+					Details:  map[string]interface{}{"library_id": lib.id},
+				})
+			}
+		}
+	}
+}
+
+// handleLibraryAudit audits a library now and returns the discrepancies
+func (s *Server) handleLibraryAudit(w http.ResponseWriter, r *http.Request) {
+	id, err := s.getIDParam(r)
+	if err != nil {
+		s.respondError(w, http.StatusBadRequest, "invalid library id")
+		return
+	}
+
+	result, err := s.auditLibrary(r.Context(), id)
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		s.respondError(w, http.StatusNotFound, "library not found")
+		return
+	case errors.Is(err, library.ErrNotInventoried):
+		s.respondError(w, http.StatusConflict, "run an inventory of the library before auditing it")
+		return
+	case errors.Is(err, library.ErrUnavailable):
+		s.respondError(w, http.StatusServiceUnavailable, err.Error())
+		return
+	case err != nil:
+		s.respondError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	s.auditLog(r, "audit", "tape_library", id, fmt.Sprintf("Slot audit of library %s: %d discrepancies", result.LibraryName, len(result.Discrepancies)))
+	s.respondJSON(w, http.StatusOK, result)
+}
@@ -0,0 +1,182 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"regexp"
+	"strings"
+
+	"github.com/RoseOO/TapeBackarr/internal/auth"
+)
+
+// peerAddrKey holds the address of the connection's peer, before
+// middleware.RealIP replaces RemoteAddr with a forwarded address
+type peerAddrKey struct{}
+
+// destructiveOperations are the endpoints that erase data on tape or in the
+// catalog. Like admin endpoints, they are limited to the management network.
+var destructiveOperations = []struct {
+	method string
+	path   *regexp.Regexp
+}{
+	{"POST", regexp.MustCompile(`^/api/v1/tapes/[^/]+/format/?$`)},
+	{"POST", regexp.MustCompile(`^/api/v1/drives/[^/]+/format-tape/?$`)},
+	{"DELETE", regexp.MustCompile(`^/api/v1/tapes/[^/]+/?$`)},
+	{"DELETE", regexp.MustCompile(`^/api/v1/pools/[^/]+/?$`)},
+	{"DELETE", regexp.MustCompile(`^/api/v1/backup-sets/[^/]+/?$`)},
+}
+
+// parseNetworks parses CIDRs and single addresses, which match only
+// themselves
+func parseNetworks(list []string) ([]*net.IPNet, error) {
+	networks := make([]*net.IPNet, 0, len(list))
+	for _, entry := range list {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		if !strings.Contains(entry, "/") {
+			ip := net.ParseIP(entry)
+			if ip == nil {
+				return nil, fmt.Errorf("invalid address %q", entry)
+			}
+			bits := 128
+			if ip.To4() != nil {
+				ip, bits = ip.To4(), 32
+			}
+			networks = append(networks, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		_, network, err := net.ParseCIDR(entry)
+		if err != nil {
+			return nil, fmt.Errorf("invalid CIDR %q", entry)
+		}
+		networks = append(networks, network)
+	}
+	return networks, nil
+}
+
+// splitNetworks splits a comma-separated list of networks
+func splitNetworks(list string) []string {
+	if strings.TrimSpace(list) == "" {
+		return nil
+	}
+	return strings.Split(list, ",")
+}
+
+// inNetworks reports whether ip is in any of the networks
+func inNetworks(ip net.IP, networks []*net.IPNet) bool {
+	for _, network := range networks {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// hostIP returns the IP of a host:port or bare host address
+func hostIP(addr string) net.IP {
+	if host, _, err := net.SplitHostPort(addr); err == nil {
+		addr = host
+	}
+	return net.ParseIP(addr)
+}
+
+// peerAddrMiddleware records the connection's peer address. It must run
+// before middleware.RealIP.
+func peerAddrMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := context.WithValue(r.Context(), peerAddrKey{}, r.RemoteAddr)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// managementClientIP returns the client address the management network is
+// checked against: the forwarded address when the peer is one of the
+// trusted proxies, the peer itself otherwise
+func managementClientIP(r *http.Request, trustedProxies []string) net.IP {
+	peer, ok := r.Context().Value(peerAddrKey{}).(string)
+	if !ok {
+		peer = r.RemoteAddr
+	}
+	peerIP := hostIP(peer)
+	if len(trustedProxies) == 0 || peerIP == nil {
+		return peerIP
+	}
+	proxies, err := parseNetworks(trustedProxies)
+	if err != nil || !inNetworks(peerIP, proxies) {
+		return peerIP
+	}
+	if forwarded := hostIP(r.RemoteAddr); forwarded != nil {
+		return forwarded
+	}
+	return peerIP
+}
+
+// checkManagementNetwork returns an error message when the request comes
+// from outside the networks allowed to call admin endpoints and destructive
+// operations: auth.management_cidrs and, for API keys, the key's own list.
+// Both must allow the client when both are set.
+func (s *Server) checkManagementNetwork(r *http.Request) string {
+	var lists [][]string
+	var trustedProxies []string
+	if s.config != nil {
+		if len(s.config.Auth.ManagementCIDRs) > 0 {
+			lists = append(lists, s.config.Auth.ManagementCIDRs)
+		}
+		trustedProxies = s.config.Auth.TrustedProxies
+	}
+	if claims, _ := r.Context().Value("claims").(*auth.Claims); claims != nil && claims.AllowedCIDRs != "" {
+		lists = append(lists, splitNetworks(claims.AllowedCIDRs))
+	}
+	if len(lists) == 0 {
+		return ""
+	}
+
+	ip := managementClientIP(r, trustedProxies)
+	for _, list := range lists {
+		networks, err := parseNetworks(list)
+		if err != nil {
+			// A broken list must not open the endpoints up
+			return "the management network is misconfigured: " + err.Error()
+		}
+		if ip == nil || !inNetworks(ip, networks) {
+			return fmt.Sprintf("requests from %s are not allowed for this operation, use the management network", ip)
+		}
+	}
+	return ""
+}
+
+// managementNetworkMiddleware limits destructiveOperations to the
+// management network
+func (s *Server) managementNetworkMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		for _, op := range destructiveOperations {
+			if op.method == r.Method && op.path.MatchString(r.URL.Path) {
+				if msg := s.checkManagementNetwork(r); msg != "" {
+					s.respondError(w, http.StatusForbidden, msg)
+					return
+				}
+				break
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// normalizeNetworks checks a comma-separated list of networks and returns it
+// with the whitespace trimmed
+func normalizeNetworks(list string) (string, error) {
+	entries := []string{}
+	for _, entry := range splitNetworks(list) {
+		if entry = strings.TrimSpace(entry); entry != "" {
+			entries = append(entries, entry)
+		}
+	}
+	if _, err := parseNetworks(entries); err != nil {
+		return "", err
+	}
+	return strings.Join(entries, ","), nil
+}
@@ -0,0 +1,116 @@
+package api
+
+import (
+	"crypto/subtle"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+
+	"github.com/RoseOO/TapeBackarr/internal/config"
+)
+
+// validateMonitoring checks the monitoring listener settings. A listener
+// must authenticate its clients with a bearer token, client certificates
+// or both.
+func validateMonitoring(cfg config.MonitoringConfig) error {
+	if cfg.Port == 0 {
+		return nil
+	}
+	if cfg.Port < 0 || cfg.Port > 65535 {
+		return fmt.Errorf("monitoring.port must be between 1 and 65535")
+	}
+	if cfg.BearerToken == "" && cfg.ClientCAFile == "" {
+		return fmt.Errorf("monitoring needs a bearer_token or a client_ca_file")
+	}
+	if (cfg.TLSCertFile == "") != (cfg.TLSKeyFile == "") {
+		return fmt.Errorf("monitoring.tls_cert_file and monitoring.tls_key_file must be set together")
+	}
+	if cfg.ClientCAFile != "" && cfg.TLSCertFile == "" {
+		return fmt.Errorf("monitoring.client_ca_file needs tls_cert_file and tls_key_file")
+	}
+	return nil
+}
+
+// NewMonitoringServer returns the HTTP server of the monitoring listener,
+// or nil when monitoring.port is not set. It serves only GET /metrics and
+// GET /health. A server with a TLSConfig must be started with
+// ListenAndServeTLS("", "").
+func (s *Server) NewMonitoringServer(cfg config.MonitoringConfig) (*http.Server, error) {
+	if cfg.Port == 0 {
+		return nil, nil
+	}
+	if err := validateMonitoring(cfg); err != nil {
+		return nil, err
+	}
+
+	srv := &http.Server{
+		Addr:         fmt.Sprintf("%s:%d", cfg.Host, cfg.Port),
+		Handler:      s.monitoringHandler(),
+		ReadTimeout:  30 * time.Second,
+		WriteTimeout: 60 * time.Second,
+		IdleTimeout:  120 * time.Second,
+	}
+	if cfg.TLSCertFile == "" {
+		return srv, nil
+	}
+
+	cert, err := tls.LoadX509KeyPair(cfg.TLSCertFile, cfg.TLSKeyFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load monitoring certificate: %w", err)
+	}
+	srv.TLSConfig = &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		MinVersion:   tls.VersionTLS12,
+	}
+	if cfg.ClientCAFile != "" {
+		pem, err := os.ReadFile(cfg.ClientCAFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read monitoring client CA: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in %s", cfg.ClientCAFile)
+		}
+		srv.TLSConfig.ClientCAs = pool
+		srv.TLSConfig.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+	return srv, nil
+}
+
+// monitoringHandler routes the monitoring listener. Client certificates are
+// verified by the listener's TLS config; the bearer token is checked here.
+func (s *Server) monitoringHandler() http.Handler {
+	r := chi.NewRouter()
+	r.Use(middleware.Recoverer)
+	r.Use(s.monitoringAuthMiddleware)
+	r.Get("/metrics", s.handleMetrics)
+	r.Get("/health", s.handleHealthCheck)
+	return r
+}
+
+// monitoringAuthMiddleware requires the configured bearer token. The token
+// is read per request so a changed token applies without a restart.
+func (s *Server) monitoringAuthMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var token string
+		if s.config != nil {
+			token = s.config.Monitoring.BearerToken
+		}
+		if token != "" {
+			got, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+			if !ok || subtle.ConstantTimeCompare([]byte(got), []byte(token)) != 1 {
+				w.Header().Set("WWW-Authenticate", `Bearer realm="tapebackarr-monitoring"`)
+				s.respondError(w, http.StatusUnauthorized, "invalid or missing bearer token")
+				return
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,176 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/RoseOO/TapeBackarr/internal/notifications"
+)
+
+// notificationTemplate is a stored template as returned by the API
+type notificationTemplate struct {
+	notifications.MessageTemplate
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// templateVariables documents the fields and helpers available to templates
+var templateVariables = map[string]string{
+	".Title":      "built-in (localized) title",
+	".Message":    "built-in (localized) message",
+	".Event":      "event type",
+	".Channel":    "channel the message is rendered for",
+	".Priority":   "low, normal, high or urgent",
+	".Timestamp":  "time of the event",
+	".Job":        "backup job name",
+	".Tape":       "tape label",
+	".NextTape":   "suggested next tape",
+	".Reason":     "reason for a tape change",
+	".BackupType": "full, incremental or differential",
+	".Sources":    "number of sources in the job",
+	".Files":      "files written",
+	".Bytes":      "bytes written or used",
+	".Duration":   "backup duration",
+	".Error":      "error message",
+	".Device":     "drive device path",
+	".Expected":   "expected tape label",
+	".Actual":     "tape label found in the drive",
+	"bytes":       "{{bytes .Bytes}} formats a byte count",
+	"round":       "{{round .Duration}} rounds a duration to seconds",
+	"date":        "{{date \"2006-01-02 15:04\" .Timestamp}} formats a time",
+	"upper/lower": "{{upper .Job}} changes case",
+}
+
+func (s *Server) loadNotificationTemplates() ([]notificationTemplate, error) {
+	rows, err := s.db.Query(`SELECT event_type, channel, title_template, body_template, updated_at
+		FROM notification_templates ORDER BY event_type, channel`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	templates := []notificationTemplate{}
+	for rows.Next() {
+		var t notificationTemplate
+		if err := rows.Scan(&t.Event, &t.Channel, &t.Title, &t.Body, &t.UpdatedAt); err != nil {
+			return nil, err
+		}
+		templates = append(templates, t)
+	}
+	return templates, rows.Err()
+}
+
+// reloadNotificationTemplates pushes the stored templates to the notification
+// services. A stored template that no longer compiles leaves the previous set
+// active and is logged.
+func (s *Server) reloadNotificationTemplates() {
+	stored, err := s.loadNotificationTemplates()
+	if err == nil {
+		templates := make([]notifications.MessageTemplate, 0, len(stored))
+		for _, t := range stored {
+			templates = append(templates, t.MessageTemplate)
+		}
+		err = notifications.LoadTemplates(templates)
+	}
+	if err != nil && s.logger != nil {
+		s.logger.Warn("Failed to load notification templates", map[string]interface{}{"error": err.Error()})
+	}
+}
+
+func (s *Server) handleListNotificationTemplates(w http.ResponseWriter, r *http.Request) {
+	templates, err := s.loadNotificationTemplates()
+	if err != nil {
+		s.respondError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	s.respondJSON(w, http.StatusOK, map[string]interface{}{
+		"templates":   templates,
+		"event_types": notifications.TemplateEvents,
+		"channels":    []string{notifications.ChannelTelegram, notifications.ChannelEmail, notifications.ChannelAll},
+		"variables":   templateVariables,
+	})
+}
+
+func (s *Server) handleSaveNotificationTemplate(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Title string `json:"title_template"`
+		Body  string `json:"body_template"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		s.respondError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+
+	t := notifications.MessageTemplate{
+		Event:   notifications.NotificationType(chi.URLParam(r, "eventType")),
+		Channel: chi.URLParam(r, "channel"),
+		Title:   req.Title,
+		Body:    req.Body,
+	}
+	if err := notifications.ValidateTemplate(t); err != nil {
+		s.respondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if _, err := s.db.Exec(`
+		INSERT INTO notification_templates (event_type, channel, title_template, body_template)
+		VALUES (?, ?, ?, ?)
+		ON CONFLICT(event_type, channel) DO UPDATE SET
+			title_template = excluded.title_template,
+			body_template = excluded.body_template,
+			updated_at = CURRENT_TIMESTAMP
+	`, t.Event, t.Channel, t.Title, t.Body); err != nil {
+		s.respondError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	s.reloadNotificationTemplates()
+	s.auditLog(r, "update", "notification_template", 0, fmt.Sprintf("Saved %s template for %s", t.Channel, t.Event))
+
+	s.respondJSON(w, http.StatusOK, t)
+}
+
+func (s *Server) handleDeleteNotificationTemplate(w http.ResponseWriter, r *http.Request) {
+	eventType := chi.URLParam(r, "eventType")
+	channel := chi.URLParam(r, "channel")
+
+	result, err := s.db.Exec("DELETE FROM notification_templates WHERE event_type = ? AND channel = ?", eventType, channel)
+	if err != nil {
+		s.respondError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		s.respondError(w, http.StatusNotFound, "notification template not found")
+		return
+	}
+
+	s.reloadNotificationTemplates()
+	s.auditLog(r, "delete", "notification_template", 0, fmt.Sprintf("Deleted %s template for %s", channel, eventType))
+
+	s.respondJSON(w, http.StatusOK, map[string]string{"status": "deleted"})
+}
+
+// handlePreviewNotificationTemplate renders an unsaved template against
+// sample data so admins can check the output before saving it.
+func (s *Server) handlePreviewNotificationTemplate(w http.ResponseWriter, r *http.Request) {
+	var t notifications.MessageTemplate
+	if err := json.NewDecoder(r.Body).Decode(&t); err != nil {
+		s.respondError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+	if t.Channel == "" {
+		t.Channel = notifications.ChannelAll
+	}
+
+	title, body, err := notifications.PreviewTemplate(t)
+	if err != nil {
+		s.respondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	s.respondJSON(w, http.StatusOK, map[string]string{"title": title, "body": body})
+}
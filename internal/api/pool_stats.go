@@ -0,0 +1,218 @@
+package api
+
+import (
+	"net/http"
+	"time"
+)
+
+// poolStatsBucket is one period of a pool statistics series
+type poolStatsBucket struct {
+	Period           string  `json:"period"`
+	BytesWritten     int64   `json:"bytes_written"`
+	SetsCreated      int     `json:"sets_created"`
+	TapesConsumed    int     `json:"tapes_consumed"`
+	CompressionRatio float64 `json:"compression_ratio"`
+	ReuseEvents      int     `json:"reuse_events"`
+
+	// Source and on-tape bytes of the sets that recorded both, for the ratio
+	ratioSource int64
+	ratioTape   int64
+}
+
+// add folds another bucket into b
+func (b *poolStatsBucket) add(o *poolStatsBucket) {
+	b.BytesWritten += o.BytesWritten
+	b.SetsCreated += o.SetsCreated
+	b.TapesConsumed += o.TapesConsumed
+	b.ReuseEvents += o.ReuseEvents
+	b.ratioSource += o.ratioSource
+	b.ratioTape += o.ratioTape
+}
+
+// finish computes the compression ratio from the accumulated bytes
+func (b *poolStatsBucket) finish() {
+	if b.ratioTape > 0 {
+		b.CompressionRatio = float64(b.ratioSource) / float64(b.ratioTape)
+	}
+}
+
+// poolStatsPeriod returns the start of the bucket holding t
+func poolStatsPeriod(t time.Time, bucket string) time.Time {
+	t = t.Local()
+	day := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.Local)
+	switch bucket {
+	case "week":
+		// Weeks start on Monday
+		return day.AddDate(0, 0, -((int(day.Weekday()) + 6) % 7))
+	case "month":
+		return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, time.Local)
+	}
+	return day
+}
+
+// poolStatsNext returns the start of the bucket after the one starting at t
+func poolStatsNext(t time.Time, bucket string) time.Time {
+	switch bucket {
+	case "week":
+		return t.AddDate(0, 0, 7)
+	case "month":
+		return t.AddDate(0, 1, 0)
+	}
+	return t.AddDate(0, 0, 1)
+}
+
+// poolStatsLabel formats a bucket start as its period label
+func poolStatsLabel(t time.Time, bucket string) string {
+	if bucket == "month" {
+		return t.Format("2006-01")
+	}
+	return t.Format("2006-01-02")
+}
+
+// handlePoolStats returns a time series of the pool's activity: bytes
+// written, backup sets created, tapes consumed, compression ratio and tape
+// reuse approvals per day, week or month. from and to are RFC 3339 times;
+// by default the series covers the last 30 days.
+func (s *Server) handlePoolStats(w http.ResponseWriter, r *http.Request) {
+	id, err := s.getIDParam(r)
+	if err != nil {
+		s.respondError(w, http.StatusBadRequest, "invalid pool id")
+		return
+	}
+
+	bucket := r.URL.Query().Get("bucket")
+	switch bucket {
+	case "":
+		bucket = "day"
+	case "day", "week", "month":
+	default:
+		s.respondError(w, http.StatusBadRequest, "bucket must be day, week or month")
+		return
+	}
+	to := time.Now()
+	if v := r.URL.Query().Get("to"); v != "" {
+		t, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			s.respondError(w, http.StatusBadRequest, "to must be an RFC 3339 time")
+			return
+		}
+		to = t
+	}
+	from := to.AddDate(0, 0, -30)
+	if v := r.URL.Query().Get("from"); v != "" {
+		t, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			s.respondError(w, http.StatusBadRequest, "from must be an RFC 3339 time")
+			return
+		}
+		from = t
+	}
+	if !from.Before(to) {
+		s.respondError(w, http.StatusBadRequest, "from must be before to")
+		return
+	}
+
+	var poolName string
+	if err := s.db.QueryRow("SELECT name FROM tape_pools WHERE id = ?", id).Scan(&poolName); err != nil {
+		s.respondError(w, http.StatusNotFound, "pool not found")
+		return
+	}
+
+	// Build every bucket up front so periods without activity are zero
+	// rather than missing from the series
+	var series []*poolStatsBucket
+	index := make(map[string]*poolStatsBucket)
+	for t := poolStatsPeriod(from, bucket); t.Before(to); t = poolStatsNext(t, bucket) {
+		b := &poolStatsBucket{Period: poolStatsLabel(t, bucket)}
+		series = append(series, b)
+		index[b.Period] = b
+	}
+	bucketFor := func(t time.Time) *poolStatsBucket {
+		return index[poolStatsLabel(poolStatsPeriod(t, bucket), bucket)]
+	}
+
+	// A set is the first on its tape when no earlier set was written to it,
+	// which is when the pool consumed that tape
+	rows, err := s.db.Query(`
+		SELECT bs.start_time, bs.total_bytes, bs.tape_bytes,
+		       NOT EXISTS (SELECT 1 FROM backup_sets p WHERE p.tape_id = bs.tape_id AND p.id < bs.id)
+		FROM backup_sets bs
+		JOIN tapes t ON bs.tape_id = t.id
+		WHERE t.pool_id = ? AND bs.status = 'completed' AND bs.start_time >= ? AND bs.start_time < ?
+	`, id, from, to)
+	if err != nil {
+		s.respondError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	for rows.Next() {
+		var start time.Time
+		var totalBytes, tapeBytes int64
+		var first bool
+		if err := rows.Scan(&start, &totalBytes, &tapeBytes, &first); err != nil {
+			continue
+		}
+		b := bucketFor(start)
+		if b == nil {
+			continue
+		}
+		b.SetsCreated++
+		if first {
+			b.TapesConsumed++
+		}
+		// Sets written before tape_bytes was recorded only know their size
+		// before compression
+		if tapeBytes > 0 {
+			b.BytesWritten += tapeBytes
+			b.ratioSource += totalBytes
+			b.ratioTape += tapeBytes
+		} else {
+			b.BytesWritten += totalBytes
+		}
+	}
+	rows.Close()
+
+	rows, err = s.db.Query(`
+		SELECT a.created_at
+		FROM audit_logs a
+		JOIN tapes t ON a.resource_id = t.id
+		WHERE a.resource_type = 'tape' AND a.action IN ('reuse_approve', 'reuse_auto_approve')
+		  AND t.pool_id = ? AND a.created_at >= ? AND a.created_at < ?
+	`, id, from, to)
+	if err != nil {
+		s.respondError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	for rows.Next() {
+		var created time.Time
+		if err := rows.Scan(&created); err != nil {
+			continue
+		}
+		if b := bucketFor(created); b != nil {
+			b.ReuseEvents++
+		}
+	}
+	rows.Close()
+
+	totals := &poolStatsBucket{}
+	for _, b := range series {
+		b.finish()
+		totals.add(b)
+	}
+	totals.finish()
+
+	s.respondJSON(w, http.StatusOK, map[string]interface{}{
+		"pool_id":   id,
+		"pool_name": poolName,
+		"from":      from,
+		"to":        to,
+		"bucket":    bucket,
+		"series":    series,
+		"totals": map[string]interface{}{
+			"bytes_written":     totals.BytesWritten,
+			"sets_created":      totals.SetsCreated,
+			"tapes_consumed":    totals.TapesConsumed,
+			"compression_ratio": totals.CompressionRatio,
+			"reuse_events":      totals.ReuseEvents,
+		},
+	})
+}
@@ -0,0 +1,481 @@
+package api
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/RoseOO/TapeBackarr/internal/credentials"
+	"github.com/RoseOO/TapeBackarr/internal/models"
+	"github.com/RoseOO/TapeBackarr/internal/proxmox"
+	"github.com/RoseOO/TapeBackarr/internal/validation"
+)
+
+// proxmoxClientTTL is how long the client of a registered cluster is reused.
+// Tickets from password logins are valid for two hours.
+const proxmoxClientTTL = time.Hour
+
+// proxmoxClusterColumns is the column list shared by cluster queries
+const proxmoxClusterColumns = `id, name, host, port, skip_tls_verify, credential_id, enabled, created_at, updated_at`
+
+var (
+	errProxmoxNotConfigured   = errors.New("Proxmox integration not configured")
+	errProxmoxClusterNotFound = errors.New("Proxmox cluster not found")
+	errProxmoxClusterDisabled = errors.New("Proxmox cluster is disabled")
+)
+
+// proxmoxScope is the client and services of one Proxmox endpoint: a
+// registered cluster, or the one in the configuration file
+type proxmoxScope struct {
+	client  *proxmox.Client
+	backup  *proxmox.BackupService
+	restore *proxmox.RestoreService
+	created time.Time
+}
+
+// proxmoxClusterState caches the scopes of registered clusters by ID
+type proxmoxClusterState struct {
+	mu     sync.Mutex
+	scopes map[int64]*proxmoxScope
+}
+
+func scanProxmoxCluster(row interface{ Scan(...interface{}) error }) (*models.ProxmoxCluster, error) {
+	var c models.ProxmoxCluster
+	if err := row.Scan(&c.ID, &c.Name, &c.Host, &c.Port, &c.SkipTLSVerify, &c.CredentialID,
+		&c.Enabled, &c.CreatedAt, &c.UpdatedAt); err != nil {
+		return nil, err
+	}
+	return &c, nil
+}
+
+// clusterIDQuery reads the optional cluster_id query parameter. Without it,
+// or with 0, requests go to the configured endpoint.
+func clusterIDQuery(r *http.Request) (*int64, error) {
+	v := r.URL.Query().Get("cluster_id")
+	if v == "" {
+		return nil, nil
+	}
+	id, err := strconv.ParseInt(v, 10, 64)
+	if err != nil || id < 0 {
+		return nil, fmt.Errorf("invalid cluster_id")
+	}
+	return optionalClusterID(id), nil
+}
+
+// optionalClusterID maps a cluster ID from a request body to a scope: 0 is
+// the configured endpoint
+func optionalClusterID(id int64) *int64 {
+	if id == 0 {
+		return nil
+	}
+	return &id
+}
+
+// proxmoxFor returns the scope of a registered cluster, or of the configured
+// endpoint when clusterID is nil. A cluster's client is created on first use
+// with its stored credential and reused for proxmoxClientTTL.
+func (s *Server) proxmoxFor(clusterID *int64) (*proxmoxScope, error) {
+	if clusterID == nil {
+		if s.proxmoxClient == nil || s.proxmoxBackupService == nil || s.proxmoxRestoreService == nil {
+			return nil, errProxmoxNotConfigured
+		}
+		return &proxmoxScope{client: s.proxmoxClient, backup: s.proxmoxBackupService, restore: s.proxmoxRestoreService}, nil
+	}
+
+	s.proxmoxClusters.mu.Lock()
+	defer s.proxmoxClusters.mu.Unlock()
+	if scope := s.proxmoxClusters.scopes[*clusterID]; scope != nil && time.Since(scope.created) < proxmoxClientTTL {
+		return scope, nil
+	}
+
+	c, err := scanProxmoxCluster(s.db.QueryRow("SELECT "+proxmoxClusterColumns+" FROM proxmox_clusters WHERE id = ?", *clusterID))
+	if err == sql.ErrNoRows {
+		return nil, errProxmoxClusterNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	if !c.Enabled {
+		return nil, errProxmoxClusterDisabled
+	}
+	client, err := s.newProxmoxClusterClient(c, "proxmox api")
+	if err != nil {
+		return nil, err
+	}
+
+	scope := &proxmoxScope{
+		client:  client,
+		backup:  proxmox.NewBackupService(client, s.db, s.tapeService, s.logger, s.proxmoxBlockSize()),
+		restore: proxmox.NewRestoreService(client, s.db, s.tapeService, s.logger, s.proxmoxBlockSize()),
+		created: time.Now(),
+	}
+	scope.backup.SetClusterID(c.ID)
+	scope.restore.SetClusterID(c.ID)
+	if s.scratch != nil {
+		scope.backup.SetScratchDir(s.scratch)
+		scope.restore.SetScratchDir(s.scratch)
+	}
+	if s.config != nil && s.config.Proxmox.TempDir != "" {
+		scope.backup.SetTempDir(s.config.Proxmox.TempDir)
+		scope.restore.SetTempDir(s.config.Proxmox.TempDir)
+	}
+
+	if s.proxmoxClusters.scopes == nil {
+		s.proxmoxClusters.scopes = make(map[int64]*proxmoxScope)
+	}
+	s.proxmoxClusters.scopes[c.ID] = scope
+	return scope, nil
+}
+
+// newProxmoxClusterClient creates a client for a registered cluster with its
+// stored credential, recording the use
+func (s *Server) newProxmoxClusterClient(c *models.ProxmoxCluster, purpose string) (*proxmox.Client, error) {
+	store := s.credentialStore()
+	if store == nil {
+		return nil, fmt.Errorf("Proxmox cluster %q uses a stored credential but the credentials store is not available", c.Name)
+	}
+	cred, secret, err := store.Resolve(c.CredentialID, credentials.Usage{
+		UsedByType: "proxmox_cluster",
+		UsedByID:   c.ID,
+		Purpose:    purpose,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	cfg := &proxmox.ClientConfig{
+		Host:          c.Host,
+		Port:          c.Port,
+		SkipTLSVerify: c.SkipTLSVerify,
+	}
+	switch cred.CredentialType {
+	case models.CredentialToken:
+		cfg.TokenID, cfg.TokenSecret = cred.Username, secret
+	case models.CredentialPassword:
+		cfg.Username, cfg.Realm, cfg.Password = cred.Username, cred.Domain, secret
+	default:
+		return nil, fmt.Errorf("credential %q is not a password or token credential", cred.Name)
+	}
+	return proxmox.NewClient(cfg)
+}
+
+// forgetProxmoxCluster drops the cached client of a cluster after it changed
+func (s *Server) forgetProxmoxCluster(id int64) {
+	s.proxmoxClusters.mu.Lock()
+	delete(s.proxmoxClusters.scopes, id)
+	s.proxmoxClusters.mu.Unlock()
+}
+
+// proxmoxBlockSize is the tape block size Proxmox backups are written with
+func (s *Server) proxmoxBlockSize() int {
+	if s.config != nil && s.config.Tape.BlockSize > 0 {
+		return s.config.Tape.BlockSize
+	}
+	return 65536
+}
+
+// proxmoxExcludeTag returns the guest tag that keeps guests out of
+// multi-guest runs
+func (s *Server) proxmoxExcludeTag() string {
+	if s.config == nil {
+		return proxmox.DefaultExcludeTag
+	}
+	return s.config.Proxmox.ExcludeTag
+}
+
+// requireProxmox writes an error when the scope of clusterID is not
+// available and returns it otherwise
+func (s *Server) requireProxmox(w http.ResponseWriter, clusterID *int64) (*proxmoxScope, bool) {
+	scope, err := s.proxmoxFor(clusterID)
+	switch {
+	case err == nil:
+		return scope, true
+	case errors.Is(err, errProxmoxNotConfigured):
+		s.respondErrorCode(w, http.StatusServiceUnavailable, codeNotConfigured, err.Error(), nil)
+	case errors.Is(err, errProxmoxClusterNotFound):
+		s.respondError(w, http.StatusNotFound, err.Error())
+	case errors.Is(err, errProxmoxClusterDisabled):
+		s.respondErrorCode(w, http.StatusConflict, codeConflict, err.Error(), nil)
+	default:
+		s.respondErrorCode(w, http.StatusBadGateway, codeUpstream, err.Error(), nil)
+	}
+	return nil, false
+}
+
+// requireProxmoxQuery is requireProxmox for the cluster_id query parameter
+func (s *Server) requireProxmoxQuery(w http.ResponseWriter, r *http.Request) (*proxmoxScope, bool) {
+	clusterID, err := clusterIDQuery(r)
+	if err != nil {
+		s.respondError(w, http.StatusBadRequest, err.Error())
+		return nil, false
+	}
+	return s.requireProxmox(w, clusterID)
+}
+
+// checkProxmoxClusterRef returns an error message when a job refers to a
+// cluster that does not exist. 0 is the configured endpoint.
+func (s *Server) checkProxmoxClusterRef(id int64) string {
+	if id == 0 {
+		return ""
+	}
+	var exists int
+	if err := s.db.QueryRow("SELECT COUNT(*) FROM proxmox_clusters WHERE id = ?", id).Scan(&exists); err != nil || exists == 0 {
+		return errProxmoxClusterNotFound.Error()
+	}
+	return ""
+}
+
+// validateProxmoxCluster checks a cluster's fields and that its credential
+// exists and can log in to Proxmox
+func (s *Server) validateProxmoxCluster(c *models.ProxmoxCluster) error {
+	v := validation.New()
+	v.Required("name", c.Name)
+	v.Required("host", c.Host)
+	if strings.ContainsAny(c.Host, "/ \t\n") {
+		v.Add("host", "must be a host name or address without a scheme or path")
+	}
+	v.Range("port", int64(c.Port), 1, 65535)
+	v.RequiredID("credential_id", c.CredentialID)
+	if c.CredentialID > 0 {
+		var credType models.CredentialType
+		if err := s.db.QueryRow("SELECT credential_type FROM credentials WHERE id = ?", c.CredentialID).Scan(&credType); err != nil {
+			v.Add("credential_id", "credential not found")
+		} else if credType != models.CredentialPassword && credType != models.CredentialToken {
+			v.Add("credential_id", "must be a password or token credential")
+		}
+	}
+	return v.Err()
+}
+
+func (s *Server) handleListProxmoxClusters(w http.ResponseWriter, r *http.Request) {
+	rows, err := s.db.Query("SELECT " + proxmoxClusterColumns + " FROM proxmox_clusters ORDER BY name")
+	if err != nil {
+		s.respondError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	defer rows.Close()
+
+	clusters := []models.ProxmoxCluster{}
+	for rows.Next() {
+		c, err := scanProxmoxCluster(rows)
+		if err != nil {
+			continue
+		}
+		clusters = append(clusters, *c)
+	}
+
+	s.respondJSON(w, http.StatusOK, clusters)
+}
+
+func (s *Server) handleGetProxmoxCluster(w http.ResponseWriter, r *http.Request) {
+	id, err := s.getIDParam(r)
+	if err != nil {
+		s.respondError(w, http.StatusBadRequest, "invalid cluster id")
+		return
+	}
+
+	c, err := scanProxmoxCluster(s.db.QueryRow("SELECT "+proxmoxClusterColumns+" FROM proxmox_clusters WHERE id = ?", id))
+	if err != nil {
+		s.respondError(w, http.StatusNotFound, errProxmoxClusterNotFound.Error())
+		return
+	}
+
+	s.respondJSON(w, http.StatusOK, c)
+}
+
+func (s *Server) handleCreateProxmoxCluster(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Name          string `json:"name"`
+		Host          string `json:"host"`
+		Port          int    `json:"port"`
+		SkipTLSVerify bool   `json:"skip_tls_verify"`
+		CredentialID  int64  `json:"credential_id"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		s.respondError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+	if s.requireCredentials(w) == nil {
+		return
+	}
+
+	c := &models.ProxmoxCluster{
+		Name:          strings.TrimSpace(req.Name),
+		Host:          strings.TrimSpace(req.Host),
+		Port:          req.Port,
+		SkipTLSVerify: req.SkipTLSVerify,
+		CredentialID:  req.CredentialID,
+	}
+	if c.Port == 0 {
+		c.Port = 8006
+	}
+	if err := s.validateProxmoxCluster(c); err != nil {
+		s.respondValidationError(w, err)
+		return
+	}
+
+	result, err := s.db.Exec(`
+		INSERT INTO proxmox_clusters (name, host, port, skip_tls_verify, credential_id, enabled)
+		VALUES (?, ?, ?, ?, ?, 1)
+	`, c.Name, c.Host, c.Port, c.SkipTLSVerify, c.CredentialID)
+	if err != nil {
+		if strings.Contains(err.Error(), "UNIQUE") {
+			s.respondErrorCode(w, http.StatusConflict, codeAlreadyExists, "a Proxmox cluster with this name already exists", nil)
+			return
+		}
+		s.respondError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	id, _ := result.LastInsertId()
+	s.auditLog(r, "create", "proxmox_cluster", id, fmt.Sprintf("Registered Proxmox cluster '%s' (%s:%d)", c.Name, c.Host, c.Port))
+
+	s.respondJSON(w, http.StatusCreated, map[string]int64{"id": id})
+}
+
+func (s *Server) handleUpdateProxmoxCluster(w http.ResponseWriter, r *http.Request) {
+	id, err := s.getIDParam(r)
+	if err != nil {
+		s.respondError(w, http.StatusBadRequest, "invalid cluster id")
+		return
+	}
+
+	var req struct {
+		Name          *string `json:"name"`
+		Host          *string `json:"host"`
+		Port          *int    `json:"port"`
+		SkipTLSVerify *bool   `json:"skip_tls_verify"`
+		CredentialID  *int64  `json:"credential_id"`
+		Enabled       *bool   `json:"enabled"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		s.respondError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+
+	c, err := scanProxmoxCluster(s.db.QueryRow("SELECT "+proxmoxClusterColumns+" FROM proxmox_clusters WHERE id = ?", id))
+	if err == sql.ErrNoRows {
+		s.respondError(w, http.StatusNotFound, errProxmoxClusterNotFound.Error())
+		return
+	}
+	if err != nil {
+		s.respondError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	if req.Name != nil {
+		c.Name = strings.TrimSpace(*req.Name)
+	}
+	if req.Host != nil {
+		c.Host = strings.TrimSpace(*req.Host)
+	}
+	if req.Port != nil {
+		c.Port = *req.Port
+	}
+	if req.SkipTLSVerify != nil {
+		c.SkipTLSVerify = *req.SkipTLSVerify
+	}
+	if req.CredentialID != nil {
+		c.CredentialID = *req.CredentialID
+	}
+	if req.Enabled != nil {
+		c.Enabled = *req.Enabled
+	}
+	if err := s.validateProxmoxCluster(c); err != nil {
+		s.respondValidationError(w, err)
+		return
+	}
+
+	if _, err := s.db.Exec(`
+		UPDATE proxmox_clusters SET name = ?, host = ?, port = ?, skip_tls_verify = ?, credential_id = ?, enabled = ?,
+			updated_at = CURRENT_TIMESTAMP
+		WHERE id = ?
+	`, c.Name, c.Host, c.Port, c.SkipTLSVerify, c.CredentialID, c.Enabled, id); err != nil {
+		if strings.Contains(err.Error(), "UNIQUE") {
+			s.respondErrorCode(w, http.StatusConflict, codeAlreadyExists, "a Proxmox cluster with this name already exists", nil)
+			return
+		}
+		s.respondError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	s.forgetProxmoxCluster(id)
+
+	s.auditLog(r, "update", "proxmox_cluster", id, fmt.Sprintf("Updated Proxmox cluster '%s'", c.Name))
+
+	s.respondJSON(w, http.StatusOK, map[string]string{"status": "updated"})
+}
+
+// handleDeleteProxmoxCluster unregisters a cluster that no Proxmox job uses.
+// Its backups and restores stay listed under its ID.
+func (s *Server) handleDeleteProxmoxCluster(w http.ResponseWriter, r *http.Request) {
+	id, err := s.getIDParam(r)
+	if err != nil {
+		s.respondError(w, http.StatusBadRequest, "invalid cluster id")
+		return
+	}
+
+	c, err := scanProxmoxCluster(s.db.QueryRow("SELECT "+proxmoxClusterColumns+" FROM proxmox_clusters WHERE id = ?", id))
+	if err != nil {
+		s.respondError(w, http.StatusNotFound, errProxmoxClusterNotFound.Error())
+		return
+	}
+
+	var jobs int
+	s.db.QueryRow("SELECT COUNT(*) FROM proxmox_backup_jobs WHERE cluster_id = ?", id).Scan(&jobs)
+	if jobs > 0 {
+		s.respondErrorCode(w, http.StatusConflict, codeConflict, fmt.Sprintf("Proxmox cluster is used by %d job(s); move or delete them first", jobs), nil)
+		return
+	}
+
+	if _, err := s.db.Exec("DELETE FROM proxmox_clusters WHERE id = ?", id); err != nil {
+		s.respondError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	s.forgetProxmoxCluster(id)
+
+	s.auditLog(r, "delete", "proxmox_cluster", id, fmt.Sprintf("Removed Proxmox cluster '%s'", c.Name))
+
+	s.respondJSON(w, http.StatusOK, map[string]string{"status": "deleted"})
+}
+
+// handleTestProxmoxCluster connects to a cluster with its stored credential
+// and lists its nodes
+func (s *Server) handleTestProxmoxCluster(w http.ResponseWriter, r *http.Request) {
+	id, err := s.getIDParam(r)
+	if err != nil {
+		s.respondError(w, http.StatusBadRequest, "invalid cluster id")
+		return
+	}
+	if s.requireCredentials(w) == nil {
+		return
+	}
+
+	c, err := scanProxmoxCluster(s.db.QueryRow("SELECT "+proxmoxClusterColumns+" FROM proxmox_clusters WHERE id = ?", id))
+	if err != nil {
+		s.respondError(w, http.StatusNotFound, errProxmoxClusterNotFound.Error())
+		return
+	}
+
+	client, err := s.newProxmoxClusterClient(c, "connection test")
+	if err != nil {
+		s.respondJSON(w, http.StatusOK, map[string]interface{}{"success": false, "error": err.Error()})
+		return
+	}
+	nodes, err := client.GetNodes(r.Context())
+	if err != nil {
+		s.respondJSON(w, http.StatusOK, map[string]interface{}{"success": false, "error": err.Error()})
+		return
+	}
+
+	s.respondJSON(w, http.StatusOK, map[string]interface{}{
+		"success":    true,
+		"node_count": len(nodes),
+		"nodes":      nodes,
+	})
+}
@@ -0,0 +1,509 @@
+package api
+
+import (
+	"compress/gzip"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/RoseOO/TapeBackarr/internal/config"
+)
+
+// replicationAlertAfter is the number of failed checks in a row after which
+// a standby reports its primary as unreachable
+const replicationAlertAfter = 5
+
+// replicationState tracks a standby's replication from its primary
+type replicationState struct {
+	mu          sync.Mutex
+	standby     bool
+	cancel      context.CancelFunc
+	generation  string
+	lastCheckAt *time.Time
+	lastSyncAt  *time.Time
+	lastError   string
+	failures    int
+	alerted     bool
+	// snapshotAt is when this primary last built a database copy
+	snapshotAt time.Time
+	// syncMu is held for the duration of a sync so promotion can wait for
+	// one in progress to finish
+	syncMu sync.Mutex
+}
+
+// replicatedConfig holds the configuration a standby takes over from its
+// primary. Settings that describe the host itself (server, database, tape
+// devices, logging, scratch) stay local.
+type replicatedConfig struct {
+	// CredentialsKey is the key the primary's credentials store uses, so
+	// the standby can decrypt the replicated credentials
+	CredentialsKey string                     `json:"credentials_key"`
+	Notifications  config.NotificationsConfig `json:"notifications"`
+	Proxmox        config.ProxmoxConfig       `json:"proxmox"`
+	SLO            config.SLOConfig           `json:"slo"`
+}
+
+// isStandby reports whether this server currently follows a primary
+func (s *Server) isStandby() bool {
+	s.replication.mu.Lock()
+	defer s.replication.mu.Unlock()
+	return s.replication.standby
+}
+
+// standbyMiddleware rejects changes on a standby, whose database is
+// replaced with the primary's on every sync. Reads and the replication API
+// stay available.
+func (s *Server) standbyMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet, http.MethodHead, http.MethodOptions:
+			next.ServeHTTP(w, r)
+			return
+		}
+		if s.isStandby() && !strings.HasPrefix(r.URL.Path, "/api/v1/replication/") {
+			s.respondErrorCode(w, http.StatusConflict, codeStandbyReplica, "this server is a standby replica; promote it before making changes", nil)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// requirePrimary writes an error unless this server is configured as a
+// replication primary and reports whether it is
+func (s *Server) requirePrimary(w http.ResponseWriter) bool {
+	if s.config == nil || s.config.Replication.Role != config.ReplicationPrimary {
+		s.respondError(w, http.StatusForbidden, "replication is not enabled: set replication.role to primary")
+		return false
+	}
+	// The standby gets the credentials key, so it must not be the JWT secret
+	if s.credentialsKey() == "" {
+		s.respondErrorCode(w, http.StatusServiceUnavailable, codeNotConfigured, "replication needs auth.credentials_key on the primary", nil)
+		return false
+	}
+	return true
+}
+
+// databaseGeneration identifies the current state of the database files.
+// It changes with every write, including those still in the WAL.
+func (s *Server) databaseGeneration() string {
+	var b strings.Builder
+	for _, path := range []string{s.db.Path, s.db.Path + "-wal"} {
+		if info, err := os.Stat(path); err == nil {
+			fmt.Fprintf(&b, "%x.%x.", info.ModTime().UnixNano(), info.Size())
+		}
+	}
+	return `"` + strings.TrimSuffix(b.String(), ".") + `"`
+}
+
+// handleReplicationSnapshot sends a consistent, gzipped copy of the
+// database to a standby. A standby passes the ETag of its last copy in
+// If-None-Match and gets 304 when nothing changed since, or when the last
+// copy was built less than replication.min_snapshot_seconds ago.
+func (s *Server) handleReplicationSnapshot(w http.ResponseWriter, r *http.Request) {
+	if !s.requirePrimary(w) {
+		return
+	}
+	generation := s.databaseGeneration()
+	since := r.Header.Get("If-None-Match")
+	if since == generation {
+		w.Header().Set("ETag", generation)
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	// Every write changes the generation and a copy reads the whole
+	// database, so a standby that has one keeps it until the interval is up
+	if since != "" {
+		minInterval := time.Duration(s.config.Replication.MinSnapshotSeconds) * time.Second
+		s.replication.mu.Lock()
+		recent := time.Since(s.replication.snapshotAt) < minInterval
+		s.replication.mu.Unlock()
+		if recent {
+			w.Header().Set("ETag", since)
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+	}
+
+	tempDir, err := s.scratch.MkdirTemp("replica-*")
+	if err != nil {
+		s.respondError(w, http.StatusInternalServerError, "failed to create temp directory")
+		return
+	}
+	defer os.RemoveAll(tempDir)
+	copyPath := filepath.Join(tempDir, "tapebackarr.db")
+	if _, err := s.db.Exec("VACUUM INTO ?", copyPath); err != nil {
+		s.respondError(w, http.StatusInternalServerError, "failed to copy database: "+err.Error())
+		return
+	}
+	s.replication.mu.Lock()
+	s.replication.snapshotAt = time.Now()
+	s.replication.mu.Unlock()
+	f, err := os.Open(copyPath)
+	if err != nil {
+		s.respondError(w, http.StatusInternalServerError, "failed to open database copy")
+		return
+	}
+	defer f.Close()
+
+	w.Header().Set("Content-Type", "application/gzip")
+	w.Header().Set("ETag", generation)
+	w.WriteHeader(http.StatusOK)
+	gz := gzip.NewWriter(w)
+	if _, err := io.Copy(gz, f); err == nil {
+		gz.Close()
+	}
+}
+
+// handleReplicationConfig returns the configuration a standby takes over,
+// secrets included
+func (s *Server) handleReplicationConfig(w http.ResponseWriter, r *http.Request) {
+	if !s.requirePrimary(w) {
+		return
+	}
+	s.respondJSON(w, http.StatusOK, replicatedConfig{
+		CredentialsKey: s.credentialsKey(),
+		Notifications:  s.config.Notifications,
+		Proxmox:        s.config.Proxmox,
+		SLO:            s.config.SLO,
+	})
+}
+
+// handleReplicationStatus reports this server's replication role and, on a
+// standby, how current its copy of the primary is
+func (s *Server) handleReplicationStatus(w http.ResponseWriter, r *http.Request) {
+	status := map[string]interface{}{"role": ""}
+	if s.config != nil {
+		status["role"] = s.config.Replication.Role
+	}
+
+	s.replication.mu.Lock()
+	standby := s.replication.standby
+	if standby {
+		status["primary_url"] = s.config.Replication.PrimaryURL
+		status["generation"] = s.replication.generation
+		status["last_check_at"] = s.replication.lastCheckAt
+		status["last_sync_at"] = s.replication.lastSyncAt
+		status["last_error"] = s.replication.lastError
+		status["consecutive_failures"] = s.replication.failures
+	}
+	s.replication.mu.Unlock()
+	status["standby"] = standby
+	if !standby && s.db != nil {
+		status["generation"] = s.databaseGeneration()
+	}
+
+	s.respondJSON(w, http.StatusOK, status)
+}
+
+// handleReplicationSync makes a standby check its primary now
+func (s *Server) handleReplicationSync(w http.ResponseWriter, r *http.Request) {
+	if !s.isStandby() {
+		s.respondError(w, http.StatusConflict, "this server is not a standby")
+		return
+	}
+	if err := s.replicateOnce(r.Context()); err != nil {
+		s.respondError(w, http.StatusBadGateway, err.Error())
+		return
+	}
+	s.handleReplicationStatus(w, r)
+}
+
+// handlePromoteStandby turns a standby into a primary: replication stops,
+// changes are allowed again and scheduled jobs start running. It is meant
+// for when the primary is gone; make sure the old primary does not come
+// back with its scheduler running.
+func (s *Server) handlePromoteStandby(w http.ResponseWriter, r *http.Request) {
+	s.replication.mu.Lock()
+	if !s.replication.standby {
+		s.replication.mu.Unlock()
+		s.respondError(w, http.StatusConflict, "this server is not a standby")
+		return
+	}
+	if s.replication.cancel != nil {
+		s.replication.cancel()
+	}
+	s.replication.mu.Unlock()
+
+	// Let a sync in progress finish before taking over
+	s.replication.syncMu.Lock()
+	s.replication.mu.Lock()
+	s.replication.standby = false
+	s.replication.cancel = nil
+	lastSync := s.replication.lastSyncAt
+	s.replication.mu.Unlock()
+	s.replication.syncMu.Unlock()
+
+	if s.scheduler != nil {
+		s.scheduler.SetStandby(false)
+		if err := s.scheduler.ReloadJobs(); err != nil && s.logger != nil {
+			s.logger.Warn("Failed to reload jobs after promotion", map[string]interface{}{"error": err.Error()})
+		}
+	}
+	primaryURL := s.config.Replication.PrimaryURL
+	s.config.Replication.Role = config.ReplicationPrimary
+	if s.configPath != "" {
+		if err := s.config.Save(s.configPath); err != nil && s.logger != nil {
+			s.logger.Error("Failed to save configuration after promotion", map[string]interface{}{"error": err.Error()})
+		}
+	}
+
+	s.auditLog(r, "promote", "replication", 0, fmt.Sprintf("Promoted standby to primary (was following %s)", primaryURL))
+	if s.logger != nil {
+		s.logger.Warn("Standby promoted to primary", map[string]interface{}{"former_primary": primaryURL})
+	}
+	s.eventBus.Publish(SystemEvent{
+		Type:     "warning",
+		Category: "system",
+		Key:      "replication_promoted",
+		Args:     []interface{}{primaryURL},
+	})
+
+	s.respondJSON(w, http.StatusOK, map[string]interface{}{
+		"status":       "promoted",
+		"last_sync_at": lastSync,
+		"note":         "restart to apply replicated notification and Proxmox settings",
+	})
+}
+
+// startReplication makes this server a standby of replication.primary_url
+// and keeps checking it for changes until it is promoted
+func (s *Server) startReplication() {
+	ctx, cancel := context.WithCancel(context.Background())
+	s.replication.mu.Lock()
+	s.replication.standby = true
+	s.replication.cancel = cancel
+	s.replication.mu.Unlock()
+	if s.scheduler != nil {
+		s.scheduler.SetStandby(true)
+	}
+
+	interval := time.Duration(s.config.Replication.IntervalSeconds) * time.Second
+	if interval <= 0 {
+		interval = time.Minute
+	}
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			s.replicateOnce(ctx)
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// replicateOnce syncs from the primary and records the outcome, alerting
+// once when the primary stays unreachable and again when it is back
+func (s *Server) replicateOnce(ctx context.Context) error {
+	s.replication.syncMu.Lock()
+	defer s.replication.syncMu.Unlock()
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+
+	synced, err := s.syncFromPrimary(ctx)
+	now := time.Now()
+	primaryURL := s.config.Replication.PrimaryURL
+
+	s.replication.mu.Lock()
+	s.replication.lastCheckAt = &now
+	var alert, recovered bool
+	if err != nil {
+		s.replication.lastError = err.Error()
+		s.replication.failures++
+		if s.replication.failures >= replicationAlertAfter && !s.replication.alerted {
+			s.replication.alerted = true
+			alert = true
+		}
+	} else {
+		s.replication.lastError = ""
+		s.replication.failures = 0
+		recovered = s.replication.alerted
+		s.replication.alerted = false
+		if synced {
+			s.replication.lastSyncAt = &now
+		}
+	}
+	s.replication.mu.Unlock()
+
+	if err != nil && ctx.Err() == nil && s.logger != nil {
+		s.logger.Warn("Replication from primary failed", map[string]interface{}{"primary": primaryURL, "error": err.Error()})
+	}
+	if alert {
+		s.eventBus.Publish(SystemEvent{
+			Type:     "error",
+			Category: "system",
+			Key:      "replication_primary_unreachable",
+			Args:     []interface{}{primaryURL, err.Error()},
+		})
+	}
+	if recovered {
+		s.eventBus.Publish(SystemEvent{
+			Type:     "success",
+			Category: "system",
+			Key:      "replication_restored",
+			Args:     []interface{}{primaryURL},
+		})
+	}
+	return err
+}
+
+// replicationRequest calls the primary's replication API
+func (s *Server) replicationRequest(ctx context.Context, path string, header http.Header) (*http.Response, error) {
+	cfg := s.config.Replication
+	if cfg.PrimaryURL == "" || cfg.APIKey == "" {
+		return nil, fmt.Errorf("replication.primary_url and replication.api_key are required on a standby")
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, strings.TrimSuffix(cfg.PrimaryURL, "/")+path, nil)
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	req.Header.Set("X-API-Key", cfg.APIKey)
+	client := &http.Client{Timeout: time.Hour}
+	if cfg.SkipTLSVerify {
+		client.Transport = &http.Transport{TLSClientConfig: &tls.Config{InsecureSkipVerify: true}}
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusNotModified {
+		defer resp.Body.Close()
+		var apiErr struct {
+			Error string `json:"error"`
+		}
+		json.NewDecoder(io.LimitReader(resp.Body, 4096)).Decode(&apiErr)
+		return nil, fmt.Errorf("primary returned %s: %s", resp.Status, apiErr.Error)
+	}
+	return resp, nil
+}
+
+// syncFromPrimary replaces the local database with the primary's when it
+// changed since the last sync and takes over the shared configuration. It
+// reports whether the database was replaced.
+func (s *Server) syncFromPrimary(ctx context.Context) (bool, error) {
+	s.replication.mu.Lock()
+	generation := s.replication.generation
+	s.replication.mu.Unlock()
+
+	header := http.Header{}
+	if generation != "" {
+		header.Set("If-None-Match", generation)
+	}
+	resp, err := s.replicationRequest(ctx, "/api/v1/replication/snapshot", header)
+	if err != nil {
+		return false, err
+	}
+	defer resp.Body.Close()
+
+	synced := false
+	if resp.StatusCode == http.StatusOK {
+		if err := s.applyReplicatedDatabase(resp.Body); err != nil {
+			return false, err
+		}
+		s.replication.mu.Lock()
+		s.replication.generation = resp.Header.Get("ETag")
+		s.replication.mu.Unlock()
+		synced = true
+	}
+
+	cfgResp, err := s.replicationRequest(ctx, "/api/v1/replication/config", nil)
+	if err != nil {
+		return synced, err
+	}
+	defer cfgResp.Body.Close()
+	var rc replicatedConfig
+	if err := json.NewDecoder(cfgResp.Body).Decode(&rc); err != nil {
+		return synced, fmt.Errorf("invalid configuration from primary: %w", err)
+	}
+	s.applyReplicatedConfig(&rc)
+	return synced, nil
+}
+
+// applyReplicatedDatabase unpacks a database copy from the primary and
+// restores it into the open database
+func (s *Server) applyReplicatedDatabase(body io.Reader) error {
+	gz, err := gzip.NewReader(body)
+	if err != nil {
+		return fmt.Errorf("invalid database copy from primary: %w", err)
+	}
+	defer gz.Close()
+
+	tmp, err := s.scratch.CreateTemp("replica-*.db")
+	if err != nil {
+		return fmt.Errorf("failed to create temp file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := io.Copy(tmp, gz); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to receive database copy: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := s.db.RestoreSnapshot(tmp.Name()); err != nil {
+		return fmt.Errorf("failed to apply database copy: %w", err)
+	}
+
+	if s.scheduler != nil {
+		if err := s.scheduler.ReloadJobs(); err != nil && s.logger != nil {
+			s.logger.Warn("Failed to reload jobs after replication", map[string]interface{}{"error": err.Error()})
+		}
+	}
+	s.reloadNotificationTemplates()
+	return nil
+}
+
+// applyReplicatedConfig takes over the primary's shared settings and saves
+// them when they changed. Notification and Proxmox changes take effect
+// after a restart; the credentials store is reopened right away.
+func (s *Server) applyReplicatedConfig(rc *replicatedConfig) {
+	// Requests and jobs read the key and the store while this runs
+	s.credentialsMu.Lock()
+	defer s.credentialsMu.Unlock()
+	changed := false
+	if !reflect.DeepEqual(s.config.Notifications, rc.Notifications) {
+		s.config.Notifications = rc.Notifications
+		changed = true
+	}
+	if !reflect.DeepEqual(s.config.Proxmox, rc.Proxmox) {
+		s.config.Proxmox = rc.Proxmox
+		changed = true
+	}
+	if s.config.SLO != rc.SLO {
+		s.config.SLO = rc.SLO
+		changed = true
+	}
+	if rc.CredentialsKey != "" && s.config.Auth.CredentialsKey != rc.CredentialsKey {
+		s.config.Auth.CredentialsKey = rc.CredentialsKey
+		s.credentials = newCredentialStore(s.db, s.config, s.configPath, s.logger)
+		if s.restoreService != nil {
+			s.restoreService.SetCredentials(s.credentials)
+		}
+		if s.backupService != nil {
+			s.backupService.SetCredentials(s.credentials)
+		}
+		changed = true
+	}
+	if !changed || s.configPath == "" {
+		return
+	}
+	if err := s.config.Save(s.configPath); err != nil && s.logger != nil {
+		s.logger.Error("Failed to save replicated configuration", map[string]interface{}{"error": err.Error()})
+	}
+}
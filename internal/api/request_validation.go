@@ -0,0 +1,24 @@
+package api
+
+import "github.com/RoseOO/TapeBackarr/internal/models"
+
+// Accepted values of the enum fields of request bodies, in the order error
+// messages list them
+var (
+	backupTypes = []string{string(models.BackupTypeFull), string(models.BackupTypeIncremental),
+		string(models.BackupTypeDifferential)}
+
+	compressionTypes = []string{string(models.CompressionNone), string(models.CompressionLTO),
+		string(models.CompressionGzip), string(models.CompressionZstd)}
+
+	changeDetectionModes = []string{string(models.ChangeDetectionMetadata), string(models.ChangeDetectionHash),
+		string(models.ChangeDetectionHybrid)}
+
+	guardActions = []string{string(models.GuardrailConfirm), string(models.GuardrailDryRun)}
+
+	allocationPolicies = []string{models.AllocationContinue, models.AllocationAlwaysNew}
+
+	sourceTypes = []string{string(models.SourceTypeLocal), string(models.SourceTypeSMB), string(models.SourceTypeNFS), string(models.SourceTypeNDMP)}
+
+	symlinkPolicies = []string{string(models.SymlinkStore), string(models.SymlinkFollow), string(models.SymlinkSkip)}
+)
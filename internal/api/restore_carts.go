@@ -0,0 +1,666 @@
+package api
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/RoseOO/TapeBackarr/internal/auth"
+	"github.com/RoseOO/TapeBackarr/internal/models"
+	"github.com/RoseOO/TapeBackarr/internal/restore"
+)
+
+// Restore cart statuses
+const (
+	cartOpen      = "open"
+	cartSubmitted = "submitted"
+)
+
+const (
+	// maxCartEntriesPerRequest bounds the catalog entries added or removed by
+	// one request; larger selections are sent in several
+	maxCartEntriesPerRequest = 10000
+	defaultCartItemLimit     = 1000
+)
+
+// restoreCart is a named selection of catalog entries to restore. Details
+// such as the backup sets and tapes involved are only filled in for a
+// single cart.
+type restoreCart struct {
+	ID             int64                     `json:"id"`
+	Name           string                    `json:"name"`
+	OwnerID        *int64                    `json:"owner_id,omitempty"`
+	OwnerName      string                    `json:"owner_name,omitempty"`
+	Status         string                    `json:"status"`
+	FileCount      int64                     `json:"file_count"`
+	TotalBytes     int64                     `json:"total_bytes"`
+	MissingEntries int64                     `json:"missing_entries,omitempty"` // items whose catalog entry is gone
+	BackupSets     []restoreCartSet          `json:"backup_sets,omitempty"`
+	RequiredTapes  []restore.TapeRequirement `json:"required_tapes,omitempty"`
+	CreatedAt      time.Time                 `json:"created_at"`
+	UpdatedAt      time.Time                 `json:"updated_at"`
+	SubmittedAt    *time.Time                `json:"submitted_at,omitempty"`
+}
+
+// restoreCartSet sums up a cart's items from one backup set
+type restoreCartSet struct {
+	BackupSetID int64      `json:"backup_set_id"`
+	JobName     string     `json:"job_name"`
+	BackupType  string     `json:"backup_type"`
+	StartTime   *time.Time `json:"start_time,omitempty"`
+	FileCount   int64      `json:"file_count"`
+	TotalBytes  int64      `json:"total_bytes"`
+}
+
+// restoreCartItem is a catalog entry in a cart
+type restoreCartItem struct {
+	ID             int64     `json:"id"`
+	CatalogEntryID int64     `json:"catalog_entry_id"`
+	BackupSetID    int64     `json:"backup_set_id"`
+	FilePath       string    `json:"file_path"`
+	FileSize       int64     `json:"file_size"`
+	AddedAt        time.Time `json:"added_at"`
+}
+
+// restoreCartFolder selects every catalog entry below a folder of a backup set
+type restoreCartFolder struct {
+	BackupSetID int64  `json:"backup_set_id"`
+	Path        string `json:"path"`
+}
+
+// restoreCartSelection is the body of requests adding or removing items
+type restoreCartSelection struct {
+	EntryIDs []int64             `json:"entry_ids"`
+	Folders  []restoreCartFolder `json:"folders"`
+}
+
+const restoreCartColumns = `c.id, c.name, c.owner_id, COALESCE(u.username, ''), c.status,
+	(SELECT COUNT(*) FROM restore_cart_items i WHERE i.cart_id = c.id),
+	(SELECT COALESCE(SUM(i.file_size), 0) FROM restore_cart_items i WHERE i.cart_id = c.id),
+	c.created_at, c.updated_at, c.submitted_at`
+
+func scanRestoreCart(row interface{ Scan(...interface{}) error }) (*restoreCart, error) {
+	var c restoreCart
+	var ownerID sql.NullInt64
+	var submittedAt sql.NullTime
+	err := row.Scan(&c.ID, &c.Name, &ownerID, &c.OwnerName, &c.Status, &c.FileCount, &c.TotalBytes,
+		&c.CreatedAt, &c.UpdatedAt, &submittedAt)
+	if err != nil {
+		return nil, err
+	}
+	if ownerID.Valid {
+		c.OwnerID = &ownerID.Int64
+	}
+	if submittedAt.Valid {
+		c.SubmittedAt = &submittedAt.Time
+	}
+	return &c, nil
+}
+
+func (s *Server) getRestoreCart(id int64) (*restoreCart, error) {
+	return scanRestoreCart(s.db.QueryRow(`
+		SELECT `+restoreCartColumns+` FROM restore_carts c LEFT JOIN users u ON c.owner_id = u.id
+		WHERE c.id = ?
+	`, id))
+}
+
+// loadRestoreCart loads the cart named by the id parameter. Carts belong to
+// the user who created them; other users but admins get a 404.
+func (s *Server) loadRestoreCart(w http.ResponseWriter, r *http.Request) (*restoreCart, bool) {
+	id, err := s.getIDParam(r)
+	if err != nil {
+		s.respondError(w, http.StatusBadRequest, "invalid cart id")
+		return nil, false
+	}
+	cart, err := s.getRestoreCart(id)
+	if err == nil {
+		claims, _ := r.Context().Value("claims").(*auth.Claims)
+		if claims != nil && (claims.Role == models.RoleAdmin || (cart.OwnerID != nil && *cart.OwnerID == claims.UserID)) {
+			return cart, true
+		}
+	}
+	s.respondError(w, http.StatusNotFound, "restore cart not found")
+	return nil, false
+}
+
+// loadOpenRestoreCart is loadRestoreCart for requests changing the items,
+// which submitted carts refuse
+func (s *Server) loadOpenRestoreCart(w http.ResponseWriter, r *http.Request) (*restoreCart, bool) {
+	cart, ok := s.loadRestoreCart(w, r)
+	if !ok {
+		return nil, false
+	}
+	if cart.Status != cartOpen {
+		s.respondError(w, http.StatusConflict, "restore cart has already been submitted")
+		return nil, false
+	}
+	return cart, true
+}
+
+// restoreCartDetails fills in the backup sets and tapes a cart's items need
+func (s *Server) restoreCartDetails(cart *restoreCart) error {
+	rows, err := s.db.Query(`
+		SELECT i.backup_set_id, COALESCE(bj.name, ''), COALESCE(bs.backup_type, ''), bs.start_time,
+			COUNT(*), COALESCE(SUM(i.file_size), 0)
+		FROM restore_cart_items i
+		LEFT JOIN backup_sets bs ON i.backup_set_id = bs.id
+		LEFT JOIN backup_jobs bj ON bs.job_id = bj.id
+		WHERE i.cart_id = ?
+		GROUP BY i.backup_set_id
+		ORDER BY bs.start_time, i.backup_set_id
+	`, cart.ID)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	cart.BackupSets = []restoreCartSet{}
+	for rows.Next() {
+		var set restoreCartSet
+		var startTime sql.NullTime
+		if err := rows.Scan(&set.BackupSetID, &set.JobName, &set.BackupType, &startTime, &set.FileCount, &set.TotalBytes); err != nil {
+			return err
+		}
+		if startTime.Valid {
+			set.StartTime = &startTime.Time
+		}
+		cart.BackupSets = append(cart.BackupSets, set)
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	// Deduplicated files are read from the set holding their data
+	tapeRows, err := s.db.Query(`
+		SELECT t.id, t.barcode, t.label, t.status, COUNT(*), COALESCE(SUM(i.file_size), 0)
+		FROM restore_cart_items i
+		JOIN catalog_entries ce ON ce.backup_set_id = i.backup_set_id AND ce.file_path = i.file_path
+		JOIN backup_sets bs ON bs.id = COALESCE(ce.ref_backup_set_id, ce.backup_set_id)
+		JOIN tapes t ON bs.tape_id = t.id
+		WHERE i.cart_id = ?
+		GROUP BY t.id
+		ORDER BY MIN(bs.start_time), t.label
+	`, cart.ID)
+	if err != nil {
+		return err
+	}
+	defer tapeRows.Close()
+	cart.RequiredTapes = []restore.TapeRequirement{}
+	for tapeRows.Next() {
+		var req restore.TapeRequirement
+		var fileCount int64
+		if err := tapeRows.Scan(&req.Tape.ID, &req.Tape.Barcode, &req.Tape.Label, &req.Tape.Status, &fileCount, &req.TotalBytes); err != nil {
+			return err
+		}
+		req.FileCount = int(fileCount)
+		req.Order = len(cart.RequiredTapes) + 1
+		cart.RequiredTapes = append(cart.RequiredTapes, req)
+	}
+	if err := tapeRows.Err(); err != nil {
+		return err
+	}
+
+	return s.db.QueryRow(`
+		SELECT COUNT(*) FROM restore_cart_items i
+		WHERE i.cart_id = ? AND NOT EXISTS (
+			SELECT 1 FROM catalog_entries ce WHERE ce.backup_set_id = i.backup_set_id AND ce.file_path = i.file_path
+		)
+	`, cart.ID).Scan(&cart.MissingEntries)
+}
+
+// respondRestoreCart responds with a cart, its totals and tape requirements
+func (s *Server) respondRestoreCart(w http.ResponseWriter, status int, id int64) {
+	cart, err := s.getRestoreCart(id)
+	if err == nil {
+		err = s.restoreCartDetails(cart)
+	}
+	if err != nil {
+		s.respondError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	s.respondJSON(w, status, cart)
+}
+
+// handleListRestoreCarts lists the caller's restore carts, or every cart for
+// admins, newest first
+func (s *Server) handleListRestoreCarts(w http.ResponseWriter, r *http.Request) {
+	claims, _ := r.Context().Value("claims").(*auth.Claims)
+	if claims == nil {
+		s.respondError(w, http.StatusUnauthorized, "missing authentication")
+		return
+	}
+	query := "SELECT " + restoreCartColumns + " FROM restore_carts c LEFT JOIN users u ON c.owner_id = u.id"
+	var conditions []string
+	var args []interface{}
+	if claims.Role != models.RoleAdmin {
+		conditions = append(conditions, "c.owner_id = ?")
+		args = append(args, claims.UserID)
+	}
+	if status := r.URL.Query().Get("status"); status != "" {
+		conditions = append(conditions, "c.status = ?")
+		args = append(args, status)
+	}
+	if len(conditions) > 0 {
+		query += " WHERE " + strings.Join(conditions, " AND ")
+	}
+	query += " ORDER BY c.id DESC LIMIT 500"
+
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		s.respondError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	defer rows.Close()
+
+	carts := []*restoreCart{}
+	for rows.Next() {
+		cart, err := scanRestoreCart(rows)
+		if err != nil {
+			continue
+		}
+		carts = append(carts, cart)
+	}
+	s.respondJSON(w, http.StatusOK, carts)
+}
+
+// handleCreateRestoreCart creates an empty cart owned by the caller
+func (s *Server) handleCreateRestoreCart(w http.ResponseWriter, r *http.Request) {
+	claims, _ := r.Context().Value("claims").(*auth.Claims)
+	if claims == nil {
+		s.respondError(w, http.StatusUnauthorized, "missing authentication")
+		return
+	}
+	var req struct {
+		Name string `json:"name"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		s.respondError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+	req.Name = strings.TrimSpace(req.Name)
+	if req.Name == "" {
+		s.respondError(w, http.StatusBadRequest, "name is required")
+		return
+	}
+
+	result, err := s.db.Exec("INSERT INTO restore_carts (name, owner_id) VALUES (?, ?)", req.Name, claims.UserID)
+	if err != nil {
+		s.respondError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	id, _ := result.LastInsertId()
+
+	s.auditLog(r, "create", "restore_cart", id, "Created restore cart "+req.Name)
+	w.Header().Set("Location", fmt.Sprintf("/api/v1/restore/carts/%d", id))
+	s.respondRestoreCart(w, http.StatusCreated, id)
+}
+
+// handleGetRestoreCart returns a cart with its running totals, the backup
+// sets its items come from and the tapes a restore of them needs
+func (s *Server) handleGetRestoreCart(w http.ResponseWriter, r *http.Request) {
+	cart, ok := s.loadRestoreCart(w, r)
+	if !ok {
+		return
+	}
+	s.respondRestoreCart(w, http.StatusOK, cart.ID)
+}
+
+// handleRenameRestoreCart renames a cart
+func (s *Server) handleRenameRestoreCart(w http.ResponseWriter, r *http.Request) {
+	cart, ok := s.loadRestoreCart(w, r)
+	if !ok {
+		return
+	}
+	var req struct {
+		Name string `json:"name"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		s.respondError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+	req.Name = strings.TrimSpace(req.Name)
+	if req.Name == "" {
+		s.respondError(w, http.StatusBadRequest, "name is required")
+		return
+	}
+	if _, err := s.db.Exec("UPDATE restore_carts SET name = ?, updated_at = CURRENT_TIMESTAMP WHERE id = ?", req.Name, cart.ID); err != nil {
+		s.respondError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	s.respondRestoreCart(w, http.StatusOK, cart.ID)
+}
+
+// handleDeleteRestoreCart deletes a cart and its items
+func (s *Server) handleDeleteRestoreCart(w http.ResponseWriter, r *http.Request) {
+	cart, ok := s.loadRestoreCart(w, r)
+	if !ok {
+		return
+	}
+	if _, err := s.db.Exec("DELETE FROM restore_cart_items WHERE cart_id = ?", cart.ID); err != nil {
+		s.respondError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if _, err := s.db.Exec("DELETE FROM restore_carts WHERE id = ?", cart.ID); err != nil {
+		s.respondError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	s.auditLog(r, "delete", "restore_cart", cart.ID, "Deleted restore cart "+cart.Name)
+	s.respondJSON(w, http.StatusOK, map[string]string{"message": "restore cart deleted"})
+}
+
+// handleListRestoreCartItems lists a cart's items by backup set and path
+func (s *Server) handleListRestoreCartItems(w http.ResponseWriter, r *http.Request) {
+	cart, ok := s.loadRestoreCart(w, r)
+	if !ok {
+		return
+	}
+	limit, offset := defaultCartItemLimit, 0
+	if l, err := strconv.Atoi(r.URL.Query().Get("limit")); err == nil && l > 0 {
+		limit = l
+	}
+	if o, err := strconv.Atoi(r.URL.Query().Get("offset")); err == nil && o > 0 {
+		offset = o
+	}
+	query := "SELECT id, catalog_entry_id, backup_set_id, file_path, file_size, added_at FROM restore_cart_items WHERE cart_id = ?"
+	args := []interface{}{cart.ID}
+	if v := r.URL.Query().Get("backup_set_id"); v != "" {
+		setID, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			s.respondError(w, http.StatusBadRequest, "invalid backup_set_id")
+			return
+		}
+		query += " AND backup_set_id = ?"
+		args = append(args, setID)
+	}
+	query += " ORDER BY backup_set_id, file_path LIMIT ? OFFSET ?"
+	args = append(args, limit, offset)
+
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		s.respondError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	defer rows.Close()
+
+	items := []restoreCartItem{}
+	for rows.Next() {
+		var item restoreCartItem
+		if err := rows.Scan(&item.ID, &item.CatalogEntryID, &item.BackupSetID, &item.FilePath, &item.FileSize, &item.AddedAt); err != nil {
+			continue
+		}
+		items = append(items, item)
+	}
+	s.respondJSON(w, http.StatusOK, items)
+}
+
+// decodeRestoreCartSelection reads the entries and folders of a request
+// adding or removing items
+func decodeRestoreCartSelection(r *http.Request) (*restoreCartSelection, error) {
+	var sel restoreCartSelection
+	if err := json.NewDecoder(r.Body).Decode(&sel); err != nil {
+		return nil, fmt.Errorf("invalid request body")
+	}
+	if len(sel.EntryIDs) == 0 && len(sel.Folders) == 0 {
+		return nil, fmt.Errorf("entry_ids or folders is required")
+	}
+	if len(sel.EntryIDs) > maxCartEntriesPerRequest {
+		return nil, fmt.Errorf("at most %d entry_ids can be sent at once", maxCartEntriesPerRequest)
+	}
+	for i, f := range sel.Folders {
+		path := strings.TrimSuffix(f.Path, "/")
+		if f.BackupSetID <= 0 || path == "" {
+			return nil, fmt.Errorf("folders need a backup_set_id and a path")
+		}
+		sel.Folders[i].Path = path
+	}
+	return &sel, nil
+}
+
+// handleAddRestoreCartItems adds catalog entries, and every entry below the
+// given folders, to a cart. Entries already in the cart are left as they are.
+func (s *Server) handleAddRestoreCartItems(w http.ResponseWriter, r *http.Request) {
+	cart, ok := s.loadOpenRestoreCart(w, r)
+	if !ok {
+		return
+	}
+	sel, err := decodeRestoreCartSelection(r)
+	if err != nil {
+		s.respondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		s.respondError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	defer tx.Rollback()
+
+	for _, id := range sel.EntryIDs {
+		var setStatus string
+		err := tx.QueryRow(`
+			SELECT bs.status FROM catalog_entries ce JOIN backup_sets bs ON ce.backup_set_id = bs.id
+			WHERE ce.id = ?
+		`, id).Scan(&setStatus)
+		if err != nil {
+			s.respondError(w, http.StatusBadRequest, fmt.Sprintf("catalog entry %d not found", id))
+			return
+		}
+		if setStatus != string(models.BackupSetStatusCompleted) {
+			s.respondError(w, http.StatusBadRequest, fmt.Sprintf("catalog entry %d belongs to a %s backup set", id, setStatus))
+			return
+		}
+		_, err = tx.Exec(`
+			INSERT OR IGNORE INTO restore_cart_items (cart_id, catalog_entry_id, backup_set_id, file_path, file_size)
+			SELECT ?, id, backup_set_id, file_path, file_size FROM catalog_entries WHERE id = ?
+		`, cart.ID, id)
+		if err != nil {
+			s.respondError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+	}
+	for _, f := range sel.Folders {
+		var setStatus string
+		if err := tx.QueryRow("SELECT status FROM backup_sets WHERE id = ?", f.BackupSetID).Scan(&setStatus); err != nil {
+			s.respondError(w, http.StatusBadRequest, fmt.Sprintf("backup set %d not found", f.BackupSetID))
+			return
+		}
+		if setStatus != string(models.BackupSetStatusCompleted) {
+			s.respondError(w, http.StatusBadRequest, fmt.Sprintf("backup set %d is %s", f.BackupSetID, setStatus))
+			return
+		}
+		_, err := tx.Exec(`
+			INSERT OR IGNORE INTO restore_cart_items (cart_id, catalog_entry_id, backup_set_id, file_path, file_size)
+			SELECT ?, id, backup_set_id, file_path, file_size FROM catalog_entries
+			WHERE backup_set_id = ? AND file_path LIKE ?
+		`, cart.ID, f.BackupSetID, f.Path+"/%")
+		if err != nil {
+			s.respondError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+	}
+	tx.Exec("UPDATE restore_carts SET updated_at = CURRENT_TIMESTAMP WHERE id = ?", cart.ID)
+	if err := tx.Commit(); err != nil {
+		s.respondError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	s.respondRestoreCart(w, http.StatusOK, cart.ID)
+}
+
+// handleRemoveRestoreCartItems removes catalog entries, and every entry
+// below the given folders, from a cart
+func (s *Server) handleRemoveRestoreCartItems(w http.ResponseWriter, r *http.Request) {
+	cart, ok := s.loadOpenRestoreCart(w, r)
+	if !ok {
+		return
+	}
+	sel, err := decodeRestoreCartSelection(r)
+	if err != nil {
+		s.respondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		s.respondError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	defer tx.Rollback()
+
+	for _, id := range sel.EntryIDs {
+		if _, err := tx.Exec("DELETE FROM restore_cart_items WHERE cart_id = ? AND catalog_entry_id = ?", cart.ID, id); err != nil {
+			s.respondError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+	}
+	for _, f := range sel.Folders {
+		if _, err := tx.Exec("DELETE FROM restore_cart_items WHERE cart_id = ? AND backup_set_id = ? AND file_path LIKE ?", cart.ID, f.BackupSetID, f.Path+"/%"); err != nil {
+			s.respondError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+	}
+	tx.Exec("UPDATE restore_carts SET updated_at = CURRENT_TIMESTAMP WHERE id = ?", cart.ID)
+	if err := tx.Commit(); err != nil {
+		s.respondError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	s.respondRestoreCart(w, http.StatusOK, cart.ID)
+}
+
+// handleClearRestoreCart removes every item from a cart
+func (s *Server) handleClearRestoreCart(w http.ResponseWriter, r *http.Request) {
+	cart, ok := s.loadOpenRestoreCart(w, r)
+	if !ok {
+		return
+	}
+	if _, err := s.db.Exec("DELETE FROM restore_cart_items WHERE cart_id = ?", cart.ID); err != nil {
+		s.respondError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	s.db.Exec("UPDATE restore_carts SET updated_at = CURRENT_TIMESTAMP WHERE id = ?", cart.ID)
+	s.respondRestoreCart(w, http.StatusOK, cart.ID)
+}
+
+// handleSubmitRestoreCart freezes a cart and turns it into a restore plan:
+// one restore request per backup set, all with the given destination, and
+// the tapes they need in the order to insert them. Each request is then run
+// through the restore endpoint. Items whose catalog entry has been pruned
+// since they were added are left out.
+func (s *Server) handleSubmitRestoreCart(w http.ResponseWriter, r *http.Request) {
+	cart, ok := s.loadOpenRestoreCart(w, r)
+	if !ok {
+		return
+	}
+	var req struct {
+		DestPath        string                `json:"dest_path"`
+		DestinationType string                `json:"destination_type"`
+		TargetID        *int64                `json:"target_id,omitempty"`
+		Verify          bool                  `json:"verify"`
+		Overwrite       bool                  `json:"overwrite"`
+		DriveID         *int64                `json:"drive_id,omitempty"`
+		RateLimitMBps   *int                  `json:"rate_limit_mbps,omitempty"`
+		Priority        int                   `json:"priority,omitempty"`
+		PathRewrites    []restore.PathRewrite `json:"path_rewrites,omitempty"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		s.respondError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+	if req.DestPath == "" {
+		s.respondError(w, http.StatusBadRequest, "dest_path is required")
+		return
+	}
+	if req.TargetID == nil && models.RestoreDestinationType(req.DestinationType).IsRemote() {
+		s.respondError(w, http.StatusBadRequest, "target_id is required for remote destinations")
+		return
+	}
+	if req.RateLimitMBps != nil && *req.RateLimitMBps < 0 {
+		s.respondError(w, http.StatusBadRequest, "rate_limit_mbps cannot be negative")
+		return
+	}
+	if err := restore.ValidatePathRewrites(req.PathRewrites); err != nil {
+		s.respondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if msg := s.checkRestoreDestination(r, req.TargetID); msg != "" {
+		s.respondError(w, http.StatusForbidden, msg)
+		return
+	}
+
+	rows, err := s.db.Query(`
+		SELECT i.backup_set_id, i.file_path FROM restore_cart_items i
+		WHERE i.cart_id = ? AND EXISTS (
+			SELECT 1 FROM catalog_entries ce WHERE ce.backup_set_id = i.backup_set_id AND ce.file_path = i.file_path
+		)
+		ORDER BY i.backup_set_id, i.file_path
+	`, cart.ID)
+	if err != nil {
+		s.respondError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	var restores []*restore.RestoreRequest
+	for rows.Next() {
+		var setID int64
+		var path string
+		if err := rows.Scan(&setID, &path); err != nil {
+			continue
+		}
+		if len(restores) == 0 || restores[len(restores)-1].BackupSetID != setID {
+			restores = append(restores, &restore.RestoreRequest{
+				BackupSetID:     setID,
+				DestPath:        req.DestPath,
+				DestinationType: req.DestinationType,
+				TargetID:        req.TargetID,
+				Verify:          req.Verify,
+				Overwrite:       req.Overwrite,
+				DriveID:         req.DriveID,
+				RateLimitMBps:   req.RateLimitMBps,
+				Priority:        req.Priority,
+				PathRewrites:    req.PathRewrites,
+			})
+		}
+		current := restores[len(restores)-1]
+		current.FilePaths = append(current.FilePaths, path)
+	}
+	rows.Close()
+	if len(restores) == 0 {
+		s.respondError(w, http.StatusBadRequest, "restore cart has no restorable items")
+		return
+	}
+
+	// Only the first of concurrent submissions goes through
+	result, err := s.db.Exec(`
+		UPDATE restore_carts SET status = ?, submitted_at = CURRENT_TIMESTAMP, updated_at = CURRENT_TIMESTAMP
+		WHERE id = ? AND status = ?
+	`, cartSubmitted, cart.ID, cartOpen)
+	if err != nil {
+		s.respondError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		s.respondError(w, http.StatusConflict, "restore cart has already been submitted")
+		return
+	}
+
+	submitted, err := s.getRestoreCart(cart.ID)
+	if err == nil {
+		err = s.restoreCartDetails(submitted)
+	}
+	if err != nil {
+		s.respondError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	s.auditLog(r, "submit", "restore_cart", cart.ID, fmt.Sprintf("Submitted restore cart %s: %d files from %d backup sets to %s",
+		cart.Name, submitted.FileCount-submitted.MissingEntries, len(restores), req.DestPath))
+	s.respondJSON(w, http.StatusOK, map[string]interface{}{
+		"cart":           submitted,
+		"restores":       restores,
+		"required_tapes": submitted.RequiredTapes,
+		"message":        "Insert the tapes in the order shown and run each restore",
+	})
+}
@@ -0,0 +1,157 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/RoseOO/TapeBackarr/internal/backup"
+	"github.com/RoseOO/TapeBackarr/internal/restore"
+)
+
+// preemptedRunStopTimeout bounds the wait for a preempted backup run to
+// finish stopping before it is resumed
+const preemptedRunStopTimeout = 5 * time.Minute
+
+// restorePriorityDrive returns the drive a restore with a priority needs:
+// the drive it names, else the drive holding its tape. When neither applies
+// and no enabled drive is free, it is the drive held by the backup run with
+// the lowest priority, which the restore is then pinned to. "" means the
+// restore can use a free drive.
+func (s *Server) restorePriorityDrive(req *restore.RestoreRequest) string {
+	var devicePath string
+	if req.DriveID != nil {
+		s.db.QueryRow("SELECT device_path FROM tape_drives WHERE id = ? AND enabled = 1", *req.DriveID).Scan(&devicePath)
+		return devicePath
+	}
+	err := s.db.QueryRow(`
+		SELECT d.device_path FROM backup_sets bs
+		JOIN tape_drives d ON d.current_tape_id = bs.tape_id AND COALESCE(d.enabled, 1) = 1
+		WHERE bs.id = ?
+	`, req.BackupSetID).Scan(&devicePath)
+	if err == nil {
+		return devicePath
+	}
+
+	var free int
+	s.db.QueryRow("SELECT COUNT(*) FROM tape_drives WHERE COALESCE(enabled, 1) = 1 AND reserved_job_id IS NULL").Scan(&free)
+	if free > 0 {
+		return ""
+	}
+	var driveID int64
+	err = s.db.QueryRow(`
+		SELECT d.id, d.device_path FROM tape_drives d
+		JOIN backup_jobs j ON j.id = d.reserved_job_id
+		WHERE COALESCE(d.enabled, 1) = 1
+		ORDER BY COALESCE(j.priority, 0), d.reserved_at DESC
+		LIMIT 1
+	`).Scan(&driveID, &devicePath)
+	if err != nil {
+		return ""
+	}
+	req.DriveID = &driveID
+	return devicePath
+}
+
+// holdRestoreDrive holds the drive a restore with a priority needs for the
+// length of the restore, stopping a backup run of lower priority that holds
+// it. Restores without a priority do not wait for drives. The run stopped,
+// if any, is returned even when the hold fails, and must be resumed with
+// resumePreemptedRun.
+func (s *Server) holdRestoreDrive(ctx context.Context, req *restore.RestoreRequest) (func(), *backup.PreemptedRun, error) {
+	noop := func() {}
+	if req.Priority <= 0 {
+		return noop, nil, nil
+	}
+	devicePath := s.restorePriorityDrive(req)
+	if devicePath == "" {
+		return noop, nil, nil
+	}
+	release, run, err := s.backupService.HoldDriveForRestore(ctx, devicePath, req.Priority)
+	if run != nil {
+		if s.logger != nil {
+			s.logger.Info("Backup run stopped for a restore with higher priority", map[string]interface{}{
+				"job_id":        run.JobID,
+				"device_path":   devicePath,
+				"backup_set_id": req.BackupSetID,
+			})
+		}
+		if s.eventBus != nil {
+			s.eventBus.Publish(SystemEvent{
+				Type:     "warning",
+				Category: "backup",
+				Key:      "backup_preempted_for_restore",
+				Args:     []interface{}{run.JobName, devicePath, req.BackupSetID},
+				Details:  map[string]interface{}{"job_id": run.JobID, "backup_set_id": req.BackupSetID, "priority": req.Priority},
+			})
+		}
+	}
+	if err != nil {
+		return noop, run, err
+	}
+	return release, run, nil
+}
+
+// resumePreemptedRun resumes a backup run stopped for a restore once it has
+// finished stopping. It resumes on the tape it was writing when it can,
+// and on a tape from the job's pool otherwise.
+func (s *Server) resumePreemptedRun(run *backup.PreemptedRun) {
+	failed := func(err error) {
+		if s.logger != nil {
+			s.logger.Warn("Failed to resume backup run after restore", map[string]interface{}{"job_id": run.JobID, "error": err.Error()})
+		}
+		if s.eventBus != nil {
+			s.eventBus.Publish(SystemEvent{
+				Type:     "error",
+				Category: "backup",
+				Key:      "backup_resume_after_restore_failed",
+				Args:     []interface{}{run.JobName, err.Error()},
+				Details:  map[string]interface{}{"job_id": run.JobID},
+			})
+		}
+	}
+
+	deadline := time.Now().Add(preemptedRunStopTimeout)
+	for s.backupService.IsJobActive(run.JobID) {
+		if time.Now().After(deadline) {
+			failed(fmt.Errorf("the stopped run did not finish"))
+			return
+		}
+		time.Sleep(time.Second)
+	}
+
+	job, source, err := s.loadRetryJob(run.JobID)
+	if err != nil {
+		failed(err)
+		return
+	}
+	tapeID := run.TapeID
+	if tapeID != 0 {
+		if err := s.backupService.ReserveTape(tapeID, job.ID); err != nil {
+			tapeID = 0
+		} else if err := s.backupService.CheckTapeWritable(tapeID); err != nil {
+			s.releaseUnusedTape(tapeID, job.ID)
+			tapeID = 0
+		}
+	}
+	if tapeID == 0 {
+		if tapeID, _, err = s.reserveTapeFromPool(job.PoolID, job.RetentionDays, job.ID); err != nil {
+			failed(err)
+			return
+		}
+	}
+	var tapeLabel string
+	s.db.QueryRow("SELECT label FROM tapes WHERE id = ?", tapeID).Scan(&tapeLabel)
+
+	s.startRetryRun(job, source, tapeID, s.jobResumeState(job.ID))
+	s.auditLogDirect(nil, "", "resume", "backup_job", job.ID, fmt.Sprintf("Resumed backup job %s on tape %s after a restore", job.Name, tapeLabel))
+	if s.eventBus != nil {
+		s.eventBus.Publish(SystemEvent{
+			Type:     "info",
+			Category: "backup",
+			Key:      "backup_resumed_after_restore",
+			Args:     []interface{}{job.Name, tapeLabel},
+			Details:  map[string]interface{}{"job_id": job.ID, "tape_id": tapeID},
+		})
+	}
+}
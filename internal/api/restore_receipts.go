@@ -0,0 +1,137 @@
+package api
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/RoseOO/TapeBackarr/internal/auth"
+	"github.com/RoseOO/TapeBackarr/internal/restore"
+)
+
+// storeRestoreReceipt records a signed receipt of a restore attempt and
+// returns its UUID, or "" if it could not be stored
+func (s *Server) storeRestoreReceipt(r *http.Request, req *restore.RestoreRequest, result *restore.RestoreResult, restoreErr error, started time.Time, keyFingerprint string) string {
+	in := restore.ReceiptInput{
+		Request:        req,
+		Result:         result,
+		Err:            restoreErr,
+		IPAddress:      clientIP(r),
+		StartedAt:      started,
+		KeyFingerprint: keyFingerprint,
+	}
+	if claims, ok := r.Context().Value("claims").(*auth.Claims); ok {
+		in.UserID = claims.UserID
+		in.Username = claims.Username
+	}
+	// The receipt is written even if the client has gone away
+	receipt, err := s.restoreService.CreateReceipt(context.WithoutCancel(r.Context()), in)
+	if err != nil {
+		if s.logger != nil {
+			s.logger.Warn("Failed to store restore receipt", map[string]interface{}{
+				"backup_set_id": req.BackupSetID,
+				"error":         err.Error(),
+			})
+		}
+		return ""
+	}
+	return receipt.UUID
+}
+
+// handleListRestoreReceipts lists restore receipts, newest first
+func (s *Server) handleListRestoreReceipts(w http.ResponseWriter, r *http.Request) {
+	limit, offset := 100, 0
+	if l, err := strconv.Atoi(r.URL.Query().Get("limit")); err == nil && l > 0 {
+		limit = l
+	}
+	if o, err := strconv.Atoi(r.URL.Query().Get("offset")); err == nil && o > 0 {
+		offset = o
+	}
+	var setID int64
+	if v := r.URL.Query().Get("backup_set_id"); v != "" {
+		id, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			s.respondError(w, http.StatusBadRequest, "invalid backup_set_id")
+			return
+		}
+		setID = id
+	}
+
+	receipts, err := s.restoreService.ListReceipts(setID, limit, offset)
+	if err != nil {
+		s.respondError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	s.respondJSON(w, http.StatusOK, receipts)
+}
+
+// handleGetRestoreReceipt returns a receipt with its signature as JSON
+func (s *Server) handleGetRestoreReceipt(w http.ResponseWriter, r *http.Request) {
+	receipt, ok := s.loadRestoreReceipt(w, r)
+	if !ok {
+		return
+	}
+	if r.URL.Query().Get("download") == "true" {
+		w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=restore-receipt-%s.json", receipt.UUID))
+	}
+	s.auditLog(r, "export", "restore_receipt", receipt.ID, "Exported restore receipt "+receipt.UUID+" as JSON")
+	s.respondJSON(w, http.StatusOK, receipt)
+}
+
+// handleGetRestoreReceiptPDF returns a receipt as a printable PDF
+func (s *Server) handleGetRestoreReceiptPDF(w http.ResponseWriter, r *http.Request) {
+	receipt, ok := s.loadRestoreReceipt(w, r)
+	if !ok {
+		return
+	}
+	pdf, err := receipt.PDF()
+	if err != nil {
+		s.respondError(w, http.StatusInternalServerError, "failed to render receipt: "+err.Error())
+		return
+	}
+	s.auditLog(r, "export", "restore_receipt", receipt.ID, "Exported restore receipt "+receipt.UUID+" as PDF")
+	w.Header().Set("Content-Type", "application/pdf")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=restore-receipt-%s.pdf", receipt.UUID))
+	w.WriteHeader(http.StatusOK)
+	w.Write(pdf)
+}
+
+// handleRestoreReceiptKey returns the public key receipts are signed with
+func (s *Server) handleRestoreReceiptKey(w http.ResponseWriter, r *http.Request) {
+	key, err := s.restoreService.ReceiptPublicKey()
+	if err != nil {
+		s.respondError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	s.respondJSON(w, http.StatusOK, map[string]string{
+		"algorithm":  restore.ReceiptAlgorithm,
+		"public_key": key,
+	})
+}
+
+// loadRestoreReceipt loads the receipt named by the id parameter and checks
+// that it still matches its signature
+func (s *Server) loadRestoreReceipt(w http.ResponseWriter, r *http.Request) (*restore.StoredReceipt, bool) {
+	id, err := s.getIDParam(r)
+	if err != nil {
+		s.respondError(w, http.StatusBadRequest, "invalid receipt id")
+		return nil, false
+	}
+	receipt, err := s.restoreService.GetReceipt(id)
+	if err == sql.ErrNoRows {
+		s.respondError(w, http.StatusNotFound, "receipt not found")
+		return nil, false
+	}
+	if err != nil {
+		s.respondError(w, http.StatusInternalServerError, err.Error())
+		return nil, false
+	}
+	if _, err := receipt.Verify(); err != nil {
+		s.respondError(w, http.StatusConflict, "stored receipt failed verification: "+err.Error())
+		return nil, false
+	}
+	return receipt, true
+}
@@ -0,0 +1,268 @@
+package api
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/RoseOO/TapeBackarr/internal/models"
+	"github.com/RoseOO/TapeBackarr/internal/restore"
+)
+
+// restoreTargetColumns is the column list shared by restore target queries.
+const restoreTargetColumns = `id, name, target_type, host, port, share, base_path, username, domain,
+	secret, mount_options, enabled, created_at, updated_at, credential_id`
+
+func scanRestoreTarget(row interface{ Scan(...interface{}) error }) (*models.RestoreTarget, error) {
+	var t models.RestoreTarget
+	if err := row.Scan(&t.ID, &t.Name, &t.TargetType, &t.Host, &t.Port, &t.Share, &t.BasePath,
+		&t.Username, &t.Domain, &t.Secret, &t.MountOptions, &t.Enabled, &t.CreatedAt, &t.UpdatedAt, &t.CredentialID); err != nil {
+		return nil, err
+	}
+	t.HasSecret = t.Secret != "" || t.CredentialID != nil
+	return &t, nil
+}
+
+func (s *Server) handleListRestoreTargets(w http.ResponseWriter, r *http.Request) {
+	rows, err := s.db.Query("SELECT " + restoreTargetColumns + " FROM restore_targets ORDER BY name")
+	if err != nil {
+		s.respondError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	defer rows.Close()
+
+	targets := []models.RestoreTarget{}
+	for rows.Next() {
+		t, err := scanRestoreTarget(rows)
+		if err != nil {
+			continue
+		}
+		targets = append(targets, *t)
+	}
+
+	s.respondJSON(w, http.StatusOK, targets)
+}
+
+func (s *Server) handleGetRestoreTarget(w http.ResponseWriter, r *http.Request) {
+	id, err := s.getIDParam(r)
+	if err != nil {
+		s.respondError(w, http.StatusBadRequest, "invalid restore target id")
+		return
+	}
+
+	t, err := scanRestoreTarget(s.db.QueryRow("SELECT "+restoreTargetColumns+" FROM restore_targets WHERE id = ?", id))
+	if err != nil {
+		s.respondError(w, http.StatusNotFound, "restore target not found")
+		return
+	}
+
+	s.respondJSON(w, http.StatusOK, t)
+}
+
+func (s *Server) handleCreateRestoreTarget(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Name         string                        `json:"name"`
+		TargetType   models.RestoreDestinationType `json:"target_type"`
+		Host         string                        `json:"host"`
+		Port         int                           `json:"port"`
+		Share        string                        `json:"share"`
+		BasePath     string                        `json:"base_path"`
+		Username     string                        `json:"username"`
+		Domain       string                        `json:"domain"`
+		Secret       string                        `json:"secret"`
+		MountOptions string                        `json:"mount_options"`
+		CredentialID *int64                        `json:"credential_id"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		s.respondError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+
+	t := &models.RestoreTarget{
+		Name:         strings.TrimSpace(req.Name),
+		TargetType:   req.TargetType,
+		Host:         strings.TrimSpace(req.Host),
+		Port:         req.Port,
+		Share:        req.Share,
+		BasePath:     req.BasePath,
+		Username:     req.Username,
+		Domain:       req.Domain,
+		Secret:       req.Secret,
+		MountOptions: req.MountOptions,
+		CredentialID: req.CredentialID,
+	}
+	if err := restore.ValidateTarget(t); err != nil {
+		s.respondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if msg := s.checkCredentialRef(t.CredentialID); msg != "" {
+		s.respondError(w, http.StatusBadRequest, msg)
+		return
+	}
+
+	result, err := s.db.Exec(`
+		INSERT INTO restore_targets (name, target_type, host, port, share, base_path, username, domain, secret, mount_options, credential_id, enabled)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, 1)
+	`, t.Name, t.TargetType, t.Host, t.Port, t.Share, t.BasePath, t.Username, t.Domain, t.Secret, t.MountOptions, t.CredentialID)
+	if err != nil {
+		if strings.Contains(err.Error(), "UNIQUE") {
+			s.respondErrorCode(w, http.StatusConflict, codeAlreadyExists, "a restore target with this name already exists", nil)
+			return
+		}
+		s.respondError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	id, _ := result.LastInsertId()
+	s.auditLog(r, "create", "restore_target", id, fmt.Sprintf("Created %s restore target '%s'", t.TargetType, t.Name))
+
+	s.respondJSON(w, http.StatusCreated, map[string]int64{"id": id})
+}
+
+func (s *Server) handleUpdateRestoreTarget(w http.ResponseWriter, r *http.Request) {
+	id, err := s.getIDParam(r)
+	if err != nil {
+		s.respondError(w, http.StatusBadRequest, "invalid restore target id")
+		return
+	}
+
+	var req struct {
+		Name         *string `json:"name"`
+		Host         *string `json:"host"`
+		Port         *int    `json:"port"`
+		Share        *string `json:"share"`
+		BasePath     *string `json:"base_path"`
+		Username     *string `json:"username"`
+		Domain       *string `json:"domain"`
+		Secret       *string `json:"secret"`
+		MountOptions *string `json:"mount_options"`
+		Enabled      *bool   `json:"enabled"`
+		// 0 removes the reference to a stored credential
+		CredentialID *int64 `json:"credential_id"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		s.respondError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+
+	t, err := scanRestoreTarget(s.db.QueryRow("SELECT "+restoreTargetColumns+" FROM restore_targets WHERE id = ?", id))
+	if err == sql.ErrNoRows {
+		s.respondError(w, http.StatusNotFound, "restore target not found")
+		return
+	}
+	if err != nil {
+		s.respondError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	if req.Name != nil {
+		t.Name = strings.TrimSpace(*req.Name)
+	}
+	if req.Host != nil {
+		t.Host = strings.TrimSpace(*req.Host)
+	}
+	if req.Port != nil {
+		t.Port = *req.Port
+	}
+	if req.Share != nil {
+		t.Share = *req.Share
+	}
+	if req.BasePath != nil {
+		t.BasePath = *req.BasePath
+	}
+	if req.Username != nil {
+		t.Username = *req.Username
+	}
+	if req.Domain != nil {
+		t.Domain = *req.Domain
+	}
+	if req.Secret != nil {
+		t.Secret = *req.Secret
+	}
+	if req.MountOptions != nil {
+		t.MountOptions = *req.MountOptions
+	}
+	if req.Enabled != nil {
+		t.Enabled = *req.Enabled
+	}
+	if req.CredentialID != nil {
+		t.CredentialID = req.CredentialID
+		if *req.CredentialID == 0 {
+			t.CredentialID = nil
+		}
+	}
+	if err := restore.ValidateTarget(t); err != nil {
+		s.respondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if msg := s.checkCredentialRef(t.CredentialID); msg != "" {
+		s.respondError(w, http.StatusBadRequest, msg)
+		return
+	}
+
+	_, err = s.db.Exec(`
+		UPDATE restore_targets SET name = ?, host = ?, port = ?, share = ?, base_path = ?, username = ?,
+			domain = ?, secret = ?, mount_options = ?, credential_id = ?, enabled = ?, updated_at = CURRENT_TIMESTAMP
+		WHERE id = ?
+	`, t.Name, t.Host, t.Port, t.Share, t.BasePath, t.Username, t.Domain, t.Secret, t.MountOptions, t.CredentialID, t.Enabled, id)
+	if err != nil {
+		if strings.Contains(err.Error(), "UNIQUE") {
+			s.respondErrorCode(w, http.StatusConflict, codeAlreadyExists, "a restore target with this name already exists", nil)
+			return
+		}
+		s.respondError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	details := fmt.Sprintf("Updated restore target '%s'", t.Name)
+	if req.Secret != nil || req.CredentialID != nil {
+		details += " (credentials changed)"
+	}
+	s.auditLog(r, "update", "restore_target", id, details)
+
+	s.respondJSON(w, http.StatusOK, map[string]string{"status": "updated"})
+}
+
+func (s *Server) handleDeleteRestoreTarget(w http.ResponseWriter, r *http.Request) {
+	id, err := s.getIDParam(r)
+	if err != nil {
+		s.respondError(w, http.StatusBadRequest, "invalid restore target id")
+		return
+	}
+
+	var name string
+	if err := s.db.QueryRow("SELECT name FROM restore_targets WHERE id = ?", id).Scan(&name); err != nil {
+		s.respondError(w, http.StatusNotFound, "restore target not found")
+		return
+	}
+
+	if _, err := s.db.Exec("DELETE FROM restore_targets WHERE id = ?", id); err != nil {
+		s.respondError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	s.auditLog(r, "delete", "restore_target", id, fmt.Sprintf("Deleted restore target '%s'", name))
+
+	s.respondJSON(w, http.StatusOK, map[string]string{"status": "deleted"})
+}
+
+func (s *Server) handleTestRestoreTarget(w http.ResponseWriter, r *http.Request) {
+	id, err := s.getIDParam(r)
+	if err != nil {
+		s.respondError(w, http.StatusBadRequest, "invalid restore target id")
+		return
+	}
+	if s.restoreService == nil {
+		s.respondError(w, http.StatusServiceUnavailable, "restore service not available")
+		return
+	}
+
+	if err := s.restoreService.TestTarget(r.Context(), id); err != nil {
+		s.respondJSON(w, http.StatusOK, map[string]interface{}{"success": false, "error": err.Error()})
+		return
+	}
+
+	s.respondJSON(w, http.StatusOK, map[string]interface{}{"success": true})
+}
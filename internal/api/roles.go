@@ -0,0 +1,93 @@
+package api
+
+import (
+	"net/http"
+	"regexp"
+
+	"github.com/RoseOO/TapeBackarr/internal/auth"
+	"github.com/RoseOO/TapeBackarr/internal/models"
+)
+
+// restoreOperatorWrites are the only non-GET endpoints restore operators may
+// call: restores, restore carts and their own account
+var restoreOperatorWrites = []struct {
+	method string // empty matches any method
+	path   *regexp.Regexp
+}{
+	{"POST", regexp.MustCompile(`^/api/v1/restore/(plan|run)/?$`)},
+	{"", regexp.MustCompile(`^/api/v1/restore/carts(/.*)?$`)},
+	{"POST", regexp.MustCompile(`^/api/v1/auth/change-password/?$`)},
+	{"PUT", regexp.MustCompile(`^/api/v1/auth/preferences/?$`)},
+}
+
+// kioskPaths are the only endpoints kiosk accounts may call: the kiosk
+// itself and their own account
+var kioskPaths = regexp.MustCompile(`^/api/v1/(kiosk(/.*)?|auth/(change-password|preferences))/?$`)
+
+// roleScopeMiddleware limits restore operators to reading and to the
+// endpoints in restoreOperatorWrites, and kiosk accounts to kioskPaths
+func (s *Server) roleScopeMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		claims, _ := r.Context().Value("claims").(*auth.Claims)
+		if claims != nil && claims.Role == models.RoleKiosk {
+			if kioskPaths.MatchString(r.URL.Path) {
+				next.ServeHTTP(w, r)
+				return
+			}
+			s.respondError(w, http.StatusForbidden, "kiosk accounts can only use the operator kiosk")
+			return
+		}
+		if claims == nil || claims.Role != models.RoleRestoreOperator {
+			next.ServeHTTP(w, r)
+			return
+		}
+		switch r.Method {
+		case http.MethodGet, http.MethodHead, http.MethodOptions:
+			next.ServeHTTP(w, r)
+			return
+		}
+		for _, allowed := range restoreOperatorWrites {
+			if (allowed.method == "" || allowed.method == r.Method) && allowed.path.MatchString(r.URL.Path) {
+				next.ServeHTTP(w, r)
+				return
+			}
+		}
+		s.respondError(w, http.StatusForbidden, "restore operators can only search the catalog and run restores")
+	})
+}
+
+// tapeHandlerMiddleware admits the roles that may handle tapes: admins,
+// operators and kiosk accounts
+func (s *Server) tapeHandlerMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		claims, _ := r.Context().Value("claims").(*auth.Claims)
+		if claims == nil {
+			s.respondError(w, http.StatusUnauthorized, "missing authentication")
+			return
+		}
+		switch claims.Role {
+		case models.RoleAdmin, models.RoleOperator, models.RoleKiosk:
+			next.ServeHTTP(w, r)
+		default:
+			s.respondError(w, http.StatusForbidden, "operator access required")
+		}
+	})
+}
+
+// checkRestoreDestination returns an error message when the caller may not
+// restore to the given destination. Restore operators may only restore to
+// enabled restore targets set up by an admin, never to a local path.
+func (s *Server) checkRestoreDestination(r *http.Request, targetID *int64) string {
+	claims, _ := r.Context().Value("claims").(*auth.Claims)
+	if claims == nil || claims.Role != models.RoleRestoreOperator {
+		return ""
+	}
+	if targetID == nil {
+		return "restore operators can only restore to an approved restore target"
+	}
+	var enabled bool
+	if err := s.db.QueryRow("SELECT enabled FROM restore_targets WHERE id = ?", *targetID).Scan(&enabled); err != nil || !enabled {
+		return "restore operators can only restore to an approved restore target"
+	}
+	return ""
+}
@@ -0,0 +1,140 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/RoseOO/TapeBackarr/internal/auth"
+	"github.com/RoseOO/TapeBackarr/internal/scheduler"
+)
+
+// handleSchedulerStatus returns whether the scheduler is running or paused,
+// when it last ticked, every loaded job with its next occurrences and the
+// jobs whose schedules failed to load.
+func (s *Server) handleSchedulerStatus(w http.ResponseWriter, r *http.Request) {
+	count := 5
+	if c := r.URL.Query().Get("count"); c != "" {
+		parsed, err := strconv.Atoi(c)
+		if err != nil || parsed < 1 || parsed > 50 {
+			s.respondError(w, http.StatusBadRequest, "count must be between 1 and 50")
+			return
+		}
+		count = parsed
+	}
+	s.respondJSON(w, http.StatusOK, s.scheduler.Status(count))
+}
+
+// handlePauseScheduler stops all scheduled runs from starting until the
+// scheduler is resumed. Manual runs are not affected.
+func (s *Server) handlePauseScheduler(w http.ResponseWriter, r *http.Request) {
+	by := ""
+	if claims, ok := r.Context().Value("claims").(*auth.Claims); ok {
+		by = claims.Username
+	}
+	if err := s.scheduler.Pause(by); err != nil {
+		s.respondError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	s.auditLog(r, "pause", "scheduler", 0, "Paused the scheduler")
+	s.respondJSON(w, http.StatusOK, map[string]interface{}{"paused": true})
+}
+
+// handleResumeScheduler lets scheduled runs start again
+func (s *Server) handleResumeScheduler(w http.ResponseWriter, r *http.Request) {
+	if err := s.scheduler.Resume(); err != nil {
+		s.respondError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	s.auditLog(r, "resume", "scheduler", 0, "Resumed the scheduler")
+	s.respondJSON(w, http.StatusOK, map[string]interface{}{"paused": false})
+}
+
+// handlePauseJobSchedule pauses a job's schedule without disabling the job
+func (s *Server) handlePauseJobSchedule(w http.ResponseWriter, r *http.Request) {
+	s.setJobSchedulePaused(w, r, true)
+}
+
+// handleResumeJobSchedule resumes a job's paused schedule
+func (s *Server) handleResumeJobSchedule(w http.ResponseWriter, r *http.Request) {
+	s.setJobSchedulePaused(w, r, false)
+}
+
+func (s *Server) setJobSchedulePaused(w http.ResponseWriter, r *http.Request, paused bool) {
+	id, err := s.getIDParam(r)
+	if err != nil {
+		s.respondError(w, http.StatusBadRequest, "invalid job id")
+		return
+	}
+	var name string
+	if err := s.db.QueryRow("SELECT name FROM backup_jobs WHERE id = ? AND ad_hoc = 0", id).Scan(&name); err != nil {
+		s.respondError(w, http.StatusNotFound, "job not found")
+		return
+	}
+	if err := s.scheduler.SetJobPaused(id, paused); err != nil {
+		s.respondError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	action, details := "resume_schedule", fmt.Sprintf("Resumed schedule of job %s", name)
+	if paused {
+		action, details = "pause_schedule", fmt.Sprintf("Paused schedule of job %s", name)
+	}
+	s.auditLog(r, action, "backup_job", id, details)
+	s.respondJSON(w, http.StatusOK, map[string]interface{}{"id": id, "schedule_paused": paused})
+}
+
+// handleDescribeCron validates a cron expression, or a job's saved schedule
+// with job_id, and returns a plain-English description with its next fire
+// times. Invalid expressions are reported with valid=false so forms can show
+// the error while the user types.
+func (s *Server) handleDescribeCron(w http.ResponseWriter, r *http.Request) {
+	expr := r.URL.Query().Get("expression")
+	if jobID := r.URL.Query().Get("job_id"); jobID != "" && expr == "" {
+		id, err := strconv.ParseInt(jobID, 10, 64)
+		if err != nil {
+			s.respondError(w, http.StatusBadRequest, "invalid job id")
+			return
+		}
+		if err := s.db.QueryRow("SELECT COALESCE(schedule_cron, '') FROM backup_jobs WHERE id = ?", id).Scan(&expr); err != nil {
+			s.respondError(w, http.StatusNotFound, "job not found")
+			return
+		}
+	}
+	if expr == "" {
+		s.respondError(w, http.StatusBadRequest, "expression or job_id is required")
+		return
+	}
+	count := 5
+	if c := r.URL.Query().Get("count"); c != "" {
+		parsed, err := strconv.Atoi(c)
+		if err != nil || parsed < 1 || parsed > 50 {
+			s.respondError(w, http.StatusBadRequest, "count must be between 1 and 50")
+			return
+		}
+		count = parsed
+	}
+
+	description, err := scheduler.Describe(expr)
+	if err != nil {
+		s.respondJSON(w, http.StatusOK, map[string]interface{}{
+			"expression": expr,
+			"valid":      false,
+			"error":      err.Error(),
+		})
+		return
+	}
+	runs, loc, err := scheduler.NextRuns(expr, time.Now(), count)
+	if err != nil {
+		s.respondError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	s.respondJSON(w, http.StatusOK, map[string]interface{}{
+		"expression":  expr,
+		"valid":       true,
+		"description": description,
+		"timezone":    loc.String(),
+		"next_runs":   runs,
+	})
+}
@@ -5,6 +5,8 @@ import (
 	"context"
 	"crypto/rand"
 	"crypto/sha256"
+	"database/sql"
+	"encoding/csv"
 	"encoding/hex"
 	"encoding/json"
 	"errors"
@@ -23,15 +25,23 @@ import (
 	"github.com/RoseOO/TapeBackarr/internal/backup"
 	"github.com/RoseOO/TapeBackarr/internal/cmdutil"
 	"github.com/RoseOO/TapeBackarr/internal/config"
+	"github.com/RoseOO/TapeBackarr/internal/credentials"
 	"github.com/RoseOO/TapeBackarr/internal/database"
 	"github.com/RoseOO/TapeBackarr/internal/encryption"
+	"github.com/RoseOO/TapeBackarr/internal/i18n"
+	"github.com/RoseOO/TapeBackarr/internal/library"
 	"github.com/RoseOO/TapeBackarr/internal/logging"
 	"github.com/RoseOO/TapeBackarr/internal/models"
+	"github.com/RoseOO/TapeBackarr/internal/ndmp"
 	"github.com/RoseOO/TapeBackarr/internal/notifications"
+	"github.com/RoseOO/TapeBackarr/internal/preflight"
 	"github.com/RoseOO/TapeBackarr/internal/proxmox"
 	"github.com/RoseOO/TapeBackarr/internal/restore"
 	"github.com/RoseOO/TapeBackarr/internal/scheduler"
+	"github.com/RoseOO/TapeBackarr/internal/scratch"
+	"github.com/RoseOO/TapeBackarr/internal/stages"
 	"github.com/RoseOO/TapeBackarr/internal/tape"
+	"github.com/RoseOO/TapeBackarr/internal/validation"
 
 	embeddedDocs "github.com/RoseOO/TapeBackarr/docs"
 
@@ -61,7 +71,7 @@ type tapeOpState struct {
 	mu      sync.Mutex
 	running bool
 	cancel  context.CancelFunc
-	opType  string // "format" or "label"
+	opType  string // "format", "label" or "relabel"
 	phase   string // "checking", "erasing", "writing", "verifying", "ejecting", "updating", "complete", "failed"
 	message string
 	driveID int64
@@ -85,15 +95,30 @@ type Server struct {
 	proxmoxBackupService  *proxmox.BackupService
 	proxmoxRestoreService *proxmox.RestoreService
 	proxmoxClient         *proxmox.Client
+	proxmoxClusters       proxmoxClusterState
 	staticDir             string
 	configPath            string
 	config                *config.Config
 	eventBus              *EventBus
 	telegramService       *notifications.TelegramService
+	emailService          *notifications.EmailService
 	batchLabel            batchLabelState
 	ltfsFormat            ltfsFormatState
 	tapeOp                tapeOpState
-	notifiedUnknownTapes  sync.Map // Track unknown tapes that have been notified (key: tape UUID)
+	scratch               *scratch.Dir
+	bulkOp                bulkOpState
+	catalogRebuild        catalogRebuildState
+	artifactRecall        artifactRecallState
+	driveBinding          driveBindingState
+	consolidation         consolidationState
+	syntheticFull         syntheticFullState
+	credentialsMu         sync.RWMutex // guards credentials and auth.credentials_key, which replication replaces
+	credentials           *credentials.Store
+	library               *library.Loader // shared with jobs so audits never run during a move
+	replication           replicationState
+	updates               updateState
+	auditExportMu         sync.Mutex // serializes writes to the compliance tape
+	notifiedUnknownTapes  sync.Map   // Track unknown tapes that have been notified (key: tape UUID)
 }
 
 // ltfsFormatState tracks a running LTFS format operation.
@@ -144,16 +169,37 @@ func NewServer(
 		config:                cfg,
 		eventBus:              NewEventBus(),
 	}
+	if backupService != nil {
+		s.library = backupService.LibraryLoader()
+	}
+	if s.library == nil && db != nil {
+		s.library = library.NewLoader(db, logger)
+	}
+	if cfg != nil {
+		s.scratch = scratch.New(cfg.Scratch.Dir, cfg.Scratch.MinFreeMB)
+		s.credentials = newCredentialStore(db, cfg, configPath, logger)
+		if restoreService != nil && s.credentials != nil {
+			restoreService.SetCredentials(s.credentials)
+		}
+		if backupService != nil && s.credentials != nil {
+			backupService.SetCredentials(s.credentials)
+		}
+	}
+
+	// Keep events for clients that reconnect to the event stream
+	if db != nil {
+		s.eventBus.Persist(db, logger)
+	}
 
 	// Wire up backup service events to the event bus
 	if backupService != nil {
-		backupService.EventCallback = func(eventType, category, title, message string) {
+		backupService.EventCallback = func(eventType, category, key string, args ...interface{}) {
 			if s.eventBus != nil {
 				s.eventBus.Publish(SystemEvent{
 					Type:     eventType,
 					Category: category,
-					Title:    title,
-					Message:  message,
+					Key:      key,
+					Args:     args,
 				})
 			}
 		}
@@ -161,37 +207,110 @@ func NewServer(
 
 	s.setupRoutes()
 
+	if db != nil {
+		s.reloadNotificationTemplates()
+	}
+
 	// Initialize Telegram bot if configured
 	if cfg != nil && cfg.Notifications.Telegram.Enabled {
 		s.telegramService = notifications.NewTelegramService(notifications.TelegramConfig{
 			Enabled:  cfg.Notifications.Telegram.Enabled,
 			BotToken: cfg.Notifications.Telegram.BotToken,
 			ChatID:   cfg.Notifications.Telegram.ChatID,
+			Language: cfg.Notifications.Telegram.Language,
 		})
 		go s.StartTelegramBot(context.Background())
 	}
 
+	if cfg != nil && cfg.Notifications.Email.Enabled {
+		s.emailService = notifications.NewEmailService(notifications.EmailConfig{
+			Enabled:    cfg.Notifications.Email.Enabled,
+			SMTPHost:   cfg.Notifications.Email.SMTPHost,
+			SMTPPort:   cfg.Notifications.Email.SMTPPort,
+			Username:   cfg.Notifications.Email.Username,
+			Password:   cfg.Notifications.Email.Password,
+			FromEmail:  cfg.Notifications.Email.FromEmail,
+			FromName:   cfg.Notifications.Email.FromName,
+			ToEmails:   cfg.Notifications.Email.ToEmails,
+			UseTLS:     cfg.Notifications.Email.UseTLS,
+			StartTLS:   cfg.Notifications.Email.StartTLS,
+			SkipVerify: cfg.Notifications.Email.SkipVerify,
+			Language:   cfg.Notifications.Email.Language,
+		})
+	}
+
 	// Wire up restore notifications (email + telegram)
 	if restoreService != nil {
-		var emailSvc *notifications.EmailService
-		if cfg != nil && cfg.Notifications.Email.Enabled {
-			emailSvc = notifications.NewEmailService(notifications.EmailConfig{
-				Enabled:    cfg.Notifications.Email.Enabled,
-				SMTPHost:   cfg.Notifications.Email.SMTPHost,
-				SMTPPort:   cfg.Notifications.Email.SMTPPort,
-				Username:   cfg.Notifications.Email.Username,
-				Password:   cfg.Notifications.Email.Password,
-				FromEmail:  cfg.Notifications.Email.FromEmail,
-				FromName:   cfg.Notifications.Email.FromName,
-				ToEmails:   cfg.Notifications.Email.ToEmails,
-				UseTLS:     cfg.Notifications.Email.UseTLS,
-				SkipVerify: cfg.Notifications.Email.SkipVerify,
-			})
-		}
-		restoreNotifier := notifications.NewRestoreNotifier(s.telegramService, emailSvc)
+		restoreNotifier := notifications.NewRestoreNotifier(s.telegramService, s.emailService)
 		restoreService.SetNotifier(restoreNotifier)
 	}
 
+	// Send one report per backup window instead of relying on per-job messages
+	if cfg != nil && cfg.Notifications.BackupWindow.Enabled && scheduler != nil && backupService != nil {
+		if err := scheduler.SetWindowReport(cfg.Notifications.BackupWindow.End, s.sendBackupWindowReport); err != nil && logger != nil {
+			logger.Error("Failed to schedule backup window report", map[string]interface{}{"error": err.Error()})
+		}
+	}
+
+	// Check and snapshot the database on a schedule and report corruption
+	// found at startup
+	if db != nil {
+		if cfg != nil && cfg.Database.IntegrityCheckSchedule != "" && scheduler != nil {
+			if err := scheduler.SetMaintenance("integrity_check", cfg.Database.IntegrityCheckSchedule, func() { s.runIntegrityCheck() }); err != nil && logger != nil {
+				logger.Error("Failed to schedule database integrity check", map[string]interface{}{"error": err.Error()})
+			}
+		}
+		if cfg != nil && cfg.Database.SnapshotSchedule != "" && scheduler != nil {
+			if err := scheduler.SetMaintenance("database_snapshot", cfg.Database.SnapshotSchedule, s.runScheduledSnapshot); err != nil && logger != nil {
+				logger.Error("Failed to schedule database snapshots", map[string]interface{}{"error": err.Error()})
+			}
+		}
+		if cfg != nil && cfg.InventoryExport.Schedule != "" && scheduler != nil {
+			if err := scheduler.SetMaintenance("inventory_export", cfg.InventoryExport.Schedule, s.runScheduledInventoryExport); err != nil && logger != nil {
+				logger.Error("Failed to schedule inventory export", map[string]interface{}{"error": err.Error()})
+			}
+		}
+		if cfg != nil && cfg.AuditExport.Schedule != "" && scheduler != nil {
+			if err := scheduler.SetMaintenance("audit_export", cfg.AuditExport.Schedule, s.runScheduledAuditExport); err != nil && logger != nil {
+				logger.Error("Failed to schedule audit log export", map[string]interface{}{"error": err.Error()})
+			}
+		}
+		go s.reportStartupRecovery()
+
+		// Follow the primary until this standby is promoted
+		if cfg != nil && cfg.Replication.Role == config.ReplicationStandby {
+			s.startReplication()
+		}
+
+		// Keep drives bound to their device nodes by serial number. Scheduled
+		// runs resolve the nodes just before they start.
+		s.rebindDrives(true)
+		if scheduler != nil {
+			scheduler.SetBeforeRun(func() { s.rebindDrives(true) })
+			if err := scheduler.SetMaintenance("drive_binding", "0 * * * * *", func() { s.rebindDrives(false) }); err != nil && logger != nil {
+				logger.Error("Failed to schedule drive binding check", map[string]interface{}{"error": err.Error()})
+			}
+		}
+
+		// Compare library slots with the slot records before the night's jobs
+		// find out the hard way
+		if cfg != nil && cfg.Tape.LibraryAuditSchedule != "" && scheduler != nil {
+			if err := scheduler.SetMaintenance("library_audit", cfg.Tape.LibraryAuditSchedule, s.runLibraryAudits); err != nil && logger != nil {
+				logger.Error("Failed to schedule library slot audit", map[string]interface{}{"error": err.Error()})
+			}
+		}
+
+		// Resume queued artifact recalls and expire their download links
+		if restoreService != nil {
+			s.resumeArtifactRecalls()
+			if scheduler != nil {
+				if err := scheduler.SetMaintenance("artifact_recall_expiry", "0 */10 * * * *", s.expireArtifactRecalls); err != nil && logger != nil {
+					logger.Error("Failed to schedule artifact recall expiry", map[string]interface{}{"error": err.Error()})
+				}
+			}
+		}
+	}
+
 	return s
 }
 
@@ -201,6 +320,8 @@ func (s *Server) setupRoutes() {
 
 	// Middleware
 	r.Use(middleware.RequestID)
+	r.Use(requestIDResponse)
+	r.Use(peerAddrMiddleware)
 	r.Use(middleware.RealIP)
 	r.Use(middleware.Logger)
 	r.Use(middleware.Recoverer)
@@ -209,22 +330,29 @@ func (s *Server) setupRoutes() {
 	// CORS
 	r.Use(cors.Handler(cors.Options{
 		AllowedOrigins:   []string{"*"},
-		AllowedMethods:   []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
-		AllowedHeaders:   []string{"Accept", "Authorization", "Content-Type", "X-API-Key"},
-		ExposedHeaders:   []string{"Link"},
+		AllowedMethods:   []string{"GET", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"},
+		AllowedHeaders:   []string{"Accept", "Authorization", "Content-Type", "X-API-Key", "Upload-Offset"},
+		ExposedHeaders:   []string{"Link", "Location", "Upload-Offset", "X-Request-Id"},
 		AllowCredentials: true,
 		MaxAge:           300,
 	}))
 
 	// Public routes
 	r.Post("/api/v1/auth/login", s.handleLogin)
+	r.Get("/api/v1/artifact-downloads/{token}", s.handleDownloadArtifact)
 
 	// Protected routes
 	r.Group(func(r chi.Router) {
 		r.Use(s.authMiddleware)
+		r.Use(s.roleScopeMiddleware)
+		r.Use(s.managementNetworkMiddleware)
+		r.Use(s.driveBindingMiddleware)
+		r.Use(s.standbyMiddleware)
 
 		// Dashboard
 		r.Get("/api/v1/dashboard", s.handleDashboard)
+		r.Get("/api/v1/slo", s.handleSLO)
+		r.Get("/api/v1/metrics", s.handleMetrics)
 
 		// Tapes
 		r.Route("/api/v1/tapes", func(r chi.Router) {
@@ -239,11 +367,27 @@ func (s *Server) setupRoutes() {
 			r.Post("/{id}/export", s.handleExportTape)
 			r.Post("/{id}/import", s.handleImportTape)
 			r.Get("/{id}/read-label", s.handleReadTapeLabel)
+			r.Get("/{id}/compatibility", s.handleTapeCompatibility)
+			r.Get("/{id}/timeline", s.handleTapeTimeline)
+			r.Post("/{id}/locate", s.handleLocateTape)
 			r.Post("/batch-label", s.handleTapesBatchLabel)
 			r.Get("/batch-label/status", s.handleBatchLabelStatus)
 			r.Post("/batch-label/cancel", s.handleBatchLabelCancel)
 			r.Post("/batch-update", s.handleBatchUpdateTapes)
 			r.Get("/operation/status", s.handleTapeOpStatus)
+			r.Get("/{id}/migrations", s.handleListTapeMigrations)
+			r.Get("/reuse-pending", s.handleListTapeReuse)
+			r.Get("/reclaimable", s.handleListReclaimableTapes)
+			r.Group(func(r chi.Router) {
+				r.Use(s.adminOnlyMiddleware)
+				r.Post("/{id}/reuse/approve", s.handleApproveTapeReuse)
+				r.Post("/{id}/reuse/reject", s.handleRejectTapeReuse)
+				r.Post("/{id}/migrate", s.handleMigrateTape)
+				r.Post("/consolidate/plan", s.handlePlanConsolidation)
+				r.Post("/consolidate", s.handleStartConsolidation)
+				r.Get("/consolidate/status", s.handleConsolidationStatus)
+				r.Post("/consolidate/cancel", s.handleCancelConsolidation)
+			})
 		})
 
 		// Tape Pools
@@ -251,6 +395,8 @@ func (s *Server) setupRoutes() {
 			r.Get("/", s.handleListPools)
 			r.Post("/", s.handleCreatePool)
 			r.Get("/{id}", s.handleGetPool)
+			r.Get("/{id}/stats", s.handlePoolStats)
+			r.Get("/{id}/reservations", s.handlePoolReservations)
 			r.Put("/{id}", s.handleUpdatePool)
 			r.Delete("/{id}", s.handleDeletePool)
 		})
@@ -260,8 +406,12 @@ func (s *Server) setupRoutes() {
 			r.Get("/", s.handleListDrives)
 			r.Post("/", s.handleCreateDrive)
 			r.Get("/scan", s.handleScanDrives)
+			r.Get("/label-cache", s.handleLabelCacheAudit)
+			r.Get("/usage", s.handleDriveUsage)
+			r.Get("/queues", s.handleDriveQueues)
 			r.Get("/{id}/status", s.handleDriveStatus)
 			r.Get("/{id}/detect-tape", s.handleDetectTape)
+			r.Post("/{id}/read-capacity", s.handleReadTapeCapacity)
 			r.Put("/{id}", s.handleUpdateDrive)
 			r.Delete("/{id}", s.handleDeleteDrive)
 			r.Post("/{id}/eject", s.handleEjectTape)
@@ -288,6 +438,7 @@ func (s *Server) setupRoutes() {
 			r.Get("/{id}", s.handleGetSource)
 			r.Put("/{id}", s.handleUpdateSource)
 			r.Delete("/{id}", s.handleDeleteSource)
+			r.Post("/{id}/test", s.handleTestSource)
 		})
 
 		// Backup Jobs
@@ -296,6 +447,7 @@ func (s *Server) setupRoutes() {
 			r.Post("/", s.handleCreateJob)
 			r.Get("/active", s.handleActiveJobs)
 			r.Get("/resumable", s.handleResumableJobs)
+			r.Get("/stream-stages", s.handleListStreamStages)
 			r.Get("/{id}", s.handleGetJob)
 			r.Put("/{id}", s.handleUpdateJob)
 			r.Delete("/{id}", s.handleDeleteJob)
@@ -304,29 +456,157 @@ func (s *Server) setupRoutes() {
 			r.Post("/{id}/pause", s.handlePauseJob)
 			r.Post("/{id}/resume", s.handleResumeJob)
 			r.Post("/{id}/retry", s.handleRetryJob)
+			r.Post("/{id}/schedule/pause", s.handlePauseJobSchedule)
+			r.Post("/{id}/schedule/resume", s.handleResumeJobSchedule)
+			r.Post("/{id}/guardrails/confirm", s.handleConfirmJobGuardrails)
 			r.Get("/{id}/recommend-tape", s.handleRecommendTape)
+			r.Get("/{id}/simulate-retention", s.handleSimulateRetention)
+			r.Get("/{id}/chains", s.handleJobChains)
+			r.Get("/{id}/snapshots", s.handleListJobSnapshots)
+			r.Post("/{id}/snapshots/rebuild", s.handleRebuildJobSnapshot)
+			r.Get("/{id}/snapshots/{snapshotId}", s.handleGetJobSnapshot)
+			r.Put("/{id}/snapshots/{snapshotId}/pin", s.handlePinJobSnapshot)
+			r.Delete("/{id}/snapshots/{snapshotId}", s.handleDeleteJobSnapshot)
+			r.Group(func(r chi.Router) {
+				r.Use(s.adminOnlyMiddleware)
+				r.Get("/synthetic-full/status", s.handleSyntheticFullStatus)
+				r.Post("/synthetic-full/cancel", s.handleCancelSyntheticFull)
+				r.Post("/{id}/synthetic-full/plan", s.handlePlanSyntheticFull)
+				r.Post("/{id}/synthetic-full", s.handleStartSyntheticFull)
+			})
+		})
+
+		// Scheduler (pausing the whole scheduler is admin only)
+		r.Route("/api/v1/scheduler", func(r chi.Router) {
+			r.Get("/status", s.handleSchedulerStatus)
+			r.Get("/cron", s.handleDescribeCron)
+			r.Get("/window-report", s.handleBackupWindowReport)
+			r.Group(func(r chi.Router) {
+				r.Use(s.adminOnlyMiddleware)
+				r.Post("/pause", s.handlePauseScheduler)
+				r.Post("/resume", s.handleResumeScheduler)
+			})
 		})
 
 		// Backup Sets
 		r.Route("/api/v1/backup-sets", func(r chi.Router) {
 			r.Get("/", s.handleListBackupSets)
+			r.Group(func(r chi.Router) {
+				// The import reads any file the server can
+				r.Use(s.adminOnlyMiddleware)
+				r.Post("/import", s.handleImportBackupSet)
+			})
+			r.Post("/adhoc", s.handleRunAdHocBackup)
+			r.Post("/bulk", s.handleBulkBackupSets)
+			r.Get("/bulk/status", s.handleBulkBackupSetsStatus)
+			r.Post("/bulk/cancel", s.handleBulkBackupSetsCancel)
+			r.Post("/bulk/export", s.handleBulkExportCatalogs)
 			r.Get("/{id}", s.handleGetBackupSet)
 			r.Get("/{id}/files", s.handleListBackupFiles)
+			r.Get("/{id}/skipped", s.handleListSkippedPaths)
+			r.Get("/{id}/deleted", s.handleListDeletedPaths)
+			r.Get("/{id}/composition", s.handleGetBackupSetComposition)
 			r.Delete("/{id}", s.handleDeleteBackupSet)
 			r.Post("/{id}/cancel", s.handleCancelBackupSet)
+			r.Post("/{id}/invalidate", s.handleInvalidateBackupSet)
+		})
+
+		// Uploads
+		r.Route("/api/v1/uploads", func(r chi.Router) {
+			r.Get("/", s.handleListUploads)
+			r.Post("/", s.handleStartUpload)
+			r.Get("/{id}", s.handleGetUpload)
+			r.Patch("/{id}", s.handleWriteUpload)
+			r.Delete("/{id}", s.handleAbortUpload)
+		})
+
+		// Artifacts
+		r.Route("/api/v1/artifacts", func(r chi.Router) {
+			r.Get("/recalls", s.handleListArtifactRecalls)
+			r.Get("/recalls/{id}", s.handleGetArtifactRecall)
+			r.Delete("/recalls/{id}", s.handleDeleteArtifactRecall)
+			r.Get("/{id}", s.handleGetArtifact)
+			r.Post("/{id}/recall", s.handleRecallArtifact)
 		})
 
 		// Catalog
 		r.Route("/api/v1/catalog", func(r chi.Router) {
 			r.Get("/search", s.handleSearchCatalog)
+			r.Get("/stats", s.handleCatalogContentStats)
 			r.Get("/browse/{backupSetId}", s.handleBrowseCatalog)
+
+			// Rebuild from on-tape labels and TOCs (admin only)
+			r.Group(func(r chi.Router) {
+				r.Use(s.adminOnlyMiddleware)
+				r.Post("/rebuild/scan", s.handleRebuildCatalogScan)
+				r.Post("/rebuild/library", s.handleRebuildCatalogLibrary)
+				r.Get("/rebuild/status", s.handleRebuildCatalogStatus)
+				r.Post("/rebuild/cancel", s.handleRebuildCatalogCancel)
+			})
 		})
 
 		// Restore
 		r.Route("/api/v1/restore", func(r chi.Router) {
 			r.Post("/plan", s.handleRestorePlan)
+			r.Post("/point-in-time", s.handlePointInTimePlan)
 			r.Post("/run", s.handleRunRestore)
 			r.Post("/raw-read", s.handleRawReadTape)
+			r.Post("/peek", s.handleRestorePeek)
+			r.Get("/receipts", s.handleListRestoreReceipts)
+			r.Get("/receipts/public-key", s.handleRestoreReceiptKey)
+			r.Get("/receipts/{id}", s.handleGetRestoreReceipt)
+			r.Get("/receipts/{id}/pdf", s.handleGetRestoreReceiptPDF)
+			r.Get("/carts", s.handleListRestoreCarts)
+			r.Post("/carts", s.handleCreateRestoreCart)
+			r.Get("/carts/{id}", s.handleGetRestoreCart)
+			r.Put("/carts/{id}", s.handleRenameRestoreCart)
+			r.Delete("/carts/{id}", s.handleDeleteRestoreCart)
+			r.Get("/carts/{id}/items", s.handleListRestoreCartItems)
+			r.Post("/carts/{id}/items", s.handleAddRestoreCartItems)
+			r.Post("/carts/{id}/items/remove", s.handleRemoveRestoreCartItems)
+			r.Delete("/carts/{id}/items", s.handleClearRestoreCart)
+			r.Post("/carts/{id}/submit", s.handleSubmitRestoreCart)
+		})
+
+		// Replication between a primary and a standby server
+		r.Route("/api/v1/replication", func(r chi.Router) {
+			r.Use(s.adminOnlyMiddleware)
+			r.Get("/status", s.handleReplicationStatus)
+			r.Get("/snapshot", s.handleReplicationSnapshot)
+			r.Get("/config", s.handleReplicationConfig)
+			r.Post("/sync", s.handleReplicationSync)
+			r.Post("/promote", s.handlePromoteStandby)
+		})
+
+		// System inventory export and import, e.g. to seed a standby server
+		r.Group(func(r chi.Router) {
+			r.Use(s.adminOnlyMiddleware)
+			r.Get("/api/v1/export/inventory", s.handleExportInventory)
+			r.Post("/api/v1/import/inventory", s.handleImportInventory)
+		})
+
+		// Credentials store (admin only; secrets are never returned)
+		r.Route("/api/v1/credentials", func(r chi.Router) {
+			r.Use(s.adminOnlyMiddleware)
+			r.Get("/", s.handleListCredentials)
+			r.Post("/", s.handleCreateCredential)
+			r.Get("/{id}", s.handleGetCredential)
+			r.Put("/{id}", s.handleUpdateCredential)
+			r.Delete("/{id}", s.handleDeleteCredential)
+			r.Get("/{id}/usage", s.handleCredentialUsage)
+		})
+
+		// Remote restore targets (admin only for management and connection tests)
+		r.Route("/api/v1/restore-targets", func(r chi.Router) {
+			r.Get("/", s.handleListRestoreTargets)
+			r.Get("/{id}", s.handleGetRestoreTarget)
+			r.Group(func(r chi.Router) {
+				r.Use(s.adminOnlyMiddleware)
+				r.Post("/", s.handleCreateRestoreTarget)
+				r.Put("/{id}", s.handleUpdateRestoreTarget)
+				r.Delete("/{id}", s.handleDeleteRestoreTarget)
+				r.Post("/{id}/test", s.handleTestRestoreTarget)
+			})
 		})
 
 		// LTFS (Linear Tape File System)
@@ -345,6 +625,12 @@ func (s *Server) setupRoutes() {
 		r.Route("/api/v1/logs", func(r chi.Router) {
 			r.Get("/audit", s.handleListAuditLogs)
 			r.Get("/export", s.handleExportLogs)
+			r.Group(func(r chi.Router) {
+				r.Use(s.adminOnlyMiddleware)
+				r.Get("/audit/exports", s.handleListAuditExports)
+				r.Post("/audit/exports", s.handleRunAuditExport)
+				r.Post("/audit/exports/verify", s.handleVerifyAuditExports)
+			})
 		})
 
 		// Users (admin only)
@@ -353,11 +639,23 @@ func (s *Server) setupRoutes() {
 			r.Get("/", s.handleListUsers)
 			r.Post("/", s.handleCreateUser)
 			r.Delete("/{id}", s.handleDeleteUser)
+			r.Post("/{id}/unlock", s.handleUnlockUser)
+			r.Get("/{id}/login-history", s.handleUserLoginHistory)
+		})
+
+		// Operator kiosk: tape requests for a tablet next to the library
+		r.Route("/api/v1/kiosk", func(r chi.Router) {
+			r.Get("/", s.handleKioskStatus)
+			r.With(s.tapeHandlerMiddleware).Post("/tape-requests/{id}/loaded", s.handleKioskConfirmLoaded)
 		})
 
 		// Password change (any authenticated user)
 		r.Post("/api/v1/auth/change-password", s.handleChangePassword)
 
+		// Per-user preferences (any authenticated user)
+		r.Get("/api/v1/auth/preferences", s.handleGetPreferences)
+		r.Put("/api/v1/auth/preferences", s.handleUpdatePreferences)
+
 		// Settings/Config (admin only for write, all authenticated for read)
 		r.Route("/api/v1/settings", func(r chi.Router) {
 			r.Get("/", s.handleGetConfig)
@@ -365,10 +663,28 @@ func (s *Server) setupRoutes() {
 				r.Use(s.adminOnlyMiddleware)
 				r.Put("/", s.handleUpdateConfig)
 				r.Post("/telegram/test", s.handleTestTelegram)
+				r.Post("/email/test", s.handleTestEmail)
 				r.Post("/restart", s.handleRestart)
 			})
 		})
 
+		// Notification templates (admin only)
+		// Release check and migration preview (admin only)
+		r.Route("/api/v1/updates", func(r chi.Router) {
+			r.Use(s.adminOnlyMiddleware)
+			r.Get("/", s.handleGetUpdates)
+			r.Post("/check", s.handleCheckUpdates)
+			r.Get("/{version}/migrations", s.handleGetUpdateMigrations)
+		})
+
+		r.Route("/api/v1/notification-templates", func(r chi.Router) {
+			r.Use(s.adminOnlyMiddleware)
+			r.Get("/", s.handleListNotificationTemplates)
+			r.Post("/preview", s.handlePreviewNotificationTemplate)
+			r.Put("/{eventType}/{channel}", s.handleSaveNotificationTemplate)
+			r.Delete("/{eventType}/{channel}", s.handleDeleteNotificationTemplate)
+		})
+
 		// Events / Notifications
 		r.Get("/api/v1/events/stream", s.handleEventStream)
 		r.Get("/api/v1/events", s.handleGetNotifications)
@@ -388,9 +704,20 @@ func (s *Server) setupRoutes() {
 				r.Use(s.adminOnlyMiddleware)
 				r.Get("/download", s.handleDownloadDatabase)
 				r.Post("/upload", s.handleUploadDatabase)
+				r.Get("/integrity", s.handleDatabaseIntegrity)
+				r.Post("/integrity/check", s.handleCheckDatabaseIntegrity)
+				r.Get("/snapshots", s.handleListDatabaseSnapshots)
+				r.Post("/snapshots", s.handleCreateDatabaseSnapshot)
+				r.Post("/snapshots/{name}/restore", s.handleRestoreDatabaseSnapshot)
 			})
 		})
 
+		// Pipeline benchmark (admin only: generates sustained CPU and I/O load)
+		r.Route("/api/v1/benchmark", func(r chi.Router) {
+			r.Use(s.adminOnlyMiddleware)
+			r.Post("/", s.handleRunBenchmark)
+		})
+
 		// Encryption keys (admin only for management, all authenticated users can list)
 		r.Route("/api/v1/encryption-keys", func(r chi.Router) {
 			r.Get("/", s.handleListEncryptionKeys)
@@ -409,11 +736,23 @@ func (s *Server) setupRoutes() {
 			r.Use(s.adminOnlyMiddleware)
 			r.Get("/", s.handleListAPIKeys)
 			r.Post("/", s.handleCreateAPIKey)
+			r.Put("/{id}", s.handleUpdateAPIKey)
 			r.Delete("/{id}", s.handleDeleteAPIKey)
 		})
 
 		// Proxmox VE integration
 		r.Route("/api/v1/proxmox", func(r chi.Router) {
+			// Registered clusters (admin only for management and connection tests)
+			r.Get("/clusters", s.handleListProxmoxClusters)
+			r.Get("/clusters/{id}", s.handleGetProxmoxCluster)
+			r.Group(func(r chi.Router) {
+				r.Use(s.adminOnlyMiddleware)
+				r.Post("/clusters", s.handleCreateProxmoxCluster)
+				r.Put("/clusters/{id}", s.handleUpdateProxmoxCluster)
+				r.Delete("/clusters/{id}", s.handleDeleteProxmoxCluster)
+				r.Post("/clusters/{id}/test", s.handleTestProxmoxCluster)
+			})
+
 			// Nodes and discovery
 			r.Get("/nodes", s.handleProxmoxListNodes)
 			r.Get("/guests", s.handleProxmoxListGuests)
@@ -428,6 +767,7 @@ func (s *Server) setupRoutes() {
 			r.Get("/backups/{id}", s.handleProxmoxGetBackup)
 			r.Post("/backups", s.handleProxmoxCreateBackup)
 			r.Post("/backups/all", s.handleProxmoxBackupAll)
+			r.Post("/backups/{id}/verify", s.handleProxmoxVerifyBackup)
 
 			// Restore operations
 			r.Get("/restores", s.handleProxmoxListRestores)
@@ -452,6 +792,7 @@ func (s *Server) setupRoutes() {
 			r.Put("/{id}", s.handleUpdateLibrary)
 			r.Delete("/{id}", s.handleDeleteLibrary)
 			r.Post("/{id}/inventory", s.handleLibraryInventory)
+			r.Post("/{id}/audit", s.handleLibraryAudit)
 			r.Get("/{id}/slots", s.handleListLibrarySlots)
 			r.Post("/{id}/load", s.handleLibraryLoad)
 			r.Post("/{id}/unload", s.handleLibraryUnload)
@@ -515,20 +856,27 @@ func (s *Server) auditLog(r *http.Request, action, resourceType string, resource
 	if claims, ok := r.Context().Value("claims").(*auth.Claims); ok {
 		userID = claims.UserID
 	}
-	ipAddress := r.RemoteAddr
-	if fwd := r.Header.Get("X-Forwarded-For"); fwd != "" {
-		ipAddress = fwd
-	}
+	ipAddress := clientIP(r)
 	s.db.Exec(`
 		INSERT INTO audit_logs (user_id, action, resource_type, resource_id, details, ip_address)
 		VALUES (?, ?, ?, ?, ?, ?)
 	`, userID, action, resourceType, resourceID, details, ipAddress)
 }
 
+// clientIP returns the address of the client that made the request, preferring
+// X-Forwarded-For when running behind a reverse proxy.
+func clientIP(r *http.Request) string {
+	if fwd := r.Header.Get("X-Forwarded-For"); fwd != "" {
+		return fwd
+	}
+	return r.RemoteAddr
+}
+
 // auditLogDirect records an audit log entry without an http.Request, used by
 // background goroutines that outlive the original request.
 func (s *Server) auditLogDirect(claims *auth.Claims, ipAddress, action, resourceType string, resourceID int64, details string) {
-	var userID int64
+	// System actions have no user; user_id references users so it stays NULL
+	var userID interface{}
 	if claims != nil {
 		userID = claims.UserID
 	}
@@ -558,58 +906,100 @@ func (s *Server) StartTelegramBot(ctx context.Context) {
 			return s.telegramTapesCommand()
 		case "drives":
 			return s.telegramDrivesCommand()
+		case "health":
+			return s.telegramHealthCommand()
+		case "pools":
+			return s.telegramPoolsCommand()
 		case "active":
 			return s.telegramActiveCommand()
+		case "language":
+			return s.telegramLanguageCommand(args)
 		case "help":
-			return "📼 TapeBackarr Commands:\n\n" +
-				"/status - System status & loaded tape\n" +
-				"/jobs - List backup jobs\n" +
-				"/tapes - List tapes\n" +
-				"/drives - Drive status\n" +
-				"/active - Running operations\n" +
-				"/help - This message"
+			msg := s.tgT("telegram.help.header") + "\n"
+			for _, cmd := range notifications.BotCommands {
+				msg += fmt.Sprintf("\n/%s - %s", cmd, s.tgT("telegram.cmd."+cmd))
+			}
+			return msg
 		default:
-			return "Unknown command. Use /help to see available commands."
+			return s.tgT("telegram.unknown_command")
 		}
 	})
 }
 
+// tgT renders a catalog message in the Telegram chat's language
+func (s *Server) tgT(key string, args ...interface{}) string {
+	lang := i18n.Default
+	if s.telegramService != nil {
+		lang = s.telegramService.Language()
+	}
+	return i18n.T(lang, key, args...)
+}
+
+// telegramLanguageCommand shows or changes the chat's language. The choice is
+// written back to the config file so it survives a restart.
+func (s *Server) telegramLanguageCommand(args string) string {
+	var available []string
+	for _, l := range i18n.Languages() {
+		available = append(available, string(l))
+	}
+	args = strings.TrimSpace(args)
+	if args == "" {
+		return s.tgT("telegram.language.current", s.tgT("language.name"), strings.Join(available, ", "))
+	}
+	lang, ok := i18n.Parse(args)
+	if !ok {
+		return s.tgT("telegram.language.unsupported", args, strings.Join(available, ", "))
+	}
+	if s.telegramService != nil {
+		s.telegramService.SetLanguage(lang)
+	}
+	if s.config != nil {
+		s.config.Notifications.Telegram.Language = string(lang)
+		if s.configPath != "" {
+			if err := s.config.Save(s.configPath); err != nil {
+				s.logger.Warn("Failed to save Telegram language", map[string]interface{}{"error": err.Error()})
+			}
+		}
+	}
+	return i18n.T(lang, "telegram.language.set", i18n.T(lang, "language.name"))
+}
+
 func (s *Server) telegramStatusCommand() string {
 	var totalTapes, activeTapes, totalJobs, runningJobs int
 	s.db.QueryRow("SELECT COUNT(*) FROM tapes").Scan(&totalTapes)
 	s.db.QueryRow("SELECT COUNT(*) FROM tapes WHERE status = 'active'").Scan(&activeTapes)
-	s.db.QueryRow("SELECT COUNT(*) FROM backup_jobs").Scan(&totalJobs)
+	s.db.QueryRow("SELECT COUNT(*) FROM backup_jobs WHERE ad_hoc = 0").Scan(&totalJobs)
 	s.db.QueryRow("SELECT COUNT(*) FROM backup_sets WHERE status = 'running'").Scan(&runningJobs)
 
-	msg := "📼 TapeBackarr Status\n\n"
-	msg += fmt.Sprintf("Tapes: %d total, %d active\n", totalTapes, activeTapes)
-	msg += fmt.Sprintf("Jobs: %d configured, %d running\n", totalJobs, runningJobs)
+	msg := s.tgT("telegram.status.header") + "\n\n"
+	msg += s.tgT("telegram.status.tapes", totalTapes, activeTapes) + "\n"
+	msg += s.tgT("telegram.status.jobs", totalJobs, runningJobs) + "\n"
 
 	// Drive status
 	ctx := context.Background()
 	statusCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
 	defer cancel()
-	status, err := s.tapeService.GetStatus(statusCtx)
+	status, err := s.tapeService.ProbeStatus(statusCtx)
 	if err != nil {
-		msg += "\nDrive: error"
+		msg += "\n" + s.tgT("telegram.status.drive_error")
 	} else if status.Online {
-		msg += "\nDrive: online ✅"
+		msg += "\n" + s.tgT("telegram.status.drive_online") + " ✅"
 		if cache := s.tapeService.GetLabelCache(); cache != nil {
-			if cached := cache.Get(s.tapeService.DevicePath(), 5*time.Minute); cached != nil && cached.Label != nil {
-				msg += fmt.Sprintf("\nLoaded tape: %s", cached.Label.Label)
+			if cached := cache.Get(s.tapeService.DevicePath(), tape.DefaultLabelCacheTTL); cached != nil && cached.Label != nil {
+				msg += "\n" + s.tgT("telegram.status.loaded_tape", cached.Label.Label)
 				if cached.Label.Pool != "" {
-					msg += fmt.Sprintf(" (pool: %s)", cached.Label.Pool)
+					msg += " " + s.tgT("telegram.status.pool", cached.Label.Pool)
 				}
 			}
 		}
 	} else {
-		msg += "\nDrive: offline"
+		msg += "\n" + s.tgT("telegram.status.drive_offline")
 	}
 
 	// Active jobs
 	activeJobs := s.backupService.GetActiveJobs()
 	if len(activeJobs) > 0 {
-		msg += "\n\n⚡ Active Operations:"
+		msg += "\n\n⚡ " + s.tgT("telegram.active.header") + ":"
 		for _, j := range activeJobs {
 			pct := float64(0)
 			if j.TotalBytes > 0 {
@@ -618,7 +1008,7 @@ func (s *Server) telegramStatusCommand() string {
 			msg += fmt.Sprintf("\n  %s: %s (%.1f%%)", j.JobName, j.Phase, pct)
 			if j.EstimatedSecondsRemaining > 0 {
 				eta := time.Duration(j.EstimatedSecondsRemaining) * time.Second
-				msg += fmt.Sprintf(" ETA: %s", eta.Round(time.Second))
+				msg += " " + s.tgT("telegram.status.eta", eta.Round(time.Second))
 			}
 		}
 	}
@@ -627,13 +1017,13 @@ func (s *Server) telegramStatusCommand() string {
 }
 
 func (s *Server) telegramJobsCommand() string {
-	rows, _ := s.db.Query("SELECT name, backup_type, enabled, schedule_cron, last_run_at FROM backup_jobs ORDER BY name LIMIT 20")
+	rows, _ := s.db.Query("SELECT name, backup_type, enabled, schedule_cron, last_run_at FROM backup_jobs WHERE ad_hoc = 0 ORDER BY name LIMIT 20")
 	if rows == nil {
-		return "Failed to query jobs"
+		return s.tgT("telegram.jobs.query_failed")
 	}
 	defer rows.Close()
 
-	msg := "📦 Backup Jobs\n"
+	msg := "📦 " + s.tgT("telegram.jobs.header") + "\n"
 	count := 0
 	for rows.Next() {
 		var name, backupType, cron string
@@ -644,7 +1034,7 @@ func (s *Server) telegramJobsCommand() string {
 		if !enabled {
 			status = "⏸"
 		}
-		schedStr := "manual"
+		schedStr := s.tgT("telegram.jobs.manual")
 		if cron != "" {
 			schedStr = cron
 		}
@@ -652,7 +1042,7 @@ func (s *Server) telegramJobsCommand() string {
 		count++
 	}
 	if count == 0 {
-		msg += "\nNo jobs configured"
+		msg += "\n" + s.tgT("telegram.jobs.none")
 	}
 	return msg
 }
@@ -660,11 +1050,11 @@ func (s *Server) telegramJobsCommand() string {
 func (s *Server) telegramTapesCommand() string {
 	rows, _ := s.db.Query("SELECT label, status, used_bytes, capacity_bytes FROM tapes ORDER BY label LIMIT 20")
 	if rows == nil {
-		return "Failed to query tapes"
+		return s.tgT("telegram.tapes.query_failed")
 	}
 	defer rows.Close()
 
-	msg := "💾 Tapes\n"
+	msg := "💾 " + s.tgT("telegram.tapes.header") + "\n"
 	count := 0
 	for rows.Next() {
 		var label, status string
@@ -674,34 +1064,52 @@ func (s *Server) telegramTapesCommand() string {
 		if capacity > 0 {
 			pct = float64(used) / float64(capacity) * 100
 		}
-		msg += fmt.Sprintf("\n%s: %s (%.1f%% used)", label, status, pct)
+		msg += "\n" + s.tgT("telegram.tapes.line", label, status, pct)
 		count++
 	}
 	if count == 0 {
-		msg += "\nNo tapes"
+		msg += "\n" + s.tgT("telegram.tapes.none")
 	}
 	return msg
 }
 
+// telegramDrivesCommand lists the enabled drives with their health: the
+// statistics recorded at the last statistics refresh, open alerts and the
+// space left on the loaded tape. It reads the database and the label cache
+// only, like the dashboard, so it never waits on a busy drive.
 func (s *Server) telegramDrivesCommand() string {
-	rows, _ := s.db.Query(`SELECT COALESCE(td.display_name, td.device_path), td.device_path, td.status,
-		COALESCE(td.model, ''), COALESCE(t.label, '')
+	rows, _ := s.db.Query(`SELECT td.id, COALESCE(td.display_name, td.device_path), td.device_path, td.status,
+		COALESCE(td.model, ''), COALESCE(t.label, ''), COALESCE(t.capacity_bytes, 0), COALESCE(t.used_bytes, 0),
+		COALESCE(ds.cleaning_required, 0), ds.last_cleaned_at, COALESCE(ds.read_errors, 0), COALESCE(ds.write_errors, 0),
+		(SELECT COUNT(*) FROM drive_alerts a WHERE a.drive_id = td.id AND a.resolved = 0)
 		FROM tape_drives td
 		LEFT JOIN tapes t ON td.current_tape_id = t.id
+		LEFT JOIN drive_statistics ds ON ds.drive_id = td.id
 		WHERE td.enabled = 1`)
 	if rows == nil {
-		return "Failed to query drives"
+		return s.tgT("telegram.drives.query_failed")
 	}
-	defer rows.Close()
-
-	msg := "🔌 Tape Drives\n"
-	count := 0
+	type driveRow struct {
+		name, devicePath, status, model, tapeLabel string
+		capacity, used                             int64
+		cleaningRequired                           bool
+		lastCleaned                                *time.Time
+		readErrors, writeErrors, openAlerts        int64
+	}
+	var drives []driveRow
 	for rows.Next() {
-		var name, devicePath, status, model, tapeLabel string
-		rows.Scan(&name, &devicePath, &status, &model, &tapeLabel)
+		var d driveRow
+		var id int64
+		rows.Scan(&id, &d.name, &d.devicePath, &d.status, &d.model, &d.tapeLabel, &d.capacity, &d.used,
+			&d.cleaningRequired, &d.lastCleaned, &d.readErrors, &d.writeErrors, &d.openAlerts)
+		drives = append(drives, d)
+	}
+	rows.Close()
 
+	msg := "🔌 " + s.tgT("telegram.drives.header") + "\n"
+	for _, d := range drives {
 		statusIcon := "❓"
-		switch models.DriveStatus(status) {
+		switch models.DriveStatus(d.status) {
 		case models.DriveStatusReady:
 			statusIcon = "✅"
 		case models.DriveStatusBusy:
@@ -712,19 +1120,130 @@ func (s *Server) telegramDrivesCommand() string {
 			statusIcon = "❌"
 		}
 
-		msg += fmt.Sprintf("\n%s %s", statusIcon, name)
-		if model != "" {
-			msg += fmt.Sprintf(" (%s)", model)
+		msg += fmt.Sprintf("\n%s %s", statusIcon, d.name)
+		if d.model != "" {
+			msg += fmt.Sprintf(" (%s)", d.model)
 		}
-		msg += fmt.Sprintf("\n  Path: %s | Status: %s", devicePath, status)
+		msg += "\n  " + s.tgT("telegram.drives.path", d.devicePath, d.status)
 
-		if tapeLabel != "" {
-			msg += fmt.Sprintf("\n  📼 Tape: %s", tapeLabel)
+		// Fall back to the label cache when the drive has no tape recorded
+		if cache := s.tapeService.GetLabelCache(); d.tapeLabel == "" && cache != nil {
+			if cached := cache.Get(d.devicePath, tape.DefaultLabelCacheTTL); cached != nil && cached.Label != nil {
+				d.tapeLabel = cached.Label.Label
+				s.db.QueryRow("SELECT capacity_bytes, used_bytes FROM tapes WHERE uuid = ?", cached.Label.UUID).Scan(&d.capacity, &d.used)
+			}
+		}
+		if d.tapeLabel != "" {
+			msg += "\n  📼 " + s.tgT("telegram.tape", d.tapeLabel)
+			if d.capacity > 0 {
+				free := d.capacity - d.used
+				if free < 0 {
+					free = 0
+				}
+				msg += "\n  " + s.tgT("telegram.drives.remaining", telegramFormatBytes(free), float64(free)/float64(d.capacity)*100)
+			}
+		}
+
+		if d.cleaningRequired {
+			msg += "\n  🧽 " + s.tgT("telegram.drives.cleaning_required")
+		}
+		if d.lastCleaned != nil {
+			msg += "\n  " + s.tgT("telegram.drives.last_cleaned", d.lastCleaned.Format("2006-01-02"))
+		}
+		if d.readErrors > 0 || d.writeErrors > 0 {
+			msg += "\n  ⚠️ " + s.tgT("telegram.drives.errors", d.readErrors, d.writeErrors)
+		}
+		if d.openAlerts > 0 {
+			msg += "\n  🚨 " + s.tgT("telegram.drives.alerts", d.openAlerts)
 		}
-		count++
 	}
-	if count == 0 {
-		msg += "\nNo drives configured"
+	if len(drives) == 0 {
+		msg += "\n" + s.tgT("telegram.drives.none")
+	}
+	return msg
+}
+
+// telegramHealthCommand summarizes the same components as /api/v1/health
+// plus drive alerts, the scheduler and failed backups of the last day
+func (s *Server) telegramHealthCommand() string {
+	msg := "🩺 " + s.tgT("telegram.health.header") + "\n"
+	healthy := true
+	line := func(ok bool, text string) {
+		icon := "✅"
+		if !ok {
+			icon = "⚠️"
+			healthy = false
+		}
+		msg += fmt.Sprintf("\n%s %s", icon, text)
+	}
+
+	db := s.checkDatabaseHealth()
+	line(db["status"] == "ok", s.tgT("telegram.health.database", db["status"]))
+
+	scratchHealth := s.checkScratchHealth()
+	if avail, ok := scratchHealth["available_bytes"].(int64); ok {
+		line(scratchHealth["status"] == "ok", s.tgT("telegram.health.scratch", telegramFormatBytes(avail)))
+	} else {
+		line(false, s.tgT("telegram.health.scratch", scratchHealth["status"]))
+	}
+
+	capabilities := s.checkCapabilitiesHealth()
+	if problems, ok := capabilities["problems"].([]preflight.Check); ok && capabilities["status"] != "ok" {
+		line(false, s.tgT("telegram.health.capabilities", len(problems)))
+	}
+
+	var drives, cleaning, alerts int
+	s.db.QueryRow("SELECT COUNT(*) FROM tape_drives WHERE enabled = 1").Scan(&drives)
+	s.db.QueryRow(`SELECT COUNT(*) FROM drive_statistics ds JOIN tape_drives td ON td.id = ds.drive_id
+		WHERE td.enabled = 1 AND ds.cleaning_required = 1`).Scan(&cleaning)
+	s.db.QueryRow(`SELECT COUNT(*) FROM drive_alerts a JOIN tape_drives td ON td.id = a.drive_id
+		WHERE td.enabled = 1 AND a.resolved = 0`).Scan(&alerts)
+	line(drives > 0, s.tgT("telegram.health.drives", drives))
+	if cleaning > 0 {
+		line(false, s.tgT("telegram.health.cleaning", cleaning))
+	}
+	if alerts > 0 {
+		line(false, s.tgT("telegram.health.alerts", alerts))
+	}
+
+	if s.scheduler != nil {
+		status := s.scheduler.Status(1)
+		switch {
+		case status.Paused:
+			line(false, s.tgT("telegram.health.scheduler_paused"))
+		case len(status.Errors) > 0:
+			line(false, s.tgT("telegram.health.scheduler_errors", len(status.Errors)))
+		default:
+			line(true, s.tgT("telegram.health.scheduler_ok", len(status.Jobs)))
+		}
+	}
+
+	var failed int
+	s.db.QueryRow("SELECT COUNT(*) FROM backup_sets WHERE status = 'failed' AND start_time > datetime('now', '-24 hours')").Scan(&failed)
+	line(failed == 0, s.tgT("telegram.health.failed_backups", failed))
+
+	if healthy {
+		msg += "\n\n" + s.tgT("telegram.health.ok")
+	} else {
+		msg += "\n\n" + s.tgT("telegram.health.degraded")
+	}
+	return msg
+}
+
+// telegramPoolsCommand lists the pools with the dashboard's storage totals
+func (s *Server) telegramPoolsCommand() string {
+	pools := s.poolStorage()
+	msg := "🗂 " + s.tgT("telegram.pools.header") + "\n"
+	for _, p := range pools {
+		pct := float64(0)
+		if p.TotalCapacityBytes > 0 {
+			pct = float64(p.TotalUsedBytes) / float64(p.TotalCapacityBytes) * 100
+		}
+		msg += "\n" + s.tgT("telegram.pools.line", p.Name, p.TapeCount, telegramFormatBytes(p.TotalUsedBytes),
+			telegramFormatBytes(p.TotalCapacityBytes), pct, telegramFormatBytes(p.TotalFreeBytes))
+	}
+	if len(pools) == 0 {
+		msg += "\n" + s.tgT("telegram.pools.none")
 	}
 	return msg
 }
@@ -732,15 +1251,15 @@ func (s *Server) telegramDrivesCommand() string {
 func (s *Server) telegramActiveCommand() string {
 	activeJobs := s.backupService.GetActiveJobs()
 	if len(activeJobs) == 0 {
-		return "No active operations"
+		return s.tgT("telegram.active.none")
 	}
 
-	msg := "⚡ Active Operations\n"
+	msg := "⚡ " + s.tgT("telegram.active.header") + "\n"
 	for _, j := range activeJobs {
 		// Job name and status
 		msg += fmt.Sprintf("\n📦 %s", j.JobName)
 		if j.Status == "paused" {
-			msg += " [PAUSED]"
+			msg += " [" + s.tgT("telegram.active.paused") + "]"
 		}
 
 		// Phase-specific icon
@@ -763,11 +1282,11 @@ func (s *Server) telegramActiveCommand() string {
 		case "failed":
 			phaseIcon = "❌"
 		}
-		msg += fmt.Sprintf("\n  %s Phase: %s", phaseIcon, j.Phase)
+		msg += fmt.Sprintf("\n  %s %s", phaseIcon, s.tgT("telegram.active.phase", j.Phase))
 
 		// Tape info
 		if j.TapeLabel != "" {
-			msg += fmt.Sprintf("\n  📼 Tape: %s", j.TapeLabel)
+			msg += "\n  📼 " + s.tgT("telegram.tape", j.TapeLabel)
 		}
 		if j.DevicePath != "" {
 			msg += fmt.Sprintf("\n  🖴 %s", j.DevicePath)
@@ -776,8 +1295,8 @@ func (s *Server) telegramActiveCommand() string {
 		// Elapsed time and start time
 		if !j.StartTime.IsZero() {
 			elapsed := time.Since(j.StartTime)
-			msg += fmt.Sprintf("\n  ⏱ Elapsed: %s", telegramFormatDuration(elapsed))
-			msg += fmt.Sprintf("\n  Started: %s", j.StartTime.Format("15:04:05"))
+			msg += "\n  ⏱ " + s.tgT("telegram.active.elapsed", telegramFormatDuration(elapsed))
+			msg += "\n  " + s.tgT("telegram.active.started", j.StartTime.Format("15:04:05"))
 		}
 
 		// Job progress
@@ -785,48 +1304,48 @@ func (s *Server) telegramActiveCommand() string {
 		if j.TotalBytes > 0 {
 			jobPct = float64(j.BytesWritten) / float64(j.TotalBytes) * 100
 		}
-		msg += fmt.Sprintf("\n  Job Progress: %.1f%%", jobPct)
+		msg += "\n  " + s.tgT("telegram.active.job_progress", jobPct)
 
 		// Tape used
 		if j.TapeCapacityBytes > 0 {
 			tapePct := telegramTapeUsedPercent(j.TapeUsedBytes, j.BytesWritten, j.TapeCapacityBytes)
-			msg += fmt.Sprintf("\n  Tape Used: %.1f%%", tapePct)
+			msg += "\n  " + s.tgT("telegram.active.tape_used", tapePct)
 		}
 
 		// Written
-		msg += fmt.Sprintf("\n  Written: %s / %s", telegramFormatBytes(j.BytesWritten), telegramFormatBytes(j.TotalBytes))
+		msg += "\n  " + s.tgT("telegram.active.written", telegramFormatBytes(j.BytesWritten), telegramFormatBytes(j.TotalBytes))
 
 		// Speed and ETAs — only meaningful during streaming phase
 		if j.Phase == "cataloging" {
-			msg += fmt.Sprintf("\n  📋 Cataloging %d/%d files...", j.FileCount, j.TotalFiles)
+			msg += "\n  📋 " + s.tgT("telegram.active.cataloging", j.FileCount, j.TotalFiles)
 		} else {
 			// Speed
 			if j.WriteSpeed > 0 {
-				msg += fmt.Sprintf("\n  Speed: %s/s", telegramFormatBytes(int64(j.WriteSpeed)))
+				msg += "\n  " + s.tgT("telegram.active.speed", telegramFormatBytes(int64(j.WriteSpeed))+"/s")
 			} else {
-				msg += "\n  Speed: ---"
+				msg += "\n  " + s.tgT("telegram.active.speed", "---")
 			}
 
 			// Job ETA
 			if j.EstimatedSecondsRemaining > 0 {
-				msg += fmt.Sprintf("\n  Job ETA: %s", telegramFormatDuration(time.Duration(j.EstimatedSecondsRemaining)*time.Second))
+				msg += "\n  " + s.tgT("telegram.active.job_eta", telegramFormatDuration(time.Duration(j.EstimatedSecondsRemaining)*time.Second))
 			} else {
-				msg += "\n  Job ETA: ---"
+				msg += "\n  " + s.tgT("telegram.active.job_eta", "---")
 			}
 
 			// Tape ETA
 			if j.TapeEstimatedSecondsRemaining > 0 {
-				msg += fmt.Sprintf("\n  Tape ETA: %s", telegramFormatDuration(time.Duration(j.TapeEstimatedSecondsRemaining)*time.Second))
+				msg += "\n  " + s.tgT("telegram.active.tape_eta", telegramFormatDuration(time.Duration(j.TapeEstimatedSecondsRemaining)*time.Second))
 			}
 
 			// Files
-			msg += fmt.Sprintf("\n  Files: %d/%d", j.FileCount, j.TotalFiles)
+			msg += "\n  " + s.tgT("telegram.active.files", j.FileCount, j.TotalFiles)
 		}
 
 		// Tape space
 		if j.TapeCapacityBytes > 0 {
 			free := telegramTapeFreeBytes(j.TapeUsedBytes, j.BytesWritten, j.TapeCapacityBytes)
-			msg += fmt.Sprintf("\n  Tape Space: %s free", telegramFormatBytes(free))
+			msg += "\n  " + s.tgT("telegram.active.tape_space", telegramFormatBytes(free))
 		}
 		msg += "\n"
 	}
@@ -944,6 +1463,10 @@ func (s *Server) adminOnlyMiddleware(next http.Handler) http.Handler {
 			s.respondError(w, http.StatusForbidden, "admin access required")
 			return
 		}
+		if msg := s.checkManagementNetwork(r); msg != "" {
+			s.respondError(w, http.StatusForbidden, msg)
+			return
+		}
 		next.ServeHTTP(w, r)
 	})
 }
@@ -956,8 +1479,9 @@ func (s *Server) respondJSON(w http.ResponseWriter, status int, data interface{}
 	json.NewEncoder(w).Encode(data)
 }
 
+// respondError writes an error response whose code follows from the status
 func (s *Server) respondError(w http.ResponseWriter, status int, message string) {
-	s.respondJSON(w, status, map[string]string{"error": message})
+	s.respondErrorCode(w, status, statusErrorCode(status), message, nil)
 }
 
 func (s *Server) getIDParam(r *http.Request) (int64, error) {
@@ -977,8 +1501,12 @@ func (s *Server) handleLogin(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	token, user, err := s.authService.Login(req.Username, req.Password)
+	token, user, err := s.authService.LoginFrom(req.Username, req.Password, clientIP(r))
 	if err != nil {
+		if errors.Is(err, auth.ErrAccountLocked) {
+			s.respondError(w, http.StatusLocked, "account locked after too many failed login attempts; contact an administrator")
+			return
+		}
 		s.respondError(w, http.StatusUnauthorized, "invalid credentials")
 		return
 	}
@@ -995,16 +1523,45 @@ func (s *Server) handleLogin(w http.ResponseWriter, r *http.Request) {
 
 // Dashboard handlers
 
-func (s *Server) handleDashboard(w http.ResponseWriter, r *http.Request) {
-	type PoolStorageStats struct {
-		ID                 int64  `json:"id"`
-		Name               string `json:"name"`
-		TapeCount          int    `json:"tape_count"`
-		TotalCapacityBytes int64  `json:"total_capacity_bytes"`
-		TotalUsedBytes     int64  `json:"total_used_bytes"`
-		TotalFreeBytes     int64  `json:"total_free_bytes"`
+// poolStorageStats is a pool's tape count and capacity as shown on the
+// dashboard and by the Telegram /pools command
+type poolStorageStats struct {
+	ID                 int64  `json:"id"`
+	Name               string `json:"name"`
+	TapeCount          int    `json:"tape_count"`
+	TotalCapacityBytes int64  `json:"total_capacity_bytes"`
+	TotalUsedBytes     int64  `json:"total_used_bytes"`
+	TotalFreeBytes     int64  `json:"total_free_bytes"`
+}
+
+// poolStorage returns the storage totals of every pool, ordered by name
+func (s *Server) poolStorage() []poolStorageStats {
+	pools := make([]poolStorageStats, 0)
+	rows, err := s.db.Query(`
+		SELECT tp.id, tp.name,
+		       COUNT(t.id) as tape_count,
+		       COALESCE(SUM(t.capacity_bytes), 0) as total_capacity_bytes,
+		       COALESCE(SUM(t.used_bytes), 0) as total_used_bytes
+		FROM tape_pools tp
+		LEFT JOIN tapes t ON t.pool_id = tp.id
+		GROUP BY tp.id
+		ORDER BY tp.name
+	`)
+	if err != nil {
+		return pools
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var ps poolStorageStats
+		if err := rows.Scan(&ps.ID, &ps.Name, &ps.TapeCount, &ps.TotalCapacityBytes, &ps.TotalUsedBytes); err == nil {
+			ps.TotalFreeBytes = ps.TotalCapacityBytes - ps.TotalUsedBytes
+			pools = append(pools, ps)
+		}
 	}
+	return pools
+}
 
+func (s *Server) handleDashboard(w http.ResponseWriter, r *http.Request) {
 	var stats struct {
 		TotalTapes            int                `json:"total_tapes"`
 		ActiveTapes           int                `json:"active_tapes"`
@@ -1020,23 +1577,24 @@ func (s *Server) handleDashboard(w http.ResponseWriter, r *http.Request) {
 		LoadedTapeEncKeyFP    string             `json:"loaded_tape_enc_key_fingerprint"`
 		LoadedTapeCompression string             `json:"loaded_tape_compression"`
 		LoadedTapeFormatType  string             `json:"loaded_tape_format_type"`
-		PoolStorage           []PoolStorageStats `json:"pool_storage"`
+		PoolStorage           []poolStorageStats `json:"pool_storage"`
 		TotalFilesCataloged   int64              `json:"total_files_cataloged"`
 		TotalSources          int                `json:"total_sources"`
 		TotalEncryptionKeys   int                `json:"total_encryption_keys"`
 		LastBackupTime        *string            `json:"last_backup_time"`
 		TotalBackupSets       int                `json:"total_backup_sets"`
 		OldestBackup          *string            `json:"oldest_backup"`
+		RPOViolations         []backup.Freshness `json:"rpo_violations"`
 	}
 
 	s.db.QueryRow("SELECT COUNT(*) FROM tapes").Scan(&stats.TotalTapes)
 	s.db.QueryRow("SELECT COUNT(*) FROM tapes WHERE status = 'active'").Scan(&stats.ActiveTapes)
-	s.db.QueryRow("SELECT COUNT(*) FROM backup_jobs").Scan(&stats.TotalJobs)
+	s.db.QueryRow("SELECT COUNT(*) FROM backup_jobs WHERE ad_hoc = 0").Scan(&stats.TotalJobs)
 	s.db.QueryRow("SELECT COUNT(*) FROM backup_sets WHERE status = 'running'").Scan(&stats.RunningJobs)
 	s.db.QueryRow("SELECT COUNT(*) FROM backup_sets WHERE start_time > datetime('now', '-24 hours')").Scan(&stats.RecentBackups)
 	s.db.QueryRow("SELECT COALESCE(SUM(total_bytes), 0) FROM backup_sets WHERE status = 'completed'").Scan(&stats.TotalDataBytes)
 	s.db.QueryRow("SELECT COALESCE(SUM(file_count), 0) FROM backup_sets WHERE status = 'completed'").Scan(&stats.TotalFilesCataloged)
-	s.db.QueryRow("SELECT COUNT(*) FROM backup_sources").Scan(&stats.TotalSources)
+	s.db.QueryRow("SELECT COUNT(*) FROM backup_sources WHERE ad_hoc = 0").Scan(&stats.TotalSources)
 	s.db.QueryRow("SELECT COUNT(*) FROM encryption_keys").Scan(&stats.TotalEncryptionKeys)
 	s.db.QueryRow("SELECT COUNT(*) FROM backup_sets WHERE status = 'completed'").Scan(&stats.TotalBackupSets)
 
@@ -1045,29 +1603,19 @@ func (s *Server) handleDashboard(w http.ResponseWriter, r *http.Request) {
 	stats.LastBackupTime = lastBackup
 	stats.OldestBackup = oldestBackup
 
-	// Get per-pool storage stats
-	stats.PoolStorage = make([]PoolStorageStats, 0)
-	poolRows, err := s.db.Query(`
-		SELECT tp.id, tp.name,
-		       COUNT(t.id) as tape_count,
-		       COALESCE(SUM(t.capacity_bytes), 0) as total_capacity_bytes,
-		       COALESCE(SUM(t.used_bytes), 0) as total_used_bytes
-		FROM tape_pools tp
-		LEFT JOIN tapes t ON t.pool_id = tp.id
-		GROUP BY tp.id
-		ORDER BY tp.name
-	`)
-	if err == nil {
-		defer poolRows.Close()
-		for poolRows.Next() {
-			var ps PoolStorageStats
-			if err := poolRows.Scan(&ps.ID, &ps.Name, &ps.TapeCount, &ps.TotalCapacityBytes, &ps.TotalUsedBytes); err == nil {
-				ps.TotalFreeBytes = ps.TotalCapacityBytes - ps.TotalUsedBytes
-				stats.PoolStorage = append(stats.PoolStorage, ps)
+	// Sources that are overdue for a backup
+	stats.RPOViolations = []backup.Freshness{}
+	if report, err := s.freshness(); err == nil {
+		for _, src := range report.Sources {
+			if src.Violation {
+				stats.RPOViolations = append(stats.RPOViolations, src)
 			}
 		}
 	}
 
+	// Get per-pool storage stats
+	stats.PoolStorage = s.poolStorage()
+
 	// Get drive status and loaded tape label
 	// First check if there are active backup jobs - if so, skip tape operations
 	// to avoid blocking the dashboard on mutex contention with running jobs.
@@ -1101,14 +1649,14 @@ func (s *Server) handleDashboard(w http.ResponseWriter, r *http.Request) {
 		ctx := r.Context()
 		statusCtx, statusCancel := context.WithTimeout(ctx, 10*time.Second)
 		defer statusCancel()
-		status, err := s.tapeService.GetStatus(statusCtx)
+		status, err := s.tapeService.ProbeStatus(statusCtx)
 		if err != nil {
 			stats.DriveStatus = "error"
 		} else if status.Online {
 			stats.DriveStatus = "online"
 			// Use cached label data to avoid rewinding the tape on every dashboard load
 			if cache := s.tapeService.GetLabelCache(); cache != nil {
-				if cached := cache.Get(s.tapeService.DevicePath(), 5*time.Minute); cached != nil {
+				if cached := cache.Get(s.tapeService.DevicePath(), tape.DefaultLabelCacheTTL); cached != nil {
 					if cached.Label != nil {
 						stats.LoadedTape = cached.Label.Label
 						stats.LoadedTapeUUID = cached.Label.UUID
@@ -1126,7 +1674,7 @@ func (s *Server) handleDashboard(w http.ResponseWriter, r *http.Request) {
 					// Cache miss - read label and cache it
 					labelCtx, labelCancel := context.WithTimeout(ctx, 5*time.Second)
 					defer labelCancel()
-					if labelData, err := s.tapeService.ReadTapeLabel(labelCtx); err == nil && labelData != nil {
+					if labelData, err := s.tapeService.ProbeLabel(labelCtx); err == nil && labelData != nil {
 						stats.LoadedTape = labelData.Label
 						stats.LoadedTapeUUID = labelData.UUID
 						stats.LoadedTapePool = labelData.Pool
@@ -1169,7 +1717,8 @@ func (s *Server) handleListTapes(w http.ResponseWriter, r *http.Request) {
 		SELECT t.id, t.uuid, t.barcode, t.label, COALESCE(t.lto_type, '') as lto_type, t.pool_id, tp.name as pool_name, t.status, 
 		       t.capacity_bytes, t.used_bytes, t.write_count, t.last_written_at, t.labeled_at, t.created_at,
 		       COALESCE(t.encryption_key_fingerprint, '') as encryption_key_fingerprint,
-		       COALESCE(t.encryption_key_name, '') as encryption_key_name
+		       COALESCE(t.encryption_key_name, '') as encryption_key_name,
+		       t.reuse_state, t.reuse_requested_at, t.physical_remaining_bytes, t.physical_remaining_at
 		FROM tapes t
 		LEFT JOIN tape_pools tp ON t.pool_id = tp.id
 		ORDER BY t.label
@@ -1188,7 +1737,7 @@ func (s *Server) handleListTapes(w http.ResponseWriter, r *http.Request) {
 		var encFingerprint, encKeyName string
 		if err := rows.Scan(&t.ID, &t.UUID, &t.Barcode, &t.Label, &ltoType, &t.PoolID, &poolName, &t.Status,
 			&t.CapacityBytes, &t.UsedBytes, &t.WriteCount, &t.LastWrittenAt, &t.LabeledAt, &t.CreatedAt,
-			&encFingerprint, &encKeyName); err != nil {
+			&encFingerprint, &encKeyName, &t.ReuseState, &t.ReuseRequested, &t.PhysicalRemainingBytes, &t.PhysicalRemainingAt); err != nil {
 			continue
 		}
 		tape := map[string]interface{}{
@@ -1208,6 +1757,11 @@ func (s *Server) handleListTapes(w http.ResponseWriter, r *http.Request) {
 			"created_at":                 t.CreatedAt,
 			"encryption_key_fingerprint": encFingerprint,
 			"encryption_key_name":        encKeyName,
+			"reuse_state":                t.ReuseState,
+			"reuse_requested_at":         t.ReuseRequested,
+			"remaining_bytes":            max(t.CapacityBytes-t.UsedBytes, 0),
+			"physical_remaining_bytes":   t.PhysicalRemainingBytes,
+			"physical_remaining_at":      t.PhysicalRemainingAt,
 		}
 		tapes = append(tapes, tape)
 	}
@@ -1237,18 +1791,17 @@ func (s *Server) handleCreateTape(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Default format type to raw
-	if req.FormatType == "" {
-		req.FormatType = string(models.TapeFormatRaw)
-	}
-	if req.FormatType != string(models.TapeFormatRaw) && req.FormatType != string(models.TapeFormatLTFS) {
-		s.respondError(w, http.StatusBadRequest, "format_type must be 'raw' or 'ltfs'")
+	// Default format type to the pool's, or raw
+	formatType, err := s.tapeFormatForPool(req.PoolID, req.FormatType)
+	if err != nil {
+		s.respondError(w, http.StatusBadRequest, err.Error())
 		return
 	}
+	req.FormatType = formatType
 
 	// LTFS format requires a drive and write_label to be set
 	if req.FormatType == string(models.TapeFormatLTFS) && req.WriteLabel && !tape.IsAvailable() {
-		s.respondError(w, http.StatusServiceUnavailable, "LTFS software not installed on this system")
+		s.respondErrorCode(w, http.StatusServiceUnavailable, codeNotConfigured, "LTFS software not installed on this system", nil)
 		return
 	}
 
@@ -1277,7 +1830,7 @@ func (s *Server) handleCreateTape(w http.ResponseWriter, r *http.Request) {
 	var existingCount int
 	s.db.QueryRow("SELECT COUNT(*) FROM tapes WHERE label = ?", req.Label).Scan(&existingCount)
 	if existingCount > 0 {
-		s.respondError(w, http.StatusConflict, "a tape with this label already exists in the database")
+		s.respondErrorCode(w, http.StatusConflict, codeAlreadyExists, "a tape with this label already exists in the database", nil)
 		return
 	}
 
@@ -1285,7 +1838,7 @@ func (s *Server) handleCreateTape(w http.ResponseWriter, r *http.Request) {
 	if req.Barcode != "" {
 		s.db.QueryRow("SELECT COUNT(*) FROM tapes WHERE barcode = ? AND barcode != ''", req.Barcode).Scan(&existingCount)
 		if existingCount > 0 {
-			s.respondError(w, http.StatusConflict, "a tape with this barcode already exists in the database")
+			s.respondErrorCode(w, http.StatusConflict, codeAlreadyExists, "a tape with this barcode already exists in the database", nil)
 			return
 		}
 	}
@@ -1414,7 +1967,7 @@ func (s *Server) handleCreateTape(w http.ResponseWriter, r *http.Request) {
 			if err := rows.Scan(&driveID, &devicePath); err == nil {
 				// Check if this drive has cached label data matching our new tape
 				if mainCache := s.tapeService.GetLabelCache(); mainCache != nil {
-					if cached := mainCache.Get(devicePath, 5*time.Minute); cached != nil && cached.Label != nil {
+					if cached := mainCache.Get(devicePath, tape.DefaultLabelCacheTTL); cached != nil && cached.Label != nil {
 						if cached.Label.Label == req.Label && cached.Label.UUID != "" {
 							// Clear notification for the original UUID too
 							s.notifiedUnknownTapes.Delete(cached.Label.UUID)
@@ -1429,8 +1982,8 @@ func (s *Server) handleCreateTape(w http.ResponseWriter, r *http.Request) {
 		s.eventBus.Publish(SystemEvent{
 			Type:     "success",
 			Category: "tape",
-			Title:    "Tape Added",
-			Message:  fmt.Sprintf("Tape '%s' has been added to the library", req.Label),
+			Key:      "tape_added",
+			Args:     []interface{}{req.Label},
 			Details: map[string]interface{}{
 				"label":    req.Label,
 				"uuid":     tapeUUID,
@@ -1455,14 +2008,17 @@ func (s *Server) handleGetTape(w http.ResponseWriter, r *http.Request) {
 	var t models.Tape
 	err = s.db.QueryRow(`
 		SELECT id, uuid, barcode, label, pool_id, status, capacity_bytes, used_bytes, 
-		       write_count, last_written_at, offsite_location, export_time, import_time, labeled_at, created_at, updated_at
+		       write_count, last_written_at, offsite_location, export_time, import_time, labeled_at,
+		       reuse_state, reuse_requested_at, physical_remaining_bytes, physical_remaining_at, created_at, updated_at
 		FROM tapes WHERE id = ?
 	`, id).Scan(&t.ID, &t.UUID, &t.Barcode, &t.Label, &t.PoolID, &t.Status, &t.CapacityBytes, &t.UsedBytes,
-		&t.WriteCount, &t.LastWrittenAt, &t.OffsiteLocation, &t.ExportTime, &t.ImportTime, &t.LabeledAt, &t.CreatedAt, &t.UpdatedAt)
+		&t.WriteCount, &t.LastWrittenAt, &t.OffsiteLocation, &t.ExportTime, &t.ImportTime, &t.LabeledAt,
+		&t.ReuseState, &t.ReuseRequested, &t.PhysicalRemainingBytes, &t.PhysicalRemainingAt, &t.CreatedAt, &t.UpdatedAt)
 	if err != nil {
 		s.respondError(w, http.StatusNotFound, "tape not found")
 		return
 	}
+	t.RemainingBytes = max(t.CapacityBytes-t.UsedBytes, 0)
 
 	s.respondJSON(w, http.StatusOK, t)
 }
@@ -1480,6 +2036,8 @@ func (s *Server) handleUpdateTape(w http.ResponseWriter, r *http.Request) {
 		PoolID          *int64             `json:"pool_id"`
 		Status          *models.TapeStatus `json:"status"`
 		OffsiteLocation *string            `json:"offsite_location"`
+		// Force expires the tape even if sets on other tapes depend on its sets
+		Force bool `json:"force"`
 	}
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		s.respondError(w, http.StatusBadRequest, "invalid request body")
@@ -1527,6 +2085,20 @@ func (s *Server) handleUpdateTape(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
+	// Expiring the tape expires its sets; warn if sets elsewhere need them
+	var expiring []int64
+	var breaks []chainBreak
+	if req.Status != nil && *req.Status == models.TapeStatusExpired && currentStatus != string(models.TapeStatusExpired) {
+		if expiring, err = s.setsOnTape(id); err != nil {
+			s.respondError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		var ok bool
+		if breaks, ok = s.checkChainBreaks(w, expiring, chainLostExpired, req.Force); !ok {
+			return
+		}
+	}
+
 	// Build dynamic update query
 	updates := []string{}
 	args := []interface{}{}
@@ -1546,6 +2118,9 @@ func (s *Server) handleUpdateTape(w http.ResponseWriter, r *http.Request) {
 	if req.Status != nil {
 		updates = append(updates, "status = ?")
 		args = append(args, *req.Status)
+		if string(*req.Status) != currentStatus {
+			updates = append(updates, clearTapeReuse)
+		}
 	}
 	if req.OffsiteLocation != nil {
 		updates = append(updates, "offsite_location = ?")
@@ -1566,6 +2141,7 @@ func (s *Server) handleUpdateTape(w http.ResponseWriter, r *http.Request) {
 		s.respondError(w, http.StatusInternalServerError, err.Error())
 		return
 	}
+	s.flagChainBreaks(breaks, expiring)
 
 	s.respondJSON(w, http.StatusOK, map[string]string{"status": "updated"})
 }
@@ -1588,6 +2164,15 @@ func (s *Server) handleDeleteTape(w http.ResponseWriter, r *http.Request) {
 		s.respondError(w, http.StatusConflict, "cannot delete tape with status '"+status+"' - retire or format it first")
 		return
 	}
+	removed, err := s.setsOnTape(id)
+	if err != nil {
+		s.respondError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	breaks, ok := s.checkChainBreaks(w, removed, chainLostDeleted, r.URL.Query().Get("force") == "true")
+	if !ok {
+		return
+	}
 
 	// Clear foreign key references before deleting the tape
 	s.db.Exec("UPDATE tape_drives SET current_tape_id = NULL WHERE current_tape_id = ?", id)
@@ -1602,6 +2187,7 @@ func (s *Server) handleDeleteTape(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	s.flagChainBreaks(breaks, removed)
 	s.auditLog(r, "delete", "tape", id, "Deleted tape")
 
 	s.respondJSON(w, http.StatusOK, map[string]string{"status": "deleted"})
@@ -1613,6 +2199,8 @@ func (s *Server) handleBatchUpdateTapes(w http.ResponseWriter, r *http.Request)
 		TapeIDs []int64            `json:"tape_ids"`
 		Status  *models.TapeStatus `json:"status"`
 		PoolID  *int64             `json:"pool_id"`
+		// Force expires tapes even if sets on other tapes depend on their sets
+		Force bool `json:"force"`
 	}
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		s.respondError(w, http.StatusBadRequest, "invalid request body")
@@ -1628,8 +2216,27 @@ func (s *Server) handleBatchUpdateTapes(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
+	// Expiring tapes expires their sets; warn if sets elsewhere need them
+	var breaks []chainBreak
+	if req.Status != nil && *req.Status == models.TapeStatusExpired {
+		var sets []int64
+		for _, tapeID := range req.TapeIDs {
+			ids, err := s.setsOnTape(tapeID)
+			if err != nil {
+				s.respondError(w, http.StatusInternalServerError, err.Error())
+				return
+			}
+			sets = append(sets, ids...)
+		}
+		var ok bool
+		if breaks, ok = s.checkChainBreaks(w, sets, chainLostExpired, req.Force); !ok {
+			return
+		}
+	}
+
 	updated := 0
 	skipped := 0
+	var expired []int64
 	for _, tapeID := range req.TapeIDs {
 		// Get current state
 		var currentStatus string
@@ -1657,6 +2264,9 @@ func (s *Server) handleBatchUpdateTapes(w http.ResponseWriter, r *http.Request)
 		if req.Status != nil {
 			updates = append(updates, "status = ?")
 			args = append(args, *req.Status)
+			if string(*req.Status) != currentStatus {
+				updates = append(updates, clearTapeReuse)
+			}
 		}
 		if req.PoolID != nil {
 			updates = append(updates, "pool_id = ?")
@@ -1672,7 +2282,12 @@ func (s *Server) handleBatchUpdateTapes(w http.ResponseWriter, r *http.Request)
 			continue
 		}
 		updated++
+		if len(breaks) > 0 {
+			ids, _ := s.setsOnTape(tapeID)
+			expired = append(expired, ids...)
+		}
 	}
+	s.flagChainBreaks(breaks, expired)
 
 	s.auditLog(r, "batch_update", "tape", 0, fmt.Sprintf("Batch updated %d tapes (skipped %d)", updated, skipped))
 
@@ -1742,7 +2357,7 @@ func (s *Server) handleLabelTape(w http.ResponseWriter, r *http.Request) {
 	if s.tapeOp.running {
 		s.tapeOp.mu.Unlock()
 		cancel()
-		s.respondError(w, http.StatusConflict, "a tape operation is already in progress")
+		s.respondErrorCode(w, http.StatusConflict, codeOperationInProgress, "a tape operation is already in progress", nil)
 		return
 	}
 	s.tapeOp.running = true
@@ -1783,8 +2398,8 @@ func (s *Server) runLabelTape(ctx context.Context, id int64, label, devicePath s
 			s.eventBus.Publish(SystemEvent{
 				Type:     "info",
 				Category: "tape",
-				Title:    "Label Progress",
-				Message:  message,
+				Key:      "label_progress",
+				Args:     []interface{}{message},
 				Details:  map[string]interface{}{"label": label, "device": devicePath, "phase": phase},
 			})
 		}
@@ -1800,8 +2415,8 @@ func (s *Server) runLabelTape(ctx context.Context, id int64, label, devicePath s
 			s.eventBus.Publish(SystemEvent{
 				Type:     "error",
 				Category: "tape",
-				Title:    "Label Failed",
-				Message:  errMsg,
+				Key:      "label_failed",
+				Args:     []interface{}{errMsg},
 				Details:  map[string]interface{}{"label": label, "device": devicePath, "phase": "failed"},
 			})
 		}
@@ -1836,8 +2451,8 @@ func (s *Server) runLabelTape(ctx context.Context, id int64, label, devicePath s
 				s.eventBus.Publish(SystemEvent{
 					Type:     "warning",
 					Category: "tape",
-					Title:    "Physical Label Write Failed",
-					Message:  fmt.Sprintf("Could not write label to tape: %s. Continuing with software tracking.", err.Error()),
+					Key:      "physical_label_write_failed",
+					Args:     []interface{}{err.Error()},
 				})
 			}
 			s.logger.Warn("Failed to write label to physical tape, continuing with software tracking", map[string]interface{}{
@@ -1884,6 +2499,7 @@ func (s *Server) runLabelTape(ctx context.Context, id int64, label, devicePath s
 		setError("Failed to update database: " + err.Error())
 		return
 	}
+	s.markTapeRelabelled(id)
 
 	s.tapeOp.mu.Lock()
 	s.tapeOp.phase = "complete"
@@ -1895,8 +2511,8 @@ func (s *Server) runLabelTape(ctx context.Context, id int64, label, devicePath s
 		s.eventBus.Publish(SystemEvent{
 			Type:     "success",
 			Category: "tape",
-			Title:    "Tape Labeled",
-			Message:  fmt.Sprintf("Tape labeled as '%s' (UUID: %s)", label, tapeUUID),
+			Key:      "tape_labeled",
+			Args:     []interface{}{label, tapeUUID},
 			Details:  map[string]interface{}{"label": label, "uuid": tapeUUID, "pool": poolName},
 		})
 	}
@@ -1906,9 +2522,38 @@ func (s *Server) runLabelTape(ctx context.Context, id int64, label, devicePath s
 
 // Pool handlers
 
+// poolFormatTypes are the accepted values of a pool's format_type. The empty
+// string lets the pool hold tapes of either format.
+var poolFormatTypes = []string{"", string(models.TapeFormatRaw), string(models.TapeFormatLTFS)}
+
+// tapeFormatForPool resolves the format of a tape labelled into a pool. An
+// empty requested format takes the pool's, or raw when the pool has none; a
+// format other than the pool's is rejected.
+func (s *Server) tapeFormatForPool(poolID *int64, requested string) (string, error) {
+	if requested != "" && requested != string(models.TapeFormatRaw) && requested != string(models.TapeFormatLTFS) {
+		return "", errors.New("format_type must be 'raw' or 'ltfs'")
+	}
+	var poolFormat string
+	if poolID != nil {
+		_ = s.db.QueryRow("SELECT COALESCE(format_type, '') FROM tape_pools WHERE id = ?", *poolID).Scan(&poolFormat)
+	}
+	switch {
+	case poolFormat == "":
+		if requested == "" {
+			return string(models.TapeFormatRaw), nil
+		}
+		return requested, nil
+	case requested == "" || requested == poolFormat:
+		return poolFormat, nil
+	default:
+		return "", fmt.Errorf("format_type must be '%s' for tapes in this pool", poolFormat)
+	}
+}
+
 func (s *Server) handleListPools(w http.ResponseWriter, r *http.Request) {
 	rows, err := s.db.Query(`
-		SELECT tp.id, tp.name, tp.description, tp.retention_days, tp.allow_reuse, tp.allocation_policy, tp.created_at,
+		SELECT tp.id, tp.name, tp.description, tp.retention_days, tp.allow_reuse, tp.allocation_policy,
+		       tp.reuse_approval, tp.reuse_grace_hours, COALESCE(tp.format_type, ''), tp.created_at,
 		       COUNT(t.id) as tape_count,
 		       COALESCE(SUM(t.capacity_bytes), 0) as total_capacity_bytes,
 		       COALESCE(SUM(t.used_bytes), 0) as total_used_bytes
@@ -1928,7 +2573,8 @@ func (s *Server) handleListPools(w http.ResponseWriter, r *http.Request) {
 		var p models.TapePool
 		var tapeCount int
 		var totalCapacity, totalUsed int64
-		if err := rows.Scan(&p.ID, &p.Name, &p.Description, &p.RetentionDays, &p.AllowReuse, &p.AllocationPolicy, &p.CreatedAt, &tapeCount, &totalCapacity, &totalUsed); err != nil {
+		if err := rows.Scan(&p.ID, &p.Name, &p.Description, &p.RetentionDays, &p.AllowReuse, &p.AllocationPolicy,
+			&p.ReuseApproval, &p.ReuseGraceHours, &p.FormatType, &p.CreatedAt, &tapeCount, &totalCapacity, &totalUsed); err != nil {
 			continue
 		}
 		pools = append(pools, map[string]interface{}{
@@ -1938,6 +2584,9 @@ func (s *Server) handleListPools(w http.ResponseWriter, r *http.Request) {
 			"retention_days":       p.RetentionDays,
 			"allow_reuse":          p.AllowReuse,
 			"allocation_policy":    p.AllocationPolicy,
+			"reuse_approval":       p.ReuseApproval,
+			"reuse_grace_hours":    p.ReuseGraceHours,
+			"format_type":          p.FormatType,
 			"tape_count":           tapeCount,
 			"total_capacity_bytes": totalCapacity,
 			"total_used_bytes":     totalUsed,
@@ -1956,6 +2605,9 @@ func (s *Server) handleCreatePool(w http.ResponseWriter, r *http.Request) {
 		RetentionDays    int    `json:"retention_days"`
 		AllowReuse       *bool  `json:"allow_reuse"`
 		AllocationPolicy string `json:"allocation_policy"`
+		ReuseApproval    bool   `json:"reuse_approval"`
+		ReuseGraceHours  int    `json:"reuse_grace_hours"`
+		FormatType       string `json:"format_type"` // "" accepts raw and LTFS tapes
 	}
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		s.respondError(w, http.StatusBadRequest, "invalid request body")
@@ -1967,13 +2619,23 @@ func (s *Server) handleCreatePool(w http.ResponseWriter, r *http.Request) {
 		allowReuse = *req.AllowReuse
 	}
 	if req.AllocationPolicy == "" {
-		req.AllocationPolicy = "continue"
+		req.AllocationPolicy = models.AllocationContinue
+	}
+	v := validation.New()
+	v.Required("name", req.Name)
+	v.NonNegative("retention_days", int64(req.RetentionDays))
+	v.OneOf("allocation_policy", req.AllocationPolicy, allocationPolicies...)
+	v.NonNegative("reuse_grace_hours", int64(req.ReuseGraceHours))
+	v.OneOf("format_type", req.FormatType, poolFormatTypes...)
+	if err := v.Err(); err != nil {
+		s.respondValidationError(w, err)
+		return
 	}
 
 	result, err := s.db.Exec(`
-		INSERT INTO tape_pools (name, description, retention_days, allow_reuse, allocation_policy)
-		VALUES (?, ?, ?, ?, ?)
-	`, req.Name, req.Description, req.RetentionDays, allowReuse, req.AllocationPolicy)
+		INSERT INTO tape_pools (name, description, retention_days, allow_reuse, allocation_policy, reuse_approval, reuse_grace_hours, format_type)
+		VALUES (?, ?, ?, ?, ?, ?, ?, NULLIF(?, ''))
+	`, req.Name, req.Description, req.RetentionDays, allowReuse, req.AllocationPolicy, req.ReuseApproval, req.ReuseGraceHours, req.FormatType)
 	if err != nil {
 		s.respondError(w, http.StatusInternalServerError, err.Error())
 		return
@@ -1992,9 +2654,11 @@ func (s *Server) handleGetPool(w http.ResponseWriter, r *http.Request) {
 
 	var p models.TapePool
 	err = s.db.QueryRow(`
-		SELECT id, name, description, retention_days, allow_reuse, allocation_policy, created_at, updated_at
+		SELECT id, name, description, retention_days, allow_reuse, allocation_policy, reuse_approval, reuse_grace_hours,
+		       COALESCE(format_type, ''), created_at, updated_at
 		FROM tape_pools WHERE id = ?
-	`, id).Scan(&p.ID, &p.Name, &p.Description, &p.RetentionDays, &p.AllowReuse, &p.AllocationPolicy, &p.CreatedAt, &p.UpdatedAt)
+	`, id).Scan(&p.ID, &p.Name, &p.Description, &p.RetentionDays, &p.AllowReuse, &p.AllocationPolicy, &p.ReuseApproval, &p.ReuseGraceHours,
+		&p.FormatType, &p.CreatedAt, &p.UpdatedAt)
 	if err != nil {
 		s.respondError(w, http.StatusNotFound, "pool not found")
 		return
@@ -2015,6 +2679,9 @@ func (s *Server) handleGetPool(w http.ResponseWriter, r *http.Request) {
 		"retention_days":       p.RetentionDays,
 		"allow_reuse":          p.AllowReuse,
 		"allocation_policy":    p.AllocationPolicy,
+		"reuse_approval":       p.ReuseApproval,
+		"reuse_grace_hours":    p.ReuseGraceHours,
+		"format_type":          p.FormatType,
 		"tape_count":           tapeCount,
 		"total_capacity_bytes": totalCapacity,
 		"total_used_bytes":     totalUsed,
@@ -2024,6 +2691,22 @@ func (s *Server) handleGetPool(w http.ResponseWriter, r *http.Request) {
 	})
 }
 
+// handlePoolReservations lists the pool's tapes that running jobs have
+// reserved for writing
+func (s *Server) handlePoolReservations(w http.ResponseWriter, r *http.Request) {
+	id, err := s.getIDParam(r)
+	if err != nil {
+		s.respondError(w, http.StatusBadRequest, "invalid pool id")
+		return
+	}
+	reservations, err := s.backupService.ListTapeReservations(id)
+	if err != nil {
+		s.respondError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	s.respondJSON(w, http.StatusOK, reservations)
+}
+
 func (s *Server) handleUpdatePool(w http.ResponseWriter, r *http.Request) {
 	id, err := s.getIDParam(r)
 	if err != nil {
@@ -2037,17 +2720,41 @@ func (s *Server) handleUpdatePool(w http.ResponseWriter, r *http.Request) {
 		RetentionDays    *int    `json:"retention_days"`
 		AllowReuse       *bool   `json:"allow_reuse"`
 		AllocationPolicy *string `json:"allocation_policy"`
+		ReuseApproval    *bool   `json:"reuse_approval"`
+		ReuseGraceHours  *int    `json:"reuse_grace_hours"`
+		FormatType       *string `json:"format_type"`
 	}
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		s.respondError(w, http.StatusBadRequest, "invalid request body")
 		return
 	}
 
-	updates := []string{}
-	args := []interface{}{}
-
+	v := validation.New()
 	if req.Name != nil {
-		updates = append(updates, "name = ?")
+		v.Required("name", *req.Name)
+	}
+	if req.RetentionDays != nil {
+		v.NonNegative("retention_days", int64(*req.RetentionDays))
+	}
+	if req.AllocationPolicy != nil {
+		v.OneOf("allocation_policy", *req.AllocationPolicy, allocationPolicies...)
+	}
+	if req.ReuseGraceHours != nil {
+		v.NonNegative("reuse_grace_hours", int64(*req.ReuseGraceHours))
+	}
+	if req.FormatType != nil {
+		v.OneOf("format_type", *req.FormatType, poolFormatTypes...)
+	}
+	if err := v.Err(); err != nil {
+		s.respondValidationError(w, err)
+		return
+	}
+
+	updates := []string{}
+	args := []interface{}{}
+
+	if req.Name != nil {
+		updates = append(updates, "name = ?")
 		args = append(args, *req.Name)
 	}
 	if req.Description != nil {
@@ -2066,6 +2773,18 @@ func (s *Server) handleUpdatePool(w http.ResponseWriter, r *http.Request) {
 		updates = append(updates, "allocation_policy = ?")
 		args = append(args, *req.AllocationPolicy)
 	}
+	if req.ReuseApproval != nil {
+		updates = append(updates, "reuse_approval = ?")
+		args = append(args, *req.ReuseApproval)
+	}
+	if req.ReuseGraceHours != nil {
+		updates = append(updates, "reuse_grace_hours = ?")
+		args = append(args, *req.ReuseGraceHours)
+	}
+	if req.FormatType != nil {
+		updates = append(updates, "format_type = NULLIF(?, '')")
+		args = append(args, *req.FormatType)
+	}
 
 	if len(updates) == 0 {
 		s.respondError(w, http.StatusBadRequest, "no fields to update")
@@ -2106,7 +2825,8 @@ func (s *Server) handleDeletePool(w http.ResponseWriter, r *http.Request) {
 func (s *Server) handleListDrives(w http.ResponseWriter, r *http.Request) {
 	rows, err := s.db.Query(`
 		SELECT id, device_path, COALESCE(display_name, '') as display_name, COALESCE(vendor, '') as vendor,
-		       COALESCE(serial_number, '') as serial_number, COALESCE(model, '') as model, status, current_tape_id, COALESCE(enabled, 1) as enabled, created_at
+		       COALESCE(serial_number, '') as serial_number, wwn, binding_status, COALESCE(model, '') as model, status, current_tape_id, COALESCE(enabled, 1) as enabled,
+		       reserved_job_id, reserved_at, created_at
 		FROM tape_drives ORDER BY device_path
 	`)
 	if err != nil {
@@ -2118,9 +2838,10 @@ func (s *Server) handleListDrives(w http.ResponseWriter, r *http.Request) {
 	drives := make([]models.TapeDrive, 0)
 	for rows.Next() {
 		var d models.TapeDrive
-		if err := rows.Scan(&d.ID, &d.DevicePath, &d.DisplayName, &d.Vendor, &d.SerialNumber, &d.Model, &d.Status, &d.CurrentTapeID, &d.Enabled, &d.CreatedAt); err != nil {
+		if err := rows.Scan(&d.ID, &d.DevicePath, &d.DisplayName, &d.Vendor, &d.SerialNumber, &d.WWN, &d.BindingStatus, &d.Model, &d.Status, &d.CurrentTapeID, &d.Enabled, &d.ReservedJobID, &d.ReservedAt, &d.CreatedAt); err != nil {
 			continue
 		}
+		d.Backend = string(tape.BackendTypeOf(d.DevicePath))
 		drives = append(drives, d)
 	}
 
@@ -2146,7 +2867,7 @@ func (s *Server) handleListDrives(w http.ResponseWriter, r *http.Request) {
 
 		probeCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
 		driveSvc := tape.NewServiceForDevice(d.DevicePath, s.tapeService.GetBlockSize())
-		hwStatus, err := driveSvc.GetStatus(probeCtx)
+		hwStatus, err := driveSvc.ProbeStatus(probeCtx)
 		cancel()
 		if err != nil || hwStatus.Error != "" {
 			drives[i].Status = models.DriveStatusOffline
@@ -2156,14 +2877,14 @@ func (s *Server) handleListDrives(w http.ResponseWriter, r *http.Request) {
 			// Use cached label data to avoid rewinding tape on every list
 			var labelData *tape.TapeLabelData
 			if mainCache := s.tapeService.GetLabelCache(); mainCache != nil {
-				if cached := mainCache.Get(d.DevicePath, 5*time.Minute); cached != nil {
+				if cached := mainCache.Get(d.DevicePath, tape.DefaultLabelCacheTTL); cached != nil {
 					labelData = cached.Label
 				}
 			}
 			if labelData == nil {
 				// Cache miss - read label and cache it
 				labelCtx, labelCancel := context.WithTimeout(ctx, 5*time.Second)
-				if ld, err := driveSvc.ReadTapeLabel(labelCtx); err == nil && ld != nil {
+				if ld, err := driveSvc.ProbeLabel(labelCtx); err == nil && ld != nil {
 					labelData = ld
 					if mainCache := s.tapeService.GetLabelCache(); mainCache != nil {
 						mainCache.Set(d.DevicePath, ld, true)
@@ -2209,8 +2930,8 @@ func (s *Server) handleListDrives(w http.ResponseWriter, r *http.Request) {
 								ID:       eventID,
 								Type:     "warning",
 								Category: "tape",
-								Title:    "Unknown Tape Detected",
-								Message:  fmt.Sprintf("Tape '%s' (UUID: %s) is loaded in drive but not in database", labelData.Label, labelData.UUID),
+								Key:      "unknown_tape_detected",
+								Args:     []interface{}{labelData.Label, labelData.UUID},
 								Details: map[string]interface{}{
 									"label":    labelData.Label,
 									"uuid":     labelData.UUID,
@@ -2229,7 +2950,7 @@ func (s *Server) handleListDrives(w http.ResponseWriter, r *http.Request) {
 			// Try to get vendor/model info if missing
 			if d.Vendor == "" || d.Model == "" {
 				infoCtx, infoCancel := context.WithTimeout(ctx, 3*time.Second)
-				if info, err := driveSvc.GetDriveInfo(infoCtx); err == nil {
+				if info, err := driveSvc.ProbeDriveInfo(infoCtx); err == nil {
 					if v, ok := info["Vendor identification"]; ok && d.Vendor == "" {
 						drives[i].Vendor = v
 					}
@@ -2279,7 +3000,7 @@ func (s *Server) handleDriveStatus(w http.ResponseWriter, r *http.Request) {
 	}
 
 	ctx := r.Context()
-	status, err := s.tapeService.GetStatus(ctx)
+	status, err := s.tapeService.ProbeStatus(ctx)
 	if err != nil {
 		s.respondError(w, http.StatusInternalServerError, err.Error())
 		return
@@ -2350,8 +3071,7 @@ func (s *Server) handleEjectTape(w http.ResponseWriter, r *http.Request) {
 		s.eventBus.Publish(SystemEvent{
 			Type:     "info",
 			Category: "tape",
-			Title:    "Eject Started",
-			Message:  "Ejecting tape from drive...",
+			Key:      "eject_started",
 		})
 	}
 	if err := s.tapeService.Eject(ctx); err != nil {
@@ -2359,18 +3079,14 @@ func (s *Server) handleEjectTape(w http.ResponseWriter, r *http.Request) {
 			s.eventBus.Publish(SystemEvent{
 				Type:     "error",
 				Category: "tape",
-				Title:    "Eject Failed",
-				Message:  fmt.Sprintf("Failed to eject tape: %s", err.Error()),
+				Key:      "eject_failed",
+				Args:     []interface{}{err.Error()},
 			})
 		}
 		s.respondError(w, http.StatusInternalServerError, "failed to eject tape: "+err.Error())
 		return
 	}
 
-	if cache := s.tapeService.GetLabelCache(); cache != nil {
-		cache.Invalidate(s.tapeService.DevicePath())
-	}
-
 	// Clear current_tape_id in DB so the drive no longer shows a stale tape
 	if _, err := s.db.Exec("UPDATE tape_drives SET current_tape_id = NULL, updated_at = CURRENT_TIMESTAMP WHERE id = ?", driveID); err != nil {
 		s.logger.Warn("Failed to clear current_tape_id after eject", map[string]interface{}{
@@ -2383,8 +3099,7 @@ func (s *Server) handleEjectTape(w http.ResponseWriter, r *http.Request) {
 		s.eventBus.Publish(SystemEvent{
 			Type:     "success",
 			Category: "tape",
-			Title:    "Tape Ejected",
-			Message:  "Tape has been ejected from the drive",
+			Key:      "tape_ejected",
 		})
 	}
 	s.auditLog(r, "eject", "tape_drive", driveID, "Ejected tape")
@@ -2398,8 +3113,7 @@ func (s *Server) handleLoadTape(w http.ResponseWriter, r *http.Request) {
 		s.eventBus.Publish(SystemEvent{
 			Type:     "info",
 			Category: "tape",
-			Title:    "Load Started",
-			Message:  "Loading tape into drive...",
+			Key:      "load_started",
 		})
 	}
 	if err := s.tapeService.Load(ctx); err != nil {
@@ -2407,24 +3121,19 @@ func (s *Server) handleLoadTape(w http.ResponseWriter, r *http.Request) {
 			s.eventBus.Publish(SystemEvent{
 				Type:     "error",
 				Category: "tape",
-				Title:    "Load Failed",
-				Message:  fmt.Sprintf("Failed to load tape: %s", err.Error()),
+				Key:      "load_failed",
+				Args:     []interface{}{err.Error()},
 			})
 		}
 		s.respondError(w, http.StatusInternalServerError, "failed to load tape: "+err.Error())
 		return
 	}
 
-	if cache := s.tapeService.GetLabelCache(); cache != nil {
-		cache.Invalidate(s.tapeService.DevicePath())
-	}
-
 	if s.eventBus != nil {
 		s.eventBus.Publish(SystemEvent{
 			Type:     "success",
 			Category: "tape",
-			Title:    "Tape Loaded",
-			Message:  "Tape has been loaded into the drive",
+			Key:      "tape_loaded",
 		})
 	}
 	s.auditLog(r, "load", "tape_drive", driveID, "Loaded tape")
@@ -2437,8 +3146,7 @@ func (s *Server) handleRewindTape(w http.ResponseWriter, r *http.Request) {
 		s.eventBus.Publish(SystemEvent{
 			Type:     "info",
 			Category: "tape",
-			Title:    "Rewind Started",
-			Message:  "Rewinding tape to beginning...",
+			Key:      "rewind_started",
 		})
 	}
 	if err := s.tapeService.Rewind(ctx); err != nil {
@@ -2446,8 +3154,8 @@ func (s *Server) handleRewindTape(w http.ResponseWriter, r *http.Request) {
 			s.eventBus.Publish(SystemEvent{
 				Type:     "error",
 				Category: "tape",
-				Title:    "Rewind Failed",
-				Message:  fmt.Sprintf("Failed to rewind tape: %s", err.Error()),
+				Key:      "rewind_failed",
+				Args:     []interface{}{err.Error()},
 			})
 		}
 		s.respondError(w, http.StatusInternalServerError, "failed to rewind tape: "+err.Error())
@@ -2458,8 +3166,7 @@ func (s *Server) handleRewindTape(w http.ResponseWriter, r *http.Request) {
 		s.eventBus.Publish(SystemEvent{
 			Type:     "success",
 			Category: "tape",
-			Title:    "Tape Rewound",
-			Message:  "Tape has been rewound to the beginning",
+			Key:      "tape_rewound",
 		})
 	}
 	s.respondJSON(w, http.StatusOK, map[string]string{"status": "rewound"})
@@ -2623,8 +3330,7 @@ func (s *Server) handleDriveClean(w http.ResponseWriter, r *http.Request) {
 		s.eventBus.Publish(SystemEvent{
 			Type:     "info",
 			Category: "tape",
-			Title:    "Cleaning Started",
-			Message:  "Initiating drive cleaning cycle...",
+			Key:      "cleaning_started",
 		})
 	}
 
@@ -2633,8 +3339,8 @@ func (s *Server) handleDriveClean(w http.ResponseWriter, r *http.Request) {
 			s.eventBus.Publish(SystemEvent{
 				Type:     "error",
 				Category: "tape",
-				Title:    "Cleaning Failed",
-				Message:  fmt.Sprintf("Failed to clean drive: %s", err.Error()),
+				Key:      "cleaning_failed",
+				Args:     []interface{}{err.Error()},
 			})
 		}
 		s.respondError(w, http.StatusInternalServerError, "failed to clean drive: "+err.Error())
@@ -2656,8 +3362,7 @@ func (s *Server) handleDriveClean(w http.ResponseWriter, r *http.Request) {
 		s.eventBus.Publish(SystemEvent{
 			Type:     "success",
 			Category: "tape",
-			Title:    "Cleaning Complete",
-			Message:  "Drive cleaning cycle completed",
+			Key:      "cleaning_complete",
 		})
 	}
 
@@ -2686,8 +3391,7 @@ func (s *Server) handleDriveRetension(w http.ResponseWriter, r *http.Request) {
 		s.eventBus.Publish(SystemEvent{
 			Type:     "info",
 			Category: "tape",
-			Title:    "Retension Started",
-			Message:  "Running tape retension pass...",
+			Key:      "retension_started",
 		})
 	}
 
@@ -2696,8 +3400,8 @@ func (s *Server) handleDriveRetension(w http.ResponseWriter, r *http.Request) {
 			s.eventBus.Publish(SystemEvent{
 				Type:     "error",
 				Category: "tape",
-				Title:    "Retension Failed",
-				Message:  fmt.Sprintf("Failed to retension tape: %s", err.Error()),
+				Key:      "retension_failed",
+				Args:     []interface{}{err.Error()},
 			})
 		}
 		s.respondError(w, http.StatusInternalServerError, "failed to retension tape: "+err.Error())
@@ -2708,8 +3412,7 @@ func (s *Server) handleDriveRetension(w http.ResponseWriter, r *http.Request) {
 		s.eventBus.Publish(SystemEvent{
 			Type:     "success",
 			Category: "tape",
-			Title:    "Retension Complete",
-			Message:  "Tape retension pass completed successfully",
+			Key:      "retension_complete",
 		})
 	}
 
@@ -2784,8 +3487,8 @@ func (s *Server) handleSetDriveHardwareEncryption(w http.ResponseWriter, r *http
 			s.eventBus.Publish(SystemEvent{
 				Type:     "error",
 				Category: "encryption",
-				Title:    "Hardware Encryption Failed",
-				Message:  fmt.Sprintf("Failed to enable hardware encryption on drive: %s", err.Error()),
+				Key:      "hardware_encryption_failed",
+				Args:     []interface{}{err.Error()},
 			})
 		}
 		s.respondError(w, http.StatusInternalServerError, "failed to set hardware encryption: "+err.Error())
@@ -2796,8 +3499,8 @@ func (s *Server) handleSetDriveHardwareEncryption(w http.ResponseWriter, r *http
 		s.eventBus.Publish(SystemEvent{
 			Type:     "success",
 			Category: "encryption",
-			Title:    "Hardware Encryption Enabled",
-			Message:  fmt.Sprintf("Hardware encryption enabled on drive %d with key ID %d", driveID, req.EncryptionKeyID),
+			Key:      "hardware_encryption_enabled",
+			Args:     []interface{}{driveID, req.EncryptionKeyID},
 		})
 	}
 
@@ -2838,8 +3541,8 @@ func (s *Server) handleClearDriveHardwareEncryption(w http.ResponseWriter, r *ht
 			s.eventBus.Publish(SystemEvent{
 				Type:     "error",
 				Category: "encryption",
-				Title:    "Clear Hardware Encryption Failed",
-				Message:  fmt.Sprintf("Failed to disable hardware encryption: %s", err.Error()),
+				Key:      "clear_hardware_encryption_failed",
+				Args:     []interface{}{err.Error()},
 			})
 		}
 		s.respondError(w, http.StatusInternalServerError, "failed to clear hardware encryption: "+err.Error())
@@ -2850,8 +3553,8 @@ func (s *Server) handleClearDriveHardwareEncryption(w http.ResponseWriter, r *ht
 		s.eventBus.Publish(SystemEvent{
 			Type:     "success",
 			Category: "encryption",
-			Title:    "Hardware Encryption Disabled",
-			Message:  fmt.Sprintf("Hardware encryption disabled on drive %d", driveID),
+			Key:      "hardware_encryption_disabled",
+			Args:     []interface{}{driveID},
 		})
 	}
 
@@ -2882,8 +3585,8 @@ func (s *Server) createDriveAlertIfNew(driveID int64, severity, category, messag
 
 func (s *Server) handleListSources(w http.ResponseWriter, r *http.Request) {
 	rows, err := s.db.Query(`
-		SELECT id, name, source_type, path, COALESCE(include_patterns, '[]'), COALESCE(exclude_patterns, '[]'), enabled, created_at
-		FROM backup_sources ORDER BY name
+		SELECT id, name, source_type, path, COALESCE(include_patterns, '[]'), COALESCE(exclude_patterns, '[]'), symlink_policy, enabled, rpo_hours, credential_id, mount_options, created_at
+		FROM backup_sources WHERE ad_hoc = 0 ORDER BY name
 	`)
 	if err != nil {
 		s.respondError(w, http.StatusInternalServerError, err.Error())
@@ -2894,7 +3597,7 @@ func (s *Server) handleListSources(w http.ResponseWriter, r *http.Request) {
 	sources := make([]models.BackupSource, 0)
 	for rows.Next() {
 		var src models.BackupSource
-		if err := rows.Scan(&src.ID, &src.Name, &src.SourceType, &src.Path, &src.IncludePatterns, &src.ExcludePatterns, &src.Enabled, &src.CreatedAt); err != nil {
+		if err := rows.Scan(&src.ID, &src.Name, &src.SourceType, &src.Path, &src.IncludePatterns, &src.ExcludePatterns, &src.SymlinkPolicy, &src.Enabled, &src.RPOHours, &src.CredentialID, &src.MountOptions, &src.CreatedAt); err != nil {
 			continue
 		}
 		sources = append(sources, src)
@@ -2905,17 +3608,48 @@ func (s *Server) handleListSources(w http.ResponseWriter, r *http.Request) {
 
 func (s *Server) handleCreateSource(w http.ResponseWriter, r *http.Request) {
 	var req struct {
-		Name            string   `json:"name"`
-		SourceType      string   `json:"source_type"`
-		Path            string   `json:"path"`
-		IncludePatterns []string `json:"include_patterns"`
-		ExcludePatterns []string `json:"exclude_patterns"`
+		Name            string               `json:"name"`
+		SourceType      string               `json:"source_type"`
+		Path            string               `json:"path"`
+		IncludePatterns []string             `json:"include_patterns"`
+		ExcludePatterns []string             `json:"exclude_patterns"`
+		SymlinkPolicy   models.SymlinkPolicy `json:"symlink_policy"`
+		RPOHours        int                  `json:"rpo_hours"`
+		CredentialID    *int64               `json:"credential_id"`
+		MountOptions    string               `json:"mount_options"`
 	}
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		s.respondError(w, http.StatusBadRequest, "invalid request body")
 		return
 	}
 
+	if req.SourceType == "" {
+		req.SourceType = string(models.SourceTypeLocal)
+	}
+	if req.SymlinkPolicy == "" {
+		req.SymlinkPolicy = models.SymlinkStore
+	}
+	v := validation.New()
+	v.Required("name", req.Name)
+	v.OneOf("source_type", req.SourceType, sourceTypes...)
+	v.Required("path", req.Path)
+	v.OneOf("symlink_policy", string(req.SymlinkPolicy), symlinkPolicies...)
+	if req.SourceType == string(models.SourceTypeNDMP) {
+		s.checkNDMPSource(v, req.Path, req.CredentialID)
+	} else if req.SourceType == string(models.SourceTypeSMB) {
+		s.checkSMBSource(v, req.Path, req.CredentialID)
+	} else if msg := s.checkCredentialRef(req.CredentialID); msg != "" {
+		v.Add("credential_id", "%s", msg)
+	}
+	if req.SourceType == string(models.SourceTypeNFS) {
+		checkNFSSource(v, req.Path)
+	}
+	checkSourceMountOptions(v, req.SourceType, req.Path, req.MountOptions)
+	if err := v.Err(); err != nil {
+		s.respondValidationError(w, err)
+		return
+	}
+
 	if req.IncludePatterns == nil {
 		req.IncludePatterns = []string{}
 	}
@@ -2926,9 +3660,9 @@ func (s *Server) handleCreateSource(w http.ResponseWriter, r *http.Request) {
 	excludeJSON, _ := json.Marshal(req.ExcludePatterns)
 
 	result, err := s.db.Exec(`
-		INSERT INTO backup_sources (name, source_type, path, include_patterns, exclude_patterns, enabled)
-		VALUES (?, ?, ?, ?, ?, 1)
-	`, req.Name, req.SourceType, req.Path, string(includeJSON), string(excludeJSON))
+		INSERT INTO backup_sources (name, source_type, path, include_patterns, exclude_patterns, symlink_policy, enabled, rpo_hours, credential_id, mount_options)
+		VALUES (?, ?, ?, ?, ?, ?, 1, ?, ?, ?)
+	`, req.Name, req.SourceType, req.Path, string(includeJSON), string(excludeJSON), req.SymlinkPolicy, req.RPOHours, req.CredentialID, req.MountOptions)
 	if err != nil {
 		s.respondError(w, http.StatusInternalServerError, err.Error())
 		return
@@ -2940,8 +3674,8 @@ func (s *Server) handleCreateSource(w http.ResponseWriter, r *http.Request) {
 		s.eventBus.Publish(SystemEvent{
 			Type:     "info",
 			Category: "source",
-			Title:    "Source Created",
-			Message:  fmt.Sprintf("Backup source '%s' created", req.Name),
+			Key:      "source_created",
+			Args:     []interface{}{req.Name},
 		})
 	}
 
@@ -2959,9 +3693,9 @@ func (s *Server) handleGetSource(w http.ResponseWriter, r *http.Request) {
 
 	var src models.BackupSource
 	err = s.db.QueryRow(`
-		SELECT id, name, source_type, path, include_patterns, exclude_patterns, enabled, created_at, updated_at
+		SELECT id, name, source_type, path, include_patterns, exclude_patterns, symlink_policy, enabled, rpo_hours, credential_id, mount_options, created_at, updated_at
 		FROM backup_sources WHERE id = ?
-	`, id).Scan(&src.ID, &src.Name, &src.SourceType, &src.Path, &src.IncludePatterns, &src.ExcludePatterns, &src.Enabled, &src.CreatedAt, &src.UpdatedAt)
+	`, id).Scan(&src.ID, &src.Name, &src.SourceType, &src.Path, &src.IncludePatterns, &src.ExcludePatterns, &src.SymlinkPolicy, &src.Enabled, &src.RPOHours, &src.CredentialID, &src.MountOptions, &src.CreatedAt, &src.UpdatedAt)
 	if err != nil {
 		s.respondError(w, http.StatusNotFound, "source not found")
 		return
@@ -2978,17 +3712,67 @@ func (s *Server) handleUpdateSource(w http.ResponseWriter, r *http.Request) {
 	}
 
 	var req struct {
-		Name            *string  `json:"name"`
-		Path            *string  `json:"path"`
-		IncludePatterns []string `json:"include_patterns"`
-		ExcludePatterns []string `json:"exclude_patterns"`
-		Enabled         *bool    `json:"enabled"`
+		Name            *string               `json:"name"`
+		Path            *string               `json:"path"`
+		IncludePatterns []string              `json:"include_patterns"`
+		ExcludePatterns []string              `json:"exclude_patterns"`
+		SymlinkPolicy   *models.SymlinkPolicy `json:"symlink_policy"`
+		Enabled         *bool                 `json:"enabled"`
+		RPOHours        *int                  `json:"rpo_hours"`
+		// CredentialID of 0 clears the credential
+		CredentialID *int64  `json:"credential_id"`
+		MountOptions *string `json:"mount_options"`
 	}
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		s.respondError(w, http.StatusBadRequest, "invalid request body")
 		return
 	}
 
+	var sourceType, path, mountOptions string
+	var credentialID *int64
+	if err := s.db.QueryRow("SELECT source_type, path, credential_id, mount_options FROM backup_sources WHERE id = ?", id).Scan(&sourceType, &path, &credentialID, &mountOptions); err != nil {
+		s.respondError(w, http.StatusNotFound, "source not found")
+		return
+	}
+	if req.Path != nil {
+		path = *req.Path
+	}
+	if req.CredentialID != nil {
+		credentialID = req.CredentialID
+		if *req.CredentialID == 0 {
+			credentialID = nil
+		}
+	}
+	if req.MountOptions != nil {
+		mountOptions = *req.MountOptions
+	}
+
+	v := validation.New()
+	if req.Name != nil {
+		v.Required("name", *req.Name)
+	}
+	if req.Path != nil {
+		v.Required("path", *req.Path)
+	}
+	if req.SymlinkPolicy != nil {
+		v.OneOf("symlink_policy", string(*req.SymlinkPolicy), symlinkPolicies...)
+	}
+	if sourceType == string(models.SourceTypeNDMP) {
+		s.checkNDMPSource(v, path, credentialID)
+	} else if sourceType == string(models.SourceTypeSMB) {
+		s.checkSMBSource(v, path, credentialID)
+	} else if msg := s.checkCredentialRef(credentialID); msg != "" {
+		v.Add("credential_id", "%s", msg)
+	}
+	if sourceType == string(models.SourceTypeNFS) {
+		checkNFSSource(v, path)
+	}
+	checkSourceMountOptions(v, sourceType, path, mountOptions)
+	if err := v.Err(); err != nil {
+		s.respondValidationError(w, err)
+		return
+	}
+
 	updates := []string{}
 	args := []interface{}{}
 
@@ -3010,10 +3794,26 @@ func (s *Server) handleUpdateSource(w http.ResponseWriter, r *http.Request) {
 		updates = append(updates, "exclude_patterns = ?")
 		args = append(args, string(excludeJSON))
 	}
+	if req.SymlinkPolicy != nil {
+		updates = append(updates, "symlink_policy = ?")
+		args = append(args, *req.SymlinkPolicy)
+	}
 	if req.Enabled != nil {
 		updates = append(updates, "enabled = ?")
 		args = append(args, *req.Enabled)
 	}
+	if req.RPOHours != nil {
+		updates = append(updates, "rpo_hours = ?")
+		args = append(args, *req.RPOHours)
+	}
+	if req.CredentialID != nil {
+		updates = append(updates, "credential_id = ?")
+		args = append(args, credentialID)
+	}
+	if req.MountOptions != nil {
+		updates = append(updates, "mount_options = ?")
+		args = append(args, mountOptions)
+	}
 
 	if len(updates) == 0 {
 		s.respondError(w, http.StatusBadRequest, "no fields to update")
@@ -3035,6 +3835,99 @@ func (s *Server) handleUpdateSource(w http.ResponseWriter, r *http.Request) {
 	s.respondJSON(w, http.StatusOK, map[string]string{"status": "updated"})
 }
 
+// checkNDMPSource checks what an NDMP source needs: an ndmp:// URL naming
+// the file system as its path, and a stored credential to log in with
+func (s *Server) checkNDMPSource(v *validation.Validator, path string, credentialID *int64) {
+	if _, err := ndmp.ParseURL(path); err != nil {
+		v.Add("path", "%s", err.Error())
+	}
+	s.checkSourceLogin(v, credentialID, "NDMP")
+}
+
+// checkSMBSource validates the share path and login of an SMB source, or
+// only the credential reference of one mounted outside TapeBackarr
+func (s *Server) checkSMBSource(v *validation.Validator, path string, credentialID *int64) {
+	// A local directory is a share mounted outside TapeBackarr
+	if !backup.MountsShare(&models.BackupSource{SourceType: models.SourceTypeSMB, Path: path}) {
+		if msg := s.checkCredentialRef(credentialID); msg != "" {
+			v.Add("credential_id", "%s", msg)
+		}
+		return
+	}
+	if _, err := backup.ParseSMBPath(path); err != nil {
+		v.Add("path", "%s", err.Error())
+	}
+	s.checkSourceLogin(v, credentialID, "SMB")
+}
+
+// checkNFSSource validates the path of an NFS source: an export to mount,
+// or a local directory where the export is mounted already
+func checkNFSSource(v *validation.Validator, path string) {
+	if filepath.IsAbs(path) {
+		return
+	}
+	if _, err := backup.ParseNFSPath(path); err != nil {
+		v.Add("path", "%s", err.Error())
+	}
+}
+
+// checkSourceMountOptions validates mount options, which only apply to
+// sources whose share is mounted for each run
+func checkSourceMountOptions(v *validation.Validator, sourceType, path, options string) {
+	if options == "" {
+		return
+	}
+	if !backup.MountsShare(&models.BackupSource{SourceType: models.SourceType(sourceType), Path: path}) {
+		v.Add("mount_options", "only apply to SMB sources and NFS sources that name an export")
+		return
+	}
+	if err := backup.CheckMountOptions(options); err != nil {
+		v.Add("mount_options", "%s", err.Error())
+	}
+}
+
+// checkSourceLogin checks that a network source references a stored
+// password credential, which holds its login
+func (s *Server) checkSourceLogin(v *validation.Validator, credentialID *int64, kind string) {
+	if credentialID == nil {
+		v.Add("credential_id", "is required for %s sources", kind)
+		return
+	}
+	var credType string
+	if err := s.db.QueryRow("SELECT credential_type FROM credentials WHERE id = ?", *credentialID).Scan(&credType); err != nil {
+		v.Add("credential_id", "credential not found")
+	} else if credType != string(models.CredentialPassword) {
+		v.Add("credential_id", "must be a password credential for %s sources", kind)
+	}
+}
+
+// handleTestSource checks that a source can be reached and read with its
+// credential, mounting and unmounting SMB and NFS shares
+func (s *Server) handleTestSource(w http.ResponseWriter, r *http.Request) {
+	id, err := s.getIDParam(r)
+	if err != nil {
+		s.respondError(w, http.StatusBadRequest, "invalid source id")
+		return
+	}
+	if s.backupService == nil {
+		s.respondError(w, http.StatusServiceUnavailable, "backup service not available")
+		return
+	}
+
+	var source models.BackupSource
+	if err := s.db.QueryRow("SELECT id, name, source_type, path FROM backup_sources WHERE id = ?", id).Scan(&source.ID, &source.Name, &source.SourceType, &source.Path); err != nil {
+		s.respondError(w, http.StatusNotFound, "source not found")
+		return
+	}
+
+	if err := s.backupService.TestSource(r.Context(), &source); err != nil {
+		s.respondJSON(w, http.StatusOK, map[string]interface{}{"success": false, "error": err.Error()})
+		return
+	}
+
+	s.respondJSON(w, http.StatusOK, map[string]interface{}{"success": true})
+}
+
 func (s *Server) handleDeleteSource(w http.ResponseWriter, r *http.Request) {
 	id, err := s.getIDParam(r)
 	if err != nil {
@@ -3052,8 +3945,8 @@ func (s *Server) handleDeleteSource(w http.ResponseWriter, r *http.Request) {
 		s.eventBus.Publish(SystemEvent{
 			Type:     "info",
 			Category: "source",
-			Title:    "Source Deleted",
-			Message:  fmt.Sprintf("Backup source %d deleted", id),
+			Key:      "source_deleted",
+			Args:     []interface{}{id},
 		})
 	}
 
@@ -3070,11 +3963,17 @@ func (s *Server) handleListJobs(w http.ResponseWriter, r *http.Request) {
 		       j.backup_type, j.schedule_cron, j.retention_days, j.enabled,
 		       j.encryption_enabled, j.encryption_key_id,
 		       COALESCE(j.hw_encryption_enabled, 0), j.hw_encryption_key_id,
-		       COALESCE(j.compression, 'none') as compression,
-		       j.last_run_at, j.next_run_at
+		       COALESCE(j.compression, 'none') as compression, COALESCE(j.dedup_enabled, 0), COALESCE(j.pipelined_scan, 0), COALESCE(j.directory_report, 0),
+		       COALESCE(j.change_detection, 'metadata'), COALESCE(j.hash_sampled, 0),
+		       j.guard_max_files, j.guard_max_bytes, j.guard_max_change_percent, j.guard_action, j.guard_confirmed,
+		       COALESCE(j.snapshot_retention, 0), COALESCE(j.full_every_incrementals, 0), COALESCE(j.full_every_days, 0),
+		       COALESCE(j.schedule_paused, 0), j.owner_id, u.username,
+		       j.notify_emails, j.notify_telegram_chat_id, j.notify_global, j.rpo_hours, j.stream_stages, j.drive_id, j.priority, j.last_run_at, j.next_run_at
 		FROM backup_jobs j
 		LEFT JOIN backup_sources s ON j.source_id = s.id
 		LEFT JOIN tape_pools p ON j.pool_id = p.id
+		LEFT JOIN users u ON j.owner_id = u.id
+		WHERE j.ad_hoc = 0
 		ORDER BY j.name
 	`)
 	if err != nil {
@@ -3086,34 +3985,67 @@ func (s *Server) handleListJobs(w http.ResponseWriter, r *http.Request) {
 	jobs := make([]map[string]interface{}, 0)
 	for rows.Next() {
 		var j models.BackupJob
-		var sourceName, poolName *string
+		var sourceName, poolName, ownerName *string
 		var compression string
+		var guardConfirmed bool
+		var streamStages sql.NullString
 		if err := rows.Scan(&j.ID, &j.Name, &j.SourceID, &sourceName, &j.PoolID, &poolName,
 			&j.BackupType, &j.ScheduleCron, &j.RetentionDays, &j.Enabled,
 			&j.EncryptionEnabled, &j.EncryptionKeyID,
 			&j.HwEncryptionEnabled, &j.HwEncryptionKeyID,
-			&compression,
-			&j.LastRunAt, &j.NextRunAt); err != nil {
+			&compression, &j.DedupEnabled, &j.PipelinedScan, &j.DirectoryReport,
+			&j.ChangeDetection, &j.HashSampled,
+			&j.GuardMaxFiles, &j.GuardMaxBytes, &j.GuardMaxChangePercent, &j.GuardAction, &guardConfirmed,
+			&j.SnapshotRetention, &j.FullEveryIncrementals, &j.FullEveryDays,
+			&j.SchedulePaused, &j.OwnerID, &ownerName,
+			&j.NotifyEmails, &j.NotifyTelegramChatID, &j.NotifyGlobal, &j.RPOHours, &streamStages, &j.DriveID, &j.Priority, &j.LastRunAt, &j.NextRunAt); err != nil {
 			continue
 		}
+		j.StreamStages, _ = stages.Parse(streamStages)
+		if j.StreamStages == nil {
+			j.StreamStages = []models.StreamStage{}
+		}
 		job := map[string]interface{}{
-			"id":                    j.ID,
-			"name":                  j.Name,
-			"source_id":             j.SourceID,
-			"source_name":           sourceName,
-			"pool_id":               j.PoolID,
-			"pool_name":             poolName,
-			"backup_type":           j.BackupType,
-			"schedule_cron":         j.ScheduleCron,
-			"retention_days":        j.RetentionDays,
-			"enabled":               j.Enabled,
-			"encryption_enabled":    j.EncryptionEnabled,
-			"encryption_key_id":     j.EncryptionKeyID,
-			"hw_encryption_enabled": j.HwEncryptionEnabled,
-			"hw_encryption_key_id":  j.HwEncryptionKeyID,
-			"compression":           compression,
-			"last_run_at":           j.LastRunAt,
-			"next_run_at":           j.NextRunAt,
+			"id":                       j.ID,
+			"name":                     j.Name,
+			"source_id":                j.SourceID,
+			"source_name":              sourceName,
+			"pool_id":                  j.PoolID,
+			"pool_name":                poolName,
+			"backup_type":              j.BackupType,
+			"schedule_cron":            j.ScheduleCron,
+			"retention_days":           j.RetentionDays,
+			"enabled":                  j.Enabled,
+			"encryption_enabled":       j.EncryptionEnabled,
+			"encryption_key_id":        j.EncryptionKeyID,
+			"hw_encryption_enabled":    j.HwEncryptionEnabled,
+			"hw_encryption_key_id":     j.HwEncryptionKeyID,
+			"compression":              compression,
+			"dedup_enabled":            j.DedupEnabled,
+			"pipelined_scan":           j.PipelinedScan,
+			"directory_report":         j.DirectoryReport,
+			"change_detection":         j.ChangeDetection,
+			"hash_sampled":             j.HashSampled,
+			"guard_max_files":          j.GuardMaxFiles,
+			"guard_max_bytes":          j.GuardMaxBytes,
+			"guard_max_change_percent": j.GuardMaxChangePercent,
+			"guard_action":             j.GuardAction,
+			"guard_confirmed":          guardConfirmed,
+			"snapshot_retention":       j.SnapshotRetention,
+			"full_every_incrementals":  j.FullEveryIncrementals,
+			"full_every_days":          j.FullEveryDays,
+			"schedule_paused":          j.SchedulePaused,
+			"owner_id":                 j.OwnerID,
+			"owner_name":               ownerName,
+			"notify_emails":            j.NotifyEmails,
+			"notify_telegram_chat_id":  j.NotifyTelegramChatID,
+			"notify_global":            j.NotifyGlobal,
+			"rpo_hours":                j.RPOHours,
+			"stream_stages":            j.StreamStages,
+			"drive_id":                 j.DriveID,
+			"priority":                 j.Priority,
+			"last_run_at":              j.LastRunAt,
+			"next_run_at":              j.NextRunAt,
 		}
 		jobs = append(jobs, job)
 	}
@@ -3123,27 +4055,78 @@ func (s *Server) handleListJobs(w http.ResponseWriter, r *http.Request) {
 
 func (s *Server) handleCreateJob(w http.ResponseWriter, r *http.Request) {
 	var req struct {
-		Name              string `json:"name"`
-		SourceID          int64  `json:"source_id"`
-		PoolID            int64  `json:"pool_id"`
-		BackupType        string `json:"backup_type"`
-		ScheduleCron      string `json:"schedule_cron"`
-		RetentionDays     int    `json:"retention_days"`
-		EncryptionKeyID   *int64 `json:"encryption_key_id"`
-		HwEncryptionKeyID *int64 `json:"hw_encryption_key_id"`
-		Compression       string `json:"compression"`
+		Name                  string               `json:"name"`
+		SourceID              int64                `json:"source_id"`
+		PoolID                int64                `json:"pool_id"`
+		BackupType            string               `json:"backup_type"`
+		ScheduleCron          string               `json:"schedule_cron"`
+		RetentionDays         int                  `json:"retention_days"`
+		EncryptionKeyID       *int64               `json:"encryption_key_id"`
+		HwEncryptionKeyID     *int64               `json:"hw_encryption_key_id"`
+		Compression           string               `json:"compression"`
+		DedupEnabled          bool                 `json:"dedup_enabled"`
+		PipelinedScan         bool                 `json:"pipelined_scan"`
+		DirectoryReport       bool                 `json:"directory_report"`
+		ChangeDetection       string               `json:"change_detection"`
+		HashSampled           bool                 `json:"hash_sampled"`
+		GuardMaxFiles         int64                `json:"guard_max_files"`
+		GuardMaxBytes         int64                `json:"guard_max_bytes"`
+		GuardMaxChangePercent int                  `json:"guard_max_change_percent"`
+		GuardAction           string               `json:"guard_action"`
+		SnapshotRetention     int                  `json:"snapshot_retention"`
+		FullEveryIncrementals int                  `json:"full_every_incrementals"`
+		FullEveryDays         int                  `json:"full_every_days"`
+		OwnerID               *int64               `json:"owner_id"`
+		NotifyEmails          string               `json:"notify_emails"`
+		NotifyTelegramChatID  string               `json:"notify_telegram_chat_id"`
+		NotifyGlobal          bool                 `json:"notify_global"`
+		RPOHours              int                  `json:"rpo_hours"`
+		StreamStages          []models.StreamStage `json:"stream_stages"`
+		DriveID               *int64               `json:"drive_id"`
+		Priority              int                  `json:"priority"`
 	}
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		s.respondError(w, http.StatusBadRequest, "invalid request body")
 		return
 	}
 
-	// Validate cron expression if provided
-	if req.ScheduleCron != "" {
-		if err := scheduler.ParseCron(req.ScheduleCron); err != nil {
-			s.respondError(w, http.StatusBadRequest, "invalid cron expression: "+err.Error())
-			return
-		}
+	compression := req.Compression
+	if compression == "" {
+		compression = "none"
+	}
+	changeDetection := req.ChangeDetection
+	if changeDetection == "" {
+		changeDetection = string(models.ChangeDetectionMetadata)
+	}
+	guardAction := req.GuardAction
+	if guardAction == "" {
+		guardAction = string(models.GuardrailConfirm)
+	}
+	v := validation.New()
+	v.Required("name", req.Name)
+	v.RequiredID("source_id", req.SourceID)
+	v.RequiredID("pool_id", req.PoolID)
+	v.OneOf("backup_type", req.BackupType, backupTypes...)
+	v.Cron("schedule_cron", req.ScheduleCron)
+	v.NonNegative("retention_days", int64(req.RetentionDays))
+	v.OneOf("compression", compression, compressionTypes...)
+	v.OneOf("change_detection", changeDetection, changeDetectionModes...)
+	validateGuardrails(v, req.GuardMaxFiles, req.GuardMaxBytes, req.GuardMaxChangePercent, guardAction)
+	v.NonNegative("snapshot_retention", int64(req.SnapshotRetention))
+	v.NonNegative("full_every_incrementals", int64(req.FullEveryIncrementals))
+	v.NonNegative("full_every_days", int64(req.FullEveryDays))
+	if req.OwnerID != nil {
+		v.Check("owner_id", s.validateJobOwner(*req.OwnerID))
+	}
+	v.Check("notify_emails", validateEmailList(req.NotifyEmails))
+	v.Check("notify_telegram_chat_id", validateChatIDs(req.NotifyTelegramChatID))
+	v.Check("stream_stages", stages.Validate(req.StreamStages))
+	if req.DriveID != nil {
+		v.Check("drive_id", s.validateJobDrive(*req.DriveID))
+	}
+	if err := v.Err(); err != nil {
+		s.respondValidationError(w, err)
+		return
 	}
 
 	// Determine software encryption settings
@@ -3170,25 +4153,19 @@ func (s *Server) handleCreateJob(w http.ResponseWriter, r *http.Request) {
 		hwEncryptionEnabled = true
 	}
 
-	compression := req.Compression
-	if compression == "" {
-		compression = "none"
-	}
-	// Validate compression type
-	switch models.CompressionType(compression) {
-	case models.CompressionNone, models.CompressionLTO, models.CompressionGzip, models.CompressionZstd:
-		// valid
-	default:
-		s.respondError(w, http.StatusBadRequest, "invalid compression type: "+compression+". Valid options: none, lto, gzip, zstd")
-		return
-	}
-
 	result, err := s.db.Exec(`
 		INSERT INTO backup_jobs (name, source_id, pool_id, backup_type, schedule_cron, retention_days, enabled,
-			encryption_enabled, encryption_key_id, hw_encryption_enabled, hw_encryption_key_id, compression)
-		VALUES (?, ?, ?, ?, ?, ?, 1, ?, ?, ?, ?, ?)
+			encryption_enabled, encryption_key_id, hw_encryption_enabled, hw_encryption_key_id, compression, dedup_enabled,
+			pipelined_scan, directory_report, change_detection, hash_sampled, snapshot_retention, full_every_incrementals, full_every_days,
+			guard_max_files, guard_max_bytes, guard_max_change_percent, guard_action,
+			owner_id, notify_emails, notify_telegram_chat_id, notify_global, rpo_hours, stream_stages, drive_id, priority)
+		VALUES (?, ?, ?, ?, ?, ?, 1, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
 	`, req.Name, req.SourceID, req.PoolID, req.BackupType, req.ScheduleCron, req.RetentionDays,
-		encryptionEnabled, req.EncryptionKeyID, hwEncryptionEnabled, req.HwEncryptionKeyID, compression)
+		encryptionEnabled, req.EncryptionKeyID, hwEncryptionEnabled, req.HwEncryptionKeyID, compression, req.DedupEnabled,
+		req.PipelinedScan, req.DirectoryReport, changeDetection, req.HashSampled, req.SnapshotRetention, req.FullEveryIncrementals, req.FullEveryDays,
+		req.GuardMaxFiles, req.GuardMaxBytes, req.GuardMaxChangePercent, guardAction,
+		nullableID(req.OwnerID), strings.TrimSpace(req.NotifyEmails), strings.TrimSpace(req.NotifyTelegramChatID), req.NotifyGlobal, req.RPOHours,
+		stages.Marshal(req.StreamStages), nullableID(req.DriveID), req.Priority)
 	if err != nil {
 		s.respondError(w, http.StatusInternalServerError, err.Error())
 		return
@@ -3199,13 +4176,25 @@ func (s *Server) handleCreateJob(w http.ResponseWriter, r *http.Request) {
 	// Add to scheduler if cron is set
 	if req.ScheduleCron != "" {
 		job := &models.BackupJob{
-			ID:           id,
-			Name:         req.Name,
-			SourceID:     req.SourceID,
-			PoolID:       req.PoolID,
-			BackupType:   models.BackupType(req.BackupType),
-			ScheduleCron: req.ScheduleCron,
-			Enabled:      true,
+			ID:                    id,
+			Name:                  req.Name,
+			SourceID:              req.SourceID,
+			PoolID:                req.PoolID,
+			BackupType:            models.BackupType(req.BackupType),
+			ScheduleCron:          req.ScheduleCron,
+			Enabled:               true,
+			DedupEnabled:          req.DedupEnabled,
+			PipelinedScan:         req.PipelinedScan,
+			DirectoryReport:       req.DirectoryReport,
+			ChangeDetection:       models.ChangeDetection(changeDetection),
+			HashSampled:           req.HashSampled,
+			GuardMaxFiles:         req.GuardMaxFiles,
+			GuardMaxBytes:         req.GuardMaxBytes,
+			GuardMaxChangePercent: req.GuardMaxChangePercent,
+			GuardAction:           models.GuardrailAction(guardAction),
+			SnapshotRetention:     req.SnapshotRetention,
+			FullEveryIncrementals: req.FullEveryIncrementals,
+			FullEveryDays:         req.FullEveryDays,
 		}
 		s.scheduler.AddJob(job)
 	}
@@ -3214,8 +4203,8 @@ func (s *Server) handleCreateJob(w http.ResponseWriter, r *http.Request) {
 		s.eventBus.Publish(SystemEvent{
 			Type:     "info",
 			Category: "job",
-			Title:    "Job Created",
-			Message:  fmt.Sprintf("Backup job '%s' created", req.Name),
+			Key:      "job_created",
+			Args:     []interface{}{req.Name},
 		})
 	}
 
@@ -3232,20 +4221,34 @@ func (s *Server) handleGetJob(w http.ResponseWriter, r *http.Request) {
 	}
 
 	var j models.BackupJob
+	var streamStages sql.NullString
 	err = s.db.QueryRow(`
 		SELECT id, name, source_id, pool_id, backup_type, schedule_cron, retention_days, 
-		       enabled, last_run_at, next_run_at, created_at, updated_at
+		       enabled, COALESCE(schedule_paused, 0), owner_id, notify_emails, notify_telegram_chat_id, notify_global, rpo_hours,
+		       stream_stages, drive_id, priority, last_run_at, next_run_at, created_at, updated_at
 		FROM backup_jobs WHERE id = ?
 	`, id).Scan(&j.ID, &j.Name, &j.SourceID, &j.PoolID, &j.BackupType, &j.ScheduleCron, &j.RetentionDays,
-		&j.Enabled, &j.LastRunAt, &j.NextRunAt, &j.CreatedAt, &j.UpdatedAt)
+		&j.Enabled, &j.SchedulePaused, &j.OwnerID, &j.NotifyEmails, &j.NotifyTelegramChatID, &j.NotifyGlobal, &j.RPOHours,
+		&streamStages, &j.DriveID, &j.Priority, &j.LastRunAt, &j.NextRunAt, &j.CreatedAt, &j.UpdatedAt)
 	if err != nil {
 		s.respondError(w, http.StatusNotFound, "job not found")
 		return
 	}
+	j.StreamStages, _ = stages.Parse(streamStages)
 
 	s.respondJSON(w, http.StatusOK, j)
 }
 
+// handleListStreamStages returns the stream stages jobs can use
+func (s *Server) handleListStreamStages(w http.ResponseWriter, r *http.Request) {
+	s.respondJSON(w, http.StatusOK, map[string]interface{}{"stages": stages.Available()})
+}
+
+// isJobRunning reports whether a backup run for the job is currently in progress
+func (s *Server) isJobRunning(jobID int64) bool {
+	return s.backupService != nil && s.backupService.IsJobActive(jobID)
+}
+
 func (s *Server) handleUpdateJob(w http.ResponseWriter, r *http.Request) {
 	id, err := s.getIDParam(r)
 	if err != nil {
@@ -3254,14 +4257,34 @@ func (s *Server) handleUpdateJob(w http.ResponseWriter, r *http.Request) {
 	}
 
 	var req struct {
-		Name            *string `json:"name"`
-		SourceID        *int64  `json:"source_id"`
-		PoolID          *int64  `json:"pool_id"`
-		BackupType      *string `json:"backup_type"`
-		ScheduleCron    *string `json:"schedule_cron"`
-		RetentionDays   *int    `json:"retention_days"`
-		Enabled         *bool   `json:"enabled"`
-		EncryptionKeyID *int64  `json:"encryption_key_id"`
+		Name                  *string               `json:"name"`
+		SourceID              *int64                `json:"source_id"`
+		PoolID                *int64                `json:"pool_id"`
+		BackupType            *string               `json:"backup_type"`
+		ScheduleCron          *string               `json:"schedule_cron"`
+		RetentionDays         *int                  `json:"retention_days"`
+		Enabled               *bool                 `json:"enabled"`
+		DedupEnabled          *bool                 `json:"dedup_enabled"`
+		PipelinedScan         *bool                 `json:"pipelined_scan"`
+		DirectoryReport       *bool                 `json:"directory_report"`
+		ChangeDetection       *string               `json:"change_detection"`
+		HashSampled           *bool                 `json:"hash_sampled"`
+		GuardMaxFiles         *int64                `json:"guard_max_files"`
+		GuardMaxBytes         *int64                `json:"guard_max_bytes"`
+		GuardMaxChangePercent *int                  `json:"guard_max_change_percent"`
+		GuardAction           *string               `json:"guard_action"`
+		SnapshotRetention     *int                  `json:"snapshot_retention"`
+		FullEveryIncrementals *int                  `json:"full_every_incrementals"`
+		FullEveryDays         *int                  `json:"full_every_days"`
+		EncryptionKeyID       *int64                `json:"encryption_key_id"`
+		OwnerID               *int64                `json:"owner_id"`
+		NotifyEmails          *string               `json:"notify_emails"`
+		NotifyTelegramChatID  *string               `json:"notify_telegram_chat_id"`
+		NotifyGlobal          *bool                 `json:"notify_global"`
+		RPOHours              *int                  `json:"rpo_hours"`
+		StreamStages          *[]models.StreamStage `json:"stream_stages"`
+		DriveID               *int64                `json:"drive_id"`
+		Priority              *int                  `json:"priority"`
 	}
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		s.respondError(w, http.StatusBadRequest, "invalid request body")
@@ -3274,13 +4297,95 @@ func (s *Server) handleUpdateJob(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if req.ScheduleCron != nil && *req.ScheduleCron != "" {
-		if err := scheduler.ParseCron(*req.ScheduleCron); err != nil {
-			s.respondError(w, http.StatusBadRequest, "invalid cron expression: "+err.Error())
+	// Structural fields define what the running backup is writing and where;
+	// changing them mid-run would leave the backup set inconsistent with its job.
+	// Schedule, retention, name and enabled only affect future runs and stay editable.
+	if s.isJobRunning(id) {
+		var locked []string
+		if req.SourceID != nil {
+			locked = append(locked, "source_id")
+		}
+		if req.PoolID != nil {
+			locked = append(locked, "pool_id")
+		}
+		if req.BackupType != nil {
+			locked = append(locked, "backup_type")
+		}
+		if len(locked) > 0 {
+			s.respondError(w, http.StatusConflict, fmt.Sprintf("job is currently running; %s cannot be changed until the run finishes", strings.Join(locked, ", ")))
 			return
 		}
 	}
 
+	v := validation.New()
+	if req.Name != nil {
+		v.Required("name", *req.Name)
+	}
+	if req.SourceID != nil {
+		v.RequiredID("source_id", *req.SourceID)
+	}
+	if req.PoolID != nil {
+		v.RequiredID("pool_id", *req.PoolID)
+	}
+	if req.BackupType != nil {
+		v.OneOf("backup_type", *req.BackupType, backupTypes...)
+	}
+	if req.ScheduleCron != nil {
+		v.Cron("schedule_cron", *req.ScheduleCron)
+	}
+	if req.RetentionDays != nil {
+		v.NonNegative("retention_days", int64(*req.RetentionDays))
+	}
+	if req.ChangeDetection != nil {
+		v.OneOf("change_detection", *req.ChangeDetection, changeDetectionModes...)
+	}
+	if req.GuardMaxFiles != nil || req.GuardMaxBytes != nil || req.GuardMaxChangePercent != nil || req.GuardAction != nil {
+		var maxFiles, maxBytes int64
+		var maxChange int
+		guardAction := string(models.GuardrailConfirm)
+		if req.GuardMaxFiles != nil {
+			maxFiles = *req.GuardMaxFiles
+		}
+		if req.GuardMaxBytes != nil {
+			maxBytes = *req.GuardMaxBytes
+		}
+		if req.GuardMaxChangePercent != nil {
+			maxChange = *req.GuardMaxChangePercent
+		}
+		if req.GuardAction != nil {
+			guardAction = *req.GuardAction
+		}
+		validateGuardrails(v, maxFiles, maxBytes, maxChange, guardAction)
+	}
+	if req.SnapshotRetention != nil {
+		v.NonNegative("snapshot_retention", int64(*req.SnapshotRetention))
+	}
+	if req.FullEveryIncrementals != nil {
+		v.NonNegative("full_every_incrementals", int64(*req.FullEveryIncrementals))
+	}
+	if req.FullEveryDays != nil {
+		v.NonNegative("full_every_days", int64(*req.FullEveryDays))
+	}
+	if req.OwnerID != nil {
+		v.Check("owner_id", s.validateJobOwner(*req.OwnerID))
+	}
+	if req.NotifyEmails != nil {
+		v.Check("notify_emails", validateEmailList(*req.NotifyEmails))
+	}
+	if req.NotifyTelegramChatID != nil {
+		v.Check("notify_telegram_chat_id", validateChatIDs(*req.NotifyTelegramChatID))
+	}
+	if req.StreamStages != nil {
+		v.Check("stream_stages", stages.Validate(*req.StreamStages))
+	}
+	if req.DriveID != nil {
+		v.Check("drive_id", s.validateJobDrive(*req.DriveID))
+	}
+	if err := v.Err(); err != nil {
+		s.respondValidationError(w, err)
+		return
+	}
+
 	updates := []string{}
 	args := []interface{}{}
 
@@ -3312,6 +4417,88 @@ func (s *Server) handleUpdateJob(w http.ResponseWriter, r *http.Request) {
 		updates = append(updates, "enabled = ?")
 		args = append(args, *req.Enabled)
 	}
+	if req.DedupEnabled != nil {
+		updates = append(updates, "dedup_enabled = ?")
+		args = append(args, *req.DedupEnabled)
+	}
+	if req.PipelinedScan != nil {
+		updates = append(updates, "pipelined_scan = ?")
+		args = append(args, *req.PipelinedScan)
+	}
+	if req.DirectoryReport != nil {
+		updates = append(updates, "directory_report = ?")
+		args = append(args, *req.DirectoryReport)
+	}
+	if req.ChangeDetection != nil {
+		updates = append(updates, "change_detection = ?")
+		args = append(args, *req.ChangeDetection)
+	}
+	if req.HashSampled != nil {
+		updates = append(updates, "hash_sampled = ?")
+		args = append(args, *req.HashSampled)
+	}
+	if req.GuardMaxFiles != nil {
+		updates = append(updates, "guard_max_files = ?")
+		args = append(args, *req.GuardMaxFiles)
+	}
+	if req.GuardMaxBytes != nil {
+		updates = append(updates, "guard_max_bytes = ?")
+		args = append(args, *req.GuardMaxBytes)
+	}
+	if req.GuardMaxChangePercent != nil {
+		updates = append(updates, "guard_max_change_percent = ?")
+		args = append(args, *req.GuardMaxChangePercent)
+	}
+	if req.GuardAction != nil {
+		updates = append(updates, "guard_action = ?")
+		args = append(args, *req.GuardAction)
+	}
+	if req.SnapshotRetention != nil {
+		updates = append(updates, "snapshot_retention = ?")
+		args = append(args, *req.SnapshotRetention)
+	}
+	if req.FullEveryIncrementals != nil {
+		updates = append(updates, "full_every_incrementals = ?")
+		args = append(args, *req.FullEveryIncrementals)
+	}
+	if req.FullEveryDays != nil {
+		updates = append(updates, "full_every_days = ?")
+		args = append(args, *req.FullEveryDays)
+	}
+	if req.OwnerID != nil {
+		updates = append(updates, "owner_id = ?")
+		args = append(args, nullableID(req.OwnerID))
+	}
+	if req.NotifyEmails != nil {
+		updates = append(updates, "notify_emails = ?")
+		args = append(args, strings.TrimSpace(*req.NotifyEmails))
+	}
+	if req.NotifyTelegramChatID != nil {
+		updates = append(updates, "notify_telegram_chat_id = ?")
+		args = append(args, strings.TrimSpace(*req.NotifyTelegramChatID))
+	}
+	if req.NotifyGlobal != nil {
+		updates = append(updates, "notify_global = ?")
+		args = append(args, *req.NotifyGlobal)
+	}
+	if req.RPOHours != nil {
+		updates = append(updates, "rpo_hours = ?")
+		args = append(args, *req.RPOHours)
+	}
+	if req.StreamStages != nil {
+		// Sets record the stages they went through, so a change only
+		// affects later runs
+		updates = append(updates, "stream_stages = ?")
+		args = append(args, stages.Marshal(*req.StreamStages))
+	}
+	if req.DriveID != nil {
+		updates = append(updates, "drive_id = ?")
+		args = append(args, nullableID(req.DriveID))
+	}
+	if req.Priority != nil {
+		updates = append(updates, "priority = ?")
+		args = append(args, *req.Priority)
+	}
 
 	if len(updates) == 0 {
 		s.respondError(w, http.StatusBadRequest, "no fields to update")
@@ -3343,6 +4530,23 @@ func (s *Server) handleDeleteJob(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if s.isJobRunning(id) {
+		s.respondErrorCode(w, http.StatusConflict, codeJobRunning, "job is currently running; cancel it or wait for it to finish before deleting", nil)
+		return
+	}
+
+	// Deduplicated files of other jobs may rely on this job's backup sets
+	var refs int
+	s.db.QueryRow(`
+		SELECT COUNT(*) FROM catalog_entries ce
+		JOIN backup_sets bs ON ce.backup_set_id = bs.id
+		WHERE bs.job_id != ? AND ce.ref_backup_set_id IN (SELECT id FROM backup_sets WHERE job_id = ?)
+	`, id, id).Scan(&refs)
+	if refs > 0 {
+		s.respondError(w, http.StatusConflict, "backup sets of this job hold data for deduplicated files of other jobs; delete those backup sets first")
+		return
+	}
+
 	// Delete child records that reference backup_sets belonging to this job.
 	// Table names are hardcoded; no user input is used in the query.
 	backupSetChildren := []string{"catalog_entries", "snapshots", "restore_operations", "tape_spanning_members"}
@@ -3407,8 +4611,8 @@ func (s *Server) handleDeleteJob(w http.ResponseWriter, r *http.Request) {
 		s.eventBus.Publish(SystemEvent{
 			Type:     "info",
 			Category: "job",
-			Title:    "Job Deleted",
-			Message:  fmt.Sprintf("Backup job %d deleted", id),
+			Key:      "job_deleted",
+			Args:     []interface{}{id},
 		})
 	}
 
@@ -3440,12 +4644,18 @@ func (s *Server) handleRunJob(w http.ResponseWriter, r *http.Request) {
 		SELECT id, name, source_id, pool_id, backup_type, retention_days,
 			encryption_enabled, encryption_key_id,
 			COALESCE(hw_encryption_enabled, 0), hw_encryption_key_id,
-			compression
+			compression, COALESCE(dedup_enabled, 0), COALESCE(pipelined_scan, 0), COALESCE(directory_report, 0),
+			COALESCE(change_detection, 'metadata'), COALESCE(hash_sampled, 0), COALESCE(snapshot_retention, 0),
+			COALESCE(full_every_incrementals, 0), COALESCE(full_every_days, 0),
+			guard_max_files, guard_max_bytes, guard_max_change_percent, guard_action
 		FROM backup_jobs WHERE id = ?
 	`, id).Scan(&job.ID, &job.Name, &job.SourceID, &job.PoolID, &job.BackupType, &job.RetentionDays,
 		&job.EncryptionEnabled, &job.EncryptionKeyID,
 		&job.HwEncryptionEnabled, &job.HwEncryptionKeyID,
-		&job.Compression)
+		&job.Compression, &job.DedupEnabled, &job.PipelinedScan, &job.DirectoryReport,
+		&job.ChangeDetection, &job.HashSampled, &job.SnapshotRetention,
+		&job.FullEveryIncrementals, &job.FullEveryDays,
+		&job.GuardMaxFiles, &job.GuardMaxBytes, &job.GuardMaxChangePercent, &job.GuardAction)
 	if err != nil {
 		s.respondError(w, http.StatusNotFound, "job not found")
 		return
@@ -3454,9 +4664,9 @@ func (s *Server) handleRunJob(w http.ResponseWriter, r *http.Request) {
 	// Get source details
 	var source models.BackupSource
 	err = s.db.QueryRow(`
-		SELECT id, name, source_type, path, include_patterns, exclude_patterns
+		SELECT id, name, source_type, path, include_patterns, exclude_patterns, symlink_policy
 		FROM backup_sources WHERE id = ?
-	`, job.SourceID).Scan(&source.ID, &source.Name, &source.SourceType, &source.Path, &source.IncludePatterns, &source.ExcludePatterns)
+	`, job.SourceID).Scan(&source.ID, &source.Name, &source.SourceType, &source.Path, &source.IncludePatterns, &source.ExcludePatterns, &source.SymlinkPolicy)
 	if err != nil {
 		s.respondError(w, http.StatusNotFound, "source not found")
 		return
@@ -3479,12 +4689,17 @@ func (s *Server) handleRunJob(w http.ResponseWriter, r *http.Request) {
 
 	if usePool && job.PoolID > 0 {
 		// Select best tape from pool
-		selectedTapeID, tapeLabel, err := s.selectTapeFromPool(job.PoolID, job.RetentionDays)
+		selectedTapeID, tapeLabel, err := s.reserveTapeFromPool(job.PoolID, job.RetentionDays, job.ID)
 		if err != nil {
-			s.respondError(w, http.StatusBadRequest, fmt.Sprintf("no suitable tape found in pool: %v", err))
+			s.respondTapeSelectionError(w, err, fmt.Sprintf("no suitable tape found in pool: %v", err))
 			return
 		}
 		tapeID = selectedTapeID
+		if err := s.backupService.CheckTapeWritable(tapeID); err != nil {
+			s.releaseUnusedTape(tapeID, job.ID)
+			s.respondError(w, http.StatusBadRequest, err.Error())
+			return
+		}
 
 		// Run backup in background
 		go func() {
@@ -3510,9 +4725,13 @@ func (s *Server) handleRunJob(w http.ResponseWriter, r *http.Request) {
 
 		s.auditLog(r, "run", "backup_job", id, "Started backup job")
 
+		message := fmt.Sprintf("Backup job started using tape %s from pool", tapeLabel)
+		if wait := s.jobDriveWait(job.ID); wait != "" {
+			message += "; " + wait
+		}
 		s.respondJSON(w, http.StatusAccepted, map[string]interface{}{
 			"status":     "started",
-			"message":    fmt.Sprintf("Backup job started using tape %s from pool", tapeLabel),
+			"message":    message,
 			"tape_id":    tapeID,
 			"tape_label": tapeLabel,
 		})
@@ -3523,6 +4742,14 @@ func (s *Server) handleRunJob(w http.ResponseWriter, r *http.Request) {
 		s.respondError(w, http.StatusBadRequest, "tape_id is required when not using pool-based selection")
 		return
 	}
+	if err := s.backupService.CheckTapeWritable(tapeID); err != nil {
+		s.respondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if err := s.backupService.ReserveTape(tapeID, job.ID); err != nil {
+		s.respondReserveError(w, err)
+		return
+	}
 
 	// Run backup in background with explicit tape
 	go func() {
@@ -3548,25 +4775,33 @@ func (s *Server) handleRunJob(w http.ResponseWriter, r *http.Request) {
 
 	s.auditLog(r, "run", "backup_job", id, "Started backup job")
 
+	message := "Backup job started in background"
+	if wait := s.jobDriveWait(job.ID); wait != "" {
+		message += "; " + wait
+	}
 	s.respondJSON(w, http.StatusAccepted, map[string]string{
 		"status":  "started",
-		"message": "Backup job started in background",
+		"message": message,
 	})
 }
 
 // selectTapeFromPool picks the best tape from a pool based on status, available space, and retention.
-// It prefers active tapes with remaining space, then blank tapes.
+// It prefers active tapes with remaining space, then blank tapes, and skips tapes
+// another job has reserved.
 func (s *Server) selectTapeFromPool(poolID int64, retentionDays int) (int64, string, error) {
 	var tapeID int64
 	var tapeLabel string
 
-	// Prefer tapes currently loaded in an enabled drive so the backup can proceed immediately.
+	// Only tapes of the pool's format, if it has one, are considered. Prefer
+	// tapes currently loaded in an enabled drive so the backup can proceed immediately.
 
 	// Active tape loaded in a drive with remaining capacity
 	err := s.db.QueryRow(`
 		SELECT t.id, t.label FROM tapes t
 		JOIN tape_drives td ON td.current_tape_id = t.id AND COALESCE(td.enabled, 1) = 1
 		WHERE t.pool_id = ? AND t.status = 'active' AND (t.capacity_bytes - t.used_bytes) > 0
+		AND t.id NOT IN (SELECT tape_id FROM tape_reservations WHERE expires_at > datetime('now'))
+		AND t.format_type = COALESCE((SELECT format_type FROM tape_pools WHERE id = t.pool_id), t.format_type)
 		ORDER BY t.used_bytes ASC
 		LIMIT 1
 	`, poolID).Scan(&tapeID, &tapeLabel)
@@ -3579,6 +4814,8 @@ func (s *Server) selectTapeFromPool(poolID int64, retentionDays int) (int64, str
 		SELECT t.id, t.label FROM tapes t
 		JOIN tape_drives td ON td.current_tape_id = t.id AND COALESCE(td.enabled, 1) = 1
 		WHERE t.pool_id = ? AND t.status = 'blank'
+		AND t.id NOT IN (SELECT tape_id FROM tape_reservations WHERE expires_at > datetime('now'))
+		AND t.format_type = COALESCE((SELECT format_type FROM tape_pools WHERE id = t.pool_id), t.format_type)
 		ORDER BY t.created_at ASC
 		LIMIT 1
 	`, poolID).Scan(&tapeID, &tapeLabel)
@@ -3586,11 +4823,14 @@ func (s *Server) selectTapeFromPool(poolID int64, retentionDays int) (int64, str
 		return tapeID, tapeLabel, nil
 	}
 
-	// Fallback: active tape not necessarily in a drive
+	// Fallback: active tape not necessarily in a drive, one a library can
+	// fetch first
 	err = s.db.QueryRow(`
 		SELECT id, label FROM tapes
 		WHERE pool_id = ? AND status = 'active' AND (capacity_bytes - used_bytes) > 0
-		ORDER BY used_bytes ASC
+		AND id NOT IN (SELECT tape_id FROM tape_reservations WHERE expires_at > datetime('now'))
+		AND format_type = COALESCE((SELECT format_type FROM tape_pools WHERE tape_pools.id = tapes.pool_id), format_type)
+		ORDER BY `+library.InSlotOrder+` DESC, used_bytes ASC
 		LIMIT 1
 	`, poolID).Scan(&tapeID, &tapeLabel)
 	if err == nil {
@@ -3601,7 +4841,9 @@ func (s *Server) selectTapeFromPool(poolID int64, retentionDays int) (int64, str
 	err = s.db.QueryRow(`
 		SELECT id, label FROM tapes
 		WHERE pool_id = ? AND status = 'blank'
-		ORDER BY created_at ASC
+		AND id NOT IN (SELECT tape_id FROM tape_reservations WHERE expires_at > datetime('now'))
+		AND format_type = COALESCE((SELECT format_type FROM tape_pools WHERE tape_pools.id = tapes.pool_id), format_type)
+		ORDER BY `+library.InSlotOrder+` DESC, created_at ASC
 		LIMIT 1
 	`, poolID).Scan(&tapeID, &tapeLabel)
 	if err == nil {
@@ -3612,20 +4854,53 @@ func (s *Server) selectTapeFromPool(poolID int64, retentionDays int) (int64, str
 	var allowReuse bool
 	_ = s.db.QueryRow("SELECT allow_reuse FROM tape_pools WHERE id = ?", poolID).Scan(&allowReuse)
 	if allowReuse {
-		err = s.db.QueryRow(`
-			SELECT id, label FROM tapes
-			WHERE pool_id = ? AND status = 'expired'
-			ORDER BY last_written_at ASC
-			LIMIT 1
-		`, poolID).Scan(&tapeID, &tapeLabel)
+		tapeID, tapeLabel, err = s.reusableTape(poolID)
 		if err == nil {
 			return tapeID, tapeLabel, nil
 		}
+		var pending *errReusePending
+		if errors.As(err, &pending) {
+			return 0, "", fmt.Errorf("no available tapes in pool: %w", err)
+		}
 	}
 
 	return 0, "", errors.New("no available tapes in pool (need blank, active with space, or expired reusable tapes)")
 }
 
+// reserveTapeFromPool selects a tape from a pool and reserves it for a job,
+// so a concurrent start cannot pick the same tape before the job begins
+// writing. A tape reserved between selection and reservation is skipped.
+func (s *Server) reserveTapeFromPool(poolID int64, retentionDays int, jobID int64) (int64, string, error) {
+	// A job pinned to a drive writes to the pool tape loaded there if it can
+	if tapeID, tapeLabel, err := s.backupService.TapeInJobDrive(jobID, poolID); err == nil {
+		if err := s.backupService.ReserveTape(tapeID, jobID); err == nil {
+			return tapeID, tapeLabel, nil
+		}
+	}
+	for attempt := 0; attempt < 3; attempt++ {
+		tapeID, tapeLabel, err := s.selectTapeFromPool(poolID, retentionDays)
+		if err != nil {
+			return 0, "", err
+		}
+		err = s.backupService.ReserveTape(tapeID, jobID)
+		if err == nil {
+			return tapeID, tapeLabel, nil
+		}
+		if !errors.Is(err, backup.ErrTapeReserved) {
+			return 0, "", err
+		}
+	}
+	return 0, "", backup.ErrTapeReserved
+}
+
+// releaseUnusedTape drops a job's reservation of a tape after its run
+// failed to start, unless another run of the job holds the tape
+func (s *Server) releaseUnusedTape(tapeID, jobID int64) {
+	if !s.backupService.IsJobActive(jobID) {
+		s.backupService.ReleaseTape(tapeID, jobID)
+	}
+}
+
 // handleRecommendTape recommends the best tape from a job's pool for backup
 func (s *Server) handleRecommendTape(w http.ResponseWriter, r *http.Request) {
 	id, err := s.getIDParam(r)
@@ -3679,69 +4954,255 @@ func (s *Server) handleRecommendTape(w http.ResponseWriter, r *http.Request) {
 	})
 }
 
-func (s *Server) handleActiveJobs(w http.ResponseWriter, r *http.Request) {
-	activeJobs := s.backupService.GetActiveJobs()
-	s.respondJSON(w, http.StatusOK, activeJobs)
-}
-
-func (s *Server) handleCancelJob(w http.ResponseWriter, r *http.Request) {
+// handleSimulateRetention replays a job's schedule and retention over the
+// next N months against its pool's current tapes and predicts consumption.
+// Run sizes come from the job's recent completed backup sets unless
+// overridden with full_bytes / incremental_bytes.
+func (s *Server) handleSimulateRetention(w http.ResponseWriter, r *http.Request) {
 	id, err := s.getIDParam(r)
 	if err != nil {
 		s.respondError(w, http.StatusBadRequest, "invalid job id")
 		return
 	}
 
-	if s.backupService.CancelJob(id) {
-		if s.eventBus != nil {
-			s.eventBus.Publish(SystemEvent{
-				Type:     "warning",
-				Category: "backup",
-				Title:    "Job Cancelled",
-				Message:  fmt.Sprintf("Backup job %d was cancelled by user", id),
-			})
+	months := 12
+	if m := r.URL.Query().Get("months"); m != "" {
+		parsed, err := strconv.Atoi(m)
+		if err != nil || parsed < 1 || parsed > 60 {
+			s.respondError(w, http.StatusBadRequest, "months must be between 1 and 60")
+			return
 		}
-		s.respondJSON(w, http.StatusOK, map[string]string{"status": "cancelled"})
-	} else {
-		s.respondError(w, http.StatusNotFound, "no active job found with that id")
+		months = parsed
 	}
-}
-
-func (s *Server) handlePauseJob(w http.ResponseWriter, r *http.Request) {
-	id, err := s.getIDParam(r)
-	if err != nil {
-		s.respondError(w, http.StatusBadRequest, "invalid job id")
+	queryBytes := func(name string) (int64, bool) {
+		v := r.URL.Query().Get(name)
+		if v == "" {
+			return 0, true
+		}
+		n, err := strconv.ParseInt(v, 10, 64)
+		if err != nil || n < 0 {
+			s.respondError(w, http.StatusBadRequest, fmt.Sprintf("%s must be a non-negative number of bytes", name))
+			return 0, false
+		}
+		return n, true
+	}
+	fullBytes, ok := queryBytes("full_bytes")
+	if !ok {
 		return
 	}
-
-	if s.backupService.PauseJob(id) {
-		if s.eventBus != nil {
-			s.eventBus.Publish(SystemEvent{
-				Type:     "info",
-				Category: "backup",
-				Title:    "Job Paused",
-				Message:  fmt.Sprintf("Backup job %d was paused by user", id),
-			})
-		}
-		s.respondJSON(w, http.StatusOK, map[string]string{"status": "paused"})
-	} else {
-		s.respondError(w, http.StatusNotFound, "no active job found with that id")
+	incrementalBytes, ok := queryBytes("incremental_bytes")
+	if !ok {
+		return
+	}
+	newTapeCapacity, ok := queryBytes("new_tape_capacity_bytes")
+	if !ok {
+		return
 	}
-}
 
-func (s *Server) handleResumeJob(w http.ResponseWriter, r *http.Request) {
-	id, err := s.getIDParam(r)
+	var job models.BackupJob
+	err = s.db.QueryRow(`
+		SELECT id, name, pool_id, backup_type, schedule_cron, retention_days FROM backup_jobs WHERE id = ?
+	`, id).Scan(&job.ID, &job.Name, &job.PoolID, &job.BackupType, &job.ScheduleCron, &job.RetentionDays)
 	if err != nil {
-		s.respondError(w, http.StatusBadRequest, "invalid job id")
+		s.respondError(w, http.StatusNotFound, "job not found")
 		return
 	}
-
+	if job.ScheduleCron == "" {
+		s.respondError(w, http.StatusBadRequest, "job has no schedule to simulate")
+		return
+	}
+	schedule, err := scheduler.ParseSchedule(job.ScheduleCron)
+	if err != nil {
+		s.respondError(w, http.StatusBadRequest, fmt.Sprintf("invalid job schedule: %v", err))
+		return
+	}
+
+	var pool models.TapePool
+	err = s.db.QueryRow("SELECT id, name, retention_days, allow_reuse FROM tape_pools WHERE id = ?", job.PoolID).
+		Scan(&pool.ID, &pool.Name, &pool.RetentionDays, &pool.AllowReuse)
+	if err != nil {
+		s.respondError(w, http.StatusNotFound, "pool not found")
+		return
+	}
+
+	// Average the most recent completed runs of each type
+	fullSource, incrementalSource := "request", "request"
+	var fullRuns int
+	var histFull, histIncr *float64
+	_ = s.db.QueryRow(`
+		SELECT COUNT(*), AVG(total_bytes) FROM (
+			SELECT total_bytes FROM backup_sets
+			WHERE job_id = ? AND status = 'completed' AND backup_type = 'full'
+			ORDER BY start_time DESC LIMIT 5)
+	`, id).Scan(&fullRuns, &histFull)
+	_ = s.db.QueryRow(`
+		SELECT AVG(total_bytes) FROM (
+			SELECT total_bytes FROM backup_sets
+			WHERE job_id = ? AND status = 'completed' AND backup_type = 'incremental'
+			ORDER BY start_time DESC LIMIT 10)
+	`, id).Scan(&histIncr)
+	if fullBytes == 0 {
+		if histFull == nil {
+			s.respondError(w, http.StatusBadRequest, "job has no completed full backups to size from; pass full_bytes")
+			return
+		}
+		fullBytes, fullSource = int64(*histFull), "history"
+	}
+	changesOnly := job.BackupType == models.BackupTypeIncremental || job.BackupType == models.BackupTypeDifferential
+	if incrementalBytes == 0 && changesOnly {
+		if histIncr != nil {
+			incrementalBytes, incrementalSource = int64(*histIncr), "history"
+		} else {
+			// No incremental history yet: assume 5% daily change
+			incrementalBytes, incrementalSource = fullBytes/20, "estimated"
+		}
+	} else if !changesOnly {
+		incrementalSource = "not_applicable"
+	}
+
+	retentionDays := job.RetentionDays
+	if retentionDays <= 0 {
+		retentionDays = pool.RetentionDays
+	}
+	existingRetention := pool.RetentionDays
+	if retentionDays > existingRetention {
+		existingRetention = retentionDays
+	}
+
+	rows, err := s.db.Query(`
+		SELECT id, label, status, capacity_bytes, used_bytes, last_written_at
+		FROM tapes WHERE pool_id = ? ORDER BY created_at ASC, id ASC
+	`, job.PoolID)
+	if err != nil {
+		s.respondError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	defer rows.Close()
+	var tapes []backup.SimTape
+	for rows.Next() {
+		var t backup.SimTape
+		if err := rows.Scan(&t.ID, &t.Label, &t.Status, &t.CapacityBytes, &t.UsedBytes, &t.LastWrittenAt); err != nil {
+			continue
+		}
+		tapes = append(tapes, t)
+	}
+	// New cartridges are assumed to match the largest tape already in the pool
+	if newTapeCapacity == 0 {
+		for _, t := range tapes {
+			if t.CapacityBytes > newTapeCapacity {
+				newTapeCapacity = t.CapacityBytes
+			}
+		}
+	}
+	if newTapeCapacity == 0 {
+		s.respondError(w, http.StatusBadRequest, "pool has no tapes to take a capacity from; pass new_tape_capacity_bytes")
+		return
+	}
+
+	start := time.Now()
+	result, err := backup.SimulateRetention(backup.RetentionSimInput{
+		Start:                 start,
+		End:                   start.AddDate(0, months, 0),
+		Schedule:              schedule,
+		BackupType:            job.BackupType,
+		FirstRunFull:          fullRuns == 0,
+		FullBytes:             fullBytes,
+		IncrementalBytes:      incrementalBytes,
+		RetentionDays:         retentionDays,
+		ExistingRetentionDays: existingRetention,
+		AllowReuse:            pool.AllowReuse,
+		NewTapeCapacity:       newTapeCapacity,
+		Tapes:                 tapes,
+	})
+	if err != nil {
+		s.respondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	s.respondJSON(w, http.StatusOK, map[string]interface{}{
+		"job_id":         job.ID,
+		"job_name":       job.Name,
+		"pool_id":        pool.ID,
+		"pool_name":      pool.Name,
+		"schedule_cron":  job.ScheduleCron,
+		"backup_type":    job.BackupType,
+		"retention_days": retentionDays,
+		"allow_reuse":    pool.AllowReuse,
+		"months":         months,
+		"assumptions": map[string]interface{}{
+			"full_bytes":               fullBytes,
+			"full_bytes_source":        fullSource,
+			"incremental_bytes":        incrementalBytes,
+			"incremental_bytes_source": incrementalSource,
+			"new_tape_capacity_bytes":  newTapeCapacity,
+		},
+		"simulation": result,
+	})
+}
+
+func (s *Server) handleActiveJobs(w http.ResponseWriter, r *http.Request) {
+	activeJobs := s.backupService.GetActiveJobs()
+	s.respondJSON(w, http.StatusOK, activeJobs)
+}
+
+func (s *Server) handleCancelJob(w http.ResponseWriter, r *http.Request) {
+	id, err := s.getIDParam(r)
+	if err != nil {
+		s.respondError(w, http.StatusBadRequest, "invalid job id")
+		return
+	}
+
+	if s.backupService.CancelJob(id) {
+		if s.eventBus != nil {
+			s.eventBus.Publish(SystemEvent{
+				Type:     "warning",
+				Category: "backup",
+				Key:      "job_cancelled",
+				Args:     []interface{}{id},
+			})
+		}
+		s.respondJSON(w, http.StatusOK, map[string]string{"status": "cancelled"})
+	} else {
+		s.respondError(w, http.StatusNotFound, "no active job found with that id")
+	}
+}
+
+func (s *Server) handlePauseJob(w http.ResponseWriter, r *http.Request) {
+	id, err := s.getIDParam(r)
+	if err != nil {
+		s.respondError(w, http.StatusBadRequest, "invalid job id")
+		return
+	}
+
+	if s.backupService.PauseJob(id) {
+		if s.eventBus != nil {
+			s.eventBus.Publish(SystemEvent{
+				Type:     "info",
+				Category: "backup",
+				Key:      "job_paused",
+				Args:     []interface{}{id},
+			})
+		}
+		s.respondJSON(w, http.StatusOK, map[string]string{"status": "paused"})
+	} else {
+		s.respondError(w, http.StatusNotFound, "no active job found with that id")
+	}
+}
+
+func (s *Server) handleResumeJob(w http.ResponseWriter, r *http.Request) {
+	id, err := s.getIDParam(r)
+	if err != nil {
+		s.respondError(w, http.StatusBadRequest, "invalid job id")
+		return
+	}
+
 	if s.backupService.ResumeJob(id) {
 		if s.eventBus != nil {
 			s.eventBus.Publish(SystemEvent{
 				Type:     "info",
 				Category: "backup",
-				Title:    "Job Resumed",
-				Message:  fmt.Sprintf("Backup job %d was resumed by user", id),
+				Key:      "job_resumed",
+				Args:     []interface{}{id},
 			})
 		}
 		s.respondJSON(w, http.StatusOK, map[string]string{"status": "resumed"})
@@ -3765,42 +5226,16 @@ func (s *Server) handleRetryJob(w http.ResponseWriter, r *http.Request) {
 	}
 	json.NewDecoder(r.Body).Decode(&req)
 
-	// Get job details
-	var job models.BackupJob
-	err = s.db.QueryRow(`
-		SELECT id, name, source_id, pool_id, backup_type, retention_days,
-			encryption_enabled, encryption_key_id,
-			COALESCE(hw_encryption_enabled, 0), hw_encryption_key_id,
-			compression
-		FROM backup_jobs WHERE id = ?
-	`, id).Scan(&job.ID, &job.Name, &job.SourceID, &job.PoolID, &job.BackupType, &job.RetentionDays,
-		&job.EncryptionEnabled, &job.EncryptionKeyID,
-		&job.HwEncryptionEnabled, &job.HwEncryptionKeyID,
-		&job.Compression)
-	if err != nil {
-		s.respondError(w, http.StatusNotFound, "job not found")
-		return
-	}
-
-	// Get source details
-	var source models.BackupSource
-	err = s.db.QueryRow(`
-		SELECT id, name, source_type, path, include_patterns, exclude_patterns
-		FROM backup_sources WHERE id = ?
-	`, job.SourceID).Scan(&source.ID, &source.Name, &source.SourceType, &source.Path, &source.IncludePatterns, &source.ExcludePatterns)
+	job, source, err := s.loadRetryJob(id)
 	if err != nil {
-		s.respondError(w, http.StatusNotFound, "source not found")
+		s.respondError(w, http.StatusNotFound, err.Error())
 		return
 	}
 
 	// Look for a resumable execution if not starting from scratch
 	var resumeState string
 	if !req.FromScratch {
-		_ = s.db.QueryRow(`
-			SELECT resume_state FROM job_executions
-			WHERE job_id = ? AND can_resume = 1 AND status IN ('paused', 'failed')
-			ORDER BY created_at DESC LIMIT 1
-		`, id).Scan(&resumeState)
+		resumeState = s.jobResumeState(id)
 	}
 
 	// Determine tape to use
@@ -3812,9 +5247,9 @@ func (s *Server) handleRetryJob(w http.ResponseWriter, r *http.Request) {
 
 	var tapeLabel string
 	if usePool && job.PoolID > 0 {
-		selectedTapeID, selectedLabel, err := s.selectTapeFromPool(job.PoolID, job.RetentionDays)
+		selectedTapeID, selectedLabel, err := s.reserveTapeFromPool(job.PoolID, job.RetentionDays, job.ID)
 		if err != nil {
-			s.respondError(w, http.StatusBadRequest, fmt.Sprintf("no suitable tape found in pool: %v", err))
+			s.respondTapeSelectionError(w, err, fmt.Sprintf("no suitable tape found in pool: %v", err))
 			return
 		}
 		tapeID = selectedTapeID
@@ -3824,13 +5259,92 @@ func (s *Server) handleRetryJob(w http.ResponseWriter, r *http.Request) {
 		return
 	} else {
 		_ = s.db.QueryRow("SELECT label FROM tapes WHERE id = ?", tapeID).Scan(&tapeLabel)
+		if err := s.backupService.ReserveTape(tapeID, job.ID); err != nil {
+			s.respondReserveError(w, err)
+			return
+		}
+	}
+	if err := s.backupService.CheckTapeWritable(tapeID); err != nil {
+		s.releaseUnusedTape(tapeID, job.ID)
+		s.respondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	s.startRetryRun(job, source, tapeID, resumeState)
+
+	s.auditLog(r, "retry", "backup_job", id, "Retried backup job")
+
+	msg := "Backup job retried"
+	if resumeState != "" {
+		msg = "Backup job resumed from checkpoint"
+	}
+	if tapeLabel != "" {
+		msg += fmt.Sprintf(" using tape %s", tapeLabel)
+	}
+
+	s.respondJSON(w, http.StatusAccepted, map[string]interface{}{
+		"status":     "started",
+		"message":    msg,
+		"tape_id":    tapeID,
+		"tape_label": tapeLabel,
+		"resumed":    resumeState != "",
+	})
+}
+
+// loadRetryJob loads a job and its source for a retried run
+func (s *Server) loadRetryJob(id int64) (*models.BackupJob, *models.BackupSource, error) {
+	var job models.BackupJob
+	err := s.db.QueryRow(`
+		SELECT id, name, source_id, pool_id, backup_type, retention_days,
+			encryption_enabled, encryption_key_id,
+			COALESCE(hw_encryption_enabled, 0), hw_encryption_key_id,
+			compression, COALESCE(dedup_enabled, 0), COALESCE(pipelined_scan, 0), COALESCE(directory_report, 0),
+			COALESCE(change_detection, 'metadata'), COALESCE(hash_sampled, 0), COALESCE(snapshot_retention, 0),
+			COALESCE(full_every_incrementals, 0), COALESCE(full_every_days, 0),
+			guard_max_files, guard_max_bytes, guard_max_change_percent, guard_action
+		FROM backup_jobs WHERE id = ?
+	`, id).Scan(&job.ID, &job.Name, &job.SourceID, &job.PoolID, &job.BackupType, &job.RetentionDays,
+		&job.EncryptionEnabled, &job.EncryptionKeyID,
+		&job.HwEncryptionEnabled, &job.HwEncryptionKeyID,
+		&job.Compression, &job.DedupEnabled, &job.PipelinedScan, &job.DirectoryReport,
+		&job.ChangeDetection, &job.HashSampled, &job.SnapshotRetention,
+		&job.FullEveryIncrementals, &job.FullEveryDays,
+		&job.GuardMaxFiles, &job.GuardMaxBytes, &job.GuardMaxChangePercent, &job.GuardAction)
+	if err != nil {
+		return nil, nil, fmt.Errorf("job not found")
 	}
 
+	var source models.BackupSource
+	err = s.db.QueryRow(`
+		SELECT id, name, source_type, path, include_patterns, exclude_patterns, symlink_policy
+		FROM backup_sources WHERE id = ?
+	`, job.SourceID).Scan(&source.ID, &source.Name, &source.SourceType, &source.Path, &source.IncludePatterns, &source.ExcludePatterns, &source.SymlinkPolicy)
+	if err != nil {
+		return nil, nil, fmt.Errorf("source not found")
+	}
+	return &job, &source, nil
+}
+
+// jobResumeState returns the resume state of a job's newest resumable
+// execution, or "" when there is none
+func (s *Server) jobResumeState(jobID int64) string {
+	var resumeState string
+	_ = s.db.QueryRow(`
+		SELECT resume_state FROM job_executions
+		WHERE job_id = ? AND can_resume = 1 AND status IN ('paused', 'failed')
+		ORDER BY created_at DESC LIMIT 1
+	`, jobID).Scan(&resumeState)
+	return resumeState
+}
+
+// startRetryRun supersedes a job's resumable executions and runs it in the
+// background on the reserved tape, resuming from resumeState when set
+func (s *Server) startRetryRun(job *models.BackupJob, source *models.BackupSource, tapeID int64, resumeState string) {
 	// Mark previous failed/paused executions as superseded
 	s.db.Exec(`
 		UPDATE job_executions SET can_resume = 0
 		WHERE job_id = ? AND can_resume = 1 AND status IN ('paused', 'failed')
-	`, id)
+	`, job.ID)
 
 	// Run backup in background with optional resume state
 	go func() {
@@ -3847,9 +5361,9 @@ func (s *Server) handleRetryJob(w http.ResponseWriter, r *http.Request) {
 		ctx := context.Background()
 		var err error
 		if resumeState != "" {
-			_, err = s.backupService.RunBackupWithResume(ctx, &job, &source, tapeID, job.BackupType, resumeState)
+			_, err = s.backupService.RunBackupWithResume(ctx, job, source, tapeID, job.BackupType, resumeState)
 		} else {
-			_, err = s.backupService.RunBackup(ctx, &job, &source, tapeID, job.BackupType)
+			_, err = s.backupService.RunBackup(ctx, job, source, tapeID, job.BackupType)
 		}
 		if err != nil {
 			s.logger.Error("Backup job failed", map[string]interface{}{
@@ -3859,24 +5373,6 @@ func (s *Server) handleRetryJob(w http.ResponseWriter, r *http.Request) {
 			})
 		}
 	}()
-
-	s.auditLog(r, "retry", "backup_job", id, "Retried backup job")
-
-	msg := "Backup job retried"
-	if resumeState != "" {
-		msg = "Backup job resumed from checkpoint"
-	}
-	if tapeLabel != "" {
-		msg += fmt.Sprintf(" using tape %s", tapeLabel)
-	}
-
-	s.respondJSON(w, http.StatusAccepted, map[string]interface{}{
-		"status":     "started",
-		"message":    msg,
-		"tape_id":    tapeID,
-		"tape_label": tapeLabel,
-		"resumed":    resumeState != "",
-	})
 }
 
 // handleResumableJobs lists jobs that have paused or failed executions that can be resumed
@@ -3934,7 +5430,9 @@ func (s *Server) handleListBackupSets(w http.ResponseWriter, r *http.Request) {
 		       COALESCE(bs.encrypted, 0) as encrypted, bs.encryption_key_id,
 		       COALESCE(bs.hw_encrypted, 0) as hw_encrypted, bs.hw_encryption_key_id,
 		       COALESCE(bs.compressed, 0) as compressed, COALESCE(bs.compression_type, 'none') as compression_type,
-		       tp.name as pool_name
+		       tp.name as pool_name, COALESCE(bs.promotion_reason, ''), bs.guardrail, COALESCE(j.ad_hoc, 0),
+		       bs.invalidated_at, bs.invalidation_reason, bs.chain_broken_at, bs.chain_broken_reason,
+		       bs.cloud_copy_url, bs.cloud_copy_status, bs.ndmp_type
 		FROM backup_sets bs
 		LEFT JOIN backup_jobs j ON bs.job_id = j.id
 		LEFT JOIN tapes t ON bs.tape_id = t.id
@@ -3969,11 +5467,14 @@ func (s *Server) handleListBackupSets(w http.ResponseWriter, r *http.Request) {
 		var compressed bool
 		var compressionType string
 		var poolName *string
+		var adHoc bool
 		if err := rows.Scan(&bs.ID, &bs.JobID, &jobName, &bs.TapeID, &tapeLabel,
 			&bs.BackupType, &bs.StartTime, &bs.EndTime, &bs.Status, &bs.FileCount, &bs.TotalBytes,
 			&encrypted, &encryptionKeyID,
 			&hwEncrypted, &hwEncryptionKeyID,
-			&compressed, &compressionType, &poolName); err != nil {
+			&compressed, &compressionType, &poolName, &bs.PromotionReason, &bs.Guardrail, &adHoc,
+			&bs.InvalidatedAt, &bs.InvalidationReason, &bs.ChainBrokenAt, &bs.ChainBrokenReason,
+			&bs.CloudCopyURL, &bs.CloudCopyStatus, &bs.NDMPType); err != nil {
 			continue
 		}
 		set := map[string]interface{}{
@@ -3995,6 +5496,16 @@ func (s *Server) handleListBackupSets(w http.ResponseWriter, r *http.Request) {
 			"compressed":           compressed,
 			"compression_type":     compressionType,
 			"pool_name":            poolName,
+			"promotion_reason":     bs.PromotionReason,
+			"guardrail":            bs.Guardrail,
+			"ad_hoc":               adHoc,
+			"invalidated_at":       bs.InvalidatedAt,
+			"invalidation_reason":  bs.InvalidationReason,
+			"chain_broken_at":      bs.ChainBrokenAt,
+			"chain_broken_reason":  bs.ChainBrokenReason,
+			"cloud_copy_url":       bs.CloudCopyURL,
+			"cloud_copy_status":    bs.CloudCopyStatus,
+			"ndmp_type":            bs.NDMPType,
 		}
 		sets = append(sets, set)
 	}
@@ -4010,16 +5521,39 @@ func (s *Server) handleGetBackupSet(w http.ResponseWriter, r *http.Request) {
 	}
 
 	var bs models.BackupSet
+	var encFormat, encKDF, encSalt, encIV string
+	var encChunkSize int
+	var streamStages sql.NullString
 	err = s.db.QueryRow(`
 		SELECT id, job_id, tape_id, backup_type, start_time, end_time, status, 
-		       file_count, total_bytes, start_block, end_block, checksum, created_at
+		       file_count, total_bytes, start_block, end_block, checksum, symlink_policy,
+		       COALESCE(skipped_count, 0), COALESCE(skip_summary, ''), COALESCE(deleted_count, 0),
+		       COALESCE(dedup_count, 0), COALESCE(dedup_bytes, 0), COALESCE(promotion_reason, ''), guardrail,
+		       tape_bytes, block_size, COALESCE(synthetic, 0), invalidated_at, invalidation_reason,
+		       chain_broken_at, chain_broken_reason,
+		       cloud_copy_url, cloud_copy_status, cloud_copy_bytes, cloud_copy_error, cloud_copy_at,
+		       ndmp_type, ndmp_level,
+		       COALESCE(encrypted, 0), encryption_key_id,
+		       encryption_format, encryption_kdf, encryption_salt, encryption_iv, encryption_chunk_size,
+		       stream_stages, created_at
 		FROM backup_sets WHERE id = ?
 	`, id).Scan(&bs.ID, &bs.JobID, &bs.TapeID, &bs.BackupType, &bs.StartTime, &bs.EndTime, &bs.Status,
-		&bs.FileCount, &bs.TotalBytes, &bs.StartBlock, &bs.EndBlock, &bs.Checksum, &bs.CreatedAt)
+		&bs.FileCount, &bs.TotalBytes, &bs.StartBlock, &bs.EndBlock, &bs.Checksum, &bs.SymlinkPolicy,
+		&bs.SkippedCount, &bs.SkipSummary, &bs.DeletedCount,
+		&bs.DedupCount, &bs.DedupBytes, &bs.PromotionReason, &bs.Guardrail,
+		&bs.TapeBytes, &bs.BlockSize, &bs.Synthetic, &bs.InvalidatedAt, &bs.InvalidationReason,
+		&bs.ChainBrokenAt, &bs.ChainBrokenReason,
+		&bs.CloudCopyURL, &bs.CloudCopyStatus, &bs.CloudCopyBytes, &bs.CloudCopyError, &bs.CloudCopyAt,
+		&bs.NDMPType, &bs.NDMPLevel,
+		&bs.Encrypted, &bs.EncryptionKeyID,
+		&encFormat, &encKDF, &encSalt, &encIV, &encChunkSize,
+		&streamStages, &bs.CreatedAt)
 	if err != nil {
 		s.respondError(w, http.StatusNotFound, "backup set not found")
 		return
 	}
+	bs.Encryption = models.ParseEncryptionMetadata(encFormat, encKDF, encSalt, encIV, encChunkSize)
+	bs.StreamStages, _ = stages.Parse(streamStages)
 
 	s.respondJSON(w, http.StatusOK, bs)
 }
@@ -4056,25 +5590,270 @@ func (s *Server) handleListBackupFiles(w http.ResponseWriter, r *http.Request) {
 	s.respondJSON(w, http.StatusOK, entries)
 }
 
-func (s *Server) handleDeleteBackupSet(w http.ResponseWriter, r *http.Request) {
+// handleListSkippedPaths returns the paths skipped while scanning the source
+// of a backup set, with the reason for each. Use ?format=csv to download the
+// full report.
+func (s *Server) handleListSkippedPaths(w http.ResponseWriter, r *http.Request) {
 	id, err := s.getIDParam(r)
 	if err != nil {
 		s.respondError(w, http.StatusBadRequest, "invalid backup set id")
 		return
 	}
 
-	// Check the backup set exists and get its status
-	var status string
-	err = s.db.QueryRow("SELECT status FROM backup_sets WHERE id = ?", id).Scan(&status)
+	var skippedCount int64
+	var summary string
+	if err := s.db.QueryRow("SELECT COALESCE(skipped_count, 0), COALESCE(skip_summary, '') FROM backup_sets WHERE id = ?", id).Scan(&skippedCount, &summary); err != nil {
+		s.respondError(w, http.StatusNotFound, "backup set not found")
+		return
+	}
+
+	query := "SELECT path, reason, COALESCE(detail, '') FROM backup_skipped_paths WHERE backup_set_id = ?"
+	args := []interface{}{id}
+	if reason := r.URL.Query().Get("reason"); reason != "" {
+		query += " AND reason = ?"
+		args = append(args, reason)
+	}
+	query += " ORDER BY path"
+
+	format := r.URL.Query().Get("format")
+	if format != "csv" {
+		limit := 1000
+		if l := r.URL.Query().Get("limit"); l != "" {
+			if parsed, err := strconv.Atoi(l); err == nil && parsed > 0 {
+				limit = parsed
+			}
+		}
+		query += " LIMIT ?"
+		args = append(args, limit)
+	}
+
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		s.respondError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	defer rows.Close()
+
+	if format == "csv" {
+		w.Header().Set("Content-Type", "text/csv")
+		w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"backup-set-%d-skipped.csv\"", id))
+		cw := csv.NewWriter(w)
+		cw.Write([]string{"path", "reason", "detail"})
+		for rows.Next() {
+			var p backup.SkippedPath
+			if err := rows.Scan(&p.Path, &p.Reason, &p.Detail); err != nil {
+				continue
+			}
+			cw.Write([]string{p.Path, string(p.Reason), p.Detail})
+		}
+		cw.Flush()
+		return
+	}
+
+	paths := []backup.SkippedPath{}
+	for rows.Next() {
+		var p backup.SkippedPath
+		if err := rows.Scan(&p.Path, &p.Reason, &p.Detail); err != nil {
+			continue
+		}
+		paths = append(paths, p)
+	}
+
+	resp := map[string]interface{}{
+		"backup_set_id": id,
+		"skipped_count": skippedCount,
+		"paths":         paths,
+	}
+	if summary != "" {
+		resp["summary"] = json.RawMessage(summary)
+	}
+	s.respondJSON(w, http.StatusOK, resp)
+}
+
+// handleListDeletedPaths returns the files an incremental backup set found
+// deleted from the source since the previous run
+func (s *Server) handleListDeletedPaths(w http.ResponseWriter, r *http.Request) {
+	id, err := s.getIDParam(r)
+	if err != nil {
+		s.respondError(w, http.StatusBadRequest, "invalid backup set id")
+		return
+	}
+
+	var deletedCount int64
+	if err := s.db.QueryRow("SELECT COALESCE(deleted_count, 0) FROM backup_sets WHERE id = ?", id).Scan(&deletedCount); err != nil {
+		s.respondError(w, http.StatusNotFound, "backup set not found")
+		return
+	}
+
+	limit := 1000
+	if l := r.URL.Query().Get("limit"); l != "" {
+		if parsed, err := strconv.Atoi(l); err == nil && parsed > 0 {
+			limit = parsed
+		}
+	}
+	query := "SELECT path FROM backup_deleted_paths WHERE backup_set_id = ?"
+	args := []interface{}{id}
+	if prefix := r.URL.Query().Get("prefix"); prefix != "" {
+		query += " AND path LIKE ?"
+		args = append(args, prefix+"%")
+	}
+	rows, err := s.db.Query(query+" ORDER BY path LIMIT ?", append(args, limit)...)
+	if err != nil {
+		s.respondError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	defer rows.Close()
+
+	paths := []string{}
+	for rows.Next() {
+		var p string
+		if err := rows.Scan(&p); err != nil {
+			continue
+		}
+		paths = append(paths, p)
+	}
+	s.respondJSON(w, http.StatusOK, map[string]interface{}{
+		"backup_set_id": id,
+		"deleted_count": deletedCount,
+		"paths":         paths,
+	})
+}
+
+// handleGetBackupSetComposition returns a backup set's directory report: its
+// files and bytes by top-level directory of the source, compared with the
+// previous run of the job that has a report
+func (s *Server) handleGetBackupSetComposition(w http.ResponseWriter, r *http.Request) {
+	id, err := s.getIDParam(r)
 	if err != nil {
+		s.respondError(w, http.StatusBadRequest, "invalid backup set id")
+		return
+	}
+
+	var jobID int64
+	var startTime time.Time
+	if err := s.db.QueryRow("SELECT job_id, start_time FROM backup_sets WHERE id = ?", id).Scan(&jobID, &startTime); err != nil {
 		s.respondError(w, http.StatusNotFound, "backup set not found")
 		return
 	}
 
+	current, err := s.directoryUsage(id)
+	if err != nil {
+		s.respondError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if len(current) == 0 {
+		s.respondError(w, http.StatusNotFound, "backup set has no directory report; enable directory_report on the job")
+		return
+	}
+
+	var previousID *int64
+	var previous []backup.DirectoryUsage
+	var prevID int64
+	err = s.db.QueryRow(`
+		SELECT bs.id FROM backup_sets bs
+		WHERE bs.job_id = ? AND bs.id != ? AND bs.status = 'completed' AND bs.start_time < ?
+			AND EXISTS (SELECT 1 FROM backup_set_directories d WHERE d.backup_set_id = bs.id)
+		ORDER BY bs.start_time DESC LIMIT 1
+	`, jobID, id, startTime).Scan(&prevID)
+	if err == nil {
+		if previous, err = s.directoryUsage(prevID); err != nil {
+			s.respondError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		previousID = &prevID
+	}
+
+	var totalFiles, totalBytes int64
+	for _, u := range current {
+		totalFiles += u.Files
+		totalBytes += u.Bytes
+	}
+	s.respondJSON(w, http.StatusOK, map[string]interface{}{
+		"backup_set_id":          id,
+		"previous_backup_set_id": previousID,
+		"total_files":            totalFiles,
+		"total_bytes":            totalBytes,
+		"directories":            backup.CompareDirectories(current, previous),
+	})
+}
+
+// directoryUsage loads the directory report of a backup set
+func (s *Server) directoryUsage(backupSetID int64) ([]backup.DirectoryUsage, error) {
+	rows, err := s.db.Query("SELECT directory, file_count, total_bytes FROM backup_set_directories WHERE backup_set_id = ?", backupSetID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	usage := []backup.DirectoryUsage{}
+	for rows.Next() {
+		var u backup.DirectoryUsage
+		if err := rows.Scan(&u.Directory, &u.Files, &u.Bytes); err != nil {
+			return nil, err
+		}
+		usage = append(usage, u)
+	}
+	return usage, rows.Err()
+}
+
+func (s *Server) handleDeleteBackupSet(w http.ResponseWriter, r *http.Request) {
+	id, err := s.getIDParam(r)
+	if err != nil {
+		s.respondError(w, http.StatusBadRequest, "invalid backup set id")
+		return
+	}
+
+	// Later sets may need this one to be restored
+	breaks, ok := s.checkChainBreaks(w, []int64{id}, chainLostDeleted, r.URL.Query().Get("force") == "true")
+	if !ok {
+		return
+	}
+
+	status, err := s.deleteBackupSet(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, errBackupSetNotFound):
+			s.respondError(w, http.StatusNotFound, "backup set not found")
+		case errors.Is(err, errBackupSetNotDeletable):
+			s.respondError(w, http.StatusBadRequest, "can only delete failed, completed, or cancelled backup sets")
+		case errors.Is(err, errBackupSetReferenced):
+			s.respondError(w, http.StatusConflict, err.Error())
+		default:
+			s.respondError(w, http.StatusInternalServerError, "failed to delete backup set")
+		}
+		return
+	}
+
+	s.flagChainBreaks(breaks, []int64{id})
+	s.auditLog(r, "delete", "backup_set", id, fmt.Sprintf("Deleted backup set #%d (status: %s)", id, status))
+	s.respondJSON(w, http.StatusOK, map[string]string{"status": "deleted"})
+}
+
+var (
+	errBackupSetNotFound     = errors.New("backup set not found")
+	errBackupSetNotDeletable = errors.New("can only delete failed, completed, or cancelled backup sets")
+	errBackupSetReferenced   = errors.New("backup set holds data for deduplicated files in other backup sets; delete those sets first")
+)
+
+// deleteBackupSet removes a finished backup set and every row referencing it.
+// It returns the status the set had before deletion.
+func (s *Server) deleteBackupSet(id int64) (string, error) {
+	// Check the backup set exists and get its status
+	var status string
+	if err := s.db.QueryRow("SELECT status FROM backup_sets WHERE id = ?", id).Scan(&status); err != nil {
+		return "", errBackupSetNotFound
+	}
+
 	// Only allow deletion of failed, completed, or cancelled backup sets
 	if status != "failed" && status != "completed" && status != "cancelled" {
-		s.respondError(w, http.StatusBadRequest, "can only delete failed, completed, or cancelled backup sets")
-		return
+		return status, errBackupSetNotDeletable
+	}
+
+	// Deduplicated files in later sets may rely on this set's data
+	var refs int
+	s.db.QueryRow("SELECT COUNT(*) FROM catalog_entries WHERE ref_backup_set_id = ? AND backup_set_id != ?", id, id).Scan(&refs)
+	if refs > 0 {
+		return status, errBackupSetReferenced
 	}
 
 	// Delete all foreign key references before deleting the backup set.
@@ -4094,14 +5873,10 @@ func (s *Server) handleDeleteBackupSet(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Delete the backup set
-	_, err = s.db.Exec("DELETE FROM backup_sets WHERE id = ?", id)
-	if err != nil {
-		s.respondError(w, http.StatusInternalServerError, "failed to delete backup set")
-		return
+	if _, err := s.db.Exec("DELETE FROM backup_sets WHERE id = ?", id); err != nil {
+		return status, err
 	}
-
-	s.auditLog(r, "delete", "backup_set", id, fmt.Sprintf("Deleted backup set #%d (status: %s)", id, status))
-	s.respondJSON(w, http.StatusOK, map[string]string{"status": "deleted"})
+	return status, nil
 }
 
 func (s *Server) handleCancelBackupSet(w http.ResponseWriter, r *http.Request) {
@@ -4136,17 +5911,147 @@ func (s *Server) handleCancelBackupSet(w http.ResponseWriter, r *http.Request) {
 	s.respondJSON(w, http.StatusOK, map[string]string{"status": "cancelled"})
 }
 
+// handleImportBackupSet writes an existing tar/tar.gz/tar.zst archive from disk
+// onto a tape under the given job and indexes its contents into the catalog.
+func (s *Server) handleImportBackupSet(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		JobID       int64  `json:"job_id"`
+		TapeID      int64  `json:"tape_id"` // optional; selected from the job's pool when omitted
+		ArchivePath string `json:"archive_path"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		s.respondError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+	if req.JobID == 0 || req.ArchivePath == "" {
+		s.respondError(w, http.StatusBadRequest, "job_id and archive_path are required")
+		return
+	}
+	if !filepath.IsAbs(req.ArchivePath) {
+		s.respondError(w, http.StatusBadRequest, "archive_path must be an absolute path")
+		return
+	}
+	if _, err := backup.DetectArchiveCompression(req.ArchivePath); err != nil {
+		s.respondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if info, err := os.Stat(req.ArchivePath); err != nil || info.IsDir() {
+		s.respondError(w, http.StatusBadRequest, "archive not found")
+		return
+	}
+
+	var job models.BackupJob
+	err := s.db.QueryRow(`
+		SELECT id, name, source_id, pool_id, backup_type, retention_days
+		FROM backup_jobs WHERE id = ?
+	`, req.JobID).Scan(&job.ID, &job.Name, &job.SourceID, &job.PoolID, &job.BackupType, &job.RetentionDays)
+	if err != nil {
+		s.respondError(w, http.StatusNotFound, "job not found")
+		return
+	}
+
+	tapeID := req.TapeID
+	if tapeID == 0 {
+		selectedTapeID, _, err := s.reserveTapeFromPool(job.PoolID, job.RetentionDays, job.ID)
+		if err != nil {
+			s.respondTapeSelectionError(w, err, fmt.Sprintf("no suitable tape found in pool: %v", err))
+			return
+		}
+		tapeID = selectedTapeID
+	} else if err := s.backupService.ReserveTape(tapeID, job.ID); err != nil {
+		s.respondReserveError(w, err)
+		return
+	}
+
+	go func() {
+		defer func() {
+			if r := recover(); r != nil {
+				if s.logger != nil {
+					s.logger.Error("Panic in archive import goroutine", map[string]interface{}{
+						"job_id": job.ID,
+						"panic":  fmt.Sprintf("%v", r),
+					})
+				}
+			}
+		}()
+		if _, err := s.backupService.ImportArchive(context.Background(), &job, tapeID, req.ArchivePath); err != nil {
+			s.releaseUnusedTape(tapeID, job.ID)
+			s.logger.Error("Archive import failed", map[string]interface{}{
+				"job_id":  job.ID,
+				"archive": req.ArchivePath,
+				"error":   err.Error(),
+			})
+		}
+	}()
+
+	s.auditLog(r, "import", "backup_set", job.ID, fmt.Sprintf("Started import of archive %s onto tape %d", req.ArchivePath, tapeID))
+	s.respondJSON(w, http.StatusAccepted, map[string]interface{}{
+		"status":  "started",
+		"message": "Archive import started in background",
+		"tape_id": tapeID,
+	})
+}
+
 // Catalog handlers
 
 func (s *Server) handleSearchCatalog(w http.ResponseWriter, r *http.Request) {
-	pattern := r.URL.Query().Get("q")
-	if pattern == "" {
+	params := r.URL.Query()
+	q := backup.CatalogQuery{
+		Pattern:      params.Get("q"),
+		Owner:        params.Get("owner"),
+		Group:        params.Get("group"),
+		FileType:     params.Get("file_type"),
+		Extension:    params.Get("extension"),
+		ContentClass: params.Get("content_class"),
+	}
+	if q.Pattern == "" && q.Owner == "" && q.Group == "" && params.Get("uid") == "" && q.Extension == "" && q.ContentClass == "" {
 		s.respondError(w, http.StatusBadRequest, "search pattern required")
 		return
 	}
 
+	v := validation.New()
+	if q.FileType != "" {
+		v.OneOf("file_type", q.FileType, backup.FileTypeFile, backup.FileTypeSymlink)
+	}
+	if q.ContentClass != "" {
+		v.OneOf("content_class", q.ContentClass, backup.ContentClasses...)
+	}
+	if p := params.Get("uid"); p != "" {
+		if uid, err := strconv.Atoi(p); err != nil || uid < 0 {
+			v.Add("uid", "must be a non-negative number")
+		} else {
+			q.UID = &uid
+		}
+	}
+	size := func(field string) int64 {
+		p := params.Get(field)
+		if p == "" {
+			return 0
+		}
+		n, err := strconv.ParseInt(p, 10, 64)
+		if err != nil {
+			v.Add(field, "must be a size in bytes")
+			return 0
+		}
+		v.NonNegative(field, n)
+		return n
+	}
+	q.MinSize = size("min_size")
+	q.MaxSize = size("max_size")
+	if p := params.Get("has_xattrs"); p != "" {
+		if b, err := strconv.ParseBool(p); err != nil {
+			v.Add("has_xattrs", "must be true or false")
+		} else {
+			q.HasXattrs = &b
+		}
+	}
+	if err := v.Err(); err != nil {
+		s.respondValidationError(w, err)
+		return
+	}
+
 	ctx := r.Context()
-	entries, err := s.backupService.SearchCatalog(ctx, pattern, 100)
+	entries, err := s.backupService.SearchCatalog(ctx, q, 100)
 	if err != nil {
 		s.respondError(w, http.StatusInternalServerError, err.Error())
 		return
@@ -4155,6 +6060,49 @@ func (s *Server) handleSearchCatalog(w http.ResponseWriter, r *http.Request) {
 	s.respondJSON(w, http.StatusOK, entries)
 }
 
+// handleCatalogContentStats totals the files on tape by content class and
+// extension, optionally for one pool, tape or job
+func (s *Server) handleCatalogContentStats(w http.ResponseWriter, r *http.Request) {
+	params := r.URL.Query()
+	v := validation.New()
+	id := func(field string) int64 {
+		p := params.Get(field)
+		if p == "" {
+			return 0
+		}
+		n, err := strconv.ParseInt(p, 10, 64)
+		if err != nil || n <= 0 {
+			v.Add(field, "must be a positive id")
+			return 0
+		}
+		return n
+	}
+	filter := backup.ContentStatsFilter{
+		PoolID: id("pool_id"),
+		TapeID: id("tape_id"),
+		JobID:  id("job_id"),
+	}
+	top := 20
+	if p := params.Get("extensions"); p != "" {
+		n, err := strconv.Atoi(p)
+		if err != nil || n < 1 || n > 500 {
+			v.Add("extensions", "must be between 1 and 500")
+		}
+		top = n
+	}
+	if err := v.Err(); err != nil {
+		s.respondValidationError(w, err)
+		return
+	}
+
+	stats, err := s.backupService.ContentStats(r.Context(), filter, top)
+	if err != nil {
+		s.respondError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	s.respondJSON(w, http.StatusOK, stats)
+}
+
 func (s *Server) handleBrowseCatalog(w http.ResponseWriter, r *http.Request) {
 	backupSetIDStr := chi.URLParam(r, "backupSetId")
 	backupSetID, err := strconv.ParseInt(backupSetIDStr, 10, 64)
@@ -4210,23 +6158,199 @@ func (s *Server) handleRestorePlan(w http.ResponseWriter, r *http.Request) {
 	})
 }
 
+// handlePointInTimePlan plans restoring a path of a job as it was at a
+// point in time, from the full backup and incrementals current then
+func (s *Server) handlePointInTimePlan(w http.ResponseWriter, r *http.Request) {
+	var req restore.PointInTimeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		s.respondError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+	if req.JobID == 0 || req.At.IsZero() {
+		s.respondError(w, http.StatusBadRequest, "job_id and at are required")
+		return
+	}
+	if req.DestPath == "" {
+		s.respondError(w, http.StatusBadRequest, "dest_path is required")
+		return
+	}
+	if req.TargetID == nil && models.RestoreDestinationType(req.DestinationType).IsRemote() {
+		s.respondError(w, http.StatusBadRequest, "target_id is required for remote destinations")
+		return
+	}
+	if req.RateLimitMBps != nil && *req.RateLimitMBps < 0 {
+		s.respondError(w, http.StatusBadRequest, "rate_limit_mbps cannot be negative")
+		return
+	}
+	if err := restore.ValidatePathRewrites(req.PathRewrites); err != nil {
+		s.respondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if msg := s.checkRestoreDestination(r, req.TargetID); msg != "" {
+		s.respondError(w, http.StatusForbidden, msg)
+		return
+	}
+
+	plan, err := s.restoreService.PlanPointInTime(r.Context(), &req)
+	if err != nil {
+		s.respondError(w, http.StatusNotFound, err.Error())
+		return
+	}
+	s.respondJSON(w, http.StatusOK, plan)
+}
+
 func (s *Server) handleRunRestore(w http.ResponseWriter, r *http.Request) {
 	var req restore.RestoreRequest
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "multipart/form-data") {
+		if err := decodeRestoreUpload(w, r, &req); err != nil {
+			s.respondError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+	} else if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		s.respondError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+
+	if req.TargetID == nil && models.RestoreDestinationType(req.DestinationType).IsRemote() {
+		s.respondError(w, http.StatusBadRequest, "target_id is required for remote destinations")
+		return
+	}
+	if req.RateLimitMBps != nil && *req.RateLimitMBps < 0 {
+		s.respondError(w, http.StatusBadRequest, "rate_limit_mbps cannot be negative")
+		return
+	}
+	if err := restore.ValidatePathRewrites(req.PathRewrites); err != nil {
+		s.respondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if err := restore.ValidateByteRange(&req); err != nil {
+		s.respondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if msg := s.checkRestoreDestination(r, req.TargetID); msg != "" {
+		s.respondError(w, http.StatusForbidden, msg)
+		return
+	}
+
+	// A key entered at restore time is validated up front and recorded in the
+	// audit log by fingerprint only; it is never written to the keystore.
+	var externalFingerprint string
+	if req.EncryptionKey != "" {
+		keyBase64, err := encryption.NormalizeKey(req.EncryptionKey)
+		if err != nil {
+			s.respondError(w, http.StatusBadRequest, "invalid encryption_key: "+err.Error())
+			return
+		}
+		req.EncryptionKey = keyBase64
+		key, _ := encryption.DecodeKey(keyBase64)
+		externalFingerprint = encryption.KeyFingerprint(key)
+	}
+
+	ctx := r.Context()
+	release, preempted, err := s.holdRestoreDrive(ctx, &req)
+	if preempted != nil {
+		defer func() { go s.resumePreemptedRun(preempted) }()
+	}
+	if errors.Is(err, backup.ErrDriveBusy) {
+		s.respondErrorCode(w, http.StatusConflict, codeOperationInProgress, err.Error(), nil)
+		return
+	}
+	if err != nil {
+		s.respondError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	started := time.Now()
+	result, err := s.restoreService.Restore(ctx, &req)
+	release()
+	receiptID := s.storeRestoreReceipt(r, &req, result, err, started, externalFingerprint)
+	if result != nil {
+		result.ReceiptID = receiptID
+	}
+	if externalFingerprint != "" {
+		details := fmt.Sprintf("Restore of backup set %d with externally supplied key (fingerprint %s)", req.BackupSetID, externalFingerprint)
+		if err != nil {
+			details += ": " + err.Error()
+		}
+		s.auditLog(r, "restore", "backup_set", req.BackupSetID, details)
+	}
+	if err != nil {
+		if errors.Is(err, encryption.ErrKeyMismatch) {
+			s.respondError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		s.respondError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	s.respondJSON(w, http.StatusOK, result)
+}
+
+// handleRestorePeek reads the first few KB of one file from tape so users
+// can check it is the version they want before a full restore
+func (s *Server) handleRestorePeek(w http.ResponseWriter, r *http.Request) {
+	var req restore.PeekRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		s.respondError(w, http.StatusBadRequest, "invalid request body")
 		return
 	}
+	if req.BackupSetID == 0 || req.FilePath == "" {
+		s.respondError(w, http.StatusBadRequest, "backup_set_id and file_path are required")
+		return
+	}
+	if req.EncryptionKey != "" {
+		keyBase64, err := encryption.NormalizeKey(req.EncryptionKey)
+		if err != nil {
+			s.respondError(w, http.StatusBadRequest, "invalid encryption_key: "+err.Error())
+			return
+		}
+		req.EncryptionKey = keyBase64
+	}
 
-	ctx := r.Context()
-	result, err := s.restoreService.Restore(ctx, &req)
+	result, err := s.restoreService.Peek(r.Context(), &req)
 	if err != nil {
+		if errors.Is(err, encryption.ErrKeyMismatch) {
+			s.respondError(w, http.StatusBadRequest, err.Error())
+			return
+		}
 		s.respondError(w, http.StatusInternalServerError, err.Error())
 		return
 	}
-
+	s.auditLog(r, "restore_peek", "backup_set", req.BackupSetID,
+		fmt.Sprintf("Peeked at the first %d bytes of %s", len(result.Data), req.FilePath))
 	s.respondJSON(w, http.StatusOK, result)
 }
 
+// maxRestoreUploadSize bounds a multipart restore request carrying a key file.
+const maxRestoreUploadSize = 1 << 20
+
+// decodeRestoreUpload reads a multipart restore request: the JSON request in
+// the "request" field and an optional key file in "key_file", whose contents
+// replace encryption_key.
+func decodeRestoreUpload(w http.ResponseWriter, r *http.Request, req *restore.RestoreRequest) error {
+	r.Body = http.MaxBytesReader(w, r.Body, maxRestoreUploadSize)
+	if err := r.ParseMultipartForm(maxRestoreUploadSize); err != nil {
+		return fmt.Errorf("invalid upload")
+	}
+	if err := json.Unmarshal([]byte(r.FormValue("request")), req); err != nil {
+		return fmt.Errorf("invalid request field")
+	}
+
+	file, _, err := r.FormFile("key_file")
+	if err == http.ErrMissingFile {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("invalid key file")
+	}
+	defer file.Close()
+	data, err := io.ReadAll(file)
+	if err != nil {
+		return fmt.Errorf("failed to read key file")
+	}
+	req.EncryptionKey = string(data)
+	return nil
+}
+
 func (s *Server) handleRawReadTape(w http.ResponseWriter, r *http.Request) {
 	var req restore.RawReadRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
@@ -4390,6 +6514,11 @@ func (s *Server) handleCreateUser(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if !models.UserRole(req.Role).Valid() {
+		s.respondError(w, http.StatusBadRequest, "invalid role: must be admin, operator, restore_operator, readonly, or kiosk")
+		return
+	}
+
 	user, err := s.authService.CreateUser(req.Username, req.Password, models.UserRole(req.Role))
 	if err != nil {
 		s.respondError(w, http.StatusInternalServerError, err.Error())
@@ -4418,6 +6547,56 @@ func (s *Server) handleDeleteUser(w http.ResponseWriter, r *http.Request) {
 	s.respondJSON(w, http.StatusOK, map[string]string{"status": "deleted"})
 }
 
+// handleUnlockUser clears a lockout caused by repeated failed logins
+func (s *Server) handleUnlockUser(w http.ResponseWriter, r *http.Request) {
+	id, err := s.getIDParam(r)
+	if err != nil {
+		s.respondError(w, http.StatusBadRequest, "invalid user id")
+		return
+	}
+
+	if err := s.authService.UnlockUser(id); err != nil {
+		if errors.Is(err, auth.ErrUserNotFound) {
+			s.respondError(w, http.StatusNotFound, "user not found")
+			return
+		}
+		s.respondError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	s.auditLog(r, "unlock", "user", id, "Unlocked user account")
+	s.respondJSON(w, http.StatusOK, map[string]string{"status": "unlocked"})
+}
+
+// handleUserLoginHistory returns recent login attempts for a user
+func (s *Server) handleUserLoginHistory(w http.ResponseWriter, r *http.Request) {
+	id, err := s.getIDParam(r)
+	if err != nil {
+		s.respondError(w, http.StatusBadRequest, "invalid user id")
+		return
+	}
+
+	if _, err := s.authService.GetUser(id); err != nil {
+		s.respondError(w, http.StatusNotFound, "user not found")
+		return
+	}
+
+	limit := 100
+	if l := r.URL.Query().Get("limit"); l != "" {
+		if parsed, err := strconv.Atoi(l); err == nil && parsed > 0 && parsed <= 1000 {
+			limit = parsed
+		}
+	}
+
+	entries, err := s.authService.GetLoginHistory(id, limit)
+	if err != nil {
+		s.respondError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	s.respondJSON(w, http.StatusOK, entries)
+}
+
 // Documentation handlers
 
 // handleListDocs returns a list of available documentation files
@@ -4557,8 +6736,8 @@ func (s *Server) runDatabaseBackup(backupID, tapeID int64, devicePath string) {
 		s.eventBus.Publish(SystemEvent{
 			Type:     "info",
 			Category: "system",
-			Title:    "Database Backup Started",
-			Message:  fmt.Sprintf("Starting database backup (id=%d) to tape (id=%d) on %s", backupID, tapeID, devicePath),
+			Key:      "db_backup_started",
+			Args:     []interface{}{backupID, tapeID, devicePath},
 		})
 	}
 
@@ -4570,9 +6749,28 @@ func (s *Server) runDatabaseBackup(backupID, tapeID int64, devicePath string) {
 		dbPath = "/var/lib/tapebackarr/tapebackarr.db"
 	}
 
-	// Create a backup copy of the database
-	tempDir := "/tmp/tapebackarr-backup"
-	os.MkdirAll(tempDir, 0755)
+	// Create a backup copy of the database in the scratch directory
+	var dbSize int64
+	if info, err := os.Stat(dbPath); err == nil {
+		dbSize = info.Size()
+	}
+	if err := s.scratch.CheckSpace("", dbSize); err != nil {
+		s.db.Exec("UPDATE database_backups SET status = 'failed', error_message = ? WHERE id = ?", err.Error(), backupID)
+		if s.eventBus != nil {
+			s.eventBus.Publish(SystemEvent{
+				Type:     "error",
+				Category: "system",
+				Key:      "db_backup_failed",
+				Args:     []interface{}{err.Error()},
+			})
+		}
+		return
+	}
+	tempDir, err := s.scratch.MkdirTemp("db-backup-*")
+	if err != nil {
+		s.db.Exec("UPDATE database_backups SET status = 'failed', error_message = ? WHERE id = ?", err.Error(), backupID)
+		return
+	}
 	defer os.RemoveAll(tempDir)
 
 	backupPath := tempDir + "/tapebackarr.db"
@@ -4581,8 +6779,8 @@ func (s *Server) runDatabaseBackup(backupID, tapeID int64, devicePath string) {
 		s.eventBus.Publish(SystemEvent{
 			Type:     "info",
 			Category: "system",
-			Title:    "Database Copy",
-			Message:  fmt.Sprintf("Creating database copy using VACUUM INTO from %s", dbPath),
+			Key:      "db_copy",
+			Args:     []interface{}{dbPath},
 		})
 	}
 
@@ -4593,8 +6791,8 @@ func (s *Server) runDatabaseBackup(backupID, tapeID int64, devicePath string) {
 			s.eventBus.Publish(SystemEvent{
 				Type:     "error",
 				Category: "system",
-				Title:    "Database Backup Failed",
-				Message:  fmt.Sprintf("Failed to create database copy: %s", err.Error()),
+				Key:      "db_backup_copy_failed",
+				Args:     []interface{}{err.Error()},
 			})
 		}
 		s.db.Exec("UPDATE database_backups SET status = 'failed', error_message = ? WHERE id = ?", err.Error(), backupID)
@@ -4608,8 +6806,8 @@ func (s *Server) runDatabaseBackup(backupID, tapeID int64, devicePath string) {
 			s.eventBus.Publish(SystemEvent{
 				Type:     "error",
 				Category: "system",
-				Title:    "Database Backup Failed",
-				Message:  fmt.Sprintf("Failed to stat backup file: %s", err.Error()),
+				Key:      "db_backup_stat_failed",
+				Args:     []interface{}{err.Error()},
 			})
 		}
 		s.db.Exec("UPDATE database_backups SET status = 'failed', error_message = ? WHERE id = ?", err.Error(), backupID)
@@ -4623,8 +6821,8 @@ func (s *Server) runDatabaseBackup(backupID, tapeID int64, devicePath string) {
 		s.eventBus.Publish(SystemEvent{
 			Type:     "info",
 			Category: "system",
-			Title:    "Database Copy Complete",
-			Message:  fmt.Sprintf("Database copy created: %d bytes, checksum: %s", info.Size(), checksum),
+			Key:      "db_copy_complete",
+			Args:     []interface{}{info.Size(), checksum},
 		})
 	}
 
@@ -4633,8 +6831,7 @@ func (s *Server) runDatabaseBackup(backupID, tapeID int64, devicePath string) {
 		s.eventBus.Publish(SystemEvent{
 			Type:     "info",
 			Category: "tape",
-			Title:    "Rewinding Tape",
-			Message:  "Rewinding tape for database backup write...",
+			Key:      "rewinding_tape",
 		})
 	}
 	if err := s.tapeService.Rewind(ctx); err != nil {
@@ -4642,8 +6839,8 @@ func (s *Server) runDatabaseBackup(backupID, tapeID int64, devicePath string) {
 			s.eventBus.Publish(SystemEvent{
 				Type:     "error",
 				Category: "tape",
-				Title:    "Database Backup Failed",
-				Message:  fmt.Sprintf("Failed to rewind tape: %s", err.Error()),
+				Key:      "db_backup_rewind_failed",
+				Args:     []interface{}{err.Error()},
 			})
 		}
 		s.db.Exec("UPDATE database_backups SET status = 'failed', error_message = ? WHERE id = ?", "failed to rewind: "+err.Error(), backupID)
@@ -4656,8 +6853,7 @@ func (s *Server) runDatabaseBackup(backupID, tapeID int64, devicePath string) {
 		s.eventBus.Publish(SystemEvent{
 			Type:     "info",
 			Category: "tape",
-			Title:    "Seeking Tape",
-			Message:  "Seeking to file position 1 (after label block)...",
+			Key:      "seeking_tape",
 		})
 	}
 	s.tapeService.SeekToFileNumber(ctx, 1)
@@ -4667,8 +6863,8 @@ func (s *Server) runDatabaseBackup(backupID, tapeID int64, devicePath string) {
 		s.eventBus.Publish(SystemEvent{
 			Type:     "info",
 			Category: "tape",
-			Title:    "Writing to Tape",
-			Message:  fmt.Sprintf("Streaming database backup to %s using tar...", devicePath),
+			Key:      "writing_to_tape",
+			Args:     []interface{}{devicePath},
 		})
 	}
 	tarArgs := []string{"-c", "-f", devicePath, "-C", tempDir, "tapebackarr.db"}
@@ -4679,8 +6875,8 @@ func (s *Server) runDatabaseBackup(backupID, tapeID int64, devicePath string) {
 			s.eventBus.Publish(SystemEvent{
 				Type:     "error",
 				Category: "tape",
-				Title:    "Database Backup Failed",
-				Message:  fmt.Sprintf("tar command failed: %s", string(output)),
+				Key:      "db_backup_tar_failed",
+				Args:     []interface{}{string(output)},
 			})
 		}
 		s.db.Exec("UPDATE database_backups SET status = 'failed', error_message = ? WHERE id = ?", "tar failed: "+string(output), backupID)
@@ -4707,8 +6903,8 @@ func (s *Server) runDatabaseBackup(backupID, tapeID int64, devicePath string) {
 		s.eventBus.Publish(SystemEvent{
 			Type:     "success",
 			Category: "system",
-			Title:    "Database Backup Complete",
-			Message:  fmt.Sprintf("Database backup (id=%d) completed successfully: %d bytes written to tape", backupID, info.Size()),
+			Key:      "db_backup_complete",
+			Args:     []interface{}{backupID, info.Size()},
 			Details:  map[string]interface{}{"backup_id": backupID, "file_size": info.Size(), "checksum": checksum},
 		})
 	}
@@ -4769,11 +6965,11 @@ func (s *Server) handleRestoreDatabaseBackup(w http.ResponseWriter, r *http.Requ
 	}
 
 	// Get backup info
-	var tapeID, blockOffset int64
+	var tapeID, blockOffset, fileSize int64
 	err := s.db.QueryRow(`
-		SELECT tape_id, COALESCE(block_offset, 0)
+		SELECT tape_id, COALESCE(block_offset, 0), COALESCE(file_size, 0)
 		FROM database_backups WHERE id = ?
-	`, req.BackupID).Scan(&tapeID, &blockOffset)
+	`, req.BackupID).Scan(&tapeID, &blockOffset, &fileSize)
 	if err != nil {
 		s.respondError(w, http.StatusNotFound, "database backup not found")
 		return
@@ -4789,7 +6985,11 @@ func (s *Server) handleRestoreDatabaseBackup(w http.ResponseWriter, r *http.Requ
 
 	destPath := req.DestPath
 	if destPath == "" {
-		destPath = "/tmp/tapebackarr-restore"
+		destPath = filepath.Join(s.scratch.Root(), "db-restore")
+	}
+	if err := s.scratch.CheckSpace(destPath, fileSize); err != nil {
+		s.respondError(w, http.StatusInsufficientStorage, err.Error())
+		return
 	}
 	os.MkdirAll(destPath, 0755)
 
@@ -4824,7 +7024,19 @@ func (s *Server) handleRestoreDatabaseBackup(w http.ResponseWriter, r *http.Requ
 // handleDownloadDatabase creates a snapshot of the database and sends it as a file download
 func (s *Server) handleDownloadDatabase(w http.ResponseWriter, r *http.Request) {
 	// Create a temporary directory for the backup copy
-	tempDir, err := os.MkdirTemp("", "tapebackarr-db-download-*")
+	var dbPath string
+	var dbSize int64
+	if err := s.db.QueryRow("SELECT path FROM pragma_database_list WHERE name='main'").Scan(&dbPath); err == nil {
+		if info, err := os.Stat(dbPath); err == nil {
+			dbSize = info.Size()
+		}
+	}
+	if err := s.scratch.CheckSpace("", dbSize); err != nil {
+		s.respondError(w, http.StatusInsufficientStorage, err.Error())
+		return
+	}
+
+	tempDir, err := s.scratch.MkdirTemp("db-download-*")
 	if err != nil {
 		s.respondError(w, http.StatusInternalServerError, "failed to create temp directory")
 		return
@@ -4926,7 +7138,11 @@ func (s *Server) handleUploadDatabase(w http.ResponseWriter, r *http.Request) {
 	defer file.Close()
 
 	// Create temp file to store the upload
-	tempDir, err := os.MkdirTemp("", "tapebackarr-db-upload-*")
+	if err := s.scratch.CheckSpace("", header.Size); err != nil {
+		s.respondError(w, http.StatusInsufficientStorage, err.Error())
+		return
+	}
+	tempDir, err := s.scratch.MkdirTemp("db-upload-*")
 	if err != nil {
 		s.respondError(w, http.StatusInternalServerError, "failed to create temp directory")
 		return
@@ -5048,6 +7264,12 @@ func (s *Server) handleCreateDrive(w http.ResponseWriter, r *http.Request) {
 		s.respondError(w, http.StatusBadRequest, "invalid request body")
 		return
 	}
+	v := validation.New()
+	v.DevicePath("device_path", req.DevicePath)
+	if err := v.Err(); err != nil {
+		s.respondValidationError(w, err)
+		return
+	}
 
 	// Probe the drive to get initial status and fill in missing info
 	initialStatus := "offline"
@@ -5091,8 +7313,8 @@ func (s *Server) handleCreateDrive(w http.ResponseWriter, r *http.Request) {
 		s.eventBus.Publish(SystemEvent{
 			Type:     "success",
 			Category: "drive",
-			Title:    "Drive Added",
-			Message:  fmt.Sprintf("Tape drive '%s' at %s has been added", req.DisplayName, req.DevicePath),
+			Key:      "drive_added",
+			Args:     []interface{}{req.DisplayName, req.DevicePath},
 		})
 	}
 
@@ -5110,6 +7332,9 @@ func (s *Server) handleUpdateDrive(w http.ResponseWriter, r *http.Request) {
 	var req struct {
 		DisplayName *string `json:"display_name"`
 		Enabled     *bool   `json:"enabled"`
+		// LibraryID links the drive to a tape library, 0 unlinks it
+		LibraryID          *int64 `json:"library_id"`
+		LibraryDriveNumber *int64 `json:"library_drive_number"`
 	}
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		s.respondError(w, http.StatusBadRequest, "invalid request body")
@@ -5127,6 +7352,26 @@ func (s *Server) handleUpdateDrive(w http.ResponseWriter, r *http.Request) {
 		updates = append(updates, "enabled = ?")
 		args = append(args, *req.Enabled)
 	}
+	if req.LibraryID != nil && *req.LibraryID == 0 {
+		updates = append(updates, "library_id = NULL", "library_drive_number = NULL")
+	} else if req.LibraryID != nil {
+		var exists int
+		if err := s.db.QueryRow("SELECT 1 FROM tape_libraries WHERE id = ?", *req.LibraryID).Scan(&exists); err != nil {
+			s.respondError(w, http.StatusBadRequest, "library not found")
+			return
+		}
+		updates = append(updates, "library_id = ?")
+		args = append(args, *req.LibraryID)
+	}
+	if req.LibraryDriveNumber != nil && (req.LibraryID == nil || *req.LibraryID != 0) {
+		// The changer's data transfer element number, as mtx status lists it
+		if *req.LibraryDriveNumber < 0 {
+			s.respondError(w, http.StatusBadRequest, "library_drive_number must not be negative")
+			return
+		}
+		updates = append(updates, "library_drive_number = ?")
+		args = append(args, *req.LibraryDriveNumber)
+	}
 
 	if len(updates) == 0 {
 		s.respondError(w, http.StatusBadRequest, "no fields to update")
@@ -5154,12 +7399,19 @@ func (s *Server) handleDeleteDrive(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	var devicePath string
+	s.db.QueryRow("SELECT device_path FROM tape_drives WHERE id = ?", id).Scan(&devicePath)
+
 	_, err = s.db.Exec("DELETE FROM tape_drives WHERE id = ?", id)
 	if err != nil {
 		s.respondError(w, http.StatusInternalServerError, err.Error())
 		return
 	}
 
+	if devicePath != "" {
+		s.tapeService.GetLabelCache().InvalidateReason(devicePath, "drive_removed")
+	}
+
 	s.respondJSON(w, http.StatusOK, map[string]string{"status": "deleted"})
 }
 
@@ -5234,6 +7486,8 @@ func (s *Server) handleFormatTape(w http.ResponseWriter, r *http.Request) {
 	var req struct {
 		DriveID int64 `json:"drive_id"`
 		Confirm bool  `json:"confirm"`
+		// Force erases the tape even if sets on other tapes depend on its sets
+		Force bool `json:"force"`
 	}
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		s.respondError(w, http.StatusBadRequest, "invalid request body")
@@ -5257,6 +7511,15 @@ func (s *Server) handleFormatTape(w http.ResponseWriter, r *http.Request) {
 		s.respondError(w, http.StatusConflict, "cannot format exported tape - import it first")
 		return
 	}
+	erased, err := s.setsOnTape(id)
+	if err != nil {
+		s.respondError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	breaks, ok := s.checkChainBreaks(w, erased, chainLostErased, req.Force)
+	if !ok {
+		return
+	}
 
 	// Get tape label for display
 	var tapeLabel string
@@ -5276,7 +7539,7 @@ func (s *Server) handleFormatTape(w http.ResponseWriter, r *http.Request) {
 	if s.tapeOp.running {
 		s.tapeOp.mu.Unlock()
 		cancel()
-		s.respondError(w, http.StatusConflict, "a tape operation is already in progress")
+		s.respondErrorCode(w, http.StatusConflict, codeOperationInProgress, "a tape operation is already in progress", nil)
 		return
 	}
 	s.tapeOp.running = true
@@ -5291,7 +7554,7 @@ func (s *Server) handleFormatTape(w http.ResponseWriter, r *http.Request) {
 	s.tapeOp.started = time.Now()
 	s.tapeOp.mu.Unlock()
 
-	go s.runFormatTape(ctx, id, req.DriveID, devicePath)
+	go s.runFormatTape(ctx, id, req.DriveID, devicePath, breaks, erased)
 
 	s.respondJSON(w, http.StatusAccepted, map[string]string{
 		"status":  "started",
@@ -5300,7 +7563,8 @@ func (s *Server) handleFormatTape(w http.ResponseWriter, r *http.Request) {
 }
 
 // runFormatTape executes the format operation in the background with phase tracking.
-func (s *Server) runFormatTape(ctx context.Context, tapeID int64, driveID int64, devicePath string) {
+// breaks are the backup chains erasing the sets on the tape breaks.
+func (s *Server) runFormatTape(ctx context.Context, tapeID int64, driveID int64, devicePath string, breaks []chainBreak, erased []int64) {
 	defer func() {
 		s.tapeOp.mu.Lock()
 		s.tapeOp.running = false
@@ -5317,8 +7581,8 @@ func (s *Server) runFormatTape(ctx context.Context, tapeID int64, driveID int64,
 			s.eventBus.Publish(SystemEvent{
 				Type:     "info",
 				Category: "tape",
-				Title:    "Format Progress",
-				Message:  message,
+				Key:      "format_progress",
+				Args:     []interface{}{message},
 				Details:  map[string]interface{}{"tape_id": tapeID, "device": devicePath, "phase": phase},
 			})
 		}
@@ -5334,8 +7598,8 @@ func (s *Server) runFormatTape(ctx context.Context, tapeID int64, driveID int64,
 			s.eventBus.Publish(SystemEvent{
 				Type:     "error",
 				Category: "tape",
-				Title:    "Format Failed",
-				Message:  errMsg,
+				Key:      "format_failed",
+				Args:     []interface{}{errMsg},
 				Details:  map[string]interface{}{"tape_id": tapeID, "device": devicePath, "phase": "failed"},
 			})
 		}
@@ -5374,13 +7638,14 @@ func (s *Server) runFormatTape(ctx context.Context, tapeID int64, driveID int64,
 	_ = s.db.QueryRow("SELECT uuid, label FROM tapes WHERE id = ?", tapeID).Scan(&tapeUUID, &tapeLabel)
 
 	if _, err := s.db.Exec(`
-		UPDATE tapes SET status = 'blank', used_bytes = 0, write_count = 0,
-		       last_written_at = NULL, labeled_at = NULL, updated_at = CURRENT_TIMESTAMP
+		UPDATE tapes SET status = 'blank', used_bytes = 0, write_count = 0, physical_remaining_bytes = NULL,
+		       last_written_at = NULL, labeled_at = NULL, `+clearTapeReuse+`, updated_at = CURRENT_TIMESTAMP
 		WHERE id = ?
 	`, tapeID); err != nil {
 		setError("Failed to update database: " + err.Error())
 		return
 	}
+	s.flagChainBreaks(breaks, erased)
 
 	// Clear unknown tape notification for this tape
 	if tapeUUID != "" {
@@ -5400,8 +7665,8 @@ func (s *Server) runFormatTape(ctx context.Context, tapeID int64, driveID int64,
 		s.eventBus.Publish(SystemEvent{
 			Type:     "success",
 			Category: "tape",
-			Title:    "Tape Formatted",
-			Message:  fmt.Sprintf("Tape (id=%d) has been formatted and reset to blank state on drive %s", tapeID, devicePath),
+			Key:      "tape_formatted",
+			Args:     []interface{}{tapeID, devicePath},
 			Details:  map[string]interface{}{"tape_id": tapeID, "device": devicePath},
 		})
 	}
@@ -5596,6 +7861,51 @@ func (s *Server) handleReadTapeLabel(w http.ResponseWriter, r *http.Request) {
 	})
 }
 
+// handleLabelCacheAudit reports every device in the tape label cache with its
+// age against the TTL and the last operation that invalidated it, so stale
+// entries can be spotted without touching the drives.
+func (s *Server) handleLabelCacheAudit(w http.ResponseWriter, r *http.Request) {
+	ttl := tape.DefaultLabelCacheTTL
+	entries := s.tapeService.GetLabelCache().Entries(ttl)
+
+	type auditEntry struct {
+		tape.LabelCacheEntry
+		DriveID     *int64 `json:"drive_id,omitempty"`
+		DisplayName string `json:"display_name,omitempty"`
+	}
+
+	drives := make(map[string]auditEntry)
+	rows, err := s.db.Query("SELECT id, device_path, COALESCE(display_name, '') FROM tape_drives")
+	if err == nil {
+		defer rows.Close()
+		for rows.Next() {
+			var id int64
+			var devicePath, name string
+			if rows.Scan(&id, &devicePath, &name) == nil {
+				driveID := id
+				drives[devicePath] = auditEntry{DriveID: &driveID, DisplayName: name}
+			}
+		}
+	}
+
+	result := make([]auditEntry, 0, len(entries))
+	stale := 0
+	for _, e := range entries {
+		a := drives[e.DevicePath]
+		a.LabelCacheEntry = e
+		if e.Expired {
+			stale++
+		}
+		result = append(result, a)
+	}
+
+	s.respondJSON(w, http.StatusOK, map[string]interface{}{
+		"ttl_seconds": ttl.Seconds(),
+		"stale":       stale,
+		"entries":     result,
+	})
+}
+
 // handleScanDrives scans the system for available tape drives
 func (s *Server) handleScanDrives(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
@@ -5620,6 +7930,8 @@ func (s *Server) handleFormatTapeInDrive(w http.ResponseWriter, r *http.Request)
 
 	var req struct {
 		Confirm bool `json:"confirm"`
+		// Force erases the tape even if sets on other tapes depend on its sets
+		Force bool `json:"force"`
 	}
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		s.respondError(w, http.StatusBadRequest, "invalid request body")
@@ -5632,19 +7944,34 @@ func (s *Server) handleFormatTapeInDrive(w http.ResponseWriter, r *http.Request)
 	}
 
 	var devicePath string
-	err = s.db.QueryRow("SELECT device_path FROM tape_drives WHERE id = ? AND enabled = 1", driveID).Scan(&devicePath)
+	var currentTapeID *int64
+	err = s.db.QueryRow("SELECT device_path, current_tape_id FROM tape_drives WHERE id = ? AND enabled = 1", driveID).Scan(&devicePath, &currentTapeID)
 	if err != nil {
 		s.respondError(w, http.StatusNotFound, "drive not found or not enabled")
 		return
 	}
 
+	// The tape the drive last reported is the one expected to be erased
+	var erased []int64
+	var breaks []chainBreak
+	if currentTapeID != nil {
+		if erased, err = s.setsOnTape(*currentTapeID); err != nil {
+			s.respondError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		var ok bool
+		if breaks, ok = s.checkChainBreaks(w, erased, chainLostErased, req.Force); !ok {
+			return
+		}
+	}
+
 	ctx, cancel := context.WithCancel(context.Background())
 
 	s.tapeOp.mu.Lock()
 	if s.tapeOp.running {
 		s.tapeOp.mu.Unlock()
 		cancel()
-		s.respondError(w, http.StatusConflict, "a tape operation is already in progress")
+		s.respondErrorCode(w, http.StatusConflict, codeOperationInProgress, "a tape operation is already in progress", nil)
 		return
 	}
 	s.tapeOp.running = true
@@ -5659,7 +7986,7 @@ func (s *Server) handleFormatTapeInDrive(w http.ResponseWriter, r *http.Request)
 	s.tapeOp.started = time.Now()
 	s.tapeOp.mu.Unlock()
 
-	go s.runFormatTapeInDrive(ctx, driveID, devicePath)
+	go s.runFormatTapeInDrive(ctx, driveID, devicePath, currentTapeID, breaks, erased)
 
 	s.respondJSON(w, http.StatusAccepted, map[string]string{
 		"status":  "started",
@@ -5668,7 +7995,9 @@ func (s *Server) handleFormatTapeInDrive(w http.ResponseWriter, r *http.Request)
 }
 
 // runFormatTapeInDrive executes the format-in-drive operation in the background.
-func (s *Server) runFormatTapeInDrive(ctx context.Context, driveID int64, devicePath string) {
+// breaks are the backup chains erasing expectedTapeID breaks; they are only
+// flagged if that is the tape found in the drive.
+func (s *Server) runFormatTapeInDrive(ctx context.Context, driveID int64, devicePath string, expectedTapeID *int64, breaks []chainBreak, erased []int64) {
 	defer func() {
 		s.tapeOp.mu.Lock()
 		s.tapeOp.running = false
@@ -5685,8 +8014,8 @@ func (s *Server) runFormatTapeInDrive(ctx context.Context, driveID int64, device
 			s.eventBus.Publish(SystemEvent{
 				Type:     "info",
 				Category: "tape",
-				Title:    "Format Progress",
-				Message:  message,
+				Key:      "format_progress",
+				Args:     []interface{}{message},
 				Details:  map[string]interface{}{"drive_id": driveID, "device": devicePath, "phase": phase},
 			})
 		}
@@ -5702,8 +8031,8 @@ func (s *Server) runFormatTapeInDrive(ctx context.Context, driveID int64, device
 			s.eventBus.Publish(SystemEvent{
 				Type:     "error",
 				Category: "tape",
-				Title:    "Format Failed",
-				Message:  errMsg,
+				Key:      "format_failed",
+				Args:     []interface{}{errMsg},
 				Details:  map[string]interface{}{"drive_id": driveID, "device": devicePath, "phase": "failed"},
 			})
 		}
@@ -5743,17 +8072,23 @@ func (s *Server) runFormatTapeInDrive(ctx context.Context, driveID int64, device
 
 	// If the tape was in our database, update its status
 	if oldUUID != "" {
-		if _, err := s.db.Exec("UPDATE tapes SET status = 'blank', used_bytes = 0, labeled_at = NULL, updated_at = CURRENT_TIMESTAMP WHERE uuid = ?", oldUUID); err != nil {
+		if _, err := s.db.Exec("UPDATE tapes SET status = 'blank', used_bytes = 0, physical_remaining_bytes = NULL, labeled_at = NULL, updated_at = CURRENT_TIMESTAMP WHERE uuid = ?", oldUUID); err != nil {
 			s.logger.Warn("Failed to update tape status by UUID after format", map[string]interface{}{"error": err.Error(), "uuid": oldUUID})
 		}
 		s.notifiedUnknownTapes.Delete(oldUUID)
 	}
 	if oldLabel != "" {
-		if _, err := s.db.Exec("UPDATE tapes SET status = 'blank', used_bytes = 0, labeled_at = NULL, updated_at = CURRENT_TIMESTAMP WHERE label = ?", oldLabel); err != nil {
+		if _, err := s.db.Exec("UPDATE tapes SET status = 'blank', used_bytes = 0, physical_remaining_bytes = NULL, labeled_at = NULL, updated_at = CURRENT_TIMESTAMP WHERE label = ?", oldLabel); err != nil {
 			s.logger.Warn("Failed to update tape status by label after format", map[string]interface{}{"error": err.Error(), "label": oldLabel})
 		}
 		s.notifiedUnknownTapes.Delete(oldLabel)
 	}
+	if expectedTapeID != nil && (oldUUID != "" || oldLabel != "") {
+		var erasedID int64
+		if s.db.QueryRow("SELECT id FROM tapes WHERE (uuid = ? AND uuid != '') OR (label = ? AND label != '')", oldUUID, oldLabel).Scan(&erasedID) == nil && erasedID == *expectedTapeID {
+			s.flagChainBreaks(breaks, erased)
+		}
+	}
 
 	s.tapeOp.mu.Lock()
 	s.tapeOp.phase = "complete"
@@ -5765,8 +8100,8 @@ func (s *Server) runFormatTapeInDrive(ctx context.Context, driveID int64, device
 		s.eventBus.Publish(SystemEvent{
 			Type:     "success",
 			Category: "tape",
-			Title:    "Tape Formatted",
-			Message:  fmt.Sprintf("Tape '%s' has been formatted/erased in drive %s", oldLabel, devicePath),
+			Key:      "tape_erased",
+			Args:     []interface{}{oldLabel, devicePath},
 			Details: map[string]interface{}{
 				"drive_id":  driveID,
 				"device":    devicePath,
@@ -5782,6 +8117,70 @@ func (s *Server) handleGetLTOTypes(w http.ResponseWriter, r *http.Request) {
 	s.respondJSON(w, http.StatusOK, models.LTOCapacities)
 }
 
+// handleTapeCompatibility reports, for every enabled drive, whether it can
+// read and write the tape's LTO generation. Access is "read-write",
+// "read-only", "none", or "unknown" when either generation is not known.
+func (s *Server) handleTapeCompatibility(w http.ResponseWriter, r *http.Request) {
+	id, err := s.getIDParam(r)
+	if err != nil {
+		s.respondError(w, http.StatusBadRequest, "invalid tape id")
+		return
+	}
+
+	var label, ltoType string
+	if err := s.db.QueryRow("SELECT label, COALESCE(lto_type, '') FROM tapes WHERE id = ?", id).Scan(&label, &ltoType); err != nil {
+		s.respondError(w, http.StatusNotFound, "tape not found")
+		return
+	}
+
+	rows, err := s.db.Query(`
+		SELECT id, COALESCE(NULLIF(display_name, ''), device_path), COALESCE(model, ''), COALESCE(current_tape_id = ?, 0)
+		FROM tape_drives WHERE COALESCE(enabled, 1) = 1 ORDER BY id
+	`, id)
+	if err != nil {
+		s.respondError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	defer rows.Close()
+
+	drives := []map[string]interface{}{}
+	for rows.Next() {
+		var driveID int64
+		var name, model string
+		var loaded bool
+		if err := rows.Scan(&driveID, &name, &model, &loaded); err != nil {
+			continue
+		}
+		driveType, known := models.LTOTypeFromDriveModel(model)
+		access := "unknown"
+		if known && ltoType != "" {
+			switch {
+			case models.CheckLTOCompatibility(driveType, ltoType, true) == nil:
+				access = "read-write"
+			case models.CheckLTOCompatibility(driveType, ltoType, false) == nil:
+				access = "read-only"
+			default:
+				access = "none"
+			}
+		}
+		drives = append(drives, map[string]interface{}{
+			"drive_id": driveID,
+			"name":     name,
+			"model":    model,
+			"lto_type": driveType,
+			"loaded":   loaded,
+			"access":   access,
+		})
+	}
+
+	s.respondJSON(w, http.StatusOK, map[string]interface{}{
+		"tape_id":  id,
+		"label":    label,
+		"lto_type": ltoType,
+		"drives":   drives,
+	})
+}
+
 // handleChangePassword allows any authenticated user to change their own password
 func (s *Server) handleChangePassword(w http.ResponseWriter, r *http.Request) {
 	claims, ok := r.Context().Value("claims").(*auth.Claims)
@@ -5821,6 +8220,136 @@ func (s *Server) handleChangePassword(w http.ResponseWriter, r *http.Request) {
 	s.respondJSON(w, http.StatusOK, map[string]string{"status": "password changed"})
 }
 
+// handleGetPreferences returns the calling user's stored UI/API preferences
+func (s *Server) handleGetPreferences(w http.ResponseWriter, r *http.Request) {
+	claims, ok := r.Context().Value("claims").(*auth.Claims)
+	if !ok || claims == nil || claims.UserID <= 0 {
+		s.respondError(w, http.StatusUnauthorized, "preferences require a user session")
+		return
+	}
+
+	prefs, err := s.authService.GetPreferences(claims.UserID)
+	if err != nil {
+		s.respondError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	s.respondJSON(w, http.StatusOK, prefs)
+}
+
+// handleUpdatePreferences updates the calling user's preferences. Only fields
+// present in the request body are changed.
+func (s *Server) handleUpdatePreferences(w http.ResponseWriter, r *http.Request) {
+	claims, ok := r.Context().Value("claims").(*auth.Claims)
+	if !ok || claims == nil || claims.UserID <= 0 {
+		s.respondError(w, http.StatusUnauthorized, "preferences require a user session")
+		return
+	}
+
+	var req struct {
+		DefaultPoolID        *int64  `json:"default_pool_id"`
+		PreferredDriveID     *int64  `json:"preferred_drive_id"`
+		ItemsPerPage         *int    `json:"items_per_page"`
+		NotificationDigest   *bool   `json:"notification_digest"`
+		DashboardLayout      *string `json:"dashboard_layout"`
+		Language             *string `json:"language"`
+		NotifyEmail          *string `json:"notify_email"`
+		NotifyTelegramChatID *string `json:"notify_telegram_chat_id"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		s.respondError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+
+	prefs, err := s.authService.GetPreferences(claims.UserID)
+	if err != nil {
+		s.respondError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	if req.DefaultPoolID != nil {
+		if *req.DefaultPoolID == 0 {
+			prefs.DefaultPoolID = nil
+		} else {
+			var exists int
+			if err := s.db.QueryRow("SELECT COUNT(*) FROM tape_pools WHERE id = ?", *req.DefaultPoolID).Scan(&exists); err != nil || exists == 0 {
+				s.respondError(w, http.StatusBadRequest, "default_pool_id does not exist")
+				return
+			}
+			prefs.DefaultPoolID = req.DefaultPoolID
+		}
+	}
+	if req.PreferredDriveID != nil {
+		if *req.PreferredDriveID == 0 {
+			prefs.PreferredDriveID = nil
+		} else {
+			var exists int
+			if err := s.db.QueryRow("SELECT COUNT(*) FROM tape_drives WHERE id = ?", *req.PreferredDriveID).Scan(&exists); err != nil || exists == 0 {
+				s.respondError(w, http.StatusBadRequest, "preferred_drive_id does not exist")
+				return
+			}
+			prefs.PreferredDriveID = req.PreferredDriveID
+		}
+	}
+	if req.ItemsPerPage != nil {
+		if *req.ItemsPerPage < 1 || *req.ItemsPerPage > 500 {
+			s.respondError(w, http.StatusBadRequest, "items_per_page must be between 1 and 500")
+			return
+		}
+		prefs.ItemsPerPage = *req.ItemsPerPage
+	}
+	if req.NotificationDigest != nil {
+		prefs.NotificationDigest = *req.NotificationDigest
+	}
+	if req.DashboardLayout != nil {
+		if *req.DashboardLayout != "" && !json.Valid([]byte(*req.DashboardLayout)) {
+			s.respondError(w, http.StatusBadRequest, "dashboard_layout must be valid JSON")
+			return
+		}
+		prefs.DashboardLayout = *req.DashboardLayout
+	}
+	if req.Language != nil {
+		if *req.Language == "" {
+			prefs.Language = ""
+		} else {
+			lang, ok := i18n.Parse(*req.Language)
+			if !ok {
+				s.respondError(w, http.StatusBadRequest, fmt.Sprintf("language must be one of %v", i18n.Languages()))
+				return
+			}
+			prefs.Language = string(lang)
+		}
+	}
+	if req.NotifyEmail != nil {
+		email := strings.TrimSpace(*req.NotifyEmail)
+		if err := validateEmailList(email); err != nil || strings.Contains(email, ",") {
+			s.respondError(w, http.StatusBadRequest, "notify_email must be a single email address")
+			return
+		}
+		prefs.NotifyEmail = email
+	}
+	if req.NotifyTelegramChatID != nil {
+		chatID := strings.TrimSpace(*req.NotifyTelegramChatID)
+		if err := validateChatIDs(chatID); err != nil || strings.Contains(chatID, ",") {
+			s.respondError(w, http.StatusBadRequest, "notify_telegram_chat_id must be a single Telegram chat ID")
+			return
+		}
+		prefs.NotifyTelegramChatID = chatID
+	}
+
+	if err := s.authService.SavePreferences(prefs); err != nil {
+		s.respondError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	updated, err := s.authService.GetPreferences(claims.UserID)
+	if err != nil {
+		s.respondError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	s.respondJSON(w, http.StatusOK, updated)
+}
+
 // handleGetConfig returns the current application configuration (sensitive fields masked)
 func (s *Server) handleGetConfig(w http.ResponseWriter, r *http.Request) {
 	if s.config == nil {
@@ -5829,10 +8358,21 @@ func (s *Server) handleGetConfig(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Return config with sensitive fields masked
+	s.credentialsMu.RLock()
 	safeConfig := *s.config
+	s.credentialsMu.RUnlock()
 	if safeConfig.Auth.JWTSecret != "" {
 		safeConfig.Auth.JWTSecret = "********"
 	}
+	if safeConfig.Auth.CredentialsKey != "" {
+		safeConfig.Auth.CredentialsKey = "********"
+	}
+	if safeConfig.Replication.APIKey != "" {
+		safeConfig.Replication.APIKey = "********"
+	}
+	if safeConfig.Monitoring.BearerToken != "" {
+		safeConfig.Monitoring.BearerToken = "********"
+	}
 	if safeConfig.Notifications.Telegram.BotToken != "" {
 		safeConfig.Notifications.Telegram.BotToken = "********"
 	}
@@ -5846,7 +8386,11 @@ func (s *Server) handleGetConfig(w http.ResponseWriter, r *http.Request) {
 		safeConfig.Proxmox.TokenSecret = "********"
 	}
 
-	s.respondJSON(w, http.StatusOK, safeConfig)
+	// Warnings from loading the file are returned alongside the settings
+	s.respondJSON(w, http.StatusOK, struct {
+		config.Config
+		Warnings []string `json:"config_warnings,omitempty"`
+	}{safeConfig, safeConfig.Warnings})
 }
 
 // handleUpdateConfig updates the application configuration
@@ -5866,6 +8410,15 @@ func (s *Server) handleUpdateConfig(w http.ResponseWriter, r *http.Request) {
 	if newCfg.Auth.JWTSecret == "********" {
 		newCfg.Auth.JWTSecret = s.config.Auth.JWTSecret
 	}
+	if newCfg.Auth.CredentialsKey == "********" {
+		newCfg.Auth.CredentialsKey = s.credentialsKey()
+	}
+	if newCfg.Replication.APIKey == "********" {
+		newCfg.Replication.APIKey = s.config.Replication.APIKey
+	}
+	if newCfg.Monitoring.BearerToken == "********" {
+		newCfg.Monitoring.BearerToken = s.config.Monitoring.BearerToken
+	}
 	if newCfg.Notifications.Telegram.BotToken == "********" {
 		newCfg.Notifications.Telegram.BotToken = s.config.Notifications.Telegram.BotToken
 	}
@@ -5878,6 +8431,55 @@ func (s *Server) handleUpdateConfig(w http.ResponseWriter, r *http.Request) {
 	if newCfg.Proxmox.TokenSecret == "********" {
 		newCfg.Proxmox.TokenSecret = s.config.Proxmox.TokenSecret
 	}
+	if bw := newCfg.Notifications.BackupWindow; bw.Enabled {
+		if _, _, err := scheduler.ParseWindowEnd(bw.End); err != nil {
+			s.respondError(w, http.StatusBadRequest, "notifications.backup_window: "+err.Error())
+			return
+		}
+	}
+	switch newCfg.Scheduler.ShutdownAction {
+	case "", config.ShutdownCancel, config.ShutdownCheckpoint:
+	default:
+		s.respondError(w, http.StatusBadRequest, "scheduler.shutdown_action must be cancel or checkpoint")
+		return
+	}
+	switch newCfg.Tape.DriveSelection.Policy {
+	case "", config.DriveSelectionFirst, config.DriveSelectionLeastUsed:
+	default:
+		s.respondError(w, http.StatusBadRequest, "tape.drive_selection.policy must be first or least_used")
+		return
+	}
+	if newCfg.Replication.Role == config.ReplicationPrimary && newCfg.Auth.CredentialsKey == "" {
+		s.respondError(w, http.StatusBadRequest, "replication.role primary needs auth.credentials_key")
+		return
+	}
+	if newCfg.SLO.DefaultRPOHours < 0 {
+		s.respondError(w, http.StatusBadRequest, "slo.default_rpo_hours cannot be negative")
+		return
+	}
+	if newCfg.Restore.RateLimitMBps < 0 {
+		s.respondError(w, http.StatusBadRequest, "restore.rate_limit_mbps cannot be negative")
+		return
+	}
+	if err := validateMonitoring(newCfg.Monitoring); err != nil {
+		s.respondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if _, err := parseNetworks(newCfg.Auth.TrustedProxies); err != nil {
+		s.respondError(w, http.StatusBadRequest, "auth.trusted_proxies: "+err.Error())
+		return
+	}
+	if networks, err := parseNetworks(newCfg.Auth.ManagementCIDRs); err != nil {
+		s.respondError(w, http.StatusBadRequest, "auth.management_cidrs: "+err.Error())
+		return
+	} else if len(networks) > 0 {
+		// Refuse a list that would lock out the admin saving it
+		ip := managementClientIP(r, newCfg.Auth.TrustedProxies)
+		if ip == nil || !inNetworks(ip, networks) {
+			s.respondError(w, http.StatusBadRequest, fmt.Sprintf("auth.management_cidrs does not include your address %s", ip))
+			return
+		}
+	}
 
 	// Save to disk
 	if err := newCfg.Save(s.configPath); err != nil {
@@ -5885,8 +8487,15 @@ func (s *Server) handleUpdateConfig(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Update in-memory config
+	// Update in-memory config. Saving rewrites the file from the known
+	// settings, so unknown keys are gone and only deprecations remain.
+	newCfg.Warnings = newCfg.KeyWarnings()
+	s.credentialsMu.Lock()
 	*s.config = newCfg
+	s.credentialsMu.Unlock()
+	if s.restoreService != nil {
+		s.restoreService.SetRateLimit(newCfg.Restore.RateLimitMBps)
+	}
 
 	s.respondJSON(w, http.StatusOK, map[string]string{"status": "configuration saved", "note": "some changes require a restart to take effect"})
 }
@@ -5908,6 +8517,7 @@ func (s *Server) handleTestTelegram(w http.ResponseWriter, r *http.Request) {
 		Enabled:  tgConfig.Enabled,
 		BotToken: tgConfig.BotToken,
 		ChatID:   tgConfig.ChatID,
+		Language: tgConfig.Language,
 	})
 
 	if err := svc.SendTestMessage(r.Context()); err != nil {
@@ -5918,16 +8528,52 @@ func (s *Server) handleTestTelegram(w http.ResponseWriter, r *http.Request) {
 	s.respondJSON(w, http.StatusOK, map[string]string{"status": "Test message sent successfully"})
 }
 
+// handleTestEmail sends a test email to the configured recipients
+func (s *Server) handleTestEmail(w http.ResponseWriter, r *http.Request) {
+	if s.config == nil {
+		s.respondError(w, http.StatusInternalServerError, "configuration not available")
+		return
+	}
+
+	emailConfig := s.config.Notifications.Email
+	if !emailConfig.Enabled || emailConfig.SMTPHost == "" || emailConfig.FromEmail == "" || emailConfig.ToEmails == "" {
+		s.respondError(w, http.StatusBadRequest, "Email notifications are not configured. Please enable and configure the SMTP host, sender and recipients first.")
+		return
+	}
+
+	svc := notifications.NewEmailService(notifications.EmailConfig{
+		Enabled:    emailConfig.Enabled,
+		SMTPHost:   emailConfig.SMTPHost,
+		SMTPPort:   emailConfig.SMTPPort,
+		Username:   emailConfig.Username,
+		Password:   emailConfig.Password,
+		FromEmail:  emailConfig.FromEmail,
+		FromName:   emailConfig.FromName,
+		ToEmails:   emailConfig.ToEmails,
+		UseTLS:     emailConfig.UseTLS,
+		StartTLS:   emailConfig.StartTLS,
+		SkipVerify: emailConfig.SkipVerify,
+		Language:   emailConfig.Language,
+	})
+
+	if err := svc.SendTestMessage(r.Context()); err != nil {
+		s.respondError(w, http.StatusInternalServerError, "Failed to send test email: "+err.Error())
+		return
+	}
+
+	s.respondJSON(w, http.StatusOK, map[string]string{"status": "Test email sent successfully"})
+}
+
 // ==================== Proxmox Handlers ====================
 
 // handleProxmoxListNodes returns all Proxmox nodes
 func (s *Server) handleProxmoxListNodes(w http.ResponseWriter, r *http.Request) {
-	if s.proxmoxClient == nil {
-		s.respondError(w, http.StatusServiceUnavailable, "Proxmox integration not configured")
+	px, ok := s.requireProxmoxQuery(w, r)
+	if !ok {
 		return
 	}
 
-	nodes, err := s.proxmoxClient.GetNodes(r.Context())
+	nodes, err := px.client.GetNodes(r.Context())
 	if err != nil {
 		s.respondError(w, http.StatusInternalServerError, err.Error())
 		return
@@ -5938,8 +8584,8 @@ func (s *Server) handleProxmoxListNodes(w http.ResponseWriter, r *http.Request)
 
 // handleProxmoxListGuests returns all VMs and LXCs across all nodes
 func (s *Server) handleProxmoxListGuests(w http.ResponseWriter, r *http.Request) {
-	if s.proxmoxClient == nil {
-		s.respondError(w, http.StatusServiceUnavailable, "Proxmox integration not configured")
+	px, ok := s.requireProxmoxQuery(w, r)
+	if !ok {
 		return
 	}
 
@@ -5953,14 +8599,14 @@ func (s *Server) handleProxmoxListGuests(w http.ResponseWriter, r *http.Request)
 	if node != "" {
 		// Get guests from specific node
 		if guestType != "lxc" {
-			vms, err = s.proxmoxClient.GetNodeVMs(r.Context(), node)
+			vms, err = px.client.GetNodeVMs(r.Context(), node)
 			if err != nil {
 				s.respondError(w, http.StatusInternalServerError, err.Error())
 				return
 			}
 		}
 		if guestType != "qemu" {
-			lxcs, err = s.proxmoxClient.GetNodeLXCs(r.Context(), node)
+			lxcs, err = px.client.GetNodeLXCs(r.Context(), node)
 			if err != nil {
 				s.respondError(w, http.StatusInternalServerError, err.Error())
 				return
@@ -5968,7 +8614,7 @@ func (s *Server) handleProxmoxListGuests(w http.ResponseWriter, r *http.Request)
 		}
 	} else {
 		// Get guests from all nodes
-		vms, lxcs, err = s.proxmoxClient.GetAllGuests(r.Context())
+		vms, lxcs, err = px.client.GetAllGuests(r.Context())
 		if err != nil {
 			s.respondError(w, http.StatusInternalServerError, err.Error())
 			return
@@ -5990,8 +8636,8 @@ func (s *Server) handleProxmoxListGuests(w http.ResponseWriter, r *http.Request)
 
 // handleProxmoxGetGuest returns details of a specific guest
 func (s *Server) handleProxmoxGetGuest(w http.ResponseWriter, r *http.Request) {
-	if s.proxmoxClient == nil {
-		s.respondError(w, http.StatusServiceUnavailable, "Proxmox integration not configured")
+	px, ok := s.requireProxmoxQuery(w, r)
+	if !ok {
 		return
 	}
 
@@ -6005,7 +8651,7 @@ func (s *Server) handleProxmoxGetGuest(w http.ResponseWriter, r *http.Request) {
 	node := r.URL.Query().Get("node")
 	if node == "" {
 		// Try to find the node
-		nodes, err := s.proxmoxClient.GetNodes(r.Context())
+		nodes, err := px.client.GetNodes(r.Context())
 		if err != nil {
 			s.respondError(w, http.StatusInternalServerError, err.Error())
 			return
@@ -6016,7 +8662,7 @@ func (s *Server) handleProxmoxGetGuest(w http.ResponseWriter, r *http.Request) {
 				continue
 			}
 			// Check VMs
-			vms, _ := s.proxmoxClient.GetNodeVMs(r.Context(), n.Node)
+			vms, _ := px.client.GetNodeVMs(r.Context(), n.Node)
 			for _, vm := range vms {
 				if vm.VMID == vmid {
 					s.respondJSON(w, http.StatusOK, vm)
@@ -6024,7 +8670,7 @@ func (s *Server) handleProxmoxGetGuest(w http.ResponseWriter, r *http.Request) {
 				}
 			}
 			// Check LXCs
-			lxcs, _ := s.proxmoxClient.GetNodeLXCs(r.Context(), n.Node)
+			lxcs, _ := px.client.GetNodeLXCs(r.Context(), n.Node)
 			for _, lxc := range lxcs {
 				if lxc.VMID == vmid {
 					s.respondJSON(w, http.StatusOK, lxc)
@@ -6037,7 +8683,7 @@ func (s *Server) handleProxmoxGetGuest(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Check VMs first
-	vms, _ := s.proxmoxClient.GetNodeVMs(r.Context(), node)
+	vms, _ := px.client.GetNodeVMs(r.Context(), node)
 	for _, vm := range vms {
 		if vm.VMID == vmid {
 			s.respondJSON(w, http.StatusOK, vm)
@@ -6046,7 +8692,7 @@ func (s *Server) handleProxmoxGetGuest(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Check LXCs
-	lxcs, _ := s.proxmoxClient.GetNodeLXCs(r.Context(), node)
+	lxcs, _ := px.client.GetNodeLXCs(r.Context(), node)
 	for _, lxc := range lxcs {
 		if lxc.VMID == vmid {
 			s.respondJSON(w, http.StatusOK, lxc)
@@ -6059,8 +8705,8 @@ func (s *Server) handleProxmoxGetGuest(w http.ResponseWriter, r *http.Request) {
 
 // handleProxmoxGetGuestConfig returns the configuration of a guest
 func (s *Server) handleProxmoxGetGuestConfig(w http.ResponseWriter, r *http.Request) {
-	if s.proxmoxClient == nil {
-		s.respondError(w, http.StatusServiceUnavailable, "Proxmox integration not configured")
+	px, ok := s.requireProxmoxQuery(w, r)
+	if !ok {
 		return
 	}
 
@@ -6080,14 +8726,14 @@ func (s *Server) handleProxmoxGetGuestConfig(w http.ResponseWriter, r *http.Requ
 	}
 
 	if guestType == "lxc" {
-		config, err := s.proxmoxClient.GetLXCConfig(r.Context(), node, vmid)
+		config, err := px.client.GetLXCConfig(r.Context(), node, vmid)
 		if err != nil {
 			s.respondError(w, http.StatusInternalServerError, err.Error())
 			return
 		}
 		s.respondJSON(w, http.StatusOK, config)
 	} else {
-		config, err := s.proxmoxClient.GetVMConfig(r.Context(), node, vmid)
+		config, err := px.client.GetVMConfig(r.Context(), node, vmid)
 		if err != nil {
 			s.respondError(w, http.StatusInternalServerError, err.Error())
 			return
@@ -6098,18 +8744,18 @@ func (s *Server) handleProxmoxGetGuestConfig(w http.ResponseWriter, r *http.Requ
 
 // handleProxmoxClusterStatus returns cluster status information
 func (s *Server) handleProxmoxClusterStatus(w http.ResponseWriter, r *http.Request) {
-	if s.proxmoxClient == nil {
-		s.respondError(w, http.StatusServiceUnavailable, "Proxmox integration not configured")
+	px, ok := s.requireProxmoxQuery(w, r)
+	if !ok {
 		return
 	}
 
-	isCluster, err := s.proxmoxClient.IsClusterMode(r.Context())
+	isCluster, err := px.client.IsClusterMode(r.Context())
 	if err != nil {
 		s.respondError(w, http.StatusInternalServerError, err.Error())
 		return
 	}
 
-	nodes, err := s.proxmoxClient.GetNodes(r.Context())
+	nodes, err := px.client.GetNodes(r.Context())
 	if err != nil {
 		s.respondError(w, http.StatusInternalServerError, err.Error())
 		return
@@ -6124,8 +8770,8 @@ func (s *Server) handleProxmoxClusterStatus(w http.ResponseWriter, r *http.Reque
 
 // handleProxmoxListBackups returns all Proxmox backups
 func (s *Server) handleProxmoxListBackups(w http.ResponseWriter, r *http.Request) {
-	if s.proxmoxBackupService == nil {
-		s.respondError(w, http.StatusServiceUnavailable, "Proxmox integration not configured")
+	px, ok := s.requireProxmoxQuery(w, r)
+	if !ok {
 		return
 	}
 
@@ -6136,7 +8782,7 @@ func (s *Server) handleProxmoxListBackups(w http.ResponseWriter, r *http.Request
 		}
 	}
 
-	backups, err := s.proxmoxBackupService.ListBackups(r.Context(), limit)
+	backups, err := px.backup.ListBackups(r.Context(), limit)
 	if err != nil {
 		s.respondError(w, http.StatusInternalServerError, err.Error())
 		return
@@ -6147,8 +8793,8 @@ func (s *Server) handleProxmoxListBackups(w http.ResponseWriter, r *http.Request
 
 // handleProxmoxGetBackup returns details of a specific backup
 func (s *Server) handleProxmoxGetBackup(w http.ResponseWriter, r *http.Request) {
-	if s.proxmoxBackupService == nil {
-		s.respondError(w, http.StatusServiceUnavailable, "Proxmox integration not configured")
+	px, ok := s.requireProxmoxQuery(w, r)
+	if !ok {
 		return
 	}
 
@@ -6159,7 +8805,7 @@ func (s *Server) handleProxmoxGetBackup(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	backup, err := s.proxmoxBackupService.GetBackup(r.Context(), id)
+	backup, err := px.backup.GetBackup(r.Context(), id)
 	if err != nil {
 		s.respondError(w, http.StatusNotFound, "backup not found")
 		return
@@ -6168,18 +8814,58 @@ func (s *Server) handleProxmoxGetBackup(w http.ResponseWriter, r *http.Request)
 	s.respondJSON(w, http.StatusOK, backup)
 }
 
-// handleProxmoxCreateBackup creates a backup of a single guest
-func (s *Server) handleProxmoxCreateBackup(w http.ResponseWriter, r *http.Request) {
-	if s.proxmoxBackupService == nil {
-		s.respondError(w, http.StatusServiceUnavailable, "Proxmox integration not configured")
+// handleProxmoxVerifyBackup reads a backup back from tape and checks its
+// vzdump archive, recording the outcome on the backup
+func (s *Server) handleProxmoxVerifyBackup(w http.ResponseWriter, r *http.Request) {
+	id, err := s.getIDParam(r)
+	if err != nil {
+		s.respondError(w, http.StatusBadRequest, "invalid backup id")
 		return
 	}
+	var req struct {
+		DriveID *int64 `json:"drive_id"`
+	}
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			s.respondError(w, http.StatusBadRequest, "invalid request body")
+			return
+		}
+	}
+
+	var clusterID *int64
+	if err := s.db.QueryRow("SELECT cluster_id FROM proxmox_backups WHERE id = ?", id).Scan(&clusterID); err != nil {
+		s.respondError(w, http.StatusNotFound, "backup not found")
+		return
+	}
+	px, ok := s.requireProxmox(w, clusterID)
+	if !ok {
+		return
+	}
+
+	result, err := px.restore.VerifyBackup(r.Context(), id, req.DriveID)
+	if err != nil {
+		s.respondError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	s.auditLog(r, "verify", "proxmox_backup", id, fmt.Sprintf("Verified Proxmox backup %d: %s", id, result.Status))
+
+	s.respondJSON(w, http.StatusOK, result)
+}
 
-	var req proxmox.ProxmoxBackupRequest
+// handleProxmoxCreateBackup creates a backup of a single guest
+func (s *Server) handleProxmoxCreateBackup(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		proxmox.ProxmoxBackupRequest
+		ClusterID int64 `json:"cluster_id"`
+	}
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		s.respondError(w, http.StatusBadRequest, "invalid request body")
 		return
 	}
+	px, ok := s.requireProxmox(w, optionalClusterID(req.ClusterID))
+	if !ok {
+		return
+	}
 
 	// Validate required fields
 	if req.Node == "" || req.VMID == 0 || req.TapeID == 0 {
@@ -6195,7 +8881,7 @@ func (s *Server) handleProxmoxCreateBackup(w http.ResponseWriter, r *http.Reques
 		req.GuestType = proxmox.GuestTypeVM
 	}
 
-	result, err := s.proxmoxBackupService.BackupGuest(r.Context(), &req)
+	result, err := px.backup.BackupGuest(r.Context(), &req.ProxmoxBackupRequest)
 	if err != nil {
 		s.respondError(w, http.StatusInternalServerError, err.Error())
 		return
@@ -6206,45 +8892,66 @@ func (s *Server) handleProxmoxCreateBackup(w http.ResponseWriter, r *http.Reques
 
 // handleProxmoxBackupAll backs up all guests
 func (s *Server) handleProxmoxBackupAll(w http.ResponseWriter, r *http.Request) {
-	if s.proxmoxBackupService == nil {
-		s.respondError(w, http.StatusServiceUnavailable, "Proxmox integration not configured")
-		return
-	}
-
 	var req struct {
-		Node     string `json:"node,omitempty"` // Empty = all nodes
-		TapeID   int64  `json:"tape_id"`
-		Mode     string `json:"mode"`
-		Compress string `json:"compress"`
+		ClusterID   int64  `json:"cluster_id"`
+		Node        string `json:"node,omitempty"` // Empty = all nodes
+		TapeID      int64  `json:"tape_id"`
+		Mode        string `json:"mode"`
+		Compress    string `json:"compress"`
+		BWLimit     int    `json:"bwlimit"`
+		IONice      *int   `json:"ionice"`
+		Parallelism int    `json:"parallelism"`
 	}
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		s.respondError(w, http.StatusBadRequest, "invalid request body")
 		return
 	}
+	px, ok := s.requireProxmox(w, optionalClusterID(req.ClusterID))
+	if !ok {
+		return
+	}
 
 	if req.TapeID == 0 {
 		s.respondError(w, http.StatusBadRequest, "tape_id is required")
 		return
 	}
 
+	var parallelism *int
+	if req.Parallelism != 0 {
+		parallelism = &req.Parallelism
+	}
+	if err := validateProxmoxJobLimits(&req.BWLimit, req.IONice, parallelism); err != nil {
+		s.respondValidationError(w, err)
+		return
+	}
+
 	mode := proxmox.BackupModeSnapshot
 	if req.Mode != "" {
 		mode = proxmox.BackupMode(req.Mode)
 	}
 
-	results, err := s.proxmoxBackupService.BackupAllGuests(r.Context(), req.Node, req.TapeID, mode, req.Compress)
+	summary, err := px.backup.BackupGuests(r.Context(), proxmox.BackupRunOptions{
+		Node:        req.Node,
+		ExcludeTag:  s.proxmoxExcludeTag(),
+		TapeID:      req.TapeID,
+		Mode:        mode,
+		Compress:    req.Compress,
+		BWLimit:     req.BWLimit,
+		IONice:      req.IONice,
+		Parallelism: req.Parallelism,
+	})
 	if err != nil {
 		s.respondError(w, http.StatusInternalServerError, err.Error())
 		return
 	}
 
-	s.respondJSON(w, http.StatusCreated, results)
+	s.respondJSON(w, http.StatusCreated, summary.Results)
 }
 
 // handleProxmoxListRestores returns all Proxmox restores
 func (s *Server) handleProxmoxListRestores(w http.ResponseWriter, r *http.Request) {
-	if s.proxmoxRestoreService == nil {
-		s.respondError(w, http.StatusServiceUnavailable, "Proxmox integration not configured")
+	px, ok := s.requireProxmoxQuery(w, r)
+	if !ok {
 		return
 	}
 
@@ -6255,7 +8962,7 @@ func (s *Server) handleProxmoxListRestores(w http.ResponseWriter, r *http.Reques
 		}
 	}
 
-	restores, err := s.proxmoxRestoreService.ListRestores(r.Context(), limit)
+	restores, err := px.restore.ListRestores(r.Context(), limit)
 	if err != nil {
 		s.respondError(w, http.StatusInternalServerError, err.Error())
 		return
@@ -6266,23 +8973,25 @@ func (s *Server) handleProxmoxListRestores(w http.ResponseWriter, r *http.Reques
 
 // handleProxmoxCreateRestore restores a guest from a backup
 func (s *Server) handleProxmoxCreateRestore(w http.ResponseWriter, r *http.Request) {
-	if s.proxmoxRestoreService == nil {
-		s.respondError(w, http.StatusServiceUnavailable, "Proxmox integration not configured")
-		return
+	var req struct {
+		proxmox.RestoreRequest
+		ClusterID int64 `json:"cluster_id"` // cluster to restore to
 	}
-
-	var req proxmox.RestoreRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		s.respondError(w, http.StatusBadRequest, "invalid request body")
 		return
 	}
+	px, ok := s.requireProxmox(w, optionalClusterID(req.ClusterID))
+	if !ok {
+		return
+	}
 
 	if req.BackupID == 0 {
 		s.respondError(w, http.StatusBadRequest, "backup_id is required")
 		return
 	}
 
-	result, err := s.proxmoxRestoreService.RestoreGuest(r.Context(), &req)
+	result, err := px.restore.RestoreGuest(r.Context(), &req.RestoreRequest)
 	if err != nil {
 		s.respondError(w, http.StatusInternalServerError, err.Error())
 		return
@@ -6293,20 +9002,20 @@ func (s *Server) handleProxmoxCreateRestore(w http.ResponseWriter, r *http.Reque
 
 // handleProxmoxRestorePlan returns the tapes needed for a restore
 func (s *Server) handleProxmoxRestorePlan(w http.ResponseWriter, r *http.Request) {
-	if s.proxmoxRestoreService == nil {
-		s.respondError(w, http.StatusServiceUnavailable, "Proxmox integration not configured")
-		return
-	}
-
 	var req struct {
-		BackupID int64 `json:"backup_id"`
+		ClusterID int64 `json:"cluster_id"`
+		BackupID  int64 `json:"backup_id"`
 	}
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		s.respondError(w, http.StatusBadRequest, "invalid request body")
 		return
 	}
+	px, ok := s.requireProxmox(w, optionalClusterID(req.ClusterID))
+	if !ok {
+		return
+	}
 
-	tapes, err := s.proxmoxRestoreService.GetRequiredTapes(r.Context(), req.BackupID)
+	tapes, err := px.restore.GetRequiredTapes(r.Context(), req.BackupID)
 	if err != nil {
 		s.respondError(w, http.StatusInternalServerError, err.Error())
 		return
@@ -6317,18 +9026,59 @@ func (s *Server) handleProxmoxRestorePlan(w http.ResponseWriter, r *http.Request
 	})
 }
 
+// maxProxmoxParallelism caps how many guests a run dumps at once
+const maxProxmoxParallelism = 8
+
+// validateProxmoxJobLimits checks a job's vzdump limits; nil values are not
+// being set
+func validateProxmoxJobLimits(bwlimit, ionice, parallelism *int) error {
+	v := validation.New()
+	if bwlimit != nil {
+		v.NonNegative("bwlimit", int64(*bwlimit))
+	}
+	if ionice != nil {
+		v.Range("ionice", int64(*ionice), 0, 8)
+	}
+	if parallelism != nil {
+		v.Range("parallelism", int64(*parallelism), 1, maxProxmoxParallelism)
+	}
+	return v.Err()
+}
+
+// normalizeNodeList trims the entries of a comma-separated node list and
+// drops empty ones
+func normalizeNodeList(list string) string {
+	var nodes []string
+	for _, n := range strings.Split(list, ",") {
+		if n = strings.TrimSpace(n); n != "" {
+			nodes = append(nodes, n)
+		}
+	}
+	return strings.Join(nodes, ",")
+}
+
 // handleProxmoxListJobs returns all Proxmox backup jobs
 func (s *Server) handleProxmoxListJobs(w http.ResponseWriter, r *http.Request) {
-	rows, err := s.db.Query(`
-		SELECT j.id, j.name, j.description, j.node, j.vmid_filter, j.guest_type_filter, j.tag_filter,
+	query := `
+		SELECT j.id, j.cluster_id, j.name, j.description, j.node, j.vmid_filter, j.guest_type_filter, j.tag_filter,
 		       j.pool_id, j.backup_mode, j.compress, j.schedule_cron, j.retention_days,
 		       j.enabled, j.last_run_at, j.next_run_at, j.created_at,
 		       COALESCE(j.notify_on_success, 0), COALESCE(j.notify_on_failure, 1), COALESCE(j.notes, ''),
+		       j.dump_nodes, j.bwlimit, j.ionice, j.parallelism,
 		       tp.name as pool_name
 		FROM proxmox_backup_jobs j
-		LEFT JOIN tape_pools tp ON j.pool_id = tp.id
-		ORDER BY j.created_at DESC
-	`)
+		LEFT JOIN tape_pools tp ON j.pool_id = tp.id`
+	var args []interface{}
+	if r.URL.Query().Get("cluster_id") != "" {
+		clusterID, err := clusterIDQuery(r)
+		if err != nil {
+			s.respondError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		query += " WHERE j.cluster_id IS ?"
+		args = append(args, clusterID)
+	}
+	rows, err := s.db.Query(query+" ORDER BY j.created_at DESC", args...)
 	if err != nil {
 		s.respondError(w, http.StatusInternalServerError, err.Error())
 		return
@@ -6340,23 +9090,26 @@ func (s *Server) handleProxmoxListJobs(w http.ResponseWriter, r *http.Request) {
 		var id int64
 		var name, backupMode, compress, scheduleCron string
 		var description, node, vmidFilter, guestTypeFilter, tagFilter *string
-		var poolID *int64
+		var clusterID, poolID *int64
 		var retentionDays int
 		var enabled, notifyOnSuccess, notifyOnFailure bool
-		var notes string
+		var notes, dumpNodes string
+		var bwlimit, parallelism int
+		var ionice *int
 		var lastRunAt, nextRunAt *time.Time
 		var createdAt time.Time
 		var poolName *string
 
-		if err := rows.Scan(&id, &name, &description, &node, &vmidFilter, &guestTypeFilter, &tagFilter,
+		if err := rows.Scan(&id, &clusterID, &name, &description, &node, &vmidFilter, &guestTypeFilter, &tagFilter,
 			&poolID, &backupMode, &compress, &scheduleCron, &retentionDays,
 			&enabled, &lastRunAt, &nextRunAt, &createdAt,
-			&notifyOnSuccess, &notifyOnFailure, &notes, &poolName); err != nil {
+			&notifyOnSuccess, &notifyOnFailure, &notes, &dumpNodes, &bwlimit, &ionice, &parallelism, &poolName); err != nil {
 			continue
 		}
 
 		job := map[string]interface{}{
 			"id":                id,
+			"cluster_id":        clusterID,
 			"name":              name,
 			"backup_mode":       backupMode,
 			"compression":       compress,
@@ -6366,6 +9119,10 @@ func (s *Server) handleProxmoxListJobs(w http.ResponseWriter, r *http.Request) {
 			"notify_on_success": notifyOnSuccess,
 			"notify_on_failure": notifyOnFailure,
 			"notes":             notes,
+			"dump_nodes":        dumpNodes,
+			"bwlimit":           bwlimit,
+			"ionice":            ionice,
+			"parallelism":       parallelism,
 			"created_at":        createdAt,
 		}
 		if description != nil {
@@ -6405,6 +9162,7 @@ func (s *Server) handleProxmoxListJobs(w http.ResponseWriter, r *http.Request) {
 // handleProxmoxCreateJob creates a new Proxmox backup job
 func (s *Server) handleProxmoxCreateJob(w http.ResponseWriter, r *http.Request) {
 	var req struct {
+		ClusterID       int64  `json:"cluster_id"`
 		Name            string `json:"name"`
 		Description     string `json:"description,omitempty"`
 		Node            string `json:"node,omitempty"`
@@ -6422,6 +9180,10 @@ func (s *Server) handleProxmoxCreateJob(w http.ResponseWriter, r *http.Request)
 		NotifyOnSuccess bool   `json:"notify_on_success"`
 		NotifyOnFailure bool   `json:"notify_on_failure"`
 		Notes           string `json:"notes"`
+		DumpNodes       string `json:"dump_nodes"`
+		BWLimit         int    `json:"bwlimit"`
+		IONice          *int   `json:"ionice"`
+		Parallelism     int    `json:"parallelism"`
 	}
 
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
@@ -6429,10 +9191,22 @@ func (s *Server) handleProxmoxCreateJob(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
+	if req.Parallelism == 0 {
+		req.Parallelism = 1
+	}
+	if err := validateProxmoxJobLimits(&req.BWLimit, req.IONice, &req.Parallelism); err != nil {
+		s.respondValidationError(w, err)
+		return
+	}
+
 	if req.Name == "" {
 		s.respondError(w, http.StatusBadRequest, "name is required")
 		return
 	}
+	if msg := s.checkProxmoxClusterRef(req.ClusterID); msg != "" {
+		s.respondError(w, http.StatusBadRequest, msg)
+		return
+	}
 	if req.BackupMode == "" {
 		req.BackupMode = "snapshot"
 	}
@@ -6456,11 +9230,13 @@ func (s *Server) handleProxmoxCreateJob(w http.ResponseWriter, r *http.Request)
 		INSERT INTO proxmox_backup_jobs (
 			name, description, node, vmid_filter, guest_type_filter, tag_filter,
 			pool_id, backup_mode, compress, schedule_cron, retention_days, enabled,
-			notify_on_success, notify_on_failure, notes
-		) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+			notify_on_success, notify_on_failure, notes, cluster_id,
+			dump_nodes, bwlimit, ionice, parallelism
+		) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
 	`, req.Name, req.Description, req.Node, vmidFilter, req.GuestTypeFilter, req.TagFilter,
 		req.PoolID, req.BackupMode, req.Compress, req.ScheduleCron, req.RetentionDays, req.Enabled,
-		req.NotifyOnSuccess, req.NotifyOnFailure, req.Notes)
+		req.NotifyOnSuccess, req.NotifyOnFailure, req.Notes, optionalClusterID(req.ClusterID),
+		normalizeNodeList(req.DumpNodes), req.BWLimit, req.IONice, req.Parallelism)
 	if err != nil {
 		s.respondError(w, http.StatusInternalServerError, err.Error())
 		return
@@ -6484,21 +9260,25 @@ func (s *Server) handleProxmoxGetJob(w http.ResponseWriter, r *http.Request) {
 
 	var name, backupMode, compress, scheduleCron string
 	var description, node, vmidFilter, guestTypeFilter, tagFilter *string
-	var poolID *int64
-	var retentionDays int
+	var clusterID, poolID *int64
+	var retentionDays, bwlimit, parallelism int
+	var ionice *int
 	var enabled bool
+	var dumpNodes string
 	var lastRunAt, nextRunAt *time.Time
 	var createdAt time.Time
 
 	err = s.db.QueryRow(`
-		SELECT name, description, node, vmid_filter, guest_type_filter, tag_filter,
+		SELECT cluster_id, name, description, node, vmid_filter, guest_type_filter, tag_filter,
 		       pool_id, backup_mode, compress, schedule_cron, retention_days,
-		       enabled, last_run_at, next_run_at, created_at
+		       enabled, last_run_at, next_run_at, created_at,
+		       dump_nodes, bwlimit, ionice, parallelism
 		FROM proxmox_backup_jobs
 		WHERE id = ?
-	`, id).Scan(&name, &description, &node, &vmidFilter, &guestTypeFilter, &tagFilter,
+	`, id).Scan(&clusterID, &name, &description, &node, &vmidFilter, &guestTypeFilter, &tagFilter,
 		&poolID, &backupMode, &compress, &scheduleCron, &retentionDays,
-		&enabled, &lastRunAt, &nextRunAt, &createdAt)
+		&enabled, &lastRunAt, &nextRunAt, &createdAt,
+		&dumpNodes, &bwlimit, &ionice, &parallelism)
 	if err != nil {
 		s.respondError(w, http.StatusNotFound, "job not found")
 		return
@@ -6506,12 +9286,17 @@ func (s *Server) handleProxmoxGetJob(w http.ResponseWriter, r *http.Request) {
 
 	job := map[string]interface{}{
 		"id":             id,
+		"cluster_id":     clusterID,
 		"name":           name,
 		"backup_mode":    backupMode,
 		"compress":       compress,
 		"schedule_cron":  scheduleCron,
 		"retention_days": retentionDays,
 		"enabled":        enabled,
+		"dump_nodes":     dumpNodes,
+		"bwlimit":        bwlimit,
+		"ionice":         ionice,
+		"parallelism":    parallelism,
 		"created_at":     createdAt,
 	}
 	if description != nil {
@@ -6552,6 +9337,7 @@ func (s *Server) handleProxmoxUpdateJob(w http.ResponseWriter, r *http.Request)
 	}
 
 	var req struct {
+		ClusterID       *int64  `json:"cluster_id,omitempty"` // 0 moves the job to the configured endpoint
 		Name            string  `json:"name,omitempty"`
 		Description     string  `json:"description,omitempty"`
 		Node            string  `json:"node,omitempty"`
@@ -6569,6 +9355,10 @@ func (s *Server) handleProxmoxUpdateJob(w http.ResponseWriter, r *http.Request)
 		NotifyOnSuccess *bool   `json:"notify_on_success,omitempty"`
 		NotifyOnFailure *bool   `json:"notify_on_failure,omitempty"`
 		Notes           *string `json:"notes,omitempty"`
+		DumpNodes       *string `json:"dump_nodes,omitempty"`
+		BWLimit         *int    `json:"bwlimit,omitempty"`
+		IONice          *int    `json:"ionice,omitempty"` // -1 restores vzdump's default
+		Parallelism     *int    `json:"parallelism,omitempty"`
 	}
 
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
@@ -6576,10 +9366,28 @@ func (s *Server) handleProxmoxUpdateJob(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
+	clearIONice := req.IONice != nil && *req.IONice == -1
+	ionice := req.IONice
+	if clearIONice {
+		ionice = nil
+	}
+	if err := validateProxmoxJobLimits(req.BWLimit, ionice, req.Parallelism); err != nil {
+		s.respondValidationError(w, err)
+		return
+	}
+
 	// Build dynamic update query
 	updates := []string{}
 	args := []interface{}{}
 
+	if req.ClusterID != nil {
+		if msg := s.checkProxmoxClusterRef(*req.ClusterID); msg != "" {
+			s.respondError(w, http.StatusBadRequest, msg)
+			return
+		}
+		updates = append(updates, "cluster_id = ?")
+		args = append(args, optionalClusterID(*req.ClusterID))
+	}
 	if req.Name != "" {
 		updates = append(updates, "name = ?")
 		args = append(args, req.Name)
@@ -6650,6 +9458,22 @@ func (s *Server) handleProxmoxUpdateJob(w http.ResponseWriter, r *http.Request)
 		updates = append(updates, "notes = ?")
 		args = append(args, *req.Notes)
 	}
+	if req.DumpNodes != nil {
+		updates = append(updates, "dump_nodes = ?")
+		args = append(args, normalizeNodeList(*req.DumpNodes))
+	}
+	if req.BWLimit != nil {
+		updates = append(updates, "bwlimit = ?")
+		args = append(args, *req.BWLimit)
+	}
+	if req.IONice != nil {
+		updates = append(updates, "ionice = ?")
+		args = append(args, ionice)
+	}
+	if req.Parallelism != nil {
+		updates = append(updates, "parallelism = ?")
+		args = append(args, *req.Parallelism)
+	}
 
 	if len(updates) == 0 {
 		s.respondError(w, http.StatusBadRequest, "no fields to update")
@@ -6702,11 +9526,6 @@ func (s *Server) handleProxmoxDeleteJob(w http.ResponseWriter, r *http.Request)
 
 // handleProxmoxRunJob manually runs a Proxmox backup job
 func (s *Server) handleProxmoxRunJob(w http.ResponseWriter, r *http.Request) {
-	if s.proxmoxBackupService == nil {
-		s.respondError(w, http.StatusServiceUnavailable, "Proxmox integration not configured")
-		return
-	}
-
 	idStr := chi.URLParam(r, "id")
 	id, err := strconv.ParseInt(idStr, 10, 64)
 	if err != nil {
@@ -6729,30 +9548,36 @@ func (s *Server) handleProxmoxRunJob(w http.ResponseWriter, r *http.Request) {
 
 	// Get job details
 	var node *string
-	var backupMode, compress string
+	var clusterID *int64
+	var backupMode, compress, dumpNodes string
+	var opts proxmox.BackupRunOptions
 	err = s.db.QueryRow(`
-		SELECT node, backup_mode, compress 
+		SELECT node, cluster_id, backup_mode, compress, dump_nodes, bwlimit, ionice, parallelism
 		FROM proxmox_backup_jobs 
 		WHERE id = ?
-	`, id).Scan(&node, &backupMode, &compress)
+	`, id).Scan(&node, &clusterID, &backupMode, &compress, &dumpNodes, &opts.BWLimit, &opts.IONice, &opts.Parallelism)
 	if err != nil {
 		s.respondError(w, http.StatusNotFound, "job not found")
 		return
 	}
+	px, ok := s.requireProxmox(w, clusterID)
+	if !ok {
+		return
+	}
 
-	nodeStr := ""
 	if node != nil {
-		nodeStr = *node
+		opts.Node = *node
+	}
+	if dumpNodes != "" {
+		opts.DumpNodes = strings.Split(dumpNodes, ",")
 	}
+	opts.TapeID = req.TapeID
+	opts.Mode = proxmox.BackupMode(backupMode)
+	opts.Compress = compress
+	opts.ExcludeTag = s.proxmoxExcludeTag()
 
 	// Run backup for all guests matching the job criteria
-	results, err := s.proxmoxBackupService.BackupAllGuests(
-		r.Context(),
-		nodeStr,
-		req.TapeID,
-		proxmox.BackupMode(backupMode),
-		compress,
-	)
+	summary, err := px.backup.BackupGuests(r.Context(), opts)
 	if err != nil {
 		s.respondError(w, http.StatusInternalServerError, err.Error())
 		return
@@ -6762,9 +9587,10 @@ func (s *Server) handleProxmoxRunJob(w http.ResponseWriter, r *http.Request) {
 	s.db.Exec("UPDATE proxmox_backup_jobs SET last_run_at = CURRENT_TIMESTAMP WHERE id = ?", id)
 
 	s.respondJSON(w, http.StatusOK, map[string]interface{}{
-		"message": "Proxmox backup job executed",
-		"job_id":  id,
-		"results": results,
+		"message":  "Proxmox backup job executed",
+		"job_id":   id,
+		"results":  summary.Results,
+		"excluded": summary.Excluded,
 	})
 }
 
@@ -6936,9 +9762,10 @@ func (s *Server) handleListAPIKeys(w http.ResponseWriter, r *http.Request) {
 
 func (s *Server) handleCreateAPIKey(w http.ResponseWriter, r *http.Request) {
 	var req struct {
-		Name      string `json:"name"`
-		Role      string `json:"role"`
-		ExpiresIn *int   `json:"expires_in_days"` // Optional: days until expiry
+		Name         string `json:"name"`
+		Role         string `json:"role"`
+		ExpiresIn    *int   `json:"expires_in_days"` // Optional: days until expiry
+		AllowedCIDRs string `json:"allowed_cidrs"`   // Optional: comma-separated
 	}
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		s.respondError(w, http.StatusBadRequest, "invalid request body")
@@ -6951,8 +9778,14 @@ func (s *Server) handleCreateAPIKey(w http.ResponseWriter, r *http.Request) {
 	}
 
 	role := models.UserRole(req.Role)
-	if role != models.RoleAdmin && role != models.RoleOperator && role != models.RoleReadOnly {
-		s.respondError(w, http.StatusBadRequest, "invalid role: must be admin, operator, or readonly")
+	if !role.Valid() {
+		s.respondError(w, http.StatusBadRequest, "invalid role: must be admin, operator, restore_operator, readonly, or kiosk")
+		return
+	}
+
+	allowedCIDRs, err := normalizeNetworks(req.AllowedCIDRs)
+	if err != nil {
+		s.respondError(w, http.StatusBadRequest, "allowed_cidrs: "+err.Error())
 		return
 	}
 
@@ -6962,7 +9795,7 @@ func (s *Server) handleCreateAPIKey(w http.ResponseWriter, r *http.Request) {
 		expiresAt = &t
 	}
 
-	rawKey, apiKey, err := s.authService.GenerateAPIKey(req.Name, role, expiresAt)
+	rawKey, apiKey, err := s.authService.GenerateAPIKey(req.Name, role, expiresAt, allowedCIDRs)
 	if err != nil {
 		s.respondError(w, http.StatusInternalServerError, err.Error())
 		return
@@ -6977,6 +9810,45 @@ func (s *Server) handleCreateAPIKey(w http.ResponseWriter, r *http.Request) {
 	})
 }
 
+// handleUpdateAPIKey changes the networks an API key may call admin
+// endpoints and destructive operations from
+func (s *Server) handleUpdateAPIKey(w http.ResponseWriter, r *http.Request) {
+	id, err := s.getIDParam(r)
+	if err != nil {
+		s.respondError(w, http.StatusBadRequest, "invalid API key id")
+		return
+	}
+	var req struct {
+		AllowedCIDRs *string `json:"allowed_cidrs"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		s.respondError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+	if req.AllowedCIDRs == nil {
+		s.respondError(w, http.StatusBadRequest, "no fields to update")
+		return
+	}
+	allowedCIDRs, err := normalizeNetworks(*req.AllowedCIDRs)
+	if err != nil {
+		s.respondError(w, http.StatusBadRequest, "allowed_cidrs: "+err.Error())
+		return
+	}
+
+	if err := s.authService.SetAPIKeyCIDRs(id, allowedCIDRs); err != nil {
+		if errors.Is(err, auth.ErrAPIKeyNotFound) {
+			s.respondError(w, http.StatusNotFound, err.Error())
+			return
+		}
+		s.respondError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	s.auditLog(r, "update", "api_key", id, fmt.Sprintf("Set API key networks to '%s'", allowedCIDRs))
+
+	s.respondJSON(w, http.StatusOK, map[string]string{"status": "updated"})
+}
+
 func (s *Server) handleDeleteAPIKey(w http.ResponseWriter, r *http.Request) {
 	id, err := s.getIDParam(r)
 	if err != nil {
@@ -7031,22 +9903,21 @@ func (s *Server) handleBatchLabel(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Default and validate format type
-	if req.FormatType == "" {
-		req.FormatType = string(models.TapeFormatRaw)
-	}
-	if req.FormatType != string(models.TapeFormatRaw) && req.FormatType != string(models.TapeFormatLTFS) {
-		s.respondError(w, http.StatusBadRequest, "format_type must be 'raw' or 'ltfs'")
+	formatType, err := s.tapeFormatForPool(req.PoolID, req.FormatType)
+	if err != nil {
+		s.respondError(w, http.StatusBadRequest, err.Error())
 		return
 	}
+	req.FormatType = formatType
 	if req.FormatType == string(models.TapeFormatLTFS) && !tape.IsAvailable() {
-		s.respondError(w, http.StatusServiceUnavailable, "LTFS software not installed on this system")
+		s.respondErrorCode(w, http.StatusServiceUnavailable, codeNotConfigured, "LTFS software not installed on this system", nil)
 		return
 	}
 
 	s.batchLabel.mu.Lock()
 	if s.batchLabel.running {
 		s.batchLabel.mu.Unlock()
-		s.respondError(w, http.StatusConflict, "batch labelling is already running")
+		s.respondErrorCode(w, http.StatusConflict, codeOperationInProgress, "batch labelling is already running", nil)
 		return
 	}
 	s.batchLabel.mu.Unlock()
@@ -7123,8 +9994,8 @@ func (s *Server) runBatchLabel(ctx context.Context, devicePath string, driveID i
 				s.eventBus.Publish(SystemEvent{
 					Type:     "warning",
 					Category: "tape",
-					Title:    "Batch Label",
-					Message:  fmt.Sprintf("Batch labelling cancelled after %d/%d tapes", i, count),
+					Key:      "batch_label_cancelled",
+					Args:     []interface{}{i, count},
 				})
 			}
 			return
@@ -7145,8 +10016,8 @@ func (s *Server) runBatchLabel(ctx context.Context, devicePath string, driveID i
 			s.eventBus.Publish(SystemEvent{
 				Type:     "info",
 				Category: "tape",
-				Title:    "Batch Label",
-				Message:  fmt.Sprintf("[%d/%d] Waiting for tape to label as '%s'... Insert tape and close drive.", i+1, count, label),
+				Key:      "batch_label_waiting",
+				Args:     []interface{}{i + 1, count, label},
 				Details:  map[string]interface{}{"label": label, "progress": i, "total": count},
 			})
 		}
@@ -7161,8 +10032,8 @@ func (s *Server) runBatchLabel(ctx context.Context, devicePath string, driveID i
 					s.eventBus.Publish(SystemEvent{
 						Type:     "warning",
 						Category: "tape",
-						Title:    "Batch Label",
-						Message:  fmt.Sprintf("Batch labelling cancelled after %d/%d tapes", i, count),
+						Key:      "batch_label_cancelled",
+						Args:     []interface{}{i, count},
 					})
 				}
 				return
@@ -7175,8 +10046,8 @@ func (s *Server) runBatchLabel(ctx context.Context, devicePath string, driveID i
 				s.eventBus.Publish(SystemEvent{
 					Type:     "error",
 					Category: "tape",
-					Title:    "Batch Label",
-					Message:  fmt.Sprintf("[%d/%d] Timeout waiting for tape. Batch labelling stopped.", i+1, count),
+					Key:      "batch_label_timeout",
+					Args:     []interface{}{i + 1, count},
 				})
 			}
 			return
@@ -7195,8 +10066,8 @@ func (s *Server) runBatchLabel(ctx context.Context, devicePath string, driveID i
 				s.eventBus.Publish(SystemEvent{
 					Type:     "warning",
 					Category: "tape",
-					Title:    "Batch Label",
-					Message:  fmt.Sprintf("[%d/%d] Tape already labelled as '%s', skipping. Eject and insert a blank tape.", i+1, count, existingLabel.Label),
+					Key:      "batch_label_skipped",
+					Args:     []interface{}{i + 1, count, existingLabel.Label},
 				})
 			}
 			// Eject the already-labelled tape
@@ -7239,8 +10110,8 @@ func (s *Server) runBatchLabel(ctx context.Context, devicePath string, driveID i
 				s.eventBus.Publish(SystemEvent{
 					Type:     "error",
 					Category: "tape",
-					Title:    "Batch Label",
-					Message:  fmt.Sprintf("[%d/%d] Failed to write label '%s': %s", i+1, count, label, writeErr.Error()),
+					Key:      "batch_label_write_failed",
+					Args:     []interface{}{i + 1, count, label, writeErr.Error()},
 				})
 			}
 			return
@@ -7279,8 +10150,8 @@ func (s *Server) runBatchLabel(ctx context.Context, devicePath string, driveID i
 			s.eventBus.Publish(SystemEvent{
 				Type:     "success",
 				Category: "tape",
-				Title:    "Batch Label",
-				Message:  fmt.Sprintf("[%d/%d] Successfully labelled tape as '%s'. Ejecting...", i+1, count, label),
+				Key:      "batch_label_written",
+				Args:     []interface{}{i + 1, count, label},
 				Details:  map[string]interface{}{"label": label, "uuid": tapeUUID, "lto_type": ltoType},
 			})
 		}
@@ -7291,15 +10162,16 @@ func (s *Server) runBatchLabel(ctx context.Context, devicePath string, driveID i
 				s.eventBus.Publish(SystemEvent{
 					Type:     "warning",
 					Category: "tape",
-					Title:    "Batch Label",
-					Message:  fmt.Sprintf("[%d/%d] Label written but eject failed: %s. Please eject manually.", i+1, count, err.Error()),
+					Key:      "batch_label_eject_failed",
+					Args:     []interface{}{i + 1, count, err.Error()},
 				})
 			}
 		}
 
-		// Invalidate label cache
+		// Invalidate label cache even if the eject failed, so the next
+		// status read picks up the newly written label from the tape
 		if cache := s.tapeService.GetLabelCache(); cache != nil {
-			cache.Invalidate(devicePath)
+			cache.InvalidateReason(devicePath, "batch_label")
 		}
 	}
 
@@ -7311,8 +10183,8 @@ func (s *Server) runBatchLabel(ctx context.Context, devicePath string, driveID i
 		s.eventBus.Publish(SystemEvent{
 			Type:     "success",
 			Category: "tape",
-			Title:    "Batch Label Complete",
-			Message:  fmt.Sprintf("Batch labelling complete: %d tapes labelled (%s%0*d through %s%0*d)", count, prefix, digits, startNum, prefix, digits, startNum+count-1),
+			Key:      "batch_label_complete",
+			Args:     []interface{}{count, prefix, digits, startNum, prefix, digits, startNum + count - 1},
 		})
 	}
 }
@@ -7353,29 +10225,28 @@ func (s *Server) handleTapesBatchLabel(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Default and validate format type
-	if req.FormatType == "" {
-		req.FormatType = string(models.TapeFormatRaw)
-	}
-	if req.FormatType != string(models.TapeFormatRaw) && req.FormatType != string(models.TapeFormatLTFS) {
-		s.respondError(w, http.StatusBadRequest, "format_type must be 'raw' or 'ltfs'")
+	formatType, err := s.tapeFormatForPool(req.PoolID, req.FormatType)
+	if err != nil {
+		s.respondError(w, http.StatusBadRequest, err.Error())
 		return
 	}
+	req.FormatType = formatType
 	if req.FormatType == string(models.TapeFormatLTFS) && !tape.IsAvailable() {
-		s.respondError(w, http.StatusServiceUnavailable, "LTFS software not installed on this system")
+		s.respondErrorCode(w, http.StatusServiceUnavailable, codeNotConfigured, "LTFS software not installed on this system", nil)
 		return
 	}
 
 	s.batchLabel.mu.Lock()
 	if s.batchLabel.running {
 		s.batchLabel.mu.Unlock()
-		s.respondError(w, http.StatusConflict, "batch labelling is already running")
+		s.respondErrorCode(w, http.StatusConflict, codeOperationInProgress, "batch labelling is already running", nil)
 		return
 	}
 	s.batchLabel.mu.Unlock()
 
 	// Get drive device path
 	var devicePath string
-	err := s.db.QueryRow("SELECT device_path FROM tape_drives WHERE id = ? AND enabled = 1", req.DriveID).Scan(&devicePath)
+	err = s.db.QueryRow("SELECT device_path FROM tape_drives WHERE id = ? AND enabled = 1", req.DriveID).Scan(&devicePath)
 	if err != nil {
 		s.respondError(w, http.StatusNotFound, "drive not found or not enabled")
 		return
@@ -7455,8 +10326,10 @@ func (s *Server) handleHealthCheck(w http.ResponseWriter, r *http.Request) {
 		"status":    "ok",
 		"timestamp": time.Now().UTC().Format(time.RFC3339),
 		"components": map[string]interface{}{
-			"database": s.checkDatabaseHealth(),
-			"tape":     s.checkTapeHealth(),
+			"database":     s.checkDatabaseHealth(),
+			"tape":         s.checkTapeHealth(),
+			"scratch":      s.checkScratchHealth(),
+			"capabilities": s.checkCapabilitiesHealth(),
 		},
 	}
 
@@ -7480,7 +10353,7 @@ func (s *Server) handleHealthCheck(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(health)
 }
 
-// checkDatabaseHealth verifies database connectivity
+// checkDatabaseHealth verifies database connectivity and integrity
 func (s *Server) checkDatabaseHealth() map[string]interface{} {
 	result := map[string]interface{}{
 		"status": "ok",
@@ -7496,6 +10369,17 @@ func (s *Server) checkDatabaseHealth() map[string]interface{} {
 	}
 
 	result["users"] = count
+
+	// Report the last integrity check and any snapshot fallback at startup
+	if check := s.db.LastIntegrityCheck(); check != nil {
+		result["integrity"] = check
+		if !check.OK {
+			result["status"] = "corrupt"
+		}
+	}
+	if recovery := s.db.Recovery(); recovery != nil {
+		result["recovery"] = recovery
+	}
 	return result
 }
 
@@ -7518,6 +10402,71 @@ func (s *Server) checkTapeHealth() map[string]interface{} {
 	return result
 }
 
+// checkCapabilitiesHealth checks access to the drives, changers and external
+// tools as the user the server runs as. Changers that cannot be used are
+// disabled until a later check finds them usable again.
+func (s *Server) checkCapabilitiesHealth() map[string]interface{} {
+	result := map[string]interface{}{
+		"status": "ok",
+	}
+
+	targets, err := preflight.LoadTargets(s.db)
+	if err != nil {
+		result["status"] = "unknown"
+		result["error"] = "failed to read drives and libraries"
+		return result
+	}
+	report := preflight.Run(targets)
+	if s.library != nil {
+		s.library.SetUnavailable(report.UnavailableChangers)
+	}
+
+	problems := report.Problems()
+	if problems == nil {
+		problems = []preflight.Check{}
+	}
+	disabled := report.Disabled
+	if disabled == nil {
+		disabled = []string{}
+	}
+	result["user"] = report.User
+	result["uid"] = report.UID
+	result["root"] = report.Root
+	result["checks"] = len(report.Checks)
+	result["problems"] = problems
+	result["disabled_features"] = disabled
+	if !report.OK() {
+		result["status"] = "missing_access"
+	}
+	return result
+}
+
+// checkScratchHealth reports scratch directory usage and whether free space
+// has dropped below the configured reserve
+func (s *Server) checkScratchHealth() map[string]interface{} {
+	result := map[string]interface{}{
+		"status": "ok",
+	}
+
+	usage, err := s.scratch.Usage()
+	if err != nil {
+		result["status"] = "error"
+		result["error"] = "failed to read scratch directory"
+		return result
+	}
+
+	result["path"] = usage.Path
+	result["used_bytes"] = usage.UsedBytes
+	result["entries"] = usage.Entries
+	result["available_bytes"] = usage.AvailableBytes
+	result["total_bytes"] = usage.TotalBytes
+	result["min_free_bytes"] = usage.MinFreeBytes
+	if usage.AvailableBytes < usage.MinFreeBytes {
+		result["status"] = "low_space"
+	}
+	return result
+}
+
 func (s *Server) handleInspectTape(w http.ResponseWriter, r *http.Request) {
 	driveID, err := s.getIDParam(r)
 	if err != nil {
@@ -7539,8 +10488,8 @@ func (s *Server) handleInspectTape(w http.ResponseWriter, r *http.Request) {
 		s.eventBus.Publish(SystemEvent{
 			Type:     "info",
 			Category: "tape",
-			Title:    "Tape Inspection Started",
-			Message:  fmt.Sprintf("Inspecting tape in drive %s...", devicePath),
+			Key:      "inspection_started",
+			Args:     []interface{}{devicePath},
 		})
 	}
 
@@ -7559,8 +10508,8 @@ func (s *Server) handleInspectTape(w http.ResponseWriter, r *http.Request) {
 			s.eventBus.Publish(SystemEvent{
 				Type:     "error",
 				Category: "tape",
-				Title:    "Tape Inspection Failed",
-				Message:  "Could not query drive status: " + statusErr.Error(),
+				Key:      "inspection_failed",
+				Args:     []interface{}{statusErr.Error()},
 			})
 		}
 		s.respondJSON(w, http.StatusOK, result)
@@ -7573,8 +10522,8 @@ func (s *Server) handleInspectTape(w http.ResponseWriter, r *http.Request) {
 			s.eventBus.Publish(SystemEvent{
 				Type:     "warning",
 				Category: "tape",
-				Title:    "Tape Inspection",
-				Message:  "No tape loaded in drive " + devicePath,
+				Key:      "inspection_no_tape",
+				Args:     []interface{}{devicePath},
 			})
 		}
 		s.respondJSON(w, http.StatusOK, result)
@@ -7595,8 +10544,7 @@ func (s *Server) handleInspectTape(w http.ResponseWriter, r *http.Request) {
 		s.eventBus.Publish(SystemEvent{
 			Type:     "info",
 			Category: "tape",
-			Title:    "Tape Inspection",
-			Message:  "Reading tape label...",
+			Key:      "inspection_reading_label",
 		})
 	}
 
@@ -7622,8 +10570,8 @@ func (s *Server) handleInspectTape(w http.ResponseWriter, r *http.Request) {
 			s.eventBus.Publish(SystemEvent{
 				Type:     "success",
 				Category: "tape",
-				Title:    "Tape Inspection",
-				Message:  fmt.Sprintf("Found TapeBackarr label: '%s' (UUID: %s)", labelData.Label, labelData.UUID),
+				Key:      "inspection_label_found",
+				Args:     []interface{}{labelData.Label, labelData.UUID},
 			})
 		}
 	} else {
@@ -7638,8 +10586,8 @@ func (s *Server) handleInspectTape(w http.ResponseWriter, r *http.Request) {
 			s.eventBus.Publish(SystemEvent{
 				Type:     "warning",
 				Category: "tape",
-				Title:    "Tape Inspection",
-				Message:  labelMsg,
+				Key:      "inspection_label",
+				Args:     []interface{}{labelMsg},
 			})
 		}
 	}
@@ -7649,8 +10597,7 @@ func (s *Server) handleInspectTape(w http.ResponseWriter, r *http.Request) {
 		s.eventBus.Publish(SystemEvent{
 			Type:     "info",
 			Category: "tape",
-			Title:    "Tape Inspection",
-			Message:  "Scanning tape contents...",
+			Key:      "inspection_scanning",
 		})
 	}
 
@@ -7680,8 +10627,8 @@ func (s *Server) handleInspectTape(w http.ResponseWriter, r *http.Request) {
 		s.eventBus.Publish(SystemEvent{
 			Type:     "success",
 			Category: "tape",
-			Title:    "Tape Inspection Complete",
-			Message:  fmt.Sprintf("Inspection complete: %d file entries found", entryCount),
+			Key:      "inspection_complete",
+			Args:     []interface{}{entryCount},
 		})
 	}
 
@@ -7712,8 +10659,7 @@ func (s *Server) handleScanForDBBackup(w http.ResponseWriter, r *http.Request) {
 		s.eventBus.Publish(SystemEvent{
 			Type:     "info",
 			Category: "system",
-			Title:    "DB Recovery Scan",
-			Message:  "Scanning tape for database backup files...",
+			Key:      "db_recovery_scan",
 		})
 	}
 
@@ -7775,8 +10721,8 @@ func (s *Server) handleScanForDBBackup(w http.ResponseWriter, r *http.Request) {
 		s.eventBus.Publish(SystemEvent{
 			Type:     "success",
 			Category: "system",
-			Title:    "DB Recovery Scan Complete",
-			Message:  fmt.Sprintf("Found %d database backup file(s) on tape", len(dbBackups)),
+			Key:      "db_recovery_scan_complete",
+			Args:     []interface{}{len(dbBackups)},
 		})
 	}
 
@@ -8072,6 +11018,10 @@ func (s *Server) handleLibraryInventory(w http.ResponseWriter, r *http.Request)
 		s.respondError(w, http.StatusNotFound, "library not found")
 		return
 	}
+	if err := s.library.CheckChanger(devicePath); err != nil {
+		s.respondError(w, http.StatusServiceUnavailable, err.Error())
+		return
+	}
 
 	// Run mtx status command to get inventory
 	cmd := exec.Command("mtx", "-f", devicePath, "status")
@@ -8082,7 +11032,7 @@ func (s *Server) handleLibraryInventory(w http.ResponseWriter, r *http.Request)
 	}
 
 	// Parse mtx output and update database
-	slots := parseMtxStatus(string(output))
+	slots := library.ParseStatus(string(output))
 
 	// Update library metadata
 	numStorage := 0
@@ -8127,8 +11077,8 @@ func (s *Server) handleLibraryInventory(w http.ResponseWriter, r *http.Request)
 		s.eventBus.Publish(SystemEvent{
 			Type:     "info",
 			Category: "tape",
-			Title:    "Library Inventory Complete",
-			Message:  fmt.Sprintf("Found %d storage slots, %d drives, %d I/E slots", numStorage, numDrives, numIE),
+			Key:      "library_inventory_complete",
+			Args:     []interface{}{numStorage, numDrives, numIE},
 		})
 	}
 
@@ -8141,91 +11091,6 @@ func (s *Server) handleLibraryInventory(w http.ResponseWriter, r *http.Request)
 	})
 }
 
-// parseMtxStatus parses the output of `mtx -f /dev/sgX status`
-func parseMtxStatus(output string) []map[string]string {
-	var slots []map[string]string
-	lines := strings.Split(output, "\n")
-
-	extractBarcode := func(line, prefix string) string {
-		if idx := strings.Index(line, prefix); idx >= 0 {
-			bc := strings.TrimSpace(line[idx+len(prefix):])
-			// Remove any trailing whitespace or non-printable chars
-			bc = strings.Fields(bc)[0]
-			return bc
-		}
-		return ""
-	}
-
-	for _, line := range lines {
-		line = strings.TrimSpace(line)
-
-		if strings.HasPrefix(line, "Data Transfer Element") {
-			// Drive slot: "Data Transfer Element 0:Full (Storage Element 3 Loaded):VolumeTag = TAPE001"
-			slot := map[string]string{
-				"slot_type": "drive",
-				"is_empty":  "true",
-				"barcode":   "",
-			}
-			// Extract drive number
-			parts := strings.SplitN(line, ":", 2)
-			numStr := strings.TrimPrefix(parts[0], "Data Transfer Element ")
-			slot["slot_number"] = strings.TrimSpace(numStr)
-
-			if strings.Contains(line, "Full") {
-				slot["is_empty"] = "false"
-			}
-			slot["barcode"] = extractBarcode(line, "VolumeTag = ")
-			if slot["barcode"] == "" {
-				slot["barcode"] = extractBarcode(line, "VolumeTag=")
-			}
-			slots = append(slots, slot)
-
-		} else if strings.Contains(line, "Storage Element") && strings.Contains(line, "IMPORT/EXPORT") {
-			// Import/Export slot
-			slot := map[string]string{
-				"slot_type": "import_export",
-				"is_empty":  "true",
-				"barcode":   "",
-			}
-			parts := strings.SplitN(line, ":", 2)
-			numStr := strings.TrimPrefix(parts[0], "      Storage Element ")
-			numStr = strings.Split(numStr, " ")[0]
-			slot["slot_number"] = strings.TrimSpace(numStr)
-
-			if strings.Contains(line, "Full") {
-				slot["is_empty"] = "false"
-			}
-			slot["barcode"] = extractBarcode(line, "VolumeTag=")
-			if slot["barcode"] == "" {
-				slot["barcode"] = extractBarcode(line, "VolumeTag = ")
-			}
-			slots = append(slots, slot)
-
-		} else if strings.Contains(line, "Storage Element") {
-			// Normal storage slot: "      Storage Element 1:Full :VolumeTag=TAPE001"
-			slot := map[string]string{
-				"slot_type": "storage",
-				"is_empty":  "true",
-				"barcode":   "",
-			}
-			parts := strings.SplitN(line, ":", 2)
-			numStr := strings.TrimPrefix(parts[0], "      Storage Element ")
-			slot["slot_number"] = strings.TrimSpace(numStr)
-
-			if strings.Contains(line, "Full") {
-				slot["is_empty"] = "false"
-			}
-			slot["barcode"] = extractBarcode(line, "VolumeTag=")
-			if slot["barcode"] == "" {
-				slot["barcode"] = extractBarcode(line, "VolumeTag = ")
-			}
-			slots = append(slots, slot)
-		}
-	}
-
-	return slots
-}
-
 func (s *Server) handleListLibrarySlots(w http.ResponseWriter, r *http.Request) {
 	id, err := s.getIDParam(r)
 	if err != nil {
@@ -8289,8 +11154,9 @@ func (s *Server) handleLibraryLoad(w http.ResponseWriter, r *http.Request) {
 	}
 
 	var req struct {
-		SlotNumber  int `json:"slot_number"`
-		DriveNumber int `json:"drive_number"`
+		SlotNumber int `json:"slot_number"`
+		// DriveNumber is picked by the drive selection policy when omitted
+		DriveNumber *int `json:"drive_number"`
 	}
 
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
@@ -8305,28 +11171,41 @@ func (s *Server) handleLibraryLoad(w http.ResponseWriter, r *http.Request) {
 		s.respondError(w, http.StatusNotFound, "library not found")
 		return
 	}
+	if err := s.library.CheckChanger(devicePath); err != nil {
+		s.respondError(w, http.StatusServiceUnavailable, err.Error())
+		return
+	}
+	var driveNum int
+	if req.DriveNumber != nil {
+		driveNum = *req.DriveNumber
+	} else if _, driveNum, err = s.pickLibraryDrive(id); err != nil {
+		s.respondError(w, http.StatusConflict, err.Error())
+		return
+	}
 
 	// Run mtx load command
-	cmd := exec.Command("mtx", "-f", devicePath, "load", strconv.Itoa(req.SlotNumber), strconv.Itoa(req.DriveNumber))
+	cmd := exec.Command("mtx", "-f", devicePath, "load", strconv.Itoa(req.SlotNumber), strconv.Itoa(driveNum))
 	output, err := cmd.CombinedOutput()
 	if err != nil {
 		s.respondError(w, http.StatusInternalServerError, fmt.Sprintf("mtx load failed: %s - %s", err.Error(), string(output)))
 		return
 	}
 
-	s.auditLog(r, "load", "tape_library", id, fmt.Sprintf("Loaded tape from slot %d to drive %d", req.SlotNumber, req.DriveNumber))
+	s.invalidateLibraryDriveLabels(id, driveNum, "library_load")
+
+	s.auditLog(r, "load", "tape_library", id, fmt.Sprintf("Loaded tape from slot %d to drive %d", req.SlotNumber, driveNum))
 
 	if s.eventBus != nil {
 		s.eventBus.Publish(SystemEvent{
 			Type:     "info",
 			Category: "tape",
-			Title:    "Tape Loaded",
-			Message:  fmt.Sprintf("Loaded tape from slot %d to drive %d", req.SlotNumber, req.DriveNumber),
+			Key:      "library_tape_loaded",
+			Args:     []interface{}{req.SlotNumber, driveNum},
 		})
 	}
 
 	s.respondJSON(w, http.StatusOK, map[string]string{
-		"message": fmt.Sprintf("Tape loaded from slot %d to drive %d", req.SlotNumber, req.DriveNumber),
+		"message": fmt.Sprintf("Tape loaded from slot %d to drive %d", req.SlotNumber, driveNum),
 	})
 }
 
@@ -8353,6 +11232,10 @@ func (s *Server) handleLibraryUnload(w http.ResponseWriter, r *http.Request) {
 		s.respondError(w, http.StatusNotFound, "library not found")
 		return
 	}
+	if err := s.library.CheckChanger(devicePath); err != nil {
+		s.respondError(w, http.StatusServiceUnavailable, err.Error())
+		return
+	}
 
 	cmd := exec.Command("mtx", "-f", devicePath, "unload", strconv.Itoa(req.SlotNumber), strconv.Itoa(req.DriveNumber))
 	output, err := cmd.CombinedOutput()
@@ -8361,14 +11244,16 @@ func (s *Server) handleLibraryUnload(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	s.invalidateLibraryDriveLabels(id, req.DriveNumber, "library_unload")
+
 	s.auditLog(r, "unload", "tape_library", id, fmt.Sprintf("Unloaded tape from drive %d to slot %d", req.DriveNumber, req.SlotNumber))
 
 	if s.eventBus != nil {
 		s.eventBus.Publish(SystemEvent{
 			Type:     "info",
 			Category: "tape",
-			Title:    "Tape Unloaded",
-			Message:  fmt.Sprintf("Unloaded tape from drive %d to slot %d", req.DriveNumber, req.SlotNumber),
+			Key:      "library_tape_unloaded",
+			Args:     []interface{}{req.DriveNumber, req.SlotNumber},
 		})
 	}
 
@@ -8400,6 +11285,10 @@ func (s *Server) handleLibraryTransfer(w http.ResponseWriter, r *http.Request) {
 		s.respondError(w, http.StatusNotFound, "library not found")
 		return
 	}
+	if err := s.library.CheckChanger(devicePath); err != nil {
+		s.respondError(w, http.StatusServiceUnavailable, err.Error())
+		return
+	}
 
 	cmd := exec.Command("mtx", "-f", devicePath, "transfer", strconv.Itoa(req.SourceSlot), strconv.Itoa(req.DestSlot))
 	output, err := cmd.CombinedOutput()
@@ -8414,6 +11303,51 @@ func (s *Server) handleLibraryTransfer(w http.ResponseWriter, r *http.Request) {
 	})
 }
 
+// invalidateLibraryDriveLabels clears cached labels and probe results for the
+// drive a changer just moved media in or out of. If the changer drive number
+// is not mapped to a configured drive, every drive attached to the library is
+// cleared instead.
+func (s *Server) invalidateLibraryDriveLabels(libraryID int64, driveNumber int, reason string) {
+	cache := s.tapeService.GetLabelCache()
+	rows, err := s.db.Query(`
+		SELECT device_path, library_drive_number FROM tape_drives WHERE library_id = ?
+	`, libraryID)
+	if err != nil {
+		cache.InvalidateAllReason(reason)
+		return
+	}
+	defer rows.Close()
+
+	var all []string
+	matched := false
+	for rows.Next() {
+		var devicePath string
+		var num *int64
+		if err := rows.Scan(&devicePath, &num); err != nil {
+			continue
+		}
+		all = append(all, devicePath)
+		if num != nil && int(*num) == driveNumber {
+			cache.InvalidateReason(devicePath, reason)
+			tape.SharedProbes().Invalidate(devicePath)
+			matched = true
+		}
+	}
+	if matched {
+		return
+	}
+	if len(all) == 0 {
+		// No drives are linked to this library; we cannot tell which
+		// device changed, so drop everything rather than serve stale labels.
+		cache.InvalidateAllReason(reason)
+		return
+	}
+	for _, devicePath := range all {
+		cache.InvalidateReason(devicePath, reason)
+		tape.SharedProbes().Invalidate(devicePath)
+	}
+}
+
 // ─── LTFS Handlers ──────────────────────────────────────────────────────────
 
 // handleLTFSStatus returns the current LTFS status including availability,
@@ -8477,7 +11411,7 @@ func (s *Server) handleLTFSStatus(w http.ResponseWriter, r *http.Request) {
 
 		tapeSvc := tape.NewServiceForDevice(devicePath, 65536)
 		if vendor == "" {
-			if driveInfo, err := tapeSvc.GetDriveInfo(r.Context()); err == nil {
+			if driveInfo, err := tapeSvc.ProbeDriveInfo(r.Context()); err == nil {
 				if v, ok := driveInfo["Vendor identification"]; ok {
 					vendor = v
 				}
@@ -8519,13 +11453,13 @@ func (s *Server) handleLTFSFormat(w http.ResponseWriter, r *http.Request) {
 	s.ltfsFormat.mu.Lock()
 	if s.ltfsFormat.running {
 		s.ltfsFormat.mu.Unlock()
-		s.respondError(w, http.StatusConflict, "an LTFS format operation is already in progress")
+		s.respondErrorCode(w, http.StatusConflict, codeOperationInProgress, "an LTFS format operation is already in progress", nil)
 		return
 	}
 	s.ltfsFormat.mu.Unlock()
 
 	if !tape.IsAvailable() {
-		s.respondError(w, http.StatusServiceUnavailable, "LTFS software not installed")
+		s.respondErrorCode(w, http.StatusServiceUnavailable, codeNotConfigured, "LTFS software not installed", nil)
 		return
 	}
 
@@ -8539,7 +11473,7 @@ func (s *Server) handleLTFSFormat(w http.ResponseWriter, r *http.Request) {
 	// Re-check running under lock to prevent race between the earlier check and now.
 	if s.ltfsFormat.running {
 		s.ltfsFormat.mu.Unlock()
-		s.respondError(w, http.StatusConflict, "an LTFS format operation is already in progress")
+		s.respondErrorCode(w, http.StatusConflict, codeOperationInProgress, "an LTFS format operation is already in progress", nil)
 		return
 	}
 	ctx, cancel := context.WithCancel(context.Background())
@@ -8569,8 +11503,8 @@ func (s *Server) handleLTFSFormat(w http.ResponseWriter, r *http.Request) {
 		s.eventBus.Publish(SystemEvent{
 			Type:     "info",
 			Category: "ltfs",
-			Title:    "LTFS Format Started",
-			Message:  fmt.Sprintf("Formatting tape with LTFS on drive %s (label: %s) — this may take up to 2 hours", devicePath, req.Label),
+			Key:      "ltfs_format_started",
+			Args:     []interface{}{devicePath, req.Label},
 			Details:  map[string]interface{}{"drive_id": req.DriveID, "label": req.Label, "phase": "formatting"},
 		})
 	}
@@ -8618,8 +11552,8 @@ func (s *Server) runLTFSFormat(ctx context.Context, devicePath, mountPoint strin
 			s.eventBus.Publish(SystemEvent{
 				Type:     "info",
 				Category: "ltfs",
-				Title:    "LTFS Format Progress",
-				Message:  message,
+				Key:      "ltfs_format_progress",
+				Args:     []interface{}{message},
 				Details:  map[string]interface{}{"drive_id": driveID, "label": label, "phase": phase},
 			})
 		}
@@ -8636,8 +11570,8 @@ func (s *Server) runLTFSFormat(ctx context.Context, devicePath, mountPoint strin
 			s.eventBus.Publish(SystemEvent{
 				Type:     "error",
 				Category: "ltfs",
-				Title:    "LTFS Format Failed",
-				Message:  errMsg,
+				Key:      "ltfs_format_failed",
+				Args:     []interface{}{errMsg},
 				Details:  map[string]interface{}{"drive_id": driveID, "label": label, "phase": "failed"},
 			})
 		}
@@ -8717,8 +11651,8 @@ func (s *Server) runLTFSFormat(ctx context.Context, devicePath, mountPoint strin
 		s.eventBus.Publish(SystemEvent{
 			Type:     "success",
 			Category: "ltfs",
-			Title:    "LTFS Format Complete",
-			Message:  fmt.Sprintf("Tape formatted with LTFS on drive %s", devicePath),
+			Key:      "ltfs_format_complete",
+			Args:     []interface{}{devicePath},
 			Details:  map[string]interface{}{"drive_id": driveID, "label": label, "phase": "complete"},
 		})
 	}
@@ -8761,7 +11695,7 @@ func (s *Server) handleLTFSMount(w http.ResponseWriter, r *http.Request) {
 	}
 
 	if !tape.IsAvailable() {
-		s.respondError(w, http.StatusServiceUnavailable, "LTFS software not installed")
+		s.respondErrorCode(w, http.StatusServiceUnavailable, codeNotConfigured, "LTFS software not installed", nil)
 		return
 	}
 
@@ -8787,8 +11721,8 @@ func (s *Server) handleLTFSMount(w http.ResponseWriter, r *http.Request) {
 		s.eventBus.Publish(SystemEvent{
 			Type:     "info",
 			Category: "ltfs",
-			Title:    "LTFS Mount",
-			Message:  fmt.Sprintf("Mounting LTFS tape from drive %s at %s...", devicePath, mountPoint),
+			Key:      "ltfs_mount",
+			Args:     []interface{}{devicePath, mountPoint},
 		})
 	}
 
@@ -8801,8 +11735,8 @@ func (s *Server) handleLTFSMount(w http.ResponseWriter, r *http.Request) {
 		s.eventBus.Publish(SystemEvent{
 			Type:     "success",
 			Category: "ltfs",
-			Title:    "LTFS Mounted",
-			Message:  fmt.Sprintf("LTFS tape mounted at %s", mountPoint),
+			Key:      "ltfs_mounted",
+			Args:     []interface{}{mountPoint},
 		})
 	}
 
@@ -8816,7 +11750,7 @@ func (s *Server) handleLTFSMount(w http.ResponseWriter, r *http.Request) {
 // handleLTFSUnmount unmounts an LTFS tape.
 func (s *Server) handleLTFSUnmount(w http.ResponseWriter, r *http.Request) {
 	if !tape.IsAvailable() {
-		s.respondError(w, http.StatusServiceUnavailable, "LTFS software not installed")
+		s.respondErrorCode(w, http.StatusServiceUnavailable, codeNotConfigured, "LTFS software not installed", nil)
 		return
 	}
 
@@ -8836,8 +11770,8 @@ func (s *Server) handleLTFSUnmount(w http.ResponseWriter, r *http.Request) {
 		s.eventBus.Publish(SystemEvent{
 			Type:     "info",
 			Category: "ltfs",
-			Title:    "LTFS Unmount",
-			Message:  fmt.Sprintf("Unmounting LTFS tape from %s...", mountPoint),
+			Key:      "ltfs_unmount",
+			Args:     []interface{}{mountPoint},
 		})
 	}
 
@@ -8850,8 +11784,7 @@ func (s *Server) handleLTFSUnmount(w http.ResponseWriter, r *http.Request) {
 		s.eventBus.Publish(SystemEvent{
 			Type:     "success",
 			Category: "ltfs",
-			Title:    "LTFS Unmounted",
-			Message:  "LTFS tape safely unmounted",
+			Key:      "ltfs_unmounted",
 		})
 	}
 
@@ -8995,8 +11928,8 @@ func (s *Server) handleLTFSRestore(w http.ResponseWriter, r *http.Request) {
 		s.eventBus.Publish(SystemEvent{
 			Type:     "info",
 			Category: "ltfs",
-			Title:    "LTFS Restore Started",
-			Message:  msg,
+			Key:      "ltfs_restore_started",
+			Args:     []interface{}{msg},
 		})
 	}
 
@@ -9010,8 +11943,8 @@ func (s *Server) handleLTFSRestore(w http.ResponseWriter, r *http.Request) {
 		s.eventBus.Publish(SystemEvent{
 			Type:     "success",
 			Category: "ltfs",
-			Title:    "LTFS Restore Complete",
-			Message:  fmt.Sprintf("Restored %d files (%d bytes) to %s", fileCount, totalBytes, req.DestPath),
+			Key:      "ltfs_restore_complete",
+			Args:     []interface{}{fileCount, totalBytes, req.DestPath},
 		})
 	}
 
@@ -9035,7 +11968,7 @@ func (s *Server) handleLTFSCheck(w http.ResponseWriter, r *http.Request) {
 	}
 
 	if !tape.IsAvailable() {
-		s.respondError(w, http.StatusServiceUnavailable, "LTFS software not installed")
+		s.respondErrorCode(w, http.StatusServiceUnavailable, codeNotConfigured, "LTFS software not installed", nil)
 		return
 	}
 
@@ -0,0 +1,113 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/RoseOO/TapeBackarr/internal/backup"
+)
+
+// defaultRPOHours returns the RPO applied to sources without their own
+func (s *Server) defaultRPOHours() int {
+	if s.config == nil {
+		return 48
+	}
+	return s.config.SLO.DefaultRPOHours
+}
+
+// freshness reports backup freshness against the configured RPOs as of now
+func (s *Server) freshness() (*backup.FreshnessReport, error) {
+	if s.backupService == nil {
+		return nil, errors.New("backup service not available")
+	}
+	return s.backupService.Freshness(s.defaultRPOHours(), time.Now())
+}
+
+// handleSLO returns the freshness of every monitored source and job
+func (s *Server) handleSLO(w http.ResponseWriter, r *http.Request) {
+	report, err := s.freshness()
+	if err != nil {
+		s.respondError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	s.respondJSON(w, http.StatusOK, report)
+}
+
+// handleMetrics exposes backup freshness in the Prometheus text format
+func (s *Server) handleMetrics(w http.ResponseWriter, r *http.Request) {
+	report, err := s.freshness()
+	if err != nil {
+		s.respondError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte(formatFreshnessMetrics(report)))
+}
+
+// formatFreshnessMetrics renders a freshness report as Prometheus gauges.
+// Items that were never backed up have no timestamp or age sample.
+func formatFreshnessMetrics(report *backup.FreshnessReport) string {
+	var b strings.Builder
+
+	sourceLabels := func(f backup.Freshness) string {
+		return fmt.Sprintf(`source_id="%d",source="%s"`, f.ID, escapeLabel(f.Name))
+	}
+	jobLabels := func(f backup.Freshness) string {
+		return fmt.Sprintf(`job_id="%d",job="%s",source="%s"`, f.ID, escapeLabel(f.Name), escapeLabel(f.SourceName))
+	}
+
+	write := func(kind string, items []backup.Freshness, labels func(backup.Freshness) string) {
+		gauge := func(name, help string, value func(backup.Freshness) (float64, bool)) {
+			name = "tapebackarr_" + kind + "_" + name
+			fmt.Fprintf(&b, "# HELP %s %s\n# TYPE %s gauge\n", name, help, name)
+			for _, f := range items {
+				if v, ok := value(f); ok {
+					fmt.Fprintf(&b, "%s{%s} %s\n", name, labels(f), strconv.FormatFloat(v, 'f', -1, 64))
+				}
+			}
+		}
+		gauge("last_success_timestamp_seconds", "Unix time of the newest successful backup of the "+kind+".",
+			func(f backup.Freshness) (float64, bool) {
+				if f.LastSuccess == nil {
+					return 0, false
+				}
+				return float64(f.LastSuccess.Unix()), true
+			})
+		gauge("backup_age_seconds", "Seconds since the newest successful backup of the "+kind+".",
+			func(f backup.Freshness) (float64, bool) {
+				if f.AgeSeconds == nil {
+					return 0, false
+				}
+				return float64(int64(*f.AgeSeconds)), true
+			})
+		gauge("rpo_seconds", "Recovery point objective of the "+kind+"; 0 means not checked.",
+			func(f backup.Freshness) (float64, bool) {
+				return float64(f.RPOHours) * 3600, true
+			})
+		gauge("rpo_violation", "1 if the "+kind+" has no successful backup within its RPO.",
+			func(f backup.Freshness) (float64, bool) {
+				if f.Violation {
+					return 1, true
+				}
+				return 0, true
+			})
+	}
+	write("source", report.Sources, sourceLabels)
+	write("job", report.Jobs, jobLabels)
+
+	b.WriteString("# HELP tapebackarr_rpo_violations Number of sources and jobs outside their RPO.\n")
+	b.WriteString("# TYPE tapebackarr_rpo_violations gauge\n")
+	fmt.Fprintf(&b, "tapebackarr_rpo_violations{kind=\"source\"} %d\n", report.SourceViolations)
+	fmt.Fprintf(&b, "tapebackarr_rpo_violations{kind=\"job\"} %d\n", report.JobViolations)
+	return b.String()
+}
+
+// escapeLabel escapes a Prometheus label value
+func escapeLabel(v string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(v)
+}
@@ -0,0 +1,297 @@
+package api
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/RoseOO/TapeBackarr/internal/backup"
+)
+
+// snapshotSummary describes a stored file snapshot without its file list
+type snapshotSummary struct {
+	ID          int64     `json:"id"`
+	BackupSetID *int64    `json:"backup_set_id"`
+	CreatedAt   time.Time `json:"created_at"`
+	FileCount   int64     `json:"file_count"`
+	TotalBytes  int64     `json:"total_bytes"`
+	DataBytes   int64     `json:"data_bytes"`
+	Pinned      bool      `json:"pinned"`
+	Current     bool      `json:"current"`
+}
+
+// jobSnapshotSource returns the source of a job and the snapshot its next
+// incremental run will compare against (0 when there is none).
+func (s *Server) jobSnapshotSource(jobID int64) (sourceID int64, sourcePath string, currentID int64, err error) {
+	err = s.db.QueryRow(`
+		SELECT j.source_id, s.path FROM backup_jobs j
+		JOIN backup_sources s ON j.source_id = s.id
+		WHERE j.id = ?
+	`, jobID).Scan(&sourceID, &sourcePath)
+	if err != nil {
+		return 0, "", 0, err
+	}
+	err = s.db.QueryRow(`
+		SELECT id FROM snapshots WHERE source_id = ? ORDER BY created_at DESC LIMIT 1
+	`, sourceID).Scan(&currentID)
+	if err == sql.ErrNoRows {
+		err = nil
+	}
+	return sourceID, sourcePath, currentID, err
+}
+
+// getJobSnapshot loads a snapshot summary, checking it belongs to the job
+func (s *Server) getJobSnapshot(jobID, snapshotID int64) (*snapshotSummary, error) {
+	var sn snapshotSummary
+	err := s.db.QueryRow(`
+		SELECT sn.id, sn.backup_set_id, sn.created_at, sn.file_count, sn.total_bytes,
+		       COALESCE(LENGTH(sn.snapshot_data), 0), sn.pinned
+		FROM snapshots sn
+		JOIN backup_sets bs ON sn.backup_set_id = bs.id
+		WHERE sn.id = ? AND bs.job_id = ?
+	`, snapshotID, jobID).Scan(&sn.ID, &sn.BackupSetID, &sn.CreatedAt, &sn.FileCount, &sn.TotalBytes,
+		&sn.DataBytes, &sn.Pinned)
+	if err != nil {
+		return nil, err
+	}
+	return &sn, nil
+}
+
+func (s *Server) snapshotParams(w http.ResponseWriter, r *http.Request) (jobID, snapshotID int64, ok bool) {
+	jobID, err := s.getIDParam(r)
+	if err != nil {
+		s.respondError(w, http.StatusBadRequest, "invalid job id")
+		return 0, 0, false
+	}
+	snapshotID, err = strconv.ParseInt(chi.URLParam(r, "snapshotId"), 10, 64)
+	if err != nil {
+		s.respondError(w, http.StatusBadRequest, "invalid snapshot id")
+		return 0, 0, false
+	}
+	return jobID, snapshotID, true
+}
+
+// handleListJobSnapshots lists the file snapshots stored for a job's runs,
+// newest first, marking the one the next incremental run compares against.
+func (s *Server) handleListJobSnapshots(w http.ResponseWriter, r *http.Request) {
+	id, err := s.getIDParam(r)
+	if err != nil {
+		s.respondError(w, http.StatusBadRequest, "invalid job id")
+		return
+	}
+
+	var retention int
+	if err := s.db.QueryRow("SELECT COALESCE(snapshot_retention, 0) FROM backup_jobs WHERE id = ?", id).Scan(&retention); err != nil {
+		s.respondError(w, http.StatusNotFound, "job not found")
+		return
+	}
+	_, _, currentID, err := s.jobSnapshotSource(id)
+	if err != nil {
+		s.respondError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	rows, err := s.db.Query(`
+		SELECT sn.id, sn.backup_set_id, sn.created_at, sn.file_count, sn.total_bytes,
+		       COALESCE(LENGTH(sn.snapshot_data), 0), sn.pinned
+		FROM snapshots sn
+		JOIN backup_sets bs ON sn.backup_set_id = bs.id
+		WHERE bs.job_id = ?
+		ORDER BY sn.created_at DESC, sn.id DESC
+	`, id)
+	if err != nil {
+		s.respondError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	defer rows.Close()
+
+	snapshots := []snapshotSummary{}
+	for rows.Next() {
+		var sn snapshotSummary
+		if err := rows.Scan(&sn.ID, &sn.BackupSetID, &sn.CreatedAt, &sn.FileCount, &sn.TotalBytes,
+			&sn.DataBytes, &sn.Pinned); err != nil {
+			continue
+		}
+		sn.Current = sn.ID == currentID
+		snapshots = append(snapshots, sn)
+	}
+
+	s.respondJSON(w, http.StatusOK, map[string]interface{}{
+		"job_id":             id,
+		"snapshot_retention": retention,
+		"snapshots":          snapshots,
+	})
+}
+
+// handleGetJobSnapshot returns a snapshot's summary and, with files=true,
+// its file list filtered by an optional path prefix.
+func (s *Server) handleGetJobSnapshot(w http.ResponseWriter, r *http.Request) {
+	jobID, snapshotID, ok := s.snapshotParams(w, r)
+	if !ok {
+		return
+	}
+	sn, err := s.getJobSnapshot(jobID, snapshotID)
+	if err != nil {
+		s.respondError(w, http.StatusNotFound, "snapshot not found")
+		return
+	}
+	_, _, currentID, _ := s.jobSnapshotSource(jobID)
+	sn.Current = sn.ID == currentID
+
+	resp := map[string]interface{}{"snapshot": sn}
+	if r.URL.Query().Get("files") != "true" {
+		s.respondJSON(w, http.StatusOK, resp)
+		return
+	}
+
+	limit := 1000
+	if l := r.URL.Query().Get("limit"); l != "" {
+		parsed, err := strconv.Atoi(l)
+		if err != nil || parsed < 1 || parsed > 10000 {
+			s.respondError(w, http.StatusBadRequest, "limit must be between 1 and 10000")
+			return
+		}
+		limit = parsed
+	}
+	prefix := r.URL.Query().Get("prefix")
+
+	var data []byte
+	if err := s.db.QueryRow("SELECT snapshot_data FROM snapshots WHERE id = ?", snapshotID).Scan(&data); err != nil {
+		s.respondError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	var files []backup.FileInfo
+	if len(data) > 0 {
+		if err := json.Unmarshal(data, &files); err != nil {
+			s.respondError(w, http.StatusUnprocessableEntity, "snapshot data is unreadable: "+err.Error())
+			return
+		}
+	}
+
+	matched := []backup.FileInfo{}
+	total := 0
+	for _, f := range files {
+		if prefix != "" && !strings.HasPrefix(f.Path, prefix) {
+			continue
+		}
+		total++
+		if len(matched) < limit {
+			matched = append(matched, f)
+		}
+	}
+	resp["files"] = matched
+	resp["matched"] = total
+	resp["truncated"] = total > len(matched)
+	s.respondJSON(w, http.StatusOK, resp)
+}
+
+// handleDeleteJobSnapshot deletes a snapshot. Pinned snapshots must be
+// unpinned first.
+func (s *Server) handleDeleteJobSnapshot(w http.ResponseWriter, r *http.Request) {
+	jobID, snapshotID, ok := s.snapshotParams(w, r)
+	if !ok {
+		return
+	}
+	sn, err := s.getJobSnapshot(jobID, snapshotID)
+	if err != nil {
+		s.respondError(w, http.StatusNotFound, "snapshot not found")
+		return
+	}
+	if sn.Pinned {
+		s.respondError(w, http.StatusConflict, "snapshot is pinned; unpin it before deleting")
+		return
+	}
+
+	if _, err := s.db.Exec("DELETE FROM snapshots WHERE id = ?", snapshotID); err != nil {
+		s.respondError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	s.auditLog(r, "delete", "snapshot", snapshotID, fmt.Sprintf("Deleted snapshot of job %d (%d files)", jobID, sn.FileCount))
+	s.respondJSON(w, http.StatusOK, map[string]string{"status": "deleted"})
+}
+
+// handlePinJobSnapshot pins or unpins a snapshot. Pinned snapshots are kept
+// regardless of the job's snapshot retention.
+func (s *Server) handlePinJobSnapshot(w http.ResponseWriter, r *http.Request) {
+	jobID, snapshotID, ok := s.snapshotParams(w, r)
+	if !ok {
+		return
+	}
+	var req struct {
+		Pinned *bool `json:"pinned"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Pinned == nil {
+		s.respondError(w, http.StatusBadRequest, "pinned is required")
+		return
+	}
+	if _, err := s.getJobSnapshot(jobID, snapshotID); err != nil {
+		s.respondError(w, http.StatusNotFound, "snapshot not found")
+		return
+	}
+
+	if _, err := s.db.Exec("UPDATE snapshots SET pinned = ? WHERE id = ?", *req.Pinned, snapshotID); err != nil {
+		s.respondError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	action, details := "unpin", fmt.Sprintf("Unpinned snapshot of job %d", jobID)
+	if *req.Pinned {
+		action, details = "pin", fmt.Sprintf("Pinned snapshot of job %d", jobID)
+	}
+	s.auditLog(r, action, "snapshot", snapshotID, details)
+	s.respondJSON(w, http.StatusOK, map[string]interface{}{"id": snapshotID, "pinned": *req.Pinned})
+}
+
+// handleRebuildJobSnapshot rebuilds a job's snapshot from the catalog of its
+// latest backup chain and stores it as the current snapshot, so the next
+// incremental run does not fall back to a full backup after the snapshot
+// blob was lost.
+func (s *Server) handleRebuildJobSnapshot(w http.ResponseWriter, r *http.Request) {
+	id, err := s.getIDParam(r)
+	if err != nil {
+		s.respondError(w, http.StatusBadRequest, "invalid job id")
+		return
+	}
+	if s.isJobRunning(id) {
+		s.respondErrorCode(w, http.StatusConflict, codeJobRunning, "job is currently running", nil)
+		return
+	}
+	sourceID, sourcePath, _, err := s.jobSnapshotSource(id)
+	if err != nil {
+		s.respondError(w, http.StatusNotFound, "job not found")
+		return
+	}
+
+	files, setID, err := s.backupService.SnapshotFromCatalog(r.Context(), id, sourcePath)
+	if errors.Is(err, backup.ErrNoCatalogChain) {
+		s.respondError(w, http.StatusConflict, err.Error())
+		return
+	}
+	if err != nil {
+		s.respondError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	snapshotID, err := s.backupService.SaveSnapshot(sourceID, setID, files)
+	if err != nil {
+		s.respondError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	s.auditLog(r, "rebuild", "snapshot", snapshotID, fmt.Sprintf("Rebuilt snapshot of job %d from catalog up to backup set %d (%d files)", id, setID, len(files)))
+
+	sn, err := s.getJobSnapshot(id, snapshotID)
+	if err != nil {
+		s.respondError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	sn.Current = true
+	s.respondJSON(w, http.StatusCreated, sn)
+}
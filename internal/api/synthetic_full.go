@@ -0,0 +1,243 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/RoseOO/TapeBackarr/internal/auth"
+	"github.com/RoseOO/TapeBackarr/internal/backup"
+)
+
+// syntheticFullState tracks a running synthetic full backup.
+type syntheticFullState struct {
+	mu       sync.Mutex
+	running  bool
+	cancel   context.CancelFunc
+	plan     *backup.SyntheticPlan
+	message  string
+	waiting  string // label of the source tape waiting to be loaded
+	err      string
+	started  time.Time
+	finished time.Time
+}
+
+// syntheticFullRequest names the tape a synthetic full is written to and,
+// to run it, the drives to read the chain and write the full in
+type syntheticFullRequest struct {
+	TargetTapeID  int64 `json:"target_tape_id"`
+	SourceDriveID int64 `json:"source_drive_id"`
+	TargetDriveID int64 `json:"target_drive_id"`
+}
+
+// planSyntheticFull decodes a synthetic full request for the job in the URL
+// and plans it, writing the error response itself when that fails
+func (s *Server) planSyntheticFull(w http.ResponseWriter, r *http.Request) (*syntheticFullRequest, *backup.SyntheticPlan, bool) {
+	jobID, err := s.getIDParam(r)
+	if err != nil {
+		s.respondError(w, http.StatusBadRequest, "invalid job id")
+		return nil, nil, false
+	}
+	var req syntheticFullRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		s.respondError(w, http.StatusBadRequest, "invalid request body")
+		return nil, nil, false
+	}
+	if req.TargetTapeID == 0 {
+		s.respondError(w, http.StatusBadRequest, "target_tape_id is required")
+		return nil, nil, false
+	}
+	plan, err := s.backupService.PlanSyntheticFull(jobID, req.TargetTapeID)
+	if errors.Is(err, backup.ErrInvalidSynthetic) {
+		s.respondError(w, http.StatusBadRequest, err.Error())
+		return nil, nil, false
+	}
+	if err != nil {
+		s.respondError(w, http.StatusInternalServerError, err.Error())
+		return nil, nil, false
+	}
+	return &req, plan, true
+}
+
+// handlePlanSyntheticFull shows which sets of a job's chain a synthetic full
+// would be read from, without touching any tape
+func (s *Server) handlePlanSyntheticFull(w http.ResponseWriter, r *http.Request) {
+	_, plan, ok := s.planSyntheticFull(w, r)
+	if !ok {
+		return
+	}
+	s.respondJSON(w, http.StatusOK, plan)
+}
+
+// handleStartSyntheticFull writes a synthetic full backup of a job onto a
+// blank target tape in the background. The chain is read from the source
+// drive, and the operator is asked to load each of its tapes in turn.
+func (s *Server) handleStartSyntheticFull(w http.ResponseWriter, r *http.Request) {
+	req, plan, ok := s.planSyntheticFull(w, r)
+	if !ok {
+		return
+	}
+	if req.SourceDriveID == 0 || req.TargetDriveID == 0 || req.SourceDriveID == req.TargetDriveID {
+		s.respondError(w, http.StatusBadRequest, "source_drive_id and target_drive_id must name two different drives")
+		return
+	}
+	source, err := s.rebuildDrive(req.SourceDriveID)
+	if err != nil {
+		s.respondError(w, http.StatusBadRequest, "source drive not found or not enabled")
+		return
+	}
+	target, err := s.rebuildDrive(req.TargetDriveID)
+	if err != nil {
+		s.respondError(w, http.StatusBadRequest, "target drive not found or not enabled")
+		return
+	}
+	var sourceDriveName string
+	s.db.QueryRow("SELECT COALESCE(display_name, device_path) FROM tape_drives WHERE id = ?", req.SourceDriveID).Scan(&sourceDriveName)
+
+	s.syntheticFull.mu.Lock()
+	if s.syntheticFull.running {
+		s.syntheticFull.mu.Unlock()
+		s.respondErrorCode(w, http.StatusConflict, codeOperationInProgress, "a synthetic full backup is already running", nil)
+		return
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	s.syntheticFull.running = true
+	s.syntheticFull.cancel = cancel
+	s.syntheticFull.plan = plan
+	s.syntheticFull.message = "Starting synthetic full backup..."
+	s.syntheticFull.waiting = ""
+	s.syntheticFull.err = ""
+	s.syntheticFull.started = time.Now()
+	s.syntheticFull.finished = time.Time{}
+	s.syntheticFull.mu.Unlock()
+
+	claims, _ := r.Context().Value("claims").(*auth.Claims)
+	ipAddress := clientIP(r)
+	driveIDs := []int64{req.SourceDriveID, req.TargetDriveID}
+	for _, id := range driveIDs {
+		s.db.Exec("UPDATE tape_drives SET status = 'busy' WHERE id = ?", id)
+	}
+
+	progress := func(message string) {
+		s.syntheticFull.mu.Lock()
+		s.syntheticFull.message = message
+		s.syntheticFull.mu.Unlock()
+	}
+	load := func(ctx context.Context, set *backup.SyntheticSet) error {
+		err := waitForOperatorLoad(ctx, source, set.TapeLabel, set.TapeUUID, sourceDriveName, func() {
+			s.syntheticFull.mu.Lock()
+			s.syntheticFull.waiting = set.TapeLabel
+			s.syntheticFull.message = fmt.Sprintf("Waiting for tape %s to be loaded into %s", set.TapeLabel, sourceDriveName)
+			s.syntheticFull.mu.Unlock()
+			if s.eventBus != nil {
+				s.eventBus.Publish(SystemEvent{
+					Type:     "warning",
+					Category: "tape",
+					Key:      "synthetic_full_load_tape",
+					Args:     []interface{}{set.TapeLabel, sourceDriveName, plan.JobName},
+				})
+			}
+		})
+		s.syntheticFull.mu.Lock()
+		s.syntheticFull.waiting = ""
+		s.syntheticFull.mu.Unlock()
+		return err
+	}
+
+	// Respond before the run starts filling in the plan
+	s.respondJSON(w, http.StatusAccepted, map[string]interface{}{
+		"status":  "started",
+		"plan":    plan,
+		"message": fmt.Sprintf("Synthetic full backup of %s onto %s started", plan.JobName, plan.TargetLabel),
+	})
+
+	go func() {
+		err := s.backupService.SynthesizeFull(ctx, plan, source, target, load, progress)
+		cancel()
+		for _, id := range driveIDs {
+			s.db.Exec("UPDATE tape_drives SET status = 'ready' WHERE id = ?", id)
+		}
+		s.tapeService.GetLabelCache().InvalidateAllReason("synthetic_full")
+
+		s.syntheticFull.mu.Lock()
+		s.syntheticFull.running = false
+		s.syntheticFull.cancel = nil
+		s.syntheticFull.waiting = ""
+		s.syntheticFull.finished = time.Now()
+		if err != nil {
+			s.syntheticFull.err = err.Error()
+			s.syntheticFull.message = "Synthetic full backup failed: " + err.Error()
+		} else {
+			s.syntheticFull.message = fmt.Sprintf("Synthesized a full backup of %s with %d files onto %s", plan.JobName, plan.FileCount, plan.TargetLabel)
+		}
+		s.syntheticFull.mu.Unlock()
+
+		if err != nil {
+			if s.logger != nil {
+				s.logger.Error("Synthetic full backup failed", map[string]interface{}{"job": plan.JobName, "target": plan.TargetLabel, "error": err.Error()})
+			}
+			if s.eventBus != nil {
+				s.eventBus.Publish(SystemEvent{
+					Type:     "error",
+					Category: "backup",
+					Key:      "synthetic_full_failed",
+					Args:     []interface{}{plan.JobName, plan.TargetLabel, err.Error()},
+				})
+			}
+			return
+		}
+		s.auditLogDirect(claims, ipAddress, "synthesize", "backup_job", plan.JobID,
+			fmt.Sprintf("Synthesized a full backup of %s from %d backup sets onto %s as backup set %d",
+				plan.JobName, len(plan.Chain), plan.TargetLabel, plan.NewBackupSetID))
+		if s.eventBus != nil {
+			s.eventBus.Publish(SystemEvent{
+				Type:     "success",
+				Category: "backup",
+				Key:      "synthetic_full_completed",
+				Args:     []interface{}{plan.JobName, plan.TargetLabel, plan.FileCount, len(plan.Chain)},
+				Details:  map[string]interface{}{"job_id": plan.JobID, "backup_set_id": plan.NewBackupSetID},
+			})
+		}
+	}()
+}
+
+// handleSyntheticFullStatus returns the progress of the current or most
+// recent synthetic full backup
+func (s *Server) handleSyntheticFullStatus(w http.ResponseWriter, r *http.Request) {
+	s.syntheticFull.mu.Lock()
+	status := map[string]interface{}{
+		"running": s.syntheticFull.running,
+		"message": s.syntheticFull.message,
+		"waiting": s.syntheticFull.waiting,
+		"error":   s.syntheticFull.err,
+	}
+	if !s.syntheticFull.running {
+		status["plan"] = s.syntheticFull.plan
+	}
+	if !s.syntheticFull.started.IsZero() {
+		status["started"] = s.syntheticFull.started.Format(time.RFC3339)
+	}
+	if !s.syntheticFull.finished.IsZero() {
+		status["finished"] = s.syntheticFull.finished.Format(time.RFC3339)
+	}
+	s.syntheticFull.mu.Unlock()
+	s.respondJSON(w, http.StatusOK, status)
+}
+
+// handleCancelSyntheticFull stops a running synthetic full backup. Nothing
+// is recorded until the whole full has been written, so a cancelled run
+// leaves the catalog as it was.
+func (s *Server) handleCancelSyntheticFull(w http.ResponseWriter, r *http.Request) {
+	s.syntheticFull.mu.Lock()
+	defer s.syntheticFull.mu.Unlock()
+	if !s.syntheticFull.running || s.syntheticFull.cancel == nil {
+		s.respondError(w, http.StatusBadRequest, "no synthetic full backup is running")
+		return
+	}
+	s.syntheticFull.cancel()
+	s.respondJSON(w, http.StatusOK, map[string]string{"status": "cancelling"})
+}
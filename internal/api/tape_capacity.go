@@ -0,0 +1,63 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/RoseOO/TapeBackarr/internal/backup"
+)
+
+// handleReadTapeCapacity reads the remaining capacity the drive reports for
+// the tape loaded in it and stores it next to the logical figure. Backups
+// do this after every write; this refreshes it on demand.
+func (s *Server) handleReadTapeCapacity(w http.ResponseWriter, r *http.Request) {
+	driveID, err := s.getIDParam(r)
+	if err != nil {
+		s.respondError(w, http.StatusBadRequest, "invalid drive id")
+		return
+	}
+
+	var status string
+	if err := s.db.QueryRow("SELECT COALESCE(status, '') FROM tape_drives WHERE id = ? AND enabled = 1", driveID).Scan(&status); err != nil {
+		s.respondError(w, http.StatusNotFound, "drive not found or not enabled")
+		return
+	}
+	if status == "busy" {
+		s.respondErrorCode(w, http.StatusConflict, codeDriveBusy, "drive is busy", nil)
+		return
+	}
+	driveSvc, err := s.rebuildDrive(driveID)
+	if err != nil {
+		s.respondError(w, http.StatusNotFound, "drive not found or not enabled")
+		return
+	}
+
+	label, err := driveSvc.ReadTapeLabel(r.Context())
+	if err != nil || label == nil {
+		s.respondError(w, http.StatusBadRequest, "no labeled tape in the drive")
+		return
+	}
+	var tapeID int64
+	if err := s.db.QueryRow("SELECT id FROM tapes WHERE uuid = ?", label.UUID).Scan(&tapeID); err != nil {
+		s.respondError(w, http.StatusNotFound, "the tape in the drive is not in the database")
+		return
+	}
+
+	reading, err := s.backupService.RecordDriveCapacity(r.Context(), tapeID, driveSvc)
+	if err != nil {
+		s.respondError(w, http.StatusInternalServerError, "failed to read remaining capacity: "+err.Error())
+		return
+	}
+	if reading == nil {
+		s.respondJSON(w, http.StatusOK, map[string]interface{}{
+			"tape_id":  tapeID,
+			"label":    label.Label,
+			"reported": false,
+			"message":  "the drive does not report remaining capacity (sg_logs is needed on physical drives)",
+		})
+		return
+	}
+	s.respondJSON(w, http.StatusOK, struct {
+		Reported bool `json:"reported"`
+		*backup.CapacityReading
+	}{true, reading})
+}
@@ -0,0 +1,82 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/RoseOO/TapeBackarr/internal/library"
+)
+
+// tapeLocateTimeout bounds the changer move of a locate
+const tapeLocateTimeout = 5 * time.Minute
+
+// handleLocateTape reports the library element holding a tape, and with
+// move_to_ie moves the tape to an import/export slot so an operator can
+// pick it out of the library
+func (s *Server) handleLocateTape(w http.ResponseWriter, r *http.Request) {
+	id, err := s.getIDParam(r)
+	if err != nil {
+		s.respondError(w, http.StatusBadRequest, "invalid tape id")
+		return
+	}
+
+	var req struct {
+		MoveToIE bool `json:"move_to_ie"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && !errors.Is(err, io.EOF) {
+		s.respondError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+
+	var label string
+	if err := s.db.QueryRow("SELECT label FROM tapes WHERE id = ?", id).Scan(&label); err != nil {
+		s.respondError(w, http.StatusNotFound, "tape not found")
+		return
+	}
+	if req.MoveToIE {
+		// A tape a job has selected must stay where the job will load it from
+		var reserved bool
+		s.db.QueryRow("SELECT COUNT(*) > 0 FROM tape_reservations WHERE tape_id = ? AND expires_at > datetime('now')", id).Scan(&reserved)
+		if reserved {
+			s.respondError(w, http.StatusConflict, "tape is reserved by a job")
+			return
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), tapeLocateTimeout)
+	defer cancel()
+	loc, err := s.library.Locate(ctx, id, req.MoveToIE)
+	switch {
+	case errors.Is(err, library.ErrNotInLibrary):
+		s.respondError(w, http.StatusNotFound, "tape is not in a library")
+		return
+	case errors.Is(err, library.ErrNoFreeIESlot):
+		s.respondError(w, http.StatusConflict, "every import/export slot of the library is full")
+		return
+	case errors.Is(err, library.ErrUnavailable):
+		s.respondError(w, http.StatusServiceUnavailable, err.Error())
+		return
+	case err != nil:
+		s.respondError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	if loc.MovedFrom != nil {
+		s.auditLog(r, "locate", "tape", id, fmt.Sprintf("Moved tape %s from %s to %s of library %s", label, loc.MovedFrom, loc.Element, loc.LibraryName))
+		if s.eventBus != nil {
+			s.eventBus.Publish(SystemEvent{
+				Type:     "info",
+				Category: "tape",
+				Key:      "library_tape_moved_to_ie",
+				Args:     []interface{}{label, loc.Element.Number, loc.LibraryName},
+				Details:  map[string]interface{}{"tape_id": id, "library_id": loc.LibraryID, "from": loc.MovedFrom, "to": loc.Element},
+			})
+		}
+	}
+	s.respondJSON(w, http.StatusOK, loc)
+}
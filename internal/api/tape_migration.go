@@ -0,0 +1,373 @@
+package api
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/RoseOO/TapeBackarr/internal/auth"
+	"github.com/RoseOO/TapeBackarr/internal/models"
+	"github.com/RoseOO/TapeBackarr/internal/tape"
+)
+
+// Relabel outcomes of a pool migration
+const (
+	relabelDone    = "done"    // the label now names the new pool
+	relabelPending = "pending" // the tape holds data; rewritten when next labelled
+	relabelSkipped = "skipped" // not requested, or an LTFS tape
+	relabelNow     = "now"     // planned: the label will be rewritten by the migration
+)
+
+// tapeMigrationCheck is what moving a tape to another pool involves.
+// Conflicts are policy mismatches that must be accepted with force;
+// warnings are only reported.
+type tapeMigrationCheck struct {
+	TapeID     int64    `json:"tape_id"`
+	TapeLabel  string   `json:"tape_label"`
+	FromPoolID *int64   `json:"from_pool_id,omitempty"`
+	FromPool   string   `json:"from_pool"`
+	ToPoolID   int64    `json:"to_pool_id"`
+	ToPool     string   `json:"to_pool"`
+	HasData    bool     `json:"has_data"`
+	Relabel    string   `json:"relabel"`
+	Conflicts  []string `json:"conflicts"`
+	Warnings   []string `json:"warnings"`
+
+	uuid        string
+	fingerprint string
+	compression string
+}
+
+// tapeMigration is a recorded move of a tape between pools
+type tapeMigration struct {
+	ID            int64     `json:"id"`
+	TapeID        int64     `json:"tape_id"`
+	FromPoolID    *int64    `json:"from_pool_id,omitempty"`
+	FromPool      string    `json:"from_pool"`
+	ToPoolID      int64     `json:"to_pool_id"`
+	ToPool        string    `json:"to_pool"`
+	RelabelStatus string    `json:"relabel_status"`
+	Warnings      []string  `json:"warnings"`
+	MigratedBy    *int64    `json:"migrated_by,omitempty"`
+	CreatedAt     time.Time `json:"created_at"`
+}
+
+// migrationError is a check failure that cannot be overridden with force
+type migrationError struct {
+	status  int
+	message string
+}
+
+func (e *migrationError) Error() string { return e.message }
+
+// checkTapeMigration works out what moving a tape to a pool involves. The
+// backup sets and catalog of the tape move with it, so the checks are about
+// the policies the tape's data and future writes fall under.
+func (s *Server) checkTapeMigration(tapeID, toPoolID int64, relabel bool) (*tapeMigrationCheck, error) {
+	c := &tapeMigrationCheck{TapeID: tapeID, ToPoolID: toPoolID, Conflicts: []string{}, Warnings: []string{}}
+	var status, formatType string
+	var usedBytes int64
+	var fromPoolID sql.NullInt64
+	err := s.db.QueryRow(`
+		SELECT label, uuid, pool_id, status, used_bytes, COALESCE(format_type, 'raw'), COALESCE(encryption_key_fingerprint, '')
+		FROM tapes WHERE id = ?
+	`, tapeID).Scan(&c.TapeLabel, &c.uuid, &fromPoolID, &status, &usedBytes, &formatType, &c.fingerprint)
+	if err != nil {
+		return nil, &migrationError{http.StatusNotFound, "tape not found"}
+	}
+
+	var toRetention int
+	if err := s.db.QueryRow("SELECT name, retention_days FROM tape_pools WHERE id = ?", toPoolID).Scan(&c.ToPool, &toRetention); err != nil {
+		return nil, &migrationError{http.StatusBadRequest, "target pool not found"}
+	}
+	fromRetention := 0
+	if fromPoolID.Valid {
+		if fromPoolID.Int64 == toPoolID {
+			return nil, &migrationError{http.StatusBadRequest, "tape is already in pool " + c.ToPool}
+		}
+		c.FromPoolID = &fromPoolID.Int64
+		s.db.QueryRow("SELECT name, retention_days FROM tape_pools WHERE id = ?", fromPoolID.Int64).Scan(&c.FromPool, &fromRetention)
+	}
+
+	var running int
+	s.db.QueryRow("SELECT COUNT(*) FROM backup_sets WHERE tape_id = ? AND status IN ('pending', 'running')", tapeID).Scan(&running)
+	if running > 0 {
+		return nil, &migrationError{http.StatusConflict, "a backup is writing to the tape"}
+	}
+
+	var sets int
+	s.db.QueryRow("SELECT COUNT(*) FROM backup_sets WHERE tape_id = ?", tapeID).Scan(&sets)
+	c.HasData = usedBytes > 0 || sets > 0 || (status != string(models.TapeStatusBlank) && status != string(models.TapeStatusRetired))
+
+	switch {
+	case !relabel:
+		c.Relabel = relabelSkipped
+	case formatType == string(models.TapeFormatLTFS):
+		c.Relabel = relabelSkipped
+		c.Warnings = append(c.Warnings, "the label of an LTFS tape is not rewritten; it keeps naming pool "+c.FromPool)
+	case c.HasData:
+		c.Relabel = relabelPending
+		c.Warnings = append(c.Warnings, "the tape holds data, and rewriting its label would end the tape after it; the label keeps naming pool "+c.FromPool+" until the tape is next labelled")
+	default:
+		c.Relabel = relabelNow
+	}
+
+	if c.HasData && toRetention > 0 && (fromRetention == 0 || toRetention < fromRetention) {
+		from := "indefinitely"
+		if fromRetention > 0 {
+			from = fmt.Sprintf("%d days", fromRetention)
+		}
+		c.Conflicts = append(c.Conflicts, fmt.Sprintf("pool %s keeps tapes for %d days, while pool %s keeps them %s", c.ToPool, toRetention, c.FromPool, from))
+	}
+
+	// Only an appendable tape receives data from the jobs of its new pool
+	if status == string(models.TapeStatusActive) {
+		rows, err := s.db.Query(`
+			SELECT j.name, COALESCE(k.key_fingerprint, '')
+			FROM backup_jobs j
+			JOIN encryption_keys k ON k.id = CASE WHEN j.encryption_enabled = 1 THEN j.encryption_key_id ELSE j.hw_encryption_key_id END
+			WHERE j.pool_id = ? AND j.enabled = 1 AND j.ad_hoc = 0
+			  AND (j.encryption_enabled = 1 OR COALESCE(j.hw_encryption_enabled, 0) = 1)
+			ORDER BY j.name
+		`, toPoolID)
+		if err != nil {
+			return nil, err
+		}
+		for rows.Next() {
+			var job, fingerprint string
+			if err := rows.Scan(&job, &fingerprint); err != nil {
+				continue
+			}
+			switch {
+			case c.fingerprint != "" && fingerprint != c.fingerprint:
+				c.Conflicts = append(c.Conflicts, fmt.Sprintf("job %s of pool %s encrypts with key %s, but the tape holds data encrypted with key %s", job, c.ToPool, fingerprint, c.fingerprint))
+			case c.fingerprint == "" && c.HasData:
+				c.Warnings = append(c.Warnings, fmt.Sprintf("job %s of pool %s would append encrypted data to a tape holding unencrypted data", job, c.ToPool))
+			}
+		}
+		rows.Close()
+	}
+
+	var otherTapes int
+	s.db.QueryRow(`
+		SELECT COUNT(DISTINCT t.id) FROM tape_spanning_members m
+		JOIN tape_spanning_members o ON o.spanning_set_id = m.spanning_set_id AND o.tape_id != m.tape_id
+		JOIN tapes t ON t.id = o.tape_id
+		WHERE m.tape_id = ? AND COALESCE(t.pool_id, 0) != ?
+	`, tapeID, toPoolID).Scan(&otherTapes)
+	if otherTapes > 0 {
+		c.Warnings = append(c.Warnings, fmt.Sprintf("the tape is part of a backup spanning %d tapes that stay in other pools", otherTapes))
+	}
+	return c, nil
+}
+
+// handleMigrateTape moves a tape to another pool. The policies of the new
+// pool are checked against the tape first; conflicts stop the move unless
+// force is set. With dry_run only the check is returned. The pool name in
+// the on-tape label is rewritten when the tape holds no data yet; the tape
+// must then be in a drive.
+func (s *Server) handleMigrateTape(w http.ResponseWriter, r *http.Request) {
+	id, err := s.getIDParam(r)
+	if err != nil {
+		s.respondError(w, http.StatusBadRequest, "invalid tape id")
+		return
+	}
+	var req struct {
+		PoolID  int64  `json:"pool_id"`
+		DriveID *int64 `json:"drive_id"`
+		Relabel *bool  `json:"relabel"`
+		Force   bool   `json:"force"`
+		DryRun  bool   `json:"dry_run"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		s.respondError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+	if req.PoolID == 0 {
+		s.respondError(w, http.StatusBadRequest, "pool_id is required")
+		return
+	}
+	relabel := req.Relabel == nil || *req.Relabel
+
+	check, err := s.checkTapeMigration(id, req.PoolID, relabel)
+	if err != nil {
+		if me, ok := err.(*migrationError); ok {
+			s.respondError(w, me.status, me.message)
+		} else {
+			s.respondError(w, http.StatusInternalServerError, err.Error())
+		}
+		return
+	}
+	if req.DryRun {
+		s.respondJSON(w, http.StatusOK, check)
+		return
+	}
+	if len(check.Conflicts) > 0 && !req.Force {
+		s.respondErrorCode(w, http.StatusConflict, codePoolPolicyConflict,
+			"the tape conflicts with the policies of pool "+check.ToPool+"; set force to move it anyway", check)
+		return
+	}
+
+	relabelStatus := check.Relabel
+	if check.Relabel == relabelNow {
+		if status, err := s.relabelTapePool(r, check, req.DriveID); err != nil {
+			s.respondError(w, status, err.Error())
+			return
+		}
+		relabelStatus = relabelDone
+	}
+
+	var migratedBy interface{}
+	if claims, ok := r.Context().Value("claims").(*auth.Claims); ok && claims != nil {
+		migratedBy = claims.UserID
+	}
+	accepted := append(append([]string{}, check.Conflicts...), check.Warnings...)
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		s.respondError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	defer tx.Rollback()
+	if _, err := tx.Exec("UPDATE tapes SET pool_id = ?, updated_at = CURRENT_TIMESTAMP WHERE id = ?", req.PoolID, id); err != nil {
+		s.respondError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	result, err := tx.Exec(`
+		INSERT INTO tape_pool_migrations (tape_id, from_pool_id, from_pool_name, to_pool_id, to_pool_name, relabel_status, warnings, migrated_by)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+	`, id, check.FromPoolID, check.FromPool, req.PoolID, check.ToPool, relabelStatus, strings.Join(accepted, "\n"), migratedBy)
+	if err != nil {
+		s.respondError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	migrationID, _ := result.LastInsertId()
+	if err := tx.Commit(); err != nil {
+		s.respondError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	details := fmt.Sprintf("Moved tape %s from pool %s to pool %s (label %s)", check.TapeLabel, check.FromPool, check.ToPool, relabelStatus)
+	if len(check.Conflicts) > 0 {
+		details += "; accepted conflicts: " + strings.Join(check.Conflicts, "; ")
+	}
+	s.auditLog(r, "migrate_pool", "tape", id, details)
+
+	migration, err := s.getTapeMigration(migrationID)
+	if err != nil {
+		s.respondError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	s.respondJSON(w, http.StatusOK, migration)
+}
+
+// relabelTapePool rewrites the pool name in the label of a tape without
+// data. The drive is the given one or the one the tape is loaded in, and
+// must hold the tape with the expected UUID.
+func (s *Server) relabelTapePool(r *http.Request, check *tapeMigrationCheck, driveID *int64) (int, error) {
+	var devicePath string
+	var err error
+	if driveID != nil {
+		err = s.db.QueryRow("SELECT device_path FROM tape_drives WHERE id = ? AND enabled = 1", *driveID).Scan(&devicePath)
+	} else {
+		err = s.db.QueryRow("SELECT device_path FROM tape_drives WHERE current_tape_id = ? AND enabled = 1 ORDER BY id LIMIT 1", check.TapeID).Scan(&devicePath)
+	}
+	if err != nil {
+		return http.StatusBadRequest, fmt.Errorf("load the tape into a drive to rewrite its label, or set relabel to false")
+	}
+
+	s.tapeOp.mu.Lock()
+	if s.tapeOp.running {
+		s.tapeOp.mu.Unlock()
+		return http.StatusConflict, fmt.Errorf("a tape operation is already in progress")
+	}
+	s.tapeOp.running = true
+	s.tapeOp.opType = "relabel"
+	s.tapeOp.phase = "writing"
+	s.tapeOp.message = fmt.Sprintf("Rewriting the pool in the label of tape '%s'...", check.TapeLabel)
+	s.tapeOp.tapeID = check.TapeID
+	s.tapeOp.label = check.TapeLabel
+	s.tapeOp.err = ""
+	s.tapeOp.started = time.Now()
+	s.tapeOp.mu.Unlock()
+	defer func() {
+		s.tapeOp.mu.Lock()
+		s.tapeOp.running = false
+		s.tapeOp.phase = "complete"
+		s.tapeOp.mu.Unlock()
+	}()
+
+	ctx := r.Context()
+	driveSvc := tape.NewServiceForDevice(devicePath, s.tapeService.GetBlockSize())
+	label, err := driveSvc.ReadTapeLabel(ctx)
+	if err != nil {
+		return http.StatusInternalServerError, fmt.Errorf("failed to read tape label: %w", err)
+	}
+	if label == nil || label.UUID != check.uuid {
+		return http.StatusConflict, fmt.Errorf("the drive does not hold tape %s", check.TapeLabel)
+	}
+	if err := driveSvc.WriteTapeLabel(ctx, label.Label, label.UUID, check.ToPool, label.EncryptionKeyFingerprint, label.CompressionType); err != nil {
+		return http.StatusInternalServerError, fmt.Errorf("failed to rewrite tape label: %w", err)
+	}
+	return http.StatusOK, nil
+}
+
+const tapeMigrationColumns = `id, tape_id, from_pool_id, from_pool_name, to_pool_id, to_pool_name, relabel_status, warnings, migrated_by, created_at`
+
+func scanTapeMigration(row interface{ Scan(...interface{}) error }) (*tapeMigration, error) {
+	var m tapeMigration
+	var fromPoolID, migratedBy sql.NullInt64
+	var warnings string
+	if err := row.Scan(&m.ID, &m.TapeID, &fromPoolID, &m.FromPool, &m.ToPoolID, &m.ToPool, &m.RelabelStatus, &warnings, &migratedBy, &m.CreatedAt); err != nil {
+		return nil, err
+	}
+	if fromPoolID.Valid {
+		m.FromPoolID = &fromPoolID.Int64
+	}
+	if migratedBy.Valid {
+		m.MigratedBy = &migratedBy.Int64
+	}
+	m.Warnings = []string{}
+	if warnings != "" {
+		m.Warnings = strings.Split(warnings, "\n")
+	}
+	return &m, nil
+}
+
+func (s *Server) getTapeMigration(id int64) (*tapeMigration, error) {
+	return scanTapeMigration(s.db.QueryRow("SELECT "+tapeMigrationColumns+" FROM tape_pool_migrations WHERE id = ?", id))
+}
+
+// handleListTapeMigrations lists the pool moves of a tape, newest first
+func (s *Server) handleListTapeMigrations(w http.ResponseWriter, r *http.Request) {
+	id, err := s.getIDParam(r)
+	if err != nil {
+		s.respondError(w, http.StatusBadRequest, "invalid tape id")
+		return
+	}
+	rows, err := s.db.Query("SELECT "+tapeMigrationColumns+" FROM tape_pool_migrations WHERE tape_id = ? ORDER BY id DESC", id)
+	if err != nil {
+		s.respondError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	defer rows.Close()
+
+	migrations := []*tapeMigration{}
+	for rows.Next() {
+		m, err := scanTapeMigration(rows)
+		if err != nil {
+			continue
+		}
+		migrations = append(migrations, m)
+	}
+	s.respondJSON(w, http.StatusOK, migrations)
+}
+
+// markTapeRelabelled records that a tape's label was written afresh, which
+// completes the relabel of earlier pool moves
+func (s *Server) markTapeRelabelled(tapeID int64) {
+	s.db.Exec("UPDATE tape_pool_migrations SET relabel_status = ? WHERE tape_id = ? AND relabel_status = ?", relabelDone, tapeID, relabelPending)
+}
@@ -0,0 +1,249 @@
+package api
+
+import (
+	"database/sql"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/RoseOO/TapeBackarr/internal/auth"
+	"github.com/RoseOO/TapeBackarr/internal/models"
+)
+
+// clearTapeReuse resets a tape's reuse decision when its status changes
+const clearTapeReuse = "reuse_state = '', reuse_requested_at = NULL, reuse_approved_at = NULL, reuse_approved_by = NULL"
+
+// errReusePending is returned by reusableTape when a pool's expired tapes
+// are all waiting for reuse approval
+type errReusePending struct {
+	count int
+}
+
+func (e *errReusePending) Error() string {
+	return fmt.Sprintf("%d expired tape(s) in pool awaiting reuse approval", e.count)
+}
+
+// reusableTape returns the expired tape a pool may recycle, written longest
+// ago. In pools with reuse approval, expired tapes first enter the pending
+// state and only approved ones are returned; pending tapes are approved
+// automatically once the pool's grace period has passed. Returns
+// sql.ErrNoRows when the pool has no expired tape.
+func (s *Server) reusableTape(poolID int64) (int64, string, error) {
+	var poolName string
+	var approval bool
+	var graceHours int
+	if err := s.db.QueryRow("SELECT name, reuse_approval, reuse_grace_hours FROM tape_pools WHERE id = ?", poolID).
+		Scan(&poolName, &approval, &graceHours); err != nil {
+		return 0, "", err
+	}
+
+	state := ""
+	if approval {
+		s.requestTapeReuse(poolID, poolName)
+		if graceHours > 0 {
+			s.autoApproveTapeReuse(poolID, time.Duration(graceHours)*time.Hour)
+		}
+		state = models.TapeReuseApproved
+	}
+
+	var tapeID int64
+	var tapeLabel string
+	err := s.db.QueryRow(`
+		SELECT id, label FROM tapes
+		WHERE pool_id = ? AND status = 'expired' AND (? = '' OR reuse_state = ?)
+		AND id NOT IN (SELECT tape_id FROM tape_reservations WHERE expires_at > datetime('now'))
+		AND format_type = COALESCE((SELECT format_type FROM tape_pools WHERE tape_pools.id = tapes.pool_id), format_type)
+		ORDER BY last_written_at ASC
+		LIMIT 1
+	`, poolID, state, state).Scan(&tapeID, &tapeLabel)
+	if err == sql.ErrNoRows && approval {
+		var pending int
+		s.db.QueryRow("SELECT COUNT(*) FROM tapes WHERE pool_id = ? AND status = 'expired' AND reuse_state = ?",
+			poolID, models.TapeReusePending).Scan(&pending)
+		if pending > 0 {
+			return 0, "", &errReusePending{count: pending}
+		}
+	}
+	return tapeID, tapeLabel, err
+}
+
+// requestTapeReuse moves the pool's expired tapes that have no reuse
+// decision yet into the pending state
+func (s *Server) requestTapeReuse(poolID int64, poolName string) {
+	rows, err := s.db.Query("SELECT id, label FROM tapes WHERE pool_id = ? AND status = 'expired' AND reuse_state = ''", poolID)
+	if err != nil {
+		return
+	}
+	type tape struct {
+		id    int64
+		label string
+	}
+	var tapes []tape
+	for rows.Next() {
+		var t tape
+		if rows.Scan(&t.id, &t.label) == nil {
+			tapes = append(tapes, t)
+		}
+	}
+	rows.Close()
+
+	for _, t := range tapes {
+		if _, err := s.db.Exec(`
+			UPDATE tapes SET reuse_state = ?, reuse_requested_at = CURRENT_TIMESTAMP, updated_at = CURRENT_TIMESTAMP
+			WHERE id = ? AND reuse_state = ''
+		`, models.TapeReusePending, t.id); err != nil {
+			continue
+		}
+		if s.logger != nil {
+			s.logger.Info("Expired tape awaiting reuse approval", map[string]interface{}{"tape": t.label, "pool": poolName})
+		}
+		if s.eventBus != nil {
+			s.eventBus.Publish(SystemEvent{Type: "warning", Category: "tape", Key: "tape_reuse_pending",
+				Args: []interface{}{t.label, poolName}})
+		}
+	}
+}
+
+// autoApproveTapeReuse approves the pool's pending tapes whose reuse was
+// requested more than grace ago
+func (s *Server) autoApproveTapeReuse(poolID int64, grace time.Duration) {
+	rows, err := s.db.Query("SELECT id, label, reuse_requested_at FROM tapes WHERE pool_id = ? AND status = 'expired' AND reuse_state = ?",
+		poolID, models.TapeReusePending)
+	if err != nil {
+		return
+	}
+	var due []int64
+	var labels []string
+	for rows.Next() {
+		var id int64
+		var label string
+		var requested *time.Time
+		if rows.Scan(&id, &label, &requested) != nil {
+			continue
+		}
+		if requested == nil || time.Since(*requested) >= grace {
+			due = append(due, id)
+			labels = append(labels, label)
+		}
+	}
+	rows.Close()
+
+	for i, id := range due {
+		if _, err := s.db.Exec(`
+			UPDATE tapes SET reuse_state = ?, reuse_approved_at = CURRENT_TIMESTAMP, reuse_approved_by = NULL, updated_at = CURRENT_TIMESTAMP
+			WHERE id = ?
+		`, models.TapeReuseApproved, id); err != nil {
+			continue
+		}
+		s.auditLogDirect(nil, "", "reuse_auto_approve", "tape", id, "Reuse of expired tape "+labels[i]+" approved after the grace period")
+		if s.eventBus != nil {
+			s.eventBus.Publish(SystemEvent{Type: "info", Category: "tape", Key: "tape_reuse_approved", Args: []interface{}{labels[i]}})
+		}
+	}
+}
+
+// handleListTapeReuse lists expired tapes waiting for reuse approval
+func (s *Server) handleListTapeReuse(w http.ResponseWriter, r *http.Request) {
+	rows, err := s.db.Query(`
+		SELECT t.id, t.label, t.pool_id, tp.name, t.last_written_at, t.reuse_requested_at, tp.reuse_grace_hours
+		FROM tapes t
+		JOIN tape_pools tp ON tp.id = t.pool_id
+		WHERE t.status = 'expired' AND t.reuse_state = ?
+		ORDER BY t.reuse_requested_at, t.label
+	`, models.TapeReusePending)
+	if err != nil {
+		s.respondError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	defer rows.Close()
+
+	pending := make([]map[string]interface{}, 0)
+	for rows.Next() {
+		var id, poolID int64
+		var label, poolName string
+		var lastWritten, requested *time.Time
+		var graceHours int
+		if err := rows.Scan(&id, &label, &poolID, &poolName, &lastWritten, &requested, &graceHours); err != nil {
+			continue
+		}
+		var autoApproveAt *time.Time
+		if graceHours > 0 && requested != nil {
+			at := requested.Add(time.Duration(graceHours) * time.Hour)
+			autoApproveAt = &at
+		}
+		pending = append(pending, map[string]interface{}{
+			"tape_id":            id,
+			"label":              label,
+			"pool_id":            poolID,
+			"pool_name":          poolName,
+			"last_written_at":    lastWritten,
+			"reuse_requested_at": requested,
+			"auto_approve_at":    autoApproveAt,
+		})
+	}
+	s.respondJSON(w, http.StatusOK, pending)
+}
+
+// handleApproveTapeReuse lets the next backup that needs a tape from the
+// pool overwrite an expired tape
+func (s *Server) handleApproveTapeReuse(w http.ResponseWriter, r *http.Request) {
+	id, label, ok := s.expiredTapeParam(w, r)
+	if !ok {
+		return
+	}
+	var userID interface{}
+	if claims, ok := r.Context().Value("claims").(*auth.Claims); ok {
+		userID = claims.UserID
+	}
+	if _, err := s.db.Exec(`
+		UPDATE tapes SET reuse_state = ?, reuse_requested_at = COALESCE(reuse_requested_at, CURRENT_TIMESTAMP),
+		       reuse_approved_at = CURRENT_TIMESTAMP, reuse_approved_by = ?, updated_at = CURRENT_TIMESTAMP
+		WHERE id = ?
+	`, models.TapeReuseApproved, userID, id); err != nil {
+		s.respondError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	s.auditLog(r, "reuse_approve", "tape", id, "Approved reuse of expired tape "+label)
+	if s.eventBus != nil {
+		s.eventBus.Publish(SystemEvent{Type: "info", Category: "tape", Key: "tape_reuse_approved", Args: []interface{}{label}})
+	}
+	s.respondJSON(w, http.StatusOK, map[string]string{"status": "approved"})
+}
+
+// handleRejectTapeReuse keeps an expired tape's data by marking it full
+// again, so that it is neither written to nor recycled
+func (s *Server) handleRejectTapeReuse(w http.ResponseWriter, r *http.Request) {
+	id, label, ok := s.expiredTapeParam(w, r)
+	if !ok {
+		return
+	}
+	if _, err := s.db.Exec(`
+		UPDATE tapes SET status = 'full', `+clearTapeReuse+`, updated_at = CURRENT_TIMESTAMP
+		WHERE id = ?
+	`, id); err != nil {
+		s.respondError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	s.auditLog(r, "reuse_reject", "tape", id, "Rejected reuse of expired tape "+label+"; tape kept as full")
+	s.respondJSON(w, http.StatusOK, map[string]string{"status": "rejected"})
+}
+
+// expiredTapeParam loads the tape named by the id parameter and checks that
+// it is expired
+func (s *Server) expiredTapeParam(w http.ResponseWriter, r *http.Request) (int64, string, bool) {
+	id, err := s.getIDParam(r)
+	if err != nil {
+		s.respondError(w, http.StatusBadRequest, "invalid tape id")
+		return 0, "", false
+	}
+	var label, status string
+	if err := s.db.QueryRow("SELECT label, status FROM tapes WHERE id = ?", id).Scan(&label, &status); err != nil {
+		s.respondError(w, http.StatusNotFound, "tape not found")
+		return 0, "", false
+	}
+	if status != string(models.TapeStatusExpired) {
+		s.respondError(w, http.StatusConflict, "tape is not expired")
+		return 0, "", false
+	}
+	return id, label, true
+}
@@ -0,0 +1,199 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"time"
+)
+
+// tapeLabelBytes is the size of the label block at file 0
+const tapeLabelBytes = 512
+
+// Kinds of tape timeline segments
+const (
+	segmentLabel          = "label"
+	segmentBackupSet      = "backup_set"
+	segmentDatabaseBackup = "database_backup"
+	segmentFree           = "free"
+)
+
+// tapeTimelineSegment is one region of a tape, in the order it was written.
+// Offsets are estimated from the bytes recorded for each write, since drives
+// only report block numbers.
+type tapeTimelineSegment struct {
+	Kind          string     `json:"kind"`
+	FileNumber    *int64     `json:"file_number,omitempty"`
+	TOCFileNumber *int64     `json:"toc_file_number,omitempty"`
+	StartBlock    *int64     `json:"start_block,omitempty"`
+	EndBlock      *int64     `json:"end_block,omitempty"`
+	OffsetBytes   int64      `json:"offset_bytes"`
+	Bytes         int64      `json:"bytes"`
+	Time          *time.Time `json:"time,omitempty"`
+
+	BackupSetID      int64      `json:"backup_set_id,omitempty"`
+	InvalidatedAt    *time.Time `json:"invalidated_at,omitempty"`
+	JobName          string     `json:"job_name,omitempty"`
+	BackupType       string     `json:"backup_type,omitempty"`
+	FileCount        int64      `json:"file_count,omitempty"`
+	DatabaseBackupID int64      `json:"database_backup_id,omitempty"`
+}
+
+// name describes a segment in warnings
+func (seg *tapeTimelineSegment) name() string {
+	if seg.Kind == segmentDatabaseBackup {
+		return fmt.Sprintf("database backup %d", seg.DatabaseBackupID)
+	}
+	return fmt.Sprintf("backup set %d", seg.BackupSetID)
+}
+
+// handleTapeTimeline lists everything written to a tape in physical order:
+// the label, completed backup sets with their data and TOC files, database
+// backups and the remaining free space. warnings flags records that do not
+// add up, such as a write that starts before an earlier one, which should be
+// checked before appending to the tape.
+func (s *Server) handleTapeTimeline(w http.ResponseWriter, r *http.Request) {
+	id, err := s.getIDParam(r)
+	if err != nil {
+		s.respondError(w, http.StatusBadRequest, "invalid tape id")
+		return
+	}
+
+	var label, formatType, status string
+	var capacity, used int64
+	var labeledAt *time.Time
+	err = s.db.QueryRow(`
+		SELECT label, format_type, status, capacity_bytes, used_bytes, labeled_at
+		FROM tapes WHERE id = ?
+	`, id).Scan(&label, &formatType, &status, &capacity, &used, &labeledAt)
+	if err != nil {
+		s.respondError(w, http.StatusNotFound, "tape not found")
+		return
+	}
+
+	var writes []*tapeTimelineSegment
+	rows, err := s.db.Query(`
+		SELECT bs.id, COALESCE(j.name, ''), bs.backup_type, bs.start_time, bs.start_block, bs.end_block,
+		       bs.file_count, bs.total_bytes, bs.tape_bytes, bs.invalidated_at
+		FROM backup_sets bs
+		LEFT JOIN backup_jobs j ON bs.job_id = j.id
+		WHERE bs.tape_id = ? AND bs.status = 'completed'
+	`, id)
+	if err != nil {
+		s.respondError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	for rows.Next() {
+		seg := &tapeTimelineSegment{Kind: segmentBackupSet}
+		var start time.Time
+		var totalBytes, tapeBytes int64
+		if err := rows.Scan(&seg.BackupSetID, &seg.JobName, &seg.BackupType, &start, &seg.StartBlock, &seg.EndBlock,
+			&seg.FileCount, &totalBytes, &tapeBytes, &seg.InvalidatedAt); err != nil {
+			continue
+		}
+		seg.Time = &start
+		seg.Bytes = totalBytes
+		if tapeBytes > 0 {
+			seg.Bytes = tapeBytes
+		}
+		writes = append(writes, seg)
+	}
+	rows.Close()
+
+	rows, err = s.db.Query(`
+		SELECT id, backup_time, file_size, block_offset
+		FROM database_backups WHERE tape_id = ? AND status = 'completed'
+	`, id)
+	if err != nil {
+		s.respondError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	for rows.Next() {
+		seg := &tapeTimelineSegment{Kind: segmentDatabaseBackup}
+		var backupTime time.Time
+		if err := rows.Scan(&seg.DatabaseBackupID, &backupTime, &seg.Bytes, &seg.StartBlock); err != nil {
+			continue
+		}
+		seg.Time = &backupTime
+		writes = append(writes, seg)
+	}
+	rows.Close()
+
+	// Writes are sequential, so the order they happened in is the order
+	// they sit on the tape
+	sort.SliceStable(writes, func(i, j int) bool { return writes[i].Time.Before(*writes[j].Time) })
+
+	var warnings []string
+	fileNum := func(n int64) *int64 { return &n }
+	segments := []*tapeTimelineSegment{{
+		Kind:        segmentLabel,
+		FileNumber:  fileNum(0),
+		StartBlock:  fileNum(0),
+		OffsetBytes: 0,
+		Bytes:       tapeLabelBytes,
+		Time:        labeledAt,
+	}}
+	next := int64(1)
+	offset := int64(tapeLabelBytes)
+	var setBytes int64
+	var lastBlock *tapeTimelineSegment
+	for _, seg := range writes {
+		seg.FileNumber = fileNum(next)
+		next++
+		if seg.Kind == segmentBackupSet {
+			// The TOC follows the data in its own file
+			seg.TOCFileNumber = fileNum(next)
+			next++
+			setBytes += seg.Bytes
+		}
+		seg.OffsetBytes = offset
+		offset += seg.Bytes
+
+		if seg.StartBlock != nil && *seg.StartBlock > 0 {
+			if lastBlock != nil && *seg.StartBlock <= *lastBlock.StartBlock {
+				warnings = append(warnings, fmt.Sprintf("%s starts at block %d, not after %s at block %d; the earlier data may have been overwritten",
+					seg.name(), *seg.StartBlock, lastBlock.name(), *lastBlock.StartBlock))
+			}
+			lastBlock = seg
+		}
+		segments = append(segments, seg)
+	}
+
+	if formatType == "ltfs" {
+		warnings = append(warnings, "LTFS tapes are laid out by the LTFS index; file numbers and offsets are not tracked")
+	}
+	if capacity > 0 && offset > capacity {
+		warnings = append(warnings, fmt.Sprintf("recorded writes total %d bytes, more than the tape capacity of %d bytes", offset, capacity))
+	}
+	if setBytes != used {
+		warnings = append(warnings, fmt.Sprintf("tape usage of %d bytes does not match the %d bytes of its backup sets", used, setBytes))
+	}
+
+	// Trust the larger of the two so free space is never overstated
+	end := offset
+	if used > end {
+		end = used
+	}
+	if capacity > end {
+		segments = append(segments, &tapeTimelineSegment{
+			Kind:        segmentFree,
+			OffsetBytes: end,
+			Bytes:       capacity - end,
+		})
+	}
+	if warnings == nil {
+		warnings = []string{}
+	}
+
+	s.respondJSON(w, http.StatusOK, map[string]interface{}{
+		"tape_id":          id,
+		"label":            label,
+		"status":           status,
+		"format_type":      formatType,
+		"capacity_bytes":   capacity,
+		"used_bytes":       used,
+		"segments":         segments,
+		"next_file_number": next,
+		"warnings":         warnings,
+	})
+}
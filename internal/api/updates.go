@@ -0,0 +1,136 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/RoseOO/TapeBackarr/internal/updates"
+	"github.com/go-chi/chi/v5"
+)
+
+// updateCheckTimeout bounds one release check
+const updateCheckTimeout = time.Minute
+
+// updateState holds the release checker and the newest release announced
+type updateState struct {
+	mu       sync.Mutex
+	checker  *updates.Checker
+	notified string
+}
+
+// SetUpdateChecker enables the release check. It runs at startup and on
+// updates.check_schedule, and whenever an admin asks.
+func (s *Server) SetUpdateChecker(c *updates.Checker) {
+	s.updates.mu.Lock()
+	s.updates.checker = c
+	s.updates.mu.Unlock()
+	if c == nil || s.config == nil || s.config.Updates.CheckSchedule == "" {
+		return
+	}
+	if s.scheduler != nil {
+		if err := s.scheduler.SetMaintenance("update_check", s.config.Updates.CheckSchedule, s.runUpdateCheck); err != nil && s.logger != nil {
+			s.logger.Error("Failed to schedule the release check", map[string]interface{}{"error": err.Error()})
+		}
+	}
+	go s.runUpdateCheck()
+}
+
+func (s *Server) updateChecker() *updates.Checker {
+	s.updates.mu.Lock()
+	defer s.updates.mu.Unlock()
+	return s.updates.checker
+}
+
+// runUpdateCheck checks for releases in the background
+func (s *Server) runUpdateCheck() {
+	ctx, cancel := context.WithTimeout(context.Background(), updateCheckTimeout)
+	defer cancel()
+	if _, err := s.checkForUpdates(ctx); err != nil && s.logger != nil {
+		s.logger.Warn("Release check failed", map[string]interface{}{"error": err.Error()})
+	}
+}
+
+// checkForUpdates runs a release check and announces a newer release once
+func (s *Server) checkForUpdates(ctx context.Context) (*updates.Status, error) {
+	checker := s.updateChecker()
+	if checker == nil {
+		return nil, nil
+	}
+	st, err := checker.Check(ctx)
+	if err != nil || !st.UpdateAvailable {
+		return st, err
+	}
+
+	s.updates.mu.Lock()
+	announce := s.updates.notified != st.LatestVersion
+	s.updates.notified = st.LatestVersion
+	s.updates.mu.Unlock()
+	if announce {
+		if s.logger != nil {
+			s.logger.Info("A new release is available", map[string]interface{}{
+				"current": st.CurrentVersion, "latest": st.LatestVersion, "pending_migrations": len(st.PendingMigrations),
+			})
+		}
+		if s.eventBus != nil {
+			s.eventBus.Publish(SystemEvent{
+				Type:     "info",
+				Category: "system",
+				Key:      "update_available",
+				Args:     []interface{}{st.LatestVersion, st.CurrentVersion, len(st.PendingMigrations)},
+			})
+		}
+	}
+	return st, nil
+}
+
+// handleGetUpdates returns the outcome of the last release check
+func (s *Server) handleGetUpdates(w http.ResponseWriter, r *http.Request) {
+	checker := s.updateChecker()
+	if checker == nil {
+		s.respondError(w, http.StatusServiceUnavailable, "release check is not available")
+		return
+	}
+	s.respondJSON(w, http.StatusOK, checker.Status())
+}
+
+// handleCheckUpdates checks for releases now
+func (s *Server) handleCheckUpdates(w http.ResponseWriter, r *http.Request) {
+	if s.updateChecker() == nil {
+		s.respondError(w, http.StatusServiceUnavailable, "release check is not available")
+		return
+	}
+	ctx, cancel := context.WithTimeout(r.Context(), updateCheckTimeout)
+	defer cancel()
+	st, err := s.checkForUpdates(ctx)
+	if err != nil {
+		s.respondError(w, http.StatusBadGateway, err.Error())
+		return
+	}
+	s.respondJSON(w, http.StatusOK, st)
+}
+
+// handleGetUpdateMigrations lists the migrations a release would apply to
+// this database
+func (s *Server) handleGetUpdateMigrations(w http.ResponseWriter, r *http.Request) {
+	checker := s.updateChecker()
+	if checker == nil {
+		s.respondError(w, http.StatusServiceUnavailable, "release check is not available")
+		return
+	}
+	version := chi.URLParam(r, "version")
+	ctx, cancel := context.WithTimeout(r.Context(), updateCheckTimeout)
+	defer cancel()
+	pending, err := checker.Migrations(ctx, version)
+	if err != nil {
+		s.respondError(w, http.StatusBadGateway, err.Error())
+		return
+	}
+	schemaVersion, _ := s.db.SchemaVersion()
+	s.respondJSON(w, http.StatusOK, map[string]interface{}{
+		"version":            version,
+		"schema_version":     schemaVersion,
+		"pending_migrations": pending,
+	})
+}
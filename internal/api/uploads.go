@@ -0,0 +1,151 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/RoseOO/TapeBackarr/internal/backup"
+	"github.com/RoseOO/TapeBackarr/internal/models"
+)
+
+// handleListUploads lists open uploads and those finished in the last day
+func (s *Server) handleListUploads(w http.ResponseWriter, r *http.Request) {
+	s.respondJSON(w, http.StatusOK, s.backupService.ListUploads())
+}
+
+// handleStartUpload opens an upload: the tape is positioned and a backup set
+// of the job is started, ready to receive the artifact's bytes in chunks
+func (s *Server) handleStartUpload(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		JobID   int64      `json:"job_id"`
+		TapeID  int64      `json:"tape_id"` // optional; selected from the job's pool when omitted
+		Path    string     `json:"path"`
+		Size    *int64     `json:"size"`
+		SHA256  string     `json:"sha256"`
+		Mode    int64      `json:"mode"`
+		ModTime *time.Time `json:"mod_time"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		s.respondError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+	if req.JobID == 0 || req.Path == "" || req.Size == nil {
+		s.respondError(w, http.StatusBadRequest, "job_id, path and size are required")
+		return
+	}
+
+	var job models.BackupJob
+	err := s.db.QueryRow(`
+		SELECT id, name, source_id, pool_id, backup_type, retention_days
+		FROM backup_jobs WHERE id = ?
+	`, req.JobID).Scan(&job.ID, &job.Name, &job.SourceID, &job.PoolID, &job.BackupType, &job.RetentionDays)
+	if err != nil {
+		s.respondError(w, http.StatusNotFound, "job not found")
+		return
+	}
+
+	tapeID := req.TapeID
+	if tapeID == 0 {
+		selectedTapeID, _, err := s.reserveTapeFromPool(job.PoolID, job.RetentionDays, job.ID)
+		if err != nil {
+			s.respondTapeSelectionError(w, err, fmt.Sprintf("no suitable tape found in pool: %v", err))
+			return
+		}
+		tapeID = selectedTapeID
+	}
+
+	upload := backup.UploadRequest{Path: req.Path, Size: *req.Size, SHA256: req.SHA256, Mode: req.Mode}
+	if req.ModTime != nil {
+		upload.ModTime = *req.ModTime
+	}
+	status, err := s.backupService.StartUpload(context.Background(), &job, tapeID, upload)
+	if err != nil {
+		s.releaseUnusedTape(tapeID, job.ID)
+		s.respondReserveError(w, err)
+		return
+	}
+
+	s.auditLog(r, "upload", "backup_set", status.BackupSetID,
+		fmt.Sprintf("Started upload of %s (%d bytes) onto tape %s for job %s", status.Path, status.Size, status.TapeLabel, job.Name))
+	w.Header().Set("Location", "/api/v1/uploads/"+status.ID)
+	w.Header().Set("Upload-Offset", "0")
+	s.respondJSON(w, http.StatusCreated, status)
+}
+
+// handleGetUpload returns an upload's status, including the offset the next
+// chunk must start at
+func (s *Server) handleGetUpload(w http.ResponseWriter, r *http.Request) {
+	status, err := s.backupService.GetUpload(chi.URLParam(r, "id"))
+	if err != nil {
+		s.respondError(w, http.StatusNotFound, err.Error())
+		return
+	}
+	w.Header().Set("Upload-Offset", strconv.FormatInt(status.Offset, 10))
+	s.respondJSON(w, http.StatusOK, status)
+}
+
+// handleWriteUpload streams the request body onto tape as the next chunk of
+// an upload. The Upload-Offset header must match the bytes received so far.
+func (s *Server) handleWriteUpload(w http.ResponseWriter, r *http.Request) {
+	offset, err := strconv.ParseInt(r.Header.Get("Upload-Offset"), 10, 64)
+	if err != nil || offset < 0 {
+		s.respondError(w, http.StatusBadRequest, "Upload-Offset header is required")
+		return
+	}
+
+	// A chunk may take as long as the tape takes to write it
+	rc := http.NewResponseController(w)
+	rc.SetReadDeadline(time.Time{})
+	rc.SetWriteDeadline(time.Time{})
+
+	id := chi.URLParam(r, "id")
+	status, err := s.backupService.WriteUpload(id, offset, r.Body)
+	if status != nil {
+		w.Header().Set("Upload-Offset", strconv.FormatInt(status.Offset, 10))
+	}
+	var offsetErr *backup.UploadOffsetError
+	switch {
+	case errors.Is(err, backup.ErrUploadNotFound):
+		s.respondError(w, http.StatusNotFound, err.Error())
+		return
+	case errors.Is(err, backup.ErrUploadBusy), errors.Is(err, backup.ErrUploadClosed), errors.As(err, &offsetErr):
+		s.respondError(w, http.StatusConflict, err.Error())
+		return
+	case err != nil && status.Status == backup.UploadReceiving:
+		// The chunk was cut short; the client can resume from Upload-Offset
+		s.respondError(w, http.StatusBadRequest, err.Error())
+		return
+	case err != nil:
+		s.auditLog(r, "upload_failed", "backup_set", status.BackupSetID, fmt.Sprintf("Upload of %s failed: %s", status.Path, status.Error))
+		s.respondError(w, http.StatusUnprocessableEntity, err.Error())
+		return
+	}
+
+	if status.Status == backup.UploadCompleted {
+		s.auditLog(r, "upload_complete", "backup_set", status.BackupSetID,
+			fmt.Sprintf("Upload of %s completed (%d bytes, sha256 %s)", status.Path, status.Size, status.SHA256))
+	}
+	s.respondJSON(w, http.StatusOK, status)
+}
+
+// handleAbortUpload cancels an open upload and marks its backup set failed
+func (s *Server) handleAbortUpload(w http.ResponseWriter, r *http.Request) {
+	status, err := s.backupService.AbortUpload(chi.URLParam(r, "id"))
+	switch {
+	case errors.Is(err, backup.ErrUploadNotFound):
+		s.respondError(w, http.StatusNotFound, err.Error())
+		return
+	case err != nil:
+		s.respondError(w, http.StatusConflict, err.Error())
+		return
+	}
+	s.auditLog(r, "upload_abort", "backup_set", status.BackupSetID, "Aborted upload of "+status.Path)
+	s.respondJSON(w, http.StatusOK, status)
+}
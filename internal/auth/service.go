@@ -2,6 +2,7 @@ package auth
 
 import (
 	"crypto/rand"
+	"database/sql"
 	"encoding/hex"
 	"errors"
 	"fmt"
@@ -27,6 +28,10 @@ var (
 	ErrTokenExpired = errors.New("token expired")
 	// ErrInsufficientPermissions is returned when user lacks permission
 	ErrInsufficientPermissions = errors.New("insufficient permissions")
+	// ErrAccountLocked is returned when a locked account attempts to log in
+	ErrAccountLocked = errors.New("account locked")
+	// ErrAPIKeyNotFound is returned when an API key doesn't exist
+	ErrAPIKeyNotFound = errors.New("API key not found")
 )
 
 // Claims represents JWT claims
@@ -34,6 +39,9 @@ type Claims struct {
 	UserID   int64           `json:"user_id"`
 	Username string          `json:"username"`
 	Role     models.UserRole `json:"role"`
+	// AllowedCIDRs is set for API keys limited to some networks, see
+	// models.APIKey
+	AllowedCIDRs string `json:"-"`
 	jwt.RegisteredClaims
 }
 
@@ -42,8 +50,19 @@ type Service struct {
 	db              *database.DB
 	jwtSecret       []byte
 	tokenExpiration time.Duration
+	maxFailedLogins int
+	lockoutDuration time.Duration
 }
 
+// DefaultMaxFailedLogins is the number of consecutive failed logins after
+// which an account is locked
+const DefaultMaxFailedLogins = 5
+
+// DefaultLockoutDuration is how long a locked account stays locked unless
+// an admin unlocks it first. Locks always expire, so that guessing at the
+// last admin's password cannot lock everyone out for good.
+const DefaultLockoutDuration = 15 * time.Minute
+
 // NewService creates a new auth service
 func NewService(db *database.DB, jwtSecret string, tokenExpirationHours int) *Service {
 	secret := []byte(jwtSecret)
@@ -57,23 +76,70 @@ func NewService(db *database.DB, jwtSecret string, tokenExpirationHours int) *Se
 		db:              db,
 		jwtSecret:       secret,
 		tokenExpiration: time.Duration(tokenExpirationHours) * time.Hour,
+		maxFailedLogins: DefaultMaxFailedLogins,
+		lockoutDuration: DefaultLockoutDuration,
+	}
+}
+
+// SetMaxFailedLogins sets the lockout threshold. Zero or a negative value
+// disables account lockout.
+func (s *Service) SetMaxFailedLogins(n int) {
+	s.maxFailedLogins = n
+}
+
+// SetLockoutDuration sets how long an account stays locked. Zero or a
+// negative value keeps DefaultLockoutDuration.
+func (s *Service) SetLockoutDuration(d time.Duration) {
+	if d <= 0 {
+		d = DefaultLockoutDuration
 	}
+	s.lockoutDuration = d
 }
 
 // Login authenticates a user and returns a JWT token
 func (s *Service) Login(username, password string) (string, *models.User, error) {
+	return s.LoginFrom(username, password, "")
+}
+
+// LoginFrom authenticates a user connecting from ipAddress. Every attempt is
+// recorded in the login history; consecutive failures lock the account for
+// the lockout duration once the configured threshold is reached. Locks are
+// ignored while lockout is disabled.
+func (s *Service) LoginFrom(username, password, ipAddress string) (string, *models.User, error) {
 	var user models.User
 	err := s.db.QueryRow(`
-		SELECT id, username, password_hash, role, created_at, updated_at
+		SELECT id, username, password_hash, role, COALESCE(failed_login_attempts, 0), locked_at, locked_until, created_at, updated_at
 		FROM users WHERE username = ?
-	`, username).Scan(&user.ID, &user.Username, &user.PasswordHash, &user.Role, &user.CreatedAt, &user.UpdatedAt)
+	`, username).Scan(&user.ID, &user.Username, &user.PasswordHash, &user.Role, &user.FailedLoginAttempts, &user.LockedAt, &user.LockedUntil, &user.CreatedAt, &user.UpdatedAt)
 
 	if err != nil {
+		s.recordLogin(nil, username, ipAddress, false, "unknown user")
 		return "", nil, ErrInvalidCredentials
 	}
 
+	if s.maxFailedLogins > 0 && user.LockedAt != nil {
+		if time.Now().Before(s.lockExpiry(&user)) {
+			s.recordLogin(&user.ID, username, ipAddress, false, "account locked")
+			return "", nil, ErrAccountLocked
+		}
+		// The lock has expired and the count of failures starts over
+		s.db.Exec("UPDATE users SET failed_login_attempts = 0, locked_at = NULL, locked_until = NULL WHERE id = ?", user.ID)
+	}
+
 	// Verify password
 	if err := bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(password)); err != nil {
+		// Count in the database, so concurrent attempts are not lost
+		var attempts int
+		if err := s.db.QueryRow("UPDATE users SET failed_login_attempts = failed_login_attempts + 1 WHERE id = ? RETURNING failed_login_attempts", user.ID).Scan(&attempts); err != nil {
+			attempts = user.FailedLoginAttempts + 1
+		}
+		if s.maxFailedLogins > 0 && attempts >= s.maxFailedLogins {
+			s.db.Exec("UPDATE users SET locked_at = CURRENT_TIMESTAMP, locked_until = ? WHERE id = ? AND (locked_at IS NULL OR locked_until <= ?)",
+				time.Now().Add(s.lockoutDuration), user.ID, time.Now())
+			s.recordLogin(&user.ID, username, ipAddress, false, fmt.Sprintf("invalid password, account locked after %d attempts", attempts))
+			return "", nil, ErrAccountLocked
+		}
+		s.recordLogin(&user.ID, username, ipAddress, false, "invalid password")
 		return "", nil, ErrInvalidCredentials
 	}
 
@@ -83,9 +149,86 @@ func (s *Service) Login(username, password string) (string, *models.User, error)
 		return "", nil, fmt.Errorf("failed to generate token: %w", err)
 	}
 
+	now := time.Now()
+	s.db.Exec(`
+		UPDATE users SET failed_login_attempts = 0, last_login_at = ?, last_login_ip = ?
+		WHERE id = ?
+	`, now, ipAddress, user.ID)
+	s.recordLogin(&user.ID, username, ipAddress, true, "")
+	user.FailedLoginAttempts = 0
+	user.LastLoginAt = &now
+	user.LastLoginIP = ipAddress
+
 	return token, &user, nil
 }
 
+// lockExpiry returns when the lock of a locked user lifts. Locks set before
+// locked_until existed expire one lockout duration after they were set.
+func (s *Service) lockExpiry(user *models.User) time.Time {
+	if user.LockedUntil != nil {
+		return *user.LockedUntil
+	}
+	return user.LockedAt.Add(s.lockoutDuration)
+}
+
+// recordLogin appends an entry to the login history
+func (s *Service) recordLogin(userID *int64, username, ipAddress string, success bool, reason string) {
+	s.db.Exec(`
+		INSERT INTO login_history (user_id, username, ip_address, success, reason)
+		VALUES (?, ?, ?, ?, ?)
+	`, userID, username, ipAddress, success, reason)
+}
+
+// UnlockUser clears the lock and failed attempt counter on a user account
+func (s *Service) UnlockUser(userID int64) error {
+	result, err := s.db.Exec(`
+		UPDATE users SET failed_login_attempts = 0, locked_at = NULL, locked_until = NULL, updated_at = CURRENT_TIMESTAMP
+		WHERE id = ?
+	`, userID)
+	if err != nil {
+		return err
+	}
+	rows, _ := result.RowsAffected()
+	if rows == 0 {
+		return ErrUserNotFound
+	}
+	return nil
+}
+
+// UnlockUsername unlocks the account with the given username, for the
+// -unlock-user command line flag
+func (s *Service) UnlockUsername(username string) error {
+	var id int64
+	if err := s.db.QueryRow("SELECT id FROM users WHERE username = ?", username).Scan(&id); err != nil {
+		return ErrUserNotFound
+	}
+	return s.UnlockUser(id)
+}
+
+// GetLoginHistory returns the most recent login attempts for a user, newest first
+func (s *Service) GetLoginHistory(userID int64, limit int) ([]models.LoginHistoryEntry, error) {
+	rows, err := s.db.Query(`
+		SELECT id, user_id, username, COALESCE(ip_address, ''), success, COALESCE(reason, ''), created_at
+		FROM login_history WHERE user_id = ?
+		ORDER BY created_at DESC, id DESC
+		LIMIT ?
+	`, userID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	entries := []models.LoginHistoryEntry{}
+	for rows.Next() {
+		var e models.LoginHistoryEntry
+		if err := rows.Scan(&e.ID, &e.UserID, &e.Username, &e.IPAddress, &e.Success, &e.Reason, &e.CreatedAt); err != nil {
+			continue
+		}
+		entries = append(entries, e)
+	}
+	return entries, nil
+}
+
 // ValidateToken validates a JWT token and returns the claims
 func (s *Service) ValidateToken(tokenString string) (*Claims, error) {
 	token, err := jwt.ParseWithClaims(tokenString, &Claims{}, func(token *jwt.Token) (interface{}, error) {
@@ -191,9 +334,9 @@ func (s *Service) UpdatePassword(userID int64, oldPassword, newPassword string)
 func (s *Service) GetUser(userID int64) (*models.User, error) {
 	var user models.User
 	err := s.db.QueryRow(`
-		SELECT id, username, role, created_at, updated_at
+		SELECT id, username, role, COALESCE(failed_login_attempts, 0), locked_at, locked_until, last_login_at, COALESCE(last_login_ip, ''), created_at, updated_at
 		FROM users WHERE id = ?
-	`, userID).Scan(&user.ID, &user.Username, &user.Role, &user.CreatedAt, &user.UpdatedAt)
+	`, userID).Scan(&user.ID, &user.Username, &user.Role, &user.FailedLoginAttempts, &user.LockedAt, &user.LockedUntil, &user.LastLoginAt, &user.LastLoginIP, &user.CreatedAt, &user.UpdatedAt)
 
 	if err != nil {
 		return nil, ErrUserNotFound
@@ -205,7 +348,7 @@ func (s *Service) GetUser(userID int64) (*models.User, error) {
 // ListUsers returns all users
 func (s *Service) ListUsers() ([]models.User, error) {
 	rows, err := s.db.Query(`
-		SELECT id, username, role, created_at, updated_at
+		SELECT id, username, role, COALESCE(failed_login_attempts, 0), locked_at, locked_until, last_login_at, COALESCE(last_login_ip, ''), created_at, updated_at
 		FROM users ORDER BY username
 	`)
 	if err != nil {
@@ -216,7 +359,7 @@ func (s *Service) ListUsers() ([]models.User, error) {
 	var users []models.User
 	for rows.Next() {
 		var u models.User
-		if err := rows.Scan(&u.ID, &u.Username, &u.Role, &u.CreatedAt, &u.UpdatedAt); err != nil {
+		if err := rows.Scan(&u.ID, &u.Username, &u.Role, &u.FailedLoginAttempts, &u.LockedAt, &u.LockedUntil, &u.LastLoginAt, &u.LastLoginIP, &u.CreatedAt, &u.UpdatedAt); err != nil {
 			continue
 		}
 		users = append(users, u)
@@ -225,6 +368,53 @@ func (s *Service) ListUsers() ([]models.User, error) {
 	return users, nil
 }
 
+// DefaultItemsPerPage is the page size used when a user has not stored a preference
+const DefaultItemsPerPage = 25
+
+// GetPreferences returns the stored preferences for a user, or defaults if none are saved
+func (s *Service) GetPreferences(userID int64) (*models.UserPreferences, error) {
+	prefs := &models.UserPreferences{UserID: userID, ItemsPerPage: DefaultItemsPerPage}
+	err := s.db.QueryRow(`
+		SELECT default_pool_id, preferred_drive_id, items_per_page, notification_digest, dashboard_layout, language,
+		       notify_email, notify_telegram_chat_id, updated_at
+		FROM user_preferences WHERE user_id = ?
+	`, userID).Scan(&prefs.DefaultPoolID, &prefs.PreferredDriveID, &prefs.ItemsPerPage,
+		&prefs.NotificationDigest, &prefs.DashboardLayout, &prefs.Language,
+		&prefs.NotifyEmail, &prefs.NotifyTelegramChatID, &prefs.UpdatedAt)
+	if err == sql.ErrNoRows {
+		return prefs, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return prefs, nil
+}
+
+// SavePreferences stores the preferences for prefs.UserID, replacing any existing values
+func (s *Service) SavePreferences(prefs *models.UserPreferences) error {
+	if prefs.ItemsPerPage <= 0 {
+		prefs.ItemsPerPage = DefaultItemsPerPage
+	}
+	_, err := s.db.Exec(`
+		INSERT INTO user_preferences (user_id, default_pool_id, preferred_drive_id, items_per_page, notification_digest, dashboard_layout, language,
+			notify_email, notify_telegram_chat_id, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, CURRENT_TIMESTAMP)
+		ON CONFLICT(user_id) DO UPDATE SET
+			default_pool_id = excluded.default_pool_id,
+			preferred_drive_id = excluded.preferred_drive_id,
+			items_per_page = excluded.items_per_page,
+			notification_digest = excluded.notification_digest,
+			dashboard_layout = excluded.dashboard_layout,
+			language = excluded.language,
+			notify_email = excluded.notify_email,
+			notify_telegram_chat_id = excluded.notify_telegram_chat_id,
+			updated_at = CURRENT_TIMESTAMP
+	`, prefs.UserID, prefs.DefaultPoolID, prefs.PreferredDriveID, prefs.ItemsPerPage,
+		prefs.NotificationDigest, prefs.DashboardLayout, prefs.Language,
+		prefs.NotifyEmail, prefs.NotifyTelegramChatID)
+	return err
+}
+
 // ErrCannotDeleteAdmin is returned when trying to delete the default admin account
 var ErrCannotDeleteAdmin = errors.New("cannot delete the default admin account")
 
@@ -253,8 +443,10 @@ func (s *Service) DeleteUser(userID int64) error {
 	return nil
 }
 
-// GenerateAPIKey creates a new API key and returns the raw key (only shown once)
-func (s *Service) GenerateAPIKey(name string, role models.UserRole, expiresAt *time.Time) (string, *models.APIKey, error) {
+// GenerateAPIKey creates a new API key and returns the raw key (only shown
+// once). allowedCIDRs limits where the key may call admin endpoints and
+// destructive operations from; empty allows any address.
+func (s *Service) GenerateAPIKey(name string, role models.UserRole, expiresAt *time.Time, allowedCIDRs string) (string, *models.APIKey, error) {
 	// Generate a random 32-byte key
 	keyBytes := make([]byte, 32)
 	if _, err := rand.Read(keyBytes); err != nil {
@@ -270,20 +462,21 @@ func (s *Service) GenerateAPIKey(name string, role models.UserRole, expiresAt *t
 	}
 
 	result, err := s.db.Exec(`
-		INSERT INTO api_keys (name, key_hash, key_prefix, role, expires_at)
-		VALUES (?, ?, ?, ?, ?)
-	`, name, string(hash), keyPrefix, role, expiresAt)
+		INSERT INTO api_keys (name, key_hash, key_prefix, role, expires_at, allowed_cidrs)
+		VALUES (?, ?, ?, ?, ?, ?)
+	`, name, string(hash), keyPrefix, role, expiresAt, allowedCIDRs)
 	if err != nil {
 		return "", nil, fmt.Errorf("failed to store API key: %w", err)
 	}
 
 	id, _ := result.LastInsertId()
 	apiKey := &models.APIKey{
-		ID:        id,
-		Name:      name,
-		KeyPrefix: keyPrefix,
-		Role:      role,
-		ExpiresAt: expiresAt,
+		ID:           id,
+		Name:         name,
+		KeyPrefix:    keyPrefix,
+		Role:         role,
+		AllowedCIDRs: allowedCIDRs,
+		ExpiresAt:    expiresAt,
 	}
 
 	return rawKey, apiKey, nil
@@ -298,9 +491,9 @@ func (s *Service) ValidateAPIKey(rawKey string) (*Claims, error) {
 
 	var apiKey models.APIKey
 	err := s.db.QueryRow(`
-		SELECT id, name, key_hash, key_prefix, role, expires_at
+		SELECT id, name, key_hash, key_prefix, role, allowed_cidrs, expires_at
 		FROM api_keys WHERE key_prefix = ?
-	`, prefix).Scan(&apiKey.ID, &apiKey.Name, &apiKey.KeyHash, &apiKey.KeyPrefix, &apiKey.Role, &apiKey.ExpiresAt)
+	`, prefix).Scan(&apiKey.ID, &apiKey.Name, &apiKey.KeyHash, &apiKey.KeyPrefix, &apiKey.Role, &apiKey.AllowedCIDRs, &apiKey.ExpiresAt)
 	if err != nil {
 		return nil, ErrInvalidToken
 	}
@@ -319,16 +512,17 @@ func (s *Service) ValidateAPIKey(rawKey string) (*Claims, error) {
 	s.db.Exec("UPDATE api_keys SET last_used_at = CURRENT_TIMESTAMP WHERE id = ?", apiKey.ID)
 
 	return &Claims{
-		UserID:   -apiKey.ID, // Negative to distinguish from user IDs
-		Username: "api:" + apiKey.Name,
-		Role:     apiKey.Role,
+		UserID:       -apiKey.ID, // Negative to distinguish from user IDs
+		Username:     "api:" + apiKey.Name,
+		Role:         apiKey.Role,
+		AllowedCIDRs: apiKey.AllowedCIDRs,
 	}, nil
 }
 
 // ListAPIKeys returns all API keys (without hashes)
 func (s *Service) ListAPIKeys() ([]models.APIKey, error) {
 	rows, err := s.db.Query(`
-		SELECT id, name, key_prefix, role, last_used_at, expires_at, created_at
+		SELECT id, name, key_prefix, role, allowed_cidrs, last_used_at, expires_at, created_at
 		FROM api_keys ORDER BY created_at DESC
 	`)
 	if err != nil {
@@ -339,7 +533,7 @@ func (s *Service) ListAPIKeys() ([]models.APIKey, error) {
 	var keys []models.APIKey
 	for rows.Next() {
 		var k models.APIKey
-		if err := rows.Scan(&k.ID, &k.Name, &k.KeyPrefix, &k.Role, &k.LastUsedAt, &k.ExpiresAt, &k.CreatedAt); err != nil {
+		if err := rows.Scan(&k.ID, &k.Name, &k.KeyPrefix, &k.Role, &k.AllowedCIDRs, &k.LastUsedAt, &k.ExpiresAt, &k.CreatedAt); err != nil {
 			continue
 		}
 		keys = append(keys, k)
@@ -347,6 +541,19 @@ func (s *Service) ListAPIKeys() ([]models.APIKey, error) {
 	return keys, nil
 }
 
+// SetAPIKeyCIDRs changes the networks an API key may call admin endpoints
+// and destructive operations from
+func (s *Service) SetAPIKeyCIDRs(id int64, allowedCIDRs string) error {
+	result, err := s.db.Exec("UPDATE api_keys SET allowed_cidrs = ? WHERE id = ?", allowedCIDRs, id)
+	if err != nil {
+		return err
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return ErrAPIKeyNotFound
+	}
+	return nil
+}
+
 // DeleteAPIKey deletes an API key
 func (s *Service) DeleteAPIKey(id int64) error {
 	_, err := s.db.Exec("DELETE FROM api_keys WHERE id = ?", id)
@@ -373,6 +580,14 @@ func CheckPermission(role models.UserRole, action string) bool {
 			"logs.read",
 			"settings.read",
 		},
+		models.RoleRestoreOperator: {
+			"tapes.read",
+			"jobs.read",
+			"sources.read",
+			"restore.run", "restore.read",
+			"logs.read",
+			"settings.read",
+		},
 		models.RoleReadOnly: {
 			"tapes.read",
 			"jobs.read",
@@ -381,6 +596,9 @@ func CheckPermission(role models.UserRole, action string) bool {
 			"logs.read",
 			"settings.read",
 		},
+		models.RoleKiosk: {
+			"tapes.read",
+		},
 	}
 
 	allowed, ok := permissions[role]
@@ -2,7 +2,9 @@ package auth
 
 import (
 	"path/filepath"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/RoseOO/TapeBackarr/internal/database"
 	"github.com/RoseOO/TapeBackarr/internal/models"
@@ -218,6 +220,10 @@ func TestCheckPermission(t *testing.T) {
 		{models.RoleOperator, "users.create", false},
 		{models.RoleOperator, "tapes.create", true},
 		{models.RoleOperator, "restore.run", true},
+		{models.RoleRestoreOperator, "restore.run", true},
+		{models.RoleRestoreOperator, "jobs.run", false},
+		{models.RoleRestoreOperator, "tapes.update", false},
+		{models.RoleRestoreOperator, "settings.update", false},
 		{models.RoleReadOnly, "tapes.read", true},
 		{models.RoleReadOnly, "tapes.create", false},
 		{models.RoleReadOnly, "restore.run", false},
@@ -232,3 +238,223 @@ func TestCheckPermission(t *testing.T) {
 		})
 	}
 }
+
+func TestPreferencesDefaultsAndSave(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	svc := NewService(db, "test-secret", 24)
+
+	// Default admin has id 1 and no stored preferences yet
+	prefs, err := svc.GetPreferences(1)
+	if err != nil {
+		t.Fatalf("GetPreferences failed: %v", err)
+	}
+	if prefs.ItemsPerPage != DefaultItemsPerPage {
+		t.Errorf("expected default items_per_page %d, got %d", DefaultItemsPerPage, prefs.ItemsPerPage)
+	}
+	if prefs.DefaultPoolID != nil {
+		t.Errorf("expected no default pool, got %v", *prefs.DefaultPoolID)
+	}
+
+	poolID := int64(1)
+	prefs.DefaultPoolID = &poolID
+	prefs.ItemsPerPage = 100
+	prefs.NotificationDigest = true
+	prefs.DashboardLayout = `{"widgets":["pools","drives"]}`
+	if err := svc.SavePreferences(prefs); err != nil {
+		t.Fatalf("SavePreferences failed: %v", err)
+	}
+
+	// Save again to exercise the upsert path
+	prefs.ItemsPerPage = 50
+	if err := svc.SavePreferences(prefs); err != nil {
+		t.Fatalf("second SavePreferences failed: %v", err)
+	}
+
+	got, err := svc.GetPreferences(1)
+	if err != nil {
+		t.Fatalf("GetPreferences failed: %v", err)
+	}
+	if got.DefaultPoolID == nil || *got.DefaultPoolID != 1 {
+		t.Errorf("expected default pool 1, got %v", got.DefaultPoolID)
+	}
+	if got.ItemsPerPage != 50 {
+		t.Errorf("expected items_per_page 50, got %d", got.ItemsPerPage)
+	}
+	if !got.NotificationDigest {
+		t.Error("expected notification digest enabled")
+	}
+	if got.DashboardLayout != `{"widgets":["pools","drives"]}` {
+		t.Errorf("unexpected dashboard layout: %s", got.DashboardLayout)
+	}
+}
+
+func TestAccountLockoutAndUnlock(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	svc := NewService(db, "test-secret", 24)
+	svc.SetMaxFailedLogins(3)
+
+	user, err := svc.CreateUser("lockme", "correct", models.RoleOperator)
+	if err != nil {
+		t.Fatalf("failed to create user: %v", err)
+	}
+
+	for i := 0; i < 2; i++ {
+		if _, _, err := svc.LoginFrom("lockme", "wrong", "10.0.0.5"); err != ErrInvalidCredentials {
+			t.Fatalf("attempt %d: expected ErrInvalidCredentials, got %v", i+1, err)
+		}
+	}
+	if _, _, err := svc.LoginFrom("lockme", "wrong", "10.0.0.5"); err != ErrAccountLocked {
+		t.Fatalf("expected ErrAccountLocked on threshold attempt, got %v", err)
+	}
+
+	// Correct password is rejected while locked
+	if _, _, err := svc.LoginFrom("lockme", "correct", "10.0.0.5"); err != ErrAccountLocked {
+		t.Fatalf("expected ErrAccountLocked for locked account, got %v", err)
+	}
+
+	got, err := svc.GetUser(user.ID)
+	if err != nil {
+		t.Fatalf("GetUser failed: %v", err)
+	}
+	if got.LockedAt == nil {
+		t.Error("expected locked_at to be set")
+	}
+
+	if err := svc.UnlockUser(user.ID); err != nil {
+		t.Fatalf("UnlockUser failed: %v", err)
+	}
+	if _, _, err := svc.LoginFrom("lockme", "correct", "10.0.0.6"); err != nil {
+		t.Fatalf("expected login after unlock to succeed, got %v", err)
+	}
+
+	got, _ = svc.GetUser(user.ID)
+	if got.FailedLoginAttempts != 0 || got.LockedAt != nil {
+		t.Errorf("expected counters reset, got attempts=%d locked_at=%v", got.FailedLoginAttempts, got.LockedAt)
+	}
+	if got.LastLoginAt == nil || got.LastLoginIP != "10.0.0.6" {
+		t.Errorf("expected last login recorded from 10.0.0.6, got %v / %q", got.LastLoginAt, got.LastLoginIP)
+	}
+
+	history, err := svc.GetLoginHistory(user.ID, 100)
+	if err != nil {
+		t.Fatalf("GetLoginHistory failed: %v", err)
+	}
+	if len(history) != 5 {
+		t.Fatalf("expected 5 login history entries, got %d", len(history))
+	}
+	if !history[0].Success || history[0].IPAddress != "10.0.0.6" {
+		t.Errorf("expected newest entry to be the successful login, got %+v", history[0])
+	}
+
+	if err := svc.UnlockUser(9999); err != ErrUserNotFound {
+		t.Errorf("expected ErrUserNotFound unlocking missing user, got %v", err)
+	}
+}
+
+func TestAccountLockoutDisabled(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	svc := NewService(db, "test-secret", 24)
+	svc.SetMaxFailedLogins(0)
+
+	for i := 0; i < 10; i++ {
+		if _, _, err := svc.Login("admin", "wrong"); err != ErrInvalidCredentials {
+			t.Fatalf("expected ErrInvalidCredentials with lockout disabled, got %v", err)
+		}
+	}
+	if _, _, err := svc.Login("admin", "changeme"); err != nil {
+		t.Fatalf("expected login to succeed with lockout disabled, got %v", err)
+	}
+}
+
+func TestAccountLockoutExpires(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	svc := NewService(db, "test-secret", 24)
+	svc.SetMaxFailedLogins(2)
+	svc.SetLockoutDuration(time.Minute)
+
+	svc.Login("admin", "wrong")
+	if _, _, err := svc.Login("admin", "wrong"); err != ErrAccountLocked {
+		t.Fatalf("expected ErrAccountLocked, got %v", err)
+	}
+	if _, _, err := svc.Login("admin", "changeme"); err != ErrAccountLocked {
+		t.Fatalf("expected the lock to hold, got %v", err)
+	}
+
+	// Move the lock into the past
+	if _, err := db.Exec("UPDATE users SET locked_until = ? WHERE username = 'admin'", time.Now().Add(-time.Second)); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := svc.Login("admin", "changeme"); err != nil {
+		t.Fatalf("expected login to succeed once the lock expired, got %v", err)
+	}
+	// The failure count started over with the expiry
+	if _, _, err := svc.Login("admin", "wrong"); err != ErrInvalidCredentials {
+		t.Fatalf("expected ErrInvalidCredentials after the expiry, got %v", err)
+	}
+}
+
+func TestAccountLockoutDisabledIgnoresLock(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	if _, err := db.Exec("UPDATE users SET failed_login_attempts = 9, locked_at = CURRENT_TIMESTAMP, locked_until = ? WHERE username = 'admin'", time.Now().Add(time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	svc := NewService(db, "test-secret", 24)
+	svc.SetMaxFailedLogins(0)
+	if _, _, err := svc.Login("admin", "changeme"); err != nil {
+		t.Fatalf("expected a lock to be ignored with lockout disabled, got %v", err)
+	}
+}
+
+func TestAccountLockoutCountsConcurrentFailures(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	svc := NewService(db, "test-secret", 24)
+	svc.SetMaxFailedLogins(100)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			svc.Login("admin", "wrong")
+		}()
+	}
+	wg.Wait()
+
+	var attempts int
+	db.QueryRow("SELECT failed_login_attempts FROM users WHERE username = 'admin'").Scan(&attempts)
+	if attempts != 8 {
+		t.Errorf("expected 8 failed attempts, got %d", attempts)
+	}
+}
+
+func TestUnlockUsername(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	svc := NewService(db, "test-secret", 24)
+	svc.SetMaxFailedLogins(1)
+	if _, _, err := svc.Login("admin", "wrong"); err != ErrAccountLocked {
+		t.Fatalf("expected ErrAccountLocked, got %v", err)
+	}
+	if err := svc.UnlockUsername("admin"); err != nil {
+		t.Fatalf("UnlockUsername failed: %v", err)
+	}
+	if _, _, err := svc.Login("admin", "changeme"); err != nil {
+		t.Fatalf("expected login to succeed after unlock, got %v", err)
+	}
+	if err := svc.UnlockUsername("nobody"); err != ErrUserNotFound {
+		t.Errorf("expected ErrUserNotFound, got %v", err)
+	}
+}
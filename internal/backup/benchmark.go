@@ -0,0 +1,485 @@
+package backup
+
+import (
+	"bufio"
+	"context"
+	"crypto/rand"
+	"fmt"
+	"io"
+	mrand "math/rand/v2"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"time"
+
+	"github.com/RoseOO/TapeBackarr/internal/encryption"
+	"github.com/RoseOO/TapeBackarr/internal/models"
+	"github.com/RoseOO/TapeBackarr/internal/tape"
+)
+
+const (
+	// DefaultBenchmarkSize is how much data each benchmark stage pushes
+	// through when no size is requested.
+	DefaultBenchmarkSize = 1024 * 1024 * 1024
+	// DefaultBenchmarkStageTimeout bounds the wall time of a single stage so a
+	// slow stage cannot stall the whole run.
+	DefaultBenchmarkStageTimeout = 8 * time.Second
+)
+
+// Benchmark stage names
+const (
+	BenchStageScan     = "scan"
+	BenchStageRead     = "read"
+	BenchStageCompress = "compress"
+	BenchStageEncrypt  = "encrypt"
+	BenchStageDevice   = "device"
+	BenchStagePipeline = "pipeline"
+)
+
+// BenchmarkOptions configures a pipeline benchmark run.
+type BenchmarkOptions struct {
+	// Source, when set, is scanned and its files are read through tar for the
+	// read stage. Without it the read stage measures the synthetic generator.
+	Source *models.BackupSource
+	// DevicePath is the write target: /dev/null or a virtual backend
+	// (null:, file://, s3://). Defaults to null:.
+	DevicePath   string
+	Compression  models.CompressionType
+	Encrypt      bool
+	SizeBytes    int64
+	StageTimeout time.Duration
+}
+
+// BenchmarkStage is the measured throughput of one pipeline stage.
+type BenchmarkStage struct {
+	Name        string  `json:"name"`
+	Bytes       int64   `json:"bytes"`
+	OutputBytes int64   `json:"output_bytes,omitempty"`
+	Files       int64   `json:"files,omitempty"`
+	DurationMs  int64   `json:"duration_ms"`
+	MBPerSec    float64 `json:"mb_per_sec"`
+	FilesPerSec float64 `json:"files_per_sec,omitempty"`
+	Detail      string  `json:"detail,omitempty"`
+	Skipped     bool    `json:"skipped,omitempty"`
+	Error       string  `json:"error,omitempty"`
+}
+
+// BenchmarkResult reports per-stage throughput and the slowest streaming
+// stage, which bounds what a real backup can achieve.
+type BenchmarkResult struct {
+	DevicePath  string                 `json:"device_path"`
+	Backend     tape.BackendType       `json:"backend"`
+	Compression models.CompressionType `json:"compression"`
+	Encrypted   bool                   `json:"encrypted"`
+	DataSource  string                 `json:"data_source"`
+	Stages      []BenchmarkStage       `json:"stages"`
+	Bottleneck  string                 `json:"bottleneck,omitempty"`
+	StartedAt   time.Time              `json:"started_at"`
+	DurationMs  int64                  `json:"duration_ms"`
+}
+
+// ValidateBenchmarkDevice rejects write targets that could hold real data.
+// Physical drives are refused; only /dev/null and virtual backends are
+// accepted.
+func ValidateBenchmarkDevice(devicePath string) error {
+	if devicePath == "/dev/null" {
+		return nil
+	}
+	if tape.IsPhysicalDevice(devicePath) {
+		return fmt.Errorf("benchmark only writes to /dev/null or a virtual device (null:, file://, s3://), not %s", devicePath)
+	}
+	return tape.ValidateDevicePath(devicePath)
+}
+
+// RunBenchmark measures each stage of the backup pipeline in isolation and
+// then end to end, so users can tell whether the source, the CPU or the
+// target limits throughput. Each stage stops after SizeBytes or StageTimeout,
+// whichever comes first.
+func (s *Service) RunBenchmark(ctx context.Context, opts BenchmarkOptions) (*BenchmarkResult, error) {
+	if opts.DevicePath == "" {
+		opts.DevicePath = "null:"
+	}
+	if err := ValidateBenchmarkDevice(opts.DevicePath); err != nil {
+		return nil, err
+	}
+	if opts.Compression == "" {
+		opts.Compression = models.CompressionNone
+	}
+	if opts.SizeBytes <= 0 {
+		opts.SizeBytes = DefaultBenchmarkSize
+	}
+	if opts.StageTimeout <= 0 {
+		opts.StageTimeout = DefaultBenchmarkStageTimeout
+	}
+
+	result := &BenchmarkResult{
+		DevicePath:  opts.DevicePath,
+		Backend:     tape.BackendTypeOf(opts.DevicePath),
+		Compression: opts.Compression,
+		Encrypted:   opts.Encrypt,
+		DataSource:  "synthetic",
+		StartedAt:   time.Now(),
+	}
+
+	var files []FileInfo
+	if opts.Source != nil {
+		result.DataSource = opts.Source.Path
+		source, release, err := s.mountSource(ctx, opts.Source, "benchmark")
+		if err != nil {
+			return nil, err
+		}
+		defer release()
+		opts.Source = source
+		stage := BenchmarkStage{Name: BenchStageScan}
+		start := time.Now()
+		scanned, err := s.ScanSource(ctx, opts.Source)
+		finishStage(&stage, start)
+		if err != nil {
+			stage.Error = err.Error()
+		} else {
+			files = scanned
+			stage.Files = int64(len(files))
+			for _, f := range files {
+				stage.Bytes += f.Size
+			}
+			if secs := float64(stage.DurationMs) / 1000; secs > 0 {
+				stage.FilesPerSec = float64(stage.Files) / secs
+			}
+			// Scanning stats files rather than streaming them, so a
+			// bytes-per-second figure would be misleading.
+			stage.MBPerSec = 0
+		}
+		result.Stages = append(result.Stages, stage)
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+	}
+
+	// Read: source via tar, or the synthetic generator
+	result.Stages = append(result.Stages, s.benchStage(ctx, BenchStageRead, opts, func(src io.Reader, st *BenchmarkStage) error {
+		n, err := io.Copy(io.Discard, src)
+		st.Bytes = n
+		return err
+	}, files))
+
+	// Compress: synthetic data through the configured compressor
+	if opts.Compression == models.CompressionGzip || opts.Compression == models.CompressionZstd {
+		result.Stages = append(result.Stages, s.benchStage(ctx, BenchStageCompress, opts, func(src io.Reader, st *BenchmarkStage) error {
+			in := &countingReader{reader: src, pipelineDepth: s.pipelineDepth}
+			out, wait, err := benchCompress(ctx, in, opts.Compression)
+			if err != nil {
+				return err
+			}
+			n, copyErr := io.Copy(io.Discard, out)
+			if err := wait(); err != nil && copyErr == nil {
+				copyErr = err
+			}
+			st.Bytes = in.bytesRead()
+			st.OutputBytes = n
+			if n > 0 {
+				st.Detail = fmt.Sprintf("%s ratio %.2f:1", opts.Compression, float64(st.Bytes)/float64(n))
+			}
+			return copyErr
+		}, nil))
+	} else {
+		result.Stages = append(result.Stages, BenchmarkStage{Name: BenchStageCompress, Skipped: true, Detail: fmt.Sprintf("compression %s is not done on the host", opts.Compression)})
+	}
+
+	// Encrypt: synthetic data through the AES-256-GCM stream
+	if opts.Encrypt {
+		result.Stages = append(result.Stages, s.benchStage(ctx, BenchStageEncrypt, opts, func(src io.Reader, st *BenchmarkStage) error {
+			in := &countingReader{reader: src, pipelineDepth: s.pipelineDepth}
+			enc, err := benchEncrypt(in)
+			if err != nil {
+				return err
+			}
+			n, err := io.Copy(io.Discard, enc)
+			st.Bytes = in.bytesRead()
+			st.OutputBytes = n
+			return err
+		}, nil))
+	} else {
+		result.Stages = append(result.Stages, BenchmarkStage{Name: BenchStageEncrypt, Skipped: true, Detail: "encryption not requested"})
+	}
+
+	// Device: synthetic data through the buffer into the target
+	result.Stages = append(result.Stages, s.benchStage(ctx, BenchStageDevice, opts, func(src io.Reader, st *BenchmarkStage) error {
+		n, mode, err := s.benchWrite(ctx, src, opts.DevicePath)
+		st.Bytes = n
+		st.Detail = mode
+		return err
+	}, nil))
+
+	// Pipeline: every enabled stage chained together, as a real backup runs
+	result.Stages = append(result.Stages, s.benchStage(ctx, BenchStagePipeline, opts, func(src io.Reader, st *BenchmarkStage) error {
+		in := &countingReader{reader: src, pipelineDepth: s.pipelineDepth}
+		var stream io.Reader = in
+		wait := func() error { return nil }
+		if opts.Compression == models.CompressionGzip || opts.Compression == models.CompressionZstd {
+			out, w, err := benchCompress(ctx, stream, opts.Compression)
+			if err != nil {
+				return err
+			}
+			stream, wait = out, w
+		}
+		if opts.Encrypt {
+			enc, err := benchEncrypt(stream)
+			if err != nil {
+				return err
+			}
+			stream = enc
+		}
+		n, mode, err := s.benchWrite(ctx, stream, opts.DevicePath)
+		if waitErr := wait(); waitErr != nil && err == nil {
+			err = waitErr
+		}
+		st.Bytes = in.bytesRead()
+		st.OutputBytes = n
+		st.Detail = mode
+		return err
+	}, files))
+
+	if ctx.Err() != nil {
+		return nil, ctx.Err()
+	}
+
+	// The slowest streaming stage bounds the pipeline. Scan runs before
+	// streaming starts and the pipeline row is the combined figure, so
+	// neither is a candidate.
+	slowest := -1.0
+	for _, st := range result.Stages {
+		if st.Skipped || st.Error != "" || st.Name == BenchStageScan || st.Name == BenchStagePipeline {
+			continue
+		}
+		if slowest < 0 || st.MBPerSec < slowest {
+			slowest = st.MBPerSec
+			result.Bottleneck = st.Name
+		}
+	}
+	result.DurationMs = time.Since(result.StartedAt).Milliseconds()
+	return result, nil
+}
+
+// benchStage runs one timed stage. The stage reads from src, which is the
+// tar stream of files when given and synthetic data otherwise, capped by the
+// configured size and time budget.
+func (s *Service) benchStage(ctx context.Context, name string, opts BenchmarkOptions, run func(src io.Reader, st *BenchmarkStage) error, files []FileInfo) BenchmarkStage {
+	stage := BenchmarkStage{Name: name}
+	stageCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var src io.Reader
+	var stop func(kill bool) error
+	if len(files) > 0 {
+		tarOut, tarStop, err := s.benchTar(stageCtx, opts.Source.Path, files)
+		if err != nil {
+			stage.Error = err.Error()
+			return stage
+		}
+		src, stop = tarOut, tarStop
+	} else {
+		src = newSyntheticReader()
+	}
+	limited := &budgetReader{reader: src, remaining: opts.SizeBytes, deadline: time.Now().Add(opts.StageTimeout)}
+
+	start := time.Now()
+	err := run(limited, &stage)
+	finishStage(&stage, start)
+	if stop != nil {
+		// Only kill tar when the stream was cut short by the budget or a
+		// failing stage; otherwise it has written everything and its exit
+		// status is meaningful.
+		if stopErr := stop(limited.exhausted || err != nil); stopErr != nil && err == nil && !limited.exhausted {
+			err = stopErr
+		}
+	}
+	if err != nil {
+		stage.Error = err.Error()
+	}
+	return stage
+}
+
+// finishStage records the stage duration and throughput.
+func finishStage(stage *BenchmarkStage, start time.Time) {
+	elapsed := time.Since(start)
+	stage.DurationMs = elapsed.Milliseconds()
+	if secs := elapsed.Seconds(); secs > 0 {
+		stage.MBPerSec = float64(stage.Bytes) / secs / (1024 * 1024)
+	}
+}
+
+// benchTar starts tar over the scanned files and returns its output. The
+// returned stop function reaps tar, killing it first when kill is set.
+func (s *Service) benchTar(ctx context.Context, sourcePath string, files []FileInfo) (io.Reader, func(kill bool) error, error) {
+	fileList, err := s.scratch.CreateTemp("bench-filelist-*.txt")
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to create file list: %w", err)
+	}
+	fileListPath := fileList.Name()
+	w := bufio.NewWriter(fileList)
+	for _, f := range files {
+		relPath, _ := filepath.Rel(sourcePath, f.Path)
+		fmt.Fprintln(w, relPath)
+	}
+	w.Flush()
+	fileList.Close()
+
+	tarArgs := []string{"-c", "-b", fmt.Sprintf("%d", s.blockSize/512), "-C", sourcePath, "-T", fileListPath}
+	if hasFollowedLinks(files) {
+		tarArgs = append(tarArgs, "--dereference")
+	}
+	tarCmd := exec.CommandContext(ctx, "tar", tarArgs...)
+	tarCmd.Dir = sourcePath
+	pipe, err := tarCmd.StdoutPipe()
+	if err != nil {
+		os.Remove(fileListPath)
+		return nil, nil, fmt.Errorf("failed to create pipe: %w", err)
+	}
+	if err := tarCmd.Start(); err != nil {
+		os.Remove(fileListPath)
+		return nil, nil, fmt.Errorf("failed to start tar: %w", err)
+	}
+	stop := func(kill bool) error {
+		defer os.Remove(fileListPath)
+		if kill {
+			// The stage stopped reading before tar finished; drop the rest.
+			tarCmd.Process.Kill()
+		}
+		if err := tarCmd.Wait(); err != nil {
+			return fmt.Errorf("tar failed: %w", err)
+		}
+		return nil
+	}
+	return pipe, stop, nil
+}
+
+// benchCompress runs src through the compressor and returns its output. wait
+// must be called once the output has been consumed.
+func benchCompress(ctx context.Context, src io.Reader, compression models.CompressionType) (io.Reader, func() error, error) {
+	cmd, err := buildCompressionCmd(ctx, compression)
+	if err != nil {
+		return nil, nil, err
+	}
+	cmd.Stdin = src
+	out, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to create pipe: %w", err)
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, nil, fmt.Errorf("failed to start %s: %w", compression, err)
+	}
+	wait := func() error {
+		if err := cmd.Wait(); err != nil {
+			return fmt.Errorf("%s failed: %w", compression, err)
+		}
+		return nil
+	}
+	return out, wait, nil
+}
+
+// benchEncrypt wraps src in the backup encryption stream with a throwaway key.
+func benchEncrypt(src io.Reader) (io.Reader, error) {
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		return nil, fmt.Errorf("failed to generate key: %w", err)
+	}
+	return encryption.NewEncryptingReader(src, key)
+}
+
+// benchWrite writes src to the target the same way a backup would: through
+// mbuffer when writing to a device node and it is installed, otherwise
+// through the backend writer. It returns the bytes written and the mode used.
+func (s *Service) benchWrite(ctx context.Context, src io.Reader, devicePath string) (int64, string, error) {
+	if s.useMbuffer(devicePath) {
+		mbufferCmd := exec.CommandContext(ctx, "mbuffer", "-q", "-s", fmt.Sprintf("%d", s.blockSize), "-m", fmt.Sprintf("%dM", s.bufferSizeMB), "-P", "90", "-o", devicePath)
+		cr := &countingReader{reader: src, pipelineDepth: s.pipelineDepth}
+		mbufferCmd.Stdin = cr
+		if err := mbufferCmd.Run(); err != nil {
+			return cr.bytesRead(), "mbuffer", fmt.Errorf("mbuffer failed: %w", err)
+		}
+		return cr.bytesRead(), "mbuffer", nil
+	}
+
+	w, err := tape.BackendFor(devicePath).OpenWriter(ctx)
+	if err != nil {
+		return 0, "direct", fmt.Errorf("failed to open %s: %w", devicePath, err)
+	}
+	buffered := bufio.NewWriterSize(w, s.blockSize)
+	cw := &countingWriter{writer: buffered}
+	_, copyErr := io.Copy(cw, src)
+	if copyErr == nil {
+		copyErr = buffered.Flush()
+	}
+	closeErr := w.Close()
+	if copyErr != nil {
+		return cw.bytesWritten(), "direct", fmt.Errorf("write to %s failed: %w", devicePath, copyErr)
+	}
+	if closeErr != nil {
+		return cw.bytesWritten(), "direct", fmt.Errorf("write to %s failed: %w", devicePath, closeErr)
+	}
+	return cw.bytesWritten(), "direct", nil
+}
+
+// budgetReader ends the stream once a byte count or deadline is reached so a
+// stage finishes cleanly instead of being cancelled mid-pipe.
+type budgetReader struct {
+	reader    io.Reader
+	remaining int64
+	deadline  time.Time
+	exhausted bool
+}
+
+func (b *budgetReader) Read(p []byte) (int, error) {
+	if b.remaining <= 0 || time.Now().After(b.deadline) {
+		b.exhausted = true
+		return 0, io.EOF
+	}
+	if int64(len(p)) > b.remaining {
+		p = p[:b.remaining]
+	}
+	n, err := b.reader.Read(p)
+	b.remaining -= int64(n)
+	return n, err
+}
+
+// syntheticBlockSize is the unit the synthetic generator refills in.
+const syntheticBlockSize = 64 * 1024
+
+// syntheticReader produces an endless stream that is roughly half random
+// bytes and half repeated text, so compressors see data that compresses
+// about 2:1 rather than the best or worst case.
+type syntheticReader struct {
+	rng *mrand.ChaCha8
+	buf []byte
+	pos int
+}
+
+func newSyntheticReader() *syntheticReader {
+	var seed [32]byte
+	r := &syntheticReader{rng: mrand.NewChaCha8(seed), buf: make([]byte, syntheticBlockSize)}
+	r.pos = len(r.buf)
+	return r
+}
+
+func (r *syntheticReader) fill() {
+	half := len(r.buf) / 2
+	r.rng.Read(r.buf[:half])
+	const text = "TapeBackarr synthetic benchmark data 0123456789 "
+	for i := half; i < len(r.buf); i++ {
+		r.buf[i] = text[i%len(text)]
+	}
+	r.pos = 0
+}
+
+func (r *syntheticReader) Read(p []byte) (int, error) {
+	n := 0
+	for n < len(p) {
+		if r.pos == len(r.buf) {
+			r.fill()
+		}
+		c := copy(p[n:], r.buf[r.pos:])
+		r.pos += c
+		n += c
+	}
+	return n, nil
+}
@@ -0,0 +1,140 @@
+package backup
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/RoseOO/TapeBackarr/internal/models"
+)
+
+func findStage(result *BenchmarkResult, name string) *BenchmarkStage {
+	for i := range result.Stages {
+		if result.Stages[i].Name == name {
+			return &result.Stages[i]
+		}
+	}
+	return nil
+}
+
+func TestValidateBenchmarkDevice(t *testing.T) {
+	for _, p := range []string{"/dev/null", "null:", "file://" + t.TempDir()} {
+		if err := ValidateBenchmarkDevice(p); err != nil {
+			t.Errorf("expected %q to be accepted, got %v", p, err)
+		}
+	}
+	for _, p := range []string{"/dev/nst0", "file://relative"} {
+		if err := ValidateBenchmarkDevice(p); err == nil {
+			t.Errorf("expected %q to be rejected", p)
+		}
+	}
+}
+
+func TestRunBenchmarkSynthetic(t *testing.T) {
+	svc := NewService(nil, nil, nil, 65536, 512, 0)
+	const size = 4 * 1024 * 1024
+
+	result, err := svc.RunBenchmark(context.Background(), BenchmarkOptions{
+		Encrypt:   true,
+		SizeBytes: size,
+	})
+	if err != nil {
+		t.Fatalf("RunBenchmark: %v", err)
+	}
+	if result.DevicePath != "null:" || result.DataSource != "synthetic" {
+		t.Errorf("unexpected defaults: %+v", result)
+	}
+	if findStage(result, BenchStageScan) != nil {
+		t.Error("expected no scan stage without a source")
+	}
+	if st := findStage(result, BenchStageCompress); st == nil || !st.Skipped {
+		t.Errorf("expected compress stage to be skipped, got %+v", st)
+	}
+	for _, name := range []string{BenchStageRead, BenchStageEncrypt, BenchStageDevice, BenchStagePipeline} {
+		st := findStage(result, name)
+		if st == nil {
+			t.Fatalf("missing stage %s", name)
+		}
+		if st.Error != "" {
+			t.Errorf("stage %s failed: %s", name, st.Error)
+		}
+		if st.Bytes != size {
+			t.Errorf("stage %s: expected %d bytes, got %d", name, size, st.Bytes)
+		}
+	}
+	// Encryption adds a header and per-chunk tags
+	if st := findStage(result, BenchStagePipeline); st.OutputBytes <= size {
+		t.Errorf("expected encrypted pipeline output to exceed input, got %d", st.OutputBytes)
+	}
+	if result.Bottleneck == "" || result.Bottleneck == BenchStagePipeline {
+		t.Errorf("expected a streaming stage as bottleneck, got %q", result.Bottleneck)
+	}
+}
+
+func TestRunBenchmarkCompression(t *testing.T) {
+	if _, err := exec.LookPath("gzip"); err != nil {
+		t.Skip("gzip not installed")
+	}
+	svc := NewService(nil, nil, nil, 65536, 512, 0)
+	result, err := svc.RunBenchmark(context.Background(), BenchmarkOptions{
+		Compression: models.CompressionGzip,
+		SizeBytes:   2 * 1024 * 1024,
+	})
+	if err != nil {
+		t.Fatalf("RunBenchmark: %v", err)
+	}
+	st := findStage(result, BenchStageCompress)
+	if st == nil || st.Skipped || st.Error != "" {
+		t.Fatalf("expected compress stage to run, got %+v", st)
+	}
+	// Synthetic data is about half repeated text
+	if st.OutputBytes == 0 || st.OutputBytes >= st.Bytes {
+		t.Errorf("expected synthetic data to compress, got %d -> %d", st.Bytes, st.OutputBytes)
+	}
+}
+
+func TestRunBenchmarkSource(t *testing.T) {
+	if _, err := exec.LookPath("tar"); err != nil {
+		t.Skip("tar not installed")
+	}
+	dir := t.TempDir()
+	for i := 0; i < 5; i++ {
+		name := filepath.Join(dir, "file"+string(rune('a'+i))+".dat")
+		if err := os.WriteFile(name, []byte(strings.Repeat("x", 100000)), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	svc := NewService(nil, nil, nil, 65536, 512, 0)
+	result, err := svc.RunBenchmark(context.Background(), BenchmarkOptions{
+		Source:     &models.BackupSource{Path: dir},
+		DevicePath: "file://" + t.TempDir(),
+		SizeBytes:  64 * 1024 * 1024,
+	})
+	if err != nil {
+		t.Fatalf("RunBenchmark: %v", err)
+	}
+	scan := findStage(result, BenchStageScan)
+	if scan == nil || scan.Files != 5 || scan.Bytes != 500000 {
+		t.Fatalf("unexpected scan stage %+v", scan)
+	}
+	read := findStage(result, BenchStageRead)
+	if read.Error != "" || read.Bytes < 500000 {
+		t.Errorf("expected tar stream of the source, got %+v", read)
+	}
+	// The whole source is smaller than the budget, so the pipeline carries
+	// exactly the tar stream.
+	if p := findStage(result, BenchStagePipeline); p.Error != "" || p.Bytes != read.Bytes {
+		t.Errorf("expected pipeline to carry %d bytes, got %+v", read.Bytes, p)
+	}
+}
+
+func TestRunBenchmarkRejectsPhysicalDrive(t *testing.T) {
+	svc := NewService(nil, nil, nil, 65536, 512, 0)
+	if _, err := svc.RunBenchmark(context.Background(), BenchmarkOptions{DevicePath: "/dev/nst0"}); err == nil {
+		t.Error("expected a physical drive to be refused")
+	}
+}
@@ -0,0 +1,178 @@
+package backup
+
+import (
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+)
+
+const (
+	// catalogBatchSize is the number of catalog rows inserted per transaction
+	catalogBatchSize = 500
+	// catalogQueueBatches is how many batches may wait for the database
+	// before add blocks
+	catalogQueueBatches = 8
+)
+
+// catalogWriter inserts the catalog entries of a backup set in batched
+// transactions while tar streams the files to tape, so a backup of millions
+// of files does not wait for one large insert once the stream ends. The
+// checksum pass after streaming then only fills in each entry's checksum.
+// The queue is bounded: when the database falls behind, add blocks until a
+// batch is committed instead of holding every pending row in memory.
+type catalogWriter struct {
+	s           *Service
+	backupSetID int64
+	sourcePath  string
+
+	batches   chan []FileInfo
+	stop      chan struct{} // closed to stop writing
+	finish    chan struct{} // closed once no more files are added
+	done      chan struct{}
+	feeders   sync.WaitGroup
+	closeOnce sync.Once
+	stopOnce  sync.Once
+	written   int64 // accessed atomically
+}
+
+// startCatalogWriter starts cataloging files of a backup set as they are
+// added. close must be called once every file has been added.
+func (s *Service) startCatalogWriter(backupSetID int64, sourcePath string) *catalogWriter {
+	cw := &catalogWriter{
+		s:           s,
+		backupSetID: backupSetID,
+		sourcePath:  sourcePath,
+		batches:     make(chan []FileInfo, catalogQueueBatches),
+		stop:        make(chan struct{}),
+		finish:      make(chan struct{}),
+		done:        make(chan struct{}),
+	}
+	go cw.run()
+	return cw
+}
+
+// add queues files for cataloging, blocking while the queue is full. Files
+// added after close are not cataloged.
+func (cw *catalogWriter) add(files []FileInfo) {
+	for len(files) > 0 {
+		n := len(files)
+		if n > catalogBatchSize {
+			n = catalogBatchSize
+		}
+		select {
+		case cw.batches <- files[:n]:
+		case <-cw.stop:
+			return
+		case <-cw.finish:
+			return
+		}
+		files = files[n:]
+	}
+}
+
+// feed adds files from a goroutine of its own, so the caller can start
+// streaming while they are cataloged
+func (cw *catalogWriter) feed(files []FileInfo) {
+	cw.feeders.Add(1)
+	go func() {
+		defer cw.feeders.Done()
+		cw.add(files)
+	}()
+}
+
+// close waits until every added file is cataloged
+func (cw *catalogWriter) close() {
+	cw.closeOnce.Do(func() {
+		cw.feeders.Wait()
+		close(cw.finish)
+	})
+	<-cw.done
+}
+
+// discard stops cataloging and removes the entries written so far, for a
+// backup set whose stream failed
+func (cw *catalogWriter) discard() {
+	cw.stopOnce.Do(func() { close(cw.stop) })
+	cw.close()
+	if cw.s.db != nil {
+		cw.s.db.Exec("DELETE FROM catalog_entries WHERE backup_set_id = ? AND ref_backup_set_id IS NULL", cw.backupSetID)
+	}
+}
+
+// cataloged returns the number of entries inserted so far
+func (cw *catalogWriter) cataloged() int64 {
+	return atomic.LoadInt64(&cw.written)
+}
+
+func (cw *catalogWriter) run() {
+	defer close(cw.done)
+	for {
+		select {
+		case batch := <-cw.batches:
+			cw.write(batch)
+		case <-cw.finish:
+			// Write what is still queued
+			for {
+				select {
+				case batch := <-cw.batches:
+					cw.write(batch)
+				default:
+					return
+				}
+			}
+		}
+	}
+}
+
+// write inserts a batch unless cataloging was stopped
+func (cw *catalogWriter) write(batch []FileInfo) {
+	select {
+	case <-cw.stop:
+	default:
+		cw.insert(batch)
+	}
+}
+
+// insert writes one batch of entries. An entry the checksum pass already
+// wrote is left alone.
+func (cw *catalogWriter) insert(batch []FileInfo) {
+	if cw.s.db == nil {
+		return
+	}
+	tx, err := cw.s.db.Begin()
+	if err != nil {
+		return
+	}
+	stmt, err := tx.Prepare(`
+		INSERT OR IGNORE INTO catalog_entries (backup_set_id, file_path, file_size, file_mode, mod_time,
+			uid, gid, owner, group_name, file_type, link_target, has_xattrs, extension, content_class)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`)
+	if err != nil {
+		tx.Rollback()
+		return
+	}
+	var n int64
+	for _, fi := range batch {
+		relPath, relErr := filepath.Rel(cw.sourcePath, fi.Path)
+		if relErr != nil {
+			relPath = fi.Path // fall back to absolute path
+		}
+		ext, class := classifyPath(relPath)
+		if _, err := stmt.Exec(cw.backupSetID, relPath, fi.Size, fi.Mode, fi.ModTime,
+			fi.UID, fi.GID, fi.Owner, fi.Group, fi.FileType, fi.LinkTarget, fi.HasXattrs, ext, class); err != nil {
+			if cw.s.logger != nil {
+				cw.s.logger.Warn("Failed to insert catalog entry", map[string]interface{}{
+					"file":  relPath,
+					"error": err.Error(),
+				})
+			}
+			continue
+		}
+		n++
+	}
+	stmt.Close()
+	if tx.Commit() == nil {
+		atomic.AddInt64(&cw.written, n)
+	}
+}
@@ -0,0 +1,69 @@
+package backup
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/RoseOO/TapeBackarr/internal/database"
+)
+
+func TestCatalogWriter(t *testing.T) {
+	db, err := database.New(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("failed to create database: %v", err)
+	}
+	defer db.Close()
+	if err := db.Migrate(); err != nil {
+		t.Fatalf("failed to migrate database: %v", err)
+	}
+	db.Exec("INSERT INTO tape_pools (name) VALUES ('p')")
+	db.Exec("INSERT INTO tapes (uuid, barcode, label, pool_id, status) VALUES ('u1', 'CW0001', 'CW0001', 1, 'active')")
+	db.Exec("INSERT INTO backup_sources (name, source_type, path) VALUES ('s', 'local', '/src')")
+	db.Exec("INSERT INTO backup_jobs (name, source_id, pool_id, backup_type) VALUES ('j', 1, 1, 'full')")
+	db.Exec("INSERT INTO backup_sets (job_id, tape_id, backup_type, start_time, status) VALUES (1, 1, 'full', CURRENT_TIMESTAMP, 'running')")
+	db.Exec("INSERT INTO backup_sets (job_id, tape_id, backup_type, start_time, status) VALUES (1, 1, 'full', CURRENT_TIMESTAMP, 'running')")
+	svc := NewService(db, nil, nil, 65536, 0, 0)
+
+	srcDir := t.TempDir()
+	var files []FileInfo
+	for i := 0; i < 3*catalogBatchSize+7; i++ {
+		files = append(files, FileInfo{Path: filepath.Join(srcDir, fmt.Sprintf("f%04d", i)), Size: int64(i), ModTime: time.Now(), FileType: FileTypeFile})
+	}
+
+	// Entries written from a feed and from direct adds all land, in batches
+	cw := svc.startCatalogWriter(1, srcDir)
+	cw.feed(files[:catalogBatchSize*2])
+	cw.add(files[catalogBatchSize*2:])
+	cw.close()
+	cw.close()
+	var count int
+	db.QueryRow("SELECT COUNT(*) FROM catalog_entries WHERE backup_set_id = 1").Scan(&count)
+	if count != len(files) || cw.cataloged() != int64(len(files)) {
+		t.Fatalf("expected %d entries, got %d (writer counted %d)", len(files), count, cw.cataloged())
+	}
+
+	// The checksum pass fills in checksums instead of adding rows
+	os.WriteFile(files[0].Path, []byte("data"), 0644)
+	svc.computeChecksumsAsync(context.Background(), files[:1], &sync.Map{}, 1, srcDir)
+	var checksum string
+	db.QueryRow("SELECT COUNT(*) FROM catalog_entries WHERE backup_set_id = 1").Scan(&count)
+	db.QueryRow("SELECT COALESCE(checksum, '') FROM catalog_entries WHERE backup_set_id = 1 AND file_path = 'f0000'").Scan(&checksum)
+	if count != len(files) || checksum == "" {
+		t.Fatalf("expected the checksum to be filled in without new rows, got %d rows and checksum %q", count, checksum)
+	}
+
+	// A failed stream discards what was cataloged, and later adds are dropped
+	cw = svc.startCatalogWriter(2, srcDir)
+	cw.add(files[:10])
+	cw.discard()
+	cw.add(files)
+	db.QueryRow("SELECT COUNT(*) FROM catalog_entries WHERE backup_set_id = 2").Scan(&count)
+	if count != 0 {
+		t.Errorf("expected discarded entries to be removed, got %d", count)
+	}
+}
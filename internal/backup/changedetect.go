@@ -0,0 +1,171 @@
+package backup
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"io"
+	"os"
+	"runtime"
+	"strings"
+	"sync"
+
+	"github.com/RoseOO/TapeBackarr/internal/models"
+)
+
+// hashSampleSize is the length of each of the three regions a sampled hash
+// reads: the start, the middle and the end of the file
+const hashSampleSize = 1 << 20
+
+// sampledHashPrefix marks sampled hashes so they are never compared with the
+// full SHA256 checksums recorded in the catalog
+const sampledHashPrefix = "sampled:"
+
+// sampledChecksum hashes a file's size and its first, middle and last MiB.
+// Files no larger than the three samples are hashed whole. An in-place edit
+// outside the samples goes unnoticed; that is the price of reading at most
+// 3 MiB per file.
+func sampledChecksum(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return "", err
+	}
+	size := info.Size()
+
+	h := sha256.New()
+	binary.Write(h, binary.BigEndian, size)
+	if size <= 3*hashSampleSize {
+		if _, err := io.Copy(h, f); err != nil {
+			return "", err
+		}
+	} else {
+		for _, off := range []int64{0, size/2 - hashSampleSize/2, size - hashSampleSize} {
+			if _, err := io.Copy(h, io.NewSectionReader(f, off, hashSampleSize)); err != nil {
+				return "", err
+			}
+		}
+	}
+	return sampledHashPrefix + hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// contentHash hashes a file for change detection, in full or sampled
+func (s *Service) contentHash(path string, sampled bool) (string, error) {
+	if sampled {
+		return sampledChecksum(path)
+	}
+	return s.CalculateChecksum(path)
+}
+
+// hashesComparable reports whether two change detection hashes were both
+// taken, and taken the same way
+func hashesComparable(a, b string) bool {
+	return a != "" && b != "" && strings.HasPrefix(a, sampledHashPrefix) == strings.HasPrefix(b, sampledHashPrefix)
+}
+
+// hashesDiffer reports whether two hashes prove that content changed. Files
+// without a comparable earlier hash, such as on the first run after hashing
+// was enabled, fall back to size and modification time.
+func hashesDiffer(a, b string) bool {
+	return hashesComparable(a, b) && a != b
+}
+
+// ctimeMoved reports whether a file's ctime changed since the previous
+// snapshot. Snapshots taken before ctimes were recorded never count as moved.
+func ctimeMoved(f, prev FileInfo) bool {
+	return f.ChangeTime != 0 && prev.ChangeTime != 0 && f.ChangeTime != prev.ChangeTime
+}
+
+// hashChangeCandidates sets Hash on the files whose size and modification
+// time match the previous snapshot, so changeFilter can tell in-place edits
+// that preserved both. The hash mode hashes all of them; the hybrid mode only
+// those whose ctime moved and carries the previous hash forward for the rest.
+// It returns the number of files read.
+func (s *Service) hashChangeCandidates(ctx context.Context, files, previous []FileInfo, mode models.ChangeDetection, sampled bool) int {
+	if mode != models.ChangeDetectionHash && mode != models.ChangeDetectionHybrid {
+		return 0
+	}
+	prevMap := make(map[string]FileInfo, len(previous))
+	for _, f := range previous {
+		prevMap[f.Path] = f
+	}
+
+	var todo []int
+	for i, f := range files {
+		prev, ok := prevMap[f.Path]
+		if !ok || f.Size != prev.Size || f.ModTime.After(prev.ModTime) || !os.FileMode(f.Mode).IsRegular() {
+			continue
+		}
+		if mode == models.ChangeDetectionHybrid && !ctimeMoved(f, prev) {
+			files[i].Hash = prev.Hash
+			continue
+		}
+		todo = append(todo, i)
+	}
+	s.hashFiles(ctx, files, todo, sampled)
+	return len(todo)
+}
+
+// hashFiles sets Hash on files[i] for every index, reading several files at
+// a time. Files that cannot be read are left without a hash.
+func (s *Service) hashFiles(ctx context.Context, files []FileInfo, indexes []int, sampled bool) {
+	numWorkers := runtime.NumCPU()
+	if numWorkers < 4 {
+		numWorkers = 4
+	}
+	if numWorkers > 16 {
+		numWorkers = 16
+	}
+
+	work := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < numWorkers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range work {
+				if hash, err := s.contentHash(files[i].Path, sampled); err == nil {
+					files[i].Hash = hash
+				}
+			}
+		}()
+	}
+	for _, i := range indexes {
+		if ctx.Err() != nil {
+			break
+		}
+		work <- i
+	}
+	close(work)
+	wg.Wait()
+}
+
+// recordWrittenHashes sets Hash on snapshot files that were written by this
+// run, so the next run has a hash to compare against. Full hashes come from
+// the checksums computed for the catalog; sampled ones are taken afresh.
+func (s *Service) recordWrittenHashes(ctx context.Context, snapshot, written []FileInfo, checksums *sync.Map, sampled bool) {
+	writtenPaths := make(map[string]struct{}, len(written))
+	for _, f := range written {
+		writtenPaths[f.Path] = struct{}{}
+	}
+
+	var todo []int
+	for i, f := range snapshot {
+		// Files found changed by their hash were hashed already
+		if _, ok := writtenPaths[f.Path]; !ok || f.Hash != "" || !os.FileMode(f.Mode).IsRegular() {
+			continue
+		}
+		if sampled {
+			todo = append(todo, i)
+		} else if sum, ok := checksums.Load(f.Path); ok {
+			snapshot[i].Hash = sum.(string)
+		}
+	}
+	s.hashFiles(ctx, snapshot, todo, sampled)
+}
@@ -0,0 +1,139 @@
+package backup
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/RoseOO/TapeBackarr/internal/models"
+)
+
+func TestChangeFilterModes(t *testing.T) {
+	mtime := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	previous := []FileInfo{
+		{Path: "/data/same", Size: 5, Mode: 0644, ModTime: mtime, Hash: "aaa", ChangeTime: 1},
+		{Path: "/data/edited", Size: 5, Mode: 0644, ModTime: mtime, Hash: "bbb", ChangeTime: 1},
+		{Path: "/data/touched", Size: 5, Mode: 0644, ModTime: mtime, ChangeTime: 1},
+		{Path: "/data/resampled", Size: 5, Mode: 0644, ModTime: mtime, Hash: "ccc", ChangeTime: 1},
+	}
+	current := []FileInfo{
+		{Path: "/data/same", Size: 5, Mode: 0644, ModTime: mtime, Hash: "aaa", ChangeTime: 1},
+		{Path: "/data/edited", Size: 5, Mode: 0644, ModTime: mtime, Hash: "xxx", ChangeTime: 2},
+		{Path: "/data/touched", Size: 5, Mode: 0644, ModTime: mtime, Hash: "ddd", ChangeTime: 2},
+		{Path: "/data/resampled", Size: 5, Mode: 0644, ModTime: mtime, Hash: sampledHashPrefix + "ccc", ChangeTime: 1},
+		{Path: "/data/new", Size: 1, Mode: 0644, ModTime: mtime},
+	}
+
+	cases := []struct {
+		mode models.ChangeDetection
+		want []string
+	}{
+		{models.ChangeDetectionMetadata, []string{"/data/new"}},
+		// A hash taken another way, or no earlier hash, is not evidence of a change
+		{models.ChangeDetectionHash, []string{"/data/edited", "/data/new"}},
+		// A moved ctime without an earlier hash counts as a change
+		{models.ChangeDetectionHybrid, []string{"/data/edited", "/data/touched", "/data/new"}},
+	}
+	for _, tc := range cases {
+		var got []string
+		for _, f := range changeFilter(previous, tc.mode)(current) {
+			got = append(got, f.Path)
+		}
+		if strings.Join(got, ",") != strings.Join(tc.want, ",") {
+			t.Errorf("%s: expected %v, got %v", tc.mode, tc.want, got)
+		}
+	}
+}
+
+func TestHashChangeCandidates(t *testing.T) {
+	tmpDir := t.TempDir()
+	mtime := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	for _, name := range []string{"a", "b", "c"} {
+		os.WriteFile(filepath.Join(tmpDir, name), []byte("content "+name), 0644)
+	}
+	files := func() []FileInfo {
+		return []FileInfo{
+			{Path: filepath.Join(tmpDir, "a"), Size: 9, Mode: 0644, ModTime: mtime, ChangeTime: 1},
+			{Path: filepath.Join(tmpDir, "b"), Size: 9, Mode: 0644, ModTime: mtime, ChangeTime: 2},
+			{Path: filepath.Join(tmpDir, "c"), Size: 10, Mode: 0644, ModTime: mtime, ChangeTime: 1},
+		}
+	}
+	previous := []FileInfo{
+		{Path: filepath.Join(tmpDir, "a"), Size: 9, Mode: 0644, ModTime: mtime, ChangeTime: 1, Hash: "old-a"},
+		{Path: filepath.Join(tmpDir, "b"), Size: 9, Mode: 0644, ModTime: mtime, ChangeTime: 1, Hash: "old-b"},
+		{Path: filepath.Join(tmpDir, "c"), Size: 9, Mode: 0644, ModTime: mtime, ChangeTime: 1, Hash: "old-c"},
+	}
+	svc := &Service{}
+
+	// The hash mode reads every file whose metadata is unchanged; c changed
+	// size and is backed up anyway
+	current := files()
+	if n := svc.hashChangeCandidates(context.Background(), current, previous, models.ChangeDetectionHash, false); n != 2 {
+		t.Errorf("expected 2 files hashed, got %d", n)
+	}
+	want, _ := svc.CalculateChecksum(current[0].Path)
+	if current[0].Hash != want || current[1].Hash == "" || current[2].Hash != "" {
+		t.Errorf("unexpected hashes %q %q %q", current[0].Hash, current[1].Hash, current[2].Hash)
+	}
+
+	// The hybrid mode only reads b, whose ctime moved, and keeps a's hash
+	current = files()
+	if n := svc.hashChangeCandidates(context.Background(), current, previous, models.ChangeDetectionHybrid, true); n != 1 {
+		t.Errorf("expected 1 file hashed, got %d", n)
+	}
+	if current[0].Hash != "old-a" || !strings.HasPrefix(current[1].Hash, sampledHashPrefix) {
+		t.Errorf("unexpected hashes %q %q", current[0].Hash, current[1].Hash)
+	}
+
+	current = files()
+	if n := svc.hashChangeCandidates(context.Background(), current, previous, models.ChangeDetectionMetadata, false); n != 0 || current[0].Hash != "" {
+		t.Errorf("expected no hashing in metadata mode, got %d", n)
+	}
+}
+
+func TestSampledChecksum(t *testing.T) {
+	tmpDir := t.TempDir()
+	path := filepath.Join(tmpDir, "big.bin")
+	data := make([]byte, 4*hashSampleSize)
+	os.WriteFile(path, data, 0644)
+	before, err := sampledChecksum(path)
+	if err != nil {
+		t.Fatalf("sampledChecksum failed: %v", err)
+	}
+
+	// An edit between the samples goes unnoticed; one inside a sample does not
+	f, _ := os.OpenFile(path, os.O_WRONLY, 0)
+	f.WriteAt([]byte{1}, hashSampleSize+10)
+	f.Close()
+	if got, _ := sampledChecksum(path); got != before {
+		t.Error("expected an edit outside the samples to keep the hash")
+	}
+	f, _ = os.OpenFile(path, os.O_WRONLY, 0)
+	f.WriteAt([]byte{1}, 2*hashSampleSize)
+	f.Close()
+	if got, _ := sampledChecksum(path); got == before {
+		t.Error("expected an edit in the middle sample to change the hash")
+	}
+}
+
+func TestDeletedSince(t *testing.T) {
+	previous := []FileInfo{
+		{Path: "/data/kept"}, {Path: "/data/gone"}, {Path: "/data/old/a"}, {Path: "/data/locked/b"}, {Path: "/data/lockedfile"},
+	}
+	current := []FileInfo{{Path: "/data/kept"}, {Path: "/data/new"}}
+	skipped := NewSkipReport()
+	skipped.Add("/data/locked", SkipPermissionDenied, "")
+	skipped.Add("/data/lockedfile", SkipPermissionDenied, "")
+
+	// Unreadable paths are not deletions
+	got := deletedSince("/data", previous, current, skipped)
+	if strings.Join(got, ",") != "gone,old/a" {
+		t.Errorf("expected gone and old/a, got %v", got)
+	}
+	if got := deletedSince("/data", previous, previous, nil); len(got) != 0 {
+		t.Errorf("expected no deletions, got %v", got)
+	}
+}
@@ -0,0 +1,14 @@
+package backup
+
+import (
+	"os"
+	"syscall"
+)
+
+// changeTime returns the ctime of a file in Unix nanoseconds
+func changeTime(info os.FileInfo) int64 {
+	if st, ok := info.Sys().(*syscall.Stat_t); ok {
+		return st.Ctim.Nano()
+	}
+	return 0
+}
@@ -0,0 +1,11 @@
+//go:build !linux
+
+package backup
+
+import "os"
+
+// changeTime returns 0: ctime is only read on Linux, and hybrid change
+// detection falls back to size and modification time elsewhere
+func changeTime(info os.FileInfo) int64 {
+	return 0
+}
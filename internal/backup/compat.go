@@ -0,0 +1,66 @@
+package backup
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/RoseOO/TapeBackarr/internal/models"
+)
+
+// ErrIncompatibleMedia is returned when a tape's LTO generation cannot be
+// written by the drives available to a backup.
+var ErrIncompatibleMedia = errors.New("incompatible tape media")
+
+// CheckTapeWritable verifies that the tape's LTO generation can be written by
+// the drive it is loaded in or, when it is not loaded, by at least one enabled
+// drive. The drive generation comes from the inquiry product ID recorded for
+// each drive; tapes or drives of unknown generation are never rejected.
+func (s *Service) CheckTapeWritable(tapeID int64) error {
+	var label, ltoType string
+	if err := s.db.QueryRow("SELECT label, COALESCE(lto_type, '') FROM tapes WHERE id = ?", tapeID).Scan(&label, &ltoType); err != nil {
+		return fmt.Errorf("tape not found: %w", err)
+	}
+	if ltoType == "" {
+		return nil
+	}
+
+	rows, err := s.db.Query(`
+		SELECT COALESCE(NULLIF(display_name, ''), device_path), COALESCE(model, ''),
+		       COALESCE(current_tape_id = ?, 0)
+		FROM tape_drives WHERE COALESCE(enabled, 1) = 1
+	`, tapeID)
+	if err != nil {
+		return fmt.Errorf("failed to list drives: %w", err)
+	}
+	defer rows.Close()
+
+	compatible := false
+	var rejected []string
+	for rows.Next() {
+		var name, model string
+		var loaded bool
+		if err := rows.Scan(&name, &model, &loaded); err != nil {
+			continue
+		}
+		driveType, known := models.LTOTypeFromDriveModel(model)
+		compatErr := models.CheckLTOCompatibility(driveType, ltoType, true)
+		if loaded {
+			// The backup will use this drive, so it alone decides
+			if known && compatErr != nil {
+				return fmt.Errorf("%w: tape %s is loaded in drive %s: %v", ErrIncompatibleMedia, label, name, compatErr)
+			}
+			return nil
+		}
+		if !known || compatErr == nil {
+			compatible = true
+		} else {
+			rejected = append(rejected, fmt.Sprintf("%s (%s)", name, driveType))
+		}
+	}
+	if !compatible && len(rejected) > 0 {
+		return fmt.Errorf("%w: no enabled drive can write %s tape %s (drives: %s)",
+			ErrIncompatibleMedia, ltoType, label, strings.Join(rejected, ", "))
+	}
+	return nil
+}
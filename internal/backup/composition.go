@@ -0,0 +1,137 @@
+package backup
+
+import (
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// RootDirectory is the directory under which files directly in the source
+// root are reported
+const RootDirectory = "."
+
+// DirectoryUsage is what one top-level directory of the source contributed
+// to a backup set
+type DirectoryUsage struct {
+	Directory string `json:"directory"`
+	Files     int64  `json:"files"`
+	Bytes     int64  `json:"bytes"`
+}
+
+// DirectoryComposition is a directory's share of a backup set, compared with
+// the previous run that has a report. The deltas are nil without one.
+type DirectoryComposition struct {
+	DirectoryUsage
+	Percent    float64 `json:"percent"`
+	FilesDelta *int64  `json:"files_delta"`
+	BytesDelta *int64  `json:"bytes_delta"`
+}
+
+// directoryUsage totals files by the top-level directory of the source they
+// are in, largest first
+func directoryUsage(sourcePath string, files []FileInfo) []DirectoryUsage {
+	byDir := make(map[string]*DirectoryUsage)
+	for _, f := range files {
+		dir := topLevelDirectory(sourcePath, f.Path)
+		u := byDir[dir]
+		if u == nil {
+			u = &DirectoryUsage{Directory: dir}
+			byDir[dir] = u
+		}
+		u.Files++
+		u.Bytes += f.Size
+	}
+
+	usage := make([]DirectoryUsage, 0, len(byDir))
+	for _, u := range byDir {
+		usage = append(usage, *u)
+	}
+	sortDirectoryUsage(usage)
+	return usage
+}
+
+// topLevelDirectory returns the first path element of path below sourcePath,
+// or RootDirectory for a file directly in it
+func topLevelDirectory(sourcePath, path string) string {
+	rel, err := filepath.Rel(sourcePath, path)
+	if err != nil || strings.HasPrefix(rel, "..") {
+		rel = strings.TrimPrefix(path, "/")
+	}
+	if i := strings.IndexByte(rel, filepath.Separator); i > 0 {
+		return rel[:i]
+	}
+	return RootDirectory
+}
+
+func sortDirectoryUsage(usage []DirectoryUsage) {
+	sort.Slice(usage, func(i, j int) bool {
+		if usage[i].Bytes != usage[j].Bytes {
+			return usage[i].Bytes > usage[j].Bytes
+		}
+		return usage[i].Directory < usage[j].Directory
+	})
+}
+
+// CompareDirectories computes each directory's share of current and, when
+// previous is not nil, its change since then. Directories that are gone
+// since the previous run are listed with no files.
+func CompareDirectories(current, previous []DirectoryUsage) []DirectoryComposition {
+	var totalBytes int64
+	for _, u := range current {
+		totalBytes += u.Bytes
+	}
+	before := make(map[string]DirectoryUsage, len(previous))
+	for _, u := range previous {
+		before[u.Directory] = u
+	}
+
+	all := append([]DirectoryUsage(nil), current...)
+	seen := make(map[string]bool, len(current))
+	for _, u := range current {
+		seen[u.Directory] = true
+	}
+	for _, u := range previous {
+		if !seen[u.Directory] {
+			all = append(all, DirectoryUsage{Directory: u.Directory})
+		}
+	}
+	sortDirectoryUsage(all)
+
+	out := make([]DirectoryComposition, 0, len(all))
+	for _, u := range all {
+		c := DirectoryComposition{DirectoryUsage: u}
+		if totalBytes > 0 {
+			c.Percent = float64(u.Bytes) * 100 / float64(totalBytes)
+		}
+		if previous != nil {
+			prev := before[u.Directory]
+			files, bytes := u.Files-prev.Files, u.Bytes-prev.Bytes
+			c.FilesDelta, c.BytesDelta = &files, &bytes
+		}
+		out = append(out, c)
+	}
+	return out
+}
+
+// saveDirectoryReport records a backup set's composition by top-level
+// directory in backup_set_directories
+func (s *Service) saveDirectoryReport(backupSetID int64, usage []DirectoryUsage) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	stmt, err := tx.Prepare("INSERT OR REPLACE INTO backup_set_directories (backup_set_id, directory, file_count, total_bytes) VALUES (?, ?, ?, ?)")
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	for _, u := range usage {
+		if _, err := stmt.Exec(backupSetID, u.Directory, u.Files, u.Bytes); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
@@ -0,0 +1,26 @@
+package backup
+
+import "testing"
+
+func TestDirectoryUsage(t *testing.T) {
+	files := []FileInfo{
+		{Path: "/data/media/film.mkv", Size: 700},
+		{Path: "/data/media/shows/ep1.mkv", Size: 200},
+		{Path: "/data/home/alice/notes.txt", Size: 50},
+		{Path: "/data/README", Size: 50},
+	}
+	usage := directoryUsage("/data", files)
+	want := []DirectoryUsage{
+		{Directory: "media", Files: 2, Bytes: 900},
+		{Directory: ".", Files: 1, Bytes: 50},
+		{Directory: "home", Files: 1, Bytes: 50},
+	}
+	if len(usage) != len(want) {
+		t.Fatalf("expected %v, got %v", want, usage)
+	}
+	for i := range want {
+		if usage[i] != want[i] {
+			t.Errorf("entry %d: expected %v, got %v", i, want[i], usage[i])
+		}
+	}
+}
@@ -0,0 +1,424 @@
+package backup
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/RoseOO/TapeBackarr/internal/models"
+	"github.com/RoseOO/TapeBackarr/internal/stages"
+	"github.com/RoseOO/TapeBackarr/internal/tape"
+)
+
+// ErrInvalidConsolidation is returned by PlanConsolidation when the tapes
+// cannot be consolidated as requested.
+var ErrInvalidConsolidation = errors.New("invalid consolidation")
+
+// ConsolidationSet is a valid backup set copied from a source tape.
+type ConsolidationSet struct {
+	BackupSetID int64     `json:"backup_set_id"`
+	JobName     string    `json:"job_name"`
+	BackupType  string    `json:"backup_type"`
+	StartTime   time.Time `json:"start_time"`
+	StartBlock  int64     `json:"start_block"`
+	FileCount   int64     `json:"file_count"`
+	Bytes       int64     `json:"bytes"`
+
+	// Filled in once the set has been copied
+	NewBackupSetID   int64 `json:"new_backup_set_id,omitempty"`
+	TargetFile       int64 `json:"target_file,omitempty"`
+	TargetStartBlock int64 `json:"target_start_block,omitempty"`
+	CopiedBytes      int64 `json:"copied_bytes,omitempty"`
+}
+
+// ConsolidationSource is a tape whose valid sets are moved off it.
+type ConsolidationSource struct {
+	TapeID           int64              `json:"tape_id"`
+	Label            string             `json:"label"`
+	UUID             string             `json:"uuid"`
+	ReclaimableBytes int64              `json:"reclaimable_bytes"`
+	Sets             []ConsolidationSet `json:"sets"`
+}
+
+// ConsolidationPlan lists what a consolidation copies where.
+type ConsolidationPlan struct {
+	TargetTapeID   int64                 `json:"target_tape_id"`
+	TargetLabel    string                `json:"target_label"`
+	TargetUUID     string                `json:"target_uuid"`
+	TargetPool     string                `json:"target_pool"`
+	TargetCapacity int64                 `json:"target_capacity_bytes"`
+	Sources        []ConsolidationSource `json:"sources"`
+	SetCount       int                   `json:"set_count"`
+	TotalBytes     int64                 `json:"total_bytes"`
+	FreedTapes     int                   `json:"freed_tapes"`
+}
+
+// consolidationCopyColumns are the backup_sets columns that describe where
+// a set is on tape and are not carried over to its copy
+var consolidationCopyColumns = map[string]bool{
+	"id": true, "tape_id": true, "start_block": true, "end_block": true, "tape_bytes": true,
+	"invalidated_at": true, "invalidated_by": true, "invalidation_reason": true,
+	"created_at": true, "updated_at": true,
+}
+
+// PlanConsolidation works out how the valid backup sets of the source tapes
+// are copied onto the target tape, which must be a blank raw tape with room
+// for all of them. Sets spanning several tapes and sets written with drive
+// encryption cannot be copied and make the plan fail.
+func (s *Service) PlanConsolidation(sourceTapeIDs []int64, targetTapeID int64) (*ConsolidationPlan, error) {
+	if len(sourceTapeIDs) == 0 {
+		return nil, fmt.Errorf("%w: no source tapes given", ErrInvalidConsolidation)
+	}
+	plan := &ConsolidationPlan{TargetTapeID: targetTapeID, Sources: []ConsolidationSource{}}
+
+	var status, formatType string
+	err := s.db.QueryRow(`
+		SELECT t.label, t.uuid, COALESCE(tp.name, ''), t.capacity_bytes, t.status, t.format_type
+		FROM tapes t LEFT JOIN tape_pools tp ON tp.id = t.pool_id
+		WHERE t.id = ?
+	`, targetTapeID).Scan(&plan.TargetLabel, &plan.TargetUUID, &plan.TargetPool, &plan.TargetCapacity, &status, &formatType)
+	if err != nil {
+		return nil, fmt.Errorf("%w: target tape %d not found", ErrInvalidConsolidation, targetTapeID)
+	}
+	if status != string(models.TapeStatusBlank) || formatType != string(models.TapeFormatRaw) {
+		return nil, fmt.Errorf("%w: target tape %s must be a blank raw tape", ErrInvalidConsolidation, plan.TargetLabel)
+	}
+
+	seen := make(map[int64]bool)
+	for _, id := range sourceTapeIDs {
+		if id == targetTapeID {
+			return nil, fmt.Errorf("%w: tape %s cannot be both a source and the target", ErrInvalidConsolidation, plan.TargetLabel)
+		}
+		if seen[id] {
+			continue
+		}
+		seen[id] = true
+
+		src := ConsolidationSource{TapeID: id, Sets: []ConsolidationSet{}}
+		err := s.db.QueryRow("SELECT label, uuid, status, format_type FROM tapes WHERE id = ?", id).
+			Scan(&src.Label, &src.UUID, &status, &formatType)
+		if err != nil {
+			return nil, fmt.Errorf("%w: source tape %d not found", ErrInvalidConsolidation, id)
+		}
+		if formatType != string(models.TapeFormatRaw) {
+			return nil, fmt.Errorf("%w: source tape %s is not a raw tape", ErrInvalidConsolidation, src.Label)
+		}
+		if status == string(models.TapeStatusExported) {
+			return nil, fmt.Errorf("%w: source tape %s is exported; import it first", ErrInvalidConsolidation, src.Label)
+		}
+
+		rows, err := s.db.Query(`
+			SELECT bs.id, COALESCE(j.name, ''), bs.backup_type, bs.start_time, COALESCE(bs.start_block, 0),
+			       bs.file_count, CASE WHEN bs.tape_bytes > 0 THEN bs.tape_bytes ELSE bs.total_bytes END,
+			       bs.invalidated_at IS NOT NULL, COALESCE(bs.hw_encrypted, 0),
+			       EXISTS (SELECT 1 FROM tape_spanning_members m WHERE m.backup_set_id = bs.id)
+			FROM backup_sets bs
+			LEFT JOIN backup_jobs j ON j.id = bs.job_id
+			WHERE bs.tape_id = ? AND bs.status = 'completed'
+			ORDER BY bs.start_time, bs.id
+		`, id)
+		if err != nil {
+			return nil, err
+		}
+		var problem string
+		for rows.Next() {
+			var set ConsolidationSet
+			var invalidated, hwEncrypted, spanned bool
+			if err := rows.Scan(&set.BackupSetID, &set.JobName, &set.BackupType, &set.StartTime, &set.StartBlock,
+				&set.FileCount, &set.Bytes, &invalidated, &hwEncrypted, &spanned); err != nil {
+				rows.Close()
+				return nil, err
+			}
+			switch {
+			case invalidated:
+				src.ReclaimableBytes += set.Bytes
+				continue
+			case spanned:
+				problem = fmt.Sprintf("backup set %d on tape %s spans several tapes", set.BackupSetID, src.Label)
+			case hwEncrypted:
+				problem = fmt.Sprintf("backup set %d on tape %s is encrypted by the drive", set.BackupSetID, src.Label)
+			}
+			src.Sets = append(src.Sets, set)
+			plan.SetCount++
+			plan.TotalBytes += set.Bytes
+		}
+		rows.Close()
+		if problem != "" {
+			return nil, fmt.Errorf("%w: %s and cannot be copied", ErrInvalidConsolidation, problem)
+		}
+		plan.Sources = append(plan.Sources, src)
+		plan.FreedTapes++
+	}
+
+	if plan.TargetCapacity > 0 && plan.TotalBytes > plan.TargetCapacity {
+		return nil, fmt.Errorf("%w: the valid sets take %d bytes, more than the %d bytes of target tape %s",
+			ErrInvalidConsolidation, plan.TotalBytes, plan.TargetCapacity, plan.TargetLabel)
+	}
+	return plan, nil
+}
+
+// ConsolidationLoader makes sure a source tape is in the source drive
+// before its sets are read, e.g. by asking an operator to load it.
+type ConsolidationLoader func(ctx context.Context, src *ConsolidationSource) error
+
+// Consolidate copies the sets of a plan onto the target tape in target,
+// reading each source tape from source once load has put it there. Sets are
+// copied byte for byte, so compressed and encrypted data stays as written,
+// one tape file per set followed by a TOC describing all of them. Once the
+// copy is complete the new sets take over the catalog, the old ones are
+// invalidated, and source tapes left without valid sets become expired so
+// the reuse rules of their pool recycle them. The target is marked full, as
+// later backups to it would overwrite the consolidated sets.
+func (s *Service) Consolidate(ctx context.Context, plan *ConsolidationPlan, source, target *tape.Service, load ConsolidationLoader, progress func(string)) error {
+	if progress == nil {
+		progress = func(string) {}
+	}
+
+	progress(fmt.Sprintf("Verifying target tape %s...", plan.TargetLabel))
+	label, err := target.ReadTapeLabel(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to read target tape label: %w", err)
+	}
+	if label == nil || label.Label != plan.TargetLabel || label.UUID != plan.TargetUUID {
+		return fmt.Errorf("target drive does not hold tape %s", plan.TargetLabel)
+	}
+	if err := target.SeekToFileNumber(ctx, 1); err != nil {
+		return fmt.Errorf("failed to position target tape past its label: %w", err)
+	}
+
+	buf := make([]byte, source.GetBlockSize())
+	fileNum := int64(1)
+	for i := range plan.Sources {
+		src := &plan.Sources[i]
+		if len(src.Sets) == 0 {
+			continue
+		}
+		if load != nil {
+			if err := load(ctx, src); err != nil {
+				return err
+			}
+		}
+		label, err := source.ReadTapeLabel(ctx)
+		if err != nil {
+			return fmt.Errorf("failed to read label of source tape %s: %w", src.Label, err)
+		}
+		if label == nil || label.Label != src.Label || label.UUID != src.UUID {
+			return fmt.Errorf("source drive does not hold tape %s", src.Label)
+		}
+
+		for j := range src.Sets {
+			set := &src.Sets[j]
+			progress(fmt.Sprintf("Copying backup set %d (%s) from %s to %s...", set.BackupSetID, set.JobName, src.Label, plan.TargetLabel))
+			if set.StartBlock > 0 {
+				err = source.SeekToBlock(ctx, set.StartBlock)
+			} else {
+				err = source.SeekToFileNumber(ctx, 1)
+			}
+			if err != nil {
+				return fmt.Errorf("failed to position tape %s at backup set %d: %w", src.Label, set.BackupSetID, err)
+			}
+			if _, block, err := target.GetTapePosition(ctx); err == nil {
+				set.TargetStartBlock = block
+			}
+			n, err := copyTapeFile(ctx, source, target, buf)
+			if err != nil {
+				return fmt.Errorf("failed to copy backup set %d: %w", set.BackupSetID, err)
+			}
+			if err := target.WriteFileMark(ctx); err != nil {
+				return fmt.Errorf("failed to write file mark after backup set %d: %w", set.BackupSetID, err)
+			}
+			set.TargetFile = fileNum
+			set.CopiedBytes = n
+			fileNum++
+		}
+	}
+
+	progress(fmt.Sprintf("Writing TOC to %s...", plan.TargetLabel))
+	toc, err := s.consolidationTOC(plan)
+	if err != nil {
+		return err
+	}
+	if err := target.WriteTOC(ctx, toc); err != nil {
+		return fmt.Errorf("failed to write TOC: %w", err)
+	}
+
+	progress("Updating catalog...")
+	if err := s.recordConsolidation(plan); err != nil {
+		return err
+	}
+	if _, err := s.RecordDriveCapacity(ctx, plan.TargetTapeID, target); err != nil {
+		s.logger.Warn("Could not read remaining capacity from drive", map[string]interface{}{"tape": plan.TargetLabel, "error": err.Error()})
+	}
+	return nil
+}
+
+// copyTapeFile copies the tape file at the source position to the target.
+// Reads and writes go through buf, sized to the tape block size, so each
+// block is written back as it was read.
+func copyTapeFile(ctx context.Context, source, target *tape.Service, buf []byte) (int64, error) {
+	r, err := source.OpenReader(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer r.Close()
+	w, err := target.OpenWriter(ctx)
+	if err != nil {
+		return 0, err
+	}
+	// Hide ReaderFrom and WriterTo so the copy keeps to buf
+	n, err := io.CopyBuffer(struct{ io.Writer }{w}, struct{ io.Reader }{r}, buf)
+	if cerr := w.Close(); err == nil {
+		err = cerr
+	}
+	return n, err
+}
+
+// consolidationTOC describes the copied sets for the target tape's TOC
+func (s *Service) consolidationTOC(plan *ConsolidationPlan) (*tape.TapeTOC, error) {
+	toc := tape.NewTapeTOC(plan.TargetLabel, plan.TargetUUID, plan.TargetPool)
+	for _, src := range plan.Sources {
+		for _, set := range src.Sets {
+			var endTime *time.Time
+			var totalBytes int64
+			var encrypted, compressed bool
+			var compressionType string
+			var encFormat, encKDF, encSalt, encIV string
+			var encChunkSize int
+			var streamStages sql.NullString
+			err := s.db.QueryRow(`
+				SELECT end_time, total_bytes, COALESCE(encrypted, 0), COALESCE(compressed, 0), COALESCE(compression_type, 'none'),
+				       encryption_format, encryption_kdf, encryption_salt, encryption_iv, encryption_chunk_size, stream_stages
+				FROM backup_sets WHERE id = ?
+			`, set.BackupSetID).Scan(&endTime, &totalBytes, &encrypted, &compressed, &compressionType,
+				&encFormat, &encKDF, &encSalt, &encIV, &encChunkSize, &streamStages)
+			if err != nil {
+				return nil, err
+			}
+			applied, err := stages.Parse(streamStages)
+			if err != nil {
+				return nil, err
+			}
+			entry := tape.TOCBackupSet{
+				FileNumber:      int(set.TargetFile),
+				JobName:         set.JobName,
+				BackupType:      set.BackupType,
+				StartTime:       set.StartTime,
+				FileCount:       set.FileCount,
+				TotalBytes:      totalBytes,
+				Encrypted:       encrypted,
+				Encryption:      models.ParseEncryptionMetadata(encFormat, encKDF, encSalt, encIV, encChunkSize),
+				Compressed:      compressed,
+				CompressionType: compressionType,
+				StreamStages:    applied,
+				Files:           []tape.TOCFileEntry{},
+			}
+			if endTime != nil {
+				entry.EndTime = *endTime
+			}
+
+			rows, err := s.db.Query(`
+				SELECT file_path, file_size, COALESCE(file_mode, 0), mod_time, COALESCE(checksum, '')
+				FROM catalog_entries WHERE backup_set_id = ? ORDER BY id
+			`, set.BackupSetID)
+			if err != nil {
+				return nil, err
+			}
+			for rows.Next() {
+				var f tape.TOCFileEntry
+				var modTime *time.Time
+				if err := rows.Scan(&f.Path, &f.Size, &f.Mode, &modTime, &f.Checksum); err != nil {
+					continue
+				}
+				if modTime != nil {
+					f.ModTime = modTime.Format(time.RFC3339)
+				}
+				entry.Files = append(entry.Files, f)
+			}
+			rows.Close()
+			toc.BackupSets = append(toc.BackupSets, entry)
+		}
+	}
+	return toc, nil
+}
+
+// recordConsolidation moves the catalog of every copied set to a new set on
+// the target tape in one transaction
+func (s *Service) recordConsolidation(plan *ConsolidationPlan) error {
+	// Copy every column that is not about the set's place on tape, so
+	// columns added later carry over too
+	rows, err := s.db.Query("SELECT name FROM pragma_table_info('backup_sets')")
+	if err != nil {
+		return err
+	}
+	var columns []string
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err == nil && !consolidationCopyColumns[name] {
+			columns = append(columns, name)
+		}
+	}
+	rows.Close()
+	columnList := strings.Join(columns, ", ")
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	now := time.Now()
+	var written int64
+	for i := range plan.Sources {
+		src := &plan.Sources[i]
+		for j := range src.Sets {
+			set := &src.Sets[j]
+			res, err := tx.Exec(`
+				INSERT INTO backup_sets (tape_id, start_block, tape_bytes, `+columnList+`)
+				SELECT ?, ?, ?, `+columnList+` FROM backup_sets WHERE id = ?
+			`, plan.TargetTapeID, set.TargetStartBlock, set.CopiedBytes, set.BackupSetID)
+			if err != nil {
+				return fmt.Errorf("failed to record copy of backup set %d: %w", set.BackupSetID, err)
+			}
+			newID, err := res.LastInsertId()
+			if err != nil {
+				return err
+			}
+			for _, stmt := range []string{
+				"UPDATE catalog_entries SET backup_set_id = ? WHERE backup_set_id = ?",
+				"UPDATE catalog_entries SET ref_backup_set_id = ? WHERE ref_backup_set_id = ?",
+				"UPDATE snapshots SET backup_set_id = ? WHERE backup_set_id = ?",
+			} {
+				if _, err := tx.Exec(stmt, newID, set.BackupSetID); err != nil {
+					return err
+				}
+			}
+			if _, err := tx.Exec(`
+				UPDATE backup_sets SET invalidated_at = ?, invalidation_reason = ?, updated_at = CURRENT_TIMESTAMP
+				WHERE id = ?
+			`, now, fmt.Sprintf("consolidated onto %s as backup set %d", plan.TargetLabel, newID), set.BackupSetID); err != nil {
+				return err
+			}
+			set.NewBackupSetID = newID
+			written += set.CopiedBytes
+		}
+		if _, err := tx.Exec(`
+			UPDATE tapes SET status = ?, updated_at = CURRENT_TIMESTAMP
+			WHERE id = ? AND status IN (?, ?)
+		`, models.TapeStatusExpired, src.TapeID, models.TapeStatusActive, models.TapeStatusFull); err != nil {
+			return err
+		}
+	}
+
+	if _, err := tx.Exec(`
+		UPDATE tapes SET status = ?, used_bytes = ?, write_count = write_count + 1, last_written_at = ?, physical_remaining_bytes = NULL,
+		       updated_at = CURRENT_TIMESTAMP
+		WHERE id = ?
+	`, models.TapeStatusFull, written, now, plan.TargetTapeID); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
@@ -0,0 +1,132 @@
+package backup
+
+import (
+	"context"
+	"errors"
+	"io"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/RoseOO/TapeBackarr/internal/database"
+	"github.com/RoseOO/TapeBackarr/internal/logging"
+	"github.com/RoseOO/TapeBackarr/internal/tape"
+)
+
+func TestConsolidate(t *testing.T) {
+	ctx := context.Background()
+	db, err := database.New(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("failed to create database: %v", err)
+	}
+	defer db.Close()
+	if err := db.Migrate(); err != nil {
+		t.Fatalf("failed to migrate database: %v", err)
+	}
+
+	// The source holds a set that was invalidated and one still valid
+	payload := strings.Repeat("archived data ", 20000)
+	source := tape.NewServiceForDevice("file://"+t.TempDir(), 65536)
+	if err := source.WriteTapeLabel(ctx, "SRC001", "uuid-src", "DAILY"); err != nil {
+		t.Fatalf("WriteTapeLabel: %v", err)
+	}
+	if err := source.SeekToFileNumber(ctx, 1); err != nil {
+		t.Fatalf("SeekToFileNumber: %v", err)
+	}
+	w, _ := source.OpenWriter(ctx)
+	io.WriteString(w, payload)
+	w.Close()
+	source.WriteFileMark(ctx)
+
+	target := tape.NewServiceForDevice("file://"+t.TempDir(), 65536)
+	if err := target.WriteTapeLabel(ctx, "DST001", "uuid-dst", "DAILY"); err != nil {
+		t.Fatalf("WriteTapeLabel: %v", err)
+	}
+
+	db.Exec("INSERT INTO tapes (uuid, barcode, label, pool_id, status, capacity_bytes, used_bytes) VALUES ('uuid-src', 'SRC001', 'SRC001', 1, 'full', 10000000, 900000)")
+	db.Exec("INSERT INTO tapes (uuid, barcode, label, pool_id, status, capacity_bytes) VALUES ('uuid-dst', 'DST001', 'DST001', 1, 'blank', 10000000)")
+	db.Exec("INSERT INTO tapes (uuid, barcode, label, pool_id, status, capacity_bytes) VALUES ('uuid-small', 'DST002', 'DST002', 1, 'blank', 1000)")
+	db.Exec("INSERT INTO backup_sources (name, source_type, path) VALUES ('docs', 'local', '/srv/docs')")
+	db.Exec("INSERT INTO backup_jobs (name, source_id, pool_id, backup_type, schedule_cron, retention_days) VALUES ('docs', 1, 1, 'full', '', 30)")
+	db.Exec(`INSERT INTO backup_sets (job_id, tape_id, backup_type, start_time, status, file_count, total_bytes, tape_bytes, invalidated_at)
+		VALUES (1, 1, 'full', '2026-01-01 02:00:00', 'completed', 1, 600000, 600000, CURRENT_TIMESTAMP)`)
+	db.Exec(`INSERT INTO backup_sets (job_id, tape_id, backup_type, start_time, end_time, status, file_count, total_bytes, tape_bytes, compressed, compression_type)
+		VALUES (1, 1, 'full', '2026-01-02 02:00:00', '2026-01-02 03:00:00', 'completed', 1, 500000, 300000, 1, 'zstd')`)
+	db.Exec("INSERT INTO catalog_entries (backup_set_id, file_path, file_size, checksum) VALUES (2, 'report.pdf', 500000, 'abc')")
+	db.Exec("INSERT INTO snapshots (source_id, backup_set_id) VALUES (1, 2)")
+
+	logger, _ := logging.NewLogger("error", "text", "")
+	svc := NewService(db, source, logger, 65536, 0, 0)
+
+	if _, err := svc.PlanConsolidation([]int64{1}, 3); !errors.Is(err, ErrInvalidConsolidation) {
+		t.Errorf("expected a target that is too small to be rejected, got %v", err)
+	}
+	if _, err := svc.PlanConsolidation([]int64{2}, 1); !errors.Is(err, ErrInvalidConsolidation) {
+		t.Errorf("expected a target that is not blank to be rejected, got %v", err)
+	}
+
+	plan, err := svc.PlanConsolidation([]int64{1}, 2)
+	if err != nil {
+		t.Fatalf("PlanConsolidation: %v", err)
+	}
+	if plan.SetCount != 1 || plan.TotalBytes != 300000 || plan.Sources[0].ReclaimableBytes != 600000 {
+		t.Fatalf("unexpected plan %+v", plan)
+	}
+
+	loaded := 0
+	load := func(ctx context.Context, src *ConsolidationSource) error {
+		loaded++
+		return nil
+	}
+	if err := svc.Consolidate(ctx, plan, source, target, load, nil); err != nil {
+		t.Fatalf("Consolidate: %v", err)
+	}
+	if loaded != 1 {
+		t.Errorf("expected the source to be loaded once, got %d", loaded)
+	}
+
+	// The target holds the data as it was followed by a TOC
+	if err := target.SeekToFileNumber(ctx, 1); err != nil {
+		t.Fatalf("SeekToFileNumber: %v", err)
+	}
+	r, _ := target.OpenReader(ctx)
+	data, _ := io.ReadAll(r)
+	r.Close()
+	if string(data) != payload {
+		t.Fatalf("copied data does not match the source, got %d bytes", len(data))
+	}
+	if err := target.SeekToFileNumber(ctx, 2); err != nil {
+		t.Fatalf("SeekToFileNumber: %v", err)
+	}
+	toc, err := target.ReadTOC(ctx)
+	if err != nil || len(toc.BackupSets) != 1 || toc.BackupSets[0].FileNumber != 1 ||
+		toc.BackupSets[0].CompressionType != "zstd" || len(toc.BackupSets[0].Files) != 1 {
+		t.Fatalf("unexpected TOC %+v %v", toc, err)
+	}
+
+	newID := plan.Sources[0].Sets[0].NewBackupSetID
+	var tapeID, tapeBytes int64
+	var jobID int64
+	var compression string
+	db.QueryRow("SELECT tape_id, job_id, tape_bytes, compression_type FROM backup_sets WHERE id = ?", newID).Scan(&tapeID, &jobID, &tapeBytes, &compression)
+	if tapeID != 2 || jobID != 1 || tapeBytes != int64(len(payload)) || compression != "zstd" {
+		t.Errorf("unexpected new set: tape=%d job=%d bytes=%d compression=%s", tapeID, jobID, tapeBytes, compression)
+	}
+	var entries, snapshots int
+	db.QueryRow("SELECT COUNT(*) FROM catalog_entries WHERE backup_set_id = ?", newID).Scan(&entries)
+	db.QueryRow("SELECT COUNT(*) FROM snapshots WHERE backup_set_id = ?", newID).Scan(&snapshots)
+	if entries != 1 || snapshots != 1 {
+		t.Errorf("expected the catalog and snapshot to move, got %d entries and %d snapshots", entries, snapshots)
+	}
+	var reason string
+	db.QueryRow("SELECT invalidation_reason FROM backup_sets WHERE id = 2").Scan(&reason)
+	if !strings.Contains(reason, "DST001") {
+		t.Errorf("expected the old set to be invalidated, got reason %q", reason)
+	}
+	var sourceStatus, targetStatus string
+	db.QueryRow("SELECT status FROM tapes WHERE id = 1").Scan(&sourceStatus)
+	db.QueryRow("SELECT status FROM tapes WHERE id = 2").Scan(&targetStatus)
+	if sourceStatus != "expired" || targetStatus != "full" {
+		t.Errorf("expected source expired and target full, got %s and %s", sourceStatus, targetStatus)
+	}
+}
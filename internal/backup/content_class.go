@@ -0,0 +1,219 @@
+package backup
+
+import (
+	"context"
+	"path"
+	"strings"
+)
+
+// Coarse content classes of cataloged files, derived from their extension
+const (
+	ContentImage    = "image"
+	ContentVideo    = "video"
+	ContentAudio    = "audio"
+	ContentDocument = "document"
+	ContentArchive  = "archive"
+	ContentDatabase = "database"
+	ContentOther    = "other"
+)
+
+// ContentClasses lists the content classes in display order
+var ContentClasses = []string{ContentImage, ContentVideo, ContentAudio, ContentDocument, ContentArchive, ContentDatabase, ContentOther}
+
+// contentClassByExt maps lower-case extensions to their content class.
+// Extensions not listed are ContentOther.
+var contentClassByExt = map[string]string{}
+
+func init() {
+	for class, exts := range map[string][]string{
+		ContentImage: {"jpg", "jpeg", "png", "gif", "bmp", "tif", "tiff", "webp", "heic", "heif", "svg", "ico",
+			"raw", "cr2", "cr3", "nef", "arw", "dng", "orf", "rw2", "psd", "xcf", "exr"},
+		ContentVideo: {"mp4", "m4v", "mkv", "mov", "avi", "wmv", "flv", "webm", "mpg", "mpeg", "m2ts", "mts",
+			"ts", "vob", "3gp", "mxf", "r3d", "braw", "prores"},
+		ContentAudio: {"mp3", "wav", "flac", "aac", "m4a", "ogg", "oga", "opus", "wma", "aiff", "aif", "alac", "mid", "midi"},
+		ContentDocument: {"pdf", "doc", "docx", "odt", "rtf", "txt", "md", "xls", "xlsx", "ods", "csv", "ppt", "pptx",
+			"odp", "pages", "numbers", "key", "epub", "tex", "html", "htm", "xml", "json", "yaml", "yml", "msg", "eml"},
+		ContentArchive: {"zip", "tar", "tgz", "tbz2", "txz", "gz", "bz2", "xz", "zst", "lz4", "7z", "rar", "cab", "iso",
+			"img", "dmg", "vma", "vmdk", "qcow2", "vhd", "vhdx", "ova", "tar.gz", "tar.bz2", "tar.xz", "tar.zst"},
+		ContentDatabase: {"db", "sqlite", "sqlite3", "mdb", "accdb", "dbf", "frm", "ibd", "myd", "myi", "mdf", "ldf",
+			"ndf", "bak", "dump", "sql", "kdbx", "fdb", "gdb", "nsf"},
+	} {
+		for _, ext := range exts {
+			contentClassByExt[ext] = class
+		}
+	}
+}
+
+// FileExtension returns the lower-case extension of a cataloged path without
+// the dot, or "" when it has none. Compressed tarballs keep both parts, so
+// "logs.tar.gz" is "tar.gz". Dot files such as ".bashrc" have no extension.
+func FileExtension(filePath string) string {
+	name := path.Base(strings.ReplaceAll(filePath, "\\", "/"))
+	dot := strings.LastIndexByte(name, '.')
+	if dot <= 0 || dot == len(name)-1 {
+		return ""
+	}
+	ext := strings.ToLower(name[dot+1:])
+	if strings.HasSuffix(strings.ToLower(name[:dot]), ".tar") && dot > len(".tar") {
+		return "tar." + ext
+	}
+	return ext
+}
+
+// ContentClass returns the content class of an extension
+func ContentClass(ext string) string {
+	if class, ok := contentClassByExt[ext]; ok {
+		return class
+	}
+	return ContentOther
+}
+
+// classifyPath returns the extension and content class of a cataloged path
+func classifyPath(filePath string) (string, string) {
+	ext := FileExtension(filePath)
+	return ext, ContentClass(ext)
+}
+
+// ClassifyCatalog fills in the extension and content class of catalog
+// entries cataloged before they were recorded. It works in batches so a
+// large catalog does not hold the database for long, and returns how many
+// entries it classified.
+func (s *Service) ClassifyCatalog(ctx context.Context) (int, error) {
+	const batchSize = 5000
+	total := 0
+	for ctx.Err() == nil {
+		rows, err := s.db.Query("SELECT id, file_path FROM catalog_entries WHERE content_class IS NULL LIMIT ?", batchSize)
+		if err != nil {
+			return total, err
+		}
+		type entry struct {
+			id   int64
+			path string
+		}
+		var batch []entry
+		for rows.Next() {
+			var e entry
+			if err := rows.Scan(&e.id, &e.path); err == nil {
+				batch = append(batch, e)
+			}
+		}
+		rows.Close()
+		if len(batch) == 0 {
+			break
+		}
+
+		tx, err := s.db.Begin()
+		if err != nil {
+			return total, err
+		}
+		stmt, err := tx.Prepare("UPDATE catalog_entries SET extension = ?, content_class = ? WHERE id = ?")
+		if err != nil {
+			tx.Rollback()
+			return total, err
+		}
+		for _, e := range batch {
+			ext, class := classifyPath(e.path)
+			if _, err := stmt.Exec(ext, class, e.id); err != nil {
+				stmt.Close()
+				tx.Rollback()
+				return total, err
+			}
+		}
+		stmt.Close()
+		if err := tx.Commit(); err != nil {
+			return total, err
+		}
+		total += len(batch)
+	}
+	if total > 0 {
+		s.logger.Info("Classified catalog entries by file type", map[string]interface{}{"entries": total})
+	}
+	return total, ctx.Err()
+}
+
+// ContentStatsFilter scopes content statistics to a pool, tape or job. Zero
+// fields do not filter.
+type ContentStatsFilter struct {
+	PoolID int64
+	TapeID int64
+	JobID  int64
+}
+
+// ContentClassStats is how many files of a content class are on tape
+type ContentClassStats struct {
+	ContentClass string `json:"content_class"`
+	Files        int64  `json:"files"`
+	Bytes        int64  `json:"bytes"`
+}
+
+// ExtensionStats is how many files with an extension are on tape
+type ExtensionStats struct {
+	Extension    string `json:"extension"`
+	ContentClass string `json:"content_class"`
+	Files        int64  `json:"files"`
+	Bytes        int64  `json:"bytes"`
+}
+
+// ContentStats breaks down the files on tape by content class and extension
+type ContentStats struct {
+	Classes    []ContentClassStats `json:"classes"`
+	Extensions []ExtensionStats    `json:"extensions"` // Largest first
+}
+
+// ContentStats totals the files of completed backup sets by content class
+// and extension. Deduplicated entries are left out: their data is counted
+// with the set that wrote it. Extensions are limited to the topN largest.
+func (s *Service) ContentStats(ctx context.Context, f ContentStatsFilter, topN int) (*ContentStats, error) {
+	where := "bs.status = 'completed' AND ce.ref_backup_set_id IS NULL"
+	var args []interface{}
+	if f.PoolID > 0 {
+		where += " AND t.pool_id = ?"
+		args = append(args, f.PoolID)
+	}
+	if f.TapeID > 0 {
+		where += " AND bs.tape_id = ?"
+		args = append(args, f.TapeID)
+	}
+	if f.JobID > 0 {
+		where += " AND bs.job_id = ?"
+		args = append(args, f.JobID)
+	}
+	from := `
+		FROM catalog_entries ce
+		JOIN backup_sets bs ON bs.id = ce.backup_set_id
+		LEFT JOIN tapes t ON t.id = bs.tape_id
+		WHERE ` + where
+
+	stats := &ContentStats{Classes: []ContentClassStats{}, Extensions: []ExtensionStats{}}
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT COALESCE(ce.content_class, ?), COUNT(*), COALESCE(SUM(ce.file_size), 0)`+from+`
+		GROUP BY 1 ORDER BY 3 DESC`, append([]interface{}{ContentOther}, args...)...)
+	if err != nil {
+		return nil, err
+	}
+	for rows.Next() {
+		var c ContentClassStats
+		if err := rows.Scan(&c.ContentClass, &c.Files, &c.Bytes); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		stats.Classes = append(stats.Classes, c)
+	}
+	rows.Close()
+
+	rows, err = s.db.QueryContext(ctx, `
+		SELECT COALESCE(ce.extension, ''), COALESCE(ce.content_class, ?), COUNT(*), COALESCE(SUM(ce.file_size), 0)`+from+`
+		GROUP BY 1, 2 ORDER BY 4 DESC LIMIT ?`, append(append([]interface{}{ContentOther}, args...), topN)...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var e ExtensionStats
+		if err := rows.Scan(&e.Extension, &e.ContentClass, &e.Files, &e.Bytes); err != nil {
+			return nil, err
+		}
+		stats.Extensions = append(stats.Extensions, e)
+	}
+	return stats, rows.Err()
+}
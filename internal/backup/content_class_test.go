@@ -0,0 +1,26 @@
+package backup
+
+import "testing"
+
+func TestClassifyPath(t *testing.T) {
+	tests := []struct {
+		path, ext, class string
+	}{
+		{"media/Holiday.MKV", "mkv", ContentVideo},
+		{"photos/2024/IMG_0001.jpeg", "jpeg", ContentImage},
+		{"srv/db/prod.sqlite3", "sqlite3", ContentDatabase},
+		{"logs/app.tar.gz", "tar.gz", ContentArchive},
+		{"docs/report.final.pdf", "pdf", ContentDocument},
+		{"home/alice/.bashrc", "", ContentOther},
+		{".tar.gz", "gz", ContentArchive},
+		{"bin/tool", "", ContentOther},
+		{"trailing.", "", ContentOther},
+		{"data/readings.xyz", "xyz", ContentOther},
+	}
+	for _, tt := range tests {
+		ext, class := classifyPath(tt.path)
+		if ext != tt.ext || class != tt.class {
+			t.Errorf("classifyPath(%q) = %q, %q; want %q, %q", tt.path, ext, class, tt.ext, tt.class)
+		}
+	}
+}
@@ -0,0 +1,171 @@
+package backup
+
+import (
+	"context"
+	"database/sql"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// DedupRef records that a file's content already exists in an earlier backup
+// set, so the file is catalogued as a reference instead of being written.
+type DedupRef struct {
+	File     FileInfo
+	RelPath  string
+	SetID    int64  // backup set holding the data
+	DataPath string // path of the data in that set's catalog
+	Checksum string
+}
+
+// dedupCandidate is a catalog entry whose size matches a file being backed up
+type dedupCandidate struct {
+	setID    int64
+	path     string
+	checksum string
+}
+
+// dedupCandidatesQuery finds catalog entries holding data for a given size in
+// completed sets of a pool whose tape still holds readable data and whose
+// job retention has not lapsed. Reference entries are excluded so references
+// always point directly at the set the data was written to.
+const dedupCandidatesQuery = `
+	SELECT ce.backup_set_id, ce.file_path, ce.mod_time, ce.checksum
+	FROM catalog_entries ce
+	JOIN backup_sets bs ON ce.backup_set_id = bs.id
+	JOIN tapes t ON bs.tape_id = t.id
+	JOIN backup_jobs j ON bs.job_id = j.id
+	WHERE ce.file_size = ? AND ce.ref_backup_set_id IS NULL
+	  AND COALESCE(ce.checksum, '') != ''
+	  AND bs.status = 'completed' AND t.pool_id = ?
+	  AND t.status IN ('active', 'full', 'exported')
+	  AND (j.retention_days <= 0 OR bs.end_time >= datetime('now', '-' || j.retention_days || ' days'))
+	ORDER BY bs.end_time DESC
+`
+
+// FindDuplicates splits files into those that must be written and those whose
+// size, modification time and SHA256 match a file already on an unexpired
+// tape in the pool. Size and mtime select candidates cheaply; only files with
+// a candidate are hashed. Lookup errors leave the file in the write list so a
+// backup never loses data because deduplication failed.
+func (s *Service) FindDuplicates(ctx context.Context, poolID int64, sourcePath string, files []FileInfo) ([]FileInfo, []DedupRef) {
+	stmt, err := s.db.Prepare(dedupCandidatesQuery)
+	if err != nil {
+		s.logger.Warn("Deduplication disabled for this run", map[string]interface{}{"error": err.Error()})
+		return files, nil
+	}
+	defer stmt.Close()
+
+	var write []FileInfo
+	var refs []DedupRef
+	for i, f := range files {
+		if ctx.Err() != nil {
+			return append(write, files[i:]...), refs
+		}
+		if f.Size == 0 || !os.FileMode(f.Mode).IsRegular() || f.FollowLink {
+			write = append(write, f)
+			continue
+		}
+
+		candidates, err := s.dedupCandidates(stmt, poolID, f)
+		if err != nil || len(candidates) == 0 {
+			write = append(write, f)
+			continue
+		}
+
+		checksum, err := s.CalculateChecksum(f.Path)
+		if err != nil {
+			write = append(write, f)
+			continue
+		}
+		ref, ok := matchDedupCandidate(candidates, checksum)
+		if !ok {
+			write = append(write, f)
+			continue
+		}
+
+		relPath, err := filepath.Rel(sourcePath, f.Path)
+		if err != nil {
+			relPath = f.Path
+		}
+		refs = append(refs, DedupRef{File: f, RelPath: relPath, SetID: ref.setID, DataPath: ref.path, Checksum: checksum})
+	}
+	return write, refs
+}
+
+// dedupCandidates returns the catalog entries matching f's size and mtime.
+// Times are compared to the second, the precision tar preserves.
+func (s *Service) dedupCandidates(stmt *sql.Stmt, poolID int64, f FileInfo) ([]dedupCandidate, error) {
+	rows, err := stmt.Query(f.Size, poolID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	want := f.ModTime.Truncate(time.Second)
+	var out []dedupCandidate
+	for rows.Next() {
+		var c dedupCandidate
+		var modTime sql.NullTime
+		if err := rows.Scan(&c.setID, &c.path, &modTime, &c.checksum); err != nil {
+			return nil, err
+		}
+		if !modTime.Valid || !modTime.Time.Truncate(time.Second).Equal(want) {
+			continue
+		}
+		out = append(out, c)
+	}
+	return out, rows.Err()
+}
+
+// matchDedupCandidate picks the first candidate, newest set first, with the
+// file's checksum.
+func matchDedupCandidate(candidates []dedupCandidate, checksum string) (dedupCandidate, bool) {
+	for _, c := range candidates {
+		if c.checksum == checksum {
+			return c, true
+		}
+	}
+	return dedupCandidate{}, false
+}
+
+// recordDedupRefs catalogs deduplicated files in a backup set as references
+// to the sets holding their data and stores the totals on the set.
+func (s *Service) recordDedupRefs(backupSetID int64, refs []DedupRef) error {
+	if len(refs) == 0 {
+		return nil
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	stmt, err := tx.Prepare(`
+		INSERT INTO catalog_entries (backup_set_id, file_path, file_size, file_mode, mod_time, checksum,
+			ref_backup_set_id, ref_file_path, uid, gid, owner, group_name, file_type, link_target, has_xattrs,
+			extension, content_class)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	var bytes int64
+	for _, r := range refs {
+		ext, class := classifyPath(r.RelPath)
+		if _, err := stmt.Exec(backupSetID, r.RelPath, r.File.Size, r.File.Mode, r.File.ModTime, r.Checksum,
+			r.SetID, r.DataPath, r.File.UID, r.File.GID, r.File.Owner, r.File.Group, r.File.FileType,
+			r.File.LinkTarget, r.File.HasXattrs, ext, class); err != nil {
+			return err
+		}
+		bytes += r.File.Size
+	}
+	if _, err := tx.Exec("UPDATE backup_sets SET dedup_count = ?, dedup_bytes = ? WHERE id = ?",
+		len(refs), bytes, backupSetID); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
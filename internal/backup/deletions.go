@@ -0,0 +1,77 @@
+package backup
+
+import (
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// deletedSince returns the paths in previous that are missing from current,
+// relative to sourcePath. Paths at or under a path the scan skipped are left
+// out: an unreadable directory does not mean its files were deleted.
+func deletedSince(sourcePath string, previous, current []FileInfo, skipped *SkipReport) []string {
+	present := make(map[string]bool, len(current))
+	for _, f := range current {
+		present[f.Path] = true
+	}
+	var skippedPaths []string
+	if skipped != nil {
+		for _, p := range skipped.Paths {
+			skippedPaths = append(skippedPaths, p.Path)
+		}
+	}
+
+	var deleted []string
+	for _, f := range previous {
+		if present[f.Path] || underAny(f.Path, skippedPaths) {
+			continue
+		}
+		rel, err := filepath.Rel(sourcePath, f.Path)
+		if err != nil || strings.HasPrefix(rel, "..") {
+			rel = f.Path
+		}
+		deleted = append(deleted, rel)
+	}
+	sort.Strings(deleted)
+	return deleted
+}
+
+// underAny reports whether path is one of roots or inside one of them
+func underAny(path string, roots []string) bool {
+	for _, root := range roots {
+		if path == root || strings.HasPrefix(path, strings.TrimSuffix(root, "/")+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// saveDeletedPaths records the files an incremental backup found deleted
+// since the previous run, on the set and in backup_deleted_paths
+func (s *Service) saveDeletedPaths(backupSetID int64, deleted []string) error {
+	if _, err := s.db.Exec("UPDATE backup_sets SET deleted_count = ? WHERE id = ?", len(deleted), backupSetID); err != nil {
+		return err
+	}
+	if len(deleted) == 0 {
+		return nil
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	stmt, err := tx.Prepare("INSERT INTO backup_deleted_paths (backup_set_id, path) VALUES (?, ?)")
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	for _, p := range deleted {
+		if _, err := stmt.Exec(backupSetID, p); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
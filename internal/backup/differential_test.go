@@ -0,0 +1,93 @@
+package backup
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/RoseOO/TapeBackarr/internal/database"
+	"github.com/RoseOO/TapeBackarr/internal/logging"
+	"github.com/RoseOO/TapeBackarr/internal/models"
+	"github.com/RoseOO/TapeBackarr/internal/tape"
+)
+
+func TestDifferentialBackup(t *testing.T) {
+	ctx := context.Background()
+	db, err := database.New(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("failed to create database: %v", err)
+	}
+	defer db.Close()
+	if err := db.Migrate(); err != nil {
+		t.Fatalf("failed to migrate database: %v", err)
+	}
+
+	srcDir := t.TempDir()
+	base := time.Now().Add(-time.Hour)
+	write := func(name, data string, at time.Time) {
+		path := filepath.Join(srcDir, name)
+		os.WriteFile(path, []byte(data), 0644)
+		os.Chtimes(path, at, at)
+	}
+	write("a.txt", "a", base)
+	write("b.txt", "b", base)
+	devicePath := "file://" + t.TempDir()
+	drive := tape.NewServiceForDevice(devicePath, 65536)
+	if err := drive.WriteTapeLabel(ctx, "DF0001", "uuid-df", "diff"); err != nil {
+		t.Fatalf("WriteTapeLabel: %v", err)
+	}
+	db.Exec("INSERT INTO tape_pools (name) VALUES ('diff')")
+	db.Exec("INSERT INTO tapes (uuid, barcode, label, pool_id, status, capacity_bytes, used_bytes) VALUES ('uuid-df', 'DF0001', 'DF0001', 1, 'active', 10000000, 0)")
+	db.Exec("INSERT INTO tape_drives (device_path, display_name, status, current_tape_id) VALUES (?, 'vtape', 'ready', 1)", devicePath)
+	db.Exec("INSERT INTO backup_sources (name, source_type, path) VALUES ('docs', 'local', ?)", srcDir)
+	db.Exec("INSERT INTO backup_jobs (name, source_id, pool_id, backup_type, schedule_cron, retention_days) VALUES ('docs', 1, 1, 'differential', '', 30)")
+
+	logger, _ := logging.NewLogger("error", "text", "")
+	svc := NewService(db, drive, logger, 65536, 0, 0)
+	job := &models.BackupJob{ID: 1, Name: "docs", PoolID: 1, BackupType: models.BackupTypeDifferential}
+	source := &models.BackupSource{ID: 1, Name: "docs", Path: srcDir}
+	run := func(backupType models.BackupType) []string {
+		t.Helper()
+		set, err := svc.RunBackup(ctx, job, source, 1, backupType)
+		if err != nil {
+			t.Fatalf("%s run: %v", backupType, err)
+		}
+		var stored string
+		db.QueryRow("SELECT backup_type FROM backup_sets WHERE id = ?", set.ID).Scan(&stored)
+		if stored != string(backupType) {
+			t.Fatalf("expected a %s set, got %q", backupType, stored)
+		}
+		var paths []string
+		rows, _ := db.Query("SELECT file_path FROM catalog_entries WHERE backup_set_id = ? ORDER BY file_path", set.ID)
+		for rows.Next() {
+			var p string
+			rows.Scan(&p)
+			paths = append(paths, filepath.Base(p))
+		}
+		rows.Close()
+		sort.Strings(paths)
+		return paths
+	}
+
+	run(models.BackupTypeFull)
+	write("a.txt", "a changed", base.Add(10*time.Minute))
+	if got := run(models.BackupTypeIncremental); len(got) != 1 || got[0] != "a.txt" {
+		t.Fatalf("expected the incremental to hold a.txt, got %v", got)
+	}
+	write("c.txt", "c", base.Add(20*time.Minute))
+
+	// The differential compares with the full, not the incremental, so it
+	// holds a.txt again
+	if got := run(models.BackupTypeDifferential); len(got) != 2 || got[0] != "a.txt" || got[1] != "c.txt" {
+		t.Fatalf("expected the differential to hold a.txt and c.txt, got %v", got)
+	}
+
+	// Without the full's snapshot it is rebuilt from the full's catalog alone
+	db.Exec("DELETE FROM snapshots")
+	if got := run(models.BackupTypeDifferential); len(got) != 2 || got[0] != "a.txt" || got[1] != "c.txt" {
+		t.Fatalf("expected the rebuilt base to be the full backup, got %v", got)
+	}
+}
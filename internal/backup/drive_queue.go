@@ -0,0 +1,238 @@
+package backup
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"sort"
+	"time"
+)
+
+// driveQueue orders the jobs writing through one drive: one job holds the
+// drive, the others wait in arrival order
+type driveQueue struct {
+	holder  int64
+	waiters []*driveWaiter
+}
+
+// driveWaiter is a job waiting for a drive. ready is closed when the drive
+// is handed to it.
+type driveWaiter struct {
+	jobID int64
+	ready chan struct{}
+}
+
+// DriveQueue is a drive held by a backup job or a restore and the jobs
+// waiting for it
+type DriveQueue struct {
+	DevicePath string `json:"device_path"`
+	JobID      int64  `json:"job_id,omitempty"`
+	JobName    string `json:"job_name,omitempty"`
+	// Restore is set when a restore holds the drive
+	Restore     bool       `json:"restore,omitempty"`
+	ReservedAt  *time.Time `json:"reserved_at,omitempty"`
+	WaitingJobs []int64    `json:"waiting_job_ids"`
+	// WaitingRestores counts the restores queued ahead of the jobs
+	WaitingRestores int `json:"waiting_restores,omitempty"`
+}
+
+// acquireDrive waits until the job holds the drive, then records the
+// reservation in tape_drives. Jobs on other drives are not held up. A job
+// that already holds the drive gets it again straight away. The returned
+// function releases the drive to the next job waiting for it.
+func (s *Service) acquireDrive(ctx context.Context, jobID int64, devicePath string) (func(), error) {
+	s.driveMu.Lock()
+	if s.drives == nil {
+		s.drives = make(map[string]*driveQueue)
+	}
+	q := s.drives[devicePath]
+	if q == nil {
+		q = &driveQueue{}
+		s.drives[devicePath] = q
+	}
+	if q.holder == jobID {
+		s.driveMu.Unlock()
+		return func() {}, nil
+	}
+	if q.holder != 0 {
+		w := &driveWaiter{jobID: jobID, ready: make(chan struct{})}
+		q.waiters = append(q.waiters, w)
+		holder := q.holder
+		position := len(q.waiters)
+		s.driveMu.Unlock()
+
+		s.updateProgress(jobID, "queued", fmt.Sprintf("Waiting for drive %s, in use by %s (position %d in queue)", devicePath, s.holderName(holder), position))
+		select {
+		case <-w.ready:
+		case <-ctx.Done():
+			s.driveMu.Lock()
+			handed := q.holder == jobID
+			for i, other := range q.waiters {
+				if other == w {
+					q.waiters = append(q.waiters[:i], q.waiters[i+1:]...)
+					break
+				}
+			}
+			s.driveMu.Unlock()
+			if handed {
+				// The drive was handed over as the wait was cancelled
+				s.releaseDrive(jobID, devicePath)
+			}
+			return nil, ctx.Err()
+		}
+	} else {
+		q.holder = jobID
+		s.driveMu.Unlock()
+	}
+
+	if _, err := s.db.Exec("UPDATE tape_drives SET reserved_job_id = ?, reserved_at = CURRENT_TIMESTAMP WHERE device_path = ?", jobID, devicePath); err != nil {
+		s.logger.Warn("Failed to record drive reservation", map[string]interface{}{"device": devicePath, "job_id": jobID, "error": err.Error()})
+	}
+	return func() { s.releaseDrive(jobID, devicePath) }, nil
+}
+
+// releaseDrive clears the job's reservation of the drive and hands the
+// drive to the first job waiting for it
+func (s *Service) releaseDrive(jobID int64, devicePath string) {
+	s.db.Exec("UPDATE tape_drives SET reserved_job_id = NULL, reserved_at = NULL WHERE device_path = ? AND reserved_job_id = ?", devicePath, jobID)
+
+	s.driveMu.Lock()
+	defer s.driveMu.Unlock()
+	q := s.drives[devicePath]
+	if q == nil || q.holder != jobID {
+		return
+	}
+	if len(q.waiters) == 0 {
+		delete(s.drives, devicePath)
+		return
+	}
+	next := q.waiters[0]
+	q.waiters = q.waiters[1:]
+	q.holder = next.jobID
+	close(next.ready)
+}
+
+// jobName returns a job's name for messages, or its ID if it has none
+func (s *Service) jobName(jobID int64) string {
+	var name string
+	if err := s.db.QueryRow("SELECT name FROM backup_jobs WHERE id = ?", jobID).Scan(&name); err != nil || name == "" {
+		return fmt.Sprintf("#%d", jobID)
+	}
+	return name
+}
+
+// DriveQueues returns the drives held by backup jobs, each with the jobs
+// waiting for it, ordered by device path
+func (s *Service) DriveQueues() []DriveQueue {
+	s.driveMu.Lock()
+	queues := make([]DriveQueue, 0, len(s.drives))
+	for path, q := range s.drives {
+		dq := DriveQueue{DevicePath: path, JobID: q.holder, WaitingJobs: []int64{}}
+		if q.holder == restoreHolder {
+			dq.JobID, dq.Restore = 0, true
+		}
+		for _, w := range q.waiters {
+			if w.jobID == restoreHolder {
+				dq.WaitingRestores++
+			} else {
+				dq.WaitingJobs = append(dq.WaitingJobs, w.jobID)
+			}
+		}
+		queues = append(queues, dq)
+	}
+	s.driveMu.Unlock()
+
+	for i := range queues {
+		if queues[i].Restore {
+			continue
+		}
+		queues[i].JobName = s.jobName(queues[i].JobID)
+		var reservedAt sql.NullTime
+		if err := s.db.QueryRow("SELECT reserved_at FROM tape_drives WHERE device_path = ? AND reserved_job_id = ?", queues[i].DevicePath, queues[i].JobID).Scan(&reservedAt); err == nil && reservedAt.Valid {
+			queues[i].ReservedAt = &reservedAt.Time
+		}
+	}
+	sort.Slice(queues, func(i, j int) bool { return queues[i].DevicePath < queues[j].DevicePath })
+	return queues
+}
+
+// ClearDriveReservations drops drive reservations left by runs that did not
+// end cleanly. Call it at startup, before any backup runs.
+func (s *Service) ClearDriveReservations() error {
+	_, err := s.db.Exec("UPDATE tape_drives SET reserved_job_id = NULL, reserved_at = NULL WHERE reserved_job_id IS NOT NULL")
+	return err
+}
+
+// availableDrivesQuery selects the device paths of the enabled drives a job
+// may probe and write to: the drive it is pinned to, if any, and otherwise
+// every drive not held by another job. Its arguments are the pinned device
+// path twice and the job ID.
+const availableDrivesQuery = `
+	SELECT device_path FROM tape_drives
+	WHERE COALESCE(enabled, 1) = 1
+	AND (? = '' OR device_path = ?)
+	AND (reserved_job_id IS NULL OR reserved_job_id = ?)`
+
+// driveHold is the drive a run holds. A run that spans onto a tape in
+// another drive moves its hold there.
+type driveHold struct {
+	s          *Service
+	jobID      int64
+	devicePath string
+	release    func()
+}
+
+// moveTo makes the run hold the drive, giving up the one it held before
+func (h *driveHold) moveTo(ctx context.Context, devicePath string) error {
+	if h.devicePath == devicePath {
+		return nil
+	}
+	h.releaseAll()
+	release, err := h.s.acquireDrive(ctx, h.jobID, devicePath)
+	if err != nil {
+		return err
+	}
+	h.devicePath, h.release = devicePath, release
+	return nil
+}
+
+// releaseAll gives up the drive the run holds, if any
+func (h *driveHold) releaseAll() {
+	if h.release != nil {
+		h.release()
+	}
+	h.devicePath, h.release = "", nil
+}
+
+// jobDrive returns the device path of the drive a job is pinned to, or ""
+// when it uses whichever drive holds its tape
+func (s *Service) jobDrive(jobID int64) (string, error) {
+	var devicePath sql.NullString
+	err := s.db.QueryRow(`
+		SELECT d.device_path FROM backup_jobs j
+		LEFT JOIN tape_drives d ON d.id = j.drive_id
+		WHERE j.id = ?
+	`, jobID).Scan(&devicePath)
+	if err != nil {
+		return "", err
+	}
+	return devicePath.String, nil
+}
+
+// TapeInJobDrive returns the tape of a job's pool loaded in the drive the
+// job is pinned to, when it can be written and no other job holds it. It
+// returns sql.ErrNoRows when the job is not pinned or there is no such tape,
+// so callers fall back to their usual tape selection.
+func (s *Service) TapeInJobDrive(jobID, poolID int64) (int64, string, error) {
+	var tapeID int64
+	var label string
+	err := s.db.QueryRow(`
+		SELECT t.id, t.label FROM backup_jobs j
+		JOIN tape_drives d ON d.id = j.drive_id AND COALESCE(d.enabled, 1) = 1
+		JOIN tapes t ON t.id = d.current_tape_id
+		WHERE j.id = ? AND t.pool_id = ?
+		AND (t.status = 'blank' OR (t.status = 'active' AND t.capacity_bytes > t.used_bytes))
+		AND t.id NOT IN (SELECT tape_id FROM tape_reservations WHERE job_id != ? AND expires_at > datetime('now'))
+	`, jobID, poolID, jobID).Scan(&tapeID, &label)
+	return tapeID, label, err
+}
@@ -0,0 +1,139 @@
+package backup
+
+import (
+	"context"
+	"database/sql"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/RoseOO/TapeBackarr/internal/database"
+	"github.com/RoseOO/TapeBackarr/internal/logging"
+	"github.com/RoseOO/TapeBackarr/internal/models"
+	"github.com/RoseOO/TapeBackarr/internal/tape"
+)
+
+func TestDriveQueues(t *testing.T) {
+	ctx := context.Background()
+	db, err := database.New(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("failed to create database: %v", err)
+	}
+	defer db.Close()
+	if err := db.Migrate(); err != nil {
+		t.Fatalf("failed to migrate database: %v", err)
+	}
+
+	srcDir := t.TempDir()
+	os.WriteFile(filepath.Join(srcDir, "a.txt"), []byte("data"), 0644)
+	db.Exec("INSERT INTO tape_pools (name) VALUES ('shared')")
+	var devices []string
+	for i, label := range []string{"DQ0001", "DQ0002"} {
+		devicePath := "file://" + t.TempDir()
+		drive := tape.NewServiceForDevice(devicePath, 65536)
+		if err := drive.WriteTapeLabel(ctx, label, "uuid-"+label, "shared"); err != nil {
+			t.Fatalf("WriteTapeLabel: %v", err)
+		}
+		db.Exec("INSERT INTO tapes (uuid, barcode, label, pool_id, status, capacity_bytes, used_bytes) VALUES (?, ?, ?, 1, 'active', 10000000, 0)", "uuid-"+label, label, label)
+		db.Exec("INSERT INTO tape_drives (device_path, display_name, status, current_tape_id) VALUES (?, ?, 'ready', ?)", devicePath, label, i+1)
+		devices = append(devices, devicePath)
+	}
+	db.Exec("INSERT INTO backup_sources (name, source_type, path) VALUES ('docs', 'local', ?)", srcDir)
+	for _, name := range []string{"docs", "mail", "web", "logs"} {
+		db.Exec("INSERT INTO backup_jobs (name, source_id, pool_id, backup_type, schedule_cron, retention_days) VALUES (?, 1, 1, 'full', '', 30)", name)
+	}
+
+	logger, _ := logging.NewLogger("error", "text", "")
+	svc := NewService(db, tape.NewServiceForDevice(devices[0], 65536), logger, 65536, 0, 0)
+
+	reservedBy := func(devicePath string) int64 {
+		var jobID sql.NullInt64
+		db.QueryRow("SELECT reserved_job_id FROM tape_drives WHERE device_path = ?", devicePath).Scan(&jobID)
+		return jobID.Int64
+	}
+
+	// Jobs on different drives do not wait for each other
+	releaseMail, err := svc.acquireDrive(ctx, 2, devices[0])
+	if err != nil {
+		t.Fatalf("acquireDrive: %v", err)
+	}
+	releaseWeb, err := svc.acquireDrive(ctx, 3, devices[1])
+	if err != nil {
+		t.Fatalf("acquireDrive on another drive: %v", err)
+	}
+	releaseWeb()
+	if reservedBy(devices[0]) != 2 || reservedBy(devices[1]) != 0 {
+		t.Fatalf("expected only the first drive reserved by job 2, got %d and %d", reservedBy(devices[0]), reservedBy(devices[1]))
+	}
+
+	// A job for a held drive queues; giving up the wait leaves the queue
+	acquired := make(chan func())
+	go func() {
+		release, err := svc.acquireDrive(ctx, 3, devices[0])
+		if err != nil {
+			t.Errorf("acquireDrive while queued: %v", err)
+		}
+		acquired <- release
+	}()
+	waitFor(t, func() bool {
+		queues := svc.DriveQueues()
+		return len(queues) == 1 && len(queues[0].WaitingJobs) == 1
+	})
+	cancelled, cancel := context.WithCancel(ctx)
+	cancel()
+	if _, err := svc.acquireDrive(cancelled, 4, devices[0]); err == nil {
+		t.Fatal("expected a cancelled wait to fail")
+	}
+	if queues := svc.DriveQueues(); queues[0].JobName != "mail" || len(queues[0].WaitingJobs) != 1 || queues[0].WaitingJobs[0] != 3 {
+		t.Fatalf("unexpected queues %+v", queues)
+	}
+
+	releaseMail()
+	releaseWeb = <-acquired
+	if reservedBy(devices[0]) != 3 {
+		t.Fatalf("expected the drive handed to job 3, reserved by %d", reservedBy(devices[0]))
+	}
+
+	// A run pinned to the drive waits for it, then writes
+	db.Exec("UPDATE backup_jobs SET drive_id = 1 WHERE id = 1")
+	job := &models.BackupJob{ID: 1, Name: "docs", PoolID: 1}
+	source := &models.BackupSource{ID: 1, Name: "docs", Path: srcDir}
+	done := make(chan error)
+	go func() {
+		_, err := svc.RunBackup(ctx, job, source, 1, models.BackupTypeFull)
+		done <- err
+	}()
+	waitFor(t, func() bool {
+		for _, p := range svc.GetActiveJobs() {
+			if p.JobID == 1 && p.Phase == "queued" {
+				return true
+			}
+		}
+		return false
+	})
+	releaseWeb()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("RunBackup: %v", err)
+		}
+	case <-time.After(30 * time.Second):
+		t.Fatal("pinned run did not finish after the drive was released")
+	}
+	if reservedBy(devices[0]) != 0 || len(svc.DriveQueues()) != 0 {
+		t.Errorf("expected the drive released after the run, reserved by %d", reservedBy(devices[0]))
+	}
+}
+
+// waitFor polls cond until it holds or the test times out
+func waitFor(t *testing.T, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(10 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal("timed out waiting for condition")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
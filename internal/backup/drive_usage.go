@@ -0,0 +1,18 @@
+package backup
+
+import "time"
+
+// recordDriveUsage adds a stretch of writing to the drive's usage history,
+// which drive selection weighs to spread wear across drives
+func (s *Service) recordDriveUsage(devicePath string, elapsed time.Duration, written int64) {
+	if elapsed <= 0 {
+		return
+	}
+	_, err := s.db.Exec(`
+		INSERT INTO drive_usage (drive_id, write_seconds, bytes_written)
+		SELECT id, ?, ? FROM tape_drives WHERE device_path = ?
+	`, elapsed.Seconds(), written, devicePath)
+	if err != nil {
+		s.logger.Warn("Failed to record drive usage", map[string]interface{}{"device": devicePath, "error": err.Error()})
+	}
+}
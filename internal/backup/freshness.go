@@ -0,0 +1,172 @@
+package backup
+
+import (
+	"time"
+)
+
+// Freshness is the age of the newest successful backup of a source or job
+// measured against its recovery point objective (RPO). RPOHours is the
+// effective objective; 0 means the item is not checked.
+type Freshness struct {
+	ID          int64      `json:"id"`
+	Name        string     `json:"name"`
+	SourceID    int64      `json:"source_id,omitempty"`
+	SourceName  string     `json:"source_name,omitempty"`
+	RPOHours    int        `json:"rpo_hours"`
+	LastSuccess *time.Time `json:"last_success_at"`
+	AgeSeconds  *float64   `json:"age_seconds"`
+	Violation   bool       `json:"violation"`
+}
+
+// FreshnessReport lists the freshness of every monitored source and job
+type FreshnessReport struct {
+	CheckedAt        time.Time   `json:"checked_at"`
+	DefaultRPOHours  int         `json:"default_rpo_hours"`
+	Sources          []Freshness `json:"sources"`
+	Jobs             []Freshness `json:"jobs"`
+	SourceViolations int         `json:"source_violations"`
+	JobViolations    int         `json:"job_violations"`
+}
+
+// effectiveRPO resolves an RPO setting: positive values apply as is, 0
+// inherits fallback and negative values turn the check off
+func effectiveRPO(hours, fallback int) int {
+	switch {
+	case hours > 0:
+		return hours
+	case hours < 0:
+		return 0
+	default:
+		return fallback
+	}
+}
+
+// check fills in the age and violation flag as of now
+func (f *Freshness) check(now time.Time) {
+	if f.LastSuccess != nil {
+		age := now.Sub(*f.LastSuccess).Seconds()
+		f.AgeSeconds = &age
+	}
+	if f.RPOHours <= 0 {
+		return
+	}
+	f.Violation = f.LastSuccess == nil || now.Sub(*f.LastSuccess) > time.Duration(f.RPOHours)*time.Hour
+}
+
+// Freshness reports how old the newest completed backup set of every
+// enabled source and job is. A source's RPO defaults to defaultRPOHours and
+// a job's to its source's. A source that was never backed up violates its
+// RPO; disabled sources and jobs, and ad-hoc runs, are not monitored.
+func (s *Service) Freshness(defaultRPOHours int, now time.Time) (*FreshnessReport, error) {
+	report := &FreshnessReport{
+		CheckedAt:       now.UTC(),
+		DefaultRPOHours: defaultRPOHours,
+		Sources:         make([]Freshness, 0),
+		Jobs:            make([]Freshness, 0),
+	}
+
+	// Newest completed set of every job
+	newest := make(map[int64]time.Time)
+	rows, err := s.db.Query(`
+		SELECT bs.job_id, bs.start_time
+		FROM backup_sets bs
+		WHERE bs.status = 'completed' AND bs.invalidated_at IS NULL
+		  AND bs.start_time = (SELECT MAX(start_time) FROM backup_sets WHERE job_id = bs.job_id AND status = 'completed' AND invalidated_at IS NULL)
+	`)
+	if err != nil {
+		return nil, err
+	}
+	for rows.Next() {
+		var jobID int64
+		var start time.Time
+		if err := rows.Scan(&jobID, &start); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		newest[jobID] = start
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	sourceIndex := make(map[int64]int)
+	rows, err = s.db.Query(`
+		SELECT id, name, rpo_hours FROM backup_sources
+		WHERE ad_hoc = 0 AND enabled = 1
+		ORDER BY name
+	`)
+	if err != nil {
+		return nil, err
+	}
+	for rows.Next() {
+		var f Freshness
+		var rpo int
+		if err := rows.Scan(&f.ID, &f.Name, &rpo); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		f.RPOHours = effectiveRPO(rpo, defaultRPOHours)
+		sourceIndex[f.ID] = len(report.Sources)
+		report.Sources = append(report.Sources, f)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	// A source is as fresh as the newest set of any of its jobs, including
+	// disabled ones
+	rows, err = s.db.Query(`
+		SELECT id, name, source_id, rpo_hours, enabled FROM backup_jobs
+		WHERE ad_hoc = 0
+		ORDER BY name
+	`)
+	if err != nil {
+		return nil, err
+	}
+	for rows.Next() {
+		var f Freshness
+		var rpo int
+		var enabled bool
+		if err := rows.Scan(&f.ID, &f.Name, &f.SourceID, &rpo, &enabled); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		idx, monitored := sourceIndex[f.SourceID]
+		if last, ok := newest[f.ID]; ok {
+			last := last
+			f.LastSuccess = &last
+			if monitored {
+				src := &report.Sources[idx]
+				if src.LastSuccess == nil || last.After(*src.LastSuccess) {
+					src.LastSuccess = &last
+				}
+			}
+		}
+		if !monitored || !enabled {
+			continue
+		}
+		f.SourceName = report.Sources[idx].Name
+		f.RPOHours = effectiveRPO(rpo, report.Sources[idx].RPOHours)
+		report.Jobs = append(report.Jobs, f)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	for i := range report.Sources {
+		report.Sources[i].check(now)
+		if report.Sources[i].Violation {
+			report.SourceViolations++
+		}
+	}
+	for i := range report.Jobs {
+		report.Jobs[i].check(now)
+		if report.Jobs[i].Violation {
+			report.JobViolations++
+		}
+	}
+	return report, nil
+}
@@ -0,0 +1,131 @@
+package backup
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/RoseOO/TapeBackarr/internal/models"
+)
+
+// GuardrailError is returned by RunBackup when a run exceeded its job's
+// guardrails and was stopped before anything was written
+type GuardrailError struct {
+	Action models.GuardrailAction
+	Reason string
+}
+
+func (e *GuardrailError) Error() string {
+	if e.Action == models.GuardrailDryRun {
+		return "guardrails exceeded, run ended as a dry run: " + e.Reason
+	}
+	return "guardrails exceeded, the next run must be confirmed: " + e.Reason
+}
+
+// hasGuardrails reports whether any of the job's guardrails is set
+func hasGuardrails(job *models.BackupJob) bool {
+	return job.GuardMaxFiles > 0 || job.GuardMaxBytes > 0 || job.GuardMaxChangePercent > 0
+}
+
+// checkGuardrails compares what a run is about to write with its job's
+// guardrails and, for the change limit, with the previous completed run of
+// the same type. It returns why the run exceeds them, or "" when it does not.
+func (s *Service) checkGuardrails(job *models.BackupJob, backupType models.BackupType, backupSetID, files, bytes int64) string {
+	var reasons []string
+	if job.GuardMaxFiles > 0 && files > job.GuardMaxFiles {
+		reasons = append(reasons, fmt.Sprintf("%d files exceed the limit of %d", files, job.GuardMaxFiles))
+	}
+	if job.GuardMaxBytes > 0 && bytes > job.GuardMaxBytes {
+		reasons = append(reasons, fmt.Sprintf("%d bytes exceed the limit of %d", bytes, job.GuardMaxBytes))
+	}
+	if job.GuardMaxChangePercent > 0 {
+		prevFiles, prevBytes, err := s.previousRunTotals(job.ID, backupType, backupSetID)
+		if err == nil {
+			if pct, ok := changePercent(files, prevFiles); ok && pct > job.GuardMaxChangePercent {
+				reasons = append(reasons, fmt.Sprintf("file count changed by %d%% since the previous run (%d to %d), more than %d%%", pct, prevFiles, files, job.GuardMaxChangePercent))
+			}
+			if pct, ok := changePercent(bytes, prevBytes); ok && pct > job.GuardMaxChangePercent {
+				reasons = append(reasons, fmt.Sprintf("size changed by %d%% since the previous run (%d to %d bytes), more than %d%%", pct, prevBytes, bytes, job.GuardMaxChangePercent))
+			}
+		} else if err != sql.ErrNoRows {
+			s.logger.Warn("Failed to load the previous run for guardrails", map[string]interface{}{
+				"job_id": job.ID,
+				"error":  err.Error(),
+			})
+		}
+	}
+	return strings.Join(reasons, "; ")
+}
+
+// previousRunTotals returns the files and bytes of the job's last completed
+// run of a type. A run spanning several tapes counts as a whole.
+func (s *Service) previousRunTotals(jobID int64, backupType models.BackupType, excludeSetID int64) (int64, int64, error) {
+	var files, bytes int64
+	err := s.db.QueryRow(`
+		SELECT COALESCE(ss.total_files, bs.file_count), COALESCE(ss.total_bytes, bs.total_bytes)
+		FROM backup_sets bs
+		LEFT JOIN tape_spanning_members m ON m.backup_set_id = bs.id
+		LEFT JOIN tape_spanning_sets ss ON ss.id = m.spanning_set_id
+		WHERE bs.job_id = ? AND bs.backup_type = ? AND bs.status = 'completed' AND bs.id != ?
+		  AND COALESCE(m.sequence_number, 1) = 1
+		ORDER BY bs.start_time DESC, bs.id DESC LIMIT 1
+	`, jobID, backupType, excludeSetID).Scan(&files, &bytes)
+	return files, bytes, err
+}
+
+// changePercent returns how much current differs from previous in percent.
+// There is no meaningful percentage against an empty previous run.
+func changePercent(current, previous int64) (int, bool) {
+	if previous <= 0 {
+		return 0, false
+	}
+	diff := current - previous
+	if diff < 0 {
+		diff = -diff
+	}
+	return int(diff * 100 / previous), true
+}
+
+// consumeGuardrailConfirmation clears the job's confirmation and reports
+// whether there was one. It is read from the database rather than the job,
+// as the scheduler holds copies of jobs loaded before the confirmation.
+func (s *Service) consumeGuardrailConfirmation(jobID int64) bool {
+	result, err := s.db.Exec("UPDATE backup_jobs SET guard_confirmed = 0 WHERE id = ? AND guard_confirmed = 1", jobID)
+	if err != nil {
+		return false
+	}
+	n, _ := result.RowsAffected()
+	return n > 0
+}
+
+// stopAtGuardrail ends a run that exceeded its guardrails before anything
+// was written. The set is kept as a cancelled record of what the run would
+// have written and why it stopped.
+func (s *Service) stopAtGuardrail(job *models.BackupJob, backupSetID, files, bytes int64, reason string) error {
+	action := job.GuardAction
+	if action == "" {
+		action = models.GuardrailConfirm
+	}
+	s.db.Exec(`
+		UPDATE backup_sets SET status = ?, guardrail = ?, end_time = ?, updated_at = CURRENT_TIMESTAMP
+		WHERE id = ?
+	`, models.BackupSetStatusCancelled, reason, time.Now(), backupSetID)
+
+	s.logger.Warn("Backup stopped by guardrails", map[string]interface{}{
+		"job_id":        job.ID,
+		"backup_set_id": backupSetID,
+		"files":         files,
+		"bytes":         bytes,
+		"reason":        reason,
+		"action":        action,
+	})
+	if action == models.GuardrailDryRun {
+		s.updateProgress(job.ID, "completed", fmt.Sprintf("Dry run: would have written %d files (%d bytes); %s", files, bytes, reason))
+		s.emitEvent("warning", "backup", "backup_guardrail_dry_run", job.Name, reason)
+	} else {
+		s.updateProgress(job.ID, "cancelled", fmt.Sprintf("Stopped before writing %d files (%d bytes); %s. Confirm the next run to go ahead", files, bytes, reason))
+		s.emitEvent("warning", "backup", "backup_guardrail_confirm", job.Name, reason)
+	}
+	return &GuardrailError{Action: action, Reason: reason}
+}
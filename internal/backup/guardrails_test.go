@@ -0,0 +1,117 @@
+package backup
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/RoseOO/TapeBackarr/internal/database"
+	"github.com/RoseOO/TapeBackarr/internal/logging"
+	"github.com/RoseOO/TapeBackarr/internal/models"
+	"github.com/RoseOO/TapeBackarr/internal/tape"
+)
+
+func TestGuardrails(t *testing.T) {
+	ctx := context.Background()
+	db, err := database.New(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("failed to create database: %v", err)
+	}
+	defer db.Close()
+	if err := db.Migrate(); err != nil {
+		t.Fatalf("failed to migrate database: %v", err)
+	}
+
+	srcDir := t.TempDir()
+	for _, name := range []string{"a.txt", "b.txt", "c.txt"} {
+		os.WriteFile(filepath.Join(srcDir, name), []byte("data "+name), 0644)
+	}
+	devicePath := "file://" + t.TempDir()
+	drive := tape.NewServiceForDevice(devicePath, 65536)
+	if err := drive.WriteTapeLabel(ctx, "GR0001", "uuid-gr", "guarded"); err != nil {
+		t.Fatalf("WriteTapeLabel: %v", err)
+	}
+	db.Exec("INSERT INTO tape_pools (name) VALUES ('guarded')")
+	db.Exec("INSERT INTO tapes (uuid, barcode, label, pool_id, status, capacity_bytes, used_bytes) VALUES ('uuid-gr', 'GR0001', 'GR0001', 1, 'active', 10000000, 0)")
+	db.Exec("INSERT INTO tape_drives (device_path, display_name, status, current_tape_id) VALUES (?, 'vtape', 'ready', 1)", devicePath)
+	db.Exec("INSERT INTO backup_sources (name, source_type, path) VALUES ('docs', 'local', ?)", srcDir)
+	db.Exec("INSERT INTO backup_jobs (name, source_id, pool_id, backup_type, schedule_cron, retention_days) VALUES ('docs', 1, 1, 'full', '', 30)")
+
+	logger, _ := logging.NewLogger("error", "text", "")
+	svc := NewService(db, drive, logger, 65536, 0, 0)
+	job := &models.BackupJob{ID: 1, Name: "docs", PoolID: 1, GuardMaxFiles: 2, GuardAction: models.GuardrailDryRun}
+	source := &models.BackupSource{ID: 1, Name: "docs", Path: srcDir}
+
+	// Three files exceed the limit of two; nothing is written
+	_, err = svc.RunBackup(ctx, job, source, 1, models.BackupTypeFull)
+	var guardErr *GuardrailError
+	if !errors.As(err, &guardErr) || guardErr.Action != models.GuardrailDryRun {
+		t.Fatalf("expected a dry run guardrail error, got %v", err)
+	}
+	var status, guardrail string
+	db.QueryRow("SELECT status, guardrail FROM backup_sets WHERE id = 1").Scan(&status, &guardrail)
+	if status != "cancelled" || !strings.Contains(guardrail, "3 files exceed the limit of 2") {
+		t.Errorf("unexpected set status %q guardrail %q", status, guardrail)
+	}
+	var used int64
+	db.QueryRow("SELECT used_bytes FROM tapes WHERE id = 1").Scan(&used)
+	if used != 0 {
+		t.Errorf("expected nothing written, tape used %d bytes", used)
+	}
+
+	// A confirmed run goes ahead once and records what it went past
+	db.Exec("UPDATE backup_jobs SET guard_confirmed = 1 WHERE id = 1")
+	set, err := svc.RunBackup(ctx, job, source, 1, models.BackupTypeFull)
+	if err != nil {
+		t.Fatalf("confirmed run failed: %v", err)
+	}
+	db.QueryRow("SELECT status, guardrail FROM backup_sets WHERE id = ?", set.ID).Scan(&status, &guardrail)
+	if status != "completed" || !strings.HasPrefix(guardrail, "confirmed: ") {
+		t.Errorf("unexpected set status %q guardrail %q", status, guardrail)
+	}
+	var confirmed bool
+	db.QueryRow("SELECT guard_confirmed FROM backup_jobs WHERE id = 1").Scan(&confirmed)
+	if confirmed {
+		t.Error("expected the confirmation to be used up")
+	}
+
+	// Against the completed run of three files, doubling the source is a
+	// 100% change
+	for _, name := range []string{"d.txt", "e.txt", "f.txt"} {
+		os.WriteFile(filepath.Join(srcDir, name), []byte("data "+name), 0644)
+	}
+	job.GuardMaxFiles = 0
+	job.GuardMaxChangePercent = 50
+	job.GuardAction = models.GuardrailConfirm
+	_, err = svc.RunBackup(ctx, job, source, 1, models.BackupTypeFull)
+	if !errors.As(err, &guardErr) || guardErr.Action != models.GuardrailConfirm || !strings.Contains(guardErr.Reason, "file count changed by 100%") {
+		t.Fatalf("expected a confirmation guardrail error for the change, got %v", err)
+	}
+
+	job.GuardMaxChangePercent = 150
+	if _, err := svc.RunBackup(ctx, job, source, 1, models.BackupTypeFull); err != nil {
+		t.Fatalf("expected the run within the change limit to succeed, got %v", err)
+	}
+}
+
+func TestChangePercent(t *testing.T) {
+	cases := []struct {
+		current, previous int64
+		want              int
+		ok                bool
+	}{
+		{150, 100, 50, true},
+		{50, 100, 50, true},
+		{100, 100, 0, true},
+		{10, 0, 0, false},
+	}
+	for _, tc := range cases {
+		got, ok := changePercent(tc.current, tc.previous)
+		if got != tc.want || ok != tc.ok {
+			t.Errorf("changePercent(%d, %d) = %d, %v; want %d, %v", tc.current, tc.previous, got, ok, tc.want, tc.ok)
+		}
+	}
+}
@@ -0,0 +1,492 @@
+package backup
+
+import (
+	"archive/tar"
+	"bufio"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/RoseOO/TapeBackarr/internal/models"
+	"github.com/RoseOO/TapeBackarr/internal/tape"
+)
+
+// ArchiveEntry describes a single regular file found inside a disk archive.
+type ArchiveEntry struct {
+	Path     string    `json:"path"`
+	Size     int64     `json:"size"`
+	Mode     int       `json:"mode"`
+	ModTime  time.Time `json:"mod_time"`
+	Checksum string    `json:"checksum"`
+	UID      int       `json:"uid"`
+	GID      int       `json:"gid"`
+	Owner    string    `json:"owner,omitempty"`
+	Group    string    `json:"group,omitempty"`
+	// HasXattrs is set when the archive carries extended attributes for
+	// the member
+	HasXattrs bool `json:"has_xattrs,omitempty"`
+}
+
+// DetectArchiveCompression infers the compression of a tar archive from its
+// file name. Plain .tar archives return CompressionNone.
+func DetectArchiveCompression(archivePath string) (models.CompressionType, error) {
+	name := strings.ToLower(archivePath)
+	switch {
+	case strings.HasSuffix(name, ".tar"):
+		return models.CompressionNone, nil
+	case strings.HasSuffix(name, ".tar.gz"), strings.HasSuffix(name, ".tgz"):
+		return models.CompressionGzip, nil
+	case strings.HasSuffix(name, ".tar.zst"), strings.HasSuffix(name, ".tzst"):
+		return models.CompressionZstd, nil
+	default:
+		return "", fmt.Errorf("unsupported archive type: %s (expected .tar, .tar.gz or .tar.zst)", archivePath)
+	}
+}
+
+// IndexArchive reads every header of a tar archive on disk and returns the
+// regular files it contains along with their SHA-256 checksums. Reading the
+// whole archive up front also validates it before anything is written to tape.
+func (s *Service) IndexArchive(ctx context.Context, archivePath string, compression models.CompressionType) ([]ArchiveEntry, error) {
+	f, err := os.Open(archivePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open archive: %w", err)
+	}
+	defer f.Close()
+
+	var reader io.Reader = bufio.NewReaderSize(f, relayBufferSize)
+	var decompCmd *exec.Cmd
+	switch compression {
+	case models.CompressionNone:
+	case models.CompressionGzip:
+		gz, err := gzip.NewReader(reader)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open gzip stream: %w", err)
+		}
+		defer gz.Close()
+		reader = gz
+	case models.CompressionZstd:
+		decompCmd = exec.CommandContext(ctx, "zstd", "-d", "-c", "--no-progress")
+		decompCmd.Stdin = reader
+		pipe, err := decompCmd.StdoutPipe()
+		if err != nil {
+			return nil, fmt.Errorf("failed to create zstd pipe: %w", err)
+		}
+		if err := decompCmd.Start(); err != nil {
+			return nil, fmt.Errorf("failed to start zstd: %w", err)
+		}
+		defer decompCmd.Wait()
+		reader = pipe
+	default:
+		return nil, fmt.Errorf("unsupported compression type: %s", compression)
+	}
+
+	var entries []ArchiveEntry
+	tr := tar.NewReader(reader)
+	for {
+		if ctx.Err() != nil {
+			if decompCmd != nil {
+				decompCmd.Process.Kill()
+			}
+			return nil, ctx.Err()
+		}
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			if decompCmd != nil {
+				decompCmd.Process.Kill()
+			}
+			return nil, fmt.Errorf("failed to read archive: %w", err)
+		}
+		if hdr.Typeflag != tar.TypeReg {
+			continue
+		}
+
+		h := sha256.New()
+		if _, err := io.Copy(h, tr); err != nil {
+			if decompCmd != nil {
+				decompCmd.Process.Kill()
+			}
+			return nil, fmt.Errorf("failed to read %s from archive: %w", hdr.Name, err)
+		}
+
+		entries = append(entries, ArchiveEntry{
+			Path:      archiveEntryPath(hdr.Name),
+			Size:      hdr.Size,
+			Mode:      int(hdr.Mode),
+			ModTime:   hdr.ModTime,
+			Checksum:  hex.EncodeToString(h.Sum(nil)),
+			UID:       hdr.Uid,
+			GID:       hdr.Gid,
+			Owner:     hdr.Uname,
+			Group:     hdr.Gname,
+			HasXattrs: archiveHasXattrs(hdr),
+		})
+	}
+
+	return entries, nil
+}
+
+// archiveHasXattrs reports whether a tar member carries extended attributes,
+// which GNU tar and bsdtar store as SCHILY.xattr or LIBARCHIVE.xattr PAX
+// records
+func archiveHasXattrs(hdr *tar.Header) bool {
+	for key := range hdr.PAXRecords {
+		if strings.HasPrefix(key, "SCHILY.xattr.") || strings.HasPrefix(key, "LIBARCHIVE.xattr.") {
+			return true
+		}
+	}
+	return false
+}
+
+// archiveEntryPath normalises a tar member name to the relative form used by
+// catalog entries written by regular backups (no leading "./" or "/").
+func archiveEntryPath(name string) string {
+	cleaned := path.Clean("/" + name)
+	return strings.TrimPrefix(cleaned, "/")
+}
+
+// ImportArchive writes an existing tar archive from disk onto a tape as a new
+// backup set belonging to job, and indexes the archive contents into the
+// catalog so the files become searchable and restorable like any other backup.
+// The archive bytes are written verbatim; compressed archives are recorded with
+// the matching compression type so restore decompresses them transparently.
+func (s *Service) ImportArchive(ctx context.Context, job *models.BackupJob, tapeID int64, archivePath string) (*models.BackupSet, error) {
+	startTime := time.Now()
+
+	compression, err := DetectArchiveCompression(archivePath)
+	if err != nil {
+		return nil, err
+	}
+	archiveInfo, err := os.Stat(archivePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to stat archive: %w", err)
+	}
+	if archiveInfo.IsDir() {
+		return nil, fmt.Errorf("archive path %s is a directory", archivePath)
+	}
+
+	var tapeLabel, tapeUUID, poolName, tapeFormatType string
+	var tapeCapacity, tapeUsed int64
+	if err := s.db.QueryRow(`
+		SELECT t.label, t.uuid, COALESCE(p.name, ''), COALESCE(t.format_type, 'raw'), t.capacity_bytes, t.used_bytes
+		FROM tapes t LEFT JOIN tape_pools p ON t.pool_id = p.id
+		WHERE t.id = ?
+	`, tapeID).Scan(&tapeLabel, &tapeUUID, &poolName, &tapeFormatType, &tapeCapacity, &tapeUsed); err != nil {
+		return nil, fmt.Errorf("tape not found: %w", err)
+	}
+	if tapeFormatType == string(models.TapeFormatLTFS) {
+		return nil, fmt.Errorf("tape %s is LTFS formatted; archives can only be imported onto raw tapes", tapeLabel)
+	}
+	if tapeCapacity > 0 && archiveInfo.Size() > tapeCapacity-tapeUsed {
+		return nil, fmt.Errorf("archive (%d bytes) does not fit on tape %s (%d bytes free)", archiveInfo.Size(), tapeLabel, tapeCapacity-tapeUsed)
+	}
+
+	var devicePath string
+	if err := s.db.QueryRow("SELECT device_path FROM tape_drives WHERE current_tape_id = ? AND COALESCE(enabled, 1) = 1", tapeID).Scan(&devicePath); err != nil {
+		return nil, fmt.Errorf("tape %s is not loaded in any enabled drive", tapeLabel)
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	var pauseFlag int32
+
+	s.mu.Lock()
+	if _, running := s.activeJobs[job.ID]; running {
+		s.mu.Unlock()
+		cancel()
+		return nil, fmt.Errorf("job %s is already running", job.Name)
+	}
+	s.activeJobs[job.ID] = &JobProgress{
+		JobID:             job.ID,
+		JobName:           job.Name,
+		Phase:             "initializing",
+		Status:            "running",
+		Message:           "Starting archive import...",
+		TapeLabel:         tapeLabel,
+		TapeCapacityBytes: tapeCapacity,
+		TapeUsedBytes:     tapeUsed,
+		DevicePath:        devicePath,
+		StartTime:         startTime,
+		UpdatedAt:         startTime,
+		LogLines:          []string{fmt.Sprintf("[%s] Importing archive %s for job %s", startTime.Format("15:04:05"), archivePath, job.Name)},
+	}
+	s.cancelFuncs[job.ID] = cancel
+	s.pauseFlags[job.ID] = &pauseFlag
+	s.mu.Unlock()
+	defer func() {
+		s.mu.Lock()
+		delete(s.activeJobs, job.ID)
+		delete(s.cancelFuncs, job.ID)
+		delete(s.pauseFlags, job.ID)
+		s.mu.Unlock()
+		cancel()
+	}()
+
+	releaseTapes, err := s.holdTape(tapeID, job.ID)
+	if err != nil {
+		return nil, err
+	}
+	defer releaseTapes()
+
+	s.emitEvent("info", "backup", "archive_import_started", archivePath, tapeLabel, job.Name)
+
+	// Index the archive before touching the tape so a corrupt archive never
+	// produces a half-written backup set.
+	s.updateProgress(job.ID, "scanning", fmt.Sprintf("Indexing archive %s...", archivePath))
+	entries, err := s.IndexArchive(ctx, archivePath, compression)
+	if err != nil {
+		s.updateProgress(job.ID, "failed", "Failed to index archive: "+err.Error())
+		return nil, fmt.Errorf("failed to index archive: %w", err)
+	}
+	var totalBytes int64
+	for _, e := range entries {
+		totalBytes += e.Size
+	}
+	s.mu.Lock()
+	if p, ok := s.activeJobs[job.ID]; ok {
+		p.TotalFiles = int64(len(entries))
+		p.TotalBytes = archiveInfo.Size()
+	}
+	s.mu.Unlock()
+
+	compressed := compression != models.CompressionNone
+	result, err := s.db.Exec(`
+		INSERT INTO backup_sets (job_id, tape_id, backup_type, format_type, start_time, status, compressed, compression_type, block_size)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`, job.ID, tapeID, models.BackupTypeFull, tapeFormatType, startTime, models.BackupSetStatusRunning, compressed, compression, s.blockSize)
+	if err != nil {
+		s.updateProgress(job.ID, "failed", "Failed to create backup set: "+err.Error())
+		return nil, fmt.Errorf("failed to create backup set: %w", err)
+	}
+	backupSetID, _ := result.LastInsertId()
+	s.mu.Lock()
+	if p, ok := s.activeJobs[job.ID]; ok {
+		p.BackupSetID = backupSetID
+	}
+	s.mu.Unlock()
+
+	fail := func(msg string, cause error) (*models.BackupSet, error) {
+		s.updateProgress(job.ID, "failed", msg)
+		s.updateBackupSetStatus(backupSetID, models.BackupSetStatusFailed, msg)
+		s.emitEvent("error", "backup", "archive_import_failed", job.Name, msg)
+		return nil, fmt.Errorf("%s: %w", msg, cause)
+	}
+
+	s.db.Exec("UPDATE tape_drives SET status = 'busy' WHERE device_path = ?", devicePath)
+	defer s.db.Exec("UPDATE tape_drives SET status = 'ready' WHERE device_path = ?", devicePath)
+
+	s.updateProgress(job.ID, "positioning", "Verifying tape label before write...")
+	driveSvc := tape.NewServiceForDevice(devicePath, s.tapeService.GetBlockSize())
+	physicalLabel, err := driveSvc.ReadTapeLabel(ctx)
+	if err != nil {
+		return fail("Failed to read tape label", err)
+	}
+	if physicalLabel == nil || physicalLabel.Label != tapeLabel || physicalLabel.UUID != tapeUUID {
+		actual := "unlabeled"
+		if physicalLabel != nil {
+			actual = physicalLabel.Label
+		}
+		return fail("Tape label mismatch", fmt.Errorf("expected %q but found %q", tapeLabel, actual))
+	}
+	if err := driveSvc.SeekToFileNumber(ctx, 1); err != nil {
+		return fail("Failed to position tape past label", err)
+	}
+	if _, startBlock, posErr := driveSvc.GetTapePosition(ctx); posErr == nil {
+		s.db.Exec("UPDATE backup_sets SET start_block = ? WHERE id = ?", startBlock, backupSetID)
+	}
+
+	s.updateProgress(job.ID, "streaming", fmt.Sprintf("Writing archive to tape %s (%d files)...", tapeLabel, len(entries)))
+	progressCb := func(bytesWritten int64) {
+		s.mu.Lock()
+		if p, ok := s.activeJobs[job.ID]; ok {
+			p.BytesWritten = bytesWritten
+			p.UpdatedAt = time.Now()
+		}
+		s.mu.Unlock()
+	}
+	tapeBytes, err := s.streamArchiveToTape(ctx, archivePath, devicePath, progressCb, &pauseFlag)
+	if err != nil {
+		return fail("Failed to write archive to tape", err)
+	}
+	if tapeBytes == 0 {
+		tapeBytes = archiveInfo.Size()
+	}
+
+	s.updateProgress(job.ID, "cataloging", fmt.Sprintf("Cataloging %d files...", len(entries)))
+	if err := s.insertArchiveCatalog(backupSetID, entries); err != nil {
+		return fail("Failed to catalog archive contents", err)
+	}
+
+	if err := driveSvc.WriteFileMark(ctx); err != nil {
+		s.logger.Warn("Failed to write file mark", map[string]interface{}{"error": err.Error()})
+	}
+
+	toc := tape.NewTapeTOC(tapeLabel, tapeUUID, poolName)
+	tocSet := tape.TOCBackupSet{
+		FileNumber:      1,
+		JobName:         job.Name,
+		BackupType:      string(models.BackupTypeFull),
+		StartTime:       startTime,
+		EndTime:         time.Now(),
+		FileCount:       int64(len(entries)),
+		TotalBytes:      totalBytes,
+		Compressed:      compressed,
+		CompressionType: string(compression),
+		Files:           make([]tape.TOCFileEntry, 0, len(entries)),
+	}
+	for _, e := range entries {
+		tocSet.Files = append(tocSet.Files, tape.TOCFileEntry{
+			Path:     e.Path,
+			Size:     e.Size,
+			Mode:     e.Mode,
+			ModTime:  e.ModTime.Format(time.RFC3339),
+			Checksum: e.Checksum,
+		})
+	}
+	toc.BackupSets = append(toc.BackupSets, tocSet)
+	if err := driveSvc.WriteTOC(ctx, toc); err != nil {
+		s.logger.Warn("Failed to write TOC to tape", map[string]interface{}{"error": err.Error()})
+	}
+
+	endTime := time.Now()
+	s.db.Exec(`
+		UPDATE backup_sets SET end_time = ?, status = ?, file_count = ?, total_bytes = ?, tape_bytes = ?
+		WHERE id = ?
+	`, endTime, models.BackupSetStatusCompleted, len(entries), totalBytes, tapeBytes, backupSetID)
+	s.db.Exec(`
+		UPDATE tapes SET
+			used_bytes = used_bytes + ?, write_count = write_count + 1, physical_remaining_bytes = NULL,
+			last_written_at = ?,
+			status = CASE WHEN status = 'blank' THEN 'active' ELSE status END
+		WHERE id = ?
+	`, tapeBytes, endTime, tapeID)
+	s.db.Exec("UPDATE backup_jobs SET last_run_at = ? WHERE id = ?", endTime, job.ID)
+
+	s.updateProgress(job.ID, "completed", fmt.Sprintf("Archive imported: %d files, %d bytes in %s", len(entries), totalBytes, endTime.Sub(startTime).String()))
+	s.emitEvent("success", "backup", "archive_import_completed", archivePath, tapeLabel, len(entries))
+	s.logger.Info("Archive import completed", map[string]interface{}{
+		"job_id":        job.ID,
+		"archive":       archivePath,
+		"backup_set_id": backupSetID,
+		"file_count":    len(entries),
+		"total_bytes":   totalBytes,
+		"tape_bytes":    tapeBytes,
+		"compression":   compression,
+	})
+
+	return &models.BackupSet{
+		ID:              backupSetID,
+		JobID:           job.ID,
+		TapeID:          tapeID,
+		BackupType:      models.BackupTypeFull,
+		FormatType:      models.TapeFormatType(tapeFormatType),
+		StartTime:       startTime,
+		EndTime:         &endTime,
+		Status:          models.BackupSetStatusCompleted,
+		FileCount:       int64(len(entries)),
+		TotalBytes:      totalBytes,
+		Compressed:      compressed,
+		CompressionType: compression,
+	}, nil
+}
+
+// streamArchiveToTape copies an archive file verbatim onto the tape device,
+// going through mbuffer when available to keep the drive streaming.
+func (s *Service) streamArchiveToTape(ctx context.Context, archivePath, devicePath string, progressCb func(bytesWritten int64), pauseFlag *int32) (int64, error) {
+	f, err := os.Open(archivePath)
+	if err != nil {
+		return 0, fmt.Errorf("failed to open archive: %w", err)
+	}
+	defer f.Close()
+	return s.streamReaderToTape(ctx, f, devicePath, progressCb, pauseFlag)
+}
+
+// streamReaderToTape copies src verbatim onto the tape device at its current
+// position and returns the number of bytes written.
+func (s *Service) streamReaderToTape(ctx context.Context, src io.Reader, devicePath string, progressCb func(bytesWritten int64), pauseFlag *int32) (int64, error) {
+	cr := &countingReader{reader: src, callback: progressCb, paused: pauseFlag, pipelineDepth: s.pipelineDepth}
+
+	if s.useMbuffer(devicePath) {
+		mbufferCmd := exec.CommandContext(ctx, "mbuffer", "-s", fmt.Sprintf("%d", s.blockSize), "-m", fmt.Sprintf("%dM", s.bufferSizeMB), "-P", "90", "-o", devicePath)
+		mbufferCmd.Stdin = cr
+		output, err := mbufferCmd.CombinedOutput()
+		if ctx.Err() != nil {
+			return 0, fmt.Errorf("write cancelled: %w", ctx.Err())
+		}
+		if err != nil {
+			return 0, fmt.Errorf("mbuffer failed: %s", string(output))
+		}
+		return cr.bytesRead(), nil
+	}
+
+	tapeFile, err := s.openTapeWriter(ctx, devicePath)
+	if err != nil {
+		return 0, fmt.Errorf("failed to open tape device: %w", err)
+	}
+	defer tapeFile.Close()
+
+	bufferedTape := bufio.NewWriterSize(tapeFile, s.blockSize)
+	tapeCw := &countingWriter{writer: bufferedTape}
+	if _, err := io.Copy(tapeCw, cr); err != nil {
+		if ctx.Err() != nil {
+			return 0, fmt.Errorf("write cancelled: %w", ctx.Err())
+		}
+		return 0, fmt.Errorf("failed to write to tape: %w", err)
+	}
+	if err := bufferedTape.Flush(); err != nil {
+		return 0, fmt.Errorf("failed to flush tape buffer: %w", err)
+	}
+	if err := tapeFile.Close(); err != nil {
+		return 0, fmt.Errorf("failed to close tape device: %w", err)
+	}
+	return tapeCw.bytesWritten(), nil
+}
+
+// insertArchiveCatalog records the archive members as catalog entries of the
+// given backup set, batching inserts to keep large archives fast.
+func (s *Service) insertArchiveCatalog(backupSetID int64, entries []ArchiveEntry) error {
+	const batchSize = 500
+	for i := 0; i < len(entries); i += batchSize {
+		end := i + batchSize
+		if end > len(entries) {
+			end = len(entries)
+		}
+
+		tx, err := s.db.Begin()
+		if err != nil {
+			return err
+		}
+		stmt, err := tx.Prepare(`
+			INSERT INTO catalog_entries (backup_set_id, file_path, file_size, file_mode, mod_time, checksum, block_offset,
+				uid, gid, owner, group_name, file_type, has_xattrs, extension, content_class)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		`)
+		if err != nil {
+			tx.Rollback()
+			return err
+		}
+		for _, e := range entries[i:end] {
+			ext, class := classifyPath(e.Path)
+			if _, err := stmt.Exec(backupSetID, e.Path, e.Size, e.Mode, e.ModTime, e.Checksum, 0,
+				e.UID, e.GID, e.Owner, e.Group, FileTypeFile, e.HasXattrs, ext, class); err != nil {
+				stmt.Close()
+				tx.Rollback()
+				return fmt.Errorf("failed to insert catalog entry %s: %w", e.Path, err)
+			}
+		}
+		stmt.Close()
+		if err := tx.Commit(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
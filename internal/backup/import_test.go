@@ -0,0 +1,209 @@
+package backup
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/RoseOO/TapeBackarr/internal/database"
+	"github.com/RoseOO/TapeBackarr/internal/logging"
+	"github.com/RoseOO/TapeBackarr/internal/models"
+)
+
+// writeTestArchive creates a tar archive at path with the given files,
+// optionally wrapping it in gzip.
+func writeTestArchive(t *testing.T, path string, files map[string]string, gz bool) {
+	t.Helper()
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatalf("failed to create archive: %v", err)
+	}
+	defer f.Close()
+
+	var w io.Writer = f
+	var gzw *gzip.Writer
+	if gz {
+		gzw = gzip.NewWriter(f)
+		w = gzw
+	}
+	tw := tar.NewWriter(w)
+	if err := tw.WriteHeader(&tar.Header{Name: "./docs/", Typeflag: tar.TypeDir, Mode: 0755}); err != nil {
+		t.Fatalf("failed to write dir header: %v", err)
+	}
+	for name, content := range files {
+		hdr := &tar.Header{
+			Name:     name,
+			Typeflag: tar.TypeReg,
+			Mode:     0644,
+			Size:     int64(len(content)),
+			ModTime:  time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC),
+		}
+		if err := tw.WriteHeader(hdr); err != nil {
+			t.Fatalf("failed to write header: %v", err)
+		}
+		if _, err := tw.Write([]byte(content)); err != nil {
+			t.Fatalf("failed to write content: %v", err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatalf("failed to close tar writer: %v", err)
+	}
+	if gzw != nil {
+		if err := gzw.Close(); err != nil {
+			t.Fatalf("failed to close gzip writer: %v", err)
+		}
+	}
+}
+
+func TestDetectArchiveCompression(t *testing.T) {
+	tests := []struct {
+		path    string
+		want    models.CompressionType
+		wantErr bool
+	}{
+		{"/data/old.tar", models.CompressionNone, false},
+		{"/data/old.TAR.GZ", models.CompressionGzip, false},
+		{"/data/old.tgz", models.CompressionGzip, false},
+		{"/data/old.tar.zst", models.CompressionZstd, false},
+		{"/data/old.zip", "", true},
+	}
+	for _, tt := range tests {
+		got, err := DetectArchiveCompression(tt.path)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("DetectArchiveCompression(%q) error = %v, wantErr %v", tt.path, err, tt.wantErr)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("DetectArchiveCompression(%q) = %q, want %q", tt.path, got, tt.want)
+		}
+	}
+}
+
+func TestIndexArchive(t *testing.T) {
+	tmpDir := t.TempDir()
+	svc := &Service{}
+	files := map[string]string{
+		"./docs/readme.txt": "Hello, World!",
+		"/abs/data.bin":     "data",
+	}
+
+	for _, gz := range []bool{false, true} {
+		name := "archive.tar"
+		compression := models.CompressionNone
+		if gz {
+			name = "archive.tar.gz"
+			compression = models.CompressionGzip
+		}
+		archivePath := filepath.Join(tmpDir, name)
+		writeTestArchive(t, archivePath, files, gz)
+
+		entries, err := svc.IndexArchive(context.Background(), archivePath, compression)
+		if err != nil {
+			t.Fatalf("IndexArchive(%s) failed: %v", name, err)
+		}
+		if len(entries) != 2 {
+			t.Fatalf("expected 2 regular files in %s, got %d", name, len(entries))
+		}
+		byPath := make(map[string]ArchiveEntry)
+		for _, e := range entries {
+			byPath[e.Path] = e
+		}
+		readme, ok := byPath["docs/readme.txt"]
+		if !ok {
+			t.Fatalf("expected normalised path docs/readme.txt, got %v", byPath)
+		}
+		if readme.Checksum != "dffd6021bb2bd5b0af676290809ec3a53191dd81c7f70a4b28688a362182986f" {
+			t.Errorf("unexpected checksum for readme.txt: %s", readme.Checksum)
+		}
+		if readme.Size != 13 {
+			t.Errorf("expected size 13, got %d", readme.Size)
+		}
+		if _, ok := byPath["abs/data.bin"]; !ok {
+			t.Errorf("expected leading slash stripped from abs/data.bin, got %v", byPath)
+		}
+	}
+}
+
+func TestIndexArchiveCorrupt(t *testing.T) {
+	tmpDir := t.TempDir()
+	archivePath := filepath.Join(tmpDir, "bad.tar.gz")
+	os.WriteFile(archivePath, []byte("not a gzip stream"), 0644)
+
+	svc := &Service{}
+	if _, err := svc.IndexArchive(context.Background(), archivePath, models.CompressionGzip); err == nil {
+		t.Error("expected error for corrupt archive")
+	}
+}
+
+func TestImportArchiveRequiresLoadedTape(t *testing.T) {
+	tmpDir := t.TempDir()
+	db, err := database.New(filepath.Join(tmpDir, "test.db"))
+	if err != nil {
+		t.Fatalf("failed to create database: %v", err)
+	}
+	defer db.Close()
+	if err := db.Migrate(); err != nil {
+		t.Fatalf("failed to migrate database: %v", err)
+	}
+	db.Exec("INSERT INTO tape_pools (name) VALUES ('test-pool')")
+	db.Exec("INSERT INTO tapes (uuid, barcode, label, pool_id, status, capacity_bytes, used_bytes) VALUES ('uuid1', 'T001', 'T001', 1, 'active', 1500000000000, 0)")
+
+	archivePath := filepath.Join(tmpDir, "archive.tar")
+	writeTestArchive(t, archivePath, map[string]string{"a.txt": "a"}, false)
+
+	logger, _ := logging.NewLogger("error", "text", "")
+	svc := NewService(db, nil, logger, 65536, 0, 0)
+	job := &models.BackupJob{ID: 1, Name: "import"}
+	if _, err := svc.ImportArchive(context.Background(), job, 1, archivePath); err == nil {
+		t.Fatal("expected error when tape is not loaded in a drive")
+	}
+
+	var count int
+	db.QueryRow("SELECT COUNT(*) FROM backup_sets").Scan(&count)
+	if count != 0 {
+		t.Errorf("expected no backup set to be created, got %d", count)
+	}
+}
+
+func TestInsertArchiveCatalog(t *testing.T) {
+	tmpDir := t.TempDir()
+	db, err := database.New(filepath.Join(tmpDir, "test.db"))
+	if err != nil {
+		t.Fatalf("failed to create database: %v", err)
+	}
+	defer db.Close()
+	if err := db.Migrate(); err != nil {
+		t.Fatalf("failed to migrate database: %v", err)
+	}
+	db.Exec("INSERT INTO tape_pools (name) VALUES ('test-pool')")
+	db.Exec("INSERT INTO tapes (uuid, barcode, label, pool_id, status, capacity_bytes, used_bytes) VALUES ('uuid1', 'T001', 'T001', 1, 'active', 1500000000000, 0)")
+	db.Exec("INSERT INTO backup_sources (name, source_type, path) VALUES ('src', 'local', '/tmp')")
+	db.Exec("INSERT INTO backup_jobs (name, source_id, pool_id, backup_type, schedule_cron, retention_days) VALUES ('job', 1, 1, 'full', '', 30)")
+	result, err := db.Exec("INSERT INTO backup_sets (job_id, tape_id, backup_type, start_time, status) VALUES (1, 1, 'full', CURRENT_TIMESTAMP, 'running')")
+	if err != nil {
+		t.Fatalf("failed to insert backup set: %v", err)
+	}
+	backupSetID, _ := result.LastInsertId()
+
+	entries := make([]ArchiveEntry, 1203)
+	for i := range entries {
+		entries[i] = ArchiveEntry{Path: fmt.Sprintf("dir/file-%04d.txt", i), Size: int64(i), Mode: 0644, ModTime: time.Now()}
+	}
+
+	svc := &Service{db: db}
+	if err := svc.insertArchiveCatalog(backupSetID, entries); err != nil {
+		t.Fatalf("insertArchiveCatalog failed: %v", err)
+	}
+
+	var count int
+	db.QueryRow("SELECT COUNT(*) FROM catalog_entries WHERE backup_set_id = ?", backupSetID).Scan(&count)
+	if count != len(entries) {
+		t.Errorf("expected %d catalog entries, got %d", len(entries), count)
+	}
+}
@@ -0,0 +1,39 @@
+package backup
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/RoseOO/TapeBackarr/internal/library"
+)
+
+// SetLibraryLoader lets runs fetch their tapes from tape libraries instead of
+// waiting for an operator to insert them
+func (s *Service) SetLibraryLoader(l *library.Loader) {
+	s.library = l
+}
+
+// LibraryLoader returns the loader set with SetLibraryLoader, or nil
+func (s *Service) LibraryLoader() *library.Loader {
+	return s.library
+}
+
+// loadFromLibrary loads a tape the run needs from its library slot, into the
+// pinned drive when there is one. It reports false when there is no loader,
+// the tape is not in a library or the load failed; the run then asks the
+// operator for the tape as before.
+func (s *Service) loadFromLibrary(ctx context.Context, jobID, tapeID int64, label, pinnedDrive string) bool {
+	if s.library == nil || !s.library.InLibrary(tapeID) {
+		return false
+	}
+	s.updateProgress(jobID, "positioning", fmt.Sprintf("Loading tape %s from the library...", label))
+	load, err := s.library.Load(ctx, tapeID, library.Request{JobID: jobID, DevicePath: pinnedDrive})
+	if err != nil {
+		s.logger.Warn("Failed to load tape from library", map[string]interface{}{
+			"job_id": jobID, "tape": label, "error": err.Error(),
+		})
+		return false
+	}
+	s.emitEvent("info", "tape", "library_tape_loaded", load.Slot, load.DriveNumber)
+	return true
+}
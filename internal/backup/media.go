@@ -0,0 +1,201 @@
+package backup
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/RoseOO/TapeBackarr/internal/models"
+	"github.com/RoseOO/TapeBackarr/internal/tape"
+)
+
+// mediaCapacityTolerance is how far a tape's recorded capacity may be from
+// what the drive reports before it is corrected
+const mediaCapacityTolerance = 0.02
+
+// MediaUpdate describes a correction of a tape's LTO type or capacity from
+// what the drive reported
+type MediaUpdate struct {
+	TapeID      int64  `json:"tape_id"`
+	Label       string `json:"label"`
+	OldLTOType  string `json:"old_lto_type"`
+	LTOType     string `json:"lto_type"`
+	OldCapacity int64  `json:"old_capacity_bytes"`
+	Capacity    int64  `json:"capacity_bytes"`
+	// Mismatch is set when the tape had a declared type or capacity that
+	// the drive contradicted, rather than one that was simply missing
+	Mismatch bool `json:"mismatch"`
+}
+
+// ApplyMediaInfo corrects a tape's LTO type and capacity from what the drive
+// reported for it. Only tapes that were never written or have no LTO type
+// are touched, so a tape is checked once on its first write. The capacity
+// reported by the drive wins over the native capacity of the generation,
+// which also gets LTO-7 Type M (M8) cartridges right. It returns nil when
+// nothing changed.
+func (s *Service) ApplyMediaInfo(tapeID int64, info *tape.MediaInfo) (*MediaUpdate, error) {
+	if info == nil {
+		return nil, nil
+	}
+	u := &MediaUpdate{TapeID: tapeID}
+	var writeCount int64
+	err := s.db.QueryRow(`
+		SELECT label, COALESCE(lto_type, ''), COALESCE(capacity_bytes, 0), COALESCE(write_count, 0)
+		FROM tapes WHERE id = ?
+	`, tapeID).Scan(&u.Label, &u.OldLTOType, &u.OldCapacity, &writeCount)
+	if err != nil {
+		return nil, fmt.Errorf("tape not found: %w", err)
+	}
+	if writeCount > 0 && u.OldLTOType != "" {
+		return nil, nil
+	}
+
+	u.LTOType = u.OldLTOType
+	if info.LTOType != "" && info.LTOType != u.OldLTOType {
+		u.LTOType = info.LTOType
+		u.Mismatch = u.OldLTOType != ""
+	}
+
+	u.Capacity = u.OldCapacity
+	expected := info.MaximumBytes
+	if expected == 0 && (u.LTOType != u.OldLTOType || u.OldCapacity == 0) {
+		expected = models.LTOCapacities[u.LTOType]
+	}
+	if expected > 0 {
+		diff := float64(expected - u.OldCapacity)
+		if diff < 0 {
+			diff = -diff
+		}
+		if u.OldCapacity == 0 || diff > float64(u.OldCapacity)*mediaCapacityTolerance {
+			u.Capacity = expected
+			if u.OldCapacity > 0 {
+				u.Mismatch = true
+			}
+		}
+	}
+
+	if u.LTOType == u.OldLTOType && u.Capacity == u.OldCapacity {
+		return nil, nil
+	}
+	if _, err := s.db.Exec(`
+		UPDATE tapes SET lto_type = ?, capacity_bytes = ?, updated_at = CURRENT_TIMESTAMP WHERE id = ?
+	`, u.LTOType, u.Capacity, tapeID); err != nil {
+		return nil, err
+	}
+	return u, nil
+}
+
+// refreshTapeMedia reads the loaded tape's generation and capacity from the
+// drive before the first write and corrects the tape record. Failures are
+// logged and never stop the backup.
+func (s *Service) refreshTapeMedia(ctx context.Context, tapeID int64, driveSvc *tape.Service) {
+	info, err := driveSvc.ReadMediaInfo(ctx)
+	if err != nil {
+		s.logger.Warn("Could not read tape media information", map[string]interface{}{"tape_id": tapeID, "error": err.Error()})
+		return
+	}
+	u, err := s.ApplyMediaInfo(tapeID, info)
+	if err != nil {
+		s.logger.Warn("Failed to update tape media information", map[string]interface{}{"tape_id": tapeID, "error": err.Error()})
+		return
+	}
+	if u == nil {
+		return
+	}
+
+	fields := map[string]interface{}{
+		"tape":         u.Label,
+		"old_lto_type": u.OldLTOType,
+		"lto_type":     u.LTOType,
+		"old_capacity": u.OldCapacity,
+		"capacity":     u.Capacity,
+	}
+	if u.Mismatch {
+		s.logger.Warn("Tape media does not match its record, corrected from the drive", fields)
+		s.emitEvent("warning", "tape", "tape_media_mismatch", u.Label, mediaDescription(u.OldLTOType, u.OldCapacity), mediaDescription(u.LTOType, u.Capacity))
+		return
+	}
+	s.logger.Info("Tape media detected from the drive", fields)
+	s.emitEvent("info", "tape", "tape_media_detected", u.Label, mediaDescription(u.LTOType, u.Capacity))
+}
+
+// mediaDescription formats an LTO type and capacity for events
+func mediaDescription(ltoType string, capacity int64) string {
+	if ltoType == "" {
+		ltoType = "unknown type"
+	}
+	return fmt.Sprintf("%s, %.1f TB", ltoType, float64(capacity)/1e12)
+}
+
+// capacityShortfallWarning is how far, as a fraction of the tape's capacity,
+// the drive's remaining space may fall below the logical remaining space
+// before a warning is raised
+const capacityShortfallWarning = 0.05
+
+// CapacityReading compares the logical remaining space of a tape with what
+// the drive reports
+type CapacityReading struct {
+	TapeID            int64  `json:"tape_id"`
+	Label             string `json:"label"`
+	CapacityBytes     int64  `json:"capacity_bytes"`
+	UsedBytes         int64  `json:"used_bytes"`
+	LogicalRemaining  int64  `json:"logical_remaining_bytes"`
+	PhysicalRemaining int64  `json:"physical_remaining_bytes"`
+	// Short is set when the drive has noticeably less room left than the
+	// catalog expects, e.g. because of rewrites on worn media
+	Short bool `json:"short"`
+}
+
+// RecordDriveCapacity reads the remaining capacity the drive reports for the
+// loaded tape and stores it next to the logical figure. It returns nil when
+// the drive does not report it (virtual drives, sg_logs not installed).
+func (s *Service) RecordDriveCapacity(ctx context.Context, tapeID int64, driveSvc *tape.Service) (*CapacityReading, error) {
+	info, err := driveSvc.ReadMediaInfo(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return s.recordPhysicalRemaining(tapeID, info.RemainingBytes)
+}
+
+// recordPhysicalRemaining stores a drive-reported remaining capacity and
+// warns when it is well below the logical remaining space
+func (s *Service) recordPhysicalRemaining(tapeID, remaining int64) (*CapacityReading, error) {
+	if remaining <= 0 {
+		return nil, nil
+	}
+	r := &CapacityReading{TapeID: tapeID, PhysicalRemaining: remaining}
+	if err := s.db.QueryRow("SELECT label, capacity_bytes, used_bytes FROM tapes WHERE id = ?", tapeID).Scan(&r.Label, &r.CapacityBytes, &r.UsedBytes); err != nil {
+		return nil, fmt.Errorf("tape not found: %w", err)
+	}
+	if _, err := s.db.Exec("UPDATE tapes SET physical_remaining_bytes = ?, physical_remaining_at = CURRENT_TIMESTAMP WHERE id = ?", remaining, tapeID); err != nil {
+		return nil, err
+	}
+	r.LogicalRemaining = r.CapacityBytes - r.UsedBytes
+	if r.LogicalRemaining < 0 {
+		r.LogicalRemaining = 0
+	}
+	shortfall := r.LogicalRemaining - r.PhysicalRemaining
+	r.Short = r.CapacityBytes > 0 && float64(shortfall) > float64(r.CapacityBytes)*capacityShortfallWarning
+	if r.Short {
+		s.logger.Warn("Drive reports less remaining tape capacity than the catalog", map[string]interface{}{
+			"tape":               r.Label,
+			"logical_remaining":  r.LogicalRemaining,
+			"physical_remaining": r.PhysicalRemaining,
+		})
+		s.emitEvent("warning", "tape", "tape_capacity_short", r.Label,
+			fmt.Sprintf("%.1f GB", float64(r.PhysicalRemaining)/1e9), fmt.Sprintf("%.1f GB", float64(r.LogicalRemaining)/1e9))
+	}
+	return r, nil
+}
+
+// tapeRemaining returns the space left on a tape for planning a write: the
+// logical remaining space, or the drive-reported figure when that is
+// smaller. Every write clears the drive figure until it is read again, so a
+// stored one always describes the tape as it is.
+func (s *Service) tapeRemaining(tapeID, logical int64) int64 {
+	var physical int64
+	err := s.db.QueryRow("SELECT physical_remaining_bytes FROM tapes WHERE id = ? AND physical_remaining_bytes IS NOT NULL", tapeID).Scan(&physical)
+	if err == nil && physical < logical {
+		return physical
+	}
+	return logical
+}
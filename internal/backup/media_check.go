@@ -0,0 +1,155 @@
+package backup
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"github.com/RoseOO/TapeBackarr/internal/models"
+	"github.com/RoseOO/TapeBackarr/internal/tape"
+)
+
+// maxMediaCheckFiles bounds how far the media check spaces forward looking
+// for the end of a tape's data
+const maxMediaCheckFiles = 8
+
+// MediaCheck is the result of comparing a loaded tape with what the catalog
+// expects to find on it
+type MediaCheck struct {
+	TapeID int64  `json:"tape_id"`
+	Label  string `json:"label"`
+	// ContentsChecked is false for a tape that was written before but has
+	// no completed backup set on record, e.g. after a failed run, so only
+	// its label could be checked
+	ContentsChecked bool `json:"contents_checked"`
+	// ExpectedJob is the job of the last completed backup set on the tape
+	ExpectedJob string `json:"expected_job,omitempty"`
+	// Files and ExpectedFiles count the files after the label closed by a
+	// file mark: 0 for a tape never written, 2 (data and TOC) otherwise
+	Files         int64 `json:"files"`
+	ExpectedFiles int64 `json:"expected_files"`
+	// Problem describes the mismatch; empty when the tape is as expected
+	Problem string `json:"problem,omitempty"`
+}
+
+// CheckTapeMedia reads the loaded tape and compares it with the catalog
+// before anything is written: the label and UUID must match, a tape the
+// catalog never wrote must hold nothing past the label, and a written tape
+// must end with the TOC of the last completed backup set recorded for it.
+// excludeSetID is the set of the run about to write, which is not on the
+// tape yet. The tape is left positioned at file 1.
+func (s *Service) CheckTapeMedia(ctx context.Context, driveSvc *tape.Service, tapeID, excludeSetID int64) (*MediaCheck, error) {
+	c := &MediaCheck{TapeID: tapeID}
+	var uuid string
+	var writeCount int64
+	if err := s.db.QueryRow("SELECT label, uuid, COALESCE(write_count, 0) FROM tapes WHERE id = ?", tapeID).Scan(&c.Label, &uuid, &writeCount); err != nil {
+		return nil, fmt.Errorf("tape not found: %w", err)
+	}
+
+	var fileCount, totalBytes int64
+	err := s.db.QueryRow(`
+		SELECT j.name, bs.file_count, bs.total_bytes
+		FROM backup_sets bs JOIN backup_jobs j ON bs.job_id = j.id
+		WHERE bs.tape_id = ? AND bs.id != ? AND bs.status = ?
+		ORDER BY bs.id DESC LIMIT 1
+	`, tapeID, excludeSetID, models.BackupSetStatusCompleted).Scan(&c.ExpectedJob, &fileCount, &totalBytes)
+	switch {
+	case err == nil:
+		c.ContentsChecked = true
+		c.ExpectedFiles = 2
+	case err == sql.ErrNoRows:
+		c.ContentsChecked = writeCount == 0
+	default:
+		return nil, err
+	}
+
+	label, err := driveSvc.ReadTapeLabel(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read tape label: %w", err)
+	}
+	if label == nil || label.Label != c.Label || label.UUID != uuid {
+		found := "an unlabeled tape"
+		if label != nil {
+			found = fmt.Sprintf("%s (%s)", label.Label, label.UUID)
+		}
+		c.Problem = fmt.Sprintf("expected tape %s (%s) but found %s", c.Label, uuid, found)
+		return c, nil
+	}
+
+	if c.ContentsChecked {
+		// File n can only be spaced to when file n-1 was closed by a file
+		// mark; spacing past the last one fails
+		for c.Files <= c.ExpectedFiles && c.Files < maxMediaCheckFiles {
+			if err := driveSvc.SeekToFileNumber(ctx, c.Files+2); err != nil {
+				break
+			}
+			c.Files++
+		}
+		switch {
+		case c.ExpectedFiles == 0 && c.Files > 0:
+			c.Problem = "the catalog has never written this tape but it holds data past the label"
+		case c.Files != c.ExpectedFiles:
+			c.Problem = fmt.Sprintf("the tape holds %d file(s) past the label where the catalog expects %d for job %q", c.Files, c.ExpectedFiles, c.ExpectedJob)
+		case c.ExpectedFiles > 0:
+			c.Problem = checkTapeTOC(ctx, driveSvc, uuid, c.ExpectedJob, fileCount, totalBytes)
+		}
+		if c.Problem != "" {
+			return c, nil
+		}
+	}
+
+	if err := driveSvc.SeekToFileNumber(ctx, 1); err != nil {
+		return nil, fmt.Errorf("failed to position tape past label: %w", err)
+	}
+	if fileNum, _, err := driveSvc.GetTapePosition(ctx); err != nil {
+		return nil, fmt.Errorf("failed to read tape position: %w", err)
+	} else if fileNum != 1 {
+		c.Problem = fmt.Sprintf("the drive reports file %d after positioning past the label", fileNum)
+	}
+	return c, nil
+}
+
+// checkTapeTOC reads the TOC at file 2 and describes how it differs from
+// the backup set the catalog expects, or returns "" when it matches
+func checkTapeTOC(ctx context.Context, driveSvc *tape.Service, uuid, jobName string, fileCount, totalBytes int64) string {
+	if err := driveSvc.SeekToFileNumber(ctx, 2); err != nil {
+		return fmt.Sprintf("could not position to the TOC: %s", err.Error())
+	}
+	toc, err := driveSvc.ReadTOC(ctx)
+	if err != nil {
+		return fmt.Sprintf("could not read the TOC: %s", err.Error())
+	}
+	if toc.TapeUUID != uuid {
+		return fmt.Sprintf("the TOC belongs to tape %s (%s)", toc.TapeLabel, toc.TapeUUID)
+	}
+	for _, set := range toc.BackupSets {
+		if set.JobName == jobName && set.FileCount == fileCount && set.TotalBytes == totalBytes {
+			return ""
+		}
+	}
+	return fmt.Sprintf("the TOC does not list the last backup set of job %q (%d files) the catalog recorded for this tape", jobName, fileCount)
+}
+
+// runMediaCheck runs the pre-run media check when it is enabled and
+// returns an error when the tape does not match the catalog
+func (s *Service) runMediaCheck(ctx context.Context, job *models.BackupJob, driveSvc *tape.Service, tapeID, excludeSetID int64) error {
+	if !s.mediaCheck {
+		return nil
+	}
+	s.updateProgress(job.ID, "positioning", "Checking tape contents against the catalog...")
+	c, err := s.CheckTapeMedia(ctx, driveSvc, tapeID, excludeSetID)
+	if err != nil {
+		return fmt.Errorf("media check failed: %w", err)
+	}
+	if c.Problem != "" {
+		s.logger.Error("Media check found the tape does not match the catalog", map[string]interface{}{
+			"job": job.Name, "tape": c.Label, "problem": c.Problem,
+		})
+		s.emitEvent("error", "backup", "media_check_failed", job.Name, c.Label, c.Problem)
+		return fmt.Errorf("media check failed for tape %s: %s", c.Label, c.Problem)
+	}
+	s.logger.Info("Media check passed", map[string]interface{}{
+		"tape": c.Label, "contents_checked": c.ContentsChecked, "files": c.Files,
+	})
+	return nil
+}
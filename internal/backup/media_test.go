@@ -0,0 +1,187 @@
+package backup
+
+import (
+	"context"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/RoseOO/TapeBackarr/internal/database"
+	"github.com/RoseOO/TapeBackarr/internal/logging"
+	"github.com/RoseOO/TapeBackarr/internal/tape"
+)
+
+func TestApplyMediaInfo(t *testing.T) {
+	db, err := database.New(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("failed to create database: %v", err)
+	}
+	defer db.Close()
+	if err := db.Migrate(); err != nil {
+		t.Fatalf("failed to migrate database: %v", err)
+	}
+	logger, _ := logging.NewLogger("error", "text", "")
+	svc := NewService(db, nil, logger, 65536, 0, 0)
+
+	db.Exec("INSERT INTO tapes (uuid, barcode, label, pool_id, status, capacity_bytes) VALUES ('u1', 'T1', 'T1', 1, 'blank', 0)")
+	db.Exec("INSERT INTO tapes (uuid, barcode, label, pool_id, lto_type, status, capacity_bytes) VALUES ('u2', 'T2', 'T2', 1, 'LTO-6', 'blank', 2500000000000)")
+	db.Exec("INSERT INTO tapes (uuid, barcode, label, pool_id, lto_type, status, capacity_bytes, write_count) VALUES ('u3', 'T3', 'T3', 1, 'LTO-6', 'active', 2500000000000, 3)")
+	db.Exec("INSERT INTO tapes (uuid, barcode, label, pool_id, lto_type, status, capacity_bytes) VALUES ('u4', 'T4', 'T4', 1, 'LTO-7', 'blank', 6000000000000)")
+
+	// A tape added without a type takes the generation's native capacity
+	u, err := svc.ApplyMediaInfo(1, &tape.MediaInfo{LTOType: "LTO-8"})
+	if err != nil || u == nil || u.LTOType != "LTO-8" || u.Capacity != 12000000000000 || u.Mismatch {
+		t.Errorf("untyped tape: unexpected update %+v (%v)", u, err)
+	}
+
+	// A declared type the drive contradicts is corrected and flagged
+	u, err = svc.ApplyMediaInfo(2, &tape.MediaInfo{LTOType: "LTO-7"})
+	if err != nil || u == nil || u.LTOType != "LTO-7" || u.Capacity != 6000000000000 || !u.Mismatch {
+		t.Errorf("wrong type: unexpected update %+v (%v)", u, err)
+	}
+
+	// Tapes already written with a known type are left alone
+	if u, err := svc.ApplyMediaInfo(3, &tape.MediaInfo{LTOType: "LTO-7"}); u != nil || err != nil {
+		t.Errorf("written tape: expected no update, got %+v (%v)", u, err)
+	}
+
+	// The drive's capacity wins over the native one, e.g. for LTO-7 Type M
+	u, err = svc.ApplyMediaInfo(4, &tape.MediaInfo{LTOType: "LTO-7", MaximumBytes: 9000000000000})
+	if err != nil || u == nil || u.Capacity != 9000000000000 || !u.Mismatch {
+		t.Errorf("M8 tape: unexpected update %+v (%v)", u, err)
+	}
+	// and small differences are not worth a correction
+	if u, err := svc.ApplyMediaInfo(4, &tape.MediaInfo{LTOType: "LTO-7", MaximumBytes: 9010000000000}); u != nil || err != nil {
+		t.Errorf("within tolerance: expected no update, got %+v (%v)", u, err)
+	}
+
+	var ltoType string
+	var capacity int64
+	db.QueryRow("SELECT lto_type, capacity_bytes FROM tapes WHERE id = 2").Scan(&ltoType, &capacity)
+	if ltoType != "LTO-7" || capacity != 6000000000000 {
+		t.Errorf("expected the record to be updated, got %s %d", ltoType, capacity)
+	}
+}
+
+func TestRecordPhysicalRemaining(t *testing.T) {
+	db, err := database.New(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("failed to create database: %v", err)
+	}
+	defer db.Close()
+	if err := db.Migrate(); err != nil {
+		t.Fatalf("failed to migrate database: %v", err)
+	}
+	logger, _ := logging.NewLogger("error", "text", "")
+	svc := NewService(db, nil, logger, 65536, 0, 0)
+	var events []string
+	svc.EventCallback = func(eventType, category, key string, args ...interface{}) { events = append(events, key) }
+
+	db.Exec("INSERT INTO tapes (uuid, barcode, label, pool_id, status, capacity_bytes, used_bytes) VALUES ('u1', 'T1', 'T1', 1, 'active', 1000000, 400000)")
+
+	// Nothing reported, nothing recorded
+	if r, err := svc.recordPhysicalRemaining(1, 0); r != nil || err != nil {
+		t.Errorf("expected no reading, got %+v (%v)", r, err)
+	}
+	if got := svc.tapeRemaining(1, 600000); got != 600000 {
+		t.Errorf("expected the logical remaining space without a reading, got %d", got)
+	}
+
+	// Drive compression leaves more room than the catalog expects
+	r, err := svc.recordPhysicalRemaining(1, 800000)
+	if err != nil || r == nil || r.LogicalRemaining != 600000 || r.Short {
+		t.Fatalf("unexpected reading %+v (%v)", r, err)
+	}
+	if got := svc.tapeRemaining(1, 600000); got != 600000 {
+		t.Errorf("expected planning to stay on the logical figure, got %d", got)
+	}
+
+	// Worn media leaves less, which is flagged and used for planning
+	r, _ = svc.recordPhysicalRemaining(1, 450000)
+	if r == nil || !r.Short || len(events) != 1 || events[0] != "tape_capacity_short" {
+		t.Errorf("expected a shortfall warning, got %+v and events %v", r, events)
+	}
+	if got := svc.tapeRemaining(1, 600000); got != 450000 {
+		t.Errorf("expected the drive figure to be used, got %d", got)
+	}
+
+	// The next write makes the reading stale
+	db.Exec("UPDATE tapes SET used_bytes = used_bytes + 1000, physical_remaining_bytes = NULL WHERE id = 1")
+	if got := svc.tapeRemaining(1, 599000); got != 599000 {
+		t.Errorf("expected a stale reading to be ignored, got %d", got)
+	}
+}
+
+func TestCheckTapeMedia(t *testing.T) {
+	ctx := context.Background()
+	db, err := database.New(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("failed to create database: %v", err)
+	}
+	defer db.Close()
+	if err := db.Migrate(); err != nil {
+		t.Fatalf("failed to migrate database: %v", err)
+	}
+	logger, _ := logging.NewLogger("error", "text", "")
+	svc := NewService(db, nil, logger, 65536, 0, 0)
+
+	db.Exec("INSERT INTO tapes (uuid, barcode, label, pool_id, status, capacity_bytes) VALUES ('uuid-mc', 'MC0001', 'MC0001', 1, 'blank', 1000000)")
+	drive := tape.NewServiceForDevice("file://"+t.TempDir(), 65536)
+	if err := drive.WriteTapeLabel(ctx, "MC0001", "uuid-mc", "DAILY"); err != nil {
+		t.Fatalf("WriteTapeLabel: %v", err)
+	}
+
+	// A blank tape holding nothing past its label passes
+	c, err := svc.CheckTapeMedia(ctx, drive, 1, 0)
+	if err != nil || c.Problem != "" || !c.ContentsChecked || c.Files != 0 {
+		t.Fatalf("blank tape: unexpected result %+v (%v)", c, err)
+	}
+
+	// Data the catalog never wrote is caught
+	drive.SeekToFileNumber(ctx, 1)
+	w, err := drive.OpenWriter(ctx)
+	if err != nil {
+		t.Fatalf("OpenWriter: %v", err)
+	}
+	w.Write([]byte("tar payload"))
+	w.Close()
+	drive.WriteFileMark(ctx)
+	toc := tape.NewTapeTOC("MC0001", "uuid-mc", "DAILY")
+	toc.BackupSets = []tape.TOCBackupSet{{FileNumber: 1, JobName: "docs", BackupType: "full", FileCount: 2, TotalBytes: 300}}
+	if err := drive.WriteTOC(ctx, toc); err != nil {
+		t.Fatalf("WriteTOC: %v", err)
+	}
+	c, err = svc.CheckTapeMedia(ctx, drive, 1, 0)
+	if err != nil || !strings.Contains(c.Problem, "never written") {
+		t.Fatalf("expected unexpected data to be reported, got %+v (%v)", c, err)
+	}
+
+	// Once the catalog records the set, the tape matches
+	db.Exec("UPDATE tapes SET status = 'active', write_count = 1 WHERE id = 1")
+	db.Exec("INSERT INTO backup_sources (name, source_type, path) VALUES ('docs', 'local', '/srv/docs')")
+	db.Exec("INSERT INTO backup_jobs (name, source_id, pool_id, backup_type, schedule_cron, retention_days) VALUES ('docs', 1, 1, 'full', '', 30)")
+	db.Exec(`INSERT INTO backup_sets (job_id, tape_id, backup_type, start_time, status, file_count, total_bytes)
+		VALUES (1, 1, 'full', CURRENT_TIMESTAMP, 'completed', 2, 300)`)
+	c, err = svc.CheckTapeMedia(ctx, drive, 1, 0)
+	if err != nil || c.Problem != "" || c.Files != 2 || c.ExpectedJob != "docs" {
+		t.Fatalf("written tape: unexpected result %+v (%v)", c, err)
+	}
+	if fileNum, _, _ := drive.GetTapePosition(ctx); fileNum != 1 {
+		t.Errorf("expected the tape to be left at file 1, got %d", fileNum)
+	}
+
+	// A tape whose TOC describes another write is caught
+	db.Exec("UPDATE backup_sets SET file_count = 5 WHERE id = 1")
+	c, err = svc.CheckTapeMedia(ctx, drive, 1, 0)
+	if err != nil || !strings.Contains(c.Problem, "does not list") {
+		t.Fatalf("expected a TOC mismatch, got %+v (%v)", c, err)
+	}
+
+	// A different tape carrying the same label is caught
+	db.Exec("UPDATE backup_sets SET file_count = 2 WHERE id = 1")
+	db.Exec("UPDATE tapes SET uuid = 'uuid-other' WHERE id = 1")
+	c, err = svc.CheckTapeMedia(ctx, drive, 1, 0)
+	if err != nil || !strings.Contains(c.Problem, "expected tape MC0001 (uuid-other)") {
+		t.Fatalf("expected a label mismatch, got %+v (%v)", c, err)
+	}
+}
@@ -0,0 +1,266 @@
+package backup
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/RoseOO/TapeBackarr/internal/cmdutil"
+	"github.com/RoseOO/TapeBackarr/internal/credentials"
+	"github.com/RoseOO/TapeBackarr/internal/models"
+	"github.com/RoseOO/TapeBackarr/internal/ndmp"
+)
+
+// mountTimeout bounds the mount of a source's share, which can hang on an
+// unreachable server
+const mountTimeout = 2 * time.Minute
+
+// unmountTimeout bounds the unmount of a source's share after a run
+const unmountTimeout = time.Minute
+
+// mountCommand runs mount and umount, folding stderr into the error
+var mountCommand = func(ctx context.Context, name string, args ...string) error {
+	cmd := exec.CommandContext(ctx, name, args...)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("%s failed (%s)", name, cmdutil.ErrorDetail(err, &stderr))
+	}
+	return nil
+}
+
+// sourceMount is the share of a source mounted for the runs reading it. Its
+// own lock is held while the share is mounted or unmounted, so that a slow
+// server only holds up the runs of its own sources.
+type sourceMount struct {
+	mountPoint string
+	users      int // runs using this entry, guarded by Service.mountMu
+
+	mu      sync.Mutex
+	mounted bool
+	refs    int // runs holding the mount, guarded by mu
+}
+
+// sourceMountPoint returns where the share of a source is mounted. It is the
+// same for every run, so the paths kept in snapshots and resume state stay
+// valid, and lives in an unprefixed subdirectory of the scratch dir so that
+// orphan cleanup can never recurse into a share left mounted by a crash.
+func (s *Service) sourceMountPoint(sourceID int64) string {
+	return filepath.Join(s.scratch.Root(), "mounts", fmt.Sprintf("source-%d", sourceID))
+}
+
+// MountsShare reports whether TapeBackarr mounts the share of a source for
+// each run: SMB and NFS sources that name a share or export rather than a
+// local directory where it is mounted outside TapeBackarr
+func MountsShare(source *models.BackupSource) bool {
+	switch source.SourceType {
+	case models.SourceTypeSMB:
+		// //server/share is an absolute path to filepath as well
+		return !filepath.IsAbs(source.Path) || strings.HasPrefix(source.Path, "//")
+	case models.SourceTypeNFS:
+		return !filepath.IsAbs(source.Path)
+	}
+	return false
+}
+
+// CheckMountOptions validates the mount options of a source: a
+// comma-separated list, without the login, which belongs in the stored
+// credential, and without options that would mount the share writable
+func CheckMountOptions(options string) error {
+	if options == "" {
+		return nil
+	}
+	if strings.ContainsAny(options, " \t\n") {
+		return fmt.Errorf("must be a comma-separated list without spaces")
+	}
+	for _, opt := range strings.Split(options, ",") {
+		key, _, _ := strings.Cut(opt, "=")
+		switch key {
+		case "username", "user", "password", "pass", "credentials", "domain":
+			return fmt.Errorf("must not set %s; keep the login in the stored credential", key)
+		case "rw", "remount":
+			return fmt.Errorf("must not set %s; shares are always mounted read-only", key)
+		}
+	}
+	return nil
+}
+
+// mountSource mounts the share of an SMB or NFS source and returns a copy of
+// the source whose path is the mounted directory, with a function that
+// releases the mount. Runs reading the same source at once share the mount,
+// and the last one to finish unmounts it. Other sources are returned as they
+// are.
+func (s *Service) mountSource(ctx context.Context, source *models.BackupSource, purpose string) (*models.BackupSource, func(), error) {
+	if !MountsShare(source) {
+		return source, func() {}, nil
+	}
+	var remote, dir string
+	var mount func(ctx context.Context, mountPoint, options string) error
+	if source.SourceType == models.SourceTypeSMB {
+		share, err := ParseSMBPath(source.Path)
+		if err != nil {
+			return nil, nil, fmt.Errorf("invalid SMB source %s: %w", source.Name, err)
+		}
+		remote, dir = share.String(), share.Dir
+		mount = func(ctx context.Context, mountPoint, options string) error {
+			return s.mountSMB(ctx, source, share, mountPoint, options, purpose)
+		}
+	} else {
+		export, err := ParseNFSPath(source.Path)
+		if err != nil {
+			return nil, nil, fmt.Errorf("invalid NFS source %s: %w", source.Name, err)
+		}
+		remote = export.String()
+		mount = func(ctx context.Context, mountPoint, options string) error {
+			if err := mountCommand(ctx, "mount", nfsMountArgs(export, mountPoint, options)...); err != nil {
+				return fmt.Errorf("failed to mount %s: %w", export, err)
+			}
+			return nil
+		}
+	}
+
+	m := s.useMount(source.ID)
+	m.mu.Lock()
+	if !m.mounted {
+		if err := os.MkdirAll(m.mountPoint, 0700); err != nil {
+			m.mu.Unlock()
+			s.dropMount(source.ID, m)
+			return nil, nil, fmt.Errorf("failed to create mount point: %w", err)
+		}
+		var options string
+		s.db.QueryRow("SELECT mount_options FROM backup_sources WHERE id = ?", source.ID).Scan(&options)
+		mountCtx, cancel := context.WithTimeout(ctx, mountTimeout)
+		err := mount(mountCtx, m.mountPoint, options)
+		cancel()
+		if err != nil {
+			os.Remove(m.mountPoint)
+			m.mu.Unlock()
+			s.dropMount(source.ID, m)
+			return nil, nil, err
+		}
+		m.mounted = true
+	}
+	m.refs++
+	m.mu.Unlock()
+
+	var once sync.Once
+	release := func() { once.Do(func() { s.releaseMount(source.ID, m) }) }
+
+	mounted := *source
+	mounted.Path = filepath.Join(m.mountPoint, filepath.FromSlash(dir))
+	if fi, err := os.Stat(mounted.Path); err != nil || !fi.IsDir() {
+		release()
+		return nil, nil, fmt.Errorf("directory %q not found on %s", dir, remote)
+	}
+	return &mounted, release, nil
+}
+
+// useMount returns the mount entry of a source, creating it if no run uses
+// the source yet. Each call must be paired with a dropMount.
+func (s *Service) useMount(sourceID int64) *sourceMount {
+	s.mountMu.Lock()
+	defer s.mountMu.Unlock()
+	m := s.mounts[sourceID]
+	if m == nil {
+		m = &sourceMount{mountPoint: s.sourceMountPoint(sourceID)}
+		if s.mounts == nil {
+			s.mounts = make(map[int64]*sourceMount)
+		}
+		s.mounts[sourceID] = m
+	}
+	m.users++
+	return m
+}
+
+// dropMount forgets the mount entry of a source once no run uses it
+func (s *Service) dropMount(sourceID int64, m *sourceMount) {
+	s.mountMu.Lock()
+	defer s.mountMu.Unlock()
+	if m.users--; m.users == 0 && s.mounts[sourceID] == m {
+		delete(s.mounts, sourceID)
+	}
+}
+
+// releaseMount drops a run's hold on the share of a source and unmounts it
+// once no run is left
+func (s *Service) releaseMount(sourceID int64, m *sourceMount) {
+	defer s.dropMount(sourceID, m)
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.refs--; m.refs > 0 {
+		return
+	}
+	m.mounted = false
+
+	ctx, cancel := context.WithTimeout(context.Background(), unmountTimeout)
+	defer cancel()
+	if err := mountCommand(ctx, "umount", m.mountPoint); err != nil {
+		if s.logger != nil {
+			s.logger.Warn("Failed to unmount source", map[string]interface{}{
+				"source_id":   sourceID,
+				"mount_point": m.mountPoint,
+				"error":       err.Error(),
+			})
+		}
+		return
+	}
+	// Remove (not RemoveAll) so a failed unmount can never touch the share
+	os.Remove(m.mountPoint)
+}
+
+// sourceCredential returns the stored login of a network source, recording
+// the use
+func (s *Service) sourceCredential(source *models.BackupSource, purpose string) (*models.Credential, string, error) {
+	var credentialID sql.NullInt64
+	s.db.QueryRow("SELECT credential_id FROM backup_sources WHERE id = ?", source.ID).Scan(&credentialID)
+	if !credentialID.Valid {
+		return nil, "", fmt.Errorf("source %s needs a stored credential", source.Name)
+	}
+	store := s.credentials.Load()
+	if store == nil {
+		return nil, "", fmt.Errorf("source %s uses a stored credential but the credentials store is not available", source.Name)
+	}
+	return store.Resolve(credentialID.Int64, credentials.Usage{
+		UsedByType: "backup_source",
+		UsedByID:   source.ID,
+		Purpose:    purpose,
+	})
+}
+
+// TestSource checks that a source can be backed up: that its directory can
+// be read, its share mounts, or its NAS accepts the NDMP login
+func (s *Service) TestSource(ctx context.Context, source *models.BackupSource) error {
+	if source.SourceType == models.SourceTypeNDMP {
+		target, err := ndmp.ParseURL(source.Path)
+		if err != nil {
+			return err
+		}
+		cred, secret, err := s.sourceCredential(source, "connection test")
+		if err != nil {
+			return err
+		}
+		client, err := ndmp.Dial(ctx, target.Addr, ndmp.Options{Username: cred.Username, Password: secret, Auth: target.Auth})
+		if err != nil {
+			return err
+		}
+		client.Close()
+		return nil
+	}
+
+	mounted, release, err := s.mountSource(ctx, source, "connection test")
+	if err != nil {
+		return err
+	}
+	defer release()
+	if _, err := os.ReadDir(mounted.Path); err != nil {
+		return fmt.Errorf("cannot read %s: %w", source.Path, err)
+	}
+	return nil
+}
@@ -0,0 +1,458 @@
+package backup
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"net"
+	"strconv"
+	"time"
+
+	"github.com/RoseOO/TapeBackarr/internal/credentials"
+	"github.com/RoseOO/TapeBackarr/internal/models"
+	"github.com/RoseOO/TapeBackarr/internal/ndmp"
+	"github.com/RoseOO/TapeBackarr/internal/tape"
+)
+
+// ndmpMaxLevel is the highest dump level; incrementals beyond it stay at
+// level 9, which backs up everything changed since the last level 8
+const ndmpMaxLevel = 9
+
+// ndmpAcceptTimeout bounds the wait for the NAS's data connection
+const ndmpAcceptTimeout = 30 * time.Second
+
+// ndmpHaltTimeout bounds the wait for the NAS to report the backup halted
+// once the whole image was received
+const ndmpHaltTimeout = 5 * time.Minute
+
+// ndmpLevel returns the dump level of a run: 0 for a full backup, 1 for a
+// differential and one above the last NDMP set of the job for an
+// incremental. ok is false when there is no previous set to base the run on.
+func (s *Service) ndmpLevel(jobID int64, backupType models.BackupType) (level int, ok bool, err error) {
+	if backupType == models.BackupTypeFull {
+		return 0, true, nil
+	}
+	var last sql.NullInt64
+	err = s.db.QueryRow(`
+		SELECT ndmp_level FROM backup_sets
+		WHERE job_id = ? AND ndmp_type != '' AND status = 'completed' AND invalidated_at IS NULL
+		ORDER BY start_time DESC LIMIT 1
+	`, jobID).Scan(&last)
+	if err == sql.ErrNoRows || (err == nil && !last.Valid) {
+		return 0, false, nil
+	}
+	if err != nil {
+		return 0, false, err
+	}
+	if backupType == models.BackupTypeDifferential {
+		return 1, true, nil
+	}
+	level = int(last.Int64) + 1
+	if level > ndmpMaxLevel {
+		level = ndmpMaxLevel
+	}
+	return level, true, nil
+}
+
+// runNDMPBackup backs up the file system of an NDMP source. The NAS's data
+// service connects back to a port opened here and sends its backup image,
+// which is written to tape as is; the file history it sends on the control
+// connection becomes the catalog. Incrementals and differentials use dump
+// levels, so the NAS decides what changed.
+func (s *Service) runNDMPBackup(ctx context.Context, job *models.BackupJob, source *models.BackupSource, tapeID int64, backupType models.BackupType) (*models.BackupSet, error) {
+	startTime := time.Now()
+
+	target, err := ndmp.ParseURL(source.Path)
+	if err != nil {
+		return nil, fmt.Errorf("invalid NDMP source %s: %w", source.Name, err)
+	}
+	if job.EncryptionEnabled {
+		return nil, fmt.Errorf("job %s backs up an NDMP source and cannot use software encryption; use hardware encryption instead", job.Name)
+	}
+
+	var tapeLabel, tapeUUID, poolName, tapeFormatType string
+	var tapeCapacity, tapeUsed int64
+	if err := s.db.QueryRow(`
+		SELECT t.label, t.uuid, COALESCE(p.name, ''), COALESCE(t.format_type, 'raw'), t.capacity_bytes, t.used_bytes
+		FROM tapes t LEFT JOIN tape_pools p ON t.pool_id = p.id
+		WHERE t.id = ?
+	`, tapeID).Scan(&tapeLabel, &tapeUUID, &poolName, &tapeFormatType, &tapeCapacity, &tapeUsed); err != nil {
+		return nil, fmt.Errorf("tape not found: %w", err)
+	}
+	if tapeFormatType == string(models.TapeFormatLTFS) {
+		return nil, fmt.Errorf("tape %s is LTFS formatted; NDMP images can only be written to raw tapes", tapeLabel)
+	}
+
+	var devicePath string
+	if err := s.db.QueryRow("SELECT device_path FROM tape_drives WHERE current_tape_id = ? AND COALESCE(enabled, 1) = 1", tapeID).Scan(&devicePath); err != nil {
+		return nil, fmt.Errorf("tape %s is not loaded in any enabled drive", tapeLabel)
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	var pauseFlag int32
+
+	s.mu.Lock()
+	if _, running := s.activeJobs[job.ID]; running {
+		s.mu.Unlock()
+		cancel()
+		return nil, fmt.Errorf("job %s is already running", job.Name)
+	}
+	s.activeJobs[job.ID] = &JobProgress{
+		JobID:             job.ID,
+		JobName:           job.Name,
+		Phase:             "initializing",
+		Status:            "running",
+		Message:           "Starting NDMP backup...",
+		TapeLabel:         tapeLabel,
+		TapeCapacityBytes: tapeCapacity,
+		TapeUsedBytes:     tapeUsed,
+		DevicePath:        devicePath,
+		StartTime:         startTime,
+		UpdatedAt:         startTime,
+		LogLines:          []string{fmt.Sprintf("[%s] Starting NDMP backup job: %s", startTime.Format("15:04:05"), job.Name)},
+	}
+	s.cancelFuncs[job.ID] = cancel
+	s.pauseFlags[job.ID] = &pauseFlag
+	s.mu.Unlock()
+	defer func() {
+		s.mu.Lock()
+		delete(s.activeJobs, job.ID)
+		delete(s.cancelFuncs, job.ID)
+		delete(s.pauseFlags, job.ID)
+		s.mu.Unlock()
+		cancel()
+	}()
+
+	releaseTapes, err := s.holdTape(tapeID, job.ID)
+	if err != nil {
+		s.updateProgress(job.ID, "failed", err.Error())
+		s.emitEvent("error", "backup", "backup_failed", job.Name, err.Error())
+		return nil, err
+	}
+	defer releaseTapes()
+
+	// The job's force-full policy applies as for other sources, and a run
+	// with no earlier NDMP set to base it on becomes a full backup
+	var promotionReason string
+	if backupType == models.BackupTypeIncremental || backupType == models.BackupTypeDifferential {
+		reason, err := s.FullBackupDue(job, startTime)
+		if err != nil {
+			s.logger.Warn("Failed to evaluate force-full policy, running incremental", map[string]interface{}{
+				"job_id": job.ID,
+				"error":  err.Error(),
+			})
+		}
+		if reason == "" {
+			if _, ok, err := s.ndmpLevel(job.ID, backupType); err == nil && !ok {
+				reason = "no earlier NDMP backup of the job to base it on"
+			}
+		}
+		if reason != "" {
+			backupType = models.BackupTypeFull
+			promotionReason = reason
+			s.updateProgress(job.ID, "initializing", "Promoted to full backup: "+reason)
+			s.emitEvent("info", "backup", "backup_promoted_full", job.Name, reason)
+		}
+	}
+	level, _, err := s.ndmpLevel(job.ID, backupType)
+	if err != nil {
+		s.updateProgress(job.ID, "failed", "Failed to determine the dump level: "+err.Error())
+		s.emitEvent("error", "backup", "backup_failed", job.Name, err.Error())
+		return nil, fmt.Errorf("failed to determine the dump level: %w", err)
+	}
+
+	s.emitEvent("info", "backup", "backup_started", job.Name, tapeLabel)
+	s.logger.Info("Starting NDMP backup job", map[string]interface{}{
+		"job_id":      job.ID,
+		"job_name":    job.Name,
+		"ndmp_server": target.Addr,
+		"filesystem":  target.Filesystem,
+		"ndmp_type":   target.Type,
+		"level":       level,
+		"backup_type": backupType,
+		"promoted":    promotionReason,
+		"tape_label":  tapeLabel,
+	})
+
+	if err := s.CheckTapeWritable(tapeID); err != nil {
+		s.updateProgress(job.ID, "failed", err.Error())
+		s.emitEvent("error", "backup", "backup_failed", job.Name, err.Error())
+		return nil, err
+	}
+
+	result, err := s.db.Exec(`
+		INSERT INTO backup_sets (job_id, tape_id, backup_type, format_type, start_time, status, promotion_reason, block_size, ndmp_type, ndmp_level)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`, job.ID, tapeID, backupType, tapeFormatType, startTime, models.BackupSetStatusRunning, promotionReason, s.blockSize, target.Type, level)
+	if err != nil {
+		s.updateProgress(job.ID, "failed", "Failed to create backup set: "+err.Error())
+		s.emitEvent("error", "backup", "backup_failed", job.Name, err.Error())
+		return nil, fmt.Errorf("failed to create backup set: %w", err)
+	}
+	backupSetID, _ := result.LastInsertId()
+	s.mu.Lock()
+	if p, ok := s.activeJobs[job.ID]; ok {
+		p.BackupSetID = backupSetID
+	}
+	s.mu.Unlock()
+
+	fail := func(msg string, cause error) (*models.BackupSet, error) {
+		s.updateProgress(job.ID, "failed", msg+": "+cause.Error())
+		s.updateBackupSetStatus(backupSetID, models.BackupSetStatusFailed, msg+": "+cause.Error())
+		s.emitEvent("error", "backup", "backup_failed", job.Name, msg+": "+cause.Error())
+		return nil, fmt.Errorf("%s: %w", msg, cause)
+	}
+
+	// Log in to the NAS before touching the tape
+	var credentialID sql.NullInt64
+	s.db.QueryRow("SELECT credential_id FROM backup_sources WHERE id = ?", source.ID).Scan(&credentialID)
+	if !credentialID.Valid {
+		return fail("NDMP source has no credential", fmt.Errorf("source %s needs a stored credential with the NDMP login", source.Name))
+	}
+	store := s.credentials.Load()
+	if store == nil {
+		return fail("Credentials store is not available", fmt.Errorf("cannot log in to %s", target.Addr))
+	}
+	cred, secret, err := store.Resolve(credentialID.Int64, credentials.Usage{
+		UsedByType: "backup_source",
+		UsedByID:   source.ID,
+		Purpose:    "backup",
+	})
+	if err != nil {
+		return fail("Failed to read the NDMP credential", err)
+	}
+
+	s.updateProgress(job.ID, "initializing", fmt.Sprintf("Connecting to NDMP server %s...", target.Addr))
+	client, err := ndmp.Dial(ctx, target.Addr, ndmp.Options{
+		Username: cred.Username,
+		Password: secret,
+		Auth:     target.Auth,
+		Log: func(msg string) {
+			s.updateProgress(job.ID, "streaming", "NAS: "+msg)
+		},
+	})
+	if err != nil {
+		return fail("Failed to connect to the NDMP server", err)
+	}
+	defer client.Close()
+
+	s.db.Exec("UPDATE tape_drives SET status = 'busy' WHERE device_path = ?", devicePath)
+	defer s.db.Exec("UPDATE tape_drives SET status = 'ready' WHERE device_path = ?", devicePath)
+
+	s.updateProgress(job.ID, "positioning", "Verifying tape label before write...")
+	driveSvc := tape.NewServiceForDevice(devicePath, s.tapeService.GetBlockSize())
+	physicalLabel, err := driveSvc.ReadTapeLabel(ctx)
+	if err != nil {
+		return fail("Failed to read tape label", err)
+	}
+	if physicalLabel == nil || physicalLabel.Label != tapeLabel || physicalLabel.UUID != tapeUUID {
+		actual := "unlabeled"
+		if physicalLabel != nil {
+			actual = physicalLabel.Label
+		}
+		return fail("Tape label mismatch", fmt.Errorf("expected %q but found %q", tapeLabel, actual))
+	}
+	if err := driveSvc.SeekToFileNumber(ctx, 1); err != nil {
+		return fail("Failed to position tape past label", err)
+	}
+	if _, startBlock, posErr := driveSvc.GetTapePosition(ctx); posErr == nil {
+		s.db.Exec("UPDATE backup_sets SET start_block = ? WHERE id = ?", startBlock, backupSetID)
+	}
+
+	var hwEncrypted bool
+	if job.HwEncryptionEnabled && job.HwEncryptionKeyID != nil {
+		s.updateProgress(job.ID, "encryption", "Setting up hardware encryption on drive...")
+		hwKeyBytes, err := s.GetHwEncryptionKeyBytes(ctx, *job.HwEncryptionKeyID)
+		if err != nil {
+			return fail("Hardware encryption key not found", err)
+		}
+		if err := driveSvc.SetHardwareEncryption(ctx, hwKeyBytes); err != nil {
+			return fail("Failed to set hardware encryption", err)
+		}
+		hwEncrypted = true
+		defer func() {
+			clearCtx, clearCancel := context.WithTimeout(context.Background(), 30*time.Second)
+			defer clearCancel()
+			if clearErr := driveSvc.ClearHardwareEncryption(clearCtx); clearErr != nil {
+				s.logger.Warn("Failed to clear hardware encryption after backup", map[string]interface{}{
+					"error":  clearErr.Error(),
+					"job_id": job.ID,
+				})
+			}
+		}()
+	}
+
+	// The NAS connects to the address it was reached from
+	localIP := client.LocalAddr().(*net.TCPAddr).IP
+	ln, err := net.ListenTCP("tcp", &net.TCPAddr{IP: localIP})
+	if err != nil {
+		return fail("Failed to open the NDMP data port", err)
+	}
+	defer ln.Close()
+	if err := client.DataConnect(ctx, ln.Addr().(*net.TCPAddr)); err != nil {
+		return fail("NDMP data connection failed", err)
+	}
+	ln.SetDeadline(time.Now().Add(ndmpAcceptTimeout))
+	dataConn, err := ln.Accept()
+	if err != nil {
+		return fail("NAS did not open the data connection", err)
+	}
+	defer dataConn.Close()
+	stopClose := context.AfterFunc(ctx, func() { dataConn.Close() })
+	defer stopClose()
+
+	env := []ndmp.Env{
+		{Name: "FILESYSTEM", Value: target.Filesystem},
+		{Name: "TYPE", Value: target.Type},
+		{Name: "HIST", Value: "y"},
+		{Name: "UPDATE", Value: "y"},
+		{Name: "LEVEL", Value: strconv.Itoa(level)},
+	}
+	if err := client.StartBackup(ctx, target.Type, env); err != nil {
+		return fail("NAS refused the backup", err)
+	}
+
+	abort := func() {
+		abortCtx, abortCancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer abortCancel()
+		client.Abort(abortCtx)
+	}
+
+	s.updateProgress(job.ID, "streaming", fmt.Sprintf("Writing %s level %d image of %s to tape %s...", target.Type, level, target.Filesystem, tapeLabel))
+	progressCb := func(bytesWritten int64) {
+		s.mu.Lock()
+		if p, ok := s.activeJobs[job.ID]; ok {
+			p.BytesWritten = bytesWritten
+			p.UpdatedAt = time.Now()
+		}
+		s.mu.Unlock()
+	}
+	tapeBytes, err := s.streamReaderToTape(ctx, dataConn, devicePath, progressCb, &pauseFlag)
+	if err != nil {
+		abort()
+		return fail("Failed to write the NDMP image to tape", err)
+	}
+
+	select {
+	case reason := <-client.Halted():
+		if reason != ndmp.HaltSuccessful {
+			return fail("NAS stopped the backup", fmt.Errorf("data service halted: %s", reason))
+		}
+	case <-client.Done():
+		return fail("Lost the NDMP control connection", client.Err())
+	case <-ctx.Done():
+		abort()
+		return fail("Backup cancelled", ctx.Err())
+	case <-time.After(ndmpHaltTimeout):
+		abort()
+		return fail("NAS did not finish the backup", fmt.Errorf("no halt notification within %s", ndmpHaltTimeout))
+	}
+	stopCtx, stopCancel := context.WithTimeout(ctx, 30*time.Second)
+	client.Stop(stopCtx)
+	stopCancel()
+
+	// Only regular files are catalogued, as for tar backups
+	var entries []ArchiveEntry
+	var totalBytes int64
+	for _, f := range client.Files(target.Filesystem) {
+		if f.Type != ndmp.FileRegular {
+			continue
+		}
+		entries = append(entries, ArchiveEntry{
+			Path:    f.Path,
+			Size:    f.Size,
+			Mode:    int(f.Mode),
+			ModTime: f.MTime,
+			UID:     int(f.UID),
+			GID:     int(f.GID),
+		})
+		totalBytes += f.Size
+	}
+	s.updateProgress(job.ID, "cataloging", fmt.Sprintf("Cataloging %d files from the file history...", len(entries)))
+	if err := s.insertArchiveCatalog(backupSetID, entries); err != nil {
+		return fail("Failed to catalog the file history", err)
+	}
+	if len(entries) == 0 {
+		s.logger.Warn("NAS sent no file history, the backup set has no catalog", map[string]interface{}{
+			"backup_set_id": backupSetID,
+		})
+	}
+
+	if err := driveSvc.WriteFileMark(ctx); err != nil {
+		s.logger.Warn("Failed to write file mark", map[string]interface{}{"error": err.Error()})
+	}
+
+	endTime := time.Now()
+	toc := tape.NewTapeTOC(tapeLabel, tapeUUID, poolName)
+	tocSet := tape.TOCBackupSet{
+		FileNumber:  1,
+		JobName:     job.Name,
+		BackupType:  string(backupType),
+		StartTime:   startTime,
+		EndTime:     endTime,
+		FileCount:   int64(len(entries)),
+		TotalBytes:  totalBytes,
+		HwEncrypted: hwEncrypted,
+		NDMPType:    target.Type,
+		NDMPLevel:   &level,
+		Files:       make([]tape.TOCFileEntry, 0, len(entries)),
+	}
+	for _, e := range entries {
+		tocSet.Files = append(tocSet.Files, tape.TOCFileEntry{
+			Path:    e.Path,
+			Size:    e.Size,
+			Mode:    e.Mode,
+			ModTime: e.ModTime.Format(time.RFC3339),
+		})
+	}
+	toc.BackupSets = append(toc.BackupSets, tocSet)
+	if err := driveSvc.WriteTOC(ctx, toc); err != nil {
+		s.logger.Warn("Failed to write TOC to tape", map[string]interface{}{"error": err.Error()})
+	}
+
+	var hwKeyID *int64
+	if hwEncrypted {
+		hwKeyID = job.HwEncryptionKeyID
+	}
+	s.db.Exec(`
+		UPDATE backup_sets SET end_time = ?, status = ?, file_count = ?, total_bytes = ?, tape_bytes = ?,
+			hw_encrypted = ?, hw_encryption_key_id = ?
+		WHERE id = ?
+	`, endTime, models.BackupSetStatusCompleted, len(entries), totalBytes, tapeBytes, hwEncrypted, hwKeyID, backupSetID)
+	s.db.Exec(`
+		UPDATE tapes SET
+			used_bytes = used_bytes + ?, write_count = write_count + 1, physical_remaining_bytes = NULL,
+			last_written_at = ?,
+			status = CASE WHEN status = 'blank' THEN 'active' ELSE status END
+		WHERE id = ?
+	`, tapeBytes, endTime, tapeID)
+	s.db.Exec("UPDATE backup_jobs SET last_run_at = ? WHERE id = ?", endTime, job.ID)
+
+	s.updateProgress(job.ID, "completed", fmt.Sprintf("NDMP backup completed: %d files, %d bytes in %s", len(entries), tapeBytes, endTime.Sub(startTime).String()))
+	s.emitEvent("success", "backup", "backup_completed", job.Name, len(entries), totalBytes, endTime.Sub(startTime).String())
+	s.logger.Info("NDMP backup completed", map[string]interface{}{
+		"job_id":        job.ID,
+		"backup_set_id": backupSetID,
+		"level":         level,
+		"file_count":    len(entries),
+		"total_bytes":   totalBytes,
+		"tape_bytes":    tapeBytes,
+		"duration":      endTime.Sub(startTime).String(),
+	})
+
+	return &models.BackupSet{
+		ID:          backupSetID,
+		JobID:       job.ID,
+		TapeID:      tapeID,
+		BackupType:  backupType,
+		FormatType:  models.TapeFormatType(tapeFormatType),
+		StartTime:   startTime,
+		EndTime:     &endTime,
+		Status:      models.BackupSetStatusCompleted,
+		FileCount:   int64(len(entries)),
+		TotalBytes:  totalBytes,
+		HwEncrypted: hwEncrypted,
+		NDMPType:    target.Type,
+		NDMPLevel:   &level,
+	}, nil
+}
@@ -0,0 +1,133 @@
+package backup
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/RoseOO/TapeBackarr/internal/credentials"
+	"github.com/RoseOO/TapeBackarr/internal/database"
+	"github.com/RoseOO/TapeBackarr/internal/logging"
+	"github.com/RoseOO/TapeBackarr/internal/models"
+	"github.com/RoseOO/TapeBackarr/internal/ndmp"
+	"github.com/RoseOO/TapeBackarr/internal/ndmp/ndmptest"
+	"github.com/RoseOO/TapeBackarr/internal/tape"
+)
+
+func TestRunNDMPBackup(t *testing.T) {
+	ctx := context.Background()
+	db, err := database.New(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("failed to create database: %v", err)
+	}
+	defer db.Close()
+	if err := db.Migrate(); err != nil {
+		t.Fatalf("failed to migrate database: %v", err)
+	}
+
+	nas, err := ndmptest.NewServer("backup", "s3cret")
+	if err != nil {
+		t.Fatalf("NewServer: %v", err)
+	}
+	defer nas.Close()
+	nas.Image = bytes.Repeat([]byte("dump image "), 5000)
+	mtime := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	nas.Files = []ndmp.File{
+		{Path: "docs", Type: ndmp.FileDir, Mode: 0755, MTime: mtime},
+		{Path: "docs/report.pdf", Type: ndmp.FileRegular, Size: 1200, Mode: 0644, MTime: mtime, UID: 1000},
+		{Path: "notes.txt", Type: ndmp.FileRegular, Size: 30, Mode: 0600, MTime: mtime},
+	}
+	nas.NodeHistory = true
+
+	store, err := credentials.NewStore(db, "test-key")
+	if err != nil {
+		t.Fatalf("NewStore: %v", err)
+	}
+	credID, err := store.Create(&models.Credential{Name: "nas", CredentialType: models.CredentialPassword, Username: "backup"}, "s3cret")
+	if err != nil {
+		t.Fatalf("Create credential: %v", err)
+	}
+
+	devicePath := "file://" + t.TempDir()
+	drive := tape.NewServiceForDevice(devicePath, 65536)
+	if err := drive.WriteTapeLabel(ctx, "ND0001", "uuid-nd", "nas"); err != nil {
+		t.Fatalf("WriteTapeLabel: %v", err)
+	}
+	db.Exec("INSERT INTO tape_pools (name) VALUES ('nas')")
+	db.Exec("INSERT INTO tapes (uuid, barcode, label, pool_id, status, capacity_bytes, used_bytes) VALUES ('uuid-nd', 'ND0001', 'ND0001', 1, 'active', 10000000, 0)")
+	db.Exec("INSERT INTO tape_drives (device_path, display_name, status, current_tape_id) VALUES (?, 'vtape', 'ready', 1)", devicePath)
+	path := "ndmp://" + nas.Addr + "/vol/vol1"
+	if _, err := db.Exec("INSERT INTO backup_sources (name, source_type, path, credential_id) VALUES ('filer', 'ndmp', ?, ?)", path, credID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Exec("INSERT INTO backup_jobs (name, source_id, pool_id, backup_type, schedule_cron, retention_days) VALUES ('filer', 1, 1, 'incremental', '', 30)"); err != nil {
+		t.Fatal(err)
+	}
+
+	logger, _ := logging.NewLogger("error", "text", "")
+	svc := NewService(db, drive, logger, 65536, 0, 0)
+	svc.SetCredentials(store)
+	job := &models.BackupJob{ID: 1, Name: "filer", PoolID: 1, BackupType: models.BackupTypeIncremental}
+	source := &models.BackupSource{ID: 1, Name: "filer", SourceType: models.SourceTypeNDMP, Path: path}
+
+	// The first incremental has nothing to build on and runs at level 0
+	set, err := svc.RunBackup(ctx, job, source, 1, models.BackupTypeIncremental)
+	if err != nil {
+		t.Fatalf("RunBackup: %v", err)
+	}
+	if set.BackupType != models.BackupTypeFull || set.NDMPLevel == nil || *set.NDMPLevel != 0 || set.FileCount != 2 {
+		t.Fatalf("expected a full level 0 set of 2 files, got %+v", set)
+	}
+	typ, env := nas.LastBackup()
+	if typ != "dump" || env["FILESYSTEM"] != "/vol/vol1" || env["LEVEL"] != "0" || env["HIST"] != "y" {
+		t.Errorf("unexpected backup request %s %v", typ, env)
+	}
+
+	var catalogued []string
+	rows, _ := db.Query("SELECT file_path FROM catalog_entries WHERE backup_set_id = ? ORDER BY file_path", set.ID)
+	for rows.Next() {
+		var p string
+		rows.Scan(&p)
+		catalogued = append(catalogued, p)
+	}
+	rows.Close()
+	if strings.Join(catalogued, ",") != "docs/report.pdf,notes.txt" {
+		t.Errorf("unexpected catalog %v", catalogued)
+	}
+
+	// The image is on tape unchanged
+	if err := drive.SeekToFileNumber(ctx, 1); err != nil {
+		t.Fatalf("SeekToFileNumber: %v", err)
+	}
+	r, err := drive.OpenReader(ctx)
+	if err != nil {
+		t.Fatalf("OpenReader: %v", err)
+	}
+	image, _ := io.ReadAll(r)
+	r.Close()
+	if !bytes.Equal(image, nas.Image) {
+		t.Errorf("tape holds %d bytes, expected the %d byte image", len(image), len(nas.Image))
+	}
+
+	// The next incremental builds on it
+	set, err = svc.RunBackup(ctx, job, source, 1, models.BackupTypeIncremental)
+	if err != nil {
+		t.Fatalf("RunBackup: %v", err)
+	}
+	var ndmpType string
+	var level int
+	db.QueryRow("SELECT ndmp_type, ndmp_level FROM backup_sets WHERE id = ?", set.ID).Scan(&ndmpType, &level)
+	if _, env := nas.LastBackup(); set.BackupType != models.BackupTypeIncremental || ndmpType != "dump" || level != 1 || env["LEVEL"] != "1" {
+		t.Errorf("expected an incremental at level 1, got %s %s level %d (%v)", set.BackupType, ndmpType, level, env)
+	}
+
+	// A wrong password fails the run
+	nas.Password = "other"
+	if _, err := svc.RunBackup(ctx, job, source, 1, models.BackupTypeFull); err == nil || !strings.Contains(err.Error(), "NDMP server") {
+		t.Errorf("expected an authentication failure, got %v", err)
+	}
+}
@@ -0,0 +1,76 @@
+package backup
+
+import (
+	"fmt"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+)
+
+// NFSExport is the export an NFS source backs up
+type NFSExport struct {
+	Host string
+	Port int // 0 for the default
+	// Path is the export, or a directory within it
+	Path string
+}
+
+func (e *NFSExport) String() string {
+	return e.Host + ":" + e.Path
+}
+
+// ParseNFSPath parses the path of an NFS source that TapeBackarr mounts
+// itself: host:/export[/directory] or nfs://host[:port]/export[/directory].
+// Sources whose path is a local directory name an export mounted outside
+// TapeBackarr and are not parsed.
+func ParseNFSPath(raw string) (*NFSExport, error) {
+	var e NFSExport
+	if strings.HasPrefix(raw, "nfs://") {
+		u, err := url.Parse(raw)
+		if err != nil || u.Hostname() == "" || u.User != nil || u.RawQuery != "" {
+			return nil, fmt.Errorf("path must be host:/export, nfs://host[:port]/export or a local directory")
+		}
+		e.Host, e.Path = u.Hostname(), u.Path
+		if strings.Contains(e.Host, ":") {
+			e.Host = "[" + e.Host + "]"
+		}
+		if p := u.Port(); p != "" {
+			port, err := strconv.Atoi(p)
+			if err != nil || port < 1 || port > 65535 {
+				return nil, fmt.Errorf("invalid port %q", p)
+			}
+			e.Port = port
+		}
+	} else {
+		// The host may be a bracketed IPv6 address, so split at ":/"
+		i := strings.Index(raw, ":/")
+		if i <= 0 {
+			return nil, fmt.Errorf("path must be host:/export, nfs://host[:port]/export or a local directory")
+		}
+		e.Host, e.Path = raw[:i], raw[i+1:]
+	}
+	// A host starting with "-" would be read by mount as an option
+	if strings.HasPrefix(e.Host, "-") || strings.ContainsAny(e.Host, " /,") {
+		return nil, fmt.Errorf("invalid host %q", e.Host)
+	}
+	if e.Path == "" {
+		return nil, fmt.Errorf("the path must name the export, e.g. nas:/export/data")
+	}
+	e.Path = path.Clean(e.Path)
+	return &e, nil
+}
+
+// nfsMountArgs returns the mount arguments for an NFS export with the
+// source's own options. "ro" comes last so that no option can undo it.
+func nfsMountArgs(e *NFSExport, mountPoint, options string) []string {
+	var opts []string
+	if e.Port > 0 {
+		opts = append(opts, "port="+strconv.Itoa(e.Port))
+	}
+	if options != "" {
+		opts = append(opts, options)
+	}
+	opts = append(opts, "ro")
+	return []string{"-t", "nfs", "-o", strings.Join(opts, ","), "--", e.String(), mountPoint}
+}
@@ -0,0 +1,220 @@
+package backup
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/RoseOO/TapeBackarr/internal/database"
+	"github.com/RoseOO/TapeBackarr/internal/logging"
+	"github.com/RoseOO/TapeBackarr/internal/models"
+	"github.com/RoseOO/TapeBackarr/internal/scratch"
+)
+
+func TestParseNFSPath(t *testing.T) {
+	tests := []struct {
+		raw  string
+		want NFSExport
+	}{
+		{"nas:/export/data", NFSExport{Host: "nas", Path: "/export/data"}},
+		{"nas:/", NFSExport{Host: "nas", Path: "/"}},
+		{"[fd00::1]:/export/", NFSExport{Host: "[fd00::1]", Path: "/export"}},
+		{"nfs://nas:2049/export/data", NFSExport{Host: "nas", Port: 2049, Path: "/export/data"}},
+		{"nfs://[fd00::1]/export", NFSExport{Host: "[fd00::1]", Path: "/export"}},
+	}
+	for _, tt := range tests {
+		got, err := ParseNFSPath(tt.raw)
+		if err != nil {
+			t.Errorf("%s: %v", tt.raw, err)
+			continue
+		}
+		if *got != tt.want {
+			t.Errorf("%s: got %+v, want %+v", tt.raw, *got, tt.want)
+		}
+	}
+
+	for _, raw := range []string{"/mnt/nfs", "nas", "nas:export", ":/export", "nfs://nas", "nfs://nas/export?vers=4", "nfs://nas:99999/export", "my nas:/export", "-oremount:/export", "nfs://-o/export"} {
+		if _, err := ParseNFSPath(raw); err == nil {
+			t.Errorf("%s: expected an error", raw)
+		}
+	}
+}
+
+func TestCheckMountOptions(t *testing.T) {
+	for _, ok := range []string{"", "vers=4.1", "vers=3,soft,timeo=100"} {
+		if err := CheckMountOptions(ok); err != nil {
+			t.Errorf("%q: %v", ok, err)
+		}
+	}
+	for _, bad := range []string{"vers=4 soft", "soft,password=x", "username=admin", "credentials=/root/creds", "rw", "soft,remount"} {
+		if err := CheckMountOptions(bad); err == nil {
+			t.Errorf("%q: expected an error", bad)
+		}
+	}
+}
+
+func TestNFSSourceMount(t *testing.T) {
+	db, err := database.New(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("failed to create database: %v", err)
+	}
+	defer db.Close()
+	if err := db.Migrate(); err != nil {
+		t.Fatalf("failed to migrate database: %v", err)
+	}
+	db.Exec("INSERT INTO backup_sources (name, source_type, path, mount_options) VALUES ('nas', 'nfs', 'nas:/export/data', 'vers=4.1,soft')")
+	db.Exec("INSERT INTO backup_jobs (name, source_id, pool_id, backup_type, schedule_cron, retention_days) VALUES ('nas', 1, 1, 'full', '', 30)")
+
+	var calls []string
+	mountErr := errors.New("mount failed (exit code 32: access denied by server)")
+	orig := mountCommand
+	defer func() { mountCommand = orig }()
+	mountCommand = func(ctx context.Context, name string, args ...string) error {
+		calls = append(calls, name+" "+strings.Join(args, " "))
+		if name == "mount" && mountErr != nil {
+			return mountErr
+		}
+		return nil
+	}
+
+	logger, _ := logging.NewLogger("error", "text", "")
+	svc := NewService(db, nil, logger, 65536, 0, 0)
+	svc.SetScratchDir(scratch.New(t.TempDir(), 0))
+	var events []string
+	svc.EventCallback = func(eventType, category, key string, args ...interface{}) {
+		events = append(events, fmt.Sprint(append([]interface{}{key}, args...)...))
+	}
+	job := &models.BackupJob{ID: 1, Name: "nas", PoolID: 1, BackupType: models.BackupTypeFull}
+	source := &models.BackupSource{ID: 1, Name: "nas", SourceType: models.SourceTypeNFS, Path: "nas:/export/data"}
+
+	// A failed mount fails the run and is shown in its progress
+	if _, err := svc.RunBackup(context.Background(), job, source, 1, models.BackupTypeFull); err == nil || !strings.Contains(err.Error(), "failed to mount nas:/export/data") {
+		t.Fatalf("expected the mount to fail the backup, got %v", err)
+	}
+	mountPoint := svc.sourceMountPoint(1)
+	if len(calls) != 1 || calls[0] != "mount -t nfs -o vers=4.1,soft,ro -- nas:/export/data "+mountPoint {
+		t.Errorf("unexpected commands %q", calls)
+	}
+	joined := strings.Join(events, "\n")
+	if !strings.Contains(joined, "backup_progressmountingMounting nas:/export/data...") ||
+		!strings.Contains(joined, "backup_progressfailedFailed to mount source: failed to mount nas:/export/data") {
+		t.Errorf("expected the mount and its failure in the job's progress, got:\n%s", joined)
+	}
+	if _, err := os.Stat(mountPoint); !os.IsNotExist(err) {
+		t.Error("expected the mount point of a failed mount to be removed")
+	}
+
+	// The connection test mounts and unmounts the export
+	mountErr = nil
+	calls = nil
+	if err := svc.TestSource(context.Background(), source); err != nil {
+		t.Fatalf("TestSource: %v", err)
+	}
+	if len(calls) != 2 || calls[1] != "umount "+mountPoint {
+		t.Errorf("expected a mount and an unmount, got %q", calls)
+	}
+
+	// NFS sources with a local path are mounted outside TapeBackarr
+	calls = nil
+	premounted := &models.BackupSource{ID: 2, SourceType: models.SourceTypeNFS, Path: t.TempDir()}
+	if err := svc.TestSource(context.Background(), premounted); err != nil {
+		t.Errorf("TestSource of a mounted export: %v", err)
+	}
+	if len(calls) != 0 {
+		t.Errorf("expected no mount for a local path, got %q", calls)
+	}
+}
+
+func TestSlowMountOnlyHoldsUpItsSource(t *testing.T) {
+	db, err := database.New(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("failed to create database: %v", err)
+	}
+	defer db.Close()
+	if err := db.Migrate(); err != nil {
+		t.Fatalf("failed to migrate database: %v", err)
+	}
+
+	svc := NewService(db, nil, nil, 65536, 0, 0)
+	svc.SetScratchDir(scratch.New(t.TempDir(), 0))
+	slow := &models.BackupSource{ID: 1, Name: "slow", SourceType: models.SourceTypeNFS, Path: "slow:/export"}
+	fast := &models.BackupSource{ID: 2, Name: "fast", SourceType: models.SourceTypeNFS, Path: "fast:/export"}
+
+	// The mount of the slow source hangs until unblocked
+	var mu sync.Mutex
+	var calls []string
+	started, unblock := make(chan struct{}), make(chan struct{})
+	orig := mountCommand
+	defer func() { mountCommand = orig }()
+	mountCommand = func(ctx context.Context, name string, args ...string) error {
+		mu.Lock()
+		calls = append(calls, name+" "+args[len(args)-1])
+		mu.Unlock()
+		if name == "mount" && args[len(args)-1] == svc.sourceMountPoint(slow.ID) {
+			close(started)
+			<-unblock
+		}
+		return nil
+	}
+
+	errs := make(chan error, 2)
+	releases := make(chan func(), 2)
+	mountSlow := func() {
+		_, release, err := svc.mountSource(context.Background(), slow, "backup")
+		if err == nil {
+			releases <- release
+		}
+		errs <- err
+	}
+	go mountSlow()
+	<-started
+	go mountSlow()
+
+	done := make(chan error)
+	go func() {
+		_, release, err := svc.mountSource(context.Background(), fast, "backup")
+		if err == nil {
+			release()
+		}
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("mount of the fast source: %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("the mount of one source held up another")
+	}
+
+	close(unblock)
+	for i := 0; i < 2; i++ {
+		if err := <-errs; err != nil {
+			t.Fatalf("mount of the slow source: %v", err)
+		}
+	}
+	(<-releases)()
+	(<-releases)()
+
+	slowMounts, slowUnmounts := 0, 0
+	for _, call := range calls {
+		switch call {
+		case "mount " + svc.sourceMountPoint(slow.ID):
+			slowMounts++
+		case "umount " + svc.sourceMountPoint(slow.ID):
+			slowUnmounts++
+		}
+	}
+	if slowMounts != 1 || slowUnmounts != 1 {
+		t.Errorf("expected the runs of the slow source to share one mount, got %q", calls)
+	}
+	if len(svc.mounts) != 0 {
+		t.Errorf("expected no mounts left, got %d", len(svc.mounts))
+	}
+}
@@ -0,0 +1,80 @@
+package backup
+
+import (
+	"os"
+	"os/user"
+	"strconv"
+	"sync"
+)
+
+// Catalog file types
+const (
+	FileTypeFile    = "file"
+	FileTypeSymlink = "symlink"
+)
+
+// ownerNames caches uid and gid lookups, which read /etc/passwd or ask NSS
+// for every call and would otherwise dominate scans of large trees
+var ownerNames struct {
+	sync.Mutex
+	users  map[int]string
+	groups map[int]string
+}
+
+// userName returns the name of a uid, or "" when it has none
+func userName(uid int) string {
+	ownerNames.Lock()
+	defer ownerNames.Unlock()
+	if name, ok := ownerNames.users[uid]; ok {
+		return name
+	}
+	var name string
+	if u, err := user.LookupId(strconv.Itoa(uid)); err == nil {
+		name = u.Username
+	}
+	if ownerNames.users == nil {
+		ownerNames.users = make(map[int]string)
+	}
+	ownerNames.users[uid] = name
+	return name
+}
+
+// groupName returns the name of a gid, or "" when it has none
+func groupName(gid int) string {
+	ownerNames.Lock()
+	defer ownerNames.Unlock()
+	if name, ok := ownerNames.groups[gid]; ok {
+		return name
+	}
+	var name string
+	if g, err := user.LookupGroupId(strconv.Itoa(gid)); err == nil {
+		name = g.Name
+	}
+	if ownerNames.groups == nil {
+		ownerNames.groups = make(map[int]string)
+	}
+	ownerNames.groups[gid] = name
+	return name
+}
+
+// describeFile fills the catalog metadata of a scanned file: its type, the
+// target of a stored symlink, its owner and group, and whether it carries
+// extended attributes. info describes fi.Path itself, or its target when the
+// link is followed.
+func describeFile(fi *FileInfo, info os.FileInfo) {
+	fi.FileType = FileTypeFile
+	if info.Mode()&os.ModeSymlink != 0 {
+		fi.FileType = FileTypeSymlink
+		if target, err := os.Readlink(fi.Path); err == nil {
+			fi.LinkTarget = target
+		}
+	} else {
+		// Listxattr follows links, so it is only asked about file contents
+		fi.HasXattrs = hasXattrs(fi.Path)
+	}
+	if uid, gid, ok := fileOwner(info); ok {
+		fi.UID, fi.GID = &uid, &gid
+		fi.Owner = userName(uid)
+		fi.Group = groupName(gid)
+	}
+}
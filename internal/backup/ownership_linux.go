@@ -0,0 +1,20 @@
+package backup
+
+import (
+	"os"
+	"syscall"
+)
+
+// fileOwner returns the uid and gid of a file
+func fileOwner(info os.FileInfo) (uid, gid int, ok bool) {
+	if st, ok := info.Sys().(*syscall.Stat_t); ok {
+		return int(st.Uid), int(st.Gid), true
+	}
+	return 0, 0, false
+}
+
+// hasXattrs reports whether a file has any extended attributes
+func hasXattrs(path string) bool {
+	n, err := syscall.Listxattr(path, nil)
+	return err == nil && n > 0
+}
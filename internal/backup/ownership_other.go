@@ -0,0 +1,16 @@
+//go:build !linux
+
+package backup
+
+import "os"
+
+// fileOwner reports no owner: ownership is only read on Linux, and the
+// catalog leaves uid and gid empty elsewhere
+func fileOwner(info os.FileInfo) (uid, gid int, ok bool) {
+	return 0, 0, false
+}
+
+// hasXattrs reports false: extended attributes are only listed on Linux
+func hasXattrs(path string) bool {
+	return false
+}
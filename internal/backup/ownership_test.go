@@ -0,0 +1,92 @@
+package backup
+
+import (
+	"archive/tar"
+	"context"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/RoseOO/TapeBackarr/internal/database"
+	"github.com/RoseOO/TapeBackarr/internal/logging"
+	"github.com/RoseOO/TapeBackarr/internal/models"
+	"github.com/RoseOO/TapeBackarr/internal/tape"
+)
+
+func TestCatalogOwnership(t *testing.T) {
+	ctx := context.Background()
+	db, err := database.New(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("failed to create database: %v", err)
+	}
+	defer db.Close()
+	if err := db.Migrate(); err != nil {
+		t.Fatalf("failed to migrate database: %v", err)
+	}
+
+	srcDir := t.TempDir()
+	os.WriteFile(filepath.Join(srcDir, "big.bin"), make([]byte, 4096), 0644)
+	os.WriteFile(filepath.Join(srcDir, "small.txt"), []byte("hi"), 0644)
+	os.Symlink("small.txt", filepath.Join(srcDir, "link"))
+
+	devicePath := "file://" + t.TempDir()
+	drive := tape.NewServiceForDevice(devicePath, 65536)
+	if err := drive.WriteTapeLabel(ctx, "OW0001", "uuid-ow1", "owners"); err != nil {
+		t.Fatalf("WriteTapeLabel: %v", err)
+	}
+	db.Exec("INSERT INTO tape_pools (name) VALUES ('owners')")
+	db.Exec("INSERT INTO tapes (uuid, barcode, label, pool_id, status, capacity_bytes, used_bytes) VALUES ('uuid-ow1', 'OW0001', 'OW0001', 1, 'active', 10000000, 0)")
+	db.Exec("INSERT INTO tape_drives (device_path, display_name, status, current_tape_id) VALUES (?, 'vtape', 'ready', 1)", devicePath)
+	db.Exec("INSERT INTO backup_sources (name, source_type, path) VALUES ('owned', 'local', ?)", srcDir)
+	db.Exec("INSERT INTO backup_jobs (name, source_id, pool_id, backup_type, schedule_cron, retention_days) VALUES ('owned', 1, 1, 'full', '', 30)")
+
+	logger, _ := logging.NewLogger("error", "text", "")
+	svc := NewService(db, drive, logger, 65536, 0, 0)
+	job := &models.BackupJob{ID: 1, Name: "owned", PoolID: 1}
+	source := &models.BackupSource{ID: 1, Name: "owned", Path: srcDir, SymlinkPolicy: models.SymlinkStore}
+	if _, err := svc.RunBackup(ctx, job, source, 1, models.BackupTypeFull); err != nil {
+		t.Fatalf("RunBackup: %v", err)
+	}
+
+	// Stored symlinks keep their target and type
+	links, err := svc.SearchCatalog(ctx, CatalogQuery{FileType: FileTypeSymlink}, 100)
+	if err != nil || len(links) != 1 || links[0].FilePath != "link" || links[0].LinkTarget != "small.txt" {
+		t.Fatalf("unexpected symlink entries %+v (err %v)", links, err)
+	}
+
+	// Size filters combine with the path pattern
+	big, err := svc.SearchCatalog(ctx, CatalogQuery{Pattern: "*", FileType: FileTypeFile, MinSize: 1024}, 100)
+	if err != nil || len(big) != 1 || big[0].FilePath != "big.bin" {
+		t.Fatalf("unexpected entries over 1KiB %+v (err %v)", big, err)
+	}
+
+	if runtime.GOOS != "linux" {
+		return
+	}
+	uid := os.Getuid()
+	if big[0].UID == nil || *big[0].UID != uid || big[0].GID == nil || *big[0].GID != os.Getgid() {
+		t.Fatalf("expected owner %d:%d, got %v:%v", uid, os.Getgid(), big[0].UID, big[0].GID)
+	}
+	owned, err := svc.SearchCatalog(ctx, CatalogQuery{UID: &uid, MinSize: 1}, 100)
+	if err != nil || len(owned) != 3 {
+		t.Fatalf("expected 3 entries owned by uid %d, got %+v (err %v)", uid, owned, err)
+	}
+	if big[0].Owner != "" {
+		byName, _ := svc.SearchCatalog(ctx, CatalogQuery{Owner: big[0].Owner}, 100)
+		if len(byName) != 3 {
+			t.Errorf("expected 3 entries owned by %s, got %d", big[0].Owner, len(byName))
+		}
+	}
+}
+
+func TestArchiveHasXattrs(t *testing.T) {
+	plain := &tar.Header{Name: "a", PAXRecords: map[string]string{"mtime": "1"}}
+	if archiveHasXattrs(plain) {
+		t.Error("member without xattr records reported as having xattrs")
+	}
+	withXattr := &tar.Header{Name: "b", PAXRecords: map[string]string{"SCHILY.xattr.user.tag": "x"}}
+	if !archiveHasXattrs(withXattr) {
+		t.Error("member with a SCHILY.xattr record not reported as having xattrs")
+	}
+}
@@ -0,0 +1,159 @@
+package backup
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/RoseOO/TapeBackarr/internal/models"
+)
+
+// pipelinedScan feeds the files of a running source scan to tar as they are
+// found, so a backup starts writing before the scan of a slow tree has
+// finished. Files go to the current tape in the order they are found while
+// they fit; the first file that does not, and every file found after it, is
+// left for the following tapes.
+type pipelinedScan struct {
+	sourcePath string
+	capacity   int64                       // usable bytes left on the tape
+	filter     func([]FileInfo) []FileInfo // drops unchanged files in incremental runs
+	onQueued   func(files, bytes int64)    // totals handed to tar so far
+	onFiles    func([]FileInfo)            // files to catalog, as they are found
+
+	mu       sync.Mutex
+	pending  []FileInfo
+	scanDone bool
+	wake     chan struct{}
+
+	// Set when the scan finishes
+	all    []FileInfo
+	report *SkipReport
+	err    error
+
+	// Set by feed, valid once done is closed
+	written  []FileInfo
+	overflow []FileInfo
+	done     chan struct{}
+
+	listWriter *os.File
+}
+
+// startPipelinedScan starts scanning source in the background and returns
+// the scan and the tar file list it feeds. The list must be closed once the
+// stream has finished, and wait called for the scan's results. onFiles, when
+// not nil, receives every file that passed the filter, whichever tape it
+// goes to.
+func (s *Service) startPipelinedScan(ctx context.Context, source *models.BackupSource, capacity int64, filter func([]FileInfo) []FileInfo, scanCb ScanProgressFunc, onQueued func(files, bytes int64), onFiles func([]FileInfo)) (*pipelinedScan, *tarFileList, error) {
+	r, w, err := os.Pipe()
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to create file list pipe: %w", err)
+	}
+	p := &pipelinedScan{
+		sourcePath: source.Path,
+		capacity:   capacity,
+		filter:     filter,
+		onQueued:   onQueued,
+		onFiles:    onFiles,
+		wake:       make(chan struct{}, 1),
+		done:       make(chan struct{}),
+		listWriter: w,
+	}
+
+	go func() {
+		files, report, err := s.scanSource(ctx, source, scanCb, p.add)
+		p.mu.Lock()
+		p.all, p.report, p.err = files, report, err
+		p.scanDone = true
+		p.mu.Unlock()
+		p.signal()
+	}()
+	go p.feed()
+
+	// Every symlink is either followed or skipped under the follow policy,
+	// so dereferencing matches what a full list would have asked for
+	list := &tarFileList{path: "-", stdin: r, dereference: source.SymlinkPolicy == models.SymlinkFollow, sourcePath: source.Path}
+	return p, list, nil
+}
+
+// add queues files found by the scan. The scan never waits for tar.
+func (p *pipelinedScan) add(files []FileInfo) {
+	p.mu.Lock()
+	p.pending = append(p.pending, files...)
+	p.mu.Unlock()
+	p.signal()
+}
+
+func (p *pipelinedScan) signal() {
+	select {
+	case p.wake <- struct{}{}:
+	default:
+	}
+}
+
+// feed writes queued files to tar's list until the scan is done, then
+// closes the list so tar finishes the archive
+func (p *pipelinedScan) feed() {
+	defer close(p.done)
+	w := bufio.NewWriter(p.listWriter)
+	var used, bytes int64
+	full, broken := false, false
+	for {
+		p.mu.Lock()
+		batch := p.pending
+		p.pending = nil
+		scanDone := p.scanDone
+		p.mu.Unlock()
+
+		if p.filter != nil {
+			batch = p.filter(batch)
+		}
+		for _, f := range batch {
+			// Same allowance for the tar header as splitFilesForTape
+			size := f.Size + 1024
+			if full || (used+size > p.capacity && len(p.written) > 0) {
+				full = true
+				p.overflow = append(p.overflow, f)
+				continue
+			}
+			used += size
+			bytes += f.Size
+			p.written = append(p.written, f)
+			if !broken {
+				relPath, _ := filepath.Rel(p.sourcePath, f.Path)
+				_, err := fmt.Fprintln(w, relPath)
+				broken = err != nil
+			}
+		}
+		if len(batch) > 0 {
+			// tar stops reading when the stream fails; keep draining the
+			// scan without writing
+			if !broken && w.Flush() != nil {
+				broken = true
+			}
+			if p.onQueued != nil {
+				p.onQueued(int64(len(p.written)), bytes)
+			}
+			if p.onFiles != nil {
+				p.onFiles(batch)
+			}
+		}
+		if scanDone {
+			break
+		}
+		<-p.wake
+	}
+	if !broken {
+		w.Flush()
+	}
+	p.listWriter.Close()
+}
+
+// wait blocks until the scan has finished and its files were handed out,
+// and returns the scan's error
+func (p *pipelinedScan) wait() error {
+	<-p.done
+	return p.err
+}
@@ -0,0 +1,107 @@
+package backup
+
+import (
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/RoseOO/TapeBackarr/internal/models"
+)
+
+func TestPipelinedScan(t *testing.T) {
+	tmpDir := t.TempDir()
+	for _, name := range []string{"a.txt", "b.txt", "c.txt", "d.txt", "e.txt"} {
+		os.WriteFile(filepath.Join(tmpDir, name), []byte(strings.Repeat("x", 1000)), 0644)
+	}
+
+	svc := &Service{}
+	source := &models.BackupSource{Path: tmpDir}
+	// c.txt stands in for a file unchanged since the last incremental run
+	filter := func(files []FileInfo) []FileInfo {
+		var out []FileInfo
+		for _, f := range files {
+			if filepath.Base(f.Path) != "c.txt" {
+				out = append(out, f)
+			}
+		}
+		return out
+	}
+	var queuedFiles, queuedBytes int64
+	onQueued := func(files, bytes int64) {
+		queuedFiles, queuedBytes = files, bytes
+	}
+
+	// Two files with their tar header allowance fit, the third does not
+	pipeline, list, err := svc.startPipelinedScan(context.Background(), source, 5000, filter, nil, onQueued, nil)
+	if err != nil {
+		t.Fatalf("startPipelinedScan failed: %v", err)
+	}
+	if strings.Join(list.args(), " ") != "-T -" {
+		t.Errorf("unexpected tar arguments %v", list.args())
+	}
+	data, err := io.ReadAll(list.stdin)
+	if err != nil {
+		t.Fatalf("failed to read file list: %v", err)
+	}
+	list.Close()
+	if err := pipeline.wait(); err != nil {
+		t.Fatalf("scan failed: %v", err)
+	}
+
+	if len(pipeline.written) != 2 || len(pipeline.overflow) != 2 {
+		t.Fatalf("expected 2 written and 2 overflow files, got %d and %d", len(pipeline.written), len(pipeline.overflow))
+	}
+	// The scan order is not fixed; the list must match what was counted as
+	// written, and c.txt must be neither written nor left over
+	var want string
+	seen := map[string]bool{}
+	for _, f := range pipeline.written {
+		want += filepath.Base(f.Path) + "\n"
+		seen[filepath.Base(f.Path)] = true
+	}
+	for _, f := range pipeline.overflow {
+		seen[filepath.Base(f.Path)] = true
+	}
+	if string(data) != want {
+		t.Errorf("expected list %q, got %q", want, data)
+	}
+	if len(seen) != 4 || seen["c.txt"] {
+		t.Errorf("unexpected written and overflow files %v", seen)
+	}
+	if len(pipeline.all) != 5 {
+		t.Errorf("expected the full scan of 5 files for the snapshot, got %d", len(pipeline.all))
+	}
+	if pipeline.report == nil || pipeline.report.Total != 0 {
+		t.Errorf("unexpected skip report %+v", pipeline.report)
+	}
+	if queuedFiles != 2 || queuedBytes != 2000 {
+		t.Errorf("expected 2 files and 2000 bytes queued, got %d and %d", queuedFiles, queuedBytes)
+	}
+}
+
+func TestPipelinedScanStreamFailure(t *testing.T) {
+	tmpDir := t.TempDir()
+	os.WriteFile(filepath.Join(tmpDir, "a.txt"), []byte("a"), 0644)
+
+	svc := &Service{}
+	source := &models.BackupSource{Path: tmpDir, SymlinkPolicy: models.SymlinkFollow}
+	pipeline, list, err := svc.startPipelinedScan(context.Background(), source, 1<<20, nil, nil, nil, nil)
+	if err != nil {
+		t.Fatalf("startPipelinedScan failed: %v", err)
+	}
+	if !list.dereference {
+		t.Error("expected the follow policy to dereference symlinks")
+	}
+
+	// A stream that fails without reading the list must not stall the scan
+	list.Close()
+	if err := pipeline.wait(); err != nil {
+		t.Fatalf("scan failed: %v", err)
+	}
+	if len(pipeline.written) != 1 {
+		t.Errorf("expected the file to be counted as written, got %d", len(pipeline.written))
+	}
+}
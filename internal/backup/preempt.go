@@ -0,0 +1,125 @@
+package backup
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// ErrDriveBusy is returned when the backup run holding a drive a restore
+// needs has at least the restore's priority
+var ErrDriveBusy = errors.New("drive is in use by a backup run")
+
+// restoreHolder stands for a restore in a drive queue. Restores are not
+// jobs, so their hold is kept in memory only and not in tape_drives.
+const restoreHolder int64 = -1
+
+// PreemptedRun is a backup run stopped at a checkpoint to free its drive
+// for a restore
+type PreemptedRun struct {
+	JobID      int64  `json:"job_id"`
+	JobName    string `json:"job_name"`
+	Priority   int    `json:"priority"`
+	DevicePath string `json:"device_path"`
+	// TapeID is the tape that was in the drive, for the run to resume on
+	TapeID int64 `json:"tape_id,omitempty"`
+}
+
+// HoldDriveForRestore makes a restore the next holder of a drive, ahead of
+// the backup runs waiting for it. A run holding the drive for a job with a
+// lower priority than the restore is checkpointed and cancelled, and
+// returned so it can be resumed after the restore; one with the same or a
+// higher priority fails the hold with ErrDriveBusy. The returned function
+// releases the drive to the next run waiting for it.
+func (s *Service) HoldDriveForRestore(ctx context.Context, devicePath string, priority int) (func(), *PreemptedRun, error) {
+	s.driveMu.Lock()
+	if s.drives == nil {
+		s.drives = make(map[string]*driveQueue)
+	}
+	q := s.drives[devicePath]
+	if q == nil {
+		q = &driveQueue{}
+		s.drives[devicePath] = q
+	}
+	release := func() { s.releaseDrive(restoreHolder, devicePath) }
+	if q.holder == 0 {
+		q.holder = restoreHolder
+		s.driveMu.Unlock()
+		return release, nil, nil
+	}
+
+	var run *PreemptedRun
+	if q.holder != restoreHolder {
+		run = &PreemptedRun{JobID: q.holder, JobName: s.jobName(q.holder), DevicePath: devicePath}
+		s.db.QueryRow("SELECT COALESCE(priority, 0) FROM backup_jobs WHERE id = ?", q.holder).Scan(&run.Priority)
+		if run.Priority >= priority {
+			s.driveMu.Unlock()
+			return nil, nil, fmt.Errorf("%w: job %s (priority %d) holds drive %s", ErrDriveBusy, run.JobName, run.Priority, devicePath)
+		}
+	}
+
+	// Restores wait behind each other but ahead of every backup run
+	w := &driveWaiter{jobID: restoreHolder, ready: make(chan struct{})}
+	i := 0
+	for i < len(q.waiters) && q.waiters[i].jobID == restoreHolder {
+		i++
+	}
+	q.waiters = append(q.waiters[:i], append([]*driveWaiter{w}, q.waiters[i:]...)...)
+	s.driveMu.Unlock()
+
+	if run != nil {
+		var tapeID sql.NullInt64
+		s.db.QueryRow("SELECT current_tape_id FROM tape_drives WHERE device_path = ?", devicePath).Scan(&tapeID)
+		run.TapeID = tapeID.Int64
+		s.preemptJob(run.JobID)
+	}
+
+	select {
+	case <-w.ready:
+		return release, run, nil
+	case <-ctx.Done():
+		s.driveMu.Lock()
+		handed := true
+		for i, other := range q.waiters {
+			if other == w {
+				q.waiters = append(q.waiters[:i], q.waiters[i+1:]...)
+				handed = false
+				break
+			}
+		}
+		s.driveMu.Unlock()
+		if handed {
+			release()
+		}
+		// The run was stopped all the same and still has to be resumed
+		return nil, run, ctx.Err()
+	}
+}
+
+// preemptJob records a running job's progress as resumable, as
+// CheckpointJob does, and cancels the run so it gives up its drive
+func (s *Service) preemptJob(jobID int64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	p, ok := s.activeJobs[jobID]
+	if !ok {
+		return
+	}
+	p.Message = "Job stopped for a restore with higher priority"
+	p.UpdatedAt = time.Now()
+	p.LogLines = append(p.LogLines, fmt.Sprintf("[%s] Job checkpointed and stopped to free drive %s for a restore, it resumes once the restore is done", time.Now().Format("15:04:05"), p.DevicePath))
+	s.saveJobExecutionState(jobID, p)
+	if cancel, ok := s.cancelFuncs[jobID]; ok {
+		cancel()
+	}
+}
+
+// holderName describes the holder of a drive for queue messages
+func (s *Service) holderName(holder int64) string {
+	if holder == restoreHolder {
+		return "a restore"
+	}
+	return "job " + s.jobName(holder)
+}
@@ -0,0 +1,116 @@
+package backup
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/RoseOO/TapeBackarr/internal/database"
+	"github.com/RoseOO/TapeBackarr/internal/logging"
+	"github.com/RoseOO/TapeBackarr/internal/tape"
+)
+
+func TestHoldDriveForRestore(t *testing.T) {
+	ctx := context.Background()
+	db, err := database.New(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("failed to create database: %v", err)
+	}
+	defer db.Close()
+	if err := db.Migrate(); err != nil {
+		t.Fatalf("failed to migrate database: %v", err)
+	}
+
+	devicePath := "file://" + t.TempDir()
+	db.Exec("INSERT INTO tape_pools (name) VALUES ('shared')")
+	db.Exec("INSERT INTO tapes (uuid, barcode, label, pool_id, status) VALUES ('uuid-PR0001', 'PR0001', 'PR0001', 1, 'active')")
+	db.Exec("INSERT INTO tape_drives (device_path, display_name, status, current_tape_id) VALUES (?, 'drive', 'ready', 1)", devicePath)
+	db.Exec("INSERT INTO backup_sources (name, source_type, path) VALUES ('docs', 'local', '/tmp')")
+	db.Exec("INSERT INTO backup_jobs (name, source_id, pool_id, backup_type, schedule_cron, retention_days, priority) VALUES ('bulk', 1, 1, 'full', '', 30, 0)")
+	db.Exec("INSERT INTO backup_jobs (name, source_id, pool_id, backup_type, schedule_cron, retention_days, priority) VALUES ('critical', 1, 1, 'full', '', 30, 10)")
+
+	logger, _ := logging.NewLogger("error", "text", "")
+	svc := NewService(db, tape.NewServiceForDevice(devicePath, 65536), logger, 65536, 0, 0)
+
+	// A free drive is held straight away
+	release, run, err := svc.HoldDriveForRestore(ctx, devicePath, 5)
+	if err != nil || run != nil {
+		t.Fatalf("expected a free drive held without preempting, got run %+v err %v", run, err)
+	}
+	if queues := svc.DriveQueues(); len(queues) != 1 || !queues[0].Restore {
+		t.Fatalf("expected the drive held by a restore, got %+v", queues)
+	}
+	release()
+
+	// A run of a job with higher priority keeps its drive
+	releaseCritical, err := svc.acquireDrive(ctx, 2, devicePath)
+	if err != nil {
+		t.Fatalf("acquireDrive: %v", err)
+	}
+	if _, _, err := svc.HoldDriveForRestore(ctx, devicePath, 5); !errors.Is(err, ErrDriveBusy) {
+		t.Fatalf("expected a higher priority run to keep the drive, got %v", err)
+	}
+	releaseCritical()
+
+	// A run of lower priority is checkpointed and stopped; the restore goes
+	// ahead of a run already waiting for the drive
+	releaseBulk, err := svc.acquireDrive(ctx, 1, devicePath)
+	if err != nil {
+		t.Fatalf("acquireDrive: %v", err)
+	}
+	db.Exec("INSERT INTO backup_sets (job_id, tape_id, backup_type, start_time, status) VALUES (1, 1, 'full', CURRENT_TIMESTAMP, 'running')")
+	svc.InjectTestJob(1, &JobProgress{JobID: 1, JobName: "bulk", BackupSetID: 1, Status: "running", DevicePath: devicePath})
+	stopped := make(chan struct{})
+	svc.mu.Lock()
+	svc.cancelFuncs[1] = func() {
+		close(stopped)
+		go releaseBulk()
+	}
+	svc.mu.Unlock()
+
+	waiting := make(chan func())
+	go func() {
+		release, err := svc.acquireDrive(ctx, 2, devicePath)
+		if err != nil {
+			t.Errorf("acquireDrive while queued: %v", err)
+		}
+		waiting <- release
+	}()
+	waitFor(t, func() bool {
+		queues := svc.DriveQueues()
+		return len(queues) == 1 && len(queues[0].WaitingJobs) == 1
+	})
+
+	release, run, err = svc.HoldDriveForRestore(ctx, devicePath, 5)
+	if err != nil {
+		t.Fatalf("HoldDriveForRestore: %v", err)
+	}
+	select {
+	case <-stopped:
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected the lower priority run to be cancelled")
+	}
+	if run == nil || run.JobID != 1 || run.JobName != "bulk" || run.TapeID != 1 {
+		t.Fatalf("unexpected preempted run %+v", run)
+	}
+	var status string
+	var canResume bool
+	db.QueryRow("SELECT status, can_resume FROM job_executions WHERE job_id = 1").Scan(&status, &canResume)
+	if status != "paused" || !canResume {
+		t.Errorf("expected the run checkpointed as resumable, got %s resumable=%v", status, canResume)
+	}
+	if queues := svc.DriveQueues(); !queues[0].Restore || len(queues[0].WaitingJobs) != 1 {
+		t.Fatalf("expected the restore to hold the drive ahead of job 2, got %+v", queues)
+	}
+	svc.RemoveTestJob(1)
+
+	// Releasing the restore hands the drive to the waiting run
+	release()
+	releaseCritical = <-waiting
+	if queues := svc.DriveQueues(); len(queues) != 1 || queues[0].JobID != 2 {
+		t.Fatalf("expected job 2 to hold the drive, got %+v", queues)
+	}
+	releaseCritical()
+}
@@ -0,0 +1,70 @@
+package backup
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/RoseOO/TapeBackarr/internal/models"
+)
+
+// fullRunFilter excludes the extra backup sets a spanned run creates for its
+// second and later tapes, so each run is counted once.
+const fullRunFilter = `
+	AND NOT EXISTS (
+		SELECT 1 FROM tape_spanning_members m
+		WHERE m.backup_set_id = bs.id AND m.sequence_number > 1
+	)`
+
+// FullBackupDue applies a job's force-full policy to a scheduled incremental
+// or differential run. It returns why the run must be promoted to a full
+// backup, or "" when the run can go ahead. Differential runs count against
+// full_every_incrementals like incrementals do. Jobs without a policy are
+// never promoted.
+func (s *Service) FullBackupDue(job *models.BackupJob, now time.Time) (string, error) {
+	if job.FullEveryIncrementals <= 0 && job.FullEveryDays <= 0 {
+		return "", nil
+	}
+
+	var lastFull time.Time
+	err := s.db.QueryRow(`
+		SELECT bs.start_time FROM backup_sets bs
+		WHERE bs.job_id = ? AND bs.backup_type = 'full' AND bs.status = 'completed' AND bs.invalidated_at IS NULL
+	`+fullRunFilter+`
+		ORDER BY bs.start_time DESC LIMIT 1
+	`, job.ID).Scan(&lastFull)
+	if err == sql.ErrNoRows {
+		return "no completed full backup to base incrementals on", nil
+	}
+	if err != nil {
+		return "", err
+	}
+
+	if job.FullEveryIncrementals > 0 {
+		var incrementals int
+		err := s.db.QueryRow(`
+			SELECT COUNT(*) FROM backup_sets bs
+			WHERE bs.job_id = ? AND bs.backup_type IN ('incremental', 'differential') AND bs.status = 'completed'
+			  AND bs.invalidated_at IS NULL AND bs.start_time > ?
+		`+fullRunFilter, job.ID, lastFull).Scan(&incrementals)
+		if err != nil {
+			return "", err
+		}
+		if incrementals >= job.FullEveryIncrementals {
+			noun := "incrementals"
+			if job.BackupType == models.BackupTypeDifferential {
+				noun = "differentials"
+			}
+			return fmt.Sprintf("%d %s since the last full backup (limit %d)", incrementals, noun, job.FullEveryIncrementals), nil
+		}
+	}
+
+	if job.FullEveryDays > 0 {
+		days := int(now.Sub(lastFull).Hours() / 24)
+		if days >= job.FullEveryDays {
+			return fmt.Sprintf("%d days since the last full backup (limit %d)", days, job.FullEveryDays), nil
+		}
+	}
+
+	return "", nil
+}
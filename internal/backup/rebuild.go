@@ -0,0 +1,397 @@
+package backup
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/RoseOO/TapeBackarr/internal/models"
+	"github.com/RoseOO/TapeBackarr/internal/stages"
+	"github.com/RoseOO/TapeBackarr/internal/tape"
+)
+
+// ErrUnlabeledTape is returned by RebuildCatalogFromTape when the tape in the
+// drive carries no TapeBackarr label.
+var ErrUnlabeledTape = errors.New("tape has no TapeBackarr label")
+
+// maxRebuildFiles caps how many tape files are probed for a TOC. Tapes hold
+// a data file and a TOC per write, so real tapes stay far below this.
+const maxRebuildFiles = 64
+
+// recoveredPoolName is used for tapes whose label names no pool.
+const recoveredPoolName = "Recovered"
+
+// RebuildSet describes one backup set found in a tape's TOC.
+type RebuildSet struct {
+	BackupSetID    int64     `json:"backup_set_id,omitempty"`
+	JobID          int64     `json:"job_id,omitempty"`
+	JobName        string    `json:"job_name"`
+	BackupType     string    `json:"backup_type"`
+	StartTime      time.Time `json:"start_time"`
+	DataFile       int64     `json:"data_file"`
+	FileCount      int64     `json:"file_count"`
+	TotalBytes     int64     `json:"total_bytes"`
+	Encrypted      bool      `json:"encrypted"`
+	SequenceNumber int       `json:"sequence_number,omitempty"`
+	TotalTapes     int       `json:"total_tapes,omitempty"`
+	Existing       bool      `json:"existing"`
+}
+
+// RebuildResult is what a catalog rebuild recovered from one tape.
+type RebuildResult struct {
+	TapeID      int64        `json:"tape_id,omitempty"`
+	Label       string       `json:"label"`
+	UUID        string       `json:"uuid"`
+	Pool        string       `json:"pool"`
+	FormatType  string       `json:"format_type"`
+	TapeCreated bool         `json:"tape_created"`
+	DryRun      bool         `json:"dry_run"`
+	Sets        []RebuildSet `json:"sets"`
+	Notes       []string     `json:"notes,omitempty"`
+}
+
+// tapeManifest is a TOC read from tape together with where each of its
+// backup sets' data starts.
+type tapeManifest struct {
+	tocFile     int64
+	toc         *tape.TapeTOC
+	dataFiles   []int64
+	startBlocks []*int64
+}
+
+// RebuildCatalogFromTape reads the label and every TOC on the tape loaded in
+// driveSvc and records the tape, its backup sets and their catalog entries,
+// for recovering a database that was lost without a backup. Jobs and pools
+// named on tape are matched by name and created when missing; created jobs
+// are disabled placeholders until an operator points them at a source.
+// Sets already catalogued are left untouched, so tapes can be rescanned.
+// With dryRun nothing is written and the result shows what would be.
+func (s *Service) RebuildCatalogFromTape(ctx context.Context, driveSvc *tape.Service, dryRun bool) (*RebuildResult, error) {
+	label, err := driveSvc.ReadTapeLabel(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read tape label: %w", err)
+	}
+	if label == nil || label.Label == "" {
+		return nil, ErrUnlabeledTape
+	}
+
+	result := &RebuildResult{
+		Label:      label.Label,
+		UUID:       label.UUID,
+		Pool:       label.Pool,
+		FormatType: label.FormatType,
+		DryRun:     dryRun,
+		Sets:       []RebuildSet{},
+	}
+	if result.FormatType == "" {
+		result.FormatType = string(models.TapeFormatRaw)
+	}
+	if result.Pool == "" {
+		result.Pool = recoveredPoolName
+	}
+
+	var manifests []tapeManifest
+	hasData := false
+	if result.FormatType == string(models.TapeFormatLTFS) {
+		result.Notes = append(result.Notes, "LTFS tape: backup sets are not read from LTFS volumes, only the tape is recorded")
+		hasData = true
+	} else {
+		manifests, hasData, err = readTapeManifests(ctx, driveSvc)
+		if err != nil {
+			return nil, err
+		}
+		if len(manifests) == 0 && hasData {
+			result.Notes = append(result.Notes, "tape holds data but no readable TOC; it is recorded as full with no backup sets")
+		}
+	}
+
+	if err := s.importTapeManifests(ctx, label, manifests, hasData, result); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// readTapeManifests probes each file on the tape for a TOC. It reports
+// whether the tape holds anything past the label.
+func readTapeManifests(ctx context.Context, driveSvc *tape.Service) ([]tapeManifest, bool, error) {
+	var manifests []tapeManifest
+	hasData := false
+	for fileNum := int64(1); fileNum <= maxRebuildFiles; fileNum++ {
+		if err := ctx.Err(); err != nil {
+			return nil, false, err
+		}
+		// Spacing past the last file mark fails, which ends the scan
+		if err := driveSvc.SeekToFileNumber(ctx, fileNum); err != nil {
+			break
+		}
+		// File 2 only exists when file 1 was closed by a file mark
+		if fileNum >= 2 {
+			hasData = true
+		}
+		toc, err := driveSvc.ReadTOC(ctx)
+		if err != nil {
+			continue
+		}
+		manifests = append(manifests, tapeManifest{tocFile: fileNum, toc: toc})
+	}
+
+	for i := range manifests {
+		m := &manifests[i]
+		for _, set := range m.toc.BackupSets {
+			// A TOC follows the data it describes
+			dataFile := m.tocFile - 1
+			if len(m.toc.BackupSets) > 1 && set.FileNumber > 0 {
+				dataFile = int64(set.FileNumber)
+			}
+			var startBlock *int64
+			if err := driveSvc.SeekToFileNumber(ctx, dataFile); err == nil {
+				if _, block, err := driveSvc.GetTapePosition(ctx); err == nil {
+					startBlock = &block
+				}
+			}
+			m.dataFiles = append(m.dataFiles, dataFile)
+			m.startBlocks = append(m.startBlocks, startBlock)
+		}
+	}
+	return manifests, hasData, nil
+}
+
+// importTapeManifests records the tape and the backup sets from its TOCs
+// in one transaction, filling in result as it goes.
+func (s *Service) importTapeManifests(ctx context.Context, label *tape.TapeLabelData, manifests []tapeManifest, hasData bool, result *RebuildResult) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	poolID, poolCreated, err := rebuildPool(tx, result.Pool)
+	if err != nil {
+		return fmt.Errorf("failed to record pool %s: %w", result.Pool, err)
+	}
+	if poolCreated {
+		result.Notes = append(result.Notes, fmt.Sprintf("created pool %s", result.Pool))
+	}
+
+	var keyID *int64
+	if label.EncryptionKeyFingerprint != "" {
+		var id int64
+		err := tx.QueryRow("SELECT id FROM encryption_keys WHERE key_fingerprint = ? LIMIT 1", label.EncryptionKeyFingerprint).Scan(&id)
+		if err == nil {
+			keyID = &id
+		} else if err == sql.ErrNoRows {
+			result.Notes = append(result.Notes, fmt.Sprintf("encryption key %s is not in the key store; import it before restoring", label.EncryptionKeyFingerprint))
+		} else {
+			return err
+		}
+	}
+
+	tapeID, err := rebuildTape(tx, label, result, poolID, manifests, hasData)
+	if err != nil {
+		return err
+	}
+	result.TapeID = tapeID
+
+	for _, m := range manifests {
+		for i, set := range m.toc.BackupSets {
+			rs := RebuildSet{
+				JobName:        set.JobName,
+				BackupType:     set.BackupType,
+				StartTime:      set.StartTime,
+				DataFile:       m.dataFiles[i],
+				FileCount:      set.FileCount,
+				TotalBytes:     set.TotalBytes,
+				Encrypted:      set.Encrypted,
+				SequenceNumber: m.toc.SequenceNumber,
+				TotalTapes:     m.toc.TotalTapes,
+			}
+			if rs.JobName == "" {
+				rs.JobName = "Recovered " + label.Label
+			}
+			if rs.BackupType != string(models.BackupTypeIncremental) && rs.BackupType != string(models.BackupTypeDifferential) {
+				rs.BackupType = string(models.BackupTypeFull)
+			}
+			if err := rebuildBackupSet(tx, &rs, set, tapeID, poolID, result.FormatType, m.startBlocks[i], keyID); err != nil {
+				return fmt.Errorf("failed to record backup set of %s from file %d: %w", rs.JobName, rs.DataFile, err)
+			}
+			if rs.TotalTapes > 1 && !rs.Existing {
+				result.Notes = append(result.Notes, fmt.Sprintf("%s is tape %d of %d of a spanned backup; scan the other tapes to catalogue the rest", rs.JobName, rs.SequenceNumber, rs.TotalTapes))
+			}
+			result.Sets = append(result.Sets, rs)
+		}
+	}
+
+	if result.DryRun {
+		return nil
+	}
+	return tx.Commit()
+}
+
+// rebuildPool finds a pool by name, creating it when missing
+func rebuildPool(tx *sql.Tx, name string) (int64, bool, error) {
+	var id int64
+	err := tx.QueryRow("SELECT id FROM tape_pools WHERE name = ?", name).Scan(&id)
+	if err == nil {
+		return id, false, nil
+	}
+	if err != sql.ErrNoRows {
+		return 0, false, err
+	}
+	res, err := tx.Exec("INSERT INTO tape_pools (name, description) VALUES (?, ?)", name, "Recreated from tape labels during a catalog rebuild")
+	if err != nil {
+		return 0, false, err
+	}
+	id, err = res.LastInsertId()
+	return id, true, err
+}
+
+// rebuildTape finds the tape by UUID or label, creating it when missing. A
+// different tape already using the label is an error.
+func rebuildTape(tx *sql.Tx, label *tape.TapeLabelData, result *RebuildResult, poolID int64, manifests []tapeManifest, hasData bool) (int64, error) {
+	var id int64
+	var uuid string
+	err := tx.QueryRow(`
+		SELECT id, COALESCE(uuid, '') FROM tapes
+		WHERE (uuid = ? AND ? != '') OR label = ?
+		ORDER BY CASE WHEN uuid = ? THEN 0 ELSE 1 END LIMIT 1
+	`, label.UUID, label.UUID, label.Label, label.UUID).Scan(&id, &uuid)
+	if err == nil {
+		if uuid != "" && label.UUID != "" && uuid != label.UUID {
+			return 0, fmt.Errorf("label %s is already used by tape %d with a different UUID", label.Label, id)
+		}
+		return id, nil
+	}
+	if err != sql.ErrNoRows {
+		return 0, err
+	}
+
+	status := models.TapeStatusBlank
+	if hasData {
+		status = models.TapeStatusFull
+	}
+	var usedBytes int64
+	var lastWritten *time.Time
+	for _, m := range manifests {
+		for _, set := range m.toc.BackupSets {
+			usedBytes += set.TotalBytes
+			if end := set.EndTime; !end.IsZero() && (lastWritten == nil || end.After(*lastWritten)) {
+				lastWritten = &end
+			}
+		}
+	}
+	var labeledAt *time.Time
+	if label.Timestamp > 0 {
+		t := time.Unix(label.Timestamp, 0)
+		labeledAt = &t
+	}
+
+	res, err := tx.Exec(`
+		INSERT INTO tapes (uuid, label, pool_id, status, used_bytes, write_count, last_written_at,
+			format_type, encryption_key_fingerprint, labeled_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`, label.UUID, label.Label, poolID, status, usedBytes, len(manifests), lastWritten,
+		result.FormatType, label.EncryptionKeyFingerprint, labeledAt)
+	if err != nil {
+		return 0, fmt.Errorf("failed to record tape %s: %w", label.Label, err)
+	}
+	result.TapeCreated = true
+	return res.LastInsertId()
+}
+
+// rebuildBackupSet records one TOC backup set and its catalog. The job is
+// matched by name and created as a disabled placeholder when missing.
+func rebuildBackupSet(tx *sql.Tx, rs *RebuildSet, set tape.TOCBackupSet, tapeID, poolID int64, formatType string, startBlock *int64, keyID *int64) error {
+	err := tx.QueryRow("SELECT id FROM backup_jobs WHERE name = ? ORDER BY id LIMIT 1", rs.JobName).Scan(&rs.JobID)
+	if err == sql.ErrNoRows {
+		res, err := tx.Exec(`
+			INSERT INTO backup_sources (name, source_type, path, enabled)
+			VALUES (?, ?, '', 0)
+		`, rs.JobName, models.SourceTypeLocal)
+		if err != nil {
+			return err
+		}
+		sourceID, _ := res.LastInsertId()
+		res, err = tx.Exec(`
+			INSERT INTO backup_jobs (name, source_id, pool_id, backup_type, schedule_cron, retention_days, enabled)
+			VALUES (?, ?, ?, ?, '', 0, 0)
+		`, rs.JobName, sourceID, poolID, rs.BackupType)
+		if err != nil {
+			return err
+		}
+		rs.JobID, _ = res.LastInsertId()
+	} else if err != nil {
+		return err
+	}
+
+	err = tx.QueryRow("SELECT id FROM backup_sets WHERE tape_id = ? AND job_id = ? AND start_time = ?",
+		tapeID, rs.JobID, set.StartTime).Scan(&rs.BackupSetID)
+	if err == nil {
+		rs.Existing = true
+		return nil
+	}
+	if err != sql.ErrNoRows {
+		return err
+	}
+
+	var encFormat models.EncryptionFormat
+	var encKDF, encSalt, encIV string
+	var encChunkSize int
+	if m := set.Encryption; m != nil {
+		encFormat, encKDF, encSalt, encIV, encChunkSize = m.Format, m.KDFJSON(), m.Salt, m.IV, m.ChunkSize
+	}
+	var encKeyID, hwKeyID *int64
+	if set.Encrypted {
+		encKeyID = keyID
+	}
+	if set.HwEncrypted {
+		hwKeyID = keyID
+	}
+	compressionType := set.CompressionType
+	if compressionType == "" {
+		compressionType = string(models.CompressionNone)
+	}
+	var endTime *time.Time
+	if !set.EndTime.IsZero() {
+		endTime = &set.EndTime
+	}
+
+	res, err := tx.Exec(`
+		INSERT INTO backup_sets (job_id, tape_id, backup_type, format_type, start_time, end_time, status,
+			file_count, total_bytes, start_block,
+			encrypted, encryption_key_id, encryption_format, encryption_kdf, encryption_salt,
+			encryption_iv, encryption_chunk_size, hw_encrypted, hw_encryption_key_id,
+			compressed, compression_type, stream_stages)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`, rs.JobID, tapeID, rs.BackupType, formatType, set.StartTime, endTime, models.BackupSetStatusCompleted,
+		set.FileCount, set.TotalBytes, startBlock,
+		set.Encrypted, encKeyID, encFormat, encKDF, encSalt,
+		encIV, encChunkSize, set.HwEncrypted, hwKeyID,
+		set.Compressed, compressionType, stages.Marshal(set.StreamStages))
+	if err != nil {
+		return err
+	}
+	rs.BackupSetID, _ = res.LastInsertId()
+
+	stmt, err := tx.Prepare(`
+		INSERT OR IGNORE INTO catalog_entries (backup_set_id, file_path, file_size, file_mode, mod_time, checksum,
+			extension, content_class)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+	`)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+	for _, f := range set.Files {
+		var modTime *time.Time
+		if t, err := time.Parse(time.RFC3339, f.ModTime); err == nil {
+			modTime = &t
+		}
+		ext, class := classifyPath(f.Path)
+		if _, err := stmt.Exec(rs.BackupSetID, f.Path, f.Size, f.Mode, modTime, f.Checksum, ext, class); err != nil {
+			return err
+		}
+	}
+	return nil
+}
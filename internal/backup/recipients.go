@@ -0,0 +1,31 @@
+package backup
+
+import (
+	"github.com/RoseOO/TapeBackarr/internal/notifications"
+)
+
+// JobRecipients resolves where a job's notifications go: the job's own chat
+// and addresses plus the contact details its owner stored in their
+// preferences, in the owner's language. A job without any recipients
+// notifies the global channels only.
+func (s *Service) JobRecipients(jobID int64) (notifications.JobRecipients, error) {
+	var emails, chatID, ownerEmail, ownerChat, ownerLang string
+	var includeGlobal bool
+	err := s.db.QueryRow(`
+		SELECT j.notify_emails, j.notify_telegram_chat_id, j.notify_global,
+		       COALESCE(p.notify_email, ''), COALESCE(p.notify_telegram_chat_id, ''), COALESCE(p.language, '')
+		FROM backup_jobs j
+		LEFT JOIN user_preferences p ON p.user_id = j.owner_id
+		WHERE j.id = ?
+	`, jobID).Scan(&emails, &chatID, &includeGlobal, &ownerEmail, &ownerChat, &ownerLang)
+	if err != nil {
+		return notifications.JobRecipients{}, err
+	}
+
+	return notifications.JobRecipients{
+		TelegramChatIDs: notifications.SplitAddresses(chatID + "," + ownerChat),
+		Emails:          notifications.SplitAddresses(emails + "," + ownerEmail),
+		Language:        ownerLang,
+		IncludeGlobal:   includeGlobal,
+	}, nil
+}
@@ -0,0 +1,126 @@
+package backup
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// ErrTapeReserved is returned when another job holds a tape's reservation
+var ErrTapeReserved = errors.New("tape is reserved by another job")
+
+const (
+	// tapeReservationTTL is how long a reservation lasts without renewal, so
+	// a crashed run frees its tape after at most this long
+	tapeReservationTTL = 15 * time.Minute
+	// tapeReservationRenewal is how often a running job renews its
+	// reservations
+	tapeReservationRenewal = 5 * time.Minute
+)
+
+// TapeReservation is a tape a job has selected for writing
+type TapeReservation struct {
+	TapeID     int64     `json:"tape_id"`
+	TapeLabel  string    `json:"tape_label"`
+	PoolID     int64     `json:"pool_id"`
+	JobID      int64     `json:"job_id"`
+	JobName    string    `json:"job_name"`
+	ReservedAt time.Time `json:"reserved_at"`
+	ExpiresAt  time.Time `json:"expires_at"`
+}
+
+// reservationExpiry is the SQLite modifier setting a reservation's expiry
+func reservationExpiry() string {
+	return fmt.Sprintf("+%d seconds", int(tapeReservationTTL/time.Second))
+}
+
+// ReserveTape reserves a tape for a job so no other job selects it while
+// the job writes. Reserving a tape the job already holds renews it. A tape
+// held by another job fails with ErrTapeReserved until that job releases
+// it or its reservation expires.
+func (s *Service) ReserveTape(tapeID, jobID int64) error {
+	if _, err := s.db.Exec("DELETE FROM tape_reservations WHERE expires_at <= datetime('now')"); err != nil {
+		return fmt.Errorf("failed to expire tape reservations: %w", err)
+	}
+	result, err := s.db.Exec(`
+		INSERT INTO tape_reservations (tape_id, job_id, reserved_at, expires_at)
+		VALUES (?, ?, CURRENT_TIMESTAMP, datetime('now', ?))
+		ON CONFLICT(tape_id) DO UPDATE SET expires_at = excluded.expires_at
+		WHERE tape_reservations.job_id = excluded.job_id
+	`, tapeID, jobID, reservationExpiry())
+	if err != nil {
+		return fmt.Errorf("failed to reserve tape: %w", err)
+	}
+	if n, _ := result.RowsAffected(); n > 0 {
+		return nil
+	}
+
+	var tapeLabel, jobName string
+	s.db.QueryRow(`
+		SELECT COALESCE(t.label, ''), COALESCE(j.name, '')
+		FROM tape_reservations r
+		LEFT JOIN tapes t ON r.tape_id = t.id
+		LEFT JOIN backup_jobs j ON r.job_id = j.id
+		WHERE r.tape_id = ?
+	`, tapeID).Scan(&tapeLabel, &jobName)
+	return fmt.Errorf("%w: tape %s is being written by job %s", ErrTapeReserved, tapeLabel, jobName)
+}
+
+// ReleaseTape drops a job's reservation of a tape
+func (s *Service) ReleaseTape(tapeID, jobID int64) {
+	s.db.Exec("DELETE FROM tape_reservations WHERE tape_id = ? AND job_id = ?", tapeID, jobID)
+}
+
+// ListTapeReservations returns the reservations that have not expired,
+// limited to one pool when poolID is not zero
+func (s *Service) ListTapeReservations(poolID int64) ([]TapeReservation, error) {
+	rows, err := s.db.Query(`
+		SELECT r.tape_id, t.label, COALESCE(t.pool_id, 0), r.job_id, COALESCE(j.name, ''), r.reserved_at, r.expires_at
+		FROM tape_reservations r
+		JOIN tapes t ON r.tape_id = t.id
+		LEFT JOIN backup_jobs j ON r.job_id = j.id
+		WHERE r.expires_at > datetime('now') AND (? = 0 OR t.pool_id = ?)
+		ORDER BY r.reserved_at
+	`, poolID, poolID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	reservations := []TapeReservation{}
+	for rows.Next() {
+		var r TapeReservation
+		if err := rows.Scan(&r.TapeID, &r.TapeLabel, &r.PoolID, &r.JobID, &r.JobName, &r.ReservedAt, &r.ExpiresAt); err != nil {
+			return nil, err
+		}
+		reservations = append(reservations, r)
+	}
+	return reservations, rows.Err()
+}
+
+// holdTape reserves a tape for the length of a run. The returned function
+// stops renewing and releases every tape the job reserved, including those
+// it spanned onto.
+func (s *Service) holdTape(tapeID, jobID int64) (func(), error) {
+	if err := s.ReserveTape(tapeID, jobID); err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		ticker := time.NewTicker(tapeReservationRenewal)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				s.db.Exec("UPDATE tape_reservations SET expires_at = datetime('now', ?) WHERE job_id = ?", reservationExpiry(), jobID)
+			}
+		}
+	}()
+	return func() {
+		cancel()
+		s.db.Exec("DELETE FROM tape_reservations WHERE job_id = ?", jobID)
+	}, nil
+}
@@ -0,0 +1,92 @@
+package backup
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/RoseOO/TapeBackarr/internal/database"
+	"github.com/RoseOO/TapeBackarr/internal/logging"
+	"github.com/RoseOO/TapeBackarr/internal/models"
+	"github.com/RoseOO/TapeBackarr/internal/tape"
+)
+
+func TestTapeReservations(t *testing.T) {
+	ctx := context.Background()
+	db, err := database.New(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("failed to create database: %v", err)
+	}
+	defer db.Close()
+	if err := db.Migrate(); err != nil {
+		t.Fatalf("failed to migrate database: %v", err)
+	}
+
+	srcDir := t.TempDir()
+	os.WriteFile(filepath.Join(srcDir, "a.txt"), []byte("data"), 0644)
+	devicePath := "file://" + t.TempDir()
+	drive := tape.NewServiceForDevice(devicePath, 65536)
+	if err := drive.WriteTapeLabel(ctx, "RS0001", "uuid-rs1", "shared"); err != nil {
+		t.Fatalf("WriteTapeLabel: %v", err)
+	}
+	db.Exec("INSERT INTO tape_pools (name) VALUES ('shared')")
+	db.Exec("INSERT INTO tapes (uuid, barcode, label, pool_id, status, capacity_bytes, used_bytes) VALUES ('uuid-rs1', 'RS0001', 'RS0001', 1, 'active', 10000000, 0)")
+	db.Exec("INSERT INTO tapes (uuid, barcode, label, pool_id, status, capacity_bytes, used_bytes) VALUES ('uuid-rs2', 'RS0002', 'RS0002', 1, 'blank', 10000000, 0)")
+	db.Exec("INSERT INTO tape_drives (device_path, display_name, status, current_tape_id) VALUES (?, 'vtape', 'ready', 1)", devicePath)
+	db.Exec("INSERT INTO backup_sources (name, source_type, path) VALUES ('docs', 'local', ?)", srcDir)
+	db.Exec("INSERT INTO backup_jobs (name, source_id, pool_id, backup_type, schedule_cron, retention_days) VALUES ('docs', 1, 1, 'full', '', 30)")
+	db.Exec("INSERT INTO backup_jobs (name, source_id, pool_id, backup_type, schedule_cron, retention_days) VALUES ('mail', 1, 1, 'full', '', 30)")
+
+	logger, _ := logging.NewLogger("error", "text", "")
+	svc := NewService(db, drive, logger, 65536, 0, 0)
+
+	// A job may renew its own reservation; another job is turned away
+	if err := svc.ReserveTape(1, 2); err != nil {
+		t.Fatalf("ReserveTape: %v", err)
+	}
+	if err := svc.ReserveTape(1, 2); err != nil {
+		t.Fatalf("renewing a reservation failed: %v", err)
+	}
+	if err := svc.ReserveTape(1, 1); !errors.Is(err, ErrTapeReserved) {
+		t.Fatalf("expected ErrTapeReserved, got %v", err)
+	}
+	reservations, err := svc.ListTapeReservations(1)
+	if err != nil || len(reservations) != 1 || reservations[0].JobName != "mail" || reservations[0].TapeLabel != "RS0001" {
+		t.Fatalf("unexpected reservations %+v (err %v)", reservations, err)
+	}
+
+	// Spanning allocation skips the tape the other job holds and reserves
+	// the one it picks
+	next, err := svc.allocateNextTape(ctx, 1, 1, nil)
+	if err != nil || next != 2 {
+		t.Fatalf("expected tape 2 to be allocated, got %d (err %v)", next, err)
+	}
+	if err := svc.ReserveTape(2, 2); !errors.Is(err, ErrTapeReserved) {
+		t.Fatalf("allocated tape was not reserved: %v", err)
+	}
+	svc.ReleaseTape(2, 1)
+
+	// A run cannot write a tape another job holds
+	job := &models.BackupJob{ID: 1, Name: "docs", PoolID: 1}
+	source := &models.BackupSource{ID: 1, Name: "docs", Path: srcDir}
+	if _, err := svc.RunBackup(ctx, job, source, 1, models.BackupTypeFull); !errors.Is(err, ErrTapeReserved) {
+		t.Fatalf("expected the run to be refused, got %v", err)
+	}
+
+	// An expired reservation no longer holds the tape, and a finished run
+	// releases its own
+	db.Exec("UPDATE tape_reservations SET expires_at = datetime('now', '-1 minute') WHERE tape_id = 1")
+	if reservations, _ := svc.ListTapeReservations(0); len(reservations) != 0 {
+		t.Fatalf("expired reservation still listed: %+v", reservations)
+	}
+	if _, err := svc.RunBackup(ctx, job, source, 1, models.BackupTypeFull); err != nil {
+		t.Fatalf("RunBackup: %v", err)
+	}
+	var held int
+	db.QueryRow("SELECT COUNT(*) FROM tape_reservations").Scan(&held)
+	if held != 0 {
+		t.Errorf("expected no reservations after the run, got %d", held)
+	}
+}
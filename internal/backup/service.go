@@ -19,10 +19,14 @@ import (
 	"sync/atomic"
 	"time"
 
+	"github.com/RoseOO/TapeBackarr/internal/credentials"
 	"github.com/RoseOO/TapeBackarr/internal/database"
 	"github.com/RoseOO/TapeBackarr/internal/encryption"
+	"github.com/RoseOO/TapeBackarr/internal/library"
 	"github.com/RoseOO/TapeBackarr/internal/logging"
 	"github.com/RoseOO/TapeBackarr/internal/models"
+	"github.com/RoseOO/TapeBackarr/internal/scratch"
+	"github.com/RoseOO/TapeBackarr/internal/stages"
 	"github.com/RoseOO/TapeBackarr/internal/tape"
 )
 
@@ -37,6 +41,20 @@ type FileInfo struct {
 	Mode    int       `json:"mode"`
 	ModTime time.Time `json:"mod_time"`
 	Hash    string    `json:"hash,omitempty"`
+	// ChangeTime is the file's ctime in Unix nanoseconds, 0 when unknown
+	ChangeTime int64 `json:"change_time,omitempty"`
+	// FollowLink is set when Path is a symlink whose target is backed up in
+	// its place (SymlinkFollow policy).
+	FollowLink bool `json:"follow_link,omitempty"`
+	// UID and GID are nil when the platform does not report ownership
+	UID   *int   `json:"uid,omitempty"`
+	GID   *int   `json:"gid,omitempty"`
+	Owner string `json:"owner,omitempty"`
+	Group string `json:"group,omitempty"`
+	// FileType is "file" or "symlink"; LinkTarget is set on stored symlinks
+	FileType   string `json:"file_type,omitempty"`
+	LinkTarget string `json:"link_target,omitempty"`
+	HasXattrs  bool   `json:"has_xattrs,omitempty"`
 }
 
 // JobProgress tracks the progress of a running backup job
@@ -116,8 +134,10 @@ func (st *speedTracker) Speed() float64 {
 	return float64(last.bytes-first.bytes) / dt
 }
 
-// EventCallback is called when backup progress events occur (for SSE/console)
-type EventCallback func(eventType, category, title, message string)
+// EventCallback is called when backup progress events occur (for SSE/console).
+// key names an event in the i18n catalog and args are its format arguments,
+// so the receiver can render the event in each recipient's language.
+type EventCallback func(eventType, category, key string, args ...interface{})
 
 // TapeChangeCallback is called when a tape change is required during multi-tape spanning.
 // It allows the caller to send notifications (e.g. Telegram) with the exact next tape label.
@@ -341,6 +361,16 @@ type Service struct {
 	cancelFuncs        map[int64]context.CancelFunc
 	pauseFlags         map[int64]*int32
 	resumeFiles        map[int64][]string // files already processed for resume
+	uploads            map[string]*upload // open and recently finished uploads
+	driveMu            sync.Mutex
+	drives             map[string]*driveQueue // drives held by running jobs, by device path
+	scratch            *scratch.Dir
+	library            *library.Loader // fetches tapes from tape libraries, if set
+	mediaCheck         bool            // check tape contents against the catalog before writing
+	writeRetry         tape.WriteRetryPolicy
+	credentials        atomic.Pointer[credentials.Store] // logins of NDMP and SMB sources, if set; replaced by replication
+	mountMu            sync.Mutex
+	mounts             map[int64]*sourceMount // shares of sources mounted for running jobs, by source ID
 	EventCallback      EventCallback
 	TapeChangeCallback TapeChangeCallback
 	WrongTapeCallback  WrongTapeCallback
@@ -374,6 +404,29 @@ func NewService(db *database.DB, tapeService *tape.Service, logger *logging.Logg
 	}
 }
 
+// SetScratchDir sets the directory used for temporary tar file lists.
+func (s *Service) SetScratchDir(d *scratch.Dir) {
+	s.scratch = d
+}
+
+// SetMediaCheck turns the pre-run media check on or off. With it on, the
+// contents of a raw tape are compared with the catalog before each write.
+func (s *Service) SetMediaCheck(enabled bool) {
+	s.mediaCheck = enabled
+}
+
+// SetWriteRetries sets how many times a block that fails to write to a
+// physical drive with a transient error is retried before the backup fails.
+// 0 fails on the first error.
+func (s *Service) SetWriteRetries(retries int) {
+	s.writeRetry = tape.WriteRetryPolicy{Retries: retries, Delay: tape.DefaultWriteRetryDelay}
+}
+
+// SetCredentials sets the store NDMP and SMB sources take their login from
+func (s *Service) SetCredentials(store *credentials.Store) {
+	s.credentials.Store(store)
+}
+
 // GetActiveJobs returns all currently running backup jobs with progress
 func (s *Service) GetActiveJobs() []*JobProgress {
 	s.mu.Lock()
@@ -385,6 +438,14 @@ func (s *Service) GetActiveJobs() []*JobProgress {
 	return jobs
 }
 
+// IsJobActive reports whether the given job currently has a run in progress
+func (s *Service) IsJobActive(jobID int64) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, ok := s.activeJobs[jobID]
+	return ok
+}
+
 // InjectTestJob adds a job directly into activeJobs for testing purposes.
 func (s *Service) InjectTestJob(jobID int64, p *JobProgress) {
 	s.mu.Lock()
@@ -417,6 +478,23 @@ func (s *Service) CancelJob(jobID int64) bool {
 	return false
 }
 
+// CheckpointJob records a running job's progress as resumable, as PauseJob
+// does, without pausing it. It is used before a run is cancelled by a
+// shutdown so the run can be resumed afterwards.
+func (s *Service) CheckpointJob(jobID int64) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	p, ok := s.activeJobs[jobID]
+	if !ok {
+		return false
+	}
+	p.Message = "Job checkpointed for shutdown"
+	p.UpdatedAt = time.Now()
+	p.LogLines = append(p.LogLines, fmt.Sprintf("[%s] Job checkpointed for shutdown, it can be resumed after the restart", time.Now().Format("15:04:05")))
+	s.saveJobExecutionState(jobID, p)
+	return true
+}
+
 // PauseJob pauses a running backup job and persists state to database for restart resilience
 func (s *Service) PauseJob(jobID int64) bool {
 	s.mu.Lock()
@@ -455,9 +533,9 @@ func (s *Service) ResumeJob(jobID int64) bool {
 }
 
 // emitEvent sends an event to the EventCallback if configured
-func (s *Service) emitEvent(eventType, category, title, message string) {
+func (s *Service) emitEvent(eventType, category, key string, args ...interface{}) {
 	if s.EventCallback != nil {
-		s.EventCallback(eventType, category, title, message)
+		s.EventCallback(eventType, category, key, args...)
 	}
 }
 
@@ -482,12 +560,51 @@ func (s *Service) updateProgress(jobID int64, phase, message string) {
 	} else if phase == "completed" {
 		eventType = "success"
 	}
-	s.emitEvent(eventType, "backup", fmt.Sprintf("Backup: %s", phase), message)
+	s.emitEvent(eventType, "backup", "backup_progress", phase, message)
 }
 
 // ScanSource scans a backup source and returns file information using concurrent directory traversal.
 // An optional progressCb is invoked periodically to report scanning progress.
 func (s *Service) ScanSource(ctx context.Context, source *models.BackupSource, progressCb ...ScanProgressFunc) ([]FileInfo, error) {
+	files, _, err := s.ScanSourceWithReport(ctx, source, progressCb...)
+	return files, err
+}
+
+// ScanSourceWithReport behaves like ScanSource and additionally returns a
+// report of every path that was skipped and why.
+func (s *Service) ScanSourceWithReport(ctx context.Context, source *models.BackupSource, progressCb ...ScanProgressFunc) ([]FileInfo, *SkipReport, error) {
+	var cb ScanProgressFunc
+	if len(progressCb) > 0 {
+		cb = progressCb[0]
+	}
+	return s.scanSource(ctx, source, cb, nil)
+}
+
+// scanSource implements ScanSourceWithReport. When onFiles is set it is
+// handed the files of each directory as soon as the directory is read, from
+// the scan's worker goroutines.
+func (s *Service) scanSource(ctx context.Context, source *models.BackupSource, cb ScanProgressFunc, onFiles func([]FileInfo)) ([]FileInfo, *SkipReport, error) {
+	report := NewSkipReport()
+
+	symlinkPolicy := source.SymlinkPolicy
+	if symlinkPolicy == "" {
+		symlinkPolicy = models.SymlinkStore
+	}
+
+	// With the follow policy, directory links are traversed. Each followed
+	// target is recorded by its resolved path so links pointing back into the
+	// source, or at a target that was already followed, cannot loop.
+	var realRoot string
+	var followedMu sync.Mutex
+	followedDirs := make(map[string]struct{})
+	if symlinkPolicy == models.SymlinkFollow {
+		if r, err := filepath.EvalSymlinks(source.Path); err == nil {
+			realRoot = r
+		} else {
+			realRoot = filepath.Clean(source.Path)
+		}
+	}
+
 	// Parse include/exclude patterns
 	var includePatterns, excludePatterns []string
 	if source.IncludePatterns != "" {
@@ -545,10 +662,6 @@ func (s *Service) ScanSource(ctx context.Context, source *models.BackupSource, p
 	var lastProgressCb int64 // unix nanos, throttle to once per second
 
 	// emitProgress fires the optional progress callback at most once per second.
-	var cb ScanProgressFunc
-	if len(progressCb) > 0 {
-		cb = progressCb[0]
-	}
 	emitProgress := func() {
 		if cb == nil {
 			return
@@ -590,28 +703,29 @@ func (s *Service) ScanSource(ctx context.Context, source *models.BackupSource, p
 		return false
 	}
 
-	// matchFile checks if a file path matches the include/exclude patterns.
+	// matchFile checks if a file path matches the include/exclude patterns
+	// and returns the skip reason, or "" when the file should be backed up.
 	// Uses fast exact-match maps before falling back to glob matching.
-	matchFile := func(path string) bool {
+	matchFile := func(path string) SkipReason {
 		baseName := filepath.Base(path)
 
 		// Fast exact-match exclude check
 		if _, ok := excludeExact[baseName]; ok {
-			return false
+			return SkipExcluded
 		}
 
 		// Glob exclude check (only if glob patterns exist)
 		if len(excludeGlobs) > 0 {
 			relPath, _ := filepath.Rel(source.Path, path)
 			if _, ok := excludeExact[relPath]; ok {
-				return false
+				return SkipExcluded
 			}
 			for _, pattern := range excludeGlobs {
 				if matched, _ := filepath.Match(pattern, relPath); matched {
-					return false
+					return SkipExcluded
 				}
 				if matched, _ := filepath.Match(pattern, baseName); matched {
-					return false
+					return SkipExcluded
 				}
 			}
 		}
@@ -620,26 +734,26 @@ func (s *Service) ScanSource(ctx context.Context, source *models.BackupSource, p
 		if len(includePatterns) > 0 {
 			// Fast exact-match include check
 			if _, ok := includeExact[baseName]; ok {
-				return true
+				return ""
 			}
 			if len(includeGlobs) > 0 {
 				relPath, _ := filepath.Rel(source.Path, path)
 				if _, ok := includeExact[relPath]; ok {
-					return true
+					return ""
 				}
 				for _, pattern := range includeGlobs {
 					if matched, _ := filepath.Match(pattern, relPath); matched {
-						return true
+						return ""
 					}
 					if matched, _ := filepath.Match(pattern, baseName); matched {
-						return true
+						return ""
 					}
 				}
 			}
-			return false
+			return SkipNotIncluded
 		}
 
-		return true
+		return ""
 	}
 
 	// readDir reads directory entries without sorting (avoids O(n log n)
@@ -672,6 +786,7 @@ func (s *Service) ScanSource(ctx context.Context, source *models.BackupSource, p
 					"error": err.Error(),
 				})
 			}
+			report.AddError(dirPath, err)
 			return
 		}
 
@@ -681,8 +796,77 @@ func (s *Service) ScanSource(ctx context.Context, source *models.BackupSource, p
 		for _, entry := range entries {
 			path := filepath.Join(dirPath, entry.Name())
 
+			if entry.Type()&os.ModeSymlink != 0 {
+				switch symlinkPolicy {
+				case models.SymlinkSkip:
+					report.Add(path, SkipSymlink, "symlink policy is skip")
+					continue
+				case models.SymlinkFollow:
+					target, err := os.Stat(path)
+					if err != nil {
+						if os.IsNotExist(err) {
+							report.Add(path, SkipDanglingSymlink, err.Error())
+						} else {
+							report.AddError(path, err)
+						}
+						continue
+					}
+					if target.IsDir() {
+						if shouldExcludeDir(path) {
+							report.Add(path, SkipExcluded, "directory matched an exclude pattern")
+							continue
+						}
+						realTarget, err := filepath.EvalSymlinks(path)
+						if err != nil {
+							report.AddError(path, err)
+							continue
+						}
+						if realTarget == realRoot || strings.HasPrefix(realTarget, realRoot+string(filepath.Separator)) {
+							report.Add(path, SkipSymlinkLoop, "target "+realTarget+" is already inside the source")
+							continue
+						}
+						followedMu.Lock()
+						_, seen := followedDirs[realTarget]
+						followedDirs[realTarget] = struct{}{}
+						followedMu.Unlock()
+						if seen {
+							report.Add(path, SkipSymlinkLoop, "target "+realTarget+" was already followed")
+							continue
+						}
+						dirWg.Add(1)
+						select {
+						case dirs <- path:
+						default:
+							processDir(path)
+						}
+						continue
+					}
+					if reason := matchFile(path); reason != "" {
+						report.Add(path, reason, "")
+						continue
+					}
+					if !target.Mode().IsRegular() {
+						report.Add(path, SkipSpecialFile, target.Mode().Type().String())
+						continue
+					}
+					fi := FileInfo{
+						Path:       path,
+						Size:       target.Size(),
+						Mode:       int(target.Mode()),
+						ModTime:    target.ModTime(),
+						ChangeTime: changeTime(target),
+						FollowLink: true,
+					}
+					describeFile(&fi, target)
+					localFiles = append(localFiles, fi)
+					continue
+				}
+				// SymlinkStore: fall through and archive the link itself.
+			}
+
 			if entry.IsDir() {
 				if shouldExcludeDir(path) {
+					report.Add(path, SkipExcluded, "directory matched an exclude pattern")
 					continue
 				}
 				dirWg.Add(1)
@@ -696,21 +880,31 @@ func (s *Service) ScanSource(ctx context.Context, source *models.BackupSource, p
 				continue
 			}
 
-			if !matchFile(path) {
+			if reason := matchFile(path); reason != "" {
+				report.Add(path, reason, "")
+				continue
+			}
+
+			if isSpecialFile(entry.Type()) {
+				report.Add(path, SkipSpecialFile, entry.Type().String())
 				continue
 			}
 
 			info, err := entry.Info()
 			if err != nil {
+				report.AddError(path, err)
 				continue
 			}
 
-			localFiles = append(localFiles, FileInfo{
-				Path:    path,
-				Size:    info.Size(),
-				Mode:    int(info.Mode()),
-				ModTime: info.ModTime(),
-			})
+			fi := FileInfo{
+				Path:       path,
+				Size:       info.Size(),
+				Mode:       int(info.Mode()),
+				ModTime:    info.ModTime(),
+				ChangeTime: changeTime(info),
+			}
+			describeFile(&fi, info)
+			localFiles = append(localFiles, fi)
 		}
 
 		if len(localFiles) > 0 {
@@ -724,6 +918,9 @@ func (s *Service) ScanSource(ctx context.Context, source *models.BackupSource, p
 			filesMu.Lock()
 			files = append(files, localFiles...)
 			filesMu.Unlock()
+			if onFiles != nil {
+				onFiles(localFiles)
+			}
 		}
 
 		// Always emit progress after each directory so the UI stays up to
@@ -759,7 +956,7 @@ func (s *Service) ScanSource(ctx context.Context, source *models.BackupSource, p
 		cb(atomic.LoadInt64(&filesFound), atomic.LoadInt64(&dirsScanned), atomic.LoadInt64(&bytesFound))
 	}
 
-	return files, ctx.Err()
+	return files, report, ctx.Err()
 }
 
 // CompareWithSnapshot compares current files with a previous snapshot for incremental backup
@@ -773,49 +970,100 @@ func (s *Service) CompareWithSnapshot(ctx context.Context, currentFiles []FileIn
 		return nil, fmt.Errorf("failed to parse snapshot: %w", err)
 	}
 
-	// Create a map of previous files
-	prevMap := make(map[string]FileInfo)
-	for _, f := range previousFiles {
-		prevMap[f.Path] = f
-	}
+	return changedSince(currentFiles, previousFiles), nil
+}
 
-	// Find changed files
-	var changedFiles []FileInfo
-	for _, current := range currentFiles {
-		prev, exists := prevMap[current.Path]
-		if !exists {
-			// New file
-			changedFiles = append(changedFiles, current)
-		} else if current.ModTime.After(prev.ModTime) || current.Size != prev.Size {
-			// Modified file
-			changedFiles = append(changedFiles, current)
+// hasFollowedLinks reports whether any file is a symlink whose target should
+// be archived in its place, in which case tar must dereference links.
+func hasFollowedLinks(files []FileInfo) bool {
+	for _, f := range files {
+		if f.FollowLink {
+			return true
 		}
 	}
-
-	return changedFiles, nil
+	return false
 }
 
-// StreamToTape streams files directly to tape using tar
-func (s *Service) StreamToTape(ctx context.Context, sourcePath string, files []FileInfo, devicePath string, progressCb func(bytesWritten int64), pauseFlag *int32) (int64, error) {
-	if len(files) == 0 {
-		return 0, nil
-	}
+// tarFileList is the list of files tar archives (-T). It is written to a
+// scratch file up front, or fed to tar's stdin while a pipelined backup is
+// still scanning the source.
+type tarFileList struct {
+	path        string
+	stdin       io.Reader
+	dereference bool
+	sourcePath  string
+	// checksums, when set, receives the SHA-256 of each file hashed from
+	// tar's output as it is streamed, keyed by absolute path
+	checksums *sync.Map
+	// offsets, when set, receives where each file's header starts in the
+	// stream, keyed by absolute path
+	offsets *sync.Map
+	hasher  *streamHasher
+}
 
-	// Create a file list for tar
-	fileListPath := fmt.Sprintf("/tmp/tapebackarr-filelist-%d.txt", time.Now().UnixNano())
-	fileList, err := os.Create(fileListPath)
+// writeTarFileList writes the paths of files, relative to sourcePath, to a
+// scratch file for tar
+func (s *Service) writeTarFileList(sourcePath string, files []FileInfo) (*tarFileList, error) {
+	fileList, err := s.scratch.CreateTemp("filelist-*.txt")
 	if err != nil {
-		return 0, fmt.Errorf("failed to create file list: %w", err)
+		return nil, fmt.Errorf("failed to create file list: %w", err)
 	}
-	defer os.Remove(fileListPath)
-
 	for _, f := range files {
-		// Write relative path to file list
 		relPath, _ := filepath.Rel(sourcePath, f.Path)
 		fmt.Fprintln(fileList, relPath)
 	}
 	fileList.Close()
+	return &tarFileList{path: fileList.Name(), dereference: hasFollowedLinks(files), sourcePath: sourcePath}, nil
+}
+
+// args returns the tar arguments that read the list
+func (l *tarFileList) args() []string {
+	args := []string{"-T", l.path}
+	if l.dereference {
+		args = append(args, "--dereference")
+	}
+	return args
+}
+
+// hashStream returns tar's output r, hashing the files in it on the way
+// when the list records checksums
+func (l *tarFileList) hashStream(r io.Reader) io.Reader {
+	if l.checksums == nil {
+		return r
+	}
+	l.hasher = newStreamHasher(l.sourcePath, l.checksums, l.offsets)
+	return l.hasher.wrap(r)
+}
+
+// Close removes a list written to a scratch file, or closes the read end of
+// a fed list so its feeder is not left blocked when tar has exited. It waits
+// for the files streamed to be hashed.
+func (l *tarFileList) Close() {
+	if l.hasher != nil {
+		l.hasher.close()
+	}
+	if c, ok := l.stdin.(io.Closer); ok {
+		c.Close()
+		return
+	}
+	os.Remove(l.path)
+}
+
+// StreamToTape streams files directly to tape using tar
+func (s *Service) StreamToTape(ctx context.Context, sourcePath string, files []FileInfo, devicePath string, progressCb func(bytesWritten int64), pauseFlag *int32) (int64, error) {
+	if len(files) == 0 {
+		return 0, nil
+	}
+	list, err := s.writeTarFileList(sourcePath, files)
+	if err != nil {
+		return 0, err
+	}
+	defer list.Close()
+	return s.streamTarList(ctx, sourcePath, list, devicePath, progressCb, pauseFlag)
+}
 
+// streamTarList streams the files of a tar file list directly to tape
+func (s *Service) streamTarList(ctx context.Context, sourcePath string, list *tarFileList, devicePath string, progressCb func(bytesWritten int64), pauseFlag *int32) (int64, error) {
 	// Build tar command with streaming to tape
 	// Using mbuffer for buffering if available, otherwise direct
 	tarArgs := []string{
@@ -825,16 +1073,24 @@ func (s *Service) StreamToTape(ctx context.Context, sourcePath string, files []F
 		// This ensures tar and mbuffer use the same block size
 		"-b", fmt.Sprintf("%d", s.blockSize/512),
 		"-C", sourcePath, // Change to source directory
-		"-T", fileListPath, // Read files from list
 	}
+	tarArgs = append(tarArgs, list.args()...) // Read files from list
 
 	var cmd *exec.Cmd
 
+	// Retried writes need the stream in process, where the failed block is
+	// still at hand; the read-ahead relay keeps the drive streaming instead
+	// of mbuffer
+	if !tape.IsPhysicalDevice(devicePath) || s.writeRetry.Retries > 0 {
+		return s.streamTarToBackend(ctx, tarArgs, list, sourcePath, devicePath, progressCb, pauseFlag)
+	}
+
 	// Check if mbuffer is available
 	_, mbufferErr := exec.LookPath("mbuffer")
 	if mbufferErr == nil {
 		// Use mbuffer for better streaming performance
 		tarCmd := exec.CommandContext(ctx, "tar", tarArgs...)
+		tarCmd.Stdin = list.stdin
 		// mbuffer -s flag expects block size in bytes, matching tar's effective block size
 		// Example: blockSize=1048576 → -s 1048576 → 1048576 bytes (1MB optimal for LTO)
 		mbufferCmd := exec.CommandContext(ctx, "mbuffer", "-s", fmt.Sprintf("%d", s.blockSize), "-m", fmt.Sprintf("%dM", s.bufferSizeMB), "-P", "90", "-o", devicePath)
@@ -846,7 +1102,7 @@ func (s *Service) StreamToTape(ctx context.Context, sourcePath string, files []F
 			return 0, fmt.Errorf("failed to create pipe: %w", err)
 		}
 
-		cr := &countingReader{reader: pipe, callback: progressCb, paused: pauseFlag, pipelineDepth: s.pipelineDepth}
+		cr := &countingReader{reader: list.hashStream(pipe), callback: progressCb, paused: pauseFlag, pipelineDepth: s.pipelineDepth}
 		mbufferCmd.Stdin = cr
 
 		if err := tarCmd.Start(); err != nil {
@@ -878,6 +1134,7 @@ func (s *Service) StreamToTape(ctx context.Context, sourcePath string, files []F
 		tarArgs = append(tarArgs, "-f", devicePath)
 		cmd = exec.CommandContext(ctx, "tar", tarArgs...)
 		cmd.Dir = sourcePath
+		cmd.Stdin = list.stdin
 
 		output, err := cmd.CombinedOutput()
 		if ctx.Err() != nil {
@@ -891,25 +1148,104 @@ func (s *Service) StreamToTape(ctx context.Context, sourcePath string, files []F
 	return 0, nil
 }
 
-// StreamToTapeEncrypted streams files directly to tape with encryption using openssl
-func (s *Service) StreamToTapeEncrypted(ctx context.Context, sourcePath string, files []FileInfo, devicePath string, encryptionKey string, progressCb func(bytesWritten int64), pauseFlag *int32) (int64, error) {
+// useMbuffer reports whether writes to devicePath should go through mbuffer.
+// mbuffer only helps keep a physical drive streaming; virtual backends are
+// written through their Go writer instead, and so are drives whose failed
+// writes are retried.
+func (s *Service) useMbuffer(devicePath string) bool {
+	if !tape.IsPhysicalDevice(devicePath) || s.writeRetry.Retries > 0 {
+		return false
+	}
+	_, err := exec.LookPath("mbuffer")
+	return err == nil
+}
+
+// openTapeWriter opens a writer at the current position of devicePath.
+// Writes to a physical drive re-position and retry a block that fails with a
+// transient error when write retries are enabled.
+func (s *Service) openTapeWriter(ctx context.Context, devicePath string) (io.WriteCloser, error) {
+	backend := tape.BackendFor(devicePath)
+	if !tape.IsPhysicalDevice(devicePath) || s.writeRetry.Retries <= 0 {
+		return backend.OpenWriter(ctx)
+	}
+	return tape.NewRetryingWriter(ctx, backend, s.blockSize, s.writeRetry, func(block int64, attempt int, err error) {
+		if s.logger != nil {
+			s.logger.Warn("Tape write failed, re-positioning to retry", map[string]interface{}{
+				"device":  devicePath,
+				"block":   block,
+				"attempt": attempt,
+				"retries": s.writeRetry.Retries,
+				"error":   err.Error(),
+			})
+		}
+	})
+}
+
+// streamTarToBackend runs tar and copies its output into a storage backend
+// at the current position: a virtual backend, or a physical drive whose
+// failed writes are retried.
+func (s *Service) streamTarToBackend(ctx context.Context, tarArgs []string, list *tarFileList, sourcePath, devicePath string, progressCb func(bytesWritten int64), pauseFlag *int32) (int64, error) {
+	tarCmd := exec.CommandContext(ctx, "tar", tarArgs...)
+	tarCmd.Dir = sourcePath
+	tarCmd.Stdin = list.stdin
+	pipe, err := tarCmd.StdoutPipe()
+	if err != nil {
+		return 0, fmt.Errorf("failed to create pipe: %w", err)
+	}
+	cr := &countingReader{reader: list.hashStream(pipe), callback: progressCb, paused: pauseFlag, pipelineDepth: s.pipelineDepth}
+
+	w, err := s.openTapeWriter(ctx, devicePath)
+	if err != nil {
+		return 0, fmt.Errorf("failed to open %s: %w", devicePath, err)
+	}
+	if err := tarCmd.Start(); err != nil {
+		w.Close()
+		return 0, fmt.Errorf("failed to start tar: %w", err)
+	}
+	_, copyErr := io.Copy(w, cr)
+	if copyErr != nil {
+		tarCmd.Process.Kill()
+	}
+	tarErr := tarCmd.Wait()
+	closeErr := w.Close()
+
+	if ctx.Err() != nil {
+		return 0, fmt.Errorf("backup cancelled: %w", ctx.Err())
+	}
+	if copyErr != nil {
+		return 0, fmt.Errorf("write to %s failed: %w", devicePath, copyErr)
+	}
+	if tarErr != nil {
+		return 0, fmt.Errorf("tar failed: %w", tarErr)
+	}
+	if closeErr != nil {
+		return 0, fmt.Errorf("write to %s failed: %w", devicePath, closeErr)
+	}
+	return cr.bytesRead(), nil
+}
+
+// StreamToTapeEncrypted streams files directly to tape encrypted with the
+// native chunked AES-256-GCM stream format
+func (s *Service) StreamToTapeEncrypted(ctx context.Context, sourcePath string, files []FileInfo, devicePath string, encryptionKey string, progressCb func(bytesWritten int64), pauseFlag *int32) (int64, *models.EncryptionMetadata, error) {
 	if len(files) == 0 {
-		return 0, nil
+		return 0, nil, nil
 	}
 
-	// Create a file list for tar
-	fileListPath := fmt.Sprintf("/tmp/tapebackarr-filelist-%d.txt", time.Now().UnixNano())
-	fileList, err := os.Create(fileListPath)
+	list, err := s.writeTarFileList(sourcePath, files)
 	if err != nil {
-		return 0, fmt.Errorf("failed to create file list: %w", err)
+		return 0, nil, err
 	}
-	defer os.Remove(fileListPath)
+	defer list.Close()
+	return s.streamTarListEncrypted(ctx, sourcePath, list, devicePath, encryptionKey, progressCb, pauseFlag)
+}
 
-	for _, f := range files {
-		relPath, _ := filepath.Rel(sourcePath, f.Path)
-		fmt.Fprintln(fileList, relPath)
+// streamTarListEncrypted streams the files of a tar file list to tape
+// encrypted with the native stream format
+func (s *Service) streamTarListEncrypted(ctx context.Context, sourcePath string, list *tarFileList, devicePath string, encryptionKey string, progressCb func(bytesWritten int64), pauseFlag *int32) (int64, *models.EncryptionMetadata, error) {
+	keyBytes, err := encryption.DecodeKey(encryptionKey)
+	if err != nil {
+		return 0, nil, err
 	}
-	fileList.Close()
 
 	// Build tar command
 	// tar -b expects count of 512-byte blocks; mbuffer -s expects bytes
@@ -918,117 +1254,82 @@ func (s *Service) StreamToTapeEncrypted(ctx context.Context, sourcePath string,
 		"-c",
 		"-b", fmt.Sprintf("%d", s.blockSize/512), // Converts bytes to 512-byte block count
 		"-C", sourcePath,
-		"-T", fileListPath,
 	}
+	tarArgs = append(tarArgs, list.args()...)
 
-	// Create pipeline: tar -> openssl enc -> tape device
-	// Using openssl for encryption (widely available, standard tool)
+	// Pipeline: tar -> countingReader -> encrypt -> tape device
 	tarCmd := exec.CommandContext(ctx, "tar", tarArgs...)
 	tarCmd.Dir = sourcePath
+	tarCmd.Stdin = list.stdin
 
-	// openssl enc with AES-256-GCM and the key passed via stdin-derived password
-	// Using -pbkdf2 for key derivation and -pass for the key
-	opensslCmd := exec.CommandContext(ctx, "openssl", "enc",
-		"-aes-256-cbc", // Using CBC as GCM is not widely supported in openssl enc
-		"-salt",
-		"-pbkdf2",
-		"-iter", "100000",
-		"-pass", "pass:"+encryptionKey,
-	)
-
-	// Check if mbuffer is available
-	_, mbufferErr := exec.LookPath("mbuffer")
-
-	// Set up the pipeline with counting reader for progress tracking
 	tarPipe, err := tarCmd.StdoutPipe()
 	if err != nil {
-		return 0, fmt.Errorf("failed to create tar pipe: %w", err)
+		return 0, nil, fmt.Errorf("failed to create tar pipe: %w", err)
 	}
-	cr := &countingReader{reader: tarPipe, callback: progressCb, paused: pauseFlag, pipelineDepth: s.pipelineDepth}
-	opensslCmd.Stdin = cr
-
-	if mbufferErr == nil {
-		// Use mbuffer for buffering before writing to tape
-		mbufferCmd := exec.CommandContext(ctx, "mbuffer", "-s", fmt.Sprintf("%d", s.blockSize), "-m", fmt.Sprintf("%dM", s.bufferSizeMB), "-P", "90", "-o", devicePath)
+	cr := &countingReader{reader: list.hashStream(tarPipe), callback: progressCb, paused: pauseFlag, pipelineDepth: s.pipelineDepth}
 
-		opensslPipe, err := opensslCmd.StdoutPipe()
-		if err != nil {
-			return 0, fmt.Errorf("failed to create openssl pipe: %w", err)
-		}
-		// Count actual encrypted bytes going to tape
-		tapeCr := &countingReader{reader: opensslPipe, pipelineDepth: s.pipelineDepth}
-		mbufferCmd.Stdin = tapeCr
-
-		// Start the pipeline
-		if err := tarCmd.Start(); err != nil {
-			return 0, fmt.Errorf("failed to start tar: %w", err)
-		}
-		if err := opensslCmd.Start(); err != nil {
-			tarCmd.Process.Kill()
-			return 0, fmt.Errorf("failed to start openssl: %w", err)
-		}
-		if err := mbufferCmd.Start(); err != nil {
-			tarCmd.Process.Kill()
-			opensslCmd.Process.Kill()
-			return 0, fmt.Errorf("failed to start mbuffer: %w", err)
-		}
+	if err := tarCmd.Start(); err != nil {
+		return 0, nil, fmt.Errorf("failed to start tar: %w", err)
+	}
 
-		// Wait for all commands
-		tarErr := tarCmd.Wait()
-		opensslErr := opensslCmd.Wait()
-		mbufferErr := mbufferCmd.Wait()
+	written, header, writeErr := s.writeEncryptedStream(ctx, cr, devicePath, keyBytes)
+	if writeErr != nil {
+		tarCmd.Process.Kill()
+	}
+	tarErr := tarCmd.Wait()
 
-		if ctx.Err() != nil {
-			return 0, fmt.Errorf("backup cancelled: %w", ctx.Err())
-		}
-		if tarErr != nil {
-			return 0, fmt.Errorf("tar failed: %w", tarErr)
-		}
-		if opensslErr != nil {
-			return 0, fmt.Errorf("openssl encryption failed: %w", opensslErr)
-		}
-		if mbufferErr != nil {
-			return 0, fmt.Errorf("mbuffer failed: %w", mbufferErr)
-		}
-		return tapeCr.bytesRead(), nil
-	} else {
-		// Direct to tape device with buffered writes to avoid small I/O
-		// causing tape shoe-shining (start/stop cycles).
-		tapeFile, err := os.OpenFile(devicePath, os.O_WRONLY, 0)
-		if err != nil {
-			return 0, fmt.Errorf("failed to open tape device: %w", err)
-		}
-		defer tapeFile.Close()
+	if ctx.Err() != nil {
+		return 0, nil, fmt.Errorf("backup cancelled: %w", ctx.Err())
+	}
+	if writeErr != nil {
+		return 0, nil, writeErr
+	}
+	if tarErr != nil {
+		return 0, nil, fmt.Errorf("tar failed: %w", tarErr)
+	}
+	return written, header.Metadata(), nil
+}
 
-		bufferedTape := bufio.NewWriterSize(tapeFile, s.blockSize)
-		tapeCw := &countingWriter{writer: bufferedTape}
-		opensslCmd.Stdout = tapeCw
+// writeEncryptedStream encrypts src with the native stream format and writes
+// it to the tape device, through mbuffer when available. It returns the
+// number of encrypted bytes written to tape and the stream header.
+func (s *Service) writeEncryptedStream(ctx context.Context, src io.Reader, devicePath string, key []byte) (int64, *encryption.StreamHeader, error) {
+	encReader, err := encryption.NewEncryptingReader(src, key)
+	if err != nil {
+		return 0, nil, err
+	}
 
-		if err := tarCmd.Start(); err != nil {
-			return 0, fmt.Errorf("failed to start tar: %w", err)
-		}
-		if err := opensslCmd.Start(); err != nil {
-			tarCmd.Process.Kill()
-			return 0, fmt.Errorf("failed to start openssl: %w", err)
+	if s.useMbuffer(devicePath) {
+		mbufferCmd := exec.CommandContext(ctx, "mbuffer", "-s", fmt.Sprintf("%d", s.blockSize), "-m", fmt.Sprintf("%dM", s.bufferSizeMB), "-P", "90", "-o", devicePath)
+		// Count actual encrypted bytes going to tape
+		tapeCr := &countingReader{reader: encReader, pipelineDepth: s.pipelineDepth}
+		mbufferCmd.Stdin = tapeCr
+		if err := mbufferCmd.Run(); err != nil {
+			return 0, nil, fmt.Errorf("mbuffer failed: %w", err)
 		}
+		return tapeCr.bytesRead(), encReader.Header(), nil
+	}
 
-		tarErr := tarCmd.Wait()
-		opensslErr := opensslCmd.Wait()
+	// Direct to tape device with buffered writes to avoid small I/O
+	// causing tape shoe-shining (start/stop cycles).
+	tapeFile, err := s.openTapeWriter(ctx, devicePath)
+	if err != nil {
+		return 0, nil, fmt.Errorf("failed to open tape device: %w", err)
+	}
+	defer tapeFile.Close()
 
-		if ctx.Err() != nil {
-			return 0, fmt.Errorf("backup cancelled: %w", ctx.Err())
-		}
-		if tarErr != nil {
-			return 0, fmt.Errorf("tar failed: %w", tarErr)
-		}
-		if opensslErr != nil {
-			return 0, fmt.Errorf("openssl encryption failed: %w", opensslErr)
-		}
-		if err := bufferedTape.Flush(); err != nil {
-			return 0, fmt.Errorf("failed to flush tape buffer: %w", err)
-		}
-		return tapeCw.bytesWritten(), nil
+	bufferedTape := bufio.NewWriterSize(tapeFile, s.blockSize)
+	tapeCw := &countingWriter{writer: bufferedTape}
+	if _, err := io.Copy(tapeCw, encReader); err != nil {
+		return 0, nil, fmt.Errorf("encryption failed: %w", err)
+	}
+	if err := bufferedTape.Flush(); err != nil {
+		return 0, nil, fmt.Errorf("failed to flush tape buffer: %w", err)
 	}
+	if err := tapeFile.Close(); err != nil {
+		return 0, nil, fmt.Errorf("failed to close tape device: %w", err)
+	}
+	return tapeCw.bytesWritten(), encReader.Header(), nil
 }
 
 // StreamToTapeCompressed streams files to tape with compression
@@ -1037,20 +1338,17 @@ func (s *Service) StreamToTapeCompressed(ctx context.Context, sourcePath string,
 		return 0, nil
 	}
 
-	// Create a file list for tar
-	fileListPath := fmt.Sprintf("/tmp/tapebackarr-filelist-%d.txt", time.Now().UnixNano())
-	fileList, err := os.Create(fileListPath)
+	list, err := s.writeTarFileList(sourcePath, files)
 	if err != nil {
-		return 0, fmt.Errorf("failed to create file list: %w", err)
-	}
-	defer os.Remove(fileListPath)
-
-	for _, f := range files {
-		relPath, _ := filepath.Rel(sourcePath, f.Path)
-		fmt.Fprintln(fileList, relPath)
+		return 0, err
 	}
-	fileList.Close()
+	defer list.Close()
+	return s.streamTarListCompressed(ctx, sourcePath, list, devicePath, compression, progressCb, pauseFlag)
+}
 
+// streamTarListCompressed streams the files of a tar file list to tape with
+// compression
+func (s *Service) streamTarListCompressed(ctx context.Context, sourcePath string, list *tarFileList, devicePath string, compression models.CompressionType, progressCb func(bytesWritten int64), pauseFlag *int32) (int64, error) {
 	// Build tar command
 	// tar -b expects count of 512-byte blocks; mbuffer -s expects bytes
 	// Both use the same effective block size for alignment
@@ -1058,11 +1356,12 @@ func (s *Service) StreamToTapeCompressed(ctx context.Context, sourcePath string,
 		"-c",
 		"-b", fmt.Sprintf("%d", s.blockSize/512), // Converts bytes to 512-byte block count
 		"-C", sourcePath,
-		"-T", fileListPath,
 	}
+	tarArgs = append(tarArgs, list.args()...)
 
 	tarCmd := exec.CommandContext(ctx, "tar", tarArgs...)
 	tarCmd.Dir = sourcePath
+	tarCmd.Stdin = list.stdin
 
 	compCmd, err := buildCompressionCmd(ctx, compression)
 	if err != nil {
@@ -1074,13 +1373,10 @@ func (s *Service) StreamToTapeCompressed(ctx context.Context, sourcePath string,
 	if err != nil {
 		return 0, fmt.Errorf("failed to create tar pipe: %w", err)
 	}
-	cr := &countingReader{reader: tarPipe, callback: progressCb, paused: pauseFlag, pipelineDepth: s.pipelineDepth}
+	cr := &countingReader{reader: list.hashStream(tarPipe), callback: progressCb, paused: pauseFlag, pipelineDepth: s.pipelineDepth}
 	compCmd.Stdin = cr
 
-	// Check if mbuffer is available
-	_, mbufferErr := exec.LookPath("mbuffer")
-
-	if mbufferErr == nil {
+	if s.useMbuffer(devicePath) {
 		mbufferCmd := exec.CommandContext(ctx, "mbuffer", "-s", fmt.Sprintf("%d", s.blockSize), "-m", fmt.Sprintf("%dM", s.bufferSizeMB), "-P", "90", "-o", devicePath)
 		compPipe, err := compCmd.StdoutPipe()
 		if err != nil {
@@ -1123,7 +1419,7 @@ func (s *Service) StreamToTapeCompressed(ctx context.Context, sourcePath string,
 	} else {
 		// Direct to tape device with buffered writes to avoid small I/O
 		// causing tape shoe-shining (start/stop cycles).
-		tapeFile, err := os.OpenFile(devicePath, os.O_WRONLY, 0)
+		tapeFile, err := s.openTapeWriter(ctx, devicePath)
 		if err != nil {
 			return 0, fmt.Errorf("failed to open tape device: %w", err)
 		}
@@ -1156,28 +1452,34 @@ func (s *Service) StreamToTapeCompressed(ctx context.Context, sourcePath string,
 		if err := bufferedTape.Flush(); err != nil {
 			return 0, fmt.Errorf("failed to flush tape buffer: %w", err)
 		}
+		if err := tapeFile.Close(); err != nil {
+			return 0, fmt.Errorf("failed to close tape device: %w", err)
+		}
 		return tapeCw.bytesWritten(), nil
 	}
 }
 
 // StreamToTapeCompressedEncrypted streams files to tape with both compression and encryption
-func (s *Service) StreamToTapeCompressedEncrypted(ctx context.Context, sourcePath string, files []FileInfo, devicePath string, compression models.CompressionType, encryptionKey string, progressCb func(bytesWritten int64), pauseFlag *int32) (int64, error) {
+func (s *Service) StreamToTapeCompressedEncrypted(ctx context.Context, sourcePath string, files []FileInfo, devicePath string, compression models.CompressionType, encryptionKey string, progressCb func(bytesWritten int64), pauseFlag *int32) (int64, *models.EncryptionMetadata, error) {
 	if len(files) == 0 {
-		return 0, nil
+		return 0, nil, nil
 	}
 
-	fileListPath := fmt.Sprintf("/tmp/tapebackarr-filelist-%d.txt", time.Now().UnixNano())
-	fileList, err := os.Create(fileListPath)
+	list, err := s.writeTarFileList(sourcePath, files)
 	if err != nil {
-		return 0, fmt.Errorf("failed to create file list: %w", err)
+		return 0, nil, err
 	}
-	defer os.Remove(fileListPath)
+	defer list.Close()
+	return s.streamTarListCompressedEncrypted(ctx, sourcePath, list, devicePath, compression, encryptionKey, progressCb, pauseFlag)
+}
 
-	for _, f := range files {
-		relPath, _ := filepath.Rel(sourcePath, f.Path)
-		fmt.Fprintln(fileList, relPath)
+// streamTarListCompressedEncrypted streams the files of a tar file list to
+// tape with both compression and encryption
+func (s *Service) streamTarListCompressedEncrypted(ctx context.Context, sourcePath string, list *tarFileList, devicePath string, compression models.CompressionType, encryptionKey string, progressCb func(bytesWritten int64), pauseFlag *int32) (int64, *models.EncryptionMetadata, error) {
+	keyBytes, err := encryption.DecodeKey(encryptionKey)
+	if err != nil {
+		return 0, nil, err
 	}
-	fileList.Close()
 
 	// Build tar command
 	// tar -b expects count of 512-byte blocks; mbuffer -s expects bytes
@@ -1186,135 +1488,60 @@ func (s *Service) StreamToTapeCompressedEncrypted(ctx context.Context, sourcePat
 		"-c",
 		"-b", fmt.Sprintf("%d", s.blockSize/512), // Converts bytes to 512-byte block count
 		"-C", sourcePath,
-		"-T", fileListPath,
 	}
+	tarArgs = append(tarArgs, list.args()...)
 
 	tarCmd := exec.CommandContext(ctx, "tar", tarArgs...)
 	tarCmd.Dir = sourcePath
+	tarCmd.Stdin = list.stdin
 
 	compCmd, err := buildCompressionCmd(ctx, compression)
 	if err != nil {
-		return 0, err
+		return 0, nil, err
 	}
 
-	opensslCmd := exec.CommandContext(ctx, "openssl", "enc",
-		"-aes-256-cbc", "-salt", "-pbkdf2", "-iter", "100000",
-		"-pass", "pass:"+encryptionKey,
-	)
-
 	// Pipeline: tar -> countingReader -> compress -> encrypt -> tape
 	tarPipe, err := tarCmd.StdoutPipe()
 	if err != nil {
-		return 0, fmt.Errorf("failed to create tar pipe: %w", err)
+		return 0, nil, fmt.Errorf("failed to create tar pipe: %w", err)
 	}
-	cr := &countingReader{reader: tarPipe, callback: progressCb, paused: pauseFlag, pipelineDepth: s.pipelineDepth}
+	cr := &countingReader{reader: list.hashStream(tarPipe), callback: progressCb, paused: pauseFlag, pipelineDepth: s.pipelineDepth}
 	compCmd.Stdin = cr
 
 	compPipe, err := compCmd.StdoutPipe()
-	if err != nil {
-		return 0, fmt.Errorf("failed to create compression pipe: %w", err)
-	}
-	opensslCmd.Stdin = compPipe
-
-	_, mbufferErr := exec.LookPath("mbuffer")
-
-	if mbufferErr == nil {
-		mbufferCmd := exec.CommandContext(ctx, "mbuffer", "-s", fmt.Sprintf("%d", s.blockSize), "-m", fmt.Sprintf("%dM", s.bufferSizeMB), "-P", "90", "-o", devicePath)
-		opensslPipe, err := opensslCmd.StdoutPipe()
-		if err != nil {
-			return 0, fmt.Errorf("failed to create openssl pipe: %w", err)
-		}
-		// Count actual compressed+encrypted bytes going to tape
-		tapeCr := &countingReader{reader: opensslPipe, pipelineDepth: s.pipelineDepth}
-		mbufferCmd.Stdin = tapeCr
-
-		if err := tarCmd.Start(); err != nil {
-			return 0, fmt.Errorf("failed to start tar: %w", err)
-		}
-		if err := compCmd.Start(); err != nil {
-			tarCmd.Process.Kill()
-			return 0, fmt.Errorf("failed to start compression: %w", err)
-		}
-		if err := opensslCmd.Start(); err != nil {
-			tarCmd.Process.Kill()
-			compCmd.Process.Kill()
-			return 0, fmt.Errorf("failed to start openssl: %w", err)
-		}
-		if err := mbufferCmd.Start(); err != nil {
-			tarCmd.Process.Kill()
-			compCmd.Process.Kill()
-			opensslCmd.Process.Kill()
-			return 0, fmt.Errorf("failed to start mbuffer: %w", err)
-		}
-
-		tarErr := tarCmd.Wait()
-		compErr := compCmd.Wait()
-		opensslErr := opensslCmd.Wait()
-		mbufErr := mbufferCmd.Wait()
-
-		if ctx.Err() != nil {
-			return 0, fmt.Errorf("backup cancelled: %w", ctx.Err())
-		}
-		if tarErr != nil {
-			return 0, fmt.Errorf("tar failed: %w", tarErr)
-		}
-		if compErr != nil {
-			return 0, fmt.Errorf("compression failed: %w", compErr)
-		}
-		if opensslErr != nil {
-			return 0, fmt.Errorf("openssl encryption failed: %w", opensslErr)
-		}
-		if mbufErr != nil {
-			return 0, fmt.Errorf("mbuffer failed: %w", mbufErr)
-		}
-		return tapeCr.bytesRead(), nil
-	} else {
-		// Direct to tape device with buffered writes to avoid small I/O
-		// causing tape shoe-shining (start/stop cycles).
-		tapeFile, err := os.OpenFile(devicePath, os.O_WRONLY, 0)
-		if err != nil {
-			return 0, fmt.Errorf("failed to open tape device: %w", err)
-		}
-		defer tapeFile.Close()
-
-		bufferedTape := bufio.NewWriterSize(tapeFile, s.blockSize)
-		tapeCw := &countingWriter{writer: bufferedTape}
-		opensslCmd.Stdout = tapeCw
-
-		if err := tarCmd.Start(); err != nil {
-			return 0, fmt.Errorf("failed to start tar: %w", err)
-		}
-		if err := compCmd.Start(); err != nil {
-			tarCmd.Process.Kill()
-			return 0, fmt.Errorf("failed to start compression: %w", err)
-		}
-		if err := opensslCmd.Start(); err != nil {
-			tarCmd.Process.Kill()
-			compCmd.Process.Kill()
-			return 0, fmt.Errorf("failed to start openssl: %w", err)
-		}
+	if err != nil {
+		return 0, nil, fmt.Errorf("failed to create compression pipe: %w", err)
+	}
 
-		tarErr := tarCmd.Wait()
-		compErr := compCmd.Wait()
-		opensslErr := opensslCmd.Wait()
+	if err := tarCmd.Start(); err != nil {
+		return 0, nil, fmt.Errorf("failed to start tar: %w", err)
+	}
+	if err := compCmd.Start(); err != nil {
+		tarCmd.Process.Kill()
+		return 0, nil, fmt.Errorf("failed to start compression: %w", err)
+	}
 
-		if ctx.Err() != nil {
-			return 0, fmt.Errorf("backup cancelled: %w", ctx.Err())
-		}
-		if tarErr != nil {
-			return 0, fmt.Errorf("tar failed: %w", tarErr)
-		}
-		if compErr != nil {
-			return 0, fmt.Errorf("compression failed: %w", compErr)
-		}
-		if opensslErr != nil {
-			return 0, fmt.Errorf("openssl encryption failed: %w", opensslErr)
-		}
-		if err := bufferedTape.Flush(); err != nil {
-			return 0, fmt.Errorf("failed to flush tape buffer: %w", err)
-		}
-		return tapeCw.bytesWritten(), nil
+	written, header, writeErr := s.writeEncryptedStream(ctx, compPipe, devicePath, keyBytes)
+	if writeErr != nil {
+		tarCmd.Process.Kill()
+		compCmd.Process.Kill()
+	}
+	compErr := compCmd.Wait()
+	tarErr := tarCmd.Wait()
+
+	if ctx.Err() != nil {
+		return 0, nil, fmt.Errorf("backup cancelled: %w", ctx.Err())
+	}
+	if writeErr != nil {
+		return 0, nil, writeErr
+	}
+	if tarErr != nil {
+		return 0, nil, fmt.Errorf("tar failed: %w", tarErr)
 	}
+	if compErr != nil {
+		return 0, nil, fmt.Errorf("compression failed: %w", compErr)
+	}
+	return written, header.Metadata(), nil
 }
 
 // StreamToTapeLTFS writes files to a mounted LTFS volume instead of using a
@@ -1331,6 +1558,7 @@ func (s *Service) StreamToTapeLTFS(ctx context.Context, sourcePath string, files
 	}
 
 	ltfsSvc := tape.NewLTFSService("", ltfsMountPoint)
+	ltfsSvc.SetFollowSymlinks(hasFollowedLinks(files))
 	if !ltfsSvc.IsMounted() {
 		return 0, fmt.Errorf("LTFS volume not mounted at %s", ltfsMountPoint)
 	}
@@ -1369,6 +1597,7 @@ func (s *Service) StreamToTapeLTFSEncrypted(ctx context.Context, sourcePath stri
 	}
 
 	ltfsSvc := tape.NewLTFSService("", ltfsMountPoint)
+	ltfsSvc.SetFollowSymlinks(hasFollowedLinks(files))
 	if !ltfsSvc.IsMounted() {
 		return 0, fmt.Errorf("LTFS volume not mounted at %s", ltfsMountPoint)
 	}
@@ -1445,12 +1674,13 @@ func (s *Service) CalculateChecksum(path string) (string, error) {
 
 // computeChecksumsAsync computes SHA256 checksums for all files concurrently,
 // storing results in the provided sync.Map (path -> checksum string) AND
-// inserting catalog entries into the database as each batch of checksums
-// completes. This builds the catalog incrementally rather than in one large
-// batch after all checksums finish, preventing the "stuck in cataloging"
-// state for large file counts. The function is called after streaming
-// completes to avoid NFS I/O contention with the tape pipeline. The TOC
-// file list is written to tape separately at the end by finishTape.
+// recording them in the catalog as each batch of checksums completes. The
+// entries themselves were inserted by the catalog writer while streaming, so
+// this only fills in their checksums; an entry the writer did not insert is
+// inserted here. Files already in checksums, hashed from the tar stream,
+// are not read again. The function is called after streaming completes to
+// avoid NFS I/O contention with the tape pipeline. The TOC file list is written to
+// tape separately at the end by finishTape.
 func (s *Service) computeChecksumsAsync(ctx context.Context, files []FileInfo, checksums *sync.Map, backupSetID int64, sourcePath string) {
 	// Use multiple workers to maximize NFS read throughput. This function now
 	// runs after tape streaming has finished, so there is no risk of I/O
@@ -1492,8 +1722,10 @@ func (s *Service) computeChecksumsAsync(ctx context.Context, files []FileInfo, c
 				return
 			}
 			stmt, err := tx.Prepare(`
-				INSERT INTO catalog_entries (backup_set_id, file_path, file_size, file_mode, mod_time, checksum)
-				VALUES (?, ?, ?, ?, ?, ?)
+				INSERT INTO catalog_entries (backup_set_id, file_path, file_size, file_mode, mod_time, checksum,
+					uid, gid, owner, group_name, file_type, link_target, has_xattrs, extension, content_class)
+				VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+				ON CONFLICT(backup_set_id, file_path) DO UPDATE SET checksum = excluded.checksum
 			`)
 			if err != nil {
 				tx.Rollback()
@@ -1501,7 +1733,9 @@ func (s *Service) computeChecksumsAsync(ctx context.Context, files []FileInfo, c
 				return
 			}
 			for _, e := range batch {
-				if _, err := stmt.Exec(backupSetID, e.relPath, e.fi.Size, e.fi.Mode, e.fi.ModTime, e.checksum); err != nil {
+				ext, class := classifyPath(e.relPath)
+				if _, err := stmt.Exec(backupSetID, e.relPath, e.fi.Size, e.fi.Mode, e.fi.ModTime, e.checksum,
+					e.fi.UID, e.fi.GID, e.fi.Owner, e.fi.Group, e.fi.FileType, e.fi.LinkTarget, e.fi.HasXattrs, ext, class); err != nil {
 					s.logger.Warn("Failed to insert catalog entry", map[string]interface{}{
 						"file":  e.relPath,
 						"error": err.Error(),
@@ -1547,9 +1781,17 @@ func (s *Service) computeChecksumsAsync(ctx context.Context, files []FileInfo, c
 				return
 			default:
 			}
-			checksum, err := s.CalculateChecksum(fi.Path)
-			if err == nil {
-				checksums.Store(fi.Path, checksum)
+			// Stored symlinks have no content of their own to checksum, and
+			// files hashed from the tar stream need not be read again
+			var checksum string
+			if sum, ok := checksums.Load(fi.Path); ok {
+				checksum = sum.(string)
+			} else if os.FileMode(fi.Mode)&os.ModeSymlink == 0 {
+				var err error
+				checksum, err = s.CalculateChecksum(fi.Path)
+				if err == nil {
+					checksums.Store(fi.Path, checksum)
+				}
 			}
 			relPath, relErr := filepath.Rel(sourcePath, fi.Path)
 			if relErr != nil {
@@ -1570,6 +1812,10 @@ func (s *Service) CreateSnapshot(files []FileInfo) ([]byte, error) {
 
 // RunBackup executes a full backup job
 func (s *Service) RunBackup(ctx context.Context, job *models.BackupJob, source *models.BackupSource, tapeID int64, backupType models.BackupType) (*models.BackupSet, error) {
+	if source.SourceType == models.SourceTypeNDMP {
+		return s.runNDMPBackup(ctx, job, source, tapeID, backupType)
+	}
+
 	startTime := time.Now()
 
 	// Create cancellable context
@@ -1630,23 +1876,77 @@ func (s *Service) RunBackup(ctx context.Context, job *models.BackupJob, source *
 		cancel()
 	}()
 
-	s.emitEvent("info", "backup", "Backup Started", fmt.Sprintf("Starting backup job: %s (tape: %s)", job.Name, tapeLabel))
+	// SMB shares and NFS exports are mounted for the run and scanned like a
+	// local directory
+	if MountsShare(source) {
+		s.updateProgress(job.ID, "mounting", fmt.Sprintf("Mounting %s...", source.Path))
+	}
+	mounted, release, err := s.mountSource(ctx, source, "backup")
+	if err != nil {
+		s.updateProgress(job.ID, "failed", "Failed to mount source: "+err.Error())
+		s.emitEvent("error", "backup", "backup_failed", job.Name, err.Error())
+		return nil, err
+	}
+	defer release()
+	source = mounted
+
+	// Hold the tape so no other job sharing the pool selects it meanwhile
+	releaseTapes, err := s.holdTape(tapeID, job.ID)
+	if err != nil {
+		s.updateProgress(job.ID, "failed", err.Error())
+		s.emitEvent("error", "backup", "backup_failed", job.Name, err.Error())
+		return nil, err
+	}
+	defer releaseTapes()
+
+	// Keep restore chains and differentials bounded: the job's force-full
+	// policy may turn this run into a full backup
+	var promotionReason string
+	if backupType == models.BackupTypeIncremental || backupType == models.BackupTypeDifferential {
+		reason, err := s.FullBackupDue(job, startTime)
+		if err != nil {
+			s.logger.Warn("Failed to evaluate force-full policy, running incremental", map[string]interface{}{
+				"job_id": job.ID,
+				"error":  err.Error(),
+			})
+		} else if reason != "" {
+			backupType = models.BackupTypeFull
+			promotionReason = reason
+			s.updateProgress(job.ID, "initializing", "Promoted to full backup: "+reason)
+			s.emitEvent("info", "backup", "backup_promoted_full", job.Name, reason)
+		}
+	}
+
+	s.emitEvent("info", "backup", "backup_started", job.Name, tapeLabel)
 	s.logger.Info("Starting backup job", map[string]interface{}{
 		"job_id":      job.ID,
 		"job_name":    job.Name,
 		"source_path": source.Path,
 		"backup_type": backupType,
+		"promoted":    promotionReason,
 		"tape_label":  tapeLabel,
 	})
 
+	// Reject tapes no drive can write before anyone is asked to load them
+	if err := s.CheckTapeWritable(tapeID); err != nil {
+		s.updateProgress(job.ID, "failed", err.Error())
+		s.emitEvent("error", "backup", "backup_failed", job.Name, err.Error())
+		return nil, err
+	}
+
+	symlinkPolicy := source.SymlinkPolicy
+	if symlinkPolicy == "" {
+		symlinkPolicy = models.SymlinkStore
+	}
+
 	// Create backup set record
 	result, err := s.db.Exec(`
-		INSERT INTO backup_sets (job_id, tape_id, backup_type, format_type, start_time, status)
-		VALUES (?, ?, ?, ?, ?, ?)
-	`, job.ID, tapeID, backupType, tapeFormatType, startTime, models.BackupSetStatusRunning)
+		INSERT INTO backup_sets (job_id, tape_id, backup_type, format_type, start_time, status, symlink_policy, promotion_reason, block_size)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`, job.ID, tapeID, backupType, tapeFormatType, startTime, models.BackupSetStatusRunning, symlinkPolicy, promotionReason, s.blockSize)
 	if err != nil {
 		s.updateProgress(job.ID, "failed", "Failed to create backup set: "+err.Error())
-		s.emitEvent("error", "backup", "Backup Failed", fmt.Sprintf("Job %s failed: %s", job.Name, err.Error()))
+		s.emitEvent("error", "backup", "backup_failed", job.Name, err.Error())
 		return nil, fmt.Errorf("failed to create backup set: %w", err)
 	}
 
@@ -1680,6 +1980,65 @@ func (s *Service) RunBackup(ctx context.Context, job *models.BackupJob, source *
 		}
 	}()
 
+	// For incremental backup, load the previous snapshot to compare with; a
+	// differential compares with the snapshot of the last full backup. A
+	// missing or unreadable snapshot is rebuilt from the catalog rather than
+	// silently turning the run into a full backup.
+	var previous []FileInfo
+	havePrevious := false
+	if backupType == models.BackupTypeIncremental || backupType == models.BackupTypeDifferential {
+		differential := backupType == models.BackupTypeDifferential
+		var snapshotData []byte
+		var err error
+		if differential {
+			snapshotData, err = s.lastFullSnapshot(ctx, job.ID, source.ID)
+		} else {
+			err = s.db.QueryRow(`
+				SELECT snapshot_data FROM snapshots 
+				WHERE source_id = ? 
+				ORDER BY created_at DESC LIMIT 1
+			`, source.ID).Scan(&snapshotData)
+		}
+
+		if err == nil && len(snapshotData) > 0 {
+			if err = json.Unmarshal(snapshotData, &previous); err != nil {
+				err = fmt.Errorf("failed to parse snapshot: %w", err)
+			}
+		} else if err == nil {
+			err = fmt.Errorf("stored snapshot is empty")
+		}
+		if err != nil {
+			s.logger.Warn("No usable snapshot, rebuilding it from the catalog", map[string]interface{}{
+				"job_id": job.ID,
+				"error":  err.Error(),
+			})
+			var fromSetID int64
+			previous, fromSetID, err = s.snapshotFromCatalog(ctx, job.ID, source.Path, differential)
+			if err != nil {
+				s.logger.Warn("Failed to rebuild snapshot from catalog, doing full backup", map[string]interface{}{
+					"job_id": job.ID,
+					"error":  err.Error(),
+				})
+				s.emitEvent("warning", "backup", "snapshot_missing_full", job.Name)
+			} else {
+				s.emitEvent("warning", "backup", "snapshot_rebuilt", job.Name, fromSetID)
+			}
+		}
+		havePrevious = err == nil
+	}
+
+	s.mu.Lock()
+	resumeFiles := s.resumeFiles[job.ID]
+	s.mu.Unlock()
+
+	// A pipelined backup starts writing the first tape while the scan is
+	// still running. Deduplication and resumed runs need the complete file
+	// list before writing, as do hashing for change detection and
+	// guardrails, and LTFS volumes are written file by file.
+	pipelineCapacity := (tapeCapacity - tapeUsed) * 99 / 100
+	hashChanges := job.ChangeDetection == models.ChangeDetectionHash || job.ChangeDetection == models.ChangeDetectionHybrid
+	pipelined := job.PipelinedScan && !useLTFS && !job.DedupEnabled && !hashChanges && !hasGuardrails(job) && len(resumeFiles) == 0 && pipelineCapacity > 0
+
 	// Scan source
 	s.updateProgress(job.ID, "scanning", fmt.Sprintf("Scanning source: %s", source.Path))
 	s.logger.Info("Scanning source", map[string]interface{}{"path": source.Path})
@@ -1695,45 +2054,66 @@ func (s *Service) RunBackup(ctx context.Context, job *models.BackupJob, source *
 		s.mu.Unlock()
 	}
 
-	files, err := s.ScanSource(ctx, source, scanCb)
-	if err != nil {
-		s.updateProgress(job.ID, "failed", fmt.Sprintf("Failed to scan source: %s", err.Error()))
-		s.updateBackupSetStatus(backupSetID, models.BackupSetStatusFailed, err.Error())
-		return nil, fmt.Errorf("failed to scan source: %w", err)
-	}
+	// Catalog entries are inserted while the files stream to tape, so the
+	// end of a large backup does not wait for them
+	catalog := s.startCatalogWriter(backupSetID, source.Path)
+	defer catalog.close()
 
-	s.updateProgress(job.ID, "scanning", fmt.Sprintf("Scan complete: found %d files", len(files)))
-	s.logger.Info("Scan complete", map[string]interface{}{
-		"file_count": len(files),
-	})
+	var files []FileInfo
+	var pipeline *pipelinedScan
+	var pipelineList *tarFileList
+	var scanSkips *SkipReport
+	if pipelined {
+		// The scan's files reach tar once the tape is positioned; the
+		// scan itself carries on meanwhile
+		var filter func([]FileInfo) []FileInfo
+		if havePrevious {
+			filter = changeFilter(previous, models.ChangeDetectionMetadata)
+		}
+		onQueued := func(queuedFiles, queuedBytes int64) {
+			s.mu.Lock()
+			if p, ok := s.activeJobs[job.ID]; ok {
+				p.TotalFiles = queuedFiles
+				p.TotalBytes = queuedBytes
+			}
+			s.mu.Unlock()
+		}
+		pipeline, pipelineList, err = s.startPipelinedScan(ctx, source, pipelineCapacity, filter, scanCb, onQueued, catalog.add)
+		if err != nil {
+			s.updateProgress(job.ID, "failed", err.Error())
+			s.updateBackupSetStatus(backupSetID, models.BackupSetStatusFailed, err.Error())
+			return nil, err
+		}
+		defer pipelineList.Close()
+	} else {
+		files, scanSkips, err = s.ScanSourceWithReport(ctx, source, scanCb)
+		if err != nil {
+			s.updateProgress(job.ID, "failed", fmt.Sprintf("Failed to scan source: %s", err.Error()))
+			s.updateBackupSetStatus(backupSetID, models.BackupSetStatusFailed, err.Error())
+			return nil, fmt.Errorf("failed to scan source: %w", err)
+		}
+		s.scanFinished(job.ID, backupSetID, len(files), scanSkips)
+	}
 
-	// For incremental backup, compare with previous snapshot
-	if backupType == models.BackupTypeIncremental {
-		var snapshotData []byte
-		err := s.db.QueryRow(`
-			SELECT snapshot_data FROM snapshots 
-			WHERE source_id = ? 
-			ORDER BY created_at DESC LIMIT 1
-		`, source.ID).Scan(&snapshotData)
+	// The snapshot records the full scan so the next incremental run only
+	// picks up what changed since this one, whatever this run wrote.
+	snapshotFiles := files
 
-		if err == nil && len(snapshotData) > 0 {
-			files, err = s.CompareWithSnapshot(ctx, files, snapshotData)
-			if err != nil {
-				s.logger.Warn("Failed to compare with snapshot, doing full backup", map[string]interface{}{
-					"error": err.Error(),
-				})
-			} else {
-				s.logger.Info("Incremental backup", map[string]interface{}{
-					"changed_files": len(files),
-				})
-			}
+	if havePrevious && !pipelined {
+		var hashed int
+		if hashChanges {
+			s.updateProgress(job.ID, "scanning", "Comparing file contents with the previous backup...")
+			hashed = s.hashChangeCandidates(ctx, files, previous, job.ChangeDetection, job.HashSampled)
 		}
+		files = changeFilter(previous, job.ChangeDetection)(files)
+		s.logger.Info("Incremental backup", map[string]interface{}{
+			"changed_files":    len(files),
+			"change_detection": job.ChangeDetection,
+			"hashed_files":     hashed,
+		})
 	}
 
 	// Filter out already-processed files when resuming from a checkpoint
-	s.mu.Lock()
-	resumeFiles := s.resumeFiles[job.ID]
-	s.mu.Unlock()
 	if len(resumeFiles) > 0 {
 		processedSet := make(map[string]bool, len(resumeFiles))
 		for _, f := range resumeFiles {
@@ -1760,6 +2140,39 @@ func (s *Service) RunBackup(ctx context.Context, job *models.BackupJob, source *
 		files = remaining
 	}
 
+	// With deduplication enabled, files whose content is already on an
+	// unexpired tape in the pool are catalogued as references rather than
+	// written again. LTFS tapes stay self-contained and are never deduplicated.
+	var dedupRefs []DedupRef
+	if job.DedupEnabled && !useLTFS {
+		s.updateProgress(job.ID, "scanning", fmt.Sprintf("Checking %d files against the pool catalog for duplicates...", len(files)))
+		files, dedupRefs = s.FindDuplicates(ctx, job.PoolID, source.Path, files)
+		// References are catalogued before anything is written; if that
+		// fails the files are written normally instead
+		if err := s.recordDedupRefs(backupSetID, dedupRefs); err != nil {
+			s.logger.Warn("Failed to record deduplicated files, writing them instead", map[string]interface{}{
+				"backup_set_id": backupSetID,
+				"error":         err.Error(),
+			})
+			for _, r := range dedupRefs {
+				files = append(files, r.File)
+			}
+			dedupRefs = nil
+		}
+		if len(dedupRefs) > 0 {
+			var dedupBytes int64
+			for _, r := range dedupRefs {
+				dedupBytes += r.File.Size
+			}
+			s.updateProgress(job.ID, "scanning", fmt.Sprintf("Deduplicated %d files (%d bytes) already in the pool, %d files to write", len(dedupRefs), dedupBytes, len(files)))
+			s.logger.Info("Deduplicated files against pool catalog", map[string]interface{}{
+				"dedup_files": len(dedupRefs),
+				"dedup_bytes": dedupBytes,
+				"remaining":   len(files),
+			})
+		}
+	}
+
 	// Calculate total size
 	var totalBytes int64
 	for _, f := range files {
@@ -1775,13 +2188,28 @@ func (s *Service) RunBackup(ctx context.Context, job *models.BackupJob, source *
 		return files[i].Path < files[j].Path
 	})
 
-	// Update progress with file/byte totals
-	s.mu.Lock()
-	if p, ok := s.activeJobs[job.ID]; ok {
-		p.TotalFiles = int64(len(files))
-		p.TotalBytes = totalBytes
+	// Update progress with file/byte totals. A pipelined scan reports them
+	// as it goes.
+	if !pipelined {
+		s.mu.Lock()
+		if p, ok := s.activeJobs[job.ID]; ok {
+			p.TotalFiles = int64(len(files))
+			p.TotalBytes = totalBytes
+		}
+		s.mu.Unlock()
+	}
+
+	// Guardrails stop a run whose size looks wrong, such as after the source
+	// path was mis-edited, before a tape is touched
+	if hasGuardrails(job) {
+		if reason := s.checkGuardrails(job, backupType, backupSetID, int64(len(files)), totalBytes); reason != "" {
+			if !s.consumeGuardrailConfirmation(job.ID) {
+				return nil, s.stopAtGuardrail(job, backupSetID, int64(len(files)), totalBytes, reason)
+			}
+			s.db.Exec("UPDATE backup_sets SET guardrail = ? WHERE id = ?", "confirmed: "+reason, backupSetID)
+			s.updateProgress(job.ID, "scanning", "Guardrails exceeded but the run was confirmed: "+reason)
+		}
 	}
-	s.mu.Unlock()
 
 	// Read expected tape info from DB
 	var expectedLabel, expectedUUID string
@@ -1796,6 +2224,26 @@ func (s *Service) RunBackup(ctx context.Context, job *models.BackupJob, source *
 	// DB column which may be stale.
 	s.updateProgress(job.ID, "positioning", "Looking for tape "+expectedLabel+" in drives...")
 
+	// A job pinned to a drive queues for it and only looks for its tape
+	// there. Other jobs skip drives that other runs hold, since probing a
+	// drive would disturb the run writing through it.
+	pinnedDrive, err := s.jobDrive(job.ID)
+	if err != nil {
+		s.updateProgress(job.ID, "failed", "Failed to look up job drive: "+err.Error())
+		s.updateBackupSetStatus(backupSetID, models.BackupSetStatusFailed, "failed to look up job drive")
+		return nil, fmt.Errorf("failed to look up job drive: %w", err)
+	}
+	drive := &driveHold{s: s, jobID: job.ID}
+	defer drive.releaseAll()
+	if pinnedDrive != "" {
+		if err := drive.moveTo(ctx, pinnedDrive); err != nil {
+			s.updateProgress(job.ID, "failed", "Backup cancelled while waiting for drive "+pinnedDrive)
+			s.updateBackupSetStatus(backupSetID, models.BackupSetStatusFailed, "cancelled waiting for drive")
+			return nil, err
+		}
+		s.updateProgress(job.ID, "positioning", "Looking for tape "+expectedLabel+" in drive "+pinnedDrive+"...")
+	}
+
 	var devicePath string
 	const tapeRetryInterval = 10 * time.Second
 	const maxConsecutiveErrors = 30 // give up after ~5 minutes of persistent drive errors
@@ -1804,7 +2252,7 @@ func (s *Service) RunBackup(ctx context.Context, job *models.BackupJob, source *
 
 	for {
 		// First, try the fast path: look up by current_tape_id
-		dbErr := s.db.QueryRow("SELECT device_path FROM tape_drives WHERE current_tape_id = ? AND COALESCE(enabled, 1) = 1", tapeID).Scan(&devicePath)
+		dbErr := s.db.QueryRow(availableDrivesQuery+" AND current_tape_id = ?", pinnedDrive, pinnedDrive, job.ID, tapeID).Scan(&devicePath)
 		if dbErr == nil {
 			// Verify the tape is actually the correct one by reading the physical label
 			// Use a per-drive timeout context to prevent blocking on unresponsive drives
@@ -1832,7 +2280,7 @@ func (s *Service) RunBackup(ctx context.Context, job *models.BackupJob, source *
 		}
 
 		// Scan all enabled drives and read physical labels to find the correct tape
-		driveRows, driveErr := s.db.Query("SELECT device_path FROM tape_drives WHERE COALESCE(enabled, 1) = 1")
+		driveRows, driveErr := s.db.Query(availableDrivesQuery, pinnedDrive, pinnedDrive, job.ID)
 		if driveErr == nil {
 			found := false
 			driveIndex := 0
@@ -1886,6 +2334,11 @@ func (s *Service) RunBackup(ctx context.Context, job *models.BackupJob, source *
 			}
 		}
 
+		// A tape in a library slot is fetched rather than waited for
+		if s.loadFromLibrary(ctx, job.ID, tapeID, expectedLabel, pinnedDrive) {
+			continue
+		}
+
 		// Tape not found in any drive — notify operator and wait
 		consecutiveErrors++
 		if consecutiveErrors >= maxConsecutiveErrors {
@@ -1896,11 +2349,14 @@ func (s *Service) RunBackup(ctx context.Context, job *models.BackupJob, source *
 
 		waitMsg := fmt.Sprintf("Tape %q not found in any drive. Please insert the correct tape to continue backup job %q.",
 			expectedLabel, job.Name)
+		if pinnedDrive != "" {
+			waitMsg = fmt.Sprintf("Tape %q not found in drive %s. Please insert the correct tape to continue backup job %q.",
+				expectedLabel, pinnedDrive, job.Name)
+		}
 		s.updateProgress(job.ID, "waiting", waitMsg)
 		issueKey := "no_tape"
 		if lastNotifiedIssue != issueKey {
-			s.emitEvent("warning", "backup", "Tape Required",
-				fmt.Sprintf("Job %s: tape %s not found in any drive. Please insert it.", job.Name, expectedLabel))
+			s.emitEvent("warning", "backup", "tape_required", job.Name, expectedLabel)
 			if s.WrongTapeCallback != nil {
 				s.WrongTapeCallback(ctx, expectedLabel, "not loaded in any drive")
 			}
@@ -1917,6 +2373,12 @@ func (s *Service) RunBackup(ctx context.Context, job *models.BackupJob, source *
 		}
 	}
 
+	if err := drive.moveTo(ctx, devicePath); err != nil {
+		s.updateProgress(job.ID, "failed", "Backup cancelled while waiting for drive "+devicePath)
+		s.updateBackupSetStatus(backupSetID, models.BackupSetStatusFailed, "cancelled waiting for drive")
+		return nil, err
+	}
+
 	// Update device path in progress
 	s.mu.Lock()
 	if p, ok := s.activeJobs[job.ID]; ok {
@@ -1990,6 +2452,27 @@ func (s *Service) RunBackup(ctx context.Context, job *models.BackupJob, source *
 		}
 	}
 
+	// The optional media check also compares the tape's contents with the
+	// catalog, catching a tape swapped for another one carrying the same label
+	if !useLTFS {
+		if err := s.runMediaCheck(ctx, job, driveSvc, tapeID, backupSetID); err != nil {
+			s.updateProgress(job.ID, "failed", err.Error())
+			s.updateBackupSetStatus(backupSetID, models.BackupSetStatusFailed, err.Error())
+			return nil, err
+		}
+	}
+
+	// Tapes added without an LTO type, or never written yet, are checked
+	// against what the drive reports so capacity planning uses real figures
+	s.refreshTapeMedia(ctx, tapeID, driveSvc)
+	if err := s.db.QueryRow("SELECT capacity_bytes FROM tapes WHERE id = ?", tapeID).Scan(&tapeCapacity); err == nil {
+		s.mu.Lock()
+		if p, ok := s.activeJobs[job.ID]; ok {
+			p.TapeCapacityBytes = tapeCapacity
+		}
+		s.mu.Unlock()
+	}
+
 	s.updateProgress(job.ID, "positioning", "Tape label verified, positioning past label...")
 
 	// Position tape past the label. ReadTapeLabel already rewound, so we seek forward.
@@ -1998,7 +2481,7 @@ func (s *Service) RunBackup(ctx context.Context, job *models.BackupJob, source *
 		s.logger.Error("Failed to seek past label on tape", map[string]interface{}{"error": err.Error(), "tape": expectedLabel})
 		s.updateProgress(job.ID, "failed", errMsg)
 		s.updateBackupSetStatus(backupSetID, models.BackupSetStatusFailed, errMsg)
-		s.emitEvent("error", "backup", "Tape Positioning Failed", fmt.Sprintf("Job %s failed: %s", job.Name, errMsg))
+		s.emitEvent("error", "backup", "tape_positioning_failed", job.Name, errMsg)
 		return nil, fmt.Errorf("failed to position tape past label: %w", err)
 	}
 
@@ -2084,6 +2567,21 @@ func (s *Service) RunBackup(ctx context.Context, job *models.BackupJob, source *
 		compressionType = job.Compression
 	}
 
+	streamStages, err := s.jobStreamStages(job.ID)
+	if err != nil {
+		s.updateProgress(job.ID, "failed", "Invalid stream stages: "+err.Error())
+		s.updateBackupSetStatus(backupSetID, models.BackupSetStatusFailed, "invalid stream stages: "+err.Error())
+		return nil, fmt.Errorf("invalid stream stages: %w", err)
+	}
+	if useLTFS && len(streamStages) > 0 {
+		// LTFS tapes hold files, not a stream
+		s.logger.Warn("Stream stages are not applied to LTFS tapes", map[string]interface{}{
+			"job_id": job.ID,
+			"stages": stages.Names(streamStages),
+		})
+		streamStages = nil
+	}
+
 	// For LTFS tapes, mount the volume before streaming
 	if useLTFS {
 		ltfsSvc := tape.NewLTFSService(devicePath, ltfsMountPoint)
@@ -2117,7 +2615,56 @@ func (s *Service) RunBackup(ctx context.Context, job *models.BackupJob, source *
 	// streamBatch streams a batch of files to the tape device with the configured
 	// encryption and compression settings. Returns actual bytes written to tape.
 	// For LTFS tapes, files are written directly to the mounted LTFS volume.
+	// The encryption parameters of the last stream are kept in batchEncryption,
+	// and the stream stages it went through in batchStages, so they can be
+	// recorded on the backup set written by that batch.
+	var batchEncryption *models.EncryptionMetadata
+	var batchStages []models.StreamStage
+	// fileChecksums holds the SHA-256 of each file by path, hashed from the
+	// tar stream while writing or by the checksum pass after it
+	fileChecksums := &sync.Map{}
+	// fileOffsets holds where each file's header starts in the stream on
+	// its tape
+	fileOffsets := &sync.Map{}
+	streamList := func(list *tarFileList, what string) (written int64, err error) {
+		list.checksums = fileChecksums
+		list.offsets = fileOffsets
+		start := time.Now()
+		defer func() { s.recordDriveUsage(devicePath, time.Since(start), written) }()
+		if len(streamStages) > 0 {
+			s.updateProgress(job.ID, "streaming", fmt.Sprintf("Streaming %s through %s to tape %s...", what, strings.Join(stages.Names(streamStages), ", "), expectedLabel))
+			var compression models.CompressionType
+			if useCompression {
+				compression = job.Compression
+			}
+			written, meta, applied, err := s.streamTarListStaged(ctx, source.Path, list, devicePath, streamStages, compression, encKey, progressCb, &pauseFlag)
+			batchEncryption, batchStages = meta, applied
+			return written, err
+		} else if encrypted && useCompression {
+			s.updateProgress(job.ID, "streaming", fmt.Sprintf("Compressing (%s), encrypting and streaming %s to tape %s...", job.Compression, what, expectedLabel))
+			written, meta, err := s.streamTarListCompressedEncrypted(ctx, source.Path, list, devicePath, job.Compression, encKey, progressCb, &pauseFlag)
+			batchEncryption = meta
+			return written, err
+		} else if encrypted {
+			s.updateProgress(job.ID, "streaming", fmt.Sprintf("Encrypting and streaming %s to tape %s...", what, expectedLabel))
+			written, meta, err := s.streamTarListEncrypted(ctx, source.Path, list, devicePath, encKey, progressCb, &pauseFlag)
+			batchEncryption = meta
+			return written, err
+		} else if useCompression {
+			s.updateProgress(job.ID, "streaming", fmt.Sprintf("Compressing (%s) and streaming %s to tape %s...", job.Compression, what, expectedLabel))
+			return s.streamTarListCompressed(ctx, source.Path, list, devicePath, job.Compression, progressCb, &pauseFlag)
+		}
+		s.updateProgress(job.ID, "streaming", fmt.Sprintf("Streaming %s to tape %s...", what, expectedLabel))
+		return s.streamTarList(ctx, source.Path, list, devicePath, progressCb, &pauseFlag)
+	}
+	// With a pipelined scan the first tape is written below before the
+	// batches are known; the first batch then only reports what was written.
+	pipelineWritten := int64(-1)
+	var pipelineEncryption *models.EncryptionMetadata
+	var pipelineStages []models.StreamStage
 	streamBatch := func(batch []FileInfo) (int64, error) {
+		batchEncryption = nil
+		batchStages = nil
 		var batchBytes int64
 		for _, f := range batch {
 			batchBytes += f.Size
@@ -2125,27 +2672,39 @@ func (s *Service) RunBackup(ctx context.Context, job *models.BackupJob, source *
 
 		if useLTFS {
 			// LTFS mode: write files to the mounted LTFS volume
+			start := time.Now()
+			var written int64
+			var err error
 			if encrypted {
 				s.updateProgress(job.ID, "streaming", fmt.Sprintf("Encrypting and writing %d files to LTFS tape %s...", len(batch), expectedLabel))
-				return s.StreamToTapeLTFSEncrypted(ctx, source.Path, batch, ltfsMountPoint, encKey, progressCb, &pauseFlag)
+				batchEncryption = encryption.LTFSFileMetadata()
+				written, err = s.StreamToTapeLTFSEncrypted(ctx, source.Path, batch, ltfsMountPoint, encKey, progressCb, &pauseFlag)
+			} else {
+				s.updateProgress(job.ID, "streaming", fmt.Sprintf("Writing %d files to LTFS tape %s...", len(batch), expectedLabel))
+				written, err = s.StreamToTapeLTFS(ctx, source.Path, batch, ltfsMountPoint, progressCb, &pauseFlag)
 			}
-			s.updateProgress(job.ID, "streaming", fmt.Sprintf("Writing %d files to LTFS tape %s...", len(batch), expectedLabel))
-			return s.StreamToTapeLTFS(ctx, source.Path, batch, ltfsMountPoint, progressCb, &pauseFlag)
+			s.recordDriveUsage(devicePath, time.Since(start), written)
+			return written, err
 		}
 
 		// Raw mode: tar-based streaming pipeline
-		if encrypted && useCompression {
-			s.updateProgress(job.ID, "streaming", fmt.Sprintf("Compressing (%s), encrypting and streaming %d files to tape %s...", job.Compression, len(batch), expectedLabel))
-			return s.StreamToTapeCompressedEncrypted(ctx, source.Path, batch, devicePath, job.Compression, encKey, progressCb, &pauseFlag)
-		} else if encrypted {
-			s.updateProgress(job.ID, "streaming", fmt.Sprintf("Encrypting and streaming %d files to tape %s...", len(batch), expectedLabel))
-			return s.StreamToTapeEncrypted(ctx, source.Path, batch, devicePath, encKey, progressCb, &pauseFlag)
-		} else if useCompression {
-			s.updateProgress(job.ID, "streaming", fmt.Sprintf("Compressing (%s) and streaming %d files to tape %s...", job.Compression, len(batch), expectedLabel))
-			return s.StreamToTapeCompressed(ctx, source.Path, batch, devicePath, job.Compression, progressCb, &pauseFlag)
+		if len(batch) == 0 {
+			return 0, nil
+		}
+		if pipelineWritten >= 0 {
+			// The first tape was already written while the source was scanned
+			written := pipelineWritten
+			pipelineWritten = -1
+			batchEncryption = pipelineEncryption
+			batchStages = pipelineStages
+			return written, nil
+		}
+		list, err := s.writeTarFileList(source.Path, batch)
+		if err != nil {
+			return 0, err
 		}
-		s.updateProgress(job.ID, "streaming", fmt.Sprintf("Streaming %d files to tape %s...", len(batch), expectedLabel))
-		return s.StreamToTape(ctx, source.Path, batch, devicePath, progressCb, &pauseFlag)
+		defer list.Close()
+		return streamList(list, fmt.Sprintf("%d files", len(batch)))
 	}
 
 	// Checksum computation is deferred until after streaming completes to
@@ -2154,11 +2713,15 @@ func (s *Service) RunBackup(ctx context.Context, job *models.BackupJob, source *
 	// sequential read throughput (often dropping from 300+ MB/s to < 10 MB/s
 	// on NAS arrays with spinning disks). By checksumming after streaming,
 	// the tape pipeline gets full source bandwidth during the write phase.
-	fileChecksums := &sync.Map{}
+	// Files hashed from the tar stream as it was written are not read again.
 	checksumDone := make(chan struct{})
 	var startChecksumsOnce sync.Once
 	startChecksums := func() {
 		startChecksumsOnce.Do(func() {
+			catalog.close()
+			s.logger.Info("Cataloged files while streaming", map[string]interface{}{
+				"entries": catalog.cataloged(),
+			})
 			go func() {
 				defer close(checksumDone)
 				s.computeChecksumsAsync(ctx, files, fileChecksums, backupSetID, source.Path)
@@ -2166,9 +2729,66 @@ func (s *Service) RunBackup(ctx context.Context, job *models.BackupJob, source *
 		})
 	}
 
+	if pipeline == nil {
+		catalog.feed(files)
+	}
+
+	var pipelineFirst int
+	if pipeline != nil {
+		// Write the first tape while the scan carries on, then pick up the
+		// scan's results as though it had finished before writing
+		s.logger.Info("Streaming to tape while scanning", map[string]interface{}{
+			"device":    devicePath,
+			"encrypted": encrypted,
+		})
+		written, err := streamList(pipelineList, "files from the running scan")
+		pipelineList.Close()
+		if err != nil {
+			catalog.discard()
+			s.updateProgress(job.ID, "failed", "Stream failed: "+err.Error())
+			s.updateBackupSetStatus(backupSetID, models.BackupSetStatusFailed, err.Error())
+			s.emitEvent("error", "backup", "backup_failed", job.Name, err.Error())
+			streamFailed(err.Error())
+			return nil, fmt.Errorf("failed to stream to tape: %w", err)
+		}
+		if err := pipeline.wait(); err != nil {
+			catalog.discard()
+			s.updateProgress(job.ID, "failed", fmt.Sprintf("Failed to scan source: %s", err.Error()))
+			s.updateBackupSetStatus(backupSetID, models.BackupSetStatusFailed, err.Error())
+			return nil, fmt.Errorf("failed to scan source: %w", err)
+		}
+		s.scanFinished(job.ID, backupSetID, len(pipeline.all), pipeline.report)
+		scanSkips = pipeline.report
+
+		// Files left over for later tapes keep the sorted order of a
+		// normal run
+		sort.Slice(pipeline.overflow, func(i, j int) bool {
+			return pipeline.overflow[i].Path < pipeline.overflow[j].Path
+		})
+		pipelineFirst = len(pipeline.written)
+		files = append(pipeline.written, pipeline.overflow...)
+		snapshotFiles = pipeline.all
+		totalBytes = 0
+		for _, f := range files {
+			totalBytes += f.Size
+		}
+		s.mu.Lock()
+		if p, ok := s.activeJobs[job.ID]; ok {
+			p.TotalFiles = int64(len(files))
+			p.TotalBytes = totalBytes
+		}
+		s.mu.Unlock()
+		pipelineWritten = written
+		pipelineEncryption = batchEncryption
+		pipelineStages = batchStages
+	}
+
 	// Check if all files fit on the current tape
-	remainingCapacity := tapeCapacity - tapeUsed
+	remainingCapacity := s.tapeRemaining(tapeID, tapeCapacity-tapeUsed)
 	_, overflow := s.splitFilesForTape(files, remainingCapacity)
+	if pipeline != nil {
+		overflow = pipeline.overflow
+	}
 
 	if overflow == nil {
 		// --- Single tape path: all files fit on this tape ---
@@ -2182,9 +2802,10 @@ func (s *Service) RunBackup(ctx context.Context, job *models.BackupJob, source *
 
 		actualTapeBytes, err := streamBatch(files)
 		if err != nil {
+			catalog.discard()
 			s.updateProgress(job.ID, "failed", "Stream failed: "+err.Error())
 			s.updateBackupSetStatus(backupSetID, models.BackupSetStatusFailed, err.Error())
-			s.emitEvent("error", "backup", "Backup Failed", fmt.Sprintf("Job %s failed: %s", job.Name, err.Error()))
+			s.emitEvent("error", "backup", "backup_failed", job.Name, err.Error())
 			streamFailed(err.Error())
 			return nil, fmt.Errorf("failed to stream to tape: %w", err)
 		}
@@ -2201,11 +2822,12 @@ func (s *Service) RunBackup(ctx context.Context, job *models.BackupJob, source *
 			driveSvc: driveSvc, files: files, totalBytes: totalBytes,
 			actualTapeBytes: actualTapeBytes,
 			backupType:      backupType, encrypted: encrypted,
-			encryptionKeyID: encryptionKeyID,
-			hwEncrypted:     hwEncrypted, hwEncryptionKeyID: hwEncryptionKeyID,
+			encryptionKeyID: encryptionKeyID, encryptionMeta: batchEncryption,
+			streamStages: batchStages,
+			hwEncrypted:  hwEncrypted, hwEncryptionKeyID: hwEncryptionKeyID,
 			compressed:      compressed,
 			compressionType: compressionType, startTime: startTime,
-			checksums: fileChecksums,
+			checksums: fileChecksums, offsets: fileOffsets,
 		}); err != nil {
 			s.logger.Warn("finishTape failed", map[string]interface{}{"error": err.Error()})
 		}
@@ -2216,7 +2838,7 @@ func (s *Service) RunBackup(ctx context.Context, job *models.BackupJob, source *
 			"remaining_capacity": remainingCapacity,
 			"file_count":         len(files),
 		})
-		s.emitEvent("info", "backup", "Multi-Tape Backup", fmt.Sprintf("Job %s requires multiple tapes — spanning enabled", job.Name))
+		s.emitEvent("info", "backup", "multi_tape_backup", job.Name)
 
 		// Create spanning set record
 		spanResult, err := s.db.Exec(`
@@ -2224,6 +2846,7 @@ func (s *Service) RunBackup(ctx context.Context, job *models.BackupJob, source *
 			VALUES (?, ?, ?, 'in_progress')
 		`, job.ID, totalBytes, len(files))
 		if err != nil {
+			catalog.discard()
 			s.updateProgress(job.ID, "failed", "Failed to create spanning set: "+err.Error())
 			s.updateBackupSetStatus(backupSetID, models.BackupSetStatusFailed, err.Error())
 			return nil, fmt.Errorf("failed to create spanning set: %w", err)
@@ -2249,9 +2872,13 @@ func (s *Service) RunBackup(ctx context.Context, job *models.BackupJob, source *
 				curCapacity = tapeCapacity
 				curUsed = tapeUsed
 			}
-			curRemaining := curCapacity - curUsed
+			curRemaining := s.tapeRemaining(currentTapeID, curCapacity-curUsed)
 
 			batch, rest := s.splitFilesForTape(remaining, curRemaining)
+			if seqNum == 1 && pipeline != nil {
+				// The first tape holds what the pipelined scan wrote
+				batch, rest = remaining[:pipelineFirst], remaining[pipelineFirst:]
+			}
 			if len(batch) == 0 {
 				// Tape has no usable capacity — need a new one immediately
 				rest = remaining
@@ -2267,9 +2894,9 @@ func (s *Service) RunBackup(ctx context.Context, job *models.BackupJob, source *
 				// For tapes after the first, we need a new backup set
 				if seqNum > 1 {
 					setResult, err := s.db.Exec(`
-						INSERT INTO backup_sets (job_id, tape_id, backup_type, format_type, start_time, status)
-						VALUES (?, ?, ?, ?, ?, ?)
-					`, job.ID, currentTapeID, backupType, tapeFormatType, time.Now(), models.BackupSetStatusRunning)
+						INSERT INTO backup_sets (job_id, tape_id, backup_type, format_type, start_time, status, symlink_policy, block_size)
+						VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+					`, job.ID, currentTapeID, backupType, tapeFormatType, time.Now(), models.BackupSetStatusRunning, symlinkPolicy, s.blockSize)
 					if err != nil {
 						s.updateProgress(job.ID, "failed", "Failed to create backup set for tape "+currentLabel+": "+err.Error())
 						s.db.Exec("UPDATE tape_spanning_sets SET status = 'failed' WHERE id = ?", spanningSetID)
@@ -2288,9 +2915,13 @@ func (s *Service) RunBackup(ctx context.Context, job *models.BackupJob, source *
 
 				actualBatchBytes, err := streamBatch(batch)
 				if err != nil {
+					if currentBackupSetID == backupSetID {
+						// Nothing of the run was written yet
+						catalog.discard()
+					}
 					s.updateProgress(job.ID, "failed", "Stream failed on tape "+currentLabel+": "+err.Error())
 					s.updateBackupSetStatus(currentBackupSetID, models.BackupSetStatusFailed, err.Error())
-					s.emitEvent("error", "backup", "Backup Failed", fmt.Sprintf("Job %s failed on tape %s: %s", job.Name, currentLabel, err.Error()))
+					s.emitEvent("error", "backup", "backup_failed_on_tape", job.Name, currentLabel, err.Error())
 					s.db.Exec("UPDATE tape_spanning_sets SET status = 'failed' WHERE id = ?", spanningSetID)
 					streamFailed(err.Error())
 					return nil, fmt.Errorf("failed to stream to tape %s: %w", currentLabel, err)
@@ -2313,12 +2944,13 @@ func (s *Service) RunBackup(ctx context.Context, job *models.BackupJob, source *
 					files: batch, totalBytes: batchBytes,
 					actualTapeBytes: actualBatchBytes,
 					backupType:      backupType, encrypted: encrypted,
-					encryptionKeyID: encryptionKeyID,
-					hwEncrypted:     hwEncrypted, hwEncryptionKeyID: hwEncryptionKeyID,
+					encryptionKeyID: encryptionKeyID, encryptionMeta: batchEncryption,
+					streamStages: batchStages,
+					hwEncrypted:  hwEncrypted, hwEncryptionKeyID: hwEncryptionKeyID,
 					compressed:      compressed,
 					compressionType: compressionType, startTime: startTime,
 					spanningSetID: spanningSetID, sequenceNumber: seqNum,
-					checksums: fileChecksums,
+					checksums: fileChecksums, offsets: fileOffsets,
 				}); err != nil {
 					s.logger.Warn("finishTape failed", map[string]interface{}{
 						"tape_label": currentLabel,
@@ -2360,7 +2992,7 @@ func (s *Service) RunBackup(ctx context.Context, job *models.BackupJob, source *
 			}
 
 			// Try to allocate the next tape from the pool
-			nextTapeID, allocErr := s.allocateNextTape(ctx, job.PoolID, usedTapeIDs)
+			nextTapeID, allocErr := s.allocateNextTape(ctx, job.PoolID, job.ID, usedTapeIDs)
 			var nextTapeLabel string
 			if allocErr != nil {
 				s.logger.Warn("Could not auto-allocate next tape", map[string]interface{}{"error": allocErr.Error()})
@@ -2370,41 +3002,58 @@ func (s *Service) RunBackup(ctx context.Context, job *models.BackupJob, source *
 				}
 			}
 
-			// Need another tape — request a change
-			if nextTapeLabel != "" {
-				s.updateProgress(job.ID, "waiting", fmt.Sprintf("Tape %s complete. Waiting for next tape %s... (%d files remaining)", currentLabel, nextTapeLabel, len(remaining)))
-				s.emitEvent("warning", "backup", "Tape Change Required",
-					fmt.Sprintf("Job %s: tape %s is full. Please load tape %s. %d files remaining.", job.Name, currentLabel, nextTapeLabel, len(remaining)))
+			// The next tape is fetched when it sits in a library; otherwise
+			// request a change and wait for the operator
+			var newTapeID int64
+			if allocErr == nil && s.loadFromLibrary(ctx, job.ID, nextTapeID, nextTapeLabel, pinnedDrive) {
+				newTapeID = nextTapeID
 			} else {
-				s.updateProgress(job.ID, "waiting", fmt.Sprintf("Tape %s complete. Waiting for next tape... (%d files remaining)", currentLabel, len(remaining)))
-				s.emitEvent("warning", "backup", "Tape Change Required",
-					fmt.Sprintf("Job %s: tape %s is full. Please load a new tape from the pool. %d files remaining.", job.Name, currentLabel, len(remaining)))
-			}
+				// Need another tape — request a change
+				if nextTapeLabel != "" {
+					s.updateProgress(job.ID, "waiting", fmt.Sprintf("Tape %s complete. Waiting for next tape %s... (%d files remaining)", currentLabel, nextTapeLabel, len(remaining)))
+					s.emitEvent("warning", "backup", "tape_change_required", job.Name, currentLabel, nextTapeLabel, len(remaining))
+				} else {
+					s.updateProgress(job.ID, "waiting", fmt.Sprintf("Tape %s complete. Waiting for next tape... (%d files remaining)", currentLabel, len(remaining)))
+					s.emitEvent("warning", "backup", "tape_change_required_any", job.Name, currentLabel, len(remaining))
+				}
 
-			// Send notification (e.g. Telegram) about the tape change
-			if s.TapeChangeCallback != nil {
-				s.TapeChangeCallback(ctx, job.Name, currentLabel, "tape_full", nextTapeLabel)
-			}
+				// Send notification (e.g. Telegram) about the tape change
+				if s.TapeChangeCallback != nil {
+					s.TapeChangeCallback(ctx, job.Name, currentLabel, "tape_full", nextTapeLabel)
+				}
 
-			reqID, err := s.createTapeChangeRequest(ctx, currentTapeID, spanningSetID, "tape_full")
-			if err != nil {
-				s.updateProgress(job.ID, "failed", "Failed to create tape change request: "+err.Error())
-				s.db.Exec("UPDATE tape_spanning_sets SET status = 'failed' WHERE id = ?", spanningSetID)
-				return nil, fmt.Errorf("failed to create tape change request: %w", err)
-			}
+				reqID, err := s.createTapeChangeRequest(ctx, currentTapeID, spanningSetID, "tape_full")
+				if err != nil {
+					s.updateProgress(job.ID, "failed", "Failed to create tape change request: "+err.Error())
+					s.db.Exec("UPDATE tape_spanning_sets SET status = 'failed' WHERE id = ?", spanningSetID)
+					return nil, fmt.Errorf("failed to create tape change request: %w", err)
+				}
 
-			// If we auto-allocated a tape, pre-fill the request with it for the operator to confirm
-			if allocErr == nil && nextTapeID > 0 {
-				s.db.Exec("UPDATE tape_change_requests SET new_tape_id = ? WHERE id = ?", nextTapeID, reqID)
+				// If we auto-allocated a tape, pre-fill the request with it for the operator to confirm
+				if allocErr == nil && nextTapeID > 0 {
+					s.db.Exec("UPDATE tape_change_requests SET new_tape_id = ? WHERE id = ?", nextTapeID, reqID)
+				}
+
+				// Wait for operator to complete the tape change
+				newTapeID, err = s.waitForTapeChange(ctx, reqID)
+				if err != nil {
+					s.updateProgress(job.ID, "failed", "Tape change failed: "+err.Error())
+					s.db.Exec("UPDATE tape_spanning_sets SET status = 'failed' WHERE id = ?", spanningSetID)
+					return nil, fmt.Errorf("tape change failed: %w", err)
+				}
 			}
 
-			// Wait for operator to complete the tape change
-			newTapeID, err := s.waitForTapeChange(ctx, reqID)
-			if err != nil {
+			// Hand the full tape back to the pool and take over the new one;
+			// an operator may have loaded a tape another job is writing
+			if allocErr == nil && nextTapeID != newTapeID {
+				s.ReleaseTape(nextTapeID, job.ID)
+			}
+			if err := s.ReserveTape(newTapeID, job.ID); err != nil {
 				s.updateProgress(job.ID, "failed", "Tape change failed: "+err.Error())
 				s.db.Exec("UPDATE tape_spanning_sets SET status = 'failed' WHERE id = ?", spanningSetID)
 				return nil, fmt.Errorf("tape change failed: %w", err)
 			}
+			s.ReleaseTape(currentTapeID, job.ID)
 
 			// Set up the new tape
 			currentTapeID = newTapeID
@@ -2421,7 +3070,7 @@ func (s *Service) RunBackup(ctx context.Context, job *models.BackupJob, source *
 			foundSpanDrive := false
 
 			// Fast path: try current_tape_id lookup first
-			if err := s.db.QueryRow("SELECT device_path FROM tape_drives WHERE current_tape_id = ? AND COALESCE(enabled, 1) = 1", currentTapeID).Scan(&devicePath); err == nil {
+			if err := s.db.QueryRow(availableDrivesQuery+" AND current_tape_id = ?", pinnedDrive, pinnedDrive, job.ID, currentTapeID).Scan(&devicePath); err == nil {
 				// Use a per-drive timeout context to prevent blocking on unresponsive drives
 				probeCtx, probeCancel := context.WithTimeout(ctx, driveProbeTimeout)
 				probeSvc := tape.NewServiceForDevice(devicePath, s.tapeService.GetBlockSize())
@@ -2438,7 +3087,7 @@ func (s *Service) RunBackup(ctx context.Context, job *models.BackupJob, source *
 
 			// If fast path failed, scan all enabled drives
 			if !foundSpanDrive {
-				driveRows, driveErr := s.db.Query("SELECT device_path FROM tape_drives WHERE COALESCE(enabled, 1) = 1")
+				driveRows, driveErr := s.db.Query(availableDrivesQuery, pinnedDrive, pinnedDrive, job.ID)
 				if driveErr == nil {
 					driveIndex := 0
 					for driveRows.Next() {
@@ -2489,6 +3138,11 @@ func (s *Service) RunBackup(ctx context.Context, job *models.BackupJob, source *
 				s.db.Exec("UPDATE tape_spanning_sets SET status = 'failed' WHERE id = ?", spanningSetID)
 				return nil, fmt.Errorf("no drive found with new tape %s after scanning all drives", currentLabel)
 			}
+			if err := drive.moveTo(ctx, devicePath); err != nil {
+				s.updateProgress(job.ID, "failed", "Backup cancelled while waiting for drive "+devicePath)
+				s.db.Exec("UPDATE tape_spanning_sets SET status = 'failed' WHERE id = ?", spanningSetID)
+				return nil, err
+			}
 			currentDriveSvc = tape.NewServiceForDevice(devicePath, s.tapeService.GetBlockSize())
 
 			// Final label verification before write — strict check, no fallback
@@ -2499,6 +3153,14 @@ func (s *Service) RunBackup(ctx context.Context, job *models.BackupJob, source *
 				s.db.Exec("UPDATE tape_spanning_sets SET status = 'failed' WHERE id = ?", spanningSetID)
 				return nil, fmt.Errorf("%s", errMsg)
 			}
+			if !useLTFS {
+				if err := s.runMediaCheck(ctx, job, currentDriveSvc, currentTapeID, 0); err != nil {
+					s.updateProgress(job.ID, "failed", err.Error())
+					s.db.Exec("UPDATE tape_spanning_sets SET status = 'failed' WHERE id = ?", spanningSetID)
+					return nil, err
+				}
+			}
+			s.refreshTapeMedia(ctx, currentTapeID, currentDriveSvc)
 			if err := currentDriveSvc.SeekToFileNumber(ctx, 1); err != nil {
 				errMsg := fmt.Sprintf("failed to position new tape %s: %s", currentLabel, err.Error())
 				s.updateProgress(job.ID, "failed", errMsg)
@@ -2554,19 +3216,58 @@ func (s *Service) RunBackup(ctx context.Context, job *models.BackupJob, source *
 		})
 	}
 
-	// Save snapshot for future incremental backups
-	snapshotData, _ := s.CreateSnapshot(files)
-	s.db.Exec(`
-		INSERT INTO snapshots (source_id, backup_set_id, file_count, total_bytes, snapshot_data)
-		VALUES (?, ?, ?, ?, ?)
-	`, source.ID, backupSetID, len(files), totalBytes, snapshotData)
+	// Record what was deleted since the previous run, so restores to a
+	// point in time leave it out. With a truncated skip report unreadable
+	// paths could pass for deletions, so none are recorded.
+	if havePrevious {
+		if scanSkips != nil && scanSkips.Truncated {
+			s.logger.Warn("Too many skipped paths to tell deleted files apart, not recording deletions", map[string]interface{}{
+				"backup_set_id": backupSetID,
+			})
+		} else if err := s.saveDeletedPaths(backupSetID, deletedSince(source.Path, previous, snapshotFiles, scanSkips)); err != nil {
+			s.logger.Warn("Failed to record deleted files", map[string]interface{}{
+				"backup_set_id": backupSetID,
+				"error":         err.Error(),
+			})
+		}
+	}
+
+	if job.DirectoryReport {
+		if err := s.saveDirectoryReport(backupSetID, directoryUsage(source.Path, files)); err != nil {
+			s.logger.Warn("Failed to record directory report", map[string]interface{}{
+				"backup_set_id": backupSetID,
+				"error":         err.Error(),
+			})
+		}
+	}
+
+	// Save snapshot for future incremental backups and prune old ones
+	if hashChanges {
+		s.recordWrittenHashes(ctx, snapshotFiles, files, fileChecksums, job.HashSampled)
+	}
+	if _, err := s.SaveSnapshot(source.ID, backupSetID, snapshotFiles); err != nil {
+		s.logger.Warn("Failed to save snapshot", map[string]interface{}{
+			"backup_set_id": backupSetID,
+			"error":         err.Error(),
+		})
+	} else if pruned, err := s.PruneSnapshots(job.ID, job.SnapshotRetention); err != nil {
+		s.logger.Warn("Failed to prune snapshots", map[string]interface{}{
+			"job_id": job.ID,
+			"error":  err.Error(),
+		})
+	} else if pruned > 0 {
+		s.logger.Info("Pruned old snapshots", map[string]interface{}{
+			"job_id": job.ID,
+			"pruned": pruned,
+		})
+	}
 
 	// Update job last run
 	endTime := time.Now()
 	s.db.Exec("UPDATE backup_jobs SET last_run_at = ? WHERE id = ?", endTime, job.ID)
 
 	s.updateProgress(job.ID, "completed", fmt.Sprintf("Backup completed: %d files, %d bytes in %s", len(files), totalBytes, endTime.Sub(startTime).String()))
-	s.emitEvent("success", "backup", "Backup Completed", fmt.Sprintf("Job %s completed: %d files, %d bytes in %s", job.Name, len(files), totalBytes, endTime.Sub(startTime).String()))
+	s.emitEvent("success", "backup", "backup_completed", job.Name, len(files), totalBytes, endTime.Sub(startTime).String())
 	s.logger.Info("Backup completed", map[string]interface{}{
 		"job_id":      job.ID,
 		"file_count":  len(files),
@@ -2629,6 +3330,8 @@ type finishTapeParams struct {
 	backupType         models.BackupType
 	encrypted          bool
 	encryptionKeyID    *int64
+	encryptionMeta     *models.EncryptionMetadata // how the stream on this tape was encrypted; nil if not encrypted
+	streamStages       []models.StreamStage       // stages the stream on this tape went through, with their metadata
 	hwEncrypted        bool
 	hwEncryptionKeyID  *int64
 	compressed         bool
@@ -2638,6 +3341,7 @@ type finishTapeParams struct {
 	sequenceNumber     int       // 1-based tape index within spanning set
 	totalTapes         int       // 0 if not yet known (updated later)
 	checksums          *sync.Map // pre-computed file checksums (path -> string), computed concurrently during streaming
+	offsets            *sync.Map // where each file's header starts in the stream on this tape (path -> int64), when known
 }
 
 // finishTape writes the per-tape TOC and updates catalog/tape records for
@@ -2729,9 +3433,11 @@ func (s *Service) finishTape(p finishTapeParams) error {
 		FileCount:       int64(len(p.files)),
 		TotalBytes:      p.totalBytes,
 		Encrypted:       p.encrypted,
+		Encryption:      p.encryptionMeta,
 		HwEncrypted:     p.hwEncrypted,
 		Compressed:      p.compressed,
 		CompressionType: string(p.compressionType),
+		StreamStages:    p.streamStages,
 		Files:           make([]tape.TOCFileEntry, 0, len(p.files)),
 	}
 	for _, f := range p.files {
@@ -2772,23 +3478,41 @@ func (s *Service) finishTape(p finishTapeParams) error {
 
 	// Update backup set for this tape
 	endTime := time.Now()
+	var encFormat models.EncryptionFormat
+	var encKDF, encSalt, encIV string
+	var encChunkSize int
+	if m := p.encryptionMeta; m != nil {
+		encFormat, encKDF, encSalt, encIV, encChunkSize = m.Format, m.KDFJSON(), m.Salt, m.IV, m.ChunkSize
+	}
+	// Use actual bytes written to tape (post-compression) when available, so
+	// compressed backups don't overestimate tape consumption
+	tapeUsageDelta := p.totalBytes
+	if p.actualTapeBytes > 0 {
+		tapeUsageDelta = p.actualTapeBytes
+	}
 	s.db.Exec(`
 		UPDATE backup_sets SET 
-			end_time = ?, status = ?, file_count = ?, total_bytes = ?,
+			end_time = ?, status = ?, file_count = ?, total_bytes = ?, tape_bytes = ?,
 			encrypted = ?, encryption_key_id = ?,
+			encryption_format = ?, encryption_kdf = ?, encryption_salt = ?,
+			encryption_iv = ?, encryption_chunk_size = ?,
 			hw_encrypted = ?, hw_encryption_key_id = ?,
-			compressed = ?, compression_type = ?
+			compressed = ?, compression_type = ?, stream_stages = ?
 		WHERE id = ?
-	`, endTime, models.BackupSetStatusCompleted, len(p.files), p.totalBytes,
+	`, endTime, models.BackupSetStatusCompleted, len(p.files), p.totalBytes, tapeUsageDelta,
 		p.encrypted, p.encryptionKeyID,
+		encFormat, encKDF, encSalt, encIV, encChunkSize,
 		p.hwEncrypted, p.hwEncryptionKeyID,
-		p.compressed, p.compressionType, p.backupSetID)
+		p.compressed, p.compressionType, stages.Marshal(p.streamStages), p.backupSetID)
+	s.recordCloudCopy(p.backupSetID, p.job.Name, p.streamStages)
 
 	// Compute and save per-file block_offset in catalog entries. Files are
 	// written sequentially as a tar stream, so the offset of each file is the
 	// cumulative size of all preceding files (plus tar header overhead per file).
 	// This allows the restore page to show where each file lives on tape.
 	// Tar header overhead: 512-byte header + up to 512 bytes padding = ~1KB per file.
+	// The exact stream_offset is recorded alongside where the stream was
+	// parsed while writing.
 	// Use batched transactions for performance with large file counts.
 	const tarHeaderOverhead = 1024
 	const offsetBatchSize = 500
@@ -2815,7 +3539,7 @@ func (s *Service) finishTape(p finishTapeParams) error {
 			}
 			continue
 		}
-		stmt, err := tx.Prepare(`UPDATE catalog_entries SET block_offset = ? WHERE backup_set_id = ? AND file_path = ?`)
+		stmt, err := tx.Prepare(`UPDATE catalog_entries SET block_offset = ?, stream_offset = ? WHERE backup_set_id = ? AND file_path = ?`)
 		if err != nil {
 			tx.Rollback()
 			s.logger.Warn("Failed to prepare statement for block_offset update", map[string]interface{}{
@@ -2835,7 +3559,13 @@ func (s *Service) finishTape(p finishTapeParams) error {
 			if relErr != nil {
 				relPath = f.Path
 			}
-			if _, err := stmt.Exec(cumulativeOffset, p.backupSetID, relPath); err != nil {
+			var streamOffset interface{}
+			if p.offsets != nil {
+				if off, ok := p.offsets.Load(f.Path); ok {
+					streamOffset = off
+				}
+			}
+			if _, err := stmt.Exec(cumulativeOffset, streamOffset, p.backupSetID, relPath); err != nil {
 				s.logger.Warn("Failed to update block_offset for catalog entry", map[string]interface{}{
 					"file": relPath, "error": err.Error(),
 				})
@@ -2846,20 +3576,20 @@ func (s *Service) finishTape(p finishTapeParams) error {
 		tx.Commit()
 	}
 
-	// Update tape usage — use actual bytes written to tape (post-compression)
-	// when available, so compressed backups don't overestimate tape consumption.
-	tapeUsageDelta := p.totalBytes
-	if p.actualTapeBytes > 0 {
-		tapeUsageDelta = p.actualTapeBytes
-	}
+	// Update tape usage
 	s.db.Exec(`
 		UPDATE tapes SET 
-			used_bytes = used_bytes + ?, write_count = write_count + 1,
+			used_bytes = used_bytes + ?, write_count = write_count + 1, physical_remaining_bytes = NULL,
 			last_written_at = ?,
 			status = CASE WHEN status = 'blank' THEN 'active' ELSE status END
 		WHERE id = ?
 	`, tapeUsageDelta, endTime, p.tapeID)
 
+	// Reconcile with what the drive says is left now that the TOC is written
+	if _, err := s.RecordDriveCapacity(p.ctx, p.tapeID, p.driveSvc); err != nil {
+		s.logger.Warn("Could not read remaining capacity from drive", map[string]interface{}{"tape": p.tapeLabel, "error": err.Error()})
+	}
+
 	// Track encryption key on tape if applicable
 	if p.encrypted && p.encryptionKeyID != nil {
 		var keyFingerprint, keyName string
@@ -2925,14 +3655,16 @@ func (s *Service) splitFilesForTape(files []FileInfo, remainingCapacity int64) (
 }
 
 // allocateNextTape finds the next available tape in the given pool, excluding
-// tapes already used in this backup. Returns the tape ID or an error.
-func (s *Service) allocateNextTape(ctx context.Context, poolID int64, excludeTapeIDs []int64) (int64, error) {
+// tapes already used in this backup and tapes other jobs have reserved, and
+// reserves it for the job. Returns the tape ID or an error.
+func (s *Service) allocateNextTape(ctx context.Context, poolID, jobID int64, excludeTapeIDs []int64) (int64, error) {
 	query := `
 		SELECT id FROM tapes
 		WHERE pool_id = ? AND status IN ('active', 'blank')
 		AND (capacity_bytes - used_bytes) > 0
+		AND id NOT IN (SELECT tape_id FROM tape_reservations WHERE job_id != ? AND expires_at > datetime('now'))
 	`
-	args := []interface{}{poolID}
+	args := []interface{}{poolID, jobID}
 
 	if len(excludeTapeIDs) > 0 {
 		placeholders := make([]string, len(excludeTapeIDs))
@@ -2943,12 +3675,16 @@ func (s *Service) allocateNextTape(ctx context.Context, poolID int64, excludeTap
 		query += " AND id NOT IN (" + strings.Join(placeholders, ",") + ")"
 	}
 
-	query += " ORDER BY used_bytes ASC LIMIT 1"
+	// Tapes a library can fetch come first
+	query += " ORDER BY " + library.InSlotOrder + " DESC, used_bytes ASC LIMIT 1"
 
 	var nextTapeID int64
 	if err := s.db.QueryRow(query, args...).Scan(&nextTapeID); err != nil {
 		return 0, fmt.Errorf("no available tape in pool: %w", err)
 	}
+	if err := s.ReserveTape(nextTapeID, jobID); err != nil {
+		return 0, err
+	}
 	return nextTapeID, nil
 }
 
@@ -3134,7 +3870,7 @@ func (s *Service) RunBackupWithResume(ctx context.Context, job *models.BackupJob
 		s.mu.Unlock()
 	}()
 
-	s.emitEvent("info", "backup", "Backup Resuming", fmt.Sprintf("Resuming backup job: %s (skipping %d already-processed files)", job.Name, len(state.FilesProcessed)))
+	s.emitEvent("info", "backup", "backup_resuming", job.Name, len(state.FilesProcessed))
 
 	return s.RunBackup(ctx, job, source, tapeID, backupType)
 }
@@ -3170,21 +3906,81 @@ func (s *Service) ListBackupSets(ctx context.Context, jobID *int64, limit int) (
 	return sets, nil
 }
 
-// SearchCatalog searches the catalog for files matching a pattern
-func (s *Service) SearchCatalog(ctx context.Context, pattern string, limit int) ([]models.CatalogEntry, error) {
-	// Replace * with % for SQL LIKE
-	sqlPattern := strings.ReplaceAll(pattern, "*", "%")
+// CatalogQuery selects catalog entries. Empty fields match every entry.
+type CatalogQuery struct {
+	// Pattern matches file paths, with * as a wildcard
+	Pattern  string
+	Owner    string
+	Group    string
+	UID      *int
+	FileType string
+	MinSize  int64
+	MaxSize  int64
+	// HasXattrs, when set, keeps only entries with or without extended
+	// attributes
+	HasXattrs *bool
+	// Extension is lower case without the dot
+	Extension    string
+	ContentClass string
+}
 
-	rows, err := s.db.Query(`
+// SearchCatalog searches the catalog for files matching a query
+func (s *Service) SearchCatalog(ctx context.Context, q CatalogQuery, limit int) ([]models.CatalogEntry, error) {
+	query := `
 		SELECT ce.id, ce.backup_set_id, ce.file_path, ce.file_size, ce.file_mode, ce.mod_time,
-		       COALESCE(ce.checksum, ''), COALESCE(ce.block_offset, 0), COALESCE(bs.tape_id, 0), COALESCE(t.label, '')
+		       COALESCE(ce.checksum, ''), COALESCE(ce.block_offset, 0), COALESCE(bs.tape_id, 0), COALESCE(t.label, ''),
+		       ce.uid, ce.gid, COALESCE(ce.owner, ''), COALESCE(ce.group_name, ''), COALESCE(ce.file_type, ''),
+		       COALESCE(ce.link_target, ''), ce.has_xattrs, COALESCE(ce.extension, ''), COALESCE(ce.content_class, '')
 		FROM catalog_entries ce
 		LEFT JOIN backup_sets bs ON ce.backup_set_id = bs.id
 		LEFT JOIN tapes t ON bs.tape_id = t.id
-		WHERE ce.file_path LIKE ?
-		ORDER BY ce.file_path
-		LIMIT ?
-	`, sqlPattern, limit)
+		WHERE 1=1`
+	var args []interface{}
+	if q.Pattern != "" {
+		// Replace * with % for SQL LIKE
+		query += " AND ce.file_path LIKE ?"
+		args = append(args, strings.ReplaceAll(q.Pattern, "*", "%"))
+	}
+	if q.Owner != "" {
+		query += " AND ce.owner = ?"
+		args = append(args, q.Owner)
+	}
+	if q.Group != "" {
+		query += " AND ce.group_name = ?"
+		args = append(args, q.Group)
+	}
+	if q.UID != nil {
+		query += " AND ce.uid = ?"
+		args = append(args, *q.UID)
+	}
+	if q.FileType != "" {
+		query += " AND ce.file_type = ?"
+		args = append(args, q.FileType)
+	}
+	if q.MinSize > 0 {
+		query += " AND ce.file_size >= ?"
+		args = append(args, q.MinSize)
+	}
+	if q.MaxSize > 0 {
+		query += " AND ce.file_size <= ?"
+		args = append(args, q.MaxSize)
+	}
+	if q.HasXattrs != nil {
+		query += " AND ce.has_xattrs = ?"
+		args = append(args, *q.HasXattrs)
+	}
+	if q.Extension != "" {
+		query += " AND ce.extension = ?"
+		args = append(args, strings.ToLower(strings.TrimPrefix(q.Extension, ".")))
+	}
+	if q.ContentClass != "" {
+		query += " AND ce.content_class = ?"
+		args = append(args, q.ContentClass)
+	}
+	query += " ORDER BY ce.file_path LIMIT ?"
+	args = append(args, limit)
+
+	rows, err := s.db.Query(query, args...)
 	if err != nil {
 		return nil, err
 	}
@@ -3193,7 +3989,8 @@ func (s *Service) SearchCatalog(ctx context.Context, pattern string, limit int)
 	var entries []models.CatalogEntry
 	for rows.Next() {
 		var e models.CatalogEntry
-		if err := rows.Scan(&e.ID, &e.BackupSetID, &e.FilePath, &e.FileSize, &e.FileMode, &e.ModTime, &e.Checksum, &e.BlockOffset, &e.TapeID, &e.TapeLabel); err != nil {
+		if err := rows.Scan(&e.ID, &e.BackupSetID, &e.FilePath, &e.FileSize, &e.FileMode, &e.ModTime, &e.Checksum, &e.BlockOffset, &e.TapeID, &e.TapeLabel,
+			&e.UID, &e.GID, &e.Owner, &e.Group, &e.FileType, &e.LinkTarget, &e.HasXattrs, &e.Extension, &e.ContentClass); err != nil {
 			continue
 		}
 		entries = append(entries, e)
@@ -6,17 +6,23 @@ import (
 	"context"
 	"encoding/base64"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"net"
 	"os"
 	"path/filepath"
+	"reflect"
 	"sort"
+	"strings"
 	"sync"
 	"sync/atomic"
 	"testing"
 	"time"
 
 	"github.com/RoseOO/TapeBackarr/internal/database"
+	"github.com/RoseOO/TapeBackarr/internal/i18n"
 	"github.com/RoseOO/TapeBackarr/internal/models"
+	"github.com/RoseOO/TapeBackarr/internal/tape"
 )
 
 func TestCalculateChecksum(t *testing.T) {
@@ -516,8 +522,8 @@ func TestEventCallback(t *testing.T) {
 	svc := NewService(nil, nil, nil, 65536, 512, 0)
 
 	var receivedEvents []string
-	svc.EventCallback = func(eventType, category, title, message string) {
-		receivedEvents = append(receivedEvents, eventType+":"+title)
+	svc.EventCallback = func(eventType, category, key string, args ...interface{}) {
+		receivedEvents = append(receivedEvents, eventType+":"+i18n.T(i18n.English, "event."+key+".title", args...))
 	}
 
 	// Register a job
@@ -554,7 +560,9 @@ func TestBackupFailureEmitsErrorEvent(t *testing.T) {
 	svc := NewService(nil, nil, nil, 65536, 512, 0)
 
 	var receivedEvents []string
-	svc.EventCallback = func(eventType, category, title, message string) {
+	svc.EventCallback = func(eventType, category, key string, args ...interface{}) {
+		title := i18n.T(i18n.English, "event."+key+".title", args...)
+		message := i18n.T(i18n.English, "event."+key+".message", args...)
 		receivedEvents = append(receivedEvents, eventType+":"+title+":"+message)
 	}
 
@@ -579,7 +587,7 @@ func TestBackupFailureEmitsErrorEvent(t *testing.T) {
 	}
 
 	// Direct emitEvent for backup failure should also work
-	svc.emitEvent("error", "backup", "Backup Failed", "Job test-job failed: some error")
+	svc.emitEvent("error", "backup", "backup_failed", "test-job", "some error")
 	if len(receivedEvents) != 2 {
 		t.Fatalf("expected 2 events, got %d", len(receivedEvents))
 	}
@@ -2323,3 +2331,773 @@ func TestDeferredChecksumStartOnce(t *testing.T) {
 		t.Errorf("expected start to be called exactly once, got %d", got)
 	}
 }
+
+func TestScanSourceWithReport(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	os.MkdirAll(filepath.Join(tmpDir, ".snapshots"), 0755)
+	os.WriteFile(filepath.Join(tmpDir, ".snapshots", "old.txt"), []byte("old"), 0644)
+	os.WriteFile(filepath.Join(tmpDir, "keep.txt"), []byte("keep"), 0644)
+	os.WriteFile(filepath.Join(tmpDir, "debug.log"), []byte("log"), 0644)
+	listener, err := net.Listen("unix", filepath.Join(tmpDir, "app.sock"))
+	if err != nil {
+		t.Fatalf("failed to create socket: %v", err)
+	}
+	defer listener.Close()
+
+	svc := &Service{}
+	excludeJSON, _ := json.Marshal([]string{".snapshots", "*.log"})
+	source := &models.BackupSource{Path: tmpDir, ExcludePatterns: string(excludeJSON)}
+
+	files, report, err := svc.ScanSourceWithReport(context.Background(), source)
+	if err != nil {
+		t.Fatalf("ScanSourceWithReport failed: %v", err)
+	}
+	if len(files) != 1 || filepath.Base(files[0].Path) != "keep.txt" {
+		t.Fatalf("expected only keep.txt, got %v", files)
+	}
+	if report.Total != 3 {
+		t.Errorf("expected 3 skipped paths, got %d (%v)", report.Total, report.Paths)
+	}
+	if report.Counts[SkipExcluded] != 2 {
+		t.Errorf("expected 2 excluded paths, got %d", report.Counts[SkipExcluded])
+	}
+	if report.Counts[SkipSpecialFile] != 1 {
+		t.Errorf("expected 1 special file, got %d", report.Counts[SkipSpecialFile])
+	}
+}
+
+func TestScanSourceWithReportMissingRoot(t *testing.T) {
+	svc := &Service{}
+	source := &models.BackupSource{Path: filepath.Join(t.TempDir(), "gone")}
+
+	_, report, err := svc.ScanSourceWithReport(context.Background(), source)
+	if err != nil {
+		t.Fatalf("ScanSourceWithReport failed: %v", err)
+	}
+	if report.Counts[SkipVanished] != 1 {
+		t.Errorf("expected missing root to be reported as vanished, got %v", report.Counts)
+	}
+}
+
+func TestSaveSkipReport(t *testing.T) {
+	db, err := database.New(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("failed to create database: %v", err)
+	}
+	defer db.Close()
+	if err := db.Migrate(); err != nil {
+		t.Fatalf("failed to migrate database: %v", err)
+	}
+	db.Exec("INSERT INTO tapes (uuid, barcode, label, pool_id, status, capacity_bytes, used_bytes) VALUES ('uuid1', 'T001', 'T001', 1, 'active', 1500000000000, 0)")
+	db.Exec("INSERT INTO backup_sources (name, source_type, path) VALUES ('src', 'local', '/tmp')")
+	db.Exec("INSERT INTO backup_jobs (name, source_id, pool_id, backup_type, schedule_cron, retention_days) VALUES ('job', 1, 1, 'full', '', 30)")
+	result, err := db.Exec("INSERT INTO backup_sets (job_id, tape_id, backup_type, start_time, status) VALUES (1, 1, 'full', CURRENT_TIMESTAMP, 'running')")
+	if err != nil {
+		t.Fatalf("failed to insert backup set: %v", err)
+	}
+	backupSetID, _ := result.LastInsertId()
+
+	report := NewSkipReport()
+	report.Add("/data/private", SkipPermissionDenied, "open /data/private: permission denied")
+	report.Add("/data/cache", SkipExcluded, "")
+
+	svc := &Service{db: db}
+	if err := svc.saveSkipReport(backupSetID, report); err != nil {
+		t.Fatalf("saveSkipReport failed: %v", err)
+	}
+
+	var skippedCount int64
+	var summary string
+	db.QueryRow("SELECT skipped_count, skip_summary FROM backup_sets WHERE id = ?", backupSetID).Scan(&skippedCount, &summary)
+	if skippedCount != 2 {
+		t.Errorf("expected skipped_count 2, got %d", skippedCount)
+	}
+	var decoded struct {
+		Counts map[SkipReason]int64 `json:"counts"`
+	}
+	if err := json.Unmarshal([]byte(summary), &decoded); err != nil || decoded.Counts[SkipPermissionDenied] != 1 {
+		t.Errorf("unexpected skip summary %q: %v", summary, err)
+	}
+
+	var rows int
+	db.QueryRow("SELECT COUNT(*) FROM backup_skipped_paths WHERE backup_set_id = ?", backupSetID).Scan(&rows)
+	if rows != 2 {
+		t.Errorf("expected 2 skipped path rows, got %d", rows)
+	}
+}
+
+func TestScanSourceSymlinkPolicies(t *testing.T) {
+	tmpDir := t.TempDir()
+	outside := t.TempDir()
+	os.WriteFile(filepath.Join(outside, "target.txt"), []byte("outside data"), 0644)
+
+	src := filepath.Join(tmpDir, "src")
+	os.MkdirAll(src, 0755)
+	os.WriteFile(filepath.Join(src, "real.txt"), []byte("real"), 0644)
+	os.Symlink(filepath.Join(outside, "target.txt"), filepath.Join(src, "file-link"))
+	os.Symlink(outside, filepath.Join(src, "dir-link"))
+	os.Symlink(filepath.Join(tmpDir, "missing"), filepath.Join(src, "dangling"))
+	os.Symlink(src, filepath.Join(src, "loop"))
+
+	svc := &Service{}
+	scan := func(policy models.SymlinkPolicy) ([]FileInfo, *SkipReport) {
+		t.Helper()
+		files, report, err := svc.ScanSourceWithReport(context.Background(), &models.BackupSource{Path: src, SymlinkPolicy: policy})
+		if err != nil {
+			t.Fatalf("scan with policy %s failed: %v", policy, err)
+		}
+		sort.Slice(files, func(i, j int) bool { return files[i].Path < files[j].Path })
+		return files, report
+	}
+
+	// store: every link is archived as a link, including the dangling one
+	files, report := scan(models.SymlinkStore)
+	if len(files) != 5 || report.Total != 0 {
+		t.Errorf("store: expected 5 entries and no skips, got %d entries, %d skips", len(files), report.Total)
+	}
+	for _, f := range files {
+		if f.FollowLink {
+			t.Errorf("store: %s should not be followed", f.Path)
+		}
+	}
+
+	// skip: only the regular file remains
+	files, report = scan(models.SymlinkSkip)
+	if len(files) != 1 || report.Counts[SkipSymlink] != 4 {
+		t.Errorf("skip: expected 1 file and 4 skipped links, got %d files, %v", len(files), report.Counts)
+	}
+
+	// follow: link targets are archived under the link names
+	files, report = scan(models.SymlinkFollow)
+	var paths []string
+	for _, f := range files {
+		rel, _ := filepath.Rel(src, f.Path)
+		paths = append(paths, rel)
+	}
+	want := []string{"dir-link/target.txt", "file-link", "real.txt"}
+	if strings.Join(paths, ",") != strings.Join(want, ",") {
+		t.Errorf("follow: expected %v, got %v", want, paths)
+	}
+	if report.Counts[SkipDanglingSymlink] != 1 || report.Counts[SkipSymlinkLoop] != 1 {
+		t.Errorf("follow: expected one dangling and one loop skip, got %v", report.Counts)
+	}
+	if !hasFollowedLinks(files) {
+		t.Error("follow: expected followed links to require tar --dereference")
+	}
+}
+
+func TestCheckTapeWritable(t *testing.T) {
+	db, err := database.New(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("failed to create database: %v", err)
+	}
+	defer db.Close()
+	if err := db.Migrate(); err != nil {
+		t.Fatalf("failed to migrate database: %v", err)
+	}
+
+	db.Exec("INSERT INTO tape_pools (name) VALUES ('test-pool')")
+	db.Exec("INSERT INTO tapes (uuid, barcode, label, pool_id, lto_type, status) VALUES ('u1', 'L7', 'OLD-LTO7', 1, 'LTO-7', 'blank')")
+	db.Exec("INSERT INTO tapes (uuid, barcode, label, pool_id, lto_type, status) VALUES ('u2', 'L9', 'NEW-LTO9', 1, 'LTO-9', 'blank')")
+	db.Exec("INSERT INTO tapes (uuid, barcode, label, pool_id, status) VALUES ('u3', 'UNK', 'UNKNOWN', 1, 'blank')")
+	if _, err := db.Exec("INSERT INTO tape_drives (device_path, display_name, model, status, enabled) VALUES ('/dev/nst0', 'Drive A', 'ULTRIUM-HH9', 'ready', 1)"); err != nil {
+		t.Fatalf("failed to insert drive: %v", err)
+	}
+
+	svc := NewService(db, nil, nil, 65536, 512, 0)
+
+	if err := svc.CheckTapeWritable(1); !errors.Is(err, ErrIncompatibleMedia) {
+		t.Errorf("expected LTO-7 media to be rejected by an LTO-9 drive, got %v", err)
+	}
+	if err := svc.CheckTapeWritable(2); err != nil {
+		t.Errorf("LTO-9 media should be writable: %v", err)
+	}
+	if err := svc.CheckTapeWritable(3); err != nil {
+		t.Errorf("tape of unknown generation should not be rejected: %v", err)
+	}
+
+	// A second drive that can write LTO-7 makes the tape usable...
+	db.Exec("INSERT INTO tape_drives (device_path, display_name, model, status, enabled) VALUES ('/dev/nst1', 'Drive B', 'ULTRIUM-HH8', 'ready', 1)")
+	if err := svc.CheckTapeWritable(1); err != nil {
+		t.Errorf("expected LTO-8 drive to accept LTO-7 media: %v", err)
+	}
+
+	// ...unless the tape is already loaded in the drive that cannot
+	db.Exec("UPDATE tape_drives SET current_tape_id = 1 WHERE device_path = '/dev/nst0'")
+	if err := svc.CheckTapeWritable(1); err == nil || !strings.Contains(err.Error(), "loaded in drive Drive A") {
+		t.Errorf("expected loaded-drive rejection, got %v", err)
+	}
+}
+
+func TestFindDuplicates(t *testing.T) {
+	db, err := database.New(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("failed to create database: %v", err)
+	}
+	defer db.Close()
+	if err := db.Migrate(); err != nil {
+		t.Fatalf("failed to migrate database: %v", err)
+	}
+
+	src := t.TempDir()
+	mtime := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	write := func(name, content string, mt time.Time) FileInfo {
+		p := filepath.Join(src, name)
+		os.WriteFile(p, []byte(content), 0644)
+		os.Chtimes(p, mt, mt)
+		info, _ := os.Stat(p)
+		return FileInfo{Path: p, Size: info.Size(), Mode: int(info.Mode()), ModTime: info.ModTime()}
+	}
+	same := write("same.txt", "duplicate data", mtime)
+	renamed := write("renamed.txt", "duplicate data", mtime)
+	changed := write("changed.txt", "different data", mtime)
+	touched := write("touched.txt", "duplicate data", mtime.Add(time.Hour))
+
+	svc := &Service{db: db}
+	checksum, _ := svc.CalculateChecksum(same.Path)
+
+	db.Exec("INSERT INTO tapes (uuid, barcode, label, pool_id, status, capacity_bytes, used_bytes) VALUES ('u1', 'T001', 'T001', 1, 'full', 1000, 100)")
+	db.Exec("INSERT INTO tapes (uuid, barcode, label, pool_id, status, capacity_bytes, used_bytes) VALUES ('u2', 'T002', 'T002', 1, 'active', 1000, 0)")
+	db.Exec("INSERT INTO backup_sources (name, source_type, path) VALUES ('src', 'local', ?)", src)
+	db.Exec("INSERT INTO backup_jobs (name, source_id, pool_id, backup_type, schedule_cron, retention_days) VALUES ('job', 1, 1, 'full', '', 30)")
+	db.Exec("INSERT INTO backup_sets (job_id, tape_id, backup_type, start_time, end_time, status) VALUES (1, 1, 'full', CURRENT_TIMESTAMP, CURRENT_TIMESTAMP, 'completed')")
+	db.Exec("INSERT INTO catalog_entries (backup_set_id, file_path, file_size, file_mode, mod_time, checksum) VALUES (1, 'same.txt', ?, ?, ?, ?)",
+		same.Size, same.Mode, same.ModTime, checksum)
+	db.Exec("INSERT INTO backup_sets (job_id, tape_id, backup_type, start_time, status) VALUES (1, 2, 'full', CURRENT_TIMESTAMP, 'running')")
+
+	files := []FileInfo{same, renamed, changed, touched}
+	toWrite, refs := svc.FindDuplicates(context.Background(), 1, src, files)
+	if len(refs) != 2 || len(toWrite) != 2 {
+		t.Fatalf("expected 2 references and 2 files to write, got %d and %d", len(refs), len(toWrite))
+	}
+	for _, r := range refs {
+		if r.SetID != 1 || r.DataPath != "same.txt" || r.Checksum != checksum {
+			t.Errorf("unexpected reference %+v", r)
+		}
+	}
+	if refs[1].RelPath != "renamed.txt" {
+		t.Errorf("expected renamed.txt to reference same.txt, got %s", refs[1].RelPath)
+	}
+
+	if err := svc.recordDedupRefs(2, refs); err != nil {
+		t.Fatalf("recordDedupRefs failed: %v", err)
+	}
+	var count, bytes int64
+	db.QueryRow("SELECT dedup_count, dedup_bytes FROM backup_sets WHERE id = 2").Scan(&count, &bytes)
+	if count != 2 || bytes != 2*same.Size {
+		t.Errorf("expected dedup totals 2/%d, got %d/%d", 2*same.Size, count, bytes)
+	}
+
+	// References are never used as a source for further references, and
+	// expired tapes no longer count as holding the data
+	db.Exec("UPDATE backup_sets SET status = 'completed', end_time = CURRENT_TIMESTAMP WHERE id = 2")
+	db.Exec("UPDATE tapes SET status = 'expired' WHERE id = 1")
+	if _, refs := svc.FindDuplicates(context.Background(), 1, src, files); len(refs) != 0 {
+		t.Errorf("expected no references once the data tape expired, got %+v", refs)
+	}
+
+	// Other pools are not searched
+	db.Exec("UPDATE tapes SET status = 'full' WHERE id = 1")
+	if _, refs := svc.FindDuplicates(context.Background(), 2, src, files); len(refs) != 0 {
+		t.Errorf("expected no references from another pool, got %+v", refs)
+	}
+}
+
+func TestSnapshotFromCatalogAndPrune(t *testing.T) {
+	db, err := database.New(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("failed to create database: %v", err)
+	}
+	defer db.Close()
+	if err := db.Migrate(); err != nil {
+		t.Fatalf("failed to migrate database: %v", err)
+	}
+	svc := &Service{db: db}
+
+	if _, _, err := svc.SnapshotFromCatalog(context.Background(), 1, "/data"); err != ErrNoCatalogChain {
+		t.Fatalf("expected ErrNoCatalogChain without backups, got %v", err)
+	}
+
+	t0 := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	db.Exec("INSERT INTO tapes (uuid, barcode, label, pool_id, status, capacity_bytes, used_bytes) VALUES ('u1', 'T001', 'T001', 1, 'active', 1000, 0)")
+	db.Exec("INSERT INTO backup_sources (name, source_type, path) VALUES ('src', 'local', '/data')")
+	db.Exec("INSERT INTO backup_jobs (name, source_id, pool_id, backup_type, schedule_cron, retention_days) VALUES ('job', 1, 1, 'incremental', '', 30)")
+	// Set 1 is an older full backup superseded by set 2; set 4 failed
+	sets := []struct {
+		backupType, status string
+		start              time.Time
+	}{
+		{"full", "completed", t0},
+		{"full", "completed", t0.Add(24 * time.Hour)},
+		{"incremental", "completed", t0.Add(48 * time.Hour)},
+		{"incremental", "failed", t0.Add(72 * time.Hour)},
+	}
+	for _, s := range sets {
+		db.Exec("INSERT INTO backup_sets (job_id, tape_id, backup_type, start_time, status) VALUES (1, 1, ?, ?, ?)", s.backupType, s.start, s.status)
+	}
+	entry := "INSERT INTO catalog_entries (backup_set_id, file_path, file_size, file_mode, mod_time) VALUES (?, ?, ?, 420, ?)"
+	db.Exec(entry, 1, "old.txt", 1, t0)
+	db.Exec(entry, 2, "a.txt", 10, t0)
+	db.Exec(entry, 2, "b.txt", 20, t0)
+	db.Exec(entry, 3, "b.txt", 25, t0.Add(48*time.Hour))
+	db.Exec(entry, 3, "c.txt", 30, t0.Add(48*time.Hour))
+	db.Exec(entry, 4, "d.txt", 40, t0.Add(72*time.Hour))
+
+	files, setID, err := svc.SnapshotFromCatalog(context.Background(), 1, "/data")
+	if err != nil {
+		t.Fatalf("SnapshotFromCatalog: %v", err)
+	}
+	if setID != 3 {
+		t.Errorf("expected the chain to end at set 3, got %d", setID)
+	}
+	got := make(map[string]int64)
+	for _, f := range files {
+		got[f.Path] = f.Size
+	}
+	want := map[string]int64{"/data/a.txt": 10, "/data/b.txt": 25, "/data/c.txt": 30}
+	if len(got) != len(want) {
+		t.Fatalf("expected %v, got %v", want, got)
+	}
+	for p, size := range want {
+		if got[p] != size {
+			t.Errorf("%s: expected size %d, got %d", p, size, got[p])
+		}
+	}
+
+	// Unchanged files are not picked up by an incremental against the rebuild
+	current := []FileInfo{
+		{Path: "/data/a.txt", Size: 10, ModTime: t0},
+		{Path: "/data/b.txt", Size: 25, ModTime: t0.Add(48 * time.Hour)},
+		{Path: "/data/e.txt", Size: 5, ModTime: t0.Add(96 * time.Hour)},
+	}
+	if changed := changedSince(current, files); len(changed) != 1 || changed[0].Path != "/data/e.txt" {
+		t.Errorf("expected only e.txt to be new, got %+v", changed)
+	}
+
+	var ids []int64
+	for setID := int64(1); setID <= 3; setID++ {
+		id, err := svc.SaveSnapshot(1, setID, files)
+		if err != nil {
+			t.Fatalf("SaveSnapshot: %v", err)
+		}
+		ids = append(ids, id)
+	}
+	db.Exec("UPDATE snapshots SET pinned = 1 WHERE id = ?", ids[0])
+
+	if pruned, err := svc.PruneSnapshots(1, 0); err != nil || pruned != 0 {
+		t.Errorf("expected retention 0 to keep everything, pruned %d (%v)", pruned, err)
+	}
+	pruned, err := svc.PruneSnapshots(1, 1)
+	if err != nil {
+		t.Fatalf("PruneSnapshots: %v", err)
+	}
+	if pruned != 1 {
+		t.Errorf("expected 1 snapshot pruned, got %d", pruned)
+	}
+	var remaining []int64
+	rows, _ := db.Query("SELECT id FROM snapshots ORDER BY id")
+	for rows.Next() {
+		var id int64
+		rows.Scan(&id)
+		remaining = append(remaining, id)
+	}
+	rows.Close()
+	if len(remaining) != 2 || remaining[0] != ids[0] || remaining[1] != ids[2] {
+		t.Errorf("expected the pinned and newest snapshots to remain, got %v", remaining)
+	}
+}
+
+func TestFullBackupDue(t *testing.T) {
+	db, err := database.New(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("failed to create database: %v", err)
+	}
+	defer db.Close()
+	if err := db.Migrate(); err != nil {
+		t.Fatalf("failed to migrate database: %v", err)
+	}
+	svc := &Service{db: db}
+
+	db.Exec("INSERT INTO tapes (uuid, barcode, label, pool_id, status, capacity_bytes, used_bytes) VALUES ('u1', 'T001', 'T001', 1, 'active', 1000, 0)")
+	db.Exec("INSERT INTO backup_sources (name, source_type, path) VALUES ('src', 'local', '/data')")
+	db.Exec("INSERT INTO backup_jobs (name, source_id, pool_id, backup_type, schedule_cron, retention_days) VALUES ('job', 1, 1, 'incremental', '', 30)")
+	now := time.Date(2024, 3, 20, 2, 0, 0, 0, time.UTC)
+	addSet := func(backupType, status string, start time.Time) int64 {
+		result, _ := db.Exec("INSERT INTO backup_sets (job_id, tape_id, backup_type, start_time, status) VALUES (1, 1, ?, ?, ?)", backupType, start, status)
+		id, _ := result.LastInsertId()
+		return id
+	}
+
+	job := &models.BackupJob{ID: 1, BackupType: models.BackupTypeIncremental}
+	if reason, _ := svc.FullBackupDue(job, now); reason != "" {
+		t.Errorf("expected no promotion without a policy, got %q", reason)
+	}
+
+	job.FullEveryIncrementals = 3
+	if reason, _ := svc.FullBackupDue(job, now); !strings.Contains(reason, "no completed full") {
+		t.Errorf("expected promotion without a full backup, got %q", reason)
+	}
+
+	addSet("full", "completed", now.AddDate(0, 0, -10))
+	addSet("incremental", "completed", now.AddDate(0, 0, -3))
+	addSet("incremental", "failed", now.AddDate(0, 0, -2))
+	// The second tape of a spanned incremental is the same run
+	addSet("incremental", "completed", now.AddDate(0, 0, -1))
+	cont := addSet("incremental", "completed", now.AddDate(0, 0, -1))
+	db.Exec("INSERT INTO tape_spanning_sets (job_id, total_tapes, status) VALUES (1, 2, 'completed')")
+	db.Exec("INSERT INTO tape_spanning_members (spanning_set_id, tape_id, backup_set_id, sequence_number) VALUES (1, 1, ?, 2)", cont)
+
+	reason, err := svc.FullBackupDue(job, now)
+	if err != nil {
+		t.Fatalf("FullBackupDue: %v", err)
+	}
+	if reason != "" {
+		t.Errorf("expected 2 incrementals to stay under the limit of 3, got %q", reason)
+	}
+
+	addSet("incremental", "completed", now.Add(-time.Hour))
+	if reason, _ := svc.FullBackupDue(job, now); !strings.Contains(reason, "3 incrementals") {
+		t.Errorf("expected promotion after 3 incrementals, got %q", reason)
+	}
+
+	job.FullEveryIncrementals, job.FullEveryDays = 0, 7
+	if reason, _ := svc.FullBackupDue(job, now); !strings.Contains(reason, "10 days") {
+		t.Errorf("expected promotion after 10 days, got %q", reason)
+	}
+	job.FullEveryDays = 14
+	if reason, _ := svc.FullBackupDue(job, now); reason != "" {
+		t.Errorf("expected no promotion within 14 days, got %q", reason)
+	}
+}
+
+func TestRebuildCatalogFromTape(t *testing.T) {
+	ctx := context.Background()
+	db, err := database.New(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("failed to open database: %v", err)
+	}
+	defer db.Close()
+	if err := db.Migrate(); err != nil {
+		t.Fatalf("failed to migrate: %v", err)
+	}
+	svc := &Service{db: db}
+
+	drive := tape.NewServiceForDevice("file://"+t.TempDir(), 65536)
+	if _, err := svc.RebuildCatalogFromTape(ctx, drive, false); !errors.Is(err, ErrUnlabeledTape) {
+		t.Fatalf("expected ErrUnlabeledTape for blank media, got %v", err)
+	}
+
+	if err := drive.WriteTapeLabel(ctx, "RB0001", "uuid-rb", "OFFSITE"); err != nil {
+		t.Fatalf("WriteTapeLabel: %v", err)
+	}
+	if err := drive.SeekToFileNumber(ctx, 1); err != nil {
+		t.Fatalf("SeekToFileNumber: %v", err)
+	}
+	w, err := drive.OpenWriter(ctx)
+	if err != nil {
+		t.Fatalf("OpenWriter: %v", err)
+	}
+	w.Write([]byte("tar payload"))
+	w.Close()
+	if err := drive.WriteFileMark(ctx); err != nil {
+		t.Fatalf("WriteFileMark: %v", err)
+	}
+	start := time.Date(2026, 3, 1, 2, 0, 0, 0, time.UTC)
+	toc := tape.NewTapeTOC("RB0001", "uuid-rb", "OFFSITE")
+	toc.BackupSets = []tape.TOCBackupSet{{
+		FileNumber:      1,
+		JobName:         "Nightly Home",
+		BackupType:      "full",
+		StartTime:       start,
+		EndTime:         start.Add(time.Hour),
+		FileCount:       2,
+		TotalBytes:      300,
+		Compressed:      true,
+		CompressionType: "zstd",
+		Files: []tape.TOCFileEntry{
+			{Path: "docs/a.txt", Size: 100, Mode: 0644, ModTime: start.Format(time.RFC3339), Checksum: "aa"},
+			{Path: "docs/b.txt", Size: 200, Mode: 0644, ModTime: start.Format(time.RFC3339), Checksum: "bb"},
+		},
+	}}
+	if err := drive.WriteTOC(ctx, toc); err != nil {
+		t.Fatalf("WriteTOC: %v", err)
+	}
+
+	// A dry run reports what would be recovered without writing anything
+	result, err := svc.RebuildCatalogFromTape(ctx, drive, true)
+	if err != nil {
+		t.Fatalf("dry run: %v", err)
+	}
+	if !result.TapeCreated || len(result.Sets) != 1 || result.Sets[0].DataFile != 1 || result.Sets[0].JobName != "Nightly Home" {
+		t.Fatalf("unexpected dry run result %+v", result)
+	}
+	var count int
+	db.QueryRow("SELECT COUNT(*) FROM tapes").Scan(&count)
+	if count != 0 {
+		t.Fatalf("dry run recorded %d tapes", count)
+	}
+
+	result, err = svc.RebuildCatalogFromTape(ctx, drive, false)
+	if err != nil {
+		t.Fatalf("rebuild: %v", err)
+	}
+	if result.TapeID == 0 || len(result.Sets) != 1 || result.Sets[0].BackupSetID == 0 {
+		t.Fatalf("unexpected result %+v", result)
+	}
+
+	var status, poolName string
+	var usedBytes int64
+	db.QueryRow(`SELECT t.status, p.name, t.used_bytes FROM tapes t JOIN tape_pools p ON t.pool_id = p.id
+		WHERE t.uuid = 'uuid-rb'`).Scan(&status, &poolName, &usedBytes)
+	if status != "full" || poolName != "OFFSITE" || usedBytes != 300 {
+		t.Fatalf("unexpected tape row: status=%s pool=%s used=%d", status, poolName, usedBytes)
+	}
+
+	var setStatus, compression string
+	var enabled bool
+	var fileCount int64
+	db.QueryRow(`SELECT bs.status, bs.compression_type, bs.file_count, j.enabled FROM backup_sets bs
+		JOIN backup_jobs j ON bs.job_id = j.id WHERE bs.id = ?`, result.Sets[0].BackupSetID).Scan(&setStatus, &compression, &fileCount, &enabled)
+	if setStatus != "completed" || compression != "zstd" || fileCount != 2 || enabled {
+		t.Fatalf("unexpected set row: status=%s compression=%s files=%d job enabled=%v", setStatus, compression, fileCount, enabled)
+	}
+	db.QueryRow("SELECT COUNT(*) FROM catalog_entries WHERE backup_set_id = ?", result.Sets[0].BackupSetID).Scan(&count)
+	if count != 2 {
+		t.Fatalf("expected 2 catalog entries, got %d", count)
+	}
+
+	// Rescanning the same tape leaves the catalog untouched
+	result, err = svc.RebuildCatalogFromTape(ctx, drive, false)
+	if err != nil {
+		t.Fatalf("rescan: %v", err)
+	}
+	if result.TapeCreated || len(result.Sets) != 1 || !result.Sets[0].Existing {
+		t.Fatalf("expected rescan to find the existing set, got %+v", result)
+	}
+	db.QueryRow("SELECT COUNT(*) FROM backup_sets").Scan(&count)
+	if count != 1 {
+		t.Fatalf("expected 1 backup set after rescan, got %d", count)
+	}
+}
+
+func TestBackupWindowReport(t *testing.T) {
+	db, err := database.New(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("failed to create database: %v", err)
+	}
+	defer db.Close()
+	if err := db.Migrate(); err != nil {
+		t.Fatalf("failed to migrate database: %v", err)
+	}
+	svc := &Service{db: db}
+
+	db.Exec("INSERT INTO tapes (uuid, barcode, label, pool_id, status, capacity_bytes, used_bytes) VALUES ('u1', 'T001', 'T001', 1, 'active', 1000, 0)")
+	db.Exec("INSERT INTO tapes (uuid, barcode, label, pool_id, status, capacity_bytes, used_bytes) VALUES ('u2', 'T002', 'T002', 1, 'active', 1000, 0)")
+	db.Exec("INSERT INTO backup_sources (name, source_type, path) VALUES ('src', 'local', '/data')")
+	db.Exec("INSERT INTO backup_jobs (name, source_id, pool_id, backup_type, schedule_cron, retention_days) VALUES ('home', 1, 1, 'full', '', 30)")
+	db.Exec("INSERT INTO backup_jobs (name, source_id, pool_id, backup_type, schedule_cron, retention_days) VALUES ('mail', 1, 1, 'full', '', 30)")
+	db.Exec("INSERT INTO backup_jobs (name, source_id, pool_id, backup_type, schedule_cron, retention_days, ad_hoc) VALUES ('adhoc', 1, 1, 'full', '', 30, 1)")
+	to := time.Date(2024, 3, 20, 7, 0, 0, 0, time.UTC)
+	from := to.Add(-24 * time.Hour)
+	addSet := func(jobID, tapeID int64, status string, start time.Time, bytes int64) int64 {
+		result, _ := db.Exec("INSERT INTO backup_sets (job_id, tape_id, backup_type, start_time, status, file_count, total_bytes) VALUES (?, ?, 'full', ?, ?, 10, ?)",
+			jobID, tapeID, start, status, bytes)
+		id, _ := result.LastInsertId()
+		return id
+	}
+
+	addSet(1, 1, "completed", from.Add(-time.Hour), 999) // previous window
+	addSet(1, 1, "completed", to.Add(-5*time.Hour), 100)
+	cont := addSet(1, 2, "completed", to.Add(-5*time.Hour), 50)
+	db.Exec("INSERT INTO tape_spanning_sets (job_id, total_tapes, status) VALUES (1, 2, 'completed')")
+	db.Exec("INSERT INTO tape_spanning_members (spanning_set_id, tape_id, backup_set_id, sequence_number) VALUES (1, 2, ?, 2)", cont)
+	addSet(2, 1, "failed", to.Add(-4*time.Hour), 20)
+	addSet(3, 1, "completed", to.Add(-3*time.Hour), 500) // ad-hoc
+
+	report, err := svc.BackupWindowReport(from, to)
+	if err != nil {
+		t.Fatalf("BackupWindowReport: %v", err)
+	}
+	if report.Succeeded != 1 || report.Failed != 1 || report.Running != 0 {
+		t.Errorf("expected 1 succeeded and 1 failed, got %+v", report)
+	}
+	if report.Bytes != 170 || report.Files != 20 {
+		t.Errorf("expected 170 bytes in 20 files, got %d bytes in %d files", report.Bytes, report.Files)
+	}
+	if len(report.Tapes) != 2 || report.Tapes[0] != "T001" || report.Tapes[1] != "T002" {
+		t.Errorf("expected tapes T001 and T002, got %v", report.Tapes)
+	}
+	if len(report.Jobs) != 2 || report.Jobs[0].JobName != "home" || report.Jobs[0].Runs != 1 || report.Jobs[0].Bytes != 150 {
+		t.Fatalf("unexpected jobs: %+v", report.Jobs)
+	}
+
+	// The scheduler's error is attached to the failed set; a run that never
+	// wrote a set counts as another failure.
+	report.AddFailure(2, "mail", "write error")
+	report.AddFailure(1, "home", "no available tape in pool")
+	if report.Failed != 2 || report.Jobs[1].Error != "write error" || report.Jobs[1].Runs != 1 {
+		t.Errorf("expected the error on the failed mail run, got %+v", report.Jobs[1])
+	}
+	if report.Jobs[0].Runs != 2 || report.Jobs[0].Failed != 1 || report.Jobs[0].Error == "" {
+		t.Errorf("expected an extra failed home run, got %+v", report.Jobs[0])
+	}
+}
+
+func TestJobRecipients(t *testing.T) {
+	db, err := database.New(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("failed to create database: %v", err)
+	}
+	defer db.Close()
+	if err := db.Migrate(); err != nil {
+		t.Fatalf("failed to migrate database: %v", err)
+	}
+	svc := &Service{db: db}
+
+	db.Exec("INSERT INTO backup_sources (name, source_type, path) VALUES ('src', 'local', '/data')")
+	result, err := db.Exec("INSERT INTO users (username, password_hash, role) VALUES ('alice', 'x', 'operator')")
+	if err != nil {
+		t.Fatalf("failed to insert user: %v", err)
+	}
+	ownerID, _ := result.LastInsertId()
+	db.Exec("INSERT INTO user_preferences (user_id, language, notify_email, notify_telegram_chat_id) VALUES (?, 'de', 'alice@example.com', '555')", ownerID)
+	db.Exec("INSERT INTO backup_jobs (name, source_id, pool_id, backup_type, schedule_cron, retention_days) VALUES ('plain', 1, 1, 'full', '', 30)")
+	db.Exec(`INSERT INTO backup_jobs (name, source_id, pool_id, backup_type, schedule_cron, retention_days, owner_id, notify_emails, notify_telegram_chat_id, notify_global)
+		VALUES ('owned', 1, 1, 'full', '', 30, ?, 'team@example.com, alice@example.com', '-100', 1)`, ownerID)
+
+	r, err := svc.JobRecipients(1)
+	if err != nil {
+		t.Fatalf("JobRecipients: %v", err)
+	}
+	if r.HasTargets() || r.IncludeGlobal || r.Language != "" {
+		t.Errorf("job without owner or recipients = %+v, want empty", r)
+	}
+
+	r, err = svc.JobRecipients(2)
+	if err != nil {
+		t.Fatalf("JobRecipients: %v", err)
+	}
+	if !reflect.DeepEqual(r.Emails, []string{"team@example.com", "alice@example.com"}) {
+		t.Errorf("emails = %v", r.Emails)
+	}
+	if !reflect.DeepEqual(r.TelegramChatIDs, []string{"-100", "555"}) {
+		t.Errorf("chats = %v", r.TelegramChatIDs)
+	}
+	if r.Language != "de" || !r.IncludeGlobal {
+		t.Errorf("language = %q, include global = %v", r.Language, r.IncludeGlobal)
+	}
+
+	// Deleting the owner keeps the job and its own recipients
+	if _, err := db.Exec("DELETE FROM users WHERE id = ?", ownerID); err != nil {
+		t.Fatalf("failed to delete owner: %v", err)
+	}
+	r, err = svc.JobRecipients(2)
+	if err != nil {
+		t.Fatalf("JobRecipients after owner deletion: %v", err)
+	}
+	if !reflect.DeepEqual(r.TelegramChatIDs, []string{"-100"}) {
+		t.Errorf("chats after owner deletion = %v", r.TelegramChatIDs)
+	}
+}
+
+func TestFreshness(t *testing.T) {
+	db, err := database.New(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("failed to create database: %v", err)
+	}
+	defer db.Close()
+	if err := db.Migrate(); err != nil {
+		t.Fatalf("failed to migrate database: %v", err)
+	}
+	svc := &Service{db: db}
+
+	if _, err := db.Exec("INSERT INTO tapes (uuid, barcode, label, pool_id, status, capacity_bytes, used_bytes) VALUES ('uuid1', 'T001', 'T001', 1, 'active', 1500000000000, 0)"); err != nil {
+		t.Fatalf("failed to insert tape: %v", err)
+	}
+	// alpha uses the default RPO, beta its own, gamma none; delta was never backed up
+	for _, src := range []struct {
+		name string
+		rpo  int
+	}{{"alpha", 0}, {"beta", 12}, {"gamma", -1}, {"delta", 0}} {
+		if _, err := db.Exec("INSERT INTO backup_sources (name, source_type, path, rpo_hours) VALUES (?, 'local', '/data', ?)", src.name, src.rpo); err != nil {
+			t.Fatalf("failed to insert source: %v", err)
+		}
+	}
+	db.Exec("INSERT INTO backup_sources (name, source_type, path, ad_hoc) VALUES ('adhoc', 'local', '/tmp', 1)")
+	for _, job := range []struct {
+		name     string
+		sourceID int
+		rpo      int
+	}{{"alpha-job", 1, 0}, {"beta-job", 2, 0}, {"beta-relaxed", 2, -1}, {"gamma-job", 3, 0}, {"delta-job", 4, 0}} {
+		if _, err := db.Exec("INSERT INTO backup_jobs (name, source_id, pool_id, backup_type, schedule_cron, retention_days, rpo_hours) VALUES (?, ?, 1, 'full', '', 30, ?)", job.name, job.sourceID, job.rpo); err != nil {
+			t.Fatalf("failed to insert job: %v", err)
+		}
+	}
+
+	now := time.Now().UTC().Truncate(time.Second)
+	for _, set := range []struct {
+		jobID  int
+		age    time.Duration
+		status string
+	}{
+		{1, 10 * time.Hour, "completed"},
+		{1, time.Hour, "failed"},
+		{2, 20 * time.Hour, "completed"},
+		{2, 30 * time.Hour, "completed"},
+		{4, 100 * time.Hour, "completed"},
+	} {
+		if _, err := db.Exec("INSERT INTO backup_sets (job_id, tape_id, backup_type, start_time, status) VALUES (?, 1, 'full', ?, ?)", set.jobID, now.Add(-set.age), set.status); err != nil {
+			t.Fatalf("failed to insert backup set: %v", err)
+		}
+	}
+
+	report, err := svc.Freshness(24, now)
+	if err != nil {
+		t.Fatalf("Freshness: %v", err)
+	}
+
+	sources := make(map[string]Freshness)
+	for _, f := range report.Sources {
+		sources[f.Name] = f
+	}
+	if len(sources) != 4 {
+		t.Fatalf("sources = %v, want alpha, beta, gamma and delta", report.Sources)
+	}
+	for name, want := range map[string]struct {
+		rpo       int
+		age       float64
+		violation bool
+	}{
+		"alpha": {24, 10 * 3600, false},
+		"beta":  {12, 20 * 3600, true},
+		"gamma": {0, 100 * 3600, false},
+		"delta": {24, -1, true},
+	} {
+		f := sources[name]
+		if f.RPOHours != want.rpo || f.Violation != want.violation {
+			t.Errorf("%s: rpo = %d, violation = %v; want %d, %v", name, f.RPOHours, f.Violation, want.rpo, want.violation)
+		}
+		if want.age < 0 {
+			if f.LastSuccess != nil || f.AgeSeconds != nil {
+				t.Errorf("%s: never backed up but has last success %v", name, f.LastSuccess)
+			}
+		} else if f.AgeSeconds == nil || *f.AgeSeconds != want.age {
+			t.Errorf("%s: age = %v, want %v", name, f.AgeSeconds, want.age)
+		}
+	}
+
+	jobs := make(map[string]Freshness)
+	for _, f := range report.Jobs {
+		jobs[f.Name] = f
+	}
+	if jobs["beta-job"].RPOHours != 12 || !jobs["beta-job"].Violation {
+		t.Errorf("beta-job should inherit the source RPO and violate it: %+v", jobs["beta-job"])
+	}
+	if jobs["beta-relaxed"].RPOHours != 0 || jobs["beta-relaxed"].Violation {
+		t.Errorf("beta-relaxed has no RPO: %+v", jobs["beta-relaxed"])
+	}
+	if report.SourceViolations != 2 || report.JobViolations != 2 {
+		t.Errorf("violations = %d sources, %d jobs; want 2, 2", report.SourceViolations, report.JobViolations)
+	}
+}
@@ -0,0 +1,305 @@
+package backup
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/RoseOO/TapeBackarr/internal/models"
+)
+
+// MaxSimulatedRuns caps how many scheduled runs a retention simulation will
+// replay, so a per-second schedule cannot exhaust memory.
+const MaxSimulatedRuns = 20000
+
+// Schedule yields successive run times; robfig/cron schedules satisfy it.
+type Schedule interface {
+	Next(time.Time) time.Time
+}
+
+// SimTape is a pool tape as seen by the retention simulation.
+type SimTape struct {
+	ID            int64
+	Label         string
+	Status        models.TapeStatus
+	CapacityBytes int64
+	UsedBytes     int64
+	LastWrittenAt *time.Time
+}
+
+// RetentionSimInput describes a job, its pool and the period to replay.
+type RetentionSimInput struct {
+	Start    time.Time
+	End      time.Time
+	Schedule Schedule
+	// BackupType is the type of every scheduled run. Incremental and
+	// differential jobs write a full first when FirstRunFull is set. A
+	// differential grows by IncrementalBytes per run since the full, up to
+	// FullBytes.
+	BackupType       models.BackupType
+	FirstRunFull     bool
+	FullBytes        int64
+	IncrementalBytes int64
+	// RetentionDays applies to data written during the simulation; existing
+	// tapes use ExistingRetentionDays from their last write. Zero or less
+	// means tapes are never released.
+	RetentionDays         int
+	ExistingRetentionDays int
+	AllowReuse            bool
+	// NewTapeCapacity is the capacity of each cartridge the simulation has
+	// to add when the pool runs dry.
+	NewTapeCapacity int64
+	Tapes           []SimTape
+}
+
+// RetentionSimMonth summarises one calendar month of the simulation.
+type RetentionSimMonth struct {
+	Month           string `json:"month"`
+	Runs            int    `json:"runs"`
+	BytesWritten    int64  `json:"bytes_written"`
+	TapesWritten    int    `json:"tapes_written"`
+	BlankConsumed   int    `json:"blank_tapes_consumed"`
+	TapesReused     int    `json:"tapes_reused"`
+	TapesAdded      int    `json:"tapes_added"`
+	BlankRemaining  int    `json:"blank_tapes_remaining"`
+	TapesInUse      int    `json:"tapes_in_retention"`
+	ReusableAtMonth int    `json:"tapes_reusable"`
+}
+
+// RetentionSimResult is the predicted tape consumption of a job.
+type RetentionSimResult struct {
+	Start                 time.Time           `json:"start"`
+	End                   time.Time           `json:"end"`
+	Runs                  int                 `json:"runs"`
+	FullRuns              int                 `json:"full_runs"`
+	IncrementalRuns       int                 `json:"incremental_runs"`
+	DifferentialRuns      int                 `json:"differential_runs"`
+	BytesWritten          int64               `json:"bytes_written"`
+	PoolTapes             int                 `json:"pool_tapes"`
+	BlankTapesConsumed    int                 `json:"blank_tapes_consumed"`
+	TapesReused           int                 `json:"tapes_reused"`
+	FirstReuseAt          *time.Time          `json:"first_reuse_at"`
+	AdditionalTapesNeeded int                 `json:"additional_tapes_needed"`
+	FirstShortageAt       *time.Time          `json:"first_shortage_at"`
+	PeakTapesInRetention  int                 `json:"peak_tapes_in_retention"`
+	Months                []RetentionSimMonth `json:"months"`
+}
+
+// simTapeState is a tape's mutable state during a simulation.
+type simTapeState struct {
+	capacity      int64
+	used          int64
+	status        models.TapeStatus
+	lastWrite     time.Time
+	retentionDays int
+	order         int
+}
+
+func (t *simTapeState) holdsData() bool {
+	return t.used > 0 && !t.lastWrite.IsZero()
+}
+
+// releasedAt reports whether the tape's data has passed its retention by at.
+func (t *simTapeState) releasedAt(at time.Time) bool {
+	if !t.holdsData() || t.retentionDays <= 0 {
+		return false
+	}
+	return !at.Before(t.lastWrite.AddDate(0, 0, t.retentionDays))
+}
+
+// SimulateRetention replays a job's schedule against its pool and predicts
+// how many cartridges it consumes and when expired tapes start being reused.
+// Tape choice follows the backup allocator: the active tape with the least
+// data first, then the oldest blank, then (if the pool allows reuse) the
+// expired tape written longest ago. Tapes are assumed to be expired as soon
+// as their retention lapses.
+func SimulateRetention(in RetentionSimInput) (*RetentionSimResult, error) {
+	if in.Schedule == nil {
+		return nil, errors.New("job has no schedule")
+	}
+	if !in.End.After(in.Start) {
+		return nil, errors.New("simulation end must be after start")
+	}
+	if in.NewTapeCapacity <= 0 {
+		return nil, errors.New("a tape capacity is required to model additional tapes")
+	}
+
+	var tapes []*simTapeState
+	for i, t := range in.Tapes {
+		switch t.Status {
+		case models.TapeStatusBlank, models.TapeStatusActive, models.TapeStatusFull, models.TapeStatusExpired:
+		default:
+			continue // retired and exported tapes are not available to the pool
+		}
+		if t.CapacityBytes <= 0 {
+			continue
+		}
+		st := &simTapeState{capacity: t.CapacityBytes, used: t.UsedBytes, status: t.Status, retentionDays: in.ExistingRetentionDays, order: i}
+		if t.LastWrittenAt != nil {
+			st.lastWrite = *t.LastWrittenAt
+		}
+		tapes = append(tapes, st)
+	}
+
+	result := &RetentionSimResult{Start: in.Start, End: in.End, PoolTapes: len(tapes)}
+	var month *RetentionSimMonth
+	monthTapes := make(map[*simTapeState]struct{})
+
+	closeMonth := func(at time.Time) {
+		if month == nil {
+			return
+		}
+		month.TapesWritten = len(monthTapes)
+		for _, t := range tapes {
+			switch {
+			case t.status == models.TapeStatusBlank:
+				month.BlankRemaining++
+			case t.status == models.TapeStatusExpired || t.releasedAt(at):
+				if in.AllowReuse {
+					month.ReusableAtMonth++
+				}
+			case t.holdsData():
+				month.TapesInUse++
+			}
+		}
+		result.Months = append(result.Months, *month)
+		month = nil
+		monthTapes = make(map[*simTapeState]struct{})
+	}
+	// nextMonth is the first instant of the month after the open one
+	var nextMonth time.Time
+	openMonth := func(at time.Time) {
+		month = &RetentionSimMonth{Month: at.Format("2006-01")}
+		nextMonth = time.Date(at.Year(), at.Month()+1, 1, 0, 0, 0, 0, at.Location())
+	}
+
+	pick := func(at time.Time) *simTapeState {
+		var best *simTapeState
+		for _, t := range tapes {
+			if t.status == models.TapeStatusActive && t.used < t.capacity && (best == nil || t.used < best.used) {
+				best = t
+			}
+		}
+		if best != nil {
+			return best
+		}
+		for _, t := range tapes {
+			if t.status == models.TapeStatusBlank && (best == nil || t.order < best.order) {
+				best = t
+			}
+		}
+		if best != nil {
+			month.BlankConsumed++
+			result.BlankTapesConsumed++
+			best.status = models.TapeStatusActive
+			return best
+		}
+		if in.AllowReuse {
+			for _, t := range tapes {
+				if t.status == models.TapeStatusExpired && (best == nil || t.lastWrite.Before(best.lastWrite)) {
+					best = t
+				}
+			}
+			if best != nil {
+				month.TapesReused++
+				result.TapesReused++
+				if result.FirstReuseAt == nil {
+					first := at
+					result.FirstReuseAt = &first
+				}
+				best.used = 0
+				best.status = models.TapeStatusActive
+				return best
+			}
+		}
+		// Pool exhausted: model buying another cartridge
+		month.TapesAdded++
+		result.AdditionalTapesNeeded++
+		if result.FirstShortageAt == nil {
+			first := at
+			result.FirstShortageAt = &first
+		}
+		t := &simTapeState{capacity: in.NewTapeCapacity, status: models.TapeStatusActive, order: len(tapes)}
+		tapes = append(tapes, t)
+		return t
+	}
+
+	openMonth(in.Start)
+	next := in.Schedule.Next(in.Start.Add(-time.Second))
+	for !next.IsZero() && next.Before(in.End) {
+		for !next.Before(nextMonth) {
+			boundary := nextMonth
+			closeMonth(boundary)
+			openMonth(boundary)
+		}
+		if result.Runs >= MaxSimulatedRuns {
+			return nil, fmt.Errorf("schedule runs more than %d times in the simulated period; shorten the period", MaxSimulatedRuns)
+		}
+
+		// Release tapes whose retention has lapsed
+		if in.AllowReuse {
+			for _, t := range tapes {
+				if (t.status == models.TapeStatusActive || t.status == models.TapeStatusFull) && t.releasedAt(next) {
+					t.status = models.TapeStatusExpired
+				}
+			}
+		}
+
+		size := in.FullBytes
+		firstFull := in.FirstRunFull && result.Runs == 0
+		switch {
+		case in.BackupType == models.BackupTypeIncremental && !firstFull:
+			size = in.IncrementalBytes
+			result.IncrementalRuns++
+		case in.BackupType == models.BackupTypeDifferential && !firstFull:
+			result.DifferentialRuns++
+			if grown := in.IncrementalBytes * int64(result.DifferentialRuns); grown < size {
+				size = grown
+			}
+		default:
+			result.FullRuns++
+		}
+		result.Runs++
+		month.Runs++
+		month.BytesWritten += size
+		result.BytesWritten += size
+
+		for remaining := size; remaining > 0; {
+			t := pick(next)
+			w := t.capacity - t.used
+			if w > remaining {
+				w = remaining
+			}
+			t.used += w
+			t.lastWrite = next
+			t.retentionDays = in.RetentionDays
+			if t.used >= t.capacity {
+				t.status = models.TapeStatusFull
+			}
+			monthTapes[t] = struct{}{}
+			remaining -= w
+		}
+
+		inRetention := 0
+		for _, t := range tapes {
+			if t.holdsData() && t.status != models.TapeStatusExpired && !t.releasedAt(next) {
+				inRetention++
+			}
+		}
+		if inRetention > result.PeakTapesInRetention {
+			result.PeakTapesInRetention = inRetention
+		}
+
+		next = in.Schedule.Next(next)
+	}
+
+	// Emit the remaining months, including any without runs
+	for nextMonth.Before(in.End) {
+		boundary := nextMonth
+		closeMonth(boundary)
+		openMonth(boundary)
+	}
+	closeMonth(in.End)
+
+	return result, nil
+}
@@ -0,0 +1,176 @@
+package backup
+
+import (
+	"testing"
+	"time"
+
+	"github.com/RoseOO/TapeBackarr/internal/models"
+)
+
+// intervalSchedule runs every interval starting at anchor.
+type intervalSchedule struct {
+	anchor   time.Time
+	interval time.Duration
+}
+
+func (s intervalSchedule) Next(t time.Time) time.Time {
+	if t.Before(s.anchor) {
+		return s.anchor
+	}
+	n := t.Sub(s.anchor)/s.interval + 1
+	return s.anchor.Add(n * s.interval)
+}
+
+const simTB = int64(1000000000000)
+
+func blankTapes(n int, capacity int64) []SimTape {
+	tapes := make([]SimTape, n)
+	for i := range tapes {
+		tapes[i] = SimTape{ID: int64(i + 1), Status: models.TapeStatusBlank, CapacityBytes: capacity}
+	}
+	return tapes
+}
+
+func TestSimulateRetentionReuse(t *testing.T) {
+	start := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	result, err := SimulateRetention(RetentionSimInput{
+		Start:           start,
+		End:             start.AddDate(0, 6, 0),
+		Schedule:        intervalSchedule{anchor: start.Add(2 * time.Hour), interval: 7 * 24 * time.Hour},
+		BackupType:      models.BackupTypeFull,
+		FullBytes:       simTB,
+		RetentionDays:   28,
+		AllowReuse:      true,
+		NewTapeCapacity: 2 * simTB,
+		Tapes:           blankTapes(4, 2*simTB),
+	})
+	if err != nil {
+		t.Fatalf("SimulateRetention: %v", err)
+	}
+	if result.Runs != 26 || result.FullRuns != 26 || result.BytesWritten != 26*simTB {
+		t.Errorf("unexpected run totals: %+v", result)
+	}
+	if len(result.Months) != 6 || result.Months[0].Month != "2026-01" || result.Months[5].Month != "2026-06" {
+		t.Errorf("expected six monthly entries, got %+v", result.Months)
+	}
+	// Two weekly 1 TB runs per 2 TB tape and four weeks of retention: the
+	// pool cycles through its blanks and then reuses the oldest tape.
+	if result.BlankTapesConsumed != 4 {
+		t.Errorf("expected all 4 blanks to be consumed, got %d", result.BlankTapesConsumed)
+	}
+	if result.AdditionalTapesNeeded != 0 || result.FirstShortageAt != nil {
+		t.Errorf("expected 4 tapes to suffice, needed %d more", result.AdditionalTapesNeeded)
+	}
+	if result.TapesReused == 0 || result.FirstReuseAt == nil {
+		t.Fatal("expected tapes to be reused once retention lapsed")
+	}
+	if result.FirstReuseAt.Before(start.AddDate(0, 0, 28)) {
+		t.Errorf("reuse at %v is before retention could lapse", result.FirstReuseAt)
+	}
+	if result.PeakTapesInRetention < 2 || result.PeakTapesInRetention > 4 {
+		t.Errorf("unexpected peak tapes in retention %d", result.PeakTapesInRetention)
+	}
+}
+
+func TestSimulateRetentionWithoutReuse(t *testing.T) {
+	start := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	result, err := SimulateRetention(RetentionSimInput{
+		Start:           start,
+		End:             start.AddDate(0, 3, 0),
+		Schedule:        intervalSchedule{anchor: start.Add(time.Hour), interval: 7 * 24 * time.Hour},
+		BackupType:      models.BackupTypeFull,
+		FullBytes:       simTB,
+		RetentionDays:   7,
+		AllowReuse:      false,
+		NewTapeCapacity: simTB,
+		Tapes:           blankTapes(2, simTB),
+	})
+	if err != nil {
+		t.Fatalf("SimulateRetention: %v", err)
+	}
+	if result.TapesReused != 0 {
+		t.Errorf("expected no reuse when the pool forbids it, got %d", result.TapesReused)
+	}
+	// 13 weekly runs of one full tape each; two blanks on hand
+	if result.AdditionalTapesNeeded != result.Runs-2 {
+		t.Errorf("expected %d additional tapes, got %d", result.Runs-2, result.AdditionalTapesNeeded)
+	}
+	if result.FirstShortageAt == nil || !result.FirstShortageAt.Equal(start.Add(time.Hour).Add(14*24*time.Hour)) {
+		t.Errorf("expected shortage on the third run, got %v", result.FirstShortageAt)
+	}
+}
+
+func TestSimulateRetentionIncremental(t *testing.T) {
+	start := time.Date(2026, 3, 10, 0, 0, 0, 0, time.UTC)
+	lastWrite := start.AddDate(0, 0, -40)
+	tapes := []SimTape{
+		{ID: 1, Status: models.TapeStatusFull, CapacityBytes: simTB, UsedBytes: simTB, LastWrittenAt: &lastWrite},
+		{ID: 2, Status: models.TapeStatusRetired, CapacityBytes: simTB},
+	}
+	result, err := SimulateRetention(RetentionSimInput{
+		Start:                 start,
+		End:                   start.AddDate(0, 0, 10),
+		Schedule:              intervalSchedule{anchor: start.Add(time.Hour), interval: 24 * time.Hour},
+		BackupType:            models.BackupTypeIncremental,
+		FirstRunFull:          true,
+		FullBytes:             simTB / 2,
+		IncrementalBytes:      simTB / 100,
+		RetentionDays:         30,
+		ExistingRetentionDays: 30,
+		AllowReuse:            true,
+		NewTapeCapacity:       simTB,
+		Tapes:                 tapes,
+	})
+	if err != nil {
+		t.Fatalf("SimulateRetention: %v", err)
+	}
+	if result.PoolTapes != 1 {
+		t.Errorf("expected retired tape to be excluded, got %d pool tapes", result.PoolTapes)
+	}
+	if result.FullRuns != 1 || result.IncrementalRuns != result.Runs-1 {
+		t.Errorf("expected one full then incrementals, got %d full / %d incremental", result.FullRuns, result.IncrementalRuns)
+	}
+	// The existing tape is past retention and is reused on the first run
+	if result.TapesReused != 1 || result.FirstReuseAt == nil || !result.FirstReuseAt.Equal(start.Add(time.Hour)) {
+		t.Errorf("expected immediate reuse of the expired tape, got %d at %v", result.TapesReused, result.FirstReuseAt)
+	}
+	if result.AdditionalTapesNeeded != 0 {
+		t.Errorf("expected incrementals to fit on the reused tape, needed %d more", result.AdditionalTapesNeeded)
+	}
+}
+
+func TestSimulateRetentionValidation(t *testing.T) {
+	start := time.Now()
+	if _, err := SimulateRetention(RetentionSimInput{Start: start, End: start.AddDate(0, 1, 0), NewTapeCapacity: simTB}); err == nil {
+		t.Error("expected an error without a schedule")
+	}
+	sched := intervalSchedule{anchor: start, interval: time.Second}
+	if _, err := SimulateRetention(RetentionSimInput{Start: start, End: start.AddDate(0, 1, 0), Schedule: sched}); err == nil {
+		t.Error("expected an error without a tape capacity")
+	}
+	if _, err := SimulateRetention(RetentionSimInput{Start: start, End: start.AddDate(0, 1, 0), Schedule: sched, NewTapeCapacity: simTB, FullBytes: 1}); err == nil {
+		t.Error("expected an error when the schedule runs too often")
+	}
+}
+
+func TestSimulateRetentionDifferential(t *testing.T) {
+	start := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	result, err := SimulateRetention(RetentionSimInput{
+		Start:            start,
+		End:              start.AddDate(0, 0, 5),
+		Schedule:         intervalSchedule{anchor: start.Add(2 * time.Hour), interval: 24 * time.Hour},
+		BackupType:       models.BackupTypeDifferential,
+		FirstRunFull:     true,
+		FullBytes:        simTB,
+		IncrementalBytes: simTB / 2,
+		NewTapeCapacity:  100 * simTB,
+		Tapes:            blankTapes(1, 100*simTB),
+	})
+	if err != nil {
+		t.Fatalf("SimulateRetention: %v", err)
+	}
+	// A full, then differentials of 0.5, 1 and (capped at a full) 1 and 1 TB
+	if result.FullRuns != 1 || result.DifferentialRuns != 4 || result.BytesWritten != simTB+simTB/2+3*simTB {
+		t.Errorf("unexpected run totals: %+v", result)
+	}
+}
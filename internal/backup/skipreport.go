@@ -0,0 +1,143 @@
+package backup
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"sync"
+)
+
+// SkipReason explains why a path found during a scan was not backed up.
+type SkipReason string
+
+const (
+	SkipPermissionDenied SkipReason = "permission_denied"
+	SkipVanished         SkipReason = "vanished"
+	SkipExcluded         SkipReason = "excluded"
+	SkipNotIncluded      SkipReason = "not_included"
+	SkipSpecialFile      SkipReason = "special_file"
+	SkipSymlink          SkipReason = "symlink"
+	SkipDanglingSymlink  SkipReason = "dangling_symlink"
+	SkipSymlinkLoop      SkipReason = "symlink_loop"
+	SkipError            SkipReason = "error"
+)
+
+// MaxSkipReportPaths caps how many individual skipped paths are kept per scan.
+// Counts are always complete; only the path list is truncated.
+const MaxSkipReportPaths = 100000
+
+// SkippedPath is a single path skipped during a scan.
+type SkippedPath struct {
+	Path   string     `json:"path"`
+	Reason SkipReason `json:"reason"`
+	Detail string     `json:"detail,omitempty"`
+}
+
+// SkipReport collects every path skipped during ScanSource with its reason.
+// It is safe for concurrent use by the scan workers.
+type SkipReport struct {
+	mu        sync.Mutex
+	Counts    map[SkipReason]int64 `json:"counts"`
+	Total     int64                `json:"total"`
+	Truncated bool                 `json:"truncated"`
+	Paths     []SkippedPath        `json:"-"`
+}
+
+// NewSkipReport returns an empty skip report.
+func NewSkipReport() *SkipReport {
+	return &SkipReport{Counts: make(map[SkipReason]int64)}
+}
+
+// Add records a skipped path.
+func (r *SkipReport) Add(path string, reason SkipReason, detail string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.Counts[reason]++
+	r.Total++
+	if len(r.Paths) >= MaxSkipReportPaths {
+		r.Truncated = true
+		return
+	}
+	r.Paths = append(r.Paths, SkippedPath{Path: path, Reason: reason, Detail: detail})
+}
+
+// AddError records a path that could not be read, classifying the error.
+func (r *SkipReport) AddError(path string, err error) {
+	r.Add(path, skipReasonForError(err), err.Error())
+}
+
+// Summary returns the per-reason counts as JSON for storing on the backup set.
+func (r *SkipReport) Summary() string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	data, _ := json.Marshal(r)
+	return string(data)
+}
+
+// skipReasonForError maps a filesystem error to a skip reason.
+func skipReasonForError(err error) SkipReason {
+	switch {
+	case errors.Is(err, fs.ErrPermission):
+		return SkipPermissionDenied
+	case errors.Is(err, fs.ErrNotExist):
+		return SkipVanished
+	default:
+		return SkipError
+	}
+}
+
+// isSpecialFile reports whether a directory entry type cannot be archived
+// meaningfully: sockets and irregular files are dropped by tar anyway.
+func isSpecialFile(mode os.FileMode) bool {
+	return mode&(os.ModeSocket|os.ModeIrregular) != 0
+}
+
+// saveSkipReport attaches a scan's skip report to a backup set: the summary on
+// the set itself and the individual paths in backup_skipped_paths.
+func (s *Service) saveSkipReport(backupSetID int64, report *SkipReport) error {
+	if _, err := s.db.Exec("UPDATE backup_sets SET skipped_count = ?, skip_summary = ? WHERE id = ?",
+		report.Total, report.Summary(), backupSetID); err != nil {
+		return err
+	}
+	if len(report.Paths) == 0 {
+		return nil
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	stmt, err := tx.Prepare("INSERT INTO backup_skipped_paths (backup_set_id, path, reason, detail) VALUES (?, ?, ?, ?)")
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	for _, p := range report.Paths {
+		if _, err := stmt.Exec(backupSetID, p.Path, string(p.Reason), p.Detail); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// scanFinished records a finished scan of a backup: the skip report goes on
+// the set and the file count into the job's progress.
+func (s *Service) scanFinished(jobID, backupSetID int64, fileCount int, report *SkipReport) {
+	if err := s.saveSkipReport(backupSetID, report); err != nil {
+		s.logger.Warn("Failed to save skip report", map[string]interface{}{
+			"backup_set_id": backupSetID,
+			"error":         err.Error(),
+		})
+	}
+
+	s.updateProgress(jobID, "scanning", fmt.Sprintf("Scan complete: found %d files, skipped %d paths", fileCount, report.Total))
+	s.logger.Info("Scan complete", map[string]interface{}{
+		"file_count":    fileCount,
+		"skipped_count": report.Total,
+	})
+}
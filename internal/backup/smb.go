@@ -0,0 +1,124 @@
+package backup
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/RoseOO/TapeBackarr/internal/models"
+)
+
+// SMBShare is the share an SMB source backs up
+type SMBShare struct {
+	Host  string
+	Port  int // 0 for the default
+	Share string
+	// Dir is the directory within the share to back up, "" for all of it
+	Dir string
+}
+
+func (s *SMBShare) String() string {
+	return "//" + s.Host + "/" + s.Share
+}
+
+// ParseSMBPath parses the path of an SMB source:
+// smb://host[:port]/share[/directory], or //host/share[/directory]
+func ParseSMBPath(raw string) (*SMBShare, error) {
+	if strings.HasPrefix(raw, `\\`) {
+		raw = strings.ReplaceAll(raw, `\`, "/")
+	}
+	if strings.HasPrefix(raw, "//") {
+		raw = "smb:" + raw
+	}
+	u, err := url.Parse(raw)
+	if err != nil || u.Scheme != "smb" || u.Hostname() == "" || u.RawQuery != "" {
+		return nil, fmt.Errorf("path must be an smb://host[:port]/share[/directory] URL or //host/share[/directory]")
+	}
+	if u.User != nil {
+		return nil, fmt.Errorf("the path must not hold a login; keep it in a stored credential")
+	}
+	parts := strings.SplitN(strings.TrimPrefix(path.Clean("/"+u.Path), "/"), "/", 2)
+	if parts[0] == "" {
+		return nil, fmt.Errorf("the path must name the share, e.g. //nas/data")
+	}
+	share := &SMBShare{Host: u.Hostname(), Share: parts[0]}
+	if len(parts) == 2 {
+		share.Dir = parts[1]
+	}
+	if p := u.Port(); p != "" {
+		port, err := strconv.Atoi(p)
+		if err != nil || port < 1 || port > 65535 {
+			return nil, fmt.Errorf("invalid port %q", p)
+		}
+		share.Port = port
+	}
+	return share, nil
+}
+
+// mountSMB mounts an SMB share read-only with the login of its source. The
+// password goes through a mount.cifs credentials file so that it never
+// appears on the command line.
+func (s *Service) mountSMB(ctx context.Context, source *models.BackupSource, share *SMBShare, mountPoint, options, purpose string) error {
+	cred, secret, err := s.sourceCredential(source, purpose)
+	if err != nil {
+		return err
+	}
+	contents, err := smbCredentials(cred, secret)
+	if err != nil {
+		return fmt.Errorf("credential %s: %w", cred.Name, err)
+	}
+	credFile, err := s.scratch.CreateTemp("smbcred-*")
+	if err != nil {
+		return fmt.Errorf("failed to create credentials file: %w", err)
+	}
+	defer os.Remove(credFile.Name())
+	_, werr := credFile.WriteString(contents)
+	if cerr := credFile.Close(); werr == nil {
+		werr = cerr
+	}
+	if werr != nil {
+		return fmt.Errorf("failed to write credentials file: %w", werr)
+	}
+
+	if err := mountCommand(ctx, "mount", smbMountArgs(share, mountPoint, credFile.Name(), options)...); err != nil {
+		return fmt.Errorf("failed to mount %s: %w", share, err)
+	}
+	return nil
+}
+
+// smbCredentials returns the contents of a mount.cifs credentials file. A
+// line break in a field would add lines, and so options, to the file.
+func smbCredentials(cred *models.Credential, secret string) (string, error) {
+	for _, field := range []struct{ name, value string }{
+		{"username", cred.Username}, {"password", secret}, {"domain", cred.Domain},
+	} {
+		if strings.ContainsAny(field.value, "\r\n") {
+			return "", fmt.Errorf("the %s must not contain line breaks", field.name)
+		}
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "username=%s\n", cred.Username)
+	fmt.Fprintf(&b, "password=%s\n", secret)
+	if cred.Domain != "" {
+		fmt.Fprintf(&b, "domain=%s\n", cred.Domain)
+	}
+	return b.String(), nil
+}
+
+// smbMountArgs returns the mount arguments for an SMB share with the
+// source's own options. "ro" comes last so that no option can undo it.
+func smbMountArgs(share *SMBShare, mountPoint, credFile, options string) []string {
+	opts := []string{"credentials=" + credFile}
+	if share.Port > 0 {
+		opts = append(opts, "port="+strconv.Itoa(share.Port))
+	}
+	if options != "" {
+		opts = append(opts, options)
+	}
+	opts = append(opts, "ro")
+	return []string{"-t", "cifs", "-o", strings.Join(opts, ","), "--", share.String(), mountPoint}
+}
@@ -0,0 +1,174 @@
+package backup
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/RoseOO/TapeBackarr/internal/credentials"
+	"github.com/RoseOO/TapeBackarr/internal/database"
+	"github.com/RoseOO/TapeBackarr/internal/models"
+	"github.com/RoseOO/TapeBackarr/internal/scratch"
+)
+
+func TestParseSMBPath(t *testing.T) {
+	tests := []struct {
+		raw  string
+		want SMBShare
+	}{
+		{"//nas/data", SMBShare{Host: "nas", Share: "data"}},
+		{`\\nas\data\projects`, SMBShare{Host: "nas", Share: "data", Dir: "projects"}},
+		{"smb://nas:4450/data/projects/2026/", SMBShare{Host: "nas", Port: 4450, Share: "data", Dir: "projects/2026"}},
+		{"smb://nas/data/../other", SMBShare{Host: "nas", Share: "other"}},
+	}
+	for _, tt := range tests {
+		got, err := ParseSMBPath(tt.raw)
+		if err != nil {
+			t.Errorf("%s: %v", tt.raw, err)
+			continue
+		}
+		if *got != tt.want {
+			t.Errorf("%s: got %+v, want %+v", tt.raw, *got, tt.want)
+		}
+	}
+
+	for _, raw := range []string{"/mnt/data", "//nas", "smb://nas/", "smb://user:pw@nas/data", "smb://nas/data?vers=3", "smb://nas:0/data", "nfs://nas/data"} {
+		if _, err := ParseSMBPath(raw); err == nil {
+			t.Errorf("%s: expected an error", raw)
+		}
+	}
+}
+
+func TestSMBCredentialsRejectLineBreaks(t *testing.T) {
+	for _, tt := range []struct {
+		cred   models.Credential
+		secret string
+	}{
+		{models.Credential{Username: "backup\ndomain=EVIL"}, "s3cret"},
+		{models.Credential{Username: "backup"}, "s3cret\r\nusername=root"},
+		{models.Credential{Username: "backup", Domain: "CORP\n"}, "s3cret"},
+	} {
+		if _, err := smbCredentials(&tt.cred, tt.secret); err == nil {
+			t.Errorf("%+v: expected an error", tt)
+		}
+	}
+	got, err := smbCredentials(&models.Credential{Username: "backup"}, "s3cret")
+	if err != nil || got != "username=backup\npassword=s3cret\n" {
+		t.Errorf("got %q, %v", got, err)
+	}
+}
+
+func TestMountSMBSource(t *testing.T) {
+	db, err := database.New(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("failed to create database: %v", err)
+	}
+	defer db.Close()
+	if err := db.Migrate(); err != nil {
+		t.Fatalf("failed to migrate database: %v", err)
+	}
+	store, err := credentials.NewStore(db, "test-key")
+	if err != nil {
+		t.Fatalf("NewStore: %v", err)
+	}
+	credID, err := store.Create(&models.Credential{Name: "nas", CredentialType: models.CredentialPassword, Username: "backup", Domain: "CORP"}, "s3cret")
+	if err != nil {
+		t.Fatalf("Create credential: %v", err)
+	}
+	db.Exec("INSERT INTO backup_sources (name, source_type, path, credential_id) VALUES ('nas', 'smb', '//nas/data/projects', ?)", credID)
+
+	// The stub "mounts" the share by creating the directory to back up
+	var calls []string
+	var credFile string
+	orig := mountCommand
+	defer func() { mountCommand = orig }()
+	mountCommand = func(ctx context.Context, name string, args ...string) error {
+		calls = append(calls, name+" "+strings.Join(args, " "))
+		if name == "mount" {
+			credFile = strings.TrimPrefix(strings.Split(args[3], ",")[0], "credentials=")
+			data, err := os.ReadFile(credFile)
+			if err != nil {
+				t.Fatalf("credentials file: %v", err)
+			}
+			if string(data) != "username=backup\npassword=s3cret\ndomain=CORP\n" {
+				t.Errorf("credentials file holds %q", data)
+			}
+			return os.MkdirAll(filepath.Join(args[len(args)-1], "projects"), 0755)
+		}
+		return os.RemoveAll(filepath.Join(args[0], "projects"))
+	}
+
+	svc := NewService(db, nil, nil, 65536, 0, 0)
+	svc.SetScratchDir(scratch.New(t.TempDir(), 0))
+	svc.SetCredentials(store)
+	source := &models.BackupSource{ID: 1, Name: "nas", SourceType: models.SourceTypeSMB, Path: "//nas/data/projects"}
+	mountPoint := svc.sourceMountPoint(1)
+
+	first, release1, err := svc.mountSource(context.Background(), source, "backup")
+	if err != nil {
+		t.Fatalf("mountSource: %v", err)
+	}
+	if first.Path != filepath.Join(mountPoint, "projects") {
+		t.Errorf("mounted path %s", first.Path)
+	}
+	if source.Path != "//nas/data/projects" {
+		t.Errorf("the source itself was changed: %s", source.Path)
+	}
+	if _, err := os.Stat(credFile); !os.IsNotExist(err) {
+		t.Error("expected the credentials file to be removed once mounted")
+	}
+
+	// A second run of the same source shares the mount
+	_, release2, err := svc.mountSource(context.Background(), source, "backup")
+	if err != nil {
+		t.Fatalf("second mountSource: %v", err)
+	}
+	release1()
+	release1()
+	if len(calls) != 1 || !strings.HasPrefix(calls[0], "mount -t cifs -o credentials=") || !strings.HasSuffix(calls[0], ",ro -- //nas/data "+mountPoint) {
+		t.Fatalf("expected one read-only mount, got %q", calls)
+	}
+	release2()
+	if len(calls) != 2 || calls[1] != "umount "+mountPoint {
+		t.Fatalf("expected the last run to unmount, got %q", calls)
+	}
+	if _, err := os.Stat(mountPoint); !os.IsNotExist(err) {
+		t.Error("expected the mount point to be removed")
+	}
+
+	// A directory missing from the share fails the mount and releases it
+	source.Path = "//nas/data/missing"
+	if _, _, err := svc.mountSource(context.Background(), source, "backup"); err == nil || !strings.Contains(err.Error(), "not found on //nas/data") {
+		t.Errorf("expected a missing directory error, got %v", err)
+	}
+	if len(calls) != 4 || !strings.HasPrefix(calls[3], "umount") {
+		t.Errorf("expected the share to be unmounted again, got %q", calls)
+	}
+
+	var uses int
+	db.QueryRow("SELECT COUNT(*) FROM credential_usage WHERE used_by_type = 'backup_source' AND used_by_id = 1").Scan(&uses)
+	if uses != 2 {
+		t.Errorf("expected 2 recorded credential uses, got %d", uses)
+	}
+
+	// Local sources are not mounted
+	local := &models.BackupSource{ID: 2, SourceType: models.SourceTypeLocal, Path: "/srv"}
+	got, release, err := svc.mountSource(context.Background(), local, "backup")
+	if err != nil || got != local {
+		t.Errorf("expected a local source as it is, got %v, %v", got, err)
+	}
+	release()
+
+	// Nor are SMB sources whose share is mounted outside TapeBackarr
+	premounted := &models.BackupSource{ID: 3, SourceType: models.SourceTypeSMB, Path: "/mnt/smb/share"}
+	got, release, err = svc.mountSource(context.Background(), premounted, "backup")
+	if err != nil || got != premounted {
+		t.Errorf("expected a mounted share as it is, got %v, %v", got, err)
+	}
+	release()
+	if len(calls) != 4 {
+		t.Errorf("expected no command for a local path, got %q", calls)
+	}
+}
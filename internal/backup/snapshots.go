@@ -0,0 +1,224 @@
+package backup
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"path/filepath"
+
+	"github.com/RoseOO/TapeBackarr/internal/models"
+)
+
+// ErrNoCatalogChain is returned by SnapshotFromCatalog when a job has no
+// completed full backup with catalog entries to rebuild from.
+var ErrNoCatalogChain = errors.New("no completed full backup with a catalog to rebuild from")
+
+// changedSince returns the files in current that are new or modified
+// compared to previous.
+func changedSince(current, previous []FileInfo) []FileInfo {
+	return changeFilter(previous, models.ChangeDetectionMetadata)(current)
+}
+
+// changeFilter returns a function that keeps the files that are new or
+// modified compared to previous, for filtering a scan batch by batch. Beyond
+// size and modification time, the hash and hybrid modes compare the content
+// hashes set by hashChangeCandidates.
+func changeFilter(previous []FileInfo, mode models.ChangeDetection) func([]FileInfo) []FileInfo {
+	prevMap := make(map[string]FileInfo, len(previous))
+	for _, f := range previous {
+		prevMap[f.Path] = f
+	}
+
+	return func(current []FileInfo) []FileInfo {
+		var changed []FileInfo
+		for _, f := range current {
+			prev, exists := prevMap[f.Path]
+			if !exists || f.ModTime.After(prev.ModTime) || f.Size != prev.Size {
+				changed = append(changed, f)
+				continue
+			}
+			switch mode {
+			case models.ChangeDetectionHash:
+				if hashesDiffer(f.Hash, prev.Hash) {
+					changed = append(changed, f)
+				}
+			case models.ChangeDetectionHybrid:
+				// Without a hash to compare against, a moved ctime alone
+				// marks the file as changed
+				if ctimeMoved(f, prev) && (!hashesComparable(f.Hash, prev.Hash) || f.Hash != prev.Hash) {
+					changed = append(changed, f)
+				}
+			}
+		}
+		return changed
+	}
+}
+
+// SnapshotFromCatalog rebuilds the file state recorded by a job's latest
+// backup chain: the catalog of its most recent completed full backup with
+// the latest differential since and every completed incremental after that
+// applied on top. It returns the files with absolute paths under sourcePath
+// and the newest backup set in the chain. Files deleted from the source
+// since the full backup cannot be told apart and stay in the result, which
+// only means they are not reported as new again.
+func (s *Service) SnapshotFromCatalog(ctx context.Context, jobID int64, sourcePath string) ([]FileInfo, int64, error) {
+	return s.snapshotFromCatalog(ctx, jobID, sourcePath, false)
+}
+
+// snapshotFromCatalog rebuilds the file state of the job's latest chain, or
+// of its last full backup alone when fullOnly is set, for a differential run
+func (s *Service) snapshotFromCatalog(ctx context.Context, jobID int64, sourcePath string, fullOnly bool) ([]FileInfo, int64, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT bs.id, bs.backup_type,
+		       (SELECT COUNT(*) FROM catalog_entries ce WHERE ce.backup_set_id = bs.id)
+		FROM backup_sets bs
+		WHERE bs.job_id = ? AND bs.status = 'completed' AND bs.invalidated_at IS NULL
+		ORDER BY bs.start_time DESC, bs.id DESC
+	`, jobID)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	// Newest first, back to and including the last full set with a catalog.
+	// Later tapes of a spanned run have no catalog of their own and are skipped.
+	// A differential holds every change since the full, so the sets between
+	// the two are skipped as well.
+	var chain []int64
+	foundFull := false
+	skipToFull := fullOnly
+	for rows.Next() {
+		var id int64
+		var backupType string
+		var entries int
+		if err := rows.Scan(&id, &backupType, &entries); err != nil {
+			rows.Close()
+			return nil, 0, err
+		}
+		if entries == 0 {
+			continue
+		}
+		if backupType == string(models.BackupTypeFull) {
+			chain = append(chain, id)
+			foundFull = true
+			break
+		}
+		if skipToFull {
+			continue
+		}
+		chain = append(chain, id)
+		skipToFull = backupType == string(models.BackupTypeDifferential)
+	}
+	rows.Close()
+	if !foundFull {
+		return nil, 0, ErrNoCatalogChain
+	}
+
+	state := make(map[string]FileInfo)
+	for i := len(chain) - 1; i >= 0; i-- {
+		if err := s.applyCatalog(ctx, chain[i], sourcePath, state); err != nil {
+			return nil, 0, fmt.Errorf("backup set %d: %w", chain[i], err)
+		}
+	}
+
+	files := make([]FileInfo, 0, len(state))
+	for _, f := range state {
+		files = append(files, f)
+	}
+	return files, chain[0], nil
+}
+
+// lastFullSnapshot returns the snapshot data stored by the job's most recent
+// completed full backup of the source, the base a differential run compares
+// against. It returns sql.ErrNoRows when the snapshot was pruned or the job
+// has no full backup.
+func (s *Service) lastFullSnapshot(ctx context.Context, jobID, sourceID int64) ([]byte, error) {
+	var data []byte
+	err := s.db.QueryRowContext(ctx, `
+		SELECT sn.snapshot_data FROM snapshots sn
+		JOIN backup_sets bs ON bs.id = sn.backup_set_id
+		WHERE sn.source_id = ? AND bs.job_id = ? AND bs.backup_type = 'full'
+		  AND bs.status = 'completed' AND bs.invalidated_at IS NULL
+		  AND NOT EXISTS (
+			SELECT 1 FROM backup_sets f
+			WHERE f.job_id = bs.job_id AND f.backup_type = 'full' AND f.status = 'completed'
+			  AND f.invalidated_at IS NULL AND f.start_time > bs.start_time
+			  AND NOT EXISTS (
+				SELECT 1 FROM tape_spanning_members m
+				WHERE m.backup_set_id = f.id AND m.sequence_number > 1
+			  )
+		  )
+		ORDER BY sn.created_at DESC LIMIT 1
+	`, sourceID, jobID).Scan(&data)
+	return data, err
+}
+
+// applyCatalog overlays a backup set's catalog onto state, keyed by path
+func (s *Service) applyCatalog(ctx context.Context, backupSetID int64, sourcePath string, state map[string]FileInfo) error {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT file_path, file_size, COALESCE(file_mode, 0), mod_time, COALESCE(checksum, '')
+		FROM catalog_entries WHERE backup_set_id = ?
+	`, backupSetID)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var rel string
+		var f FileInfo
+		var modTime sql.NullTime
+		if err := rows.Scan(&rel, &f.Size, &f.Mode, &modTime, &f.Hash); err != nil {
+			return err
+		}
+		f.Path = rel
+		if !filepath.IsAbs(rel) {
+			f.Path = filepath.Join(sourcePath, rel)
+		}
+		f.ModTime = modTime.Time
+		state[f.Path] = f
+	}
+	return rows.Err()
+}
+
+// SaveSnapshot stores the file state of a backup run for the next
+// incremental comparison and returns the snapshot's ID.
+func (s *Service) SaveSnapshot(sourceID, backupSetID int64, files []FileInfo) (int64, error) {
+	data, err := s.CreateSnapshot(files)
+	if err != nil {
+		return 0, err
+	}
+	var totalBytes int64
+	for _, f := range files {
+		totalBytes += f.Size
+	}
+	result, err := s.db.Exec(`
+		INSERT INTO snapshots (source_id, backup_set_id, file_count, total_bytes, snapshot_data)
+		VALUES (?, ?, ?, ?, ?)
+	`, sourceID, backupSetID, len(files), totalBytes, data)
+	if err != nil {
+		return 0, err
+	}
+	return result.LastInsertId()
+}
+
+// PruneSnapshots deletes all but the keep most recent unpinned snapshots of
+// a job. Pinned snapshots are never pruned. keep <= 0 keeps everything.
+func (s *Service) PruneSnapshots(jobID int64, keep int) (int64, error) {
+	if keep <= 0 {
+		return 0, nil
+	}
+	result, err := s.db.Exec(`
+		DELETE FROM snapshots WHERE id IN (
+			SELECT sn.id FROM snapshots sn
+			JOIN backup_sets bs ON sn.backup_set_id = bs.id
+			WHERE bs.job_id = ? AND sn.pinned = 0
+			ORDER BY sn.created_at DESC, sn.id DESC
+			LIMIT -1 OFFSET ?
+		)
+	`, jobID, keep)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
@@ -0,0 +1,112 @@
+package backup
+
+import (
+	"archive/tar"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"path/filepath"
+	"sync"
+)
+
+// streamHasher computes the SHA-256 of every regular file in a tar stream
+// as the stream is written to tape, so the checksum pass after streaming
+// does not read those files from the source a second time. The checksums
+// are of the data tar actually archived. It also records where each file's
+// header starts in the stream, so a restore can seek to it.
+type streamHasher struct {
+	sourcePath string
+	checksums  *sync.Map
+	offsets    *sync.Map
+	pr         *io.PipeReader
+	pw         *io.PipeWriter
+	done       chan struct{}
+	closeOnce  sync.Once
+}
+
+// newStreamHasher starts hashing a tar stream of files relative to
+// sourcePath, storing checksums and, when offsets is set, stream offsets by
+// absolute path
+func newStreamHasher(sourcePath string, checksums, offsets *sync.Map) *streamHasher {
+	pr, pw := io.Pipe()
+	h := &streamHasher{sourcePath: sourcePath, checksums: checksums, offsets: offsets, pr: pr, pw: pw, done: make(chan struct{})}
+	go h.run()
+	return h
+}
+
+// run reads the archive entry by entry. A file cut short, e.g. by a failed
+// stream, gets no checksum and is left to the checksum pass.
+func (h *streamHasher) run() {
+	defer close(h.done)
+	cr := &streamCounter{r: h.pr}
+	tr := tar.NewReader(cr)
+	// Entries are padded to 512-byte blocks, so each header starts at the
+	// block after the previous entry's data
+	var next int64
+	for {
+		hdr, err := tr.Next()
+		if err != nil {
+			break
+		}
+		start := next
+		if hdr.Typeflag != tar.TypeReg && hdr.Typeflag != tar.TypeGNUSparse {
+			if _, err := io.Copy(io.Discard, tr); err != nil {
+				break
+			}
+			next = (cr.n + 511) &^ 511
+			continue
+		}
+		sum := sha256.New()
+		if _, err := io.Copy(sum, tr); err != nil {
+			break
+		}
+		next = (cr.n + 511) &^ 511
+		path := filepath.Join(h.sourcePath, hdr.Name)
+		h.checksums.Store(path, hex.EncodeToString(sum.Sum(nil)))
+		if h.offsets != nil && hdr.Typeflag == tar.TypeReg {
+			h.offsets.Store(path, start)
+		}
+	}
+	// Keep draining so the stream never blocks on the hasher
+	io.Copy(io.Discard, h.pr)
+}
+
+// wrap returns r with what is read from it teed to the hasher
+func (h *streamHasher) wrap(r io.Reader) io.Reader {
+	return &hashingReader{r: r, h: h}
+}
+
+// close ends the stream and waits until every complete file is hashed
+func (h *streamHasher) close() {
+	h.closeOnce.Do(func() { h.pw.Close() })
+	<-h.done
+}
+
+// hashingReader tees reads of a tar stream to a streamHasher
+type hashingReader struct {
+	r io.Reader
+	h *streamHasher
+}
+
+func (hr *hashingReader) Read(p []byte) (int, error) {
+	n, err := hr.r.Read(p)
+	if n > 0 {
+		hr.h.pw.Write(p[:n])
+	}
+	if err != nil {
+		hr.h.closeOnce.Do(func() { hr.h.pw.Close() })
+	}
+	return n, err
+}
+
+// streamCounter counts the bytes the tar reader consumed
+type streamCounter struct {
+	r io.Reader
+	n int64
+}
+
+func (c *streamCounter) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
@@ -0,0 +1,105 @@
+package backup
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/RoseOO/TapeBackarr/internal/logging"
+	"github.com/RoseOO/TapeBackarr/internal/scratch"
+	"github.com/RoseOO/TapeBackarr/internal/tape"
+)
+
+func TestStreamHasher(t *testing.T) {
+	var archive bytes.Buffer
+	tw := tar.NewWriter(&archive)
+	long := strings.Repeat("long/", 30) + "c.txt"
+	files := map[string]string{"docs/a.txt": strings.Repeat("a", 5000), long: "c", "b.bin": "b"}
+	for _, name := range []string{"docs/a.txt", long, "b.bin"} {
+		tw.WriteHeader(&tar.Header{Name: name, Mode: 0644, Size: int64(len(files[name])), Typeflag: tar.TypeReg})
+		tw.Write([]byte(files[name]))
+	}
+	tw.WriteHeader(&tar.Header{Name: "link", Linkname: "b.bin", Typeflag: tar.TypeSymlink})
+	tw.Close()
+	want := func(content string) string {
+		sum := sha256.Sum256([]byte(content))
+		return hex.EncodeToString(sum[:])
+	}
+
+	checksums, offsets := &sync.Map{}, &sync.Map{}
+	h := newStreamHasher("/src", checksums, offsets)
+	if n, err := io.Copy(io.Discard, h.wrap(bytes.NewReader(archive.Bytes()))); err != nil || n != int64(archive.Len()) {
+		t.Fatalf("expected the stream passed through unchanged, copied %d: %v", n, err)
+	}
+	h.close()
+	for name, content := range files {
+		if got, _ := checksums.Load("/src/" + name); got != want(content) {
+			t.Errorf("%s: expected checksum %s, got %v", name, want(content), got)
+		}
+	}
+	if _, ok := checksums.Load("/src/link"); ok {
+		t.Error("expected no checksum for a symlink")
+	}
+	// Each recorded offset is where the file's header starts
+	for name := range files {
+		off, ok := offsets.Load("/src/" + name)
+		if !ok {
+			t.Errorf("%s: expected a stream offset", name)
+			continue
+		}
+		hdr, err := tar.NewReader(bytes.NewReader(archive.Bytes()[off.(int64):])).Next()
+		if err != nil || hdr.Name != name {
+			t.Errorf("%s: expected its header at offset %d, got %v (%v)", name, off, hdr, err)
+		}
+	}
+
+	// A stream cut off inside a file leaves that file to the checksum pass
+	checksums = &sync.Map{}
+	h = newStreamHasher("/src", checksums, nil)
+	io.Copy(io.Discard, h.wrap(bytes.NewReader(archive.Bytes()[:1024])))
+	h.close()
+	if _, ok := checksums.Load("/src/docs/a.txt"); ok {
+		t.Error("expected no checksum for a file cut short")
+	}
+}
+
+func TestStreamTarListChecksums(t *testing.T) {
+	srcDir := t.TempDir()
+	os.MkdirAll(filepath.Join(srcDir, "sub"), 0755)
+	content := map[string]string{"one.txt": "first file", "sub/two.txt": strings.Repeat("second ", 1000)}
+	var files []FileInfo
+	for name, data := range content {
+		path := filepath.Join(srcDir, name)
+		os.WriteFile(path, []byte(data), 0644)
+		files = append(files, FileInfo{Path: path, Size: int64(len(data)), Mode: 0644})
+	}
+
+	logger, _ := logging.NewLogger("error", "text", "")
+	devicePath := "file://" + t.TempDir()
+	svc := NewService(nil, tape.NewServiceForDevice(devicePath, 65536), logger, 65536, 0, 0)
+	svc.SetScratchDir(scratch.New(t.TempDir(), 0))
+	list, err := svc.writeTarFileList(srcDir, files)
+	if err != nil {
+		t.Fatalf("writeTarFileList: %v", err)
+	}
+	list.checksums = &sync.Map{}
+	if _, err := svc.streamTarList(context.Background(), srcDir, list, devicePath, nil, nil); err != nil {
+		t.Fatalf("streamTarList: %v", err)
+	}
+	list.Close()
+
+	for name, data := range content {
+		sum := sha256.Sum256([]byte(data))
+		if got, _ := list.checksums.Load(filepath.Join(srcDir, name)); got != hex.EncodeToString(sum[:]) {
+			t.Errorf("%s: expected the checksum hashed from the stream, got %v", name, got)
+		}
+	}
+}
@@ -0,0 +1,191 @@
+package backup
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"database/sql"
+	"fmt"
+	"io"
+	"os/exec"
+	"strconv"
+
+	"github.com/RoseOO/TapeBackarr/internal/cmdutil"
+	"github.com/RoseOO/TapeBackarr/internal/encryption"
+	"github.com/RoseOO/TapeBackarr/internal/models"
+	"github.com/RoseOO/TapeBackarr/internal/stages"
+)
+
+// jobStreamStages returns the stream stages configured for a job, checked
+// against the registered stages
+func (s *Service) jobStreamStages(jobID int64) ([]models.StreamStage, error) {
+	var raw sql.NullString
+	if err := s.db.QueryRow("SELECT stream_stages FROM backup_jobs WHERE id = ?", jobID).Scan(&raw); err != nil {
+		return nil, err
+	}
+	chain, err := stages.Parse(raw)
+	if err != nil {
+		return nil, err
+	}
+	return chain, stages.Validate(chain)
+}
+
+// streamTarListStaged streams the files of a tar file list to tape through a
+// job's stream stages, then compression and encryption when they are set:
+// tar -> countingReader -> stages -> compress -> encrypt -> tape. It returns
+// the bytes written to tape, the encryption parameters and the stages as
+// applied, with the metadata they recorded.
+func (s *Service) streamTarListStaged(ctx context.Context, sourcePath string, list *tarFileList, devicePath string, chain []models.StreamStage, compression models.CompressionType, encryptionKey string, progressCb func(bytesWritten int64), pauseFlag *int32) (int64, *models.EncryptionMetadata, []models.StreamStage, error) {
+	var keyBytes []byte
+	if encryptionKey != "" {
+		var err error
+		if keyBytes, err = encryption.DecodeKey(encryptionKey); err != nil {
+			return 0, nil, nil, err
+		}
+	}
+
+	tarArgs := []string{
+		"-c",
+		"-b", fmt.Sprintf("%d", s.blockSize/512),
+		"-C", sourcePath,
+	}
+	tarArgs = append(tarArgs, list.args()...)
+	tarCmd := exec.CommandContext(ctx, "tar", tarArgs...)
+	tarCmd.Dir = sourcePath
+	tarCmd.Stdin = list.stdin
+	tarPipe, err := tarCmd.StdoutPipe()
+	if err != nil {
+		return 0, nil, nil, fmt.Errorf("failed to create tar pipe: %w", err)
+	}
+	cr := &countingReader{reader: list.hashStream(tarPipe), callback: progressCb, paused: pauseFlag, pipelineDepth: s.pipelineDepth}
+
+	staged, applied, err := stages.Encode(ctx, cr, chain)
+	if err != nil {
+		return 0, nil, nil, err
+	}
+
+	var compCmd *exec.Cmd
+	var compStderr bytes.Buffer
+	var src io.Reader = staged
+	if compression != "" {
+		if compCmd, err = buildCompressionCmd(ctx, compression); err != nil {
+			return 0, nil, nil, err
+		}
+		// The command copies the staged stream in, so a stage error
+		// surfaces from Wait
+		compCmd.Stdin = staged
+		compCmd.Stderr = &compStderr
+		if src, err = compCmd.StdoutPipe(); err != nil {
+			return 0, nil, nil, fmt.Errorf("failed to create compression pipe: %w", err)
+		}
+	}
+
+	if err := tarCmd.Start(); err != nil {
+		return 0, nil, nil, fmt.Errorf("failed to start tar: %w", err)
+	}
+	if compCmd != nil {
+		if err := compCmd.Start(); err != nil {
+			tarCmd.Process.Kill()
+			tarCmd.Wait()
+			return 0, nil, nil, fmt.Errorf("failed to start compression: %w", err)
+		}
+	}
+
+	var written int64
+	var header *encryption.StreamHeader
+	var writeErr error
+	if keyBytes != nil {
+		written, header, writeErr = s.writeEncryptedStream(ctx, src, devicePath, keyBytes)
+	} else {
+		written, writeErr = s.writeStream(ctx, src, devicePath)
+	}
+	if writeErr != nil {
+		tarCmd.Process.Kill()
+		if compCmd != nil {
+			compCmd.Process.Kill()
+		}
+	}
+	var compErr error
+	if compCmd != nil {
+		compErr = compCmd.Wait()
+	}
+	tarErr := tarCmd.Wait()
+
+	if ctx.Err() != nil {
+		return 0, nil, nil, fmt.Errorf("backup cancelled: %w", ctx.Err())
+	}
+	if writeErr != nil {
+		return 0, nil, nil, writeErr
+	}
+	if tarErr != nil {
+		return 0, nil, nil, fmt.Errorf("tar failed: %w", tarErr)
+	}
+	if compErr != nil {
+		return 0, nil, nil, fmt.Errorf("compression failed: %s", cmdutil.ErrorDetail(compErr, &compStderr))
+	}
+	var meta *models.EncryptionMetadata
+	if header != nil {
+		meta = header.Metadata()
+	}
+	return written, meta, applied(), nil
+}
+
+// writeStream writes src to the tape device, through mbuffer when available,
+// and returns the number of bytes written
+func (s *Service) writeStream(ctx context.Context, src io.Reader, devicePath string) (int64, error) {
+	if s.useMbuffer(devicePath) {
+		mbufferCmd := exec.CommandContext(ctx, "mbuffer", "-s", fmt.Sprintf("%d", s.blockSize), "-m", fmt.Sprintf("%dM", s.bufferSizeMB), "-P", "90", "-o", devicePath)
+		tapeCr := &countingReader{reader: src, pipelineDepth: s.pipelineDepth}
+		mbufferCmd.Stdin = tapeCr
+		if err := mbufferCmd.Run(); err != nil {
+			return 0, fmt.Errorf("mbuffer failed: %w", err)
+		}
+		return tapeCr.bytesRead(), nil
+	}
+
+	tapeFile, err := s.openTapeWriter(ctx, devicePath)
+	if err != nil {
+		return 0, fmt.Errorf("failed to open tape device: %w", err)
+	}
+	defer tapeFile.Close()
+
+	bufferedTape := bufio.NewWriterSize(tapeFile, s.blockSize)
+	tapeCw := &countingWriter{writer: bufferedTape}
+	if _, err := io.Copy(tapeCw, src); err != nil {
+		return 0, fmt.Errorf("write to %s failed: %w", devicePath, err)
+	}
+	if err := bufferedTape.Flush(); err != nil {
+		return 0, fmt.Errorf("failed to flush tape buffer: %w", err)
+	}
+	if err := tapeFile.Close(); err != nil {
+		return 0, fmt.Errorf("failed to close tape device: %w", err)
+	}
+	return tapeCw.bytesWritten(), nil
+}
+
+// recordCloudCopy saves on the backup set the outcome of its cloud_copy
+// stage, if the stream went through one. A failed upload leaves the tape
+// backup as it is and raises a warning.
+func (s *Service) recordCloudCopy(backupSetID int64, jobName string, applied []models.StreamStage) {
+	for _, st := range applied {
+		if st.Name != stages.CloudCopyStage {
+			continue
+		}
+		meta := st.Metadata
+		n, _ := strconv.ParseInt(meta["bytes"], 10, 64)
+		if _, err := s.db.Exec(`
+			UPDATE backup_sets SET cloud_copy_url = ?, cloud_copy_status = ?, cloud_copy_bytes = ?,
+				cloud_copy_error = ?, cloud_copy_at = CURRENT_TIMESTAMP
+			WHERE id = ?
+		`, meta["url"], meta["status"], n, meta["error"], backupSetID); err != nil {
+			s.logger.Warn("Failed to record cloud copy", map[string]interface{}{"backup_set_id": backupSetID, "error": err.Error()})
+		}
+		if meta["status"] == stages.CloudCopyFailed {
+			s.logger.Warn("Cloud copy failed", map[string]interface{}{"backup_set_id": backupSetID, "url": meta["url"], "error": meta["error"]})
+			s.emitEvent("warning", "backup", "cloud_copy_failed", jobName, meta["url"], meta["error"])
+		} else {
+			s.logger.Info("Cloud copy uploaded", map[string]interface{}{"backup_set_id": backupSetID, "url": meta["url"], "bytes": n})
+		}
+		return
+	}
+}
@@ -0,0 +1,146 @@
+package backup
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/RoseOO/TapeBackarr/internal/database"
+	"github.com/RoseOO/TapeBackarr/internal/logging"
+	"github.com/RoseOO/TapeBackarr/internal/models"
+	"github.com/RoseOO/TapeBackarr/internal/stages"
+	"github.com/RoseOO/TapeBackarr/internal/tape"
+)
+
+func TestRunBackupStreamStages(t *testing.T) {
+	ctx := context.Background()
+	db, err := database.New(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("failed to create database: %v", err)
+	}
+	defer db.Close()
+	if err := db.Migrate(); err != nil {
+		t.Fatalf("failed to migrate database: %v", err)
+	}
+
+	srcDir := t.TempDir()
+	for _, name := range []string{"a.txt", "b.txt"} {
+		os.WriteFile(filepath.Join(srcDir, name), []byte(strings.Repeat("data "+name, 100)), 0644)
+	}
+	devicePath := "file://" + t.TempDir()
+	drive := tape.NewServiceForDevice(devicePath, 65536)
+	if err := drive.WriteTapeLabel(ctx, "ST0001", "uuid-st", "staged"); err != nil {
+		t.Fatalf("WriteTapeLabel: %v", err)
+	}
+	db.Exec("INSERT INTO tape_pools (name) VALUES ('staged')")
+	db.Exec("INSERT INTO tapes (uuid, barcode, label, pool_id, status, capacity_bytes, used_bytes) VALUES ('uuid-st', 'ST0001', 'ST0001', 1, 'active', 10000000, 0)")
+	db.Exec("INSERT INTO tape_drives (device_path, display_name, status, current_tape_id) VALUES (?, 'vtape', 'ready', 1)", devicePath)
+	db.Exec("INSERT INTO backup_sources (name, source_type, path) VALUES ('docs', 'local', ?)", srcDir)
+	db.Exec(`INSERT INTO backup_jobs (name, source_id, pool_id, backup_type, schedule_cron, retention_days, compression, stream_stages)
+		VALUES ('docs', 1, 1, 'full', '', 30, 'gzip', '[{"name":"sha256"}]')`)
+
+	logger, _ := logging.NewLogger("error", "text", "")
+	svc := NewService(db, drive, logger, 65536, 0, 0)
+	job := &models.BackupJob{ID: 1, Name: "docs", PoolID: 1, Compression: models.CompressionGzip}
+	source := &models.BackupSource{ID: 1, Name: "docs", Path: srcDir}
+
+	set, err := svc.RunBackup(ctx, job, source, 1, models.BackupTypeFull)
+	if err != nil {
+		t.Fatalf("RunBackup: %v", err)
+	}
+	var raw sql.NullString
+	db.QueryRow("SELECT stream_stages FROM backup_sets WHERE id = ?", set.ID).Scan(&raw)
+	applied, err := stages.Parse(raw)
+	if err != nil || len(applied) != 1 || applied[0].Name != "sha256" {
+		t.Fatalf("expected the sha256 stage recorded on the set, got %q (%v)", raw.String, err)
+	}
+
+	// The stage ran before compression: its checksum covers the tar stream
+	if err := drive.SeekToFileNumber(ctx, 1); err != nil {
+		t.Fatalf("SeekToFileNumber: %v", err)
+	}
+	r, err := drive.OpenReader(ctx)
+	if err != nil {
+		t.Fatalf("OpenReader: %v", err)
+	}
+	defer r.Close()
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		t.Fatalf("expected a gzip stream on tape: %v", err)
+	}
+	archive, _ := io.ReadAll(gz)
+	sum := sha256.Sum256(archive)
+	if applied[0].Metadata["sha256"] != hex.EncodeToString(sum[:]) || applied[0].Metadata["bytes"] != strconv.Itoa(len(archive)) {
+		t.Errorf("recorded %v does not match the %d byte tar stream", applied[0].Metadata, len(archive))
+	}
+	tr := tar.NewReader(bytes.NewReader(archive))
+	files := 0
+	for {
+		if _, err := tr.Next(); err != nil {
+			break
+		}
+		files++
+	}
+	if files != 2 {
+		t.Errorf("expected 2 files in the archive, got %d", files)
+	}
+
+	// A stage that is not registered fails the run before anything is written
+	db.Exec(`UPDATE backup_jobs SET stream_stages = '[{"name":"missing"}]' WHERE id = 1`)
+	if _, err := svc.RunBackup(ctx, job, source, 1, models.BackupTypeFull); err == nil || !strings.Contains(err.Error(), "unknown stage") {
+		t.Errorf("expected an unknown stage error, got %v", err)
+	}
+}
+
+func TestRecordCloudCopy(t *testing.T) {
+	db, err := database.New(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("failed to create database: %v", err)
+	}
+	defer db.Close()
+	if err := db.Migrate(); err != nil {
+		t.Fatalf("failed to migrate database: %v", err)
+	}
+	db.Exec("INSERT INTO tape_pools (name) VALUES ('p')")
+	db.Exec("INSERT INTO tapes (uuid, barcode, label, pool_id, status, capacity_bytes, used_bytes) VALUES ('u', 'T1', 'T1', 1, 'active', 1000, 0)")
+	db.Exec("INSERT INTO backup_sources (name, source_type, path) VALUES ('docs', 'local', '/tmp')")
+	db.Exec("INSERT INTO backup_jobs (name, source_id, pool_id, backup_type, schedule_cron, retention_days) VALUES ('docs', 1, 1, 'full', '', 30)")
+	db.Exec("INSERT INTO backup_sets (job_id, tape_id, backup_type, start_time, status) VALUES (1, 1, 'full', CURRENT_TIMESTAMP, 'completed')")
+
+	logger, _ := logging.NewLogger("error", "text", "")
+	svc := NewService(db, nil, logger, 65536, 0, 0)
+	var events []string
+	svc.EventCallback = func(eventType, category, key string, args ...interface{}) {
+		events = append(events, key)
+	}
+
+	// Sets without a cloud copy are left alone
+	svc.recordCloudCopy(1, "docs", []models.StreamStage{{Name: "sha256"}})
+	var status, url, errMsg string
+	var n int64
+	db.QueryRow("SELECT cloud_copy_status FROM backup_sets WHERE id = 1").Scan(&status)
+	if status != "" {
+		t.Fatalf("expected no cloud copy recorded, got %q", status)
+	}
+
+	svc.recordCloudCopy(1, "docs", []models.StreamStage{{Name: stages.CloudCopyStage, Metadata: map[string]string{
+		"url": "s3://bucket/x.tar", "status": stages.CloudCopyFailed, "bytes": "512", "error": "access denied",
+	}}})
+	db.QueryRow("SELECT cloud_copy_url, cloud_copy_status, cloud_copy_bytes, cloud_copy_error FROM backup_sets WHERE id = 1").Scan(&url, &status, &n, &errMsg)
+	if url != "s3://bucket/x.tar" || status != stages.CloudCopyFailed || n != 512 || errMsg != "access denied" {
+		t.Errorf("unexpected cloud copy %q %q %d %q", url, status, n, errMsg)
+	}
+	if len(events) != 1 || events[0] != "cloud_copy_failed" {
+		t.Errorf("expected a cloud_copy_failed event, got %v", events)
+	}
+}
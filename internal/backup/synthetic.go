@@ -0,0 +1,680 @@
+package backup
+
+import (
+	"archive/tar"
+	"bufio"
+	"compress/gzip"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/RoseOO/TapeBackarr/internal/encryption"
+	"github.com/RoseOO/TapeBackarr/internal/models"
+	"github.com/RoseOO/TapeBackarr/internal/stages"
+	"github.com/RoseOO/TapeBackarr/internal/tape"
+)
+
+// ErrInvalidSynthetic is returned by PlanSyntheticFull when a job's chain
+// cannot be synthesized into a full backup as requested.
+var ErrInvalidSynthetic = errors.New("invalid synthetic full backup")
+
+// SyntheticSet is a backup set of the chain a synthetic full is read from.
+type SyntheticSet struct {
+	BackupSetID int64     `json:"backup_set_id"`
+	BackupType  string    `json:"backup_type"`
+	StartTime   time.Time `json:"start_time"`
+	TapeID      int64     `json:"tape_id"`
+	TapeLabel   string    `json:"tape_label"`
+	TapeUUID    string    `json:"tape_uuid"`
+	StartBlock  int64     `json:"start_block"`
+	BlockSize   int       `json:"block_size"`
+	// Files and Bytes count the files whose newest version is in this set
+	// and is read from it
+	Files int   `json:"files"`
+	Bytes int64 `json:"bytes"`
+}
+
+// SyntheticPlan lists the chain a synthetic full backup is built from and
+// the tape it is written to.
+type SyntheticPlan struct {
+	JobID          int64  `json:"job_id"`
+	JobName        string `json:"job_name"`
+	TargetTapeID   int64  `json:"target_tape_id"`
+	TargetLabel    string `json:"target_label"`
+	TargetUUID     string `json:"target_uuid"`
+	TargetPool     string `json:"target_pool"`
+	TargetCapacity int64  `json:"target_capacity_bytes"`
+	// Chain is the full backup, the latest differential after it if any and
+	// the incrementals after that, oldest first
+	Chain      []SyntheticSet `json:"chain"`
+	FileCount  int            `json:"file_count"`
+	TotalBytes int64          `json:"total_bytes"`
+	// DedupFiles counts files whose data is in a set outside the new full;
+	// their catalog entries keep pointing there
+	DedupFiles int `json:"dedup_files"`
+	// DeletedFiles counts the files left out because a later set found them
+	// deleted from the source
+	DeletedFiles    int                    `json:"deleted_files"`
+	CompressionType models.CompressionType `json:"compression_type"`
+	Encrypted       bool                   `json:"encrypted"`
+
+	// Filled in once the full has been written
+	NewBackupSetID int64 `json:"new_backup_set_id,omitempty"`
+	TapeBytes      int64 `json:"tape_bytes,omitempty"`
+
+	encryptionKeyID *int64
+	files           map[string]syntheticFile
+}
+
+// syntheticFile is the newest version of a file within the chain
+type syntheticFile struct {
+	setIndex int
+	entryID  int64
+	size     int64
+	// deduplicated entries have no data in their set
+	dedup bool
+}
+
+// PlanSyntheticFull resolves the current chain of a job, its last completed
+// full backup, the latest differential after it and the incrementals after
+// that, and works out which set holds the newest version of each file. The
+// target must be a blank raw tape. Chains with sets that span several tapes,
+// were encrypted by the drive or sit on exported or LTFS tapes cannot be
+// read back and make the plan fail, and so does a full with nothing after it.
+func (s *Service) PlanSyntheticFull(jobID, targetTapeID int64) (*SyntheticPlan, error) {
+	plan := &SyntheticPlan{JobID: jobID, TargetTapeID: targetTapeID, Chain: []SyntheticSet{}, files: make(map[string]syntheticFile)}
+	if err := s.db.QueryRow("SELECT name FROM backup_jobs WHERE id = ?", jobID).Scan(&plan.JobName); err != nil {
+		return nil, fmt.Errorf("%w: job %d not found", ErrInvalidSynthetic, jobID)
+	}
+
+	var status, formatType string
+	err := s.db.QueryRow(`
+		SELECT t.label, t.uuid, COALESCE(tp.name, ''), t.capacity_bytes, t.status, t.format_type
+		FROM tapes t LEFT JOIN tape_pools tp ON tp.id = t.pool_id
+		WHERE t.id = ?
+	`, targetTapeID).Scan(&plan.TargetLabel, &plan.TargetUUID, &plan.TargetPool, &plan.TargetCapacity, &status, &formatType)
+	if err != nil {
+		return nil, fmt.Errorf("%w: target tape %d not found", ErrInvalidSynthetic, targetTapeID)
+	}
+	if status != string(models.TapeStatusBlank) || formatType != string(models.TapeFormatRaw) {
+		return nil, fmt.Errorf("%w: target tape %s must be a blank raw tape", ErrInvalidSynthetic, plan.TargetLabel)
+	}
+
+	rows, err := s.db.Query(`
+		SELECT bs.id, bs.backup_type, bs.start_time, bs.tape_id, t.label, t.uuid, t.status,
+		       COALESCE(bs.start_block, 0), COALESCE(bs.block_size, 0), bs.format_type, COALESCE(bs.hw_encrypted, 0),
+		       EXISTS (SELECT 1 FROM tape_spanning_members m WHERE m.backup_set_id = bs.id),
+		       (SELECT COUNT(*) FROM catalog_entries ce WHERE ce.backup_set_id = bs.id)
+		FROM backup_sets bs
+		JOIN tapes t ON t.id = bs.tape_id
+		WHERE bs.job_id = ? AND bs.status = ? AND bs.invalidated_at IS NULL
+		ORDER BY bs.start_time DESC, bs.id DESC
+	`, jobID, models.BackupSetStatusCompleted)
+	if err != nil {
+		return nil, err
+	}
+
+	// Newest first back to the full, as point-in-time restores resolve it
+	foundFull := false
+	skipToFull := false
+	var problem string
+	for rows.Next() {
+		var set SyntheticSet
+		var tapeStatus, setFormat string
+		var hwEncrypted, spanned bool
+		var entries int
+		if err := rows.Scan(&set.BackupSetID, &set.BackupType, &set.StartTime, &set.TapeID, &set.TapeLabel, &set.TapeUUID, &tapeStatus,
+			&set.StartBlock, &set.BlockSize, &setFormat, &hwEncrypted, &spanned, &entries); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		if entries == 0 || (skipToFull && set.BackupType != string(models.BackupTypeFull)) {
+			continue
+		}
+		switch {
+		case spanned:
+			problem = fmt.Sprintf("backup set %d spans several tapes", set.BackupSetID)
+		case hwEncrypted:
+			problem = fmt.Sprintf("backup set %d is encrypted by the drive", set.BackupSetID)
+		case setFormat != string(models.TapeFormatRaw):
+			problem = fmt.Sprintf("backup set %d is on an LTFS tape", set.BackupSetID)
+		case tapeStatus == string(models.TapeStatusExported):
+			problem = fmt.Sprintf("backup set %d is on tape %s, which is exported; import it first", set.BackupSetID, set.TapeLabel)
+		}
+		plan.Chain = append(plan.Chain, set)
+		if set.BackupType == string(models.BackupTypeFull) {
+			foundFull = true
+			break
+		}
+		skipToFull = set.BackupType == string(models.BackupTypeDifferential)
+	}
+	rows.Close()
+	if !foundFull {
+		return nil, fmt.Errorf("%w: job %s has no completed full backup", ErrInvalidSynthetic, plan.JobName)
+	}
+	if len(plan.Chain) == 1 {
+		return nil, fmt.Errorf("%w: the last full backup of job %s has no backups after it to synthesize", ErrInvalidSynthetic, plan.JobName)
+	}
+	if problem != "" {
+		return nil, fmt.Errorf("%w: %s and cannot be read back", ErrInvalidSynthetic, problem)
+	}
+	for i, j := 0, len(plan.Chain)-1; i < j; i, j = i+1, j-1 {
+		plan.Chain[i], plan.Chain[j] = plan.Chain[j], plan.Chain[i]
+	}
+
+	// The new full keeps the compression and encryption of the full it
+	// replaces
+	var encrypted bool
+	if err := s.db.QueryRow(`
+		SELECT COALESCE(compression_type, 'none'), COALESCE(encrypted, 0), encryption_key_id
+		FROM backup_sets WHERE id = ?
+	`, plan.Chain[0].BackupSetID).Scan(&plan.CompressionType, &encrypted, &plan.encryptionKeyID); err != nil {
+		return nil, err
+	}
+	if plan.CompressionType == "" {
+		plan.CompressionType = models.CompressionNone
+	}
+	if !encrypted {
+		plan.encryptionKeyID = nil
+	}
+	plan.Encrypted = plan.encryptionKeyID != nil
+
+	// Overlay the catalogs oldest first so the newest version of each file
+	// wins, dropping the files each later set found deleted
+	for i, set := range plan.Chain {
+		removed, err := s.db.Query("SELECT path FROM backup_deleted_paths WHERE backup_set_id = ?", set.BackupSetID)
+		if err != nil {
+			return nil, err
+		}
+		for removed.Next() {
+			var p string
+			if err := removed.Scan(&p); err == nil {
+				if _, ok := plan.files[p]; ok {
+					delete(plan.files, p)
+					plan.DeletedFiles++
+				}
+			}
+		}
+		removed.Close()
+
+		entries, err := s.db.Query(`
+			SELECT id, file_path, file_size, ref_backup_set_id IS NOT NULL
+			FROM catalog_entries WHERE backup_set_id = ?
+		`, set.BackupSetID)
+		if err != nil {
+			return nil, err
+		}
+		for entries.Next() {
+			var filePath string
+			f := syntheticFile{setIndex: i}
+			if err := entries.Scan(&f.entryID, &filePath, &f.size, &f.dedup); err != nil {
+				entries.Close()
+				return nil, err
+			}
+			plan.files[filePath] = f
+		}
+		entries.Close()
+		if err := entries.Err(); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, f := range plan.files {
+		plan.FileCount++
+		plan.TotalBytes += f.size
+		if f.dedup {
+			plan.DedupFiles++
+			continue
+		}
+		plan.Chain[f.setIndex].Files++
+		plan.Chain[f.setIndex].Bytes += f.size
+	}
+
+	if plan.CompressionType == models.CompressionNone && plan.TargetCapacity > 0 && plan.TotalBytes > plan.TargetCapacity {
+		return nil, fmt.Errorf("%w: the synthetic full takes %d bytes, more than the %d bytes of target tape %s",
+			ErrInvalidSynthetic, plan.TotalBytes, plan.TargetCapacity, plan.TargetLabel)
+	}
+	return plan, nil
+}
+
+// SyntheticLoader makes sure the tape of a chain set is in the source drive
+// before the set is read, e.g. by asking an operator to load it.
+type SyntheticLoader func(ctx context.Context, set *SyntheticSet) error
+
+// SynthesizeFull writes a new full backup of a plan's job onto the target
+// tape in target without reading the job's source. The sets of the chain are
+// read from source one after another, once load has put their tape there,
+// and the newest version of each file is copied from its set into a single
+// tar stream, compressed and encrypted like the chain's full. The new set
+// is recorded as a full backup started when the newest set of the chain
+// was, so later differentials and point-in-time restores start from it; the
+// chain is left as it was. Deduplicated files keep pointing at the set that
+// holds their data.
+func (s *Service) SynthesizeFull(ctx context.Context, plan *SyntheticPlan, source, target *tape.Service, load SyntheticLoader, progress func(string)) error {
+	if progress == nil {
+		progress = func(string) {}
+	}
+
+	var key []byte
+	if plan.encryptionKeyID != nil {
+		keyData, err := s.GetEncryptionKey(ctx, *plan.encryptionKeyID)
+		if err != nil {
+			return err
+		}
+		if key, err = encryption.DecodeKey(keyData); err != nil {
+			return fmt.Errorf("invalid encryption key: %w", err)
+		}
+	}
+
+	progress(fmt.Sprintf("Verifying target tape %s...", plan.TargetLabel))
+	label, err := target.ReadTapeLabel(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to read target tape label: %w", err)
+	}
+	if label == nil || label.Label != plan.TargetLabel || label.UUID != plan.TargetUUID {
+		return fmt.Errorf("target drive does not hold tape %s", plan.TargetLabel)
+	}
+	if err := target.SeekToFileNumber(ctx, 1); err != nil {
+		return fmt.Errorf("failed to position target tape past its label: %w", err)
+	}
+	var startBlock int64
+	if _, block, err := target.GetTapePosition(ctx); err == nil {
+		startBlock = block
+	}
+
+	// The tar stream is written to tape as it is produced
+	pr, pw := io.Pipe()
+	stream := &countingWriter{writer: pw}
+	var tapeBytes int64
+	var header *encryption.StreamHeader
+	tapeDone := make(chan error, 1)
+	go func() {
+		var err error
+		tapeBytes, header, err = s.writeSyntheticStream(ctx, pr, target.DevicePath(), plan.CompressionType, key)
+		if err != nil {
+			pr.CloseWithError(err)
+		}
+		tapeDone <- err
+	}()
+	abort := func(err error) error {
+		pw.CloseWithError(err)
+		<-tapeDone
+		return err
+	}
+
+	tw := tar.NewWriter(stream)
+	loadedTape := int64(0)
+	for i := range plan.Chain {
+		set := &plan.Chain[i]
+		if set.Files == 0 {
+			continue
+		}
+		if set.TapeID != loadedTape {
+			if load != nil {
+				if err := load(ctx, set); err != nil {
+					return abort(err)
+				}
+			}
+			label, err := source.ReadTapeLabel(ctx)
+			if err != nil {
+				return abort(fmt.Errorf("failed to read label of source tape %s: %w", set.TapeLabel, err))
+			}
+			if label == nil || label.Label != set.TapeLabel || label.UUID != set.TapeUUID {
+				return abort(fmt.Errorf("source drive does not hold tape %s", set.TapeLabel))
+			}
+			loadedTape = set.TapeID
+		}
+
+		progress(fmt.Sprintf("Reading %d files from backup set %d on %s...", set.Files, set.BackupSetID, set.TapeLabel))
+		copied, err := s.copySyntheticSet(ctx, source, plan, i, tw)
+		if err != nil {
+			return abort(fmt.Errorf("failed to copy files from backup set %d: %w", set.BackupSetID, err))
+		}
+		if copied != set.Files {
+			return abort(fmt.Errorf("backup set %d on %s holds %d of the %d files expected from it", set.BackupSetID, set.TapeLabel, copied, set.Files))
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return abort(fmt.Errorf("failed to finish the tar stream: %w", err))
+	}
+	// Pad a plain stream to a whole tape block; tar ignores the trailing zeros
+	if bs := int64(s.blockSize); bs > 0 && plan.CompressionType == models.CompressionNone && key == nil {
+		if rem := stream.bytesWritten() % bs; rem > 0 {
+			if _, err := stream.Write(make([]byte, bs-rem)); err != nil {
+				return abort(fmt.Errorf("failed to write to tape: %w", err))
+			}
+		}
+	}
+	pw.Close()
+	if err := <-tapeDone; err != nil {
+		return fmt.Errorf("failed to write to tape: %w", err)
+	}
+	if tapeBytes == 0 {
+		tapeBytes = stream.bytesWritten()
+	}
+	plan.TapeBytes = tapeBytes
+	if err := target.WriteFileMark(ctx); err != nil {
+		return fmt.Errorf("failed to write file mark: %w", err)
+	}
+
+	progress("Updating catalog...")
+	var meta *models.EncryptionMetadata
+	if header != nil {
+		meta = header.Metadata()
+	}
+	if err := s.recordSyntheticFull(plan, startBlock, meta); err != nil {
+		return err
+	}
+
+	progress(fmt.Sprintf("Writing TOC to %s...", plan.TargetLabel))
+	toc, err := s.syntheticTOC(plan, meta)
+	if err == nil {
+		err = target.WriteTOC(ctx, toc)
+	}
+	if err != nil {
+		s.logger.Warn("Failed to write TOC to tape", map[string]interface{}{"tape": plan.TargetLabel, "error": err.Error()})
+	}
+	if _, err := s.RecordDriveCapacity(ctx, plan.TargetTapeID, target); err != nil {
+		s.logger.Warn("Could not read remaining capacity from drive", map[string]interface{}{"tape": plan.TargetLabel, "error": err.Error()})
+	}
+	return nil
+}
+
+// writeSyntheticStream compresses and encrypts src as requested and writes
+// it to the tape device. It returns the bytes written to tape and, for
+// encrypted streams, the stream header.
+func (s *Service) writeSyntheticStream(ctx context.Context, src io.Reader, devicePath string, compression models.CompressionType, key []byte) (int64, *encryption.StreamHeader, error) {
+	var compCmd *exec.Cmd
+	if compression != models.CompressionNone {
+		var err error
+		if compCmd, err = buildCompressionCmd(ctx, compression); err != nil {
+			return 0, nil, err
+		}
+		compCmd.Stdin = src
+		out, err := compCmd.StdoutPipe()
+		if err != nil {
+			return 0, nil, fmt.Errorf("failed to create compression pipe: %w", err)
+		}
+		if err := compCmd.Start(); err != nil {
+			return 0, nil, fmt.Errorf("failed to start compression: %w", err)
+		}
+		src = out
+	}
+
+	var written int64
+	var header *encryption.StreamHeader
+	var err error
+	if key != nil {
+		written, header, err = s.writeEncryptedStream(ctx, src, devicePath, key)
+	} else {
+		written, err = s.streamReaderToTape(ctx, src, devicePath, nil, nil)
+	}
+	if compCmd != nil {
+		if err != nil {
+			compCmd.Process.Kill()
+			compCmd.Wait()
+		} else if werr := compCmd.Wait(); werr != nil {
+			err = fmt.Errorf("compression failed: %w", werr)
+		}
+	}
+	return written, header, err
+}
+
+// copySyntheticSet reads the tar stream of a chain set from source and
+// copies the entries whose newest version is in it to tw. It returns how
+// many entries were copied.
+func (s *Service) copySyntheticSet(ctx context.Context, source *tape.Service, plan *SyntheticPlan, index int, tw *tar.Writer) (int, error) {
+	set := &plan.Chain[index]
+	var encrypted bool
+	var encryptionKeyID *int64
+	var compressionType string
+	var encFormat, encKDF, encSalt, encIV string
+	var encChunkSize int
+	var streamStages sql.NullString
+	if err := s.db.QueryRow(`
+		SELECT COALESCE(encrypted, 0), encryption_key_id, COALESCE(compression_type, 'none'),
+		       encryption_format, encryption_kdf, encryption_salt, encryption_iv, encryption_chunk_size, stream_stages
+		FROM backup_sets WHERE id = ?
+	`, set.BackupSetID).Scan(&encrypted, &encryptionKeyID, &compressionType,
+		&encFormat, &encKDF, &encSalt, &encIV, &encChunkSize, &streamStages); err != nil {
+		return 0, err
+	}
+	applied, err := stages.Parse(streamStages)
+	if err != nil {
+		return 0, err
+	}
+
+	if set.StartBlock > 0 {
+		err = source.SeekToBlock(ctx, set.StartBlock)
+	} else {
+		err = source.SeekToFileNumber(ctx, 1)
+	}
+	if err != nil {
+		return 0, fmt.Errorf("failed to position tape %s: %w", set.TapeLabel, err)
+	}
+	readSize := source.GetBlockSize()
+	if source.IsPhysical() && set.BlockSize > 0 {
+		if err := source.SetBlockSize(ctx, set.BlockSize); err != nil {
+			return 0, fmt.Errorf("failed to set block size: %w", err)
+		}
+		readSize = set.BlockSize
+	}
+
+	tapeFile, err := source.OpenReader(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("failed to open tape device: %w", err)
+	}
+	defer tapeFile.Close()
+
+	var stream io.Reader = bufio.NewReaderSize(tapeFile, readSize)
+	if encrypted && encryptionKeyID != nil {
+		keyData, err := s.GetEncryptionKey(ctx, *encryptionKeyID)
+		if err != nil {
+			return 0, err
+		}
+		encMeta := models.ParseEncryptionMetadata(encFormat, encKDF, encSalt, encIV, encChunkSize)
+		if stream, err = encryption.NewBackupDecryptingReader(stream, keyData, encMeta); err != nil {
+			return 0, fmt.Errorf("failed to start decryption: %w", err)
+		}
+	}
+	var decompCmd *exec.Cmd
+	switch models.CompressionType(compressionType) {
+	case models.CompressionNone, "":
+	case models.CompressionGzip:
+		gz, err := gzip.NewReader(stream)
+		if err != nil {
+			return 0, fmt.Errorf("failed to open gzip stream: %w", err)
+		}
+		defer gz.Close()
+		stream = gz
+	case models.CompressionZstd:
+		decompCmd = exec.CommandContext(ctx, "zstd", "-d", "-c", "--no-progress")
+		decompCmd.Stdin = stream
+		pipe, err := decompCmd.StdoutPipe()
+		if err != nil {
+			return 0, fmt.Errorf("failed to create zstd pipe: %w", err)
+		}
+		if err := decompCmd.Start(); err != nil {
+			return 0, fmt.Errorf("failed to start zstd: %w", err)
+		}
+		defer func() {
+			decompCmd.Process.Kill()
+			decompCmd.Wait()
+		}()
+		stream = pipe
+	default:
+		return 0, fmt.Errorf("unsupported compression type: %s", compressionType)
+	}
+	if stream, err = stages.Decode(ctx, stream, applied); err != nil {
+		return 0, err
+	}
+
+	copied := 0
+	tr := tar.NewReader(stream)
+	for {
+		if ctx.Err() != nil {
+			return copied, ctx.Err()
+		}
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return copied, fmt.Errorf("failed to read tar stream: %w", err)
+		}
+		f, ok := plan.files[archiveEntryPath(hdr.Name)]
+		if !ok || f.setIndex != index || f.dedup {
+			continue
+		}
+		if err := tw.WriteHeader(hdr); err != nil {
+			return copied, err
+		}
+		if _, err := io.Copy(tw, tr); err != nil {
+			return copied, err
+		}
+		copied++
+	}
+	// Read the stream to its end so stages that check it there do
+	if _, err := io.Copy(io.Discard, stream); err != nil {
+		return copied, fmt.Errorf("failed to read stream: %w", err)
+	}
+	return copied, nil
+}
+
+// recordSyntheticFull records the new full and copies the catalog entries
+// of the newest version of each file into it in one transaction
+func (s *Service) recordSyntheticFull(plan *SyntheticPlan, startBlock int64, meta *models.EncryptionMetadata) error {
+	// Copy every column that is not about the entry's place in its set, so
+	// columns added later carry over too
+	rows, err := s.db.Query("SELECT name FROM pragma_table_info('catalog_entries')")
+	if err != nil {
+		return err
+	}
+	var columns []string
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err == nil {
+			switch name {
+			case "id", "backup_set_id", "block_offset", "created_at":
+			default:
+				columns = append(columns, name)
+			}
+		}
+	}
+	rows.Close()
+	columnList := strings.Join(columns, ", ")
+
+	var encFormat models.EncryptionFormat
+	var encKDF, encSalt, encIV string
+	var encChunkSize int
+	if meta != nil {
+		encFormat, encKDF, encSalt, encIV, encChunkSize = meta.Format, meta.KDFJSON(), meta.Salt, meta.IV, meta.ChunkSize
+	}
+	var dedupBytes int64
+	for _, f := range plan.files {
+		if f.dedup {
+			dedupBytes += f.size
+		}
+	}
+	newest := plan.Chain[len(plan.Chain)-1]
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// The start time is copied as stored so the new full sorts right after
+	// the newest set of the chain
+	now := time.Now()
+	res, err := tx.Exec(`
+		INSERT INTO backup_sets (job_id, tape_id, backup_type, format_type, start_time, end_time, status,
+			file_count, total_bytes, tape_bytes, start_block, block_size,
+			encrypted, encryption_key_id, encryption_format, encryption_kdf, encryption_salt, encryption_iv, encryption_chunk_size,
+			compressed, compression_type, dedup_count, dedup_bytes, symlink_policy, synthetic)
+		SELECT ?, ?, ?, ?, start_time, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, symlink_policy, 1
+		FROM backup_sets WHERE id = ?
+	`, plan.JobID, plan.TargetTapeID, models.BackupTypeFull, models.TapeFormatRaw, now, models.BackupSetStatusCompleted,
+		plan.FileCount, plan.TotalBytes, plan.TapeBytes, startBlock, s.blockSize,
+		plan.encryptionKeyID != nil, plan.encryptionKeyID, encFormat, encKDF, encSalt, encIV, encChunkSize,
+		plan.CompressionType != models.CompressionNone, plan.CompressionType, plan.DedupFiles, dedupBytes, newest.BackupSetID)
+	if err != nil {
+		return fmt.Errorf("failed to record synthetic full: %w", err)
+	}
+	newID, err := res.LastInsertId()
+	if err != nil {
+		return err
+	}
+
+	stmt, err := tx.Prepare(`
+		INSERT INTO catalog_entries (backup_set_id, ` + columnList + `)
+		SELECT ?, ` + columnList + ` FROM catalog_entries WHERE id = ?
+	`)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+	for _, f := range plan.files {
+		if _, err := stmt.Exec(newID, f.entryID); err != nil {
+			return fmt.Errorf("failed to catalog synthetic full: %w", err)
+		}
+	}
+
+	if _, err := tx.Exec(`
+		UPDATE tapes SET status = ?, used_bytes = ?, write_count = write_count + 1, last_written_at = ?, physical_remaining_bytes = NULL,
+		       updated_at = CURRENT_TIMESTAMP
+		WHERE id = ?
+	`, models.TapeStatusActive, plan.TapeBytes, now, plan.TargetTapeID); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	plan.NewBackupSetID = newID
+	return nil
+}
+
+// syntheticTOC describes the synthetic full for the target tape's TOC
+func (s *Service) syntheticTOC(plan *SyntheticPlan, meta *models.EncryptionMetadata) (*tape.TapeTOC, error) {
+	toc := tape.NewTapeTOC(plan.TargetLabel, plan.TargetUUID, plan.TargetPool)
+	entry := tape.TOCBackupSet{
+		FileNumber:      1,
+		JobName:         plan.JobName,
+		BackupType:      string(models.BackupTypeFull),
+		StartTime:       plan.Chain[len(plan.Chain)-1].StartTime,
+		EndTime:         time.Now(),
+		FileCount:       int64(plan.FileCount),
+		TotalBytes:      plan.TotalBytes,
+		Encrypted:       meta != nil,
+		Encryption:      meta,
+		Compressed:      plan.CompressionType != models.CompressionNone,
+		CompressionType: string(plan.CompressionType),
+		Files:           []tape.TOCFileEntry{},
+	}
+	rows, err := s.db.Query(`
+		SELECT file_path, file_size, COALESCE(file_mode, 0), mod_time, COALESCE(checksum, '')
+		FROM catalog_entries WHERE backup_set_id = ? ORDER BY id
+	`, plan.NewBackupSetID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var f tape.TOCFileEntry
+		var modTime *time.Time
+		if err := rows.Scan(&f.Path, &f.Size, &f.Mode, &modTime, &f.Checksum); err != nil {
+			continue
+		}
+		if modTime != nil {
+			f.ModTime = modTime.Format(time.RFC3339)
+		}
+		entry.Files = append(entry.Files, f)
+	}
+	toc.BackupSets = append(toc.BackupSets, entry)
+	return toc, rows.Err()
+}
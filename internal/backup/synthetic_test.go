@@ -0,0 +1,169 @@
+package backup
+
+import (
+	"archive/tar"
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/RoseOO/TapeBackarr/internal/database"
+	"github.com/RoseOO/TapeBackarr/internal/logging"
+	"github.com/RoseOO/TapeBackarr/internal/models"
+	"github.com/RoseOO/TapeBackarr/internal/tape"
+)
+
+func TestSynthesizeFull(t *testing.T) {
+	ctx := context.Background()
+	db, err := database.New(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("failed to create database: %v", err)
+	}
+	defer db.Close()
+	if err := db.Migrate(); err != nil {
+		t.Fatalf("failed to migrate database: %v", err)
+	}
+
+	srcDir := t.TempDir()
+	base := time.Now().Add(-time.Hour)
+	write := func(name, data string, at time.Time) {
+		path := filepath.Join(srcDir, name)
+		os.WriteFile(path, []byte(data), 0644)
+		os.Chtimes(path, at, at)
+	}
+	write("a.txt", "a", base)
+	write("b.txt", "b", base)
+	write("c.txt", "c", base)
+
+	// The full goes to SY0001 in one drive and the incremental to SY0002
+	// in another; SY0003 is the blank target
+	cartridges := map[string]string{}
+	db.Exec("INSERT INTO tape_pools (name) VALUES ('synth')")
+	for i, label := range []string{"SY0001", "SY0002", "SY0003"} {
+		devicePath := "file://" + t.TempDir()
+		cartridges[label] = devicePath
+		if err := tape.NewServiceForDevice(devicePath, 65536).WriteTapeLabel(ctx, label, "uuid-"+label, "synth"); err != nil {
+			t.Fatalf("WriteTapeLabel: %v", err)
+		}
+		status := "active"
+		if label == "SY0003" {
+			status = "blank"
+		}
+		db.Exec("INSERT INTO tapes (uuid, barcode, label, pool_id, status, capacity_bytes, used_bytes) VALUES (?, ?, ?, 1, ?, 10000000, 0)",
+			"uuid-"+label, label, label, status)
+		db.Exec("INSERT INTO tape_drives (device_path, display_name, status, current_tape_id) VALUES (?, ?, 'ready', ?)", devicePath, label, i+1)
+	}
+	db.Exec("INSERT INTO backup_sources (name, source_type, path) VALUES ('docs', 'local', ?)", srcDir)
+	db.Exec("INSERT INTO backup_jobs (name, source_id, pool_id, backup_type, schedule_cron, retention_days) VALUES ('docs', 1, 1, 'incremental', '', 30)")
+
+	logger, _ := logging.NewLogger("error", "text", "")
+	svc := NewService(db, tape.NewServiceForDevice(cartridges["SY0001"], 65536), logger, 65536, 0, 0)
+	job := &models.BackupJob{ID: 1, Name: "docs", PoolID: 1, BackupType: models.BackupTypeIncremental}
+	source := &models.BackupSource{ID: 1, Name: "docs", Path: srcDir}
+
+	if _, err := svc.RunBackup(ctx, job, source, 1, models.BackupTypeFull); err != nil {
+		t.Fatalf("full run: %v", err)
+	}
+	if _, err := svc.PlanSyntheticFull(1, 3); !errors.Is(err, ErrInvalidSynthetic) {
+		t.Errorf("expected a full with nothing after it to be refused, got %v", err)
+	}
+	write("a.txt", "a changed", base.Add(10*time.Minute))
+	write("d.txt", "d", base.Add(10*time.Minute))
+	os.Remove(filepath.Join(srcDir, "b.txt"))
+	if _, err := svc.RunBackup(ctx, job, source, 2, models.BackupTypeIncremental); err != nil {
+		t.Fatalf("incremental run: %v", err)
+	}
+
+	if _, err := svc.PlanSyntheticFull(1, 1); !errors.Is(err, ErrInvalidSynthetic) {
+		t.Errorf("expected a target that is not blank to be refused, got %v", err)
+	}
+	plan, err := svc.PlanSyntheticFull(1, 3)
+	if err != nil {
+		t.Fatalf("PlanSyntheticFull: %v", err)
+	}
+	if len(plan.Chain) != 2 || plan.FileCount != 3 || plan.DeletedFiles != 1 || plan.Chain[0].Files != 1 || plan.Chain[1].Files != 2 {
+		t.Fatalf("unexpected plan %+v", plan)
+	}
+
+	// The source drive holds SY0001; loading SY0002 moves its cartridge in
+	sourceDir := strings.TrimPrefix(cartridges["SY0001"], "file://")
+	var loads []string
+	load := func(ctx context.Context, set *SyntheticSet) error {
+		loads = append(loads, set.TapeLabel)
+		if set.TapeLabel == "SY0001" {
+			return nil
+		}
+		from := strings.TrimPrefix(cartridges[set.TapeLabel], "file://")
+		names, _ := filepath.Glob(filepath.Join(sourceDir, "*"))
+		for _, name := range names {
+			os.Remove(name)
+		}
+		names, _ = filepath.Glob(filepath.Join(from, "*"))
+		for _, name := range names {
+			data, _ := os.ReadFile(name)
+			os.WriteFile(filepath.Join(sourceDir, filepath.Base(name)), data, 0644)
+		}
+		return nil
+	}
+	sourceDrive := tape.NewServiceForDevice(cartridges["SY0001"], 65536)
+	target := tape.NewServiceForDevice(cartridges["SY0003"], 65536)
+	if err := svc.SynthesizeFull(ctx, plan, sourceDrive, target, load, nil); err != nil {
+		t.Fatalf("SynthesizeFull: %v", err)
+	}
+	if strings.Join(loads, ",") != "SY0001,SY0002" {
+		t.Errorf("expected each source tape loaded once, got %v", loads)
+	}
+
+	// The target holds the newest version of every file that still exists
+	if err := target.SeekToFileNumber(ctx, 1); err != nil {
+		t.Fatalf("SeekToFileNumber: %v", err)
+	}
+	r, _ := target.OpenReader(ctx)
+	contents := map[string]string{}
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if err != nil {
+			break
+		}
+		data, _ := io.ReadAll(tr)
+		contents[archiveEntryPath(hdr.Name)] = string(data)
+	}
+	r.Close()
+	if len(contents) != 3 || contents["a.txt"] != "a changed" || contents["c.txt"] != "c" || contents["d.txt"] != "d" {
+		t.Fatalf("unexpected synthetic full contents %v", contents)
+	}
+
+	var backupType, tapeStatus string
+	var synthetic bool
+	var tapeID int64
+	db.QueryRow("SELECT backup_type, synthetic, tape_id FROM backup_sets WHERE id = ?", plan.NewBackupSetID).Scan(&backupType, &synthetic, &tapeID)
+	db.QueryRow("SELECT status FROM tapes WHERE id = 3").Scan(&tapeStatus)
+	if backupType != "full" || !synthetic || tapeID != 3 || tapeStatus != "active" {
+		t.Errorf("unexpected new set: type=%s synthetic=%v tape=%d tape status=%s", backupType, synthetic, tapeID, tapeStatus)
+	}
+	var paths []string
+	rows, _ := db.Query("SELECT file_path FROM catalog_entries WHERE backup_set_id = ?", plan.NewBackupSetID)
+	for rows.Next() {
+		var p string
+		rows.Scan(&p)
+		paths = append(paths, p)
+	}
+	rows.Close()
+	sort.Strings(paths)
+	if strings.Join(paths, ",") != "a.txt,c.txt,d.txt" {
+		t.Errorf("unexpected catalog of the synthetic full %v", paths)
+	}
+
+	// The synthetic full is the newest full, so there is nothing after it
+	// to synthesize
+	db.Exec("INSERT INTO tapes (uuid, barcode, label, pool_id, status, capacity_bytes) VALUES ('uuid-SY0004', 'SY0004', 'SY0004', 1, 'blank', 10000000)")
+	if _, err := svc.PlanSyntheticFull(1, 4); !errors.Is(err, ErrInvalidSynthetic) {
+		t.Errorf("expected the synthetic full to start the chain, got %v", err)
+	}
+}
@@ -0,0 +1,661 @@
+package backup
+
+import (
+	"archive/tar"
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/RoseOO/TapeBackarr/internal/models"
+	"github.com/RoseOO/TapeBackarr/internal/tape"
+)
+
+// Uploads let external systems push a single artifact straight onto tape
+// over HTTP, without staging it on the server's disk. The artifact is
+// wrapped in a one-entry tar stream as it arrives, so the resulting backup
+// set is catalogued and restored like any other. Chunks must arrive in
+// order; a dropped connection can be resumed from the last acknowledged
+// offset, but because the data is already on tape an upload does not
+// survive a server restart.
+
+// Upload states
+const (
+	UploadReceiving = "receiving"
+	UploadCompleted = "completed"
+	UploadFailed    = "failed"
+)
+
+var (
+	// ErrUploadNotFound is returned for unknown or pruned upload IDs
+	ErrUploadNotFound = errors.New("upload not found")
+	// ErrUploadBusy is returned when a chunk arrives while another chunk of
+	// the same upload is still being written
+	ErrUploadBusy = errors.New("another chunk of this upload is being written")
+	// ErrUploadClosed is returned for chunks sent to a finished upload
+	ErrUploadClosed = errors.New("upload is no longer accepting data")
+)
+
+// UploadOffsetError is returned when a chunk does not start where the data
+// received so far ends
+type UploadOffsetError struct {
+	Expected int64
+}
+
+func (e *UploadOffsetError) Error() string {
+	return fmt.Sprintf("chunk must start at offset %d", e.Expected)
+}
+
+// uploadIdleTimeout aborts uploads that receive no data for this long, so an
+// abandoned upload does not hold the drive forever
+var uploadIdleTimeout = time.Hour
+
+// uploadRetention is how long finished uploads can still be queried
+const uploadRetention = 24 * time.Hour
+
+// UploadRequest describes the artifact an external producer will send
+type UploadRequest struct {
+	Path    string    // catalog path of the artifact, relative
+	Size    int64     // exact size in bytes; the tar header precedes the data
+	SHA256  string    // optional expected checksum, verified on completion
+	Mode    int64     // file mode; 0644 when zero
+	ModTime time.Time // modification time; now when zero
+}
+
+// UploadStatus reports the state of an upload
+type UploadStatus struct {
+	ID          string `json:"id"`
+	JobID       int64  `json:"job_id"`
+	BackupSetID int64  `json:"backup_set_id"`
+	TapeID      int64  `json:"tape_id"`
+	TapeLabel   string `json:"tape_label"`
+	Path        string `json:"path"`
+	Size        int64  `json:"size"`
+	Offset      int64  `json:"offset"`
+	Status      string `json:"status"`
+	Error       string `json:"error,omitempty"`
+	SHA256      string `json:"sha256,omitempty"`
+	// ArtifactID is the catalog entry of a completed upload; it can be
+	// recalled from tape through the artifacts API
+	ArtifactID int64     `json:"artifact_id,omitempty"`
+	StartedAt  time.Time `json:"started_at"`
+	UpdatedAt  time.Time `json:"updated_at"`
+}
+
+// upload is an open tar stream to a tape fed by successive chunks
+type upload struct {
+	writing sync.Mutex // held while a chunk is copied in or the upload is finalised
+
+	mu     sync.Mutex // guards status and reason
+	status UploadStatus
+	reason string // why the upload context was cancelled
+
+	job        *models.BackupJob
+	req        UploadRequest
+	tapeUUID   string
+	poolName   string
+	devicePath string
+	driveSvc   *tape.Service
+	ctx        context.Context
+	cancel     context.CancelFunc
+	pipe       *io.PipeWriter
+	stream     *countingWriter // tar bytes produced, used to pad the last block
+	tw         *tar.Writer
+	hash       hash.Hash
+	idle       *time.Timer
+	tapeBytes  int64
+	tapeErr    error
+	tapeDone   chan struct{}
+	finished   chan struct{}
+	finishOnce sync.Once
+	driveBusy  bool   // drive was marked busy
+	release    func() // releases the tape reservation
+}
+
+func (u *upload) snapshot() UploadStatus {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	return u.status
+}
+
+func (u *upload) update(fn func(st *UploadStatus)) {
+	u.mu.Lock()
+	fn(&u.status)
+	u.status.UpdatedAt = time.Now()
+	u.mu.Unlock()
+}
+
+// cancelWith cancels the upload, recording why
+func (u *upload) cancelWith(reason string) {
+	u.mu.Lock()
+	if u.reason == "" {
+		u.reason = reason
+	}
+	u.mu.Unlock()
+	u.cancel()
+}
+
+// uploadSink feeds chunk data into the tar stream and checksum, advancing
+// the offset only for bytes that reached the tape pipeline
+type uploadSink struct {
+	u   *upload
+	err error
+}
+
+func (w *uploadSink) Write(p []byte) (int, error) {
+	n, err := w.u.tw.Write(p)
+	w.u.hash.Write(p[:n])
+	w.u.update(func(st *UploadStatus) { st.Offset += int64(n) })
+	if err != nil {
+		w.err = err
+	}
+	return n, err
+}
+
+// StartUpload positions the tape for a new backup set of job and opens the
+// tar stream an artifact of req.Size bytes will be written into. The tape
+// must be loaded in an enabled drive and use the raw format.
+func (s *Service) StartUpload(ctx context.Context, job *models.BackupJob, tapeID int64, req UploadRequest) (*UploadStatus, error) {
+	startTime := time.Now()
+
+	req.Path = archiveEntryPath(req.Path)
+	if req.Path == "" {
+		return nil, fmt.Errorf("path is required")
+	}
+	if req.Size < 0 {
+		return nil, fmt.Errorf("size cannot be negative")
+	}
+	req.SHA256 = strings.ToLower(req.SHA256)
+	if req.SHA256 != "" {
+		if b, err := hex.DecodeString(req.SHA256); err != nil || len(b) != sha256.Size {
+			return nil, fmt.Errorf("sha256 must be 64 hexadecimal characters")
+		}
+	}
+	if req.Mode == 0 {
+		req.Mode = 0644
+	}
+	if req.ModTime.IsZero() {
+		req.ModTime = startTime
+	}
+
+	var tapeLabel, tapeUUID, poolName, tapeFormatType string
+	var tapeCapacity, tapeUsed int64
+	if err := s.db.QueryRow(`
+		SELECT t.label, t.uuid, COALESCE(p.name, ''), COALESCE(t.format_type, 'raw'), t.capacity_bytes, t.used_bytes
+		FROM tapes t LEFT JOIN tape_pools p ON t.pool_id = p.id
+		WHERE t.id = ?
+	`, tapeID).Scan(&tapeLabel, &tapeUUID, &poolName, &tapeFormatType, &tapeCapacity, &tapeUsed); err != nil {
+		return nil, fmt.Errorf("tape not found: %w", err)
+	}
+	if tapeFormatType == string(models.TapeFormatLTFS) {
+		return nil, fmt.Errorf("tape %s is LTFS formatted; uploads can only be written to raw tapes", tapeLabel)
+	}
+	if tapeCapacity > 0 && req.Size > tapeCapacity-tapeUsed {
+		return nil, fmt.Errorf("upload (%d bytes) does not fit on tape %s (%d bytes free)", req.Size, tapeLabel, tapeCapacity-tapeUsed)
+	}
+	if err := s.CheckTapeWritable(tapeID); err != nil {
+		return nil, err
+	}
+
+	var devicePath string
+	if err := s.db.QueryRow("SELECT device_path FROM tape_drives WHERE current_tape_id = ? AND COALESCE(enabled, 1) = 1", tapeID).Scan(&devicePath); err != nil {
+		return nil, fmt.Errorf("tape %s is not loaded in any enabled drive", tapeLabel)
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	var pauseFlag int32
+	u := &upload{
+		status: UploadStatus{
+			ID:        newUploadID(),
+			JobID:     job.ID,
+			TapeID:    tapeID,
+			TapeLabel: tapeLabel,
+			Path:      req.Path,
+			Size:      req.Size,
+			Status:    UploadReceiving,
+			StartedAt: startTime,
+			UpdatedAt: startTime,
+		},
+		job:        job,
+		req:        req,
+		tapeUUID:   tapeUUID,
+		poolName:   poolName,
+		devicePath: devicePath,
+		ctx:        ctx,
+		cancel:     cancel,
+		hash:       sha256.New(),
+		tapeDone:   make(chan struct{}),
+		finished:   make(chan struct{}),
+	}
+
+	s.mu.Lock()
+	if _, running := s.activeJobs[job.ID]; running {
+		s.mu.Unlock()
+		cancel()
+		return nil, fmt.Errorf("job %s is already running", job.Name)
+	}
+	s.activeJobs[job.ID] = &JobProgress{
+		JobID:             job.ID,
+		JobName:           job.Name,
+		Phase:             "initializing",
+		Status:            "running",
+		Message:           "Starting upload...",
+		TapeLabel:         tapeLabel,
+		TapeCapacityBytes: tapeCapacity,
+		TapeUsedBytes:     tapeUsed,
+		DevicePath:        devicePath,
+		TotalFiles:        1,
+		TotalBytes:        req.Size,
+		StartTime:         startTime,
+		UpdatedAt:         startTime,
+		LogLines:          []string{fmt.Sprintf("[%s] Receiving upload %s for job %s", startTime.Format("15:04:05"), req.Path, job.Name)},
+	}
+	s.cancelFuncs[job.ID] = func() { u.cancelWith("Upload cancelled by user") }
+	s.pauseFlags[job.ID] = &pauseFlag
+	s.mu.Unlock()
+
+	release, err := s.holdTape(tapeID, job.ID)
+	if err != nil {
+		s.finishUpload(u)
+		return nil, err
+	}
+	u.release = release
+
+	result, err := s.db.Exec(`
+		INSERT INTO backup_sets (job_id, tape_id, backup_type, format_type, start_time, status, block_size)
+		VALUES (?, ?, ?, ?, ?, ?, ?)
+	`, job.ID, tapeID, models.BackupTypeFull, tapeFormatType, startTime, models.BackupSetStatusRunning, s.blockSize)
+	if err != nil {
+		s.finishUpload(u)
+		return nil, fmt.Errorf("failed to create backup set: %w", err)
+	}
+	backupSetID, _ := result.LastInsertId()
+	u.status.BackupSetID = backupSetID
+	s.mu.Lock()
+	if p, ok := s.activeJobs[job.ID]; ok {
+		p.BackupSetID = backupSetID
+	}
+	s.mu.Unlock()
+
+	fail := func(msg string, cause error) (*UploadStatus, error) {
+		u.status.Status = UploadFailed
+		u.status.Error = msg
+		s.updateProgress(job.ID, "failed", msg)
+		s.updateBackupSetStatus(backupSetID, models.BackupSetStatusFailed, msg)
+		s.finishUpload(u)
+		return nil, fmt.Errorf("%s: %w", msg, cause)
+	}
+
+	s.db.Exec("UPDATE tape_drives SET status = 'busy' WHERE device_path = ?", devicePath)
+	u.driveBusy = true
+
+	s.updateProgress(job.ID, "positioning", "Verifying tape label before write...")
+	u.driveSvc = tape.NewServiceForDevice(devicePath, s.tapeService.GetBlockSize())
+	physicalLabel, err := u.driveSvc.ReadTapeLabel(ctx)
+	if err != nil {
+		return fail("Failed to read tape label", err)
+	}
+	if physicalLabel == nil || physicalLabel.Label != tapeLabel || physicalLabel.UUID != tapeUUID {
+		actual := "unlabeled"
+		if physicalLabel != nil {
+			actual = physicalLabel.Label
+		}
+		return fail("Tape label mismatch", fmt.Errorf("expected %q but found %q", tapeLabel, actual))
+	}
+	if err := u.driveSvc.SeekToFileNumber(ctx, 1); err != nil {
+		return fail("Failed to position tape past label", err)
+	}
+	if _, startBlock, posErr := u.driveSvc.GetTapePosition(ctx); posErr == nil {
+		s.db.Exec("UPDATE backup_sets SET start_block = ? WHERE id = ?", startBlock, backupSetID)
+	}
+
+	progressCb := func(bytesWritten int64) {
+		s.mu.Lock()
+		if p, ok := s.activeJobs[job.ID]; ok {
+			p.BytesWritten = bytesWritten
+			p.UpdatedAt = time.Now()
+		}
+		s.mu.Unlock()
+	}
+	pr, pw := io.Pipe()
+	go func() {
+		defer close(u.tapeDone)
+		u.tapeBytes, u.tapeErr = s.streamReaderToTape(ctx, pr, devicePath, progressCb, &pauseFlag)
+		if u.tapeErr != nil {
+			pr.CloseWithError(u.tapeErr)
+		}
+	}()
+	u.pipe = pw
+	u.stream = &countingWriter{writer: pw}
+	u.tw = tar.NewWriter(u.stream)
+
+	if err := u.tw.WriteHeader(&tar.Header{
+		Typeflag: tar.TypeReg,
+		Name:     req.Path,
+		Size:     req.Size,
+		Mode:     req.Mode,
+		ModTime:  req.ModTime,
+	}); err != nil {
+		pw.CloseWithError(err)
+		cancel()
+		<-u.tapeDone
+		return fail("Failed to start the tape stream", err)
+	}
+
+	// Cancellation (by the user, an abort or the idle timeout) unblocks the
+	// tape stream and fails the upload once any chunk in flight has stopped
+	go func() {
+		<-ctx.Done()
+		pr.CloseWithError(context.Canceled)
+		u.writing.Lock()
+		defer u.writing.Unlock()
+		u.mu.Lock()
+		reason := u.reason
+		u.mu.Unlock()
+		if reason == "" {
+			reason = "Upload cancelled"
+		}
+		s.failUpload(u, reason)
+	}()
+	u.idle = time.AfterFunc(uploadIdleTimeout, func() {
+		u.cancelWith(fmt.Sprintf("No data received for %s", uploadIdleTimeout))
+	})
+
+	s.mu.Lock()
+	if s.uploads == nil {
+		s.uploads = make(map[string]*upload)
+	}
+	s.pruneUploadsLocked(startTime)
+	s.uploads[u.status.ID] = u
+	s.mu.Unlock()
+
+	s.updateProgress(job.ID, "streaming", fmt.Sprintf("Waiting for %d bytes of %s...", req.Size, req.Path))
+	s.emitEvent("info", "backup", "upload_started", req.Path, tapeLabel, job.Name)
+	s.logger.Info("Upload started", map[string]interface{}{
+		"upload_id":     u.status.ID,
+		"job_id":        job.ID,
+		"backup_set_id": backupSetID,
+		"path":          req.Path,
+		"size":          req.Size,
+		"tape":          tapeLabel,
+	})
+
+	st := u.snapshot()
+	return &st, nil
+}
+
+// WriteUpload appends a chunk read from r to the upload. offset must equal
+// the number of bytes received so far. When r ends early the bytes read up
+// to that point are kept and the chunk can be resent from the returned
+// offset. The upload completes as soon as its declared size is reached.
+func (s *Service) WriteUpload(id string, offset int64, r io.Reader) (*UploadStatus, error) {
+	u := s.lookupUpload(id)
+	if u == nil {
+		return nil, ErrUploadNotFound
+	}
+	if !u.writing.TryLock() {
+		return nil, ErrUploadBusy
+	}
+	defer u.writing.Unlock()
+
+	st := u.snapshot()
+	if st.Status != UploadReceiving {
+		return &st, ErrUploadClosed
+	}
+	if offset != st.Offset {
+		return &st, &UploadOffsetError{Expected: st.Offset}
+	}
+
+	u.idle.Stop()
+	sink := &uploadSink{u: u}
+	_, readErr := io.Copy(sink, io.LimitReader(r, st.Size-st.Offset))
+	if sink.err != nil {
+		if u.ctx.Err() == nil {
+			s.failUpload(u, "Failed to write to tape: "+sink.err.Error())
+		}
+		st = u.snapshot()
+		return &st, sink.err
+	}
+	st = u.snapshot()
+	if readErr != nil {
+		u.idle.Reset(uploadIdleTimeout)
+		return &st, fmt.Errorf("upload interrupted at offset %d: %w", st.Offset, readErr)
+	}
+	if st.Offset < st.Size {
+		u.idle.Reset(uploadIdleTimeout)
+		return &st, nil
+	}
+
+	var extra [1]byte
+	if n, _ := io.ReadFull(r, extra[:]); n > 0 {
+		s.failUpload(u, fmt.Sprintf("Received more than the declared %d bytes", st.Size))
+	} else {
+		s.completeUpload(u)
+	}
+	st = u.snapshot()
+	if st.Status == UploadFailed {
+		return &st, errors.New(st.Error)
+	}
+	return &st, nil
+}
+
+// GetUpload returns the status of an upload
+func (s *Service) GetUpload(id string) (*UploadStatus, error) {
+	u := s.lookupUpload(id)
+	if u == nil {
+		return nil, ErrUploadNotFound
+	}
+	st := u.snapshot()
+	return &st, nil
+}
+
+// ListUploads returns open uploads and those finished within the last day,
+// newest first
+func (s *Service) ListUploads() []UploadStatus {
+	s.mu.Lock()
+	s.pruneUploadsLocked(time.Now())
+	list := make([]UploadStatus, 0, len(s.uploads))
+	for _, u := range s.uploads {
+		list = append(list, u.snapshot())
+	}
+	s.mu.Unlock()
+	sort.Slice(list, func(i, j int) bool { return list[i].StartedAt.After(list[j].StartedAt) })
+	return list
+}
+
+// AbortUpload cancels an open upload and waits until its backup set has been
+// marked failed and the drive released
+func (s *Service) AbortUpload(id string) (*UploadStatus, error) {
+	u := s.lookupUpload(id)
+	if u == nil {
+		return nil, ErrUploadNotFound
+	}
+	if st := u.snapshot(); st.Status != UploadReceiving {
+		return &st, ErrUploadClosed
+	}
+	u.cancelWith("Upload aborted")
+	<-u.finished
+	st := u.snapshot()
+	return &st, nil
+}
+
+func (s *Service) lookupUpload(id string) *upload {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.uploads[id]
+}
+
+// pruneUploadsLocked forgets uploads finished more than uploadRetention ago
+func (s *Service) pruneUploadsLocked(now time.Time) {
+	for id, u := range s.uploads {
+		if st := u.snapshot(); st.Status != UploadReceiving && now.Sub(st.UpdatedAt) > uploadRetention {
+			delete(s.uploads, id)
+		}
+	}
+}
+
+// completeUpload closes the tar stream and records the artifact in the
+// catalog and on the tape. Called with u.writing held.
+func (s *Service) completeUpload(u *upload) {
+	job := u.job
+	st := u.snapshot()
+
+	if err := u.tw.Close(); err != nil {
+		s.failUpload(u, "Failed to finish the tar stream: "+err.Error())
+		return
+	}
+	// Pad the stream to a whole tape block; tar ignores the trailing zeros
+	if bs := int64(s.blockSize); bs > 0 {
+		if rem := u.stream.bytesWritten() % bs; rem > 0 {
+			if _, err := u.stream.Write(make([]byte, bs-rem)); err != nil {
+				s.failUpload(u, "Failed to write to tape: "+err.Error())
+				return
+			}
+		}
+	}
+	u.pipe.Close()
+	<-u.tapeDone
+	if u.tapeErr != nil {
+		s.failUpload(u, "Failed to write to tape: "+u.tapeErr.Error())
+		return
+	}
+
+	checksum := hex.EncodeToString(u.hash.Sum(nil))
+	if u.req.SHA256 != "" && u.req.SHA256 != checksum {
+		s.failUpload(u, fmt.Sprintf("SHA-256 mismatch: expected %s, received %s", u.req.SHA256, checksum))
+		return
+	}
+
+	s.updateProgress(job.ID, "cataloging", "Cataloging "+st.Path+"...")
+	entry := ArchiveEntry{Path: st.Path, Size: st.Size, Mode: int(u.req.Mode), ModTime: u.req.ModTime, Checksum: checksum}
+	if err := s.insertArchiveCatalog(st.BackupSetID, []ArchiveEntry{entry}); err != nil {
+		s.failUpload(u, "Failed to catalog upload: "+err.Error())
+		return
+	}
+
+	ctx := context.WithoutCancel(u.ctx)
+	if err := u.driveSvc.WriteFileMark(ctx); err != nil {
+		s.logger.Warn("Failed to write file mark", map[string]interface{}{"error": err.Error()})
+	}
+	toc := tape.NewTapeTOC(st.TapeLabel, u.tapeUUID, u.poolName)
+	toc.BackupSets = append(toc.BackupSets, tape.TOCBackupSet{
+		FileNumber: 1,
+		JobName:    job.Name,
+		BackupType: string(models.BackupTypeFull),
+		StartTime:  st.StartedAt,
+		EndTime:    time.Now(),
+		FileCount:  1,
+		TotalBytes: st.Size,
+		Files: []tape.TOCFileEntry{{
+			Path:     entry.Path,
+			Size:     entry.Size,
+			Mode:     entry.Mode,
+			ModTime:  entry.ModTime.Format(time.RFC3339),
+			Checksum: checksum,
+		}},
+	})
+	if err := u.driveSvc.WriteTOC(ctx, toc); err != nil {
+		s.logger.Warn("Failed to write TOC to tape", map[string]interface{}{"error": err.Error()})
+	}
+
+	tapeBytes := u.tapeBytes
+	if tapeBytes == 0 {
+		tapeBytes = u.stream.bytesWritten()
+	}
+	endTime := time.Now()
+	s.db.Exec(`
+		UPDATE backup_sets SET end_time = ?, status = ?, file_count = 1, total_bytes = ?, tape_bytes = ?
+		WHERE id = ?
+	`, endTime, models.BackupSetStatusCompleted, st.Size, tapeBytes, st.BackupSetID)
+	s.db.Exec(`
+		UPDATE tapes SET
+			used_bytes = used_bytes + ?, write_count = write_count + 1, physical_remaining_bytes = NULL,
+			last_written_at = ?,
+			status = CASE WHEN status = 'blank' THEN 'active' ELSE status END
+		WHERE id = ?
+	`, tapeBytes, endTime, st.TapeID)
+	s.db.Exec("UPDATE backup_jobs SET last_run_at = ? WHERE id = ?", endTime, job.ID)
+
+	var artifactID int64
+	s.db.QueryRow("SELECT id FROM catalog_entries WHERE backup_set_id = ? AND file_path = ?", st.BackupSetID, st.Path).Scan(&artifactID)
+	u.update(func(st *UploadStatus) {
+		st.Status = UploadCompleted
+		st.SHA256 = checksum
+		st.ArtifactID = artifactID
+	})
+	s.mu.Lock()
+	if p, ok := s.activeJobs[job.ID]; ok {
+		p.FileCount = 1
+	}
+	s.mu.Unlock()
+	s.updateProgress(job.ID, "completed", fmt.Sprintf("Upload completed: %s, %d bytes in %s", st.Path, st.Size, endTime.Sub(st.StartedAt).String()))
+	s.emitEvent("success", "backup", "upload_completed", st.Path, st.TapeLabel, st.Size)
+	s.logger.Info("Upload completed", map[string]interface{}{
+		"upload_id":     st.ID,
+		"job_id":        job.ID,
+		"backup_set_id": st.BackupSetID,
+		"path":          st.Path,
+		"size":          st.Size,
+		"tape_bytes":    tapeBytes,
+	})
+	s.finishUpload(u)
+}
+
+// failUpload stops the tape stream and marks the upload and its backup set
+// failed. It does nothing for uploads that have already finished. Called
+// with u.writing held.
+func (s *Service) failUpload(u *upload, msg string) {
+	st := u.snapshot()
+	if st.Status != UploadReceiving {
+		return
+	}
+	u.update(func(st *UploadStatus) {
+		st.Status = UploadFailed
+		st.Error = msg
+	})
+	u.pipe.CloseWithError(errors.New(msg))
+	u.cancel()
+	<-u.tapeDone
+
+	s.updateProgress(u.job.ID, "failed", msg)
+	s.updateBackupSetStatus(st.BackupSetID, models.BackupSetStatusFailed, msg)
+	s.emitEvent("error", "backup", "upload_failed", st.Path, msg)
+	s.finishUpload(u)
+}
+
+// finishUpload releases the job slot, drive and tape held by an upload
+func (s *Service) finishUpload(u *upload) {
+	u.finishOnce.Do(func() {
+		s.mu.Lock()
+		delete(s.activeJobs, u.job.ID)
+		delete(s.cancelFuncs, u.job.ID)
+		delete(s.pauseFlags, u.job.ID)
+		s.mu.Unlock()
+		if u.idle != nil {
+			u.idle.Stop()
+		}
+		if u.driveBusy {
+			s.db.Exec("UPDATE tape_drives SET status = 'ready' WHERE device_path = ?", u.devicePath)
+		}
+		if u.release != nil {
+			u.release()
+		}
+		u.cancel()
+		close(u.finished)
+	})
+}
+
+// newUploadID returns a random upload identifier
+func newUploadID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
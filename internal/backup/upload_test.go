@@ -0,0 +1,179 @@
+package backup
+
+import (
+	"archive/tar"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"path/filepath"
+	"strings"
+	"testing"
+	"testing/iotest"
+
+	"github.com/RoseOO/TapeBackarr/internal/database"
+	"github.com/RoseOO/TapeBackarr/internal/logging"
+	"github.com/RoseOO/TapeBackarr/internal/models"
+	"github.com/RoseOO/TapeBackarr/internal/tape"
+)
+
+func TestUpload(t *testing.T) {
+	ctx := context.Background()
+	db, err := database.New(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("failed to create database: %v", err)
+	}
+	defer db.Close()
+	if err := db.Migrate(); err != nil {
+		t.Fatalf("failed to migrate database: %v", err)
+	}
+
+	devicePath := "file://" + t.TempDir()
+	drive := tape.NewServiceForDevice(devicePath, 65536)
+	if err := drive.WriteTapeLabel(ctx, "UP0001", "uuid-up", "uploads"); err != nil {
+		t.Fatalf("WriteTapeLabel: %v", err)
+	}
+	db.Exec("INSERT INTO tape_pools (name) VALUES ('uploads')")
+	db.Exec("INSERT INTO tapes (uuid, barcode, label, pool_id, status, capacity_bytes, used_bytes) VALUES ('uuid-up', 'UP0001', 'UP0001', 1, 'active', 1000000, 0)")
+	db.Exec("INSERT INTO tape_drives (device_path, display_name, status, current_tape_id) VALUES (?, 'vtape', 'ready', 1)", devicePath)
+	db.Exec("INSERT INTO backup_sources (name, source_type, path) VALUES ('renders', 'local', '/srv/renders')")
+	db.Exec("INSERT INTO backup_jobs (name, source_id, pool_id, backup_type, schedule_cron, retention_days) VALUES ('renders', 1, 1, 'full', '', 30)")
+
+	logger, _ := logging.NewLogger("error", "text", "")
+	svc := NewService(db, drive, logger, 65536, 0, 0)
+	job := &models.BackupJob{ID: 1, Name: "renders"}
+
+	payload := strings.Repeat("frame data ", 10000)
+	sum := sha256.Sum256([]byte(payload))
+
+	if _, err := svc.StartUpload(ctx, job, 1, UploadRequest{Path: "../", Size: 1}); err == nil {
+		t.Fatal("expected an empty path to be rejected")
+	}
+	if _, err := svc.StartUpload(ctx, job, 1, UploadRequest{Path: "big.bin", Size: 2000000}); err == nil {
+		t.Fatal("expected an upload larger than the free space to be rejected")
+	}
+
+	st, err := svc.StartUpload(ctx, job, 1, UploadRequest{Path: "/project/final.mov", Size: int64(len(payload)), SHA256: hex.EncodeToString(sum[:])})
+	if err != nil {
+		t.Fatalf("StartUpload: %v", err)
+	}
+	if st.Path != "project/final.mov" || st.Status != UploadReceiving || st.BackupSetID == 0 {
+		t.Fatalf("unexpected status %+v", st)
+	}
+	if !svc.IsJobActive(job.ID) {
+		t.Error("expected the upload to show up as an active job")
+	}
+	if _, err := svc.StartUpload(ctx, job, 1, UploadRequest{Path: "other", Size: 1}); err == nil {
+		t.Fatal("expected a second upload for the same job to be rejected")
+	}
+
+	// A connection dropped mid-chunk keeps what arrived and can be resumed
+	first := payload[:40000]
+	st, err = svc.WriteUpload(st.ID, 0, iotest.TimeoutReader(strings.NewReader(first)))
+	if err == nil || st.Offset == 0 || st.Offset >= int64(len(first)) {
+		t.Fatalf("expected an interrupted chunk, got offset %d err %v", st.Offset, err)
+	}
+	offset := st.Offset
+
+	var offErr *UploadOffsetError
+	if _, err := svc.WriteUpload(st.ID, 0, strings.NewReader(payload)); !errors.As(err, &offErr) || offErr.Expected != offset {
+		t.Fatalf("expected an offset error at %d, got %v", offset, err)
+	}
+
+	st, err = svc.WriteUpload(st.ID, offset, strings.NewReader(payload[offset:60000]))
+	if err != nil || st.Offset != 60000 || st.Status != UploadReceiving {
+		t.Fatalf("second chunk: %+v %v", st, err)
+	}
+	st, err = svc.WriteUpload(st.ID, 60000, strings.NewReader(payload[60000:]))
+	if err != nil {
+		t.Fatalf("last chunk: %v", err)
+	}
+	if st.Status != UploadCompleted || st.SHA256 != hex.EncodeToString(sum[:]) || st.ArtifactID == 0 {
+		t.Fatalf("unexpected final status %+v", st)
+	}
+	if _, err := svc.WriteUpload(st.ID, st.Offset, strings.NewReader("x")); !errors.Is(err, ErrUploadClosed) {
+		t.Fatalf("expected ErrUploadClosed, got %v", err)
+	}
+	if svc.IsJobActive(job.ID) {
+		t.Error("expected the job slot to be released")
+	}
+
+	var status string
+	var fileCount, totalBytes int64
+	db.QueryRow("SELECT status, file_count, total_bytes FROM backup_sets WHERE id = ?", st.BackupSetID).Scan(&status, &fileCount, &totalBytes)
+	if status != "completed" || fileCount != 1 || totalBytes != int64(len(payload)) {
+		t.Fatalf("unexpected backup set: status=%s files=%d bytes=%d", status, fileCount, totalBytes)
+	}
+	var path, checksum string
+	db.QueryRow("SELECT file_path, checksum FROM catalog_entries WHERE backup_set_id = ?", st.BackupSetID).Scan(&path, &checksum)
+	if path != "project/final.mov" || checksum != st.SHA256 {
+		t.Fatalf("unexpected catalog entry %s %s", path, checksum)
+	}
+	var used int64
+	db.QueryRow("SELECT used_bytes FROM tapes WHERE id = 1").Scan(&used)
+	if used == 0 || used%65536 != 0 {
+		t.Errorf("expected tape usage in whole blocks, got %d", used)
+	}
+
+	// The tape holds a plain tar stream restore can read back
+	if err := drive.SeekToFileNumber(ctx, 1); err != nil {
+		t.Fatalf("SeekToFileNumber: %v", err)
+	}
+	r, err := drive.OpenReader(ctx)
+	if err != nil {
+		t.Fatalf("OpenReader: %v", err)
+	}
+	tr := tar.NewReader(r)
+	hdr, err := tr.Next()
+	if err != nil || hdr.Name != "project/final.mov" || hdr.Size != int64(len(payload)) {
+		t.Fatalf("unexpected tar header %+v %v", hdr, err)
+	}
+	data, _ := io.ReadAll(tr)
+	r.Close()
+	if string(data) != payload {
+		t.Fatal("data read back from tape does not match the upload")
+	}
+	if err := drive.SeekToFileNumber(ctx, 2); err != nil {
+		t.Fatalf("SeekToFileNumber: %v", err)
+	}
+	toc, err := drive.ReadTOC(ctx)
+	if err != nil || len(toc.BackupSets) != 1 || toc.BackupSets[0].Files[0].Checksum != st.SHA256 {
+		t.Fatalf("unexpected TOC %+v %v", toc, err)
+	}
+
+	// A checksum mismatch fails the backup set
+	st, err = svc.StartUpload(ctx, job, 1, UploadRequest{Path: "bad.bin", Size: 4, SHA256: hex.EncodeToString(sum[:])})
+	if err != nil {
+		t.Fatalf("StartUpload: %v", err)
+	}
+	st, err = svc.WriteUpload(st.ID, 0, strings.NewReader("oops"))
+	if err == nil || st.Status != UploadFailed {
+		t.Fatalf("expected a checksum failure, got %+v %v", st, err)
+	}
+	db.QueryRow("SELECT status FROM backup_sets WHERE id = ?", st.BackupSetID).Scan(&status)
+	if status != "failed" {
+		t.Errorf("expected the backup set to be failed, got %s", status)
+	}
+
+	// Aborting releases the job and fails the set
+	st, err = svc.StartUpload(ctx, job, 1, UploadRequest{Path: "aborted.bin", Size: 100})
+	if err != nil {
+		t.Fatalf("StartUpload: %v", err)
+	}
+	st, err = svc.AbortUpload(st.ID)
+	if err != nil || st.Status != UploadFailed || st.Error != "Upload aborted" {
+		t.Fatalf("unexpected abort result %+v %v", st, err)
+	}
+	if svc.IsJobActive(job.ID) {
+		t.Error("expected the aborted upload to release the job slot")
+	}
+	if list := svc.ListUploads(); len(list) != 3 || list[0].ID != st.ID {
+		t.Fatalf("expected 3 uploads newest first, got %+v", list)
+	}
+	var driveStatus string
+	db.QueryRow("SELECT status FROM tape_drives WHERE id = 1").Scan(&driveStatus)
+	if driveStatus != "ready" {
+		t.Errorf("expected the drive to be released, got %s", driveStatus)
+	}
+}
@@ -0,0 +1,126 @@
+package backup
+
+import (
+	"sort"
+	"time"
+)
+
+// WindowJob summarizes one job's runs within a backup window
+type WindowJob struct {
+	JobID     int64  `json:"job_id"`
+	JobName   string `json:"job_name"`
+	Runs      int    `json:"runs"`
+	Succeeded int    `json:"succeeded"`
+	Failed    int    `json:"failed"`
+	Running   int    `json:"running"`
+	Files     int64  `json:"files"`
+	Bytes     int64  `json:"bytes"`
+	Error     string `json:"error,omitempty"`
+}
+
+// WindowReport summarizes every backup run that started within a window,
+// typically one night of scheduled jobs.
+type WindowReport struct {
+	From      time.Time   `json:"from"`
+	To        time.Time   `json:"to"`
+	Jobs      []WindowJob `json:"jobs"`
+	Succeeded int         `json:"succeeded"`
+	Failed    int         `json:"failed"`
+	Running   int         `json:"running"`
+	Files     int64       `json:"files"`
+	Bytes     int64       `json:"bytes"`
+	Tapes     []string    `json:"tapes"`
+}
+
+// BackupWindowReport builds the report for backup sets started after from
+// and up to to. Ad-hoc runs are left out. The later tapes of a spanned run
+// add to its bytes and tapes but do not count as runs of their own.
+func (s *Service) BackupWindowReport(from, to time.Time) (*WindowReport, error) {
+	rows, err := s.db.Query(`
+		SELECT j.id, j.name, bs.status, COALESCE(bs.file_count, 0), COALESCE(bs.total_bytes, 0), t.label,
+		       EXISTS (SELECT 1 FROM tape_spanning_members m WHERE m.backup_set_id = bs.id AND m.sequence_number > 1)
+		FROM backup_sets bs
+		JOIN backup_jobs j ON bs.job_id = j.id
+		JOIN tapes t ON bs.tape_id = t.id
+		WHERE bs.start_time > ? AND bs.start_time <= ? AND j.ad_hoc = 0
+		ORDER BY bs.start_time
+	`, from, to)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	report := &WindowReport{From: from, To: to, Jobs: []WindowJob{}, Tapes: []string{}}
+	jobs := make(map[int64]*WindowJob)
+	var order []int64
+	tapes := make(map[string]bool)
+	for rows.Next() {
+		var jobID, files, bytes int64
+		var name, status, tapeLabel string
+		var continuation bool
+		if err := rows.Scan(&jobID, &name, &status, &files, &bytes, &tapeLabel, &continuation); err != nil {
+			return nil, err
+		}
+		job, ok := jobs[jobID]
+		if !ok {
+			job = &WindowJob{JobID: jobID, JobName: name}
+			jobs[jobID] = job
+			order = append(order, jobID)
+		}
+		job.Bytes += bytes
+		report.Bytes += bytes
+		if !tapes[tapeLabel] {
+			tapes[tapeLabel] = true
+			report.Tapes = append(report.Tapes, tapeLabel)
+		}
+		if continuation {
+			continue
+		}
+		job.Runs++
+		job.Files += files
+		report.Files += files
+		switch status {
+		case "completed":
+			job.Succeeded++
+			report.Succeeded++
+		case "running", "pending":
+			job.Running++
+			report.Running++
+		default:
+			job.Failed++
+			report.Failed++
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	for _, id := range order {
+		report.Jobs = append(report.Jobs, *jobs[id])
+	}
+	sort.Strings(report.Tapes)
+	return report, nil
+}
+
+// AddFailure records the error of a failed scheduled run. When the job
+// already has a failed backup set without an error the error is attached to
+// it; otherwise the run failed before writing a set (no usable tape, source
+// unreachable) and is counted as an extra failed run.
+func (r *WindowReport) AddFailure(jobID int64, jobName, errMsg string) {
+	for i := range r.Jobs {
+		if r.Jobs[i].JobID == jobID && r.Jobs[i].Failed > 0 && r.Jobs[i].Error == "" {
+			r.Jobs[i].Error = errMsg
+			return
+		}
+	}
+	r.Failed++
+	for i := range r.Jobs {
+		if r.Jobs[i].JobID == jobID {
+			r.Jobs[i].Runs++
+			r.Jobs[i].Failed++
+			r.Jobs[i].Error = errMsg
+			return
+		}
+	}
+	r.Jobs = append(r.Jobs, WindowJob{JobID: jobID, JobName: jobName, Runs: 1, Failed: 1, Error: errMsg})
+}
@@ -8,6 +8,9 @@ import (
 
 // Config holds all application configuration
 type Config struct {
+	// Version is the config schema version, see CurrentVersion. Older files
+	// are upgraded when they are loaded.
+	Version       int                 `json:"version"`
 	Server        ServerConfig        `json:"server"`
 	Database      DatabaseConfig      `json:"database"`
 	Tape          TapeConfig          `json:"tape"`
@@ -15,6 +18,23 @@ type Config struct {
 	Auth          AuthConfig          `json:"auth"`
 	Notifications NotificationsConfig `json:"notifications"`
 	Proxmox       ProxmoxConfig       `json:"proxmox,omitempty"`
+	Scratch       ScratchConfig       `json:"scratch"`
+	SLO           SLOConfig           `json:"slo"`
+	Restore       RestoreConfig       `json:"restore"`
+	// Monitoring serves metrics and health on a listener of their own
+	Monitoring MonitoringConfig `json:"monitoring"`
+	// InventoryExport writes the system inventory to a directory on a
+	// schedule, e.g. for a standby server to import
+	InventoryExport InventoryExportConfig `json:"inventory_export"`
+	Replication     ReplicationConfig     `json:"replication"`
+	Scheduler       SchedulerConfig       `json:"scheduler"`
+	// AuditExport appends the audit log to a compliance tape on a schedule
+	AuditExport AuditExportConfig `json:"audit_export"`
+	// Updates checks for new releases
+	Updates UpdatesConfig `json:"updates"`
+	// Warnings lists problems found while loading the file: upgrades,
+	// unknown and deprecated keys
+	Warnings []string `json:"-"`
 }
 
 // ServerConfig holds HTTP server configuration
@@ -27,6 +47,19 @@ type ServerConfig struct {
 // DatabaseConfig holds database configuration
 type DatabaseConfig struct {
 	Path string `json:"path"`
+	// IntegrityCheckSchedule is the cron expression (with seconds) of the
+	// full integrity check; empty disables it. A quick check always runs at
+	// startup.
+	IntegrityCheckSchedule string `json:"integrity_check_schedule"`
+	// SnapshotSchedule is the cron expression (with seconds) of rolling
+	// local snapshots; empty disables them. Snapshots are also taken after
+	// each passing integrity check and before a snapshot restore.
+	SnapshotSchedule string `json:"snapshot_schedule"`
+	// SnapshotDir holds the local snapshots; empty uses a snapshots
+	// directory next to the database
+	SnapshotDir string `json:"snapshot_dir"`
+	// SnapshotKeep is the number of newest snapshots kept
+	SnapshotKeep int `json:"snapshot_keep"`
 }
 
 // DriveConfig holds configuration for a single tape drive
@@ -38,13 +71,15 @@ type DriveConfig struct {
 
 // TapeConfig holds tape-related configuration
 type TapeConfig struct {
-	DefaultDevice    string        `json:"default_device"`
-	Drives           []DriveConfig `json:"drives,omitempty"`
-	BufferSizeMB     int           `json:"buffer_size_mb"`
-	BlockSize        int           `json:"block_size"`
-	PipelineDepthMB  int           `json:"pipeline_depth_mb"`
-	WriteRetries     int           `json:"write_retries"`
-	VerifyAfterWrite bool          `json:"verify_after_write"`
+	DefaultDevice   string        `json:"default_device"`
+	Drives          []DriveConfig `json:"drives,omitempty"` // deprecated and ignored, drives are stored in the database
+	BufferSizeMB    int           `json:"buffer_size_mb"`
+	BlockSize       int           `json:"block_size"`
+	PipelineDepthMB int           `json:"pipeline_depth_mb"`
+	// WriteRetries retries a block that fails to write this many times.
+	// Retrying writes bypasses mbuffer, so it is off by default.
+	WriteRetries     int  `json:"write_retries"`
+	VerifyAfterWrite bool `json:"verify_after_write"`
 	// LTFS enables the Linear Tape File System format for tape operations.
 	// When enabled, tapes are formatted with LTFS and files are written as a
 	// standard POSIX filesystem instead of tar archives. This makes each tape
@@ -52,6 +87,158 @@ type TapeConfig struct {
 	// Requires LTO-5 or later drives and LTFS software (mkltfs, ltfs).
 	EnableLTFS     bool   `json:"enable_ltfs"`
 	LTFSMountPoint string `json:"ltfs_mount_point,omitempty"`
+	// MediaCheck compares a raw tape's contents with the catalog before
+	// each backup writes to it: the data and TOC of the last backup set,
+	// or nothing past the label for a tape never written
+	MediaCheck bool `json:"media_check"`
+	// DriveSelection decides which idle library drive a tape is loaded
+	// into when the drive is not given
+	DriveSelection DriveSelectionConfig `json:"drive_selection"`
+	// LibraryAuditSchedule is the cron expression (with seconds) of the
+	// audit comparing each library's slots with the slot records; empty
+	// disables it
+	LibraryAuditSchedule string `json:"library_audit_schedule"`
+}
+
+// Drive selection policies
+const (
+	// DriveSelectionFirst picks the lowest numbered idle drive
+	DriveSelectionFirst = "first"
+	// DriveSelectionLeastUsed picks the idle drive that wrote the fewest
+	// hours recently, spreading wear across drives
+	DriveSelectionLeastUsed = "least_used"
+)
+
+// DriveSelectionConfig holds the policy for choosing between idle drives
+type DriveSelectionConfig struct {
+	Policy string `json:"policy"` // "least_used" (default) or "first"
+	// WindowDays is how far back writing hours are counted
+	WindowDays int `json:"window_days"`
+	// MaxTemperatureC passes over drives whose last reported temperature is
+	// at or above it while a cooler drive is idle. Zero ignores temperature.
+	MaxTemperatureC int `json:"max_temperature_c"`
+}
+
+// InventoryExportConfig holds configuration for scheduled inventory exports
+type InventoryExportConfig struct {
+	// Schedule is the cron expression (with seconds) of the export; empty
+	// disables it
+	Schedule string `json:"schedule"`
+	// Dir receives the archives, typically a mounted network share
+	Dir string `json:"dir"`
+	// Keep is the number of newest archives kept in Dir; zero keeps all
+	Keep int `json:"keep"`
+	// SetsDays is how many days of backup sets each archive carries
+	SetsDays int `json:"sets_days"`
+}
+
+// AuditExportConfig holds configuration for appending the audit log to a
+// dedicated compliance tape
+type AuditExportConfig struct {
+	// Schedule is the cron expression (with seconds) of the export; empty
+	// disables it
+	Schedule string `json:"schedule"`
+	// TapeLabel names the compliance tape. It must not belong to a pool so
+	// backups never write to it.
+	TapeLabel string `json:"tape_label"`
+}
+
+// UpdatesConfig holds configuration for the check for new releases
+type UpdatesConfig struct {
+	// CheckSchedule is the cron expression (with seconds) of the check,
+	// e.g. "0 15 4 * * *". Empty by default, so nothing reaches out to
+	// GitHub unless asked to; a check can still be run from the API.
+	CheckSchedule string `json:"check_schedule"`
+	// Repository is the GitHub repository whose releases are checked
+	Repository string `json:"repository"`
+	// APIURL is the GitHub API, or a mirror serving the same endpoints
+	APIURL string `json:"api_url"`
+	// IncludePrereleases reports release candidates as updates too
+	IncludePrereleases bool `json:"include_prereleases"`
+}
+
+// Shutdown actions for scheduled runs still going after the grace period
+const (
+	ShutdownCancel     = "cancel"
+	ShutdownCheckpoint = "checkpoint"
+)
+
+// SchedulerConfig holds configuration for scheduled job runs
+type SchedulerConfig struct {
+	// ShutdownGraceSeconds is how long a shutdown waits for scheduled runs
+	// to finish before stopping them
+	ShutdownGraceSeconds int `json:"shutdown_grace_seconds"`
+	// ShutdownAction is "cancel" to cancel runs still going after the grace
+	// period, or "checkpoint" to record their progress first so they can be
+	// resumed after the restart
+	ShutdownAction string `json:"shutdown_action"`
+}
+
+// Replication roles
+const (
+	ReplicationPrimary = "primary"
+	ReplicationStandby = "standby"
+)
+
+// ReplicationConfig holds configuration for keeping a standby server in
+// sync with a primary
+type ReplicationConfig struct {
+	// Role is "primary" to serve the replication API, "standby" to follow
+	// PrimaryURL, or empty for a server that does neither
+	Role string `json:"role"`
+	// PrimaryURL is the base URL of the primary, e.g. https://tape1:8080
+	PrimaryURL string `json:"primary_url"`
+	// APIKey is an admin API key on the primary
+	APIKey string `json:"api_key,omitempty"`
+	// IntervalSeconds is how often a standby checks the primary for changes
+	IntervalSeconds int `json:"interval_seconds"`
+	// MinSnapshotSeconds is the least time between two database copies a
+	// primary builds for standbys that already have one. Each copy reads
+	// and sends the whole database; 0 builds one for every change.
+	MinSnapshotSeconds int  `json:"min_snapshot_seconds"`
+	SkipTLSVerify      bool `json:"skip_tls_verify"`
+}
+
+// ScratchConfig holds configuration for the temporary working directory used
+// to stage file lists, database snapshots, Proxmox spools and restores.
+type ScratchConfig struct {
+	Dir string `json:"dir"`
+	// MinFreeMB is the free space, in megabytes, that staging operations
+	// must leave on the scratch filesystem.
+	MinFreeMB int `json:"min_free_mb"`
+}
+
+// SLOConfig holds backup service level objectives
+type SLOConfig struct {
+	// DefaultRPOHours is the recovery point objective of sources without
+	// their own: the maximum age, in hours, of the newest successful
+	// backup. Zero turns the default check off.
+	DefaultRPOHours int `json:"default_rpo_hours"`
+}
+
+// RestoreConfig holds restore settings
+type RestoreConfig struct {
+	// RateLimitMBps caps how fast restores write, in MB/s, so a restore to
+	// a production share does not saturate the network. Restore requests
+	// may set their own limit. Zero means unlimited.
+	RateLimitMBps int `json:"rate_limit_mbps"`
+}
+
+// MonitoringConfig holds configuration for a separate listener serving
+// /metrics and /health to monitoring agents, with its own authentication so
+// they need no API key and the main API can stay firewalled
+type MonitoringConfig struct {
+	// Port of the monitoring listener; zero disables it
+	Port int    `json:"port"`
+	Host string `json:"host"`
+	// BearerToken, when set, must be sent as "Authorization: Bearer <token>"
+	BearerToken string `json:"bearer_token,omitempty"`
+	// TLSCertFile and TLSKeyFile serve the listener over HTTPS
+	TLSCertFile string `json:"tls_cert_file"`
+	TLSKeyFile  string `json:"tls_key_file"`
+	// ClientCAFile, when set, requires clients to present a certificate
+	// signed by one of its CAs. It needs TLSCertFile and TLSKeyFile.
+	ClientCAFile string `json:"client_ca_file"`
 }
 
 // LoggingConfig holds logging configuration
@@ -66,12 +253,42 @@ type AuthConfig struct {
 	JWTSecret       string `json:"jwt_secret"`
 	TokenExpiration int    `json:"token_expiration"` // hours
 	SessionTimeout  int    `json:"session_timeout"`  // minutes
+	// MaxFailedLogins locks an account after this many consecutive failed
+	// logins, for LockoutMinutes or until an admin unlocks it. Zero disables
+	// lockout.
+	MaxFailedLogins int `json:"max_failed_logins"`
+	// LockoutMinutes is how long a locked account stays locked (15 when
+	// zero)
+	LockoutMinutes int `json:"lockout_minutes"`
+	// CredentialsKey encrypts the secrets in the credentials store. When
+	// empty a random key is generated and saved on startup. Changing it
+	// makes stored secrets unreadable until they are entered again.
+	CredentialsKey string `json:"credentials_key,omitempty"`
+	// ManagementCIDRs limits admin endpoints and destructive operations to
+	// clients in these networks (CIDRs or single addresses), whatever
+	// credentials they present. Empty allows any address.
+	ManagementCIDRs []string `json:"management_cidrs,omitempty"`
+	// TrustedProxies are the reverse proxies whose X-Forwarded-For and
+	// X-Real-IP headers give the client address for ManagementCIDRs. The
+	// headers of any other peer are ignored.
+	TrustedProxies []string `json:"trusted_proxies,omitempty"`
 }
 
 // NotificationsConfig holds notification configuration
 type NotificationsConfig struct {
-	Telegram TelegramConfig `json:"telegram"`
-	Email    EmailConfig    `json:"email"`
+	Telegram     TelegramConfig     `json:"telegram"`
+	Email        EmailConfig        `json:"email"`
+	BackupWindow BackupWindowConfig `json:"backup_window"`
+}
+
+// BackupWindowConfig controls the consolidated backup window report: one
+// summary of all scheduled runs sent daily at End, covering the day before.
+type BackupWindowConfig struct {
+	Enabled bool   `json:"enabled"`
+	End     string `json:"end"` // HH:MM in server time, e.g. "07:00"
+	// SuppressJobMessages skips the per-job started and completed
+	// messages while the report is enabled. Failures are still sent.
+	SuppressJobMessages bool `json:"suppress_job_messages"`
 }
 
 // TelegramConfig holds Telegram bot configuration
@@ -79,6 +296,9 @@ type TelegramConfig struct {
 	Enabled  bool   `json:"enabled"`
 	BotToken string `json:"bot_token"`
 	ChatID   string `json:"chat_id"`
+	// Language of bot messages and command replies (en, de, fr). The
+	// /language bot command changes it at runtime.
+	Language string `json:"language"`
 }
 
 // EmailConfig holds SMTP email configuration
@@ -91,8 +311,10 @@ type EmailConfig struct {
 	FromEmail  string `json:"from_email"`
 	FromName   string `json:"from_name"`
 	ToEmails   string `json:"to_emails"` // Comma-separated list
-	UseTLS     bool   `json:"use_tls"`
+	UseTLS     bool   `json:"use_tls"`   // Implicit TLS, usually port 465
+	StartTLS   bool   `json:"starttls"`  // Require STARTTLS on a plain connection
 	SkipVerify bool   `json:"skip_verify"`
+	Language   string `json:"language"` // en, de or fr
 }
 
 // ProxmoxConfig holds Proxmox VE connection configuration
@@ -111,32 +333,41 @@ type ProxmoxConfig struct {
 	// Backup settings
 	DefaultMode     string `json:"default_mode"`     // snapshot, suspend, or stop
 	DefaultCompress string `json:"default_compress"` // zstd, lzo, gzip, or empty
-	TempDir         string `json:"temp_dir"`         // Temp directory for backup operations
+	TempDir         string `json:"temp_dir"`         // Temp directory for backup operations (defaults to a scratch subdirectory)
+	// ExcludeTag leaves guests with this PVE tag out of backup-all runs and
+	// jobs; empty backs up every guest
+	ExcludeTag string `json:"exclude_tag"`
 }
 
 // DefaultConfig returns a configuration with sensible defaults
 func DefaultConfig() *Config {
 	return &Config{
+		Version: CurrentVersion,
 		Server: ServerConfig{
 			Host:      "0.0.0.0",
 			Port:      8080,
 			StaticDir: "/opt/tapebackarr/static",
 		},
 		Database: DatabaseConfig{
-			Path: "/var/lib/tapebackarr/tapebackarr.db",
+			Path:                   "/var/lib/tapebackarr/tapebackarr.db",
+			IntegrityCheckSchedule: "0 30 3 * * *",
+			SnapshotSchedule:       "0 0 */6 * * *",
+			SnapshotKeep:           10,
 		},
 		Tape: TapeConfig{
-			DefaultDevice: "/dev/nst0",
-			Drives: []DriveConfig{
-				{DevicePath: "/dev/nst0", DisplayName: "Primary LTO Drive", Enabled: true},
-			},
+			DefaultDevice:    "/dev/nst0",
 			BufferSizeMB:     2048,
 			BlockSize:        1048576,
 			PipelineDepthMB:  64,
-			WriteRetries:     3,
 			VerifyAfterWrite: true,
 			EnableLTFS:       false,
 			LTFSMountPoint:   "/mnt/ltfs",
+			DriveSelection: DriveSelectionConfig{
+				Policy:          DriveSelectionLeastUsed,
+				WindowDays:      30,
+				MaxTemperatureC: 50,
+			},
+			LibraryAuditSchedule: "0 0 18 * * *",
 		},
 		Logging: LoggingConfig{
 			Level:      "info",
@@ -147,12 +378,15 @@ func DefaultConfig() *Config {
 			JWTSecret:       "", // Must be set in config file
 			TokenExpiration: 24,
 			SessionTimeout:  60,
+			MaxFailedLogins: 5,
+			LockoutMinutes:  15,
 		},
 		Notifications: NotificationsConfig{
 			Telegram: TelegramConfig{
 				Enabled:  false,
 				BotToken: "",
 				ChatID:   "",
+				Language: "en",
 			},
 			Email: EmailConfig{
 				Enabled:    false,
@@ -163,8 +397,14 @@ func DefaultConfig() *Config {
 				FromEmail:  "",
 				FromName:   "TapeBackarr",
 				ToEmails:   "",
-				UseTLS:     true,
+				UseTLS:     false,
+				StartTLS:   true,
 				SkipVerify: false,
+				Language:   "en",
+			},
+			BackupWindow: BackupWindowConfig{
+				Enabled: false,
+				End:     "07:00",
 			},
 		},
 		Proxmox: ProxmoxConfig{
@@ -175,12 +415,37 @@ func DefaultConfig() *Config {
 			Realm:           "pam",
 			DefaultMode:     "snapshot",
 			DefaultCompress: "zstd",
-			TempDir:         "/var/lib/tapebackarr/proxmox-tmp",
+			ExcludeTag:      "no-backup",
+		},
+		Scratch: ScratchConfig{
+			Dir:       "/var/lib/tapebackarr/tmp",
+			MinFreeMB: 1024,
+		},
+		SLO: SLOConfig{
+			DefaultRPOHours: 48,
+		},
+		InventoryExport: InventoryExportConfig{
+			Keep:     14,
+			SetsDays: 30,
+		},
+		Replication: ReplicationConfig{
+			IntervalSeconds:    60,
+			MinSnapshotSeconds: 300,
+		},
+		Scheduler: SchedulerConfig{
+			ShutdownGraceSeconds: 30,
+			ShutdownAction:       ShutdownCheckpoint,
+		},
+		Updates: UpdatesConfig{
+			Repository: "RoseOO/TapeBackarr",
+			APIURL:     "https://api.github.com",
 		},
 	}
 }
 
-// Load loads configuration from a JSON file
+// Load loads configuration from a JSON file, upgrading files written by
+// older releases. Problems that do not prevent loading are returned in
+// Config.Warnings.
 func Load(path string) (*Config, error) {
 	cfg := DefaultConfig()
 
@@ -193,9 +458,14 @@ func Load(path string) (*Config, error) {
 		return nil, err
 	}
 
+	data, warnings, err := loadRaw(path, data)
+	if err != nil {
+		return nil, err
+	}
 	if err := json.Unmarshal(data, cfg); err != nil {
 		return nil, err
 	}
+	cfg.Warnings = warnings
 
 	return cfg, nil
 }
@@ -208,6 +478,9 @@ func (c *Config) Save(path string) error {
 		return err
 	}
 
+	if c.Version < CurrentVersion {
+		c.Version = CurrentVersion
+	}
 	data, err := json.MarshalIndent(c, "", "  ")
 	if err != nil {
 		return err
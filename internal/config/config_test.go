@@ -3,6 +3,7 @@ package config
 import (
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 )
 
@@ -112,3 +113,107 @@ func TestSaveAndLoadLTFSConfig(t *testing.T) {
 		t.Errorf("expected LTFSMountPoint /mnt/custom-ltfs, got %s", loaded.Tape.LTFSMountPoint)
 	}
 }
+
+func TestLoadUpgradesOldConfig(t *testing.T) {
+	configPath := filepath.Join(t.TempDir(), "config.json")
+	original := []byte(`{
+  "server": {"port": 9090, "hostname": "old"},
+  "tape": {"default_device": "/dev/nst1", "drives": [{"device_path": "/dev/nst1", "serial": "X"}]},
+  "legacy": true
+}`)
+	if err := os.WriteFile(configPath, original, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	oldUpgrades := upgrades
+	upgrades = append(upgrades, upgrade{to: 3, apply: func(raw map[string]interface{}) []string {
+		renameKey(raw, "tape.default_device", "tape.device")
+		return []string{"renamed tape.default_device"}
+	}})
+	defer func() { upgrades = oldUpgrades }()
+
+	cfg, err := Load(configPath)
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+	if cfg.Version != CurrentVersion || cfg.Server.Port != 9090 || cfg.Tape.DefaultDevice != "/dev/nst1" {
+		t.Errorf("unexpected config after upgrade: version %d, port %d, device %q", cfg.Version, cfg.Server.Port, cfg.Tape.DefaultDevice)
+	}
+
+	// The original is kept and the rewritten file carries the version
+	backup, err := os.ReadFile(configPath + ".v1.bak")
+	if err != nil || string(backup) != string(original) {
+		t.Fatalf("expected the original to be backed up, got %q, %v", backup, err)
+	}
+	rewritten, _ := os.ReadFile(configPath)
+	if !strings.Contains(string(rewritten), `"version": 2`) || !strings.Contains(string(rewritten), `"legacy": true`) {
+		t.Errorf("expected rewritten file with version and unknown keys kept, got %s", rewritten)
+	}
+
+	want := []string{
+		"config upgraded from version 1 to 2",
+		`unknown config key "legacy"`,
+		`unknown config key "server.hostname"`,
+		`unknown config key "tape.drives[0].serial"`,
+		`config key "tape.drives" is deprecated`,
+	}
+	joined := strings.Join(cfg.Warnings, "\n")
+	for _, w := range want {
+		if !strings.Contains(joined, w) {
+			t.Errorf("expected warning %q in %q", w, joined)
+		}
+	}
+	if strings.Contains(joined, "renamed tape.default_device") {
+		t.Error("upgrades beyond CurrentVersion must not run")
+	}
+
+	// Loading again does not upgrade or back up a second time
+	cfg, err = Load(configPath)
+	if err != nil {
+		t.Fatalf("reload: %v", err)
+	}
+	if strings.Contains(strings.Join(cfg.Warnings, "\n"), "upgraded") {
+		t.Errorf("expected no upgrade on reload, got %q", cfg.Warnings)
+	}
+	matches, _ := filepath.Glob(configPath + ".v1*.bak")
+	if len(matches) != 1 {
+		t.Errorf("expected one backup, got %v", matches)
+	}
+}
+
+func TestRenameKey(t *testing.T) {
+	raw := map[string]interface{}{"tape": map[string]interface{}{"old": 1.0}}
+	if !renameKey(raw, "tape.old", "drive.new") {
+		t.Fatal("expected the key to be moved")
+	}
+	if _, ok := raw["tape"].(map[string]interface{})["old"]; ok {
+		t.Error("expected the old key to be removed")
+	}
+	if v := raw["drive"].(map[string]interface{})["new"]; v != 1.0 {
+		t.Errorf("expected moved value 1, got %v", v)
+	}
+	if renameKey(raw, "tape.old", "drive.new") {
+		t.Error("expected nothing to move the second time")
+	}
+}
+
+func TestSaveStampsVersion(t *testing.T) {
+	configPath := filepath.Join(t.TempDir(), "config.json")
+	cfg := DefaultConfig()
+	cfg.Version = 0
+	if err := cfg.Save(configPath); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := Load(configPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if loaded.Version != CurrentVersion || len(loaded.Warnings) != 0 {
+		t.Errorf("expected a current config without warnings, got version %d, %q", loaded.Version, loaded.Warnings)
+	}
+
+	loaded.Tape.Drives = []DriveConfig{{DevicePath: "/dev/nst0"}}
+	if w := loaded.KeyWarnings(); len(w) != 1 || !strings.Contains(w[0], "tape.drives") {
+		t.Errorf("expected a tape.drives deprecation warning, got %q", w)
+	}
+}
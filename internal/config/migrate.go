@@ -0,0 +1,236 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+)
+
+// CurrentVersion is the config schema version written by this release.
+// Files without a version field are version 1.
+const CurrentVersion = 2
+
+// upgrade transforms a decoded config file from version to-1 to version to.
+// It edits raw in place and returns notes describing what it changed.
+type upgrade struct {
+	to    int
+	apply func(raw map[string]interface{}) []string
+}
+
+// upgrades run in order on files older than CurrentVersion. Renamed keys
+// must be moved here rather than dropped, so settings survive the upgrade.
+var upgrades = []upgrade{
+	// Version 2 introduced the version field itself
+	{to: 2, apply: func(raw map[string]interface{}) []string { return nil }},
+}
+
+// deprecatedKeys are still accepted but have no effect
+var deprecatedKeys = map[string]string{
+	"tape.drives": "drives are managed on the Drives page and stored in the database; this list is ignored",
+}
+
+// upgradeRaw applies the upgrades needed to bring raw from version to
+// CurrentVersion and stamps the new version
+func upgradeRaw(raw map[string]interface{}, version int) []string {
+	var notes []string
+	for _, u := range upgrades {
+		if u.to <= version || u.to > CurrentVersion {
+			continue
+		}
+		notes = append(notes, u.apply(raw)...)
+	}
+	raw["version"] = CurrentVersion
+	return notes
+}
+
+// rawVersion returns the schema version of a decoded config file
+func rawVersion(raw map[string]interface{}) int {
+	if v, ok := raw["version"].(float64); ok && v >= 1 {
+		return int(v)
+	}
+	return 1
+}
+
+// renameKey moves the value at a dotted path to another dotted path,
+// creating parent objects as needed. An existing value at the destination
+// wins and the old key is dropped. It reports whether anything was moved.
+func renameKey(raw map[string]interface{}, from, to string) bool {
+	fromParent, fromKey := lookupParent(raw, from, false)
+	if fromParent == nil {
+		return false
+	}
+	v, ok := fromParent[fromKey]
+	if !ok {
+		return false
+	}
+	delete(fromParent, fromKey)
+	toParent, toKey := lookupParent(raw, to, true)
+	if toParent == nil {
+		return false
+	}
+	if _, exists := toParent[toKey]; !exists {
+		toParent[toKey] = v
+	}
+	return true
+}
+
+// lookupParent returns the object holding the last element of a dotted path
+func lookupParent(raw map[string]interface{}, path string, create bool) (map[string]interface{}, string) {
+	parts := strings.Split(path, ".")
+	cur := raw
+	for _, p := range parts[:len(parts)-1] {
+		next, ok := cur[p].(map[string]interface{})
+		if !ok {
+			if !create || cur[p] != nil {
+				return nil, ""
+			}
+			next = make(map[string]interface{})
+			cur[p] = next
+		}
+		cur = next
+	}
+	return cur, parts[len(parts)-1]
+}
+
+// backupConfigFile copies the original config next to itself before it is
+// rewritten, e.g. config.json.v1.bak. An existing backup is never replaced.
+func backupConfigFile(path string, data []byte, version int) (string, error) {
+	backup := fmt.Sprintf("%s.v%d.bak", path, version)
+	if _, err := os.Stat(backup); err == nil {
+		backup = fmt.Sprintf("%s.v%d.%s.bak", path, version, time.Now().Format("20060102-150405"))
+	}
+	if err := os.WriteFile(backup, data, 0600); err != nil {
+		return "", err
+	}
+	return backup, nil
+}
+
+// keyWarnings lists unknown and deprecated keys in a decoded config file
+func keyWarnings(raw map[string]interface{}) []string {
+	var warnings []string
+	for _, key := range unknownKeys(raw, reflect.TypeOf(Config{}), "") {
+		warnings = append(warnings, fmt.Sprintf("unknown config key %q is ignored", key))
+	}
+	paths := make([]string, 0, len(deprecatedKeys))
+	for path := range deprecatedKeys {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	for _, path := range paths {
+		if parent, key := lookupParent(raw, path, false); parent != nil {
+			if _, ok := parent[key]; ok {
+				warnings = append(warnings, fmt.Sprintf("config key %q is deprecated: %s", path, deprecatedKeys[path]))
+			}
+		}
+	}
+	return warnings
+}
+
+// KeyWarnings lists the unknown and deprecated keys the config would be
+// saved with
+func (c *Config) KeyWarnings() []string {
+	data, err := json.Marshal(c)
+	if err != nil {
+		return nil
+	}
+	var raw map[string]interface{}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return nil
+	}
+	return keyWarnings(raw)
+}
+
+// unknownKeys returns the dotted paths of keys in raw that no field of t
+// decodes
+func unknownKeys(raw map[string]interface{}, t reflect.Type, prefix string) []string {
+	fields := make(map[string]reflect.Type)
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		name := strings.Split(f.Tag.Get("json"), ",")[0]
+		if name == "-" || !f.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+		fields[name] = f.Type
+	}
+
+	var unknown []string
+	for key, v := range raw {
+		ft, ok := fields[key]
+		if !ok {
+			// encoding/json matches field names case-insensitively
+			for name, t := range fields {
+				if strings.EqualFold(name, key) {
+					ft, ok = t, true
+					break
+				}
+			}
+		}
+		if !ok {
+			unknown = append(unknown, prefix+key)
+			continue
+		}
+		switch {
+		case ft.Kind() == reflect.Struct:
+			if m, ok := v.(map[string]interface{}); ok {
+				unknown = append(unknown, unknownKeys(m, ft, prefix+key+".")...)
+			}
+		case ft.Kind() == reflect.Slice && ft.Elem().Kind() == reflect.Struct:
+			if items, ok := v.([]interface{}); ok {
+				for i, item := range items {
+					if m, ok := item.(map[string]interface{}); ok {
+						unknown = append(unknown, unknownKeys(m, ft.Elem(), fmt.Sprintf("%s%s[%d].", prefix, key, i))...)
+					}
+				}
+			}
+		}
+	}
+	sort.Strings(unknown)
+	return unknown
+}
+
+// loadRaw decodes a config file, upgrading it to CurrentVersion first. An
+// upgraded file is backed up and rewritten in place; if that fails the
+// upgrade still applies in memory. It returns the JSON to decode into Config
+// and the warnings to report.
+func loadRaw(path string, data []byte) ([]byte, []string, error) {
+	var raw map[string]interface{}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return nil, nil, err
+	}
+	if raw == nil {
+		raw = make(map[string]interface{})
+	}
+
+	var warnings []string
+	version := rawVersion(raw)
+	switch {
+	case version > CurrentVersion:
+		warnings = append(warnings, fmt.Sprintf("config version %d is newer than this release supports (%d); settings it introduced are ignored", version, CurrentVersion))
+	case version < CurrentVersion:
+		notes := upgradeRaw(raw, version)
+		upgraded, err := json.MarshalIndent(raw, "", "  ")
+		if err != nil {
+			return nil, nil, err
+		}
+		backup, err := backupConfigFile(path, data, version)
+		if err == nil {
+			err = os.WriteFile(path, upgraded, 0600)
+		}
+		if err != nil {
+			warnings = append(warnings, fmt.Sprintf("config upgraded from version %d to %d in memory only, the file could not be rewritten: %v", version, CurrentVersion, err))
+		} else {
+			warnings = append(warnings, fmt.Sprintf("config upgraded from version %d to %d, the original was saved to %s", version, CurrentVersion, backup))
+		}
+		warnings = append(warnings, notes...)
+		data = upgraded
+	}
+
+	return data, append(warnings, keyWarnings(raw)...), nil
+}
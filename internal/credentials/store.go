@@ -0,0 +1,335 @@
+// Package credentials keeps named secrets (SMB passwords, SSH private keys,
+// database passwords) encrypted in the database so restore targets and other
+// consumers can reference them by ID instead of storing their own copy. Every
+// time a secret is handed out the use is recorded.
+package credentials
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/RoseOO/TapeBackarr/internal/database"
+	"github.com/RoseOO/TapeBackarr/internal/models"
+)
+
+// secretPrefix marks the format of an encrypted secret: base64 of the
+// AES-256-GCM nonce followed by the ciphertext
+const secretPrefix = "v1:"
+
+var (
+	// ErrNotFound is returned for an unknown credential ID
+	ErrNotFound = errors.New("credential not found")
+	// ErrUndecryptable is returned when a secret was encrypted with another
+	// key, usually because auth.credentials_key was changed
+	ErrUndecryptable = errors.New("credential secret cannot be decrypted with the configured credentials key")
+	// ErrInUse is returned when deleting a credential that is still referenced
+	ErrInUse = errors.New("credential is still in use")
+)
+
+// Columns is the column list shared by credential queries
+const Columns = `id, name, credential_type, username, domain, description, secret_encrypted,
+	last_used_at, created_at, updated_at`
+
+// Usage describes who is using a credential and why, for the usage audit
+type Usage struct {
+	UsedByType string // e.g. "restore_target"
+	UsedByID   int64
+	Purpose    string // e.g. "restore", "connection test"
+}
+
+// Store encrypts, decrypts and hands out credentials
+type Store struct {
+	db  *database.DB
+	gcm cipher.AEAD
+}
+
+// NewStore creates a credentials store whose secrets are encrypted with a
+// key derived from passphrase
+func NewStore(db *database.DB, passphrase string) (*Store, error) {
+	if passphrase == "" {
+		return nil, fmt.Errorf("a credentials key is required")
+	}
+	key := sha256.Sum256([]byte("tapebackarr-credentials:" + passphrase))
+	block, err := aes.NewCipher(key[:])
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	return &Store{db: db, gcm: gcm}, nil
+}
+
+// Validate checks that a credential has a name and a known type
+func Validate(c *models.Credential) error {
+	if strings.TrimSpace(c.Name) == "" {
+		return fmt.Errorf("name is required")
+	}
+	// Usernames end up in mount.cifs credentials files and option lists
+	if strings.ContainsAny(c.Username+c.Domain, ",\r\n") {
+		return fmt.Errorf("username and domain must not contain commas or newlines")
+	}
+	// ssh and rsync would read a leading dash as an option
+	if strings.HasPrefix(c.Username, "-") {
+		return fmt.Errorf("username must not start with a dash")
+	}
+	switch c.CredentialType {
+	case models.CredentialPassword, models.CredentialSSHKey, models.CredentialToken:
+	default:
+		return fmt.Errorf("credential_type must be password, ssh_key or token")
+	}
+	return nil
+}
+
+// encrypt seals a secret for storage. An empty secret is stored as is.
+func (s *Store) encrypt(secret string) (string, error) {
+	if secret == "" {
+		return "", nil
+	}
+	nonce := make([]byte, s.gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	sealed := s.gcm.Seal(nonce, nonce, []byte(secret), nil)
+	return secretPrefix + base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+// decrypt opens a stored secret
+func (s *Store) decrypt(stored string) (string, error) {
+	if stored == "" {
+		return "", nil
+	}
+	if !strings.HasPrefix(stored, secretPrefix) {
+		return "", ErrUndecryptable
+	}
+	data, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(stored, secretPrefix))
+	if err != nil || len(data) < s.gcm.NonceSize() {
+		return "", ErrUndecryptable
+	}
+	plain, err := s.gcm.Open(nil, data[:s.gcm.NonceSize()], data[s.gcm.NonceSize():], nil)
+	if err != nil {
+		return "", ErrUndecryptable
+	}
+	return string(plain), nil
+}
+
+// Scan reads a credential selected with Columns and returns it with its
+// still encrypted secret
+func Scan(row interface{ Scan(...interface{}) error }) (*models.Credential, string, error) {
+	var c models.Credential
+	var encrypted string
+	var lastUsed sql.NullTime
+	if err := row.Scan(&c.ID, &c.Name, &c.CredentialType, &c.Username, &c.Domain, &c.Description,
+		&encrypted, &lastUsed, &c.CreatedAt, &c.UpdatedAt); err != nil {
+		return nil, "", err
+	}
+	if lastUsed.Valid {
+		c.LastUsedAt = &lastUsed.Time
+	}
+	c.HasSecret = encrypted != ""
+	return &c, encrypted, nil
+}
+
+// Get returns a credential without its secret
+func (s *Store) Get(id int64) (*models.Credential, error) {
+	c, _, err := Scan(s.db.QueryRow("SELECT "+Columns+" FROM credentials WHERE id = ?", id))
+	if err == sql.ErrNoRows {
+		return nil, ErrNotFound
+	}
+	return c, err
+}
+
+// Create stores a new credential and returns its ID
+func (s *Store) Create(c *models.Credential, secret string) (int64, error) {
+	if err := Validate(c); err != nil {
+		return 0, err
+	}
+	encrypted, err := s.encrypt(secret)
+	if err != nil {
+		return 0, err
+	}
+	result, err := s.db.Exec(`
+		INSERT INTO credentials (name, credential_type, username, domain, description, secret_encrypted)
+		VALUES (?, ?, ?, ?, ?, ?)
+	`, strings.TrimSpace(c.Name), c.CredentialType, c.Username, c.Domain, c.Description, encrypted)
+	if err != nil {
+		return 0, err
+	}
+	return result.LastInsertId()
+}
+
+// Update saves a credential's fields. The secret is only replaced when
+// secret is not nil.
+func (s *Store) Update(c *models.Credential, secret *string) error {
+	if err := Validate(c); err != nil {
+		return err
+	}
+	query := `UPDATE credentials SET name = ?, credential_type = ?, username = ?, domain = ?, description = ?`
+	args := []interface{}{strings.TrimSpace(c.Name), c.CredentialType, c.Username, c.Domain, c.Description}
+	if secret != nil {
+		encrypted, err := s.encrypt(*secret)
+		if err != nil {
+			return err
+		}
+		query += ", secret_encrypted = ?"
+		args = append(args, encrypted)
+	}
+	query += ", updated_at = CURRENT_TIMESTAMP WHERE id = ?"
+	args = append(args, c.ID)
+	result, err := s.db.Exec(query, args...)
+	if err != nil {
+		return err
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// Delete removes a credential that no restore target, Proxmox cluster or
+// backup source references any more
+func (s *Store) Delete(id int64) error {
+	var refs int
+	if err := s.db.QueryRow("SELECT COUNT(*) FROM restore_targets WHERE credential_id = ?", id).Scan(&refs); err != nil {
+		return err
+	}
+	if refs > 0 {
+		return fmt.Errorf("%w by %d restore target(s)", ErrInUse, refs)
+	}
+	if err := s.db.QueryRow("SELECT COUNT(*) FROM proxmox_clusters WHERE credential_id = ?", id).Scan(&refs); err != nil {
+		return err
+	}
+	if refs > 0 {
+		return fmt.Errorf("%w by %d Proxmox cluster(s)", ErrInUse, refs)
+	}
+	if err := s.db.QueryRow("SELECT COUNT(*) FROM backup_sources WHERE credential_id = ?", id).Scan(&refs); err != nil {
+		return err
+	}
+	if refs > 0 {
+		return fmt.Errorf("%w by %d backup source(s)", ErrInUse, refs)
+	}
+	result, err := s.db.Exec("DELETE FROM credentials WHERE id = ?", id)
+	if err != nil {
+		return err
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// Reencrypt re-encrypts the secrets that from can decrypt with the key of
+// s, for moving a store to a new key. Secrets neither key can read are
+// left as they are. It returns the number of secrets moved.
+func (s *Store) Reencrypt(from *Store) (int, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.Query("SELECT id, secret_encrypted FROM credentials WHERE secret_encrypted != ''")
+	if err != nil {
+		return 0, err
+	}
+	moved := make(map[int64]string)
+	for rows.Next() {
+		var id int64
+		var encrypted string
+		if err := rows.Scan(&id, &encrypted); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		secret, err := from.decrypt(encrypted)
+		if err != nil {
+			continue
+		}
+		if moved[id], err = s.encrypt(secret); err != nil {
+			rows.Close()
+			return 0, err
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	for id, encrypted := range moved {
+		if _, err := tx.Exec("UPDATE credentials SET secret_encrypted = ? WHERE id = ?", encrypted, id); err != nil {
+			return 0, err
+		}
+	}
+	return len(moved), tx.Commit()
+}
+
+// Resolve returns a credential together with its decrypted secret and
+// records the use. Failed attempts are recorded too.
+func (s *Store) Resolve(id int64, usage Usage) (*models.Credential, string, error) {
+	c, encrypted, err := Scan(s.db.QueryRow("SELECT "+Columns+" FROM credentials WHERE id = ?", id))
+	if err == sql.ErrNoRows {
+		return nil, "", ErrNotFound
+	}
+	if err != nil {
+		return nil, "", err
+	}
+	secret, err := s.decrypt(encrypted)
+	s.recordUsage(id, usage, err)
+	if err != nil {
+		return nil, "", fmt.Errorf("credential %q: %w", c.Name, err)
+	}
+	return c, secret, nil
+}
+
+// recordUsage appends to the usage audit and stamps last_used_at
+func (s *Store) recordUsage(id int64, usage Usage, useErr error) {
+	var usedByID interface{}
+	if usage.UsedByID != 0 {
+		usedByID = usage.UsedByID
+	}
+	errText := ""
+	if useErr != nil {
+		errText = useErr.Error()
+	}
+	s.db.Exec(`
+		INSERT INTO credential_usage (credential_id, used_by_type, used_by_id, purpose, success, error)
+		VALUES (?, ?, ?, ?, ?, ?)
+	`, id, usage.UsedByType, usedByID, usage.Purpose, useErr == nil, errText)
+	if useErr == nil {
+		s.db.Exec("UPDATE credentials SET last_used_at = CURRENT_TIMESTAMP WHERE id = ?", id)
+	}
+}
+
+// UsageLog returns the most recent uses of a credential, newest first
+func (s *Store) UsageLog(id int64, limit int) ([]models.CredentialUsage, error) {
+	rows, err := s.db.Query(`
+		SELECT id, credential_id, used_by_type, used_by_id, purpose, success, error, created_at
+		FROM credential_usage WHERE credential_id = ?
+		ORDER BY created_at DESC, id DESC LIMIT ?
+	`, id, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	usage := []models.CredentialUsage{}
+	for rows.Next() {
+		var u models.CredentialUsage
+		var usedByID sql.NullInt64
+		if err := rows.Scan(&u.ID, &u.CredentialID, &u.UsedByType, &usedByID, &u.Purpose, &u.Success, &u.Error, &u.CreatedAt); err != nil {
+			return nil, err
+		}
+		if usedByID.Valid {
+			u.UsedByID = &usedByID.Int64
+		}
+		usage = append(usage, u)
+	}
+	return usage, rows.Err()
+}
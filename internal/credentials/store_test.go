@@ -0,0 +1,117 @@
+package credentials
+
+import (
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/RoseOO/TapeBackarr/internal/database"
+	"github.com/RoseOO/TapeBackarr/internal/models"
+)
+
+func setupTestDB(t *testing.T) *database.DB {
+	t.Helper()
+	db, err := database.New(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("failed to create database: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	if err := db.Migrate(); err != nil {
+		t.Fatalf("failed to migrate database: %v", err)
+	}
+	return db
+}
+
+func TestStoreEncryptsAndRecordsUsage(t *testing.T) {
+	db := setupTestDB(t)
+	store, err := NewStore(db, "correct horse")
+	if err != nil {
+		t.Fatalf("NewStore: %v", err)
+	}
+
+	id, err := store.Create(&models.Credential{Name: "nas", CredentialType: models.CredentialPassword, Username: "backup"}, "s3cret")
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+
+	var stored string
+	db.QueryRow("SELECT secret_encrypted FROM credentials WHERE id = ?", id).Scan(&stored)
+	if stored == "" || strings.Contains(stored, "s3cret") {
+		t.Fatalf("expected the secret to be stored encrypted, got %q", stored)
+	}
+
+	c, secret, err := store.Resolve(id, Usage{UsedByType: "restore_target", UsedByID: 7, Purpose: "restore"})
+	if err != nil || secret != "s3cret" || c.Username != "backup" {
+		t.Fatalf("Resolve: %+v %q %v", c, secret, err)
+	}
+	if c, _ := store.Get(id); c.LastUsedAt == nil || !c.HasSecret {
+		t.Errorf("expected last_used_at and has_secret to be set, got %+v", c)
+	}
+
+	// A store opened with another key cannot read the secret, and says so
+	other, _ := NewStore(db, "wrong key")
+	if _, _, err := other.Resolve(id, Usage{UsedByType: "restore_target", UsedByID: 7, Purpose: "restore"}); !errors.Is(err, ErrUndecryptable) {
+		t.Errorf("expected ErrUndecryptable, got %v", err)
+	}
+
+	usage, err := store.UsageLog(id, 10)
+	if err != nil || len(usage) != 2 {
+		t.Fatalf("expected two recorded uses, got %d (%v)", len(usage), err)
+	}
+	if usage[0].Success || usage[1].Purpose != "restore" || *usage[1].UsedByID != 7 {
+		t.Errorf("unexpected usage log %+v", usage)
+	}
+
+	// Keeping the secret when it is not given
+	if err := store.Update(&models.Credential{ID: id, Name: "nas", CredentialType: models.CredentialPassword, Username: "svc"}, nil); err != nil {
+		t.Fatalf("Update: %v", err)
+	}
+	if _, secret, _ := store.Resolve(id, Usage{UsedByType: "test"}); secret != "s3cret" {
+		t.Errorf("expected the secret to be kept, got %q", secret)
+	}
+
+	db.Exec("INSERT INTO restore_targets (name, target_type, host, share, credential_id) VALUES ('nas', 'smb', 'nas.local', 'data', ?)", id)
+	if err := store.Delete(id); !errors.Is(err, ErrInUse) {
+		t.Errorf("expected a referenced credential to stay, got %v", err)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	if err := Validate(&models.Credential{Name: "x", CredentialType: "certificate"}); err == nil {
+		t.Error("expected an unknown type to be rejected")
+	}
+	if err := Validate(&models.Credential{Name: "x", CredentialType: models.CredentialPassword, Username: "a,b"}); err == nil {
+		t.Error("expected a username with a comma to be rejected")
+	}
+	if err := Validate(&models.Credential{Name: "x", CredentialType: models.CredentialPassword, Username: "-oProxyCommand=sh"}); err == nil {
+		t.Error("expected a username starting with a dash to be rejected")
+	}
+	if err := Validate(&models.Credential{Name: " ", CredentialType: models.CredentialToken}); err == nil {
+		t.Error("expected an empty name to be rejected")
+	}
+}
+
+func TestReencrypt(t *testing.T) {
+	db := setupTestDB(t)
+	old, _ := NewStore(db, "old key")
+	moved, _ := old.Create(&models.Credential{Name: "nas", CredentialType: models.CredentialPassword, Username: "backup"}, "s3cret")
+	other, _ := NewStore(db, "lost key")
+	lost, _ := other.Create(&models.Credential{Name: "lost", CredentialType: models.CredentialToken}, "token")
+
+	store, _ := NewStore(db, "new key")
+	n, err := store.Reencrypt(old)
+	if err != nil || n != 1 {
+		t.Fatalf("Reencrypt: %d, %v", n, err)
+	}
+	if _, secret, err := store.Resolve(moved, Usage{UsedByType: "test"}); err != nil || secret != "s3cret" {
+		t.Errorf("expected the secret under the new key, got %q, %v", secret, err)
+	}
+	if _, _, err := old.Resolve(moved, Usage{UsedByType: "test"}); !errors.Is(err, ErrUndecryptable) {
+		t.Errorf("expected the old key to be retired, got %v", err)
+	}
+	// A secret neither key reads is left alone
+	if _, secret, err := other.Resolve(lost, Usage{UsedByType: "test"}); err != nil || secret != "token" {
+		t.Errorf("expected the unreadable secret to be kept, got %q, %v", secret, err)
+	}
+}
@@ -1,11 +1,15 @@
 package database
 
 import (
+	"context"
 	"database/sql"
 	"embed"
 	"fmt"
+	"io/fs"
 	"os"
 	"path/filepath"
+	"strings"
+	"sync"
 
 	_ "modernc.org/sqlite"
 )
@@ -13,10 +17,17 @@ import (
 //go:embed migrations/*.sql
 var migrationsFS embed.FS
 
+// migrationFiles holds the migrations directory; replaced in tests
+var migrationFiles fs.FS = migrationsFS
+
 // DB wraps the SQLite database connection
 type DB struct {
 	*sql.DB
 	Path string
+
+	mu        sync.Mutex
+	lastCheck *IntegrityResult
+	recovery  *Recovery
 }
 
 // New creates a new database connection
@@ -27,6 +38,15 @@ func New(dbPath string) (*DB, error) {
 		return nil, fmt.Errorf("failed to create database directory: %w", err)
 	}
 
+	db, err := open(dbPath)
+	if err != nil {
+		return nil, err
+	}
+	return &DB{DB: db, Path: dbPath}, nil
+}
+
+// open opens and pings the SQLite database at dbPath
+func open(dbPath string) (*sql.DB, error) {
 	db, err := sql.Open("sqlite", dbPath+"?_pragma=journal_mode(WAL)&_pragma=foreign_keys(1)&_pragma=busy_timeout(5000)")
 	if err != nil {
 		return nil, fmt.Errorf("failed to open database: %w", err)
@@ -38,10 +58,10 @@ func New(dbPath string) (*DB, error) {
 
 	// Test connection
 	if err := db.Ping(); err != nil {
+		db.Close()
 		return nil, fmt.Errorf("failed to ping database: %w", err)
 	}
-
-	return &DB{db, dbPath}, nil
+	return db, nil
 }
 
 // Migrate runs database migrations
@@ -58,58 +78,92 @@ func (db *DB) Migrate() error {
 	}
 
 	// Get current version
-	var currentVersion int
-	err = db.QueryRow("SELECT COALESCE(MAX(version), 0) FROM schema_migrations").Scan(&currentVersion)
+	currentVersion, err := db.SchemaVersion()
 	if err != nil {
-		return fmt.Errorf("failed to get current migration version: %w", err)
+		return err
 	}
 
 	// Read and apply migrations
-	entries, err := migrationsFS.ReadDir("migrations")
+	migrations, err := Migrations()
 	if err != nil {
-		return fmt.Errorf("failed to read migrations directory: %w", err)
+		return err
 	}
 
-	for _, entry := range entries {
-		if entry.IsDir() {
-			continue
+	for _, m := range migrations {
+		if m.Version <= currentVersion {
+			continue // Already applied
 		}
 
-		var version int
-		_, err := fmt.Sscanf(entry.Name(), "%03d_", &version)
+		content, err := fs.ReadFile(migrationFiles, "migrations/"+m.Name)
 		if err != nil {
-			continue // Skip files that don't match pattern
+			return fmt.Errorf("failed to read migration %s: %w", m.Name, err)
 		}
 
-		if version <= currentVersion {
-			continue // Already applied
+		if err := db.applyMigration(m.Name, m.Version, string(content)); err != nil {
+			return err
 		}
+	}
 
-		content, err := migrationsFS.ReadFile("migrations/" + entry.Name())
-		if err != nil {
-			return fmt.Errorf("failed to read migration %s: %w", entry.Name(), err)
-		}
+	return nil
+}
 
-		tx, err := db.Begin()
-		if err != nil {
-			return fmt.Errorf("failed to begin transaction: %w", err)
+// noForeignKeysDirective marks a migration that rebuilds a table referenced
+// by foreign keys. PRAGMA foreign_keys is a no-op inside a transaction, and
+// with it on, dropping the old table would run the ON DELETE actions of every
+// referencing row, so such migrations run with foreign keys switched off and
+// are checked before they commit.
+const noForeignKeysDirective = "-- +foreign_keys off"
+
+// applyMigration runs one migration file in a transaction and records it
+func (db *DB) applyMigration(name string, version int, content string) error {
+	// Pin one connection: the foreign key pragma is per connection
+	ctx := context.Background()
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to get connection for migration %s: %w", name, err)
+	}
+	defer conn.Close()
+
+	noForeignKeys := strings.HasPrefix(content, noForeignKeysDirective)
+	if noForeignKeys {
+		if _, err := conn.ExecContext(ctx, "PRAGMA foreign_keys=OFF"); err != nil {
+			return fmt.Errorf("failed to disable foreign keys for migration %s: %w", name, err)
 		}
+		defer conn.ExecContext(ctx, "PRAGMA foreign_keys=ON")
+	}
+
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
 
-		if _, err := tx.Exec(string(content)); err != nil {
+	if _, err := tx.Exec(content); err != nil {
+		tx.Rollback()
+		return fmt.Errorf("failed to apply migration %s: %w", name, err)
+	}
+
+	if noForeignKeys {
+		rows, err := tx.Query("PRAGMA foreign_key_check")
+		if err != nil {
 			tx.Rollback()
-			return fmt.Errorf("failed to apply migration %s: %w", entry.Name(), err)
+			return fmt.Errorf("failed to check foreign keys after migration %s: %w", name, err)
 		}
-
-		if _, err := tx.Exec("INSERT INTO schema_migrations (version) VALUES (?)", version); err != nil {
+		violation := rows.Next()
+		rows.Close()
+		if violation {
 			tx.Rollback()
-			return fmt.Errorf("failed to record migration %s: %w", entry.Name(), err)
+			return fmt.Errorf("migration %s left foreign key violations", name)
 		}
+	}
 
-		if err := tx.Commit(); err != nil {
-			return fmt.Errorf("failed to commit migration %s: %w", entry.Name(), err)
-		}
+	if _, err := tx.Exec("INSERT INTO schema_migrations (version) VALUES (?)", version); err != nil {
+		tx.Rollback()
+		return fmt.Errorf("failed to record migration %s: %w", name, err)
 	}
 
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit migration %s: %w", name, err)
+	}
 	return nil
 }
 
@@ -1,8 +1,14 @@
 package database
 
 import (
+	"errors"
+	"fmt"
+	"os"
 	"path/filepath"
+	"sync"
 	"testing"
+	"testing/fstest"
+	"time"
 )
 
 func TestNewDatabase(t *testing.T) {
@@ -182,3 +188,436 @@ func TestMigrateIdempotent(t *testing.T) {
 		t.Errorf("expected 1 admin user, got %d", adminCount)
 	}
 }
+
+func TestMigrationWithoutForeignKeys(t *testing.T) {
+	db, err := New(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("failed to create database: %v", err)
+	}
+	defer db.Close()
+
+	if _, err := db.Exec(`
+		CREATE TABLE parents (id INTEGER PRIMARY KEY, kind TEXT CHECK (kind IN ('a')));
+		CREATE TABLE children (id INTEGER PRIMARY KEY, parent_id INTEGER REFERENCES parents(id) ON DELETE CASCADE);
+		INSERT INTO parents (id, kind) VALUES (1, 'a');
+		INSERT INTO children (id, parent_id) VALUES (1, 1);
+		CREATE TABLE schema_migrations (version INTEGER PRIMARY KEY, applied_at DATETIME DEFAULT CURRENT_TIMESTAMP);
+	`); err != nil {
+		t.Fatal(err)
+	}
+
+	rebuild := noForeignKeysDirective + `
+		CREATE TABLE parents_new (id INTEGER PRIMARY KEY, kind TEXT CHECK (kind IN ('a', 'b')));
+		INSERT INTO parents_new SELECT id, kind FROM parents;
+		DROP TABLE parents;
+		ALTER TABLE parents_new RENAME TO parents;
+	`
+	if err := db.applyMigration("900_rebuild.sql", 900, rebuild); err != nil {
+		t.Fatalf("rebuild: %v", err)
+	}
+
+	// Dropping the old table must not have cascaded to the children
+	var children int
+	db.QueryRow("SELECT COUNT(*) FROM children").Scan(&children)
+	if children != 1 {
+		t.Errorf("expected the child row to survive the rebuild, got %d rows", children)
+	}
+	var fk int
+	db.QueryRow("PRAGMA foreign_keys").Scan(&fk)
+	if fk != 1 {
+		t.Error("expected foreign keys to be enabled again")
+	}
+
+	// A rebuild that leaves dangling references is rejected
+	broken := noForeignKeysDirective + `
+		DELETE FROM parents;
+	`
+	if err := db.applyMigration("901_broken.sql", 901, broken); err == nil {
+		t.Fatal("expected foreign key violations to fail the migration")
+	}
+	db.QueryRow("SELECT COUNT(*) FROM parents").Scan(&children)
+	if children != 1 {
+		t.Error("expected the failed migration to be rolled back")
+	}
+}
+
+func TestIntegrityCheckAndSnapshots(t *testing.T) {
+	tmpDir := t.TempDir()
+	db, err := New(filepath.Join(tmpDir, "test.db"))
+	if err != nil {
+		t.Fatalf("failed to create database: %v", err)
+	}
+	defer db.Close()
+	if err := db.Migrate(); err != nil {
+		t.Fatalf("failed to migrate: %v", err)
+	}
+
+	if db.LastIntegrityCheck() != nil {
+		t.Fatal("expected no check before the first run")
+	}
+	for _, full := range []bool{false, true} {
+		result := db.CheckIntegrity(full)
+		if !result.OK || len(result.Problems) != 0 {
+			t.Fatalf("expected a healthy database (full=%v), got %+v", full, result)
+		}
+	}
+	if last := db.LastIntegrityCheck(); last == nil || last.Mode != "full" {
+		t.Errorf("expected the last check to be the full one, got %+v", last)
+	}
+
+	// Snapshots are listed newest first and pruned to the newest N
+	dir := filepath.Join(tmpDir, "snapshots")
+	snap, err := db.CreateSnapshot(dir, "")
+	if err != nil {
+		t.Fatalf("CreateSnapshot: %v", err)
+	}
+	for _, name := range []string{"tapebackarr-20240101-010000.db", "tapebackarr-20240102-010000.db", "notes.txt"} {
+		os.WriteFile(filepath.Join(dir, name), []byte("x"), 0600)
+	}
+	snapshots, err := ListSnapshots(dir)
+	if err != nil {
+		t.Fatalf("ListSnapshots: %v", err)
+	}
+	if len(snapshots) != 3 || snapshots[0].Name != snap.Name || snapshots[2].Name != "tapebackarr-20240101-010000.db" {
+		t.Fatalf("unexpected snapshots: %+v", snapshots)
+	}
+	removed, err := PruneSnapshots(dir, 2)
+	if err != nil {
+		t.Fatalf("PruneSnapshots: %v", err)
+	}
+	if len(removed) != 1 || removed[0] != "tapebackarr-20240101-010000.db" {
+		t.Errorf("expected the oldest snapshot to be pruned, got %v", removed)
+	}
+
+	if snapshots, _ := ListSnapshots(filepath.Join(tmpDir, "missing")); len(snapshots) != 0 {
+		t.Errorf("expected no snapshots in a missing directory, got %v", snapshots)
+	}
+}
+
+// corruptDatabase overwrites everything after the first page so the file
+// still opens but its tables are unreadable
+func corruptDatabase(t *testing.T, path string) {
+	t.Helper()
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatalf("stat: %v", err)
+	}
+	f, err := os.OpenFile(path, os.O_WRONLY, 0)
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	defer f.Close()
+	garbage := make([]byte, info.Size()-4096)
+	for i := range garbage {
+		garbage[i] = 0xA5
+	}
+	if _, err := f.WriteAt(garbage, 4096); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+}
+
+func TestOpenCheckedFallsBackToSnapshot(t *testing.T) {
+	tmpDir := t.TempDir()
+	dbPath := filepath.Join(tmpDir, "test.db")
+	snapDir := filepath.Join(tmpDir, "snapshots")
+
+	db, recovery, err := OpenChecked(dbPath, snapDir)
+	if err != nil {
+		t.Fatalf("OpenChecked on a new database: %v", err)
+	}
+	if recovery != nil {
+		t.Fatalf("expected no recovery for a new database, got %+v", recovery)
+	}
+	if err := db.Migrate(); err != nil {
+		t.Fatalf("failed to migrate: %v", err)
+	}
+	db.Exec("INSERT INTO tape_pools (name) VALUES ('snapshotted')")
+	if _, err := db.CreateSnapshot(snapDir, ""); err != nil {
+		t.Fatalf("CreateSnapshot: %v", err)
+	}
+	db.Exec("INSERT INTO tape_pools (name) VALUES ('after-snapshot')")
+	db.Exec("PRAGMA wal_checkpoint(TRUNCATE)")
+	db.Close()
+	corruptDatabase(t, dbPath)
+
+	db, recovery, err = OpenChecked(dbPath, snapDir)
+	if err != nil {
+		t.Fatalf("OpenChecked on a corrupt database: %v", err)
+	}
+	defer db.Close()
+	if recovery == nil || recovery.Snapshot == "" || len(recovery.Problems) == 0 {
+		t.Fatalf("expected a snapshot recovery, got %+v", recovery)
+	}
+	if db.Recovery() != recovery {
+		t.Error("expected the recovery to be kept on the database")
+	}
+	if _, err := os.Stat(recovery.CorruptPath); err != nil {
+		t.Errorf("expected the corrupt database to be kept at %s: %v", recovery.CorruptPath, err)
+	}
+	if check := db.LastIntegrityCheck(); check == nil || !check.OK {
+		t.Errorf("expected the restored database to pass its check, got %+v", check)
+	}
+	var pools []string
+	rows, err := db.Query("SELECT name FROM tape_pools WHERE name IN ('snapshotted', 'after-snapshot')")
+	if err != nil {
+		t.Fatalf("query restored database: %v", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var name string
+		rows.Scan(&name)
+		pools = append(pools, name)
+	}
+	if len(pools) != 1 || pools[0] != "snapshotted" {
+		t.Errorf("expected the snapshot's data only, got %v", pools)
+	}
+}
+
+func TestOpenCheckedWithoutSnapshot(t *testing.T) {
+	tmpDir := t.TempDir()
+	dbPath := filepath.Join(tmpDir, "test.db")
+
+	db, err := New(dbPath)
+	if err != nil {
+		t.Fatalf("failed to create database: %v", err)
+	}
+	if err := db.Migrate(); err != nil {
+		t.Fatalf("failed to migrate: %v", err)
+	}
+	db.Exec("PRAGMA wal_checkpoint(TRUNCATE)")
+	db.Close()
+	corruptDatabase(t, dbPath)
+
+	// A snapshot that fails its own check is not used
+	snapDir := filepath.Join(tmpDir, "snapshots")
+	os.MkdirAll(snapDir, 0700)
+	name := "tapebackarr-" + time.Now().Format("20060102-150405") + ".db"
+	os.WriteFile(filepath.Join(snapDir, name), []byte("not a database"), 0600)
+
+	// The damaged file does not open, so startup fails and leaves it in place
+	if _, _, err := OpenChecked(dbPath, snapDir); err == nil {
+		t.Fatal("expected an error without a usable snapshot")
+	}
+	if _, err := os.Stat(dbPath); err != nil {
+		t.Errorf("expected the corrupt database to stay in place: %v", err)
+	}
+}
+
+func TestOpenCheckedKeepsUnreadableDatabase(t *testing.T) {
+	tmpDir := t.TempDir()
+	dbPath := filepath.Join(tmpDir, "test.db")
+	snapDir := filepath.Join(tmpDir, "snapshots")
+
+	db, err := New(filepath.Join(tmpDir, "other.db"))
+	if err != nil {
+		t.Fatalf("failed to create database: %v", err)
+	}
+	if _, err := db.CreateSnapshot(snapDir, ""); err != nil {
+		t.Fatalf("CreateSnapshot: %v", err)
+	}
+	db.Close()
+
+	// A database that cannot be opened for a reason other than corruption
+	// fails startup instead of being replaced by the snapshot
+	if err := os.Mkdir(dbPath, 0700); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := OpenChecked(dbPath, snapDir); err == nil {
+		t.Fatal("expected an error for an unreadable database")
+	}
+	if fi, err := os.Stat(dbPath); err != nil || !fi.IsDir() {
+		t.Errorf("expected the database path to be left alone: %v", err)
+	}
+	if matches, _ := filepath.Glob(dbPath + ".corrupt-*"); len(matches) != 0 {
+		t.Errorf("expected nothing moved aside, got %v", matches)
+	}
+}
+
+func TestRestoreSnapshot(t *testing.T) {
+	tmpDir := t.TempDir()
+	db, err := New(filepath.Join(tmpDir, "test.db"))
+	if err != nil {
+		t.Fatalf("failed to create database: %v", err)
+	}
+	defer db.Close()
+	if err := db.Migrate(); err != nil {
+		t.Fatalf("failed to migrate: %v", err)
+	}
+
+	dir := filepath.Join(tmpDir, "snapshots")
+	db.Exec("INSERT INTO tape_pools (name) VALUES ('before')")
+	snap, err := db.CreateSnapshot(dir, "manual")
+	if err != nil {
+		t.Fatalf("CreateSnapshot: %v", err)
+	}
+	if snap.Label != "manual" || filepath.Base(snap.Path) != snap.Name {
+		t.Errorf("unexpected snapshot: %+v", snap)
+	}
+	if _, err := db.CreateSnapshot(dir, "../escape"); err == nil {
+		t.Error("expected an invalid label to be rejected")
+	}
+
+	found, err := FindSnapshot(dir, snap.Name)
+	if err != nil || found.Label != "manual" {
+		t.Fatalf("FindSnapshot = %+v, %v", found, err)
+	}
+	for _, name := range []string{"../test.db", "tapebackarr-20240101-010000.db", "other.db"} {
+		if _, err := FindSnapshot(dir, name); err == nil {
+			t.Errorf("FindSnapshot(%q): expected an error", name)
+		}
+	}
+
+	db.Exec("INSERT INTO tape_pools (name) VALUES ('after')")
+	if err := db.RestoreSnapshot(snap.Path); err != nil {
+		t.Fatalf("RestoreSnapshot: %v", err)
+	}
+
+	// The same DB value now serves the restored data
+	var before, after int
+	db.QueryRow("SELECT COUNT(*) FROM tape_pools WHERE name = 'before'").Scan(&before)
+	db.QueryRow("SELECT COUNT(*) FROM tape_pools WHERE name = 'after'").Scan(&after)
+	if before != 1 || after != 0 {
+		t.Errorf("expected the snapshot's data, got before=%d after=%d", before, after)
+	}
+	if _, err := db.Exec("INSERT INTO tape_pools (name) VALUES ('writable')"); err != nil {
+		t.Errorf("expected the restored database to be writable: %v", err)
+	}
+
+	bad := filepath.Join(dir, "tapebackarr-20240101-010000.db")
+	os.WriteFile(bad, []byte("not a database"), 0600)
+	if err := db.RestoreSnapshot(bad); err == nil {
+		t.Error("expected a damaged snapshot to be rejected")
+	}
+	if err := db.Ping(); err != nil {
+		t.Errorf("expected the database to stay usable: %v", err)
+	}
+}
+
+func TestRestoreSnapshotDuringQueries(t *testing.T) {
+	tmpDir := t.TempDir()
+	db, err := New(filepath.Join(tmpDir, "test.db"))
+	if err != nil {
+		t.Fatalf("failed to create database: %v", err)
+	}
+	defer db.Close()
+	if err := db.Migrate(); err != nil {
+		t.Fatalf("failed to migrate: %v", err)
+	}
+	db.Exec("INSERT INTO tape_pools (name) VALUES ('snapshotted')")
+	snap, err := db.CreateSnapshot(filepath.Join(tmpDir, "snapshots"), "")
+	if err != nil {
+		t.Fatalf("CreateSnapshot: %v", err)
+	}
+
+	// Queries keep running, and succeeding, while the snapshot is restored
+	stop := make(chan struct{})
+	errs := make(chan error, 4)
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; ; j++ {
+				select {
+				case <-stop:
+					return
+				default:
+				}
+				var n int
+				if err := db.QueryRow("SELECT COUNT(*) FROM tape_pools").Scan(&n); err != nil {
+					errs <- err
+					return
+				}
+				if _, err := db.Exec("INSERT INTO tape_pools (name) VALUES (?)", fmt.Sprintf("writer-%d-%d", i, j)); err != nil {
+					errs <- err
+					return
+				}
+			}
+		}(i)
+	}
+	for i := 0; i < 5; i++ {
+		if err := db.RestoreSnapshot(snap.Path); err != nil {
+			t.Fatalf("RestoreSnapshot: %v", err)
+		}
+	}
+	close(stop)
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Errorf("query during restore: %v", err)
+	}
+
+	var mode string
+	db.QueryRow("PRAGMA journal_mode").Scan(&mode)
+	if mode != "wal" {
+		t.Errorf("expected the restored database to stay in WAL mode, got %q", mode)
+	}
+	var snapshotted int
+	db.QueryRow("SELECT COUNT(*) FROM tape_pools WHERE name = 'snapshotted'").Scan(&snapshotted)
+	if snapshotted != 1 {
+		t.Errorf("expected the snapshot's data, got %d", snapshotted)
+	}
+}
+
+func TestUpgrade(t *testing.T) {
+	files := fstest.MapFS{
+		"migrations/001_init.sql": {Data: []byte("CREATE TABLE pools (name TEXT);")},
+	}
+	orig := migrationFiles
+	migrationFiles = files
+	defer func() { migrationFiles = orig }()
+
+	tmpDir := t.TempDir()
+	snapshotDir := filepath.Join(tmpDir, "snapshots")
+	db, err := New(filepath.Join(tmpDir, "test.db"))
+	if err != nil {
+		t.Fatalf("failed to create database: %v", err)
+	}
+	defer db.Close()
+
+	// A new database is not snapshotted
+	result, err := db.Upgrade(snapshotDir)
+	if err != nil || result.Snapshot != nil || result.ToVersion != 1 || len(result.Applied) != 1 {
+		t.Fatalf("Upgrade of a new database = %+v, %v", result, err)
+	}
+	db.Exec("INSERT INTO pools (name) VALUES ('daily')")
+
+	// A failing migration puts the database back as it was
+	files["migrations/002_tapes.sql"] = &fstest.MapFile{Data: []byte("CREATE TABLE tapes (label TEXT);")}
+	files["migrations/003_broken.sql"] = &fstest.MapFile{Data: []byte("ALTER TABLE missing ADD COLUMN x TEXT;")}
+	pending, err := db.PendingMigrations()
+	if err != nil || len(pending) != 2 || pending[0].Version != 2 {
+		t.Fatalf("PendingMigrations = %+v, %v", pending, err)
+	}
+	result, err = db.Upgrade(snapshotDir)
+	if err == nil || !result.RolledBack || result.Snapshot == nil || result.Snapshot.Label != "pre-upgrade" {
+		t.Fatalf("expected a rolled back upgrade, got %+v, %v", result, err)
+	}
+	if version, _ := db.SchemaVersion(); version != 1 {
+		t.Errorf("expected schema version 1 after the rollback, got %d", version)
+	}
+	var tables, pools int
+	db.QueryRow("SELECT COUNT(*) FROM sqlite_master WHERE name = 'tapes'").Scan(&tables)
+	db.QueryRow("SELECT COUNT(*) FROM pools").Scan(&pools)
+	if tables != 0 || pools != 1 {
+		t.Errorf("expected the pre-upgrade database, got tapes table %d, %d pools", tables, pools)
+	}
+
+	// Fixed, both migrations apply after a snapshot. Snapshots are named by
+	// the second, so the first one makes way.
+	os.Remove(result.Snapshot.Path)
+	files["migrations/003_broken.sql"] = &fstest.MapFile{Data: []byte("ALTER TABLE tapes ADD COLUMN barcode TEXT;")}
+	result, err = db.Upgrade(snapshotDir)
+	if err != nil || result.RolledBack || result.Snapshot == nil || result.FromVersion != 1 || result.ToVersion != 3 || len(result.Applied) != 2 {
+		t.Fatalf("Upgrade = %+v, %v", result, err)
+	}
+	if result, err = db.Upgrade(snapshotDir); err != nil || result.Snapshot != nil || len(result.Applied) != 0 {
+		t.Errorf("expected nothing to do, got %+v, %v", result, err)
+	}
+
+	// An older release refuses the newer schema
+	delete(files, "migrations/003_broken.sql")
+	if _, err := db.Upgrade(snapshotDir); !errors.Is(err, ErrSchemaTooNew) {
+		t.Errorf("expected ErrSchemaTooNew, got %v", err)
+	}
+}
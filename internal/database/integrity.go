@@ -0,0 +1,191 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"modernc.org/sqlite"
+	sqlite3 "modernc.org/sqlite/lib"
+)
+
+// maxIntegrityProblems bounds the problems reported by one check
+const maxIntegrityProblems = 50
+
+// IntegrityResult is the outcome of a PRAGMA quick_check or integrity_check
+type IntegrityResult struct {
+	Mode      string    `json:"mode"` // quick or full
+	OK        bool      `json:"ok"`
+	Problems  []string  `json:"problems,omitempty"`
+	CheckedAt time.Time `json:"checked_at"`
+	Duration  float64   `json:"duration_seconds"`
+
+	// err is the error that kept the check from running to the end
+	err error
+}
+
+// Recovery describes a fallback to a local snapshot after the database was
+// found corrupt at startup. Snapshot is empty when no usable snapshot was
+// found and the damaged database is still in use.
+type Recovery struct {
+	At           time.Time `json:"at"`
+	Problems     []string  `json:"problems"`
+	CorruptPath  string    `json:"corrupt_path,omitempty"`
+	Snapshot     string    `json:"snapshot,omitempty"`
+	SnapshotTime time.Time `json:"snapshot_time,omitempty"`
+}
+
+// CheckIntegrity runs PRAGMA quick_check, or the slower integrity_check when
+// full is set, and remembers the result for LastIntegrityCheck. A damaged
+// file often makes the pragma itself fail; that error is reported as a
+// problem.
+func (db *DB) CheckIntegrity(full bool) *IntegrityResult {
+	result := checkIntegrity(db.DB, full)
+	db.mu.Lock()
+	db.lastCheck = result
+	db.mu.Unlock()
+	return result
+}
+
+// LastIntegrityCheck returns the result of the most recent check, or nil
+func (db *DB) LastIntegrityCheck() *IntegrityResult {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	return db.lastCheck
+}
+
+// Recovery returns the snapshot fallback performed at startup, or nil
+func (db *DB) Recovery() *Recovery {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	return db.recovery
+}
+
+func checkIntegrity(conn *sql.DB, full bool) *IntegrityResult {
+	mode, pragma := "quick", "quick_check"
+	if full {
+		mode, pragma = "full", "integrity_check"
+	}
+	result := &IntegrityResult{Mode: mode, CheckedAt: time.Now().UTC()}
+	start := time.Now()
+	defer func() { result.Duration = time.Since(start).Seconds() }()
+
+	rows, err := conn.Query(fmt.Sprintf("PRAGMA %s(%d)", pragma, maxIntegrityProblems))
+	if err != nil {
+		result.Problems, result.err = []string{err.Error()}, err
+		return result
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var line string
+		if err := rows.Scan(&line); err != nil {
+			result.Problems, result.err = append(result.Problems, err.Error()), err
+			return result
+		}
+		if line != "ok" {
+			result.Problems = append(result.Problems, line)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		result.Problems, result.err = append(result.Problems, err.Error()), err
+	}
+	result.OK = len(result.Problems) == 0
+	return result
+}
+
+// OpenChecked opens the database and runs a quick check. If the database is
+// corrupt, it is moved aside and replaced by the newest snapshot in
+// snapshotDir that passes a full integrity check. Without a usable snapshot
+// the damaged database stays in use, if it opens at all, so that it can be
+// restored from a tape database backup. The returned Recovery is nil when
+// the database was fine.
+//
+// Only SQLite's own corruption errors and problems reported by the check
+// count as corruption. Any other error, such as a locked or unreadable
+// file, fails the open and leaves the database alone.
+func OpenChecked(dbPath, snapshotDir string) (*DB, *Recovery, error) {
+	_, statErr := os.Stat(dbPath)
+	exists := statErr == nil
+
+	db, err := New(dbPath)
+	var problems []string
+	if err != nil {
+		if !exists || !isCorruption(err) {
+			return nil, nil, err
+		}
+		problems = []string{err.Error()}
+	} else if result := db.CheckIntegrity(false); !result.OK {
+		if result.err != nil && !isCorruption(result.err) {
+			db.Close()
+			return nil, nil, fmt.Errorf("failed to check database: %w", result.err)
+		}
+		problems = result.Problems
+	} else {
+		return db, nil, nil
+	}
+
+	recovery := &Recovery{At: time.Now().UTC(), Problems: problems}
+	snap := latestGoodSnapshot(snapshotDir)
+	if snap == nil {
+		if db == nil {
+			return nil, nil, fmt.Errorf("database is corrupt and no usable snapshot was found in %s; restore a database backup from tape: %w", snapshotDir, err)
+		}
+		db.recovery = recovery
+		return db, recovery, nil
+	}
+
+	if db != nil {
+		db.Close()
+	}
+	corruptPath := fmt.Sprintf("%s.corrupt-%s", dbPath, time.Now().Format(snapshotLayout))
+	for _, suffix := range []string{"", "-wal", "-shm"} {
+		if err := os.Rename(dbPath+suffix, corruptPath+suffix); err != nil && !os.IsNotExist(err) {
+			return nil, nil, fmt.Errorf("failed to move corrupt database aside: %w", err)
+		}
+	}
+	if err := copyFile(snap.Path, dbPath); err != nil {
+		return nil, nil, fmt.Errorf("failed to restore snapshot %s: %w", snap.Name, err)
+	}
+
+	db, err = New(dbPath)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to open restored snapshot %s: %w", snap.Name, err)
+	}
+	db.CheckIntegrity(false)
+	recovery.CorruptPath = corruptPath
+	recovery.Snapshot = snap.Name
+	recovery.SnapshotTime = snap.Time
+	db.recovery = recovery
+	return db, recovery, nil
+}
+
+// isCorruption reports whether err is SQLite finding the database file
+// damaged or not a database at all
+func isCorruption(err error) bool {
+	var sqliteErr *sqlite.Error
+	if !errors.As(err, &sqliteErr) {
+		return false
+	}
+	switch sqliteErr.Code() & 0xff {
+	case sqlite3.SQLITE_CORRUPT, sqlite3.SQLITE_NOTADB:
+		return true
+	}
+	return false
+}
+
+// latestGoodSnapshot returns the newest snapshot that passes a full
+// integrity check, or nil
+func latestGoodSnapshot(dir string) *Snapshot {
+	snapshots, err := ListSnapshots(dir)
+	if err != nil {
+		return nil
+	}
+	for i := range snapshots {
+		if VerifySnapshot(snapshots[i].Path) {
+			return &snapshots[i]
+		}
+	}
+	return nil
+}
@@ -0,0 +1,10 @@
+-- Per-user UI/API preferences so settings follow the operator between machines
+CREATE TABLE IF NOT EXISTS user_preferences (
+    user_id INTEGER PRIMARY KEY REFERENCES users(id) ON DELETE CASCADE,
+    default_pool_id INTEGER REFERENCES tape_pools(id) ON DELETE SET NULL,
+    preferred_drive_id INTEGER REFERENCES tape_drives(id) ON DELETE SET NULL,
+    items_per_page INTEGER NOT NULL DEFAULT 25,
+    notification_digest BOOLEAN NOT NULL DEFAULT 0,
+    dashboard_layout TEXT NOT NULL DEFAULT '',
+    updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
+);
@@ -0,0 +1,13 @@
+-- Per-run report of paths skipped while scanning a source
+ALTER TABLE backup_sets ADD COLUMN skipped_count INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE backup_sets ADD COLUMN skip_summary TEXT;
+
+CREATE TABLE IF NOT EXISTS backup_skipped_paths (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    backup_set_id INTEGER NOT NULL REFERENCES backup_sets(id) ON DELETE CASCADE,
+    path TEXT NOT NULL,
+    reason TEXT NOT NULL,
+    detail TEXT
+);
+
+CREATE INDEX IF NOT EXISTS idx_backup_skipped_paths_set ON backup_skipped_paths(backup_set_id, reason);
@@ -0,0 +1,4 @@
+-- Explicit symlink handling per source ('store', 'follow', 'skip'), recorded
+-- on each backup set so restores know what the archive contains
+ALTER TABLE backup_sources ADD COLUMN symlink_policy TEXT NOT NULL DEFAULT 'store';
+ALTER TABLE backup_sets ADD COLUMN symlink_policy TEXT NOT NULL DEFAULT 'store';
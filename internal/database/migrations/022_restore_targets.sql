@@ -0,0 +1,19 @@
+-- Saved remote restore destinations. SMB and NFS targets are mounted by
+-- TapeBackarr for the duration of a restore; SSH targets receive the restored
+-- files via rsync. The secret holds the SMB password or SSH private key.
+CREATE TABLE IF NOT EXISTS restore_targets (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    name TEXT NOT NULL UNIQUE,
+    target_type TEXT NOT NULL CHECK (target_type IN ('smb', 'nfs', 'ssh')),
+    host TEXT NOT NULL,
+    port INTEGER NOT NULL DEFAULT 0,
+    share TEXT NOT NULL DEFAULT '',
+    base_path TEXT NOT NULL DEFAULT '',
+    username TEXT NOT NULL DEFAULT '',
+    domain TEXT NOT NULL DEFAULT '',
+    secret TEXT NOT NULL DEFAULT '',
+    mount_options TEXT NOT NULL DEFAULT '',
+    enabled BOOLEAN NOT NULL DEFAULT 1,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
+);
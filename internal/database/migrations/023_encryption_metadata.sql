@@ -0,0 +1,8 @@
+-- Per-set record of how the backup stream was encrypted (format, KDF
+-- parameters, salt and starting IV) so restores never depend on defaults
+-- that may change between TapeBackarr versions
+ALTER TABLE backup_sets ADD COLUMN encryption_format TEXT NOT NULL DEFAULT '';
+ALTER TABLE backup_sets ADD COLUMN encryption_kdf TEXT NOT NULL DEFAULT '';
+ALTER TABLE backup_sets ADD COLUMN encryption_salt TEXT NOT NULL DEFAULT '';
+ALTER TABLE backup_sets ADD COLUMN encryption_iv TEXT NOT NULL DEFAULT '';
+ALTER TABLE backup_sets ADD COLUMN encryption_chunk_size INTEGER NOT NULL DEFAULT 0;
@@ -0,0 +1,3 @@
+-- Per-user language for notifications and system events; empty falls back
+-- to the browser's Accept-Language and then English
+ALTER TABLE user_preferences ADD COLUMN language TEXT NOT NULL DEFAULT '';
@@ -0,0 +1,11 @@
+-- Admin-defined notification templates (Go text/template) per event type and
+-- channel; channel 'all' applies to channels without their own template
+CREATE TABLE IF NOT EXISTS notification_templates (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    event_type TEXT NOT NULL,
+    channel TEXT NOT NULL,
+    title_template TEXT NOT NULL DEFAULT '',
+    body_template TEXT NOT NULL,
+    updated_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE(event_type, channel)
+);
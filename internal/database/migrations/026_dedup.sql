@@ -0,0 +1,13 @@
+-- Catalog-aware duplicate skipping: files whose content already exists in an
+-- unexpired set of the same pool are catalogued as references to that set
+-- instead of being written to tape again
+ALTER TABLE backup_jobs ADD COLUMN dedup_enabled BOOLEAN NOT NULL DEFAULT 0;
+
+ALTER TABLE catalog_entries ADD COLUMN ref_backup_set_id INTEGER;
+ALTER TABLE catalog_entries ADD COLUMN ref_file_path TEXT;
+
+ALTER TABLE backup_sets ADD COLUMN dedup_count INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE backup_sets ADD COLUMN dedup_bytes INTEGER NOT NULL DEFAULT 0;
+
+CREATE INDEX IF NOT EXISTS idx_catalog_file_size ON catalog_entries(file_size);
+CREATE INDEX IF NOT EXISTS idx_catalog_ref_set ON catalog_entries(ref_backup_set_id);
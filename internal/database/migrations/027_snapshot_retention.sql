@@ -0,0 +1,7 @@
+-- Snapshot management: pinned snapshots are kept regardless of the job's
+-- snapshot retention, which keeps the newest N snapshots (0 keeps all)
+ALTER TABLE snapshots ADD COLUMN pinned BOOLEAN NOT NULL DEFAULT 0;
+
+ALTER TABLE backup_jobs ADD COLUMN snapshot_retention INTEGER NOT NULL DEFAULT 0;
+
+CREATE INDEX IF NOT EXISTS idx_snapshot_backup_set ON snapshots(backup_set_id);
@@ -0,0 +1,7 @@
+-- Force-full policy: an incremental run is promoted to a full backup after
+-- N incrementals or X days since the last full (0 disables either limit).
+-- The reason for a promotion is recorded on the backup set.
+ALTER TABLE backup_jobs ADD COLUMN full_every_incrementals INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE backup_jobs ADD COLUMN full_every_days INTEGER NOT NULL DEFAULT 0;
+
+ALTER TABLE backup_sets ADD COLUMN promotion_reason TEXT NOT NULL DEFAULT '';
@@ -0,0 +1,5 @@
+-- Ad-hoc backups: one-off runs of an arbitrary path get an internal source
+-- and job so their backup sets are catalogued and restorable like any other.
+-- These rows are hidden from the source and job lists.
+ALTER TABLE backup_sources ADD COLUMN ad_hoc BOOLEAN NOT NULL DEFAULT 0;
+ALTER TABLE backup_jobs ADD COLUMN ad_hoc BOOLEAN NOT NULL DEFAULT 0;
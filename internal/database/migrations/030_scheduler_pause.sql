@@ -0,0 +1,13 @@
+-- Scheduler pause: a job's schedule can be paused without disabling the job,
+-- and the whole scheduler can be paused. Paused schedules keep their cron
+-- entries so upcoming runs can still be previewed; the runs are skipped.
+ALTER TABLE backup_jobs ADD COLUMN schedule_paused BOOLEAN NOT NULL DEFAULT 0;
+
+CREATE TABLE IF NOT EXISTS scheduler_state (
+    id INTEGER PRIMARY KEY CHECK (id = 1),
+    paused BOOLEAN NOT NULL DEFAULT 0,
+    paused_at DATETIME,
+    paused_by TEXT NOT NULL DEFAULT ''
+);
+
+INSERT OR IGNORE INTO scheduler_state (id, paused) VALUES (1, 0);
@@ -0,0 +1,12 @@
+-- Job ownership and per-job notification recipients. A job's notifications
+-- go to its own chat and addresses and to its owner's contact details; the
+-- global channels receive them only when the job has no recipients or has
+-- notify_global set.
+ALTER TABLE backup_jobs ADD COLUMN owner_id INTEGER REFERENCES users(id) ON DELETE SET NULL;
+ALTER TABLE backup_jobs ADD COLUMN notify_emails TEXT NOT NULL DEFAULT '';
+ALTER TABLE backup_jobs ADD COLUMN notify_telegram_chat_id TEXT NOT NULL DEFAULT '';
+ALTER TABLE backup_jobs ADD COLUMN notify_global BOOLEAN NOT NULL DEFAULT 0;
+
+-- Where a user wants the notifications of the jobs they own
+ALTER TABLE user_preferences ADD COLUMN notify_email TEXT NOT NULL DEFAULT '';
+ALTER TABLE user_preferences ADD COLUMN notify_telegram_chat_id TEXT NOT NULL DEFAULT '';
@@ -0,0 +1,5 @@
+-- Recovery point objectives: the maximum age of the newest successful
+-- backup. 0 uses the default (slo.default_rpo_hours for sources, the
+-- source's RPO for jobs); a negative value turns the check off.
+ALTER TABLE backup_sources ADD COLUMN rpo_hours INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE backup_jobs ADD COLUMN rpo_hours INTEGER NOT NULL DEFAULT 0;
@@ -0,0 +1,10 @@
+-- Optional approval before a pool recycles an expired tape. Expired tapes
+-- enter the pending state when a backup would reuse them and are only
+-- selected once approved, by an admin or after the pool's grace period.
+ALTER TABLE tape_pools ADD COLUMN reuse_approval BOOLEAN NOT NULL DEFAULT 0;
+ALTER TABLE tape_pools ADD COLUMN reuse_grace_hours INTEGER NOT NULL DEFAULT 0;
+
+ALTER TABLE tapes ADD COLUMN reuse_state TEXT NOT NULL DEFAULT '';
+ALTER TABLE tapes ADD COLUMN reuse_requested_at DATETIME;
+ALTER TABLE tapes ADD COLUMN reuse_approved_at DATETIME;
+ALTER TABLE tapes ADD COLUMN reuse_approved_by INTEGER REFERENCES users(id) ON DELETE SET NULL;
@@ -0,0 +1,28 @@
+-- Signed receipts of restores: who requested them, which files from which
+-- backup sets and tapes, the verification outcome and the destination. The
+-- receipt is stored as the exact JSON that was signed so it can be exported
+-- and verified later with the signing key's public half.
+CREATE TABLE IF NOT EXISTS receipt_signing_keys (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    public_key TEXT NOT NULL,   -- base64 Ed25519 public key
+    private_key TEXT NOT NULL,  -- base64 Ed25519 private key
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS restore_receipts (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    uuid TEXT NOT NULL UNIQUE,
+    user_id INTEGER REFERENCES users(id) ON DELETE SET NULL,
+    backup_set_id INTEGER NOT NULL,  -- No foreign key: receipts outlive deleted sets
+    status TEXT NOT NULL CHECK (status IN ('completed', 'failed')),
+    destination TEXT NOT NULL DEFAULT '',
+    files_restored INTEGER NOT NULL DEFAULT 0,
+    bytes_restored INTEGER NOT NULL DEFAULT 0,
+    content TEXT NOT NULL,
+    signature TEXT NOT NULL,
+    key_id INTEGER NOT NULL REFERENCES receipt_signing_keys(id),
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_restore_receipts_backup_set ON restore_receipts(backup_set_id);
+CREATE INDEX IF NOT EXISTS idx_restore_receipts_created ON restore_receipts(created_at);
@@ -0,0 +1,24 @@
+-- Recalls of single cataloged artifacts from tape. A recall is queued,
+-- worked off by the server (loading the tape from a library when it can),
+-- and the extracted file is then served from scratch space through a
+-- random download token until the recall expires.
+CREATE TABLE IF NOT EXISTS artifact_recalls (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    catalog_entry_id INTEGER NOT NULL,  -- No foreign key: the catalog entry may be pruned
+    backup_set_id INTEGER NOT NULL,
+    file_path TEXT NOT NULL,
+    file_size INTEGER NOT NULL DEFAULT 0,
+    status TEXT NOT NULL DEFAULT 'queued' CHECK (status IN ('queued', 'waiting', 'recalling', 'ready', 'failed', 'expired')),
+    error TEXT NOT NULL DEFAULT '',
+    staged_path TEXT NOT NULL DEFAULT '',
+    download_token TEXT UNIQUE,
+    ttl_hours INTEGER NOT NULL DEFAULT 24,
+    requested_by INTEGER REFERENCES users(id) ON DELETE SET NULL,
+    requested_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    started_at DATETIME,
+    ready_at DATETIME,
+    expires_at DATETIME
+);
+
+CREATE INDEX IF NOT EXISTS idx_artifact_recalls_status ON artifact_recalls(status);
+CREATE INDEX IF NOT EXISTS idx_artifact_recalls_entry ON artifact_recalls(catalog_entry_id);
@@ -0,0 +1,2 @@
+-- Jobs can start writing to tape while the source is still being scanned
+ALTER TABLE backup_jobs ADD COLUMN pipelined_scan BOOLEAN NOT NULL DEFAULT 0;
@@ -0,0 +1,7 @@
+-- How incremental runs of a job detect changed files. 'metadata' compares
+-- size and modification time; 'hash' also compares content hashes of files
+-- whose metadata is unchanged; 'hybrid' hashes those only when their ctime
+-- moved. hash_sampled hashes the start, middle and end of large files
+-- instead of their whole content.
+ALTER TABLE backup_jobs ADD COLUMN change_detection TEXT NOT NULL DEFAULT 'metadata' CHECK (change_detection IN ('metadata', 'hash', 'hybrid'));
+ALTER TABLE backup_jobs ADD COLUMN hash_sampled BOOLEAN NOT NULL DEFAULT 0;
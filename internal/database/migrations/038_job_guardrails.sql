@@ -0,0 +1,12 @@
+-- Guardrails stop a backup run whose size looks wrong, such as after a
+-- mis-edited source path, before anything is written. A limit of 0 is off.
+-- guard_action decides whether a tripped run waits for the next run to be
+-- confirmed or ends as a report-only dry run; guard_confirmed lets the next
+-- tripped run through once. backup_sets.guardrail records what tripped.
+ALTER TABLE backup_jobs ADD COLUMN guard_max_files INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE backup_jobs ADD COLUMN guard_max_bytes INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE backup_jobs ADD COLUMN guard_max_change_percent INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE backup_jobs ADD COLUMN guard_action TEXT NOT NULL DEFAULT 'confirm' CHECK (guard_action IN ('confirm', 'dry_run'));
+ALTER TABLE backup_jobs ADD COLUMN guard_confirmed BOOLEAN NOT NULL DEFAULT 0;
+
+ALTER TABLE backup_sets ADD COLUMN guardrail TEXT NOT NULL DEFAULT '';
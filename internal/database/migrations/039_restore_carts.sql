@@ -0,0 +1,27 @@
+-- Restore carts collect catalog entries from any number of searches and
+-- backup sets before they are submitted as a restore plan, so clients never
+-- have to send one giant file list. Items keep the path and size they were
+-- added with; a cart is frozen once submitted.
+CREATE TABLE IF NOT EXISTS restore_carts (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    name TEXT NOT NULL,
+    owner_id INTEGER REFERENCES users(id) ON DELETE CASCADE,
+    status TEXT NOT NULL DEFAULT 'open' CHECK (status IN ('open', 'submitted')),
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    updated_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    submitted_at DATETIME
+);
+
+CREATE TABLE IF NOT EXISTS restore_cart_items (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    cart_id INTEGER NOT NULL REFERENCES restore_carts(id) ON DELETE CASCADE,
+    catalog_entry_id INTEGER NOT NULL,  -- No foreign key: the catalog entry may be pruned
+    backup_set_id INTEGER NOT NULL,
+    file_path TEXT NOT NULL,
+    file_size INTEGER NOT NULL DEFAULT 0,
+    added_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE(cart_id, backup_set_id, file_path)
+);
+
+CREATE INDEX IF NOT EXISTS idx_restore_carts_owner ON restore_carts(owner_id);
+CREATE INDEX IF NOT EXISTS idx_restore_cart_items_cart ON restore_cart_items(cart_id, backup_set_id);
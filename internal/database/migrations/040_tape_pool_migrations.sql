@@ -0,0 +1,19 @@
+-- History of tapes moved between pools. A tape's backup sets and catalog
+-- move with it. relabel_status records whether the pool name in the on-tape
+-- label was rewritten: a label can only be rewritten in place on a tape
+-- without data, so tapes holding data stay 'pending' until they are next
+-- labelled.
+CREATE TABLE IF NOT EXISTS tape_pool_migrations (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    tape_id INTEGER NOT NULL REFERENCES tapes(id) ON DELETE CASCADE,
+    from_pool_id INTEGER,             -- No foreign key: pools may be deleted later
+    from_pool_name TEXT NOT NULL DEFAULT '',
+    to_pool_id INTEGER NOT NULL,
+    to_pool_name TEXT NOT NULL DEFAULT '',
+    relabel_status TEXT NOT NULL DEFAULT 'skipped' CHECK (relabel_status IN ('done', 'pending', 'skipped')),
+    warnings TEXT NOT NULL DEFAULT '',  -- Policy findings accepted for the move, one per line
+    migrated_by INTEGER REFERENCES users(id) ON DELETE SET NULL,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_tape_pool_migrations_tape ON tape_pool_migrations(tape_id);
@@ -0,0 +1,10 @@
+-- Bind physical drives by serial number / WWN. Device nodes such as
+-- /dev/nst0 follow probe order and can change across reboots; device_path is
+-- re-resolved from these identifiers before drive operations.
+-- binding_status: '' (not yet bound), 'bound', or 'missing' when the drive
+-- cannot be found. binding_disabled records that the drive was disabled
+-- because it went missing, so it is re-enabled when it is found again.
+ALTER TABLE tape_drives ADD COLUMN wwn TEXT NOT NULL DEFAULT '';
+ALTER TABLE tape_drives ADD COLUMN binding_status TEXT NOT NULL DEFAULT '';
+ALTER TABLE tape_drives ADD COLUMN binding_disabled BOOLEAN NOT NULL DEFAULT 0;
+ALTER TABLE tape_drives ADD COLUMN binding_checked_at DATETIME;
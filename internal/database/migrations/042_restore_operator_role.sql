@@ -0,0 +1,26 @@
+-- +foreign_keys off
+-- Add the restore_operator role: catalog search and restores to approved
+-- restore targets, nothing else. SQLite cannot change a CHECK constraint in
+-- place, so the users table is rebuilt; the migration runs with foreign keys
+-- off so rows referencing users are left untouched.
+CREATE TABLE users_new (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    username TEXT NOT NULL UNIQUE,
+    password_hash TEXT NOT NULL,
+    role TEXT NOT NULL CHECK (role IN ('admin', 'operator', 'restore_operator', 'readonly')),
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    updated_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    failed_login_attempts INTEGER NOT NULL DEFAULT 0,
+    locked_at DATETIME,
+    last_login_at DATETIME,
+    last_login_ip TEXT
+);
+
+INSERT INTO users_new (id, username, password_hash, role, created_at, updated_at,
+    failed_login_attempts, locked_at, last_login_at, last_login_ip)
+SELECT id, username, password_hash, role, created_at, updated_at,
+    failed_login_attempts, locked_at, last_login_at, last_login_ip
+FROM users;
+
+DROP TABLE users;
+ALTER TABLE users_new RENAME TO users;
@@ -0,0 +1,4 @@
+-- Bytes a backup set occupies on tape after software compression and
+-- encryption. Together with total_bytes (source bytes) it gives the set's
+-- compression ratio. 0 for sets written before this column existed.
+ALTER TABLE backup_sets ADD COLUMN tape_bytes INTEGER NOT NULL DEFAULT 0;
@@ -0,0 +1,8 @@
+-- Backup sets can be logically deleted while they stay on tape. Their catalog
+-- is removed and the space they take counts as reclaimable when the tape is
+-- recycled; later sets on the same tape stay valid.
+ALTER TABLE backup_sets ADD COLUMN invalidated_at DATETIME;
+ALTER TABLE backup_sets ADD COLUMN invalidated_by INTEGER REFERENCES users(id) ON DELETE SET NULL;
+ALTER TABLE backup_sets ADD COLUMN invalidation_reason TEXT NOT NULL DEFAULT '';
+
+CREATE INDEX IF NOT EXISTS idx_backup_sets_invalidated ON backup_sets(tape_id, invalidated_at);
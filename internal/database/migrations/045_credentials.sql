@@ -0,0 +1,30 @@
+-- Named credentials (SMB passwords, SSH keys, database passwords) kept
+-- encrypted in one place and referenced by restore targets instead of being
+-- copied into each of them. Every use of a secret is recorded.
+CREATE TABLE IF NOT EXISTS credentials (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    name TEXT NOT NULL UNIQUE,
+    credential_type TEXT NOT NULL CHECK (credential_type IN ('password', 'ssh_key', 'token')),
+    username TEXT NOT NULL DEFAULT '',
+    domain TEXT NOT NULL DEFAULT '',
+    description TEXT NOT NULL DEFAULT '',
+    secret_encrypted TEXT NOT NULL DEFAULT '',
+    last_used_at DATETIME,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS credential_usage (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    credential_id INTEGER NOT NULL REFERENCES credentials(id) ON DELETE CASCADE,
+    used_by_type TEXT NOT NULL,
+    used_by_id INTEGER,
+    purpose TEXT NOT NULL DEFAULT '',
+    success BOOLEAN NOT NULL DEFAULT 1,
+    error TEXT NOT NULL DEFAULT '',
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_credential_usage_credential ON credential_usage(credential_id, created_at);
+
+ALTER TABLE restore_targets ADD COLUMN credential_id INTEGER REFERENCES credentials(id);
@@ -0,0 +1,5 @@
+-- Remaining capacity as the drive reports it (tape capacity log page 31h),
+-- read after each write. used_bytes counts logical bytes, so it misses drive
+-- compression and space lost to rewrites on worn media.
+ALTER TABLE tapes ADD COLUMN physical_remaining_bytes INTEGER;
+ALTER TABLE tapes ADD COLUMN physical_remaining_at DATETIME;
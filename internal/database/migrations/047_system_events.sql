@@ -0,0 +1,15 @@
+-- Published system events, kept so event stream clients that reconnect can
+-- replay what they missed (Last-Event-ID). id is the event's sequence number.
+CREATE TABLE IF NOT EXISTS system_events (
+    id INTEGER PRIMARY KEY,
+    event_id TEXT NOT NULL DEFAULT '',
+    type TEXT NOT NULL,
+    category TEXT NOT NULL DEFAULT '',
+    title TEXT NOT NULL DEFAULT '',
+    message TEXT NOT NULL DEFAULT '',
+    event_key TEXT NOT NULL DEFAULT '',
+    args TEXT NOT NULL DEFAULT '',
+    details TEXT NOT NULL DEFAULT '',
+    created_at DATETIME NOT NULL
+);
+CREATE INDEX IF NOT EXISTS idx_system_events_created ON system_events(created_at);
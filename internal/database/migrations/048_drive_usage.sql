@@ -0,0 +1,11 @@
+-- Write time per drive, used to spread tape loads across drives by how much
+-- each drive has been writing recently
+CREATE TABLE IF NOT EXISTS drive_usage (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    drive_id INTEGER NOT NULL REFERENCES tape_drives(id) ON DELETE CASCADE,
+    write_seconds REAL NOT NULL DEFAULT 0,
+    bytes_written INTEGER NOT NULL DEFAULT 0,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_drive_usage_drive ON drive_usage(drive_id, created_at);
@@ -0,0 +1,18 @@
+-- Audit log exports appended to a compliance tape. Each export is one tape
+-- file holding the audit entries since the previous one; hash chains the
+-- exports so a removed or altered export, or audit rows changed after they
+-- were exported, can be detected.
+CREATE TABLE IF NOT EXISTS audit_exports (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    sequence INTEGER NOT NULL UNIQUE,
+    tape_id INTEGER NOT NULL REFERENCES tapes(id),
+    file_number INTEGER NOT NULL,
+    first_audit_id INTEGER NOT NULL,
+    last_audit_id INTEGER NOT NULL,
+    entry_count INTEGER NOT NULL,
+    prev_hash TEXT NOT NULL DEFAULT '',
+    hash TEXT NOT NULL,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_audit_exports_tape ON audit_exports(tape_id, file_number);
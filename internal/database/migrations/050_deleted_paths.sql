@@ -0,0 +1,12 @@
+-- Files an incremental backup found deleted since the previous run: in the
+-- previous snapshot but missing from this scan. Paths are relative to the
+-- source like catalog entries. Point-in-time restores leave them out.
+ALTER TABLE backup_sets ADD COLUMN deleted_count INTEGER NOT NULL DEFAULT 0;
+
+CREATE TABLE IF NOT EXISTS backup_deleted_paths (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    backup_set_id INTEGER NOT NULL REFERENCES backup_sets(id) ON DELETE CASCADE,
+    path TEXT NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_backup_deleted_paths_set ON backup_deleted_paths(backup_set_id, path);
@@ -0,0 +1,12 @@
+-- A tape a job has selected for writing. Selection skips tapes reserved by
+-- other jobs so two jobs sharing a pool never write the same tape. Rows are
+-- removed when the job finishes and ignored once expired, so a crashed run
+-- cannot hold a tape for longer than the reservation timeout.
+CREATE TABLE IF NOT EXISTS tape_reservations (
+    tape_id INTEGER PRIMARY KEY REFERENCES tapes(id) ON DELETE CASCADE,
+    job_id INTEGER NOT NULL REFERENCES backup_jobs(id) ON DELETE CASCADE,
+    reserved_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    expires_at DATETIME NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_tape_reservations_job ON tape_reservations(job_id);
@@ -0,0 +1,12 @@
+-- Ownership and file type in the catalog: who owned each file, what kind of
+-- file it was, where a stored symlink pointed and whether it carried extended
+-- attributes. uid and gid are NULL when the platform did not report them.
+ALTER TABLE catalog_entries ADD COLUMN uid INTEGER;
+ALTER TABLE catalog_entries ADD COLUMN gid INTEGER;
+ALTER TABLE catalog_entries ADD COLUMN owner TEXT;
+ALTER TABLE catalog_entries ADD COLUMN group_name TEXT;
+ALTER TABLE catalog_entries ADD COLUMN file_type TEXT;
+ALTER TABLE catalog_entries ADD COLUMN link_target TEXT;
+ALTER TABLE catalog_entries ADD COLUMN has_xattrs BOOLEAN NOT NULL DEFAULT 0;
+
+CREATE INDEX IF NOT EXISTS idx_catalog_owner ON catalog_entries(owner);
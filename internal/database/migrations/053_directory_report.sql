@@ -0,0 +1,12 @@
+-- Optional per-run report of a backup set's composition by top-level
+-- directory of the source, so users can see what is consuming tape in
+-- shared datasets. Files directly in the source root are recorded under '.'.
+ALTER TABLE backup_jobs ADD COLUMN directory_report BOOLEAN NOT NULL DEFAULT 0;
+
+CREATE TABLE IF NOT EXISTS backup_set_directories (
+    backup_set_id INTEGER NOT NULL REFERENCES backup_sets(id) ON DELETE CASCADE,
+    directory TEXT NOT NULL,
+    file_count INTEGER NOT NULL DEFAULT 0,
+    total_bytes INTEGER NOT NULL DEFAULT 0,
+    PRIMARY KEY (backup_set_id, directory)
+);
@@ -0,0 +1,22 @@
+-- Proxmox VE clusters registered through the API, in addition to the one
+-- endpoint in the configuration file. Credentials come from the encrypted
+-- credentials store. Guests, backups, restores and jobs are scoped to a
+-- cluster; a NULL cluster_id is the configured endpoint.
+CREATE TABLE IF NOT EXISTS proxmox_clusters (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    name TEXT NOT NULL UNIQUE,
+    host TEXT NOT NULL,
+    port INTEGER NOT NULL DEFAULT 8006,
+    skip_tls_verify BOOLEAN NOT NULL DEFAULT 0,
+    credential_id INTEGER NOT NULL REFERENCES credentials(id),
+    enabled BOOLEAN NOT NULL DEFAULT 1,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
+);
+
+ALTER TABLE proxmox_backups ADD COLUMN cluster_id INTEGER;
+ALTER TABLE proxmox_restores ADD COLUMN cluster_id INTEGER;
+ALTER TABLE proxmox_backup_jobs ADD COLUMN cluster_id INTEGER REFERENCES proxmox_clusters(id);
+
+CREATE INDEX IF NOT EXISTS idx_proxmox_backups_cluster ON proxmox_backups(cluster_id);
+CREATE INDEX IF NOT EXISTS idx_proxmox_restores_cluster ON proxmox_restores(cluster_id);
@@ -0,0 +1,3 @@
+-- Let a pool require a tape format. Tapes labelled into the pool default to
+-- it and backups only select tapes of that format. NULL accepts either.
+ALTER TABLE tape_pools ADD COLUMN format_type TEXT CHECK (format_type IN ('raw', 'ltfs'));
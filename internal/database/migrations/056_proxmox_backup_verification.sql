@@ -0,0 +1,5 @@
+-- Record the outcome of reading a Proxmox backup back from tape and checking
+-- its vzdump archive
+ALTER TABLE proxmox_backups ADD COLUMN verify_status TEXT CHECK (verify_status IN ('passed', 'failed'));
+ALTER TABLE proxmox_backups ADD COLUMN verified_at DATETIME;
+ALTER TABLE proxmox_backups ADD COLUMN verify_error TEXT;
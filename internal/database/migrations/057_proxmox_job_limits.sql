@@ -0,0 +1,7 @@
+-- Limit the impact of Proxmox backup jobs on the cluster: the nodes allowed
+-- to run dumps, vzdump's bandwidth limit (KiB/s) and IO priority, and how
+-- many guests are dumped at once into the staging area
+ALTER TABLE proxmox_backup_jobs ADD COLUMN dump_nodes TEXT NOT NULL DEFAULT '';  -- Comma-separated, empty means any
+ALTER TABLE proxmox_backup_jobs ADD COLUMN bwlimit INTEGER NOT NULL DEFAULT 0 CHECK (bwlimit >= 0);
+ALTER TABLE proxmox_backup_jobs ADD COLUMN ionice INTEGER CHECK (ionice BETWEEN 0 AND 8);
+ALTER TABLE proxmox_backup_jobs ADD COLUMN parallelism INTEGER NOT NULL DEFAULT 1 CHECK (parallelism BETWEEN 1 AND 8);
@@ -0,0 +1,24 @@
+-- +foreign_keys off
+-- Add the kiosk role: the operator kiosk's tape requests and nothing else.
+-- The users table is rebuilt to change its CHECK constraint, as in 042.
+CREATE TABLE users_new (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    username TEXT NOT NULL UNIQUE,
+    password_hash TEXT NOT NULL,
+    role TEXT NOT NULL CHECK (role IN ('admin', 'operator', 'restore_operator', 'readonly', 'kiosk')),
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    updated_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    failed_login_attempts INTEGER NOT NULL DEFAULT 0,
+    locked_at DATETIME,
+    last_login_at DATETIME,
+    last_login_ip TEXT
+);
+
+INSERT INTO users_new (id, username, password_hash, role, created_at, updated_at,
+    failed_login_attempts, locked_at, last_login_at, last_login_ip)
+SELECT id, username, password_hash, role, created_at, updated_at,
+    failed_login_attempts, locked_at, last_login_at, last_login_ip
+FROM users;
+
+DROP TABLE users;
+ALTER TABLE users_new RENAME TO users;
@@ -0,0 +1,9 @@
+-- File extension and coarse content class (image, video, audio, document,
+-- archive, database, other) of each catalog entry, for filtered searches and
+-- per-type statistics. Entries cataloged earlier are NULL until the server
+-- classifies them at startup.
+ALTER TABLE catalog_entries ADD COLUMN extension TEXT;
+ALTER TABLE catalog_entries ADD COLUMN content_class TEXT;
+
+CREATE INDEX IF NOT EXISTS idx_catalog_extension ON catalog_entries(extension);
+CREATE INDEX IF NOT EXISTS idx_catalog_content_class ON catalog_entries(content_class);
@@ -0,0 +1,6 @@
+-- Stream stages run on a backup stream between tar and compression. Jobs
+-- list the stages to apply; backup sets record the stages applied, with the
+-- metadata needed to reverse them on restore. Both are JSON arrays of
+-- {name, params, metadata}; NULL means no stages.
+ALTER TABLE backup_jobs ADD COLUMN stream_stages TEXT;
+ALTER TABLE backup_sets ADD COLUMN stream_stages TEXT;
@@ -0,0 +1,11 @@
+-- A backup job writing through a drive holds it until the run ends; jobs
+-- for other drives run alongside it and jobs for the same drive queue
+-- behind it. The holder is recorded here so the UI and tape selection can
+-- see it. NULL means the drive is free.
+ALTER TABLE tape_drives ADD COLUMN reserved_job_id INTEGER REFERENCES backup_jobs(id) ON DELETE SET NULL;
+ALTER TABLE tape_drives ADD COLUMN reserved_at DATETIME;
+
+-- A job can be pinned to a drive: it then waits its turn for that drive and
+-- only writes to tapes loaded in it. NULL uses whichever drive holds the
+-- job's tape.
+ALTER TABLE backup_jobs ADD COLUMN drive_id INTEGER REFERENCES tape_drives(id) ON DELETE SET NULL;
@@ -0,0 +1,4 @@
+-- Networks an API key may call admin endpoints and destructive operations
+-- from: comma-separated CIDRs or single addresses, checked in addition to
+-- auth.management_cidrs. Empty allows any address the global list allows.
+ALTER TABLE api_keys ADD COLUMN allowed_cidrs TEXT NOT NULL DEFAULT '';
@@ -0,0 +1,98 @@
+-- +foreign_keys off
+-- Add the differential backup type: changes since the job's last full
+-- backup. backup_jobs and backup_sets are rebuilt to change their CHECK
+-- constraints, as in 058; the column order is kept so rows copy as they are.
+CREATE TABLE backup_jobs_new (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    name TEXT NOT NULL,
+    source_id INTEGER NOT NULL REFERENCES backup_sources(id),
+    pool_id INTEGER NOT NULL REFERENCES tape_pools(id),
+    backup_type TEXT NOT NULL CHECK (backup_type IN ('full', 'incremental', 'differential')),
+    schedule_cron TEXT,
+    retention_days INTEGER DEFAULT 30,
+    enabled BOOLEAN DEFAULT 1,
+    last_run_at DATETIME,
+    next_run_at DATETIME,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    updated_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    encryption_enabled BOOLEAN DEFAULT 0,
+    encryption_key_id INTEGER REFERENCES encryption_keys(id),
+    compression TEXT DEFAULT 'none',
+    hw_encryption_enabled BOOLEAN DEFAULT 0,
+    hw_encryption_key_id INTEGER REFERENCES encryption_keys(id),
+    dedup_enabled BOOLEAN NOT NULL DEFAULT 0,
+    snapshot_retention INTEGER NOT NULL DEFAULT 0,
+    full_every_incrementals INTEGER NOT NULL DEFAULT 0,
+    full_every_days INTEGER NOT NULL DEFAULT 0,
+    ad_hoc BOOLEAN NOT NULL DEFAULT 0,
+    schedule_paused BOOLEAN NOT NULL DEFAULT 0,
+    owner_id INTEGER REFERENCES users(id) ON DELETE SET NULL,
+    notify_emails TEXT NOT NULL DEFAULT '',
+    notify_telegram_chat_id TEXT NOT NULL DEFAULT '',
+    notify_global BOOLEAN NOT NULL DEFAULT 0,
+    rpo_hours INTEGER NOT NULL DEFAULT 0,
+    pipelined_scan BOOLEAN NOT NULL DEFAULT 0,
+    change_detection TEXT NOT NULL DEFAULT 'metadata' CHECK (change_detection IN ('metadata', 'hash', 'hybrid')),
+    hash_sampled BOOLEAN NOT NULL DEFAULT 0,
+    guard_max_files INTEGER NOT NULL DEFAULT 0,
+    guard_max_bytes INTEGER NOT NULL DEFAULT 0,
+    guard_max_change_percent INTEGER NOT NULL DEFAULT 0,
+    guard_action TEXT NOT NULL DEFAULT 'confirm' CHECK (guard_action IN ('confirm', 'dry_run')),
+    guard_confirmed BOOLEAN NOT NULL DEFAULT 0,
+    directory_report BOOLEAN NOT NULL DEFAULT 0,
+    stream_stages TEXT,
+    drive_id INTEGER REFERENCES tape_drives(id) ON DELETE SET NULL
+);
+
+INSERT INTO backup_jobs_new SELECT * FROM backup_jobs;
+DROP TABLE backup_jobs;
+ALTER TABLE backup_jobs_new RENAME TO backup_jobs;
+
+CREATE TABLE backup_sets_new (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    job_id INTEGER NOT NULL REFERENCES backup_jobs(id),
+    tape_id INTEGER NOT NULL REFERENCES tapes(id),
+    backup_type TEXT NOT NULL CHECK (backup_type IN ('full', 'incremental', 'differential')),
+    start_time DATETIME NOT NULL,
+    end_time DATETIME,
+    status TEXT NOT NULL CHECK (status IN ('pending', 'running', 'completed', 'failed', 'cancelled')),
+    file_count INTEGER DEFAULT 0,
+    total_bytes INTEGER DEFAULT 0,
+    start_block INTEGER,
+    end_block INTEGER,
+    checksum TEXT,
+    parent_set_id INTEGER REFERENCES backup_sets(id),
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    updated_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    encrypted BOOLEAN DEFAULT 0,
+    encryption_key_id INTEGER REFERENCES encryption_keys(id),
+    compressed BOOLEAN DEFAULT 0,
+    compression_type TEXT DEFAULT 'none',
+    format_type TEXT NOT NULL DEFAULT 'raw' CHECK (format_type IN ('raw', 'ltfs')),
+    hw_encrypted BOOLEAN DEFAULT 0,
+    hw_encryption_key_id INTEGER REFERENCES encryption_keys(id),
+    skipped_count INTEGER NOT NULL DEFAULT 0,
+    skip_summary TEXT,
+    symlink_policy TEXT NOT NULL DEFAULT 'store',
+    encryption_format TEXT NOT NULL DEFAULT '',
+    encryption_kdf TEXT NOT NULL DEFAULT '',
+    encryption_salt TEXT NOT NULL DEFAULT '',
+    encryption_iv TEXT NOT NULL DEFAULT '',
+    encryption_chunk_size INTEGER NOT NULL DEFAULT 0,
+    dedup_count INTEGER NOT NULL DEFAULT 0,
+    dedup_bytes INTEGER NOT NULL DEFAULT 0,
+    promotion_reason TEXT NOT NULL DEFAULT '',
+    guardrail TEXT NOT NULL DEFAULT '',
+    tape_bytes INTEGER NOT NULL DEFAULT 0,
+    invalidated_at DATETIME,
+    invalidated_by INTEGER REFERENCES users(id) ON DELETE SET NULL,
+    invalidation_reason TEXT NOT NULL DEFAULT '',
+    deleted_count INTEGER NOT NULL DEFAULT 0,
+    stream_stages TEXT
+);
+
+INSERT INTO backup_sets_new SELECT * FROM backup_sets;
+DROP TABLE backup_sets;
+ALTER TABLE backup_sets_new RENAME TO backup_sets;
+
+CREATE INDEX idx_backup_sets_invalidated ON backup_sets(tape_id, invalidated_at);
@@ -0,0 +1,4 @@
+-- The tape block size a backup set was written with, so restores can set
+-- the drive to it before reading. 0 means unknown: sets written before it
+-- was recorded, and sets catalogued by scanning a tape.
+ALTER TABLE backup_sets ADD COLUMN block_size INTEGER NOT NULL DEFAULT 0;
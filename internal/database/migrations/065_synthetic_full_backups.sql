@@ -0,0 +1,3 @@
+-- Full backup sets synthesized on tape from a full and the incrementals
+-- after it, rather than read from the source.
+ALTER TABLE backup_sets ADD COLUMN synthetic BOOLEAN NOT NULL DEFAULT 0;
@@ -0,0 +1,3 @@
+-- A restore with a higher priority than the backup run holding the drive it
+-- needs stops the run at a checkpoint and resumes it after the restore.
+ALTER TABLE backup_jobs ADD COLUMN priority INTEGER NOT NULL DEFAULT 0;
@@ -0,0 +1,4 @@
+-- Where each file's tar header starts in the archive stream on its tape,
+-- recorded while writing. Unlike the estimated block_offset it is exact, so
+-- a byte range restore can seek the drive to the file. NULL when unknown.
+ALTER TABLE catalog_entries ADD COLUMN stream_offset INTEGER;
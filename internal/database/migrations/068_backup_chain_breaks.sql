@@ -0,0 +1,5 @@
+-- Backup sets that can no longer be restored completely because a set they
+-- depend on was deleted, expired or erased. Deleted sets leave no trace in
+-- the chain, so the break is recorded on the sets left behind.
+ALTER TABLE backup_sets ADD COLUMN chain_broken_at DATETIME;
+ALTER TABLE backup_sets ADD COLUMN chain_broken_reason TEXT NOT NULL DEFAULT '';
@@ -0,0 +1,7 @@
+-- Copies of backup sets uploaded to S3-compatible object storage by the
+-- cloud_copy stream stage. The status is empty for sets without one.
+ALTER TABLE backup_sets ADD COLUMN cloud_copy_url TEXT NOT NULL DEFAULT '';
+ALTER TABLE backup_sets ADD COLUMN cloud_copy_status TEXT NOT NULL DEFAULT '';
+ALTER TABLE backup_sets ADD COLUMN cloud_copy_bytes INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE backup_sets ADD COLUMN cloud_copy_error TEXT NOT NULL DEFAULT '';
+ALTER TABLE backup_sets ADD COLUMN cloud_copy_at DATETIME;
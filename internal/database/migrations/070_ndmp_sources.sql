@@ -0,0 +1,28 @@
+-- +foreign_keys off
+-- NDMP sources back up a NAS file system over NDMP and log in with a stored
+-- credential. backup_sources is rebuilt to allow the new source type, as in
+-- 063; the column order is kept so rows copy as they are. Backup sets
+-- written from NDMP sources hold the image the NAS sent, of the type it
+-- wrote (dump, tar, ...) and at the dump level it was asked for.
+CREATE TABLE backup_sources_new (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    name TEXT NOT NULL,
+    source_type TEXT NOT NULL CHECK (source_type IN ('local', 'smb', 'nfs', 'ndmp')),
+    path TEXT NOT NULL,
+    include_patterns TEXT,
+    exclude_patterns TEXT,
+    enabled BOOLEAN DEFAULT 1,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    updated_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    symlink_policy TEXT NOT NULL DEFAULT 'store',
+    ad_hoc BOOLEAN NOT NULL DEFAULT 0,
+    rpo_hours INTEGER NOT NULL DEFAULT 0
+);
+
+INSERT INTO backup_sources_new SELECT * FROM backup_sources;
+DROP TABLE backup_sources;
+ALTER TABLE backup_sources_new RENAME TO backup_sources;
+
+ALTER TABLE backup_sources ADD COLUMN credential_id INTEGER REFERENCES credentials(id);
+ALTER TABLE backup_sets ADD COLUMN ndmp_type TEXT NOT NULL DEFAULT '';
+ALTER TABLE backup_sets ADD COLUMN ndmp_level INTEGER;
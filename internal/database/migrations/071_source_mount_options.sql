@@ -0,0 +1,4 @@
+-- NFS sources may name an export (host:/export) that is mounted for each
+-- run, like the shares of SMB sources. mount_options are added to the
+-- options of the mount, e.g. vers=4.1,soft,timeo=100.
+ALTER TABLE backup_sources ADD COLUMN mount_options TEXT NOT NULL DEFAULT '';
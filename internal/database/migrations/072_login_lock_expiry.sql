@@ -0,0 +1,4 @@
+-- Account locks expire: locked_until is when a lock set after too many
+-- failed logins lifts by itself. Locks set before this migration expire
+-- auth.lockout_minutes after locked_at.
+ALTER TABLE users ADD COLUMN locked_until DATETIME;
@@ -0,0 +1,254 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"modernc.org/sqlite"
+)
+
+// snapshotPrefix, snapshotLayout and snapshotSuffix name local database
+// snapshots: tapebackarr-<time>[-<label>].db
+const (
+	snapshotPrefix = "tapebackarr-"
+	snapshotSuffix = ".db"
+	snapshotLayout = "20060102-150405"
+)
+
+// snapshotLabel restricts labels to characters safe in file names
+var snapshotLabel = regexp.MustCompile(`^[a-z0-9-]*$`)
+
+// Snapshot is a local copy of the database written with VACUUM INTO
+type Snapshot struct {
+	Name  string    `json:"name"`
+	Path  string    `json:"path"`
+	Time  time.Time `json:"time"`
+	Size  int64     `json:"size_bytes"`
+	Label string    `json:"label,omitempty"`
+}
+
+// DefaultSnapshotDir is the snapshot directory next to the database file
+func DefaultSnapshotDir(dbPath string) string {
+	return filepath.Join(filepath.Dir(dbPath), "snapshots")
+}
+
+// CreateSnapshot writes a consistent copy of the database into dir. The
+// optional label (lowercase letters, digits and dashes) is added to the
+// file name, e.g. "pre-restore".
+func (db *DB) CreateSnapshot(dir, label string) (*Snapshot, error) {
+	if !snapshotLabel.MatchString(label) {
+		return nil, fmt.Errorf("invalid snapshot label %q", label)
+	}
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, fmt.Errorf("failed to create snapshot directory: %w", err)
+	}
+	now := time.Now()
+	name := snapshotPrefix + now.Format(snapshotLayout)
+	if label != "" {
+		name += "-" + label
+	}
+	name += snapshotSuffix
+	path := filepath.Join(dir, name)
+	if _, err := os.Stat(path); err == nil {
+		return nil, fmt.Errorf("snapshot %s already exists", name)
+	}
+	if _, err := db.Exec("VACUUM INTO ?", path); err != nil {
+		return nil, fmt.Errorf("failed to write snapshot: %w", err)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	return &Snapshot{Name: name, Path: path, Time: now.Truncate(time.Second), Size: info.Size(), Label: label}, nil
+}
+
+// ListSnapshots returns the snapshots in dir, newest first. A missing
+// directory has no snapshots.
+func ListSnapshots(dir string) ([]Snapshot, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	var snapshots []Snapshot
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+		snap, ok := parseSnapshotName(entry.Name())
+		if !ok {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			continue
+		}
+		snap.Path = filepath.Join(dir, snap.Name)
+		snap.Size = info.Size()
+		snapshots = append(snapshots, snap)
+	}
+	sort.Slice(snapshots, func(i, j int) bool { return snapshots[i].Time.After(snapshots[j].Time) })
+	return snapshots, nil
+}
+
+// parseSnapshotName reads the time and label from a snapshot file name
+func parseSnapshotName(name string) (Snapshot, bool) {
+	if !strings.HasPrefix(name, snapshotPrefix) || !strings.HasSuffix(name, snapshotSuffix) {
+		return Snapshot{}, false
+	}
+	rest := strings.TrimSuffix(strings.TrimPrefix(name, snapshotPrefix), snapshotSuffix)
+	if len(rest) < len(snapshotLayout) {
+		return Snapshot{}, false
+	}
+	t, err := time.ParseInLocation(snapshotLayout, rest[:len(snapshotLayout)], time.Local)
+	if err != nil {
+		return Snapshot{}, false
+	}
+	label := rest[len(snapshotLayout):]
+	if label != "" {
+		if !strings.HasPrefix(label, "-") || !snapshotLabel.MatchString(label[1:]) {
+			return Snapshot{}, false
+		}
+		label = label[1:]
+	}
+	return Snapshot{Name: name, Time: t, Label: label}, true
+}
+
+// FindSnapshot returns the snapshot with the given file name in dir
+func FindSnapshot(dir, name string) (*Snapshot, error) {
+	if _, ok := parseSnapshotName(name); !ok || filepath.Base(name) != name {
+		return nil, fmt.Errorf("invalid snapshot name %q", name)
+	}
+	snapshots, err := ListSnapshots(dir)
+	if err != nil {
+		return nil, err
+	}
+	for i := range snapshots {
+		if snapshots[i].Name == name {
+			return &snapshots[i], nil
+		}
+	}
+	return nil, os.ErrNotExist
+}
+
+// PruneSnapshots deletes all but the newest keep snapshots in dir and
+// returns the names of the deleted ones
+func PruneSnapshots(dir string, keep int) ([]string, error) {
+	snapshots, err := ListSnapshots(dir)
+	if err != nil {
+		return nil, err
+	}
+	var removed []string
+	for i, snap := range snapshots {
+		if i < keep {
+			continue
+		}
+		if err := os.Remove(snap.Path); err != nil {
+			return removed, err
+		}
+		removed = append(removed, snap.Name)
+	}
+	return removed, nil
+}
+
+// RestoreSnapshot replaces the contents of the database with a snapshot that
+// passes a full integrity check. The connection stays open, so every
+// service holding this DB continues with the restored data; queries made
+// meanwhile wait for the restore. Migrations are applied afterwards in case
+// the snapshot predates an upgrade. Callers should make sure no backup or
+// restore is writing to the database.
+func (db *DB) RestoreSnapshot(snapshotPath string) error {
+	if !VerifySnapshot(snapshotPath) {
+		return fmt.Errorf("snapshot failed its integrity check")
+	}
+	if err := db.replaceWith(snapshotPath); err != nil {
+		return err
+	}
+	return db.Migrate()
+}
+
+// restorer is the part of the SQLite driver's connection that copies
+// another database into it with the online backup API
+type restorer interface {
+	NewRestore(srcURI string) (*sqlite.Backup, error)
+}
+
+// replaceWith copies snapshotPath over the open database in one step of the
+// backup API. It runs on the pool's only connection, so the *sql.DB is never
+// closed or swapped under other goroutines: their queries wait for the
+// connection and then see the restored data. A failed copy leaves the
+// database as it was.
+func (db *DB) replaceWith(snapshotPath string) error {
+	conn, err := db.DB.Conn(context.Background())
+	if err != nil {
+		return fmt.Errorf("failed to get a database connection: %w", err)
+	}
+	defer conn.Close()
+
+	err = conn.Raw(func(driverConn interface{}) error {
+		r, ok := driverConn.(restorer)
+		if !ok {
+			return fmt.Errorf("the database driver cannot restore snapshots")
+		}
+		backup, err := r.NewRestore("file:" + snapshotPath + "?mode=ro")
+		if err != nil {
+			return err
+		}
+		if _, err := backup.Step(-1); err != nil {
+			backup.Finish()
+			return err
+		}
+		return backup.Finish()
+	})
+	if err != nil {
+		return fmt.Errorf("failed to restore snapshot: %w", err)
+	}
+
+	db.mu.Lock()
+	db.lastCheck = nil
+	db.recovery = nil
+	db.mu.Unlock()
+	return nil
+}
+
+// VerifySnapshot opens a snapshot read-only and runs a full integrity check
+func VerifySnapshot(path string) bool {
+	conn, err := sql.Open("sqlite", "file:"+path+"?mode=ro")
+	if err != nil {
+		return false
+	}
+	defer conn.Close()
+	return checkIntegrity(conn, true).OK
+}
+
+// copyFile copies src to dst, syncing dst before returning
+func copyFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	if err := out.Sync(); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
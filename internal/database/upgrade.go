@@ -0,0 +1,150 @@
+package database
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"sort"
+)
+
+// Migration is a schema migration shipped with this release
+type Migration struct {
+	Version int    `json:"version"`
+	Name    string `json:"name"`
+}
+
+// Migrations returns the migrations of this release in order
+func Migrations() ([]Migration, error) {
+	entries, err := fs.ReadDir(migrationFiles, "migrations")
+	if err != nil {
+		return nil, fmt.Errorf("failed to read migrations directory: %w", err)
+	}
+	var migrations []Migration
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+		if version, ok := ParseMigrationName(entry.Name()); ok {
+			migrations = append(migrations, Migration{Version: version, Name: entry.Name()})
+		}
+	}
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].Version < migrations[j].Version })
+	return migrations, nil
+}
+
+// ParseMigrationName reads the version from a migration file name such as
+// 012_tape_library_support.sql
+func ParseMigrationName(name string) (int, bool) {
+	var version int
+	if _, err := fmt.Sscanf(name, "%03d_", &version); err != nil || version <= 0 {
+		return 0, false
+	}
+	return version, true
+}
+
+// SchemaVersion returns the newest migration applied, 0 for a new database
+func (db *DB) SchemaVersion() (int, error) {
+	var version int
+	err := db.QueryRow("SELECT COALESCE(MAX(version), 0) FROM schema_migrations").Scan(&version)
+	if err != nil {
+		var exists int
+		if db.QueryRow("SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name = 'schema_migrations'").Scan(&exists) == nil && exists == 0 {
+			return 0, nil
+		}
+		return 0, fmt.Errorf("failed to get current migration version: %w", err)
+	}
+	return version, nil
+}
+
+// PendingMigrations returns the migrations of this release not yet applied
+func (db *DB) PendingMigrations() ([]Migration, error) {
+	current, err := db.SchemaVersion()
+	if err != nil {
+		return nil, err
+	}
+	migrations, err := Migrations()
+	if err != nil {
+		return nil, err
+	}
+	var pending []Migration
+	for _, m := range migrations {
+		if m.Version > current {
+			pending = append(pending, m)
+		}
+	}
+	return pending, nil
+}
+
+// UpgradeResult describes the migrations applied by Upgrade
+type UpgradeResult struct {
+	FromVersion int         `json:"from_version"`
+	ToVersion   int         `json:"to_version"`
+	Applied     []Migration `json:"applied"`
+	// Snapshot is the copy taken before migrating, nil for a new database
+	// or when nothing was pending
+	Snapshot *Snapshot `json:"snapshot,omitempty"`
+	// RolledBack is set when a migration failed and the database was put
+	// back from the snapshot
+	RolledBack bool `json:"rolled_back"`
+}
+
+// ErrSchemaTooNew is returned by Upgrade for a database migrated by a newer
+// release than this one
+var ErrSchemaTooNew = errors.New("database was migrated by a newer release")
+
+// Upgrade applies the pending migrations. A database that already holds a
+// schema is snapshotted into snapshotDir first, labelled pre-upgrade, and
+// put back from the snapshot when a migration fails, so the previous
+// release can still open it.
+func (db *DB) Upgrade(snapshotDir string) (*UpgradeResult, error) {
+	if _, err := db.Exec(`
+		CREATE TABLE IF NOT EXISTS schema_migrations (
+			version INTEGER PRIMARY KEY,
+			applied_at DATETIME DEFAULT CURRENT_TIMESTAMP
+		)
+	`); err != nil {
+		return nil, fmt.Errorf("failed to create migrations table: %w", err)
+	}
+	from, err := db.SchemaVersion()
+	if err != nil {
+		return nil, err
+	}
+	result := &UpgradeResult{FromVersion: from, ToVersion: from, Applied: []Migration{}}
+	pending, err := db.PendingMigrations()
+	if err != nil {
+		return nil, err
+	}
+	if len(pending) == 0 {
+		if migrations, err := Migrations(); err == nil && len(migrations) > 0 && from > migrations[len(migrations)-1].Version {
+			return result, fmt.Errorf("%w: schema version %d, this release knows up to %d", ErrSchemaTooNew, from, migrations[len(migrations)-1].Version)
+		}
+		return result, nil
+	}
+
+	if from > 0 {
+		if result.Snapshot, err = db.CreateSnapshot(snapshotDir, "pre-upgrade"); err != nil {
+			return result, fmt.Errorf("failed to snapshot the database before upgrading: %w", err)
+		}
+	}
+
+	migrateErr := db.Migrate()
+	result.ToVersion, _ = db.SchemaVersion()
+	for _, m := range pending {
+		if m.Version <= result.ToVersion {
+			result.Applied = append(result.Applied, m)
+		}
+	}
+	if migrateErr == nil {
+		return result, nil
+	}
+	if result.Snapshot == nil {
+		return result, migrateErr
+	}
+	if err := db.replaceWith(result.Snapshot.Path); err != nil {
+		return result, fmt.Errorf("%v; putting back the pre-upgrade snapshot %s failed too: %w", migrateErr, result.Snapshot.Name, err)
+	}
+	result.RolledBack = true
+	result.ToVersion = from
+	result.Applied = []Migration{}
+	return result, fmt.Errorf("%w; the database was put back from the pre-upgrade snapshot %s", migrateErr, result.Snapshot.Name)
+}
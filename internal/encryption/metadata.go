@@ -0,0 +1,69 @@
+package encryption
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+
+	"github.com/RoseOO/TapeBackarr/internal/models"
+)
+
+// ErrMetadataMismatch is returned when the encryption header on tape does not
+// match the metadata recorded in the catalog for the backup set, which means
+// the tape is positioned at the wrong file or the catalog is for another set.
+var ErrMetadataMismatch = errors.New("encryption header on tape does not match the catalog")
+
+// Metadata returns the catalog record of the parameters in the header.
+func (h *StreamHeader) Metadata() *models.EncryptionMetadata {
+	return &models.EncryptionMetadata{
+		Format: models.EncryptionFormatStreamV2,
+		KDF: models.EncryptionKDF{
+			Algorithm: kdfName(h.KDF),
+			Info:      subkeyContext,
+			KeyLength: KeySize,
+		},
+		Salt:      hex.EncodeToString(h.Salt[:]),
+		IV:        hex.EncodeToString(h.IV[:]),
+		ChunkSize: int(h.ChunkSize),
+	}
+}
+
+// LTFSFileMetadata returns the catalog record for per-file LTFS encryption,
+// where the raw key is used directly and every file carries its own nonce.
+func LTFSFileMetadata() *models.EncryptionMetadata {
+	return &models.EncryptionMetadata{
+		Format: models.EncryptionFormatLTFSFileGCM,
+		KDF:    models.EncryptionKDF{Algorithm: "none", KeyLength: KeySize},
+	}
+}
+
+// VerifyMetadata checks a stream header read from tape against the metadata
+// recorded for the backup set. Sets without recorded metadata pass.
+func VerifyMetadata(expected *models.EncryptionMetadata, h *StreamHeader) error {
+	if expected == nil {
+		return nil
+	}
+	actual := h.Metadata()
+	switch {
+	case expected.Format != actual.Format:
+		return fmt.Errorf("%w: catalog records format %s, tape has %s", ErrMetadataMismatch, expected.Format, actual.Format)
+	case expected.Salt != actual.Salt:
+		return fmt.Errorf("%w: salt differs", ErrMetadataMismatch)
+	case expected.IV != "" && expected.IV != actual.IV:
+		return fmt.Errorf("%w: IV differs", ErrMetadataMismatch)
+	case expected.ChunkSize != 0 && expected.ChunkSize != actual.ChunkSize:
+		return fmt.Errorf("%w: chunk size %d, tape has %d", ErrMetadataMismatch, expected.ChunkSize, actual.ChunkSize)
+	case expected.KDF.Algorithm != "" && expected.KDF.Algorithm != actual.KDF.Algorithm:
+		return fmt.Errorf("%w: key derivation %s, tape has %s", ErrMetadataMismatch, expected.KDF.Algorithm, actual.KDF.Algorithm)
+	}
+	return nil
+}
+
+func kdfName(id byte) string {
+	switch id {
+	case KDFHKDFSHA256:
+		return "hkdf-sha256"
+	default:
+		return fmt.Sprintf("unknown-%d", id)
+	}
+}
@@ -0,0 +1,119 @@
+package encryption
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/pbkdf2"
+	"crypto/sha256"
+	"fmt"
+	"io"
+)
+
+// Backups written before the native stream format were piped through
+//
+//	openssl enc -aes-256-cbc -salt -pbkdf2 -iter 100000 -pass pass:<key_base64>
+//
+// The reader below decrypts that format in Go so existing tapes can still be
+// restored without the openssl binary.
+const (
+	openSSLSaltedMagic = "Salted__"
+	openSSLSaltSize    = 8
+	openSSLIterations  = 100000
+)
+
+// openSSLDecryptingReader decrypts an `openssl enc -aes-256-cbc -pbkdf2`
+// stream. The last block is held back until EOF so padding can be removed.
+type openSSLDecryptingReader struct {
+	source    io.Reader
+	mode      cipher.BlockMode
+	buf       []byte // ciphertext read but not yet decrypted
+	decrypted []byte
+	eof       bool
+}
+
+// NewOpenSSLDecryptingReader returns a reader that decrypts a legacy
+// openssl-encrypted backup stream using passphrase.
+func NewOpenSSLDecryptingReader(source io.Reader, passphrase string) (io.Reader, error) {
+	header := make([]byte, len(openSSLSaltedMagic)+openSSLSaltSize)
+	if _, err := io.ReadFull(source, header); err != nil {
+		return nil, fmt.Errorf("failed to read openssl header: %w", err)
+	}
+	if string(header[:len(openSSLSaltedMagic)]) != openSSLSaltedMagic {
+		return nil, ErrNotEncrypted
+	}
+	salt := header[len(openSSLSaltedMagic):]
+
+	// PBKDF2-HMAC-SHA256 yields the 32-byte key followed by the 16-byte IV
+	derived, err := pbkdf2.Key(sha256.New, passphrase, salt, openSSLIterations, KeySize+aes.BlockSize)
+	if err != nil {
+		return nil, fmt.Errorf("failed to derive key: %w", err)
+	}
+	block, err := aes.NewCipher(derived[:KeySize])
+	if err != nil {
+		return nil, fmt.Errorf("failed to create cipher: %w", err)
+	}
+
+	return &openSSLDecryptingReader{
+		source: source,
+		mode:   cipher.NewCBCDecrypter(block, derived[KeySize:]),
+	}, nil
+}
+
+// Read implements io.Reader
+func (r *openSSLDecryptingReader) Read(p []byte) (int, error) {
+	for len(r.decrypted) == 0 {
+		if r.eof {
+			return 0, io.EOF
+		}
+		if err := r.fill(); err != nil {
+			return 0, err
+		}
+	}
+	n := copy(p, r.decrypted)
+	r.decrypted = r.decrypted[n:]
+	return n, nil
+}
+
+// fill reads more ciphertext and decrypts every complete block except the
+// last one, which may carry padding.
+func (r *openSSLDecryptingReader) fill() error {
+	chunk := make([]byte, StreamChunkSize)
+	n, err := io.ReadAtLeast(r.source, chunk, aes.BlockSize)
+	r.buf = append(r.buf, chunk[:n]...)
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		r.eof = true
+	} else if err != nil {
+		return fmt.Errorf("failed to read ciphertext: %w", err)
+	}
+
+	if r.eof {
+		if len(r.buf) == 0 || len(r.buf)%aes.BlockSize != 0 {
+			return fmt.Errorf("%w: ciphertext is not a whole number of blocks", ErrTruncated)
+		}
+		plain := make([]byte, len(r.buf))
+		r.mode.CryptBlocks(plain, r.buf)
+		r.buf = nil
+		pad := int(plain[len(plain)-1])
+		if pad == 0 || pad > aes.BlockSize || pad > len(plain) {
+			return fmt.Errorf("failed to decrypt: bad padding (wrong key?)")
+		}
+		for _, b := range plain[len(plain)-pad:] {
+			if int(b) != pad {
+				return fmt.Errorf("failed to decrypt: bad padding (wrong key?)")
+			}
+		}
+		r.decrypted = plain[:len(plain)-pad]
+		return nil
+	}
+
+	// Keep at least one whole block back for padding removal at EOF
+	ready := (len(r.buf)/aes.BlockSize - 1) * aes.BlockSize
+	if ready <= 0 {
+		return nil
+	}
+	plain := make([]byte, ready)
+	r.mode.CryptBlocks(plain, r.buf[:ready])
+	r.buf = append(r.buf[:0], r.buf[ready:]...)
+	r.decrypted = plain
+	return nil
+}
@@ -230,8 +230,8 @@ This sheet contains encryption keys needed to restore encrypted backups.
 
 To restore an encrypted backup without TapeBackarr:
 1. Position tape to the encrypted backup set
-2. Extract with: openssl enc -d -aes-256-gcm -pbkdf2 -pass pass:<key_base64> < /dev/nst0 | tar -xvf -
-   OR use: gpg --decrypt --batch --passphrase <key_base64> < /dev/nst0 | tar -xvf -
+2. Extract with: dd if=/dev/nst0 bs=1M | tapebackarr -decrypt -key <key_base64> | tar -xvf -
+   (no configuration or database is needed for -decrypt)
 3. See MANUAL_RECOVERY.md for detailed instructions
 
 WARNING: Anyone with access to these keys can decrypt your backups.
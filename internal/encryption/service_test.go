@@ -2,8 +2,14 @@ package encryption
 
 import (
 	"bytes"
+	"encoding/base64"
+	"errors"
 	"io"
+	"os/exec"
+	"strings"
 	"testing"
+
+	"github.com/RoseOO/TapeBackarr/internal/models"
 )
 
 func TestEncryptDecrypt(t *testing.T) {
@@ -293,3 +299,200 @@ func TestEncryptDecryptLargeChunks(t *testing.T) {
 		t.Errorf("round-trip failed: expected %d bytes, got %d", len(data), len(decrypted))
 	}
 }
+
+func encryptAll(t *testing.T, data, key []byte) []byte {
+	t.Helper()
+	encReader, err := NewEncryptingReader(bytes.NewReader(data), key)
+	if err != nil {
+		t.Fatalf("NewEncryptingReader: %v", err)
+	}
+	encrypted, err := io.ReadAll(encReader)
+	if err != nil {
+		t.Fatalf("encrypt ReadAll: %v", err)
+	}
+	return encrypted
+}
+
+func TestStreamHeaderCarriesKeyFingerprint(t *testing.T) {
+	key := bytes.Repeat([]byte{7}, KeySize)
+	encrypted := encryptAll(t, []byte("data"), key)
+
+	h, err := ReadStreamHeader(bytes.NewReader(encrypted))
+	if err != nil {
+		t.Fatalf("ReadStreamHeader: %v", err)
+	}
+	if h.Fingerprint() != KeyFingerprint(key) {
+		t.Errorf("header fingerprint %s, want %s", h.Fingerprint(), KeyFingerprint(key))
+	}
+	if h.ChunkSize != StreamChunkSize {
+		t.Errorf("header chunk size %d, want %d", h.ChunkSize, StreamChunkSize)
+	}
+
+	// Two streams with the same key use different salts
+	other, _ := ReadStreamHeader(bytes.NewReader(encryptAll(t, []byte("data"), key)))
+	if other.Salt == h.Salt {
+		t.Error("expected a fresh salt per stream")
+	}
+}
+
+func TestWrongKeyFailsBeforeDecrypting(t *testing.T) {
+	key := bytes.Repeat([]byte{1}, KeySize)
+	wrongKey := bytes.Repeat([]byte{2}, KeySize)
+	encrypted := encryptAll(t, []byte("secret"), key)
+
+	decReader, _ := NewDecryptingReader(bytes.NewReader(encrypted), wrongKey)
+	if _, err := io.ReadAll(decReader); !errors.Is(err, ErrKeyMismatch) {
+		t.Errorf("expected ErrKeyMismatch, got %v", err)
+	}
+
+	_, err := NewBackupDecryptingReader(bytes.NewReader(encrypted), base64.StdEncoding.EncodeToString(wrongKey), nil)
+	if !errors.Is(err, ErrKeyMismatch) {
+		t.Errorf("expected eager ErrKeyMismatch, got %v", err)
+	}
+}
+
+func TestTamperedAndTruncatedStreams(t *testing.T) {
+	key := bytes.Repeat([]byte{3}, KeySize)
+	data := make([]byte, 2*StreamChunkSize+100)
+	for i := range data {
+		data[i] = byte(i % 253)
+	}
+	encrypted := encryptAll(t, data, key)
+
+	tampered := append([]byte(nil), encrypted...)
+	tampered[HeaderSize+100] ^= 0xff
+	decReader, _ := NewDecryptingReader(bytes.NewReader(tampered), key)
+	if _, err := io.ReadAll(decReader); err == nil {
+		t.Error("expected tampered chunk to fail authentication")
+	}
+
+	// Cutting the stream at a chunk boundary must not look like a clean end
+	_, secondChunk := (&StreamHeader{ChunkSize: StreamChunkSize}).ChunkForOffset(StreamChunkSize)
+	decReader, _ = NewDecryptingReader(bytes.NewReader(encrypted[:secondChunk]), key)
+	if _, err := io.ReadAll(decReader); !errors.Is(err, ErrTruncated) {
+		t.Errorf("expected ErrTruncated, got %v", err)
+	}
+
+	// Plaintext that is an exact multiple of the chunk size still round-trips
+	exact := data[:StreamChunkSize]
+	decReader, _ = NewDecryptingReader(bytes.NewReader(encryptAll(t, exact, key)), key)
+	if out, err := io.ReadAll(decReader); err != nil || !bytes.Equal(out, exact) {
+		t.Errorf("exact-chunk round trip failed: %v", err)
+	}
+}
+
+func TestDecryptingReaderAtChunk(t *testing.T) {
+	key := bytes.Repeat([]byte{4}, KeySize)
+	data := make([]byte, 3*StreamChunkSize+42)
+	for i := range data {
+		data[i] = byte(i % 241)
+	}
+	encrypted := encryptAll(t, data, key)
+
+	h, err := ReadStreamHeader(bytes.NewReader(encrypted))
+	if err != nil {
+		t.Fatalf("ReadStreamHeader: %v", err)
+	}
+
+	plainOffset := int64(2*StreamChunkSize + 10)
+	index, encOffset := h.ChunkForOffset(plainOffset)
+	if index != 2 {
+		t.Fatalf("expected chunk 2, got %d", index)
+	}
+
+	decReader, err := NewDecryptingReaderAt(bytes.NewReader(encrypted[encOffset:]), key, h, index)
+	if err != nil {
+		t.Fatalf("NewDecryptingReaderAt: %v", err)
+	}
+	out, err := io.ReadAll(decReader)
+	if err != nil {
+		t.Fatalf("ReadAll: %v", err)
+	}
+	if !bytes.Equal(out, data[index*StreamChunkSize:]) {
+		t.Errorf("random access read returned %d bytes, want %d", len(out), len(data)-int(index)*StreamChunkSize)
+	}
+}
+
+func TestLegacyOpenSSLStream(t *testing.T) {
+	if _, err := exec.LookPath("openssl"); err != nil {
+		t.Skip("openssl not available")
+	}
+
+	keyBase64 := base64.StdEncoding.EncodeToString(bytes.Repeat([]byte{5}, KeySize))
+	data := make([]byte, StreamChunkSize+333)
+	for i := range data {
+		data[i] = byte(i % 199)
+	}
+
+	cmd := exec.Command("openssl", "enc", "-aes-256-cbc", "-salt", "-pbkdf2", "-iter", "100000", "-pass", "pass:"+keyBase64)
+	cmd.Stdin = bytes.NewReader(data)
+	encrypted, err := cmd.Output()
+	if err != nil {
+		t.Fatalf("openssl enc failed: %v", err)
+	}
+
+	decReader, err := NewBackupDecryptingReader(bytes.NewReader(encrypted), keyBase64, nil)
+	if err != nil {
+		t.Fatalf("NewBackupDecryptingReader: %v", err)
+	}
+	out, err := io.ReadAll(decReader)
+	if err != nil {
+		t.Fatalf("ReadAll: %v", err)
+	}
+	if !bytes.Equal(out, data) {
+		t.Errorf("legacy decryption returned %d bytes, want %d", len(out), len(data))
+	}
+}
+
+func TestStreamMetadataRecordsHeader(t *testing.T) {
+	key := bytes.Repeat([]byte{5}, KeySize)
+	keyBase64 := base64.StdEncoding.EncodeToString(key)
+	encrypted := encryptAll(t, []byte("metadata"), key)
+
+	h, err := ReadStreamHeader(bytes.NewReader(encrypted))
+	if err != nil {
+		t.Fatalf("ReadStreamHeader: %v", err)
+	}
+	meta := h.Metadata()
+	if meta.Format != models.EncryptionFormatStreamV2 || meta.KDF.Algorithm != "hkdf-sha256" {
+		t.Errorf("unexpected metadata: %+v", meta)
+	}
+	if len(meta.Salt) != 2*saltSize || len(meta.IV) != 2*NonceSize || meta.ChunkSize != StreamChunkSize {
+		t.Errorf("unexpected salt/IV/chunk size: %+v", meta)
+	}
+
+	// Round trip through the catalog columns
+	stored := models.ParseEncryptionMetadata(string(meta.Format), meta.KDFJSON(), meta.Salt, meta.IV, meta.ChunkSize)
+	if *stored != *meta {
+		t.Errorf("catalog round trip changed metadata: %+v != %+v", stored, meta)
+	}
+
+	dec, err := NewBackupDecryptingReader(bytes.NewReader(encrypted), keyBase64, stored)
+	if err != nil {
+		t.Fatalf("NewBackupDecryptingReader with matching metadata: %v", err)
+	}
+	if got, err := io.ReadAll(dec); err != nil || string(got) != "metadata" {
+		t.Errorf("decrypted %q, %v", got, err)
+	}
+
+	// A stream from another backup set with the same key is rejected
+	other := encryptAll(t, []byte("metadata"), key)
+	if _, err := NewBackupDecryptingReader(bytes.NewReader(other), keyBase64, stored); !errors.Is(err, ErrMetadataMismatch) {
+		t.Errorf("expected ErrMetadataMismatch, got %v", err)
+	}
+
+	// LTFS metadata never matches a tar stream
+	if err := VerifyMetadata(LTFSFileMetadata(), h); !errors.Is(err, ErrMetadataMismatch) {
+		t.Errorf("expected format mismatch, got %v", err)
+	}
+}
+
+func TestUnsupportedKDFRejected(t *testing.T) {
+	key := bytes.Repeat([]byte{6}, KeySize)
+	encrypted := encryptAll(t, []byte("data"), key)
+	encrypted[len(MagicHeader)] = 9
+
+	if _, err := ReadStreamHeader(bytes.NewReader(encrypted)); err == nil || !strings.Contains(err.Error(), "unsupported key derivation") {
+		t.Errorf("expected unsupported key derivation error, got %v", err)
+	}
+}
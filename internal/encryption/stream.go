@@ -1,115 +1,298 @@
 package encryption
 
 import (
+	"bufio"
+	"bytes"
 	"crypto/aes"
 	"crypto/cipher"
+	"crypto/hkdf"
 	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
 	"fmt"
 	"io"
+	"strings"
+
+	"github.com/RoseOO/TapeBackarr/internal/models"
 )
 
+// Stream format (version 2)
+//
+//	header: MagicHeader | KDF id (1) | chunk size (uint32) | key fingerprint (32) | salt (32) | IV (12)
+//	chunks: length (uint32, top bit = final chunk) | AES-256-GCM ciphertext+tag
+//
+// Each stream encrypts with its own subkey derived from the key and the
+// random salt by the KDF named in the header. The nonce of chunk i is the
+// first four bytes of the random starting IV followed by the IV's trailing
+// 64-bit counter plus i. Everything needed to decrypt is in the header, so
+// restores never depend on defaults compiled into a particular release.
+// Every chunk authenticates the header, its index and whether it is the
+// final chunk, which detects tampering, reordering and truncation. All
+// chunks except the last hold exactly ChunkSize plaintext bytes, so the
+// encrypted offset of any plaintext offset can be computed for random access.
 const (
 	// StreamChunkSize is the size of each encryption chunk (1MB to match the
 	// default LTO block size and minimize per-chunk GCM overhead).
 	StreamChunkSize = 1024 * 1024
+	// KeySize is the size of an AES-256 key (32 bytes)
+	KeySize = 32
 	// NonceSize is the size of the GCM nonce (12 bytes)
 	NonceSize = 12
 	// TagSize is the size of the GCM authentication tag (16 bytes)
 	TagSize = 16
-	// ChunkOverhead is the nonce + tag size added to each encrypted chunk
-	ChunkOverhead = NonceSize + TagSize
+	// ChunkOverhead is the length prefix + tag size added to each encrypted chunk
+	ChunkOverhead = 4 + TagSize
 	// MagicHeader identifies encrypted streams
-	MagicHeader = "TAPEBACKARR_ENC_V1"
+	MagicHeader = "TAPEBACKARR_ENC_V2"
+	// HeaderSize is the size of the stream header
+	HeaderSize = len(MagicHeader) + 1 + 4 + sha256.Size + saltSize + NonceSize
+
+	// KDFHKDFSHA256 identifies HKDF-SHA256 subkey derivation in the header.
+	KDFHKDFSHA256 = byte(1)
+
+	saltSize      = 32
+	finalFlag     = uint32(1) << 31
+	maxChunkSize  = 64 * 1024 * 1024
+	subkeyContext = "tapebackarr stream v2"
 )
 
+var (
+	// ErrNotEncrypted is returned when a stream does not start with a
+	// recognised encryption header.
+	ErrNotEncrypted = errors.New("invalid encryption header: not an encrypted backup")
+	// ErrKeyMismatch is returned before any data is decrypted when the
+	// stream was encrypted with a different key.
+	ErrKeyMismatch = errors.New("encryption key does not match the key used for this backup")
+	// ErrTruncated is returned when a stream ends before its final chunk.
+	ErrTruncated = errors.New("encrypted stream is truncated")
+)
+
+// KeyFingerprint returns the hex SHA-256 fingerprint of a raw key, matching
+// the key_fingerprint stored for keys in the keystore.
+func KeyFingerprint(key []byte) string {
+	sum := sha256.Sum256(key)
+	return hex.EncodeToString(sum[:])
+}
+
+// DecodeKey decodes a base64 keystore key into raw AES-256 key bytes.
+func DecodeKey(keyBase64 string) ([]byte, error) {
+	key, err := base64.StdEncoding.DecodeString(keyBase64)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode key: %w", err)
+	}
+	if len(key) != KeySize {
+		return nil, fmt.Errorf("invalid key length: expected %d bytes, got %d", KeySize, len(key))
+	}
+	return key, nil
+}
+
+// NormalizeKey accepts a key as pasted from the key sheet or read from a key
+// file, where the base64 may be wrapped across lines, and returns it in
+// canonical base64 form.
+func NormalizeKey(input string) (string, error) {
+	key, err := DecodeKey(strings.Join(strings.Fields(input), ""))
+	if err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(key), nil
+}
+
+// StreamHeader is the parsed header of an encrypted stream.
+type StreamHeader struct {
+	KDF            byte
+	ChunkSize      uint32
+	KeyFingerprint [sha256.Size]byte
+	Salt           [saltSize]byte
+	IV             [NonceSize]byte
+}
+
+// Fingerprint returns the hex fingerprint of the key the stream was
+// encrypted with.
+func (h *StreamHeader) Fingerprint() string {
+	return hex.EncodeToString(h.KeyFingerprint[:])
+}
+
+// ChunkForOffset returns the index of the chunk holding the given plaintext
+// offset and the offset of that chunk in the encrypted stream. A reader
+// positioned there can be passed to NewDecryptingReaderAt.
+func (h *StreamHeader) ChunkForOffset(plainOffset int64) (index, encOffset int64) {
+	index = plainOffset / int64(h.ChunkSize)
+	return index, int64(HeaderSize) + index*int64(int(h.ChunkSize)+ChunkOverhead)
+}
+
+// MarshalBinary encodes the header as written at the start of a stream.
+func (h *StreamHeader) MarshalBinary() ([]byte, error) {
+	buf := make([]byte, 0, HeaderSize)
+	buf = append(buf, MagicHeader...)
+	buf = append(buf, h.KDF)
+	buf = binary.BigEndian.AppendUint32(buf, h.ChunkSize)
+	buf = append(buf, h.KeyFingerprint[:]...)
+	buf = append(buf, h.Salt[:]...)
+	buf = append(buf, h.IV[:]...)
+	return buf, nil
+}
+
+// ReadStreamHeader reads and validates the header at the start of a stream.
+func ReadStreamHeader(r io.Reader) (*StreamHeader, error) {
+	buf := make([]byte, HeaderSize)
+	if _, err := io.ReadFull(r, buf); err != nil {
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return nil, ErrNotEncrypted
+		}
+		return nil, fmt.Errorf("failed to read encryption header: %w", err)
+	}
+	if !IsEncryptedStream(buf) {
+		return nil, ErrNotEncrypted
+	}
+
+	h := &StreamHeader{}
+	off := len(MagicHeader)
+	h.KDF = buf[off]
+	off++
+	h.ChunkSize = binary.BigEndian.Uint32(buf[off:])
+	off += 4
+	copy(h.KeyFingerprint[:], buf[off:])
+	off += sha256.Size
+	copy(h.Salt[:], buf[off:])
+	off += saltSize
+	copy(h.IV[:], buf[off:])
+
+	if h.KDF != KDFHKDFSHA256 {
+		return nil, fmt.Errorf("invalid encryption header: unsupported key derivation %d", h.KDF)
+	}
+	if h.ChunkSize == 0 || h.ChunkSize > maxChunkSize {
+		return nil, fmt.Errorf("invalid encryption header: chunk size %d", h.ChunkSize)
+	}
+	return h, nil
+}
+
+// streamCipher holds the per-stream AEAD and the authenticated header.
+type streamCipher struct {
+	gcm    cipher.AEAD
+	header []byte
+	iv     [NonceSize]byte
+	nonce  [NonceSize]byte
+	aad    []byte
+}
+
+func newStreamCipher(key []byte, h *StreamHeader) (*streamCipher, error) {
+	if len(key) != KeySize {
+		return nil, fmt.Errorf("invalid key length: expected %d bytes, got %d", KeySize, len(key))
+	}
+	subkey, err := hkdf.Key(sha256.New, key, h.Salt[:], subkeyContext, KeySize)
+	if err != nil {
+		return nil, fmt.Errorf("failed to derive stream key: %w", err)
+	}
+	block, err := aes.NewCipher(subkey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create cipher: %w", err)
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create GCM: %w", err)
+	}
+	header, _ := h.MarshalBinary()
+	c := &streamCipher{gcm: gcm, header: header, iv: h.IV}
+	copy(c.nonce[:NonceSize-8], h.IV[:NonceSize-8])
+	return c, nil
+}
+
+// chunkParams sets the nonce and additional data for chunk index.
+func (c *streamCipher) chunkParams(index uint64, final bool) ([]byte, []byte) {
+	counter := binary.BigEndian.Uint64(c.iv[NonceSize-8:]) + index
+	binary.BigEndian.PutUint64(c.nonce[NonceSize-8:], counter)
+	c.aad = append(c.aad[:0], c.header...)
+	c.aad = binary.BigEndian.AppendUint64(c.aad, index)
+	if final {
+		c.aad = append(c.aad, 1)
+	} else {
+		c.aad = append(c.aad, 0)
+	}
+	return c.nonce[:], c.aad
+}
+
 // EncryptingReader wraps an io.Reader and encrypts data as it's read
 type EncryptingReader struct {
-	source     io.Reader
-	gcm        cipher.AEAD
-	buffer     []byte
-	encrypted  []byte
-	eof        bool
-	headerSent bool
-	headerBuf  []byte // Buffer for partial header sends
+	source    *bufio.Reader
+	cipher    *streamCipher
+	header    *StreamHeader
+	buffer    []byte
+	encrypted []byte
+	index     uint64
+	done      bool
 }
 
 // NewEncryptingReader creates a new encrypting reader
 func NewEncryptingReader(source io.Reader, key []byte) (*EncryptingReader, error) {
-	block, err := aes.NewCipher(key)
-	if err != nil {
-		return nil, fmt.Errorf("failed to create cipher: %w", err)
+	h := &StreamHeader{KDF: KDFHKDFSHA256, ChunkSize: StreamChunkSize}
+	h.KeyFingerprint = sha256.Sum256(key)
+	if _, err := rand.Read(h.Salt[:]); err != nil {
+		return nil, fmt.Errorf("failed to generate salt: %w", err)
+	}
+	if _, err := rand.Read(h.IV[:]); err != nil {
+		return nil, fmt.Errorf("failed to generate IV: %w", err)
 	}
 
-	gcm, err := cipher.NewGCM(block)
+	c, err := newStreamCipher(key, h)
 	if err != nil {
-		return nil, fmt.Errorf("failed to create GCM: %w", err)
+		return nil, err
 	}
 
 	return &EncryptingReader{
-		source:     source,
-		gcm:        gcm,
-		buffer:     make([]byte, StreamChunkSize),
-		encrypted:  nil,
-		eof:        false,
-		headerSent: false,
-		headerBuf:  []byte(MagicHeader),
+		source:    bufio.NewReaderSize(source, StreamChunkSize),
+		cipher:    c,
+		header:    h,
+		buffer:    make([]byte, StreamChunkSize),
+		encrypted: append([]byte(nil), c.header...),
 	}, nil
 }
 
+// Header returns the header written at the start of the stream.
+func (r *EncryptingReader) Header() *StreamHeader {
+	return r.header
+}
+
 // Read implements io.Reader
 func (r *EncryptingReader) Read(p []byte) (int, error) {
-	// First, send the magic header
-	if len(r.headerBuf) > 0 {
-		n := copy(p, r.headerBuf)
-		r.headerBuf = r.headerBuf[n:]
-		if len(r.headerBuf) == 0 {
-			r.headerSent = true
-		}
-		return n, nil
-	}
-
-	// If we have encrypted data in buffer, return it
+	// Return buffered header or ciphertext first
 	if len(r.encrypted) > 0 {
 		n := copy(p, r.encrypted)
 		r.encrypted = r.encrypted[n:]
 		return n, nil
 	}
 
-	if r.eof {
+	if r.done {
 		return 0, io.EOF
 	}
 
 	// Read a chunk from source
 	n, err := io.ReadFull(r.source, r.buffer)
+	final := false
 	if err == io.EOF || err == io.ErrUnexpectedEOF {
-		r.eof = true
-		if n == 0 {
-			return 0, io.EOF
-		}
+		final = true
 	} else if err != nil {
 		return 0, err
+	} else if _, peekErr := r.source.Peek(1); peekErr == io.EOF {
+		// A full chunk that ends the source is still the final chunk
+		final = true
+	} else if peekErr != nil {
+		return 0, peekErr
 	}
 
-	// Generate nonce
-	nonce := make([]byte, r.gcm.NonceSize())
-	if _, err := rand.Read(nonce); err != nil {
-		return 0, fmt.Errorf("failed to generate nonce: %w", err)
-	}
-
-	// Encrypt the chunk
-	ciphertext := r.gcm.Seal(nil, nonce, r.buffer[:n], nil)
-
-	// Prepend chunk size (4 bytes big-endian) + nonce
-	chunkSize := make([]byte, 4)
-	size := uint32(len(ciphertext))
-	chunkSize[0] = byte(size >> 24)
-	chunkSize[1] = byte(size >> 16)
-	chunkSize[2] = byte(size >> 8)
-	chunkSize[3] = byte(size)
+	nonce, aad := r.cipher.chunkParams(r.index, final)
+	ciphertext := r.cipher.gcm.Seal(nil, nonce, r.buffer[:n], aad)
+	r.index++
+	r.done = final
 
-	r.encrypted = make([]byte, 0, 4+NonceSize+len(ciphertext))
-	r.encrypted = append(r.encrypted, chunkSize...)
-	r.encrypted = append(r.encrypted, nonce...)
+	length := uint32(len(ciphertext))
+	if final {
+		length |= finalFlag
+	}
+	r.encrypted = make([]byte, 0, 4+len(ciphertext))
+	r.encrypted = binary.BigEndian.AppendUint32(r.encrypted, length)
 	r.encrypted = append(r.encrypted, ciphertext...)
 
 	// Return what fits in p
@@ -120,46 +303,68 @@ func (r *EncryptingReader) Read(p []byte) (int, error) {
 
 // DecryptingReader wraps an io.Reader and decrypts data as it's read
 type DecryptingReader struct {
-	source     io.Reader
-	gcm        cipher.AEAD
-	decrypted  []byte
-	eof        bool
-	headerRead bool
+	source    io.Reader
+	key       []byte
+	cipher    *streamCipher
+	header    *StreamHeader
+	decrypted []byte
+	index     uint64
+	done      bool
 }
 
-// NewDecryptingReader creates a new decrypting reader
+// NewDecryptingReader creates a new decrypting reader. The header is read
+// and the key fingerprint checked on the first Read, so a wrong key fails
+// with ErrKeyMismatch before any ciphertext is processed.
 func NewDecryptingReader(source io.Reader, key []byte) (*DecryptingReader, error) {
-	block, err := aes.NewCipher(key)
-	if err != nil {
-		return nil, fmt.Errorf("failed to create cipher: %w", err)
+	if len(key) != KeySize {
+		return nil, fmt.Errorf("invalid key length: expected %d bytes, got %d", KeySize, len(key))
 	}
+	return &DecryptingReader{source: source, key: key}, nil
+}
 
-	gcm, err := cipher.NewGCM(block)
+// NewDecryptingReaderAt creates a decrypting reader that starts at chunk
+// index of a stream whose header was already read. source must be
+// positioned at the chunk's encrypted offset (see StreamHeader.ChunkForOffset).
+func NewDecryptingReaderAt(source io.Reader, key []byte, h *StreamHeader, index int64) (*DecryptingReader, error) {
+	if err := checkFingerprint(h, key); err != nil {
+		return nil, err
+	}
+	c, err := newStreamCipher(key, h)
 	if err != nil {
-		return nil, fmt.Errorf("failed to create GCM: %w", err)
+		return nil, err
 	}
+	return &DecryptingReader{source: source, key: key, cipher: c, header: h, index: uint64(index)}, nil
+}
 
-	return &DecryptingReader{
-		source:     source,
-		gcm:        gcm,
-		decrypted:  nil,
-		eof:        false,
-		headerRead: false,
-	}, nil
+// Header returns the stream header once it has been read.
+func (r *DecryptingReader) Header() *StreamHeader {
+	return r.header
+}
+
+func checkFingerprint(h *StreamHeader, key []byte) error {
+	if h.KeyFingerprint != sha256.Sum256(key) {
+		return fmt.Errorf("%w (backup key fingerprint %s)", ErrKeyMismatch, h.Fingerprint())
+	}
+	return nil
 }
 
 // Read implements io.Reader
 func (r *DecryptingReader) Read(p []byte) (int, error) {
-	// First, verify the magic header
-	if !r.headerRead {
-		header := make([]byte, len(MagicHeader))
-		if _, err := io.ReadFull(r.source, header); err != nil {
-			return 0, fmt.Errorf("failed to read encryption header: %w", err)
+	// First, read and verify the header
+	if r.cipher == nil {
+		h, err := ReadStreamHeader(r.source)
+		if err != nil {
+			return 0, err
 		}
-		if string(header) != MagicHeader {
-			return 0, fmt.Errorf("invalid encryption header: not an encrypted backup")
+		if err := checkFingerprint(h, r.key); err != nil {
+			return 0, err
 		}
-		r.headerRead = true
+		c, err := newStreamCipher(r.key, h)
+		if err != nil {
+			return 0, err
+		}
+		r.header = h
+		r.cipher = c
 	}
 
 	// If we have decrypted data in buffer, return it
@@ -169,45 +374,45 @@ func (r *DecryptingReader) Read(p []byte) (int, error) {
 		return n, nil
 	}
 
-	if r.eof {
+	if r.done {
 		return 0, io.EOF
 	}
 
-	// Read chunk size (4 bytes)
-	sizeBuf := make([]byte, 4)
-	_, err := io.ReadFull(r.source, sizeBuf)
-	if err == io.EOF {
-		r.eof = true
-		return 0, io.EOF
-	} else if err != nil {
+	// Read chunk length (4 bytes)
+	var sizeBuf [4]byte
+	if _, err := io.ReadFull(r.source, sizeBuf[:]); err != nil {
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return 0, fmt.Errorf("%w after chunk %d", ErrTruncated, r.index)
+		}
 		return 0, fmt.Errorf("failed to read chunk size: %w", err)
 	}
+	length := binary.BigEndian.Uint32(sizeBuf[:])
+	final := length&finalFlag != 0
+	length &^= finalFlag
 
-	chunkSize := uint32(sizeBuf[0])<<24 | uint32(sizeBuf[1])<<16 | uint32(sizeBuf[2])<<8 | uint32(sizeBuf[3])
-
-	// Validate chunk size
-	if chunkSize > StreamChunkSize+ChunkOverhead+1024 {
-		return 0, fmt.Errorf("chunk size too large: %d", chunkSize)
-	}
-
-	// Read nonce
-	nonce := make([]byte, NonceSize)
-	if _, err := io.ReadFull(r.source, nonce); err != nil {
-		return 0, fmt.Errorf("failed to read nonce: %w", err)
+	// Validate chunk size: only the final chunk may be shorter
+	full := r.header.ChunkSize + TagSize
+	if length > full || (!final && length != full) || length < TagSize {
+		return 0, fmt.Errorf("invalid chunk %d: size %d", r.index, length)
 	}
 
 	// Read ciphertext
-	ciphertext := make([]byte, chunkSize)
+	ciphertext := make([]byte, length)
 	if _, err := io.ReadFull(r.source, ciphertext); err != nil {
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return 0, fmt.Errorf("%w in chunk %d", ErrTruncated, r.index)
+		}
 		return 0, fmt.Errorf("failed to read ciphertext: %w", err)
 	}
 
-	// Decrypt
-	plaintext, err := r.gcm.Open(nil, nonce, ciphertext, nil)
+	// Decrypt and authenticate
+	nonce, aad := r.cipher.chunkParams(r.index, final)
+	plaintext, err := r.cipher.gcm.Open(ciphertext[:0], nonce, ciphertext, aad)
 	if err != nil {
-		return 0, fmt.Errorf("failed to decrypt chunk: %w", err)
+		return 0, fmt.Errorf("failed to decrypt chunk %d: %w", r.index, err)
 	}
-
+	r.index++
+	r.done = final
 	r.decrypted = plaintext
 
 	// Return what fits in p
@@ -224,3 +429,41 @@ func IsEncryptedStream(header []byte) bool {
 	}
 	return string(header[:len(MagicHeader)]) == MagicHeader
 }
+
+// NewBackupDecryptingReader returns a reader that decrypts a backup stream
+// written by any TapeBackarr version. Streams in the native format are
+// decrypted with the raw key; older streams written by `openssl enc` are
+// recognised by their "Salted__" prefix and decrypted with the base64 key
+// as the passphrase, exactly as they were encrypted. The header is read
+// immediately, so a wrong key is reported before any data is extracted.
+// When expected is non-nil the header must also match the metadata recorded
+// in the catalog for the backup set.
+func NewBackupDecryptingReader(source io.Reader, keyBase64 string, expected *models.EncryptionMetadata) (io.Reader, error) {
+	br := bufio.NewReader(source)
+	prefix, err := br.Peek(len(MagicHeader))
+	if err != nil && len(prefix) < len(openSSLSaltedMagic) {
+		if err == io.EOF {
+			return nil, ErrNotEncrypted
+		}
+		return nil, fmt.Errorf("failed to read encryption header: %w", err)
+	}
+
+	if bytes.HasPrefix(prefix, []byte(openSSLSaltedMagic)) {
+		if expected != nil && expected.Format != models.EncryptionFormatOpenSSLCBC {
+			return nil, fmt.Errorf("%w: catalog records format %s, tape has %s", ErrMetadataMismatch, expected.Format, models.EncryptionFormatOpenSSLCBC)
+		}
+		return NewOpenSSLDecryptingReader(br, keyBase64)
+	}
+	key, err := DecodeKey(keyBase64)
+	if err != nil {
+		return nil, err
+	}
+	h, err := ReadStreamHeader(br)
+	if err != nil {
+		return nil, err
+	}
+	if err := VerifyMetadata(expected, h); err != nil {
+		return nil, err
+	}
+	return NewDecryptingReaderAt(br, key, h, 0)
+}
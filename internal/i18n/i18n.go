@@ -0,0 +1,106 @@
+// Package i18n holds the message catalog used for notifications, Telegram
+// command replies and system events. Catalogs are flat key/format-string maps
+// embedded from locales/<lang>.json; English is the reference catalog and the
+// fallback for any key a translation is missing.
+package i18n
+
+import (
+	"embed"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Lang is a supported catalog language code
+type Lang string
+
+const (
+	English Lang = "en"
+	German  Lang = "de"
+	French  Lang = "fr"
+
+	// Default is used when no language is configured or a request names an
+	// unsupported one
+	Default = English
+)
+
+//go:embed locales/*.json
+var localeFS embed.FS
+
+var catalogs = loadCatalogs()
+
+func loadCatalogs() map[Lang]map[string]string {
+	entries, err := localeFS.ReadDir("locales")
+	if err != nil {
+		panic(fmt.Sprintf("i18n: reading locales: %v", err))
+	}
+	out := make(map[Lang]map[string]string, len(entries))
+	for _, e := range entries {
+		data, err := localeFS.ReadFile("locales/" + e.Name())
+		if err != nil {
+			panic(fmt.Sprintf("i18n: reading %s: %v", e.Name(), err))
+		}
+		var messages map[string]string
+		if err := json.Unmarshal(data, &messages); err != nil {
+			panic(fmt.Sprintf("i18n: parsing %s: %v", e.Name(), err))
+		}
+		out[Lang(strings.TrimSuffix(e.Name(), ".json"))] = messages
+	}
+	return out
+}
+
+// Languages returns the supported language codes, sorted
+func Languages() []Lang {
+	langs := make([]Lang, 0, len(catalogs))
+	for l := range catalogs {
+		langs = append(langs, l)
+	}
+	sort.Slice(langs, func(i, j int) bool { return langs[i] < langs[j] })
+	return langs
+}
+
+// Parse maps a language tag such as "de", "de-CH" or "FR_fr" to a supported
+// language. It reports false if the language has no catalog.
+func Parse(tag string) (Lang, bool) {
+	tag = strings.ToLower(strings.TrimSpace(tag))
+	if i := strings.IndexAny(tag, "-_"); i >= 0 {
+		tag = tag[:i]
+	}
+	if _, ok := catalogs[Lang(tag)]; !ok || tag == "" {
+		return "", false
+	}
+	return Lang(tag), true
+}
+
+// Normalize is Parse with a fallback to Default
+func Normalize(tag string) Lang {
+	if l, ok := Parse(tag); ok {
+		return l
+	}
+	return Default
+}
+
+// Has reports whether key exists in the reference (English) catalog
+func Has(key string) bool {
+	_, ok := catalogs[English][key]
+	return ok
+}
+
+// T renders key in lang, formatting it with args. A format without verbs is
+// returned as is, so a title and message can share one argument list; formats
+// that use only some of the arguments must index them explicitly (%[2]s).
+// Missing translations fall back to English and unknown keys render as the
+// key itself so a typo shows up in the UI instead of an empty string.
+func T(lang Lang, key string, args ...interface{}) string {
+	format, ok := catalogs[lang][key]
+	if !ok {
+		if format, ok = catalogs[English][key]; !ok {
+			return key
+		}
+	}
+	if len(args) == 0 || !strings.Contains(format, "%") {
+		return format
+	}
+	return fmt.Sprintf(format, args...)
+}
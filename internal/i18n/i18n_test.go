@@ -0,0 +1,111 @@
+package i18n
+
+import (
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+var verbPattern = regexp.MustCompile(`%(\[\d+\])?[-+# 0*]*[\d.]*[a-zA-Z%]`)
+
+// argVerbs maps each argument position a format consumes to its verb, so
+// translations may reorder arguments with explicit indexes but not change
+// what they expect.
+func argVerbs(format string) []string {
+	var out []string
+	next := 1
+	for _, m := range verbPattern.FindAllStringSubmatch(format, -1) {
+		verb := m[0][len(m[0])-1:]
+		if verb == "%" {
+			continue
+		}
+		if m[1] != "" {
+			next, _ = strconv.Atoi(strings.Trim(m[1], "[]"))
+		}
+		if strings.Contains(m[0], "*") {
+			out = append(out, strconv.Itoa(next)+":*")
+			next++
+		}
+		out = append(out, strconv.Itoa(next)+":"+verb)
+		next++
+	}
+	sort.Strings(out)
+	return out
+}
+
+func TestCatalogsComplete(t *testing.T) {
+	en := catalogs[English]
+	if len(en) == 0 {
+		t.Fatal("English catalog is empty")
+	}
+	for _, lang := range []Lang{German, French} {
+		cat, ok := catalogs[lang]
+		if !ok {
+			t.Fatalf("missing catalog %s", lang)
+		}
+		for key, format := range en {
+			translated, ok := cat[key]
+			if !ok {
+				t.Errorf("%s: missing key %s", lang, key)
+				continue
+			}
+			if got, want := strings.Join(argVerbs(translated), ","), strings.Join(argVerbs(format), ","); got != want {
+				t.Errorf("%s: %s uses arguments %q, English uses %q", lang, key, got, want)
+			}
+		}
+		for key := range cat {
+			if _, ok := en[key]; !ok {
+				t.Errorf("%s: key %s is not in the English catalog", lang, key)
+			}
+		}
+	}
+}
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		in   string
+		want Lang
+		ok   bool
+	}{
+		{"de", German, true},
+		{"DE-ch", German, true},
+		{"fr_FR", French, true},
+		{" en ", English, true},
+		{"es", "", false},
+		{"", "", false},
+	}
+	for _, tt := range tests {
+		got, ok := Parse(tt.in)
+		if got != tt.want || ok != tt.ok {
+			t.Errorf("Parse(%q) = %q, %v; want %q, %v", tt.in, got, ok, tt.want, tt.ok)
+		}
+	}
+	if Normalize("xx") != Default {
+		t.Error("expected unsupported languages to normalize to the default")
+	}
+}
+
+func TestT(t *testing.T) {
+	if got := T(German, "notify.tape_full.title"); got != "Band voll" {
+		t.Errorf("unexpected German title %q", got)
+	}
+	if got := T(French, "telegram.status.tapes", 3, 1); got != "Bandes : 3 au total, 1 actives" {
+		t.Errorf("unexpected French status %q", got)
+	}
+	if got := T("xx", "notify.tape_full.title"); got != "Tape Full" {
+		t.Errorf("expected English fallback, got %q", got)
+	}
+	if got := T(English, "no.such.key"); got != "no.such.key" {
+		t.Errorf("expected unknown key to render as itself, got %q", got)
+	}
+	// A title without verbs shares the message's arguments without
+	// picking up %!(EXTRA ...) noise
+	if got := T(English, "event.tape_added.title", "LTO-001"); got != "Tape Added" {
+		t.Errorf("unexpected title %q", got)
+	}
+	if got := T(English, "event.backup_progress.title", "scanning", "Scanning files..."); got != "Backup: scanning" {
+		t.Errorf("unexpected indexed title %q", got)
+	}
+}
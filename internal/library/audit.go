@@ -0,0 +1,182 @@
+package library
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+)
+
+// ErrNotInventoried is returned when a library is audited before its first
+// inventory, so there are no slot records to compare with
+var ErrNotInventoried = errors.New("library has not been inventoried")
+
+// Discrepancy kinds found by a slot audit
+const (
+	// DiscrepancyMissing is a tape the slot records place in the library
+	// that the changer does not report
+	DiscrepancyMissing = "missing"
+	// DiscrepancyUnexpected is a tape the changer reports where the slot
+	// records have none
+	DiscrepancyUnexpected = "unexpected"
+	// DiscrepancyMoved is a tape the changer reports in another element
+	// than the slot records
+	DiscrepancyMoved = "moved"
+)
+
+// Element is a storage slot, drive or import/export slot of a library
+type Element struct {
+	Type   string `json:"slot_type"`
+	Number int    `json:"slot_number"`
+}
+
+// String describes the element in messages
+func (e Element) String() string {
+	switch e.Type {
+	case "drive":
+		return fmt.Sprintf("drive %d", e.Number)
+	case "import_export":
+		return fmt.Sprintf("I/E slot %d", e.Number)
+	}
+	return fmt.Sprintf("slot %d", e.Number)
+}
+
+// Discrepancy is a difference between the changer's inventory and the slot
+// records
+type Discrepancy struct {
+	Kind string `json:"kind"`
+	// Barcode is empty for a full element whose tape has no readable barcode
+	Barcode string `json:"barcode"`
+	// TapeID is the tape with the barcode, 0 when no tape has it
+	TapeID int64 `json:"tape_id,omitempty"`
+	// Expected is where the slot records place the tape, nil for
+	// unexpected tapes
+	Expected *Element `json:"expected,omitempty"`
+	// Found is where the changer reports the tape, nil for missing tapes
+	Found *Element `json:"found,omitempty"`
+}
+
+// AuditResult is the outcome of a slot audit
+type AuditResult struct {
+	LibraryID     int64         `json:"library_id"`
+	LibraryName   string        `json:"library_name"`
+	Elements      int           `json:"elements"`
+	Discrepancies []Discrepancy `json:"discrepancies"`
+}
+
+// Audit compares the changer's inventory from mtx status with the slot
+// records of the last inventory and the moves made since. Tapes are matched
+// by barcode; a full element without a barcode is only reported when the
+// records have it empty. The records are left as they are: running an
+// inventory accepts what the changer reports.
+func (l *Loader) Audit(ctx context.Context, libraryID int64) (*AuditResult, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	result := &AuditResult{LibraryID: libraryID, Discrepancies: []Discrepancy{}}
+	var changer string
+	var inventoried bool
+	if err := l.db.QueryRow("SELECT name, device_path, last_inventory_at IS NOT NULL FROM tape_libraries WHERE id = ?",
+		libraryID).Scan(&result.LibraryName, &changer, &inventoried); err != nil {
+		return nil, err
+	}
+	if !inventoried {
+		return nil, ErrNotInventoried
+	}
+	if err := l.CheckChanger(changer); err != nil {
+		return nil, err
+	}
+
+	output, err := l.mtx(ctx, changer, "status")
+	if err != nil {
+		return nil, fmt.Errorf("mtx status failed: %s - %s", err.Error(), string(output))
+	}
+	type reported struct {
+		element Element
+		barcode string
+	}
+	var full []reported
+	foundAt := make(map[string]Element)
+	for _, slot := range ParseStatus(string(output)) {
+		number, err := strconv.Atoi(slot["slot_number"])
+		if err != nil {
+			continue
+		}
+		result.Elements++
+		if slot["is_empty"] == "true" {
+			continue
+		}
+		e := Element{Type: slot["slot_type"], Number: number}
+		full = append(full, reported{e, slot["barcode"]})
+		if slot["barcode"] != "" {
+			foundAt[slot["barcode"]] = e
+		}
+	}
+
+	// A slot filled by a load records the tape, an inventoried one the
+	// barcode
+	rows, err := l.db.Query(`
+		SELECT ls.slot_type, ls.slot_number, COALESCE(NULLIF(ls.barcode, ''), t.barcode, ''), ls.is_empty
+		FROM tape_library_slots ls
+		LEFT JOIN tapes t ON t.id = ls.tape_id
+		WHERE ls.library_id = ?
+		ORDER BY ls.slot_type, ls.slot_number
+	`, libraryID)
+	if err != nil {
+		return nil, err
+	}
+	var recorded []reported
+	expectedAt := make(map[string]Element)
+	recordedFull := make(map[Element]bool)
+	for rows.Next() {
+		var r reported
+		var empty bool
+		if err := rows.Scan(&r.element.Type, &r.element.Number, &r.barcode, &empty); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		if empty {
+			continue
+		}
+		recordedFull[r.element] = true
+		if r.barcode != "" {
+			recorded = append(recorded, r)
+			expectedAt[r.barcode] = r.element
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	add := func(kind, barcode string, expected, found *Element) {
+		d := Discrepancy{Kind: kind, Barcode: barcode, Expected: expected, Found: found}
+		if barcode != "" {
+			l.db.QueryRow("SELECT id FROM tapes WHERE barcode = ?", barcode).Scan(&d.TapeID)
+		}
+		result.Discrepancies = append(result.Discrepancies, d)
+	}
+	for _, r := range recorded {
+		expected := r.element
+		found, ok := foundAt[r.barcode]
+		switch {
+		case !ok:
+			add(DiscrepancyMissing, r.barcode, &expected, nil)
+		case found != expected:
+			add(DiscrepancyMoved, r.barcode, &expected, &found)
+		}
+	}
+	for _, r := range full {
+		found := r.element
+		if r.barcode == "" {
+			if !recordedFull[found] {
+				add(DiscrepancyUnexpected, "", nil, &found)
+			}
+			continue
+		}
+		if _, ok := expectedAt[r.barcode]; !ok {
+			add(DiscrepancyUnexpected, r.barcode, nil, &found)
+		}
+	}
+	return result, nil
+}
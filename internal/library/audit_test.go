@@ -0,0 +1,94 @@
+package library
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"testing"
+
+	"github.com/RoseOO/TapeBackarr/internal/database"
+	"github.com/RoseOO/TapeBackarr/internal/logging"
+)
+
+const auditStatus = `  Storage Changer /dev/sg3:1 Drives, 5 Slots ( 1 Import/Export )
+Data Transfer Element 0:Full (Storage Element 2 Loaded):VolumeTag = AUD002
+      Storage Element 1:Full :VolumeTag=AUD003
+      Storage Element 2:Empty
+      Storage Element 3:Full :VolumeTag=AUD009
+      Storage Element 4:Full
+      Storage Element 5 IMPORT/EXPORT:Empty
+`
+
+func TestAudit(t *testing.T) {
+	ctx := context.Background()
+	db, err := database.New(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("failed to create database: %v", err)
+	}
+	defer db.Close()
+	if err := db.Migrate(); err != nil {
+		t.Fatalf("failed to migrate database: %v", err)
+	}
+
+	db.Exec("INSERT INTO tape_pools (name) VALUES ('daily')")
+	for _, label := range []string{"AUD001", "AUD002", "AUD003"} {
+		db.Exec("INSERT INTO tapes (uuid, barcode, label, pool_id, status) VALUES (?, ?, ?, 1, 'active')", "uuid-"+label, label, label)
+	}
+	db.Exec("INSERT INTO tape_libraries (name, device_path) VALUES ('changer', '/dev/sg3')")
+
+	logger, _ := logging.NewLogger("error", "text", "")
+	loader := NewLoader(db, logger)
+	loader.mtx = func(ctx context.Context, changer string, args ...string) ([]byte, error) {
+		return []byte(auditStatus), nil
+	}
+
+	if _, err := loader.Audit(ctx, 1); !errors.Is(err, ErrNotInventoried) {
+		t.Fatalf("expected a library without an inventory to be refused, got %v", err)
+	}
+
+	// AUD001 was in slot 1 and AUD003 in slot 3; AUD002 was loaded into the
+	// drive, recorded by tape only
+	db.Exec("UPDATE tape_libraries SET last_inventory_at = CURRENT_TIMESTAMP")
+	db.Exec("INSERT INTO tape_library_slots (library_id, slot_number, slot_type, barcode, is_empty) VALUES (1, 1, 'storage', 'AUD001', 0)")
+	db.Exec("INSERT INTO tape_library_slots (library_id, slot_number, slot_type, barcode, is_empty) VALUES (1, 2, 'storage', '', 1)")
+	db.Exec("INSERT INTO tape_library_slots (library_id, slot_number, slot_type, barcode, is_empty) VALUES (1, 3, 'storage', 'AUD003', 0)")
+	db.Exec("INSERT INTO tape_library_slots (library_id, slot_number, slot_type, barcode, is_empty) VALUES (1, 4, 'storage', '', 1)")
+	db.Exec("INSERT INTO tape_library_slots (library_id, slot_number, slot_type, tape_id, barcode, is_empty) VALUES (1, 0, 'drive', 2, '', 0)")
+
+	result, err := loader.Audit(ctx, 1)
+	if err != nil {
+		t.Fatalf("Audit: %v", err)
+	}
+	if result.LibraryName != "changer" || result.Elements != 6 {
+		t.Errorf("unexpected result %+v", result)
+	}
+	var got []string
+	for _, d := range result.Discrepancies {
+		where := ""
+		if d.Expected != nil {
+			where += " expected " + d.Expected.String()
+		}
+		if d.Found != nil {
+			where += " found " + d.Found.String()
+		}
+		got = append(got, fmt.Sprintf("%s %s#%d%s", d.Kind, d.Barcode, d.TapeID, where))
+	}
+	want := []string{
+		"missing AUD001#1 expected slot 1",
+		"moved AUD003#3 expected slot 3 found slot 1",
+		"unexpected AUD009#0 found slot 3",
+		"unexpected #0 found slot 4",
+	}
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("expected discrepancies\n%v\ngot\n%v", want, got)
+	}
+
+	// A changer that cannot be read is an error, not a clean audit
+	loader.mtx = func(ctx context.Context, changer string, args ...string) ([]byte, error) {
+		return []byte("mtx: cannot open SCSI device"), errors.New("exit status 1")
+	}
+	if _, err := loader.Audit(ctx, 1); err == nil {
+		t.Fatal("expected a failed mtx status to fail the audit")
+	}
+}
@@ -0,0 +1,296 @@
+// Package library moves tapes between the slots and drives of tape libraries
+// (autochangers) with mtx, so jobs can fetch the tapes they need without an
+// operator inserting them.
+package library
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"os/exec"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/RoseOO/TapeBackarr/internal/database"
+	"github.com/RoseOO/TapeBackarr/internal/logging"
+	"github.com/RoseOO/TapeBackarr/internal/tape"
+)
+
+// ErrNotInLibrary is returned when the tape is not in a storage slot of an
+// enabled library, so it has to be inserted by hand
+var ErrNotInLibrary = errors.New("tape is not in a library slot")
+
+// ErrUnavailable is returned for a changer that cannot be used, e.g. because
+// mtx is not installed or the user has no access to the device
+var ErrUnavailable = errors.New("library is unavailable")
+
+// readyTimeout is how long a drive may take to report a freshly loaded tape
+// as ready
+const readyTimeout = 2 * time.Minute
+
+// Request says where a tape may be loaded
+type Request struct {
+	// JobID is the backup job the tape is loaded for. Drives held by other
+	// jobs are not used. Zero for restores.
+	JobID int64
+	// DevicePath limits the load to one drive, e.g. the drive a job is
+	// pinned to. Empty uses any drive of the tape's library.
+	DevicePath string
+}
+
+// Load describes a tape moved into a drive
+type Load struct {
+	LibraryID   int64
+	Slot        int
+	DriveID     int64
+	DriveNumber int
+	DevicePath  string
+	// UnloadedTo is the slot the drive's previous tape was returned to, or
+	// 0 when the drive was empty
+	UnloadedTo int
+}
+
+// Loader loads tapes from library slots into the library's drives. Moves
+// are serialized: a changer has one robot.
+type Loader struct {
+	db     *database.DB
+	logger *logging.Logger
+	mu     sync.Mutex
+	// mtx runs mtx against a changer device; replaced in tests
+	mtx func(ctx context.Context, changer string, args ...string) ([]byte, error)
+
+	umu sync.RWMutex
+	// unavailable maps changers that cannot be used to why, the empty path
+	// standing for all of them
+	unavailable map[string]string
+}
+
+// NewLoader creates a loader
+func NewLoader(db *database.DB, logger *logging.Logger) *Loader {
+	return &Loader{db: db, logger: logger, mtx: runMtx}
+}
+
+func runMtx(ctx context.Context, changer string, args ...string) ([]byte, error) {
+	return exec.CommandContext(ctx, "mtx", append([]string{"-f", changer}, args...)...).CombinedOutput()
+}
+
+// SetUnavailable replaces the changers that cannot be used, mapped to why;
+// the empty path stands for all changers. Tapes in their slots are treated
+// as not in a library, so runs ask an operator for them instead of failing
+// on the changer, and moves return ErrUnavailable.
+func (l *Loader) SetUnavailable(changers map[string]string) {
+	l.umu.Lock()
+	defer l.umu.Unlock()
+	l.unavailable = changers
+}
+
+// CheckChanger returns an error wrapping ErrUnavailable when the changer
+// cannot be used
+func (l *Loader) CheckChanger(changer string) error {
+	if l == nil {
+		return nil
+	}
+	l.umu.RLock()
+	defer l.umu.RUnlock()
+	if reason, ok := l.unavailable[""]; ok {
+		return fmt.Errorf("%w: %s", ErrUnavailable, reason)
+	}
+	if reason, ok := l.unavailable[changer]; ok {
+		return fmt.Errorf("%w: %s", ErrUnavailable, reason)
+	}
+	return nil
+}
+
+// tapeSlotQuery finds the storage slot holding a tape, matched by the tape
+// recorded in the slot or by barcode since an inventory only records the
+// latter
+const tapeSlotQuery = `
+	SELECT ls.library_id, ls.slot_number, l.device_path
+	FROM tape_library_slots ls
+	JOIN tape_libraries l ON l.id = ls.library_id AND COALESCE(l.enabled, 1) = 1
+	JOIN tapes t ON t.id = ?
+	WHERE ls.slot_type = 'storage' AND ls.is_empty = 0
+	AND (ls.tape_id = t.id OR (ls.barcode != '' AND ls.barcode = t.barcode))
+	ORDER BY ls.library_id, ls.slot_number LIMIT 1`
+
+// InSlotOrder is an SQL expression, true for a row of tapes that sits in a
+// storage slot of an enabled library. Tape selection orders by it, descending,
+// so a tape a library can fetch is picked before one on the shelf. The query
+// must not alias the tapes table.
+const InSlotOrder = `EXISTS (
+	SELECT 1 FROM tape_library_slots ls
+	JOIN tape_libraries l ON l.id = ls.library_id AND COALESCE(l.enabled, 1) = 1
+	WHERE ls.slot_type = 'storage' AND ls.is_empty = 0
+	AND (ls.tape_id = tapes.id OR (ls.barcode != '' AND ls.barcode = tapes.barcode)))`
+
+// InLibrary reports whether the tape sits in a storage slot of an enabled
+// library whose changer can be used
+func (l *Loader) InLibrary(tapeID int64) bool {
+	_, ok := l.LibraryOf(tapeID)
+	return ok
+}
+
+// LibraryOf returns the enabled library with a usable changer that holds the
+// tape in a storage slot
+func (l *Loader) LibraryOf(tapeID int64) (int64, bool) {
+	var libraryID int64
+	var slot int
+	var changer string
+	if l.db.QueryRow(tapeSlotQuery, tapeID).Scan(&libraryID, &slot, &changer) != nil {
+		return 0, false
+	}
+	return libraryID, l.CheckChanger(changer) == nil
+}
+
+// Load moves the tape from its library slot into a drive of the library that
+// is mapped to a configured drive, returning a tape already in that drive to
+// an empty slot first. Empty drives are preferred. It returns ErrNotInLibrary
+// when the tape is not in a library, and waits for the drive to report the
+// tape ready.
+func (l *Loader) Load(ctx context.Context, tapeID int64, req Request) (*Load, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	load := &Load{}
+	var changer string
+	if err := l.db.QueryRow(tapeSlotQuery, tapeID).Scan(&load.LibraryID, &load.Slot, &changer); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrNotInLibrary
+		}
+		return nil, err
+	}
+	if err := l.CheckChanger(changer); err != nil {
+		return nil, err
+	}
+
+	var currentTape sql.NullInt64
+	err := l.db.QueryRow(`
+		SELECT id, device_path, library_drive_number, current_tape_id FROM tape_drives
+		WHERE library_id = ? AND library_drive_number IS NOT NULL AND COALESCE(enabled, 1) = 1
+		AND (? = '' OR device_path = ?)
+		AND (reserved_job_id IS NULL OR reserved_job_id = ?)
+		AND COALESCE(status, '') != 'busy'
+		ORDER BY current_tape_id IS NOT NULL, library_drive_number LIMIT 1
+	`, load.LibraryID, req.DevicePath, req.DevicePath, req.JobID).Scan(&load.DriveID, &load.DevicePath, &load.DriveNumber, &currentTape)
+	if errors.Is(err, sql.ErrNoRows) {
+		if req.DevicePath != "" {
+			return nil, fmt.Errorf("drive %s is not a free drive of library %d", req.DevicePath, load.LibraryID)
+		}
+		return nil, fmt.Errorf("no free drive in library %d", load.LibraryID)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// A drive slot marked full by the last inventory holds a tape too
+	var driveSlotFull bool
+	l.db.QueryRow("SELECT is_empty = 0 FROM tape_library_slots WHERE library_id = ? AND slot_type = 'drive' AND slot_number = ?",
+		load.LibraryID, load.DriveNumber).Scan(&driveSlotFull)
+	if currentTape.Valid || driveSlotFull {
+		if err := l.db.QueryRow(`
+			SELECT slot_number FROM tape_library_slots
+			WHERE library_id = ? AND slot_type = 'storage' AND is_empty = 1
+			ORDER BY slot_number LIMIT 1
+		`, load.LibraryID).Scan(&load.UnloadedTo); err != nil {
+			return nil, fmt.Errorf("drive %d of library %d holds a tape and there is no empty slot to return it to", load.DriveNumber, load.LibraryID)
+		}
+		if output, err := l.mtx(ctx, changer, "unload", strconv.Itoa(load.UnloadedTo), strconv.Itoa(load.DriveNumber)); err != nil {
+			return nil, fmt.Errorf("mtx unload failed: %s - %s", err.Error(), string(output))
+		}
+		l.moved(load.LibraryID, "drive", load.DriveNumber, "storage", load.UnloadedTo)
+		if currentTape.Valid {
+			l.db.Exec("UPDATE tape_library_slots SET tape_id = ? WHERE library_id = ? AND slot_type = 'storage' AND slot_number = ?",
+				currentTape.Int64, load.LibraryID, load.UnloadedTo)
+		}
+		l.db.Exec("UPDATE tape_drives SET current_tape_id = NULL WHERE id = ?", load.DriveID)
+		invalidate(load.DevicePath, "library_unload")
+	}
+
+	if output, err := l.mtx(ctx, changer, "load", strconv.Itoa(load.Slot), strconv.Itoa(load.DriveNumber)); err != nil {
+		return nil, fmt.Errorf("mtx load failed: %s - %s", err.Error(), string(output))
+	}
+	l.moved(load.LibraryID, "storage", load.Slot, "drive", load.DriveNumber)
+	l.db.Exec("UPDATE tape_library_slots SET tape_id = ? WHERE library_id = ? AND slot_type = 'drive' AND slot_number = ?",
+		tapeID, load.LibraryID, load.DriveNumber)
+	l.db.Exec("UPDATE tape_drives SET current_tape_id = ? WHERE id = ?", tapeID, load.DriveID)
+	invalidate(load.DevicePath, "library_load")
+
+	l.logger.Info("Loaded tape from library", map[string]interface{}{
+		"tape_id": tapeID, "library_id": load.LibraryID, "slot": load.Slot,
+		"drive": load.DriveNumber, "device": load.DevicePath, "unloaded_to": load.UnloadedTo,
+	})
+
+	if err := tape.NewServiceForDevice(load.DevicePath, 0).WaitForTape(ctx, readyTimeout); err != nil {
+		return load, fmt.Errorf("tape loaded into %s but the drive did not become ready: %w", load.DevicePath, err)
+	}
+	return load, nil
+}
+
+// LoadSlot moves the tape in a storage slot of a library into one of its
+// drives, whether or not the catalog knows the tape, e.g. to read its
+// catalog back. The drive must be empty.
+func (l *Loader) LoadSlot(ctx context.Context, libraryID int64, slot, driveNumber int) error {
+	return l.moveSlot(ctx, libraryID, "load", slot, driveNumber)
+}
+
+// UnloadSlot returns the tape in a drive of a library to a storage slot
+func (l *Loader) UnloadSlot(ctx context.Context, libraryID int64, slot, driveNumber int) error {
+	return l.moveSlot(ctx, libraryID, "unload", slot, driveNumber)
+}
+
+// moveSlot runs mtx load or unload between a slot and a drive and records
+// the move like Load does
+func (l *Loader) moveSlot(ctx context.Context, libraryID int64, op string, slot, driveNumber int) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	var changer string
+	if err := l.db.QueryRow("SELECT device_path FROM tape_libraries WHERE id = ?", libraryID).Scan(&changer); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return fmt.Errorf("library %d not found", libraryID)
+		}
+		return err
+	}
+	if err := l.CheckChanger(changer); err != nil {
+		return err
+	}
+	if output, err := l.mtx(ctx, changer, op, strconv.Itoa(slot), strconv.Itoa(driveNumber)); err != nil {
+		return fmt.Errorf("mtx %s failed: %s - %s", op, err.Error(), string(output))
+	}
+
+	if op == "load" {
+		l.moved(libraryID, "storage", slot, "drive", driveNumber)
+		l.db.Exec(`UPDATE tape_drives SET current_tape_id = (
+			SELECT tape_id FROM tape_library_slots WHERE library_id = ? AND slot_type = 'drive' AND slot_number = ?
+		) WHERE library_id = ? AND library_drive_number = ?`, libraryID, driveNumber, libraryID, driveNumber)
+	} else {
+		l.moved(libraryID, "drive", driveNumber, "storage", slot)
+		l.db.Exec("UPDATE tape_drives SET current_tape_id = NULL WHERE library_id = ? AND library_drive_number = ?", libraryID, driveNumber)
+	}
+	var devicePath string
+	if l.db.QueryRow("SELECT device_path FROM tape_drives WHERE library_id = ? AND library_drive_number = ?", libraryID, driveNumber).Scan(&devicePath) == nil {
+		invalidate(devicePath, "library_"+op)
+	}
+	return nil
+}
+
+// moved records a move in the slot inventory: the tape and barcode go from
+// one element to the other
+func (l *Loader) moved(libraryID int64, fromType string, from int, toType string, to int) {
+	var tapeID sql.NullInt64
+	var barcode string
+	l.db.QueryRow("SELECT tape_id, COALESCE(barcode, '') FROM tape_library_slots WHERE library_id = ? AND slot_type = ? AND slot_number = ?",
+		libraryID, fromType, from).Scan(&tapeID, &barcode)
+	l.db.Exec("UPDATE tape_library_slots SET tape_id = NULL, barcode = '', is_empty = 1, updated_at = CURRENT_TIMESTAMP WHERE library_id = ? AND slot_type = ? AND slot_number = ?",
+		libraryID, fromType, from)
+	l.db.Exec("UPDATE tape_library_slots SET tape_id = ?, barcode = ?, is_empty = 0, updated_at = CURRENT_TIMESTAMP WHERE library_id = ? AND slot_type = ? AND slot_number = ?",
+		tapeID, barcode, libraryID, toType, to)
+}
+
+// invalidate drops what is known about the media in a drive after a move
+func invalidate(devicePath, reason string) {
+	tape.SharedLabelCache().InvalidateReason(devicePath, reason)
+	tape.SharedProbes().Invalidate(devicePath)
+}
@@ -0,0 +1,136 @@
+package library
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/RoseOO/TapeBackarr/internal/database"
+	"github.com/RoseOO/TapeBackarr/internal/logging"
+)
+
+func TestLoad(t *testing.T) {
+	ctx := context.Background()
+	db, err := database.New(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("failed to create database: %v", err)
+	}
+	defer db.Close()
+	if err := db.Migrate(); err != nil {
+		t.Fatalf("failed to migrate database: %v", err)
+	}
+
+	db.Exec("INSERT INTO tape_pools (name) VALUES ('daily')")
+	for _, label := range []string{"LIB001", "LIB002", "SHELF1"} {
+		db.Exec("INSERT INTO tapes (uuid, barcode, label, pool_id, status) VALUES (?, ?, ?, 1, 'active')", "uuid-"+label, label, label)
+	}
+	db.Exec("INSERT INTO tape_libraries (name, device_path) VALUES ('changer', '/dev/sg3')")
+	// LIB001 in slot 1, slot 2 empty, LIB002 in drive 0 as found by an inventory
+	db.Exec("INSERT INTO tape_library_slots (library_id, slot_number, slot_type, barcode, is_empty) VALUES (1, 1, 'storage', 'LIB001', 0)")
+	db.Exec("INSERT INTO tape_library_slots (library_id, slot_number, slot_type, barcode, is_empty) VALUES (1, 2, 'storage', '', 1)")
+	db.Exec("INSERT INTO tape_library_slots (library_id, slot_number, slot_type, barcode, is_empty) VALUES (1, 0, 'drive', 'LIB002', 0)")
+	devicePath := "file://" + t.TempDir()
+	db.Exec("INSERT INTO tape_drives (device_path, display_name, status, current_tape_id, library_id, library_drive_number) VALUES (?, 'lib0', 'ready', 2, 1, 0)", devicePath)
+
+	logger, _ := logging.NewLogger("error", "text", "")
+	loader := NewLoader(db, logger)
+	var calls []string
+	loader.mtx = func(ctx context.Context, changer string, args ...string) ([]byte, error) {
+		calls = append(calls, changer+" "+strings.Join(args, " "))
+		return nil, nil
+	}
+
+	if _, err := loader.Load(ctx, 3, Request{}); !errors.Is(err, ErrNotInLibrary) {
+		t.Fatalf("expected a shelf tape to be reported as not in a library, got %v", err)
+	}
+
+	// A drive another job holds is not used
+	db.Exec("INSERT INTO backup_sources (name, source_type, path) VALUES ('docs', 'local', '/tmp')")
+	db.Exec("INSERT INTO backup_jobs (name, source_id, pool_id, backup_type, schedule_cron, retention_days) VALUES ('docs', 1, 1, 'full', '', 30)")
+	db.Exec("UPDATE tape_drives SET reserved_job_id = 1")
+	if _, err := loader.Load(ctx, 1, Request{JobID: 2}); err == nil || len(calls) != 0 {
+		t.Fatalf("expected no load into a drive held by another job, got %v and calls %v", err, calls)
+	}
+
+	// The job holding the drive gets its tape swapped in
+	load, err := loader.Load(ctx, 1, Request{JobID: 1, DevicePath: devicePath})
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	if want := []string{"/dev/sg3 unload 2 0", "/dev/sg3 load 1 0"}; strings.Join(calls, ",") != strings.Join(want, ",") {
+		t.Errorf("expected mtx calls %v, got %v", want, calls)
+	}
+	if load.Slot != 1 || load.DriveNumber != 0 || load.UnloadedTo != 2 || load.DevicePath != devicePath {
+		t.Errorf("unexpected load %+v", load)
+	}
+
+	var current int64
+	db.QueryRow("SELECT current_tape_id FROM tape_drives WHERE id = 1").Scan(&current)
+	if current != 1 {
+		t.Errorf("expected the drive to hold tape 1, got %d", current)
+	}
+	slot := func(slotType string, number int) (string, sql.NullInt64, bool) {
+		var barcode string
+		var tapeID sql.NullInt64
+		var empty bool
+		db.QueryRow("SELECT barcode, tape_id, is_empty FROM tape_library_slots WHERE slot_type = ? AND slot_number = ?", slotType, number).Scan(&barcode, &tapeID, &empty)
+		return barcode, tapeID, empty
+	}
+	if barcode, _, empty := slot("storage", 1); !empty || barcode != "" {
+		t.Errorf("expected slot 1 empty, got %q, empty %v", barcode, empty)
+	}
+	if barcode, tapeID, empty := slot("storage", 2); empty || barcode != "LIB002" || tapeID.Int64 != 2 {
+		t.Errorf("expected LIB002 returned to slot 2, got %q, tape %v, empty %v", barcode, tapeID, empty)
+	}
+	if barcode, tapeID, empty := slot("drive", 0); empty || barcode != "LIB001" || tapeID.Int64 != 1 {
+		t.Errorf("expected LIB001 in drive 0, got %q, tape %v, empty %v", barcode, tapeID, empty)
+	}
+	if loader.InLibrary(1) || !loader.InLibrary(2) {
+		t.Error("expected only LIB002 in a slot after the swap")
+	}
+
+	// A changer that cannot be used leaves its tapes to the operator
+	loader.SetUnavailable(map[string]string{"/dev/sg3": "permission denied"})
+	calls = nil
+	if loader.InLibrary(2) {
+		t.Error("expected tapes of an unavailable changer to be reported as not in a library")
+	}
+	if _, err := loader.Load(ctx, 2, Request{}); !errors.Is(err, ErrUnavailable) || len(calls) != 0 {
+		t.Errorf("expected ErrUnavailable without mtx calls, got %v and calls %v", err, calls)
+	}
+	if err := loader.UnloadSlot(ctx, 1, 1, 0); !errors.Is(err, ErrUnavailable) || len(calls) != 0 {
+		t.Errorf("expected ErrUnavailable for a slot move without mtx calls, got %v and calls %v", err, calls)
+	}
+	loader.SetUnavailable(nil)
+	if !loader.InLibrary(2) {
+		t.Error("expected the changer usable again")
+	}
+
+	// Slot moves go through the same changer and keep the inventory
+	if err := loader.UnloadSlot(ctx, 1, 1, 0); err != nil {
+		t.Fatalf("UnloadSlot: %v", err)
+	}
+	db.QueryRow("SELECT COALESCE(current_tape_id, 0) FROM tape_drives WHERE id = 1").Scan(&current)
+	if barcode, tapeID, empty := slot("storage", 1); empty || barcode != "LIB001" || tapeID.Int64 != 1 || current != 0 {
+		t.Errorf("expected LIB001 back in slot 1 and the drive empty, got %q, tape %v, empty %v, drive %d", barcode, tapeID, empty, current)
+	}
+	if err := loader.LoadSlot(ctx, 1, 1, 0); err != nil {
+		t.Fatalf("LoadSlot: %v", err)
+	}
+	db.QueryRow("SELECT COALESCE(current_tape_id, 0) FROM tape_drives WHERE id = 1").Scan(&current)
+	if current != 1 {
+		t.Errorf("expected the drive to hold tape 1 again, got %d", current)
+	}
+	if want := []string{"/dev/sg3 unload 1 0", "/dev/sg3 load 1 0"}; strings.Join(calls, ",") != strings.Join(want, ",") {
+		t.Errorf("expected mtx calls %v, got %v", want, calls)
+	}
+	loader.mtx = func(ctx context.Context, changer string, args ...string) ([]byte, error) {
+		return []byte("Drive 0 Full"), errors.New("exit status 1")
+	}
+	if err := loader.LoadSlot(ctx, 1, 2, 0); err == nil || !strings.Contains(err.Error(), "mtx load failed: exit status 1 - Drive 0 Full") {
+		t.Errorf("expected the mtx failure, got %v", err)
+	}
+}
@@ -0,0 +1,85 @@
+package library
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strconv"
+)
+
+// ErrNoFreeIESlot is returned when a tape is to be moved to the mail slot
+// but every import/export slot of its library is full
+var ErrNoFreeIESlot = errors.New("no empty import/export slot")
+
+// Location is where a library holds a tape
+type Location struct {
+	LibraryID   int64   `json:"library_id"`
+	LibraryName string  `json:"library_name"`
+	Element     Element `json:"element"`
+	Barcode     string  `json:"barcode"`
+	// MovedFrom is the slot the tape was moved out of when it was moved to
+	// an import/export slot
+	MovedFrom *Element `json:"moved_from,omitempty"`
+}
+
+// Locate finds the element of an enabled library holding a tape, from the
+// slot records, so an operator can find the cartridge. With moveToIE a
+// tape in a storage slot is moved to the first empty import/export slot,
+// where it can be taken out; a tape in a drive must be unloaded first. It
+// returns ErrNotInLibrary when no library holds the tape.
+func (l *Loader) Locate(ctx context.Context, tapeID int64, moveToIE bool) (*Location, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	loc := &Location{}
+	var changer string
+	err := l.db.QueryRow(`
+		SELECT ls.library_id, l.name, l.device_path, ls.slot_type, ls.slot_number, COALESCE(NULLIF(ls.barcode, ''), t.barcode, '')
+		FROM tape_library_slots ls
+		JOIN tape_libraries l ON l.id = ls.library_id AND COALESCE(l.enabled, 1) = 1
+		JOIN tapes t ON t.id = ?
+		WHERE ls.is_empty = 0
+		AND (ls.tape_id = t.id OR (ls.barcode != '' AND ls.barcode = t.barcode))
+		ORDER BY ls.library_id, ls.slot_number LIMIT 1
+	`, tapeID).Scan(&loc.LibraryID, &loc.LibraryName, &changer, &loc.Element.Type, &loc.Element.Number, &loc.Barcode)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotInLibrary
+	}
+	if err != nil {
+		return nil, err
+	}
+	if !moveToIE || loc.Element.Type == "import_export" {
+		return loc, nil
+	}
+	if loc.Element.Type == "drive" {
+		return nil, fmt.Errorf("tape is loaded in drive %d of library %s, unload it first", loc.Element.Number, loc.LibraryName)
+	}
+	if err := l.CheckChanger(changer); err != nil {
+		return nil, err
+	}
+
+	ie := Element{Type: "import_export"}
+	if err := l.db.QueryRow(`
+		SELECT slot_number FROM tape_library_slots
+		WHERE library_id = ? AND slot_type = 'import_export' AND is_empty = 1
+		ORDER BY slot_number LIMIT 1
+	`, loc.LibraryID).Scan(&ie.Number); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrNoFreeIESlot
+		}
+		return nil, err
+	}
+	if output, err := l.mtx(ctx, changer, "transfer", strconv.Itoa(loc.Element.Number), strconv.Itoa(ie.Number)); err != nil {
+		return nil, fmt.Errorf("mtx transfer failed: %s - %s", err.Error(), string(output))
+	}
+	l.moved(loc.LibraryID, loc.Element.Type, loc.Element.Number, ie.Type, ie.Number)
+	l.logger.Info("Moved tape to import/export slot", map[string]interface{}{
+		"tape_id": tapeID, "library_id": loc.LibraryID, "slot": loc.Element.Number, "ie_slot": ie.Number,
+	})
+
+	from := loc.Element
+	loc.MovedFrom = &from
+	loc.Element = ie
+	return loc, nil
+}
@@ -0,0 +1,86 @@
+package library
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/RoseOO/TapeBackarr/internal/database"
+	"github.com/RoseOO/TapeBackarr/internal/logging"
+)
+
+func TestLocate(t *testing.T) {
+	ctx := context.Background()
+	db, err := database.New(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("failed to create database: %v", err)
+	}
+	defer db.Close()
+	if err := db.Migrate(); err != nil {
+		t.Fatalf("failed to migrate database: %v", err)
+	}
+
+	db.Exec("INSERT INTO tape_pools (name) VALUES ('daily')")
+	for _, label := range []string{"LOC001", "LOC002", "LOC003"} {
+		db.Exec("INSERT INTO tapes (uuid, barcode, label, pool_id, status) VALUES (?, ?, ?, 1, 'active')", "uuid-"+label, label, label)
+	}
+	db.Exec("INSERT INTO tape_libraries (name, device_path) VALUES ('changer', '/dev/sg3')")
+	db.Exec("INSERT INTO tape_library_slots (library_id, slot_number, slot_type, barcode, is_empty) VALUES (1, 0, 'drive', 'LOC002', 0)")
+	db.Exec("INSERT INTO tape_library_slots (library_id, slot_number, slot_type, barcode, is_empty) VALUES (1, 3, 'storage', 'LOC001', 0)")
+	db.Exec("INSERT INTO tape_library_slots (library_id, slot_number, slot_type, barcode, is_empty) VALUES (1, 9, 'import_export', '', 1)")
+
+	logger, _ := logging.NewLogger("error", "text", "")
+	loader := NewLoader(db, logger)
+	var moves []string
+	loader.mtx = func(ctx context.Context, changer string, args ...string) ([]byte, error) {
+		moves = append(moves, strings.Join(args, " "))
+		return nil, nil
+	}
+
+	// Locating reports the slot without moving the tape
+	loc, err := loader.Locate(ctx, 1, false)
+	if err != nil {
+		t.Fatalf("Locate: %v", err)
+	}
+	if loc.LibraryName != "changer" || loc.Element != (Element{Type: "storage", Number: 3}) || loc.Barcode != "LOC001" || len(moves) != 0 {
+		t.Fatalf("expected LOC001 found in slot 3 without a move, got %+v, moves %v", loc, moves)
+	}
+
+	if _, err := loader.Locate(ctx, 3, false); !errors.Is(err, ErrNotInLibrary) {
+		t.Errorf("expected a tape on the shelf to be reported, got %v", err)
+	}
+	if _, err := loader.Locate(ctx, 2, true); err == nil || !strings.Contains(err.Error(), "drive 0") {
+		t.Errorf("expected a loaded tape not to be moved, got %v", err)
+	}
+
+	// Moving takes the tape to the empty I/E slot and updates the records
+	loc, err = loader.Locate(ctx, 1, true)
+	if err != nil {
+		t.Fatalf("Locate to I/E: %v", err)
+	}
+	if len(moves) != 1 || moves[0] != "transfer 3 9" {
+		t.Fatalf("expected one transfer from slot 3 to 9, got %v", moves)
+	}
+	if loc.Element != (Element{Type: "import_export", Number: 9}) || loc.MovedFrom == nil || loc.MovedFrom.Number != 3 {
+		t.Errorf("unexpected location after the move %+v", loc)
+	}
+	var barcode string
+	db.QueryRow("SELECT barcode FROM tape_library_slots WHERE slot_number = 9 AND is_empty = 0").Scan(&barcode)
+	if barcode != "LOC001" {
+		t.Errorf("expected the I/E slot recorded full with LOC001, got %q", barcode)
+	}
+	if loader.InLibrary(1) {
+		t.Error("expected a tape in the I/E slot not to count as loadable")
+	}
+
+	// A tape already in the I/E slot stays there; another finds it full
+	if _, err := loader.Locate(ctx, 1, true); err != nil || len(moves) != 1 {
+		t.Errorf("expected no move for a tape in the I/E slot, got %v, moves %v", err, moves)
+	}
+	db.Exec("INSERT INTO tape_library_slots (library_id, slot_number, slot_type, barcode, is_empty) VALUES (1, 4, 'storage', 'LOC003', 0)")
+	if _, err := loader.Locate(ctx, 3, true); !errors.Is(err, ErrNoFreeIESlot) {
+		t.Errorf("expected a full mail slot to be reported, got %v", err)
+	}
+}
@@ -0,0 +1,89 @@
+package library
+
+import "strings"
+
+// ParseStatus parses the output of `mtx -f /dev/sgX status` into one map
+// per element with its slot_type, slot_number, barcode and is_empty
+func ParseStatus(output string) []map[string]string {
+	var slots []map[string]string
+	lines := strings.Split(output, "\n")
+
+	extractBarcode := func(line, prefix string) string {
+		if idx := strings.Index(line, prefix); idx >= 0 {
+			// Remove any trailing whitespace or non-printable chars
+			if fields := strings.Fields(line[idx+len(prefix):]); len(fields) > 0 {
+				return fields[0]
+			}
+		}
+		return ""
+	}
+
+	for _, line := range lines {
+		line = strings.TrimSpace(line)
+
+		if strings.HasPrefix(line, "Data Transfer Element") {
+			// Drive slot: "Data Transfer Element 0:Full (Storage Element 3 Loaded):VolumeTag = TAPE001"
+			slot := map[string]string{
+				"slot_type": "drive",
+				"is_empty":  "true",
+				"barcode":   "",
+			}
+			// Extract drive number
+			parts := strings.SplitN(line, ":", 2)
+			numStr := strings.TrimPrefix(parts[0], "Data Transfer Element ")
+			slot["slot_number"] = strings.TrimSpace(numStr)
+
+			if strings.Contains(line, "Full") {
+				slot["is_empty"] = "false"
+			}
+			slot["barcode"] = extractBarcode(line, "VolumeTag = ")
+			if slot["barcode"] == "" {
+				slot["barcode"] = extractBarcode(line, "VolumeTag=")
+			}
+			slots = append(slots, slot)
+
+		} else if strings.Contains(line, "Storage Element") && strings.Contains(line, "IMPORT/EXPORT") {
+			// Import/Export slot
+			slot := map[string]string{
+				"slot_type": "import_export",
+				"is_empty":  "true",
+				"barcode":   "",
+			}
+			parts := strings.SplitN(line, ":", 2)
+			numStr := strings.TrimPrefix(parts[0], "Storage Element ")
+			numStr = strings.Split(numStr, " ")[0]
+			slot["slot_number"] = strings.TrimSpace(numStr)
+
+			if strings.Contains(line, "Full") {
+				slot["is_empty"] = "false"
+			}
+			slot["barcode"] = extractBarcode(line, "VolumeTag=")
+			if slot["barcode"] == "" {
+				slot["barcode"] = extractBarcode(line, "VolumeTag = ")
+			}
+			slots = append(slots, slot)
+
+		} else if strings.Contains(line, "Storage Element") {
+			// Normal storage slot: "      Storage Element 1:Full :VolumeTag=TAPE001"
+			slot := map[string]string{
+				"slot_type": "storage",
+				"is_empty":  "true",
+				"barcode":   "",
+			}
+			parts := strings.SplitN(line, ":", 2)
+			numStr := strings.TrimPrefix(parts[0], "Storage Element ")
+			slot["slot_number"] = strings.TrimSpace(numStr)
+
+			if strings.Contains(line, "Full") {
+				slot["is_empty"] = "false"
+			}
+			slot["barcode"] = extractBarcode(line, "VolumeTag=")
+			if slot["barcode"] == "" {
+				slot["barcode"] = extractBarcode(line, "VolumeTag = ")
+			}
+			slots = append(slots, slot)
+		}
+	}
+
+	return slots
+}
@@ -1,6 +1,9 @@
 package models
 
 import (
+	"encoding/json"
+	"fmt"
+	"regexp"
 	"strings"
 	"time"
 )
@@ -11,17 +14,65 @@ type UserRole string
 const (
 	RoleAdmin    UserRole = "admin"
 	RoleOperator UserRole = "operator"
-	RoleReadOnly UserRole = "readonly"
+	// RoleRestoreOperator can search the catalog and run restores to
+	// approved restore targets, but not run backups or change tapes or
+	// configuration
+	RoleRestoreOperator UserRole = "restore_operator"
+	RoleReadOnly        UserRole = "readonly"
+	// RoleKiosk can only use the operator kiosk: see pending tape requests
+	// and confirm tapes as loaded, e.g. from a tablet next to the library
+	RoleKiosk UserRole = "kiosk"
 )
 
+// Valid reports whether r is a known role
+func (r UserRole) Valid() bool {
+	switch r {
+	case RoleAdmin, RoleOperator, RoleRestoreOperator, RoleReadOnly, RoleKiosk:
+		return true
+	}
+	return false
+}
+
 // User represents a system user for authentication
 type User struct {
-	ID           int64     `json:"id" db:"id"`
-	Username     string    `json:"username" db:"username"`
-	PasswordHash string    `json:"-" db:"password_hash"`
-	Role         UserRole  `json:"role" db:"role"`
-	CreatedAt    time.Time `json:"created_at" db:"created_at"`
-	UpdatedAt    time.Time `json:"updated_at" db:"updated_at"`
+	ID                  int64      `json:"id" db:"id"`
+	Username            string     `json:"username" db:"username"`
+	PasswordHash        string     `json:"-" db:"password_hash"`
+	Role                UserRole   `json:"role" db:"role"`
+	FailedLoginAttempts int        `json:"failed_login_attempts" db:"failed_login_attempts"`
+	LockedAt            *time.Time `json:"locked_at" db:"locked_at"`
+	LockedUntil         *time.Time `json:"locked_until" db:"locked_until"`
+	LastLoginAt         *time.Time `json:"last_login_at" db:"last_login_at"`
+	LastLoginIP         string     `json:"last_login_ip" db:"last_login_ip"`
+	CreatedAt           time.Time  `json:"created_at" db:"created_at"`
+	UpdatedAt           time.Time  `json:"updated_at" db:"updated_at"`
+}
+
+// LoginHistoryEntry records a single login attempt
+type LoginHistoryEntry struct {
+	ID        int64     `json:"id" db:"id"`
+	UserID    *int64    `json:"user_id" db:"user_id"`
+	Username  string    `json:"username" db:"username"`
+	IPAddress string    `json:"ip_address" db:"ip_address"`
+	Success   bool      `json:"success" db:"success"`
+	Reason    string    `json:"reason" db:"reason"`
+	CreatedAt time.Time `json:"created_at" db:"created_at"`
+}
+
+// UserPreferences holds per-user UI/API settings persisted server-side.
+// DashboardLayout is an opaque JSON document owned by the web UI. NotifyEmail
+// and NotifyTelegramChatID receive the notifications of the jobs the user owns.
+type UserPreferences struct {
+	UserID               int64     `json:"user_id" db:"user_id"`
+	DefaultPoolID        *int64    `json:"default_pool_id" db:"default_pool_id"`
+	PreferredDriveID     *int64    `json:"preferred_drive_id" db:"preferred_drive_id"`
+	ItemsPerPage         int       `json:"items_per_page" db:"items_per_page"`
+	NotificationDigest   bool      `json:"notification_digest" db:"notification_digest"`
+	DashboardLayout      string    `json:"dashboard_layout" db:"dashboard_layout"`
+	Language             string    `json:"language" db:"language"`
+	NotifyEmail          string    `json:"notify_email" db:"notify_email"`
+	NotifyTelegramChatID string    `json:"notify_telegram_chat_id" db:"notify_telegram_chat_id"`
+	UpdatedAt            time.Time `json:"updated_at" db:"updated_at"`
 }
 
 // TapePool represents a group of tapes with similar policies
@@ -32,10 +83,21 @@ type TapePool struct {
 	RetentionDays    int       `json:"retention_days" db:"retention_days"`
 	AllowReuse       bool      `json:"allow_reuse" db:"allow_reuse"`
 	AllocationPolicy string    `json:"allocation_policy" db:"allocation_policy"`
+	ReuseApproval    bool      `json:"reuse_approval" db:"reuse_approval"`
+	ReuseGraceHours  int       `json:"reuse_grace_hours" db:"reuse_grace_hours"` // 0 = wait for an admin
+	FormatType       string    `json:"format_type" db:"format_type"`             // "" = raw or LTFS tapes
 	CreatedAt        time.Time `json:"created_at" db:"created_at"`
 	UpdatedAt        time.Time `json:"updated_at" db:"updated_at"`
 }
 
+// Pool allocation policies
+const (
+	// AllocationContinue fills a pool's current tape before starting another
+	AllocationContinue = "continue"
+	// AllocationAlwaysNew starts a new tape for each job
+	AllocationAlwaysNew = "always-new"
+)
+
 // TapeStatus represents the state of a tape
 type TapeStatus string
 
@@ -48,6 +110,12 @@ const (
 	TapeStatusExported TapeStatus = "exported"
 )
 
+// Reuse states of expired tapes in pools that require reuse approval
+const (
+	TapeReusePending  = "pending"
+	TapeReuseApproved = "approved"
+)
+
 // LTOCapacities maps LTO generation to native capacity in bytes
 var LTOCapacities = map[string]int64{
 	"LTO-1":  100000000000,   // 100 GB
@@ -125,6 +193,59 @@ func CanUseHardwareEncryption(ltoType string) bool {
 	return gen >= HWEncryptionMinLTOGeneration
 }
 
+// driveModelPattern matches the generation in the SCSI inquiry product ID of
+// an LTO drive, e.g. "ULTRIUM-HH8", "ULT3580-TD9", "Ultrium 7-SCSI" or "LTO-9 HH".
+var driveModelPattern = regexp.MustCompile(`(?i)(?:ultrium|ult3580|lto)[\s_-]*(?:td|hh|fh)?[\s_-]*(\d{1,2})\b`)
+
+// LTOTypeFromDriveModel derives the LTO generation of a drive from its
+// inquiry product ID. Returns false when the model is not recognised.
+func LTOTypeFromDriveModel(model string) (string, bool) {
+	m := driveModelPattern.FindStringSubmatch(model)
+	if m == nil {
+		return "", false
+	}
+	ltoType := "LTO-" + strings.TrimLeft(m[1], "0")
+	if _, ok := LTOCapacities[ltoType]; !ok {
+		return "", false
+	}
+	return ltoType, true
+}
+
+// ltoMediaSupport reports whether a drive generation can read and write a
+// media generation. Through LTO-7 drives read two generations back and write
+// one; LTO-8 and LTO-9 read and write one generation back; LTO-10 drives only
+// accept LTO-10 media.
+func ltoMediaSupport(driveGen, mediaGen int) (read, write bool) {
+	switch {
+	case driveGen <= 0 || mediaGen <= 0 || mediaGen > driveGen:
+		return false, false
+	case driveGen >= 10:
+		return mediaGen == driveGen, mediaGen == driveGen
+	case driveGen >= 8:
+		return driveGen-mediaGen <= 1, driveGen-mediaGen <= 1
+	default:
+		return driveGen-mediaGen <= 2, driveGen-mediaGen <= 1
+	}
+}
+
+// CheckLTOCompatibility returns an error if a drive of driveType cannot read
+// media of mediaType, or cannot write it when write is set. Combinations where
+// either generation is unknown are allowed, leaving the final word to the drive.
+func CheckLTOCompatibility(driveType, mediaType string, write bool) error {
+	driveGen, mediaGen := ltoGeneration(driveType), ltoGeneration(mediaType)
+	if driveGen == 0 || mediaGen == 0 {
+		return nil
+	}
+	canRead, canWrite := ltoMediaSupport(driveGen, mediaGen)
+	if write && !canWrite {
+		return fmt.Errorf("%s drive cannot write %s media", driveType, mediaType)
+	}
+	if !canRead {
+		return fmt.Errorf("%s drive cannot read %s media", driveType, mediaType)
+	}
+	return nil
+}
+
 // LTFSBackend describes which LTFS tape backend driver a vendor's drives use.
 type LTFSBackend string
 
@@ -246,8 +367,15 @@ type Tape struct {
 	ExportTime      *time.Time     `json:"export_time" db:"export_time"`
 	ImportTime      *time.Time     `json:"import_time" db:"import_time"`
 	LabeledAt       *time.Time     `json:"labeled_at" db:"labeled_at"`
-	CreatedAt       time.Time      `json:"created_at" db:"created_at"`
-	UpdatedAt       time.Time      `json:"updated_at" db:"updated_at"`
+	ReuseState      string         `json:"reuse_state" db:"reuse_state"` // "", pending or approved
+	ReuseRequested  *time.Time     `json:"reuse_requested_at" db:"reuse_requested_at"`
+	// RemainingBytes is the logical remaining space, capacity minus used.
+	// PhysicalRemainingBytes is what the drive last reported after a write.
+	RemainingBytes         int64      `json:"remaining_bytes" db:"-"`
+	PhysicalRemainingBytes *int64     `json:"physical_remaining_bytes,omitempty" db:"physical_remaining_bytes"`
+	PhysicalRemainingAt    *time.Time `json:"physical_remaining_at,omitempty" db:"physical_remaining_at"`
+	CreatedAt              time.Time  `json:"created_at" db:"created_at"`
+	UpdatedAt              time.Time  `json:"updated_at" db:"updated_at"`
 }
 
 // DriveStatus represents the state of a tape drive
@@ -264,15 +392,20 @@ const (
 type TapeDrive struct {
 	ID            int64            `json:"id" db:"id"`
 	DevicePath    string           `json:"device_path" db:"device_path"`
+	Backend       string           `json:"backend" db:"-"` // storage backend selected by the device path
 	DisplayName   string           `json:"display_name" db:"display_name"`
 	Vendor        string           `json:"vendor" db:"vendor"`
 	SerialNumber  string           `json:"serial_number" db:"serial_number"`
+	WWN           string           `json:"wwn" db:"wwn"`
+	BindingStatus string           `json:"binding_status" db:"binding_status"` // "", "bound" or "missing", see migration 041
 	Model         string           `json:"model" db:"model"`
 	Status        DriveStatus      `json:"status" db:"status"`
 	CurrentTapeID *int64           `json:"current_tape_id" db:"current_tape_id"`
 	CurrentTape   string           `json:"current_tape" db:"-"`
 	UnknownTape   *UnknownTapeInfo `json:"unknown_tape,omitempty" db:"-"`
 	Enabled       bool             `json:"enabled" db:"enabled"`
+	ReservedJobID *int64           `json:"reserved_job_id,omitempty" db:"reserved_job_id"` // backup job writing through the drive
+	ReservedAt    *time.Time       `json:"reserved_at,omitempty" db:"reserved_at"`
 	CreatedAt     time.Time        `json:"created_at" db:"created_at"`
 	UpdatedAt     time.Time        `json:"updated_at" db:"updated_at"`
 }
@@ -309,6 +442,67 @@ const (
 	CompressionZstd CompressionType = "zstd"
 )
 
+// EncryptionFormat identifies the on-tape format of an encrypted backup set
+type EncryptionFormat string
+
+const (
+	// EncryptionFormatStreamV2 is the native chunked AES-256-GCM tar stream.
+	EncryptionFormatStreamV2 EncryptionFormat = "tapebackarr-gcm-stream-v2"
+	// EncryptionFormatOpenSSLCBC is the legacy `openssl enc -aes-256-cbc -pbkdf2` stream.
+	EncryptionFormatOpenSSLCBC EncryptionFormat = "openssl-aes-256-cbc"
+	// EncryptionFormatLTFSFileGCM encrypts each file on an LTFS volume with
+	// AES-256-GCM under a random nonce stored at the start of the file.
+	EncryptionFormatLTFSFileGCM EncryptionFormat = "ltfs-file-aes-256-gcm"
+)
+
+// EncryptionKDF describes how the cipher key is derived from the keystore key
+type EncryptionKDF struct {
+	Algorithm  string `json:"algorithm"`
+	Info       string `json:"info,omitempty"`
+	Iterations int    `json:"iterations,omitempty"`
+	KeyLength  int    `json:"key_length"`
+}
+
+// StreamStage is a processing stage of a backup stream, run between tar and
+// compression. On a job it names the stage and its parameters; on a backup
+// set it also holds the metadata the stage recorded, which a restore needs
+// to reverse it.
+type StreamStage struct {
+	Name     string            `json:"name"`
+	Params   map[string]string `json:"params,omitempty"`
+	Metadata map[string]string `json:"metadata,omitempty"`
+}
+
+// EncryptionMetadata records exactly how a backup set was encrypted, so a
+// restore never relies on defaults of the TapeBackarr version running it.
+// Salt and IV are hex encoded.
+type EncryptionMetadata struct {
+	Format    EncryptionFormat `json:"format"`
+	KDF       EncryptionKDF    `json:"kdf"`
+	Salt      string           `json:"salt,omitempty"`
+	IV        string           `json:"iv,omitempty"`
+	ChunkSize int              `json:"chunk_size,omitempty"`
+}
+
+// KDFJSON returns the KDF parameters as stored in the encryption_kdf column.
+func (m *EncryptionMetadata) KDFJSON() string {
+	data, _ := json.Marshal(m.KDF)
+	return string(data)
+}
+
+// ParseEncryptionMetadata rebuilds metadata from the backup_sets columns.
+// It returns nil for sets written before the metadata was recorded.
+func ParseEncryptionMetadata(format, kdf, salt, iv string, chunkSize int) *EncryptionMetadata {
+	if format == "" {
+		return nil
+	}
+	m := &EncryptionMetadata{Format: EncryptionFormat(format), Salt: salt, IV: iv, ChunkSize: chunkSize}
+	if kdf != "" {
+		_ = json.Unmarshal([]byte(kdf), &m.KDF)
+	}
+	return m
+}
+
 // SourceType represents the type of backup source
 type SourceType string
 
@@ -316,19 +510,44 @@ const (
 	SourceTypeLocal SourceType = "local"
 	SourceTypeSMB   SourceType = "smb"
 	SourceTypeNFS   SourceType = "nfs"
+	// SourceTypeNDMP backs up a NAS over NDMP; the path is an
+	// ndmp://host[:port]/filesystem URL
+	SourceTypeNDMP SourceType = "ndmp"
 )
 
+// SymlinkPolicy controls how symbolic links in a source are backed up
+type SymlinkPolicy string
+
+const (
+	// SymlinkStore archives the link itself; restores recreate the link.
+	SymlinkStore SymlinkPolicy = "store"
+	// SymlinkFollow archives the data the link points to under the link's
+	// name; restores produce regular files and directories.
+	SymlinkFollow SymlinkPolicy = "follow"
+	// SymlinkSkip leaves links out of the backup entirely.
+	SymlinkSkip SymlinkPolicy = "skip"
+)
+
+// IsValid reports whether p is a known symlink policy
+func (p SymlinkPolicy) IsValid() bool {
+	return p == SymlinkStore || p == SymlinkFollow || p == SymlinkSkip
+}
+
 // BackupSource represents a configured backup source
 type BackupSource struct {
-	ID              int64      `json:"id" db:"id"`
-	Name            string     `json:"name" db:"name"`
-	SourceType      SourceType `json:"source_type" db:"source_type"`
-	Path            string     `json:"path" db:"path"`
-	IncludePatterns string     `json:"include_patterns" db:"include_patterns"` // JSON array
-	ExcludePatterns string     `json:"exclude_patterns" db:"exclude_patterns"` // JSON array
-	Enabled         bool       `json:"enabled" db:"enabled"`
-	CreatedAt       time.Time  `json:"created_at" db:"created_at"`
-	UpdatedAt       time.Time  `json:"updated_at" db:"updated_at"`
+	ID              int64         `json:"id" db:"id"`
+	Name            string        `json:"name" db:"name"`
+	SourceType      SourceType    `json:"source_type" db:"source_type"`
+	Path            string        `json:"path" db:"path"`
+	IncludePatterns string        `json:"include_patterns" db:"include_patterns"` // JSON array
+	ExcludePatterns string        `json:"exclude_patterns" db:"exclude_patterns"` // JSON array
+	SymlinkPolicy   SymlinkPolicy `json:"symlink_policy" db:"symlink_policy"`
+	Enabled         bool          `json:"enabled" db:"enabled"`
+	RPOHours        int           `json:"rpo_hours" db:"rpo_hours"`                   // 0 = default, negative = no RPO
+	CredentialID    *int64        `json:"credential_id,omitempty" db:"credential_id"` // login of NDMP and SMB sources
+	MountOptions    string        `json:"mount_options" db:"mount_options"`           // added when mounting SMB and NFS shares
+	CreatedAt       time.Time     `json:"created_at" db:"created_at"`
+	UpdatedAt       time.Time     `json:"updated_at" db:"updated_at"`
 }
 
 // BackupType represents the type of backup
@@ -337,27 +556,77 @@ type BackupType string
 const (
 	BackupTypeFull        BackupType = "full"
 	BackupTypeIncremental BackupType = "incremental"
+	// BackupTypeDifferential backs up the changes since the job's last full
+	// backup, so a restore needs only the full and the latest differential
+	BackupTypeDifferential BackupType = "differential"
+)
+
+// ChangeDetection selects how incremental backups tell that a file changed
+type ChangeDetection string
+
+const (
+	// ChangeDetectionMetadata compares size and modification time only
+	ChangeDetectionMetadata ChangeDetection = "metadata"
+	// ChangeDetectionHash also compares the content hash of every file whose
+	// size and modification time are unchanged, catching in-place edits that
+	// preserved both
+	ChangeDetectionHash ChangeDetection = "hash"
+	// ChangeDetectionHybrid hashes a file with unchanged size and
+	// modification time only when its ctime moved
+	ChangeDetectionHybrid ChangeDetection = "hybrid"
+)
+
+// GuardrailAction decides what happens to a backup run that exceeds its
+// job's guardrails
+type GuardrailAction string
+
+const (
+	// GuardrailConfirm stops the run; the next run goes ahead once confirmed
+	GuardrailConfirm GuardrailAction = "confirm"
+	// GuardrailDryRun ends the run as a report of what it would have written
+	GuardrailDryRun GuardrailAction = "dry_run"
 )
 
 // BackupJob represents a scheduled backup job
 type BackupJob struct {
-	ID                  int64           `json:"id" db:"id"`
-	Name                string          `json:"name" db:"name"`
-	SourceID            int64           `json:"source_id" db:"source_id"`
-	PoolID              int64           `json:"pool_id" db:"pool_id"`
-	BackupType          BackupType      `json:"backup_type" db:"backup_type"`
-	ScheduleCron        string          `json:"schedule_cron" db:"schedule_cron"`
-	RetentionDays       int             `json:"retention_days" db:"retention_days"`
-	Enabled             bool            `json:"enabled" db:"enabled"`
-	EncryptionEnabled   bool            `json:"encryption_enabled" db:"encryption_enabled"`
-	EncryptionKeyID     *int64          `json:"encryption_key_id" db:"encryption_key_id"`
-	HwEncryptionEnabled bool            `json:"hw_encryption_enabled" db:"hw_encryption_enabled"`
-	HwEncryptionKeyID   *int64          `json:"hw_encryption_key_id" db:"hw_encryption_key_id"`
-	Compression         CompressionType `json:"compression" db:"compression"`
-	LastRunAt           *time.Time      `json:"last_run_at" db:"last_run_at"`
-	NextRunAt           *time.Time      `json:"next_run_at" db:"next_run_at"`
-	CreatedAt           time.Time       `json:"created_at" db:"created_at"`
-	UpdatedAt           time.Time       `json:"updated_at" db:"updated_at"`
+	ID                    int64           `json:"id" db:"id"`
+	Name                  string          `json:"name" db:"name"`
+	SourceID              int64           `json:"source_id" db:"source_id"`
+	PoolID                int64           `json:"pool_id" db:"pool_id"`
+	BackupType            BackupType      `json:"backup_type" db:"backup_type"`
+	ScheduleCron          string          `json:"schedule_cron" db:"schedule_cron"`
+	RetentionDays         int             `json:"retention_days" db:"retention_days"`
+	Enabled               bool            `json:"enabled" db:"enabled"`
+	EncryptionEnabled     bool            `json:"encryption_enabled" db:"encryption_enabled"`
+	EncryptionKeyID       *int64          `json:"encryption_key_id" db:"encryption_key_id"`
+	HwEncryptionEnabled   bool            `json:"hw_encryption_enabled" db:"hw_encryption_enabled"`
+	HwEncryptionKeyID     *int64          `json:"hw_encryption_key_id" db:"hw_encryption_key_id"`
+	Compression           CompressionType `json:"compression" db:"compression"`
+	DedupEnabled          bool            `json:"dedup_enabled" db:"dedup_enabled"`
+	PipelinedScan         bool            `json:"pipelined_scan" db:"pipelined_scan"`     // start writing while the source is scanned
+	DirectoryReport       bool            `json:"directory_report" db:"directory_report"` // record usage by top-level directory after each run
+	ChangeDetection       ChangeDetection `json:"change_detection" db:"change_detection"`
+	HashSampled           bool            `json:"hash_sampled" db:"hash_sampled"`                         // hash the start, middle and end of large files only
+	GuardMaxFiles         int64           `json:"guard_max_files" db:"guard_max_files"`                   // 0 = no limit
+	GuardMaxBytes         int64           `json:"guard_max_bytes" db:"guard_max_bytes"`                   // 0 = no limit
+	GuardMaxChangePercent int             `json:"guard_max_change_percent" db:"guard_max_change_percent"` // vs the previous run, 0 = no limit
+	GuardAction           GuardrailAction `json:"guard_action" db:"guard_action"`
+	SnapshotRetention     int             `json:"snapshot_retention" db:"snapshot_retention"`
+	FullEveryIncrementals int             `json:"full_every_incrementals" db:"full_every_incrementals"`
+	FullEveryDays         int             `json:"full_every_days" db:"full_every_days"`
+	SchedulePaused        bool            `json:"schedule_paused" db:"schedule_paused"`
+	OwnerID               *int64          `json:"owner_id" db:"owner_id"`
+	NotifyEmails          string          `json:"notify_emails" db:"notify_emails"`                     // comma-separated
+	NotifyTelegramChatID  string          `json:"notify_telegram_chat_id" db:"notify_telegram_chat_id"` // comma-separated
+	NotifyGlobal          bool            `json:"notify_global" db:"notify_global"`                     // also notify the global channels
+	RPOHours              int             `json:"rpo_hours" db:"rpo_hours"`                             // 0 = the source's RPO, negative = no RPO
+	StreamStages          []StreamStage   `json:"stream_stages,omitempty" db:"stream_stages"`           // applied between tar and compression, in order
+	DriveID               *int64          `json:"drive_id,omitempty" db:"drive_id"`                     // nil = any drive holding the job's tape
+	Priority              int             `json:"priority" db:"priority"`                               // restores with a higher priority may preempt its runs
+	LastRunAt             *time.Time      `json:"last_run_at" db:"last_run_at"`
+	NextRunAt             *time.Time      `json:"next_run_at" db:"next_run_at"`
+	CreatedAt             time.Time       `json:"created_at" db:"created_at"`
+	UpdatedAt             time.Time       `json:"updated_at" db:"updated_at"`
 }
 
 // BackupSetStatus represents the status of a backup set
@@ -373,28 +642,52 @@ const (
 
 // BackupSet represents a single backup operation
 type BackupSet struct {
-	ID                int64           `json:"id" db:"id"`
-	JobID             int64           `json:"job_id" db:"job_id"`
-	TapeID            int64           `json:"tape_id" db:"tape_id"`
-	BackupType        BackupType      `json:"backup_type" db:"backup_type"`
-	FormatType        TapeFormatType  `json:"format_type" db:"format_type"`
-	StartTime         time.Time       `json:"start_time" db:"start_time"`
-	EndTime           *time.Time      `json:"end_time" db:"end_time"`
-	Status            BackupSetStatus `json:"status" db:"status"`
-	FileCount         int64           `json:"file_count" db:"file_count"`
-	TotalBytes        int64           `json:"total_bytes" db:"total_bytes"`
-	StartBlock        int64           `json:"start_block" db:"start_block"`
-	EndBlock          int64           `json:"end_block" db:"end_block"`
-	Checksum          string          `json:"checksum" db:"checksum"`
-	Encrypted         bool            `json:"encrypted" db:"encrypted"`
-	EncryptionKeyID   *int64          `json:"encryption_key_id" db:"encryption_key_id"`
-	HwEncrypted       bool            `json:"hw_encrypted" db:"hw_encrypted"`
-	HwEncryptionKeyID *int64          `json:"hw_encryption_key_id" db:"hw_encryption_key_id"`
-	Compressed        bool            `json:"compressed" db:"compressed"`
-	CompressionType   CompressionType `json:"compression_type" db:"compression_type"`
-	ParentSetID       *int64          `json:"parent_set_id" db:"parent_set_id"`
-	CreatedAt         time.Time       `json:"created_at" db:"created_at"`
-	UpdatedAt         time.Time       `json:"updated_at" db:"updated_at"`
+	ID                 int64               `json:"id" db:"id"`
+	JobID              int64               `json:"job_id" db:"job_id"`
+	TapeID             int64               `json:"tape_id" db:"tape_id"`
+	BackupType         BackupType          `json:"backup_type" db:"backup_type"`
+	FormatType         TapeFormatType      `json:"format_type" db:"format_type"`
+	StartTime          time.Time           `json:"start_time" db:"start_time"`
+	EndTime            *time.Time          `json:"end_time" db:"end_time"`
+	Status             BackupSetStatus     `json:"status" db:"status"`
+	FileCount          int64               `json:"file_count" db:"file_count"`
+	TotalBytes         int64               `json:"total_bytes" db:"total_bytes"`
+	StartBlock         int64               `json:"start_block" db:"start_block"`
+	EndBlock           int64               `json:"end_block" db:"end_block"`
+	Checksum           string              `json:"checksum" db:"checksum"`
+	Encrypted          bool                `json:"encrypted" db:"encrypted"`
+	EncryptionKeyID    *int64              `json:"encryption_key_id" db:"encryption_key_id"`
+	HwEncrypted        bool                `json:"hw_encrypted" db:"hw_encrypted"`
+	HwEncryptionKeyID  *int64              `json:"hw_encryption_key_id" db:"hw_encryption_key_id"`
+	Compressed         bool                `json:"compressed" db:"compressed"`
+	CompressionType    CompressionType     `json:"compression_type" db:"compression_type"`
+	ParentSetID        *int64              `json:"parent_set_id" db:"parent_set_id"`
+	SymlinkPolicy      SymlinkPolicy       `json:"symlink_policy" db:"symlink_policy"`
+	SkippedCount       int64               `json:"skipped_count" db:"skipped_count"`
+	SkipSummary        string              `json:"skip_summary,omitempty" db:"skip_summary"`
+	DeletedCount       int64               `json:"deleted_count" db:"deleted_count"` // files an incremental found deleted since the previous run
+	DedupCount         int64               `json:"dedup_count" db:"dedup_count"`
+	DedupBytes         int64               `json:"dedup_bytes" db:"dedup_bytes"`
+	PromotionReason    string              `json:"promotion_reason,omitempty" db:"promotion_reason"`
+	Guardrail          string              `json:"guardrail,omitempty" db:"guardrail"` // why the run tripped its job's guardrails
+	TapeBytes          int64               `json:"tape_bytes" db:"tape_bytes"`
+	BlockSize          int                 `json:"block_size" db:"block_size"`                   // tape block size written with, 0 if unknown
+	Synthetic          bool                `json:"synthetic" db:"synthetic"`                     // synthesized from a full and incrementals on tape
+	InvalidatedAt      *time.Time          `json:"invalidated_at,omitempty" db:"invalidated_at"` // logically deleted, data still on tape
+	InvalidationReason string              `json:"invalidation_reason,omitempty" db:"invalidation_reason"`
+	ChainBrokenAt      *time.Time          `json:"chain_broken_at,omitempty" db:"chain_broken_at"` // a set it depends on was deleted, expired or erased
+	ChainBrokenReason  string              `json:"chain_broken_reason,omitempty" db:"chain_broken_reason"`
+	CloudCopyURL       string              `json:"cloud_copy_url,omitempty" db:"cloud_copy_url"`       // object uploaded by the cloud_copy stage
+	CloudCopyStatus    string              `json:"cloud_copy_status,omitempty" db:"cloud_copy_status"` // completed or failed, empty without a cloud copy
+	CloudCopyBytes     int64               `json:"cloud_copy_bytes,omitempty" db:"cloud_copy_bytes"`
+	CloudCopyError     string              `json:"cloud_copy_error,omitempty" db:"cloud_copy_error"`
+	CloudCopyAt        *time.Time          `json:"cloud_copy_at,omitempty" db:"cloud_copy_at"`
+	NDMPType           string              `json:"ndmp_type,omitempty" db:"ndmp_type"` // image type of a set backed up over NDMP
+	NDMPLevel          *int                `json:"ndmp_level,omitempty" db:"ndmp_level"`
+	Encryption         *EncryptionMetadata `json:"encryption,omitempty"`
+	StreamStages       []StreamStage       `json:"stream_stages,omitempty" db:"stream_stages"`
+	CreatedAt          time.Time           `json:"created_at" db:"created_at"`
+	UpdatedAt          time.Time           `json:"updated_at" db:"updated_at"`
 }
 
 // CatalogEntry represents a file in the backup catalog
@@ -408,6 +701,22 @@ type CatalogEntry struct {
 	Checksum    string    `json:"checksum" db:"checksum"`
 	BlockOffset int64     `json:"block_offset" db:"block_offset"`
 	CreatedAt   time.Time `json:"created_at" db:"created_at"`
+	// RefBackupSetID and RefFilePath are set on deduplicated entries: the
+	// file's data was not written with this set but lives in the given set.
+	RefBackupSetID *int64 `json:"ref_backup_set_id,omitempty" db:"ref_backup_set_id"`
+	RefFilePath    string `json:"ref_file_path,omitempty" db:"ref_file_path"`
+	// UID and GID are nil for entries cataloged without ownership
+	UID        *int   `json:"uid,omitempty" db:"uid"`
+	GID        *int   `json:"gid,omitempty" db:"gid"`
+	Owner      string `json:"owner,omitempty" db:"owner"`
+	Group      string `json:"group,omitempty" db:"group_name"`
+	FileType   string `json:"file_type,omitempty" db:"file_type"`
+	LinkTarget string `json:"link_target,omitempty" db:"link_target"`
+	HasXattrs  bool   `json:"has_xattrs" db:"has_xattrs"`
+	// Extension is lower case without the dot; ContentClass is a coarse
+	// type derived from it, such as image, video or database
+	Extension    string `json:"extension,omitempty" db:"extension"`
+	ContentClass string `json:"content_class,omitempty" db:"content_class"`
 	// Tape info populated from backup_set -> tape join for restore display
 	TapeID    int64  `json:"tape_id,omitempty"`
 	TapeLabel string `json:"tape_label,omitempty"`
@@ -523,8 +832,89 @@ const (
 	RestoreDestLocal RestoreDestinationType = "local"
 	RestoreDestSMB   RestoreDestinationType = "smb"
 	RestoreDestNFS   RestoreDestinationType = "nfs"
+	RestoreDestSSH   RestoreDestinationType = "ssh"
 )
 
+// IsRemote reports whether the destination is a remote target that
+// TapeBackarr connects to itself rather than a local path
+func (t RestoreDestinationType) IsRemote() bool {
+	return t == RestoreDestSMB || t == RestoreDestNFS || t == RestoreDestSSH
+}
+
+// RestoreTarget is a saved remote restore destination. TapeBackarr mounts SMB
+// and NFS targets itself and streams to SSH targets with rsync, so restores
+// can be delivered straight to the original share. The secret (SMB password
+// or SSH private key) is never returned by the API.
+type RestoreTarget struct {
+	ID           int64                  `json:"id" db:"id"`
+	Name         string                 `json:"name" db:"name"`
+	TargetType   RestoreDestinationType `json:"target_type" db:"target_type"`
+	Host         string                 `json:"host" db:"host"`
+	Port         int                    `json:"port,omitempty" db:"port"`
+	Share        string                 `json:"share,omitempty" db:"share"` // SMB share name or NFS export path
+	BasePath     string                 `json:"base_path,omitempty" db:"base_path"`
+	Username     string                 `json:"username,omitempty" db:"username"`
+	Domain       string                 `json:"domain,omitempty" db:"domain"`
+	Secret       string                 `json:"-" db:"secret"`
+	HasSecret    bool                   `json:"has_secret" db:"-"`
+	CredentialID *int64                 `json:"credential_id,omitempty" db:"credential_id"` // overrides username, domain and secret
+	MountOptions string                 `json:"mount_options,omitempty" db:"mount_options"`
+	Enabled      bool                   `json:"enabled" db:"enabled"`
+	CreatedAt    time.Time              `json:"created_at" db:"created_at"`
+	UpdatedAt    time.Time              `json:"updated_at" db:"updated_at"`
+}
+
+// ProxmoxCluster is a Proxmox VE cluster or standalone node registered
+// through the API. Its credential is a password credential (username and
+// realm in domain) or a token credential (token ID in username).
+type ProxmoxCluster struct {
+	ID            int64     `json:"id" db:"id"`
+	Name          string    `json:"name" db:"name"`
+	Host          string    `json:"host" db:"host"`
+	Port          int       `json:"port" db:"port"`
+	SkipTLSVerify bool      `json:"skip_tls_verify" db:"skip_tls_verify"`
+	CredentialID  int64     `json:"credential_id" db:"credential_id"`
+	Enabled       bool      `json:"enabled" db:"enabled"`
+	CreatedAt     time.Time `json:"created_at" db:"created_at"`
+	UpdatedAt     time.Time `json:"updated_at" db:"updated_at"`
+}
+
+// CredentialType is the kind of secret a credential holds
+type CredentialType string
+
+const (
+	CredentialPassword CredentialType = "password"
+	CredentialSSHKey   CredentialType = "ssh_key"
+	CredentialToken    CredentialType = "token"
+)
+
+// Credential is a named secret in the credentials store. The secret is kept
+// encrypted and is never returned by the API.
+type Credential struct {
+	ID             int64          `json:"id" db:"id"`
+	Name           string         `json:"name" db:"name"`
+	CredentialType CredentialType `json:"credential_type" db:"credential_type"`
+	Username       string         `json:"username,omitempty" db:"username"`
+	Domain         string         `json:"domain,omitempty" db:"domain"`
+	Description    string         `json:"description,omitempty" db:"description"`
+	HasSecret      bool           `json:"has_secret" db:"-"`
+	LastUsedAt     *time.Time     `json:"last_used_at,omitempty" db:"last_used_at"`
+	CreatedAt      time.Time      `json:"created_at" db:"created_at"`
+	UpdatedAt      time.Time      `json:"updated_at" db:"updated_at"`
+}
+
+// CredentialUsage records one use of a credential's secret
+type CredentialUsage struct {
+	ID           int64     `json:"id" db:"id"`
+	CredentialID int64     `json:"credential_id" db:"credential_id"`
+	UsedByType   string    `json:"used_by_type" db:"used_by_type"`
+	UsedByID     *int64    `json:"used_by_id,omitempty" db:"used_by_id"`
+	Purpose      string    `json:"purpose" db:"purpose"`
+	Success      bool      `json:"success" db:"success"`
+	Error        string    `json:"error,omitempty" db:"error"`
+	CreatedAt    time.Time `json:"created_at" db:"created_at"`
+}
+
 // RestoreOperation represents a tracked restore operation
 type RestoreOperation struct {
 	ID              int64                  `json:"id" db:"id"`
@@ -587,12 +977,15 @@ type DriveStatistics struct {
 
 // APIKey represents an API key for programmatic access
 type APIKey struct {
-	ID         int64      `json:"id" db:"id"`
-	Name       string     `json:"name" db:"name"`
-	KeyHash    string     `json:"-" db:"key_hash"`
-	KeyPrefix  string     `json:"key_prefix" db:"key_prefix"` // First 8 chars for identification
-	Role       UserRole   `json:"role" db:"role"`
-	LastUsedAt *time.Time `json:"last_used_at" db:"last_used_at"`
-	ExpiresAt  *time.Time `json:"expires_at" db:"expires_at"`
-	CreatedAt  time.Time  `json:"created_at" db:"created_at"`
+	ID        int64    `json:"id" db:"id"`
+	Name      string   `json:"name" db:"name"`
+	KeyHash   string   `json:"-" db:"key_hash"`
+	KeyPrefix string   `json:"key_prefix" db:"key_prefix"` // First 8 chars for identification
+	Role      UserRole `json:"role" db:"role"`
+	// AllowedCIDRs lists the networks the key may call admin endpoints and
+	// destructive operations from, comma-separated; empty = any
+	AllowedCIDRs string     `json:"allowed_cidrs" db:"allowed_cidrs"`
+	LastUsedAt   *time.Time `json:"last_used_at" db:"last_used_at"`
+	ExpiresAt    *time.Time `json:"expires_at" db:"expires_at"`
+	CreatedAt    time.Time  `json:"created_at" db:"created_at"`
 }
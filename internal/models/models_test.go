@@ -187,3 +187,55 @@ func TestCheckLTFSCompat(t *testing.T) {
 		})
 	}
 }
+
+func TestLTOTypeFromDriveModel(t *testing.T) {
+	tests := []struct {
+		model string
+		want  string
+	}{
+		{"ULTRIUM-HH8", "LTO-8"},
+		{"ULT3580-TD9", "LTO-9"},
+		{"Ultrium 7-SCSI", "LTO-7"},
+		{"ULTRIUM-TD5", "LTO-5"},
+		{"LTO-6 HH", "LTO-6"},
+		{"ULTRIUM 10", "LTO-10"},
+		{"DAT160", ""},
+		{"", ""},
+		{"ULTRIUM-HH12", ""},
+	}
+	for _, tt := range tests {
+		got, ok := LTOTypeFromDriveModel(tt.model)
+		if got != tt.want || ok != (tt.want != "") {
+			t.Errorf("LTOTypeFromDriveModel(%q) = %q, %v; want %q", tt.model, got, ok, tt.want)
+		}
+	}
+}
+
+func TestCheckLTOCompatibility(t *testing.T) {
+	tests := []struct {
+		drive, media      string
+		canRead, canWrite bool
+	}{
+		{"LTO-6", "LTO-6", true, true},
+		{"LTO-6", "LTO-5", true, true},
+		{"LTO-6", "LTO-4", true, false},
+		{"LTO-6", "LTO-3", false, false},
+		{"LTO-6", "LTO-7", false, false},
+		{"LTO-8", "LTO-7", true, true},
+		{"LTO-8", "LTO-6", false, false},
+		{"LTO-9", "LTO-8", true, true},
+		{"LTO-9", "LTO-7", false, false},
+		{"LTO-10", "LTO-10", true, true},
+		{"LTO-10", "LTO-9", false, false},
+		{"", "LTO-7", true, true},
+		{"LTO-9", "", true, true},
+	}
+	for _, tt := range tests {
+		readErr := CheckLTOCompatibility(tt.drive, tt.media, false)
+		writeErr := CheckLTOCompatibility(tt.drive, tt.media, true)
+		if (readErr == nil) != tt.canRead || (writeErr == nil) != tt.canWrite {
+			t.Errorf("%s drive with %s media: read err %v, write err %v; want read %v write %v",
+				tt.drive, tt.media, readErr, writeErr, tt.canRead, tt.canWrite)
+		}
+	}
+}
@@ -0,0 +1,351 @@
+package ndmp
+
+import (
+	"context"
+	"crypto/md5"
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// HaltReason is why the data service stopped
+type HaltReason uint32
+
+// Halt reasons
+const (
+	HaltSuccessful    HaltReason = 1
+	HaltAborted       HaltReason = 2
+	HaltInternalError HaltReason = 3
+	HaltConnectError  HaltReason = 4
+)
+
+func (r HaltReason) String() string {
+	switch r {
+	case HaltSuccessful:
+		return "successful"
+	case HaltAborted:
+		return "aborted"
+	case HaltInternalError:
+		return "internal error"
+	case HaltConnectError:
+		return "connection error"
+	}
+	return fmt.Sprintf("reason %d", uint32(r))
+}
+
+// Env is a backup environment variable
+type Env struct {
+	Name, Value string
+}
+
+// Options are the credentials and callbacks of a connection
+type Options struct {
+	Username string
+	Password string
+	// Auth is AuthText or AuthMD5 (the default), where the password is
+	// never sent
+	Auth string
+	// Log receives the log messages of the server
+	Log func(msg string)
+}
+
+// Authentication methods of Options.Auth
+const (
+	AuthMD5  = "md5"
+	AuthText = "text"
+)
+
+// handshakeTimeout bounds the server's greeting
+const handshakeTimeout = 30 * time.Second
+
+type reply struct {
+	hdr  Header
+	body []byte
+}
+
+// Client is a control connection to the NDMP server of a NAS
+type Client struct {
+	conn net.Conn
+	opts Options
+
+	wmu sync.Mutex
+	seq atomic.Uint32
+
+	mu      sync.Mutex
+	pending map[uint32]chan reply
+	readErr error
+
+	history history
+	halted  chan HaltReason
+	closed  chan struct{}
+}
+
+// Dial connects and authenticates to the NDMP server at addr (host:port)
+func Dial(ctx context.Context, addr string, opts Options) (*Client, error) {
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to NDMP server %s: %w", addr, err)
+	}
+
+	// The server greets with its connection status
+	deadline := time.Now().Add(handshakeTimeout)
+	if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+		deadline = d
+	}
+	conn.SetReadDeadline(deadline)
+	h, body, err := ReadMessage(conn)
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("no greeting from NDMP server %s: %w", addr, err)
+	}
+	conn.SetReadDeadline(time.Time{})
+	if h.Message != MsgNotifyConnectionStatus {
+		conn.Close()
+		return nil, fmt.Errorf("unexpected greeting 0x%x from NDMP server %s", h.Message, addr)
+	}
+	d := NewDecoder(body)
+	reason, _, text := d.Uint32(), d.Uint32(), d.Text()
+	if reason != 0 {
+		conn.Close()
+		return nil, fmt.Errorf("NDMP server %s refused the connection: %s", addr, text)
+	}
+
+	c := &Client{
+		conn:    conn,
+		opts:    opts,
+		pending: make(map[uint32]chan reply),
+		halted:  make(chan HaltReason, 1),
+		closed:  make(chan struct{}),
+	}
+	go c.readLoop()
+
+	if err := c.callErr(ctx, MsgConnectOpen, (&Encoder{}).Uint32(ProtocolVersion).Bytes()); err != nil {
+		c.conn.Close()
+		return nil, fmt.Errorf("NDMP server %s does not accept version %d: %w", addr, ProtocolVersion, err)
+	}
+	if err := c.authenticate(ctx); err != nil {
+		c.conn.Close()
+		return nil, fmt.Errorf("authentication to NDMP server %s failed: %w", addr, err)
+	}
+	return c, nil
+}
+
+func (c *Client) authenticate(ctx context.Context) error {
+	e := &Encoder{}
+	if c.opts.Auth == AuthText {
+		e.Uint32(AuthTypeText).Text(c.opts.Username).Text(c.opts.Password)
+	} else {
+		d, err := c.call(ctx, MsgConfigGetAuthAttr, (&Encoder{}).Uint32(AuthTypeMD5).Bytes())
+		if err != nil {
+			return err
+		}
+		if e := Error(d.Uint32()); e != ErrNone {
+			return e
+		}
+		if d.Uint32() != AuthTypeMD5 {
+			return errors.New("server did not return an MD5 challenge")
+		}
+		challenge := d.Opaque(64)
+		if d.Err() != nil {
+			return d.Err()
+		}
+		digest := AuthDigest(challenge, c.opts.Password)
+		e.Uint32(AuthTypeMD5).Text(c.opts.Username).Opaque(digest[:])
+	}
+	return c.callErr(ctx, MsgConnectClientAuth, e.Bytes())
+}
+
+// AuthDigest computes the response to an MD5 challenge as NDMP defines it:
+// the MD5 of the password, the challenge and the password again, laid out
+// in 128 bytes
+func AuthDigest(challenge []byte, password string) [16]byte {
+	pw := []byte(password)
+	if len(pw) > 32 {
+		pw = pw[:32]
+	}
+	var msg [128]byte
+	copy(msg[:], pw)
+	copy(msg[128-len(pw):], pw)
+	copy(msg[64-len(pw):], challenge)
+	return md5.Sum(msg[:])
+}
+
+// readLoop dispatches replies to their callers and handles the requests
+// the server sends: notifications, log messages and file history
+func (c *Client) readLoop() {
+	for {
+		h, body, err := ReadMessage(c.conn)
+		if err != nil {
+			c.mu.Lock()
+			c.readErr = err
+			c.mu.Unlock()
+			close(c.closed)
+			return
+		}
+		if h.Type == MessageReply {
+			c.mu.Lock()
+			ch := c.pending[h.ReplySequence]
+			delete(c.pending, h.ReplySequence)
+			c.mu.Unlock()
+			if ch != nil {
+				ch <- reply{h, body}
+			}
+			continue
+		}
+		d := NewDecoder(body)
+		switch h.Message {
+		case MsgNotifyDataHalted:
+			select {
+			case c.halted <- HaltReason(d.Uint32()):
+			default:
+			}
+		case MsgLogMessage:
+			d.Uint32() // log_type
+			d.Uint32() // message_id
+			if msg := d.Text(); c.opts.Log != nil {
+				c.opts.Log(msg)
+			}
+		case MsgLogFile:
+			name := d.Text()
+			if e := Error(d.Uint32()); e != ErrNone && c.opts.Log != nil {
+				c.opts.Log(fmt.Sprintf("%s: %v", name, e))
+			}
+		case MsgFhAddFile, MsgFhAddDir, MsgFhAddNode:
+			if err := c.history.add(h.Message, d); err != nil && c.opts.Log != nil {
+				c.opts.Log("Unreadable file history: " + err.Error())
+			}
+		}
+	}
+}
+
+// call sends a request and waits for its reply. A reply carrying an error
+// in its header is returned as that error.
+func (c *Client) call(ctx context.Context, msg uint32, body []byte) (*Decoder, error) {
+	seq := c.seq.Add(1)
+	ch := make(chan reply, 1)
+	c.mu.Lock()
+	if c.readErr != nil {
+		c.mu.Unlock()
+		return nil, fmt.Errorf("connection lost: %w", c.readErr)
+	}
+	c.pending[seq] = ch
+	c.mu.Unlock()
+
+	c.wmu.Lock()
+	err := WriteMessage(c.conn, Header{Sequence: seq, Timestamp: uint32(time.Now().Unix()), Type: MessageRequest, Message: msg}, body)
+	c.wmu.Unlock()
+	if err != nil {
+		return nil, err
+	}
+	select {
+	case r := <-ch:
+		if r.hdr.Error != 0 {
+			return nil, Error(r.hdr.Error)
+		}
+		return NewDecoder(r.body), nil
+	case <-c.closed:
+		return nil, fmt.Errorf("connection lost: %w", c.Err())
+	case <-ctx.Done():
+		c.mu.Lock()
+		delete(c.pending, seq)
+		c.mu.Unlock()
+		return nil, ctx.Err()
+	}
+}
+
+// callErr sends a request whose reply holds only an error code
+func (c *Client) callErr(ctx context.Context, msg uint32, body []byte) error {
+	d, err := c.call(ctx, msg, body)
+	if err != nil {
+		return err
+	}
+	if e := Error(d.Uint32()); e != ErrNone {
+		return e
+	}
+	return d.Err()
+}
+
+// DataConnect has the data service connect to addr, where the image of the
+// backup is received. Only IPv4 addresses can be given in NDMP version 4.
+func (c *Client) DataConnect(ctx context.Context, addr *net.TCPAddr) error {
+	ip := addr.IP.To4()
+	if ip == nil {
+		return fmt.Errorf("data address %s is not an IPv4 address", addr)
+	}
+	e := &Encoder{}
+	e.Uint32(1) // NDMP4_ADDR_TCP
+	e.Uint32(1) // one address
+	e.Uint32(uint32(ip[0])<<24 | uint32(ip[1])<<16 | uint32(ip[2])<<8 | uint32(ip[3]))
+	e.Uint32(uint32(addr.Port))
+	e.Uint32(0) // no addr_env
+	if err := c.callErr(ctx, MsgDataConnect, e.Bytes()); err != nil {
+		return fmt.Errorf("data connect to %s failed: %w", addr, err)
+	}
+	return nil
+}
+
+// StartBackup starts a backup of the given type (dump, tar, ...) with its
+// environment. The image is sent to the address given to DataConnect.
+func (c *Client) StartBackup(ctx context.Context, buType string, env []Env) error {
+	e := &Encoder{}
+	e.Text(buType)
+	e.Uint32(uint32(len(env)))
+	for _, v := range env {
+		e.Text(v.Name).Text(v.Value)
+	}
+	if err := c.callErr(ctx, MsgDataStartBackup, e.Bytes()); err != nil {
+		return fmt.Errorf("failed to start %s backup: %w", buType, err)
+	}
+	return nil
+}
+
+// Halted is signalled with the reason once the data service stops
+func (c *Client) Halted() <-chan HaltReason {
+	return c.halted
+}
+
+// Done is closed when the connection is lost
+func (c *Client) Done() <-chan struct{} {
+	return c.closed
+}
+
+// Err returns why the connection was lost
+func (c *Client) Err() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.readErr
+}
+
+// LocalAddr returns the local address of the control connection, which
+// the NAS can reach
+func (c *Client) LocalAddr() net.Addr {
+	return c.conn.LocalAddr()
+}
+
+// Abort stops a running backup
+func (c *Client) Abort(ctx context.Context) error {
+	return c.callErr(ctx, MsgDataAbort, nil)
+}
+
+// Stop returns a halted data service to idle
+func (c *Client) Stop(ctx context.Context) error {
+	return c.callErr(ctx, MsgDataStop, nil)
+}
+
+// Files returns the file history received so far, with paths relative to
+// root, the file system that was backed up
+func (c *Client) Files(root string) []File {
+	return c.history.resolve(root)
+}
+
+// Close ends the session
+func (c *Client) Close() error {
+	c.wmu.Lock()
+	WriteMessage(c.conn, Header{Sequence: c.seq.Add(1), Timestamp: uint32(time.Now().Unix()), Type: MessageRequest, Message: MsgConnectClose}, nil)
+	c.wmu.Unlock()
+	return c.conn.Close()
+}
@@ -0,0 +1,121 @@
+package ndmp_test
+
+import (
+	"context"
+	"io"
+	"net"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/RoseOO/TapeBackarr/internal/ndmp"
+	"github.com/RoseOO/TapeBackarr/internal/ndmp/ndmptest"
+)
+
+func TestBackup(t *testing.T) {
+	srv, err := ndmptest.NewServer("ndmp", "secret")
+	if err != nil {
+		t.Fatalf("NewServer: %v", err)
+	}
+	defer srv.Close()
+	mtime := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	srv.Image = []byte(strings.Repeat("image", 1000))
+	srv.Files = []ndmp.File{
+		{Path: "docs", Type: ndmp.FileDir, Mode: 0755, MTime: mtime},
+		{Path: "docs/report.pdf", Type: ndmp.FileRegular, Size: 1234, Mode: 0640, MTime: mtime, UID: 1000, GID: 100},
+		{Path: "notes.txt", Type: ndmp.FileRegular, Size: 5, Mode: 0644, MTime: mtime},
+	}
+
+	for _, tc := range []struct {
+		name string
+		auth string
+		node bool
+	}{
+		{"md5 auth, path history", ndmp.AuthMD5, false},
+		{"text auth, node history", ndmp.AuthText, true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			srv.NodeHistory = tc.node
+			ctx := context.Background()
+			var logs []string
+			c, err := ndmp.Dial(ctx, srv.Addr, ndmp.Options{Username: "ndmp", Password: "secret", Auth: tc.auth, Log: func(msg string) { logs = append(logs, msg) }})
+			if err != nil {
+				t.Fatalf("Dial: %v", err)
+			}
+			defer c.Close()
+
+			ln, err := net.ListenTCP("tcp", &net.TCPAddr{IP: net.IPv4(127, 0, 0, 1)})
+			if err != nil {
+				t.Fatalf("Listen: %v", err)
+			}
+			defer ln.Close()
+			if err := c.DataConnect(ctx, ln.Addr().(*net.TCPAddr)); err != nil {
+				t.Fatalf("DataConnect: %v", err)
+			}
+			data, err := ln.Accept()
+			if err != nil {
+				t.Fatalf("Accept: %v", err)
+			}
+			if err := c.StartBackup(ctx, "dump", []ndmp.Env{{Name: "FILESYSTEM", Value: "/vol/vol1"}, {Name: "LEVEL", Value: "0"}}); err != nil {
+				t.Fatalf("StartBackup: %v", err)
+			}
+			image, _ := io.ReadAll(data)
+			if string(image) != string(srv.Image) {
+				t.Errorf("expected the image over the data connection, got %d bytes", len(image))
+			}
+			if reason := <-c.Halted(); reason != ndmp.HaltSuccessful {
+				t.Errorf("expected a successful halt, got %v", reason)
+			}
+			if err := c.Stop(ctx); err != nil {
+				t.Errorf("Stop: %v", err)
+			}
+			if typ, env := srv.LastBackup(); typ != "dump" || env["LEVEL"] != "0" {
+				t.Errorf("unexpected backup %s %v", typ, env)
+			}
+
+			files := c.Files("/vol/vol1")
+			sort.Slice(files, func(i, j int) bool { return files[i].Path < files[j].Path })
+			if len(files) != 3 {
+				t.Fatalf("expected 3 files in the history, got %+v", files)
+			}
+			f := files[1]
+			if f.Path != "docs/report.pdf" || f.Type != ndmp.FileRegular || f.Size != 1234 || f.Mode != 0640 || !f.MTime.Equal(mtime) || f.UID != 1000 || f.GID != 100 {
+				t.Errorf("unexpected file %+v", f)
+			}
+			if len(logs) == 0 {
+				t.Error("expected the server's log message")
+			}
+		})
+	}
+}
+
+func TestDialWrongPassword(t *testing.T) {
+	srv, err := ndmptest.NewServer("ndmp", "secret")
+	if err != nil {
+		t.Fatalf("NewServer: %v", err)
+	}
+	defer srv.Close()
+	if _, err := ndmp.Dial(context.Background(), srv.Addr, ndmp.Options{Username: "ndmp", Password: "wrong"}); err == nil || !strings.Contains(err.Error(), "not authorized") {
+		t.Errorf("expected the login to be refused, got %v", err)
+	}
+}
+
+func TestParseURL(t *testing.T) {
+	target, err := ndmp.ParseURL("ndmp://nas.example.com/vol/vol1")
+	if err != nil {
+		t.Fatalf("ParseURL: %v", err)
+	}
+	if target.Addr != "nas.example.com:10000" || target.Filesystem != "/vol/vol1" || target.Type != "dump" || target.Auth != ndmp.AuthMD5 {
+		t.Errorf("unexpected defaults %+v", target)
+	}
+	target, err = ndmp.ParseURL("ndmp://10.0.0.5:10001/volume1/share?type=tar&auth=text")
+	if err != nil || target.Addr != "10.0.0.5:10001" || target.Type != "tar" || target.Auth != ndmp.AuthText {
+		t.Errorf("unexpected target %+v (%v)", target, err)
+	}
+	for _, raw := range []string{"/vol/vol1", "ndmp://nas", "ndmp://nas/vol?auth=plain", "ndmp://nas/vol?level=1"} {
+		if _, err := ndmp.ParseURL(raw); err == nil {
+			t.Errorf("expected %q to be rejected", raw)
+		}
+	}
+}
@@ -0,0 +1,207 @@
+package ndmp
+
+import (
+	"path"
+	"strings"
+	"sync"
+	"time"
+)
+
+// FileType is the type of a file in the file history
+type FileType uint32
+
+// File types
+const (
+	FileDir      FileType = 0
+	FileFIFO     FileType = 1
+	FileCharDev  FileType = 2
+	FileBlockDev FileType = 3
+	FileRegular  FileType = 4
+	FileSymlink  FileType = 5
+	FileSocket   FileType = 6
+	FileRegistry FileType = 7
+	FileOther    FileType = 8
+)
+
+// File is an entry of the file history
+type File struct {
+	// Path is relative to the file system backed up
+	Path  string
+	Type  FileType
+	Size  int64
+	Mode  uint32 // permission bits
+	MTime time.Time
+	UID   uint32
+	GID   uint32
+}
+
+// fileStat is an ndmp4_file_stat
+type fileStat struct {
+	ftype FileType
+	mtime uint32
+	owner uint32
+	group uint32
+	fattr uint32
+	size  uint64
+}
+
+// history collects the file history a backup sends. Servers report either
+// whole paths (FH_ADD_FILE) or directory entries and inodes separately
+// (FH_ADD_DIR and FH_ADD_NODE), as dump does; the latter are joined into
+// paths once the backup has finished.
+type history struct {
+	mu       sync.Mutex
+	files    []File
+	dirs     map[uint64]dirEntry
+	nodes    map[uint64]fileStat
+	root     uint64
+	haveRoot bool
+}
+
+type dirEntry struct {
+	name   string
+	parent uint64
+}
+
+func decodeNames(d *Decoder) []string {
+	n := d.Count()
+	names := make([]string, 0, n)
+	for i := 0; i < n; i++ {
+		switch d.Uint32() {
+		case 1: // NT: nt_path and dos_path
+			names = append(names, d.Text())
+			d.Text()
+		default: // UNIX and other file systems
+			names = append(names, d.Text())
+		}
+	}
+	return names
+}
+
+func decodeStats(d *Decoder) []fileStat {
+	n := d.Count()
+	stats := make([]fileStat, 0, n)
+	for i := 0; i < n; i++ {
+		d.Uint32() // invalid
+		d.Uint32() // fs_type
+		var st fileStat
+		st.ftype = FileType(d.Uint32())
+		st.mtime = d.Uint32()
+		d.Uint32() // atime
+		d.Uint32() // ctime
+		st.owner = d.Uint32()
+		st.group = d.Uint32()
+		st.fattr = d.Uint32()
+		st.size = d.Uint64()
+		d.Uint32() // links
+		stats = append(stats, st)
+	}
+	return stats
+}
+
+// add records an FH_ADD_FILE, FH_ADD_DIR or FH_ADD_NODE message
+func (h *history) add(msg uint32, d *Decoder) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.dirs == nil {
+		h.dirs = make(map[uint64]dirEntry)
+		h.nodes = make(map[uint64]fileStat)
+	}
+	n := d.Count()
+	for i := 0; i < n && d.Err() == nil; i++ {
+		switch msg {
+		case MsgFhAddFile:
+			names, stats := decodeNames(d), decodeStats(d)
+			d.Uint64() // node
+			d.Uint64() // fh_info
+			if len(names) > 0 && len(stats) > 0 {
+				h.files = append(h.files, stats[0].file(names[0]))
+			}
+		case MsgFhAddDir:
+			names := decodeNames(d)
+			node, parent := d.Uint64(), d.Uint64()
+			if len(names) == 0 {
+				continue
+			}
+			if node == parent {
+				h.root, h.haveRoot = node, true
+				continue
+			}
+			if names[0] != "." && names[0] != ".." {
+				h.dirs[node] = dirEntry{name: names[0], parent: parent}
+			}
+		case MsgFhAddNode:
+			stats := decodeStats(d)
+			node := d.Uint64()
+			d.Uint64() // fh_info
+			if len(stats) > 0 {
+				h.nodes[node] = stats[0]
+			}
+		}
+	}
+	return d.Err()
+}
+
+func (st fileStat) file(name string) File {
+	return File{
+		Path:  name,
+		Type:  st.ftype,
+		Size:  int64(st.size),
+		Mode:  st.fattr & 07777,
+		MTime: time.Unix(int64(st.mtime), 0),
+		UID:   st.owner,
+		GID:   st.group,
+	}
+}
+
+// resolve returns the files of the history with their paths relative to
+// root, the file system backed up
+func (h *history) resolve(root string) []File {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	files := make([]File, 0, len(h.files)+len(h.nodes))
+	for _, f := range h.files {
+		if f.Path = relPath(root, f.Path); f.Path != "" {
+			files = append(files, f)
+		}
+	}
+	for node, st := range h.nodes {
+		if p, ok := h.nodePath(node); ok {
+			files = append(files, st.file(p))
+		}
+	}
+	return files
+}
+
+// nodePath joins the names from the root down to node
+func (h *history) nodePath(node uint64) (string, bool) {
+	var parts []string
+	for depth := 0; depth < 4096; depth++ {
+		if h.haveRoot && node == h.root {
+			if len(parts) == 0 {
+				return "", false
+			}
+			for i, j := 0, len(parts)-1; i < j; i, j = i+1, j-1 {
+				parts[i], parts[j] = parts[j], parts[i]
+			}
+			return path.Join(parts...), true
+		}
+		e, ok := h.dirs[node]
+		if !ok {
+			return "", false
+		}
+		parts = append(parts, e.name)
+		node = e.parent
+	}
+	return "", false
+}
+
+// relPath makes a path reported by the server relative to root
+func relPath(root, name string) string {
+	name = path.Clean("/" + name)
+	root = path.Clean("/" + root)
+	if root != "/" && (name == root || strings.HasPrefix(name, root+"/")) {
+		name = strings.TrimPrefix(name, root)
+	}
+	return strings.TrimPrefix(name, "/")
+}
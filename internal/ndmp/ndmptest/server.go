@@ -0,0 +1,260 @@
+// Package ndmptest provides a minimal NDMP data server for tests, in the
+// manner of net/http/httptest.
+package ndmptest
+
+import (
+	"crypto/rand"
+	"net"
+	"path"
+	"strings"
+	"sync"
+
+	"github.com/RoseOO/TapeBackarr/internal/ndmp"
+)
+
+// Server answers one NDMP session at a time. It authenticates the client
+// and, when a backup starts, connects to the data address, sends the file
+// history and the image, and reports the data service halted.
+type Server struct {
+	// Addr is the host:port the server listens on
+	Addr     string
+	Username string
+	Password string
+	// Image is the backup image sent over the data connection
+	Image []byte
+	// Files is sent as the file history: as whole paths under the backed up
+	// file system, or with NodeHistory as directory entries and nodes, the
+	// way dump reports them
+	Files       []ndmp.File
+	NodeHistory bool
+	// Halt is reported when the image was sent; successful when zero
+	Halt ndmp.HaltReason
+
+	ln  net.Listener
+	mu  sync.Mutex
+	typ string
+	env map[string]string
+}
+
+// NewServer starts a server on a local port
+func NewServer(username, password string) (*Server, error) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, err
+	}
+	s := &Server{Addr: ln.Addr().String(), Username: username, Password: password, ln: ln}
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			s.serve(conn)
+		}
+	}()
+	return s, nil
+}
+
+// Close stops the server
+func (s *Server) Close() {
+	s.ln.Close()
+}
+
+// LastBackup returns the type and environment of the last backup started
+func (s *Server) LastBackup() (string, map[string]string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.typ, s.env
+}
+
+// session is one control connection
+type session struct {
+	conn net.Conn
+	wmu  sync.Mutex
+	seq  uint32
+}
+
+func (ss *session) send(typ, msg, replyTo uint32, errCode ndmp.Error, body *ndmp.Encoder) {
+	ss.wmu.Lock()
+	defer ss.wmu.Unlock()
+	ss.seq++
+	var b []byte
+	if body != nil {
+		b = body.Bytes()
+	}
+	ndmp.WriteMessage(ss.conn, ndmp.Header{Sequence: ss.seq, Type: typ, Message: msg, ReplySequence: replyTo, Error: uint32(errCode)}, b)
+}
+
+func (s *Server) serve(conn net.Conn) {
+	defer conn.Close()
+	ss := &session{conn: conn}
+	ss.send(ndmp.MessageRequest, ndmp.MsgNotifyConnectionStatus, 0, 0, (&ndmp.Encoder{}).Uint32(0).Uint32(ndmp.ProtocolVersion).Text(""))
+
+	challenge := make([]byte, 64)
+	rand.Read(challenge)
+	var authed bool
+	var data net.Conn
+	defer func() {
+		if data != nil {
+			data.Close()
+		}
+	}()
+	for {
+		h, body, err := ndmp.ReadMessage(conn)
+		if err != nil {
+			return
+		}
+		d := ndmp.NewDecoder(body)
+		result := func(e ndmp.Error) {
+			ss.send(ndmp.MessageReply, h.Message, h.Sequence, 0, (&ndmp.Encoder{}).Uint32(uint32(e)))
+		}
+		switch h.Message {
+		case ndmp.MsgConnectOpen:
+			if d.Uint32() != ndmp.ProtocolVersion {
+				result(28)
+				continue
+			}
+			result(ndmp.ErrNone)
+		case ndmp.MsgConfigGetAuthAttr:
+			ss.send(ndmp.MessageReply, h.Message, h.Sequence, 0, (&ndmp.Encoder{}).Uint32(0).Uint32(ndmp.AuthTypeMD5).Opaque(challenge))
+		case ndmp.MsgConnectClientAuth:
+			typ, user := d.Uint32(), d.Text()
+			switch typ {
+			case ndmp.AuthTypeText:
+				authed = user == s.Username && d.Text() == s.Password
+			case ndmp.AuthTypeMD5:
+				digest := ndmp.AuthDigest(challenge, s.Password)
+				authed = user == s.Username && string(d.Opaque(16)) == string(digest[:])
+			}
+			if !authed {
+				result(ndmp.ErrNotAuthorized)
+				continue
+			}
+			result(ndmp.ErrNone)
+		case ndmp.MsgDataConnect:
+			if !authed {
+				result(ndmp.ErrNotAuthorized)
+				continue
+			}
+			d.Uint32() // address type
+			d.Count()
+			ip, port := d.Uint32(), d.Uint32()
+			addr := &net.TCPAddr{IP: net.IPv4(byte(ip>>24), byte(ip>>16), byte(ip>>8), byte(ip)), Port: int(port)}
+			if data, err = net.DialTCP("tcp", nil, addr); err != nil {
+				result(23)
+				continue
+			}
+			result(ndmp.ErrNone)
+		case ndmp.MsgDataStartBackup:
+			if data == nil {
+				result(ndmp.ErrIllegalState)
+				continue
+			}
+			typ := d.Text()
+			env := make(map[string]string)
+			for i, n := 0, d.Count(); i < n; i++ {
+				name := d.Text()
+				env[name] = d.Text()
+			}
+			s.mu.Lock()
+			s.typ, s.env = typ, env
+			s.mu.Unlock()
+			result(ndmp.ErrNone)
+			go s.backup(ss, data, env["FILESYSTEM"])
+		case ndmp.MsgDataAbort:
+			if data != nil {
+				data.Close()
+			}
+			result(ndmp.ErrNone)
+		case ndmp.MsgDataStop:
+			result(ndmp.ErrNone)
+		case ndmp.MsgConnectClose:
+			return
+		default:
+			ss.send(ndmp.MessageReply, h.Message, h.Sequence, ndmp.ErrNotSupported, nil)
+		}
+	}
+}
+
+// backup sends the file history and the image, then reports the halt
+func (s *Server) backup(ss *session, data net.Conn, filesystem string) {
+	ss.send(ndmp.MessageRequest, ndmp.MsgLogMessage, 0, 0, (&ndmp.Encoder{}).Uint32(0).Uint32(1).Text("Backing up "+filesystem).Uint32(1).Uint32(0))
+	if s.NodeHistory {
+		s.sendNodeHistory(ss)
+	} else {
+		e := &ndmp.Encoder{}
+		e.Uint32(uint32(len(s.Files)))
+		for i, f := range s.Files {
+			e.Uint32(1).Uint32(0).Text(path.Join(filesystem, f.Path))
+			encodeStat(e, f)
+			e.Uint64(uint64(i + 100)).Uint64(0)
+		}
+		ss.send(ndmp.MessageRequest, ndmp.MsgFhAddFile, 0, 0, e)
+	}
+
+	_, err := data.Write(s.Image)
+	data.Close()
+	halt := s.Halt
+	if halt == 0 {
+		halt = ndmp.HaltSuccessful
+	}
+	if err != nil {
+		halt = ndmp.HaltConnectError
+	}
+	ss.send(ndmp.MessageRequest, ndmp.MsgNotifyDataHalted, 0, 0, (&ndmp.Encoder{}).Uint32(uint32(halt)))
+}
+
+// sendNodeHistory reports the files as directory entries and nodes
+func (s *Server) sendNodeHistory(ss *session) {
+	const root = 2
+	type dirEntry struct {
+		name         string
+		node, parent uint64
+	}
+	entries := []dirEntry{{".", root, root}}
+	var nodes []ndmp.File
+	var ids []uint64
+	known := map[string]uint64{"": root}
+	var walk func(p string, f *ndmp.File) uint64
+	walk = func(p string, f *ndmp.File) uint64 {
+		if n, ok := known[p]; ok {
+			return n
+		}
+		parent := walk(strings.TrimSuffix(path.Dir(p), "."), nil)
+		n := uint64(root + len(known))
+		known[p] = n
+		entries = append(entries, dirEntry{path.Base(p), n, parent})
+		st := ndmp.File{Type: ndmp.FileDir, Mode: 0755}
+		if f != nil {
+			st = *f
+		}
+		nodes = append(nodes, st)
+		ids = append(ids, n)
+		return n
+	}
+	for i := range s.Files {
+		walk(s.Files[i].Path, &s.Files[i])
+	}
+
+	e := (&ndmp.Encoder{}).Uint32(uint32(len(entries)))
+	for _, d := range entries {
+		e.Uint32(1).Uint32(0).Text(d.name).Uint64(d.node).Uint64(d.parent)
+	}
+	ss.send(ndmp.MessageRequest, ndmp.MsgFhAddDir, 0, 0, e)
+
+	e = (&ndmp.Encoder{}).Uint32(uint32(len(nodes)))
+	for i, f := range nodes {
+		encodeStat(e, f)
+		e.Uint64(ids[i]).Uint64(0)
+	}
+	ss.send(ndmp.MessageRequest, ndmp.MsgFhAddNode, 0, 0, e)
+}
+
+// encodeStat appends a one-element ndmp4_file_stat array
+func encodeStat(e *ndmp.Encoder, f ndmp.File) {
+	e.Uint32(1)
+	e.Uint32(0).Uint32(0).Uint32(uint32(f.Type))
+	mtime := uint32(f.MTime.Unix())
+	e.Uint32(mtime).Uint32(mtime).Uint32(mtime)
+	e.Uint32(f.UID).Uint32(f.GID).Uint32(f.Mode).Uint64(uint64(f.Size)).Uint32(1)
+}
@@ -0,0 +1,252 @@
+// Package ndmp is a client for version 4 of the Network Data Management
+// Protocol spoken by NAS appliances such as NetApp and Synology. TapeBackarr
+// acts as the data management application and as the tape server at once:
+// it has the NAS's data service connect to a TCP port it listens on, starts
+// a backup and writes the image it receives to tape, while the file history
+// the NAS sends over the control connection becomes the catalog.
+package ndmp
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// ProtocolVersion is the NDMP version the client speaks
+const ProtocolVersion = 4
+
+// DefaultPort is the standard NDMP control port
+const DefaultPort = 10000
+
+// Message types
+const (
+	MessageRequest uint32 = 0
+	MessageReply   uint32 = 1
+)
+
+// Message codes used by the client
+const (
+	MsgConfigGetAuthAttr      uint32 = 0x103
+	MsgDataGetState           uint32 = 0x400
+	MsgDataStartBackup        uint32 = 0x401
+	MsgDataAbort              uint32 = 0x403
+	MsgDataStop               uint32 = 0x407
+	MsgDataConnect            uint32 = 0x40a
+	MsgNotifyDataHalted       uint32 = 0x501
+	MsgNotifyConnectionStatus uint32 = 0x502
+	MsgLogFile                uint32 = 0x602
+	MsgLogMessage             uint32 = 0x603
+	MsgFhAddFile              uint32 = 0x703
+	MsgFhAddDir               uint32 = 0x704
+	MsgFhAddNode              uint32 = 0x705
+	MsgConnectOpen            uint32 = 0x900
+	MsgConnectClientAuth      uint32 = 0x901
+	MsgConnectClose           uint32 = 0x902
+)
+
+// Authentication types
+const (
+	AuthTypeText uint32 = 1
+	AuthTypeMD5  uint32 = 2
+)
+
+// maxMessageSize bounds a message so a broken peer cannot exhaust memory;
+// file history batches stay well below it
+const maxMessageSize = 64 << 20
+
+// Header is the header of every NDMP message
+type Header struct {
+	Sequence      uint32
+	Timestamp     uint32
+	Type          uint32
+	Message       uint32
+	ReplySequence uint32
+	Error         uint32
+}
+
+// Error is an NDMP error code
+type Error uint32
+
+// Error codes
+const (
+	ErrNone          Error = 0
+	ErrNotSupported  Error = 1
+	ErrNotAuthorized Error = 4
+	ErrIllegalArgs   Error = 9
+	ErrIllegalState  Error = 19
+)
+
+var errorNames = map[Error]string{
+	0: "no error", 1: "not supported", 2: "device busy", 3: "device opened", 4: "not authorized",
+	5: "permission denied", 6: "device not open", 7: "I/O error", 8: "timeout", 9: "illegal arguments",
+	10: "no tape loaded", 11: "write protected", 12: "end of file", 13: "end of media",
+	14: "file not found", 15: "bad file", 16: "no device", 17: "no bus", 18: "XDR decode error",
+	19: "illegal state", 20: "undefined error", 21: "XDR encode error", 22: "out of memory",
+	23: "connection error", 24: "sequence number error", 25: "read in progress", 26: "precondition failed",
+	27: "class not supported", 28: "version not supported",
+}
+
+func (e Error) Error() string {
+	if name, ok := errorNames[e]; ok {
+		return "ndmp: " + name
+	}
+	return fmt.Sprintf("ndmp: error %d", uint32(e))
+}
+
+// ReadMessage reads one record-marked message
+func ReadMessage(r io.Reader) (Header, []byte, error) {
+	var msg []byte
+	for {
+		var mark [4]byte
+		if _, err := io.ReadFull(r, mark[:]); err != nil {
+			return Header{}, nil, err
+		}
+		v := binary.BigEndian.Uint32(mark[:])
+		n := int(v & 0x7fffffff)
+		if len(msg)+n > maxMessageSize {
+			return Header{}, nil, fmt.Errorf("ndmp: message of more than %d bytes", maxMessageSize)
+		}
+		frag := make([]byte, n)
+		if _, err := io.ReadFull(r, frag); err != nil {
+			return Header{}, nil, err
+		}
+		msg = append(msg, frag...)
+		if v&0x80000000 != 0 {
+			break
+		}
+	}
+	d := NewDecoder(msg)
+	h := Header{d.Uint32(), d.Uint32(), d.Uint32(), d.Uint32(), d.Uint32(), d.Uint32()}
+	if d.Err() != nil {
+		return Header{}, nil, errors.New("ndmp: short message header")
+	}
+	return h, msg[24:], nil
+}
+
+// WriteMessage writes a message as a single record fragment
+func WriteMessage(w io.Writer, h Header, body []byte) error {
+	e := &Encoder{}
+	e.Uint32(0x80000000 | uint32(24+len(body)))
+	e.Uint32(h.Sequence).Uint32(h.Timestamp).Uint32(h.Type).Uint32(h.Message).Uint32(h.ReplySequence).Uint32(h.Error)
+	e.b = append(e.b, body...)
+	_, err := w.Write(e.b)
+	return err
+}
+
+// Encoder writes XDR values
+type Encoder struct {
+	b []byte
+}
+
+// Uint32 appends an unsigned int; enums and u_short are encoded the same
+func (e *Encoder) Uint32(v uint32) *Encoder {
+	e.b = binary.BigEndian.AppendUint32(e.b, v)
+	return e
+}
+
+// Uint64 appends an unsigned hyper or ndmp_u_quad
+func (e *Encoder) Uint64(v uint64) *Encoder {
+	e.b = binary.BigEndian.AppendUint64(e.b, v)
+	return e
+}
+
+// Text appends a variable-length string
+func (e *Encoder) Text(s string) *Encoder {
+	e.Uint32(uint32(len(s)))
+	e.b = append(e.b, s...)
+	e.b = append(e.b, make([]byte, pad(len(s)))...)
+	return e
+}
+
+// Opaque appends fixed-length opaque data
+func (e *Encoder) Opaque(p []byte) *Encoder {
+	e.b = append(e.b, p...)
+	e.b = append(e.b, make([]byte, pad(len(p)))...)
+	return e
+}
+
+// Bytes returns the encoded data
+func (e *Encoder) Bytes() []byte {
+	return e.b
+}
+
+// Decoder reads XDR values. The first error sticks and further reads
+// return zero values.
+type Decoder struct {
+	b   []byte
+	err error
+}
+
+// NewDecoder decodes b
+func NewDecoder(b []byte) *Decoder {
+	return &Decoder{b: b}
+}
+
+func (d *Decoder) take(n int) []byte {
+	if d.err != nil {
+		return nil
+	}
+	if n < 0 || n > len(d.b) {
+		d.err = errors.New("ndmp: truncated message")
+		return nil
+	}
+	p := d.b[:n]
+	d.b = d.b[n:]
+	return p
+}
+
+// Uint32 reads an unsigned int
+func (d *Decoder) Uint32() uint32 {
+	if p := d.take(4); p != nil {
+		return binary.BigEndian.Uint32(p)
+	}
+	return 0
+}
+
+// Uint64 reads an unsigned hyper or ndmp_u_quad
+func (d *Decoder) Uint64() uint64 {
+	if p := d.take(8); p != nil {
+		return binary.BigEndian.Uint64(p)
+	}
+	return 0
+}
+
+// Text reads a variable-length string
+func (d *Decoder) Text() string {
+	n := d.Uint32()
+	if n > uint32(len(d.b)) {
+		d.err = errors.New("ndmp: truncated message")
+		return ""
+	}
+	p := d.take(int(n))
+	d.take(pad(int(n)))
+	return string(p)
+}
+
+// Opaque reads n bytes of fixed-length opaque data
+func (d *Decoder) Opaque(n int) []byte {
+	p := d.take(n)
+	d.take(pad(n))
+	return p
+}
+
+// Count reads the length of a variable-length array, refusing lengths the
+// remaining data cannot hold
+func (d *Decoder) Count() int {
+	n := d.Uint32()
+	if n > uint32(len(d.b)) {
+		d.err = errors.New("ndmp: truncated message")
+		return 0
+	}
+	return int(n)
+}
+
+// Err returns the first decoding error
+func (d *Decoder) Err() error {
+	return d.err
+}
+
+func pad(n int) int {
+	return (4 - n%4) % 4
+}
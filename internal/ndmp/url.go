@@ -0,0 +1,61 @@
+package ndmp
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// Target is what an NDMP source backs up
+type Target struct {
+	// Addr is the host:port of the NAS's NDMP service
+	Addr string
+	// Filesystem is the volume or share path on the NAS, e.g. /vol/vol1
+	Filesystem string
+	// Type is the backup type the NAS writes, dump by default
+	Type string
+	// Auth is AuthMD5 or AuthText
+	Auth string
+}
+
+// ParseURL parses the path of an NDMP source:
+// ndmp://host[:port]/filesystem[?type=dump|tar|...][&auth=md5|text]
+func ParseURL(raw string) (*Target, error) {
+	u, err := url.Parse(raw)
+	if err != nil || u.Scheme != "ndmp" || u.Hostname() == "" {
+		return nil, fmt.Errorf("path must be an ndmp://host[:port]/filesystem URL")
+	}
+	t := &Target{
+		Addr:       u.Host,
+		Filesystem: u.Path,
+		Type:       u.Query().Get("type"),
+		Auth:       u.Query().Get("auth"),
+	}
+	if u.Port() == "" {
+		t.Addr = net.JoinHostPort(u.Hostname(), strconv.Itoa(DefaultPort))
+	}
+	if t.Filesystem == "" || t.Filesystem == "/" {
+		return nil, fmt.Errorf("the URL must name the file system to back up, e.g. ndmp://nas/vol/vol1")
+	}
+	for key := range u.Query() {
+		if key != "type" && key != "auth" {
+			return nil, fmt.Errorf("unknown parameter %q", key)
+		}
+	}
+	if t.Type == "" {
+		t.Type = "dump"
+	}
+	if strings.ContainsAny(t.Type, " /") {
+		return nil, fmt.Errorf("invalid backup type %q", t.Type)
+	}
+	switch t.Auth {
+	case "":
+		t.Auth = AuthMD5
+	case AuthMD5, AuthText:
+	default:
+		return nil, fmt.Errorf("auth must be md5 or text")
+	}
+	return t, nil
+}
@@ -5,9 +5,13 @@ import (
 	"context"
 	"crypto/tls"
 	"fmt"
+	"net"
 	"net/smtp"
+	"strconv"
 	"strings"
 	"time"
+
+	"github.com/RoseOO/TapeBackarr/internal/i18n"
 )
 
 // EmailConfig holds SMTP email configuration
@@ -20,8 +24,10 @@ type EmailConfig struct {
 	FromEmail  string `json:"from_email"`
 	FromName   string `json:"from_name"`
 	ToEmails   string `json:"to_emails"` // Comma-separated list
-	UseTLS     bool   `json:"use_tls"`
+	UseTLS     bool   `json:"use_tls"`   // Implicit TLS, usually port 465
+	StartTLS   bool   `json:"starttls"`  // Require STARTTLS on a plain connection
 	SkipVerify bool   `json:"skip_verify"`
+	Language   string `json:"language"` // catalog language for email notifications
 }
 
 // EmailService provides email notification functionality
@@ -47,12 +53,23 @@ func (s *EmailService) IsEnabled() bool {
 	return s.config.Enabled && s.config.SMTPHost != "" && s.config.ToEmails != ""
 }
 
+// Language returns the language email notifications are rendered in
+func (s *EmailService) Language() i18n.Lang {
+	return i18n.Normalize(s.config.Language)
+}
+
+// t renders a catalog message in the email language
+func (s *EmailService) t(key string, args ...interface{}) string {
+	return i18n.T(s.Language(), key, args...)
+}
+
 // Send sends a notification via email
 func (s *EmailService) Send(ctx context.Context, notification *Notification) error {
 	if !s.IsEnabled() {
 		return nil
 	}
 
+	notification = applyTemplate(notification, ChannelEmail)
 	subject := s.formatSubject(notification)
 	body := s.formatBody(notification)
 
@@ -64,7 +81,7 @@ func (s *EmailService) formatSubject(notification *Notification) string {
 	prefix := "[TapeBackarr]"
 	switch notification.Priority {
 	case "urgent":
-		prefix = "[TapeBackarr] 🚨 URGENT:"
+		prefix = "[TapeBackarr] 🚨 " + s.t("notify.email.urgent")
 	case "high":
 		prefix = "[TapeBackarr] ⚠️"
 	}
@@ -126,16 +143,16 @@ body { font-family: Arial, sans-serif; line-height: 1.6; color: #333; }
 		}
 
 		buf.WriteString(fmt.Sprintf(`<div class="%s">
-<h3 style="margin-top: 0;">Details</h3>
+<h3 style="margin-top: 0;">%s</h3>
 <table style="width: 100%%;">
-`, detailsClass))
+`, detailsClass, escapeHTML(s.t("notify.details"))))
 
 		for key, value := range notification.Data {
 			buf.WriteString(fmt.Sprintf(`<tr>
 <td style="font-weight: bold; padding: 5px 10px 5px 0;">%s:</td>
 <td style="padding: 5px 0;">%v</td>
 </tr>
-`, escapeHTML(key), value))
+`, escapeHTML(fieldLabel(s.Language(), key)), value))
 		}
 
 		buf.WriteString(`</table>
@@ -146,13 +163,14 @@ body { font-family: Arial, sans-serif; line-height: 1.6; color: #333; }
 
 	// Footer
 	buf.WriteString(fmt.Sprintf(`<div class="footer">
-<p>This notification was sent by TapeBackarr at %s</p>
-<p>Access the web interface to manage your tape backup system.</p>
+<p>%s</p>
+<p>%s</p>
 </div>
 </div>
 </body>
 </html>
-`, notification.Timestamp.Format("2006-01-02 15:04:05 MST")))
+`, escapeHTML(s.t("notify.email.footer_sent", notification.Timestamp.Format("2006-01-02 15:04:05 MST"))),
+		escapeHTML(s.t("notify.email.footer_manage"))))
 
 	return buf.String()
 }
@@ -192,54 +210,66 @@ func (s *EmailService) sendEmail(ctx context.Context, subject, body string) erro
 	msg.WriteString("\r\n")
 	msg.WriteString(body)
 
-	// SMTP address
-	addr := fmt.Sprintf("%s:%d", s.config.SMTPHost, s.config.SMTPPort)
-
-	// Create auth if credentials provided
-	var auth smtp.Auth
-	if s.config.Username != "" && s.config.Password != "" {
-		auth = smtp.PlainAuth("", s.config.Username, s.config.Password, s.config.SMTPHost)
-	}
-
-	// Send email
-	if s.config.UseTLS {
-		return s.sendEmailTLS(addr, auth, s.config.FromEmail, recipients, msg.Bytes())
-	}
-
-	return smtp.SendMail(addr, auth, s.config.FromEmail, recipients, msg.Bytes())
+	return s.deliver(ctx, recipients, msg.Bytes())
 }
 
-// sendEmailTLS sends email using TLS connection
-func (s *EmailService) sendEmailTLS(addr string, auth smtp.Auth, from string, to []string, msg []byte) error {
-	// TLS configuration
+// smtpTimeout bounds a delivery when the context has no deadline
+const smtpTimeout = 2 * time.Minute
+
+// deliver sends msg over SMTP. With UseTLS the connection is TLS from the
+// start (usually port 465). Otherwise STARTTLS is used when the server offers
+// it, and StartTLS makes it required. SkipVerify applies to both.
+func (s *EmailService) deliver(ctx context.Context, to []string, msg []byte) error {
+	addr := net.JoinHostPort(s.config.SMTPHost, strconv.Itoa(s.config.SMTPPort))
 	tlsConfig := &tls.Config{
 		ServerName:         s.config.SMTPHost,
 		InsecureSkipVerify: s.config.SkipVerify,
 	}
 
-	// Connect to SMTP server
-	conn, err := tls.Dial("tcp", addr, tlsConfig)
+	dialer := &net.Dialer{Timeout: 30 * time.Second}
+	var conn net.Conn
+	var err error
+	if s.config.UseTLS {
+		conn, err = (&tls.Dialer{NetDialer: dialer, Config: tlsConfig}).DialContext(ctx, "tcp", addr)
+	} else {
+		conn, err = dialer.DialContext(ctx, "tcp", addr)
+	}
 	if err != nil {
 		return fmt.Errorf("failed to connect to SMTP server: %w", err)
 	}
-	defer conn.Close()
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		deadline = time.Now().Add(smtpTimeout)
+	}
+	conn.SetDeadline(deadline)
 
-	// Create SMTP client
 	client, err := smtp.NewClient(conn, s.config.SMTPHost)
 	if err != nil {
+		conn.Close()
 		return fmt.Errorf("failed to create SMTP client: %w", err)
 	}
 	defer client.Close()
 
+	if !s.config.UseTLS {
+		if ok, _ := client.Extension("STARTTLS"); ok {
+			if err := client.StartTLS(tlsConfig); err != nil {
+				return fmt.Errorf("STARTTLS failed: %w", err)
+			}
+		} else if s.config.StartTLS {
+			return fmt.Errorf("SMTP server %s does not offer STARTTLS", addr)
+		}
+	}
+
 	// Authenticate if credentials provided
-	if auth != nil {
+	if s.config.Username != "" && s.config.Password != "" {
+		auth := smtp.PlainAuth("", s.config.Username, s.config.Password, s.config.SMTPHost)
 		if err := client.Auth(auth); err != nil {
 			return fmt.Errorf("SMTP authentication failed: %w", err)
 		}
 	}
 
 	// Set sender
-	if err := client.Mail(from); err != nil {
+	if err := client.Mail(s.config.FromEmail); err != nil {
 		return fmt.Errorf("failed to set sender: %w", err)
 	}
 
@@ -267,13 +297,24 @@ func (s *EmailService) sendEmailTLS(addr string, auth smtp.Auth, from string, to
 	return client.Quit()
 }
 
+// SendTestMessage sends a test email to the configured recipients
+func (s *EmailService) SendTestMessage(ctx context.Context) error {
+	return s.Send(ctx, &Notification{
+		Type:      NotifyTest,
+		Title:     s.t("notify.test.title"),
+		Message:   s.t("notify.email.test.message"),
+		Priority:  "normal",
+		Timestamp: time.Now(),
+	})
+}
+
 // NotifyTapeChangeRequired sends a tape change notification via email
 func (s *EmailService) NotifyTapeChangeRequired(ctx context.Context, jobName string, currentTape string, reason string, nextTape string) error {
-	msg := fmt.Sprintf("Job '%s' requires a tape change. Current tape: %s. Reason: %s.", jobName, currentTape, reason)
+	msg := s.t("notify.email.tape_change.message", jobName, currentTape, reason)
 	if nextTape != "" {
-		msg += fmt.Sprintf(" Next tape needed: %s.", nextTape)
+		msg += " " + s.t("notify.next_tape", nextTape) + "."
 	}
-	msg += " Please insert the required tape and acknowledge in the web interface."
+	msg += " " + s.t("notify.tape_change.action")
 
 	data := map[string]interface{}{
 		"Job":          jobName,
@@ -286,11 +327,29 @@ func (s *EmailService) NotifyTapeChangeRequired(ctx context.Context, jobName str
 
 	return s.Send(ctx, &Notification{
 		Type:      NotifyTapeChange,
-		Title:     "Tape Change Required",
+		Title:     s.t("notify.tape_change.title"),
 		Message:   msg,
 		Priority:  "high",
 		Timestamp: time.Now(),
 		Data:      data,
+		Vars:      TemplateVars{Job: jobName, Tape: currentTape, Reason: reason, NextTape: nextTape},
+	})
+}
+
+// NotifyBackupStarted sends a backup start notification via email
+func (s *EmailService) NotifyBackupStarted(ctx context.Context, jobName string, sourceCount int, backupType string) error {
+	return s.Send(ctx, &Notification{
+		Type:      NotifyBackupStart,
+		Title:     s.t("notify.backup_started.title"),
+		Message:   s.t("notify.backup_started.message", jobName, backupType, sourceCount),
+		Priority:  "normal",
+		Timestamp: time.Now(),
+		Data: map[string]interface{}{
+			"Job":     jobName,
+			"Type":    backupType,
+			"Sources": sourceCount,
+		},
+		Vars: TemplateVars{Job: jobName, BackupType: backupType, Sources: sourceCount},
 	})
 }
 
@@ -299,8 +358,8 @@ func (s *EmailService) NotifyBackupCompleted(ctx context.Context, jobName string
 	sizeGB := float64(totalBytes) / (1024 * 1024 * 1024)
 	return s.Send(ctx, &Notification{
 		Type:      NotifyBackupComplete,
-		Title:     "Backup Completed Successfully",
-		Message:   fmt.Sprintf("Backup job '%s' completed successfully.", jobName),
+		Title:     s.t("notify.email.backup_completed.title"),
+		Message:   s.t("notify.email.backup_completed.message", jobName),
 		Priority:  "normal",
 		Timestamp: time.Now(),
 		Data: map[string]interface{}{
@@ -309,6 +368,7 @@ func (s *EmailService) NotifyBackupCompleted(ctx context.Context, jobName string
 			"Size":     fmt.Sprintf("%.2f GB", sizeGB),
 			"Duration": duration.Round(time.Second).String(),
 		},
+		Vars: TemplateVars{Job: jobName, Files: fileCount, Bytes: totalBytes, Duration: duration},
 	})
 }
 
@@ -316,14 +376,15 @@ func (s *EmailService) NotifyBackupCompleted(ctx context.Context, jobName string
 func (s *EmailService) NotifyBackupFailed(ctx context.Context, jobName string, errorMsg string) error {
 	return s.Send(ctx, &Notification{
 		Type:      NotifyBackupFailed,
-		Title:     "Backup Failed",
-		Message:   fmt.Sprintf("Backup job '%s' failed! Please check the logs and tape status.", jobName),
+		Title:     s.t("notify.backup_failed.title"),
+		Message:   s.t("notify.email.backup_failed.message", jobName),
 		Priority:  "urgent",
 		Timestamp: time.Now(),
 		Data: map[string]interface{}{
 			"Job":   jobName,
 			"Error": errorMsg,
 		},
+		Vars: TemplateVars{Job: jobName, Error: errorMsg},
 	})
 }
 
@@ -331,14 +392,15 @@ func (s *EmailService) NotifyBackupFailed(ctx context.Context, jobName string, e
 func (s *EmailService) NotifyDriveError(ctx context.Context, devicePath string, errorMsg string) error {
 	return s.Send(ctx, &Notification{
 		Type:      NotifyDriveError,
-		Title:     "Tape Drive Error",
-		Message:   fmt.Sprintf("A tape drive error has been detected on device %s. Please check the drive status.", devicePath),
+		Title:     s.t("notify.email.drive_error.title"),
+		Message:   s.t("notify.email.drive_error.message", devicePath),
 		Priority:  "urgent",
 		Timestamp: time.Now(),
 		Data: map[string]interface{}{
 			"Device": devicePath,
 			"Error":  errorMsg,
 		},
+		Vars: TemplateVars{Device: devicePath, Error: errorMsg},
 	})
 }
 
@@ -346,13 +408,14 @@ func (s *EmailService) NotifyDriveError(ctx context.Context, devicePath string,
 func (s *EmailService) NotifyWrongTapeInserted(ctx context.Context, expectedLabel string, actualLabel string) error {
 	return s.Send(ctx, &Notification{
 		Type:      NotifyWrongTape,
-		Title:     "Wrong Tape Inserted",
-		Message:   fmt.Sprintf("The inserted tape does not match the expected tape. Expected: %s, Actual: %s. Please insert the correct tape.", expectedLabel, actualLabel),
+		Title:     s.t("notify.wrong_tape.title"),
+		Message:   s.t("notify.email.wrong_tape.message", expectedLabel, actualLabel),
 		Priority:  "high",
 		Timestamp: time.Now(),
 		Data: map[string]interface{}{
 			"Expected": expectedLabel,
 			"Actual":   actualLabel,
 		},
+		Vars: TemplateVars{Expected: expectedLabel, Actual: actualLabel, Tape: actualLabel},
 	})
 }
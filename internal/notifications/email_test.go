@@ -0,0 +1,117 @@
+package notifications
+
+import (
+	"bufio"
+	"context"
+	"net"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fakeSMTPServer accepts one SMTP session without STARTTLS and returns the
+// message data it received
+func fakeSMTPServer(t *testing.T) (int, <-chan string) {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	t.Cleanup(func() { ln.Close() })
+
+	received := make(chan string, 1)
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		conn.SetDeadline(time.Now().Add(5 * time.Second))
+
+		r := bufio.NewReader(conn)
+		reply := func(s string) { conn.Write([]byte(s + "\r\n")) }
+		reply("220 localhost ESMTP")
+		var data strings.Builder
+		for {
+			line, err := r.ReadString('\n')
+			if err != nil {
+				return
+			}
+			cmd := strings.ToUpper(strings.TrimSpace(line))
+			switch {
+			case strings.HasPrefix(cmd, "EHLO"):
+				reply("250-localhost")
+				reply("250 8BITMIME")
+			case strings.HasPrefix(cmd, "DATA"):
+				reply("354 go ahead")
+				for {
+					line, err := r.ReadString('\n')
+					if err != nil {
+						return
+					}
+					if line == ".\r\n" {
+						break
+					}
+					data.WriteString(line)
+				}
+				reply("250 queued")
+				received <- data.String()
+			case strings.HasPrefix(cmd, "QUIT"):
+				reply("221 bye")
+				return
+			default:
+				reply("250 ok")
+			}
+		}
+	}()
+
+	return ln.Addr().(*net.TCPAddr).Port, received
+}
+
+func TestEmailSendTestMessage(t *testing.T) {
+	port, received := fakeSMTPServer(t)
+	svc := NewEmailService(EmailConfig{
+		Enabled:   true,
+		SMTPHost:  "127.0.0.1",
+		SMTPPort:  port,
+		FromEmail: "tapebackarr@example.com",
+		ToEmails:  "admin@example.com, operator@example.com",
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := svc.SendTestMessage(ctx); err != nil {
+		t.Fatalf("SendTestMessage: %v", err)
+	}
+
+	msg := <-received
+	if !strings.Contains(msg, "To: admin@example.com, operator@example.com") {
+		t.Errorf("expected both recipients in message, got %q", msg)
+	}
+	if !strings.Contains(msg, "Subject: ") {
+		t.Errorf("expected a subject header, got %q", msg)
+	}
+}
+
+func TestEmailRequiresStartTLS(t *testing.T) {
+	port, _ := fakeSMTPServer(t)
+	svc := NewEmailService(EmailConfig{
+		Enabled:   true,
+		SMTPHost:  "127.0.0.1",
+		SMTPPort:  port,
+		FromEmail: "tapebackarr@example.com",
+		ToEmails:  "admin@example.com",
+		StartTLS:  true,
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	err := svc.SendTestMessage(ctx)
+	if err == nil || !strings.Contains(err.Error(), "STARTTLS") {
+		t.Fatalf("expected STARTTLS error, got %v", err)
+	}
+	if !strings.Contains(err.Error(), strconv.Itoa(port)) {
+		t.Errorf("expected server address in error, got %v", err)
+	}
+}
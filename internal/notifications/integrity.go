@@ -0,0 +1,55 @@
+package notifications
+
+import (
+	"context"
+	"time"
+
+	"github.com/RoseOO/TapeBackarr/internal/i18n"
+)
+
+// NotifyDatabaseIntegrity is the type of database corruption alerts
+const NotifyDatabaseIntegrity NotificationType = "database_integrity"
+
+// IntegrityAlert describes a failed database integrity check. Snapshot is
+// the local snapshot the database was restored from at startup; it is empty
+// when the damaged database is still in use.
+type IntegrityAlert struct {
+	Problems     []string
+	Snapshot     string
+	SnapshotTime time.Time
+}
+
+// integrityNotification builds the alert in the given language. Both cases
+// advise restoring from the tape database backup: a snapshot fallback loses
+// every change made since the snapshot.
+func integrityNotification(lang i18n.Lang, alert IntegrityAlert) *Notification {
+	n := &Notification{
+		Type:      NotifyDatabaseIntegrity,
+		Priority:  "urgent",
+		Timestamp: time.Now(),
+		Data:      map[string]interface{}{},
+	}
+	if alert.Snapshot != "" {
+		n.Title = i18n.T(lang, "notify.database_recovered.title")
+		n.Message = i18n.T(lang, "notify.database_recovered.message", alert.Snapshot, alert.SnapshotTime.Format("2006-01-02 15:04"))
+		n.Data["Snapshot"] = alert.Snapshot
+	} else {
+		n.Title = i18n.T(lang, "notify.database_corrupt.title")
+		n.Message = i18n.T(lang, "notify.database_corrupt.message")
+	}
+	if len(alert.Problems) > 0 {
+		n.Data["Error"] = alert.Problems[0]
+		n.Vars.Error = alert.Problems[0]
+	}
+	return n
+}
+
+// NotifyDatabaseIntegrity sends a database corruption alert
+func (s *TelegramService) NotifyDatabaseIntegrity(ctx context.Context, alert IntegrityAlert) error {
+	return s.Send(ctx, integrityNotification(s.Language(), alert))
+}
+
+// NotifyDatabaseIntegrity sends a database corruption alert via email
+func (s *EmailService) NotifyDatabaseIntegrity(ctx context.Context, alert IntegrityAlert) error {
+	return s.Send(ctx, integrityNotification(s.Language(), alert))
+}
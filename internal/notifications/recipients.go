@@ -0,0 +1,158 @@
+package notifications
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+)
+
+// JobRecipients are the notification targets of one backup job. They use
+// the bot and SMTP server of the global channels, which must be enabled.
+type JobRecipients struct {
+	TelegramChatIDs []string
+	Emails          []string
+	// Language for the job's own targets, e.g. the owner's preference;
+	// empty keeps the language of the global channel
+	Language string
+	// IncludeGlobal also notifies the global chat and addresses
+	IncludeGlobal bool
+}
+
+// HasTargets reports whether the job has recipients of its own
+func (r JobRecipients) HasTargets() bool {
+	return len(r.TelegramChatIDs) > 0 || len(r.Emails) > 0
+}
+
+// SplitAddresses splits a comma-separated list of email addresses or chat
+// IDs, dropping empty entries and duplicates
+func SplitAddresses(list string) []string {
+	var out []string
+	seen := make(map[string]bool)
+	for _, a := range strings.Split(list, ",") {
+		a = strings.TrimSpace(a)
+		if a != "" && !seen[strings.ToLower(a)] {
+			seen[strings.ToLower(a)] = true
+			out = append(out, a)
+		}
+	}
+	return out
+}
+
+// forChat returns a service that sends to another chat with the same bot
+func (s *TelegramService) forChat(chatID, language string) *TelegramService {
+	s.mu.RLock()
+	config := s.config
+	s.mu.RUnlock()
+	config.ChatID = chatID
+	if language != "" {
+		config.Language = language
+	}
+	return &TelegramService{config: config, httpClient: s.httpClient}
+}
+
+// forRecipients returns a service that sends to other addresses through the
+// same SMTP server
+func (s *EmailService) forRecipients(to []string, language string) *EmailService {
+	config := s.config
+	config.ToEmails = strings.Join(to, ", ")
+	if language != "" {
+		config.Language = language
+	}
+	return &EmailService{config: config}
+}
+
+// JobNotifier sends backup job notifications to each job's recipients,
+// falling back to the global chat and addresses for jobs without any.
+type JobNotifier struct {
+	telegram *TelegramService
+	email    *EmailService
+}
+
+// NewJobNotifier creates a job notifier; either service may be nil
+func NewJobNotifier(telegram *TelegramService, email *EmailService) *JobNotifier {
+	return &JobNotifier{telegram: telegram, email: email}
+}
+
+// targets returns the Telegram and email services a job's notification is
+// sent through
+func (n *JobNotifier) targets(r JobRecipients) ([]*TelegramService, []*EmailService) {
+	var tg []*TelegramService
+	var em []*EmailService
+	global := r.IncludeGlobal || !r.HasTargets()
+
+	if n.telegram != nil && n.telegram.IsEnabled() {
+		n.telegram.mu.RLock()
+		globalChat := n.telegram.config.ChatID
+		n.telegram.mu.RUnlock()
+		if global {
+			tg = append(tg, n.telegram)
+		}
+		for _, chat := range r.TelegramChatIDs {
+			if global && chat == globalChat {
+				continue
+			}
+			tg = append(tg, n.telegram.forChat(chat, r.Language))
+		}
+	}
+	if n.email != nil && n.email.IsEnabled() {
+		if global {
+			em = append(em, n.email)
+		}
+		var own []string
+		globalTo := make(map[string]bool)
+		for _, a := range SplitAddresses(n.email.config.ToEmails) {
+			globalTo[strings.ToLower(a)] = true
+		}
+		for _, a := range r.Emails {
+			if global && globalTo[strings.ToLower(a)] {
+				continue
+			}
+			own = append(own, a)
+		}
+		if len(own) > 0 {
+			em = append(em, n.email.forRecipients(own, r.Language))
+		}
+	}
+	return tg, em
+}
+
+// send delivers one notification through every target of the job
+func (n *JobNotifier) send(ctx context.Context, r JobRecipients, telegram func(*TelegramService) error, email func(*EmailService) error) error {
+	tg, em := n.targets(r)
+	var errs []error
+	for _, t := range tg {
+		errs = append(errs, telegram(t))
+	}
+	for _, e := range em {
+		errs = append(errs, email(e))
+	}
+	return errors.Join(errs...)
+}
+
+// NotifyBackupStarted sends a backup start notification to the job's recipients
+func (n *JobNotifier) NotifyBackupStarted(ctx context.Context, r JobRecipients, jobName string, sourceCount int, backupType string) error {
+	return n.send(ctx, r, func(t *TelegramService) error {
+		return t.NotifyBackupStarted(ctx, jobName, sourceCount, backupType)
+	}, func(e *EmailService) error {
+		return e.NotifyBackupStarted(ctx, jobName, sourceCount, backupType)
+	})
+}
+
+// NotifyBackupCompleted sends a backup completion notification to the job's recipients
+func (n *JobNotifier) NotifyBackupCompleted(ctx context.Context, r JobRecipients, jobName string, fileCount int64, totalBytes int64, duration time.Duration) error {
+	return n.send(ctx, r, func(t *TelegramService) error {
+		return t.NotifyBackupCompleted(ctx, jobName, fileCount, totalBytes, duration)
+	}, func(e *EmailService) error {
+		return e.NotifyBackupCompleted(ctx, jobName, fileCount, totalBytes, duration)
+	})
+}
+
+// NotifyBackupFailed sends a backup failure notification to the job's recipients
+func (n *JobNotifier) NotifyBackupFailed(ctx context.Context, r JobRecipients, jobName string, errorMsg string) error {
+	return n.send(ctx, r, func(t *TelegramService) error {
+		return t.NotifyBackupFailed(ctx, jobName, errorMsg)
+	}, func(e *EmailService) error {
+		return e.NotifyBackupFailed(ctx, jobName, errorMsg)
+	})
+}
@@ -0,0 +1,79 @@
+package notifications
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSplitAddresses(t *testing.T) {
+	got := SplitAddresses(" a@example.com, ,b@example.com,A@example.com,")
+	want := []string{"a@example.com", "b@example.com"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("SplitAddresses = %v, want %v", got, want)
+	}
+	if got := SplitAddresses(""); len(got) != 0 {
+		t.Errorf("SplitAddresses(\"\") = %v, want empty", got)
+	}
+}
+
+func TestJobNotifierTargets(t *testing.T) {
+	telegram := NewTelegramService(TelegramConfig{Enabled: true, BotToken: "token", ChatID: "100", Language: "en"})
+	email := NewEmailService(EmailConfig{Enabled: true, SMTPHost: "smtp.example.com", ToEmails: "ops@example.com", Language: "en"})
+	n := NewJobNotifier(telegram, email)
+
+	chats := func(tg []*TelegramService) []string {
+		var out []string
+		for _, s := range tg {
+			out = append(out, s.config.ChatID)
+		}
+		return out
+	}
+	mails := func(em []*EmailService) []string {
+		var out []string
+		for _, s := range em {
+			out = append(out, s.config.ToEmails)
+		}
+		return out
+	}
+
+	// No recipients of its own: global channels only
+	tg, em := n.targets(JobRecipients{})
+	if got := chats(tg); !reflect.DeepEqual(got, []string{"100"}) {
+		t.Errorf("fallback chats = %v", got)
+	}
+	if got := mails(em); !reflect.DeepEqual(got, []string{"ops@example.com"}) {
+		t.Errorf("fallback emails = %v", got)
+	}
+
+	// Own recipients replace the global channels
+	r := JobRecipients{TelegramChatIDs: []string{"200"}, Emails: []string{"owner@example.com"}, Language: "de"}
+	tg, em = n.targets(r)
+	if got := chats(tg); !reflect.DeepEqual(got, []string{"200"}) {
+		t.Errorf("own chats = %v", got)
+	}
+	if got := mails(em); !reflect.DeepEqual(got, []string{"owner@example.com"}) {
+		t.Errorf("own emails = %v", got)
+	}
+	if tg[0].Language() != "de" || em[0].Language() != "de" {
+		t.Errorf("own targets should use the owner's language, got %s/%s", tg[0].Language(), em[0].Language())
+	}
+	if telegram.Language() != "en" {
+		t.Error("global channel language must not change")
+	}
+
+	// IncludeGlobal adds the global channels without duplicating them
+	r = JobRecipients{TelegramChatIDs: []string{"100", "200"}, Emails: []string{"OPS@example.com", "owner@example.com"}, IncludeGlobal: true}
+	tg, em = n.targets(r)
+	if got := chats(tg); !reflect.DeepEqual(got, []string{"100", "200"}) {
+		t.Errorf("global+own chats = %v", got)
+	}
+	if got := mails(em); !reflect.DeepEqual(got, []string{"ops@example.com", "owner@example.com"}) {
+		t.Errorf("global+own emails = %v", got)
+	}
+
+	// Disabled channels send nothing
+	off := NewJobNotifier(NewTelegramService(TelegramConfig{}), nil)
+	if tg, em := off.targets(r); len(tg) != 0 || len(em) != 0 {
+		t.Errorf("disabled channels produced targets: %d telegram, %d email", len(tg), len(em))
+	}
+}
@@ -2,7 +2,6 @@ package notifications
 
 import (
 	"context"
-	"fmt"
 )
 
 // RestoreNotifier sends restore-specific notifications via all configured
@@ -22,10 +21,10 @@ func NewRestoreNotifier(telegram *TelegramService, email *EmailService) *Restore
 // is needed for the restore to continue.
 func (n *RestoreNotifier) SendRestoreTapeChangeRequired(ctx context.Context, expectedLabel string, actualLabel string) error {
 	if n.telegram != nil && n.telegram.IsEnabled() {
-		_ = n.telegram.NotifyTapeChangeRequired(ctx, "Restore", actualLabel, fmt.Sprintf("Please insert tape %s to continue the restore", expectedLabel), expectedLabel)
+		_ = n.telegram.NotifyTapeChangeRequired(ctx, n.telegram.t("notify.restore.job"), actualLabel, n.telegram.t("notify.restore.insert_tape", expectedLabel), expectedLabel)
 	}
 	if n.email != nil && n.email.IsEnabled() {
-		_ = n.email.NotifyTapeChangeRequired(ctx, "Restore", actualLabel, fmt.Sprintf("Please insert tape %s to continue the restore", expectedLabel), expectedLabel)
+		_ = n.email.NotifyTapeChangeRequired(ctx, n.email.t("notify.restore.job"), actualLabel, n.email.t("notify.restore.insert_tape", expectedLabel), expectedLabel)
 	}
 	return nil
 }
@@ -37,7 +36,7 @@ func (n *RestoreNotifier) SendRestoreWrongTape(ctx context.Context, expectedLabe
 	}
 	// Email doesn't have a specific wrong-tape method; reuse tape change.
 	if n.email != nil && n.email.IsEnabled() {
-		_ = n.email.NotifyTapeChangeRequired(ctx, "Restore", actualLabel, fmt.Sprintf("Wrong tape loaded — please insert tape %s", expectedLabel), expectedLabel)
+		_ = n.email.NotifyTapeChangeRequired(ctx, n.email.t("notify.restore.job"), actualLabel, n.email.t("notify.restore.wrong_tape", expectedLabel), expectedLabel)
 	}
 	return nil
 }
@@ -6,7 +6,12 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/http"
+	"regexp"
+	"strings"
+	"sync"
 	"time"
+
+	"github.com/RoseOO/TapeBackarr/internal/i18n"
 )
 
 // TelegramConfig holds Telegram bot configuration
@@ -14,6 +19,7 @@ type TelegramConfig struct {
 	Enabled  bool   `json:"enabled"`
 	BotToken string `json:"bot_token"`
 	ChatID   string `json:"chat_id"`
+	Language string `json:"language"` // catalog language for messages sent to the chat
 }
 
 // NotificationType defines the type of notification
@@ -39,10 +45,13 @@ type Notification struct {
 	Priority  string                 `json:"priority"` // low, normal, high, urgent
 	Timestamp time.Time              `json:"timestamp"`
 	Data      map[string]interface{} `json:"data,omitempty"`
+	// Vars are the structured values exposed to admin-defined templates
+	Vars TemplateVars `json:"-"`
 }
 
 // TelegramService provides Telegram notification functionality
 type TelegramService struct {
+	mu         sync.RWMutex
 	config     TelegramConfig
 	httpClient *http.Client
 }
@@ -62,12 +71,31 @@ func (s *TelegramService) IsEnabled() bool {
 	return s.config.Enabled && s.config.BotToken != "" && s.config.ChatID != ""
 }
 
+// Language returns the language messages to the chat are rendered in
+func (s *TelegramService) Language() i18n.Lang {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return i18n.Normalize(s.config.Language)
+}
+
+// SetLanguage changes the chat's language, e.g. from the /language command
+func (s *TelegramService) SetLanguage(lang i18n.Lang) {
+	s.mu.Lock()
+	s.config.Language = string(lang)
+	s.mu.Unlock()
+}
+
+// t renders a catalog message in the chat's language
+func (s *TelegramService) t(key string, args ...interface{}) string {
+	return i18n.T(s.Language(), key, args...)
+}
+
 // SendTestMessage sends a test notification via Telegram to verify the configuration
 func (s *TelegramService) SendTestMessage(ctx context.Context) error {
 	return s.Send(ctx, &Notification{
-		Type:      "test",
-		Title:     "Test Notification",
-		Message:   "This is a test message from TapeBackarr. Your Telegram notifications are working correctly!",
+		Type:      NotifyTest,
+		Title:     s.t("notify.test.title"),
+		Message:   s.t("notify.test.message"),
 		Priority:  "normal",
 		Timestamp: time.Now(),
 	})
@@ -79,6 +107,8 @@ func (s *TelegramService) Send(ctx context.Context, notification *Notification)
 		return nil
 	}
 
+	notification = applyTemplate(notification, ChannelTelegram)
+
 	// Format message with emoji based on type
 	emoji := s.getEmoji(notification.Type, notification.Priority)
 	formattedMessage := s.formatMessage(emoji, notification)
@@ -107,6 +137,8 @@ func (s *TelegramService) getEmoji(notifType NotificationType, priority string)
 		return "🚨"
 	case NotifyWrongTape:
 		return "⚠️"
+	case NotifyBackupWindow:
+		return "📋"
 	default:
 		if priority == "urgent" || priority == "high" {
 			return "🔴"
@@ -127,18 +159,30 @@ func (s *TelegramService) formatMessage(emoji string, notification *Notification
 
 	// Add data fields if present
 	if len(notification.Data) > 0 {
-		buf.WriteString("\n\n*Details:*\n")
+		buf.WriteString(fmt.Sprintf("\n\n*%s:*\n", escapeMarkdown(s.t("notify.details"))))
 		for key, value := range notification.Data {
-			buf.WriteString(fmt.Sprintf("• %s: `%v`\n", escapeMarkdown(key), value))
+			buf.WriteString(fmt.Sprintf("• %s: `%v`\n", escapeMarkdown(fieldLabel(s.Language(), key)), value))
 		}
 	}
 
 	// Timestamp
-	buf.WriteString(fmt.Sprintf("\n\n_Sent at %s_", escapeMarkdown(notification.Timestamp.Format("2006-01-02 15:04:05"))))
+	buf.WriteString(fmt.Sprintf("\n\n_%s_", escapeMarkdown(s.t("notify.sent_at", notification.Timestamp.Format("2006-01-02 15:04:05")))))
 
 	return buf.String()
 }
 
+var fieldWordBoundary = regexp.MustCompile(`([a-z])([A-Z])`)
+
+// fieldLabel translates a notification data key such as "CurrentTape" or
+// "Current Tape" via notify.field.current_tape, keeping unknown keys as is.
+func fieldLabel(lang i18n.Lang, key string) string {
+	slug := strings.ToLower(strings.ReplaceAll(fieldWordBoundary.ReplaceAllString(key, "${1}_${2}"), " ", "_"))
+	if !i18n.Has("notify.field." + slug) {
+		return key
+	}
+	return i18n.T(lang, "notify.field."+slug)
+}
+
 // escapeMarkdown escapes special characters for Telegram MarkdownV2
 func escapeMarkdown(s string) string {
 	specialChars := []string{"_", "*", "[", "]", "(", ")", "~", "`", ">", "#", "+", "-", "=", "|", "{", "}", ".", "!"}
@@ -202,11 +246,11 @@ func (s *TelegramService) sendMessage(ctx context.Context, text string) error {
 
 // NotifyTapeChangeRequired sends a tape change notification
 func (s *TelegramService) NotifyTapeChangeRequired(ctx context.Context, jobName string, currentTape string, reason string, nextTape string) error {
-	msg := fmt.Sprintf("Job '%s' requires a tape change.\n\nCurrent tape: %s\nReason: %s", jobName, currentTape, reason)
+	msg := s.t("notify.tape_change.message", jobName, currentTape, reason)
 	if nextTape != "" {
-		msg += fmt.Sprintf("\n\n📌 Next tape needed: %s", nextTape)
+		msg += "\n\n📌 " + s.t("notify.next_tape", nextTape)
 	}
-	msg += "\n\nPlease insert the required tape and acknowledge in the web interface."
+	msg += "\n\n" + s.t("notify.tape_change.action")
 
 	data := map[string]interface{}{
 		"Job":         jobName,
@@ -219,22 +263,23 @@ func (s *TelegramService) NotifyTapeChangeRequired(ctx context.Context, jobName
 
 	return s.Send(ctx, &Notification{
 		Type:      NotifyTapeChange,
-		Title:     "Tape Change Required",
+		Title:     s.t("notify.tape_change.title"),
 		Message:   msg,
 		Priority:  "high",
 		Timestamp: time.Now(),
 		Data:      data,
+		Vars:      TemplateVars{Job: jobName, Tape: currentTape, Reason: reason, NextTape: nextTape},
 	})
 }
 
 // NotifyTapeFull sends a tape full notification
 func (s *TelegramService) NotifyTapeFull(ctx context.Context, tapeLabel string, usedBytes int64, jobName string, nextTape string) error {
 	usedGB := float64(usedBytes) / (1024 * 1024 * 1024)
-	msg := fmt.Sprintf("Tape '%s' is full (%.2f GB used).\n\nJob: %s", tapeLabel, usedGB, jobName)
+	msg := s.t("notify.tape_full.message", tapeLabel, usedGB, jobName)
 	if nextTape != "" {
-		msg += fmt.Sprintf("\n\n📌 Next tape needed: %s", nextTape)
+		msg += "\n\n📌 " + s.t("notify.next_tape", nextTape)
 	}
-	msg += "\n\nPlease insert the required tape to continue."
+	msg += "\n\n" + s.t("notify.tape_full.action")
 
 	data := map[string]interface{}{
 		"Tape":   tapeLabel,
@@ -247,11 +292,12 @@ func (s *TelegramService) NotifyTapeFull(ctx context.Context, tapeLabel string,
 
 	return s.Send(ctx, &Notification{
 		Type:      NotifyTapeFull,
-		Title:     "Tape Full",
+		Title:     s.t("notify.tape_full.title"),
 		Message:   msg,
 		Priority:  "urgent",
 		Timestamp: time.Now(),
 		Data:      data,
+		Vars:      TemplateVars{Job: jobName, Tape: tapeLabel, NextTape: nextTape, Bytes: usedBytes},
 	})
 }
 
@@ -259,8 +305,8 @@ func (s *TelegramService) NotifyTapeFull(ctx context.Context, tapeLabel string,
 func (s *TelegramService) NotifyBackupStarted(ctx context.Context, jobName string, sourceCount int, backupType string) error {
 	return s.Send(ctx, &Notification{
 		Type:      NotifyBackupStart,
-		Title:     "Backup Started",
-		Message:   fmt.Sprintf("Backup job '%s' has started.\n\nType: %s\nSources: %d", jobName, backupType, sourceCount),
+		Title:     s.t("notify.backup_started.title"),
+		Message:   s.t("notify.backup_started.message", jobName, backupType, sourceCount),
 		Priority:  "normal",
 		Timestamp: time.Now(),
 		Data: map[string]interface{}{
@@ -268,6 +314,7 @@ func (s *TelegramService) NotifyBackupStarted(ctx context.Context, jobName strin
 			"Type":    backupType,
 			"Sources": sourceCount,
 		},
+		Vars: TemplateVars{Job: jobName, BackupType: backupType, Sources: sourceCount},
 	})
 }
 
@@ -276,8 +323,8 @@ func (s *TelegramService) NotifyBackupCompleted(ctx context.Context, jobName str
 	sizeGB := float64(totalBytes) / (1024 * 1024 * 1024)
 	return s.Send(ctx, &Notification{
 		Type:      NotifyBackupComplete,
-		Title:     "Backup Completed",
-		Message:   fmt.Sprintf("Backup job '%s' completed successfully.\n\nFiles: %d\nSize: %.2f GB\nDuration: %s", jobName, fileCount, sizeGB, duration.Round(time.Second)),
+		Title:     s.t("notify.backup_completed.title"),
+		Message:   s.t("notify.backup_completed.message", jobName, fileCount, sizeGB, duration.Round(time.Second)),
 		Priority:  "normal",
 		Timestamp: time.Now(),
 		Data: map[string]interface{}{
@@ -286,6 +333,7 @@ func (s *TelegramService) NotifyBackupCompleted(ctx context.Context, jobName str
 			"SizeGB":   fmt.Sprintf("%.2f", sizeGB),
 			"Duration": duration.Round(time.Second).String(),
 		},
+		Vars: TemplateVars{Job: jobName, Files: fileCount, Bytes: totalBytes, Duration: duration},
 	})
 }
 
@@ -293,14 +341,15 @@ func (s *TelegramService) NotifyBackupCompleted(ctx context.Context, jobName str
 func (s *TelegramService) NotifyBackupFailed(ctx context.Context, jobName string, errorMsg string) error {
 	return s.Send(ctx, &Notification{
 		Type:      NotifyBackupFailed,
-		Title:     "Backup Failed",
-		Message:   fmt.Sprintf("Backup job '%s' failed!\n\nError: %s\n\nPlease check the logs and tape status.", jobName, errorMsg),
+		Title:     s.t("notify.backup_failed.title"),
+		Message:   s.t("notify.backup_failed.message", jobName, errorMsg),
 		Priority:  "urgent",
 		Timestamp: time.Now(),
 		Data: map[string]interface{}{
 			"Job":   jobName,
 			"Error": errorMsg,
 		},
+		Vars: TemplateVars{Job: jobName, Error: errorMsg},
 	})
 }
 
@@ -308,14 +357,15 @@ func (s *TelegramService) NotifyBackupFailed(ctx context.Context, jobName string
 func (s *TelegramService) NotifyDriveError(ctx context.Context, devicePath string, errorMsg string) error {
 	return s.Send(ctx, &Notification{
 		Type:      NotifyDriveError,
-		Title:     "Drive Error",
-		Message:   fmt.Sprintf("Tape drive error detected!\n\nDevice: %s\nError: %s\n\nPlease check the drive status.", devicePath, errorMsg),
+		Title:     s.t("notify.drive_error.title"),
+		Message:   s.t("notify.drive_error.message", devicePath, errorMsg),
 		Priority:  "urgent",
 		Timestamp: time.Now(),
 		Data: map[string]interface{}{
 			"Device": devicePath,
 			"Error":  errorMsg,
 		},
+		Vars: TemplateVars{Device: devicePath, Error: errorMsg},
 	})
 }
 
@@ -323,17 +373,22 @@ func (s *TelegramService) NotifyDriveError(ctx context.Context, devicePath strin
 func (s *TelegramService) NotifyWrongTapeInserted(ctx context.Context, expectedLabel string, actualLabel string) error {
 	return s.Send(ctx, &Notification{
 		Type:      NotifyWrongTape,
-		Title:     "Wrong Tape Inserted",
-		Message:   fmt.Sprintf("The inserted tape does not match the expected tape.\n\nExpected: %s\nActual: %s\n\nPlease insert the correct tape.", expectedLabel, actualLabel),
+		Title:     s.t("notify.wrong_tape.title"),
+		Message:   s.t("notify.wrong_tape.message", expectedLabel, actualLabel),
 		Priority:  "high",
 		Timestamp: time.Now(),
 		Data: map[string]interface{}{
 			"Expected": expectedLabel,
 			"Actual":   actualLabel,
 		},
+		Vars: TemplateVars{Expected: expectedLabel, Actual: actualLabel, Tape: actualLabel},
 	})
 }
 
+// BotCommands lists the bot's commands in the order they are registered and
+// shown by /help; each has a telegram.cmd.<name> description in the catalog.
+var BotCommands = []string{"status", "health", "jobs", "tapes", "pools", "drives", "active", "language", "help"}
+
 // CommandHandler is called when a Telegram command is received
 type CommandHandler func(command string, args string) string
 
@@ -343,13 +398,9 @@ func (s *TelegramService) RegisterCommands(ctx context.Context) error {
 		return nil
 	}
 
-	commands := []map[string]string{
-		{"command": "status", "description": "Show current system status, loaded tape, and running jobs"},
-		{"command": "jobs", "description": "List backup jobs and their status"},
-		{"command": "tapes", "description": "List tapes and their status"},
-		{"command": "drives", "description": "Show tape drive status"},
-		{"command": "active", "description": "Show active/running backup operations"},
-		{"command": "help", "description": "Show available commands"},
+	var commands []map[string]string
+	for _, cmd := range BotCommands {
+		commands = append(commands, map[string]string{"command": cmd, "description": s.t("telegram.cmd." + cmd)})
 	}
 
 	url := fmt.Sprintf("https://api.telegram.org/bot%s/setMyCommands", s.config.BotToken)
@@ -6,6 +6,7 @@ import (
 	"encoding/json"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
 	"time"
 )
@@ -246,6 +247,31 @@ func TestFormatMessageEscapesTimestamp(t *testing.T) {
 	}
 }
 
+func TestFormatMessageLocalized(t *testing.T) {
+	svc := NewTelegramService(TelegramConfig{Language: "de"})
+
+	notification := &Notification{
+		Type:      NotifyTapeChange,
+		Title:     "Bandwechsel erforderlich",
+		Message:   "Test",
+		Priority:  "high",
+		Timestamp: time.Date(2024, 1, 15, 10, 30, 0, 0, time.UTC),
+		Data:      map[string]interface{}{"CurrentTape": "TAPE-001", "Custom": "x"},
+	}
+
+	result := svc.formatMessage("📼", notification)
+	for _, want := range []string{"Gesendet am 2024\\-01\\-15", "Aktuelles Band", "Custom"} {
+		if !strings.Contains(result, want) {
+			t.Errorf("expected %q in German message, got: %s", want, result)
+		}
+	}
+
+	svc.SetLanguage("fr")
+	if got := svc.formatMessage("📼", notification); !strings.Contains(got, "Bande actuelle") {
+		t.Errorf("expected French field label after SetLanguage, got: %s", got)
+	}
+}
+
 func TestNotificationHelpers(t *testing.T) {
 	// Test that helper functions create proper notifications
 	svc := NewTelegramService(TelegramConfig{Enabled: false})
@@ -277,6 +303,9 @@ func TestNotificationHelpers(t *testing.T) {
 		{"WrongTapeInserted", func() error {
 			return svc.NotifyWrongTapeInserted(ctx, "TAPE-001", "TAPE-002")
 		}},
+		{"BackupWindow", func() error {
+			return svc.NotifyBackupWindow(ctx, WindowSummary{})
+		}},
 	}
 
 	for _, tt := range tests {
@@ -288,3 +317,56 @@ func TestNotificationHelpers(t *testing.T) {
 		})
 	}
 }
+
+func TestWindowNotification(t *testing.T) {
+	to := time.Date(2024, 3, 20, 7, 0, 0, 0, time.UTC)
+	summary := WindowSummary{
+		From:      to.Add(-24 * time.Hour),
+		To:        to,
+		Succeeded: 2,
+		Failed:    1,
+		Bytes:     5 * 1024 * 1024 * 1024,
+		Tapes:     []string{"WEEKLY-001", "WEEKLY-002"},
+		Jobs: []WindowJobSummary{
+			{Name: "home", Runs: 2, Succeeded: 2, Bytes: 5 * 1024 * 1024 * 1024},
+			{Name: "mail", Runs: 1, Failed: 1, Error: "write error"},
+		},
+	}
+
+	n := windowNotification("en", summary)
+	if n.Type != NotifyBackupWindow || n.Priority != "high" {
+		t.Errorf("expected a high priority backup_window notification, got %s/%s", n.Type, n.Priority)
+	}
+	for _, want := range []string{"2 succeeded, 1 failed", "5.00 GB written to 2 tape(s)", "home: 2 run(s)", "mail: 1 of 1 run(s) failed: write error"} {
+		if !strings.Contains(n.Message, want) {
+			t.Errorf("expected message to contain %q, got: %s", want, n.Message)
+		}
+	}
+	if n.Data["Tapes"] != "WEEKLY-001, WEEKLY-002" {
+		t.Errorf("expected tapes in data, got %v", n.Data["Tapes"])
+	}
+
+	empty := windowNotification("en", WindowSummary{From: summary.From, To: to})
+	if empty.Priority != "normal" || !strings.Contains(empty.Message, "No scheduled backups") {
+		t.Errorf("unexpected empty window notification: %+v", empty)
+	}
+}
+
+func TestIntegrityNotification(t *testing.T) {
+	n := integrityNotification("en", IntegrityAlert{Problems: []string{"database disk image is malformed"}})
+	if n.Type != NotifyDatabaseIntegrity || n.Priority != "urgent" {
+		t.Errorf("expected an urgent database_integrity notification, got %s/%s", n.Type, n.Priority)
+	}
+	if !strings.Contains(n.Message, "from tape") || n.Data["Error"] != "database disk image is malformed" {
+		t.Errorf("unexpected corruption alert: %+v", n)
+	}
+
+	at := time.Date(2024, 3, 20, 3, 30, 0, 0, time.UTC)
+	n = integrityNotification("de", IntegrityAlert{Snapshot: "tapebackarr-20240320-033000.db", SnapshotTime: at})
+	if !strings.Contains(n.Message, "tapebackarr-20240320-033000.db") || !strings.Contains(n.Message, "2024-03-20 03:30") {
+		t.Errorf("expected the snapshot in the recovery alert, got: %s", n.Message)
+	}
+	if n.Data["Snapshot"] != "tapebackarr-20240320-033000.db" {
+		t.Errorf("expected the snapshot in data, got %v", n.Data)
+	}
+}
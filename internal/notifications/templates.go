@@ -0,0 +1,276 @@
+package notifications
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+)
+
+// Notification channels a template can target. ChannelAll applies to every
+// channel that has no template of its own for the event.
+const (
+	ChannelTelegram = "telegram"
+	ChannelEmail    = "email"
+	ChannelAll      = "all"
+)
+
+// maxTemplateSize bounds a single title or body template
+const maxTemplateSize = 8192
+
+// TemplateEvents lists the notification types that can be templated
+var TemplateEvents = []NotificationType{
+	NotifyTapeChange,
+	NotifyTapeFull,
+	NotifyBackupStart,
+	NotifyBackupComplete,
+	NotifyBackupFailed,
+	NotifyDriveError,
+	NotifyWrongTape,
+	NotifyBackupWindow,
+	NotifyTest,
+}
+
+// NotifyTest is the type of the configuration test message
+const NotifyTest NotificationType = "test"
+
+// TemplateVars are the variables available to notification templates, in
+// addition to the default .Title and .Message. Fields that do not apply to
+// an event are left empty.
+type TemplateVars struct {
+	Job        string
+	Tape       string
+	NextTape   string
+	Reason     string
+	BackupType string
+	Sources    int
+	Files      int64
+	Bytes      int64
+	Duration   time.Duration
+	Error      string
+	Device     string
+	Expected   string
+	Actual     string
+	Succeeded  int
+	Failed     int
+	Tapes      string
+}
+
+// TemplateData is the value templates are executed against
+type TemplateData struct {
+	TemplateVars
+	Event     NotificationType
+	Channel   string
+	Title     string
+	Message   string
+	Priority  string
+	Timestamp time.Time
+	Data      map[string]interface{}
+}
+
+// templateFuncs are the helpers available to notification templates
+var templateFuncs = template.FuncMap{
+	"bytes": formatTemplateBytes,
+	"upper": strings.ToUpper,
+	"lower": strings.ToLower,
+	"date":  func(layout string, t time.Time) string { return t.Format(layout) },
+	"round": func(d time.Duration) time.Duration { return d.Round(time.Second) },
+}
+
+// formatTemplateBytes renders a byte count with binary units
+func formatTemplateBytes(b int64) string {
+	const unit = 1024
+	if b < unit {
+		return fmt.Sprintf("%d B", b)
+	}
+	div, exp := int64(unit), 0
+	for n := b / unit; n >= unit && exp < 4; n /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.2f %cB", float64(b)/float64(div), "KMGTP"[exp])
+}
+
+// MessageTemplate is an admin-defined title/body override for one event
+// type on one channel. An empty title keeps the built-in title.
+type MessageTemplate struct {
+	Event   NotificationType `json:"event_type"`
+	Channel string           `json:"channel"`
+	Title   string           `json:"title_template"`
+	Body    string           `json:"body_template"`
+}
+
+type compiledTemplate struct {
+	title *template.Template
+	body  *template.Template
+}
+
+// templateStore holds the active templates. It is shared by every Telegram
+// and email service in the process so templates edited through the API take
+// effect without recreating the services.
+var templateStore = struct {
+	sync.RWMutex
+	templates map[string]*compiledTemplate
+}{templates: make(map[string]*compiledTemplate)}
+
+func templateKey(event NotificationType, channel string) string {
+	return string(event) + "/" + channel
+}
+
+// compile parses and test-renders a template against sample data so field
+// typos are rejected when the template is saved rather than when it fires.
+func (t MessageTemplate) compile() (*compiledTemplate, error) {
+	if !validTemplateEvent(t.Event) {
+		return nil, fmt.Errorf("unknown event type %q", t.Event)
+	}
+	switch t.Channel {
+	case ChannelTelegram, ChannelEmail, ChannelAll:
+	default:
+		return nil, fmt.Errorf("channel must be %s, %s or %s", ChannelTelegram, ChannelEmail, ChannelAll)
+	}
+	if strings.TrimSpace(t.Body) == "" {
+		return nil, fmt.Errorf("body_template is required")
+	}
+	if len(t.Title) > maxTemplateSize || len(t.Body) > maxTemplateSize {
+		return nil, fmt.Errorf("templates are limited to %d bytes", maxTemplateSize)
+	}
+
+	c := &compiledTemplate{}
+	var err error
+	if t.Title != "" {
+		if c.title, err = template.New("title").Funcs(templateFuncs).Parse(t.Title); err != nil {
+			return nil, fmt.Errorf("title_template: %w", err)
+		}
+	}
+	if c.body, err = template.New("body").Funcs(templateFuncs).Parse(t.Body); err != nil {
+		return nil, fmt.Errorf("body_template: %w", err)
+	}
+	if _, _, err := c.render(SampleTemplateData(t.Event, t.Channel)); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+func (c *compiledTemplate) render(data *TemplateData) (string, string, error) {
+	title := data.Title
+	if c.title != nil {
+		var buf bytes.Buffer
+		if err := c.title.Execute(&buf, data); err != nil {
+			return "", "", fmt.Errorf("title_template: %w", err)
+		}
+		title = strings.TrimSpace(buf.String())
+	}
+	var buf bytes.Buffer
+	if err := c.body.Execute(&buf, data); err != nil {
+		return "", "", fmt.Errorf("body_template: %w", err)
+	}
+	return title, strings.TrimSpace(buf.String()), nil
+}
+
+func validTemplateEvent(event NotificationType) bool {
+	for _, e := range TemplateEvents {
+		if e == event {
+			return true
+		}
+	}
+	return false
+}
+
+// ValidateTemplate checks that a template parses and renders
+func ValidateTemplate(t MessageTemplate) error {
+	_, err := t.compile()
+	return err
+}
+
+// PreviewTemplate renders a template against sample data for its event
+func PreviewTemplate(t MessageTemplate) (string, string, error) {
+	c, err := t.compile()
+	if err != nil {
+		return "", "", err
+	}
+	return c.render(SampleTemplateData(t.Event, t.Channel))
+}
+
+// LoadTemplates replaces the active templates. Every template is validated
+// first; on error the previous set stays active.
+func LoadTemplates(templates []MessageTemplate) error {
+	compiled := make(map[string]*compiledTemplate, len(templates))
+	for _, t := range templates {
+		c, err := t.compile()
+		if err != nil {
+			return fmt.Errorf("%s/%s: %w", t.Event, t.Channel, err)
+		}
+		compiled[templateKey(t.Event, t.Channel)] = c
+	}
+	templateStore.Lock()
+	templateStore.templates = compiled
+	templateStore.Unlock()
+	return nil
+}
+
+// applyTemplate returns n with its title and message replaced by the
+// channel's template for n.Type, if one is configured. A template that fails
+// to execute leaves the built-in message in place so an alert is never lost.
+func applyTemplate(n *Notification, channel string) *Notification {
+	templateStore.RLock()
+	c := templateStore.templates[templateKey(n.Type, channel)]
+	if c == nil {
+		c = templateStore.templates[templateKey(n.Type, ChannelAll)]
+	}
+	templateStore.RUnlock()
+	if c == nil {
+		return n
+	}
+
+	title, body, err := c.render(&TemplateData{
+		TemplateVars: n.Vars,
+		Event:        n.Type,
+		Channel:      channel,
+		Title:        n.Title,
+		Message:      n.Message,
+		Priority:     n.Priority,
+		Timestamp:    n.Timestamp,
+		Data:         n.Data,
+	})
+	if err != nil {
+		return n
+	}
+	out := *n
+	out.Title = title
+	out.Message = body
+	return &out
+}
+
+// SampleTemplateData returns representative data for previewing and
+// validating templates of the given event type.
+func SampleTemplateData(event NotificationType, channel string) *TemplateData {
+	return &TemplateData{
+		TemplateVars: TemplateVars{
+			Job:        "Daily-FileServer",
+			Tape:       "WEEKLY-001",
+			NextTape:   "WEEKLY-002",
+			Reason:     "tape full",
+			BackupType: "incremental",
+			Sources:    1,
+			Files:      12345,
+			Bytes:      1288490188800,
+			Duration:   2*time.Hour + 14*time.Minute + 5*time.Second,
+			Error:      "write error: input/output error",
+			Device:     "/dev/nst0",
+			Expected:   "WEEKLY-002",
+			Actual:     "MONTHLY-007",
+			Succeeded:  4,
+			Failed:     1,
+			Tapes:      "WEEKLY-001, WEEKLY-002",
+		},
+		Event:     event,
+		Channel:   channel,
+		Title:     "Sample " + string(event) + " notification",
+		Message:   "This is the built-in message for the event.",
+		Priority:  "normal",
+		Timestamp: time.Date(2024, 1, 15, 14, 30, 45, 0, time.UTC),
+		Data:      map[string]interface{}{"Job": "Daily-FileServer"},
+	}
+}
@@ -0,0 +1,108 @@
+package notifications
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestValidateTemplate(t *testing.T) {
+	tests := []struct {
+		name    string
+		tmpl    MessageTemplate
+		wantErr bool
+	}{
+		{"valid", MessageTemplate{Event: NotifyBackupComplete, Channel: ChannelAll, Body: "{{.Job}} wrote {{bytes .Bytes}}"}, false},
+		{"unknown event", MessageTemplate{Event: "nope", Channel: ChannelAll, Body: "x"}, true},
+		{"unknown channel", MessageTemplate{Event: NotifyBackupFailed, Channel: "sms", Body: "x"}, true},
+		{"empty body", MessageTemplate{Event: NotifyBackupFailed, Channel: ChannelEmail, Body: "  "}, true},
+		{"parse error", MessageTemplate{Event: NotifyBackupFailed, Channel: ChannelEmail, Body: "{{.Job"}, true},
+		{"unknown field", MessageTemplate{Event: NotifyBackupFailed, Channel: ChannelEmail, Body: "{{.JobName}}"}, true},
+		{"too large", MessageTemplate{Event: NotifyBackupFailed, Channel: ChannelEmail, Body: strings.Repeat("x", maxTemplateSize+1)}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := ValidateTemplate(tt.tmpl); (err != nil) != tt.wantErr {
+				t.Errorf("ValidateTemplate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestPreviewTemplate(t *testing.T) {
+	title, body, err := PreviewTemplate(MessageTemplate{
+		Event:   NotifyBackupComplete,
+		Channel: ChannelTelegram,
+		Title:   "[{{upper .Job}}] done",
+		Body:    "{{bytes .Bytes}} in {{round .Duration}} - see https://wiki/runbooks/{{.Event}}",
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if title != "[DAILY-FILESERVER] done" {
+		t.Errorf("unexpected title %q", title)
+	}
+	if body != "1.17 TB in 2h14m5s - see https://wiki/runbooks/backup_complete" {
+		t.Errorf("unexpected body %q", body)
+	}
+}
+
+func TestApplyTemplate(t *testing.T) {
+	defer LoadTemplates(nil)
+
+	n := &Notification{
+		Type:      NotifyBackupFailed,
+		Title:     "Backup Failed",
+		Message:   "built-in",
+		Timestamp: time.Now(),
+		Vars:      TemplateVars{Job: "nightly", Error: "drive offline"},
+	}
+
+	if got := applyTemplate(n, ChannelEmail); got != n {
+		t.Error("expected the notification to be unchanged without templates")
+	}
+
+	if err := LoadTemplates([]MessageTemplate{
+		{Event: NotifyBackupFailed, Channel: ChannelAll, Body: "{{.Job}}: {{.Error}}"},
+		{Event: NotifyBackupFailed, Channel: ChannelTelegram, Title: "TG {{.Title}}", Body: "{{.Message}} ({{.Channel}})"},
+	}); err != nil {
+		t.Fatalf("LoadTemplates: %v", err)
+	}
+
+	got := applyTemplate(n, ChannelEmail)
+	if got.Title != "Backup Failed" || got.Message != "nightly: drive offline" {
+		t.Errorf("expected the 'all' template for email, got %q / %q", got.Title, got.Message)
+	}
+	got = applyTemplate(n, ChannelTelegram)
+	if got.Title != "TG Backup Failed" || got.Message != "built-in (telegram)" {
+		t.Errorf("expected the telegram template, got %q / %q", got.Title, got.Message)
+	}
+	if n.Message != "built-in" {
+		t.Error("applyTemplate must not modify the original notification")
+	}
+
+	// An invalid set is rejected and the active templates are kept
+	if err := LoadTemplates([]MessageTemplate{{Event: NotifyBackupFailed, Channel: ChannelAll, Body: "{{.Nope}}"}}); err == nil {
+		t.Error("expected an invalid template to be rejected")
+	}
+	if got := applyTemplate(n, ChannelEmail); got.Message != "nightly: drive offline" {
+		t.Errorf("expected previous templates to stay active, got %q", got.Message)
+	}
+}
+
+func TestApplyTemplateExecutionErrorFallsBack(t *testing.T) {
+	defer LoadTemplates(nil)
+
+	// index on a missing Data key passes validation against the sample data
+	// but fails for a notification without data
+	if err := LoadTemplates([]MessageTemplate{
+		{Event: NotifyDriveError, Channel: ChannelAll, Body: `{{index .Data "Job" | len}}`},
+	}); err != nil {
+		t.Fatalf("LoadTemplates: %v", err)
+	}
+
+	n := &Notification{Type: NotifyDriveError, Title: "Drive Error", Message: "built-in"}
+	if got := applyTemplate(n, ChannelTelegram); got.Message != "built-in" {
+		t.Errorf("expected built-in message on execution error, got %q", got.Message)
+	}
+}
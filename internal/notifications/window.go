@@ -0,0 +1,102 @@
+package notifications
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/RoseOO/TapeBackarr/internal/i18n"
+)
+
+// NotifyBackupWindow is the type of the consolidated backup window report
+const NotifyBackupWindow NotificationType = "backup_window"
+
+// WindowJobSummary is one job's line in a backup window report
+type WindowJobSummary struct {
+	Name      string
+	Runs      int
+	Succeeded int
+	Failed    int
+	Running   int
+	Bytes     int64
+	Error     string
+}
+
+// WindowSummary is the consolidated result of every scheduled backup that
+// ran within one backup window.
+type WindowSummary struct {
+	From      time.Time
+	To        time.Time
+	Jobs      []WindowJobSummary
+	Succeeded int
+	Failed    int
+	Running   int
+	Files     int64
+	Bytes     int64
+	Tapes     []string
+}
+
+// windowNotification builds the report notification in the given language.
+// It is sent with high priority when any run failed.
+func windowNotification(lang i18n.Lang, summary WindowSummary) *Notification {
+	const layout = "2006-01-02 15:04"
+	window := summary.From.Format(layout) + " – " + summary.To.Format(layout)
+	size := formatTemplateBytes(summary.Bytes)
+
+	var lines []string
+	for _, job := range summary.Jobs {
+		switch {
+		case job.Failed > 0:
+			lines = append(lines, i18n.T(lang, "notify.backup_window.job_failed", job.Name, job.Failed, job.Runs, job.Error))
+		case job.Running > 0:
+			lines = append(lines, i18n.T(lang, "notify.backup_window.job_running", job.Name))
+		default:
+			lines = append(lines, i18n.T(lang, "notify.backup_window.job_ok", job.Name, job.Runs, formatTemplateBytes(job.Bytes)))
+		}
+	}
+	message := i18n.T(lang, "notify.backup_window.none")
+	if len(lines) > 0 {
+		message = i18n.T(lang, "notify.backup_window.message", summary.Succeeded, summary.Failed, summary.Running, size, len(summary.Tapes)) +
+			"\n\n" + strings.Join(lines, "\n")
+	}
+
+	priority := "normal"
+	if summary.Failed > 0 {
+		priority = "high"
+	}
+	tapes := strings.Join(summary.Tapes, ", ")
+	data := map[string]interface{}{
+		"Window":    window,
+		"Succeeded": summary.Succeeded,
+		"Failed":    summary.Failed,
+		"Size":      size,
+	}
+	if tapes != "" {
+		data["Tapes"] = tapes
+	}
+	return &Notification{
+		Type:      NotifyBackupWindow,
+		Title:     i18n.T(lang, "notify.backup_window.title"),
+		Message:   message,
+		Priority:  priority,
+		Timestamp: time.Now(),
+		Data:      data,
+		Vars: TemplateVars{
+			Files:     summary.Files,
+			Bytes:     summary.Bytes,
+			Succeeded: summary.Succeeded,
+			Failed:    summary.Failed,
+			Tapes:     tapes,
+		},
+	}
+}
+
+// NotifyBackupWindow sends the consolidated backup window report
+func (s *TelegramService) NotifyBackupWindow(ctx context.Context, summary WindowSummary) error {
+	return s.Send(ctx, windowNotification(s.Language(), summary))
+}
+
+// NotifyBackupWindow sends the consolidated backup window report via email
+func (s *EmailService) NotifyBackupWindow(ctx context.Context, summary WindowSummary) error {
+	return s.Send(ctx, windowNotification(s.Language(), summary))
+}
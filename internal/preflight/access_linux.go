@@ -0,0 +1,27 @@
+package preflight
+
+import (
+	"os"
+	"os/user"
+	"strconv"
+	"syscall"
+)
+
+// accessReadWrite checks that the process may open path for reading and
+// writing, without opening it: opening a tape device can rewind it
+func accessReadWrite(path string) error {
+	return syscall.Access(path, 0x4|0x2) // R_OK | W_OK
+}
+
+// deviceGroup returns the group owning a device and whether it may write
+func deviceGroup(info os.FileInfo) (string, bool) {
+	st, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return "", false
+	}
+	name := strconv.Itoa(int(st.Gid))
+	if g, err := user.LookupGroupId(name); err == nil {
+		name = g.Name
+	}
+	return name, info.Mode().Perm()&0060 == 0060
+}
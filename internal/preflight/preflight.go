@@ -0,0 +1,287 @@
+// Package preflight checks that the user TapeBackarr runs as can reach what
+// it drives: the tape devices, the library changers and the external tools
+// it runs. Problems are found at startup and in the health check, with what
+// to do about them, instead of when a job starts at night.
+package preflight
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"os/user"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/RoseOO/TapeBackarr/internal/database"
+	"github.com/RoseOO/TapeBackarr/internal/tape"
+)
+
+// Check kinds
+const (
+	KindDevice  = "device"
+	KindChanger = "changer"
+	KindTool    = "tool"
+)
+
+// Check statuses
+const (
+	StatusOK      = "ok"
+	StatusMissing = "missing"
+	StatusDenied  = "denied"
+)
+
+// Features a failed check disables
+const (
+	FeatureBackup      = "backup"
+	FeatureTape        = "tape"
+	FeatureLibrary     = "library"
+	FeatureBuffering   = "buffering"
+	FeatureCompression = "compression"
+	FeatureEncryption  = "hardware_encryption"
+	FeatureDiagnostics = "diagnostics"
+	FeatureLTFS        = "ltfs"
+	FeatureS3          = "s3"
+)
+
+// Check is the result of one check
+type Check struct {
+	Kind string `json:"kind"`
+	// Name is the tool, or the drive or library name for devices
+	Name string `json:"name"`
+	// Path is the device path or where the tool was found
+	Path    string `json:"path,omitempty"`
+	Status  string `json:"status"`
+	Feature string `json:"feature"`
+	// Required checks are needed by something that is configured; optional
+	// ones only limit a feature
+	Required bool   `json:"required"`
+	Error    string `json:"error,omitempty"`
+	// Hint says how to fix a failed check
+	Hint string `json:"hint,omitempty"`
+}
+
+// OK reports whether the check passed
+func (c Check) OK() bool {
+	return c.Status == StatusOK
+}
+
+// Report is the result of a run
+type Report struct {
+	CheckedAt time.Time `json:"checked_at"`
+	User      string    `json:"user"`
+	UID       int       `json:"uid"`
+	Root      bool      `json:"root"`
+	Checks    []Check   `json:"checks"`
+	// Disabled lists the features a failed check disables
+	Disabled []string `json:"disabled_features"`
+	// UnavailableChangers maps the changer devices that cannot be used to
+	// why; the empty path stands for all changers
+	UnavailableChangers map[string]string `json:"-"`
+}
+
+// OK reports whether every required check passed
+func (r *Report) OK() bool {
+	for _, c := range r.Checks {
+		if c.Required && !c.OK() {
+			return false
+		}
+	}
+	return true
+}
+
+// Problems returns the failed checks, required ones first
+func (r *Report) Problems() []Check {
+	var required, optional []Check
+	for _, c := range r.Checks {
+		switch {
+		case c.OK():
+		case c.Required:
+			required = append(required, c)
+		default:
+			optional = append(optional, c)
+		}
+	}
+	return append(required, optional...)
+}
+
+// Device is a configured drive or library changer
+type Device struct {
+	Name string
+	Path string
+}
+
+// Targets are what a run checks
+type Targets struct {
+	Drives   []Device
+	Changers []Device
+}
+
+// LoadTargets reads the enabled drives and libraries from the database
+func LoadTargets(db *database.DB) (Targets, error) {
+	var t Targets
+	var err error
+	if t.Drives, err = loadDevices(db, "SELECT COALESCE(display_name, ''), device_path FROM tape_drives WHERE COALESCE(enabled, 1) = 1 ORDER BY id"); err != nil {
+		return t, err
+	}
+	if t.Changers, err = loadDevices(db, "SELECT name, device_path FROM tape_libraries WHERE COALESCE(enabled, 1) = 1 ORDER BY id"); err != nil {
+		return t, err
+	}
+	return t, nil
+}
+
+func loadDevices(db *database.DB, query string) ([]Device, error) {
+	rows, err := db.Query(query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var devices []Device
+	for rows.Next() {
+		var d Device
+		if err := rows.Scan(&d.Name, &d.Path); err != nil {
+			return nil, err
+		}
+		if d.Name == "" {
+			d.Name = d.Path
+		}
+		devices = append(devices, d)
+	}
+	return devices, rows.Err()
+}
+
+// tool is an external program TapeBackarr runs
+type tool struct {
+	name    string
+	feature string
+	pkg     string // Debian package providing it
+	// essential tools disable their feature when missing; without the
+	// others it falls back to slower or reduced behaviour
+	essential bool
+}
+
+// optionalTools are not needed by every setup
+var optionalTools = []tool{
+	{"mbuffer", FeatureBuffering, "mbuffer", false},
+	{"pigz", FeatureCompression, "pigz", false},
+	{"zstd", FeatureCompression, "zstd", false},
+	{"stenc", FeatureEncryption, "stenc", true},
+	{"sg_logs", FeatureDiagnostics, "sg3-utils", false},
+	{"sg_inq", FeatureDiagnostics, "sg3-utils", false},
+	{"tapeinfo", FeatureDiagnostics, "mtx", false},
+	{"lsscsi", FeatureDiagnostics, "lsscsi", false},
+	{"mkltfs", FeatureLTFS, "the LTFS software of the drive vendor", true},
+	{"ltfs", FeatureLTFS, "the LTFS software of the drive vendor", true},
+	{"ltfsck", FeatureLTFS, "the LTFS software of the drive vendor", true},
+}
+
+// lookPath finds a tool; replaced in tests
+var lookPath = exec.LookPath
+
+// Run checks the targets as the current user
+func Run(t Targets) *Report {
+	r := &Report{CheckedAt: time.Now().UTC(), UID: os.Geteuid(), UnavailableChangers: map[string]string{}}
+	r.Root = r.UID == 0
+	r.User = strconv.Itoa(r.UID)
+	if u, err := user.LookupId(r.User); err == nil {
+		r.User = u.Username
+	}
+
+	var physical, s3 bool
+	for _, d := range t.Drives {
+		switch tape.BackendTypeOf(d.Path) {
+		case tape.BackendTape:
+			physical = true
+			r.add(r.checkDevice(KindDevice, d, FeatureTape), true)
+		case tape.BackendS3:
+			s3 = true
+		}
+	}
+
+	r.add(r.checkTool(tool{"tar", FeatureBackup, "tar", true}, true), true)
+	r.add(r.checkTool(tool{"mt", FeatureTape, "mt-st", true}, physical), physical)
+	r.add(r.checkTool(tool{"aws", FeatureS3, "awscli", true}, s3), s3)
+
+	if len(t.Changers) > 0 {
+		mtx := r.checkTool(tool{"mtx", FeatureLibrary, "mtx", true}, true)
+		r.add(mtx, true)
+		if !mtx.OK() {
+			r.UnavailableChangers[""] = mtx.Error
+		}
+		for _, c := range t.Changers {
+			check := r.checkDevice(KindChanger, c, FeatureLibrary)
+			r.add(check, true)
+			if !check.OK() {
+				r.UnavailableChangers[c.Path] = check.Error
+			}
+		}
+	}
+
+	for _, tl := range optionalTools {
+		r.add(r.checkTool(tl, false), tl.essential)
+	}
+	return r
+}
+
+// add records a check and, when it failed and the feature cannot work
+// without it, the feature as disabled
+func (r *Report) add(c Check, disables bool) {
+	r.Checks = append(r.Checks, c)
+	if c.OK() || !disables {
+		return
+	}
+	for _, f := range r.Disabled {
+		if f == c.Feature {
+			return
+		}
+	}
+	r.Disabled = append(r.Disabled, c.Feature)
+}
+
+func (r *Report) checkTool(tl tool, required bool) Check {
+	c := Check{Kind: KindTool, Name: tl.name, Feature: tl.feature, Required: required, Status: StatusOK}
+	path, err := lookPath(tl.name)
+	if err != nil {
+		c.Status = StatusMissing
+		c.Error = fmt.Sprintf("%s was not found in PATH", tl.name)
+		if strings.HasPrefix(tl.pkg, "the ") {
+			c.Hint = "Install " + tl.pkg
+		} else {
+			c.Hint = fmt.Sprintf("Install the %s package (e.g. apt install %s)", tl.pkg, tl.pkg)
+		}
+		return c
+	}
+	c.Path = path
+	return c
+}
+
+func (r *Report) checkDevice(kind string, d Device, feature string) Check {
+	c := Check{Kind: kind, Name: d.Name, Path: d.Path, Feature: feature, Required: true, Status: StatusOK}
+	info, err := os.Stat(d.Path)
+	if err != nil {
+		c.Status = StatusMissing
+		c.Error = fmt.Sprintf("%s does not exist", d.Path)
+		if kind == KindChanger {
+			c.Hint = "Check the changer path with lsscsi --generic; changers are /dev/sg* devices or /dev/tape/by-id links"
+		} else {
+			c.Hint = "Check the drive path with lsscsi --generic and that the st module is loaded; prefer the /dev/tape/by-id links, which survive reboots"
+		}
+		return c
+	}
+	if err := accessReadWrite(d.Path); err != nil {
+		c.Status = StatusDenied
+		c.Error = fmt.Sprintf("%s cannot open %s for reading and writing: %v", r.User, d.Path, err)
+		c.Hint = deviceHint(r.User, d.Path, info)
+	}
+	return c
+}
+
+// deviceHint names the group to add the user to, or a udev rule when the
+// device's group has no write access
+func deviceHint(username, path string, info os.FileInfo) string {
+	group, groupWritable := deviceGroup(info)
+	if group != "" && groupWritable {
+		return fmt.Sprintf("Add %s to the %s group that owns %s (usermod -aG %s %s) and restart TapeBackarr", username, group, path, group, username)
+	}
+	return fmt.Sprintf("Give a group %s is in read and write access to %s with a udev rule, e.g. KERNEL==\"nst*|sg*\", GROUP=\"tape\", MODE=\"0660\", and restart TapeBackarr", username, path)
+}
@@ -0,0 +1,96 @@
+package preflight
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRun(t *testing.T) {
+	installed := map[string]bool{"tar": true, "mt": true, "mbuffer": true}
+	orig := lookPath
+	defer func() { lookPath = orig }()
+	lookPath = func(name string) (string, error) {
+		if installed[name] {
+			return "/usr/bin/" + name, nil
+		}
+		return "", errors.New("not found")
+	}
+
+	dir := t.TempDir()
+	drive := filepath.Join(dir, "nst0")
+	changer := filepath.Join(dir, "sg3")
+	for _, p := range []string{drive, changer} {
+		if err := os.WriteFile(p, nil, 0660); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	report := Run(Targets{
+		Drives: []Device{
+			{Name: "lto9", Path: drive},
+			{Name: "gone", Path: filepath.Join(dir, "nst1")},
+			{Name: "vtape", Path: "file://" + dir},
+		},
+		Changers: []Device{{Name: "library", Path: changer}},
+	})
+
+	find := func(kind, name string) Check {
+		for _, c := range report.Checks {
+			if c.Kind == kind && c.Name == name {
+				return c
+			}
+		}
+		t.Fatalf("no %s check for %s", kind, name)
+		return Check{}
+	}
+	if c := find(KindDevice, "lto9"); !c.OK() {
+		t.Errorf("expected the drive usable, got %+v", c)
+	}
+	if c := find(KindDevice, "gone"); c.Status != StatusMissing || !c.Required || c.Hint == "" {
+		t.Errorf("expected a missing drive with a hint, got %+v", c)
+	}
+	for _, c := range report.Checks {
+		if c.Name == "vtape" {
+			t.Errorf("expected virtual drives not to be checked, got %+v", c)
+		}
+	}
+	if c := find(KindTool, "mtx"); c.Status != StatusMissing || !c.Required || !strings.Contains(c.Hint, "apt install mtx") {
+		t.Errorf("expected mtx required with an install hint, got %+v", c)
+	}
+	if c := find(KindTool, "aws"); c.Required {
+		t.Errorf("expected aws optional without S3 drives, got %+v", c)
+	}
+	if c := find(KindTool, "pigz"); c.Required || c.OK() {
+		t.Errorf("expected pigz missing and optional, got %+v", c)
+	}
+	if report.OK() {
+		t.Error("expected the report to fail on the missing drive and mtx")
+	}
+	if _, ok := report.UnavailableChangers[""]; !ok {
+		t.Errorf("expected every changer unavailable without mtx, got %v", report.UnavailableChangers)
+	}
+	if got := strings.Join(report.Disabled, ","); got != "tape,library,hardware_encryption,ltfs" {
+		t.Errorf("unexpected disabled features %s", got)
+	}
+	if problems := report.Problems(); len(problems) == 0 || !problems[0].Required || problems[len(problems)-1].Required {
+		t.Errorf("expected required problems first, got %+v", problems)
+	}
+}
+
+func TestRunDeniedDevice(t *testing.T) {
+	if os.Geteuid() == 0 {
+		t.Skip("root can open any device")
+	}
+	drive := filepath.Join(t.TempDir(), "nst0")
+	if err := os.WriteFile(drive, nil, 0400); err != nil {
+		t.Fatal(err)
+	}
+	report := Run(Targets{Drives: []Device{{Name: "lto9", Path: drive}}})
+	c := report.Checks[0]
+	if c.Status != StatusDenied || c.Hint == "" {
+		t.Errorf("expected access denied with a hint, got %+v", c)
+	}
+}
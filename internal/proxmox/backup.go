@@ -1,6 +1,7 @@
 package proxmox
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
 	"fmt"
@@ -8,11 +9,13 @@ import (
 	"os"
 	"os/exec"
 	"path/filepath"
+	"strconv"
 	"strings"
 	"time"
 
 	"github.com/RoseOO/TapeBackarr/internal/database"
 	"github.com/RoseOO/TapeBackarr/internal/logging"
+	"github.com/RoseOO/TapeBackarr/internal/scratch"
 	"github.com/RoseOO/TapeBackarr/internal/tape"
 )
 
@@ -43,11 +46,31 @@ type ProxmoxBackupRequest struct {
 	Compress   string     `json:"compress"` // zstd, lzo, gzip, or empty
 	TapeID     int64      `json:"tape_id"`
 	Notes      string     `json:"notes,omitempty"`
+	BWLimit    int        `json:"bwlimit,omitempty"` // KiB/s, passed to vzdump --bwlimit
+	IONice     *int       `json:"ionice,omitempty"`  // vzdump --ionice priority, 0-8
+}
+
+// BackupRunOptions selects the guests of a multi-guest backup run and
+// limits its impact on the cluster
+type BackupRunOptions struct {
+	Node       string   // Only this node's guests; empty = all online nodes
+	DumpNodes  []string // Nodes allowed to perform dumps; empty = any
+	ExcludeTag string   // Guests with this tag are left out; empty = none
+	TapeID     int64
+	Mode       BackupMode
+	Compress   string
+	BWLimit    int
+	IONice     *int
+	// Parallelism is how many guests are dumped at once into the staging
+	// area. Tape writes stay sequential. At 1 or less each dump is streamed
+	// straight to tape without staging.
+	Parallelism int
 }
 
 // ProxmoxBackupResult represents the result of a Proxmox backup
 type ProxmoxBackupResult struct {
 	BackupID    int64     `json:"backup_id"`
+	ClusterID   *int64    `json:"cluster_id,omitempty"`
 	Node        string    `json:"node"`
 	VMID        int       `json:"vmid"`
 	GuestType   GuestType `json:"guest_type"`
@@ -60,6 +83,11 @@ type ProxmoxBackupResult struct {
 	Status      string    `json:"status"`
 	ConfigSaved bool      `json:"config_saved"`
 	Error       string    `json:"error,omitempty"`
+
+	// Outcome of the last read-back check; empty if never verified
+	VerifyStatus string     `json:"verify_status,omitempty"`
+	VerifiedAt   *time.Time `json:"verified_at,omitempty"`
+	VerifyError  string     `json:"verify_error,omitempty"`
 }
 
 // ProxmoxBackupMetadata stores metadata about a Proxmox backup for restore
@@ -88,6 +116,8 @@ type BackupService struct {
 	logger      *logging.Logger
 	blockSize   int
 	tmpDir      string // Temporary directory for vzdump output before streaming
+	scratch     *scratch.Dir
+	clusterID   *int64 // nil for the configured endpoint
 }
 
 // NewBackupService creates a new Proxmox backup service
@@ -107,10 +137,31 @@ func (s *BackupService) SetTempDir(dir string) {
 	s.tmpDir = dir
 }
 
+// SetScratchDir stages backup data in a subdirectory of the shared scratch
+// directory and enforces its free-space reserve. Call SetTempDir afterwards
+// to override the location.
+func (s *BackupService) SetScratchDir(d *scratch.Dir) {
+	s.scratch = d
+	s.tmpDir = d.Path("proxmox")
+}
+
+// SetClusterID scopes the service to a registered cluster: its backups are
+// recorded with the cluster's ID, and only those are listed
+func (s *BackupService) SetClusterID(id int64) {
+	s.clusterID = &id
+}
+
 // BackupGuest performs a backup of a VM or LXC container to tape
 func (s *BackupService) BackupGuest(ctx context.Context, req *ProxmoxBackupRequest) (*ProxmoxBackupResult, error) {
+	return s.backupGuest(ctx, req, nil)
+}
+
+// backupGuest writes a guest's backup to tape, from a dump already in the
+// staging area when staged is not nil or else straight from vzdump
+func (s *BackupService) backupGuest(ctx context.Context, req *ProxmoxBackupRequest, staged *stagedDump) (*ProxmoxBackupResult, error) {
 	startTime := time.Now()
 	result := &ProxmoxBackupResult{
+		ClusterID: s.clusterID,
 		Node:      req.Node,
 		VMID:      req.VMID,
 		GuestType: req.GuestType,
@@ -147,10 +198,10 @@ func (s *BackupService) BackupGuest(ctx context.Context, req *ProxmoxBackupReque
 	dbResult, err := s.db.Exec(`
 		INSERT INTO proxmox_backups (
 			node, vmid, guest_type, guest_name, tape_id, backup_mode, 
-			compress, status, start_time, notes
-		) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+			compress, status, start_time, notes, cluster_id
+		) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
 	`, req.Node, req.VMID, req.GuestType, req.GuestName, req.TapeID,
-		req.BackupMode, req.Compress, "running", startTime, req.Notes)
+		req.BackupMode, req.Compress, "running", startTime, req.Notes, s.clusterID)
 	if err != nil {
 		result.Status = "failed"
 		result.Error = fmt.Sprintf("failed to create backup record: %v", err)
@@ -179,6 +230,13 @@ func (s *BackupService) BackupGuest(ctx context.Context, req *ProxmoxBackupReque
 		}
 	}
 
+	if staged != nil && staged.err != nil {
+		result.Status = "failed"
+		result.Error = staged.err.Error()
+		s.updateBackupStatus(backupID, "failed", result.Error, 0)
+		return result, staged.err
+	}
+
 	// Ensure temp directory exists
 	if err := os.MkdirAll(s.tmpDir, 0755); err != nil {
 		result.Status = "failed"
@@ -186,6 +244,12 @@ func (s *BackupService) BackupGuest(ctx context.Context, req *ProxmoxBackupReque
 		s.updateBackupStatus(backupID, "failed", result.Error, 0)
 		return result, err
 	}
+	if err := s.scratch.CheckSpace(s.tmpDir, 0); err != nil {
+		result.Status = "failed"
+		result.Error = err.Error()
+		s.updateBackupStatus(backupID, "failed", result.Error, 0)
+		return result, err
+	}
 
 	// Start vzdump backup
 	vzdumpOptions := map[string]string{
@@ -232,7 +296,7 @@ func (s *BackupService) BackupGuest(ctx context.Context, req *ProxmoxBackupReque
 	}
 
 	// Execute vzdump and stream to tape
-	totalBytes, err := s.executeVzdumpToTape(ctx, req, devicePath)
+	totalBytes, err := s.executeVzdumpToTape(ctx, req, devicePath, staged)
 	if err != nil {
 		result.Status = "failed"
 		result.Error = err.Error()
@@ -261,7 +325,7 @@ func (s *BackupService) BackupGuest(ctx context.Context, req *ProxmoxBackupReque
 	// Update tape usage
 	s.db.Exec(`
 		UPDATE tapes SET 
-			used_bytes = used_bytes + ?, 
+			used_bytes = used_bytes + ?, physical_remaining_bytes = NULL, 
 			write_count = write_count + 1,
 			last_written_at = CURRENT_TIMESTAMP,
 			status = CASE WHEN status = 'blank' THEN 'active' ELSE status END
@@ -278,9 +342,9 @@ func (s *BackupService) BackupGuest(ctx context.Context, req *ProxmoxBackupReque
 	return result, nil
 }
 
-// executeVzdumpToTape runs vzdump and streams output to tape
-func (s *BackupService) executeVzdumpToTape(ctx context.Context, req *ProxmoxBackupRequest, devicePath string) (int64, error) {
-	// Build vzdump command
+// vzdumpArgs builds the vzdump arguments that write a guest's backup to
+// stdout
+func vzdumpArgs(req *ProxmoxBackupRequest) []string {
 	// vzdump outputs to stdout when using --stdout
 	args := []string{
 		fmt.Sprintf("%d", req.VMID),
@@ -290,36 +354,80 @@ func (s *BackupService) executeVzdumpToTape(ctx context.Context, req *ProxmoxBac
 	if req.Compress != "" {
 		args = append(args, "--compress", req.Compress)
 	}
+	if req.BWLimit > 0 {
+		args = append(args, "--bwlimit", strconv.Itoa(req.BWLimit))
+	}
+	if req.IONice != nil {
+		args = append(args, "--ionice", strconv.Itoa(*req.IONice))
+	}
 
 	// For VM snapshots, we may need additional options
 	if req.GuestType == GuestTypeVM && req.BackupMode == BackupModeSnapshot {
 		// Use QEMU guest agent if available for consistent snapshots
 		args = append(args, "--quiet")
 	}
+	return args
+}
 
-	s.logger.Info("Executing vzdump", map[string]interface{}{
-		"vmid": req.VMID,
-		"args": strings.Join(args, " "),
-	})
-
-	// Create vzdump command
-	vzdumpCmd := exec.CommandContext(ctx, "vzdump", args...)
-	vzdumpStdout, err := vzdumpCmd.StdoutPipe()
-	if err != nil {
-		return 0, fmt.Errorf("failed to create vzdump stdout pipe: %w", err)
+// executeVzdumpToTape runs vzdump, or reads a staged dump, and streams the
+// output to tape
+func (s *BackupService) executeVzdumpToTape(ctx context.Context, req *ProxmoxBackupRequest, devicePath string, staged *stagedDump) (int64, error) {
+	var vzdumpCmd *exec.Cmd
+	var source io.Reader
+	if staged != nil {
+		f, err := os.Open(staged.path)
+		if err != nil {
+			return 0, fmt.Errorf("failed to open staged dump: %w", err)
+		}
+		defer f.Close()
+		source = f
+	} else {
+		args := vzdumpArgs(req)
+		s.logger.Info("Executing vzdump", map[string]interface{}{
+			"vmid": req.VMID,
+			"args": strings.Join(args, " "),
+		})
+
+		// Create vzdump command
+		vzdumpCmd = exec.CommandContext(ctx, "vzdump", args...)
+		vzdumpStdout, err := vzdumpCmd.StdoutPipe()
+		if err != nil {
+			return 0, fmt.Errorf("failed to create vzdump stdout pipe: %w", err)
+		}
+		source = vzdumpStdout
 	}
 
 	// Create tar command to write to tape
 	// We wrap the vzdump output in a tar archive for consistency with other backups
+	archive, tapeWriter, err := openTapeArchiveWriter(ctx, devicePath)
+	if err != nil {
+		return 0, err
+	}
 	tarArgs := []string{
 		"-c",
 		"-b", fmt.Sprintf("%d", s.blockSize/512),
-		"-f", devicePath,
+		"-f", archive,
 		"--label", fmt.Sprintf("proxmox-%s-%d-%s", req.GuestType, req.VMID, time.Now().Format("20060102-150405")),
 		"-",
 	}
 	tarCmd := exec.CommandContext(ctx, "tar", tarArgs...)
-	tarCmd.Stdin = vzdumpStdout
+	tarCmd.Stdin = source
+	if tapeWriter != nil {
+		defer tapeWriter.Close()
+		tarCmd.Stdout = tapeWriter
+	}
+
+	if staged != nil {
+		if err := tarCmd.Run(); err != nil {
+			return 0, fmt.Errorf("tar to tape failed: %w", err)
+		}
+		if tapeWriter != nil {
+			if err := tapeWriter.Close(); err != nil {
+				return 0, fmt.Errorf("tar to tape failed: %w", err)
+			}
+		}
+		return staged.size, nil
+	}
 
 	// Start both commands
 	if err := vzdumpCmd.Start(); err != nil {
@@ -343,6 +451,11 @@ func (s *BackupService) executeVzdumpToTape(ctx context.Context, req *ProxmoxBac
 	if tarErr != nil {
 		return 0, fmt.Errorf("tar to tape failed: %w", tarErr)
 	}
+	if tapeWriter != nil {
+		if err := tapeWriter.Close(); err != nil {
+			return 0, fmt.Errorf("tar to tape failed: %w", err)
+		}
+	}
 
 	// Get approximate bytes written (vzdump doesn't report exact size)
 	// We'll estimate based on file info or process stats
@@ -392,25 +505,53 @@ func (s *BackupService) writeMetadataToTape(ctx context.Context, devicePath stri
 	tmpFile.Close()
 
 	// Write metadata to tape using tar
+	archive, tapeWriter, err := openTapeArchiveWriter(ctx, devicePath)
+	if err != nil {
+		return err
+	}
 	tarArgs := []string{
 		"-c",
 		"-b", fmt.Sprintf("%d", s.blockSize/512),
-		"-f", devicePath,
+		"-f", archive,
 		"--label", "proxmox-metadata",
 		"-C", filepath.Dir(tmpFile.Name()),
 		filepath.Base(tmpFile.Name()),
 	}
 
 	cmd := exec.CommandContext(ctx, "tar", tarArgs...)
-	output, err := cmd.CombinedOutput()
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	if tapeWriter != nil {
+		cmd.Stdout = tapeWriter
+	}
+	err = cmd.Run()
+	if tapeWriter != nil {
+		if closeErr := tapeWriter.Close(); err == nil && closeErr != nil {
+			return fmt.Errorf("failed to write metadata to tape: %w", closeErr)
+		}
+	}
 	if err != nil {
-		return fmt.Errorf("failed to write metadata to tape: %s", string(output))
+		return fmt.Errorf("failed to write metadata to tape: %s", stderr.String())
 	}
 
 	// Write a file mark to separate metadata from data
 	return s.tapeService.WriteFileMark(ctx)
 }
 
+// openTapeArchiveWriter returns the tar -f argument for devicePath. Physical
+// drives are opened by tar directly; virtual storage backends are written
+// through the returned writer attached to tar's stdout.
+func openTapeArchiveWriter(ctx context.Context, devicePath string) (string, io.WriteCloser, error) {
+	if tape.IsPhysicalDevice(devicePath) {
+		return devicePath, nil, nil
+	}
+	w, err := tape.BackendFor(devicePath).OpenWriter(ctx)
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to open %s: %w", devicePath, err)
+	}
+	return "-", w, nil
+}
+
 // updateBackupStatus updates the status of a backup in the database
 func (s *BackupService) updateBackupStatus(backupID int64, status, errorMsg string, totalBytes int64) {
 	if status == "completed" {
@@ -430,12 +571,26 @@ func (s *BackupService) updateBackupStatus(backupID int64, status, errorMsg stri
 
 // BackupAllGuests backs up all VMs and LXCs on a node or cluster
 func (s *BackupService) BackupAllGuests(ctx context.Context, node string, tapeID int64, mode BackupMode, compress string) ([]*ProxmoxBackupResult, error) {
+	summary, err := s.BackupGuests(ctx, BackupRunOptions{Node: node, TapeID: tapeID, Mode: mode, Compress: compress})
+	if err != nil {
+		return nil, err
+	}
+	return summary.Results, nil
+}
+
+// BackupGuests backs up the VMs and LXCs selected by opts. Guests on nodes
+// outside opts.DumpNodes are reported as skipped. Guests tagged with
+// opts.ExcludeTag, and the disks each backup leaves out, are listed in the
+// summary's exclusions.
+func (s *BackupService) BackupGuests(ctx context.Context, opts BackupRunOptions) (*BackupRunSummary, error) {
+	summary := &BackupRunSummary{Excluded: []Exclusion{}}
 	var results []*ProxmoxBackupResult
+	var reqs []*ProxmoxBackupRequest
 
 	// Get nodes to backup
 	var nodes []string
-	if node != "" {
-		nodes = []string{node}
+	if opts.Node != "" {
+		nodes = []string{opts.Node}
 	} else {
 		// Get all nodes in cluster
 		nodeList, err := s.client.GetNodes(ctx)
@@ -449,8 +604,37 @@ func (s *BackupService) BackupAllGuests(ctx context.Context, node string, tapeID
 		}
 	}
 
-	// Backup each node
+	excludedByTag := func(nodeName string, vmid int, guestType GuestType, name, tags string) bool {
+		if !hasTag(tags, opts.ExcludeTag) {
+			return false
+		}
+		summary.Excluded = append(summary.Excluded, Exclusion{
+			Node:      nodeName,
+			VMID:      vmid,
+			GuestType: guestType,
+			GuestName: name,
+			Reason:    "tagged " + opts.ExcludeTag,
+		})
+		return true
+	}
+	guestRequest := func(nodeName string, vmid int, guestType GuestType, name string) *ProxmoxBackupRequest {
+		return &ProxmoxBackupRequest{
+			Node:       nodeName,
+			VMID:       vmid,
+			GuestType:  guestType,
+			GuestName:  name,
+			BackupMode: opts.Mode,
+			Compress:   opts.Compress,
+			TapeID:     opts.TapeID,
+			BWLimit:    opts.BWLimit,
+			IONice:     opts.IONice,
+		}
+	}
+
+	// Collect the guests of each node
 	for _, nodeName := range nodes {
+		var nodeReqs []*ProxmoxBackupRequest
+
 		// Backup VMs
 		vms, err := s.client.GetNodeVMs(ctx, nodeName)
 		if err != nil {
@@ -460,31 +644,14 @@ func (s *BackupService) BackupAllGuests(ctx context.Context, node string, tapeID
 			})
 			continue
 		}
-
 		for _, vm := range vms {
 			if vm.Template == 1 {
 				continue // Skip templates
 			}
-
-			req := &ProxmoxBackupRequest{
-				Node:       nodeName,
-				VMID:       vm.VMID,
-				GuestType:  GuestTypeVM,
-				GuestName:  vm.Name,
-				BackupMode: mode,
-				Compress:   compress,
-				TapeID:     tapeID,
-			}
-
-			result, err := s.BackupGuest(ctx, req)
-			if err != nil {
-				s.logger.Error("Failed to backup VM", map[string]interface{}{
-					"vmid":  vm.VMID,
-					"name":  vm.Name,
-					"error": err.Error(),
-				})
+			if excludedByTag(nodeName, vm.VMID, GuestTypeVM, vm.Name, vm.Tags) {
+				continue
 			}
-			results = append(results, result)
+			nodeReqs = append(nodeReqs, guestRequest(nodeName, vm.VMID, GuestTypeVM, vm.Name))
 		}
 
 		// Backup LXCs
@@ -496,48 +663,97 @@ func (s *BackupService) BackupAllGuests(ctx context.Context, node string, tapeID
 			})
 			continue
 		}
-
 		for _, lxc := range lxcs {
 			if lxc.Template == 1 {
 				continue // Skip templates
 			}
+			if excludedByTag(nodeName, lxc.VMID, GuestTypeLXC, lxc.Name, lxc.Tags) {
+				continue
+			}
+			nodeReqs = append(nodeReqs, guestRequest(nodeName, lxc.VMID, GuestTypeLXC, lxc.Name))
+		}
 
-			req := &ProxmoxBackupRequest{
-				Node:       nodeName,
-				VMID:       lxc.VMID,
-				GuestType:  GuestTypeLXC,
-				GuestName:  lxc.Name,
-				BackupMode: mode,
-				Compress:   compress,
-				TapeID:     tapeID,
+		if len(opts.DumpNodes) > 0 && !containsNode(opts.DumpNodes, nodeName) {
+			for _, req := range nodeReqs {
+				results = append(results, &ProxmoxBackupResult{
+					ClusterID: s.clusterID,
+					Node:      req.Node,
+					VMID:      req.VMID,
+					GuestType: req.GuestType,
+					GuestName: req.GuestName,
+					TapeID:    req.TapeID,
+					Status:    "skipped",
+					Error:     fmt.Sprintf("node %s is not one of the job's dump nodes", nodeName),
+				})
 			}
+			continue
+		}
+		reqs = append(reqs, nodeReqs...)
+	}
+
+	for _, req := range reqs {
+		if e := s.diskExclusion(ctx, req); e != nil {
+			summary.Excluded = append(summary.Excluded, *e)
+		}
+	}
+	if len(summary.Excluded) > 0 {
+		s.logger.Info("Proxmox backup run excludes guests or disks", map[string]interface{}{
+			"excluded": len(summary.Excluded),
+		})
+	}
 
+	if opts.Parallelism > 1 {
+		results = append(results, s.backupStaged(ctx, reqs, opts.Parallelism)...)
+	} else {
+		for _, req := range reqs {
 			result, err := s.BackupGuest(ctx, req)
 			if err != nil {
-				s.logger.Error("Failed to backup LXC", map[string]interface{}{
-					"vmid":  lxc.VMID,
-					"name":  lxc.Name,
-					"error": err.Error(),
-				})
+				s.logBackupFailure(req, err)
 			}
 			results = append(results, result)
 		}
 	}
+	summary.Results = results
+	return summary, nil
+}
+
+// logBackupFailure logs a guest that could not be backed up during a
+// multi-guest run
+func (s *BackupService) logBackupFailure(req *ProxmoxBackupRequest, err error) {
+	msg := "Failed to backup VM"
+	if req.GuestType == GuestTypeLXC {
+		msg = "Failed to backup LXC"
+	}
+	s.logger.Error(msg, map[string]interface{}{
+		"vmid":  req.VMID,
+		"name":  req.GuestName,
+		"error": err.Error(),
+	})
+}
 
-	return results, nil
+func containsNode(nodes []string, node string) bool {
+	for _, n := range nodes {
+		if n == node {
+			return true
+		}
+	}
+	return false
 }
 
-// ListBackups returns all Proxmox backups from the database
+// ListBackups returns the Proxmox backups of the service's cluster from the
+// database
 func (s *BackupService) ListBackups(ctx context.Context, limit int) ([]ProxmoxBackupResult, error) {
 	rows, err := s.db.Query(`
-		SELECT pb.id, pb.node, pb.vmid, pb.guest_type, pb.guest_name, 
+		SELECT pb.id, pb.cluster_id, pb.node, pb.vmid, pb.guest_type, pb.guest_name, 
 			   pb.tape_id, t.barcode, pb.start_time, pb.end_time, 
-			   pb.total_bytes, pb.status, pb.config_data IS NOT NULL
+			   pb.total_bytes, pb.status, pb.config_data IS NOT NULL,
+			   COALESCE(pb.verify_status, ''), pb.verified_at, COALESCE(pb.verify_error, '')
 		FROM proxmox_backups pb
 		JOIN tapes t ON pb.tape_id = t.id
+		WHERE pb.cluster_id IS ?
 		ORDER BY pb.start_time DESC
 		LIMIT ?
-	`, limit)
+	`, s.clusterID, limit)
 	if err != nil {
 		return nil, err
 	}
@@ -547,9 +763,9 @@ func (s *BackupService) ListBackups(ctx context.Context, limit int) ([]ProxmoxBa
 	for rows.Next() {
 		var b ProxmoxBackupResult
 		var endTime *time.Time
-		if err := rows.Scan(&b.BackupID, &b.Node, &b.VMID, &b.GuestType, &b.GuestName,
+		if err := rows.Scan(&b.BackupID, &b.ClusterID, &b.Node, &b.VMID, &b.GuestType, &b.GuestName,
 			&b.TapeID, &b.TapeBarcode, &b.StartTime, &endTime, &b.TotalBytes,
-			&b.Status, &b.ConfigSaved); err != nil {
+			&b.Status, &b.ConfigSaved, &b.VerifyStatus, &b.VerifiedAt, &b.VerifyError); err != nil {
 			continue
 		}
 		if endTime != nil {
@@ -566,15 +782,16 @@ func (s *BackupService) GetBackup(ctx context.Context, backupID int64) (*Proxmox
 	var b ProxmoxBackupResult
 	var endTime *time.Time
 	err := s.db.QueryRow(`
-		SELECT pb.id, pb.node, pb.vmid, pb.guest_type, pb.guest_name, 
+		SELECT pb.id, pb.cluster_id, pb.node, pb.vmid, pb.guest_type, pb.guest_name, 
 			   pb.tape_id, t.barcode, pb.start_time, pb.end_time, 
-			   pb.total_bytes, pb.status, pb.config_data IS NOT NULL, pb.error_message
+			   pb.total_bytes, pb.status, pb.config_data IS NOT NULL, COALESCE(pb.error_message, ''),
+			   COALESCE(pb.verify_status, ''), pb.verified_at, COALESCE(pb.verify_error, '')
 		FROM proxmox_backups pb
 		JOIN tapes t ON pb.tape_id = t.id
 		WHERE pb.id = ?
-	`, backupID).Scan(&b.BackupID, &b.Node, &b.VMID, &b.GuestType, &b.GuestName,
+	`, backupID).Scan(&b.BackupID, &b.ClusterID, &b.Node, &b.VMID, &b.GuestType, &b.GuestName,
 		&b.TapeID, &b.TapeBarcode, &b.StartTime, &endTime, &b.TotalBytes,
-		&b.Status, &b.ConfigSaved, &b.Error)
+		&b.Status, &b.ConfigSaved, &b.Error, &b.VerifyStatus, &b.VerifiedAt, &b.VerifyError)
 	if err != nil {
 		return nil, err
 	}
@@ -587,16 +804,7 @@ func (s *BackupService) GetBackup(ctx context.Context, backupID int64) (*Proxmox
 // StreamBackupToWriter streams a Proxmox backup directly to an io.Writer (for tape)
 // This is an alternative method that uses vzdump's stdout mode
 func (s *BackupService) StreamBackupToWriter(ctx context.Context, req *ProxmoxBackupRequest, w io.Writer) error {
-	args := []string{
-		fmt.Sprintf("%d", req.VMID),
-		"--mode", string(req.BackupMode),
-		"--stdout",
-	}
-	if req.Compress != "" {
-		args = append(args, "--compress", req.Compress)
-	}
-
-	cmd := exec.CommandContext(ctx, "vzdump", args...)
+	cmd := exec.CommandContext(ctx, "vzdump", vzdumpArgs(req)...)
 	cmd.Stdout = w
 
 	var stderr strings.Builder
@@ -0,0 +1,70 @@
+package proxmox
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestVzdumpArgs(t *testing.T) {
+	ionice := 7
+	req := &ProxmoxBackupRequest{
+		VMID:       101,
+		GuestType:  GuestTypeLXC,
+		BackupMode: BackupModeSnapshot,
+		Compress:   "zstd",
+		BWLimit:    51200,
+		IONice:     &ionice,
+	}
+	got := strings.Join(vzdumpArgs(req), " ")
+	want := "101 --mode snapshot --stdout --compress zstd --bwlimit 51200 --ionice 7"
+	if got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+
+	req = &ProxmoxBackupRequest{VMID: 100, GuestType: GuestTypeVM, BackupMode: BackupModeStop}
+	if got := strings.Join(vzdumpArgs(req), " "); got != "100 --mode stop --stdout" {
+		t.Errorf("expected no limits by default, got %q", got)
+	}
+}
+
+func TestHasTag(t *testing.T) {
+	tests := []struct {
+		tags, tag string
+		want      bool
+	}{
+		{"prod;no-backup", "no-backup", true},
+		{"prod,No-Backup", "no-backup", true},
+		{"prod no-backup", "no-backup", true},
+		{"no-backup-soon", "no-backup", false},
+		{"no-backup", "", false},
+		{"", "no-backup", false},
+	}
+	for _, tt := range tests {
+		if got := hasTag(tt.tags, tt.tag); got != tt.want {
+			t.Errorf("hasTag(%q, %q) = %v, want %v", tt.tags, tt.tag, got, tt.want)
+		}
+	}
+}
+
+func TestExcludedDisks(t *testing.T) {
+	vm := map[string]string{
+		"scsi0":    "local-lvm:vm-100-disk-0,size=32G",
+		"scsi1":    "local-lvm:vm-100-disk-1,backup=0,size=500G",
+		"virtio2":  "local-lvm:vm-100-disk-2,backup=no",
+		"ide2":     "none,media=cdrom,backup=0",
+		"scsihw":   "virtio-scsi-pci",
+		"efidisk0": "local-lvm:vm-100-disk-3,backup=1",
+	}
+	if got := strings.Join(excludedVMDisks(vm), ","); got != "scsi1,virtio2" {
+		t.Errorf("VM disks: got %q, want %q", got, "scsi1,virtio2")
+	}
+
+	lxc := map[string]string{
+		"mp0": "local-lvm:subvol-200-disk-1,mp=/data,backup=1",
+		"mp1": "local-lvm:subvol-200-disk-2,mp=/cache",
+		"mp2": "/mnt/media,mp=/media,backup=1",
+	}
+	if got := strings.Join(excludedMountPoints(lxc), ","); got != "mp1,mp2" {
+		t.Errorf("mount points: got %q, want %q", got, "mp1,mp2")
+	}
+}
@@ -0,0 +1,124 @@
+package proxmox
+
+import (
+	"context"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// DefaultExcludeTag is the guest tag that keeps a guest out of multi-guest
+// backup runs unless another tag is configured
+const DefaultExcludeTag = "no-backup"
+
+// Exclusion is a guest, or some of a guest's disks, left out of a
+// multi-guest backup run
+type Exclusion struct {
+	Node      string    `json:"node"`
+	VMID      int       `json:"vmid"`
+	GuestType GuestType `json:"guest_type"`
+	GuestName string    `json:"guest_name"`
+	Disks     []string  `json:"disks,omitempty"` // Empty when the whole guest was left out
+	Reason    string    `json:"reason"`
+}
+
+// BackupRunSummary is the outcome of a multi-guest backup run
+type BackupRunSummary struct {
+	Results  []*ProxmoxBackupResult `json:"results"`
+	Excluded []Exclusion            `json:"excluded"`
+}
+
+// vmDiskKey matches the configuration keys of a VM's disks, but not options
+// such as scsihw that share their prefix
+var vmDiskKey = regexp.MustCompile(`^(scsi|virtio|ide|sata|efidisk|tpmstate)\d+$`)
+
+// hasTag reports whether a guest's PVE tag list contains tag. PVE separates
+// tags with semicolons; older versions also used commas and spaces.
+func hasTag(tags, tag string) bool {
+	if tag == "" {
+		return false
+	}
+	for _, t := range strings.FieldsFunc(tags, func(r rune) bool { return r == ';' || r == ',' || r == ' ' }) {
+		if strings.EqualFold(t, tag) {
+			return true
+		}
+	}
+	return false
+}
+
+// diskBackupFlag returns the value of the backup option of a PVE disk or
+// mount point specification, and whether it is set
+func diskBackupFlag(spec string) (enabled, set bool) {
+	for _, opt := range strings.Split(spec, ",") {
+		if v, ok := strings.CutPrefix(opt, "backup="); ok {
+			switch strings.ToLower(v) {
+			case "0", "no", "off", "false":
+				return false, true
+			}
+			return true, true
+		}
+	}
+	return false, false
+}
+
+// excludedVMDisks returns the disks of a VM that vzdump skips because they
+// are marked backup=0. CD-ROM drives are not disks.
+func excludedVMDisks(disks map[string]string) []string {
+	var excluded []string
+	for key, spec := range disks {
+		if !vmDiskKey.MatchString(key) || strings.Contains(spec, "media=cdrom") {
+			continue
+		}
+		if enabled, set := diskBackupFlag(spec); set && !enabled {
+			excluded = append(excluded, key)
+		}
+	}
+	sort.Strings(excluded)
+	return excluded
+}
+
+// excludedMountPoints returns the mount points of a container that vzdump
+// skips. Unlike VM disks, mount points are only included with backup=1, and
+// bind mounts never are.
+func excludedMountPoints(mountPoints map[string]string) []string {
+	var excluded []string
+	for key, spec := range mountPoints {
+		if enabled, _ := diskBackupFlag(spec); !enabled || strings.HasPrefix(spec, "/") {
+			excluded = append(excluded, key)
+		}
+	}
+	sort.Strings(excluded)
+	return excluded
+}
+
+// diskExclusion reports the disks of a guest that its backup leaves out, or
+// nil when it includes them all. Guests whose configuration cannot be read
+// are not reported; their backup records the error.
+func (s *BackupService) diskExclusion(ctx context.Context, req *ProxmoxBackupRequest) *Exclusion {
+	var disks []string
+	var reason string
+	if req.GuestType == GuestTypeVM {
+		cfg, err := s.client.GetVMConfig(ctx, req.Node, req.VMID)
+		if err != nil {
+			return nil
+		}
+		disks, reason = excludedVMDisks(cfg.Disks), "disks marked backup=0"
+	} else {
+		cfg, err := s.client.GetLXCConfig(ctx, req.Node, req.VMID)
+		if err != nil {
+			return nil
+		}
+		disks, reason = excludedMountPoints(cfg.MountPoints), "mount points without backup=1"
+	}
+	if len(disks) == 0 {
+		return nil
+	}
+	return &Exclusion{
+		Node:      req.Node,
+		VMID:      req.VMID,
+		GuestType: req.GuestType,
+		GuestName: req.GuestName,
+		Disks:     disks,
+		Reason:    reason,
+	}
+}
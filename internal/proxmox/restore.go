@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"os"
@@ -14,6 +15,7 @@ import (
 	"github.com/RoseOO/TapeBackarr/internal/cmdutil"
 	"github.com/RoseOO/TapeBackarr/internal/database"
 	"github.com/RoseOO/TapeBackarr/internal/logging"
+	"github.com/RoseOO/TapeBackarr/internal/scratch"
 	"github.com/RoseOO/TapeBackarr/internal/tape"
 )
 
@@ -33,6 +35,7 @@ type RestoreRequest struct {
 // RestoreResult represents the result of a restore operation
 type RestoreResult struct {
 	RestoreID     int64     `json:"restore_id"`
+	ClusterID     *int64    `json:"cluster_id,omitempty"`
 	BackupID      int64     `json:"backup_id"`
 	SourceNode    string    `json:"source_node"`
 	TargetNode    string    `json:"target_node"`
@@ -56,6 +59,8 @@ type RestoreService struct {
 	logger      *logging.Logger
 	blockSize   int
 	tmpDir      string
+	scratch     *scratch.Dir
+	clusterID   *int64 // nil for the configured endpoint
 }
 
 // NewRestoreService creates a new Proxmox restore service
@@ -75,10 +80,26 @@ func (s *RestoreService) SetTempDir(dir string) {
 	s.tmpDir = dir
 }
 
+// SetScratchDir stages restore data in a subdirectory of the shared scratch
+// directory and enforces its free-space reserve. Call SetTempDir afterwards
+// to override the location.
+func (s *RestoreService) SetScratchDir(d *scratch.Dir) {
+	s.scratch = d
+	s.tmpDir = d.Path("proxmox")
+}
+
+// SetClusterID scopes the service to a registered cluster: guests are
+// restored to it, restores are recorded with its ID, and only those are
+// listed
+func (s *RestoreService) SetClusterID(id int64) {
+	s.clusterID = &id
+}
+
 // RestoreGuest restores a Proxmox VM or LXC from tape
 func (s *RestoreService) RestoreGuest(ctx context.Context, req *RestoreRequest) (*RestoreResult, error) {
 	startTime := time.Now()
 	result := &RestoreResult{
+		ClusterID: s.clusterID,
 		BackupID:  req.BackupID,
 		StartTime: startTime,
 		Status:    "running",
@@ -133,74 +154,21 @@ func (s *RestoreService) RestoreGuest(ctx context.Context, req *RestoreRequest)
 		"guest_type":  backup.GuestType,
 	})
 
-	// Check if tape is loaded - use explicit drive if provided
-	var devicePath string
-	if req.DriveID != nil {
-		err = s.db.QueryRow(
-			"SELECT device_path FROM tape_drives WHERE id = ? AND enabled = 1",
-			*req.DriveID,
-		).Scan(&devicePath)
-		if err != nil {
-			result.Status = "failed"
-			result.Error = "drive not found or not enabled"
-			return result, fmt.Errorf("drive not found or not enabled: %w", err)
-		}
-	} else {
-		err = s.db.QueryRow(`
-			SELECT device_path FROM tape_drives WHERE current_tape_id = ?
-		`, backup.TapeID).Scan(&devicePath)
-		if err != nil {
-			result.Status = "failed"
-			result.Error = "required tape not loaded"
-			return result, fmt.Errorf("tape not loaded: %w", err)
-		}
-	}
-
-	// Create a drive-specific tape service for all tape operations
-	driveSvc := tape.NewServiceForDevice(devicePath, s.blockSize)
-
-	// Wait for tape to be physically ready
-	if err := driveSvc.WaitForTape(ctx, 30*time.Second); err != nil {
+	devicePath, driveSvc, err := s.openBackupTape(ctx, backup.TapeID, req.DriveID)
+	if err != nil {
 		result.Status = "failed"
-		result.Error = fmt.Sprintf("tape not ready: %v", err)
+		result.Error = err.Error()
 		return result, err
 	}
 
-	// Verify the correct tape is loaded by reading its label
-	var expectedLabel string
-	if err := s.db.QueryRow("SELECT label FROM tapes WHERE id = ?", backup.TapeID).Scan(&expectedLabel); err == nil && expectedLabel != "" {
-		s.logger.Info("Verifying tape label", map[string]interface{}{
-			"expected_label": expectedLabel,
-			"device_path":    devicePath,
-		})
-		label, err := driveSvc.ReadTapeLabel(ctx)
-		if err != nil {
-			result.Status = "failed"
-			result.Error = fmt.Sprintf("failed to read tape label: %v", err)
-			return result, err
-		}
-		if label == nil || label.Label != expectedLabel {
-			actualLabel := ""
-			if label != nil {
-				actualLabel = label.Label
-			}
-			result.Status = "failed"
-			result.Error = fmt.Sprintf("wrong tape loaded: expected %s, got %s", expectedLabel, actualLabel)
-			return result, fmt.Errorf("wrong tape loaded: expected %s, got %s", expectedLabel, actualLabel)
-		}
-		s.logger.Info("Correct tape verified", map[string]interface{}{
-			"label": expectedLabel,
-		})
-	}
-
 	// Create restore record
 	dbResult, err := s.db.Exec(`
 		INSERT INTO proxmox_restores (
 			backup_id, source_node, target_node, source_vmid, target_vmid,
-			guest_type, guest_name, status, start_time
-		) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
+			guest_type, guest_name, status, start_time, cluster_id
+		) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
 	`, req.BackupID, backup.Node, req.TargetNode, backup.VMID, req.TargetVMID,
-		backup.GuestType, backup.GuestName, "running", startTime)
+		backup.GuestType, backup.GuestName, "running", startTime, s.clusterID)
 	if err != nil {
 		result.Status = "failed"
 		result.Error = fmt.Sprintf("failed to create restore record: %v", err)
@@ -216,6 +184,12 @@ func (s *RestoreService) RestoreGuest(ctx context.Context, req *RestoreRequest)
 		s.updateRestoreStatus(restoreID, "failed", result.Error)
 		return result, err
 	}
+	if err := s.scratch.CheckSpace(s.tmpDir, backup.TotalBytes); err != nil {
+		result.Status = "failed"
+		result.Error = err.Error()
+		s.updateRestoreStatus(restoreID, "failed", result.Error)
+		return result, err
+	}
 
 	// Position tape past the label to the backup data
 	if err := driveSvc.SeekToFileNumber(ctx, 1); err != nil {
@@ -294,20 +268,86 @@ func (s *RestoreService) RestoreGuest(ctx context.Context, req *RestoreRequest)
 	return result, nil
 }
 
+// openBackupTape finds the drive holding a backup's tape, or the given
+// drive, waits for it to be ready and checks that the expected tape is
+// loaded
+func (s *RestoreService) openBackupTape(ctx context.Context, tapeID int64, driveID *int64) (string, *tape.Service, error) {
+	var devicePath string
+	if driveID != nil {
+		if err := s.db.QueryRow(
+			"SELECT device_path FROM tape_drives WHERE id = ? AND enabled = 1",
+			*driveID,
+		).Scan(&devicePath); err != nil {
+			return "", nil, errors.New("drive not found or not enabled")
+		}
+	} else {
+		if err := s.db.QueryRow(`
+			SELECT device_path FROM tape_drives WHERE current_tape_id = ?
+		`, tapeID).Scan(&devicePath); err != nil {
+			return "", nil, errors.New("required tape not loaded")
+		}
+	}
+
+	// Create a drive-specific tape service for all tape operations
+	driveSvc := tape.NewServiceForDevice(devicePath, s.blockSize)
+
+	// Wait for tape to be physically ready
+	if err := driveSvc.WaitForTape(ctx, 30*time.Second); err != nil {
+		return "", nil, fmt.Errorf("tape not ready: %w", err)
+	}
+
+	// Verify the correct tape is loaded by reading its label
+	var expectedLabel string
+	if err := s.db.QueryRow("SELECT label FROM tapes WHERE id = ?", tapeID).Scan(&expectedLabel); err == nil && expectedLabel != "" {
+		s.logger.Info("Verifying tape label", map[string]interface{}{
+			"expected_label": expectedLabel,
+			"device_path":    devicePath,
+		})
+		label, err := driveSvc.ReadTapeLabel(ctx)
+		if err != nil {
+			return "", nil, fmt.Errorf("failed to read tape label: %w", err)
+		}
+		if label == nil || label.Label != expectedLabel {
+			actualLabel := ""
+			if label != nil {
+				actualLabel = label.Label
+			}
+			return "", nil, fmt.Errorf("wrong tape loaded: expected %s, got %s", expectedLabel, actualLabel)
+		}
+		s.logger.Info("Correct tape verified", map[string]interface{}{
+			"label": expectedLabel,
+		})
+	}
+	return devicePath, driveSvc, nil
+}
+
 // extractFromTape extracts the backup archive from tape
 func (s *RestoreService) extractFromTape(ctx context.Context, devicePath, destPath string) error {
 	// First, skip the metadata file mark and extract metadata
 	// Then extract the actual backup data
 
 	// Extract to destination
+	archive := devicePath
+	var tapeReader io.ReadCloser
+	if !tape.IsPhysicalDevice(devicePath) {
+		r, err := tape.BackendFor(devicePath).OpenReader(ctx)
+		if err != nil {
+			return fmt.Errorf("failed to open %s: %w", devicePath, err)
+		}
+		defer r.Close()
+		archive, tapeReader = "-", r
+	}
 	tarArgs := []string{
 		"-x",
 		"-b", fmt.Sprintf("%d", s.blockSize/512),
-		"-f", devicePath,
+		"-f", archive,
 		"-C", destPath,
 	}
 
 	cmd := exec.CommandContext(ctx, "tar", tarArgs...)
+	if tapeReader != nil {
+		cmd.Stdin = tapeReader
+	}
 	var tarStderr bytes.Buffer
 	cmd.Stderr = &tarStderr
 	if err := cmd.Run(); err != nil {
@@ -462,15 +502,17 @@ type TapeRequirement struct {
 	Order      int    `json:"order"`
 }
 
-// ListRestores returns all Proxmox restores from the database
+// ListRestores returns the Proxmox restores to the service's cluster from
+// the database
 func (s *RestoreService) ListRestores(ctx context.Context, limit int) ([]RestoreResult, error) {
 	rows, err := s.db.Query(`
-		SELECT id, backup_id, source_node, target_node, source_vmid, target_vmid,
+		SELECT id, cluster_id, backup_id, source_node, target_node, source_vmid, target_vmid,
 			   guest_type, guest_name, start_time, end_time, status, error_message
 		FROM proxmox_restores
+		WHERE cluster_id IS ?
 		ORDER BY start_time DESC
 		LIMIT ?
-	`, limit)
+	`, s.clusterID, limit)
 	if err != nil {
 		return nil, err
 	}
@@ -481,7 +523,7 @@ func (s *RestoreService) ListRestores(ctx context.Context, limit int) ([]Restore
 		var r RestoreResult
 		var endTime *time.Time
 		var errorMsg *string
-		if err := rows.Scan(&r.RestoreID, &r.BackupID, &r.SourceNode, &r.TargetNode,
+		if err := rows.Scan(&r.RestoreID, &r.ClusterID, &r.BackupID, &r.SourceNode, &r.TargetNode,
 			&r.SourceVMID, &r.TargetVMID, &r.GuestType, &r.GuestName,
 			&r.StartTime, &endTime, &r.Status, &errorMsg); err != nil {
 			continue
@@ -0,0 +1,117 @@
+package proxmox
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+
+	"github.com/RoseOO/TapeBackarr/internal/cmdutil"
+)
+
+// stagedDump is a guest's vzdump output in the staging area, waiting to be
+// written to tape
+type stagedDump struct {
+	req  *ProxmoxBackupRequest
+	path string
+	size int64
+	err  error // the dump failed; path is empty
+}
+
+// backupStaged dumps up to parallelism guests at once into the staging area
+// and writes each finished dump to tape, one at a time, in the order they
+// complete. A worker holds on to its dump until the tape is free, so at most
+// parallelism dumps are staged at any time.
+func (s *BackupService) backupStaged(ctx context.Context, reqs []*ProxmoxBackupRequest, parallelism int) []*ProxmoxBackupResult {
+	pending := make(chan *ProxmoxBackupRequest)
+	staged := make(chan *stagedDump)
+
+	var wg sync.WaitGroup
+	for i := 0; i < parallelism; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for req := range pending {
+				staged <- s.stageDump(ctx, req)
+			}
+		}()
+	}
+	go func() {
+		defer close(pending)
+		for _, req := range reqs {
+			select {
+			case pending <- req:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	go func() {
+		wg.Wait()
+		close(staged)
+	}()
+
+	var results []*ProxmoxBackupResult
+	for d := range staged {
+		result, err := s.backupGuest(ctx, d.req, d)
+		if d.path != "" {
+			os.Remove(d.path)
+		}
+		if err != nil {
+			s.logBackupFailure(d.req, err)
+		}
+		results = append(results, result)
+	}
+	return results
+}
+
+// stageDump runs vzdump for a guest into a file in the staging area
+func (s *BackupService) stageDump(ctx context.Context, req *ProxmoxBackupRequest) *stagedDump {
+	d := &stagedDump{req: req}
+	if err := os.MkdirAll(s.tmpDir, 0755); err != nil {
+		d.err = fmt.Errorf("failed to create temp dir: %w", err)
+		return d
+	}
+	if err := s.scratch.CheckSpace(s.tmpDir, 0); err != nil {
+		d.err = err
+		return d
+	}
+	f, err := os.CreateTemp(s.tmpDir, fmt.Sprintf("vzdump-%s-%d-*", req.GuestType, req.VMID))
+	if err != nil {
+		d.err = fmt.Errorf("failed to create staging file: %w", err)
+		return d
+	}
+
+	args := vzdumpArgs(req)
+	s.logger.Info("Executing vzdump to staging area", map[string]interface{}{
+		"vmid": req.VMID,
+		"args": strings.Join(args, " "),
+		"file": f.Name(),
+	})
+	cmd := exec.CommandContext(ctx, "vzdump", args...)
+	cmd.Stdout = f
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	runErr := cmd.Run()
+	closeErr := f.Close()
+	if runErr == nil {
+		runErr = closeErr
+	}
+	if runErr != nil {
+		os.Remove(f.Name())
+		d.err = fmt.Errorf("vzdump failed (%s)", cmdutil.ErrorDetail(runErr, &stderr))
+		return d
+	}
+
+	info, err := os.Stat(f.Name())
+	if err != nil {
+		os.Remove(f.Name())
+		d.err = err
+		return d
+	}
+	d.path, d.size = f.Name(), info.Size()
+	return d
+}
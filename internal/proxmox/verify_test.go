@@ -0,0 +1,51 @@
+package proxmox
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+)
+
+func TestCheckArchive(t *testing.T) {
+	if _, err := exec.LookPath("tar"); err != nil {
+		t.Skip("tar not available")
+	}
+	dir := t.TempDir()
+	src := filepath.Join(dir, "rootfs")
+	if err := os.MkdirAll(filepath.Join(src, "etc"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(src, "etc", "hostname"), []byte("ct101\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	archive := filepath.Join(dir, "vzdump-lxc-101.tar.gz")
+	if out, err := exec.Command("tar", "-czf", archive, "-C", src, ".").CombinedOutput(); err != nil {
+		t.Fatalf("tar failed: %v: %s", err, out)
+	}
+
+	s := &RestoreService{}
+	ctx := context.Background()
+	if check, err := s.checkArchive(ctx, GuestTypeLXC, archive); err != nil || check != "tar -t" {
+		t.Fatalf("expected a valid container archive to pass tar -t, got %q: %v", check, err)
+	}
+
+	// A truncated archive fails the listing
+	data, err := os.ReadFile(archive)
+	if err != nil {
+		t.Fatal(err)
+	}
+	truncated := filepath.Join(dir, "truncated.tar.gz")
+	if err := os.WriteFile(truncated, data[:len(data)/2], 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.checkArchive(ctx, GuestTypeLXC, truncated); err == nil {
+		t.Error("expected a truncated archive to fail")
+	}
+
+	// A VM backup must hold a VMA archive
+	if _, err := s.checkArchive(ctx, GuestTypeVM, archive); err == nil {
+		t.Error("expected a tar archive to fail the VM check")
+	}
+}
@@ -0,0 +1,212 @@
+package restore
+
+import (
+	"bufio"
+	"context"
+	"database/sql"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"os/exec"
+	"time"
+
+	"github.com/RoseOO/TapeBackarr/internal/encryption"
+	"github.com/RoseOO/TapeBackarr/internal/models"
+	"github.com/RoseOO/TapeBackarr/internal/stages"
+	"github.com/RoseOO/TapeBackarr/internal/tape"
+)
+
+// setArchive is the tar stream of a backup set opened on tape, decrypted
+// and decompressed, for reading single files with archive/tar
+type setArchive struct {
+	tapeLabel string
+	stream    io.Reader
+	// pos is how far into the set's archive stream has been read
+	pos int64
+
+	driveSvc   *tape.Service
+	tapeFile   io.ReadCloser
+	buf        *bufio.Reader
+	startBlock int64
+	readSize   int
+	// seekable is set for sets written straight to tape in fixed-size
+	// blocks, where a stream offset maps to a tape block
+	seekable bool
+	cleanup  []func()
+}
+
+func (a *setArchive) Read(p []byte) (int, error) {
+	n, err := a.stream.Read(p)
+	a.pos += int64(n)
+	return n, err
+}
+
+// close stops reading and restores the drive's state
+func (a *setArchive) close() {
+	for i := len(a.cleanup) - 1; i >= 0; i-- {
+		a.cleanup[i]()
+	}
+}
+
+// seek positions the drive at offset in the set's archive stream, for
+// seekable archives only
+func (a *setArchive) seek(ctx context.Context, offset int64) error {
+	if !a.seekable {
+		return fmt.Errorf("the archive cannot be seeked")
+	}
+	if err := a.driveSvc.SeekToBlock(ctx, a.startBlock+offset/int64(a.readSize)); err != nil {
+		return err
+	}
+	a.buf.Reset(a.tapeFile)
+	a.pos = offset - offset%int64(a.readSize)
+	_, err := io.CopyN(io.Discard, a, offset%int64(a.readSize))
+	return err
+}
+
+// rewound resets a seekable archive after the drive was positioned back at
+// the start of the set
+func (a *setArchive) rewound() {
+	a.buf.Reset(a.tapeFile)
+	a.pos = 0
+}
+
+// openArchive checks the set's tape is in its drive, positions the drive at
+// the start of the set and opens its archive stream. keyInput is a key
+// entered by the user, used instead of the keystore's.
+func (s *Service) openArchive(ctx context.Context, setID int64, driveID *int64, keyInput string) (a *setArchive, err error) {
+	var tapeID, startBlock int64
+	var encrypted, hwEncrypted, compressed bool
+	var encryptionKeyID, hwEncryptionKeyID *int64
+	var compressionType string
+	var encFormat, encKDF, encSalt, encIV string
+	var encChunkSize int
+	var streamStages sql.NullString
+	var recordedBlockSize int
+	err = s.db.QueryRow(`
+		SELECT tape_id, COALESCE(start_block, 0), block_size, COALESCE(encrypted, 0), encryption_key_id,
+		       COALESCE(hw_encrypted, 0), hw_encryption_key_id,
+		       COALESCE(compressed, 0), COALESCE(compression_type, 'none'),
+		       encryption_format, encryption_kdf, encryption_salt, encryption_iv, encryption_chunk_size, stream_stages
+		FROM backup_sets WHERE id = ?
+	`, setID).Scan(&tapeID, &startBlock, &recordedBlockSize, &encrypted, &encryptionKeyID,
+		&hwEncrypted, &hwEncryptionKeyID, &compressed, &compressionType,
+		&encFormat, &encKDF, &encSalt, &encIV, &encChunkSize, &streamStages)
+	if err != nil {
+		return nil, fmt.Errorf("backup set not found: %w", err)
+	}
+	applied, err := stages.Parse(streamStages)
+	if err != nil {
+		return nil, err
+	}
+
+	var encryptionKey string
+	if encrypted && keyInput != "" {
+		if encryptionKey, err = s.checkExternalKey(keyInput, encryptionKeyID, tapeID); err != nil {
+			return nil, err
+		}
+	} else if encrypted && encryptionKeyID != nil {
+		s.db.QueryRow("SELECT key_data FROM encryption_keys WHERE id = ?", *encryptionKeyID).Scan(&encryptionKey)
+	}
+	if encrypted && encryptionKey == "" {
+		return nil, fmt.Errorf("backup set is marked as encrypted but no encryption key is available; supply encryption_key from the key sheet")
+	}
+
+	devicePath, err := s.driveForTape(ctx, &RestoreRequest{DriveID: driveID}, tapeID)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.checkDriveCanRead(devicePath, tapeID); err != nil {
+		return nil, err
+	}
+	driveSvc := tape.NewServiceForDevice(devicePath, s.blockSize)
+
+	a = &setArchive{driveSvc: driveSvc, startBlock: startBlock}
+	defer func() {
+		if err != nil {
+			a.close()
+		}
+	}()
+
+	if hwEncrypted && hwEncryptionKeyID != nil {
+		var hwKeyData string
+		if err := s.db.QueryRow("SELECT key_data FROM encryption_keys WHERE id = ?", *hwEncryptionKeyID).Scan(&hwKeyData); err != nil {
+			return nil, fmt.Errorf("hardware encryption key not found for hw-encrypted backup: %w", err)
+		}
+		hwKeyBytes, err := base64.StdEncoding.DecodeString(hwKeyData)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode hardware encryption key: %w", err)
+		}
+		if err := driveSvc.SetHardwareEncryption(ctx, hwKeyBytes); err != nil {
+			return nil, fmt.Errorf("failed to set hardware encryption for reading: %w", err)
+		}
+		a.cleanup = append(a.cleanup, func() {
+			clearCtx, clearCancel := context.WithTimeout(context.Background(), 30*time.Second)
+			defer clearCancel()
+			driveSvc.ClearHardwareEncryption(clearCtx)
+		})
+	}
+
+	var expectedLabel string
+	s.db.QueryRow("SELECT label FROM tapes WHERE id = ?", tapeID).Scan(&expectedLabel)
+	label, err := driveSvc.ReadTapeLabel(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read tape label: %w", err)
+	}
+	if label == nil || label.Label != expectedLabel {
+		return nil, fmt.Errorf("tape %s is not loaded in drive %s", expectedLabel, devicePath)
+	}
+	a.tapeLabel = expectedLabel
+	if err := s.positionAtSet(ctx, driveSvc, startBlock); err != nil {
+		return nil, err
+	}
+	if a.readSize, err = s.setReadBlockSize(ctx, driveSvc, recordedBlockSize, func(ctx context.Context) error {
+		return s.positionAtSet(ctx, driveSvc, startBlock)
+	}, func(msg string) {
+		s.logger.Info(msg, map[string]interface{}{"backup_set_id": setID})
+	}); err != nil {
+		return nil, err
+	}
+
+	// Cancelling stops the decompressor once reading is done
+	ctx, cancel := context.WithCancel(ctx)
+	a.cleanup = append(a.cleanup, cancel)
+	if a.tapeFile, err = driveSvc.OpenReader(ctx); err != nil {
+		return nil, fmt.Errorf("failed to open tape device: %w", err)
+	}
+	a.cleanup = append(a.cleanup, func() { a.tapeFile.Close() })
+
+	a.buf = bufio.NewReaderSize(a.tapeFile, a.readSize)
+	a.stream = a.buf
+	a.seekable = !encrypted && !compressed && len(applied) == 0 && startBlock > 0 && a.readSize > 0
+	if encrypted {
+		encMeta := models.ParseEncryptionMetadata(encFormat, encKDF, encSalt, encIV, encChunkSize)
+		if a.stream, err = encryption.NewBackupDecryptingReader(a.stream, encryptionKey, encMeta); err != nil {
+			return nil, fmt.Errorf("failed to start decryption: %w", err)
+		}
+	}
+	if compressed {
+		var decompCmd *exec.Cmd
+		if decompCmd, err = buildDecompressionCmd(ctx, models.CompressionType(compressionType)); err != nil {
+			return nil, fmt.Errorf("failed to build decompression command: %w", err)
+		}
+		decompStdin, err := decompCmd.StdinPipe()
+		if err != nil {
+			return nil, fmt.Errorf("failed to create decompression pipe: %w", err)
+		}
+		decompOut, err := decompCmd.StdoutPipe()
+		if err != nil {
+			return nil, fmt.Errorf("failed to create decompression pipe: %w", err)
+		}
+		if err := decompCmd.Start(); err != nil {
+			return nil, fmt.Errorf("failed to start decompression: %w", err)
+		}
+		a.cleanup = append(a.cleanup, func() { decompCmd.Wait() }, cancel)
+		feedStream(decompStdin, a.stream)
+		a.stream = decompOut
+	}
+
+	if a.stream, err = stages.Decode(ctx, a.stream, applied); err != nil {
+		return nil, err
+	}
+	return a, nil
+}
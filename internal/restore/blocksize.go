@@ -0,0 +1,48 @@
+package restore
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/RoseOO/TapeBackarr/internal/tape"
+)
+
+// setReadBlockSize sets the drive to a block size it can read the tape file
+// at the current position with: the size the set was recorded with, then the
+// configured size, then variable block mode. It returns the buffer size
+// readers of the file need and passes each step to logf for the restore log.
+// Virtual media have no block size and are read as configured.
+func (s *Service) setReadBlockSize(ctx context.Context, driveSvc *tape.Service, recorded int, reposition func(context.Context) error, logf func(string)) (int, error) {
+	if !driveSvc.IsPhysical() {
+		return s.blockSize, nil
+	}
+	detection, err := driveSvc.DetectReadBlockSize(ctx, []int{recorded, s.blockSize}, reposition)
+	if detection != nil {
+		for _, attempt := range detection.Attempts {
+			logf("Block size probe: " + attempt)
+		}
+	}
+	if errors.Is(err, tape.ErrBlockSizeUndetected) {
+		// Read as recorded anyway and let the extraction report the error
+		size := recorded
+		if size <= 0 {
+			size = s.blockSize
+		}
+		if err := driveSvc.SetBlockSize(ctx, size); err != nil {
+			return 0, fmt.Errorf("failed to set block size: %w", err)
+		}
+		logf(fmt.Sprintf("No block size could read the tape, reading with %s", tape.DescribeBlockSize(size)))
+		return size, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	logf(fmt.Sprintf("Reading with %s", tape.DescribeBlockSize(detection.BlockSize)))
+	return detection.ReadSize, nil
+}
+
+// tarBlockingFactor returns tar's -b value for reading records of size bytes
+func tarBlockingFactor(size int) string {
+	return fmt.Sprintf("%d", (size+511)/512)
+}
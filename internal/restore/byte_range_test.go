@@ -0,0 +1,84 @@
+package restore
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/RoseOO/TapeBackarr/internal/logging"
+	"github.com/RoseOO/TapeBackarr/internal/tape"
+)
+
+func TestRestoreByteRange(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+	setID := setupTestData(t, db)
+	logger, _ := logging.NewLogger("error", "text", "")
+	svc := NewService(db, nil, logger, 65536)
+	ctx := context.Background()
+
+	devicePath := "file://" + t.TempDir()
+	image := strings.Repeat("0123456789", 300)
+	writeTarToTape(t, tape.NewServiceForDevice(devicePath, 65536), "Test Tape",
+		map[string]string{"documents/notes.txt": "notes", "documents/report.pdf": image},
+		[]string{"documents/notes.txt", "documents/report.pdf"}, false)
+	db.Exec("UPDATE catalog_entries SET file_size = ?, checksum = NULL WHERE file_path = 'documents/report.pdf'", len(image))
+	db.Exec("INSERT INTO tape_drives (device_path, display_name, status, current_tape_id) VALUES (?, 'vtape', 'ready', 1)", devicePath)
+
+	dest := t.TempDir()
+	restored := filepath.Join(dest, "documents/report.pdf")
+	run := func(offset, length int64, overwrite bool) (*RestoreResult, error) {
+		return svc.Restore(ctx, &RestoreRequest{
+			BackupSetID: setID, FilePaths: []string{"documents/report.pdf"}, DestPath: dest, Overwrite: overwrite,
+			ByteRange: &ByteRange{Offset: offset, Length: length},
+		})
+	}
+
+	// A range in the middle is written at its offset
+	res, err := run(1000, 500, false)
+	if err != nil {
+		t.Fatalf("Restore: %v", err)
+	}
+	p := res.PartialFile
+	if p == nil || !p.Complete || p.BytesWritten != 500 || p.NextOffset != 1500 || p.Seeked || res.FilesRestored != 0 {
+		t.Fatalf("unexpected result %+v %+v", res, p)
+	}
+	data, _ := os.ReadFile(restored)
+	if len(data) != 1500 || string(data[1000:]) != image[1000:1500] || !bytes.Equal(data[:1000], make([]byte, 1000)) {
+		t.Fatalf("expected bytes 1000-1500 in place, got %d bytes", len(data))
+	}
+
+	// Resuming from next_offset finishes the file
+	res, err = run(p.NextOffset, 0, false)
+	if err != nil || res.PartialFile.NextOffset != int64(len(image)) || res.FilesRestored != 1 {
+		t.Fatalf("expected the resume to reach the end, got %+v (%v)", res, err)
+	}
+	data, _ = os.ReadFile(restored)
+	if string(data[1000:]) != image[1000:] {
+		t.Error("expected the rest of the file after resuming")
+	}
+
+	// Starting over needs overwrite
+	if _, err := run(0, 1000, false); err == nil {
+		t.Error("expected an existing file not to be replaced without overwrite")
+	}
+	if _, err := run(0, 1000, true); err != nil {
+		t.Fatalf("Restore with overwrite: %v", err)
+	}
+	if data, _ = os.ReadFile(restored); string(data) != image {
+		t.Error("expected the whole file after filling in the start")
+	}
+
+	if _, err := run(int64(len(image))+1, 0, true); err == nil {
+		t.Error("expected an offset past the end to be rejected")
+	}
+	if err := ValidateByteRange(&RestoreRequest{FilePaths: []string{"a", "b"}, ByteRange: &ByteRange{}}); err == nil {
+		t.Error("expected a byte range over two files to be rejected")
+	}
+	if err := ValidateByteRange(&RestoreRequest{FilePaths: []string{"a"}, ByteRange: &ByteRange{Offset: -1}}); err == nil {
+		t.Error("expected a negative offset to be rejected")
+	}
+}
@@ -0,0 +1,225 @@
+package restore
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// dedupRef is a catalog entry whose data was written with another backup set
+type dedupRef struct {
+	path     string // path in the set being restored
+	setID    int64  // set holding the data
+	dataPath string // path of the data in that set
+}
+
+// lookupDedupRefs returns the deduplicated entries of a backup set among
+// filePaths, or all of them when filePaths is empty.
+func (s *Service) lookupDedupRefs(backupSetID int64, filePaths []string) ([]dedupRef, error) {
+	rows, err := s.db.Query(`
+		SELECT file_path, ref_backup_set_id, COALESCE(ref_file_path, file_path)
+		FROM catalog_entries
+		WHERE backup_set_id = ? AND ref_backup_set_id IS NOT NULL
+		ORDER BY file_path
+	`, backupSetID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var wanted map[string]bool
+	if len(filePaths) > 0 {
+		wanted = make(map[string]bool, len(filePaths))
+		for _, p := range filePaths {
+			wanted[p] = true
+		}
+	}
+
+	var refs []dedupRef
+	for rows.Next() {
+		var r dedupRef
+		if err := rows.Scan(&r.path, &r.setID, &r.dataPath); err != nil {
+			return nil, err
+		}
+		if wanted == nil || wanted[r.path] {
+			refs = append(refs, r)
+		}
+	}
+	return refs, rows.Err()
+}
+
+// restoreWithRefs restores a backup set containing deduplicated files. Files
+// written with the set are extracted from its own tape first; each
+// referenced set is then extracted into a staging directory and its files
+// moved to the paths they have in the set being restored.
+func (s *Service) restoreWithRefs(ctx context.Context, req *RestoreRequest, destPath, destLabel string, allFilePaths []string, refs []dedupRef, rw *pathRewriter) (*RestoreResult, error) {
+	result := &RestoreResult{
+		StartTime:       time.Now(),
+		FoldersRestored: len(req.FolderPaths),
+	}
+
+	refPaths := make(map[string]bool, len(refs))
+	for _, r := range refs {
+		refPaths[r.path] = true
+	}
+	var dataPaths []string
+	for _, p := range allFilePaths {
+		if !refPaths[p] {
+			dataPaths = append(dataPaths, p)
+		}
+	}
+
+	// A whole-set restore extracts the full archive; references are simply
+	// not in it
+	if len(allFilePaths) == 0 || len(dataPaths) > 0 {
+		own := *req
+		own.FilePaths, own.FolderPaths, own.Verify, own.skipRefs = dataPaths, nil, false, true
+		sub, err := s.restoreToPath(ctx, &own, destPath, destLabel)
+		if sub != nil {
+			result.Errors = append(result.Errors, sub.Errors...)
+		}
+		if err != nil {
+			return result, err
+		}
+	}
+
+	bySet := make(map[int64][]dedupRef)
+	var setIDs []int64
+	for _, r := range refs {
+		if _, ok := bySet[r.setID]; !ok {
+			setIDs = append(setIDs, r.setID)
+		}
+		bySet[r.setID] = append(bySet[r.setID], r)
+	}
+	sort.Slice(setIDs, func(i, j int) bool { return setIDs[i] < setIDs[j] })
+
+	for _, setID := range setIDs {
+		s.logger.Info("Restoring deduplicated files from referenced backup set", map[string]interface{}{
+			"backup_set_id":     req.BackupSetID,
+			"ref_backup_set_id": setID,
+			"file_count":        len(bySet[setID]),
+		})
+		if err := s.restoreRefGroup(ctx, req, destPath, destLabel, setID, bySet[setID], rw); err != nil {
+			result.Errors = append(result.Errors, err.Error())
+			return result, err
+		}
+	}
+
+	result.FilesRestored, result.BytesRestored = countRestored(destPath, rw.applyAll(allFilePaths))
+
+	if req.Verify {
+		var verifyErrors []string
+		result.ChecksumsVerified, verifyErrors = s.verifyRestore(ctx, req.BackupSetID, destPath, allFilePaths, rw)
+		result.Errors = append(result.Errors, verifyErrors...)
+		result.Verified = len(verifyErrors) == 0
+	}
+
+	result.EndTime = time.Now()
+	return result, nil
+}
+
+// restoreRefGroup extracts the data of refs from backup set setID and places
+// each file at its path under destPath, as rewritten by rw.
+func (s *Service) restoreRefGroup(ctx context.Context, req *RestoreRequest, destPath, destLabel string, setID int64, refs []dedupRef, rw *pathRewriter) error {
+	if err := os.MkdirAll(destPath, 0755); err != nil {
+		return fmt.Errorf("failed to create destination directory: %w", err)
+	}
+	staging, err := os.MkdirTemp(destPath, ".tapebackarr-dedup-")
+	if err != nil {
+		return fmt.Errorf("failed to create staging directory: %w", err)
+	}
+	defer os.RemoveAll(staging)
+
+	// Several files may share one copy of the data
+	uses := make(map[string]int)
+	var dataPaths []string
+	for _, r := range refs {
+		if uses[r.dataPath] == 0 {
+			dataPaths = append(dataPaths, r.dataPath)
+		}
+		uses[r.dataPath]++
+	}
+
+	sub := *req
+	sub.BackupSetID = setID
+	sub.FilePaths, sub.FolderPaths, sub.PathRewrites = dataPaths, nil, nil
+	sub.Verify, sub.Overwrite, sub.skipRefs = false, true, true
+	if _, err := s.restoreToPath(ctx, &sub, staging, destLabel); err != nil {
+		return fmt.Errorf("deduplicated files reference backup set %d: %w", setID, err)
+	}
+
+	for _, r := range refs {
+		src := filepath.Join(staging, r.dataPath)
+		dst := filepath.Join(destPath, rw.apply(r.path))
+		if !req.Overwrite {
+			if _, err := os.Lstat(dst); err == nil {
+				return fmt.Errorf("%s already exists", r.path)
+			}
+		}
+		if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+			return fmt.Errorf("failed to create directory for %s: %w", r.path, err)
+		}
+		uses[r.dataPath]--
+		if uses[r.dataPath] == 0 {
+			err = os.Rename(src, dst)
+		} else {
+			err = copyRestoredFile(src, dst)
+		}
+		if err != nil {
+			return fmt.Errorf("failed to place %s: %w", r.path, err)
+		}
+	}
+	return nil
+}
+
+// copyRestoredFile copies an extracted file, keeping its mode and mtime
+func copyRestoredFile(src, dst string) error {
+	info, err := os.Stat(src)
+	if err != nil {
+		return err
+	}
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, info.Mode().Perm())
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	if err := out.Close(); err != nil {
+		return err
+	}
+	return os.Chtimes(dst, info.ModTime(), info.ModTime())
+}
+
+// countRestored counts the restored files: filePaths under destPath, or every
+// file in destPath when filePaths is empty.
+func countRestored(destPath string, filePaths []string) (files, bytes int64) {
+	if len(filePaths) > 0 {
+		for _, fp := range filePaths {
+			if info, err := os.Stat(filepath.Join(destPath, fp)); err == nil {
+				files++
+				bytes += info.Size()
+			}
+		}
+		return files, bytes
+	}
+	filepath.Walk(destPath, func(path string, info os.FileInfo, err error) error {
+		if err == nil && !info.IsDir() {
+			files++
+			bytes += info.Size()
+		}
+		return nil
+	})
+	return files, bytes
+}
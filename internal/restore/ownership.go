@@ -0,0 +1,69 @@
+package restore
+
+import (
+	"fmt"
+	"os"
+	"os/user"
+	"strconv"
+)
+
+// ownershipRestored reports whether tar restores file owners, which it only
+// does when run as root
+var ownershipRestored = func() bool {
+	return os.Geteuid() == 0
+}
+
+// expectedID returns the id tar gives a restored file: a cataloged name that
+// exists on this host maps to its local id, otherwise the numeric id is kept
+func expectedID(id int, name string, lookup func(string) (string, error)) int {
+	if name == "" {
+		return id
+	}
+	local, err := lookup(name)
+	if err != nil {
+		return id
+	}
+	if n, err := strconv.Atoi(local); err == nil {
+		return n
+	}
+	return id
+}
+
+func lookupUID(name string) (string, error) {
+	u, err := user.Lookup(name)
+	if err != nil {
+		return "", err
+	}
+	return u.Uid, nil
+}
+
+func lookupGID(name string) (string, error) {
+	g, err := user.LookupGroup(name)
+	if err != nil {
+		return "", err
+	}
+	return g.Gid, nil
+}
+
+// checkOwnership compares the owner and group of a restored file with its
+// catalog entry. It returns the problem found, or "" when they match or the
+// entry has no ownership recorded.
+func checkOwnership(destFile, filePath string, uid, gid *int, owner, group string) string {
+	if uid == nil || gid == nil {
+		return ""
+	}
+	info, err := os.Lstat(destFile)
+	if err != nil {
+		return ""
+	}
+	gotUID, gotGID, ok := restoredOwner(info)
+	if !ok {
+		return ""
+	}
+	wantUID := expectedID(*uid, owner, lookupUID)
+	wantGID := expectedID(*gid, group, lookupGID)
+	if gotUID != wantUID || gotGID != wantGID {
+		return fmt.Sprintf("owner mismatch for %s: expected %d:%d, got %d:%d", filePath, wantUID, wantGID, gotUID, gotGID)
+	}
+	return ""
+}
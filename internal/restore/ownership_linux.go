@@ -0,0 +1,14 @@
+package restore
+
+import (
+	"os"
+	"syscall"
+)
+
+// restoredOwner returns the uid and gid of a restored file
+func restoredOwner(info os.FileInfo) (uid, gid int, ok bool) {
+	if st, ok := info.Sys().(*syscall.Stat_t); ok {
+		return int(st.Uid), int(st.Gid), true
+	}
+	return 0, 0, false
+}
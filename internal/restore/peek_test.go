@@ -0,0 +1,108 @@
+package restore
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/RoseOO/TapeBackarr/internal/logging"
+	"github.com/RoseOO/TapeBackarr/internal/tape"
+)
+
+// writeTarToTape writes files as a tar archive at file 1 of a file-backed tape
+func writeTarToTape(t *testing.T, drive *tape.Service, label string, files map[string]string, order []string, compress bool) {
+	t.Helper()
+	ctx := context.Background()
+	if err := drive.WriteTapeLabel(ctx, label, "uuid-"+label, "test_pool"); err != nil {
+		t.Fatalf("WriteTapeLabel: %v", err)
+	}
+	var buf bytes.Buffer
+	var out io.Writer = &buf
+	var gz *gzip.Writer
+	if compress {
+		gz = gzip.NewWriter(&buf)
+		out = gz
+	}
+	tw := tar.NewWriter(out)
+	for _, name := range order {
+		tw.WriteHeader(&tar.Header{Name: name, Mode: 0644, Size: int64(len(files[name])), Typeflag: tar.TypeReg})
+		tw.Write([]byte(files[name]))
+	}
+	tw.Close()
+	if gz != nil {
+		gz.Close()
+	}
+	writeStreamToTape(t, drive, buf.Bytes())
+}
+
+// writeStreamToTape writes data at file 1 of a labeled file-backed tape
+func writeStreamToTape(t *testing.T, drive *tape.Service, data []byte) {
+	t.Helper()
+	ctx := context.Background()
+	if err := drive.SeekToFileNumber(ctx, 1); err != nil {
+		t.Fatalf("SeekToFileNumber: %v", err)
+	}
+	w, err := drive.OpenWriter(ctx)
+	if err != nil {
+		t.Fatalf("OpenWriter: %v", err)
+	}
+	w.Write(data)
+	w.Close()
+	drive.WriteFileMark(ctx)
+}
+
+func TestPeek(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+	setID := setupTestData(t, db)
+	logger, _ := logging.NewLogger("error", "text", "")
+	svc := NewService(db, nil, logger, 65536)
+	ctx := context.Background()
+
+	devicePath := "file://" + t.TempDir()
+	pdf := "%PDF-1.7\n" + strings.Repeat("x", 3000)
+	writeTarToTape(t, tape.NewServiceForDevice(devicePath, 65536), "Test Tape",
+		map[string]string{"documents/notes.txt": "notes", "documents/report.pdf": pdf, "images/photo.jpg": "jpeg"},
+		[]string{"documents/notes.txt", "documents/report.pdf", "images/photo.jpg"}, false)
+
+	if _, err := svc.Peek(ctx, &PeekRequest{BackupSetID: setID, FilePath: "documents/report.pdf"}); err == nil {
+		t.Fatal("expected an error while the tape is not loaded")
+	}
+	db.Exec("INSERT INTO tape_drives (device_path, display_name, status, current_tape_id) VALUES (?, 'vtape', 'ready', 1)", devicePath)
+
+	res, err := svc.Peek(ctx, &PeekRequest{BackupSetID: setID, FilePath: "documents/report.pdf", MaxBytes: 1024})
+	if err != nil {
+		t.Fatalf("Peek: %v", err)
+	}
+	if string(res.Data) != pdf[:1024] || !res.Truncated || res.FilesSkipped != 1 || res.ContentType != "application/pdf" {
+		t.Errorf("unexpected peek %q truncated=%v skipped=%d type=%s", res.Data[:16], res.Truncated, res.FilesSkipped, res.ContentType)
+	}
+
+	res, err = svc.Peek(ctx, &PeekRequest{BackupSetID: setID, FilePath: "documents/notes.txt"})
+	if err != nil || string(res.Data) != "notes" || res.Truncated {
+		t.Errorf("expected the whole small file, got %+v (%v)", res, err)
+	}
+
+	if _, err := svc.Peek(ctx, &PeekRequest{BackupSetID: setID, FilePath: "documents/missing.txt"}); err == nil {
+		t.Error("expected an error for a file not in the catalog")
+	}
+
+	// A deduplicated file is read from the compressed set holding its data
+	refDevice := "file://" + t.TempDir()
+	db.Exec(`INSERT INTO tapes (barcode, label, pool_id, status, capacity_bytes, used_bytes) VALUES ('OLD001', 'Old Tape', 1, 'full', 1000000000, 0)`)
+	r, _ := db.Exec(`INSERT INTO backup_sets (job_id, tape_id, backup_type, start_time, status, compressed, compression_type) VALUES (1, 2, 'full', datetime('now', '-7 days'), 'completed', 1, 'gzip')`)
+	refSetID, _ := r.LastInsertId()
+	db.Exec("UPDATE catalog_entries SET ref_backup_set_id = ?, ref_file_path = 'old/photo.jpg' WHERE file_path = 'images/photo.jpg'", refSetID)
+	db.Exec("INSERT INTO tape_drives (device_path, display_name, status, current_tape_id) VALUES (?, 'vtape2', 'ready', 2)", refDevice)
+	writeTarToTape(t, tape.NewServiceForDevice(refDevice, 65536), "Old Tape",
+		map[string]string{"old/photo.jpg": "\xff\xd8\xff\xe0 old photo"}, []string{"old/photo.jpg"}, true)
+
+	res, err = svc.Peek(ctx, &PeekRequest{BackupSetID: setID, FilePath: "images/photo.jpg"})
+	if err != nil || string(res.Data) != "\xff\xd8\xff\xe0 old photo" || res.ContentType != "image/jpeg" {
+		t.Errorf("expected the deduplicated photo from the old tape, got %+v (%v)", res, err)
+	}
+}
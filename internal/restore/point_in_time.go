@@ -0,0 +1,251 @@
+package restore
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/RoseOO/TapeBackarr/internal/models"
+)
+
+// PointInTimeRequest asks for a file or directory of a job as it was at a
+// moment. The restore options are copied into each planned restore.
+type PointInTimeRequest struct {
+	JobID int64 `json:"job_id"`
+	// Path is a file or directory relative to the job's source; empty
+	// means everything the job backed up
+	Path            string        `json:"path"`
+	At              time.Time     `json:"at"`
+	DestPath        string        `json:"dest_path"`
+	DestinationType string        `json:"destination_type"`
+	TargetID        *int64        `json:"target_id,omitempty"`
+	Verify          bool          `json:"verify"`
+	Overwrite       bool          `json:"overwrite"`
+	DriveID         *int64        `json:"drive_id,omitempty"`
+	RateLimitMBps   *int          `json:"rate_limit_mbps,omitempty"`
+	Priority        int           `json:"priority,omitempty"`
+	PathRewrites    []PathRewrite `json:"path_rewrites,omitempty"`
+}
+
+// PointInTimeSet is one backup set of the chain a point-in-time plan
+// restores from
+type PointInTimeSet struct {
+	BackupSetID int64     `json:"backup_set_id"`
+	BackupType  string    `json:"backup_type"`
+	StartTime   time.Time `json:"start_time"`
+	TapeLabel   string    `json:"tape_label"`
+	// Files and Bytes count the files whose newest version at the point in
+	// time is in this set
+	Files int   `json:"files"`
+	Bytes int64 `json:"bytes"`
+}
+
+// PointInTimePlan is the restore plan for a path at a point in time
+type PointInTimePlan struct {
+	JobID int64     `json:"job_id"`
+	Path  string    `json:"path"`
+	At    time.Time `json:"at"`
+	// Chain is the full backup, the latest differential after it if any and
+	// the incrementals after that, oldest first
+	Chain []PointInTimeSet `json:"chain"`
+	// Restores holds one restore per set contributing files, in chain order
+	Restores      []*RestoreRequest `json:"restores"`
+	FileCount     int               `json:"file_count"`
+	TotalBytes    int64             `json:"total_bytes"`
+	RequiredTapes []TapeRequirement `json:"required_tapes"`
+	// DeletedFiles counts the files left out because they had been deleted
+	// from the source by the point in time
+	DeletedFiles int `json:"deleted_files"`
+}
+
+// pitFile is the newest version of a file within a chain
+type pitFile struct {
+	setIndex int
+	size     int64
+	tape     models.Tape
+}
+
+// PlanPointInTime resolves the backup chain of a job that was current at
+// req.At, the last completed full backup started by then, the latest
+// differential after it and every incremental after that up to that moment,
+// and plans restoring each file under req.Path from the newest set in the
+// chain that holds it. Files a set in the chain found deleted are left out.
+func (s *Service) PlanPointInTime(ctx context.Context, req *PointInTimeRequest) (*PointInTimePlan, error) {
+	if req.At.IsZero() {
+		return nil, fmt.Errorf("a point in time is required")
+	}
+	path := strings.Trim(req.Path, "/")
+
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT bs.id, bs.backup_type, bs.start_time, COALESCE(t.label, ''),
+		       (SELECT COUNT(*) FROM catalog_entries ce WHERE ce.backup_set_id = bs.id)
+		FROM backup_sets bs
+		LEFT JOIN tapes t ON bs.tape_id = t.id
+		WHERE bs.job_id = ? AND bs.status = ? AND bs.invalidated_at IS NULL
+		ORDER BY bs.start_time DESC, bs.id DESC
+	`, req.JobID, models.BackupSetStatusCompleted)
+	if err != nil {
+		return nil, err
+	}
+
+	// Newest first, back to and including the last full set with a catalog.
+	// Later tapes of a spanned run have no catalog of their own and are skipped.
+	// The latest differential holds every change since the full, so the sets
+	// between the two are not needed.
+	var chain []PointInTimeSet
+	foundFull := false
+	skipToFull := false
+	for rows.Next() {
+		var set PointInTimeSet
+		var entries int
+		if err := rows.Scan(&set.BackupSetID, &set.BackupType, &set.StartTime, &set.TapeLabel, &entries); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		if entries == 0 || set.StartTime.After(req.At) {
+			continue
+		}
+		if skipToFull && set.BackupType != string(models.BackupTypeFull) {
+			continue
+		}
+		chain = append(chain, set)
+		if set.BackupType == string(models.BackupTypeFull) {
+			foundFull = true
+			break
+		}
+		skipToFull = set.BackupType == string(models.BackupTypeDifferential)
+	}
+	rows.Close()
+	if !foundFull {
+		return nil, fmt.Errorf("job %d has no completed full backup started by %s", req.JobID, req.At.Format(time.RFC3339))
+	}
+	for i, j := 0, len(chain)-1; i < j; i, j = i+1, j-1 {
+		chain[i], chain[j] = chain[j], chain[i]
+	}
+
+	// Overlay the catalogs oldest first so the newest version of each file
+	// wins, dropping the files each later set found deleted
+	files := make(map[string]pitFile)
+	deleted := 0
+	for i, set := range chain {
+		removed, err := s.deletedPaths(ctx, set.BackupSetID, path)
+		if err != nil {
+			return nil, err
+		}
+		for _, p := range removed {
+			if _, ok := files[p]; ok {
+				delete(files, p)
+				deleted++
+			}
+		}
+
+		query := `
+			SELECT ce.file_path, ce.file_size, t.id, t.barcode, t.label, t.status
+			FROM catalog_entries ce
+			JOIN backup_sets bs ON COALESCE(ce.ref_backup_set_id, ce.backup_set_id) = bs.id
+			JOIN tapes t ON bs.tape_id = t.id
+			WHERE ce.backup_set_id = ?`
+		args := []interface{}{set.BackupSetID}
+		if path != "" {
+			query += " AND (ce.file_path = ? OR ce.file_path LIKE ?)"
+			args = append(args, path, path+"/%")
+		}
+		rows, err := s.db.QueryContext(ctx, query, args...)
+		if err != nil {
+			return nil, err
+		}
+		for rows.Next() {
+			var filePath string
+			f := pitFile{setIndex: i}
+			if err := rows.Scan(&filePath, &f.size, &f.tape.ID, &f.tape.Barcode, &f.tape.Label, &f.tape.Status); err != nil {
+				rows.Close()
+				return nil, err
+			}
+			files[filePath] = f
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return nil, err
+		}
+	}
+	if len(files) == 0 {
+		return nil, fmt.Errorf("%q was not backed up by job %d as of %s", req.Path, req.JobID, req.At.Format(time.RFC3339))
+	}
+
+	plan := &PointInTimePlan{JobID: req.JobID, Path: path, At: req.At, Chain: chain, DeletedFiles: deleted}
+	restores := make([]*RestoreRequest, len(chain))
+	tapes := make(map[int64]*TapeRequirement)
+	for filePath, f := range files {
+		if restores[f.setIndex] == nil {
+			restores[f.setIndex] = &RestoreRequest{
+				BackupSetID:     chain[f.setIndex].BackupSetID,
+				DestPath:        req.DestPath,
+				DestinationType: req.DestinationType,
+				TargetID:        req.TargetID,
+				Verify:          req.Verify,
+				Overwrite:       req.Overwrite,
+				DriveID:         req.DriveID,
+				RateLimitMBps:   req.RateLimitMBps,
+				Priority:        req.Priority,
+				PathRewrites:    req.PathRewrites,
+			}
+		}
+		restores[f.setIndex].FilePaths = append(restores[f.setIndex].FilePaths, filePath)
+		chain[f.setIndex].Files++
+		chain[f.setIndex].Bytes += f.size
+		plan.FileCount++
+		plan.TotalBytes += f.size
+
+		tr, ok := tapes[f.tape.ID]
+		if !ok {
+			tr = &TapeRequirement{Tape: f.tape}
+			tapes[f.tape.ID] = tr
+		}
+		tr.FileCount++
+		tr.TotalBytes += f.size
+	}
+
+	// Tapes are needed in the order their restores run
+	for _, r := range restores {
+		if r == nil {
+			continue
+		}
+		sort.Strings(r.FilePaths)
+		plan.Restores = append(plan.Restores, r)
+		for _, filePath := range r.FilePaths {
+			if tr := tapes[files[filePath].tape.ID]; tr.Order == 0 {
+				tr.Order = len(plan.RequiredTapes) + 1
+				plan.RequiredTapes = append(plan.RequiredTapes, *tr)
+			}
+		}
+	}
+	return plan, nil
+}
+
+// deletedPaths returns the paths an incremental set recorded as deleted,
+// limited to path and what is under it when path is not empty
+func (s *Service) deletedPaths(ctx context.Context, backupSetID int64, path string) ([]string, error) {
+	query := "SELECT path FROM backup_deleted_paths WHERE backup_set_id = ?"
+	args := []interface{}{backupSetID}
+	if path != "" {
+		query += " AND (path = ? OR path LIKE ?)"
+		args = append(args, path, path+"/%")
+	}
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var paths []string
+	for rows.Next() {
+		var p string
+		if err := rows.Scan(&p); err != nil {
+			return nil, err
+		}
+		paths = append(paths, p)
+	}
+	return paths, rows.Err()
+}
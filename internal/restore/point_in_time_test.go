@@ -0,0 +1,121 @@
+package restore
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestPlanPointInTime(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+	fullID := setupTestData(t, db)
+	svc := &Service{db: db}
+	ctx := context.Background()
+	db.Exec("UPDATE backup_sets SET start_time = datetime('now', '-10 days') WHERE id = ?", fullID)
+
+	// Two incrementals on a second tape, one after the point in time
+	db.Exec(`INSERT INTO tapes (barcode, label, pool_id, status, capacity_bytes, used_bytes) VALUES ('TEST002', 'Second Tape', 1, 'active', 1000000000, 0)`)
+	r, _ := db.Exec(`INSERT INTO backup_sets (job_id, tape_id, backup_type, start_time, status) VALUES (1, 2, 'incremental', datetime('now', '-5 days'), 'completed')`)
+	incrID, _ := r.LastInsertId()
+	db.Exec(`INSERT INTO catalog_entries (backup_set_id, file_path, file_size) VALUES (?, 'documents/notes.txt', 600), (?, 'documents/new.txt', 10)`, incrID, incrID)
+	r, _ = db.Exec(`INSERT INTO backup_sets (job_id, tape_id, backup_type, start_time, status) VALUES (1, 2, 'incremental', datetime('now', '-1 days'), 'completed')`)
+	laterID, _ := r.LastInsertId()
+	db.Exec(`INSERT INTO catalog_entries (backup_set_id, file_path, file_size) VALUES (?, 'documents/report.pdf', 1200)`, laterID)
+	// An empty incremental is not part of the chain
+	db.Exec(`INSERT INTO backup_sets (job_id, tape_id, backup_type, start_time, status) VALUES (1, 2, 'incremental', datetime('now', '-4 days'), 'completed')`)
+
+	plan, err := svc.PlanPointInTime(ctx, &PointInTimeRequest{JobID: 1, Path: "documents/", At: time.Now().Add(-3 * 24 * time.Hour), DestPath: "/restore"})
+	if err != nil {
+		t.Fatalf("PlanPointInTime: %v", err)
+	}
+	if len(plan.Chain) != 2 || plan.Chain[0].BackupSetID != fullID || plan.Chain[1].BackupSetID != incrID {
+		t.Fatalf("expected the full and first incremental, got %+v", plan.Chain)
+	}
+	if plan.FileCount != 5 || len(plan.Restores) != 2 {
+		t.Fatalf("expected 5 files in 2 restores, got %d in %d", plan.FileCount, len(plan.Restores))
+	}
+	full, incr := plan.Restores[0], plan.Restores[1]
+	if full.BackupSetID != fullID || len(full.FilePaths) != 3 || full.DestPath != "/restore" {
+		t.Errorf("unexpected restore from the full set %+v", full)
+	}
+	if incr.BackupSetID != incrID || len(incr.FilePaths) != 2 || incr.FilePaths[0] != "documents/new.txt" || incr.FilePaths[1] != "documents/notes.txt" {
+		t.Errorf("expected the changed files from the incremental, got %+v", incr)
+	}
+	if len(plan.RequiredTapes) != 2 || plan.RequiredTapes[0].Tape.ID != 1 || plan.RequiredTapes[1].FileCount != 2 {
+		t.Errorf("unexpected required tapes %+v", plan.RequiredTapes)
+	}
+
+	// Now the later incremental's report.pdf wins
+	plan, err = svc.PlanPointInTime(ctx, &PointInTimeRequest{JobID: 1, Path: "documents/report.pdf", At: time.Now()})
+	if err != nil || len(plan.Restores) != 1 || plan.Restores[0].BackupSetID != laterID || plan.TotalBytes != 1200 {
+		t.Errorf("expected report.pdf from the latest incremental, got %+v (%v)", plan, err)
+	}
+
+	// A file the later incremental found deleted is left out from then on
+	db.Exec("INSERT INTO backup_deleted_paths (backup_set_id, path) VALUES (?, 'documents/new.txt')", laterID)
+	plan, err = svc.PlanPointInTime(ctx, &PointInTimeRequest{JobID: 1, Path: "documents", At: time.Now()})
+	if err != nil || plan.FileCount != 4 || plan.DeletedFiles != 1 {
+		t.Fatalf("expected 4 files with 1 deleted, got %+v (%v)", plan, err)
+	}
+	for _, r := range plan.Restores {
+		for _, p := range r.FilePaths {
+			if p == "documents/new.txt" {
+				t.Errorf("deleted file planned for restore from set %d", r.BackupSetID)
+			}
+		}
+	}
+	plan, _ = svc.PlanPointInTime(ctx, &PointInTimeRequest{JobID: 1, Path: "documents", At: time.Now().Add(-3 * 24 * time.Hour)})
+	if plan == nil || plan.DeletedFiles != 0 || plan.FileCount != 5 {
+		t.Errorf("expected the file before its deletion, got %+v", plan)
+	}
+
+	if _, err := svc.PlanPointInTime(ctx, &PointInTimeRequest{JobID: 1, At: time.Now().Add(-30 * 24 * time.Hour)}); err == nil {
+		t.Error("expected an error before the first full backup")
+	}
+}
+
+func TestPlanPointInTimeDifferential(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+	fullID := setupTestData(t, db)
+	svc := &Service{db: db}
+	ctx := context.Background()
+	db.Exec("UPDATE backup_sets SET start_time = datetime('now', '-10 days') WHERE id = ?", fullID)
+
+	// An incremental on tape 2, then a differential and an incremental on
+	// tape 3: the differential already holds the first incremental's change
+	db.Exec(`INSERT INTO tapes (barcode, label, pool_id, status, capacity_bytes, used_bytes) VALUES ('TEST002', 'Second Tape', 1, 'active', 1000000000, 0)`)
+	db.Exec(`INSERT INTO tapes (barcode, label, pool_id, status, capacity_bytes, used_bytes) VALUES ('TEST003', 'Third Tape', 1, 'active', 1000000000, 0)`)
+	r, _ := db.Exec(`INSERT INTO backup_sets (job_id, tape_id, backup_type, start_time, status) VALUES (1, 2, 'incremental', datetime('now', '-6 days'), 'completed')`)
+	incrID, _ := r.LastInsertId()
+	db.Exec(`INSERT INTO catalog_entries (backup_set_id, file_path, file_size) VALUES (?, 'documents/notes.txt', 600)`, incrID)
+	r, _ = db.Exec(`INSERT INTO backup_sets (job_id, tape_id, backup_type, start_time, status) VALUES (1, 3, 'differential', datetime('now', '-4 days'), 'completed')`)
+	diffID, _ := r.LastInsertId()
+	db.Exec(`INSERT INTO catalog_entries (backup_set_id, file_path, file_size) VALUES (?, 'documents/notes.txt', 600), (?, 'documents/new.txt', 10)`, diffID, diffID)
+	r, _ = db.Exec(`INSERT INTO backup_sets (job_id, tape_id, backup_type, start_time, status) VALUES (1, 3, 'incremental', datetime('now', '-2 days'), 'completed')`)
+	laterID, _ := r.LastInsertId()
+	db.Exec(`INSERT INTO catalog_entries (backup_set_id, file_path, file_size) VALUES (?, 'documents/report.pdf', 1200)`, laterID)
+
+	plan, err := svc.PlanPointInTime(ctx, &PointInTimeRequest{JobID: 1, Path: "documents", At: time.Now()})
+	if err != nil {
+		t.Fatalf("PlanPointInTime: %v", err)
+	}
+	if len(plan.Chain) != 3 || plan.Chain[0].BackupSetID != fullID || plan.Chain[1].BackupSetID != diffID || plan.Chain[2].BackupSetID != laterID {
+		t.Fatalf("expected the full, the differential and the incremental after it, got %+v", plan.Chain)
+	}
+	if plan.FileCount != 5 {
+		t.Errorf("expected 5 files, got %d", plan.FileCount)
+	}
+	for _, tr := range plan.RequiredTapes {
+		if tr.Tape.ID == 2 {
+			t.Errorf("the incremental before the differential should not be needed, got tapes %+v", plan.RequiredTapes)
+		}
+	}
+
+	// Before the differential the first incremental is still needed
+	plan, err = svc.PlanPointInTime(ctx, &PointInTimeRequest{JobID: 1, Path: "documents", At: time.Now().Add(-5 * 24 * time.Hour)})
+	if err != nil || len(plan.Chain) != 2 || plan.Chain[1].BackupSetID != incrID {
+		t.Fatalf("expected the full and first incremental, got %+v (%v)", plan, err)
+	}
+}
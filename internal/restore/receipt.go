@@ -0,0 +1,440 @@
+package restore
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// receiptMaxFiles bounds the files listed in a receipt. The manifest count,
+// size and digest always cover every file.
+const receiptMaxFiles = 10000
+
+// ReceiptAlgorithm is the signature algorithm of restore receipts
+const ReceiptAlgorithm = "ed25519"
+
+// ErrBadReceiptSignature is returned when a receipt does not match its signature
+var ErrBadReceiptSignature = errors.New("receipt signature is invalid")
+
+// Receipt records what a restore handed over: who asked for it, which files
+// from which backup sets and tapes, how they were verified and where they
+// went. It is signed as the JSON document it encodes to.
+type Receipt struct {
+	ID                       string              `json:"id"`
+	Version                  int                 `json:"version"`
+	RequestedBy              ReceiptUser         `json:"requested_by"`
+	StartedAt                time.Time           `json:"started_at"`
+	FinishedAt               time.Time           `json:"finished_at"`
+	Status                   string              `json:"status"` // completed or failed
+	Error                    string              `json:"error,omitempty"`
+	Destination              ReceiptDestination  `json:"destination"`
+	BackupSets               []ReceiptSet        `json:"backup_sets"`
+	FilesRestored            int64               `json:"files_restored"`
+	BytesRestored            int64               `json:"bytes_restored"`
+	Verification             ReceiptVerification `json:"verification"`
+	EncryptionKeyFingerprint string              `json:"encryption_key_fingerprint,omitempty"`
+	Manifest                 ReceiptManifest     `json:"manifest"`
+}
+
+// ReceiptUser is the user who requested a restore
+type ReceiptUser struct {
+	ID        int64  `json:"id"`
+	Username  string `json:"username"`
+	IPAddress string `json:"ip_address,omitempty"`
+}
+
+// ReceiptDestination is where restored files were written
+type ReceiptDestination struct {
+	Type       string `json:"type"`
+	Path       string `json:"path"`
+	TargetID   *int64 `json:"target_id,omitempty"`
+	TargetName string `json:"target_name,omitempty"`
+}
+
+// ReceiptSet is a backup set files were read from, with its tape
+type ReceiptSet struct {
+	ID          int64     `json:"id"`
+	JobName     string    `json:"job_name"`
+	BackupType  string    `json:"backup_type"`
+	StartTime   time.Time `json:"start_time"`
+	TapeID      int64     `json:"tape_id"`
+	TapeLabel   string    `json:"tape_label"`
+	TapeBarcode string    `json:"tape_barcode,omitempty"`
+	Encrypted   bool      `json:"encrypted"`
+	FileCount   int64     `json:"file_count"`
+}
+
+// ReceiptVerification is the outcome of checking restored files against the
+// catalog
+type ReceiptVerification struct {
+	Requested         bool     `json:"requested"`
+	Verified          bool     `json:"verified"`
+	ChecksumsVerified int64    `json:"checksums_verified"`
+	Errors            []string `json:"errors,omitempty"`
+}
+
+// ReceiptManifest lists the restored files. SHA256 is the digest of one
+// "<sha256>\t<size>\t<path>\n" line per file in path order, so a recipient
+// can check a full file list against a receipt whose list was truncated.
+type ReceiptManifest struct {
+	FileCount  int64         `json:"file_count"`
+	TotalBytes int64         `json:"total_bytes"`
+	SHA256     string        `json:"sha256"`
+	Files      []ReceiptFile `json:"files"`
+	Omitted    int64         `json:"omitted,omitempty"`
+}
+
+// ReceiptFile is one restored file as recorded in the catalog
+type ReceiptFile struct {
+	Path        string `json:"path"`
+	Size        int64  `json:"size"`
+	SHA256      string `json:"sha256,omitempty"`
+	BackupSetID int64  `json:"backup_set_id"`
+}
+
+// ReceiptInput describes a finished restore attempt
+type ReceiptInput struct {
+	Request        *RestoreRequest
+	Result         *RestoreResult // nil if the restore failed before starting
+	Err            error
+	UserID         int64
+	Username       string
+	IPAddress      string
+	StartedAt      time.Time
+	KeyFingerprint string // externally supplied encryption key
+}
+
+// StoredReceipt is a signed receipt as stored. Receipt holds the exact
+// bytes that were signed.
+type StoredReceipt struct {
+	ID        int64           `json:"id"`
+	UUID      string          `json:"uuid"`
+	Receipt   json.RawMessage `json:"receipt"`
+	Signature string          `json:"signature"`
+	Algorithm string          `json:"algorithm"`
+	PublicKey string          `json:"public_key"`
+	CreatedAt time.Time       `json:"created_at"`
+}
+
+// ReceiptSummary is a receipt as listed
+type ReceiptSummary struct {
+	ID            int64     `json:"id"`
+	UUID          string    `json:"uuid"`
+	UserID        *int64    `json:"user_id"`
+	Username      *string   `json:"username"`
+	BackupSetID   int64     `json:"backup_set_id"`
+	Status        string    `json:"status"`
+	Destination   string    `json:"destination"`
+	FilesRestored int64     `json:"files_restored"`
+	BytesRestored int64     `json:"bytes_restored"`
+	CreatedAt     time.Time `json:"created_at"`
+}
+
+// CreateReceipt builds, signs and stores the receipt of a restore attempt.
+// Failed restores get a receipt too, listing what was requested.
+func (s *Service) CreateReceipt(ctx context.Context, in ReceiptInput) (*StoredReceipt, error) {
+	req := in.Request
+	receipt := &Receipt{
+		ID:          newReceiptID(),
+		Version:     1,
+		RequestedBy: ReceiptUser{ID: in.UserID, Username: in.Username, IPAddress: in.IPAddress},
+		StartedAt:   in.StartedAt.UTC(),
+		FinishedAt:  time.Now().UTC(),
+		Status:      "completed",
+		Destination: ReceiptDestination{
+			Type:     req.DestinationType,
+			Path:     req.DestPath,
+			TargetID: req.TargetID,
+		},
+		EncryptionKeyFingerprint: in.KeyFingerprint,
+		Verification:             ReceiptVerification{Requested: req.Verify},
+	}
+	if receipt.Destination.Type == "" {
+		receipt.Destination.Type = "local"
+	}
+	if in.Err != nil {
+		receipt.Status = "failed"
+		receipt.Error = in.Err.Error()
+	}
+	if req.TargetID != nil {
+		if t, err := s.GetTarget(*req.TargetID); err == nil {
+			receipt.Destination.TargetName = t.Name
+		}
+	}
+	if r := in.Result; r != nil {
+		receipt.FilesRestored = r.FilesRestored
+		receipt.BytesRestored = r.BytesRestored
+		receipt.Verification.Verified = r.Verified
+		receipt.Verification.ChecksumsVerified = r.ChecksumsVerified
+		if req.Verify {
+			receipt.Verification.Errors = r.Errors
+		}
+	}
+
+	setFiles, err := s.receiptManifest(ctx, req, &receipt.Manifest)
+	if err != nil {
+		return nil, err
+	}
+	receipt.BackupSets, err = s.receiptSets(req.BackupSetID, setFiles)
+	if err != nil {
+		return nil, err
+	}
+
+	content, err := json.Marshal(receipt)
+	if err != nil {
+		return nil, err
+	}
+	keyID, priv, pub, err := s.receiptKey()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load receipt signing key: %w", err)
+	}
+	signature := base64.StdEncoding.EncodeToString(ed25519.Sign(priv, content))
+
+	var userID interface{}
+	if in.UserID > 0 {
+		userID = in.UserID
+	}
+	destination := receipt.Destination.Path
+	if receipt.Destination.TargetName != "" {
+		destination = receipt.Destination.TargetName + ":" + destination
+	}
+	res, err := s.db.Exec(`
+		INSERT INTO restore_receipts (uuid, user_id, backup_set_id, status, destination, files_restored, bytes_restored, content, signature, key_id)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`, receipt.ID, userID, req.BackupSetID, receipt.Status, destination, receipt.FilesRestored, receipt.BytesRestored,
+		string(content), signature, keyID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to store restore receipt: %w", err)
+	}
+	id, _ := res.LastInsertId()
+	return &StoredReceipt{
+		ID:        id,
+		UUID:      receipt.ID,
+		Receipt:   content,
+		Signature: signature,
+		Algorithm: ReceiptAlgorithm,
+		PublicKey: base64.StdEncoding.EncodeToString(pub),
+		CreatedAt: receipt.FinishedAt,
+	}, nil
+}
+
+// receiptManifest fills in the files selected by a restore request and
+// returns how many of them came from each backup set
+func (s *Service) receiptManifest(ctx context.Context, req *RestoreRequest, m *ReceiptManifest) (map[int64]int64, error) {
+	paths := append([]string(nil), req.FilePaths...)
+	if len(req.FolderPaths) > 0 {
+		folderFiles, err := s.getFilesInFolders(ctx, req.BackupSetID, req.FolderPaths)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get files in folders: %w", err)
+		}
+		paths = append(paths, folderFiles...)
+	}
+	selected := make(map[string]bool, len(paths))
+	for _, p := range paths {
+		selected[p] = true
+	}
+
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT file_path, file_size, COALESCE(checksum, ''), COALESCE(ref_backup_set_id, backup_set_id)
+		FROM catalog_entries
+		WHERE backup_set_id = ?
+		ORDER BY file_path
+	`, req.BackupSetID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	setFiles := make(map[int64]int64)
+	h := sha256.New()
+	m.Files = make([]ReceiptFile, 0)
+	for rows.Next() {
+		var f ReceiptFile
+		if err := rows.Scan(&f.Path, &f.Size, &f.SHA256, &f.BackupSetID); err != nil {
+			return nil, err
+		}
+		if len(selected) > 0 && !selected[f.Path] {
+			continue
+		}
+		fmt.Fprintf(h, "%s\t%d\t%s\n", f.SHA256, f.Size, f.Path)
+		m.FileCount++
+		m.TotalBytes += f.Size
+		setFiles[f.BackupSetID]++
+		if len(m.Files) < receiptMaxFiles {
+			m.Files = append(m.Files, f)
+		} else {
+			m.Omitted++
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	m.SHA256 = hex.EncodeToString(h.Sum(nil))
+	return setFiles, nil
+}
+
+// receiptSets describes the restored set and every set that supplied
+// deduplicated files
+func (s *Service) receiptSets(backupSetID int64, setFiles map[int64]int64) ([]ReceiptSet, error) {
+	ids := []int64{backupSetID}
+	for id := range setFiles {
+		if id != backupSetID {
+			ids = append(ids, id)
+		}
+	}
+	sets := make([]ReceiptSet, 0, len(ids))
+	for i, id := range ids {
+		var set ReceiptSet
+		var barcode *string
+		err := s.db.QueryRow(`
+			SELECT bs.id, COALESCE(j.name, ''), bs.backup_type, bs.start_time, bs.tape_id, t.label, t.barcode, COALESCE(bs.encrypted, 0)
+			FROM backup_sets bs
+			JOIN tapes t ON t.id = bs.tape_id
+			LEFT JOIN backup_jobs j ON j.id = bs.job_id
+			WHERE bs.id = ?
+		`, id).Scan(&set.ID, &set.JobName, &set.BackupType, &set.StartTime, &set.TapeID, &set.TapeLabel, &barcode, &set.Encrypted)
+		if err != nil {
+			if i == 0 {
+				return nil, fmt.Errorf("backup set not found: %w", err)
+			}
+			continue
+		}
+		if barcode != nil {
+			set.TapeBarcode = *barcode
+		}
+		set.FileCount = setFiles[id]
+		sets = append(sets, set)
+	}
+	// Referenced sets in ID order after the restored set
+	if len(sets) > 1 {
+		refs := sets[1:]
+		sort.Slice(refs, func(i, j int) bool { return refs[i].ID < refs[j].ID })
+	}
+	return sets, nil
+}
+
+// receiptKey returns the receipt signing key, creating it on first use
+func (s *Service) receiptKey() (int64, ed25519.PrivateKey, ed25519.PublicKey, error) {
+	var id int64
+	var privB64 string
+	err := s.db.QueryRow("SELECT id, private_key FROM receipt_signing_keys ORDER BY id DESC LIMIT 1").Scan(&id, &privB64)
+	if err == sql.ErrNoRows {
+		pub, priv, err := ed25519.GenerateKey(rand.Reader)
+		if err != nil {
+			return 0, nil, nil, err
+		}
+		res, err := s.db.Exec("INSERT INTO receipt_signing_keys (public_key, private_key) VALUES (?, ?)",
+			base64.StdEncoding.EncodeToString(pub), base64.StdEncoding.EncodeToString(priv))
+		if err != nil {
+			return 0, nil, nil, err
+		}
+		id, _ = res.LastInsertId()
+		return id, priv, pub, nil
+	}
+	if err != nil {
+		return 0, nil, nil, err
+	}
+	raw, err := base64.StdEncoding.DecodeString(privB64)
+	if err != nil || len(raw) != ed25519.PrivateKeySize {
+		return 0, nil, nil, fmt.Errorf("stored signing key is malformed")
+	}
+	priv := ed25519.PrivateKey(raw)
+	return id, priv, priv.Public().(ed25519.PublicKey), nil
+}
+
+// ReceiptPublicKey returns the base64 public key receipts are signed with,
+// creating the key pair on first use
+func (s *Service) ReceiptPublicKey() (string, error) {
+	_, _, pub, err := s.receiptKey()
+	if err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(pub), nil
+}
+
+// GetReceipt returns a stored receipt by ID
+func (s *Service) GetReceipt(id int64) (*StoredReceipt, error) {
+	var r StoredReceipt
+	var content string
+	err := s.db.QueryRow(`
+		SELECT rr.id, rr.uuid, rr.content, rr.signature, k.public_key, rr.created_at
+		FROM restore_receipts rr
+		JOIN receipt_signing_keys k ON k.id = rr.key_id
+		WHERE rr.id = ?
+	`, id).Scan(&r.ID, &r.UUID, &content, &r.Signature, &r.PublicKey, &r.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	r.Receipt = json.RawMessage(content)
+	r.Algorithm = ReceiptAlgorithm
+	return &r, nil
+}
+
+// ListReceipts returns receipts, newest first, optionally for one backup set
+func (s *Service) ListReceipts(backupSetID int64, limit, offset int) ([]ReceiptSummary, error) {
+	query := `
+		SELECT rr.id, rr.uuid, rr.user_id, u.username, rr.backup_set_id, rr.status, rr.destination,
+		       rr.files_restored, rr.bytes_restored, rr.created_at
+		FROM restore_receipts rr
+		LEFT JOIN users u ON u.id = rr.user_id`
+	args := []interface{}{}
+	if backupSetID > 0 {
+		query += " WHERE rr.backup_set_id = ?"
+		args = append(args, backupSetID)
+	}
+	query += " ORDER BY rr.id DESC LIMIT ? OFFSET ?"
+	args = append(args, limit, offset)
+
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	receipts := make([]ReceiptSummary, 0)
+	for rows.Next() {
+		var r ReceiptSummary
+		if err := rows.Scan(&r.ID, &r.UUID, &r.UserID, &r.Username, &r.BackupSetID, &r.Status, &r.Destination,
+			&r.FilesRestored, &r.BytesRestored, &r.CreatedAt); err != nil {
+			return nil, err
+		}
+		receipts = append(receipts, r)
+	}
+	return receipts, rows.Err()
+}
+
+// Verify checks the receipt against its signature and decodes it
+func (r *StoredReceipt) Verify() (*Receipt, error) {
+	pub, err := base64.StdEncoding.DecodeString(r.PublicKey)
+	if err != nil || len(pub) != ed25519.PublicKeySize {
+		return nil, fmt.Errorf("invalid public key")
+	}
+	sig, err := base64.StdEncoding.DecodeString(r.Signature)
+	if err != nil || !ed25519.Verify(ed25519.PublicKey(pub), r.Receipt, sig) {
+		return nil, ErrBadReceiptSignature
+	}
+	var receipt Receipt
+	if err := json.Unmarshal(r.Receipt, &receipt); err != nil {
+		return nil, err
+	}
+	return &receipt, nil
+}
+
+// newReceiptID returns a random UUID v4
+func newReceiptID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	b[6] = (b[6] & 0x0f) | 0x40
+	b[8] = (b[8] & 0x3f) | 0x80
+	h := hex.EncodeToString(b)
+	return strings.Join([]string{h[0:8], h[8:12], h[12:16], h[16:20], h[20:32]}, "-")
+}
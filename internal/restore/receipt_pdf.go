@@ -0,0 +1,194 @@
+package restore
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// PDF page layout: A4 in points, Courier at 8pt
+const (
+	pdfPageWidth    = 595
+	pdfPageHeight   = 842
+	pdfMargin       = 40
+	pdfFontSize     = 8
+	pdfLeading      = 10
+	pdfLineWidth    = 110 // characters that fit between the margins
+	pdfLinesPerPage = (pdfPageHeight - 2*pdfMargin) / pdfLeading
+)
+
+// PDF renders the stored receipt as a printable document. The signature
+// and public key are printed so the receipt can be checked against the
+// JSON export.
+func (r *StoredReceipt) PDF() ([]byte, error) {
+	var receipt Receipt
+	if err := json.Unmarshal(r.Receipt, &receipt); err != nil {
+		return nil, err
+	}
+	return renderPDF(receiptLines(&receipt, r)), nil
+}
+
+// receiptLines lays the receipt out as plain text
+func receiptLines(rc *Receipt, stored *StoredReceipt) []string {
+	ts := func(t time.Time) string { return t.UTC().Format("2006-01-02 15:04:05 UTC") }
+	lines := []string{
+		"TAPEBACKARR RESTORE RECEIPT",
+		"",
+		"Receipt ID:      " + rc.ID,
+		"Status:          " + rc.Status,
+	}
+	if rc.Error != "" {
+		lines = append(lines, "Error:           "+rc.Error)
+	}
+	requester := fmt.Sprintf("%s (user %d)", rc.RequestedBy.Username, rc.RequestedBy.ID)
+	if rc.RequestedBy.IPAddress != "" {
+		requester += " from " + rc.RequestedBy.IPAddress
+	}
+	dest := rc.Destination.Type + " " + rc.Destination.Path
+	if rc.Destination.TargetName != "" {
+		dest = fmt.Sprintf("%s target %q, path %s", rc.Destination.Type, rc.Destination.TargetName, rc.Destination.Path)
+	}
+	lines = append(lines,
+		"Requested by:    "+requester,
+		"Started:         "+ts(rc.StartedAt),
+		"Finished:        "+ts(rc.FinishedAt),
+		"Destination:     "+dest,
+		fmt.Sprintf("Files restored:  %d (%d bytes)", rc.FilesRestored, rc.BytesRestored),
+	)
+	switch {
+	case !rc.Verification.Requested:
+		lines = append(lines, "Verification:    not requested")
+	case rc.Verification.Verified:
+		lines = append(lines, fmt.Sprintf("Verification:    passed, %d checksums verified", rc.Verification.ChecksumsVerified))
+	default:
+		lines = append(lines, fmt.Sprintf("Verification:    FAILED, %d checksums verified", rc.Verification.ChecksumsVerified))
+		for _, e := range rc.Verification.Errors {
+			lines = append(lines, "                 "+e)
+		}
+	}
+	if rc.EncryptionKeyFingerprint != "" {
+		lines = append(lines, "Supplied key:    fingerprint "+rc.EncryptionKeyFingerprint)
+	}
+
+	lines = append(lines, "", "BACKUP SETS AND TAPES")
+	for _, set := range rc.BackupSets {
+		tape := set.TapeLabel
+		if set.TapeBarcode != "" && set.TapeBarcode != set.TapeLabel {
+			tape += " (barcode " + set.TapeBarcode + ")"
+		}
+		enc := ""
+		if set.Encrypted {
+			enc = ", encrypted"
+		}
+		lines = append(lines, fmt.Sprintf("  Set %d: job %q, %s backup of %s%s", set.ID, set.JobName, set.BackupType, ts(set.StartTime), enc),
+			fmt.Sprintf("         tape %s, %d file(s)", tape, set.FileCount))
+	}
+
+	m := rc.Manifest
+	lines = append(lines, "", "FILE MANIFEST",
+		fmt.Sprintf("  %d file(s), %d bytes", m.FileCount, m.TotalBytes),
+		"  Manifest SHA256: "+m.SHA256,
+		"")
+	for _, f := range m.Files {
+		sum := f.SHA256
+		if sum == "" {
+			sum = strings.Repeat("-", 64)
+		}
+		lines = append(lines, fmt.Sprintf("  %s %12d %s", sum, f.Size, f.Path))
+	}
+	if m.Omitted > 0 {
+		lines = append(lines, fmt.Sprintf("  ... %d more file(s) are covered by the manifest SHA256 but not listed", m.Omitted))
+	}
+
+	lines = append(lines, "", "SIGNATURE",
+		"  Algorithm:  "+stored.Algorithm,
+		"  Public key: "+stored.PublicKey,
+		"  Signature:  "+stored.Signature,
+		"",
+		"The signature covers the receipt JSON exported from",
+		fmt.Sprintf("GET /api/v1/restore/receipts/%d.", stored.ID))
+	return lines
+}
+
+// renderPDF writes lines of text as a multi-page PDF using the built-in
+// Courier font. Long lines are wrapped; characters outside Latin-1 are
+// replaced.
+func renderPDF(lines []string) []byte {
+	var wrapped []string
+	for _, l := range lines {
+		runes := []rune(l)
+		for len(runes) > pdfLineWidth {
+			wrapped = append(wrapped, string(runes[:pdfLineWidth]))
+			runes = append([]rune("    "), runes[pdfLineWidth:]...)
+		}
+		wrapped = append(wrapped, string(runes))
+	}
+	var pages [][]string
+	for len(wrapped) > pdfLinesPerPage {
+		pages = append(pages, wrapped[:pdfLinesPerPage])
+		wrapped = wrapped[pdfLinesPerPage:]
+	}
+	pages = append(pages, wrapped)
+
+	// Objects: 1 catalog, 2 page tree, 3 font, then a page and its content
+	// stream for every page
+	var objects []string
+	kids := make([]string, len(pages))
+	for i := range pages {
+		kids[i] = fmt.Sprintf("%d 0 R", 4+2*i)
+	}
+	objects = append(objects,
+		"<< /Type /Catalog /Pages 2 0 R >>",
+		fmt.Sprintf("<< /Type /Pages /Kids [%s] /Count %d >>", strings.Join(kids, " "), len(pages)),
+		"<< /Type /Font /Subtype /Type1 /BaseFont /Courier /Encoding /WinAnsiEncoding >>",
+	)
+	for i, page := range pages {
+		var content bytes.Buffer
+		fmt.Fprintf(&content, "BT /F1 %d Tf %d TL %d %d Td\n", pdfFontSize, pdfLeading, pdfMargin, pdfPageHeight-pdfMargin)
+		for _, l := range page {
+			fmt.Fprintf(&content, "(%s) '\n", pdfEscape(l))
+		}
+		fmt.Fprintf(&content, "ET\nBT /F1 %d Tf %d %d Td (Page %d of %d) Tj ET\n", pdfFontSize, pdfPageWidth-pdfMargin-70, pdfMargin/2, i+1, len(pages))
+		objects = append(objects,
+			fmt.Sprintf("<< /Type /Page /Parent 2 0 R /MediaBox [0 0 %d %d] /Resources << /Font << /F1 3 0 R >> >> /Contents %d 0 R >>",
+				pdfPageWidth, pdfPageHeight, 5+2*i),
+			fmt.Sprintf("<< /Length %d >>\nstream\n%sendstream", content.Len(), content.String()),
+		)
+	}
+
+	var out bytes.Buffer
+	out.WriteString("%PDF-1.4\n")
+	offsets := make([]int, len(objects))
+	for i, obj := range objects {
+		offsets[i] = out.Len()
+		fmt.Fprintf(&out, "%d 0 obj\n%s\nendobj\n", i+1, obj)
+	}
+	xref := out.Len()
+	fmt.Fprintf(&out, "xref\n0 %d\n0000000000 65535 f \n", len(objects)+1)
+	for _, off := range offsets {
+		fmt.Fprintf(&out, "%010d 00000 n \n", off)
+	}
+	fmt.Fprintf(&out, "trailer\n<< /Size %d /Root 1 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(objects)+1, xref)
+	return out.Bytes()
+}
+
+// pdfEscape encodes s as the body of a PDF string literal in WinAnsi
+func pdfEscape(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		switch {
+		case r == '(' || r == ')' || r == '\\':
+			b.WriteByte('\\')
+			b.WriteRune(r)
+		case r < 0x20 || r > 0xff:
+			b.WriteByte('?')
+		case r < 0x80:
+			b.WriteRune(r)
+		default:
+			fmt.Fprintf(&b, "\\%03o", r)
+		}
+	}
+	return b.String()
+}
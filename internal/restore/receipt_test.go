@@ -0,0 +1,127 @@
+package restore
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestRestoreReceipt(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+	setID := setupTestData(t, db)
+	svc := &Service{db: db}
+
+	// photo.jpg is deduplicated against an older set on another tape
+	db.Exec(`INSERT INTO tapes (barcode, label, pool_id, status, capacity_bytes, used_bytes) VALUES ('OLD001', 'Old Tape', 1, 'full', 1000000000, 0)`)
+	res, err := db.Exec(`INSERT INTO backup_sets (job_id, tape_id, backup_type, start_time, status) VALUES (1, 2, 'full', datetime('now', '-7 days'), 'completed')`)
+	if err != nil {
+		t.Fatalf("failed to insert backup set: %v", err)
+	}
+	refSetID, _ := res.LastInsertId()
+	db.Exec("UPDATE catalog_entries SET ref_backup_set_id = ? WHERE file_path = 'images/photo.jpg'", refSetID)
+
+	req := &RestoreRequest{
+		BackupSetID: setID,
+		FilePaths:   []string{"images/photo.jpg"},
+		FolderPaths: []string{"documents/subfolder"},
+		DestPath:    "/restore/out",
+		Verify:      true,
+	}
+	result := &RestoreResult{FilesRestored: 3, BytesRestored: 3500, Verified: true, ChecksumsVerified: 3}
+	stored, err := svc.CreateReceipt(context.Background(), ReceiptInput{
+		Request:   req,
+		Result:    result,
+		UserID:    0,
+		Username:  "auditor",
+		IPAddress: "10.0.0.5",
+		StartedAt: time.Now().Add(-time.Minute),
+	})
+	if err != nil {
+		t.Fatalf("CreateReceipt: %v", err)
+	}
+
+	receipt, err := stored.Verify()
+	if err != nil {
+		t.Fatalf("Verify: %v", err)
+	}
+	if receipt.Status != "completed" || receipt.RequestedBy.Username != "auditor" || receipt.Destination.Path != "/restore/out" {
+		t.Errorf("unexpected receipt header: %+v", receipt)
+	}
+	if !receipt.Verification.Requested || !receipt.Verification.Verified || receipt.Verification.ChecksumsVerified != 3 {
+		t.Errorf("unexpected verification: %+v", receipt.Verification)
+	}
+	if receipt.Manifest.FileCount != 3 || receipt.Manifest.TotalBytes != 3500 || len(receipt.Manifest.Files) != 3 {
+		t.Errorf("unexpected manifest: %+v", receipt.Manifest)
+	}
+	if len(receipt.BackupSets) != 2 || receipt.BackupSets[0].ID != setID || receipt.BackupSets[1].ID != refSetID {
+		t.Fatalf("expected the restored set and the referenced set, got %+v", receipt.BackupSets)
+	}
+	if receipt.BackupSets[0].FileCount != 2 || receipt.BackupSets[1].FileCount != 1 || receipt.BackupSets[1].TapeLabel != "Old Tape" {
+		t.Errorf("unexpected set breakdown: %+v", receipt.BackupSets)
+	}
+
+	// Reloading gives the same bytes and signature
+	loaded, err := svc.GetReceipt(stored.ID)
+	if err != nil {
+		t.Fatalf("GetReceipt: %v", err)
+	}
+	if !bytes.Equal(loaded.Receipt, stored.Receipt) || loaded.Signature != stored.Signature || loaded.PublicKey != stored.PublicKey {
+		t.Error("stored receipt differs from the one created")
+	}
+
+	// Any change to the content breaks the signature
+	tampered := *loaded
+	tampered.Receipt = bytes.Replace(loaded.Receipt, []byte("/restore/out"), []byte("/restore/eve"), 1)
+	if _, err := tampered.Verify(); !errors.Is(err, ErrBadReceiptSignature) {
+		t.Errorf("expected a bad signature for tampered content, got %v", err)
+	}
+
+	// A failed restore gets a receipt signed with the same key
+	failed, err := svc.CreateReceipt(context.Background(), ReceiptInput{
+		Request:   &RestoreRequest{BackupSetID: setID, DestPath: "/restore/all"},
+		Err:       errors.New("tape not ready"),
+		StartedAt: time.Now(),
+	})
+	if err != nil {
+		t.Fatalf("CreateReceipt for a failed restore: %v", err)
+	}
+	if failed.PublicKey != stored.PublicKey {
+		t.Error("expected receipts to share the signing key")
+	}
+	var rc Receipt
+	json.Unmarshal(failed.Receipt, &rc)
+	if rc.Status != "failed" || rc.Error != "tape not ready" || rc.Manifest.FileCount != 5 {
+		t.Errorf("unexpected failed receipt: status %q, error %q, %d files", rc.Status, rc.Error, rc.Manifest.FileCount)
+	}
+
+	list, err := svc.ListReceipts(setID, 10, 0)
+	if err != nil || len(list) != 2 || list[0].ID != failed.ID {
+		t.Errorf("ListReceipts = %+v, %v", list, err)
+	}
+
+	pdf, err := stored.PDF()
+	if err != nil {
+		t.Fatalf("PDF: %v", err)
+	}
+	if !bytes.HasPrefix(pdf, []byte("%PDF-1.4")) || !bytes.HasSuffix(pdf, []byte("%%EOF\n")) || !bytes.Contains(pdf, []byte(receipt.ID)) {
+		t.Error("PDF is missing its header, trailer or receipt ID")
+	}
+}
+
+func TestRenderPDFPaging(t *testing.T) {
+	lines := make([]string, pdfLinesPerPage*2+1)
+	for i := range lines {
+		lines[i] = "line (with parens) \\ and ü"
+	}
+	pdf := renderPDF(lines)
+	if !bytes.Contains(pdf, []byte("/Count 3")) {
+		t.Error("expected three pages")
+	}
+	if !bytes.Contains(pdf, []byte(`line \(with parens\) \\ and \374`)) {
+		t.Error("expected escaped text")
+	}
+}
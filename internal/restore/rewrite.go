@@ -0,0 +1,145 @@
+package restore
+
+import (
+	"fmt"
+	"path"
+	"strings"
+)
+
+// PathRewrite is a rule that moves restored files to another directory
+// tree. Rules apply in order to a file's original path on the source: a
+// path under StripPrefix has that prefix replaced with Prepend. An empty
+// StripPrefix matches every path.
+type PathRewrite struct {
+	StripPrefix string `json:"strip_prefix,omitempty"`
+	Prepend     string `json:"prepend,omitempty"`
+}
+
+// ValidatePathRewrites checks rewrite rules: both paths must be absolute
+// and a rule must change something
+func ValidatePathRewrites(rules []PathRewrite) error {
+	for i, r := range rules {
+		for _, p := range []string{r.StripPrefix, r.Prepend} {
+			if p != "" && !path.IsAbs(p) {
+				return fmt.Errorf("path_rewrites[%d]: %q is not an absolute path", i, p)
+			}
+			if strings.ContainsAny(p, "\x00\n") {
+				return fmt.Errorf("path_rewrites[%d]: invalid path %q", i, p)
+			}
+		}
+		if trimRoot(r.StripPrefix) == "" && trimRoot(r.Prepend) == "" {
+			return fmt.Errorf("path_rewrites[%d]: strip_prefix or prepend is required", i)
+		}
+	}
+	return nil
+}
+
+// trimRoot cleans an absolute path and drops the root, so "/" and "" both
+// stand for no path
+func trimRoot(p string) string {
+	if p == "" {
+		return ""
+	}
+	return strings.TrimSuffix(path.Clean(p), "/")
+}
+
+// pathRewriter maps the paths of a backup set's files to where a restore
+// with rewrite rules places them under the destination. A nil rewriter
+// leaves paths as they are.
+type pathRewriter struct {
+	// root is the source path the set was backed up from; the set's
+	// catalog paths are relative to it
+	root  string
+	rules []PathRewrite
+}
+
+// pathRewriter returns the rewriter of a restore, nil without rules
+func (s *Service) pathRewriter(req *RestoreRequest) (*pathRewriter, error) {
+	if len(req.PathRewrites) == 0 {
+		return nil, nil
+	}
+	if err := ValidatePathRewrites(req.PathRewrites); err != nil {
+		return nil, err
+	}
+	var root string
+	if err := s.db.QueryRow(`
+		SELECT COALESCE(src.path, '') FROM backup_sets bs
+		JOIN backup_jobs j ON j.id = bs.job_id
+		JOIN backup_sources src ON src.id = j.source_id
+		WHERE bs.id = ?
+	`, req.BackupSetID).Scan(&root); err != nil {
+		return nil, fmt.Errorf("failed to look up the source of backup set %d: %w", req.BackupSetID, err)
+	}
+	return &pathRewriter{root: root, rules: req.PathRewrites}, nil
+}
+
+// apply returns where a file at catalog path name is restored, relative to
+// the destination
+func (rw *pathRewriter) apply(name string) string {
+	if rw == nil {
+		return name
+	}
+	p := path.Join("/", rw.root, name)
+	for _, r := range rw.rules {
+		prefix := trimRoot(r.StripPrefix)
+		if prefix == "" {
+			p = trimRoot(r.Prepend) + p
+		} else if strings.HasPrefix(p, prefix+"/") {
+			p = trimRoot(r.Prepend) + p[len(prefix):]
+		}
+	}
+	return strings.TrimLeft(p, "/")
+}
+
+// applyAll applies the rewriter to each path
+func (rw *pathRewriter) applyAll(paths []string) []string {
+	if rw == nil {
+		return paths
+	}
+	out := make([]string, len(paths))
+	for i, p := range paths {
+		out[i] = rw.apply(p)
+	}
+	return out
+}
+
+// tarArgs returns the tar --transform expressions that rename extracted
+// files as apply does. Members are still selected by their names in the
+// archive. Symlink targets are left alone; hard link targets are renamed
+// with the files they point to.
+func (rw *pathRewriter) tarArgs() []string {
+	if rw == nil {
+		return nil
+	}
+	args := []string{"--transform", fmt.Sprintf("s,^,%s/,S", sedReplacement(trimRoot(path.Join("/", rw.root))))}
+	for _, r := range rw.rules {
+		args = append(args, "--transform", fmt.Sprintf("s,^%s/,%s/,S", sedPattern(trimRoot(r.StripPrefix)), sedReplacement(trimRoot(r.Prepend))))
+	}
+	return append(args, "--transform", "s,^/*,,S")
+}
+
+// sedPattern escapes a literal for a basic regular expression delimited by
+// commas
+func sedPattern(s string) string {
+	var b strings.Builder
+	for _, c := range s {
+		if strings.ContainsRune(`\.[]*^$,`, c) {
+			b.WriteByte('\\')
+		}
+		b.WriteRune(c)
+	}
+	return b.String()
+}
+
+// sedReplacement escapes a literal for the replacement of a substitution
+// delimited by commas
+func sedReplacement(s string) string {
+	var b strings.Builder
+	for _, c := range s {
+		if strings.ContainsRune(`\&,`, c) {
+			b.WriteByte('\\')
+		}
+		b.WriteRune(c)
+	}
+	return b.String()
+}
@@ -0,0 +1,74 @@
+package restore
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+)
+
+func TestPathRewriter(t *testing.T) {
+	rw := &pathRewriter{root: "/mnt/nas/share", rules: []PathRewrite{
+		{StripPrefix: "/mnt/nas", Prepend: "/restore/2024"},
+		{StripPrefix: "/restore/2024/share/old stuff", Prepend: "/archive"},
+	}}
+	tests := map[string]string{
+		"docs/a.txt":          "restore/2024/share/docs/a.txt",
+		"old stuff/b.txt":     "archive/b.txt",
+		"old stuffing/c.txt":  "restore/2024/share/old stuffing/c.txt",
+		"odd,name & co/d.txt": "restore/2024/share/odd,name & co/d.txt",
+	}
+	for name, want := range tests {
+		if got := rw.apply(name); got != want {
+			t.Errorf("apply(%q) = %q, want %q", name, got, want)
+		}
+	}
+	if got := (*pathRewriter)(nil).apply("docs/a.txt"); got != "docs/a.txt" {
+		t.Errorf("expected no rules to leave the path alone, got %q", got)
+	}
+	prepend := &pathRewriter{root: "/srv", rules: []PathRewrite{{Prepend: "/copy"}}}
+	if got := prepend.apply("x/y"); got != "copy/srv/x/y" {
+		t.Errorf("expected a prepend-only rule to apply to every path, got %q", got)
+	}
+
+	// tar places the files where apply says
+	if _, err := exec.LookPath("tar"); err != nil {
+		t.Skip("tar not available")
+	}
+	src := t.TempDir()
+	for name := range tests {
+		os.MkdirAll(filepath.Join(src, filepath.Dir(name)), 0755)
+		os.WriteFile(filepath.Join(src, name), []byte(name), 0644)
+	}
+	archive := filepath.Join(t.TempDir(), "set.tar")
+	names := []string{"docs/a.txt", "old stuff/b.txt", "old stuffing/c.txt", "odd,name & co/d.txt"}
+	if out, err := exec.Command("tar", append([]string{"-cf", archive, "-C", src}, names...)...).CombinedOutput(); err != nil {
+		t.Fatalf("tar create: %v %s", err, out)
+	}
+	dest := t.TempDir()
+	args := append([]string{"-xf", archive, "-C", dest}, rw.tarArgs()...)
+	if out, err := exec.Command("tar", append(args, names...)...).CombinedOutput(); err != nil {
+		t.Fatalf("tar extract: %v %s", err, out)
+	}
+	for name, want := range tests {
+		if data, err := os.ReadFile(filepath.Join(dest, want)); err != nil || string(data) != name {
+			t.Errorf("expected %s extracted to %s: %v", name, want, err)
+		}
+	}
+}
+
+func TestValidatePathRewrites(t *testing.T) {
+	if err := ValidatePathRewrites([]PathRewrite{{StripPrefix: "/mnt/nas", Prepend: "/restore"}, {Prepend: "/x"}}); err != nil {
+		t.Errorf("expected valid rules, got %v", err)
+	}
+	for _, rules := range [][]PathRewrite{
+		{{StripPrefix: "mnt/nas"}},
+		{{Prepend: "restore"}},
+		{{}},
+		{{StripPrefix: "/", Prepend: "/"}},
+	} {
+		if err := ValidatePathRewrites(rules); err == nil {
+			t.Errorf("expected %+v to be rejected", rules)
+		}
+	}
+}
@@ -1,23 +1,33 @@
 package restore
 
 import (
+	"bufio"
 	"bytes"
 	"context"
 	"crypto/sha256"
+	"database/sql"
 	"encoding/base64"
 	"encoding/hex"
+	"errors"
 	"fmt"
 	"io"
 	"os"
 	"os/exec"
 	"path/filepath"
 	"strings"
+	"sync/atomic"
+	"syscall"
 	"time"
 
 	"github.com/RoseOO/TapeBackarr/internal/cmdutil"
+	"github.com/RoseOO/TapeBackarr/internal/credentials"
 	"github.com/RoseOO/TapeBackarr/internal/database"
+	"github.com/RoseOO/TapeBackarr/internal/encryption"
+	"github.com/RoseOO/TapeBackarr/internal/library"
 	"github.com/RoseOO/TapeBackarr/internal/logging"
 	"github.com/RoseOO/TapeBackarr/internal/models"
+	"github.com/RoseOO/TapeBackarr/internal/scratch"
+	"github.com/RoseOO/TapeBackarr/internal/stages"
 	"github.com/RoseOO/TapeBackarr/internal/tape"
 )
 
@@ -27,10 +37,29 @@ type RestoreRequest struct {
 	FilePaths       []string `json:"file_paths,omitempty"`   // Empty means restore all
 	FolderPaths     []string `json:"folder_paths,omitempty"` // Folders to restore (includes subfolders)
 	DestPath        string   `json:"dest_path"`
-	DestinationType string   `json:"destination_type"` // local, smb, nfs
+	DestinationType string   `json:"destination_type"`    // local, smb, nfs, ssh
+	TargetID        *int64   `json:"target_id,omitempty"` // Saved remote target; DestPath is then relative to it
 	Verify          bool     `json:"verify"`
 	Overwrite       bool     `json:"overwrite"`
 	DriveID         *int64   `json:"drive_id,omitempty"` // Tape drive to use for restore
+	// EncryptionKey is a base64 key entered at restore time (e.g. from the
+	// printed key sheet). It is used for this restore only and never stored.
+	EncryptionKey string `json:"encryption_key,omitempty"`
+	// RateLimitMBps caps how fast the restore writes, in MB/s. Unset uses
+	// the configured default; 0 means unlimited.
+	RateLimitMBps *int `json:"rate_limit_mbps,omitempty"`
+	// Priority lets the restore stop backup runs of jobs with a lower
+	// priority that hold the drive it needs. They resume afterwards.
+	Priority int `json:"priority,omitempty"`
+	// PathRewrites move the restored files to another directory tree, e.g.
+	// stripping /mnt/nas and prepending /restore/2024, under DestPath
+	PathRewrites []PathRewrite `json:"path_rewrites,omitempty"`
+	// ByteRange restores only part of the single file in FilePaths, or
+	// resumes an interrupted restore of it
+	ByteRange *ByteRange `json:"byte_range,omitempty"`
+
+	// skipRefs is set on the per-set restores issued by restoreWithRefs
+	skipRefs bool
 }
 
 // RestoreResult represents the result of a restore operation
@@ -42,6 +71,17 @@ type RestoreResult struct {
 	EndTime         time.Time `json:"end_time"`
 	Errors          []string  `json:"errors,omitempty"`
 	Verified        bool      `json:"verified"`
+	// ChecksumsVerified counts restored files whose SHA256 matched the catalog
+	ChecksumsVerified int64 `json:"checksums_verified,omitempty"`
+	// ReceiptID identifies the signed restore receipt, when one was stored
+	ReceiptID string `json:"receipt_id,omitempty"`
+	// BlockSize is the block size the tape was read with, 0 for variable
+	// block mode
+	BlockSize int `json:"block_size"`
+	// LogMessages records how the drive was set up to read the tape
+	LogMessages []string `json:"log_messages,omitempty"`
+	// PartialFile reports how far a byte range restore got
+	PartialFile *PartialFile `json:"partial_file,omitempty"`
 }
 
 // TapeRequirement describes a tape needed for restore
@@ -72,6 +112,12 @@ type Service struct {
 	logger      *logging.Logger
 	blockSize   int
 	notifier    NotificationSender
+	scratch     *scratch.Dir
+	credentials atomic.Pointer[credentials.Store] // replaced by replication
+	library     *library.Loader
+	// rateLimitMBps is the restore bandwidth limit of requests without
+	// their own, 0 for unlimited
+	rateLimitMBps int
 }
 
 // NewService creates a new restore service
@@ -89,6 +135,30 @@ func (s *Service) SetNotifier(n NotificationSender) {
 	s.notifier = n
 }
 
+// SetCredentials sets the store that restore targets referencing a stored
+// credential take their secret from.
+func (s *Service) SetCredentials(store *credentials.Store) {
+	s.credentials.Store(store)
+}
+
+// SetScratchDir sets the directory used for remote target mount points,
+// SSH staging and credential files.
+func (s *Service) SetScratchDir(d *scratch.Dir) {
+	s.scratch = d
+}
+
+// SetLibraryLoader lets restores load tapes that sit in a tape library
+// instead of requiring them to be in a drive already.
+func (s *Service) SetLibraryLoader(l *library.Loader) {
+	s.library = l
+}
+
+// SetRateLimit sets the default restore bandwidth limit in MB/s. Requests
+// may set their own; 0 means unlimited.
+func (s *Service) SetRateLimit(mbps int) {
+	s.rateLimitMBps = mbps
+}
+
 // buildDecompressionCmd returns the exec.Cmd for the given compression type.
 // For gzip it uses pigz (parallel gzip) with -d when available,
 // falling back to gzip -d. For zstd it uses automatic multi-threading.
@@ -106,6 +176,49 @@ func buildDecompressionCmd(ctx context.Context, compression models.CompressionTy
 	}
 }
 
+// feedStream copies r into w (the stdin of a pipeline stage) in the
+// background and closes w when done. The returned channel receives the
+// copy error, if any.
+func feedStream(w io.WriteCloser, r io.Reader) <-chan error {
+	done := make(chan error, 1)
+	go func() {
+		_, err := io.Copy(w, r)
+		w.Close()
+		done <- err
+	}()
+	return done
+}
+
+// stageCutOff reports whether a stage of a restore pipeline failed only
+// because the stage it feeds had already exited, as tar does once it reaches
+// the end of the archive. stderr is the stage's captured output, or nil for
+// an in-process stage. Any other error, such as a chunk that fails to
+// decrypt, means the stream was cut short.
+func stageCutOff(err error, stderr *bytes.Buffer) bool {
+	if errors.Is(err, syscall.EPIPE) || errors.Is(err, io.ErrClosedPipe) || errors.Is(err, os.ErrClosed) {
+		return true
+	}
+	// A decompressor writing to a closed pipe dies of SIGPIPE or reports it
+	if strings.Contains(err.Error(), "broken pipe") {
+		return true
+	}
+	return stderr != nil && strings.Contains(strings.ToLower(stderr.String()), "broken pipe")
+}
+
+// tarArchiveSource returns the archive argument for tar -f. A physical
+// drive is opened by tar itself; virtual backends are streamed to tar's
+// stdin through the returned reader, which the caller must close.
+func tarArchiveSource(ctx context.Context, driveSvc *tape.Service) (string, io.ReadCloser, error) {
+	if driveSvc.IsPhysical() {
+		return driveSvc.DevicePath(), nil, nil
+	}
+	r, err := driveSvc.OpenReader(ctx)
+	if err != nil {
+		return "", nil, err
+	}
+	return "-", r, nil
+}
+
 // restorePipeline returns a label describing which restore pipeline will
 // be used for a backup set with the given flags.  It also returns an error
 // when the flag combination is invalid (e.g. encrypted without a key).
@@ -164,15 +277,48 @@ func (s *Service) GetRequiredTapes(ctx context.Context, req *RestoreRequest) ([]
 			TotalBytes: totalBytes,
 			Order:      1,
 		})
+
+		// Deduplicated files also need the tapes of the sets holding their data
+		refRows, err := s.db.Query(`
+			SELECT t.id, t.barcode, t.label, t.status, COUNT(*), SUM(ce.file_size)
+			FROM catalog_entries ce
+			JOIN backup_sets bs ON ce.ref_backup_set_id = bs.id
+			JOIN tapes t ON bs.tape_id = t.id
+			WHERE ce.backup_set_id = ?
+			GROUP BY t.id
+			ORDER BY t.label
+		`, req.BackupSetID)
+		if err != nil {
+			return nil, err
+		}
+		defer refRows.Close()
+		for refRows.Next() {
+			var rt models.Tape
+			var refFiles, refBytes int64
+			if err := refRows.Scan(&rt.ID, &rt.Barcode, &rt.Label, &rt.Status, &refFiles, &refBytes); err != nil {
+				continue
+			}
+			if rt.ID == t.ID {
+				requirements[0].FileCount += int(refFiles)
+				requirements[0].TotalBytes += refBytes
+				continue
+			}
+			requirements = append(requirements, TapeRequirement{
+				Tape:       rt,
+				FileCount:  int(refFiles),
+				TotalBytes: refBytes,
+				Order:      len(requirements) + 1,
+			})
+		}
 	} else {
 		// Restore specific files - find which tapes they're on
 		for _, filePath := range allFilePaths {
 			rows, err := s.db.Query(`
 				SELECT DISTINCT t.id, t.barcode, t.label, t.status, ce.file_size
 				FROM catalog_entries ce
-				JOIN backup_sets bs ON ce.backup_set_id = bs.id
+				JOIN backup_sets bs ON COALESCE(ce.ref_backup_set_id, ce.backup_set_id) = bs.id
 				JOIN tapes t ON bs.tape_id = t.id
-				WHERE ce.file_path = ? AND bs.id = ?
+				WHERE ce.file_path = ? AND ce.backup_set_id = ?
 				ORDER BY bs.start_time DESC
 				LIMIT 1
 			`, filePath, req.BackupSetID)
@@ -210,6 +356,31 @@ func (s *Service) GetRequiredTapes(ctx context.Context, req *RestoreRequest) ([]
 	return requirements, nil
 }
 
+// checkExternalKey validates a key entered at restore time and checks it
+// against the key fingerprint recorded for the backup set, so a wrong key is
+// rejected before the tape is positioned. It returns the canonical base64 key.
+func (s *Service) checkExternalKey(input string, encryptionKeyID *int64, tapeID int64) (string, error) {
+	keyBase64, err := encryption.NormalizeKey(input)
+	if err != nil {
+		return "", fmt.Errorf("invalid encryption key: %w", err)
+	}
+	key, _ := encryption.DecodeKey(keyBase64)
+
+	// Prefer the keystore record; fall back to the fingerprint tracked on
+	// the tape when the key was never imported on this server.
+	var expected string
+	if encryptionKeyID != nil {
+		s.db.QueryRow("SELECT key_fingerprint FROM encryption_keys WHERE id = ?", *encryptionKeyID).Scan(&expected)
+	}
+	if expected == "" {
+		s.db.QueryRow("SELECT COALESCE(encryption_key_fingerprint, '') FROM tapes WHERE id = ?", tapeID).Scan(&expected)
+	}
+	if expected != "" && expected != encryption.KeyFingerprint(key) {
+		return "", fmt.Errorf("%w (backup key fingerprint %s)", encryption.ErrKeyMismatch, expected)
+	}
+	return keyBase64, nil
+}
+
 // resolveDriveDevicePath determines the tape device path for the restore.
 // When req.DriveID is set the user explicitly selected a drive; otherwise
 // the drive is looked up by the tape that is currently loaded.
@@ -237,6 +408,57 @@ func (s *Service) resolveDriveDevicePath(req *RestoreRequest, tapeID int64) (str
 	return devicePath, nil
 }
 
+// driveForTape resolves the drive to restore from like
+// resolveDriveDevicePath. A tape that is not in that drive, or in any drive
+// when none was selected, is loaded from its library slot when it sits in
+// one.
+func (s *Service) driveForTape(ctx context.Context, req *RestoreRequest, tapeID int64) (string, error) {
+	devicePath, err := s.resolveDriveDevicePath(req, tapeID)
+	if s.library == nil || (req.DriveID != nil && err != nil) {
+		return devicePath, err
+	}
+	if err == nil {
+		var current sql.NullInt64
+		s.db.QueryRow("SELECT current_tape_id FROM tape_drives WHERE device_path = ?", devicePath).Scan(&current)
+		if current.Int64 == tapeID || !s.library.InLibrary(tapeID) {
+			return devicePath, nil
+		}
+	}
+
+	load, loadErr := s.library.Load(ctx, tapeID, library.Request{DevicePath: devicePath})
+	if loadErr != nil {
+		if err == nil {
+			// The tape may have been inserted by hand; the label check
+			// finds out
+			s.logger.Warn("Failed to load tape from library", map[string]interface{}{
+				"tape_id": tapeID, "device_path": devicePath, "error": loadErr.Error(),
+			})
+			return devicePath, nil
+		}
+		if errors.Is(loadErr, library.ErrNotInLibrary) {
+			return "", err
+		}
+		return "", fmt.Errorf("%v, and loading it from the library failed: %w", err, loadErr)
+	}
+	return load.DevicePath, nil
+}
+
+// checkDriveCanRead rejects restores from a drive whose LTO generation cannot
+// read the tape, e.g. LTO-6 media in an LTO-9 drive. Unknown generations pass.
+func (s *Service) checkDriveCanRead(devicePath string, tapeID int64) error {
+	var model, ltoType string
+	s.db.QueryRow("SELECT COALESCE(model, '') FROM tape_drives WHERE device_path = ?", devicePath).Scan(&model)
+	s.db.QueryRow("SELECT COALESCE(lto_type, '') FROM tapes WHERE id = ?", tapeID).Scan(&ltoType)
+	driveType, ok := models.LTOTypeFromDriveModel(model)
+	if !ok {
+		return nil
+	}
+	if err := models.CheckLTOCompatibility(driveType, ltoType, false); err != nil {
+		return fmt.Errorf("cannot restore with drive %s: %w", devicePath, err)
+	}
+	return nil
+}
+
 // waitForCorrectTape verifies that the correct tape is loaded in the drive.
 // It reads the tape label and compares it to the expected label. If the wrong
 // tape is loaded it sends a notification and polls until the correct tape
@@ -276,8 +498,73 @@ func (s *Service) waitForCorrectTape(ctx context.Context, driveSvc *tape.Service
 	}
 }
 
-// Restore performs a restore operation
+// positionAtSet positions the tape head at the start of the backup data.
+// The data lives at file number 1 (after the label at file 0 and its file
+// mark). If start_block is recorded an absolute seek is tried first, falling
+// back to file-based positioning on failure.
+func (s *Service) positionAtSet(ctx context.Context, driveSvc *tape.Service, startBlock int64) error {
+	if startBlock > 0 {
+		if err := driveSvc.SeekToBlock(ctx, startBlock); err != nil {
+			s.logger.Warn("Failed to seek to block, falling back to file-based seek", map[string]interface{}{
+				"start_block": startBlock,
+				"error":       err.Error(),
+			})
+			// Fall back to seeking by file number
+			if err := driveSvc.SeekToFileNumber(ctx, 1); err != nil {
+				return fmt.Errorf("failed to position tape: %w", err)
+			}
+		}
+		return nil
+	}
+	// No recorded start block — seek past the label to file 1
+	if err := driveSvc.SeekToFileNumber(ctx, 1); err != nil {
+		return fmt.Errorf("failed to seek past tape label: %w", err)
+	}
+	return nil
+}
+
+// Restore performs a restore operation. When req.TargetID is set the files
+// are delivered to the saved remote target instead of a local path.
 func (s *Service) Restore(ctx context.Context, req *RestoreRequest) (*RestoreResult, error) {
+	// Images a NAS wrote over NDMP are in its own format (dump, tar, ...)
+	// and can only be restored through the NAS
+	var ndmpType string
+	if err := s.db.QueryRow("SELECT ndmp_type FROM backup_sets WHERE id = ?", req.BackupSetID).Scan(&ndmpType); err == nil && ndmpType != "" {
+		return nil, fmt.Errorf("backup set %d is an NDMP %s image; restoring NDMP backups is not supported yet", req.BackupSetID, ndmpType)
+	}
+
+	if req.TargetID == nil {
+		if models.RestoreDestinationType(req.DestinationType).IsRemote() {
+			return nil, fmt.Errorf("target_id is required for %s destinations", req.DestinationType)
+		}
+		return s.restoreToPath(ctx, req, req.DestPath, req.DestPath)
+	}
+
+	dest, err := s.openRemoteDestination(ctx, *req.TargetID, req.BackupSetID, req.DestPath)
+	if err != nil {
+		return nil, err
+	}
+	defer dest.Close(context.Background())
+	// SSH restores are staged and copied whole, so a range would replace
+	// the remote file with a partial one
+	if req.ByteRange != nil && dest.target.TargetType == models.RestoreDestSSH {
+		return nil, fmt.Errorf("byte_range is not supported for ssh targets")
+	}
+
+	result, err := s.restoreToPath(ctx, req, dest.LocalPath, dest.Description)
+	if err != nil {
+		return result, err
+	}
+	if err := dest.Deliver(ctx); err != nil {
+		result.Errors = append(result.Errors, err.Error())
+		return result, fmt.Errorf("failed to deliver restore to %s: %w", dest.Description, err)
+	}
+	return result, nil
+}
+
+// restoreToPath extracts a backup set into the local directory destPath.
+// destLabel is how the destination is reported in logs and the audit trail.
+func (s *Service) restoreToPath(ctx context.Context, req *RestoreRequest, destPath, destLabel string) (*RestoreResult, error) {
 	result := &RestoreResult{
 		StartTime: time.Now(),
 	}
@@ -294,10 +581,28 @@ func (s *Service) Restore(ctx context.Context, req *RestoreRequest) (*RestoreRes
 		allFilePaths = append(allFilePaths, folderFiles...)
 		result.FoldersRestored = len(req.FolderPaths)
 	}
+	rw, err := s.pathRewriter(req)
+	if err != nil {
+		return nil, err
+	}
+	if req.ByteRange != nil {
+		return s.restoreRange(ctx, req, destPath, destLabel, rw)
+	}
+
+	// Deduplicated files are read from the sets holding their data
+	if !req.skipRefs {
+		refs, err := s.lookupDedupRefs(req.BackupSetID, allFilePaths)
+		if err != nil {
+			return nil, fmt.Errorf("failed to look up deduplicated files: %w", err)
+		}
+		if len(refs) > 0 {
+			return s.restoreWithRefs(ctx, req, destPath, destLabel, allFilePaths, refs, rw)
+		}
+	}
 
 	s.logger.Info("Starting restore", map[string]interface{}{
 		"backup_set_id": req.BackupSetID,
-		"dest_path":     req.DestPath,
+		"dest_path":     destLabel,
 		"file_count":    len(allFilePaths),
 		"folder_count":  len(req.FolderPaths),
 	})
@@ -311,21 +616,44 @@ func (s *Service) Restore(ctx context.Context, req *RestoreRequest) (*RestoreRes
 	var hwEncryptionKeyID *int64
 	var compressed bool
 	var compressionType string
-	err := s.db.QueryRow(`
-		SELECT tape_id, COALESCE(start_block, 0), COALESCE(encrypted, 0), encryption_key_id,
+	var encFormat, encKDF, encSalt, encIV string
+	var encChunkSize int
+	var streamStages sql.NullString
+	var recordedBlockSize int
+	err = s.db.QueryRow(`
+		SELECT tape_id, COALESCE(start_block, 0), block_size, COALESCE(encrypted, 0), encryption_key_id,
 		       COALESCE(hw_encrypted, 0), hw_encryption_key_id,
-		       COALESCE(compressed, 0), COALESCE(compression_type, 'none')
+		       COALESCE(compressed, 0), COALESCE(compression_type, 'none'),
+		       encryption_format, encryption_kdf, encryption_salt, encryption_iv, encryption_chunk_size,
+		       stream_stages
 		FROM backup_sets 
 		WHERE id = ?
-	`, req.BackupSetID).Scan(&tapeID, &startBlock, &encrypted, &encryptionKeyID,
-		&hwEncrypted, &hwEncryptionKeyID, &compressed, &compressionType)
+	`, req.BackupSetID).Scan(&tapeID, &startBlock, &recordedBlockSize, &encrypted, &encryptionKeyID,
+		&hwEncrypted, &hwEncryptionKeyID, &compressed, &compressionType,
+		&encFormat, &encKDF, &encSalt, &encIV, &encChunkSize, &streamStages)
 	if err != nil {
 		return nil, fmt.Errorf("backup set not found: %w", err)
 	}
+	applied, err := stages.Parse(streamStages)
+	if err != nil {
+		return nil, err
+	}
+	// Recorded encryption parameters are checked against the header on tape;
+	// sets written before they were recorded rely on the header alone.
+	encMeta := models.ParseEncryptionMetadata(encFormat, encKDF, encSalt, encIV, encChunkSize)
 
-	// Get encryption key if backup is encrypted
+	// Get encryption key if backup is encrypted. A key supplied with the
+	// request takes precedence over the keystore.
 	var encryptionKey string
-	if encrypted && encryptionKeyID != nil {
+	if encrypted && req.EncryptionKey != "" {
+		encryptionKey, err = s.checkExternalKey(req.EncryptionKey, encryptionKeyID, tapeID)
+		if err != nil {
+			return nil, err
+		}
+		s.logger.Info("Decrypting backup with externally supplied key", map[string]interface{}{
+			"backup_set_id": req.BackupSetID,
+		})
+	} else if encrypted && encryptionKeyID != nil {
 		err = s.db.QueryRow("SELECT key_data FROM encryption_keys WHERE id = ?", *encryptionKeyID).Scan(&encryptionKey)
 		if err != nil {
 			return nil, fmt.Errorf("encryption key not found for encrypted backup: %w", err)
@@ -337,14 +665,17 @@ func (s *Service) Restore(ctx context.Context, req *RestoreRequest) (*RestoreRes
 
 	// Validate: if the backup is marked encrypted we must have a key.
 	if encrypted && encryptionKey == "" {
-		return nil, fmt.Errorf("backup set is marked as encrypted but no encryption key is available")
+		return nil, fmt.Errorf("backup set is marked as encrypted but no encryption key is available; supply encryption_key from the key sheet")
 	}
 
 	// --- Step 1: Resolve drive and device path ---
-	devicePath, err := s.resolveDriveDevicePath(req, tapeID)
+	devicePath, err := s.driveForTape(ctx, req, tapeID)
 	if err != nil {
 		return nil, err
 	}
+	if err := s.checkDriveCanRead(devicePath, tapeID); err != nil {
+		return nil, err
+	}
 
 	// Create a drive-specific tape service for all tape operations
 	driveSvc := tape.NewServiceForDevice(devicePath, s.blockSize)
@@ -397,40 +728,43 @@ func (s *Service) Restore(ctx context.Context, req *RestoreRequest) (*RestoreRes
 	}
 
 	// --- Step 4: Ensure destination exists ---
-	if err := os.MkdirAll(req.DestPath, 0755); err != nil {
+	if err := os.MkdirAll(destPath, 0755); err != nil {
 		return nil, fmt.Errorf("failed to create destination directory: %w", err)
 	}
 
 	// --- Step 5: Position tape ---
 	// The tape label was already read (and the tape rewound) during verification.
-	// We now need to position the tape head at the start of the backup data.
-	// The data lives at file number 1 (after the label at file 0 and its file mark).
-	// If start_block is recorded we try an absolute seek first, falling back to
-	// file-based positioning on failure.
-	if startBlock > 0 {
-		if err := driveSvc.SeekToBlock(ctx, startBlock); err != nil {
-			s.logger.Warn("Failed to seek to block, falling back to file-based seek", map[string]interface{}{
-				"start_block": startBlock,
-				"error":       err.Error(),
-			})
-			// Fall back to seeking by file number
-			if err := driveSvc.SeekToFileNumber(ctx, 1); err != nil {
-				return nil, fmt.Errorf("failed to position tape: %w", err)
-			}
-		}
-	} else {
-		// No recorded start block — seek past the label to file 1
-		if err := driveSvc.SeekToFileNumber(ctx, 1); err != nil {
-			return nil, fmt.Errorf("failed to seek past tape label: %w", err)
-		}
+	if err := s.positionAtSet(ctx, driveSvc, startBlock); err != nil {
+		return nil, err
+	}
+
+	// --- Step 6: Set the drive to a block size that reads the set ---
+	// A drive left at another block size fails or crawls through the reads
+	readSize, err := s.setReadBlockSize(ctx, driveSvc, recordedBlockSize, func(ctx context.Context) error {
+		return s.positionAtSet(ctx, driveSvc, startBlock)
+	}, func(msg string) {
+		result.LogMessages = append(result.LogMessages, fmt.Sprintf("[%s] %s", time.Now().Format("15:04:05"), msg))
+		s.logger.Info(msg, map[string]interface{}{"backup_set_id": req.BackupSetID})
+	})
+	if err != nil {
+		return nil, err
+	}
+	result.BlockSize = readSize
+
+	// Extraction reads no faster than the restore may write
+	rateLimit := s.rateLimit(req)
+	if rateLimit > 0 {
+		msg := fmt.Sprintf("Restore limited to %d MB/s", rateLimit>>20)
+		result.LogMessages = append(result.LogMessages, fmt.Sprintf("[%s] %s", time.Now().Format("15:04:05"), msg))
+		s.logger.Info(msg, map[string]interface{}{"backup_set_id": req.BackupSetID})
 	}
 
-	// --- Step 6: Build tar extract command and execute pipeline ---
-	// tar -b expects count of 512-byte blocks to match the block size used during backup
+	// --- Step 7: Build tar extract command and execute pipeline ---
+	// tar -b expects count of 512-byte blocks to match the block size on tape
 	tarArgs := []string{
-		"-x",                                     // Extract
-		"-b", fmt.Sprintf("%d", s.blockSize/512), // Block size in 512-byte units (must match backup)
-		"-C", req.DestPath, // Change to destination
+		"-x",                              // Extract
+		"-b", tarBlockingFactor(readSize), // Block size in 512-byte units (must match the tape)
+		"-C", destPath, // Change to destination
 	}
 
 	if req.Overwrite {
@@ -438,33 +772,48 @@ func (s *Service) Restore(ctx context.Context, req *RestoreRequest) (*RestoreRes
 	} else {
 		tarArgs = append(tarArgs, "--keep-old-files")
 	}
+	tarArgs = append(tarArgs, rw.tarArgs()...)
 
 	// Add specific files if requested
 	if len(allFilePaths) > 0 {
 		tarArgs = append(tarArgs, allFilePaths...)
 	}
 
-	if encrypted && compressed {
-		// For compressed+encrypted backups: tape -> openssl dec -> decompress -> tar
+	if len(applied) > 0 {
+		// Sets written through stream stages: the stages are reversed
+		// after decryption and decompression
+		s.logger.Info("Using stream stage restore pipeline", map[string]interface{}{
+			"stages":           stages.Names(applied),
+			"compression_type": compressionType,
+		})
+		var decompression string
+		if compressed {
+			decompression = compressionType
+		}
+		if err := s.extractStaged(ctx, driveSvc, readSize, tarArgs, applied, encryptionKey, encMeta, decompression, rateLimit); err != nil {
+			errMsg := err.Error()
+			result.Errors = append(result.Errors, errMsg)
+			s.logger.Error("Restore failed", map[string]interface{}{"error": errMsg})
+			return result, fmt.Errorf("restore failed: %s", errMsg)
+		}
+	} else if encrypted && compressed {
+		// For compressed+encrypted backups: tape -> decrypt -> decompress -> tar
 		s.logger.Info("Using encrypted+compressed restore pipeline", map[string]interface{}{
 			"compression_type": compressionType,
 		})
 
-		// Open tape device for reading and feed data into the pipeline
-		tapeFile, err := os.Open(devicePath)
+		// Open tape device for reading and check the encryption header
+		// before starting the pipeline, so a wrong key fails immediately
+		tapeFile, err := driveSvc.OpenReader(ctx)
 		if err != nil {
 			return nil, fmt.Errorf("failed to open tape device: %w", err)
 		}
 		defer tapeFile.Close()
 
-		opensslCmd := exec.CommandContext(ctx, "openssl", "enc",
-			"-d", // Decrypt
-			"-aes-256-cbc",
-			"-pbkdf2",
-			"-iter", "100000",
-			"-pass", "pass:"+encryptionKey,
-		)
-		opensslCmd.Stdin = tapeFile
+		decReader, err := encryption.NewBackupDecryptingReader(bufio.NewReaderSize(tapeFile, readSize), encryptionKey, encMeta)
+		if err != nil {
+			return nil, fmt.Errorf("failed to start decryption: %w", err)
+		}
 
 		decompCmd, err := buildDecompressionCmd(ctx, models.CompressionType(compressionType))
 		if err != nil {
@@ -474,110 +823,102 @@ func (s *Service) Restore(ctx context.Context, req *RestoreRequest) (*RestoreRes
 		tarCmd := exec.CommandContext(ctx, "tar", tarArgs...)
 
 		// Capture stderr from each pipeline stage for diagnostics
-		var opensslStderr, decompStderr, tarStderr bytes.Buffer
-		opensslCmd.Stderr = &opensslStderr
+		var decompStderr, tarStderr bytes.Buffer
 		decompCmd.Stderr = &decompStderr
 		tarCmd.Stderr = &tarStderr
 
-		// Pipeline: tape -> openssl -> decompress -> tar
-		opensslPipe, err := opensslCmd.StdoutPipe()
+		// Pipeline: tape -> decrypt -> decompress -> tar
+		decompStdin, err := decompCmd.StdinPipe()
 		if err != nil {
-			return nil, fmt.Errorf("failed to create openssl pipe: %w", err)
+			return nil, fmt.Errorf("failed to create decompression pipe: %w", err)
 		}
-		decompCmd.Stdin = opensslPipe
-
 		decompPipe, err := decompCmd.StdoutPipe()
 		if err != nil {
 			return nil, fmt.Errorf("failed to create decompression pipe: %w", err)
 		}
-		tarCmd.Stdin = decompPipe
+		tarCmd.Stdin = throttle(ctx, decompPipe, rateLimit)
 
-		if err := opensslCmd.Start(); err != nil {
-			return nil, fmt.Errorf("failed to start openssl: %w", err)
-		}
 		if err := decompCmd.Start(); err != nil {
-			opensslCmd.Process.Kill()
 			return nil, fmt.Errorf("failed to start decompression: %w", err)
 		}
 		if err := tarCmd.Start(); err != nil {
-			opensslCmd.Process.Kill()
 			decompCmd.Process.Kill()
 			return nil, fmt.Errorf("failed to start tar: %w", err)
 		}
+		decryptDone := feedStream(decompStdin, decReader)
 
 		// Wait for downstream (tar) first. When tar finishes a selective
-		// restore it closes its stdin, which may cause upstream processes
-		// (decompressor / openssl) to receive SIGPIPE and exit non-zero.
-		// That is expected – only treat upstream errors as failures when
-		// tar itself also failed.
+		// restore it closes its stdin, which may cause upstream stages
+		// (decompressor / decryption) to fail with a broken pipe.
+		// That is expected once tar has succeeded; any other upstream
+		// error means tar may have seen a cut-off stream and fails the
+		// restore even when tar itself did not notice.
 		tarErr := tarCmd.Wait()
 		decompErr := decompCmd.Wait()
-		opensslErr := opensslCmd.Wait()
+		decryptErr := <-decryptDone
 
+		var problems []string
 		if tarErr != nil {
-			errMsg := fmt.Sprintf("tar extract failed (%s)", cmdutil.ErrorDetail(tarErr, &tarStderr))
-			if decompErr != nil {
-				errMsg += fmt.Sprintf("; decompression failed (%s)", cmdutil.ErrorDetail(decompErr, &decompStderr))
-			}
-			if opensslErr != nil {
-				errMsg += fmt.Sprintf("; decryption failed (%s)", cmdutil.ErrorDetail(opensslErr, &opensslStderr))
-			}
+			problems = append(problems, fmt.Sprintf("tar extract failed (%s)", cmdutil.ErrorDetail(tarErr, &tarStderr)))
+		}
+		if decompErr != nil && (tarErr != nil || !stageCutOff(decompErr, &decompStderr)) {
+			problems = append(problems, fmt.Sprintf("decompression failed (%s)", cmdutil.ErrorDetail(decompErr, &decompStderr)))
+		}
+		if decryptErr != nil && (tarErr != nil || !stageCutOff(decryptErr, nil)) {
+			problems = append(problems, fmt.Sprintf("decryption failed (%s)", decryptErr))
+		}
+		if len(problems) > 0 {
+			errMsg := strings.Join(problems, "; ")
 			result.Errors = append(result.Errors, errMsg)
 			s.logger.Error("Restore failed", map[string]interface{}{"error": errMsg})
 			return result, fmt.Errorf("restore failed: %s", errMsg)
 		}
 	} else if encrypted {
-		// For encrypted-only backups (no compression): tape -> openssl dec -> tar
+		// For encrypted-only backups (no compression): tape -> decrypt -> tar
 		s.logger.Info("Using encrypted-only restore pipeline", nil)
 
-		// Open tape device for reading and feed data into the pipeline
-		tapeFile, err := os.Open(devicePath)
+		// Open tape device for reading and check the encryption header
+		tapeFile, err := driveSvc.OpenReader(ctx)
 		if err != nil {
 			return nil, fmt.Errorf("failed to open tape device: %w", err)
 		}
 		defer tapeFile.Close()
 
-		opensslCmd := exec.CommandContext(ctx, "openssl", "enc",
-			"-d", // Decrypt
-			"-aes-256-cbc",
-			"-pbkdf2",
-			"-iter", "100000",
-			"-pass", "pass:"+encryptionKey,
-		)
-		opensslCmd.Stdin = tapeFile
+		decReader, err := encryption.NewBackupDecryptingReader(bufio.NewReaderSize(tapeFile, readSize), encryptionKey, encMeta)
+		if err != nil {
+			return nil, fmt.Errorf("failed to start decryption: %w", err)
+		}
 
 		tarCmd := exec.CommandContext(ctx, "tar", tarArgs...)
 
-		// Capture stderr from each pipeline stage for diagnostics
-		var opensslStderr, tarStderr bytes.Buffer
-		opensslCmd.Stderr = &opensslStderr
+		// Capture stderr for diagnostics
+		var tarStderr bytes.Buffer
 		tarCmd.Stderr = &tarStderr
 
-		// Pipe openssl output to tar
-		opensslPipe, err := opensslCmd.StdoutPipe()
+		tarStdin, err := tarCmd.StdinPipe()
 		if err != nil {
-			return nil, fmt.Errorf("failed to create openssl pipe: %w", err)
+			return nil, fmt.Errorf("failed to create tar pipe: %w", err)
 		}
-		tarCmd.Stdin = opensslPipe
 
-		if err := opensslCmd.Start(); err != nil {
-			return nil, fmt.Errorf("failed to start openssl: %w", err)
-		}
 		if err := tarCmd.Start(); err != nil {
-			opensslCmd.Process.Kill()
 			return nil, fmt.Errorf("failed to start tar: %w", err)
 		}
+		decryptDone := feedStream(tarStdin, throttle(ctx, decReader, rateLimit))
 
 		// Wait for tar (downstream) first – see encrypted+compressed
 		// pipeline comment above for rationale.
 		tarErr := tarCmd.Wait()
-		opensslErr := opensslCmd.Wait()
+		decryptErr := <-decryptDone
 
+		var problems []string
 		if tarErr != nil {
-			errMsg := fmt.Sprintf("tar extract failed (%s)", cmdutil.ErrorDetail(tarErr, &tarStderr))
-			if opensslErr != nil {
-				errMsg += fmt.Sprintf("; decryption failed (%s)", cmdutil.ErrorDetail(opensslErr, &opensslStderr))
-			}
+			problems = append(problems, fmt.Sprintf("tar extract failed (%s)", cmdutil.ErrorDetail(tarErr, &tarStderr)))
+		}
+		if decryptErr != nil && (tarErr != nil || !stageCutOff(decryptErr, nil)) {
+			problems = append(problems, fmt.Sprintf("decryption failed (%s)", decryptErr))
+		}
+		if len(problems) > 0 {
+			errMsg := strings.Join(problems, "; ")
 			result.Errors = append(result.Errors, errMsg)
 			s.logger.Error("Restore failed", map[string]interface{}{"error": errMsg})
 			return result, fmt.Errorf("restore failed: %s", errMsg)
@@ -592,7 +933,7 @@ func (s *Service) Restore(ctx context.Context, req *RestoreRequest) (*RestoreRes
 			return nil, fmt.Errorf("failed to build decompression command: %w", err)
 		}
 
-		tapeFile, err := os.Open(devicePath)
+		tapeFile, err := driveSvc.OpenReader(ctx)
 		if err != nil {
 			return nil, fmt.Errorf("failed to open tape device: %w", err)
 		}
@@ -611,7 +952,7 @@ func (s *Service) Restore(ctx context.Context, req *RestoreRequest) (*RestoreRes
 		if err != nil {
 			return nil, fmt.Errorf("failed to create decompression pipe: %w", err)
 		}
-		tarCmd.Stdin = decompPipe
+		tarCmd.Stdin = throttle(ctx, decompPipe, rateLimit)
 
 		if err := decompCmd.Start(); err != nil {
 			return nil, fmt.Errorf("failed to start decompression: %w", err)
@@ -638,22 +979,39 @@ func (s *Service) Restore(ctx context.Context, req *RestoreRequest) (*RestoreRes
 	} else {
 		// Standard unencrypted, uncompressed restore
 		s.logger.Info("Using standard (unencrypted, uncompressed) restore pipeline", nil)
+		archive, archiveReader, err := tarArchiveSource(ctx, driveSvc)
+		if err == nil && archiveReader == nil && rateLimit > 0 {
+			// tar reads a physical drive itself unless it has to be
+			// throttled through stdin
+			archive = "-"
+			archiveReader, err = driveSvc.OpenReader(ctx)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to open tape device: %w", err)
+		}
+		if archiveReader != nil {
+			defer archiveReader.Close()
+		}
 		tarArgs = []string{
 			"-x",
-			"-b", fmt.Sprintf("%d", s.blockSize/512),
-			"-f", devicePath,
-			"-C", req.DestPath,
+			"-b", tarBlockingFactor(readSize),
+			"-f", archive,
+			"-C", destPath,
 		}
 		if req.Overwrite {
 			tarArgs = append(tarArgs, "--overwrite")
 		} else {
 			tarArgs = append(tarArgs, "--keep-old-files")
 		}
+		tarArgs = append(tarArgs, rw.tarArgs()...)
 		if len(allFilePaths) > 0 {
 			tarArgs = append(tarArgs, allFilePaths...)
 		}
 
 		cmd := exec.CommandContext(ctx, "tar", tarArgs...)
+		if archiveReader != nil {
+			cmd.Stdin = throttle(ctx, bufio.NewReaderSize(archiveReader, readSize), rateLimit)
+		}
 		var tarStderr bytes.Buffer
 		cmd.Stderr = &tarStderr
 		err = cmd.Run()
@@ -666,29 +1024,13 @@ func (s *Service) Restore(ctx context.Context, req *RestoreRequest) (*RestoreRes
 	}
 
 	// Count restored files
-	if len(allFilePaths) > 0 {
-		for _, fp := range allFilePaths {
-			destFile := filepath.Join(req.DestPath, fp)
-			if info, err := os.Stat(destFile); err == nil {
-				result.FilesRestored++
-				result.BytesRestored += info.Size()
-			}
-		}
-	} else {
-		// Count all files in destination
-		filepath.Walk(req.DestPath, func(path string, info os.FileInfo, err error) error {
-			if err == nil && !info.IsDir() {
-				result.FilesRestored++
-				result.BytesRestored += info.Size()
-			}
-			return nil
-		})
-	}
+	result.FilesRestored, result.BytesRestored = countRestored(destPath, rw.applyAll(allFilePaths))
 
 	// Verify if requested
 	if req.Verify {
 		s.logger.Info("Verifying restored files", nil)
-		verifyErrors := s.verifyRestore(ctx, req.BackupSetID, req.DestPath, allFilePaths)
+		var verifyErrors []string
+		result.ChecksumsVerified, verifyErrors = s.verifyRestore(ctx, req.BackupSetID, destPath, allFilePaths, rw)
 		if len(verifyErrors) > 0 {
 			result.Errors = append(result.Errors, verifyErrors...)
 			result.Verified = false
@@ -710,17 +1052,22 @@ func (s *Service) Restore(ctx context.Context, req *RestoreRequest) (*RestoreRes
 	s.db.Exec(`
 		INSERT INTO audit_logs (action, resource_type, resource_id, details)
 		VALUES (?, ?, ?, ?)
-	`, "restore", "backup_set", req.BackupSetID, fmt.Sprintf("Restored %d files to %s", result.FilesRestored, req.DestPath))
+	`, "restore", "backup_set", req.BackupSetID, fmt.Sprintf("Restored %d files to %s", result.FilesRestored, destLabel))
 
 	return result, nil
 }
 
-// verifyRestore checks restored files against catalog checksums
-func (s *Service) verifyRestore(ctx context.Context, backupSetID int64, destPath string, filePaths []string) []string {
+// verifyRestore checks restored files against catalog checksums, and
+// against the cataloged owner and group when tar was able to restore them.
+// Files are looked for where rw placed them. It returns the number of files
+// whose checksum matched and the problems found.
+func (s *Service) verifyRestore(ctx context.Context, backupSetID int64, destPath string, filePaths []string, rw *pathRewriter) (int64, []string) {
 	var errors []string
+	var matched int64
+	checkOwners := ownershipRestored()
 
 	query := `
-		SELECT file_path, file_size, checksum 
+		SELECT file_path, file_size, COALESCE(checksum, ''), uid, gid, COALESCE(owner, ''), COALESCE(group_name, '')
 		FROM catalog_entries 
 		WHERE backup_set_id = ?
 	`
@@ -738,7 +1085,7 @@ func (s *Service) verifyRestore(ctx context.Context, backupSetID int64, destPath
 	rows, err := s.db.Query(query, args...)
 	if err != nil {
 		errors = append(errors, fmt.Sprintf("failed to query catalog: %v", err))
-		return errors
+		return 0, errors
 	}
 	defer rows.Close()
 
@@ -746,18 +1093,26 @@ func (s *Service) verifyRestore(ctx context.Context, backupSetID int64, destPath
 		var filePath string
 		var expectedSize int64
 		var expectedChecksum string
+		var uid, gid *int
+		var owner, group string
 
-		if err := rows.Scan(&filePath, &expectedSize, &expectedChecksum); err != nil {
+		if err := rows.Scan(&filePath, &expectedSize, &expectedChecksum, &uid, &gid, &owner, &group); err != nil {
 			continue
 		}
 
-		destFile := filepath.Join(destPath, filePath)
+		destFile := filepath.Join(destPath, rw.apply(filePath))
 		info, err := os.Stat(destFile)
 		if err != nil {
 			errors = append(errors, fmt.Sprintf("file not found: %s", filePath))
 			continue
 		}
 
+		if checkOwners {
+			if problem := checkOwnership(destFile, filePath, uid, gid, owner, group); problem != "" {
+				errors = append(errors, problem)
+			}
+		}
+
 		if info.Size() != expectedSize {
 			errors = append(errors, fmt.Sprintf("size mismatch for %s: expected %d, got %d", filePath, expectedSize, info.Size()))
 		}
@@ -770,11 +1125,13 @@ func (s *Service) verifyRestore(ctx context.Context, backupSetID int64, destPath
 			}
 			if actualChecksum != expectedChecksum {
 				errors = append(errors, fmt.Sprintf("checksum mismatch for %s", filePath))
+			} else {
+				matched++
 			}
 		}
 	}
 
-	return errors
+	return matched, errors
 }
 
 func calculateChecksum(path string) (string, error) {
@@ -810,21 +1167,28 @@ func (s *Service) BrowseCatalog(ctx context.Context, backupSetID int64, pathPref
 		})
 	}
 
+	// Deduplicated entries report the tape holding their data
 	query := `
-		SELECT id, backup_set_id, file_path, file_size,
-		       COALESCE(file_mode, 0), COALESCE(mod_time, ''),
-		       COALESCE(checksum, ''), COALESCE(block_offset, 0)
-		FROM catalog_entries
-		WHERE backup_set_id = ?
+		SELECT ce.id, ce.backup_set_id, ce.file_path, ce.file_size,
+		       COALESCE(ce.file_mode, 0), COALESCE(ce.mod_time, ''),
+		       COALESCE(ce.checksum, ''), COALESCE(ce.block_offset, 0),
+		       ce.ref_backup_set_id, COALESCE(ce.ref_file_path, ''),
+		       COALESCE(rt.id, 0), COALESCE(rt.label, ''),
+		       ce.uid, ce.gid, COALESCE(ce.owner, ''), COALESCE(ce.group_name, ''),
+		       COALESCE(ce.file_type, ''), COALESCE(ce.link_target, ''), ce.has_xattrs
+		FROM catalog_entries ce
+		LEFT JOIN backup_sets rbs ON ce.ref_backup_set_id = rbs.id
+		LEFT JOIN tapes rt ON rbs.tape_id = rt.id
+		WHERE ce.backup_set_id = ?
 	`
 	args := []interface{}{backupSetID}
 
 	if pathPrefix != "" {
-		query += " AND file_path LIKE ?"
+		query += " AND ce.file_path LIKE ?"
 		args = append(args, pathPrefix+"%")
 	}
 
-	query += " ORDER BY file_path"
+	query += " ORDER BY ce.file_path"
 	if limit > 0 {
 		query += " LIMIT ?"
 		args = append(args, limit)
@@ -844,7 +1208,11 @@ func (s *Service) BrowseCatalog(ctx context.Context, backupSetID int64, pathPref
 	for rows.Next() {
 		var e models.CatalogEntry
 		var modTimeStr string
-		if err := rows.Scan(&e.ID, &e.BackupSetID, &e.FilePath, &e.FileSize, &e.FileMode, &modTimeStr, &e.Checksum, &e.BlockOffset); err != nil {
+		var refTapeID int64
+		var refTapeLabel string
+		if err := rows.Scan(&e.ID, &e.BackupSetID, &e.FilePath, &e.FileSize, &e.FileMode, &modTimeStr, &e.Checksum, &e.BlockOffset,
+			&e.RefBackupSetID, &e.RefFilePath, &refTapeID, &refTapeLabel,
+			&e.UID, &e.GID, &e.Owner, &e.Group, &e.FileType, &e.LinkTarget, &e.HasXattrs); err != nil {
 			continue
 		}
 		if modTimeStr != "" {
@@ -854,6 +1222,10 @@ func (s *Service) BrowseCatalog(ctx context.Context, backupSetID int64, pathPref
 		}
 		e.TapeID = tapeID
 		e.TapeLabel = tapeLabel
+		if e.RefBackupSetID != nil {
+			e.TapeID = refTapeID
+			e.TapeLabel = refTapeLabel
+		}
 		entries = append(entries, e)
 	}
 
@@ -945,7 +1317,9 @@ func (s *Service) GetFolderContents(ctx context.Context, backupSetID int64, fold
 
 	rows, err := s.db.Query(`
 		SELECT id, backup_set_id, file_path, file_size, COALESCE(file_mode, 0), 
-		       COALESCE(checksum, ''), COALESCE(block_offset, 0)
+		       COALESCE(checksum, ''), COALESCE(block_offset, 0),
+		       uid, gid, COALESCE(owner, ''), COALESCE(group_name, ''),
+		       COALESCE(file_type, ''), COALESCE(link_target, ''), has_xattrs
 		FROM catalog_entries
 		WHERE backup_set_id = ? AND file_path LIKE ?
 		ORDER BY file_path
@@ -965,7 +1339,8 @@ func (s *Service) GetFolderContents(ctx context.Context, backupSetID int64, fold
 
 	for rows.Next() {
 		var e models.CatalogEntry
-		if err := rows.Scan(&e.ID, &e.BackupSetID, &e.FilePath, &e.FileSize, &e.FileMode, &e.Checksum, &e.BlockOffset); err != nil {
+		if err := rows.Scan(&e.ID, &e.BackupSetID, &e.FilePath, &e.FileSize, &e.FileMode, &e.Checksum, &e.BlockOffset,
+			&e.UID, &e.GID, &e.Owner, &e.Group, &e.FileType, &e.LinkTarget, &e.HasXattrs); err != nil {
 			return nil, nil, fmt.Errorf("failed to scan catalog entry: %w", err)
 		}
 
@@ -1113,34 +1488,55 @@ func (s *Service) RawReadTape(ctx context.Context, req *RawReadRequest) (*RawRea
 	addLog(fmt.Sprintf("Destination directory: %s", req.DestPath))
 
 	// --- Step 5: Position tape for reading ---
-	if result.HasHeader {
-		// Tape has our header at file 0 - seek past it to file 1 where data lives
-		addLog("Positioning tape past header to data section (file 1)...")
-		if err := driveSvc.SeekToFileNumber(ctx, 1); err != nil {
-			addLog(fmt.Sprintf("Failed to seek to file 1: %s, rewinding to start", err.Error()))
-			if rwErr := driveSvc.Rewind(ctx); rwErr != nil {
-				return nil, fmt.Errorf("failed to rewind tape: %w", rwErr)
+	position := func(ctx context.Context) error {
+		if result.HasHeader {
+			// Tape has our header at file 0 - seek past it to file 1 where data lives
+			err := driveSvc.SeekToFileNumber(ctx, 1)
+			if err == nil {
+				return nil
 			}
+			addLog(fmt.Sprintf("Failed to seek to file 1: %s, rewinding to start", err.Error()))
 		}
+		if err := driveSvc.Rewind(ctx); err != nil {
+			return fmt.Errorf("failed to rewind tape: %w", err)
+		}
+		return nil
+	}
+	if result.HasHeader {
+		addLog("Positioning tape past header to data section (file 1)...")
 	} else {
 		// No header - rewind and read from beginning
 		addLog("Rewinding tape to beginning for full read...")
-		if err := driveSvc.Rewind(ctx); err != nil {
-			return nil, fmt.Errorf("failed to rewind tape: %w", err)
-		}
+	}
+	if err := position(ctx); err != nil {
+		return nil, err
+	}
+
+	// A tape from another system carries no record of its block size, so
+	// the configured size is tried before variable block mode
+	readSize, err := s.setReadBlockSize(ctx, driveSvc, 0, position, addLog)
+	if err != nil {
+		return nil, err
 	}
 
 	// --- Step 6: Extract data from tape using verbose tar ---
 	addLog("Starting data extraction from tape...")
 
+	archive, archiveReader, err := tarArchiveSource(ctx, driveSvc)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open tape device: %w", err)
+	}
+	if archiveReader != nil {
+		defer archiveReader.Close()
+	}
 	tarArgs := []string{
 		"-x", // Extract
 		"-v", // Verbose - list each file as it's extracted
-		"-f", devicePath,
+		"-f", archive,
 		"-C", req.DestPath,
 	}
-	if s.blockSize > 0 {
-		tarArgs = append(tarArgs, "-b", fmt.Sprintf("%d", s.blockSize/512))
+	if readSize > 0 {
+		tarArgs = append(tarArgs, "-b", tarBlockingFactor(readSize))
 	}
 	if req.Overwrite {
 		tarArgs = append(tarArgs, "--overwrite")
@@ -1149,6 +1545,9 @@ func (s *Service) RawReadTape(ctx context.Context, req *RawReadRequest) (*RawRea
 	}
 
 	cmd := exec.CommandContext(ctx, "tar", tarArgs...)
+	if archiveReader != nil {
+		cmd.Stdin = archiveReader
+	}
 	var tarStdout, tarStderr bytes.Buffer
 	cmd.Stdout = &tarStdout
 	cmd.Stderr = &tarStderr
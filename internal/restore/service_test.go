@@ -1,13 +1,23 @@
 package restore
 
 import (
+	"archive/tar"
+	"bytes"
 	"context"
+	"encoding/base64"
+	"errors"
+	"io"
 	"os"
 	"path/filepath"
+	"runtime"
+	"strings"
 	"testing"
 
 	"github.com/RoseOO/TapeBackarr/internal/database"
+	"github.com/RoseOO/TapeBackarr/internal/encryption"
+	"github.com/RoseOO/TapeBackarr/internal/logging"
 	"github.com/RoseOO/TapeBackarr/internal/models"
+	"github.com/RoseOO/TapeBackarr/internal/tape"
 )
 
 func setupTestDB(t *testing.T) *database.DB {
@@ -838,3 +848,197 @@ func TestHwEncryptionFieldsInBackupSetForRestore(t *testing.T) {
 		t.Error("expected hw_encrypted to be true")
 	}
 }
+
+func TestExternalKeyCheckedAgainstTapeFingerprint(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+	setID := setupTestData(t, db)
+
+	key := bytes.Repeat([]byte{0x42}, encryption.KeySize)
+	keyBase64 := base64.StdEncoding.EncodeToString(key)
+	wrongBase64 := base64.StdEncoding.EncodeToString(bytes.Repeat([]byte{0x24}, encryption.KeySize))
+
+	// The key was never imported here; only the tape knows its fingerprint
+	if _, err := db.Exec("UPDATE backup_sets SET encrypted = 1 WHERE id = ?", setID); err != nil {
+		t.Fatalf("failed to mark set encrypted: %v", err)
+	}
+	if _, err := db.Exec("UPDATE tapes SET encryption_key_fingerprint = ? WHERE id = 1", encryption.KeyFingerprint(key)); err != nil {
+		t.Fatalf("failed to set tape fingerprint: %v", err)
+	}
+
+	logger, _ := logging.NewLogger("error", "text", "")
+	svc := NewService(db, nil, logger, 262144)
+
+	// Key sheets wrap the base64 across lines
+	wrapped := keyBase64[:22] + "\n    " + keyBase64[22:] + "\n"
+	got, err := svc.checkExternalKey(wrapped, nil, 1)
+	if err != nil || got != keyBase64 {
+		t.Errorf("checkExternalKey = %q, %v", got, err)
+	}
+	if _, err := svc.checkExternalKey(wrongBase64, nil, 1); !errors.Is(err, encryption.ErrKeyMismatch) {
+		t.Errorf("expected ErrKeyMismatch, got %v", err)
+	}
+	if _, err := svc.checkExternalKey("not a key", nil, 1); err == nil {
+		t.Error("expected invalid key to be rejected")
+	}
+
+	// A wrong key fails the restore before any drive is touched
+	_, err = svc.Restore(context.Background(), &RestoreRequest{BackupSetID: setID, DestPath: t.TempDir(), EncryptionKey: wrongBase64})
+	if !errors.Is(err, encryption.ErrKeyMismatch) {
+		t.Errorf("expected restore to fail with ErrKeyMismatch, got %v", err)
+	}
+
+	_, err = svc.Restore(context.Background(), &RestoreRequest{BackupSetID: setID, DestPath: t.TempDir()})
+	if err == nil || !strings.Contains(err.Error(), "encryption_key") {
+		t.Errorf("expected missing key error to mention encryption_key, got %v", err)
+	}
+}
+
+func TestDedupReferencesResolveAcrossSets(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+	setupTestData(t, db)
+
+	result, err := db.Exec(`INSERT INTO tapes (barcode, label, pool_id, status, capacity_bytes, used_bytes) VALUES ('TEST002', 'Second Tape', 1, 'active', 1000000000, 0)`)
+	if err != nil {
+		t.Fatalf("failed to insert tape: %v", err)
+	}
+	tape2, _ := result.LastInsertId()
+	result, err = db.Exec(`INSERT INTO backup_sets (job_id, tape_id, backup_type, start_time, status, file_count, total_bytes) VALUES (1, ?, 'full', datetime('now'), 'completed', 1, 100)`, tape2)
+	if err != nil {
+		t.Fatalf("failed to insert backup set: %v", err)
+	}
+	set2, _ := result.LastInsertId()
+	db.Exec(`INSERT INTO catalog_entries (backup_set_id, file_path, file_size, checksum) VALUES (?, 'new.txt', 100, 'x')`, set2)
+	db.Exec(`INSERT INTO catalog_entries (backup_set_id, file_path, file_size, checksum, ref_backup_set_id, ref_file_path) VALUES (?, 'archive/photo.jpg', 2500, 'mno', 1, 'images/photo.jpg')`, set2)
+
+	svc := &Service{db: db}
+
+	refs, err := svc.lookupDedupRefs(set2, nil)
+	if err != nil || len(refs) != 1 || refs[0].setID != 1 || refs[0].dataPath != "images/photo.jpg" {
+		t.Fatalf("unexpected refs %+v: %v", refs, err)
+	}
+	if refs, _ := svc.lookupDedupRefs(set2, []string{"new.txt"}); len(refs) != 0 {
+		t.Errorf("expected no refs among written files, got %+v", refs)
+	}
+
+	reqs, err := svc.GetRequiredTapes(context.Background(), &RestoreRequest{BackupSetID: set2})
+	if err != nil {
+		t.Fatalf("GetRequiredTapes failed: %v", err)
+	}
+	if len(reqs) != 2 || reqs[1].Tape.Label != "Test Tape" || reqs[1].FileCount != 1 || reqs[1].TotalBytes != 2500 {
+		t.Errorf("expected the referenced tape to be required, got %+v", reqs)
+	}
+
+	reqs, err = svc.GetRequiredTapes(context.Background(), &RestoreRequest{BackupSetID: set2, FilePaths: []string{"archive/photo.jpg"}})
+	if err != nil || len(reqs) != 1 || reqs[0].Tape.Label != "Test Tape" {
+		t.Errorf("expected only the referenced tape for a deduplicated file, got %+v: %v", reqs, err)
+	}
+
+	entries, err := svc.BrowseCatalog(context.Background(), set2, "archive/", 0, 0)
+	if err != nil || len(entries) != 1 {
+		t.Fatalf("BrowseCatalog failed: %v (%d entries)", err, len(entries))
+	}
+	if entries[0].RefBackupSetID == nil || *entries[0].RefBackupSetID != 1 || entries[0].TapeLabel != "Test Tape" {
+		t.Errorf("expected deduplicated entry to report the referenced set and tape, got %+v", entries[0])
+	}
+}
+
+func TestCheckOwnership(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("ownership is only checked on Linux")
+	}
+	dir := t.TempDir()
+	path := filepath.Join(dir, "f.txt")
+	os.WriteFile(path, []byte("x"), 0644)
+	uid, gid := os.Getuid(), os.Getgid()
+
+	if problem := checkOwnership(path, "f.txt", &uid, &gid, "", ""); problem != "" {
+		t.Errorf("matching owner reported: %s", problem)
+	}
+	if problem := checkOwnership(path, "f.txt", nil, nil, "", ""); problem != "" {
+		t.Errorf("entry without ownership reported: %s", problem)
+	}
+	other := uid + 1
+	if problem := checkOwnership(path, "f.txt", &other, &gid, "", ""); problem == "" {
+		t.Error("different owner not reported")
+	}
+
+	// A cataloged name that exists locally wins over the numeric id
+	lookup := func(name string) (string, error) { return "42", nil }
+	if got := expectedID(7, "svc_media", lookup); got != 42 {
+		t.Errorf("expected local id 42, got %d", got)
+	}
+	missing := func(name string) (string, error) { return "", errors.New("unknown user") }
+	if got := expectedID(7, "svc_media", missing); got != 7 {
+		t.Errorf("expected cataloged id 7, got %d", got)
+	}
+}
+
+func TestRestoreRefusesNDMPImages(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+	backupSetID := setupTestData(t, db)
+	db.Exec("UPDATE backup_sets SET ndmp_type = 'dump', ndmp_level = 0 WHERE id = ?", backupSetID)
+
+	svc := &Service{db: db, blockSize: 65536}
+	_, err := svc.Restore(context.Background(), &RestoreRequest{BackupSetID: backupSetID, DestPath: t.TempDir(), FilePaths: []string{"documents/report.pdf"}})
+	if err == nil || !strings.Contains(err.Error(), "NDMP") {
+		t.Errorf("expected NDMP images to be refused, got %v", err)
+	}
+}
+
+func TestRestoreFailsOnCorruptEncryptedChunk(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+	setID := setupTestData(t, db)
+	logger, _ := logging.NewLogger("error", "text", "")
+	svc := NewService(db, nil, logger, 65536)
+	ctx := context.Background()
+
+	devicePath := "file://" + t.TempDir()
+	drive := tape.NewServiceForDevice(devicePath, 65536)
+	if err := drive.WriteTapeLabel(ctx, "Test Tape", "uuid-Test Tape", "test_pool"); err != nil {
+		t.Fatalf("WriteTapeLabel: %v", err)
+	}
+	db.Exec("INSERT INTO tape_drives (device_path, display_name, status, current_tape_id) VALUES (?, 'vtape', 'ready', 1)", devicePath)
+
+	key := bytes.Repeat([]byte{0x42}, encryption.KeySize)
+	db.Exec("UPDATE backup_sets SET encrypted = 1 WHERE id = ?", setID)
+	db.Exec("UPDATE tapes SET encryption_key_fingerprint = ? WHERE id = 1", encryption.KeyFingerprint(key))
+
+	// The first file ends exactly at the end of the first chunk, so a stream
+	// cut short there is still a valid archive to tar
+	var archive bytes.Buffer
+	tw := tar.NewWriter(&archive)
+	first := bytes.Repeat([]byte("a"), encryption.StreamChunkSize-512)
+	second := bytes.Repeat([]byte("b"), encryption.StreamChunkSize+100000)
+	tw.WriteHeader(&tar.Header{Name: "documents/report.pdf", Mode: 0644, Size: int64(len(first)), Typeflag: tar.TypeReg})
+	tw.Write(first)
+	tw.WriteHeader(&tar.Header{Name: "images/photo.jpg", Mode: 0644, Size: int64(len(second)), Typeflag: tar.TypeReg})
+	tw.Write(second)
+	tw.Close()
+	plainLen := archive.Len()
+
+	enc, err := encryption.NewEncryptingReader(&archive, key)
+	if err != nil {
+		t.Fatalf("NewEncryptingReader: %v", err)
+	}
+	data, err := io.ReadAll(enc)
+	if err != nil {
+		t.Fatalf("encrypt: %v", err)
+	}
+	// Each chunk is a 4-byte length, the ciphertext and a 16-byte tag;
+	// damage the ciphertext of the second of three chunks
+	const overhead = 4 + 16
+	last := plainLen - 2*encryption.StreamChunkSize
+	chunk2 := len(data) - (last + overhead) - (encryption.StreamChunkSize + overhead)
+	data[chunk2+4+1000] ^= 0xff
+	writeStreamToTape(t, drive, data)
+
+	dest := t.TempDir()
+	_, err = svc.Restore(ctx, &RestoreRequest{BackupSetID: setID, DestPath: dest, EncryptionKey: base64.StdEncoding.EncodeToString(key)})
+	if err == nil || !strings.Contains(err.Error(), "decryption failed") {
+		t.Fatalf("expected the corrupt chunk to fail the restore, got %v", err)
+	}
+}
@@ -0,0 +1,133 @@
+package restore
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os/exec"
+
+	"github.com/RoseOO/TapeBackarr/internal/cmdutil"
+	"github.com/RoseOO/TapeBackarr/internal/encryption"
+	"github.com/RoseOO/TapeBackarr/internal/models"
+	"github.com/RoseOO/TapeBackarr/internal/stages"
+	"github.com/RoseOO/TapeBackarr/internal/tape"
+)
+
+// extractStaged extracts a backup set written through stream stages:
+// tape -> decrypt -> decompress -> reverse stages -> tar. An empty
+// encryptionKey or compressionType skips that step. The stream is read to
+// its end even when tar stops early, so stages that check the stream at its
+// end, such as sha256, always do. rateLimit caps how fast tar is fed, in
+// bytes a second; 0 means unlimited.
+func (s *Service) extractStaged(ctx context.Context, driveSvc *tape.Service, readSize int, tarArgs []string, applied []models.StreamStage, encryptionKey string, encMeta *models.EncryptionMetadata, compressionType string, rateLimit int64) error {
+	tapeFile, err := driveSvc.OpenReader(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to open tape device: %w", err)
+	}
+	defer tapeFile.Close()
+
+	var stream io.Reader = bufio.NewReaderSize(tapeFile, readSize)
+	if encryptionKey != "" {
+		if stream, err = encryption.NewBackupDecryptingReader(stream, encryptionKey, encMeta); err != nil {
+			return fmt.Errorf("failed to start decryption: %w", err)
+		}
+	}
+
+	var decompCmd *exec.Cmd
+	var decompStderr bytes.Buffer
+	if compressionType != "" {
+		if decompCmd, err = buildDecompressionCmd(ctx, models.CompressionType(compressionType)); err != nil {
+			return fmt.Errorf("failed to build decompression command: %w", err)
+		}
+		decompCmd.Stdin = stream
+		decompCmd.Stderr = &decompStderr
+		if stream, err = decompCmd.StdoutPipe(); err != nil {
+			return fmt.Errorf("failed to create decompression pipe: %w", err)
+		}
+		if err := decompCmd.Start(); err != nil {
+			return fmt.Errorf("failed to start decompression: %w", err)
+		}
+	}
+
+	decoded, err := stages.Decode(ctx, stream, applied)
+	if err != nil {
+		if decompCmd != nil {
+			decompCmd.Process.Kill()
+			decompCmd.Wait()
+		}
+		return err
+	}
+
+	tarCmd := exec.CommandContext(ctx, "tar", tarArgs...)
+	var tarStderr bytes.Buffer
+	tarCmd.Stderr = &tarStderr
+	tarStdin, err := tarCmd.StdinPipe()
+	if err != nil {
+		if decompCmd != nil {
+			decompCmd.Process.Kill()
+			decompCmd.Wait()
+		}
+		return fmt.Errorf("failed to create tar pipe: %w", err)
+	}
+	if err := tarCmd.Start(); err != nil {
+		if decompCmd != nil {
+			decompCmd.Process.Kill()
+			decompCmd.Wait()
+		}
+		return fmt.Errorf("failed to start tar: %w", err)
+	}
+
+	readErr := copyThenDrain(throttleWriter(ctx, tarStdin, rateLimit), decoded)
+	tarErr := tarCmd.Wait()
+	var decompErr error
+	if decompCmd != nil {
+		decompErr = decompCmd.Wait()
+	}
+
+	var errMsg string
+	if tarErr != nil {
+		errMsg = fmt.Sprintf("tar extract failed (%s)", cmdutil.ErrorDetail(tarErr, &tarStderr))
+	}
+	if decompErr != nil {
+		if errMsg != "" {
+			errMsg += "; "
+		}
+		errMsg += fmt.Sprintf("decompression failed (%s)", cmdutil.ErrorDetail(decompErr, &decompStderr))
+	}
+	if readErr != nil {
+		if errMsg != "" {
+			errMsg += "; "
+		}
+		errMsg += fmt.Sprintf("reading the stream failed (%s)", readErr)
+	}
+	if errMsg != "" {
+		return fmt.Errorf("%s", errMsg)
+	}
+	return nil
+}
+
+// copyThenDrain copies r into w and closes w. Once w stops accepting data,
+// as when tar has found everything it was asked for, the rest of r is read
+// and discarded. It returns the error reading r, if any.
+func copyThenDrain(w io.WriteCloser, r io.Reader) error {
+	defer w.Close()
+	buf := make([]byte, 256*1024)
+	writing := true
+	for {
+		n, err := r.Read(buf)
+		if n > 0 && writing {
+			if _, werr := w.Write(buf[:n]); werr != nil {
+				writing = false
+				w.Close()
+			}
+		}
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
@@ -0,0 +1,106 @@
+package restore
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/RoseOO/TapeBackarr/internal/logging"
+	"github.com/RoseOO/TapeBackarr/internal/models"
+	"github.com/RoseOO/TapeBackarr/internal/stages"
+	"github.com/RoseOO/TapeBackarr/internal/tape"
+)
+
+// invertStage flips every bit of the stream, so a restore that does not
+// reverse it cannot read the archive
+type invertStage struct{}
+
+func (invertStage) Name() string                            { return "test-invert" }
+func (invertStage) Validate(params map[string]string) error { return nil }
+
+func (invertStage) Encode(ctx context.Context, r io.Reader, params map[string]string) (stages.Stream, error) {
+	return invertReader{r}, nil
+}
+
+func (invertStage) Decode(ctx context.Context, r io.Reader, applied models.StreamStage) (io.Reader, error) {
+	return invertReader{r}, nil
+}
+
+type invertReader struct{ r io.Reader }
+
+func (i invertReader) Read(p []byte) (int, error) {
+	n, err := i.r.Read(p)
+	for j := range p[:n] {
+		p[j] = ^p[j]
+	}
+	return n, err
+}
+
+func (invertReader) Metadata() map[string]string { return nil }
+
+func init() {
+	stages.Register(invertStage{})
+}
+
+func TestRestoreStreamStages(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+	setID := setupTestData(t, db)
+	logger, _ := logging.NewLogger("error", "text", "")
+	svc := NewService(db, nil, logger, 65536)
+	ctx := context.Background()
+
+	devicePath := "file://" + t.TempDir()
+	drive := tape.NewServiceForDevice(devicePath, 65536)
+	if err := drive.WriteTapeLabel(ctx, "Test Tape", "uuid-Test Tape", "test_pool"); err != nil {
+		t.Fatalf("WriteTapeLabel: %v", err)
+	}
+	db.Exec("INSERT INTO tape_drives (device_path, display_name, status, current_tape_id) VALUES (?, 'vtape', 'ready', 1)", devicePath)
+
+	var archive bytes.Buffer
+	tw := tar.NewWriter(&archive)
+	content := strings.Repeat("staged ", 1000)
+	tw.WriteHeader(&tar.Header{Name: "documents/notes.txt", Mode: 0644, Size: int64(len(content)), Typeflag: tar.TypeReg})
+	tw.Write([]byte(content))
+	tw.Close()
+
+	chain := []models.StreamStage{{Name: "sha256"}, {Name: "test-invert"}}
+	encoded, applied, err := stages.Encode(ctx, &archive, chain)
+	if err != nil {
+		t.Fatalf("Encode: %v", err)
+	}
+	data, _ := io.ReadAll(encoded)
+	writeStreamToTape(t, drive, data)
+	recorded := applied()
+	if recorded[0].Metadata["sha256"] == "" {
+		t.Fatalf("expected sha256 to record the stream checksum, got %+v", recorded[0])
+	}
+	db.Exec("UPDATE backup_sets SET stream_stages = ? WHERE id = ?", stages.Marshal(recorded), setID)
+
+	dest := t.TempDir()
+	if _, err := svc.Restore(ctx, &RestoreRequest{BackupSetID: setID, DestPath: dest}); err != nil {
+		t.Fatalf("Restore: %v", err)
+	}
+	got, err := os.ReadFile(filepath.Join(dest, "documents/notes.txt"))
+	if err != nil || string(got) != content {
+		t.Fatalf("expected the file restored through the stages, got %d bytes (%v)", len(got), err)
+	}
+
+	res, err := svc.Peek(ctx, &PeekRequest{BackupSetID: setID, FilePath: "documents/notes.txt", MaxBytes: 6})
+	if err != nil || string(res.Data) != "staged" {
+		t.Errorf("expected peek to reverse the stages, got %+v (%v)", res, err)
+	}
+
+	// A stream that does not match its recorded checksum fails the restore
+	recorded[0].Metadata["sha256"] = strings.Repeat("0", 64)
+	db.Exec("UPDATE backup_sets SET stream_stages = ? WHERE id = ?", stages.Marshal(recorded), setID)
+	_, err = svc.Restore(ctx, &RestoreRequest{BackupSetID: setID, DestPath: t.TempDir()})
+	if err == nil || !strings.Contains(err.Error(), "checksum mismatch") {
+		t.Errorf("expected a checksum mismatch, got %v", err)
+	}
+}
@@ -0,0 +1,462 @@
+package restore
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"fmt"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/RoseOO/TapeBackarr/internal/cmdutil"
+	"github.com/RoseOO/TapeBackarr/internal/credentials"
+	"github.com/RoseOO/TapeBackarr/internal/models"
+)
+
+// defaultSSHPort is used for SSH targets that do not specify a port.
+const defaultSSHPort = 22
+
+// remoteDestination is a remote restore target made available as a local
+// directory. SMB and NFS targets are mounted and extracted into directly;
+// SSH targets are extracted into a staging directory and pushed with rsync
+// by Deliver.
+type remoteDestination struct {
+	target      *models.RestoreTarget
+	LocalPath   string
+	Description string
+
+	mountPoint string
+	staging    string
+	remoteDir  string
+	keyFile    string
+	logger     func(msg string, fields map[string]interface{})
+}
+
+// GetTarget loads a saved restore target including its secret.
+func (s *Service) GetTarget(id int64) (*models.RestoreTarget, error) {
+	var t models.RestoreTarget
+	err := s.db.QueryRow(`
+		SELECT id, name, target_type, host, port, share, base_path, username, domain,
+		       secret, mount_options, enabled, created_at, updated_at, credential_id
+		FROM restore_targets WHERE id = ?
+	`, id).Scan(&t.ID, &t.Name, &t.TargetType, &t.Host, &t.Port, &t.Share, &t.BasePath,
+		&t.Username, &t.Domain, &t.Secret, &t.MountOptions, &t.Enabled, &t.CreatedAt, &t.UpdatedAt, &t.CredentialID)
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("restore target %d not found", id)
+	}
+	if err != nil {
+		return nil, err
+	}
+	t.HasSecret = t.Secret != "" || t.CredentialID != nil
+	return &t, nil
+}
+
+// applyCredential fills in the username, domain and secret of a target that
+// references the credentials store, recording the use
+func (s *Service) applyCredential(t *models.RestoreTarget, purpose string) error {
+	if t.CredentialID == nil {
+		return nil
+	}
+	store := s.credentials.Load()
+	if store == nil {
+		return fmt.Errorf("restore target %q uses a stored credential but the credentials store is not available", t.Name)
+	}
+	c, secret, err := store.Resolve(*t.CredentialID, credentials.Usage{
+		UsedByType: "restore_target",
+		UsedByID:   t.ID,
+		Purpose:    purpose,
+	})
+	if err != nil {
+		return err
+	}
+	if c.Username != "" {
+		t.Username = c.Username
+	}
+	if c.Domain != "" {
+		t.Domain = c.Domain
+	}
+	t.Secret = secret
+	return nil
+}
+
+// ValidateTarget checks that a restore target has the fields its type needs.
+func ValidateTarget(t *models.RestoreTarget) error {
+	if t.Name == "" {
+		return fmt.Errorf("name is required")
+	}
+	if t.Host == "" {
+		return fmt.Errorf("host is required")
+	}
+	if err := checkTargetLogin(t); err != nil {
+		return err
+	}
+	if t.Port < 0 || t.Port > 65535 {
+		return fmt.Errorf("port must be between 0 and 65535")
+	}
+	if strings.ContainsAny(t.MountOptions, " \t\n") {
+		return fmt.Errorf("mount_options must be a comma-separated list without spaces")
+	}
+	switch t.TargetType {
+	case models.RestoreDestSMB:
+		if t.Share == "" {
+			return fmt.Errorf("share is required for smb targets")
+		}
+		if strings.ContainsAny(t.Username+t.Domain, ",\n") {
+			return fmt.Errorf("username and domain must not contain commas or newlines")
+		}
+	case models.RestoreDestNFS:
+		if !strings.HasPrefix(t.Share, "/") {
+			return fmt.Errorf("share must be the absolute export path for nfs targets")
+		}
+	case models.RestoreDestSSH:
+		if t.Username == "" && t.CredentialID == nil {
+			return fmt.Errorf("username is required for ssh targets")
+		}
+		if t.Secret != "" && !strings.Contains(t.Secret, "PRIVATE KEY") {
+			return fmt.Errorf("secret must be an SSH private key for ssh targets")
+		}
+	default:
+		return fmt.Errorf("target_type must be smb, nfs or ssh")
+	}
+	return nil
+}
+
+// checkTargetLogin rejects a host or login that would be read as an option
+// or split into further arguments by mount, ssh or rsync, or that would add
+// lines to a mount.cifs credentials file. It runs again once a stored
+// credential has filled in the login.
+func checkTargetLogin(t *models.RestoreTarget) error {
+	if strings.HasPrefix(t.Host, "-") || strings.ContainsAny(t.Host, " \t\r\n@:/,") {
+		return fmt.Errorf("invalid host %q", t.Host)
+	}
+	switch t.TargetType {
+	case models.RestoreDestSSH:
+		if strings.HasPrefix(t.Username, "-") || strings.ContainsAny(t.Username, " \t\r\n@:") {
+			return fmt.Errorf("invalid username %q for ssh targets", t.Username)
+		}
+	case models.RestoreDestSMB:
+		if strings.ContainsAny(t.Username+t.Domain+t.Secret, "\r\n") {
+			return fmt.Errorf("username, domain and password must not contain line breaks")
+		}
+	}
+	return nil
+}
+
+// TestTarget checks that a saved target is reachable with its credentials by
+// mounting and unmounting it, or running a no-op command over SSH.
+func (s *Service) TestTarget(ctx context.Context, id int64) error {
+	t, err := s.GetTarget(id)
+	if err != nil {
+		return err
+	}
+	if err := s.applyCredential(t, "connection test"); err != nil {
+		return err
+	}
+	if err := checkTargetLogin(t); err != nil {
+		return err
+	}
+	dest := &remoteDestination{target: t, logger: s.logger.Warn}
+	defer dest.Close(context.Background())
+
+	if t.TargetType == models.RestoreDestSSH {
+		if err := dest.writeKeyFile(s); err != nil {
+			return err
+		}
+		return runTargetCommand(ctx, "ssh", append(sshArgs(t, dest.keyFile), "--", sshDestination(t), "true")...)
+	}
+	return dest.mount(ctx, s)
+}
+
+// openRemoteDestination prepares a saved target for a restore of backupSetID
+// into subPath (relative to the target's base path).
+func (s *Service) openRemoteDestination(ctx context.Context, targetID, backupSetID int64, subPath string) (*remoteDestination, error) {
+	t, err := s.GetTarget(targetID)
+	if err != nil {
+		return nil, err
+	}
+	if !t.Enabled {
+		return nil, fmt.Errorf("restore target %q is disabled", t.Name)
+	}
+	if err := s.applyCredential(t, fmt.Sprintf("restore of backup set %d", backupSetID)); err != nil {
+		return nil, err
+	}
+	if err := checkTargetLogin(t); err != nil {
+		return nil, err
+	}
+
+	dest := &remoteDestination{target: t, logger: s.logger.Warn}
+	switch t.TargetType {
+	case models.RestoreDestSMB, models.RestoreDestNFS:
+		if err := dest.mount(ctx, s); err != nil {
+			dest.Close(context.Background())
+			return nil, err
+		}
+		local, err := safeJoin(dest.mountPoint, t.BasePath, subPath)
+		if err != nil {
+			dest.Close(context.Background())
+			return nil, err
+		}
+		dest.LocalPath = local
+		dest.Description = fmt.Sprintf("%s (%s)", t.Name, targetURL(t, path.Join("/", t.BasePath, subPath)))
+
+	case models.RestoreDestSSH:
+		// A relative base path is resolved against the remote user's home
+		rel, err := safeJoin(".", subPath)
+		if err != nil {
+			return nil, err
+		}
+		remoteDir := path.Join(t.BasePath, filepath.ToSlash(rel))
+		dest.remoteDir = remoteDir
+
+		// SSH restores are staged locally first, so the full set must fit
+		var totalBytes int64
+		s.db.QueryRow("SELECT total_bytes FROM backup_sets WHERE id = ?", backupSetID).Scan(&totalBytes)
+		if err := s.scratch.CheckSpace("", totalBytes); err != nil {
+			return nil, err
+		}
+		staging, err := s.scratch.MkdirTemp("restore-ssh-*")
+		if err != nil {
+			return nil, fmt.Errorf("failed to create staging directory: %w", err)
+		}
+		dest.staging = staging
+		dest.LocalPath = staging
+		if err := dest.writeKeyFile(s); err != nil {
+			dest.Close(context.Background())
+			return nil, err
+		}
+		dest.Description = fmt.Sprintf("%s (%s)", t.Name, targetURL(t, remoteDir))
+
+	default:
+		return nil, fmt.Errorf("unsupported restore target type: %s", t.TargetType)
+	}
+	return dest, nil
+}
+
+// mount mounts an SMB or NFS target on a fresh mount point. Mount points live
+// in an unprefixed subdirectory of the scratch dir so that orphan cleanup can
+// never recurse into a share left mounted by a crash.
+func (d *remoteDestination) mount(ctx context.Context, s *Service) error {
+	mountRoot := filepath.Join(s.scratch.Root(), "mounts")
+	if err := os.MkdirAll(mountRoot, 0700); err != nil {
+		return fmt.Errorf("failed to create mount directory: %w", err)
+	}
+	mountPoint, err := os.MkdirTemp(mountRoot, "restore-")
+	if err != nil {
+		return fmt.Errorf("failed to create mount point: %w", err)
+	}
+
+	var args []string
+	if d.target.TargetType == models.RestoreDestSMB {
+		contents, err := smbCredentials(d.target)
+		if err != nil {
+			os.Remove(mountPoint)
+			return err
+		}
+		credFile, err := s.scratch.CreateTemp("smbcred-*")
+		if err != nil {
+			os.Remove(mountPoint)
+			return fmt.Errorf("failed to create credentials file: %w", err)
+		}
+		defer os.Remove(credFile.Name())
+		_, werr := credFile.WriteString(contents)
+		if cerr := credFile.Close(); werr == nil {
+			werr = cerr
+		}
+		if werr != nil {
+			os.Remove(mountPoint)
+			return fmt.Errorf("failed to write credentials file: %w", werr)
+		}
+		args = smbMountArgs(d.target, mountPoint, credFile.Name())
+	} else {
+		args = nfsMountArgs(d.target, mountPoint)
+	}
+
+	if err := runTargetCommand(ctx, "mount", args...); err != nil {
+		os.Remove(mountPoint)
+		return fmt.Errorf("failed to mount %s: %w", targetURL(d.target, ""), err)
+	}
+	d.mountPoint = mountPoint
+	return nil
+}
+
+// writeKeyFile writes the target's SSH private key to a 0600 scratch file.
+func (d *remoteDestination) writeKeyFile(s *Service) error {
+	if d.target.Secret == "" {
+		return nil
+	}
+	f, err := s.scratch.CreateTemp("sshkey-*")
+	if err != nil {
+		return fmt.Errorf("failed to create key file: %w", err)
+	}
+	d.keyFile = f.Name()
+	key := d.target.Secret
+	if !strings.HasSuffix(key, "\n") {
+		key += "\n"
+	}
+	_, werr := f.WriteString(key)
+	if cerr := f.Close(); werr == nil {
+		werr = cerr
+	}
+	if werr != nil {
+		return fmt.Errorf("failed to write key file: %w", werr)
+	}
+	return nil
+}
+
+// Deliver pushes staged files to an SSH target. Mounted targets were written
+// in place, so there is nothing left to do for them.
+func (d *remoteDestination) Deliver(ctx context.Context) error {
+	if d.target.TargetType != models.RestoreDestSSH {
+		return nil
+	}
+	ssh := sshArgs(d.target, d.keyFile)
+	mkdir := append(append([]string{}, ssh...), "--", sshDestination(d.target), "mkdir -p "+shellQuote(d.remoteDir))
+	if err := runTargetCommand(ctx, "ssh", mkdir...); err != nil {
+		return fmt.Errorf("failed to create remote directory: %w", err)
+	}
+	return runTargetCommand(ctx, "rsync", rsyncArgs(d.target, d.staging, d.remoteDir, d.keyFile)...)
+}
+
+// Close unmounts the target and removes staging and credential files.
+func (d *remoteDestination) Close(ctx context.Context) {
+	if d.mountPoint != "" {
+		if err := runTargetCommand(ctx, "umount", d.mountPoint); err != nil {
+			d.logger("Failed to unmount restore target", map[string]interface{}{
+				"mount_point": d.mountPoint,
+				"error":       err.Error(),
+			})
+		} else {
+			// Remove (not RemoveAll) so a failed unmount can never touch the share
+			os.Remove(d.mountPoint)
+		}
+	}
+	if d.staging != "" {
+		os.RemoveAll(d.staging)
+	}
+	if d.keyFile != "" {
+		os.Remove(d.keyFile)
+	}
+}
+
+// runTargetCommand runs an external command and folds its stderr into the error.
+func runTargetCommand(ctx context.Context, name string, args ...string) error {
+	cmd := exec.CommandContext(ctx, name, args...)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("%s failed (%s)", name, cmdutil.ErrorDetail(err, &stderr))
+	}
+	return nil
+}
+
+// smbCredentials returns the contents of a mount.cifs credentials file, which
+// keeps the password off the mount command line. A line break in a field
+// would add lines, and so options, to the file.
+func smbCredentials(t *models.RestoreTarget) (string, error) {
+	if strings.ContainsAny(t.Username+t.Domain+t.Secret, "\r\n") {
+		return "", fmt.Errorf("username, domain and password must not contain line breaks")
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "username=%s\n", t.Username)
+	fmt.Fprintf(&b, "password=%s\n", t.Secret)
+	if t.Domain != "" {
+		fmt.Fprintf(&b, "domain=%s\n", t.Domain)
+	}
+	return b.String(), nil
+}
+
+// smbMountArgs returns the mount arguments for an SMB target.
+func smbMountArgs(t *models.RestoreTarget, mountPoint, credFile string) []string {
+	opts := []string{"credentials=" + credFile}
+	if t.Port > 0 {
+		opts = append(opts, "port="+strconv.Itoa(t.Port))
+	}
+	if t.MountOptions != "" {
+		opts = append(opts, t.MountOptions)
+	}
+	share := strings.Trim(t.Share, "/")
+	return []string{"-t", "cifs", "-o", strings.Join(opts, ","), "--", "//" + t.Host + "/" + share, mountPoint}
+}
+
+// nfsMountArgs returns the mount arguments for an NFS target.
+func nfsMountArgs(t *models.RestoreTarget, mountPoint string) []string {
+	var opts []string
+	if t.Port > 0 {
+		opts = append(opts, "port="+strconv.Itoa(t.Port))
+	}
+	if t.MountOptions != "" {
+		opts = append(opts, t.MountOptions)
+	}
+	args := []string{"-t", "nfs"}
+	if len(opts) > 0 {
+		args = append(args, "-o", strings.Join(opts, ","))
+	}
+	return append(args, "--", t.Host+":"+t.Share, mountPoint)
+}
+
+// sshArgs returns the ssh options shared by connection tests, remote mkdir
+// and rsync. BatchMode stops ssh from ever prompting for a password.
+func sshArgs(t *models.RestoreTarget, keyFile string) []string {
+	port := t.Port
+	if port == 0 {
+		port = defaultSSHPort
+	}
+	args := []string{"-p", strconv.Itoa(port), "-o", "BatchMode=yes", "-o", "StrictHostKeyChecking=accept-new"}
+	if keyFile != "" {
+		args = append(args, "-i", keyFile, "-o", "IdentitiesOnly=yes")
+	}
+	return args
+}
+
+// sshDestination returns user@host for an SSH target.
+func sshDestination(t *models.RestoreTarget) string {
+	return t.Username + "@" + t.Host
+}
+
+// rsyncArgs returns the rsync arguments that copy the contents of staging
+// into remoteDir on an SSH target.
+func rsyncArgs(t *models.RestoreTarget, staging, remoteDir, keyFile string) []string {
+	sshCmd := "ssh"
+	for _, a := range sshArgs(t, keyFile) {
+		sshCmd += " " + shellQuote(a)
+	}
+	return []string{
+		"-a",
+		"--protect-args", // remote paths may contain spaces
+		"-e", sshCmd,
+		"--",
+		strings.TrimSuffix(staging, "/") + "/",
+		sshDestination(t) + ":" + strings.TrimSuffix(remoteDir, "/") + "/",
+	}
+}
+
+// targetURL describes a target location for logs and the audit trail.
+func targetURL(t *models.RestoreTarget, p string) string {
+	switch t.TargetType {
+	case models.RestoreDestSMB:
+		return "//" + t.Host + "/" + strings.Trim(t.Share, "/") + p
+	case models.RestoreDestNFS:
+		return t.Host + ":" + t.Share + p
+	default:
+		return sshDestination(t) + ":" + p
+	}
+}
+
+// safeJoin joins elems onto root and rejects results that escape root.
+func safeJoin(root string, elems ...string) (string, error) {
+	joined := filepath.Join(append([]string{root}, elems...)...)
+	rel, err := filepath.Rel(root, joined)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("destination path escapes the restore target")
+	}
+	return joined, nil
+}
+
+// shellQuote single-quotes s for a POSIX shell.
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
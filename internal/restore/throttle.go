@@ -0,0 +1,108 @@
+package restore
+
+import (
+	"context"
+	"io"
+	"time"
+)
+
+// throttleChunks is how many reads a second of data is split into, so a
+// limited restore writes steadily instead of in one burst a second
+const throttleChunks = 10
+
+// rateLimiter paces a stream to rate bytes a second on average
+type rateLimiter struct {
+	ctx   context.Context
+	rate  int64
+	start time.Time
+	done  int64
+}
+
+// wait accounts for n more bytes and sleeps until the stream is back within
+// the rate. It returns early with the context's error when ctx is cancelled.
+func (l *rateLimiter) wait(n int) error {
+	if l.start.IsZero() {
+		l.start = time.Now()
+	}
+	l.done += int64(n)
+	due := l.start.Add(time.Duration(float64(l.done) / float64(l.rate) * float64(time.Second)))
+	wait := time.Until(due)
+	if wait <= 0 {
+		return nil
+	}
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-l.ctx.Done():
+		return l.ctx.Err()
+	}
+}
+
+// throttledReader passes reads through at no more than the limiter's rate
+type throttledReader struct {
+	r       io.Reader
+	limiter *rateLimiter
+}
+
+// throttle returns r limited to rate bytes a second, or r itself when rate
+// is 0 (unlimited)
+func throttle(ctx context.Context, r io.Reader, rate int64) io.Reader {
+	if rate <= 0 {
+		return r
+	}
+	return &throttledReader{r: r, limiter: &rateLimiter{ctx: ctx, rate: rate}}
+}
+
+func (t *throttledReader) Read(p []byte) (int, error) {
+	if chunk := t.limiter.rate / throttleChunks; chunk > 0 && int64(len(p)) > chunk {
+		p = p[:chunk]
+	}
+	n, err := t.r.Read(p)
+	if werr := t.limiter.wait(n); werr != nil {
+		return n, werr
+	}
+	return n, err
+}
+
+// throttledWriter passes writes through at no more than the limiter's rate
+type throttledWriter struct {
+	w       io.WriteCloser
+	limiter *rateLimiter
+}
+
+// throttleWriter returns w limited to rate bytes a second, or w itself when
+// rate is 0 (unlimited)
+func throttleWriter(ctx context.Context, w io.WriteCloser, rate int64) io.WriteCloser {
+	if rate <= 0 {
+		return w
+	}
+	return &throttledWriter{w: w, limiter: &rateLimiter{ctx: ctx, rate: rate}}
+}
+
+func (t *throttledWriter) Write(p []byte) (int, error) {
+	n, err := t.w.Write(p)
+	if err != nil {
+		return n, err
+	}
+	return n, t.limiter.wait(n)
+}
+
+func (t *throttledWriter) Close() error {
+	return t.w.Close()
+}
+
+// rateLimit returns the bytes a second a restore is limited to: the
+// request's own limit when it sets one, the configured default otherwise.
+// 0 means unlimited.
+func (s *Service) rateLimit(req *RestoreRequest) int64 {
+	mbps := s.rateLimitMBps
+	if req.RateLimitMBps != nil {
+		mbps = *req.RateLimitMBps
+	}
+	if mbps <= 0 {
+		return 0
+	}
+	return int64(mbps) << 20
+}
@@ -0,0 +1,60 @@
+package restore
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"testing"
+	"time"
+)
+
+func TestThrottle(t *testing.T) {
+	ctx := context.Background()
+	data := bytes.Repeat([]byte("x"), 300*1024)
+
+	// 1 MB/s: 300 KB takes about 0.3s
+	start := time.Now()
+	n, err := io.Copy(io.Discard, throttle(ctx, bytes.NewReader(data), 1<<20))
+	elapsed := time.Since(start)
+	if err != nil || n != int64(len(data)) {
+		t.Fatalf("copied %d bytes: %v", n, err)
+	}
+	if elapsed < 250*time.Millisecond || elapsed > 2*time.Second {
+		t.Errorf("expected about 300ms at 1 MB/s, took %v", elapsed)
+	}
+
+	if r := bytes.NewReader(data); throttle(ctx, r, 0) != io.Reader(r) {
+		t.Error("expected no limit to return the reader itself")
+	}
+
+	// A cancelled restore stops waiting
+	cancelled, cancel := context.WithCancel(ctx)
+	cancel()
+	w := throttleWriter(cancelled, nopWriteCloser{io.Discard}, 1<<20)
+	if _, err := w.Write(data); !errors.Is(err, context.Canceled) {
+		t.Errorf("expected a cancelled write to return the context error, got %v", err)
+	}
+}
+
+func TestRateLimit(t *testing.T) {
+	s := &Service{}
+	if got := s.rateLimit(&RestoreRequest{}); got != 0 {
+		t.Errorf("expected no limit by default, got %d", got)
+	}
+	s.SetRateLimit(50)
+	if got := s.rateLimit(&RestoreRequest{}); got != 50<<20 {
+		t.Errorf("expected the configured default, got %d", got)
+	}
+	own, off := 10, 0
+	if got := s.rateLimit(&RestoreRequest{RateLimitMBps: &own}); got != 10<<20 {
+		t.Errorf("expected the request's own limit, got %d", got)
+	}
+	if got := s.rateLimit(&RestoreRequest{RateLimitMBps: &off}); got != 0 {
+		t.Errorf("expected 0 on the request to lift the default, got %d", got)
+	}
+}
+
+type nopWriteCloser struct{ io.Writer }
+
+func (nopWriteCloser) Close() error { return nil }
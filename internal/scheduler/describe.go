@@ -0,0 +1,216 @@
+package scheduler
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var weekdayNames = []string{"Sunday", "Monday", "Tuesday", "Wednesday", "Thursday", "Friday", "Saturday", "Sunday"}
+
+var monthNames = []string{"", "January", "February", "March", "April", "May", "June",
+	"July", "August", "September", "October", "November", "December"}
+
+// splitTimezone separates a CRON_TZ= or TZ= prefix from a cron expression
+func splitTimezone(expr string) (tz, spec string) {
+	expr = strings.TrimSpace(expr)
+	for _, prefix := range []string{"CRON_TZ=", "TZ="} {
+		if strings.HasPrefix(expr, prefix) {
+			if i := strings.IndexAny(expr, " \t"); i > 0 {
+				return expr[len(prefix):i], strings.TrimSpace(expr[i:])
+			}
+		}
+	}
+	return "", expr
+}
+
+// Describe returns a plain-English description of a six-field cron
+// expression, such as "At 02:00, on Monday through Friday". The expression
+// is validated first.
+func Describe(expr string) (string, error) {
+	if _, err := ParseSchedule(expr); err != nil {
+		return "", err
+	}
+	tz, spec := splitTimezone(expr)
+	fields := strings.Fields(spec)
+	sec, min, hour, dom, month, dow := fields[0], fields[1], fields[2], fields[3], fields[4], fields[5]
+
+	var clauses []string
+	s, sOK := singleValue(sec)
+	m, mOK := singleValue(min)
+	h, hOK := singleValue(hour)
+	if sOK && mOK && hOK {
+		at := fmt.Sprintf("at %02d:%02d", h, m)
+		if s != 0 {
+			at += fmt.Sprintf(":%02d", s)
+		}
+		clauses = append(clauses, at)
+	} else {
+		clauses = timeClauses([]string{sec, min, hour}, []string{"second", "minute", "hour"})
+	}
+
+	dayRestricted := false
+	if !isWildcard(dom) && !isWildcard(dow) {
+		clauses = append(clauses, "on "+listPhrase(dom, "day", nil)+" of the month or on "+listPhrase(dow, "", weekdayNames))
+		dayRestricted = true
+	} else if !isWildcard(dom) {
+		clauses = append(clauses, "on "+listPhrase(dom, "day", nil)+" of the month")
+		dayRestricted = true
+	} else if !isWildcard(dow) {
+		clauses = append(clauses, "on "+listPhrase(dow, "", weekdayNames))
+		dayRestricted = true
+	}
+	if !isWildcard(month) {
+		clauses = append(clauses, "in "+listPhrase(month, "month", monthNames))
+		dayRestricted = true
+	}
+	if !dayRestricted && sOK && mOK && hOK {
+		clauses = append(clauses, "every day")
+	}
+
+	desc := strings.Join(clauses, ", ")
+	if tz != "" {
+		desc += " (" + tz + ")"
+	}
+	return strings.ToUpper(desc[:1]) + desc[1:], nil
+}
+
+// timeClauses describes the second, minute and hour fields. A wildcard is
+// only spelled out when it adds something ("every hour"); zero fields below
+// the first interesting one are left out.
+func timeClauses(fields, units []string) []string {
+	var clauses []string
+	smallerAllZero := true
+	lastFixed := false
+	for i, f := range fields {
+		switch {
+		case isWildcard(f):
+			// "at minute 30, every hour" but just "every 15 minutes"
+			if smallerAllZero || lastFixed {
+				clauses = append(clauses, "every "+units[i])
+			}
+			lastFixed = false
+		case f == "0" && smallerAllZero:
+			// leading zero fields add nothing
+		default:
+			clauses = append(clauses, rangePhrase(f, units[i]))
+			lastFixed = !strings.ContainsAny(f, "/-")
+		}
+		if f != "0" {
+			smallerAllZero = false
+		}
+	}
+	return clauses
+}
+
+// rangePhrase describes one field of the time part, e.g. "every 15 minutes"
+func rangePhrase(f, unit string) string {
+	if base, step, ok := strings.Cut(f, "/"); ok {
+		phrase := fmt.Sprintf("every %s %ss", step, unit)
+		switch {
+		case base == "*":
+		case strings.Contains(base, "-"):
+			lo, hi, _ := strings.Cut(base, "-")
+			phrase += fmt.Sprintf(" from %s through %s", lo, hi)
+		default:
+			phrase += " starting at " + base
+		}
+		return phrase
+	}
+	if lo, hi, ok := strings.Cut(f, "-"); ok && !strings.Contains(f, ",") {
+		return fmt.Sprintf("every %s from %s through %s", unit, lo, hi)
+	}
+	return listPhrase(f, unit, nil)
+}
+
+// listPhrase describes a list or range of values, using names when given
+// ("Monday through Friday", "day 1 and 15", "minutes 0 and 30").
+func listPhrase(f, unit string, names []string) string {
+	if base, step, ok := strings.Cut(f, "/"); ok {
+		phrase := fmt.Sprintf("every %s %ss", step, unit)
+		if unit == "" {
+			phrase = fmt.Sprintf("every %s days", step)
+		}
+		if base != "*" && base != "?" {
+			phrase += " from " + listPhrase(base, "", names)
+		}
+		return phrase
+	}
+
+	parts := strings.Split(f, ",")
+	for i, p := range parts {
+		if lo, hi, ok := strings.Cut(p, "-"); ok {
+			parts[i] = valueName(lo, names) + " through " + valueName(hi, names)
+		} else {
+			parts[i] = valueName(p, names)
+		}
+	}
+	phrase := parts[0]
+	if len(parts) > 1 {
+		phrase = strings.Join(parts[:len(parts)-1], ", ") + " and " + parts[len(parts)-1]
+	}
+	if unit == "" || names != nil {
+		return phrase
+	}
+	if len(parts) > 1 || strings.Contains(f, "-") {
+		unit += "s"
+	}
+	if unit == "day" || unit == "days" {
+		return unit + " " + phrase
+	}
+	return "at " + unit + " " + phrase
+}
+
+// valueName turns a field value into its name (weekday, month), title-casing
+// names already written as text such as MON or JAN
+func valueName(v string, names []string) string {
+	if names == nil {
+		return v
+	}
+	if n, err := strconv.Atoi(v); err == nil && n >= 0 && n < len(names) && names[n] != "" {
+		return names[n]
+	}
+	lower := strings.ToLower(v)
+	for _, name := range names {
+		if name != "" && strings.HasPrefix(strings.ToLower(name), lower) {
+			return name
+		}
+	}
+	return v
+}
+
+func isWildcard(f string) bool {
+	return f == "*" || f == "?"
+}
+
+// singleValue reports whether a field is one plain number
+func singleValue(f string) (int, bool) {
+	n, err := strconv.Atoi(f)
+	return n, err == nil
+}
+
+// NextRuns returns the next count fire times of a cron expression after
+// from, in the expression's CRON_TZ time zone or the server's local one.
+func NextRuns(expr string, from time.Time, count int) ([]time.Time, *time.Location, error) {
+	schedule, err := ParseSchedule(expr)
+	if err != nil {
+		return nil, nil, err
+	}
+	loc := time.Local
+	if tz, _ := splitTimezone(expr); tz != "" {
+		if l, err := time.LoadLocation(tz); err == nil {
+			loc = l
+		}
+	}
+	runs := make([]time.Time, 0, count)
+	next := from.In(loc)
+	for i := 0; i < count; i++ {
+		next = schedule.Next(next)
+		if next.IsZero() {
+			break
+		}
+		runs = append(runs, next)
+	}
+	return runs, loc, nil
+}
@@ -0,0 +1,61 @@
+package scheduler
+
+import (
+	"testing"
+	"time"
+)
+
+func TestDescribe(t *testing.T) {
+	tests := []struct {
+		expr string
+		want string
+	}{
+		{"0 0 2 * * *", "At 02:00, every day"},
+		{"0 30 1 * * 0", "At 01:30, on Sunday"},
+		{"15 30 1 * * *", "At 01:30:15, every day"},
+		{"0 0 22 * * 1-5", "At 22:00, on Monday through Friday"},
+		{"0 0 3 1,15 * *", "At 03:00, on days 1 and 15 of the month"},
+		{"0 0 0 1 JAN *", "At 00:00, on day 1 of the month, in January"},
+		{"0 */15 * * * *", "Every 15 minutes"},
+		{"0 0 */6 * * *", "Every 6 hours"},
+		{"0 0 * * * *", "Every hour"},
+		{"0 * * * * *", "Every minute"},
+		{"*/10 * * * * *", "Every 10 seconds"},
+		{"0 30 * * * *", "At minute 30, every hour"},
+		{"0 0,30 9-17 * * MON-FRI", "At minutes 0 and 30, every hour from 9 through 17, on Monday through Friday"},
+		{"CRON_TZ=Europe/Berlin 0 0 2 * * *", "At 02:00, every day (Europe/Berlin)"},
+	}
+	for _, tt := range tests {
+		got, err := Describe(tt.expr)
+		if err != nil {
+			t.Errorf("Describe(%q): %v", tt.expr, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("Describe(%q) = %q, want %q", tt.expr, got, tt.want)
+		}
+	}
+
+	for _, bad := range []string{"", "0 2 * * *", "0 0 25 * * *", "@daily"} {
+		if _, err := Describe(bad); err == nil {
+			t.Errorf("Describe(%q): expected an error", bad)
+		}
+	}
+}
+
+func TestNextRuns(t *testing.T) {
+	from := time.Date(2026, 1, 5, 12, 0, 0, 0, time.UTC)
+	runs, loc, err := NextRuns("CRON_TZ=UTC 0 0 2 * * *", from, 5)
+	if err != nil {
+		t.Fatalf("NextRuns: %v", err)
+	}
+	if loc.String() != "UTC" || len(runs) != 5 {
+		t.Fatalf("expected 5 runs in UTC, got %d in %s", len(runs), loc)
+	}
+	if want := time.Date(2026, 1, 6, 2, 0, 0, 0, time.UTC); !runs[0].Equal(want) {
+		t.Errorf("first run = %s, want %s", runs[0], want)
+	}
+	if !runs[4].Equal(runs[0].Add(4 * 24 * time.Hour)) {
+		t.Errorf("expected daily runs, got %v", runs)
+	}
+}
@@ -0,0 +1,33 @@
+package scheduler
+
+import "github.com/robfig/cron/v3"
+
+// SetMaintenance runs fn on the given cron schedule (with seconds) under a
+// name such as "integrity_check". Maintenance keeps running while the
+// scheduler is paused. Calling it again with the same name replaces the
+// earlier schedule.
+func (s *Service) SetMaintenance(name, spec string, fn func()) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if entryID, ok := s.maintenance[name]; ok {
+		s.cron.Remove(entryID)
+		delete(s.maintenance, name)
+	}
+	entryID, err := s.cron.AddFunc(spec, fn)
+	if err != nil {
+		return err
+	}
+	if s.maintenance == nil {
+		s.maintenance = make(map[string]cron.EntryID)
+	}
+	s.maintenance[name] = entryID
+	return nil
+}
+
+// SetBeforeRun registers a function called before each scheduled job run,
+// after the pause checks
+func (s *Service) SetBeforeRun(fn func()) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.beforeRun = fn
+}
@@ -2,6 +2,8 @@ package scheduler
 
 import (
 	"context"
+	"database/sql"
+	"sort"
 	"sync"
 	"time"
 
@@ -12,19 +14,83 @@ import (
 	"github.com/robfig/cron/v3"
 )
 
-// JobRunner is a function that runs a backup job
+// JobRunner is a function that runs a backup job. The context is cancelled
+// when the scheduler stops and the run outlives the shutdown grace period.
 type JobRunner func(ctx context.Context, job *models.BackupJob) error
 
+// ShutdownPolicy decides what happens to scheduled runs still going when
+// the scheduler stops
+type ShutdownPolicy struct {
+	// Grace is how long Stop waits for running jobs to finish by themselves
+	// before cancelling them
+	Grace time.Duration
+	// Checkpoint, when set, is called for each job still running after the
+	// grace period, just before it is cancelled, so the run can be resumed
+	// later
+	Checkpoint func(jobID int64)
+}
+
 // Service manages job scheduling
 type Service struct {
-	db        *database.DB
-	logger    *logging.Logger
-	cron      *cron.Cron
-	jobRunner JobRunner
-	mu        sync.RWMutex
-	entries   map[int64]cron.EntryID
-	ctx       context.Context
-	cancel    context.CancelFunc
+	db         *database.DB
+	logger     *logging.Logger
+	cron       *cron.Cron
+	jobRunner  JobRunner
+	mu         sync.RWMutex
+	entries    map[int64]cron.EntryID
+	jobs       map[int64]models.BackupJob
+	loadErrors map[int64]LoadError
+	started    bool
+	paused     bool
+	pausedAt   *time.Time
+	pausedBy   string
+	// standby is set while this server replicates another one, see
+	// SetStandby
+	standby  bool
+	lastTick time.Time
+	// backup window report, see SetWindowReport
+	windowEntry cron.EntryID
+	windowStart time.Time
+	failures    []RunFailure
+	// maintenance tasks by name, see SetMaintenance
+	maintenance map[string]cron.EntryID
+	// called before each scheduled run, see SetBeforeRun
+	beforeRun func()
+	// scheduled runs in progress, see Stop
+	running  map[int64]bool
+	shutdown ShutdownPolicy
+	ctx      context.Context
+	cancel   context.CancelFunc
+}
+
+// LoadError records a job whose schedule could not be added to the scheduler
+type LoadError struct {
+	JobID    int64  `json:"job_id"`
+	JobName  string `json:"job_name"`
+	Schedule string `json:"schedule"`
+	Error    string `json:"error"`
+}
+
+// JobStatus describes a scheduled job and its upcoming runs
+type JobStatus struct {
+	JobID    int64       `json:"job_id"`
+	JobName  string      `json:"job_name"`
+	Schedule string      `json:"schedule"`
+	Paused   bool        `json:"paused"`
+	PrevRun  *time.Time  `json:"prev_run,omitempty"`
+	NextRuns []time.Time `json:"next_runs"`
+}
+
+// Status is a snapshot of the scheduler's state
+type Status struct {
+	Running  bool        `json:"running"`
+	Paused   bool        `json:"paused"`
+	PausedAt *time.Time  `json:"paused_at,omitempty"`
+	PausedBy string      `json:"paused_by,omitempty"`
+	Standby  bool        `json:"standby,omitempty"`
+	LastTick *time.Time  `json:"last_tick,omitempty"`
+	Jobs     []JobStatus `json:"jobs"`
+	Errors   []LoadError `json:"errors"`
 }
 
 // NewService creates a new scheduler service
@@ -32,13 +98,16 @@ func NewService(db *database.DB, logger *logging.Logger, jobRunner JobRunner) *S
 	ctx, cancel := context.WithCancel(context.Background())
 
 	return &Service{
-		db:        db,
-		logger:    logger,
-		cron:      cron.New(cron.WithSeconds()),
-		jobRunner: jobRunner,
-		entries:   make(map[int64]cron.EntryID),
-		ctx:       ctx,
-		cancel:    cancel,
+		db:         db,
+		logger:     logger,
+		cron:       cron.New(cron.WithSeconds()),
+		jobRunner:  jobRunner,
+		entries:    make(map[int64]cron.EntryID),
+		jobs:       make(map[int64]models.BackupJob),
+		loadErrors: make(map[int64]LoadError),
+		running:    make(map[int64]bool),
+		ctx:        ctx,
+		cancel:     cancel,
 	}
 }
 
@@ -46,12 +115,20 @@ func NewService(db *database.DB, logger *logging.Logger, jobRunner JobRunner) *S
 func (s *Service) Start() error {
 	s.logger.Info("Starting scheduler", nil)
 
+	if err := s.loadPauseState(); err != nil {
+		return err
+	}
+
 	// Load all enabled jobs
 	if err := s.loadJobs(); err != nil {
 		return err
 	}
 
 	s.cron.Start()
+	s.mu.Lock()
+	s.started = true
+	s.lastTick = time.Now()
+	s.mu.Unlock()
 
 	// Start next run updater
 	go s.updateNextRuns()
@@ -59,12 +136,82 @@ func (s *Service) Start() error {
 	return nil
 }
 
-// Stop stops the scheduler
+// SetShutdownPolicy sets how Stop treats scheduled runs still in progress
+func (s *Service) SetShutdownPolicy(policy ShutdownPolicy) {
+	s.mu.Lock()
+	s.shutdown = policy
+	s.mu.Unlock()
+}
+
+// Stop stops the scheduler. No new runs start; runs in progress get the
+// shutdown grace period to finish, are then checkpointed if the policy
+// says so, and cancelled. Stop returns once every run has returned.
 func (s *Service) Stop() {
 	s.logger.Info("Stopping scheduler", nil)
+	done := s.cron.Stop()
+
+	s.mu.RLock()
+	policy := s.shutdown
+	running := len(s.running)
+	s.mu.RUnlock()
+	if running > 0 && policy.Grace > 0 {
+		s.logger.Info("Waiting for scheduled jobs to finish", map[string]interface{}{
+			"running": running,
+			"grace":   policy.Grace.String(),
+		})
+		select {
+		case <-done.Done():
+		case <-time.After(policy.Grace):
+		}
+	}
+
+	s.mu.RLock()
+	jobIDs := make([]int64, 0, len(s.running))
+	for jobID := range s.running {
+		jobIDs = append(jobIDs, jobID)
+	}
+	s.mu.RUnlock()
+	if len(jobIDs) > 0 {
+		checkpoint := policy.Checkpoint != nil
+		s.logger.Warn("Cancelling scheduled jobs still running at shutdown", map[string]interface{}{
+			"job_ids":    jobIDs,
+			"checkpoint": checkpoint,
+		})
+		if checkpoint {
+			for _, jobID := range jobIDs {
+				policy.Checkpoint(jobID)
+			}
+		}
+	}
+
 	s.cancel()
-	ctx := s.cron.Stop()
-	<-ctx.Done()
+	<-done.Done()
+	s.mu.Lock()
+	s.started = false
+	s.mu.Unlock()
+}
+
+// loadPauseState restores a scheduler-wide pause that outlived a restart
+func (s *Service) loadPauseState() error {
+	var paused bool
+	var pausedAt *time.Time
+	var pausedBy string
+	err := s.db.QueryRow("SELECT paused, paused_at, paused_by FROM scheduler_state WHERE id = 1").Scan(&paused, &pausedAt, &pausedBy)
+	if err == sql.ErrNoRows {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	s.paused, s.pausedAt, s.pausedBy = paused, pausedAt, pausedBy
+	s.mu.Unlock()
+	if paused {
+		s.logger.Warn("Scheduler is paused; scheduled runs will be skipped until it is resumed", map[string]interface{}{
+			"paused_by": pausedBy,
+		})
+	}
+	return nil
 }
 
 // loadJobs loads all enabled jobs from the database
@@ -73,7 +220,11 @@ func (s *Service) loadJobs() error {
 		SELECT id, name, source_id, pool_id, backup_type, schedule_cron, retention_days, enabled,
 		       encryption_enabled, encryption_key_id,
 		       COALESCE(hw_encryption_enabled, 0), hw_encryption_key_id,
-		       compression
+		       compression, COALESCE(dedup_enabled, 0), COALESCE(pipelined_scan, 0), COALESCE(directory_report, 0),
+		       COALESCE(change_detection, 'metadata'), COALESCE(hash_sampled, 0), COALESCE(snapshot_retention, 0),
+		       COALESCE(full_every_incrementals, 0), COALESCE(full_every_days, 0),
+		       COALESCE(schedule_paused, 0),
+		       guard_max_files, guard_max_bytes, guard_max_change_percent, guard_action
 		FROM backup_jobs WHERE enabled = 1 AND schedule_cron IS NOT NULL AND schedule_cron != ''
 	`)
 	if err != nil {
@@ -86,7 +237,11 @@ func (s *Service) loadJobs() error {
 		if err := rows.Scan(&job.ID, &job.Name, &job.SourceID, &job.PoolID, &job.BackupType, &job.ScheduleCron, &job.RetentionDays, &job.Enabled,
 			&job.EncryptionEnabled, &job.EncryptionKeyID,
 			&job.HwEncryptionEnabled, &job.HwEncryptionKeyID,
-			&job.Compression); err != nil {
+			&job.Compression, &job.DedupEnabled, &job.PipelinedScan, &job.DirectoryReport,
+			&job.ChangeDetection, &job.HashSampled, &job.SnapshotRetention,
+			&job.FullEveryIncrementals, &job.FullEveryDays,
+			&job.SchedulePaused,
+			&job.GuardMaxFiles, &job.GuardMaxBytes, &job.GuardMaxChangePercent, &job.GuardAction); err != nil {
 			s.logger.Warn("Failed to scan job", map[string]interface{}{"error": err.Error()})
 			continue
 		}
@@ -112,6 +267,8 @@ func (s *Service) scheduleJob(job *models.BackupJob) error {
 		s.cron.Remove(entryID)
 		delete(s.entries, job.ID)
 	}
+	delete(s.jobs, job.ID)
+	delete(s.loadErrors, job.ID)
 
 	if !job.Enabled || job.ScheduleCron == "" {
 		return nil
@@ -124,10 +281,17 @@ func (s *Service) scheduleJob(job *models.BackupJob) error {
 		s.runJob(&jobCopy)
 	})
 	if err != nil {
+		s.loadErrors[job.ID] = LoadError{
+			JobID:    job.ID,
+			JobName:  job.Name,
+			Schedule: job.ScheduleCron,
+			Error:    err.Error(),
+		}
 		return err
 	}
 
 	s.entries[job.ID] = entryID
+	s.jobs[job.ID] = jobCopy
 
 	s.logger.Info("Scheduled job", map[string]interface{}{
 		"job_id":   job.ID,
@@ -138,13 +302,49 @@ func (s *Service) scheduleJob(job *models.BackupJob) error {
 	return nil
 }
 
-// runJob executes a backup job
+// runJob executes a backup job unless its schedule or the scheduler is paused
 func (s *Service) runJob(job *models.BackupJob) {
+	s.mu.Lock()
+	s.lastTick = time.Now()
+	paused := s.paused
+	standby := s.standby
+	jobPaused := s.jobs[job.ID].SchedulePaused
+	beforeRun := s.beforeRun
+	s.mu.Unlock()
+	if paused || standby || jobPaused {
+		reason := "job schedule paused"
+		if paused {
+			reason = "scheduler paused"
+		}
+		if standby {
+			reason = "standby server"
+		}
+		s.logger.Info("Skipping scheduled job", map[string]interface{}{
+			"job_id":   job.ID,
+			"job_name": job.Name,
+			"reason":   reason,
+		})
+		return
+	}
+
 	s.logger.Info("Running scheduled job", map[string]interface{}{
 		"job_id":   job.ID,
 		"job_name": job.Name,
 	})
 
+	if beforeRun != nil {
+		beforeRun()
+	}
+
+	s.mu.Lock()
+	s.running[job.ID] = true
+	s.mu.Unlock()
+	defer func() {
+		s.mu.Lock()
+		delete(s.running, job.ID)
+		s.mu.Unlock()
+	}()
+
 	ctx, cancel := context.WithTimeout(s.ctx, 24*time.Hour)
 	defer cancel()
 
@@ -153,6 +353,7 @@ func (s *Service) runJob(job *models.BackupJob) {
 			"job_id": job.ID,
 			"error":  err.Error(),
 		})
+		s.recordFailure(RunFailure{JobID: job.ID, JobName: job.Name, At: time.Now(), Error: err.Error()})
 	}
 
 	// Update last run time
@@ -169,6 +370,8 @@ func (s *Service) RemoveJob(jobID int64) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
+	delete(s.jobs, jobID)
+	delete(s.loadErrors, jobID)
 	if entryID, exists := s.entries[jobID]; exists {
 		s.cron.Remove(entryID)
 		delete(s.entries, jobID)
@@ -200,14 +403,15 @@ func (s *Service) updateNextRuns() {
 		case <-s.ctx.Done():
 			return
 		case <-ticker.C:
-			s.mu.RLock()
+			s.mu.Lock()
+			s.lastTick = time.Now()
 			for jobID, entryID := range s.entries {
 				entry := s.cron.Entry(entryID)
 				if !entry.Next.IsZero() {
 					s.db.Exec("UPDATE backup_jobs SET next_run_at = ? WHERE id = ?", entry.Next, jobID)
 				}
 			}
-			s.mu.RUnlock()
+			s.mu.Unlock()
 		}
 	}
 }
@@ -220,6 +424,8 @@ func (s *Service) ReloadJobs() error {
 		s.cron.Remove(entryID)
 		delete(s.entries, jobID)
 	}
+	s.jobs = make(map[int64]models.BackupJob)
+	s.loadErrors = make(map[int64]LoadError)
 	s.mu.Unlock()
 
 	// Reload from database
@@ -244,9 +450,122 @@ func (s *Service) ListScheduledJobs() []map[string]interface{} {
 	return jobs
 }
 
+// Pause stops scheduled runs from starting until Resume is called. Jobs stay
+// loaded so their upcoming runs can still be previewed. The pause is stored
+// so it survives a restart.
+func (s *Service) Pause(by string) error {
+	now := time.Now()
+	if _, err := s.db.Exec("UPDATE scheduler_state SET paused = 1, paused_at = ?, paused_by = ? WHERE id = 1", now, by); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	s.paused, s.pausedAt, s.pausedBy = true, &now, by
+	s.mu.Unlock()
+	s.logger.Info("Scheduler paused", map[string]interface{}{"paused_by": by})
+	return nil
+}
+
+// Resume lets scheduled runs start again after Pause
+func (s *Service) Resume() error {
+	if _, err := s.db.Exec("UPDATE scheduler_state SET paused = 0, paused_at = NULL, paused_by = '' WHERE id = 1"); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	s.paused, s.pausedAt, s.pausedBy = false, nil, ""
+	s.mu.Unlock()
+	s.logger.Info("Scheduler resumed", nil)
+	return nil
+}
+
+// SetStandby stops or allows scheduled runs on a standby server. Unlike
+// Pause it is not stored in the database, which a standby replaces with the
+// primary's, and maintenance keeps running.
+func (s *Service) SetStandby(standby bool) {
+	s.mu.Lock()
+	s.standby = standby
+	s.mu.Unlock()
+}
+
+// SetJobPaused pauses or resumes the schedule of a single job without
+// disabling it. Manual runs are not affected.
+func (s *Service) SetJobPaused(jobID int64, paused bool) error {
+	if _, err := s.db.Exec("UPDATE backup_jobs SET schedule_paused = ? WHERE id = ?", paused, jobID); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	if job, ok := s.jobs[jobID]; ok {
+		job.SchedulePaused = paused
+		s.jobs[jobID] = job
+	}
+	s.mu.Unlock()
+	return nil
+}
+
+// Status returns the scheduler state with each loaded job's next count
+// occurrences and any schedules that failed to load.
+func (s *Service) Status(count int) Status {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	status := Status{
+		Running:  s.started,
+		Paused:   s.paused,
+		PausedAt: s.pausedAt,
+		PausedBy: s.pausedBy,
+		Standby:  s.standby,
+		Jobs:     []JobStatus{},
+		Errors:   []LoadError{},
+	}
+	if !s.lastTick.IsZero() {
+		tick := s.lastTick
+		status.LastTick = &tick
+	}
+
+	now := time.Now()
+	for jobID, entryID := range s.entries {
+		job := s.jobs[jobID]
+		js := JobStatus{
+			JobID:    jobID,
+			JobName:  job.Name,
+			Schedule: job.ScheduleCron,
+			Paused:   job.SchedulePaused,
+			NextRuns: []time.Time{},
+		}
+		entry := s.cron.Entry(entryID)
+		if !entry.Prev.IsZero() {
+			prev := entry.Prev
+			js.PrevRun = &prev
+		}
+		if entry.Schedule != nil {
+			next := now
+			for i := 0; i < count; i++ {
+				next = entry.Schedule.Next(next)
+				if next.IsZero() {
+					break
+				}
+				js.NextRuns = append(js.NextRuns, next)
+			}
+		}
+		status.Jobs = append(status.Jobs, js)
+	}
+	sort.Slice(status.Jobs, func(i, j int) bool { return status.Jobs[i].JobID < status.Jobs[j].JobID })
+
+	for _, e := range s.loadErrors {
+		status.Errors = append(status.Errors, e)
+	}
+	sort.Slice(status.Errors, func(i, j int) bool { return status.Errors[i].JobID < status.Errors[j].JobID })
+	return status
+}
+
 // ParseCron validates a cron expression
 func ParseCron(expr string) error {
-	parser := cron.NewParser(cron.Second | cron.Minute | cron.Hour | cron.Dom | cron.Month | cron.Dow)
-	_, err := parser.Parse(expr)
+	_, err := ParseSchedule(expr)
 	return err
 }
+
+// ParseSchedule parses a six-field cron expression (with seconds) into a
+// schedule that can enumerate future run times.
+func ParseSchedule(expr string) (cron.Schedule, error) {
+	parser := cron.NewParser(cron.Second | cron.Minute | cron.Hour | cron.Dom | cron.Month | cron.Dow)
+	return parser.Parse(expr)
+}
@@ -0,0 +1,61 @@
+package scheduler
+
+import (
+	"context"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/RoseOO/TapeBackarr/internal/database"
+	"github.com/RoseOO/TapeBackarr/internal/logging"
+	"github.com/RoseOO/TapeBackarr/internal/models"
+)
+
+func TestStopCheckpointsAndCancelsRunningJobs(t *testing.T) {
+	db, err := database.New(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("failed to create database: %v", err)
+	}
+	defer db.Close()
+	if err := db.Migrate(); err != nil {
+		t.Fatalf("failed to migrate database: %v", err)
+	}
+	logger, _ := logging.NewLogger("error", "text", "")
+
+	started := make(chan struct{})
+	var runErr error
+	runner := func(ctx context.Context, job *models.BackupJob) error {
+		close(started)
+		<-ctx.Done()
+		runErr = ctx.Err()
+		return runErr
+	}
+	s := NewService(db, logger, runner)
+
+	var checkpointed []int64
+	s.SetShutdownPolicy(ShutdownPolicy{
+		Grace:      50 * time.Millisecond,
+		Checkpoint: func(jobID int64) { checkpointed = append(checkpointed, jobID) },
+	})
+
+	var once sync.Once
+	job := &models.BackupJob{ID: 7, Name: "nightly"}
+	if _, err := s.cron.AddFunc("* * * * * *", func() { once.Do(func() { s.runJob(job) }) }); err != nil {
+		t.Fatal(err)
+	}
+	s.cron.Start()
+	select {
+	case <-started:
+	case <-time.After(3 * time.Second):
+		t.Fatal("job did not start")
+	}
+
+	s.Stop()
+	if len(checkpointed) != 1 || checkpointed[0] != 7 {
+		t.Errorf("expected job 7 to be checkpointed, got %v", checkpointed)
+	}
+	if runErr != context.Canceled {
+		t.Errorf("expected the run to be cancelled, got %v", runErr)
+	}
+}
@@ -0,0 +1,100 @@
+package scheduler
+
+import (
+	"fmt"
+	"time"
+)
+
+// RunFailure records a scheduled run whose job runner returned an error
+type RunFailure struct {
+	JobID   int64     `json:"job_id"`
+	JobName string    `json:"job_name"`
+	At      time.Time `json:"at"`
+	Error   string    `json:"error"`
+}
+
+// WindowReporter is called once per backup window with the window's bounds
+// and the scheduled runs that failed within it.
+type WindowReporter func(from, to time.Time, failures []RunFailure)
+
+// ParseWindowEnd parses a daily "HH:MM" window boundary
+func ParseWindowEnd(end string) (hour, minute int, err error) {
+	t, err := time.Parse("15:04", end)
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid window end %q: expected HH:MM", end)
+	}
+	return t.Hour(), t.Minute(), nil
+}
+
+// SetWindowReport calls fn every day at end (server time, "HH:MM") for the
+// window since the previous call, or the previous 24 hours after a restart.
+// Calling it again replaces the earlier boundary.
+func (s *Service) SetWindowReport(end string, fn WindowReporter) error {
+	hour, minute, err := ParseWindowEnd(end)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.windowEntry != 0 {
+		s.cron.Remove(s.windowEntry)
+	}
+	entryID, err := s.cron.AddFunc(fmt.Sprintf("0 %d %d * * *", minute, hour), func() {
+		s.reportWindow(fn)
+	})
+	if err != nil {
+		return err
+	}
+	s.windowEntry = entryID
+	return nil
+}
+
+// reportWindow hands the current window to fn and starts the next one
+func (s *Service) reportWindow(fn WindowReporter) {
+	to := time.Now()
+	s.mu.Lock()
+	from := s.windowStart
+	if from.IsZero() {
+		from = to.Add(-24 * time.Hour)
+	}
+	s.windowStart = to
+	s.mu.Unlock()
+
+	failures := s.Failures(from, to)
+	s.mu.Lock()
+	kept := s.failures[:0]
+	for _, f := range s.failures {
+		if f.At.After(to) {
+			kept = append(kept, f)
+		}
+	}
+	s.failures = kept
+	s.mu.Unlock()
+
+	fn(from, to, failures)
+}
+
+// recordFailure remembers a failed scheduled run for the window report
+func (s *Service) recordFailure(f RunFailure) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.windowEntry == 0 {
+		return
+	}
+	s.failures = append(s.failures, f)
+}
+
+// Failures returns the failed scheduled runs between from and to that have
+// not been handed to a window report yet
+func (s *Service) Failures(from, to time.Time) []RunFailure {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	failures := []RunFailure{}
+	for _, f := range s.failures {
+		if f.At.After(from) && !f.At.After(to) {
+			failures = append(failures, f)
+		}
+	}
+	return failures
+}
@@ -0,0 +1,44 @@
+package scheduler
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseWindowEnd(t *testing.T) {
+	if h, m, err := ParseWindowEnd("07:30"); err != nil || h != 7 || m != 30 {
+		t.Errorf("ParseWindowEnd(07:30) = %d, %d, %v", h, m, err)
+	}
+	for _, end := range []string{"", "7", "25:00", "07:60", "0 7 * * *"} {
+		if _, _, err := ParseWindowEnd(end); err == nil {
+			t.Errorf("expected %q to be rejected", end)
+		}
+	}
+}
+
+func TestReportWindow(t *testing.T) {
+	s := &Service{windowEntry: 1}
+	s.recordFailure(RunFailure{JobID: 1, JobName: "home", At: time.Now().Add(-25 * time.Hour), Error: "too old"})
+	s.recordFailure(RunFailure{JobID: 2, JobName: "mail", At: time.Now().Add(-time.Hour), Error: "write error"})
+
+	var from, to time.Time
+	var got []RunFailure
+	report := func(f, t time.Time, failures []RunFailure) {
+		from, to, got = f, t, failures
+	}
+	s.reportWindow(report)
+	if to.Sub(from) != 24*time.Hour {
+		t.Errorf("expected the first window to cover 24 hours, got %s", to.Sub(from))
+	}
+	if len(got) != 1 || got[0].JobName != "mail" {
+		t.Errorf("expected only the failure inside the window, got %+v", got)
+	}
+
+	// The next window starts where the last one ended and reports each
+	// failure only once
+	prevEnd := to
+	s.reportWindow(report)
+	if !from.Equal(prevEnd) || len(got) != 0 {
+		t.Errorf("expected an empty window starting at %s, got %s with %+v", prevEnd, from, got)
+	}
+}
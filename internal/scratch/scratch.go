@@ -0,0 +1,199 @@
+// Package scratch manages the temporary working directory used for staging
+// data (file lists, database snapshots, Proxmox spools, restores) so that all
+// temporary files live under one configurable location with free-space checks.
+package scratch
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+)
+
+// Prefix is prepended to every temporary entry created in the scratch
+// directory. Only entries carrying this prefix are removed by CleanOrphans,
+// so pointing the scratch directory at a shared location like /tmp is safe.
+const Prefix = "tapebackarr-"
+
+// ErrInsufficientSpace is returned when the scratch filesystem does not have
+// enough free space for a staging operation.
+var ErrInsufficientSpace = errors.New("insufficient scratch space")
+
+// Dir is a scratch directory with a free-space reserve. A nil *Dir is valid
+// and behaves like the system temp directory without a reserve.
+type Dir struct {
+	root         string
+	minFreeBytes int64
+}
+
+// Usage describes the scratch directory and the filesystem it lives on.
+type Usage struct {
+	Path           string `json:"path"`
+	UsedBytes      int64  `json:"used_bytes"`
+	Entries        int    `json:"entries"`
+	AvailableBytes int64  `json:"available_bytes"`
+	TotalBytes     int64  `json:"total_bytes"`
+	MinFreeBytes   int64  `json:"min_free_bytes"`
+}
+
+// New returns a scratch directory rooted at root that keeps at least
+// minFreeMB megabytes free. An empty root falls back to the system temp dir.
+func New(root string, minFreeMB int) *Dir {
+	if root == "" {
+		root = os.TempDir()
+	}
+	if minFreeMB < 0 {
+		minFreeMB = 0
+	}
+	return &Dir{root: root, minFreeBytes: int64(minFreeMB) * 1024 * 1024}
+}
+
+// Root returns the scratch directory path.
+func (d *Dir) Root() string {
+	if d == nil {
+		return os.TempDir()
+	}
+	return d.root
+}
+
+// MinFreeBytes returns the free-space reserve that staging must not dip into.
+func (d *Dir) MinFreeBytes() int64 {
+	if d == nil {
+		return 0
+	}
+	return d.minFreeBytes
+}
+
+// Ensure creates the scratch directory if it does not exist.
+func (d *Dir) Ensure() error {
+	return os.MkdirAll(d.Root(), 0700)
+}
+
+// Path returns the path of a named entry in the scratch directory. The name
+// is prefixed so the entry is treated as temporary by CleanOrphans.
+func (d *Dir) Path(name string) string {
+	return filepath.Join(d.Root(), Prefix+name)
+}
+
+// MkdirTemp creates a new temporary directory in the scratch directory.
+func (d *Dir) MkdirTemp(pattern string) (string, error) {
+	if err := d.Ensure(); err != nil {
+		return "", err
+	}
+	return os.MkdirTemp(d.Root(), Prefix+pattern)
+}
+
+// CreateTemp creates a new temporary file in the scratch directory.
+func (d *Dir) CreateTemp(pattern string) (*os.File, error) {
+	if err := d.Ensure(); err != nil {
+		return nil, err
+	}
+	return os.CreateTemp(d.Root(), Prefix+pattern)
+}
+
+// CheckSpace verifies that the filesystem holding path (the scratch root when
+// path is empty) can take required more bytes while keeping the reserve free.
+func (d *Dir) CheckSpace(path string, required int64) error {
+	if path == "" {
+		path = d.Root()
+	}
+	available, _, err := FreeSpace(existingParent(path))
+	if err != nil {
+		return fmt.Errorf("failed to check free space on %s: %w", path, err)
+	}
+	if available-d.MinFreeBytes() < required {
+		return fmt.Errorf("%w on %s: need %d bytes plus %d reserved, %d available",
+			ErrInsufficientSpace, path, required, d.MinFreeBytes(), available)
+	}
+	return nil
+}
+
+// CleanOrphans removes temporary entries left behind by a previous run. It
+// must only be called at startup, before any staging operation has begun.
+func (d *Dir) CleanOrphans() ([]string, error) {
+	entries, err := os.ReadDir(d.Root())
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	var removed []string
+	var errs []error
+	for _, e := range entries {
+		if !strings.HasPrefix(e.Name(), Prefix) {
+			continue
+		}
+		path := filepath.Join(d.Root(), e.Name())
+		if err := os.RemoveAll(path); err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		removed = append(removed, path)
+	}
+	return removed, errors.Join(errs...)
+}
+
+// Usage reports how much space temporary entries occupy and how much is
+// left on the scratch filesystem.
+func (d *Dir) Usage() (*Usage, error) {
+	u := &Usage{Path: d.Root(), MinFreeBytes: d.MinFreeBytes()}
+
+	entries, err := os.ReadDir(d.Root())
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	for _, e := range entries {
+		if !strings.HasPrefix(e.Name(), Prefix) {
+			continue
+		}
+		u.Entries++
+		filepath.WalkDir(filepath.Join(d.Root(), e.Name()), func(_ string, de fs.DirEntry, err error) error {
+			if err != nil {
+				return nil
+			}
+			if info, err := de.Info(); err == nil && info.Mode().IsRegular() {
+				u.UsedBytes += info.Size()
+			}
+			return nil
+		})
+	}
+
+	available, total, err := FreeSpace(existingParent(d.Root()))
+	if err != nil {
+		return nil, err
+	}
+	u.AvailableBytes = available
+	u.TotalBytes = total
+	return u, nil
+}
+
+// FreeSpace returns the bytes available to unprivileged users and the total
+// size of the filesystem holding path.
+func FreeSpace(path string) (available, total int64, err error) {
+	var st syscall.Statfs_t
+	if err := syscall.Statfs(path, &st); err != nil {
+		return 0, 0, err
+	}
+	bsize := int64(st.Bsize)
+	return int64(st.Bavail) * bsize, int64(st.Blocks) * bsize, nil
+}
+
+// existingParent walks up from path to the nearest directory that exists so
+// free space can be checked before a staging directory is created.
+func existingParent(path string) string {
+	for {
+		if _, err := os.Stat(path); err == nil {
+			return path
+		}
+		parent := filepath.Dir(path)
+		if parent == path {
+			return path
+		}
+		path = parent
+	}
+}
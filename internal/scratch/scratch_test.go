@@ -0,0 +1,91 @@
+package scratch
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestNilDirFallsBackToTempDir(t *testing.T) {
+	var d *Dir
+	if d.Root() != os.TempDir() {
+		t.Errorf("expected nil Dir root %q, got %q", os.TempDir(), d.Root())
+	}
+	if d.MinFreeBytes() != 0 {
+		t.Errorf("expected no reserve for nil Dir, got %d", d.MinFreeBytes())
+	}
+}
+
+func TestMkdirTempAndCreateTemp(t *testing.T) {
+	root := filepath.Join(t.TempDir(), "scratch")
+	d := New(root, 0)
+
+	dir, err := d.MkdirTemp("db-*")
+	if err != nil {
+		t.Fatalf("MkdirTemp failed: %v", err)
+	}
+	if filepath.Dir(dir) != root || !strings.HasPrefix(filepath.Base(dir), Prefix+"db-") {
+		t.Errorf("unexpected temp dir %q", dir)
+	}
+
+	f, err := d.CreateTemp("filelist-*.txt")
+	if err != nil {
+		t.Fatalf("CreateTemp failed: %v", err)
+	}
+	f.Close()
+	if !strings.HasPrefix(filepath.Base(f.Name()), Prefix+"filelist-") {
+		t.Errorf("unexpected temp file %q", f.Name())
+	}
+}
+
+func TestCleanOrphansOnlyRemovesPrefixedEntries(t *testing.T) {
+	root := t.TempDir()
+	d := New(root, 0)
+
+	orphanDir, _ := d.MkdirTemp("restore-*")
+	os.WriteFile(filepath.Join(orphanDir, "data"), []byte("leftover"), 0600)
+	orphanFile, _ := d.CreateTemp("filelist-*.txt")
+	orphanFile.Close()
+	keep := filepath.Join(root, "unrelated.txt")
+	os.WriteFile(keep, []byte("keep"), 0600)
+
+	usage, err := d.Usage()
+	if err != nil {
+		t.Fatalf("Usage failed: %v", err)
+	}
+	if usage.Entries != 2 || usage.UsedBytes != int64(len("leftover")) {
+		t.Errorf("unexpected usage before cleanup: %+v", usage)
+	}
+
+	removed, err := d.CleanOrphans()
+	if err != nil {
+		t.Fatalf("CleanOrphans failed: %v", err)
+	}
+	if len(removed) != 2 {
+		t.Errorf("expected 2 orphans removed, got %v", removed)
+	}
+	if _, err := os.Stat(keep); err != nil {
+		t.Errorf("unrelated file was removed: %v", err)
+	}
+	if _, err := os.Stat(orphanDir); !os.IsNotExist(err) {
+		t.Errorf("orphan dir still exists")
+	}
+}
+
+func TestCheckSpace(t *testing.T) {
+	root := filepath.Join(t.TempDir(), "not-created-yet")
+	d := New(root, 0)
+	if err := d.CheckSpace("", 1); err != nil {
+		t.Errorf("expected 1 byte to fit, got %v", err)
+	}
+	if err := d.CheckSpace("", 1<<62); !errors.Is(err, ErrInsufficientSpace) {
+		t.Errorf("expected ErrInsufficientSpace, got %v", err)
+	}
+
+	reserved := New(root, 1<<30) // 1 PiB reserve
+	if err := reserved.CheckSpace("", 0); !errors.Is(err, ErrInsufficientSpace) {
+		t.Errorf("expected reserve to be enforced, got %v", err)
+	}
+}
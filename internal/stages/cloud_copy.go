@@ -0,0 +1,326 @@
+package stages
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/url"
+	"os/exec"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/RoseOO/TapeBackarr/internal/models"
+)
+
+// CloudCopyStage is the name of the stage that copies backups to object
+// storage
+const CloudCopyStage = "cloud_copy"
+
+// Cloud copy outcomes recorded in the stage's status metadata
+const (
+	CloudCopyCompleted = "completed"
+	CloudCopyFailed    = "failed"
+)
+
+func init() {
+	Register(cloudCopyStage{})
+}
+
+// cloudCommand runs the aws CLI; tests replace it
+var cloudCommand = func(ctx context.Context, args ...string) *exec.Cmd {
+	return exec.CommandContext(ctx, "aws", args...)
+}
+
+// cloudCopyStage passes the stream through unchanged and uploads it to an
+// S3-compatible bucket as one tar object, using the aws CLI so credentials
+// come from the usual AWS configuration. With include patterns only the
+// matching files are put in the object. A failed upload is recorded in the
+// metadata but does not fail the backup: the tape stays the primary copy.
+type cloudCopyStage struct{}
+
+func (cloudCopyStage) Name() string { return CloudCopyStage }
+
+func (cloudCopyStage) Validate(params map[string]string) error {
+	for key := range params {
+		switch key {
+		case "url", "include", "sse":
+		default:
+			return fmt.Errorf("unknown parameter %q", key)
+		}
+	}
+	if _, err := parseCloudURL(params["url"]); err != nil {
+		return err
+	}
+	for _, p := range splitPatterns(params["include"]) {
+		if _, err := path.Match(p, ""); err != nil {
+			return fmt.Errorf("invalid include pattern %q", p)
+		}
+	}
+	return nil
+}
+
+func (cloudCopyStage) Encode(ctx context.Context, r io.Reader, params map[string]string) (Stream, error) {
+	dest, err := parseCloudURL(params["url"])
+	if err != nil {
+		return nil, err
+	}
+	suffix := make([]byte, 4)
+	rand.Read(suffix)
+	key := time.Now().UTC().Format("20060102T150405Z") + "-" + hex.EncodeToString(suffix) + ".tar"
+	if dest.prefix != "" {
+		key = dest.prefix + "/" + key
+	}
+	s := &cloudCopyStream{r: r, url: fmt.Sprintf("s3://%s/%s", dest.bucket, key)}
+
+	args := []string{"s3", "cp", "-", s.url}
+	if dest.endpoint != "" {
+		args = append(args, "--endpoint-url", dest.endpoint)
+	}
+	if dest.profile != "" {
+		args = append(args, "--profile", dest.profile)
+	}
+	if params["sse"] != "" {
+		args = append(args, "--sse", params["sse"])
+	}
+	s.cmd = cloudCommand(ctx, args...)
+	s.cmd.Stderr = &s.stderr
+	stdin, err := s.cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err := s.cmd.Start(); err != nil {
+		// The backup goes on without its cloud copy
+		s.err = fmt.Errorf("failed to start aws s3 cp: %w", err)
+		return s, nil
+	}
+	s.stdin = stdin
+	s.upload = stdin
+
+	if patterns := splitPatterns(params["include"]); len(patterns) > 0 {
+		pr, pw := io.Pipe()
+		s.upload = pw
+		s.filterDone = make(chan error, 1)
+		go func() {
+			err := s.filterTar(pr, stdin, patterns)
+			// Unblock the tee if the filter stopped early
+			pr.CloseWithError(err)
+			s.filterDone <- err
+		}()
+	}
+	// Reap the upload if the backup stops before the end of the stream
+	context.AfterFunc(ctx, func() {
+		s.upload.Close()
+		s.wait()
+	})
+	return s, nil
+}
+
+// Decode returns the stream unchanged: the tape holds what was read
+func (cloudCopyStage) Decode(ctx context.Context, r io.Reader, applied models.StreamStage) (io.Reader, error) {
+	return r, nil
+}
+
+// cloudDest is where a cloud copy stage uploads to
+type cloudDest struct {
+	bucket, prefix, endpoint, profile string
+}
+
+// parseCloudURL parses s3://bucket/prefix?endpoint=...&profile=..., the
+// form the s3 virtual tape backend uses
+func parseCloudURL(raw string) (*cloudDest, error) {
+	if raw == "" {
+		return nil, fmt.Errorf("url is required, e.g. s3://bucket/prefix")
+	}
+	u, err := url.Parse(raw)
+	if err != nil || u.Scheme != "s3" || u.Host == "" {
+		return nil, fmt.Errorf("url must be an s3://bucket/prefix URL")
+	}
+	return &cloudDest{
+		bucket:   u.Host,
+		prefix:   strings.Trim(u.Path, "/"),
+		endpoint: u.Query().Get("endpoint"),
+		profile:  u.Query().Get("profile"),
+	}, nil
+}
+
+// splitPatterns splits a comma-separated list of glob patterns
+func splitPatterns(s string) []string {
+	var patterns []string
+	for _, p := range strings.Split(s, ",") {
+		if p = strings.TrimSpace(p); p != "" {
+			patterns = append(patterns, p)
+		}
+	}
+	return patterns
+}
+
+// matchInclude reports whether a file in the archive is selected: a pattern
+// matches its path, its base name or one of its parent directories
+func matchInclude(name string, patterns []string) bool {
+	name = strings.Trim(strings.TrimPrefix(name, "./"), "/")
+	for _, p := range patterns {
+		p = strings.Trim(p, "/")
+		if ok, _ := path.Match(p, path.Base(name)); ok {
+			return true
+		}
+		for dir := name; dir != "." && dir != ""; dir = path.Dir(dir) {
+			if ok, _ := path.Match(p, dir); ok {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// cloudCopyStream tees the stream into the upload
+type cloudCopyStream struct {
+	r      io.Reader
+	url    string
+	cmd    *exec.Cmd
+	stdin  io.WriteCloser
+	stderr bytes.Buffer
+	// upload is stdin, or the input of the include filter
+	upload     io.WriteCloser
+	filterDone chan error
+
+	waitOnce sync.Once
+	waitErr  error
+
+	mu       sync.Mutex
+	uploaded int64
+	files    int64
+	err      error
+	finished bool
+}
+
+func (s *cloudCopyStream) Read(p []byte) (int, error) {
+	n, err := s.r.Read(p)
+	if n > 0 && s.upload != nil && s.err == nil {
+		if _, werr := s.upload.Write(p[:n]); werr != nil {
+			s.fail(werr)
+		} else if s.filterDone == nil {
+			s.mu.Lock()
+			s.uploaded += int64(n)
+			s.mu.Unlock()
+		}
+	}
+	if err == io.EOF {
+		s.finish()
+	}
+	return n, err
+}
+
+// fail stops uploading; the stream itself carries on to tape
+func (s *cloudCopyStream) fail(err error) {
+	if s.err == nil {
+		s.err = err
+	}
+	s.upload.Close()
+	if s.cmd.Process != nil {
+		s.cmd.Process.Kill()
+	}
+}
+
+// finish completes the upload once the whole stream was read
+func (s *cloudCopyStream) finish() {
+	if s.finished || s.upload == nil {
+		return
+	}
+	s.finished = true
+	s.upload.Close()
+	if s.filterDone != nil {
+		if err := <-s.filterDone; err != nil && s.err == nil {
+			s.err = err
+		}
+		s.stdin.Close()
+	}
+	if err := s.wait(); err != nil && s.err == nil {
+		s.err = fmt.Errorf("aws s3 cp failed: %s", strings.TrimSpace(s.stderr.String()))
+	}
+}
+
+// wait waits for the upload command to exit
+func (s *cloudCopyStream) wait() error {
+	s.waitOnce.Do(func() { s.waitErr = s.cmd.Wait() })
+	return s.waitErr
+}
+
+// filterTar copies the files of the archive in r that match the patterns
+// to a new archive in w
+func (s *cloudCopyStream) filterTar(r io.Reader, w io.Writer, patterns []string) error {
+	cw := &countWriter{w: w, n: &s.uploaded, mu: &s.mu}
+	tr := tar.NewReader(r)
+	tw := tar.NewWriter(cw)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read archive: %w", err)
+		}
+		if !matchInclude(hdr.Name, patterns) {
+			continue
+		}
+		if err := tw.WriteHeader(hdr); err != nil {
+			return err
+		}
+		if _, err := io.Copy(tw, tr); err != nil {
+			return err
+		}
+		if hdr.Typeflag == tar.TypeReg {
+			s.mu.Lock()
+			s.files++
+			s.mu.Unlock()
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	// Drain the padding after the end of the archive
+	_, err := io.Copy(io.Discard, r)
+	return err
+}
+
+func (s *cloudCopyStream) Metadata() map[string]string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	meta := map[string]string{
+		"url":    s.url,
+		"status": CloudCopyCompleted,
+		"bytes":  strconv.FormatInt(s.uploaded, 10),
+	}
+	if s.filterDone != nil {
+		meta["files"] = strconv.FormatInt(s.files, 10)
+	}
+	if s.err == nil && !s.finished {
+		s.err = fmt.Errorf("the stream ended before it was read to the end")
+	}
+	if s.err != nil {
+		meta["status"] = CloudCopyFailed
+		meta["error"] = s.err.Error()
+	}
+	return meta
+}
+
+// countWriter counts the bytes written through it
+type countWriter struct {
+	w  io.Writer
+	n  *int64
+	mu *sync.Mutex
+}
+
+func (c *countWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.mu.Lock()
+	*c.n += int64(n)
+	c.mu.Unlock()
+	return n, err
+}
@@ -0,0 +1,144 @@
+package stages
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/RoseOO/TapeBackarr/internal/models"
+)
+
+// fakeCloud replaces the aws CLI with a shell script for the test
+func fakeCloud(t *testing.T, script string) (objectPath string, args *[]string) {
+	objectPath = filepath.Join(t.TempDir(), "object.tar")
+	var got []string
+	orig := cloudCommand
+	cloudCommand = func(ctx context.Context, a ...string) *exec.Cmd {
+		got = a
+		return exec.CommandContext(ctx, "sh", "-c", script, "sh", objectPath)
+	}
+	t.Cleanup(func() { cloudCommand = orig })
+	return objectPath, &got
+}
+
+func testArchive(t *testing.T) []byte {
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	for _, f := range []struct{ name, body string }{
+		{"docs/", ""},
+		{"docs/report.pdf", "report"},
+		{"docs/notes.txt", "notes"},
+		{"photos/cat.jpg", strings.Repeat("meow", 1000)},
+	} {
+		hdr := &tar.Header{Name: f.name, Mode: 0644, Size: int64(len(f.body)), Typeflag: tar.TypeReg}
+		if strings.HasSuffix(f.name, "/") {
+			hdr.Typeflag, hdr.Mode = tar.TypeDir, 0755
+		}
+		tw.WriteHeader(hdr)
+		tw.Write([]byte(f.body))
+	}
+	tw.Close()
+	// Pad to a tape block as tar -b does
+	buf.Write(make([]byte, 10240-buf.Len()%10240))
+	return buf.Bytes()
+}
+
+func TestCloudCopyStage(t *testing.T) {
+	if _, err := exec.LookPath("sh"); err != nil {
+		t.Skip("sh not available")
+	}
+	ctx := context.Background()
+	data := testArchive(t)
+	object, args := fakeCloud(t, `cat > "$1"`)
+
+	chain := []models.StreamStage{{Name: CloudCopyStage, Params: map[string]string{
+		"url": "s3://bucket/backups?endpoint=http://minio:9000&profile=offsite", "sse": "AES256",
+	}}}
+	if err := Validate(chain); err != nil {
+		t.Fatalf("Validate: %v", err)
+	}
+	encoded, applied, err := Encode(ctx, bytes.NewReader(data), chain)
+	if err != nil {
+		t.Fatalf("Encode: %v", err)
+	}
+	out, _ := io.ReadAll(encoded)
+	if !bytes.Equal(out, data) {
+		t.Fatal("expected the stream to pass through unchanged")
+	}
+	meta := applied()[0].Metadata
+	if meta["status"] != CloudCopyCompleted || meta["bytes"] != "10240" || !strings.HasPrefix(meta["url"], "s3://bucket/backups/") {
+		t.Errorf("unexpected metadata %v", meta)
+	}
+	if uploaded, _ := os.ReadFile(object); !bytes.Equal(uploaded, data) {
+		t.Error("expected the whole stream uploaded")
+	}
+	if got := strings.Join(*args, " "); got != "s3 cp - "+meta["url"]+" --endpoint-url http://minio:9000 --profile offsite --sse AES256" {
+		t.Errorf("unexpected aws arguments %q", got)
+	}
+	if decoded, _ := Decode(ctx, bytes.NewReader(out), applied()); decoded == nil {
+		t.Error("expected the stage to decode as a pass-through")
+	}
+
+	// Only selected files
+	chain[0].Params = map[string]string{"url": "s3://bucket", "include": "*.pdf, photos"}
+	encoded, applied, _ = Encode(ctx, bytes.NewReader(data), chain)
+	if out, _ := io.ReadAll(encoded); !bytes.Equal(out, data) {
+		t.Fatal("expected the stream to pass through unchanged with include patterns")
+	}
+	if meta := applied()[0].Metadata; meta["status"] != CloudCopyCompleted || meta["files"] != "2" {
+		t.Errorf("unexpected metadata %v", meta)
+	}
+	f, _ := os.Open(object)
+	defer f.Close()
+	tr := tar.NewReader(f)
+	var names []string
+	for {
+		hdr, err := tr.Next()
+		if err != nil {
+			break
+		}
+		names = append(names, hdr.Name)
+	}
+	if strings.Join(names, ",") != "docs/report.pdf,photos/cat.jpg" {
+		t.Errorf("expected only the selected files uploaded, got %v", names)
+	}
+}
+
+func TestCloudCopyStageFailure(t *testing.T) {
+	if _, err := exec.LookPath("sh"); err != nil {
+		t.Skip("sh not available")
+	}
+	data := testArchive(t)
+	fakeCloud(t, `echo "access denied" >&2; exit 1`)
+
+	encoded, applied, err := Encode(context.Background(), bytes.NewReader(data), []models.StreamStage{{Name: CloudCopyStage, Params: map[string]string{"url": "s3://bucket"}}})
+	if err != nil {
+		t.Fatalf("Encode: %v", err)
+	}
+	if out, err := io.ReadAll(encoded); err != nil || !bytes.Equal(out, data) {
+		t.Fatalf("expected a failed upload not to affect the stream, got %v", err)
+	}
+	if meta := applied()[0].Metadata; meta["status"] != CloudCopyFailed || meta["error"] == "" {
+		t.Errorf("expected the failure recorded, got %v", meta)
+	}
+}
+
+func TestCloudCopyValidate(t *testing.T) {
+	for _, params := range []map[string]string{
+		{},
+		{"url": "https://bucket/prefix"},
+		{"url": "s3:///prefix"},
+		{"url": "s3://bucket", "include": "[a"},
+		{"url": "s3://bucket", "region": "eu-west-1"},
+	} {
+		if err := Validate([]models.StreamStage{{Name: CloudCopyStage, Params: params}}); err == nil {
+			t.Errorf("expected %v to be rejected", params)
+		}
+	}
+}
@@ -0,0 +1,91 @@
+package stages
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"strconv"
+
+	"github.com/RoseOO/TapeBackarr/internal/models"
+)
+
+// ErrChecksumMismatch is returned when a stream read back from tape does not
+// match the checksum recorded when it was written
+var ErrChecksumMismatch = errors.New("stream checksum mismatch")
+
+func init() {
+	Register(hashStage{})
+}
+
+// hashStage passes the stream through unchanged and records its SHA-256 and
+// length. When the whole stream is read back, as by a restore, a stream that
+// does not match fails with ErrChecksumMismatch.
+type hashStage struct{}
+
+func (hashStage) Name() string { return "sha256" }
+
+func (hashStage) Validate(params map[string]string) error {
+	for key := range params {
+		return fmt.Errorf("unknown parameter %q", key)
+	}
+	return nil
+}
+
+func (hashStage) Encode(ctx context.Context, r io.Reader, params map[string]string) (Stream, error) {
+	return &hashStream{r: r, h: sha256.New()}, nil
+}
+
+func (hashStage) Decode(ctx context.Context, r io.Reader, applied models.StreamStage) (io.Reader, error) {
+	want := applied.Metadata["sha256"]
+	size, err := strconv.ParseInt(applied.Metadata["bytes"], 10, 64)
+	if want == "" || err != nil {
+		// Nothing to check against: the backup did not finish recording it
+		return r, nil
+	}
+	return &hashVerifier{hashStream: hashStream{r: r, h: sha256.New()}, want: want, size: size}, nil
+}
+
+// hashStream hashes what is read through it
+type hashStream struct {
+	r io.Reader
+	h hash.Hash
+	n int64
+}
+
+func (s *hashStream) Read(p []byte) (int, error) {
+	n, err := s.r.Read(p)
+	s.h.Write(p[:n])
+	s.n += int64(n)
+	return n, err
+}
+
+func (s *hashStream) Metadata() map[string]string {
+	return map[string]string{
+		"sha256": hex.EncodeToString(s.h.Sum(nil)),
+		"bytes":  strconv.FormatInt(s.n, 10),
+	}
+}
+
+// hashVerifier checks the stream against the recorded checksum at its end
+type hashVerifier struct {
+	hashStream
+	want string
+	size int64
+}
+
+func (v *hashVerifier) Read(p []byte) (int, error) {
+	n, err := v.hashStream.Read(p)
+	if err == io.EOF {
+		if v.n != v.size {
+			return n, fmt.Errorf("%w: read %d bytes, %d were written", ErrChecksumMismatch, v.n, v.size)
+		}
+		if got := hex.EncodeToString(v.h.Sum(nil)); got != v.want {
+			return n, fmt.Errorf("%w: sha256 %s, %s was written", ErrChecksumMismatch, got, v.want)
+		}
+	}
+	return n, err
+}
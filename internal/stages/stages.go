@@ -0,0 +1,167 @@
+// Package stages provides stream processors that run on a backup stream
+// between tar and compression, such as deduplication, chunk hashing or
+// content scanning. A job lists the stages to apply in order. Each backup set
+// records the stages applied to it, with the metadata they need to be
+// reversed on restore.
+package stages
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"sync"
+
+	"github.com/RoseOO/TapeBackarr/internal/models"
+)
+
+// Stage is a stream processor. Stages register with Register, usually from
+// an init function, and are looked up by name.
+type Stage interface {
+	// Name identifies the stage in job settings and backup set records
+	Name() string
+	// Validate checks the parameters a job sets for the stage
+	Validate(params map[string]string) error
+	// Encode returns the processed stream of r
+	Encode(ctx context.Context, r io.Reader, params map[string]string) (Stream, error)
+	// Decode reverses Encode, given the stage as recorded with the backup set
+	Decode(ctx context.Context, r io.Reader, applied models.StreamStage) (io.Reader, error)
+}
+
+// Stream is the output of a stage. Metadata is read once the stream has been
+// read to the end, and is recorded with the backup set.
+type Stream interface {
+	io.Reader
+	Metadata() map[string]string
+}
+
+var (
+	registry   = make(map[string]Stage)
+	registryMu sync.RWMutex
+)
+
+// Register makes a stage available to jobs. It panics if a stage with the
+// same name is already registered.
+func Register(stage Stage) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	if _, ok := registry[stage.Name()]; ok {
+		panic("stages: Register called twice for stage " + stage.Name())
+	}
+	registry[stage.Name()] = stage
+}
+
+// Lookup returns the registered stage with the given name
+func Lookup(name string) (Stage, bool) {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+	stage, ok := registry[name]
+	return stage, ok
+}
+
+// Available returns the names of the registered stages, sorted
+func Available() []string {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+	names := make([]string, 0, len(registry))
+	for name := range registry {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Names returns the names of the stages in a chain, in order
+func Names(chain []models.StreamStage) []string {
+	names := make([]string, len(chain))
+	for i, st := range chain {
+		names[i] = st.Name
+	}
+	return names
+}
+
+// Validate checks that every stage of a job's chain is registered and
+// accepts its parameters
+func Validate(chain []models.StreamStage) error {
+	for i, st := range chain {
+		stage, ok := Lookup(st.Name)
+		if !ok {
+			return fmt.Errorf("stage %d: unknown stage %q", i+1, st.Name)
+		}
+		if err := stage.Validate(st.Params); err != nil {
+			return fmt.Errorf("stage %d (%s): %w", i+1, st.Name, err)
+		}
+	}
+	return nil
+}
+
+// Encode runs r through the stages of a chain in order. The returned
+// function reports the stages as applied, with their metadata, once the
+// stream has been read to the end.
+func Encode(ctx context.Context, r io.Reader, chain []models.StreamStage) (io.Reader, func() []models.StreamStage, error) {
+	streams := make([]Stream, len(chain))
+	for i, st := range chain {
+		stage, ok := Lookup(st.Name)
+		if !ok {
+			return nil, nil, fmt.Errorf("unknown stream stage %q", st.Name)
+		}
+		stream, err := stage.Encode(ctx, r, st.Params)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to start stream stage %s: %w", st.Name, err)
+		}
+		streams[i] = stream
+		r = stream
+	}
+	applied := func() []models.StreamStage {
+		out := make([]models.StreamStage, len(chain))
+		for i, st := range chain {
+			out[i] = models.StreamStage{Name: st.Name, Params: st.Params, Metadata: streams[i].Metadata()}
+		}
+		return out
+	}
+	return r, applied, nil
+}
+
+// Decode reverses the stages recorded with a backup set, last stage first.
+// A set written through a stage that is no longer registered cannot be read.
+func Decode(ctx context.Context, r io.Reader, applied []models.StreamStage) (io.Reader, error) {
+	for i := len(applied) - 1; i >= 0; i-- {
+		st := applied[i]
+		stage, ok := Lookup(st.Name)
+		if !ok {
+			return nil, fmt.Errorf("backup set was written through stream stage %q, which is not available", st.Name)
+		}
+		decoded, err := stage.Decode(ctx, r, st)
+		if err != nil {
+			return nil, fmt.Errorf("failed to reverse stream stage %s: %w", st.Name, err)
+		}
+		r = decoded
+	}
+	return r, nil
+}
+
+// Marshal encodes a chain for a database column. An empty chain is NULL.
+func Marshal(chain []models.StreamStage) sql.NullString {
+	if len(chain) == 0 {
+		return sql.NullString{}
+	}
+	data, err := json.Marshal(chain)
+	if err != nil {
+		return sql.NullString{}
+	}
+	return sql.NullString{String: string(data), Valid: true}
+}
+
+// Parse decodes a chain stored by Marshal
+func Parse(s sql.NullString) ([]models.StreamStage, error) {
+	if !s.Valid || s.String == "" {
+		return nil, nil
+	}
+	var chain []models.StreamStage
+	if err := json.Unmarshal([]byte(s.String), &chain); err != nil {
+		return nil, fmt.Errorf("invalid stream stages: %w", err)
+	}
+	return chain, nil
+}
@@ -0,0 +1,68 @@
+package stages
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"testing"
+
+	"github.com/RoseOO/TapeBackarr/internal/models"
+)
+
+func TestValidate(t *testing.T) {
+	if err := Validate(nil); err != nil {
+		t.Errorf("expected an empty chain to be valid, got %v", err)
+	}
+	if err := Validate([]models.StreamStage{{Name: "sha256"}}); err != nil {
+		t.Errorf("expected sha256 to be valid, got %v", err)
+	}
+	if err := Validate([]models.StreamStage{{Name: "sha256"}, {Name: "nope"}}); err == nil {
+		t.Error("expected an unknown stage to be rejected")
+	}
+	if err := Validate([]models.StreamStage{{Name: "sha256", Params: map[string]string{"chunk": "1"}}}); err == nil {
+		t.Error("expected an unknown parameter to be rejected")
+	}
+}
+
+func TestMarshalParse(t *testing.T) {
+	if v := Marshal(nil); v.Valid {
+		t.Errorf("expected an empty chain to be NULL, got %q", v.String)
+	}
+	chain := []models.StreamStage{{Name: "sha256", Metadata: map[string]string{"bytes": "3"}}}
+	parsed, err := Parse(Marshal(chain))
+	if err != nil || len(parsed) != 1 || parsed[0].Metadata["bytes"] != "3" {
+		t.Errorf("round trip lost the chain: %+v (%v)", parsed, err)
+	}
+}
+
+func TestHashStage(t *testing.T) {
+	ctx := context.Background()
+	data := bytes.Repeat([]byte("tape"), 10000)
+	encoded, applied, err := Encode(ctx, bytes.NewReader(data), []models.StreamStage{{Name: "sha256"}})
+	if err != nil {
+		t.Fatalf("Encode: %v", err)
+	}
+	out, _ := io.ReadAll(encoded)
+	if !bytes.Equal(out, data) {
+		t.Fatal("expected sha256 to pass the stream through unchanged")
+	}
+
+	decoded, err := Decode(ctx, bytes.NewReader(out), applied())
+	if err != nil {
+		t.Fatalf("Decode: %v", err)
+	}
+	if _, err := io.ReadAll(decoded); err != nil {
+		t.Errorf("expected the stream to check out, got %v", err)
+	}
+
+	// A truncated stream does not
+	decoded, _ = Decode(ctx, bytes.NewReader(out[:len(out)-1]), applied())
+	if _, err := io.ReadAll(decoded); !errors.Is(err, ErrChecksumMismatch) {
+		t.Errorf("expected ErrChecksumMismatch, got %v", err)
+	}
+
+	if _, err := Decode(ctx, bytes.NewReader(out), []models.StreamStage{{Name: "nope"}}); err == nil {
+		t.Error("expected a set written through an unknown stage to be unreadable")
+	}
+}
@@ -0,0 +1,268 @@
+package tape
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// BackendType identifies the kind of media a drive writes to
+type BackendType string
+
+const (
+	// BackendTape is a physical tape drive driven through mt/dd
+	BackendTape BackendType = "tape"
+	// BackendFile is a virtual tape stored as one file per tape file in a directory
+	BackendFile BackendType = "file"
+	// BackendS3 is a virtual tape stored as one object per tape file in an S3 bucket
+	BackendS3 BackendType = "s3"
+	// BackendNull discards all writes; used to benchmark the pipeline
+	BackendNull BackendType = "null"
+)
+
+// ErrNotSupported is returned when an operation has no meaning for a backend,
+// e.g. hardware encryption on a virtual tape.
+var ErrNotSupported = errors.New("operation not supported by this storage backend")
+
+// Backend is the set of primitive media operations the tape service is built
+// on. A physical drive implements them with mt and dd; virtual backends
+// emulate tape semantics (file marks, sequential positioning, writes
+// truncating everything after the current position) on other storage so the
+// same job, catalog and restore code can target them.
+type Backend interface {
+	// Type returns the backend kind
+	Type() BackendType
+	// Status reports load state and the current position
+	Status(ctx context.Context) (*DriveStatus, error)
+	// Rewind moves to the beginning of the media
+	Rewind(ctx context.Context) error
+	// SpaceFiles moves forward over count file marks from the current position
+	SpaceFiles(ctx context.Context, count int64) error
+	// SeekBlock positions at an absolute block number
+	SeekBlock(ctx context.Context, block int64) error
+	// WriteFileMark ends the current tape file
+	WriteFileMark(ctx context.Context) error
+	// SetBlockSize sets the block size; 0 selects variable block mode
+	SetBlockSize(ctx context.Context, size int) error
+	// Eject unloads the media
+	Eject(ctx context.Context) error
+	// Load loads the media
+	Load(ctx context.Context) error
+	// ReadBlocks reads up to count blocks of blockSize bytes from the current position
+	ReadBlocks(ctx context.Context, blockSize, count int) ([]byte, error)
+	// WriteBlocks writes data in blockSize blocks at the current position
+	WriteBlocks(ctx context.Context, blockSize int, data []byte) error
+	// OpenReader streams the current tape file from the current position
+	OpenReader(ctx context.Context) (io.ReadCloser, error)
+	// OpenWriter streams data into the media at the current position
+	OpenWriter(ctx context.Context) (io.WriteCloser, error)
+}
+
+// backends caches one Backend per device path so that virtual media keep
+// their position across the short-lived Service instances created per
+// operation, the same way deviceLocks shares mutexes.
+var (
+	backends   = make(map[string]Backend)
+	backendsMu sync.Mutex
+)
+
+// BackendFor returns the shared backend for a device path
+func BackendFor(devicePath string) Backend {
+	backendsMu.Lock()
+	defer backendsMu.Unlock()
+	if b, ok := backends[devicePath]; ok {
+		return b
+	}
+	b, err := newBackend(devicePath)
+	if err != nil {
+		b = &brokenBackend{err: err}
+	}
+	backends[devicePath] = b
+	return b
+}
+
+// BackendTypeOf returns the backend kind a device path selects
+func BackendTypeOf(devicePath string) BackendType {
+	switch {
+	case strings.HasPrefix(devicePath, "file://"):
+		return BackendFile
+	case strings.HasPrefix(devicePath, "s3://"):
+		return BackendS3
+	case devicePath == "null:" || strings.HasPrefix(devicePath, "null:"):
+		return BackendNull
+	default:
+		return BackendTape
+	}
+}
+
+// IsPhysicalDevice reports whether a device path names a real tape drive
+func IsPhysicalDevice(devicePath string) bool {
+	return BackendTypeOf(devicePath) == BackendTape
+}
+
+// ValidateDevicePath checks that a device path names a usable backend
+func ValidateDevicePath(devicePath string) error {
+	_, err := newBackend(devicePath)
+	return err
+}
+
+// newBackend parses a device path into a backend. Plain paths such as
+// /dev/nst0 select a physical drive; file:///dir, s3://bucket/prefix and
+// null: select the virtual backends.
+func newBackend(devicePath string) (Backend, error) {
+	switch BackendTypeOf(devicePath) {
+	case BackendFile:
+		dir := strings.TrimPrefix(devicePath, "file://")
+		if dir == "" || !strings.HasPrefix(dir, "/") {
+			return nil, fmt.Errorf("file backend requires an absolute directory, e.g. file:///var/lib/tapebackarr/vtape/VT0001")
+		}
+		return newVirtualTape(BackendFile, &dirStore{dir: dir}), nil
+	case BackendS3:
+		u, err := url.Parse(devicePath)
+		if err != nil {
+			return nil, fmt.Errorf("invalid s3 device path: %w", err)
+		}
+		if u.Host == "" {
+			return nil, fmt.Errorf("s3 backend requires a bucket, e.g. s3://bucket/prefix")
+		}
+		return newVirtualTape(BackendS3, &s3Store{
+			bucket:   u.Host,
+			prefix:   strings.Trim(u.Path, "/"),
+			endpoint: u.Query().Get("endpoint"),
+			profile:  u.Query().Get("profile"),
+		}), nil
+	case BackendNull:
+		return &nullBackend{}, nil
+	default:
+		if devicePath == "" {
+			return nil, fmt.Errorf("device path is required")
+		}
+		return &deviceBackend{path: devicePath}, nil
+	}
+}
+
+// brokenBackend is returned for device paths that could not be parsed so
+// that every operation reports the configuration error.
+type brokenBackend struct {
+	err error
+}
+
+func (b *brokenBackend) Type() BackendType { return BackendTape }
+func (b *brokenBackend) Status(ctx context.Context) (*DriveStatus, error) {
+	return &DriveStatus{LastChecked: time.Now(), Error: b.err.Error()}, nil
+}
+func (b *brokenBackend) Rewind(ctx context.Context) error                  { return b.err }
+func (b *brokenBackend) SpaceFiles(ctx context.Context, count int64) error { return b.err }
+func (b *brokenBackend) SeekBlock(ctx context.Context, block int64) error  { return b.err }
+func (b *brokenBackend) WriteFileMark(ctx context.Context) error           { return b.err }
+func (b *brokenBackend) SetBlockSize(ctx context.Context, size int) error  { return b.err }
+func (b *brokenBackend) Eject(ctx context.Context) error                   { return b.err }
+func (b *brokenBackend) Load(ctx context.Context) error                    { return b.err }
+func (b *brokenBackend) ReadBlocks(ctx context.Context, blockSize, count int) ([]byte, error) {
+	return nil, b.err
+}
+func (b *brokenBackend) WriteBlocks(ctx context.Context, blockSize int, data []byte) error {
+	return b.err
+}
+func (b *brokenBackend) OpenReader(ctx context.Context) (io.ReadCloser, error) { return nil, b.err }
+func (b *brokenBackend) OpenWriter(ctx context.Context) (io.WriteCloser, error) {
+	return nil, b.err
+}
+
+// nullBackend accepts and discards everything written to it and reads back
+// as blank media. File marks still advance the position so job bookkeeping
+// behaves as it would on tape.
+type nullBackend struct {
+	mu        sync.Mutex
+	file      int64
+	unloaded  bool
+	blockSize int
+}
+
+func (n *nullBackend) Type() BackendType { return BackendNull }
+
+func (n *nullBackend) Status(ctx context.Context) (*DriveStatus, error) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	online := !n.unloaded
+	return &DriveStatus{
+		Online:      online,
+		Ready:       online,
+		BOT:         n.file == 0,
+		FileNumber:  n.file,
+		BlockSize:   n.blockSize,
+		LastChecked: time.Now(),
+	}, nil
+}
+
+func (n *nullBackend) Rewind(ctx context.Context) error {
+	n.mu.Lock()
+	n.file = 0
+	n.mu.Unlock()
+	return nil
+}
+
+func (n *nullBackend) SpaceFiles(ctx context.Context, count int64) error {
+	n.mu.Lock()
+	n.file += count
+	n.mu.Unlock()
+	return nil
+}
+
+func (n *nullBackend) SeekBlock(ctx context.Context, block int64) error { return ErrNotSupported }
+
+func (n *nullBackend) WriteFileMark(ctx context.Context) error {
+	n.mu.Lock()
+	n.file++
+	n.mu.Unlock()
+	return nil
+}
+
+func (n *nullBackend) SetBlockSize(ctx context.Context, size int) error {
+	n.mu.Lock()
+	n.blockSize = size
+	n.mu.Unlock()
+	return nil
+}
+
+func (n *nullBackend) Eject(ctx context.Context) error {
+	n.mu.Lock()
+	n.unloaded = true
+	n.file = 0
+	n.mu.Unlock()
+	return nil
+}
+
+func (n *nullBackend) Load(ctx context.Context) error {
+	n.mu.Lock()
+	n.unloaded = false
+	n.mu.Unlock()
+	return nil
+}
+
+func (n *nullBackend) ReadBlocks(ctx context.Context, blockSize, count int) ([]byte, error) {
+	return nil, nil
+}
+
+func (n *nullBackend) WriteBlocks(ctx context.Context, blockSize int, data []byte) error {
+	return nil
+}
+
+func (n *nullBackend) OpenReader(ctx context.Context) (io.ReadCloser, error) {
+	return io.NopCloser(strings.NewReader("")), nil
+}
+
+func (n *nullBackend) OpenWriter(ctx context.Context) (io.WriteCloser, error) {
+	return nopWriteCloser{io.Discard}, nil
+}
+
+type nopWriteCloser struct {
+	io.Writer
+}
+
+func (nopWriteCloser) Close() error { return nil }
@@ -0,0 +1,204 @@
+package tape
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// deviceBackend drives a physical tape through the Linux st driver using
+// mt for positioning and dd for fixed-size block transfers.
+type deviceBackend struct {
+	path string
+}
+
+var (
+	fileNumRe  = regexp.MustCompile(`File number=(\d+)`)
+	blockNumRe = regexp.MustCompile(`block number=(\d+)`)
+	densityRe  = regexp.MustCompile(`Tape block size (\d+) bytes\. Density code (0x[0-9a-fA-F]+)`)
+	ltoDescRe  = regexp.MustCompile(`Density code 0x[0-9a-fA-F]+ \((LTO-\d+)\)`)
+)
+
+func (d *deviceBackend) Type() BackendType { return BackendTape }
+
+func (d *deviceBackend) Status(ctx context.Context) (*DriveStatus, error) {
+	status := &DriveStatus{
+		DevicePath:  d.path,
+		LastChecked: time.Now(),
+	}
+
+	// Create a context with timeout to prevent indefinite blocking
+	opCtx, cancel := context.WithTimeout(ctx, DefaultOperationTimeout)
+	defer cancel()
+
+	cmd := exec.CommandContext(opCtx, "mt", "-f", d.path, "status")
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		// Check if the error was due to context timeout/cancellation
+		if opCtx.Err() == context.DeadlineExceeded {
+			status.Error = fmt.Sprintf("tape status operation timed out after %v", DefaultOperationTimeout)
+			return status, ErrOperationTimeout
+		}
+		if opCtx.Err() == context.Canceled {
+			status.Error = "tape status operation cancelled"
+			return status, ctx.Err()
+		}
+		status.Error = fmt.Sprintf("failed to get tape status: %s", string(output))
+		return status, nil
+	}
+
+	parseMTStatus(string(output), status)
+	return status, nil
+}
+
+// parseMTStatus fills status from `mt status` output
+func parseMTStatus(outputStr string, status *DriveStatus) {
+	status.Online = !strings.Contains(outputStr, "offline")
+	status.Ready = strings.Contains(outputStr, "ONLINE") || strings.Contains(outputStr, "DR_OPEN")
+	status.WriteProtect = strings.Contains(outputStr, "WR_PROT")
+	status.BOT = strings.Contains(outputStr, "BOT")
+	status.EOT = strings.Contains(outputStr, "EOT")
+	status.EOF = strings.Contains(outputStr, "EOF")
+
+	// Parse file and block numbers
+	if matches := fileNumRe.FindStringSubmatch(outputStr); len(matches) > 1 {
+		status.FileNumber, _ = strconv.ParseInt(matches[1], 10, 64)
+	}
+	if matches := blockNumRe.FindStringSubmatch(outputStr); len(matches) > 1 {
+		status.BlockNumber, _ = strconv.ParseInt(matches[1], 10, 64)
+	}
+
+	// Parse density
+	if matches := densityRe.FindStringSubmatch(outputStr); len(matches) > 2 {
+		status.BlockSize, _ = strconv.Atoi(matches[1])
+		status.Density = matches[2]
+	}
+
+	// Parse LTO type from density description (e.g., "Density code 0x58 (LTO-5).")
+	if matches := ltoDescRe.FindStringSubmatch(outputStr); len(matches) > 1 {
+		status.DriveType = matches[1]
+	}
+}
+
+func (d *deviceBackend) Rewind(ctx context.Context) error {
+	// Create a context with timeout to prevent indefinite blocking
+	opCtx, cancel := context.WithTimeout(ctx, DefaultOperationTimeout)
+	defer cancel()
+
+	cmd := exec.CommandContext(opCtx, "mt", "-f", d.path, "rewind")
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		// Check if the error was due to context timeout/cancellation
+		if opCtx.Err() == context.DeadlineExceeded {
+			return fmt.Errorf("rewind timed out after %v: %w", DefaultOperationTimeout, ErrOperationTimeout)
+		}
+		if opCtx.Err() == context.Canceled {
+			return fmt.Errorf("rewind cancelled: %w", ctx.Err())
+		}
+		return fmt.Errorf("rewind failed: %s", string(output))
+	}
+	return nil
+}
+
+func (d *deviceBackend) SpaceFiles(ctx context.Context, count int64) error {
+	cmd := exec.CommandContext(ctx, "mt", "-f", d.path, "fsf", strconv.FormatInt(count, 10))
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("seek failed: %s", string(output))
+	}
+	return nil
+}
+
+func (d *deviceBackend) SeekBlock(ctx context.Context, block int64) error {
+	cmd := exec.CommandContext(ctx, "mt", "-f", d.path, "seek", strconv.FormatInt(block, 10))
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("seek to block failed: %s", string(output))
+	}
+	return nil
+}
+
+func (d *deviceBackend) WriteFileMark(ctx context.Context) error {
+	cmd := exec.CommandContext(ctx, "mt", "-f", d.path, "weof", "1")
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("write file mark failed: %s", string(output))
+	}
+	return nil
+}
+
+func (d *deviceBackend) SetBlockSize(ctx context.Context, size int) error {
+	// Create a context with timeout to prevent indefinite blocking
+	opCtx, cancel := context.WithTimeout(ctx, DefaultOperationTimeout)
+	defer cancel()
+
+	cmd := exec.CommandContext(opCtx, "mt", "-f", d.path, "setblk", strconv.Itoa(size))
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		// Check if the error was due to context timeout/cancellation
+		if opCtx.Err() == context.DeadlineExceeded {
+			return fmt.Errorf("set block size timed out after %v: %w", DefaultOperationTimeout, ErrOperationTimeout)
+		}
+		if opCtx.Err() == context.Canceled {
+			return fmt.Errorf("set block size cancelled: %w", ctx.Err())
+		}
+		return fmt.Errorf("set block size failed: %s", string(output))
+	}
+	return nil
+}
+
+func (d *deviceBackend) Eject(ctx context.Context) error {
+	cmd := exec.CommandContext(ctx, "mt", "-f", d.path, "eject")
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("eject failed: %s", string(output))
+	}
+	return nil
+}
+
+func (d *deviceBackend) Load(ctx context.Context) error {
+	cmd := exec.CommandContext(ctx, "mt", "-f", d.path, "load")
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("load failed: %s", string(output))
+	}
+	return nil
+}
+
+func (d *deviceBackend) ReadBlocks(ctx context.Context, blockSize, count int) ([]byte, error) {
+	cmd := exec.CommandContext(ctx, "dd",
+		fmt.Sprintf("if=%s", d.path),
+		fmt.Sprintf("bs=%d", blockSize),
+		fmt.Sprintf("count=%d", count),
+	)
+	return cmd.Output()
+}
+
+func (d *deviceBackend) WriteBlocks(ctx context.Context, blockSize int, data []byte) error {
+	cmd := exec.CommandContext(ctx, "dd",
+		fmt.Sprintf("of=%s", d.path),
+		fmt.Sprintf("bs=%d", blockSize),
+		fmt.Sprintf("count=%d", (len(data)+blockSize-1)/blockSize),
+	)
+	cmd.Stdin = bytes.NewReader(data)
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("%s", string(output))
+	}
+	return nil
+}
+
+func (d *deviceBackend) OpenReader(ctx context.Context) (io.ReadCloser, error) {
+	return os.Open(d.path)
+}
+
+func (d *deviceBackend) OpenWriter(ctx context.Context) (io.WriteCloser, error) {
+	return os.OpenFile(d.path, os.O_WRONLY, 0)
+}
@@ -0,0 +1,98 @@
+package tape
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+// MaxVariableBlockSize is the buffer a block is read into in variable block
+// mode. The st driver fails a read into a buffer smaller than the block, so
+// it must cover the largest block size in use.
+const MaxVariableBlockSize = 16 << 20
+
+// ErrBlockSizeUndetected is returned by DetectReadBlockSize when no block
+// size could read the tape
+var ErrBlockSizeUndetected = errors.New("no block size could read the tape")
+
+// BlockSizeDetection is the block size DetectReadBlockSize settled on
+type BlockSizeDetection struct {
+	// BlockSize is the size the drive was set to, 0 for variable block mode
+	BlockSize int
+	// ReadSize is the size of the block that was read. Readers of the tape
+	// file need buffers of at least this size.
+	ReadSize int
+	// Attempts describes each block size tried, in order
+	Attempts []string
+}
+
+// DescribeBlockSize returns a block size as shown in logs
+func DescribeBlockSize(size int) string {
+	if size <= 0 {
+		return "variable block mode"
+	}
+	return fmt.Sprintf("%d byte blocks", size)
+}
+
+// DetectReadBlockSize finds a block size the drive can read the tape file at
+// the current position with. Each candidate is tried in fixed block mode,
+// then variable block mode: the drive is set to the size, one block is read
+// and reposition is called to return to where the read started. The drive is
+// left set to the first size that read a block. Zero and repeated candidates
+// are skipped.
+func (s *Service) DetectReadBlockSize(ctx context.Context, candidates []int, reposition func(context.Context) error) (*BlockSizeDetection, error) {
+	var sizes []int
+	seen := make(map[int]bool)
+	for _, size := range candidates {
+		if size > 0 && !seen[size] {
+			seen[size] = true
+			sizes = append(sizes, size)
+		}
+	}
+	sizes = append(sizes, 0)
+
+	detection := &BlockSizeDetection{}
+	for _, size := range sizes {
+		data, err := s.readOneBlock(ctx, size)
+		if posErr := reposition(ctx); posErr != nil {
+			return detection, fmt.Errorf("failed to reposition after trying %s: %w", DescribeBlockSize(size), posErr)
+		}
+		switch {
+		case err != nil:
+			detection.Attempts = append(detection.Attempts, fmt.Sprintf("%s: %s", DescribeBlockSize(size), strings.TrimSpace(err.Error())))
+		case len(data) == 0:
+			detection.Attempts = append(detection.Attempts, DescribeBlockSize(size)+": no data read")
+		default:
+			detection.BlockSize, detection.ReadSize = size, len(data)
+			if size > detection.ReadSize {
+				detection.ReadSize = size
+			}
+			detection.Attempts = append(detection.Attempts, fmt.Sprintf("%s: read a %d byte block", DescribeBlockSize(size), len(data)))
+			return detection, nil
+		}
+	}
+	return detection, fmt.Errorf("%w (%s)", ErrBlockSizeUndetected, strings.Join(detection.Attempts, "; "))
+}
+
+// readOneBlock sets the drive's block size and reads one block from the
+// current position
+func (s *Service) readOneBlock(ctx context.Context, size int) ([]byte, error) {
+	s.deviceMu.Lock()
+	defer s.deviceMu.Unlock()
+	if err := s.setBlockSizeLocked(ctx, size); err != nil {
+		return nil, err
+	}
+	readSize := size
+	if readSize <= 0 {
+		readSize = MaxVariableBlockSize
+	}
+	data, err := s.backend.ReadBlocks(ctx, readSize, 1)
+	// dd explains a failed read, e.g. a block larger than the buffer, on stderr
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) && len(exitErr.Stderr) > 0 {
+		err = errors.New(strings.TrimSpace(string(exitErr.Stderr)))
+	}
+	return data, err
+}
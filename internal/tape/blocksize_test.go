@@ -0,0 +1,69 @@
+package tape
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+)
+
+// blockTape is a drive holding blocks of one size: in fixed block mode only
+// that size reads, in variable block mode any buffer at least that large does
+type blockTape struct {
+	*nullBackend
+	block       int
+	set         int
+	repositions int
+}
+
+func (b *blockTape) SetBlockSize(ctx context.Context, size int) error {
+	b.set = size
+	return nil
+}
+
+func (b *blockTape) ReadBlocks(ctx context.Context, blockSize, count int) ([]byte, error) {
+	if (b.set > 0 && b.set != b.block) || blockSize < b.block {
+		return nil, errors.New("dd: error reading '/dev/nst0': Cannot allocate memory")
+	}
+	return make([]byte, b.block), nil
+}
+
+func TestDetectReadBlockSize(t *testing.T) {
+	ctx := context.Background()
+	drive := &blockTape{nullBackend: &nullBackend{}, block: 262144}
+	svc := &Service{devicePath: "/dev/nst0", deviceMu: &sync.Mutex{}, backend: drive}
+	reposition := func(ctx context.Context) error {
+		drive.repositions++
+		return nil
+	}
+
+	// The recorded size reads at once
+	detection, err := svc.DetectReadBlockSize(ctx, []int{262144, 1048576}, reposition)
+	if err != nil || detection.BlockSize != 262144 || detection.ReadSize != 262144 || len(detection.Attempts) != 1 {
+		t.Fatalf("expected the recorded size to work, got %+v (%v)", detection, err)
+	}
+	if drive.set != 262144 || drive.repositions != 1 {
+		t.Errorf("expected the drive set to the recorded size and repositioned once, got %d and %d", drive.set, drive.repositions)
+	}
+
+	// A wrong recorded size falls back to variable block mode, which
+	// reports the size on tape
+	detection, err = svc.DetectReadBlockSize(ctx, []int{1048576, 1048576, 0}, reposition)
+	if err != nil || detection.BlockSize != 0 || detection.ReadSize != 262144 {
+		t.Fatalf("expected variable block mode, got %+v (%v)", detection, err)
+	}
+	if len(detection.Attempts) != 2 || drive.set != 0 || drive.repositions != 3 {
+		t.Errorf("expected one failed fixed attempt, then variable mode, got %v", detection.Attempts)
+	}
+
+	// Blocks larger than any buffer cannot be read
+	drive.block = MaxVariableBlockSize * 2
+	if _, err := svc.DetectReadBlockSize(ctx, []int{1048576}, reposition); err == nil {
+		t.Fatal("expected detection to fail")
+	}
+
+	failing := func(ctx context.Context) error { return errors.New("seek failed") }
+	if _, err := svc.DetectReadBlockSize(ctx, []int{1048576}, failing); err == nil {
+		t.Fatal("expected a failed reposition to stop detection")
+	}
+}
@@ -0,0 +1,135 @@
+package tape
+
+import (
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// sysfsRoot is the sysfs mount point, replaced in tests
+var sysfsRoot = "/sys"
+
+// DeviceNode is a tape device node and the identity of the drive behind it.
+// Node numbers (nst0, nst1, ...) follow probe order and can change across
+// reboots, the serial number and WWN do not.
+type DeviceNode struct {
+	DevicePath string `json:"device_path"`
+	Serial     string `json:"serial_number"`
+	WWN        string `json:"wwn"`
+}
+
+// ScanDeviceNodes lists the non-rewinding tape nodes known to the kernel with
+// the serial number and WWN of each drive, read from sysfs
+func ScanDeviceNodes() ([]DeviceNode, error) {
+	entries, err := os.ReadDir(filepath.Join(sysfsRoot, "class", "scsi_tape"))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	nodes := make([]DeviceNode, 0)
+	for _, e := range entries {
+		name := e.Name()
+		// Only nstN: the rewinding stN node and the mode variants (nstNa,
+		// nstNl, nstNm) refer to the same drive
+		if !strings.HasPrefix(name, "nst") || strings.TrimLeft(name[3:], "0123456789") != "" || len(name) == 3 {
+			continue
+		}
+		dev := filepath.Join(sysfsRoot, "class", "scsi_tape", name, "device")
+		node := DeviceNode{
+			DevicePath: "/dev/" + name,
+			Serial:     readUnitSerial(filepath.Join(dev, "vpd_pg80")),
+			WWN:        readWWN(dev),
+		}
+		nodes = append(nodes, node)
+	}
+	sort.Slice(nodes, func(i, j int) bool { return nodes[i].DevicePath < nodes[j].DevicePath })
+	return nodes, nil
+}
+
+// FindDeviceNode returns the node of the drive with the given WWN or serial
+// number. The WWN is preferred when both are known.
+func FindDeviceNode(nodes []DeviceNode, serial, wwn string) *DeviceNode {
+	if wwn != "" {
+		for i := range nodes {
+			if strings.EqualFold(nodes[i].WWN, wwn) {
+				return &nodes[i]
+			}
+		}
+	}
+	if serial != "" {
+		for i := range nodes {
+			if nodes[i].Serial == serial {
+				return &nodes[i]
+			}
+		}
+	}
+	return nil
+}
+
+// NodeForPath returns the scanned node at a device path. The rewinding stN
+// node maps to the same drive as nstN.
+func NodeForPath(nodes []DeviceNode, devicePath string) *DeviceNode {
+	path := devicePath
+	if strings.HasPrefix(path, "/dev/st") {
+		path = "/dev/nst" + strings.TrimPrefix(path, "/dev/st")
+	}
+	for i := range nodes {
+		if nodes[i].DevicePath == path {
+			return &nodes[i]
+		}
+	}
+	return nil
+}
+
+// readUnitSerial parses the Unit Serial Number VPD page (0x80)
+func readUnitSerial(path string) string {
+	b, err := os.ReadFile(path)
+	if err != nil || len(b) < 4 {
+		return ""
+	}
+	n := int(b[3])
+	if 4+n > len(b) {
+		n = len(b) - 4
+	}
+	return strings.TrimSpace(strings.Trim(string(b[4:4+n]), "\x00"))
+}
+
+// readWWN returns the drive's NAA world wide name, from the wwid attribute
+// when the kernel provides it and otherwise from the Device Identification
+// VPD page (0x83)
+func readWWN(dev string) string {
+	if b, err := os.ReadFile(filepath.Join(dev, "wwid")); err == nil {
+		id := strings.TrimSpace(string(b))
+		if strings.HasPrefix(id, "naa.") {
+			return strings.ToLower(strings.TrimPrefix(id, "naa."))
+		}
+	}
+	b, err := os.ReadFile(filepath.Join(dev, "vpd_pg83"))
+	if err != nil || len(b) < 4 {
+		return ""
+	}
+	end := 4 + (int(b[2])<<8 | int(b[3]))
+	if end > len(b) {
+		end = len(b)
+	}
+	for off := 4; off+4 <= end; {
+		codeSet := b[off] & 0x0f
+		assoc := (b[off+1] >> 4) & 0x03
+		idType := b[off+1] & 0x0f
+		n := int(b[off+3])
+		if off+4+n > end {
+			break
+		}
+		// Binary NAA designator associated with the logical unit
+		if codeSet == 1 && assoc == 0 && idType == 3 {
+			return hex.EncodeToString(b[off+4 : off+4+n])
+		}
+		off += 4 + n
+	}
+	return ""
+}
@@ -0,0 +1,77 @@
+package tape
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func writeSysfsDrive(t *testing.T, root, name string, files map[string][]byte) {
+	t.Helper()
+	dev := filepath.Join(root, "class", "scsi_tape", name, "device")
+	if err := os.MkdirAll(dev, 0755); err != nil {
+		t.Fatal(err)
+	}
+	for f, data := range files {
+		if err := os.WriteFile(filepath.Join(dev, f), data, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestScanDeviceNodes(t *testing.T) {
+	root := t.TempDir()
+	old := sysfsRoot
+	sysfsRoot = root
+	defer func() { sysfsRoot = old }()
+
+	serial := "HU1234ABCD"
+	pg80 := append([]byte{0x01, 0x80, 0x00, byte(len(serial))}, serial...)
+	// Device identification page with a T10 vendor designator followed by a
+	// binary NAA designator
+	pg83 := []byte{0x01, 0x83, 0x00, 0x14,
+		0x02, 0x01, 0x00, 0x04, 'I', 'B', 'M', ' ',
+		0x01, 0x03, 0x00, 0x08, 0x50, 0x01, 0x10, 0xa0, 0x00, 0x12, 0x34, 0x56}
+	writeSysfsDrive(t, root, "nst1", map[string][]byte{"vpd_pg80": pg80, "vpd_pg83": pg83})
+	writeSysfsDrive(t, root, "nst0", map[string][]byte{"wwid": []byte("naa.5001ABCD00000001\n")})
+	writeSysfsDrive(t, root, "nst0a", nil)
+	writeSysfsDrive(t, root, "st0", nil)
+
+	nodes, err := ScanDeviceNodes()
+	if err != nil {
+		t.Fatalf("scan: %v", err)
+	}
+	if len(nodes) != 2 {
+		t.Fatalf("expected 2 nodes, got %+v", nodes)
+	}
+	if nodes[0].DevicePath != "/dev/nst0" || nodes[0].WWN != "5001abcd00000001" || nodes[0].Serial != "" {
+		t.Errorf("unexpected nst0 node: %+v", nodes[0])
+	}
+	if nodes[1].DevicePath != "/dev/nst1" || nodes[1].Serial != serial || nodes[1].WWN != "500110a000123456" {
+		t.Errorf("unexpected nst1 node: %+v", nodes[1])
+	}
+
+	if n := FindDeviceNode(nodes, serial, ""); n == nil || n.DevicePath != "/dev/nst1" {
+		t.Errorf("expected serial lookup to find nst1, got %+v", n)
+	}
+	if n := FindDeviceNode(nodes, "other", "5001ABCD00000001"); n == nil || n.DevicePath != "/dev/nst0" {
+		t.Errorf("expected WWN lookup to find nst0, got %+v", n)
+	}
+	if n := FindDeviceNode(nodes, "missing", ""); n != nil {
+		t.Errorf("expected no node, got %+v", n)
+	}
+	if n := NodeForPath(nodes, "/dev/st1"); n == nil || n.DevicePath != "/dev/nst1" {
+		t.Errorf("expected /dev/st1 to map to nst1, got %+v", n)
+	}
+}
+
+func TestScanDeviceNodesNoSysfs(t *testing.T) {
+	old := sysfsRoot
+	sysfsRoot = filepath.Join(t.TempDir(), "missing")
+	defer func() { sysfsRoot = old }()
+
+	nodes, err := ScanDeviceNodes()
+	if err != nil || len(nodes) != 0 {
+		t.Fatalf("expected no nodes and no error, got %v, %v", nodes, err)
+	}
+}
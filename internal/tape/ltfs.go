@@ -65,8 +65,9 @@ const LTFSMetadataFile = ".tapebackarr.json"
 // Requires LTO-5 or later drives and LTFS software (mkltfs, ltfs commands).
 // Inspired by github.com/samuelncui/yatm which uses LTFS for tape management.
 type LTFSService struct {
-	devicePath string
-	mountPoint string
+	devicePath     string
+	mountPoint     string
+	followSymlinks bool
 }
 
 // NewLTFSService creates a new LTFS service for the given tape device.
@@ -82,6 +83,12 @@ func NewLTFSService(devicePath string, mountPoint string) *LTFSService {
 	}
 }
 
+// SetFollowSymlinks controls whether WriteFiles copies the data a symlink
+// points to (true) or recreates the link itself on the volume (false).
+func (l *LTFSService) SetFollowSymlinks(follow bool) {
+	l.followSymlinks = follow
+}
+
 // DevicePath returns the configured device path.
 func (l *LTFSService) DevicePath() string {
 	return l.devicePath
@@ -116,6 +123,16 @@ func IsAvailable() bool {
 //
 // Equivalent to: mkltfs -d /dev/nst0 --force [-n label]
 func (l *LTFSService) Format(ctx context.Context, label string) error {
+	// mkltfs rewrites the partitions and the cartridge is reloaded
+	// afterwards, so any cached label or probe result for this drive is stale whatever
+	// the outcome.
+	defer sharedLabelCache.InvalidateReason(l.devicePath, "ltfs_format")
+	defer sharedProbes.Invalidate(l.devicePath)
+
+	if !IsPhysicalDevice(l.devicePath) {
+		return fmt.Errorf("LTFS requires a physical tape drive: %w", ErrNotSupported)
+	}
+
 	args := []string{"-d", l.devicePath, "--force"}
 	if label != "" {
 		args = append(args, "-n", label)
@@ -301,6 +318,10 @@ func (l *LTFSService) reloadCartridge(ctx context.Context) error {
 //
 // Equivalent to: ltfs /mnt/ltfs -o devname=/dev/nst0
 func (l *LTFSService) Mount(ctx context.Context) error {
+	if !IsPhysicalDevice(l.devicePath) {
+		return fmt.Errorf("LTFS requires a physical tape drive: %w", ErrNotSupported)
+	}
+
 	// Ensure mount point directory exists
 	if err := os.MkdirAll(l.mountPoint, 0755); err != nil {
 		return fmt.Errorf("failed to create mount point %s: %w", l.mountPoint, err)
@@ -458,8 +479,14 @@ func (l *LTFSService) WriteFiles(ctx context.Context, sourcePath string, files [
 			return totalBytes, fileCount, fmt.Errorf("failed to create directory %s: %w", destDir, err)
 		}
 
-		// Copy file
-		n, err := copyFile(filePath, destPath)
+		// Copy file, or recreate the link when symlinks are stored as links
+		var n int64
+		var err error
+		if !l.followSymlinks && isSymlink(filePath) {
+			err = copySymlink(filePath, destPath)
+		} else {
+			n, err = copyFile(filePath, destPath)
+		}
 		if err != nil {
 			return totalBytes, fileCount, fmt.Errorf("failed to copy %s to LTFS: %w", relPath, err)
 		}
@@ -559,7 +586,14 @@ func (l *LTFSService) RestoreFiles(ctx context.Context, destPath string, filePat
 			return totalBytes, fileCount, fmt.Errorf("failed to create directory for %s: %w", relPath, err)
 		}
 
-		n, err := copyFile(srcPath, dstPath)
+		// Links on the volume were stored as links; restore them as links
+		var n int64
+		var err error
+		if isSymlink(srcPath) {
+			err = copySymlink(srcPath, dstPath)
+		} else {
+			n, err = copyFile(srcPath, dstPath)
+		}
 		if err != nil {
 			return totalBytes, fileCount, fmt.Errorf("failed to restore %s: %w", relPath, err)
 		}
@@ -833,6 +867,15 @@ func (l *LTFSService) WriteFilesEncrypted(ctx context.Context, sourcePath string
 			return totalBytes, fileCount, fmt.Errorf("failed to create directory %s: %w", destDir, mkErr)
 		}
 
+		// A stored link has no content to encrypt; keep it as a plain link
+		if !l.followSymlinks && isSymlink(filePath) {
+			if linkErr := copySymlink(filePath, filepath.Join(l.mountPoint, relPath)); linkErr != nil {
+				return totalBytes, fileCount, fmt.Errorf("failed to copy link %s to LTFS: %w", relPath, linkErr)
+			}
+			fileCount++
+			continue
+		}
+
 		n, copyErr := copyFileEncrypted(filePath, destPath, encryptionKey)
 		if copyErr != nil {
 			return totalBytes, fileCount, fmt.Errorf("failed to encrypt and copy %s to LTFS: %w", relPath, copyErr)
@@ -887,7 +930,11 @@ func (l *LTFSService) RestoreFilesDecrypted(ctx context.Context, destPath string
 			return totalBytes, fileCount, fmt.Errorf("failed to create directory for %s: %w", outRelPath, mkErr)
 		}
 
-		if strings.HasSuffix(relPath, EncryptedFileSuffix) && encryptionKey != nil {
+		if isSymlink(srcPath) {
+			if linkErr := copySymlink(srcPath, dstPath); linkErr != nil {
+				return totalBytes, fileCount, fmt.Errorf("failed to restore link %s: %w", relPath, linkErr)
+			}
+		} else if strings.HasSuffix(relPath, EncryptedFileSuffix) && encryptionKey != nil {
 			n, decErr := copyFileDecrypted(srcPath, dstPath, encryptionKey)
 			if decErr != nil {
 				return totalBytes, fileCount, fmt.Errorf("failed to decrypt and restore %s: %w", relPath, decErr)
@@ -973,6 +1020,25 @@ func copyFileDecrypted(src, dst string, key []byte) (int64, error) {
 	return int64(len(plaintext)), nil
 }
 
+// isSymlink reports whether path is itself a symbolic link.
+func isSymlink(path string) bool {
+	info, err := os.Lstat(path)
+	return err == nil && info.Mode()&os.ModeSymlink != 0
+}
+
+// copySymlink recreates the symbolic link src at dst with the same target,
+// replacing any existing entry. Dangling links are copied as-is.
+func copySymlink(src, dst string) error {
+	target, err := os.Readlink(src)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(dst); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return os.Symlink(target, dst)
+}
+
 // copyFile copies a single file from src to dst. Returns bytes copied.
 func copyFile(src, dst string) (int64, error) {
 	srcFile, err := os.Open(src)
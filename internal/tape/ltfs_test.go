@@ -543,3 +543,32 @@ func TestIsDeviceBusy(t *testing.T) {
 		})
 	}
 }
+
+func TestCopySymlink(t *testing.T) {
+	tmpDir := t.TempDir()
+	src := filepath.Join(tmpDir, "link")
+	dst := filepath.Join(tmpDir, "copy")
+
+	// Dangling links are copied as-is
+	if err := os.Symlink("../does-not-exist", src); err != nil {
+		t.Fatalf("failed to create symlink: %v", err)
+	}
+	if !isSymlink(src) {
+		t.Fatal("expected isSymlink to detect the link")
+	}
+	os.WriteFile(dst, []byte("stale"), 0644)
+
+	if err := copySymlink(src, dst); err != nil {
+		t.Fatalf("copySymlink failed: %v", err)
+	}
+	target, err := os.Readlink(dst)
+	if err != nil {
+		t.Fatalf("expected dst to be a symlink: %v", err)
+	}
+	if target != "../does-not-exist" {
+		t.Errorf("expected link target ../does-not-exist, got %s", target)
+	}
+	if isSymlink(filepath.Join(tmpDir, "missing")) {
+		t.Error("expected isSymlink to be false for a missing path")
+	}
+}
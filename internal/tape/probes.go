@@ -0,0 +1,192 @@
+package tape
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// DefaultProbeTTL is how long the result of a read-only drive probe is
+// shared with later callers before the hardware is asked again. It is short
+// on purpose: it only absorbs bursts of UI refreshes, it is not a cache of
+// drive state.
+const DefaultProbeTTL = 3 * time.Second
+
+// Probe kinds, one result per device is kept for each
+const (
+	probeStatus = "status"
+	probeLabel  = "label"
+	probeInfo   = "info"
+)
+
+type probeKey struct {
+	devicePath string
+	kind       string
+}
+
+// probeCall is one run of a probe. done is closed when it has finished;
+// callers that arrive while it runs wait for it instead of starting another.
+type probeCall struct {
+	done      chan struct{}
+	value     interface{}
+	err       error
+	at        time.Time
+	cancelled bool // the caller that ran it gave up, so the result is not shared
+}
+
+// ProbeCoordinator coalesces concurrent identical probes of a device and
+// shares their results for a short TTL. The probes themselves still go
+// through the device lock, so they queue behind any other operation on the
+// same drive.
+type ProbeCoordinator struct {
+	mu    sync.Mutex
+	ttl   time.Duration
+	calls map[probeKey]*probeCall
+	runs  map[probeKey]int
+}
+
+// NewProbeCoordinator creates a probe coordinator sharing results for ttl
+func NewProbeCoordinator(ttl time.Duration) *ProbeCoordinator {
+	return &ProbeCoordinator{
+		ttl:   ttl,
+		calls: make(map[probeKey]*probeCall),
+		runs:  make(map[probeKey]int),
+	}
+}
+
+// sharedProbes is used by every Service so that probes from different
+// endpoints and per-device services are coalesced with each other.
+var sharedProbes = NewProbeCoordinator(DefaultProbeTTL)
+
+// SharedProbes returns the process-wide probe coordinator
+func SharedProbes() *ProbeCoordinator {
+	return sharedProbes
+}
+
+// do returns the result of the probe for the device, running fn only if no
+// identical probe is running and no fresh result is held
+func (pc *ProbeCoordinator) do(ctx context.Context, devicePath, kind string, fn func(context.Context) (interface{}, error)) (interface{}, error) {
+	key := probeKey{devicePath, kind}
+	for {
+		pc.mu.Lock()
+		call, ok := pc.calls[key]
+		if ok {
+			select {
+			case <-call.done:
+				if time.Since(call.at) <= pc.ttl {
+					pc.mu.Unlock()
+					return call.value, call.err
+				}
+				ok = false
+			default:
+			}
+		}
+		if !ok {
+			call = &probeCall{done: make(chan struct{})}
+			pc.calls[key] = call
+			pc.runs[key]++
+			pc.mu.Unlock()
+
+			value, err := fn(ctx)
+			pc.mu.Lock()
+			call.value, call.err, call.at = value, err, time.Now()
+			call.cancelled = ctx.Err() != nil
+			if call.cancelled && pc.calls[key] == call {
+				delete(pc.calls, key)
+			}
+			close(call.done)
+			pc.mu.Unlock()
+			return value, err
+		}
+		pc.mu.Unlock()
+
+		select {
+		case <-call.done:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+		if !call.cancelled {
+			return call.value, call.err
+		}
+		// The probe was abandoned by the caller that ran it; run it again
+		// for this caller
+	}
+}
+
+// Invalidate drops the held results for a device so the next probe asks
+// the hardware. Call it after anything that changes what is in the drive.
+// A probe already running is only shared with the callers waiting for it.
+func (pc *ProbeCoordinator) Invalidate(devicePath string) {
+	pc.mu.Lock()
+	defer pc.mu.Unlock()
+	for key := range pc.calls {
+		if key.devicePath == devicePath {
+			delete(pc.calls, key)
+		}
+	}
+}
+
+// Runs returns how many times a probe kind has actually run against the
+// device, for tests and diagnostics
+func (pc *ProbeCoordinator) Runs(devicePath, kind string) int {
+	pc.mu.Lock()
+	defer pc.mu.Unlock()
+	return pc.runs[probeKey{devicePath, kind}]
+}
+
+// ProbeStatus returns the drive status like GetStatus, sharing the result
+// with concurrent and recent callers. Use it for status polled by the UI;
+// operations about to write should call GetStatus.
+func (s *Service) ProbeStatus(ctx context.Context) (*DriveStatus, error) {
+	value, err := s.probes.do(ctx, s.devicePath, probeStatus, func(ctx context.Context) (interface{}, error) {
+		return s.GetStatus(ctx)
+	})
+	status, _ := value.(*DriveStatus)
+	if status == nil {
+		return nil, err
+	}
+	copied := *status
+	return &copied, err
+}
+
+// ProbeTapeLoaded reports whether a tape is loaded like IsTapeLoaded, from a
+// shared status probe
+func (s *Service) ProbeTapeLoaded(ctx context.Context) (bool, error) {
+	status, err := s.ProbeStatus(ctx)
+	if err != nil {
+		return false, err
+	}
+	return status.Online && status.Ready && status.Error == "", nil
+}
+
+// ProbeLabel reads the tape label like ReadTapeLabel, sharing the result
+// with concurrent and recent callers so a burst of refreshes rewinds the
+// tape once
+func (s *Service) ProbeLabel(ctx context.Context) (*TapeLabelData, error) {
+	value, err := s.probes.do(ctx, s.devicePath, probeLabel, func(ctx context.Context) (interface{}, error) {
+		return s.ReadTapeLabel(ctx)
+	})
+	label, _ := value.(*TapeLabelData)
+	if label == nil {
+		return nil, err
+	}
+	copied := *label
+	return &copied, err
+}
+
+// ProbeDriveInfo returns the drive inquiry data like GetDriveInfo, sharing
+// the result with concurrent and recent callers
+func (s *Service) ProbeDriveInfo(ctx context.Context) (map[string]string, error) {
+	value, err := s.probes.do(ctx, s.devicePath, probeInfo, func(ctx context.Context) (interface{}, error) {
+		return s.GetDriveInfo(ctx)
+	})
+	info, _ := value.(map[string]string)
+	if info == nil {
+		return nil, err
+	}
+	copied := make(map[string]string, len(info))
+	for k, v := range info {
+		copied[k] = v
+	}
+	return copied, err
+}
@@ -0,0 +1,105 @@
+package tape
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestProbeCoordinatorCoalesces(t *testing.T) {
+	ctx := context.Background()
+	pc := NewProbeCoordinator(time.Minute)
+
+	// Identical probes arriving while one runs share its result
+	release := make(chan struct{})
+	started := make(chan struct{})
+	probe := func(ctx context.Context) (interface{}, error) {
+		close(started)
+		<-release
+		return "online", nil
+	}
+	var wg sync.WaitGroup
+	results := make([]interface{}, 5)
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		results[0], _ = pc.do(ctx, "/dev/nst0", probeStatus, probe)
+	}()
+	<-started
+	for i := 1; i < len(results); i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			results[i], _ = pc.do(ctx, "/dev/nst0", probeStatus, probe)
+		}(i)
+	}
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+	wg.Wait()
+	for i, r := range results {
+		if r != "online" {
+			t.Errorf("caller %d got %v", i, r)
+		}
+	}
+	if runs := pc.Runs("/dev/nst0", probeStatus); runs != 1 {
+		t.Fatalf("expected one probe of the drive, got %d", runs)
+	}
+
+	// Later callers reuse the result until it is invalidated; other devices
+	// and probe kinds are probed separately
+	count := func(ctx context.Context) (interface{}, error) { return "again", nil }
+	if r, _ := pc.do(ctx, "/dev/nst0", probeStatus, count); r != "online" {
+		t.Errorf("expected the held result, got %v", r)
+	}
+	pc.do(ctx, "/dev/nst1", probeStatus, count)
+	pc.do(ctx, "/dev/nst0", probeLabel, count)
+	pc.Invalidate("/dev/nst0")
+	if r, _ := pc.do(ctx, "/dev/nst0", probeStatus, count); r != "again" {
+		t.Errorf("expected a new probe after invalidation, got %v", r)
+	}
+	if pc.Runs("/dev/nst0", probeStatus) != 2 || pc.Runs("/dev/nst1", probeStatus) != 1 || pc.Runs("/dev/nst0", probeLabel) != 1 {
+		t.Errorf("unexpected probe counts")
+	}
+
+	// A probe abandoned by its caller is not shared
+	cancelled, cancel := context.WithCancel(ctx)
+	cancel()
+	pc.do(cancelled, "/dev/nst2", probeStatus, func(ctx context.Context) (interface{}, error) { return nil, ctx.Err() })
+	if r, err := pc.do(ctx, "/dev/nst2", probeStatus, count); r != "again" || err != nil {
+		t.Errorf("expected a new probe after a cancelled one, got %v, %v", r, err)
+	}
+}
+
+func TestProbeTTL(t *testing.T) {
+	ctx := context.Background()
+	pc := NewProbeCoordinator(20 * time.Millisecond)
+	probe := func(ctx context.Context) (interface{}, error) { return nil, nil }
+	pc.do(ctx, "/dev/nst0", probeInfo, probe)
+	pc.do(ctx, "/dev/nst0", probeInfo, probe)
+	time.Sleep(40 * time.Millisecond)
+	pc.do(ctx, "/dev/nst0", probeInfo, probe)
+	if runs := pc.Runs("/dev/nst0", probeInfo); runs != 2 {
+		t.Fatalf("expected the drive probed again after the TTL, got %d probes", runs)
+	}
+}
+
+func TestProbeLabelInvalidatedByWrite(t *testing.T) {
+	ctx := context.Background()
+	devicePath := "file://" + t.TempDir()
+	svc := NewServiceForDevice(devicePath, 65536)
+
+	if label, err := svc.ProbeLabel(ctx); err != nil || label != nil {
+		t.Fatalf("expected no label on blank media, got %+v, %v", label, err)
+	}
+	if err := svc.WriteTapeLabel(ctx, "PR0001", "uuid-pr", "DAILY"); err != nil {
+		t.Fatalf("WriteTapeLabel: %v", err)
+	}
+	label, err := svc.ProbeLabel(ctx)
+	if err != nil || label == nil || label.Label != "PR0001" {
+		t.Fatalf("expected the new label after writing it, got %+v, %v", label, err)
+	}
+	if loaded, err := svc.ProbeTapeLoaded(ctx); err != nil || !loaded {
+		t.Fatalf("expected virtual media loaded, got %v, %v", loaded, err)
+	}
+}
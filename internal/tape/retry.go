@@ -0,0 +1,168 @@
+package tape
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"syscall"
+	"time"
+)
+
+// DefaultWriteRetryDelay is the wait before the first retry of a failed
+// block write
+const DefaultWriteRetryDelay = 2 * time.Second
+
+// WriteRetryPolicy controls how a block that failed to write is retried
+type WriteRetryPolicy struct {
+	// Retries is how many times a block is written again after a transient
+	// error before the write fails. 0 disables retries.
+	Retries int
+	// Delay is the wait before the first retry, doubled for each further one
+	Delay time.Duration
+}
+
+// IsTransientWriteError reports whether a write error may clear once the
+// drive is re-positioned and the block written again. A full tape is not
+// transient: it is handled by spanning onto the next tape.
+func IsTransientWriteError(err error) bool {
+	return errors.Is(err, syscall.EIO) || errors.Is(err, syscall.ETIMEDOUT) || errors.Is(err, syscall.EBUSY)
+}
+
+// RetryingWriter writes a stream to a drive one block at a time. The block
+// number after each successful write is its checkpoint: when a write fails
+// with a transient error, the writer re-positions the drive at that block
+// and writes the failed block again, so hours of streaming are not lost to
+// one SCSI error.
+type RetryingWriter struct {
+	ctx     context.Context
+	backend Backend
+	policy  WriteRetryPolicy
+	onRetry func(block int64, attempt int, err error)
+
+	w          io.WriteCloser
+	buf        []byte
+	n          int
+	startBlock int64
+	positioned bool // startBlock is known, so the drive can be re-positioned
+	blocks     int64
+	retries    int
+	closed     bool
+}
+
+// NewRetryingWriter opens a writer at the current position of the backend.
+// onRetry, when not nil, is called before each retry with the block being
+// written again. Without a known position the writer cannot re-position, and
+// write errors fail at once.
+func NewRetryingWriter(ctx context.Context, backend Backend, blockSize int, policy WriteRetryPolicy, onRetry func(block int64, attempt int, err error)) (*RetryingWriter, error) {
+	if blockSize <= 0 {
+		return nil, fmt.Errorf("invalid block size %d", blockSize)
+	}
+	if policy.Delay <= 0 {
+		policy.Delay = DefaultWriteRetryDelay
+	}
+	rw := &RetryingWriter{
+		ctx:     ctx,
+		backend: backend,
+		policy:  policy,
+		onRetry: onRetry,
+		buf:     make([]byte, blockSize),
+	}
+	if status, err := backend.Status(ctx); err == nil && status.Error == "" {
+		rw.startBlock = status.BlockNumber
+		rw.positioned = true
+	}
+	w, err := backend.OpenWriter(ctx)
+	if err != nil {
+		return nil, err
+	}
+	rw.w = w
+	return rw, nil
+}
+
+// Write buffers p and writes every block it completes
+func (rw *RetryingWriter) Write(p []byte) (int, error) {
+	written := 0
+	for len(p) > 0 {
+		c := copy(rw.buf[rw.n:], p)
+		rw.n += c
+		p = p[c:]
+		written += c
+		if rw.n == len(rw.buf) {
+			if err := rw.writeBlock(rw.buf); err != nil {
+				return written, err
+			}
+			rw.n = 0
+		}
+	}
+	return written, nil
+}
+
+// Close writes the last, possibly short, block and closes the drive
+func (rw *RetryingWriter) Close() error {
+	if rw.closed {
+		return nil
+	}
+	rw.closed = true
+	var err error
+	if rw.n > 0 {
+		err = rw.writeBlock(rw.buf[:rw.n])
+		rw.n = 0
+	}
+	if closeErr := rw.w.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// Retries returns how many block writes were retried
+func (rw *RetryingWriter) Retries() int {
+	return rw.retries
+}
+
+// writeBlock writes one block, re-positioning and retrying it after a
+// transient error until the policy's retries are used up
+func (rw *RetryingWriter) writeBlock(block []byte) error {
+	delay := rw.policy.Delay
+	for attempt := 0; ; attempt++ {
+		_, err := rw.w.Write(block)
+		if err == nil {
+			rw.blocks++
+			return nil
+		}
+		blockNum := rw.startBlock + rw.blocks
+		if !IsTransientWriteError(err) || !rw.positioned || attempt >= rw.policy.Retries {
+			if attempt > 0 {
+				return fmt.Errorf("write failed at block %d after %d retries: %w", blockNum, attempt, err)
+			}
+			return err
+		}
+		rw.retries++
+		if rw.onRetry != nil {
+			rw.onRetry(blockNum, attempt+1, err)
+		}
+		if err := rw.reposition(blockNum, delay); err != nil {
+			return fmt.Errorf("failed to re-position to block %d after a write error: %w", blockNum, err)
+		}
+		delay *= 2
+	}
+}
+
+// reposition reopens the drive at block after waiting delay
+func (rw *RetryingWriter) reposition(block int64, delay time.Duration) error {
+	rw.w.Close()
+	select {
+	case <-rw.ctx.Done():
+		return rw.ctx.Err()
+	case <-time.After(delay):
+	}
+	if err := rw.backend.SeekBlock(rw.ctx, block); err != nil {
+		return err
+	}
+	w, err := rw.backend.OpenWriter(rw.ctx)
+	if err != nil {
+		return err
+	}
+	rw.w = w
+	return nil
+}
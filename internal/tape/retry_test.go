@@ -0,0 +1,105 @@
+package tape
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"os"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// flakyDrive records blocks by position and fails the writes listed in
+// failAt, keyed by block number
+type flakyDrive struct {
+	nullBackend
+	blocks  map[int64][]byte
+	pos     int64
+	failAt  map[int64]int
+	failErr error
+	seeks   []int64
+}
+
+func (d *flakyDrive) Status(ctx context.Context) (*DriveStatus, error) {
+	return &DriveStatus{BlockNumber: d.pos}, nil
+}
+
+func (d *flakyDrive) SeekBlock(ctx context.Context, block int64) error {
+	d.seeks = append(d.seeks, block)
+	d.pos = block
+	return nil
+}
+
+func (d *flakyDrive) OpenWriter(ctx context.Context) (io.WriteCloser, error) {
+	return &flakyWriter{d: d}, nil
+}
+
+type flakyWriter struct{ d *flakyDrive }
+
+func (w *flakyWriter) Write(p []byte) (int, error) {
+	if w.d.failAt[w.d.pos] > 0 {
+		w.d.failAt[w.d.pos]--
+		// A failed write may still have moved the head
+		w.d.pos++
+		return 0, &os.PathError{Op: "write", Path: "/dev/nst0", Err: w.d.failErr}
+	}
+	w.d.blocks[w.d.pos] = append([]byte(nil), p...)
+	w.d.pos++
+	return len(p), nil
+}
+
+func (w *flakyWriter) Close() error { return nil }
+
+func TestRetryingWriter(t *testing.T) {
+	ctx := context.Background()
+	policy := WriteRetryPolicy{Retries: 2, Delay: time.Millisecond}
+	data := bytes.Repeat([]byte("0123456789"), 10)
+
+	write := func(d *flakyDrive) (*RetryingWriter, error) {
+		t.Helper()
+		rw, err := NewRetryingWriter(ctx, d, 16, policy, nil)
+		if err != nil {
+			t.Fatalf("NewRetryingWriter: %v", err)
+		}
+		if _, err := rw.Write(data); err != nil {
+			rw.Close()
+			return rw, err
+		}
+		return rw, rw.Close()
+	}
+	contents := func(d *flakyDrive) []byte {
+		var out []byte
+		for b := int64(10); b < d.pos; b++ {
+			out = append(out, d.blocks[b]...)
+		}
+		return out
+	}
+
+	// A block that fails twice is re-positioned and written again, and the
+	// stream on tape is intact
+	d := &flakyDrive{blocks: map[int64][]byte{}, pos: 10, failAt: map[int64]int{12: 2}, failErr: syscall.EIO}
+	rw, err := write(d)
+	if err != nil {
+		t.Fatalf("write with retries failed: %v", err)
+	}
+	if rw.Retries() != 2 || len(d.seeks) != 2 || d.seeks[0] != 12 || d.seeks[1] != 12 {
+		t.Errorf("expected 2 retries at block 12, got %d retries, seeks %v", rw.Retries(), d.seeks)
+	}
+	if !bytes.Equal(contents(d), data) {
+		t.Errorf("tape contents differ from the stream written")
+	}
+
+	// Once the retries are used up the write fails
+	d = &flakyDrive{blocks: map[int64][]byte{}, pos: 10, failAt: map[int64]int{13: 3}, failErr: syscall.EIO}
+	if _, err := write(d); !errors.Is(err, syscall.EIO) {
+		t.Fatalf("expected EIO after exhausting retries, got %v", err)
+	}
+
+	// Errors that are not transient fail at once
+	d = &flakyDrive{blocks: map[int64][]byte{}, pos: 10, failAt: map[int64]int{11: 1}, failErr: syscall.ENOSPC}
+	if _, err := write(d); !errors.Is(err, syscall.ENOSPC) || len(d.seeks) != 0 {
+		t.Fatalf("expected ENOSPC without retrying, got %v (seeks %v)", err, d.seeks)
+	}
+}
@@ -7,10 +7,11 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
 	"os"
 	"os/exec"
 	"path/filepath"
-	"regexp"
+	"sort"
 	"strconv"
 	"strings"
 	"sync"
@@ -125,6 +126,10 @@ type TapeContentEntry struct {
 	Path        string `json:"path"`
 }
 
+// DefaultLabelCacheTTL is how long a cached label is trusted before callers
+// re-read it from the tape.
+const DefaultLabelCacheTTL = 5 * time.Minute
+
 // CachedLabel holds a cached tape label for a drive
 type CachedLabel struct {
 	Label       *TapeLabelData
@@ -132,19 +137,51 @@ type CachedLabel struct {
 	DriveOnline bool
 }
 
+// LabelInvalidation records the most recent invalidation of a device's entry
+type LabelInvalidation struct {
+	Reason string
+	At     time.Time
+}
+
+// LabelCacheEntry is a point-in-time view of one device's cache state, used
+// by the cache audit endpoint.
+type LabelCacheEntry struct {
+	DevicePath       string         `json:"device_path"`
+	Cached           bool           `json:"cached"`
+	Label            *TapeLabelData `json:"label,omitempty"`
+	DriveOnline      bool           `json:"drive_online"`
+	CachedAt         *time.Time     `json:"cached_at,omitempty"`
+	AgeSeconds       float64        `json:"age_seconds"`
+	TTLSeconds       float64        `json:"ttl_seconds"`
+	Expired          bool           `json:"expired"`
+	InvalidatedAt    *time.Time     `json:"invalidated_at,omitempty"`
+	InvalidateReason string         `json:"invalidate_reason,omitempty"`
+}
+
 // LabelCache provides thread-safe caching of tape labels per device
 type LabelCache struct {
-	mu    sync.RWMutex
-	cache map[string]*CachedLabel
+	mu          sync.RWMutex
+	cache       map[string]*CachedLabel
+	invalidated map[string]LabelInvalidation
 }
 
 // NewLabelCache creates a new label cache
 func NewLabelCache() *LabelCache {
 	return &LabelCache{
-		cache: make(map[string]*CachedLabel),
+		cache:       make(map[string]*CachedLabel),
+		invalidated: make(map[string]LabelInvalidation),
 	}
 }
 
+// sharedLabelCache is used by every Service so that an operation performed
+// through a per-device service is visible to all other readers of the cache.
+var sharedLabelCache = NewLabelCache()
+
+// SharedLabelCache returns the process-wide label cache
+func SharedLabelCache() *LabelCache {
+	return sharedLabelCache
+}
+
 // Get returns the cached label for a device, or nil if not cached or expired
 func (lc *LabelCache) Get(devicePath string, maxAge time.Duration) *CachedLabel {
 	lc.mu.RLock()
@@ -172,24 +209,82 @@ func (lc *LabelCache) Set(devicePath string, label *TapeLabelData, online bool)
 
 // Invalidate removes the cached label for a device (call on eject/load)
 func (lc *LabelCache) Invalidate(devicePath string) {
+	lc.InvalidateReason(devicePath, "manual")
+}
+
+// InvalidateReason removes the cached label for a device and records why,
+// so the audit endpoint can show which operation last cleared it.
+func (lc *LabelCache) InvalidateReason(devicePath, reason string) {
 	lc.mu.Lock()
 	defer lc.mu.Unlock()
 	delete(lc.cache, devicePath)
+	lc.invalidated[devicePath] = LabelInvalidation{Reason: reason, At: time.Now()}
 }
 
 // InvalidateAll clears the entire cache
 func (lc *LabelCache) InvalidateAll() {
+	lc.InvalidateAllReason("manual")
+}
+
+// InvalidateAllReason clears the entire cache and records the reason against
+// every device that had an entry.
+func (lc *LabelCache) InvalidateAllReason(reason string) {
 	lc.mu.Lock()
 	defer lc.mu.Unlock()
+	now := time.Now()
+	for devicePath := range lc.cache {
+		lc.invalidated[devicePath] = LabelInvalidation{Reason: reason, At: now}
+	}
 	lc.cache = make(map[string]*CachedLabel)
 }
 
+// Entries returns the state of every device the cache has seen, sorted by
+// device path, with ages evaluated against ttl.
+func (lc *LabelCache) Entries(ttl time.Duration) []LabelCacheEntry {
+	lc.mu.RLock()
+	defer lc.mu.RUnlock()
+
+	paths := make(map[string]struct{}, len(lc.cache)+len(lc.invalidated))
+	for p := range lc.cache {
+		paths[p] = struct{}{}
+	}
+	for p := range lc.invalidated {
+		paths[p] = struct{}{}
+	}
+
+	now := time.Now()
+	entries := make([]LabelCacheEntry, 0, len(paths))
+	for p := range paths {
+		e := LabelCacheEntry{DevicePath: p, TTLSeconds: ttl.Seconds()}
+		if c, ok := lc.cache[p]; ok {
+			cachedAt := c.CachedAt
+			age := now.Sub(cachedAt)
+			e.Cached = true
+			e.Label = c.Label
+			e.DriveOnline = c.DriveOnline
+			e.CachedAt = &cachedAt
+			e.AgeSeconds = age.Seconds()
+			e.Expired = age > ttl
+		}
+		if inv, ok := lc.invalidated[p]; ok {
+			at := inv.At
+			e.InvalidatedAt = &at
+			e.InvalidateReason = inv.Reason
+		}
+		entries = append(entries, e)
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].DevicePath < entries[j].DevicePath })
+	return entries
+}
+
 // Service provides tape drive operations
 type Service struct {
 	devicePath string
 	blockSize  int
 	labelCache *LabelCache
+	probes     *ProbeCoordinator
 	deviceMu   *sync.Mutex // serializes access to the tape device (shared per device path)
+	backend    Backend     // media primitives (shared per device path)
 }
 
 // GetBlockSize returns the configured block size
@@ -202,8 +297,10 @@ func NewService(devicePath string, blockSize int) *Service {
 	return &Service{
 		devicePath: devicePath,
 		blockSize:  blockSize,
-		labelCache: NewLabelCache(),
+		labelCache: sharedLabelCache,
+		probes:     sharedProbes,
 		deviceMu:   getDeviceLock(devicePath),
+		backend:    BackendFor(devicePath),
 	}
 }
 
@@ -212,8 +309,10 @@ func NewServiceForDevice(devicePath string, blockSize int) *Service {
 	return &Service{
 		devicePath: devicePath,
 		blockSize:  blockSize,
-		labelCache: NewLabelCache(),
+		labelCache: sharedLabelCache,
+		probes:     sharedProbes,
 		deviceMu:   getDeviceLock(devicePath),
+		backend:    BackendFor(devicePath),
 	}
 }
 
@@ -222,6 +321,27 @@ func (s *Service) DevicePath() string {
 	return s.devicePath
 }
 
+// Backend returns the storage backend selected by the device path
+func (s *Service) Backend() Backend {
+	return s.backend
+}
+
+// IsPhysical reports whether the service drives a real tape device
+func (s *Service) IsPhysical() bool {
+	return IsPhysicalDevice(s.devicePath)
+}
+
+// OpenReader streams the tape file at the current position. Callers are
+// expected to have positioned the media first.
+func (s *Service) OpenReader(ctx context.Context) (io.ReadCloser, error) {
+	return s.backend.OpenReader(ctx)
+}
+
+// OpenWriter streams data onto the media at the current position
+func (s *Service) OpenWriter(ctx context.Context) (io.WriteCloser, error) {
+	return s.backend.OpenWriter(ctx)
+}
+
 // GetLabelCache returns the label cache for external use
 func (s *Service) GetLabelCache() *LabelCache {
 	return s.labelCache
@@ -339,65 +459,11 @@ func (s *Service) GetStatus(ctx context.Context) (*DriveStatus, error) {
 // getStatusLocked is the internal implementation of GetStatus.
 // The caller must hold s.deviceMu.
 func (s *Service) getStatusLocked(ctx context.Context) (*DriveStatus, error) {
-	status := &DriveStatus{
-		DevicePath:  s.devicePath,
-		LastChecked: time.Now(),
-	}
-
-	// Create a context with timeout to prevent indefinite blocking
-	opCtx, cancel := context.WithTimeout(ctx, DefaultOperationTimeout)
-	defer cancel()
-
-	cmd := exec.CommandContext(opCtx, "mt", "-f", s.devicePath, "status")
-	output, err := cmd.CombinedOutput()
-	if err != nil {
-		// Check if the error was due to context timeout/cancellation
-		if opCtx.Err() == context.DeadlineExceeded {
-			status.Error = fmt.Sprintf("tape status operation timed out after %v", DefaultOperationTimeout)
-			return status, ErrOperationTimeout
-		}
-		if opCtx.Err() == context.Canceled {
-			status.Error = "tape status operation cancelled"
-			return status, ctx.Err()
-		}
-		status.Error = fmt.Sprintf("failed to get tape status: %s", string(output))
-		return status, nil
-	}
-
-	// Parse mt status output
-	outputStr := string(output)
-	status.Online = !strings.Contains(outputStr, "offline")
-	status.Ready = strings.Contains(outputStr, "ONLINE") || strings.Contains(outputStr, "DR_OPEN")
-	status.WriteProtect = strings.Contains(outputStr, "WR_PROT")
-	status.BOT = strings.Contains(outputStr, "BOT")
-	status.EOT = strings.Contains(outputStr, "EOT")
-	status.EOF = strings.Contains(outputStr, "EOF")
-
-	// Parse file and block numbers
-	fileNumRe := regexp.MustCompile(`File number=(\d+)`)
-	if matches := fileNumRe.FindStringSubmatch(outputStr); len(matches) > 1 {
-		status.FileNumber, _ = strconv.ParseInt(matches[1], 10, 64)
-	}
-
-	blockNumRe := regexp.MustCompile(`block number=(\d+)`)
-	if matches := blockNumRe.FindStringSubmatch(outputStr); len(matches) > 1 {
-		status.BlockNumber, _ = strconv.ParseInt(matches[1], 10, 64)
+	status, err := s.backend.Status(ctx)
+	if status != nil {
+		status.DevicePath = s.devicePath
 	}
-
-	// Parse density
-	densityRe := regexp.MustCompile(`Tape block size (\d+) bytes\. Density code (0x[0-9a-fA-F]+)`)
-	if matches := densityRe.FindStringSubmatch(outputStr); len(matches) > 2 {
-		status.BlockSize, _ = strconv.Atoi(matches[1])
-		status.Density = matches[2]
-	}
-
-	// Parse LTO type from density description (e.g., "Density code 0x58 (LTO-5).")
-	ltoDescRe := regexp.MustCompile(`Density code 0x[0-9a-fA-F]+ \((LTO-\d+)\)`)
-	if matches := ltoDescRe.FindStringSubmatch(outputStr); len(matches) > 1 {
-		status.DriveType = matches[1]
-	}
-
-	return status, nil
+	return status, err
 }
 
 // Rewind rewinds the tape to the beginning.
@@ -411,37 +477,20 @@ func (s *Service) Rewind(ctx context.Context) error {
 // rewindLocked is the internal implementation of Rewind.
 // The caller must hold s.deviceMu.
 func (s *Service) rewindLocked(ctx context.Context) error {
-	// Create a context with timeout to prevent indefinite blocking
-	opCtx, cancel := context.WithTimeout(ctx, DefaultOperationTimeout)
-	defer cancel()
-
-	cmd := exec.CommandContext(opCtx, "mt", "-f", s.devicePath, "rewind")
-	output, err := cmd.CombinedOutput()
-	if err != nil {
-		// Check if the error was due to context timeout/cancellation
-		if opCtx.Err() == context.DeadlineExceeded {
-			return fmt.Errorf("rewind timed out after %v: %w", DefaultOperationTimeout, ErrOperationTimeout)
-		}
-		if opCtx.Err() == context.Canceled {
-			return fmt.Errorf("rewind cancelled: %w", ctx.Err())
-		}
-		return fmt.Errorf("rewind failed: %s", string(output))
-	}
-	return nil
+	return s.backend.Rewind(ctx)
 }
 
 // Eject ejects the tape from the drive
 func (s *Service) Eject(ctx context.Context) error {
 	s.deviceMu.Lock()
 	defer s.deviceMu.Unlock()
-	cmd := exec.CommandContext(ctx, "mt", "-f", s.devicePath, "eject")
-	output, err := cmd.CombinedOutput()
-	if err != nil {
-		return fmt.Errorf("eject failed: %s", string(output))
+	if err := s.backend.Eject(ctx); err != nil {
+		return err
 	}
 	if s.labelCache != nil {
-		s.labelCache.Invalidate(s.devicePath)
+		s.labelCache.InvalidateReason(s.devicePath, "eject")
 	}
+	s.probes.Invalidate(s.devicePath)
 	return nil
 }
 
@@ -449,14 +498,13 @@ func (s *Service) Eject(ctx context.Context) error {
 func (s *Service) Load(ctx context.Context) error {
 	s.deviceMu.Lock()
 	defer s.deviceMu.Unlock()
-	cmd := exec.CommandContext(ctx, "mt", "-f", s.devicePath, "load")
-	output, err := cmd.CombinedOutput()
-	if err != nil {
-		return fmt.Errorf("load failed: %s", string(output))
+	if err := s.backend.Load(ctx); err != nil {
+		return err
 	}
 	if s.labelCache != nil {
-		s.labelCache.Invalidate(s.devicePath)
+		s.labelCache.InvalidateReason(s.devicePath, "load")
 	}
+	s.probes.Invalidate(s.devicePath)
 	return nil
 }
 
@@ -464,6 +512,10 @@ func (s *Service) Load(ctx context.Context) error {
 func (s *Service) Retension(ctx context.Context) error {
 	s.deviceMu.Lock()
 	defer s.deviceMu.Unlock()
+	if !s.IsPhysical() {
+		// Virtual media has nothing to wind
+		return nil
+	}
 	cmd := exec.CommandContext(ctx, "mt", "-f", s.devicePath, "retension")
 	output, err := cmd.CombinedOutput()
 	if err != nil {
@@ -492,12 +544,7 @@ func (s *Service) seekToFileNumberLocked(ctx context.Context, fileNum int64) err
 	}
 
 	// Forward space to file number
-	cmd := exec.CommandContext(ctx, "mt", "-f", s.devicePath, "fsf", strconv.FormatInt(fileNum, 10))
-	output, err := cmd.CombinedOutput()
-	if err != nil {
-		return fmt.Errorf("seek failed: %s", string(output))
-	}
-	return nil
+	return s.backend.SpaceFiles(ctx, fileNum)
 }
 
 // GetTapePosition returns the current file number and block number of the tape head
@@ -519,12 +566,7 @@ func (s *Service) GetTapePosition(ctx context.Context) (fileNumber, blockNumber
 func (s *Service) SeekToBlock(ctx context.Context, blockNum int64) error {
 	s.deviceMu.Lock()
 	defer s.deviceMu.Unlock()
-	cmd := exec.CommandContext(ctx, "mt", "-f", s.devicePath, "seek", strconv.FormatInt(blockNum, 10))
-	output, err := cmd.CombinedOutput()
-	if err != nil {
-		return fmt.Errorf("seek to block failed: %s", string(output))
-	}
-	return nil
+	return s.backend.SeekBlock(ctx, blockNum)
 }
 
 // WriteFileMark writes a file mark on the tape
@@ -537,12 +579,7 @@ func (s *Service) WriteFileMark(ctx context.Context) error {
 // writeFileMarkLocked is the internal implementation of WriteFileMark.
 // The caller must hold s.deviceMu.
 func (s *Service) writeFileMarkLocked(ctx context.Context) error {
-	cmd := exec.CommandContext(ctx, "mt", "-f", s.devicePath, "weof", "1")
-	output, err := cmd.CombinedOutput()
-	if err != nil {
-		return fmt.Errorf("write file mark failed: %s", string(output))
-	}
-	return nil
+	return s.backend.WriteFileMark(ctx)
 }
 
 const (
@@ -560,23 +597,7 @@ func (s *Service) SetBlockSize(ctx context.Context, size int) error {
 // setBlockSizeLocked is the internal implementation of SetBlockSize.
 // The caller must hold s.deviceMu.
 func (s *Service) setBlockSizeLocked(ctx context.Context, size int) error {
-	// Create a context with timeout to prevent indefinite blocking
-	opCtx, cancel := context.WithTimeout(ctx, DefaultOperationTimeout)
-	defer cancel()
-
-	cmd := exec.CommandContext(opCtx, "mt", "-f", s.devicePath, "setblk", strconv.Itoa(size))
-	output, err := cmd.CombinedOutput()
-	if err != nil {
-		// Check if the error was due to context timeout/cancellation
-		if opCtx.Err() == context.DeadlineExceeded {
-			return fmt.Errorf("set block size timed out after %v: %w", DefaultOperationTimeout, ErrOperationTimeout)
-		}
-		if opCtx.Err() == context.Canceled {
-			return fmt.Errorf("set block size cancelled: %w", ctx.Err())
-		}
-		return fmt.Errorf("set block size failed: %s", string(output))
-	}
-	return nil
+	return s.backend.SetBlockSize(ctx, size)
 }
 
 const (
@@ -620,8 +641,7 @@ func (s *Service) ReadTapeLabel(ctx context.Context) (*TapeLabelData, error) {
 	defer cancel()
 
 	// Read first block which should contain the label
-	cmd := exec.CommandContext(opCtx, "dd", fmt.Sprintf("if=%s", s.devicePath), "bs=512", "count=1")
-	output, err := cmd.Output()
+	output, err := s.backend.ReadBlocks(opCtx, 512, 1)
 	if err != nil {
 		// Check if the error was due to context timeout/cancellation
 		if opCtx.Err() == context.DeadlineExceeded {
@@ -699,12 +719,16 @@ func (s *Service) WriteTapeLabel(ctx context.Context, label string, uuid string,
 	padded := make([]byte, 512)
 	copy(padded, []byte(labelData))
 
+	// Drop the old entry first: a failed write may leave the label block
+	// partially overwritten, so the previous label can no longer be trusted.
+	if s.labelCache != nil {
+		s.labelCache.InvalidateReason(s.devicePath, "label_write")
+	}
+	s.probes.Invalidate(s.devicePath)
+
 	// Write label
-	cmd := exec.CommandContext(ctx, "dd", fmt.Sprintf("of=%s", s.devicePath), "bs=512", "count=1")
-	cmd.Stdin = bytes.NewReader(padded)
-	output, err := cmd.CombinedOutput()
-	if err != nil {
-		return fmt.Errorf("failed to write label: %s", string(output))
+	if err := s.backend.WriteBlocks(ctx, 512, padded); err != nil {
+		return fmt.Errorf("failed to write label: %w", err)
 	}
 
 	// Write file mark after label
@@ -741,15 +765,14 @@ func (s *Service) EraseTape(ctx context.Context) error {
 	}
 
 	// Write end-of-data mark at beginning to effectively erase
-	cmd := exec.CommandContext(ctx, "mt", "-f", s.devicePath, "weof", "1")
-	output, err := cmd.CombinedOutput()
-	if err != nil {
-		return fmt.Errorf("erase failed: %s", string(output))
+	if err := s.backend.WriteFileMark(ctx); err != nil {
+		return fmt.Errorf("erase failed: %w", err)
 	}
 
 	if s.labelCache != nil {
-		s.labelCache.Invalidate(s.devicePath)
+		s.labelCache.InvalidateReason(s.devicePath, "erase")
 	}
+	s.probes.Invalidate(s.devicePath)
 	// Rewind again after erase
 	return s.rewindLocked(ctx)
 }
@@ -760,6 +783,11 @@ func (s *Service) GetDriveInfo(ctx context.Context) (map[string]string, error) {
 	defer s.deviceMu.Unlock()
 
 	info := make(map[string]string)
+	if !s.IsPhysical() {
+		info["Vendor identification"] = "TapeBackarr"
+		info["Product identification"] = fmt.Sprintf("Virtual (%s)", s.backend.Type())
+		return info, nil
+	}
 
 	// Try to get device info using sg_inq
 	cmd := exec.CommandContext(ctx, "sg_inq", s.devicePath)
@@ -867,6 +895,58 @@ func (s *Service) DetectTapeType(ctx context.Context) (string, error) {
 	return "", nil
 }
 
+// MediaInfo describes the tape loaded in a drive as the drive reports it
+type MediaInfo struct {
+	LTOType string `json:"lto_type,omitempty"`
+	Density string `json:"density,omitempty"`
+	// From the tape capacity log page (0x31); zero when the drive does not
+	// report it
+	MaximumBytes   int64 `json:"maximum_bytes,omitempty"`
+	RemainingBytes int64 `json:"remaining_bytes,omitempty"`
+}
+
+// ReadMediaInfo returns the generation and capacity of the loaded tape. The
+// capacity comes from sg_logs and is left at zero for virtual drives or
+// when sg_logs is not installed.
+func (s *Service) ReadMediaInfo(ctx context.Context) (*MediaInfo, error) {
+	s.deviceMu.Lock()
+	defer s.deviceMu.Unlock()
+	status, err := s.getStatusLocked(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if status.Error != "" {
+		return nil, fmt.Errorf("drive error: %s", status.Error)
+	}
+
+	info := &MediaInfo{LTOType: status.DriveType, Density: status.Density}
+	if info.LTOType == "" && status.Density != "" {
+		info.LTOType, _ = models.LTOTypeFromDensity(status.Density)
+	}
+	if s.IsPhysical() {
+		output, err := exec.CommandContext(ctx, "sg_logs", "-p", "0x31", s.devicePath).CombinedOutput()
+		if err == nil {
+			parseTapeCapacityPage(string(output), info)
+		}
+	}
+	return info, nil
+}
+
+// parseTapeCapacityPage parses sg_logs tape capacity page (0x31) output.
+// Values are reported in MiB for the main partition.
+func parseTapeCapacityPage(output string, info *MediaInfo) {
+	scanner := bufio.NewScanner(strings.NewReader(output))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		switch {
+		case strings.HasPrefix(line, "Main partition remaining capacity"):
+			info.RemainingBytes = extractSgLogsColonValue(line) * 1024 * 1024
+		case strings.HasPrefix(line, "Main partition maximum capacity"):
+			info.MaximumBytes = extractSgLogsColonValue(line) * 1024 * 1024
+		}
+	}
+}
+
 // WaitForTape waits for a tape to be loaded
 func (s *Service) WaitForTape(ctx context.Context, timeout time.Duration) error {
 	deadline := time.Now().Add(timeout)
@@ -910,8 +990,14 @@ func (s *Service) ListTapeContents(ctx context.Context, maxEntries int) ([]TapeC
 	tarCtx, cancel := context.WithTimeout(ctx, 60*time.Second)
 	defer cancel()
 
-	cmd := exec.CommandContext(tarCtx, "tar", "-tvf", s.devicePath)
-	output, err := cmd.CombinedOutput()
+	var output []byte
+	var err error
+	if s.IsPhysical() {
+		cmd := exec.CommandContext(tarCtx, "tar", "-tvf", s.devicePath)
+		output, err = cmd.CombinedOutput()
+	} else {
+		output, err = s.listVirtualContents(tarCtx)
+	}
 	if err != nil {
 		// Could be encrypted data or not a tar archive - return empty list
 		return []TapeContentEntry{}, nil
@@ -944,6 +1030,20 @@ func (s *Service) ListTapeContents(ctx context.Context, maxEntries int) ([]TapeC
 	return entries, nil
 }
 
+// listVirtualContents runs tar -tv over the current tape file of a virtual
+// backend, which tar cannot open by path.
+// The caller must hold s.deviceMu.
+func (s *Service) listVirtualContents(ctx context.Context) ([]byte, error) {
+	r, err := s.backend.OpenReader(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	cmd := exec.CommandContext(ctx, "tar", "-tv")
+	cmd.Stdin = r
+	return cmd.CombinedOutput()
+}
+
 // DriveStatisticsData holds parsed drive statistics from tapeinfo/sg_logs
 type DriveStatisticsData struct {
 	TotalBytesRead      int64   `json:"total_bytes_read"`
@@ -967,6 +1067,16 @@ type DriveStatisticsData struct {
 func (s *Service) ForceClean(ctx context.Context) error {
 	s.deviceMu.Lock()
 	defer s.deviceMu.Unlock()
+	if !s.IsPhysical() {
+		if err := s.backend.Eject(ctx); err != nil {
+			return err
+		}
+		if s.labelCache != nil {
+			s.labelCache.InvalidateReason(s.devicePath, "clean")
+		}
+		s.probes.Invalidate(s.devicePath)
+		return nil
+	}
 	// rewoffl (rewind-offline) ejects the tape, which is the preparatory step for
 	// loading a cleaning cartridge. LTO drives auto-detect cleaning tapes on load.
 	cmd := exec.CommandContext(ctx, "mt", "-f", s.devicePath, "rewoffl")
@@ -975,8 +1085,9 @@ func (s *Service) ForceClean(ctx context.Context) error {
 		return fmt.Errorf("force clean failed: %s", string(output))
 	}
 	if s.labelCache != nil {
-		s.labelCache.Invalidate(s.devicePath)
+		s.labelCache.InvalidateReason(s.devicePath, "clean")
 	}
+	s.probes.Invalidate(s.devicePath)
 	return nil
 }
 
@@ -1013,18 +1124,28 @@ type TapeTOC struct {
 
 // TOCBackupSet represents a single backup set entry in the TOC
 type TOCBackupSet struct {
-	FileNumber      int            `json:"file_number"`
-	JobName         string         `json:"job_name,omitempty"`
-	BackupType      string         `json:"backup_type"`
-	StartTime       time.Time      `json:"start_time"`
-	EndTime         time.Time      `json:"end_time"`
-	FileCount       int64          `json:"file_count"`
-	TotalBytes      int64          `json:"total_bytes"`
-	Encrypted       bool           `json:"encrypted"`
-	HwEncrypted     bool           `json:"hw_encrypted,omitempty"`
-	Compressed      bool           `json:"compressed"`
-	CompressionType string         `json:"compression_type,omitempty"`
-	Files           []TOCFileEntry `json:"files"`
+	FileNumber int       `json:"file_number"`
+	JobName    string    `json:"job_name,omitempty"`
+	BackupType string    `json:"backup_type"`
+	StartTime  time.Time `json:"start_time"`
+	EndTime    time.Time `json:"end_time"`
+	FileCount  int64     `json:"file_count"`
+	TotalBytes int64     `json:"total_bytes"`
+	Encrypted  bool      `json:"encrypted"`
+	// Encryption records the format, KDF, salt and IV of an encrypted set so
+	// the tape can be restored without the database.
+	Encryption      *models.EncryptionMetadata `json:"encryption,omitempty"`
+	HwEncrypted     bool                       `json:"hw_encrypted,omitempty"`
+	Compressed      bool                       `json:"compressed"`
+	CompressionType string                     `json:"compression_type,omitempty"`
+	// StreamStages are the stages the tar stream went through before
+	// compression, in the order they were applied
+	StreamStages []models.StreamStage `json:"stream_stages,omitempty"`
+	// NDMPType is set on images a NAS wrote over NDMP, which are in the
+	// NAS's own format (dump, tar, ...) rather than a TapeBackarr stream
+	NDMPType  string         `json:"ndmp_type,omitempty"`
+	NDMPLevel *int           `json:"ndmp_level,omitempty"`
+	Files     []TOCFileEntry `json:"files"`
 }
 
 // TOCFileEntry represents a single file entry in the TOC
@@ -1084,16 +1205,9 @@ func (s *Service) WriteTOC(ctx context.Context, toc *TapeTOC) error {
 		tocData = append(tocData, make([]byte, padSize)...)
 	}
 
-	// Write TOC data to tape using dd
-	cmd := exec.CommandContext(ctx, "dd",
-		fmt.Sprintf("of=%s", s.devicePath),
-		fmt.Sprintf("bs=%d", tocBlockSize),
-		fmt.Sprintf("count=%d", len(tocData)/tocBlockSize),
-	)
-	cmd.Stdin = bytes.NewReader(tocData)
-	output, err := cmd.CombinedOutput()
-	if err != nil {
-		return fmt.Errorf("failed to write TOC to tape: %s", string(output))
+	// Write TOC data to tape in 64KB blocks
+	if err := s.backend.WriteBlocks(ctx, tocBlockSize, tocData); err != nil {
+		return fmt.Errorf("failed to write TOC to tape: %w", err)
 	}
 
 	// Write a file mark after the TOC data
@@ -1110,6 +1224,9 @@ func (s *Service) GetDriveStatistics(ctx context.Context) (*DriveStatisticsData,
 	defer s.deviceMu.Unlock()
 
 	stats := &DriveStatisticsData{}
+	if !s.IsPhysical() {
+		return stats, nil
+	}
 
 	// Try tapeinfo first
 	cmd := exec.CommandContext(ctx, "tapeinfo", "-f", s.devicePath)
@@ -1188,13 +1305,8 @@ func (s *Service) ReadTOC(ctx context.Context) (*TapeTOC, error) {
 	s.deviceMu.Lock()
 	defer s.deviceMu.Unlock()
 
-	// Read TOC data from tape using dd with a reasonable max size (16MB)
-	cmd := exec.CommandContext(ctx, "dd",
-		fmt.Sprintf("if=%s", s.devicePath),
-		fmt.Sprintf("bs=%d", tocBlockSize),
-		"count=256", // Up to 16MB of TOC data
-	)
-	output, err := cmd.Output()
+	// Read TOC data from tape with a reasonable max size (16MB)
+	output, err := s.backend.ReadBlocks(ctx, tocBlockSize, 256)
 	if err != nil {
 		return nil, fmt.Errorf("failed to read TOC from tape: %w", err)
 	}
@@ -1346,6 +1458,9 @@ type HardwareEncryptionStatus struct {
 func (s *Service) SetHardwareEncryption(ctx context.Context, keyData []byte) error {
 	s.deviceMu.Lock()
 	defer s.deviceMu.Unlock()
+	if !s.IsPhysical() {
+		return fmt.Errorf("hardware encryption: %w", ErrNotSupported)
+	}
 
 	if len(keyData) != 32 {
 		return fmt.Errorf("hardware encryption requires a 256-bit (32-byte) key, got %d bytes", len(keyData))
@@ -1387,6 +1502,9 @@ func (s *Service) SetHardwareEncryption(ctx context.Context, keyData []byte) err
 func (s *Service) ClearHardwareEncryption(ctx context.Context) error {
 	s.deviceMu.Lock()
 	defer s.deviceMu.Unlock()
+	if !s.IsPhysical() {
+		return fmt.Errorf("hardware encryption: %w", ErrNotSupported)
+	}
 
 	opCtx, cancel := context.WithTimeout(ctx, DefaultOperationTimeout)
 	defer cancel()
@@ -1411,6 +1529,9 @@ func (s *Service) GetHardwareEncryptionStatus(ctx context.Context) (*HardwareEnc
 	status := &HardwareEncryptionStatus{
 		Mode: "off",
 	}
+	if !s.IsPhysical() {
+		return status, nil
+	}
 
 	opCtx, cancel := context.WithTimeout(ctx, DefaultOperationTimeout)
 	defer cancel()
@@ -458,6 +458,55 @@ func TestLabelCacheOperations(t *testing.T) {
 	}
 }
 
+func TestLabelCacheSharedAcrossServices(t *testing.T) {
+	a := NewServiceForDevice("/dev/nst-shared-test", 65536)
+	b := NewServiceForDevice("/dev/nst-shared-test", 65536)
+	if a.GetLabelCache() != b.GetLabelCache() || a.GetLabelCache() != SharedLabelCache() {
+		t.Fatal("expected per-device services to share the label cache")
+	}
+
+	a.GetLabelCache().Set("/dev/nst-shared-test", &TapeLabelData{Label: "OLD-001"}, true)
+	b.GetLabelCache().InvalidateReason("/dev/nst-shared-test", "erase")
+	if entry := a.GetLabelCache().Get("/dev/nst-shared-test", DefaultLabelCacheTTL); entry != nil {
+		t.Error("expected invalidation through one service to be visible to the other")
+	}
+}
+
+func TestLabelCacheEntries(t *testing.T) {
+	cache := NewLabelCache()
+	cache.Set("/dev/nst1", &TapeLabelData{Label: "TAPE-002"}, true)
+	cache.Set("/dev/nst0", &TapeLabelData{Label: "TAPE-001"}, true)
+	cache.InvalidateReason("/dev/nst0", "library_unload")
+
+	entries := cache.Entries(DefaultLabelCacheTTL)
+	if len(entries) != 2 {
+		t.Fatalf("expected 2 entries, got %d", len(entries))
+	}
+	if entries[0].DevicePath != "/dev/nst0" || entries[0].Cached {
+		t.Errorf("expected /dev/nst0 to be listed as not cached, got %+v", entries[0])
+	}
+	if entries[0].InvalidateReason != "library_unload" || entries[0].InvalidatedAt == nil {
+		t.Errorf("expected invalidation reason to be recorded, got %+v", entries[0])
+	}
+	if !entries[1].Cached || entries[1].Label.Label != "TAPE-002" || entries[1].Expired {
+		t.Errorf("expected fresh cached entry for /dev/nst1, got %+v", entries[1])
+	}
+
+	if expired := cache.Entries(0); !expired[1].Expired {
+		t.Error("expected entry to be reported expired with zero TTL")
+	}
+
+	cache.InvalidateAllReason("restart")
+	for _, e := range cache.Entries(DefaultLabelCacheTTL) {
+		if e.Cached {
+			t.Errorf("expected %s to be cleared", e.DevicePath)
+		}
+	}
+	if e := cache.Entries(DefaultLabelCacheTTL)[1]; e.InvalidateReason != "restart" {
+		t.Errorf("expected InvalidateAllReason to record reason, got %q", e.InvalidateReason)
+	}
+}
+
 func TestLabelCacheExpiry(t *testing.T) {
 	cache := NewLabelCache()
 	label := &TapeLabelData{Label: "TEST-001"}
@@ -603,6 +652,23 @@ func TestParseDataCompressionPage(t *testing.T) {
 	}
 }
 
+func TestParseTapeCapacityPage(t *testing.T) {
+	output := `Tape capacity page  (LTO-5 and LTO-6 specific) [0x31]
+  Main partition remaining capacity (in MiB): 1427512
+  Alternate partition remaining capacity (in MiB): 0
+  Main partition maximum capacity (in MiB): 1430512
+  Alternate partition maximum capacity (in MiB): 0
+`
+	info := &MediaInfo{}
+	parseTapeCapacityPage(output, info)
+	if info.RemainingBytes != 1427512*1024*1024 {
+		t.Errorf("expected remaining %d, got %d", int64(1427512*1024*1024), info.RemainingBytes)
+	}
+	if info.MaximumBytes != 1430512*1024*1024 {
+		t.Errorf("expected maximum %d, got %d", int64(1430512*1024*1024), info.MaximumBytes)
+	}
+}
+
 func TestParseTapeAlertPage(t *testing.T) {
 	svc := NewService("/dev/nst0", 65536)
 
@@ -0,0 +1,587 @@
+package tape
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// virtualBlockSize is the block size used to report positions on virtual
+// media while the drive is in variable block mode.
+const virtualBlockSize = 512
+
+// vtapeStore holds the tape files of a virtual cartridge. Tape file N is
+// everything written between file mark N-1 and file mark N.
+type vtapeStore interface {
+	// Count returns the number of tape files on the cartridge
+	Count(ctx context.Context) (int64, error)
+	// Size returns the size of a tape file, or os.ErrNotExist
+	Size(ctx context.Context, index int64) (int64, error)
+	// Truncate cuts tape file index to size, creating it if needed, and
+	// removes every later tape file
+	Truncate(ctx context.Context, index, size int64) error
+	// Append opens tape file index for appending
+	Append(ctx context.Context, index int64) (io.WriteCloser, error)
+	// Open reads tape file index starting at offset
+	Open(ctx context.Context, index, offset int64) (io.ReadCloser, error)
+}
+
+// virtualTape emulates a sequential tape drive on top of a vtapeStore. It
+// tracks the head position (file number and byte offset) and applies tape
+// semantics: writing anywhere discards everything after that point, and
+// reading to the end of a tape file moves past its file mark.
+type virtualTape struct {
+	typ   BackendType
+	store vtapeStore
+
+	mu        sync.Mutex
+	file      int64
+	offset    int64
+	blockSize int
+	unloaded  bool
+}
+
+func newVirtualTape(typ BackendType, store vtapeStore) *virtualTape {
+	return &virtualTape{typ: typ, store: store}
+}
+
+func (v *virtualTape) Type() BackendType { return v.typ }
+
+func (v *virtualTape) blockLocked() int64 {
+	bs := v.blockSize
+	if bs <= 0 {
+		bs = virtualBlockSize
+	}
+	return v.offset / int64(bs)
+}
+
+func (v *virtualTape) Status(ctx context.Context) (*DriveStatus, error) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	status := &DriveStatus{
+		Online:      !v.unloaded,
+		Ready:       !v.unloaded,
+		BOT:         !v.unloaded && v.file == 0 && v.offset == 0,
+		FileNumber:  v.file,
+		BlockNumber: v.blockLocked(),
+		BlockSize:   v.blockSize,
+		LastChecked: time.Now(),
+	}
+	if v.unloaded {
+		return status, nil
+	}
+	count, err := v.store.Count(ctx)
+	if err != nil {
+		status.Error = fmt.Sprintf("failed to get tape status: %v", err)
+		return status, nil
+	}
+	status.EOF = v.file >= count
+	return status, nil
+}
+
+func (v *virtualTape) checkLoadedLocked() error {
+	if v.unloaded {
+		return fmt.Errorf("no virtual cartridge loaded")
+	}
+	return nil
+}
+
+func (v *virtualTape) Rewind(ctx context.Context) error {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if err := v.checkLoadedLocked(); err != nil {
+		return fmt.Errorf("rewind failed: %w", err)
+	}
+	v.file, v.offset = 0, 0
+	return nil
+}
+
+func (v *virtualTape) SpaceFiles(ctx context.Context, count int64) error {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if err := v.checkLoadedLocked(); err != nil {
+		return fmt.Errorf("seek failed: %w", err)
+	}
+	total, err := v.store.Count(ctx)
+	if err != nil {
+		return fmt.Errorf("seek failed: %w", err)
+	}
+	// Like fsf, spacing is allowed up to end of data but not beyond it
+	if v.file+count > total {
+		return fmt.Errorf("seek failed: file %d is beyond end of data (%d files)", v.file+count, total)
+	}
+	v.file += count
+	v.offset = 0
+	return nil
+}
+
+// SeekBlock is not supported: virtual media has no absolute block address
+// space, so callers fall back to file-number positioning.
+func (v *virtualTape) SeekBlock(ctx context.Context, block int64) error {
+	return fmt.Errorf("seek to block failed: %w", ErrNotSupported)
+}
+
+func (v *virtualTape) WriteFileMark(ctx context.Context) error {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if err := v.checkLoadedLocked(); err != nil {
+		return fmt.Errorf("write file mark failed: %w", err)
+	}
+	if err := v.store.Truncate(ctx, v.file, v.offset); err != nil {
+		return fmt.Errorf("write file mark failed: %w", err)
+	}
+	v.file++
+	v.offset = 0
+	return nil
+}
+
+func (v *virtualTape) SetBlockSize(ctx context.Context, size int) error {
+	v.mu.Lock()
+	v.blockSize = size
+	v.mu.Unlock()
+	return nil
+}
+
+func (v *virtualTape) Eject(ctx context.Context) error {
+	v.mu.Lock()
+	v.unloaded = true
+	v.file, v.offset = 0, 0
+	v.mu.Unlock()
+	return nil
+}
+
+func (v *virtualTape) Load(ctx context.Context) error {
+	v.mu.Lock()
+	v.unloaded = false
+	v.file, v.offset = 0, 0
+	v.mu.Unlock()
+	return nil
+}
+
+func (v *virtualTape) ReadBlocks(ctx context.Context, blockSize, count int) ([]byte, error) {
+	r, err := v.OpenReader(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	return io.ReadAll(io.LimitReader(r, int64(blockSize)*int64(count)))
+}
+
+func (v *virtualTape) WriteBlocks(ctx context.Context, blockSize int, data []byte) error {
+	w, err := v.OpenWriter(ctx)
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(data); err != nil {
+		w.Close()
+		return err
+	}
+	return w.Close()
+}
+
+func (v *virtualTape) OpenReader(ctx context.Context) (io.ReadCloser, error) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if err := v.checkLoadedLocked(); err != nil {
+		return nil, err
+	}
+	if _, err := v.store.Size(ctx, v.file); errors.Is(err, os.ErrNotExist) {
+		// Reading at end of data returns nothing, like a blank tape
+		return io.NopCloser(bytes.NewReader(nil)), nil
+	} else if err != nil {
+		return nil, err
+	}
+	rc, err := v.store.Open(ctx, v.file, v.offset)
+	if err != nil {
+		return nil, err
+	}
+	return &vtapeReader{v: v, rc: rc, file: v.file}, nil
+}
+
+func (v *virtualTape) OpenWriter(ctx context.Context) (io.WriteCloser, error) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if err := v.checkLoadedLocked(); err != nil {
+		return nil, err
+	}
+	if err := v.store.Truncate(ctx, v.file, v.offset); err != nil {
+		return nil, err
+	}
+	wc, err := v.store.Append(ctx, v.file)
+	if err != nil {
+		return nil, err
+	}
+	return &vtapeWriter{v: v, wc: wc, file: v.file}, nil
+}
+
+// vtapeReader advances the head as data is consumed and moves past the
+// file mark once the tape file has been read to the end.
+type vtapeReader struct {
+	v    *virtualTape
+	rc   io.ReadCloser
+	file int64
+	n    int64
+	eof  bool
+}
+
+func (r *vtapeReader) Read(p []byte) (int, error) {
+	n, err := r.rc.Read(p)
+	r.n += int64(n)
+	if err == io.EOF {
+		r.eof = true
+	}
+	return n, err
+}
+
+func (r *vtapeReader) Close() error {
+	err := r.rc.Close()
+	r.v.mu.Lock()
+	if r.v.file == r.file {
+		if r.eof {
+			r.v.file++
+			r.v.offset = 0
+		} else {
+			r.v.offset += r.n
+		}
+	}
+	r.v.mu.Unlock()
+	return err
+}
+
+// vtapeWriter advances the head by the number of bytes written. Closing
+// it again is a no-op, as callers close on error paths and defer a close.
+type vtapeWriter struct {
+	v      *virtualTape
+	wc     io.WriteCloser
+	file   int64
+	n      int64
+	closed bool
+}
+
+func (w *vtapeWriter) Write(p []byte) (int, error) {
+	n, err := w.wc.Write(p)
+	w.n += int64(n)
+	return n, err
+}
+
+func (w *vtapeWriter) Close() error {
+	if w.closed {
+		return nil
+	}
+	w.closed = true
+	err := w.wc.Close()
+	w.v.mu.Lock()
+	if w.v.file == w.file {
+		w.v.offset += w.n
+	}
+	w.v.mu.Unlock()
+	return err
+}
+
+// dirStore keeps each tape file as a numbered file in a directory
+type dirStore struct {
+	dir string
+}
+
+func (d *dirStore) path(index int64) string {
+	return filepath.Join(d.dir, fmt.Sprintf("%06d.tape", index))
+}
+
+func (d *dirStore) indexes() ([]int64, error) {
+	entries, err := os.ReadDir(d.dir)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var idx []int64
+	for _, e := range entries {
+		name := e.Name()
+		if e.IsDir() || !strings.HasSuffix(name, ".tape") {
+			continue
+		}
+		n, err := strconv.ParseInt(strings.TrimSuffix(name, ".tape"), 10, 64)
+		if err == nil {
+			idx = append(idx, n)
+		}
+	}
+	sort.Slice(idx, func(i, j int) bool { return idx[i] < idx[j] })
+	return idx, nil
+}
+
+func (d *dirStore) Count(ctx context.Context) (int64, error) {
+	idx, err := d.indexes()
+	if err != nil || len(idx) == 0 {
+		return 0, err
+	}
+	return idx[len(idx)-1] + 1, nil
+}
+
+func (d *dirStore) Size(ctx context.Context, index int64) (int64, error) {
+	info, err := os.Stat(d.path(index))
+	if err != nil {
+		return 0, err
+	}
+	return info.Size(), nil
+}
+
+func (d *dirStore) Truncate(ctx context.Context, index, size int64) error {
+	if err := os.MkdirAll(d.dir, 0750); err != nil {
+		return err
+	}
+	idx, err := d.indexes()
+	if err != nil {
+		return err
+	}
+	for _, n := range idx {
+		if n > index {
+			if err := os.Remove(d.path(n)); err != nil {
+				return err
+			}
+		}
+	}
+	// Fill any gap so file numbers stay contiguous
+	for n := int64(0); n < index; n++ {
+		if _, err := os.Stat(d.path(n)); errors.Is(err, os.ErrNotExist) {
+			if err := os.WriteFile(d.path(n), nil, 0640); err != nil {
+				return err
+			}
+		}
+	}
+	f, err := os.OpenFile(d.path(index), os.O_WRONLY|os.O_CREATE, 0640)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return f.Truncate(size)
+}
+
+func (d *dirStore) Append(ctx context.Context, index int64) (io.WriteCloser, error) {
+	return os.OpenFile(d.path(index), os.O_WRONLY|os.O_APPEND, 0640)
+}
+
+func (d *dirStore) Open(ctx context.Context, index, offset int64) (io.ReadCloser, error) {
+	f, err := os.Open(d.path(index))
+	if err != nil {
+		return nil, err
+	}
+	if _, err := f.Seek(offset, io.SeekStart); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return f, nil
+}
+
+// s3Store keeps each tape file as an object under bucket/prefix, using the
+// aws CLI so that credentials come from the usual AWS configuration
+// (environment, ~/.aws, instance role). S3 objects cannot be appended to,
+// so a tape file must be written in one pass from its start.
+type s3Store struct {
+	bucket   string
+	prefix   string
+	endpoint string
+	profile  string
+}
+
+func (s *s3Store) key(index int64) string {
+	name := fmt.Sprintf("%06d.tape", index)
+	if s.prefix == "" {
+		return name
+	}
+	return s.prefix + "/" + name
+}
+
+func (s *s3Store) uri(index int64) string {
+	return fmt.Sprintf("s3://%s/%s", s.bucket, s.key(index))
+}
+
+func (s *s3Store) command(ctx context.Context, args ...string) *exec.Cmd {
+	if s.endpoint != "" {
+		args = append(args, "--endpoint-url", s.endpoint)
+	}
+	if s.profile != "" {
+		args = append(args, "--profile", s.profile)
+	}
+	return exec.CommandContext(ctx, "aws", args...)
+}
+
+// list returns the size of every tape file object under the prefix
+func (s *s3Store) list(ctx context.Context) (map[int64]int64, error) {
+	dir := fmt.Sprintf("s3://%s/", s.bucket)
+	if s.prefix != "" {
+		dir += s.prefix + "/"
+	}
+	var stderr bytes.Buffer
+	cmd := s.command(ctx, "s3", "ls", dir)
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		// aws s3 ls exits 1 when the prefix is empty
+		if exitErr, ok := err.(*exec.ExitError); ok && exitErr.ExitCode() == 1 && stderr.Len() == 0 {
+			return map[int64]int64{}, nil
+		}
+		return nil, fmt.Errorf("aws s3 ls failed: %s", strings.TrimSpace(stderr.String()))
+	}
+	return parseS3Listing(string(out)), nil
+}
+
+// parseS3Listing parses `aws s3 ls` output lines of the form
+// "2024-01-15 10:30:00     123456 000001.tape"
+func parseS3Listing(out string) map[int64]int64 {
+	files := make(map[int64]int64)
+	scanner := bufio.NewScanner(strings.NewReader(out))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) != 4 || !strings.HasSuffix(fields[3], ".tape") {
+			continue
+		}
+		n, err := strconv.ParseInt(strings.TrimSuffix(fields[3], ".tape"), 10, 64)
+		if err != nil {
+			continue
+		}
+		size, err := strconv.ParseInt(fields[2], 10, 64)
+		if err != nil {
+			continue
+		}
+		files[n] = size
+	}
+	return files
+}
+
+func (s *s3Store) Count(ctx context.Context) (int64, error) {
+	files, err := s.list(ctx)
+	if err != nil {
+		return 0, err
+	}
+	var count int64
+	for n := range files {
+		if n+1 > count {
+			count = n + 1
+		}
+	}
+	return count, nil
+}
+
+func (s *s3Store) Size(ctx context.Context, index int64) (int64, error) {
+	files, err := s.list(ctx)
+	if err != nil {
+		return 0, err
+	}
+	size, ok := files[index]
+	if !ok {
+		return 0, os.ErrNotExist
+	}
+	return size, nil
+}
+
+func (s *s3Store) Truncate(ctx context.Context, index, size int64) error {
+	files, err := s.list(ctx)
+	if err != nil {
+		return err
+	}
+	for n := range files {
+		if n > index {
+			if out, err := s.command(ctx, "s3", "rm", s.uri(n)).CombinedOutput(); err != nil {
+				return fmt.Errorf("aws s3 rm failed: %s", strings.TrimSpace(string(out)))
+			}
+		}
+	}
+	current, exists := files[index]
+	if exists && current == size {
+		return nil
+	}
+	if size != 0 {
+		return fmt.Errorf("s3 backend cannot truncate tape file %d to %d bytes: %w", index, size, ErrNotSupported)
+	}
+	// Replace the object with an empty one
+	cmd := s.command(ctx, "s3", "cp", "-", s.uri(index))
+	cmd.Stdin = bytes.NewReader(nil)
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("aws s3 cp failed: %s", strings.TrimSpace(string(out)))
+	}
+	return nil
+}
+
+func (s *s3Store) Append(ctx context.Context, index int64) (io.WriteCloser, error) {
+	if size, err := s.Size(ctx, index); err == nil && size > 0 {
+		return nil, fmt.Errorf("s3 backend cannot append to tape file %d: %w", index, ErrNotSupported)
+	}
+	cmd := s.command(ctx, "s3", "cp", "-", s.uri(index))
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("failed to start aws s3 cp: %w", err)
+	}
+	return &cmdWriter{cmd: cmd, stdin: stdin, stderr: &stderr}, nil
+}
+
+func (s *s3Store) Open(ctx context.Context, index, offset int64) (io.ReadCloser, error) {
+	cmd := s.command(ctx, "s3", "cp", s.uri(index), "-")
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("failed to start aws s3 cp: %w", err)
+	}
+	r := &cmdReader{cmd: cmd, stdout: stdout, stderr: &stderr}
+	if offset > 0 {
+		if _, err := io.CopyN(io.Discard, stdout, offset); err != nil {
+			r.Close()
+			return nil, fmt.Errorf("failed to skip to offset %d: %w", offset, err)
+		}
+	}
+	return r, nil
+}
+
+// cmdWriter streams into a command's stdin and reports its exit status on Close
+type cmdWriter struct {
+	cmd    *exec.Cmd
+	stdin  io.WriteCloser
+	stderr *bytes.Buffer
+}
+
+func (w *cmdWriter) Write(p []byte) (int, error) { return w.stdin.Write(p) }
+
+func (w *cmdWriter) Close() error {
+	w.stdin.Close()
+	if err := w.cmd.Wait(); err != nil {
+		return fmt.Errorf("%s failed: %s", w.cmd.Args[0], strings.TrimSpace(w.stderr.String()))
+	}
+	return nil
+}
+
+// cmdReader streams a command's stdout and reaps the process on Close
+type cmdReader struct {
+	cmd    *exec.Cmd
+	stdout io.ReadCloser
+	stderr *bytes.Buffer
+}
+
+func (r *cmdReader) Read(p []byte) (int, error) { return r.stdout.Read(p) }
+
+func (r *cmdReader) Close() error {
+	r.stdout.Close()
+	if err := r.cmd.Wait(); err != nil && r.stderr.Len() > 0 {
+		return fmt.Errorf("%s failed: %s", r.cmd.Args[0], strings.TrimSpace(r.stderr.String()))
+	}
+	return nil
+}
@@ -0,0 +1,200 @@
+package tape
+
+import (
+	"context"
+	"errors"
+	"io"
+	"testing"
+)
+
+func TestBackendTypeOf(t *testing.T) {
+	tests := []struct {
+		path string
+		want BackendType
+	}{
+		{"/dev/nst0", BackendTape},
+		{"file:///var/lib/tapebackarr/vtape/VT0001", BackendFile},
+		{"s3://bucket/prefix", BackendS3},
+		{"null:", BackendNull},
+		{"null:bench", BackendNull},
+	}
+	for _, tt := range tests {
+		if got := BackendTypeOf(tt.path); got != tt.want {
+			t.Errorf("BackendTypeOf(%q) = %q, want %q", tt.path, got, tt.want)
+		}
+	}
+}
+
+func TestValidateDevicePath(t *testing.T) {
+	valid := []string{"/dev/nst0", "file:///tmp/vt", "s3://bucket", "s3://bucket/a/b?endpoint=http://minio:9000", "null:"}
+	for _, p := range valid {
+		if err := ValidateDevicePath(p); err != nil {
+			t.Errorf("expected %q to be valid, got %v", p, err)
+		}
+	}
+	invalid := []string{"", "file://relative/dir", "s3:///prefix-only"}
+	for _, p := range invalid {
+		if err := ValidateDevicePath(p); err == nil {
+			t.Errorf("expected %q to be rejected", p)
+		}
+	}
+}
+
+func TestVirtualTapeRoundTrip(t *testing.T) {
+	ctx := context.Background()
+	devicePath := "file://" + t.TempDir()
+	svc := NewServiceForDevice(devicePath, 65536)
+	if svc.IsPhysical() {
+		t.Fatal("expected file backend to be virtual")
+	}
+
+	// Blank media reads as unlabeled
+	if label, err := svc.ReadTapeLabel(ctx); err != nil || label != nil {
+		t.Fatalf("expected no label on blank media, got %+v, %v", label, err)
+	}
+
+	if err := svc.WriteTapeLabel(ctx, "VT0001", "uuid-vt", "DAILY"); err != nil {
+		t.Fatalf("WriteTapeLabel: %v", err)
+	}
+	label, err := svc.ReadTapeLabel(ctx)
+	if err != nil || label == nil || label.Label != "VT0001" || label.UUID != "uuid-vt" || label.Pool != "DAILY" {
+		t.Fatalf("unexpected label %+v, %v", label, err)
+	}
+
+	// Data goes to file 1, followed by a file mark and the TOC at file 2
+	if err := svc.SeekToFileNumber(ctx, 1); err != nil {
+		t.Fatalf("SeekToFileNumber(1): %v", err)
+	}
+	w, err := svc.OpenWriter(ctx)
+	if err != nil {
+		t.Fatalf("OpenWriter: %v", err)
+	}
+	if _, err := w.Write([]byte("backup payload")); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("close: %v", err)
+	}
+	// A second close, as a deferred one, does not move the head again
+	w.Close()
+	if err := svc.WriteFileMark(ctx); err != nil {
+		t.Fatalf("WriteFileMark: %v", err)
+	}
+	if err := svc.WriteTOC(ctx, NewTapeTOC("VT0001", "uuid-vt", "DAILY")); err != nil {
+		t.Fatalf("WriteTOC: %v", err)
+	}
+	if file, _, err := svc.GetTapePosition(ctx); err != nil || file != 3 {
+		t.Errorf("expected head at file 3 after TOC, got %d (%v)", file, err)
+	}
+
+	if err := svc.SeekToFileNumber(ctx, 1); err != nil {
+		t.Fatalf("SeekToFileNumber(1): %v", err)
+	}
+	r, err := svc.OpenReader(ctx)
+	if err != nil {
+		t.Fatalf("OpenReader: %v", err)
+	}
+	data, _ := io.ReadAll(r)
+	r.Close()
+	if string(data) != "backup payload" {
+		t.Errorf("expected payload back, got %q", data)
+	}
+	// Reading to the end of the tape file moves past its file mark
+	toc, err := svc.ReadTOC(ctx)
+	if err != nil || toc.TapeLabel != "VT0001" {
+		t.Fatalf("ReadTOC after data: %+v, %v", toc, err)
+	}
+
+	// Spacing beyond end of data fails like fsf
+	if err := svc.SeekToFileNumber(ctx, 5); err == nil {
+		t.Error("expected seek beyond end of data to fail")
+	}
+
+	// Rewriting file 1 truncates everything after it
+	if err := svc.SeekToFileNumber(ctx, 1); err != nil {
+		t.Fatal(err)
+	}
+	if err := svc.WriteFileMark(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if err := svc.SeekToFileNumber(ctx, 3); err == nil {
+		t.Error("expected old TOC to be gone after overwriting file 1")
+	}
+
+	if err := svc.EraseTape(ctx); err != nil {
+		t.Fatalf("EraseTape: %v", err)
+	}
+	if label, err := svc.ReadTapeLabel(ctx); err != nil || label != nil {
+		t.Errorf("expected erased media to be unlabeled, got %+v, %v", label, err)
+	}
+}
+
+func TestVirtualTapeSharedAcrossServices(t *testing.T) {
+	ctx := context.Background()
+	devicePath := "file://" + t.TempDir()
+	if err := NewServiceForDevice(devicePath, 65536).WriteTapeLabel(ctx, "VT0002", "uuid-2", ""); err != nil {
+		t.Fatal(err)
+	}
+	other := NewServiceForDevice(devicePath, 65536)
+	if file, _, err := other.GetTapePosition(ctx); err != nil || file != 1 {
+		t.Errorf("expected position to be shared, got file %d (%v)", file, err)
+	}
+
+	if err := other.Eject(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if loaded, _ := other.IsTapeLoaded(ctx); loaded {
+		t.Error("expected virtual cartridge to be unloaded after eject")
+	}
+	if err := other.Load(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if loaded, _ := other.IsTapeLoaded(ctx); !loaded {
+		t.Error("expected virtual cartridge to be loaded after load")
+	}
+}
+
+func TestVirtualTapeUnsupportedOperations(t *testing.T) {
+	ctx := context.Background()
+	svc := NewServiceForDevice("file://"+t.TempDir(), 65536)
+	if err := svc.SetHardwareEncryption(ctx, make([]byte, 32)); !errors.Is(err, ErrNotSupported) {
+		t.Errorf("expected ErrNotSupported for hardware encryption, got %v", err)
+	}
+	if err := svc.SeekToBlock(ctx, 10); !errors.Is(err, ErrNotSupported) {
+		t.Errorf("expected ErrNotSupported for block seek, got %v", err)
+	}
+	if err := NewLTFSService(svc.DevicePath(), t.TempDir()).Mount(ctx); !errors.Is(err, ErrNotSupported) {
+		t.Errorf("expected LTFS mount to be refused, got %v", err)
+	}
+}
+
+func TestNullBackend(t *testing.T) {
+	ctx := context.Background()
+	svc := NewServiceForDevice("null:test", 65536)
+	if err := svc.WriteTapeLabel(ctx, "NULL01", "uuid-null", ""); err != nil {
+		t.Fatalf("WriteTapeLabel: %v", err)
+	}
+	w, err := svc.OpenWriter(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n, err := w.Write(make([]byte, 1<<20)); err != nil || n != 1<<20 {
+		t.Errorf("expected discard writes to succeed, got %d, %v", n, err)
+	}
+	w.Close()
+	if label, err := svc.ReadTapeLabel(ctx); err != nil || label != nil {
+		t.Errorf("expected null media to read back blank, got %+v, %v", label, err)
+	}
+}
+
+func TestParseS3Listing(t *testing.T) {
+	out := `                           PRE old/
+2024-01-15 10:30:00        512 000000.tape
+2024-01-15 10:31:00    1048576 000001.tape
+2024-01-15 10:31:05          0 notes.txt
+`
+	files := parseS3Listing(out)
+	if len(files) != 2 || files[0] != 512 || files[1] != 1048576 {
+		t.Errorf("unexpected listing %v", files)
+	}
+}
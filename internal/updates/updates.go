@@ -0,0 +1,278 @@
+// Package updates checks for new TapeBackarr releases and lists the database
+// migrations a release would apply, so an upgrade of the server that owns
+// every backup record can be planned instead of discovered.
+package updates
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/RoseOO/TapeBackarr/internal/config"
+	"github.com/RoseOO/TapeBackarr/internal/database"
+)
+
+// Release is a published release
+type Release struct {
+	Version     string    `json:"version"`
+	Name        string    `json:"name"`
+	URL         string    `json:"url"`
+	PublishedAt time.Time `json:"published_at"`
+	Notes       string    `json:"notes"`
+	Prerelease  bool      `json:"prerelease"`
+}
+
+// Status is the outcome of the last check
+type Status struct {
+	CurrentVersion  string `json:"current_version"`
+	SchemaVersion   int    `json:"schema_version"`
+	LatestVersion   string `json:"latest_version,omitempty"`
+	UpdateAvailable bool   `json:"update_available"`
+	// Releases are the releases newer than the running one, newest first
+	Releases []Release `json:"releases"`
+	// PendingMigrations are the migrations the latest release would apply
+	// to this database
+	PendingMigrations []database.Migration `json:"pending_migrations"`
+	CheckedAt         *time.Time           `json:"checked_at,omitempty"`
+	Error             string               `json:"error,omitempty"`
+}
+
+// migrationsPath is where a release keeps its migrations
+const migrationsPath = "internal/database/migrations"
+
+// Checker reads the releases of the configured GitHub repository
+type Checker struct {
+	db      *database.DB
+	current string
+	cfg     config.UpdatesConfig
+	client  *http.Client
+
+	mu   sync.Mutex
+	last *Status
+}
+
+// NewChecker creates a checker for the running version
+func NewChecker(db *database.DB, current string, cfg config.UpdatesConfig) *Checker {
+	if cfg.APIURL == "" {
+		cfg.APIURL = "https://api.github.com"
+	}
+	return &Checker{db: db, current: current, cfg: cfg, client: &http.Client{Timeout: 30 * time.Second}}
+}
+
+// Status returns the outcome of the last check, or the running version and
+// schema when there was none
+func (c *Checker) Status() *Status {
+	c.mu.Lock()
+	last := c.last
+	c.mu.Unlock()
+	if last != nil {
+		copied := *last
+		return &copied
+	}
+	st := &Status{CurrentVersion: c.current, Releases: []Release{}, PendingMigrations: []database.Migration{}}
+	st.SchemaVersion, _ = c.db.SchemaVersion()
+	return st
+}
+
+// Check fetches the releases and, when one is newer than the running
+// version, the migrations the newest would apply. A failed check is kept
+// in the status with its error.
+func (c *Checker) Check(ctx context.Context) (*Status, error) {
+	now := time.Now().UTC()
+	st := &Status{CurrentVersion: c.current, Releases: []Release{}, PendingMigrations: []database.Migration{}, CheckedAt: &now}
+	st.SchemaVersion, _ = c.db.SchemaVersion()
+
+	err := c.check(ctx, st)
+	if err != nil {
+		st.Error = err.Error()
+	}
+	c.mu.Lock()
+	c.last = st
+	c.mu.Unlock()
+	copied := *st
+	return &copied, err
+}
+
+func (c *Checker) check(ctx context.Context, st *Status) error {
+	releases, err := c.releases(ctx)
+	if err != nil {
+		return err
+	}
+	for _, r := range releases {
+		if CompareVersions(r.Version, c.current) > 0 {
+			st.Releases = append(st.Releases, r)
+		}
+	}
+	if len(st.Releases) == 0 {
+		if len(releases) > 0 {
+			st.LatestVersion = releases[0].Version
+		}
+		return nil
+	}
+	st.LatestVersion = st.Releases[0].Version
+	st.UpdateAvailable = true
+	pending, err := c.Migrations(ctx, st.LatestVersion)
+	if err != nil {
+		return fmt.Errorf("failed to list the migrations of %s: %w", st.LatestVersion, err)
+	}
+	st.PendingMigrations = pending
+	return nil
+}
+
+// githubRelease is a release as the GitHub API returns it
+type githubRelease struct {
+	TagName     string    `json:"tag_name"`
+	Name        string    `json:"name"`
+	HTMLURL     string    `json:"html_url"`
+	PublishedAt time.Time `json:"published_at"`
+	Body        string    `json:"body"`
+	Draft       bool      `json:"draft"`
+	Prerelease  bool      `json:"prerelease"`
+}
+
+// releases returns the published releases, newest version first. Drafts
+// are skipped, and prereleases unless configured.
+func (c *Checker) releases(ctx context.Context) ([]Release, error) {
+	var found []githubRelease
+	if err := c.get(ctx, fmt.Sprintf("/repos/%s/releases?per_page=50", c.cfg.Repository), &found); err != nil {
+		return nil, err
+	}
+	var releases []Release
+	for _, r := range found {
+		if r.Draft || r.Prerelease && !c.cfg.IncludePrereleases {
+			continue
+		}
+		if _, ok := parseVersion(r.TagName); !ok {
+			continue
+		}
+		releases = append(releases, Release{
+			Version:     r.TagName,
+			Name:        r.Name,
+			URL:         r.HTMLURL,
+			PublishedAt: r.PublishedAt,
+			Notes:       r.Body,
+			Prerelease:  r.Prerelease,
+		})
+	}
+	sort.SliceStable(releases, func(i, j int) bool { return CompareVersions(releases[i].Version, releases[j].Version) > 0 })
+	return releases, nil
+}
+
+// Migrations returns the migrations of a release that this database has
+// not applied yet, read from the release's source tree
+func (c *Checker) Migrations(ctx context.Context, version string) ([]database.Migration, error) {
+	var entries []struct {
+		Name string `json:"name"`
+		Type string `json:"type"`
+	}
+	path := fmt.Sprintf("/repos/%s/contents/%s?ref=%s", c.cfg.Repository, migrationsPath, url.QueryEscape(version))
+	if err := c.get(ctx, path, &entries); err != nil {
+		return nil, err
+	}
+	current, err := c.db.SchemaVersion()
+	if err != nil {
+		return nil, err
+	}
+	pending := []database.Migration{}
+	for _, e := range entries {
+		if e.Type != "file" || !strings.HasSuffix(e.Name, ".sql") {
+			continue
+		}
+		if v, ok := database.ParseMigrationName(e.Name); ok && v > current {
+			pending = append(pending, database.Migration{Version: v, Name: e.Name})
+		}
+	}
+	sort.Slice(pending, func(i, j int) bool { return pending[i].Version < pending[j].Version })
+	return pending, nil
+}
+
+// get decodes the JSON the API returns for path
+func (c *Checker) get(ctx context.Context, path string, v interface{}) error {
+	if c.cfg.Repository == "" {
+		return fmt.Errorf("no repository configured")
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, strings.TrimSuffix(c.cfg.APIURL, "/")+path, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/vnd.github+json")
+	req.Header.Set("User-Agent", "TapeBackarr/"+c.current)
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("release check failed: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("release check failed: %s returned %s", req.URL.Host, resp.Status)
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
+
+// version is a parsed semantic version
+type version struct {
+	nums [3]int
+	pre  string
+}
+
+// parseVersion splits v1.2.3-rc1 into its numbers and prerelease
+func parseVersion(v string) (version, bool) {
+	var parsed version
+	v = strings.TrimPrefix(strings.TrimSpace(v), "v")
+	v, parsed.pre, _ = strings.Cut(v, "-")
+	v, _, _ = strings.Cut(v, "+")
+	parts := strings.Split(v, ".")
+	if len(parts) == 0 || len(parts) > 3 {
+		return parsed, false
+	}
+	for i, p := range parts {
+		n, err := strconv.Atoi(p)
+		if err != nil || n < 0 {
+			return parsed, false
+		}
+		parsed.nums[i] = n
+	}
+	return parsed, true
+}
+
+// CompareVersions compares two semantic versions, with or without a
+// leading v: -1 when a is older than b, 1 when newer, 0 when equal. A
+// release is newer than its prereleases. Versions that do not parse are
+// older than any that do.
+func CompareVersions(a, b string) int {
+	va, okA := parseVersion(a)
+	vb, okB := parseVersion(b)
+	switch {
+	case !okA && !okB:
+		return 0
+	case !okA:
+		return -1
+	case !okB:
+		return 1
+	}
+	for i := range va.nums {
+		if va.nums[i] != vb.nums[i] {
+			if va.nums[i] < vb.nums[i] {
+				return -1
+			}
+			return 1
+		}
+	}
+	switch {
+	case va.pre == vb.pre:
+		return 0
+	case va.pre == "":
+		return 1
+	case vb.pre == "":
+		return -1
+	case va.pre < vb.pre:
+		return -1
+	}
+	return 1
+}
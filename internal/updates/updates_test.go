@@ -0,0 +1,119 @@
+package updates
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"github.com/RoseOO/TapeBackarr/internal/config"
+	"github.com/RoseOO/TapeBackarr/internal/database"
+)
+
+// fakeGitHub serves the releases and migration listings of a repository
+func fakeGitHub(t *testing.T, migrations map[string][]string) *httptest.Server {
+	releases := []map[string]interface{}{
+		{"tag_name": "v0.1.0", "name": "0.1.0", "html_url": "https://example.com/v0.1.0"},
+		{"tag_name": "v0.3.0-rc1", "name": "0.3.0 RC 1", "prerelease": true},
+		{"tag_name": "v0.2.0", "name": "0.2.0", "html_url": "https://example.com/v0.2.0", "body": "Notes"},
+		{"tag_name": "v0.4.0", "draft": true},
+		{"tag_name": "nightly"},
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/repos/owner/repo/releases", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(releases)
+	})
+	mux.HandleFunc("/repos/owner/repo/contents/internal/database/migrations", func(w http.ResponseWriter, r *http.Request) {
+		names, ok := migrations[r.URL.Query().Get("ref")]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		var entries []map[string]string
+		for _, name := range names {
+			entries = append(entries, map[string]string{"name": name, "type": "file"})
+		}
+		json.NewEncoder(w).Encode(entries)
+	})
+	srv := httptest.NewServer(mux)
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestCheck(t *testing.T) {
+	db, err := database.New(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("failed to create database: %v", err)
+	}
+	defer db.Close()
+	if err := db.Migrate(); err != nil {
+		t.Fatalf("failed to migrate database: %v", err)
+	}
+	current, _ := db.SchemaVersion()
+	applied := "001_initial_schema.sql"
+	next1 := "998_next.sql"
+	next2 := "999_later.sql"
+	srv := fakeGitHub(t, map[string][]string{
+		"v0.2.0":     {applied, next1, next2, "README.md"},
+		"v0.3.0-rc1": {applied, next1, next2},
+	})
+
+	checker := NewChecker(db, "0.1.0", config.UpdatesConfig{Repository: "owner/repo", APIURL: srv.URL})
+	if st := checker.Status(); st.CheckedAt != nil || st.SchemaVersion != current || st.UpdateAvailable {
+		t.Errorf("expected no check yet, got %+v", st)
+	}
+
+	st, err := checker.Check(context.Background())
+	if err != nil {
+		t.Fatalf("Check: %v", err)
+	}
+	if !st.UpdateAvailable || st.LatestVersion != "v0.2.0" || len(st.Releases) != 1 || st.Releases[0].Notes != "Notes" {
+		t.Errorf("expected v0.2.0 without prereleases and drafts, got %+v", st)
+	}
+	if len(st.PendingMigrations) != 2 || st.PendingMigrations[0].Version != 998 || st.PendingMigrations[1].Name != next2 {
+		t.Errorf("expected the two new migrations, got %+v", st.PendingMigrations)
+	}
+	if checker.Status().CheckedAt == nil {
+		t.Error("expected the check kept")
+	}
+
+	checker = NewChecker(db, "0.1.0", config.UpdatesConfig{Repository: "owner/repo", APIURL: srv.URL, IncludePrereleases: true})
+	if st, err := checker.Check(context.Background()); err != nil || st.LatestVersion != "v0.3.0-rc1" || len(st.Releases) != 2 {
+		t.Errorf("expected the release candidate first, got %+v, %v", st, err)
+	}
+
+	checker = NewChecker(db, "0.2.0", config.UpdatesConfig{Repository: "owner/repo", APIURL: srv.URL})
+	if st, err := checker.Check(context.Background()); err != nil || st.UpdateAvailable || st.LatestVersion != "v0.2.0" {
+		t.Errorf("expected no update for the latest release, got %+v, %v", st, err)
+	}
+
+	if _, err := checker.Migrations(context.Background(), "v9.9.9"); err == nil {
+		t.Error("expected an unknown release to fail")
+	}
+	checker = NewChecker(db, "0.1.0", config.UpdatesConfig{Repository: "owner/missing", APIURL: srv.URL})
+	if st, err := checker.Check(context.Background()); err == nil || st.Error == "" {
+		t.Errorf("expected the failure recorded, got %+v", st)
+	}
+}
+
+func TestCompareVersions(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want int
+	}{
+		{"v1.2.3", "1.2.3", 0},
+		{"1.10.0", "1.9.9", 1},
+		{"0.1.0", "v0.2.0", -1},
+		{"1.0.0", "1.0.0-rc1", 1},
+		{"1.0.0-rc1", "1.0.0-rc2", -1},
+		{"1.2", "1.2.0", 0},
+		{"nightly", "0.0.1", -1},
+	}
+	for _, tt := range tests {
+		if got := CompareVersions(tt.a, tt.b); got != tt.want {
+			t.Errorf("CompareVersions(%q, %q) = %d, want %d", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,128 @@
+// Package validation checks API request bodies field by field, so a client
+// learns about every invalid field at once and which field each problem is
+// in.
+package validation
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/RoseOO/TapeBackarr/internal/scheduler"
+	"github.com/RoseOO/TapeBackarr/internal/tape"
+)
+
+// FieldError is one invalid field of a request
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// Errors are the invalid fields of a request, in the order they were checked
+type Errors []FieldError
+
+func (e Errors) Error() string {
+	msgs := make([]string, len(e))
+	for i, fe := range e {
+		msgs[i] = fe.Field + ": " + fe.Message
+	}
+	return strings.Join(msgs, "; ")
+}
+
+// Validator collects the errors of one request. Each field is reported once,
+// with the first problem found in it.
+type Validator struct {
+	errs Errors
+}
+
+// New returns a Validator with no errors
+func New() *Validator {
+	return &Validator{}
+}
+
+// Add records a problem with a field unless the field already has one
+func (v *Validator) Add(field, format string, args ...interface{}) {
+	for _, fe := range v.errs {
+		if fe.Field == field {
+			return
+		}
+	}
+	v.errs = append(v.errs, FieldError{Field: field, Message: fmt.Sprintf(format, args...)})
+}
+
+// Check records err against a field when it is not nil
+func (v *Validator) Check(field string, err error) {
+	if err != nil {
+		v.Add(field, "%s", err.Error())
+	}
+}
+
+// Required checks that a string field is not empty or blank
+func (v *Validator) Required(field, value string) {
+	if strings.TrimSpace(value) == "" {
+		v.Add(field, "is required")
+	}
+}
+
+// RequiredID checks that an ID field was given
+func (v *Validator) RequiredID(field string, id int64) {
+	if id <= 0 {
+		v.Add(field, "is required")
+	}
+}
+
+// NonNegative checks that a number is not below zero
+func (v *Validator) NonNegative(field string, value int64) {
+	if value < 0 {
+		v.Add(field, "cannot be negative")
+	}
+}
+
+// Range checks that a number is between min and max inclusive
+func (v *Validator) Range(field string, value, min, max int64) {
+	if value < min || value > max {
+		v.Add(field, "must be between %d and %d", min, max)
+	}
+}
+
+// OneOf checks that a value is one of allowed
+func (v *Validator) OneOf(field, value string, allowed ...string) {
+	for _, a := range allowed {
+		if value == a {
+			return
+		}
+	}
+	v.Add(field, "must be one of: %s", strings.Join(allowed, ", "))
+}
+
+// Cron checks a six-field cron expression with seconds first. An empty
+// expression is allowed and means no schedule.
+func (v *Validator) Cron(field, expr string) {
+	if expr == "" {
+		return
+	}
+	if err := scheduler.ParseCron(expr); err != nil {
+		v.Add(field, "is not a valid cron expression: %s", err.Error())
+	}
+}
+
+// DevicePath checks that a device path names a tape drive by its absolute
+// path, or a virtual drive
+func (v *Validator) DevicePath(field, path string) {
+	if path == "" {
+		v.Add(field, "is required")
+		return
+	}
+	if tape.IsPhysicalDevice(path) && (!strings.HasPrefix(path, "/") || strings.ContainsAny(path, " \t\n")) {
+		v.Add(field, "must be an absolute device path such as /dev/nst0, or a file://, s3:// or null: virtual drive")
+		return
+	}
+	v.Check(field, tape.ValidateDevicePath(path))
+}
+
+// Err returns the recorded errors, or nil when there are none
+func (v *Validator) Err() error {
+	if len(v.errs) == 0 {
+		return nil
+	}
+	return v.errs
+}
@@ -0,0 +1,58 @@
+package validation
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestValidator(t *testing.T) {
+	v := New()
+	v.Required("name", "  ")
+	v.RequiredID("pool_id", 0)
+	v.NonNegative("retention_days", -1)
+	v.Range("percent", 101, 0, 100)
+	v.OneOf("backup_type", "differential", "full", "incremental")
+	v.Cron("schedule_cron", "0 2 * *")
+	v.DevicePath("device_path", "nst0")
+	v.Check("owner_id", errors.New("does not refer to an existing user"))
+	// A field is reported once, with its first problem
+	v.Add("name", "is too long")
+
+	var errs Errors
+	if !errors.As(v.Err(), &errs) {
+		t.Fatalf("expected Errors, got %v", v.Err())
+	}
+	want := map[string]string{
+		"name":           "is required",
+		"pool_id":        "is required",
+		"retention_days": "cannot be negative",
+		"percent":        "must be between 0 and 100",
+		"backup_type":    "must be one of: full, incremental",
+		"schedule_cron":  "is not a valid cron expression",
+		"device_path":    "must be an absolute device path",
+		"owner_id":       "does not refer to an existing user",
+	}
+	if len(errs) != len(want) {
+		t.Fatalf("expected %d errors, got %v", len(want), errs)
+	}
+	for _, fe := range errs {
+		if !strings.HasPrefix(fe.Message, want[fe.Field]) {
+			t.Errorf("%s: expected %q, got %q", fe.Field, want[fe.Field], fe.Message)
+		}
+	}
+	if !strings.HasPrefix(errs.Error(), "name: is required; pool_id: is required") {
+		t.Errorf("unexpected message %q", errs.Error())
+	}
+
+	v = New()
+	v.Required("name", "Nightly")
+	v.OneOf("backup_type", "full", "full", "incremental")
+	v.Cron("schedule_cron", "")
+	v.Cron("schedule_cron", "0 0 2 * * *")
+	v.DevicePath("device_path", "/dev/nst0")
+	v.DevicePath("virtual", "file:///var/lib/tapebackarr/vtape")
+	if err := v.Err(); err != nil {
+		t.Errorf("expected no errors, got %v", err)
+	}
+}
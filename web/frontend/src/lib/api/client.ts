@@ -1,5 +1,29 @@
 const API_BASE = '/api/v1';
 
+// ApiError carries the machine-readable fields of an API error response
+export class ApiError extends Error {
+  code: string;
+  retryable: boolean;
+  details: unknown;
+  requestId: string;
+  status: number;
+
+  constructor(status: number, body: any, fallback: string) {
+    super(body?.message || body?.error || fallback);
+    this.name = 'ApiError';
+    this.status = status;
+    this.code = body?.code || '';
+    this.retryable = !!body?.retryable;
+    this.details = body?.details;
+    this.requestId = body?.request_id || '';
+  }
+}
+
+async function apiError(response: Response, fallback: string): Promise<ApiError> {
+  const body = await response.json().catch(() => ({ error: fallback }));
+  return new ApiError(response.status, body, fallback);
+}
+
 async function fetchApi(endpoint: string, options: RequestInit = {}) {
   const token = typeof window !== 'undefined' ? localStorage.getItem('token') : null;
   
@@ -27,8 +51,7 @@ async function fetchApi(endpoint: string, options: RequestInit = {}) {
   }
 
   if (!response.ok) {
-    const error = await response.json().catch(() => ({ error: 'Request failed' }));
-    throw new Error(error.error || 'Request failed');
+    throw await apiError(response, 'Request failed');
   }
 
   // Handle empty or non-JSON responses gracefully
@@ -173,6 +196,18 @@ export async function readTapeLabel(id: number, driveId: number) {
   return fetchApi(`/tapes/${id}/read-label?drive_id=${driveId}`);
 }
 
+// Operator kiosk
+export async function getKioskStatus() {
+  return fetchApi('/kiosk');
+}
+
+export async function confirmTapeLoaded(requestId: number, tapeLabel?: string) {
+  return fetchApi(`/kiosk/tape-requests/${requestId}/loaded`, {
+    method: 'POST',
+    body: JSON.stringify(tapeLabel ? { tape_label: tapeLabel } : {}),
+  });
+}
+
 // Active/running jobs
 export async function getActiveJobs() {
   return fetchApi('/jobs/active');
@@ -221,20 +256,26 @@ export async function getSource(id: number) {
   return fetchApi(`/sources/${id}`);
 }
 
-export async function createSource(data: { name: string; source_type: string; path: string; include_patterns?: string[]; exclude_patterns?: string[] }) {
+export async function createSource(data: { name: string; source_type: string; path: string; include_patterns?: string[]; exclude_patterns?: string[]; credential_id?: number; mount_options?: string }) {
   return fetchApi('/sources', {
     method: 'POST',
     body: JSON.stringify(data),
   });
 }
 
-export async function updateSource(id: number, data: { name?: string; path?: string; include_patterns?: string[]; exclude_patterns?: string[]; enabled?: boolean }) {
+export async function updateSource(id: number, data: { name?: string; path?: string; include_patterns?: string[]; exclude_patterns?: string[]; enabled?: boolean; credential_id?: number; mount_options?: string }) {
   return fetchApi(`/sources/${id}`, {
     method: 'PUT',
     body: JSON.stringify(data),
   });
 }
 
+export async function testSource(id: number) {
+  return fetchApi(`/sources/${id}/test`, {
+    method: 'POST',
+  });
+}
+
 export async function deleteSource(id: number) {
   return fetchApi(`/sources/${id}`, {
     method: 'DELETE',
@@ -419,8 +460,7 @@ export async function getKeySheetText() {
   }
   const response = await fetch(`${API_BASE}/encryption-keys/keysheet/text`, { headers });
   if (!response.ok) {
-    const error = await response.json().catch(() => ({ error: 'Request failed' }));
-    throw new Error(error.error || 'Request failed');
+    throw await apiError(response, 'Request failed');
   }
   return response.text();
 }
@@ -443,6 +483,12 @@ export async function testTelegramNotification() {
   });
 }
 
+export async function testEmailNotification() {
+  return fetchApi('/settings/email/test', {
+    method: 'POST',
+  });
+}
+
 // Get LTO type capacity mapping
 export async function getLTOTypes(): Promise<Record<string, number>> {
   return fetchApi('/tapes/lto-types');
@@ -482,8 +528,7 @@ export async function downloadDatabase() {
   }
   const response = await fetch(`${API_BASE}/database-backup/download`, { headers });
   if (!response.ok) {
-    const error = await response.json().catch(() => ({ error: 'Download failed' }));
-    throw new Error(error.error || 'Download failed');
+    throw await apiError(response, 'Download failed');
   }
   const blob = await response.blob();
   const disposition = response.headers.get('Content-Disposition');
@@ -524,8 +569,7 @@ export async function uploadDatabase(file: File) {
     throw new Error('Unauthorized');
   }
   if (!response.ok) {
-    const error = await response.json().catch(() => ({ error: 'Upload failed' }));
-    throw new Error(error.error || 'Upload failed');
+    throw await apiError(response, 'Upload failed');
   }
   return response.json();
 }
@@ -551,6 +595,17 @@ export async function inspectTape(driveId: number) {
   return fetchApi(`/drives/${driveId}/inspect-tape`);
 }
 
+// Release check
+export async function getUpdateStatus() {
+  return fetchApi('/updates');
+}
+
+export async function checkForUpdates() {
+  return fetchApi('/updates/check', {
+    method: 'POST',
+  });
+}
+
 // Restart TapeBackarr service
 export async function restartService() {
   return fetchApi('/settings/restart', {
@@ -670,6 +725,12 @@ export async function libraryInventory(id: number) {
   });
 }
 
+export async function libraryAudit(id: number) {
+  return fetchApi(`/libraries/${id}/audit`, {
+    method: 'POST',
+  });
+}
+
 export async function getLibrarySlots(id: number) {
   return fetchApi(`/libraries/${id}/slots`);
 }
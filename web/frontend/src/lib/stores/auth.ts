@@ -3,7 +3,7 @@ import { writable } from 'svelte/store';
 interface User {
   id: number;
   username: string;
-  role: 'admin' | 'operator' | 'readonly';
+  role: 'admin' | 'operator' | 'restore_operator' | 'readonly' | 'kiosk';
 }
 
 interface AuthState {